@@ -0,0 +1,229 @@
+// Command agent runs on a node and connects it to the panel. It registers
+// with a one-time enrollment token, reports the capacity and health of
+// the machine with a heartbeat, and runs the tasks the panel queues for
+// the node, streaming their output back.
+//
+// A task names an action: an executable of that name in the actions
+// directory. It is run with the task args as JSON on stdin, and the last
+// line it prints to stdout is its result. Only tasks signed with the key
+// the panel handed out at registration are run.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	agentv1 "github.com/openhost/openhost/pkg/proto/agent/v1"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const (
+	defaultHeartbeat = 30 * time.Second
+	maxBackoff       = time.Minute
+)
+
+func main() {
+	panel := flag.String("panel", "", "Address of the panel's agent API, host:port")
+	enroll := flag.String("enroll", "", "Enrollment token to register the node with")
+	statePath := flag.String("state", "/var/lib/openhost-agent/state.json", "File the node credentials are kept in")
+	actions := flag.String("actions", "/etc/openhost-agent/actions", "Directory of the executables tasks run")
+	caFile := flag.String("ca", "", "CA certificate to verify the panel with, instead of the system roots")
+	plaintext := flag.Bool("insecure", false, "Connect without TLS, only for a private network")
+	disk := flag.String("disk", "/", "Filesystem whose size and usage are reported")
+	concurrency := flag.Int("concurrency", 2, "Tasks run at the same time")
+	flag.Parse()
+
+	st, err := loadState(*statePath)
+	if err != nil {
+		log.Fatalf("read state: %v", err)
+	}
+	if *panel == "" && st != nil {
+		*panel = st.Panel
+	}
+	if *panel == "" {
+		log.Fatal("-panel is required")
+	}
+
+	conn, err := dial(*panel, *caFile, *plaintext)
+	if err != nil {
+		log.Fatalf("connect to %s: %v", *panel, err)
+	}
+	defer conn.Close()
+	client := agentv1.NewAgentServiceClient(conn)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *enroll != "" {
+		if st, err = register(ctx, client, *enroll, *disk); err != nil {
+			log.Fatalf("register: %v", err)
+		}
+		st.Panel = *panel
+		if err := saveState(*statePath, st); err != nil {
+			log.Fatalf("save state: %v", err)
+		}
+		log.Printf("registered as node %d", st.NodeID)
+	}
+	if st == nil {
+		log.Fatal("the node is not registered; run the agent once with -enroll and the token from the panel")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(st.SigningKey)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		log.Fatalf("the signing key in %s is invalid; register again with -enroll", *statePath)
+	}
+
+	a := &agent{
+		client:  client,
+		state:   st,
+		key:     ed25519.PublicKey(raw),
+		actions: *actions,
+		disk:    *disk,
+		slots:   make(chan struct{}, max(*concurrency, 1)),
+		seen:    make(map[uint64]time.Time),
+	}
+	log.Printf("agent %s running as node %d against %s", version, st.NodeID, *panel)
+	go a.heartbeats(ctx)
+	a.receive(ctx)
+	a.wait()
+}
+
+// dial connects to the panel, over TLS unless plaintext is asked for
+func dial(addr, caFile string, plaintext bool) (*grpc.ClientConn, error) {
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if plaintext {
+		creds = insecure.NewCredentials()
+	} else if caFile != "" {
+		var err error
+		if creds, err = credentials.NewClientTLSFromFile(caFile, ""); err != nil {
+			return nil, err
+		}
+	}
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		// Pings find a dead connection while the task stream is idle
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+}
+
+// register trades an enrollment token for the node credentials
+func register(ctx context.Context, client agentv1.AgentServiceClient, token, disk string) (*state, error) {
+	hostname, _ := os.Hostname()
+	capacity, _ := collect(disk)
+	callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	resp, err := client.Register(callCtx, &agentv1.RegisterRequest{
+		EnrollmentToken: token,
+		Hostname:        hostname,
+		Version:         version,
+		Os:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		Capacity:        capacity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state{NodeID: resp.NodeId, NodeToken: resp.NodeToken, SigningKey: resp.SigningKey}, nil
+}
+
+// authorized adds the node token to the metadata of a call
+func (a *agent) authorized(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+a.state.NodeToken)
+}
+
+// heartbeats reports capacity and health at the interval the panel asks
+// for until ctx is done
+func (a *agent) heartbeats(ctx context.Context) {
+	interval := defaultHeartbeat
+	for {
+		capacity, health := collect(a.disk)
+		callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		resp, err := a.client.Heartbeat(a.authorized(callCtx), &agentv1.HeartbeatRequest{
+			Version:  version,
+			Capacity: capacity,
+			Health:   health,
+		})
+		cancel()
+		if err != nil {
+			logCallError("heartbeat", err)
+		} else if resp.HeartbeatSeconds > 0 {
+			interval = time.Duration(resp.HeartbeatSeconds) * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// receive keeps a task stream open, reconnecting with backoff, and starts
+// each task it gets until ctx is done
+func (a *agent) receive(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		stream, err := a.client.Tasks(a.authorized(ctx), &agentv1.TasksRequest{})
+		if err == nil {
+			for {
+				task, recvErr := stream.Recv()
+				if recvErr != nil {
+					err = recvErr
+					break
+				}
+				backoff = time.Second
+				a.start(ctx, task)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logCallError("task stream", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// logCallError logs a failed call, pointing out when the panel no longer
+// accepts the node
+func logCallError(call string, err error) {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		log.Printf("%s: the panel refused the node token; re-enroll the node and run the agent with -enroll", call)
+	case codes.PermissionDenied:
+		log.Printf("%s: the node is disabled in the panel", call)
+	default:
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("%s: %v", call, err)
+		}
+	}
+}
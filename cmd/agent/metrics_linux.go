@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	agentv1 "github.com/openhost/openhost/pkg/proto/agent/v1"
+)
+
+// collect reads the capacity and usage of the machine from /proc and the
+// filesystem at disk. Figures that cannot be read are left at zero.
+func collect(disk string) (*agentv1.Capacity, *agentv1.Health) {
+	capacity := &agentv1.Capacity{CpuCores: int32(runtime.NumCPU())}
+	health := &agentv1.Health{}
+
+	if mem, err := readMeminfo(); err == nil {
+		capacity.MemoryBytes = mem["MemTotal"]
+		if available, ok := mem["MemAvailable"]; ok {
+			health.MemoryUsedBytes = max(mem["MemTotal"]-available, 0)
+		}
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(disk, &fs); err == nil {
+		capacity.DiskBytes = int64(fs.Blocks) * int64(fs.Bsize)
+		health.DiskUsedBytes = int64(fs.Blocks-fs.Bfree) * int64(fs.Bsize)
+	}
+	if fields := readFields("/proc/loadavg"); len(fields) > 0 {
+		health.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	if fields := readFields("/proc/uptime"); len(fields) > 0 {
+		uptime, _ := strconv.ParseFloat(fields[0], 64)
+		health.UptimeSeconds = int64(uptime)
+	}
+	return capacity, health
+}
+
+// readMeminfo returns the fields of /proc/meminfo in bytes
+func readMeminfo() (map[string]int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(value)
+		if len(parts) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(parts) > 1 && parts[1] == "kB" {
+			n *= 1024
+		}
+		fields[name] = n
+	}
+	return fields, scanner.Err()
+}
+
+func readFields(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
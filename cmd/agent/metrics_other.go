@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"runtime"
+
+	agentv1 "github.com/openhost/openhost/pkg/proto/agent/v1"
+)
+
+// collect reports only the CPU count outside Linux, where the agent does
+// not read memory, disk and load figures
+func collect(string) (*agentv1.Capacity, *agentv1.Health) {
+	return &agentv1.Capacity{CpuCores: int32(runtime.NumCPU())}, &agentv1.Health{}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// state is what the agent keeps between runs: the credentials it got
+// when it registered
+type state struct {
+	Panel      string `json:"panel"`
+	NodeID     uint64 `json:"node_id"`
+	NodeToken  string `json:"node_token"`
+	SigningKey string `json:"signing_key"` // Base64 Ed25519 public key of the panel
+}
+
+// loadState reads the state file, nil if the agent never registered
+func loadState(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// saveState writes the state file readable by its owner only, replacing
+// it in one step
+func saveState(path string, st *state) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
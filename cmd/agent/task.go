@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agentv1 "github.com/openhost/openhost/pkg/proto/agent/v1"
+)
+
+const (
+	defaultTaskTimeout = 10 * time.Minute
+	// maxLine is the longest log line sent; the rest of a line is dropped
+	maxLine = 4096
+	// Log lines are sent in batches of up to batchLines, at least every
+	// batchInterval
+	batchLines    = 50
+	batchInterval = 500 * time.Millisecond
+	// reportAttempts bounds how often a report is retried on a new stream
+	reportAttempts = 3
+)
+
+var actionPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+var errReplayed = errors.New("task was already received")
+
+// agent runs the tasks of one node
+type agent struct {
+	client  agentv1.AgentServiceClient
+	state   *state
+	key     ed25519.PublicKey
+	actions string
+	disk    string
+	slots   chan struct{} // One per task allowed to run at a time
+
+	mu      sync.Mutex
+	seen    map[uint64]time.Time // Task IDs received, until they expire
+	running sync.WaitGroup
+}
+
+// start checks a task and runs it in the background. Running tasks are
+// left to finish when the agent is stopped.
+func (a *agent) start(ctx context.Context, task *agentv1.Task) {
+	path, err := a.verify(task)
+	if errors.Is(err, errReplayed) {
+		return
+	}
+	if err != nil {
+		log.Printf("rejected task %d: %v", task.Id, err)
+		r := a.newReporter(task.Id)
+		r.finish("", "rejected by the agent: "+err.Error(), false)
+		return
+	}
+
+	a.running.Add(1)
+	go func() {
+		defer a.running.Done()
+		select {
+		case a.slots <- struct{}{}:
+		case <-ctx.Done():
+			// Not started; the panel sends it again on the next connection
+			return
+		}
+		defer func() { <-a.slots }()
+		a.run(task, path)
+	}()
+}
+
+// wait blocks until the running tasks finish
+func (a *agent) wait() {
+	a.running.Wait()
+}
+
+// verify checks that the panel signed a task for this node, that it has
+// not expired or been received before, and that its action exists. It
+// returns the path of the action.
+func (a *agent) verify(task *agentv1.Task) (string, error) {
+	if !ed25519.Verify(a.key, task.SigningPayload(), task.Signature) {
+		return "", errors.New("invalid signature")
+	}
+	if task.NodeId != a.state.NodeID {
+		return "", fmt.Errorf("task is for node %d", task.NodeId)
+	}
+	now := time.Now()
+	expires := time.Unix(task.ExpiresAt, 0)
+	if now.After(expires) {
+		return "", errors.New("task has expired")
+	}
+
+	a.mu.Lock()
+	for id, until := range a.seen {
+		if now.After(until) {
+			delete(a.seen, id)
+		}
+	}
+	_, replayed := a.seen[task.Id]
+	a.seen[task.Id] = expires
+	a.mu.Unlock()
+	if replayed {
+		return "", errReplayed
+	}
+
+	if !actionPattern.MatchString(task.Action) {
+		return "", errors.New("invalid action name")
+	}
+	path := filepath.Join(a.actions, task.Action)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("unknown action %s", task.Action)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return "", fmt.Errorf("action %s is not executable", task.Action)
+	}
+	return path, nil
+}
+
+// run executes the action of a task, streaming its output to the panel,
+// and reports how it ended
+func (a *agent) run(task *agentv1.Task, path string) {
+	r := a.newReporter(task.Id)
+	// The first report marks the task running
+	r.send(&agentv1.TaskReport{TaskId: task.Id})
+
+	timeout := time.Duration(task.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTaskTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = a.actions
+	cmd.Stdin = bytes.NewReader(task.Args)
+	cmd.Env = append(os.Environ(),
+		"OPENHOST_TASK_ID="+strconv.FormatUint(task.Id, 10),
+		"OPENHOST_NODE_ID="+strconv.FormatUint(task.NodeId, 10),
+		"OPENHOST_ACTION="+task.Action,
+	)
+	// Children left holding the output open do not hold up the task
+	cmd.WaitDelay = 5 * time.Second
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	log.Printf("running task %d: %s", task.Id, task.Action)
+	if err := cmd.Start(); err != nil {
+		r.finish("", err.Error(), false)
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		stdoutW.Close()
+		stderrW.Close()
+		done <- err
+	}()
+
+	lines := make(chan *agentv1.LogLine, batchLines)
+	var lastOut, lastErr string
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		lastOut = readLines(stdoutR, "stdout", lines)
+	}()
+	go func() {
+		defer readers.Done()
+		lastErr = readLines(stderrR, "stderr", lines)
+	}()
+	go func() {
+		readers.Wait()
+		close(lines)
+	}()
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	var batch []*agentv1.LogLine
+	flush := func() {
+		if len(batch) > 0 {
+			r.send(&agentv1.TaskReport{TaskId: task.Id, Lines: batch})
+			batch = nil
+		}
+	}
+	for open := true; open; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				open = false
+				break
+			}
+			batch = append(batch, line)
+			if len(batch) >= batchLines {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+	flush()
+
+	err := <-done
+	if err == nil {
+		log.Printf("task %d succeeded", task.Id)
+		r.finish(lastOut, "", true)
+		return
+	}
+	message := err.Error()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		message = "timed out after " + timeout.String()
+	} else if lastErr != "" {
+		message += ": " + lastErr
+	}
+	log.Printf("task %d failed: %s", task.Id, message)
+	r.finish(lastOut, message, false)
+}
+
+// readLines sends the lines of r as log lines and returns the last one
+// that was not blank
+func readLines(r io.Reader, stream string, lines chan<- *agentv1.LogLine) string {
+	reader := bufio.NewReaderSize(r, maxLine)
+	var last string
+	for {
+		line, err := readLine(reader)
+		if len(line) > 0 || err == nil {
+			text := string(line)
+			if len(bytes.TrimSpace(line)) > 0 {
+				last = text
+			}
+			lines <- &agentv1.LogLine{Stream: stream, Text: text, Time: time.Now().Unix()}
+		}
+		if err != nil {
+			// Drain what is left so the action is never blocked writing
+			io.Copy(io.Discard, reader)
+			return strings.TrimSpace(last)
+		}
+	}
+}
+
+// readLine reads a line without its ending, cut to maxLine
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, isPrefix, err := reader.ReadLine()
+	out := append([]byte(nil), line...)
+	for isPrefix && err == nil {
+		_, isPrefix, err = reader.ReadLine()
+	}
+	return bytes.TrimSuffix(out, []byte("\r")), err
+}
+
+// reporter sends the reports of one task, opening a new stream when the
+// current one breaks
+type reporter struct {
+	a      *agent
+	taskID uint64
+	stream agentv1.AgentService_ReportClient
+	cancel context.CancelFunc
+}
+
+func (a *agent) newReporter(taskID uint64) *reporter {
+	return &reporter{a: a, taskID: taskID}
+}
+
+// send sends a report, dropping it if the panel stays unreachable
+func (r *reporter) send(report *agentv1.TaskReport) {
+	for attempt := 0; attempt < reportAttempts; attempt++ {
+		if r.stream == nil {
+			if err := r.open(); err != nil {
+				logCallError(fmt.Sprintf("task %d report", r.taskID), err)
+				time.Sleep(time.Duration(attempt+1) * time.Second)
+				continue
+			}
+		}
+		if err := r.stream.Send(report); err == nil {
+			return
+		}
+		// The cause comes with the close
+		_, err := r.stream.CloseAndRecv()
+		r.close()
+		if permanent(err) {
+			logCallError(fmt.Sprintf("task %d report", r.taskID), err)
+			return
+		}
+	}
+}
+
+// finish reports the end of a task and waits for the panel to record it
+func (r *reporter) finish(output, message string, success bool) {
+	report := &agentv1.TaskReport{TaskId: r.taskID, Done: true, Success: success, Output: output, Error: message}
+	for attempt := 0; attempt < reportAttempts; attempt++ {
+		r.send(report)
+		if r.stream == nil {
+			continue
+		}
+		_, err := r.stream.CloseAndRecv()
+		r.close()
+		if err == nil {
+			return
+		}
+		logCallError(fmt.Sprintf("task %d report", r.taskID), err)
+		if permanent(err) {
+			return
+		}
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+	r.close()
+}
+
+func (r *reporter) open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := r.a.client.Report(r.a.authorized(ctx))
+	if err != nil {
+		cancel()
+		return err
+	}
+	r.stream, r.cancel = stream, cancel
+	return nil
+}
+
+func (r *reporter) close() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.stream, r.cancel = nil, nil
+}
+
+// permanent reports whether retrying a report cannot help
+func permanent(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.FailedPrecondition, codes.Unauthenticated, codes.PermissionDenied, codes.InvalidArgument:
+		return true
+	}
+	return false
+}
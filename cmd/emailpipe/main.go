@@ -1,25 +1,25 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/jhillyerd/enmime"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/spam"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
 	"github.com/openhost/openhost/internal/infrastructure/tickets"
 )
 
-var ticketIDRegex = regexp.MustCompile(`\[Ticket #(\d+)\]`)
-
 func main() {
 	dsn := strings.TrimSpace(os.Getenv("DATABASE_DSN"))
 	if dsn == "" {
@@ -36,107 +36,103 @@ func main() {
 		if err := repo.AutoMigrate(); err != nil {
 			log.Fatalf("auto migrate: %v", err)
 		}
+		if err := db.AutoMigrate(&domain.SpamListEntry{}, &domain.SpamMessage{}); err != nil {
+			log.Fatalf("auto migrate: %v", err)
+		}
 	}
 
-	if err := processEmail(os.Stdin, repo); err != nil {
-		log.Fatalf("process email: %v", err)
-	}
-}
-
-func processEmail(reader io.Reader, repo *tickets.Repository) error {
-	envelope, err := enmime.ReadEnvelope(reader)
+	maxAttachmentMB, err := envFloat("EMAILPIPE_MAX_ATTACHMENT_MB", 0)
 	if err != nil {
-		return fmt.Errorf("parse email: %w", err)
+		log.Fatal(err)
+	}
+	policy := tickets.AttachmentPolicy{MaxSize: int64(maxAttachmentMB * (1 << 20))}
+	for _, allowed := range strings.Split(os.Getenv("EMAILPIPE_ALLOWED_TYPES"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" {
+			policy.AllowedTypes = append(policy.AllowedTypes, allowed)
+		}
 	}
+	repo.SetAttachmentPolicy(policy)
 
-	subject := strings.TrimSpace(envelope.GetHeader("Subject"))
-	if subject == "" {
-		subject = "(no subject)"
+	// Attachments go to the file store of the server configuration; only
+	// without one are they kept in the database
+	configPath := strings.TrimSpace(os.Getenv("EMAILPIPE_CONFIG"))
+	if configPath == "" {
+		configPath = config.DefaultPath
+	}
+	if ok, err := config.Exists(configPath); err != nil {
+		log.Fatalf("read config: %v", err)
+	} else if ok {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			log.Fatalf("load config: %v", err)
+		}
+		files, err := storage.New(cfg.Storage)
+		if err != nil {
+			log.Fatalf("open file storage: %v", err)
+		}
+		repo.SetFileStore(files)
 	}
 
-	ticketID, err := extractTicketID(subject)
+	filter := spam.NewService(db)
+	threshold, err := envFloat("EMAILPIPE_SPAM_THRESHOLD", spam.DefaultThreshold)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-
-	body := strings.TrimSpace(envelope.Text)
-	if body == "" {
-		body = strings.TrimSpace(envelope.HTML)
+	rejectThreshold, err := envFloat("EMAILPIPE_SPAM_REJECT_THRESHOLD", spam.DefaultRejectThreshold)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if body == "" {
-		body = "(no content)"
+	filter.SetThresholds(threshold, rejectThreshold)
+	filter.SetRspamd(spam.NewRspamd(os.Getenv("EMAILPIPE_RSPAMD_URL"), os.Getenv("EMAILPIPE_RSPAMD_PASSWORD")))
+
+	if err := processEmail(os.Stdin, repo, filter); err != nil {
+		log.Fatalf("process email: %v", err)
 	}
+}
 
-	sender := strings.TrimSpace(envelope.GetHeader("From"))
-	if sender == "" {
-		sender = "unknown"
+func processEmail(reader io.Reader, repo *tickets.Repository, filter *spam.Service) error {
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("read email: %w", err)
 	}
 
-	var ticket domain.Ticket
-	if ticketID != nil {
-		ticket, err = repo.FindTicketByID(*ticketID)
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				ticket, err = createTicket(repo, subject)
-				if err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("load ticket: %w", err)
-			}
-		}
-	} else {
-		ticket, err = createTicket(repo, subject)
+	verdict, err := filter.Check(context.Background(), raw)
+	if err != nil {
+		return err
+	}
+	switch verdict.Action {
+	case spam.ActionReject:
+		// Exit cleanly: a failure would make the mail server bounce the
+		// message, answering a bounce or spammer
+		log.Printf("rejected message from %s (score %.1f): %s", verdict.Sender, verdict.Score, strings.Join(verdict.Reasons, ", "))
+		return nil
+	case spam.ActionQuarantine:
+		message, err := filter.Quarantine(raw, verdict)
 		if err != nil {
 			return err
 		}
+		log.Printf("quarantined message from %s as spam #%d (score %.1f)", verdict.Sender, message.ID, verdict.Score)
+		return nil
 	}
 
-	message := domain.TicketMessage{
-		TicketID:    ticket.ID,
-		SenderEmail: sender,
-		Body:        body,
-		IsStaff:     false,
-	}
-
-	for _, attachment := range envelope.Attachments {
-		data := attachment.Content
-		message.Attachments = append(message.Attachments, domain.TicketAttachment{
-			FileName:    attachment.FileName,
-			ContentType: attachment.ContentType,
-			SizeBytes:   int64(len(data)),
-			Data:        data,
-		})
-	}
-
-	if err := repo.CreateMessage(&message); err != nil {
+	if _, err := repo.ImportEmail(raw); err != nil {
+		if errors.Is(err, domain.ErrSenderRejected) {
+			log.Printf("rejected message from %s: %v", verdict.Sender, err)
+			return nil
+		}
 		return err
 	}
-
 	return nil
 }
 
-func extractTicketID(subject string) (*uint64, error) {
-	matches := ticketIDRegex.FindStringSubmatch(subject)
-	if len(matches) < 2 {
-		return nil, nil
+func envFloat(name string, fallback float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
 	}
-	id, err := strconv.ParseUint(matches[1], 10, 64)
+	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return nil, fmt.Errorf("parse ticket id: %w", err)
-	}
-	return &id, nil
-}
-
-func createTicket(repo *tickets.Repository, subject string) (domain.Ticket, error) {
-	ticket := domain.Ticket{
-		Subject:  subject,
-		Status:   domain.TicketStatusOpen,
-		Priority: domain.TicketPriorityNormal,
-		Source:   "email",
-	}
-	if err := repo.CreateTicket(&ticket); err != nil {
-		return domain.Ticket{}, err
+		return 0, fmt.Errorf("%s: %w", name, err)
 	}
-	return ticket, nil
+	return f, nil
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openhost/openhost/internal/core/service/adminaccess"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// runAdminAccessRecover implements "server admin-access-recover", which
+// prints a new recovery token for when every admin is locked out of the
+// admin area. A signed in admin uses it to trust their address.
+func runAdminAccessRecover(args []string) int {
+	flags := flag.NewFlagSet("admin-access-recover", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server admin-access-recover")
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", config.DefaultPath, "configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate database: %v\n", err)
+		return 1
+	}
+
+	host, _ := os.Hostname()
+	token, err := adminaccess.NewService(db).CreateRecoveryToken(nil, "", "server admin-access-recover on "+host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create recovery token: %v\n", err)
+		return 1
+	}
+	fmt.Println(token)
+	fmt.Fprintln(os.Stderr, "Sign in as an admin and send the token to POST /api/v1/admin-access/recover from the address to trust.")
+	fmt.Fprintln(os.Stderr, "It works once and replaces any previous recovery token.")
+	return 0
+}
@@ -0,0 +1,79 @@
+//go:build e2e
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/service/payment"
+)
+
+// fakeGatewaySlug is the slug of the payment gateway the suite pays with
+const fakeGatewaySlug = "e2e_fake"
+
+// fakeProcessor is a payment gateway approving every charge. It records
+// the charges made so the suite can check what reached the gateway.
+type fakeProcessor struct {
+	mu      sync.Mutex
+	charges []payment.PaymentRequest
+}
+
+var _ payment.PaymentProcessor = (*fakeProcessor)(nil)
+
+func (p *fakeProcessor) Name() string {
+	return fakeGatewaySlug
+}
+
+func (p *fakeProcessor) ProcessPayment(request *payment.PaymentRequest) (*payment.PaymentResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.charges = append(p.charges, *request)
+	id := fmt.Sprintf("fake_ch_%d", len(p.charges))
+	return &payment.PaymentResult{
+		Success:       true,
+		TransactionID: id,
+		GatewayRef:    id,
+		Amount:        request.Amount,
+		Status:        "completed",
+	}, nil
+}
+
+func (p *fakeProcessor) ProcessRefund(transactionID string, amount decimal.Decimal) (*payment.RefundResult, error) {
+	return &payment.RefundResult{
+		Success:  true,
+		RefundID: "fake_re_" + transactionID,
+		Amount:   amount,
+		Status:   "completed",
+	}, nil
+}
+
+func (p *fakeProcessor) CreateSubscription(_ *payment.SubscriptionRequest) (*payment.SubscriptionResult, error) {
+	return nil, errors.New("fake gateway has no subscriptions")
+}
+
+func (p *fakeProcessor) CancelSubscription(_ string) error {
+	return errors.New("fake gateway has no subscriptions")
+}
+
+func (p *fakeProcessor) ValidateWebhook(_ []byte, _ string) bool {
+	return true
+}
+
+func (p *fakeProcessor) GetPaymentURL(_ *payment.PaymentRequest) (string, error) {
+	return "", errors.New("fake gateway charges directly")
+}
+
+func (p *fakeProcessor) TokenizeCard(_ *payment.CardDetails) (string, error) {
+	return "fake_tok", nil
+}
+
+// Charges returns the charges the gateway approved
+func (p *fakeProcessor) Charges() []payment.PaymentRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]payment.PaymentRequest(nil), p.charges...)
+}
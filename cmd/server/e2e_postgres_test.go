@@ -0,0 +1,128 @@
+//go:build e2e
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// e2ePostgres is a disposable Postgres container
+type e2ePostgres struct {
+	container string
+	config    config.PostgresConfig
+}
+
+// startPostgres runs a Postgres container on a free local port and waits
+// until it takes connections
+func startPostgres(ctx context.Context, image string) (*e2ePostgres, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	password := hex.EncodeToString(buf)
+	name := "openhost-e2e-" + hex.EncodeToString(buf[:4])
+
+	out, err := docker(ctx, "run", "-d", "--rm", "--name", name,
+		"-e", "POSTGRES_USER=openhost",
+		"-e", "POSTGRES_PASSWORD="+password,
+		"-e", "POSTGRES_DB=openhost",
+		"-p", "127.0.0.1::5432",
+		image)
+	if err != nil {
+		return nil, err
+	}
+	pg := &e2ePostgres{container: strings.TrimSpace(out)}
+
+	mapping, err := docker(ctx, "port", pg.container, "5432/tcp")
+	if err != nil {
+		pg.stop()
+		return nil, err
+	}
+	// Docker lists one mapping per line, the IPv4 one first
+	_, portText, err := net.SplitHostPort(strings.TrimSpace(strings.SplitN(mapping, "\n", 2)[0]))
+	if err != nil {
+		pg.stop()
+		return nil, fmt.Errorf("parse port mapping %q: %w", mapping, err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		pg.stop()
+		return nil, fmt.Errorf("parse port mapping %q: %w", mapping, err)
+	}
+	pg.config = config.PostgresConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		User:     "openhost",
+		Password: password,
+		Database: "openhost",
+		SSLMode:  "disable",
+	}
+
+	if err := pg.wait(ctx, time.Minute); err != nil {
+		pg.stop()
+		return nil, err
+	}
+	return pg, nil
+}
+
+// wait polls the database until it answers. Postgres restarts once after
+// initializing, so the first successful connection may come too early.
+func (p *e2ePostgres) wait(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	ready := 0
+	var lastErr error
+	for time.Now().Before(deadline) {
+		db, err := database.Open(config.DatabaseConfig{Type: "postgres", Postgres: p.config})
+		if err == nil {
+			if sqlDB, err := db.DB(); err == nil {
+				lastErr = sqlDB.PingContext(ctx)
+				sqlDB.Close()
+			}
+		} else {
+			lastErr = err
+		}
+		if lastErr == nil {
+			if ready++; ready == 3 {
+				return nil
+			}
+		} else {
+			ready = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("postgres did not start: %v", lastErr)
+}
+
+// stop removes the container with its data
+func (p *e2ePostgres) stop() {
+	if _, err := docker(context.Background(), "rm", "-f", p.container); err != nil {
+		fmt.Printf("failed to remove container %s: %v\n", p.container, err)
+	}
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,479 @@
+//go:build e2e
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hashicorp/go-hclog"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/order"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+	"github.com/openhost/openhost/internal/infrastructure/tasks"
+)
+
+var (
+	e2eImage = flag.String("e2e.image", "postgres:16-alpine", "Postgres image the end-to-end suite runs")
+	e2eKeep  = flag.Bool("e2e.keep", false, "keep the Postgres container after the end-to-end suite")
+)
+
+// TestE2E is the end-to-end suite of the billing pipeline. It serves the
+// API against a disposable Postgres container with a fake payment
+// gateway, then takes a customer from sign up through order, invoice and
+// payment to a service provisioned by the mock driver, checking the
+// emails and webhooks queued on the way. It needs Docker and is only
+// built with the e2e tag.
+func TestE2E(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("the end-to-end suite needs Docker")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pg, err := startPostgres(ctx, *e2eImage)
+	if err != nil {
+		t.Fatalf("failed to start Postgres: %v", err)
+	}
+	if *e2eKeep {
+		t.Logf("Postgres container %s kept on port %d, password %s", pg.container, pg.config.Port, pg.config.Password)
+	} else {
+		defer pg.stop()
+	}
+
+	suite, err := newE2ESuite(ctx, config.DatabaseConfig{Type: "postgres", Postgres: pg.config})
+	if err != nil {
+		t.Fatalf("failed to start the server: %v", err)
+	}
+	defer suite.close()
+	suite.run(t)
+}
+
+// e2eSuite holds the server under test and what the steps created
+type e2eSuite struct {
+	ctx      context.Context
+	db       *gorm.DB
+	server   *httptest.Server
+	webhooks *httptest.Server
+	gateway  *fakeProcessor
+	token    string
+
+	email     string
+	gatewayID uint64
+	productID uint64
+	orderID   uint64
+	invoiceID uint64
+	serviceID uint64
+}
+
+func newE2ESuite(ctx context.Context, databaseConfig config.DatabaseConfig) (*e2eSuite, error) {
+	dir, err := os.MkdirTemp("", "openhost-e2e-")
+	if err != nil {
+		return nil, err
+	}
+	cfg := config.Config{
+		App:      config.AppConfig{Name: "OpenHost E2E", BaseURL: "http://localhost"},
+		Database: databaseConfig,
+		Storage:  config.StorageConfig{Directory: dir + "/storage"},
+		Archive:  config.ArchiveConfig{Directory: dir + "/archive"},
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		return nil, err
+	}
+	// The catalog a fresh install starts with
+	if err := ensureDefaultCatalog(db); err != nil {
+		return nil, err
+	}
+
+	fileStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	payments := registerAPIRoutes(router.Group("/api/v1"), db, cfg, fileStore)
+	gateway := &fakeProcessor{}
+	payments.RegisterProcessor(fakeGatewaySlug, gateway)
+
+	return &e2eSuite{
+		ctx:     ctx,
+		db:      db,
+		server:  httptest.NewServer(router),
+		gateway: gateway,
+		webhooks: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})),
+		email: fmt.Sprintf("e2e-%d@example.com", time.Now().UnixNano()),
+	}, nil
+}
+
+func (s *e2eSuite) close() {
+	s.server.Close()
+	s.webhooks.Close()
+}
+
+func (s *e2eSuite) run(t *testing.T) {
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"configure gateway, emails and webhooks", s.configure},
+		{"sign up with a billing address", s.signUp},
+		{"order from the cart", s.placeOrder},
+		{"invoice the order", s.invoiceOrder},
+		{"pay the invoice through the gateway", s.pay},
+		{"accept the order", s.acceptOrder},
+		{"provision the service", s.provision},
+		{"check the queued emails and webhooks", s.checkNotifications},
+	}
+	// Each step builds on the ones before, so the first failure ends the run
+	for _, step := range steps {
+		t.Logf("--- %s", step.name)
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+}
+
+// configure sets up what an admin would before taking orders: the
+// gateway, the SMTP server, the billing and welcome emails and a webhook
+// subscribed to every event
+func (s *e2eSuite) configure() error {
+	gateway := &domain.PaymentGatewayModule{
+		Name:        "Fake",
+		Slug:        fakeGatewaySlug,
+		DisplayName: "Fake card gateway",
+		Type:        domain.GatewayTypeCard,
+		FeePercent:  decimal.RequireFromString("2.9"),
+		FeeFixed:    decimal.RequireFromString("0.30"),
+		Active:      true,
+		Visible:     true,
+	}
+	if err := s.db.Create(gateway).Error; err != nil {
+		return err
+	}
+	s.gatewayID = gateway.ID
+
+	smtp := &domain.SMTPConfig{
+		Name:       "E2E",
+		Host:       "127.0.0.1",
+		Port:       2525,
+		Encryption: "none",
+		FromEmail:  "billing@example.com",
+		FromName:   "OpenHost E2E",
+		Default:    true,
+		Active:     true,
+	}
+	if err := s.db.Create(smtp).Error; err != nil {
+		return err
+	}
+	templates := map[domain.EmailTemplateType]string{
+		domain.EmailTypeInvoiceCreated: "Invoice {{.InvoiceNumber}} created",
+		domain.EmailTypeInvoicePaid:    "Invoice {{.InvoiceNumber}} paid",
+	}
+	for templateType, subject := range templates {
+		template := &domain.EmailTemplate{
+			Name:     string(templateType),
+			Type:     string(templateType),
+			Language: "en",
+			Subject:  subject,
+			BodyHTML: "<p>" + subject + "</p>",
+			Active:   true,
+		}
+		if err := s.db.Create(template).Error; err != nil {
+			return err
+		}
+	}
+
+	var product domain.Product
+	if err := s.db.Where("slug = ?", "starter-vps").First(&product).Error; err != nil {
+		return err
+	}
+	s.productID = product.ID
+	if _, err := notification.NewService(s.db).SetWelcomeEmail(product.ID, "Your {{.ProductName}} is ready", "Welcome aboard.", true); err != nil {
+		return err
+	}
+
+	webhook := &domain.WebhookConfig{
+		Name:   "E2E",
+		URL:    s.webhooks.URL,
+		Events: domain.JSONMap{"events": []interface{}{"*"}},
+		Active: true,
+	}
+	return s.db.Create(webhook).Error
+}
+
+func (s *e2eSuite) signUp() error {
+	const password = "e2e-password"
+	err := s.call(http.MethodPost, "/auth/register", map[string]interface{}{
+		"email":      s.email,
+		"password":   password,
+		"first_name": "End",
+		"last_name":  "ToEnd",
+		"currency":   "USD",
+	}, nil)
+	if err != nil {
+		return err
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := s.call(http.MethodPost, "/auth/login", map[string]string{"email": s.email, "password": password}, &login); err != nil {
+		return err
+	}
+	if login.Token == "" {
+		return errors.New("login returned no token")
+	}
+	s.token = login.Token
+
+	// Orders need a billing address
+	return s.call(http.MethodPut, "/auth/profile", map[string]string{
+		"address1":    "1 Main Street",
+		"city":        "Austin",
+		"state":       "TX",
+		"postal_code": "78701",
+		"country":     "US",
+	}, nil)
+}
+
+func (s *e2eSuite) placeOrder() error {
+	err := s.call(http.MethodPost, "/cart/items", map[string]interface{}{
+		"product_id":    s.productID,
+		"billing_cycle": "monthly",
+		"hostname":      "e2e.example.com",
+	}, nil)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		ID     uint64 `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := s.call(http.MethodPost, "/orders", nil, &created); err != nil {
+		return err
+	}
+	if created.Status != string(domain.OrderStatusPending) {
+		return fmt.Errorf("order is %s, want pending", created.Status)
+	}
+	s.orderID = created.ID
+	return nil
+}
+
+// invoiceOrder invoices the order as checkout in the client area does
+func (s *e2eSuite) invoiceOrder() error {
+	placed, err := order.NewService(s.db).GetOrder(s.orderID)
+	if err != nil {
+		return err
+	}
+	created, err := invoice.NewService(s.db).CreateInvoiceFromOrder(placed, time.Now().Add(7*24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if !created.Total.Equal(decimal.RequireFromString("19.99")) {
+		return fmt.Errorf("invoice total is %s, want 19.99", created.Total)
+	}
+	if created.Status != domain.InvoiceStatusUnpaid {
+		return fmt.Errorf("invoice is %s, want unpaid", created.Status)
+	}
+	s.invoiceID = created.ID
+	return nil
+}
+
+func (s *e2eSuite) pay() error {
+	var created struct {
+		Request struct {
+			ID uint64
+		} `json:"request"`
+	}
+	err := s.call(http.MethodPost, "/payments", map[string]interface{}{
+		"invoice_id": s.invoiceID,
+		"gateway_id": s.gatewayID,
+		"amount":     19.99,
+		"currency":   "USD",
+	}, &created)
+	if err != nil {
+		return err
+	}
+	var processed struct {
+		Success bool `json:"success"`
+	}
+	if err := s.call(http.MethodPost, fmt.Sprintf("/payments/%d/process", created.Request.ID), nil, &processed); err != nil {
+		return err
+	}
+	if !processed.Success {
+		return errors.New("payment was not successful")
+	}
+
+	charges := s.gateway.Charges()
+	if len(charges) != 1 || !charges[0].Amount.Equal(decimal.RequireFromString("19.99")) || charges[0].Currency != "USD" {
+		return fmt.Errorf("gateway charges are %+v, want one of 19.99 USD", charges)
+	}
+	var paid domain.Invoice
+	if err := s.db.First(&paid, s.invoiceID).Error; err != nil {
+		return err
+	}
+	if paid.Status != domain.InvoiceStatusPaid || !paid.Balance.IsZero() {
+		return fmt.Errorf("invoice is %s with %s due, want paid", paid.Status, paid.Balance)
+	}
+	var transaction domain.Transaction
+	if err := s.db.Where("invoice_id = ? AND type = ?", s.invoiceID, domain.TransactionTypePayment).First(&transaction).Error; err != nil {
+		return err
+	}
+	if transaction.Gateway != fakeGatewaySlug || !transaction.Fee.Equal(decimal.RequireFromString("0.87971")) {
+		return fmt.Errorf("transaction through %s with fee %s, want %s with the gateway fee", transaction.Gateway, transaction.Fee, fakeGatewaySlug)
+	}
+	return nil
+}
+
+// acceptOrder creates the services of the paid order as staff accepting
+// it do
+func (s *e2eSuite) acceptOrder() error {
+	if err := order.NewService(s.db).ActivateOrder(s.orderID); err != nil {
+		return err
+	}
+	var item domain.OrderItem
+	if err := s.db.Where("order_id = ?", s.orderID).First(&item).Error; err != nil {
+		return err
+	}
+	if item.ServiceID == nil {
+		return errors.New("accepted order has no service")
+	}
+	s.serviceID = *item.ServiceID
+	return nil
+}
+
+// provision runs the provisioning task the way the queue worker does, in
+// test mode so the mock driver creates the service
+func (s *e2eSuite) provision() error {
+	worker := tasks.NewWorker(s.db, nil, hclog.NewNullLogger())
+	worker.SetTestMode(true)
+	task, err := tasks.NewProvisionTask(s.serviceID)
+	if err != nil {
+		return err
+	}
+	if err := worker.ProcessTask(s.ctx, task); err != nil {
+		return err
+	}
+
+	var service struct {
+		Status string `json:"status"`
+	}
+	if err := s.call(http.MethodGet, fmt.Sprintf("/services/%d", s.serviceID), nil, &service); err != nil {
+		return err
+	}
+	if service.Status != string(domain.ServiceStatusActive) {
+		return fmt.Errorf("service is %s, want active", service.Status)
+	}
+	return nil
+}
+
+func (s *e2eSuite) checkNotifications() error {
+	var subjects []string
+	if err := s.db.Model(&domain.EmailQueue{}).Where("to_email = ?", s.email).Order("id").Pluck("subject", &subjects).Error; err != nil {
+		return err
+	}
+	var number string
+	if err := s.db.Model(&domain.Invoice{}).Where("id = ?", s.invoiceID).Pluck("invoice_number", &number).Error; err != nil {
+		return err
+	}
+	wantEmails := []string{
+		"Invoice " + number + " created",
+		"Invoice " + number + " paid",
+		"Your Starter VPS is ready",
+	}
+	if missing := missingFrom(subjects, wantEmails); len(missing) > 0 {
+		return fmt.Errorf("emails %q not queued, queued %q", missing, subjects)
+	}
+
+	var events []string
+	if err := s.db.Model(&domain.WebhookDelivery{}).Order("id").Pluck("event_type", &events).Error; err != nil {
+		return err
+	}
+	wantEvents := []string{notification.EventInvoiceCreated, notification.EventPaymentReceived}
+	if missing := missingFrom(events, wantEvents); len(missing) > 0 {
+		return fmt.Errorf("webhooks %q not queued, queued %q", missing, events)
+	}
+	return nil
+}
+
+// missingFrom returns the wanted values not in got
+func missingFrom(got, want []string) []string {
+	seen := make(map[string]bool, len(got))
+	for _, value := range got {
+		seen[value] = true
+	}
+	var missing []string
+	for _, value := range want {
+		if !seen[value] {
+			missing = append(missing, value)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// call sends a JSON request to the API as the signed in customer and
+// decodes the response into out
+func (s *e2eSuite) call(method, path string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(s.ctx, method, s.server.URL+"/api/v1"+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if s.token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	response, err := s.server.Client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %d %s", method, path, response.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
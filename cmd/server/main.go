@@ -1,30 +1,89 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	_ "github.com/openhost/openhost/docs"
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/addon"
+	"github.com/openhost/openhost/internal/core/service/address"
+	"github.com/openhost/openhost/internal/core/service/adminaccess"
+	"github.com/openhost/openhost/internal/core/service/adminlist"
 	"github.com/openhost/openhost/internal/core/service/affiliate"
+	"github.com/openhost/openhost/internal/core/service/agent"
+	"github.com/openhost/openhost/internal/core/service/announcement"
+	"github.com/openhost/openhost/internal/core/service/apilog"
+	"github.com/openhost/openhost/internal/core/service/approval"
+	"github.com/openhost/openhost/internal/core/service/archive"
+	"github.com/openhost/openhost/internal/core/service/assist"
 	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/automation"
+	"github.com/openhost/openhost/internal/core/service/bulk"
+	"github.com/openhost/openhost/internal/core/service/cancellation"
+	"github.com/openhost/openhost/internal/core/service/coupon"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
+	"github.com/openhost/openhost/internal/core/service/customerhealth"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/download"
+	"github.com/openhost/openhost/internal/core/service/dunning"
+	"github.com/openhost/openhost/internal/core/service/export"
+	"github.com/openhost/openhost/internal/core/service/featureflag"
 	"github.com/openhost/openhost/internal/core/service/invoice"
 	"github.com/openhost/openhost/internal/core/service/knowledgebase"
+	"github.com/openhost/openhost/internal/core/service/license"
+	"github.com/openhost/openhost/internal/core/service/maintenance"
+	"github.com/openhost/openhost/internal/core/service/media"
+	"github.com/openhost/openhost/internal/core/service/money"
+	"github.com/openhost/openhost/internal/core/service/network"
+	"github.com/openhost/openhost/internal/core/service/note"
 	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/numbering"
 	"github.com/openhost/openhost/internal/core/service/order"
 	"github.com/openhost/openhost/internal/core/service/payment"
+	"github.com/openhost/openhost/internal/core/service/pricing"
 	"github.com/openhost/openhost/internal/core/service/product"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+	"github.com/openhost/openhost/internal/core/service/recognition"
+	"github.com/openhost/openhost/internal/core/service/report"
+	"github.com/openhost/openhost/internal/core/service/routing"
+	"github.com/openhost/openhost/internal/core/service/securitymonitor"
+	"github.com/openhost/openhost/internal/core/service/servicefile"
+	"github.com/openhost/openhost/internal/core/service/spam"
+	"github.com/openhost/openhost/internal/core/service/stock"
 	"github.com/openhost/openhost/internal/core/service/subuser"
+	"github.com/openhost/openhost/internal/core/service/task"
 	"github.com/openhost/openhost/internal/core/service/ticket"
+	"github.com/openhost/openhost/internal/core/service/transfer"
+	"github.com/openhost/openhost/internal/core/service/trial"
+	"github.com/openhost/openhost/internal/core/service/vat"
+	"github.com/openhost/openhost/internal/core/service/whmcs"
+	"github.com/openhost/openhost/internal/infrastructure/agentrpc"
+	assistInfra "github.com/openhost/openhost/internal/infrastructure/assist"
+	"github.com/openhost/openhost/internal/infrastructure/backup"
 	"github.com/openhost/openhost/internal/infrastructure/config"
 	"github.com/openhost/openhost/internal/infrastructure/database"
+	"github.com/openhost/openhost/internal/infrastructure/geoip"
+	"github.com/openhost/openhost/internal/infrastructure/health"
 	"github.com/openhost/openhost/internal/infrastructure/http/handlers"
 	apiHandlers "github.com/openhost/openhost/internal/infrastructure/http/handlers/api"
+	"github.com/openhost/openhost/internal/infrastructure/httpcache"
+	"github.com/openhost/openhost/internal/infrastructure/pdf"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+	"github.com/openhost/openhost/internal/infrastructure/sysinfo"
+	"github.com/openhost/openhost/internal/infrastructure/tasks"
+	"github.com/openhost/openhost/internal/infrastructure/tickets"
 	"github.com/openhost/openhost/internal/infrastructure/web"
 )
 
@@ -33,20 +92,60 @@ import (
 // @description OpenHost API for provisioning and billing.
 // @BasePath /api/v1
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		os.Exit(runRestore(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "storage-migrate" {
+		os.Exit(runStorageMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rotate-secrets" {
+		os.Exit(runRotateSecrets(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin-access-recover" {
+		os.Exit(runAdminAccessRecover(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		os.Exit(runSeed(os.Args[2:]))
+	}
+
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(web.RequestIDMiddleware())
 	router.Use(web.SecurityHeaders())
 	router.Use(web.RecoveryMiddleware())
+	router.Use(web.GeoIPMiddleware())
 	router.Use(web.LanguageMiddleware())
 	router.Use(web.ThemeMiddleware("default"))
 	router.Use(web.CurrencyMiddleware("USD"))
+	router.Use(web.IPBanMiddleware())
+	router.Use(web.MaintenanceModeMiddleware())
+	router.Use(web.AdminAccessMiddleware())
 
 	router.NoRoute(web.NotFoundHandler)
 	router.NoMethod(web.MethodNotAllowedHandler)
 
-	// Static files
-	router.Static("/static", "./themes")
+	// Templates are cached. Outside release mode a watcher drops the
+	// cached templates of changed theme files; in production the admin
+	// API clears the cache after a theme is deployed.
+	web.GetRenderer().SetCacheEnabled(true)
+	if gin.Mode() != gin.ReleaseMode {
+		go func() {
+			if err := web.WatchTemplates(context.Background()); err != nil {
+				log.Printf("template watcher: %v", err)
+			}
+		}()
+	}
+
+	// Static files, with fingerprinted URLs from the asset template helper
+	if os.Getenv("OPENHOST_PRECOMPRESS_ASSETS") == "true" {
+		if count, err := web.DefaultAssetServer.Precompress(); err != nil {
+			log.Printf("precompress assets: %v", err)
+		} else {
+			log.Printf("precompressed %d assets", count)
+		}
+	}
+	router.GET("/static/*filepath", web.DefaultAssetServer.Handler())
+	router.HEAD("/static/*filepath", web.DefaultAssetServer.Handler())
 
 	// Frontend routes
 	router.GET("/", handlers.Root)
@@ -105,6 +204,28 @@ func main() {
 		if err != nil {
 			log.Fatalf("failed to load config: %v", err)
 		}
+		if _, err := configureSecrets(cfg.Secrets); err != nil {
+			log.Fatalf("failed to load secrets key: %v", err)
+		}
+		configureSecretResolver(cfg.Secrets)
+		// The admin allow-list checks the client address the proxies report.
+		// With no proxies listed the header is ignored and the address of
+		// the connection is used.
+		if err := router.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+			log.Fatalf("invalid app.trusted_proxies: %v", err)
+		}
+		if behindUntrustedProxy(cfg.App) {
+			log.Printf("Warning: app.base_url is https but app.trusted_proxies is empty; clients appear to come from the proxy and addresses are not banned automatically")
+		}
+		web.SetSecurityHeaders(web.SecurityOptions{
+			CSP:                   cfg.Headers.CSP,
+			CSPDisabled:           cfg.Headers.CSPDisabled,
+			CSPReportOnly:         cfg.Headers.CSPReportOnly,
+			HSTSMaxAge:            cfg.Headers.HSTSMaxAge,
+			HSTSIncludeSubdomains: cfg.Headers.HSTSIncludeSubdomains,
+			HSTSPreload:           cfg.Headers.HSTSPreload,
+			FrameOptions:          cfg.Headers.FrameOptions,
+		})
 		db, err := database.Open(cfg.Database)
 		if err != nil {
 			log.Fatalf("failed to open database: %v", err)
@@ -119,25 +240,169 @@ func main() {
 			log.Fatalf("failed to ensure default catalog: %v", err)
 		}
 		api.GET("/health", handlers.Health)
-		registerAPIRoutes(api, db)
-		registerFrontendRoutes(router, db)
+		registerHealthRoutes(router, newHealthChecker(db, cfg))
+		// Amounts in templates and API responses use the currencies
+		// configured in the database
+		moneyService := money.NewService(db)
+		if err := moneyService.LoadCurrencies(); err != nil {
+			log.Printf("load currencies: %v", err)
+		}
+		web.GetRenderer().SetMoneyService(moneyService)
+		apiHandlers.SetMoneyService(moneyService)
+		// Visitors are greeted in the currency and language of their
+		// country when the GeoIP database is configured
+		if reader, err := geoip.Open(cfg.GeoIP.DatabasePath); err != nil {
+			log.Printf("geoip: %v", err)
+		} else if reader != nil {
+			web.SetGeoIP(reader, moneyService.Active)
+		}
+
+		fileStore, err := storage.New(cfg.Storage)
+		if err != nil {
+			log.Fatalf("failed to open file storage: %v", err)
+		}
+		if local, ok := fileStore.(*storage.Local); ok {
+			router.GET(storage.LocalURLPrefix+"*key", local.Handler())
+		}
+
+		registerAPIRoutes(api, db, cfg, fileStore)
+		registerFrontendRoutes(router, db, cfg)
+		if cfg.WHMCS.Enabled {
+			registerWHMCSRoutes(router, db, cfg)
+		}
 	} else {
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(http.StatusServiceUnavailable, apiHandlers.ErrorResponse{Error: "Service not installed"})
 		})
+		registerHealthRoutes(router, nil)
 	}
 
 	_ = http.ListenAndServe(":6421", router)
 }
 
-func registerFrontendRoutes(router *gin.Engine, db *gorm.DB) {
+// registerHealthRoutes serves the Kubernetes probes. A nil checker keeps
+// the service not ready.
+func registerHealthRoutes(router *gin.Engine, checker *health.Checker) {
+	healthHandler := handlers.NewHealthHandler(checker)
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+}
+
+// newHealthChecker checks the database and its migrations, which the
+// service cannot run without, and the job queue and SMTP server, which
+// only delay background work
+func newHealthChecker(db *gorm.DB, cfg config.Config) *health.Checker {
+	checker := health.NewChecker()
+	checker.Add(health.DatabaseCheck(db))
+	checker.Add(health.MigrationCheck(db))
+	if cfg.Queue.RedisAddr != "" {
+		checker.Add(health.QueueCheck(redisClientOpt(cfg.Queue)))
+	}
+	checker.Add(health.SMTPCheck(db))
+	return checker
+}
+
+// newAddressService normalizes billing addresses with the configured API,
+// if any, before checking them
+func newAddressService(db *gorm.DB, cfg config.Config) *address.Service {
+	addressService := address.NewService(db)
+	if normalizer := address.NewHTTPNormalizer(cfg.Address.NormalizeURL, cfg.Address.APIKey); normalizer != nil {
+		addressService.SetNormalizer(normalizer)
+	}
+	return addressService
+}
+
+// newSecurityMonitor bans addresses and customers over the configured
+// limits of failed sign ins, password resets and declined payments
+func newSecurityMonitor(db *gorm.DB, cfg config.Config) *securitymonitor.Service {
+	monitor := securitymonitor.NewService(db)
+	monitor.SetLimits(securitymonitor.Limits{
+		LoginFailures:  cfg.SecurityMonitor.LoginFailures,
+		PasswordResets: cfg.SecurityMonitor.PasswordResets,
+		CardDeclines:   cfg.SecurityMonitor.CardDeclines,
+		BanDuration:    time.Duration(cfg.SecurityMonitor.BanMinutes) * time.Minute,
+	})
+	if err := monitor.SetTrusted(cfg.SecurityMonitor.TrustedIPs); err != nil {
+		log.Fatalf("invalid security_monitor.trusted_ips: %v", err)
+	}
+	monitor.SetBehindUntrustedProxy(behindUntrustedProxy(cfg.App))
+	return monitor
+}
+
+// behindUntrustedProxy reports whether the server runs behind a reverse
+// proxy missing from app.trusted_proxies. The server speaks plain HTTP, so
+// an https base URL means a proxy terminates TLS in front of it.
+func behindUntrustedProxy(cfg config.AppConfig) bool {
+	return len(cfg.TrustedProxies) == 0 && strings.HasPrefix(strings.ToLower(cfg.BaseURL), "https://")
+}
+
+// newSessionPolicy fills in the session timeouts not configured with the
+// defaults
+func newSessionPolicy(cfg config.SessionsConfig) auth.SessionPolicy {
+	policy := auth.DefaultSessionPolicy
+	policy.MaxConcurrent = cfg.MaxConcurrent
+	policy.Customer = sessionTimeouts(cfg.Customer, policy.Customer)
+	policy.Staff = sessionTimeouts(cfg.Staff, policy.Staff)
+	return policy
+}
+
+func sessionTimeouts(cfg config.SessionTimeoutsConfig, timeouts auth.SessionTimeouts) auth.SessionTimeouts {
+	if cfg.AbsoluteHours > 0 {
+		timeouts.Absolute = time.Duration(cfg.AbsoluteHours) * time.Hour
+	}
+	switch {
+	case cfg.IdleMinutes > 0:
+		timeouts.Idle = time.Duration(cfg.IdleMinutes) * time.Minute
+	case cfg.IdleMinutes < 0:
+		timeouts.Idle = 0
+	}
+	return timeouts
+}
+
+// newInvoiceRenderer renders invoice PDFs in the languages and currency
+// formats of the web pages, issued by the site and the VAT seller
+func newInvoiceRenderer(db *gorm.DB, cfg config.Config) *pdf.InvoiceRenderer {
+	vatService := vat.NewService(db)
+	return pdf.NewInvoiceRenderer(web.GetRenderer().I18nManager(), web.GetRenderer().Money(), func() pdf.Seller {
+		seller := pdf.Seller{Name: cfg.App.Name}
+		if settings, err := vatService.Settings(); err == nil {
+			seller.Country = settings.SellerCountry
+			seller.VATNumber = settings.SellerVATNumber
+		}
+		return seller
+	})
+}
+
+// newSystemInfoCollector reports the Redis queues when the job queue is
+// configured
+func newSystemInfoCollector(db *gorm.DB, cfg config.Config) *sysinfo.Collector {
+	var inspector *asynq.Inspector
+	if cfg.Queue.RedisAddr != "" {
+		inspector = asynq.NewInspector(redisClientOpt(cfg.Queue))
+	}
+	return sysinfo.NewCollector(db, cfg, inspector)
+}
+
+func registerFrontendRoutes(router *gin.Engine, db *gorm.DB, cfg config.Config) {
 	authService := auth.NewService(db)
+	authService.SetSessionPolicy(newSessionPolicy(cfg.Sessions))
+	if !cfg.SecurityMonitor.Disabled {
+		authService.SetSecurityMonitor(newSecurityMonitor(db, cfg))
+	}
 	productService := product.NewService(db)
 	orderService := order.NewService(db)
+	orderService.SetAddressService(newAddressService(db, cfg))
 	cartService := order.NewCartService(db)
 	invoiceService := invoice.NewService(db)
+	accountService := account.NewService(db)
 
-	frontendHandler := handlers.NewFrontendHandler(authService, productService, cartService, orderService, invoiceService)
+	affiliateService := affiliate.NewService(db)
+	affiliateService.SetCookieDays(cfg.Affiliate.CookieDays)
+	affiliateService.SetBaseURL(cfg.App.BaseURL)
+
+	frontendHandler := handlers.NewFrontendHandler(authService, productService, cartService, orderService, invoiceService, accountService)
+	frontendHandler.SetAffiliateService(affiliateService)
+	frontendHandler.SetVATService(vat.NewService(db))
 	frontend := router.Group("/", frontendHandler.SessionMiddleware())
 
 	frontend.GET("/login", frontendHandler.LoginForm)
@@ -146,39 +411,237 @@ func registerFrontendRoutes(router *gin.Engine, db *gorm.DB) {
 	frontend.POST("/register", frontendHandler.RegisterSubmit)
 	frontend.GET("/logout", frontendHandler.Logout)
 
+	unsubscribeHandler := handlers.NewUnsubscribeHandler(notification.NewService(db))
+	frontend.GET("/unsubscribe/:token", unsubscribeHandler.Confirm)
+	frontend.POST("/unsubscribe/:token", unsubscribeHandler.Unsubscribe)
+
+	referralHandler := handlers.NewReferralHandler(affiliateService)
+	frontend.GET("/ref/:code", referralHandler.Visit)
+	router.GET("/banners/:id/:code", referralHandler.Banner)
+
+	trackingHandler := handlers.NewTrackingHandler(notification.NewService(db))
+	router.GET("/t/o/:token", trackingHandler.Open)
+	router.GET("/t/c/:token/:position", trackingHandler.Click)
+
 	frontend.GET("/products", frontendHandler.Products)
 	frontend.GET("/order/configure/:slug", frontendHandler.ConfigureProduct)
 	frontend.POST("/order/configure/:slug", frontendHandler.AddToCartFromProduct)
 
 	frontend.GET("/cart", frontendHandler.Cart)
 	frontend.POST("/cart/coupon", frontendHandler.ApplyCoupon)
+	frontend.POST("/cart/country", frontendHandler.SetCartCountry)
 	frontend.GET("/checkout", frontendHandler.Checkout)
 	frontend.POST("/checkout", frontendHandler.PlaceOrder)
+
+	adminListHandler := handlers.NewAdminListHandler(adminlist.NewService(db))
+	adminLists := frontend.Group("/admin", adminListHandler.StaffMiddleware())
+	adminLists.GET("/customers/data", adminListHandler.Customers)
+	adminLists.GET("/orders/data", adminListHandler.Orders)
+	adminLists.GET("/invoices/data", adminListHandler.Invoices)
+	adminLists.GET("/tickets/data", adminListHandler.Tickets)
+	adminLists.GET("/tasks/data", adminListHandler.Tasks)
+	web.GetRenderer().AddHookProvider(web.NewFuncHookProvider(web.HookAdminDashboardTop, handlers.MyTasksWidget, 100))
 }
 
-func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
+// registerAPIRoutes serves the API. It returns the payment service so
+// gateways can be registered with it.
+func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB, cfg config.Config, fileStore domain.FileStore) *payment.Service {
+	// Maintenance mode holds the background jobs changing services and
+	// the webhook deliveries; they resume when it is turned off
+	maintenanceService := maintenance.NewService(db)
 	authService := auth.NewService(db)
+	authService.SetSessionPolicy(newSessionPolicy(cfg.Sessions))
 	productService := product.NewService(db)
+	addressService := newAddressService(db, cfg)
 	orderService := order.NewService(db)
+	orderService.SetAddressService(addressService)
+	go orderService.MonitorCycleChanges(context.Background(), 5*time.Minute)
 	cartService := order.NewCartService(db)
 	invoiceService := invoice.NewService(db)
+	go invoiceService.MonitorDrafts(context.Background(), 5*time.Minute)
+	dunningService := dunning.NewService(db)
+	dunningService.SetPause(maintenanceService.Active)
+	go dunningService.Monitor(context.Background(), time.Hour)
+	quarantineService := quarantine.NewService(db)
+	quarantineService.SetFileStore(fileStore)
+	quarantineService.SetScanner(storage.NewScanner(cfg.Storage.Scanner))
 	ticketService := ticket.NewService(db)
+	ticketService.SetFileStore(fileStore)
+	ticketService.SetQuarantine(quarantineService)
+	routingService := routing.NewService(db)
+	go routingService.Monitor(context.Background(), time.Minute)
+	networkService := network.NewService(db)
+	go networkService.Monitor(context.Background(), 5*time.Minute)
+	spamService := spam.NewService(db)
+	emailImporter := tickets.NewRepository(db)
+	emailImporter.SetFileStore(fileStore)
+	spamService.SetImporter(emailImporter)
 	paymentService := payment.NewService(db)
+	paymentService.SetTestMode(cfg.TestMode.Enabled)
+	if cfg.TestMode.Enabled {
+		log.Printf("test mode: charges go to gateway sandboxes and services are provisioned by the mock driver")
+	}
+	// Bans staff make apply even with the detection turned off
+	securityMonitor := newSecurityMonitor(db, cfg)
+	go securityMonitor.Monitor(context.Background(), time.Hour)
+	if !cfg.SecurityMonitor.Disabled {
+		authService.SetSecurityMonitor(securityMonitor)
+		paymentService.SetSecurityMonitor(securityMonitor)
+	}
 	affiliateService := affiliate.NewService(db)
+	affiliateService.SetCookieDays(cfg.Affiliate.CookieDays)
+	affiliateService.SetBaseURL(cfg.App.BaseURL)
 	notificationService := notification.NewService(db)
+	notificationService.SetPause(maintenanceService.Active)
+	notificationService.SetInvoiceRenderer(newInvoiceRenderer(db, cfg))
+	maintenanceService.OnResume(func() {
+		if _, err := notificationService.DeliverPendingWebhooks(time.Now()); err != nil {
+			log.Printf("webhooks: delivery failed: %v", err)
+		}
+	})
+	go notificationService.MonitorWebhooks(context.Background(), 15*time.Second)
+	notificationService.SetBaseURL(cfg.App.BaseURL)
+	go notificationService.MonitorQueue(context.Background(), 30*time.Second)
+	go notificationService.MonitorDigests(context.Background(), 15*time.Minute)
+	announcementService := announcement.NewService(db)
 	knowledgebaseService := knowledgebase.NewService(db)
+	knowledgebaseService.SetFileStore(fileStore)
+	knowledgebaseService.SetQuarantine(quarantineService)
+	downloadService := download.NewService(db)
+	downloadService.SetFileStore(fileStore)
+	downloadService.SetQuarantine(quarantineService)
+	serviceFileService := servicefile.NewService(db)
+	serviceFileService.SetFileStore(fileStore)
+	serviceFileService.SetQuarantine(quarantineService)
+	mediaService := media.NewService(db)
+	mediaService.SetFileStore(fileStore)
+	mediaService.SetQuarantine(quarantineService)
+	mediaService.SetWebPEncoder(storage.NewWebPEncoder(cfg.Media.WebPCommand))
+	mediaService.SetLimits(int64(cfg.Media.MaxFileSizeMB)<<20, cfg.Media.MaxDimension, cfg.Media.ThumbnailSize)
+	serviceFileService.SetLimits(int64(cfg.ServiceFiles.MaxFileSizeMB)<<20, int64(cfg.ServiceFiles.QuotaMB)<<20)
 	subUserService := subuser.NewService(db)
+	archiveService := archive.NewService(db, cfg.Archive.Directory)
+	go archiveService.Monitor(context.Background(), time.Hour)
+	backupService := backup.NewService(db, cfg)
+	go backupService.Monitor(context.Background(), time.Minute)
+	bulkService := bulk.NewService(db, startQueue(db, cfg.Queue, cfg.TestMode.Enabled))
+	pricingService := pricing.NewService(db)
+	go pricingService.Monitor(context.Background(), time.Minute)
+	stockService := stock.NewService(db)
+	trialService := trial.NewService(db)
+	trialService.SetPause(maintenanceService.Active)
+	go trialService.Monitor(context.Background(), time.Hour)
+	addonService := addon.NewService(db)
+	customFieldService := customfield.NewService(db)
+	cancellationService := cancellation.NewService(db)
+	cancellationService.SetPause(maintenanceService.Active)
+	go cancellationService.Monitor(context.Background(), time.Hour)
+	transferService := transfer.NewService(db)
+	accountService := account.NewService(db)
+	healthService := customerhealth.NewService(db)
+	healthService.SetAlertDrop(cfg.Health.AlertDrop)
+	go healthService.Monitor(context.Background(), 6*time.Hour)
+	recognitionService := recognition.NewService(db)
+	go recognitionService.Monitor(context.Background(), time.Hour)
+	taskService := task.NewService(db)
+	go taskService.Monitor(context.Background(), 15*time.Minute)
+	licenseService := license.NewService(db, sysinfo.Version, cfg.App.BaseURL)
+	licenseService.SetDefaultKey(cfg.License.Key)
+	licenseService.SetGracePeriod(time.Duration(cfg.License.GraceDays) * 24 * time.Hour)
+	if cfg.License.ServerURL != "" {
+		licenseService.SetServer(license.NewUpdateServer(cfg.License.ServerURL))
+		go licenseService.Monitor(context.Background(), 24*time.Hour)
+	}
+	assistService := assist.NewService(db)
+	if provider, err := assistInfra.New(cfg.Assist); err != nil {
+		log.Printf("AI assist disabled: %v", err)
+	} else {
+		assistService.SetProvider(provider)
+	}
+	assistService.SetLimits(cfg.Assist.MaxTokens)
+	if err := assistService.SetLogging(cfg.Assist.Logging); err != nil {
+		log.Fatalf("assist: %v", err)
+	}
 
-	authHandler := apiHandlers.NewAuthHandler(authService)
+	authHandler := apiHandlers.NewAuthHandler(authService, accountService)
+	web.SetMaintenance(func() web.MaintenanceState {
+		state := maintenanceService.State()
+		return web.MaintenanceState{Enabled: state.Enabled, Message: state.Message, EndsAt: state.EndsAt}
+	}, authHandler.MaintenanceBypass)
+	maintenanceHandler := apiHandlers.NewMaintenanceHandler(maintenanceService)
+	adminAccessHandler := apiHandlers.NewAdminAccessHandler(adminaccess.NewService(db), authService)
+	web.SetAdminAccess(adminAccessHandler.PageAccess)
+	securityMonitorHandler := apiHandlers.NewSecurityMonitorHandler(securityMonitor, authService)
+	web.SetIPBans(securityMonitor.IPBanned, securityMonitorHandler.BanBypass)
+	featureFlagService := featureflag.NewService(db)
+	web.SetFeatures(featureFlagService.Enabled)
+	featureFlagHandler := apiHandlers.NewFeatureFlagHandler(featureFlagService)
+	licenseHandler := apiHandlers.NewLicenseHandler(licenseService)
+	authHandler.SetAffiliateService(affiliateService)
 	productHandler := apiHandlers.NewProductHandler(productService)
-	orderHandler := apiHandlers.NewOrderHandler(orderService, cartService)
+	vatService := vat.NewService(db)
+	go vatService.Monitor(context.Background(), time.Hour)
+	orderHandler := apiHandlers.NewOrderHandler(orderService, cartService, accountService)
+	orderHandler.SetVATService(vatService)
 	invoiceHandler := apiHandlers.NewInvoiceHandler(invoiceService)
 	ticketHandler := apiHandlers.NewTicketHandler(ticketService)
 	paymentHandler := apiHandlers.NewPaymentHandler(paymentService)
 	affiliateHandler := apiHandlers.NewAffiliateHandler(affiliateService)
 	notificationHandler := apiHandlers.NewNotificationHandler(notificationService)
 	knowledgeBaseHandler := apiHandlers.NewKnowledgeBaseHandler(knowledgebaseService)
+	downloadHandler := apiHandlers.NewDownloadHandler(downloadService)
+	serviceFileHandler := apiHandlers.NewServiceFileHandler(serviceFileService)
+	quarantineHandler := apiHandlers.NewQuarantineHandler(quarantineService)
+	mediaHandler := apiHandlers.NewMediaHandler(mediaService)
+	markupHandler := apiHandlers.NewMarkupHandler()
+	spamHandler := apiHandlers.NewSpamHandler(spamService)
+	assistHandler := apiHandlers.NewAssistHandler(assistService)
+	healthHandler := apiHandlers.NewHealthHandler(healthService)
+	reportHandler := apiHandlers.NewReportHandler(report.NewService(db))
+	recognitionHandler := apiHandlers.NewRecognitionHandler(recognitionService)
+	taskHandler := apiHandlers.NewTaskHandler(taskService)
+	noteHandler := apiHandlers.NewNoteHandler(note.NewService(db), authService)
+	exportHandler := apiHandlers.NewExportHandler(export.NewService(db))
+	agentService := agent.NewService(db)
+	startAgentAPI(agentService, cfg.Agent)
+	agentHandler := apiHandlers.NewAgentHandler(agentService)
+	responseCache := newResponseCache(db, cfg.ResponseCache)
+	routingHandler := apiHandlers.NewRoutingHandler(routingService)
+	networkHandler := apiHandlers.NewNetworkHandler(networkService)
+	announcementHandler := apiHandlers.NewAnnouncementHandler(announcementService)
 	subUserHandler := apiHandlers.NewSubUserHandler(subUserService)
+	archiveHandler := apiHandlers.NewArchiveHandler(archiveService)
+	backupHandler := apiHandlers.NewBackupHandler(backupService)
+	bulkHandler := apiHandlers.NewBulkHandler(bulkService)
+	// Dangerous actions wait for a second admin when the two-person rule
+	// covers them
+	approvalService := approval.NewService(db)
+	go approvalService.Monitor(context.Background(), time.Minute)
+	orderHandler.SetApprovalService(approvalService)
+	paymentHandler.SetApprovalService(approvalService)
+	bulkHandler.SetApprovalService(approvalService)
+	approvalHandler := apiHandlers.NewApprovalHandler(approvalService)
+	pricingHandler := apiHandlers.NewPricingHandler(pricingService)
+	couponHandler := apiHandlers.NewCouponHandler(coupon.NewService(db))
+	numberingHandler := apiHandlers.NewNumberingHandler(numbering.NewService(db))
+	dunningHandler := apiHandlers.NewDunningHandler(dunningService)
+	customerGroupHandler := apiHandlers.NewCustomerGroupHandler(customergroup.NewService(db))
+	addressHandler := apiHandlers.NewAddressHandler(addressService)
+	vatHandler := apiHandlers.NewVATHandler(vatService)
+	stockHandler := apiHandlers.NewStockHandler(stockService)
+	trialHandler := apiHandlers.NewTrialHandler(trialService)
+	bundleHandler := apiHandlers.NewBundleHandler(productService)
+	addonHandler := apiHandlers.NewAddonHandler(addonService)
+	customFieldHandler := apiHandlers.NewCustomFieldHandler(customFieldService)
+	cancellationHandler := apiHandlers.NewCancellationHandler(cancellationService)
+	transferHandler := apiHandlers.NewTransferHandler(transferService)
+	accountHandler := apiHandlers.NewAccountHandler(accountService)
+	whmcsHandler := apiHandlers.NewWHMCSHandler(whmcs.NewService(db), cfg.WHMCS.AllowedIPs, cfg.WHMCS.AccessKey)
+	automationHandler := apiHandlers.NewAutomationHandler(automation.NewService(db))
+	apiLogHandler := apiHandlers.NewAPILogHandler(apilog.NewService(db))
+	menuHandler := apiHandlers.NewMenuHandler(web.DefaultMenuRegistry)
+	systemHandler := apiHandlers.NewSystemHandler(web.GetRenderer(), newSystemInfoCollector(db, cfg))
+	translationHandler := apiHandlers.NewTranslationHandler(web.GetRenderer())
 
 	// Public endpoints
 	api.POST("/auth/register", authHandler.Register)
@@ -186,26 +649,46 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 	api.POST("/auth/forgot-password", authHandler.ForgotPassword)
 	api.POST("/auth/reset-password", authHandler.ResetPassword)
 
-	api.GET("/products/groups", productHandler.ListProductGroups)
-	api.GET("/products/groups/:slug", productHandler.GetProductGroup)
-	api.GET("/products", productHandler.ListProducts)
-	api.GET("/products/:slug", productHandler.GetProduct)
-	api.POST("/products/:id/pricing", productHandler.GetProductPricing)
-
-	api.GET("/cart", orderHandler.GetCart)
-	api.POST("/cart/items", orderHandler.AddToCart)
-	api.PUT("/cart/items/:id", orderHandler.UpdateCartItem)
-	api.DELETE("/cart/items/:id", orderHandler.RemoveCartItem)
-	api.POST("/cart/coupon", orderHandler.ApplyCoupon)
-	api.DELETE("/cart/coupon", orderHandler.RemoveCoupon)
-	api.DELETE("/cart", orderHandler.ClearCart)
-
-	api.GET("/kb/categories", knowledgeBaseHandler.ListCategories)
-	api.GET("/kb/categories/:slug", knowledgeBaseHandler.GetCategory)
-	api.GET("/kb/articles/:slug", knowledgeBaseHandler.GetArticle)
+	productsGroup := api.Group("/products", authHandler.OptionalAuthMiddleware(), responseCache.Middleware("catalog"))
+	productsGroup.GET("/groups", productHandler.ListProductGroups)
+	productsGroup.GET("/groups/:slug", productHandler.GetProductGroup)
+	productsGroup.GET("", productHandler.ListProducts)
+	productsGroup.GET("/:slug", productHandler.GetProduct)
+	productsGroup.POST("/:id/pricing", productHandler.GetProductPricing)
+	api.GET("/trial-offers/:product_id", trialHandler.GetProductTrial)
+	api.GET("/order-fields/:product_id", customFieldHandler.GetOrderFields)
+	api.GET("/checkout-fields", customFieldHandler.GetCheckoutFields)
+	api.GET("/bundles", bundleHandler.ListBundles)
+	api.GET("/bundles/:id", bundleHandler.GetBundle)
+
+	registerCartRoutes(api, authHandler, orderHandler)
+
+	kbCache := responseCache.Middleware("kb")
+	api.GET("/kb/categories", kbCache, knowledgeBaseHandler.ListCategories)
+	api.GET("/kb/categories/:slug", kbCache, knowledgeBaseHandler.GetCategory)
+	api.GET("/kb/articles/:slug", knowledgeBaseHandler.CountView, kbCache, knowledgeBaseHandler.GetArticle)
 	api.GET("/kb/search", knowledgeBaseHandler.SearchArticles)
 	api.POST("/kb/articles/:slug/rate", knowledgeBaseHandler.RateArticle)
 	api.GET("/kb/popular", knowledgeBaseHandler.GetPopularArticles)
+	api.GET("/kb/attachments/:id", knowledgeBaseHandler.DownloadAttachment)
+	api.GET("/network/components", networkHandler.ListComponents)
+	api.GET("/network/maintenance", networkHandler.GetMaintenanceCalendar)
+	api.GET("/announcements", responseCache.Middleware("announcements"), announcementHandler.ListAnnouncements)
+	api.GET("/features", authHandler.OptionalAuthMiddleware(), featureFlagHandler.GetFeatures)
+	kbSuggestGroup := api.Group("/kb/suggest", authHandler.OptionalAuthMiddleware())
+	kbSuggestGroup.POST("", knowledgeBaseHandler.SuggestArticles)
+	kbSuggestGroup.POST("/:id/outcome", knowledgeBaseHandler.RecordSuggestionOutcome)
+
+	// Downloads area; logged in clients see restricted downloads too
+	api.GET("/downloads/categories", downloadHandler.ListCategories)
+	downloadsGroup := api.Group("/downloads", authHandler.OptionalAuthMiddleware())
+	downloadsGroup.GET("", downloadHandler.ListDownloads)
+	downloadsGroup.GET("/:id", downloadHandler.GetDownload)
+	downloadsGroup.GET("/:id/file", downloadHandler.DownloadFile)
+
+	// Media library images embedded in articles and product descriptions
+	api.GET("/media/:id", mediaHandler.ServeMedia)
+	api.GET("/markup/highlight.css", markupHandler.HighlightCSS)
 
 	api.GET("/payments/gateways", paymentHandler.ListGateways)
 	api.POST("/payments/callback/:gateway", paymentHandler.ProcessCallback)
@@ -215,27 +698,93 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 
 	api.GET("/ref/:code", affiliateHandler.TrackClick)
 
+	api.GET("/currencies", accountHandler.ListCurrencies)
+	api.GET("/legal", accountHandler.ListLegalDocuments)
+	api.GET("/legal/:type", accountHandler.GetLegalDocument)
+
+	// Automation API, authenticated with API keys
+	api.GET("/automation/schema", automationHandler.Schema)
+	// Automation keys act for staff, so they are held to the admin
+	// allow-list like the staff member's own requests
+	automationGroup := api.Group("/automation", apiLogMiddleware(db, cfg.APILog), automationHandler.KeyMiddleware(), adminAccessHandler.Middleware())
+	automationGroup.GET("/me", automationHandler.Me)
+	automationGroup.POST("/actions/create-customer", automationHandler.CreateCustomer)
+	automationGroup.POST("/actions/create-ticket", automationHandler.CreateTicket)
+	automationGroup.POST("/actions/add-credit", automationHandler.AddCredit)
+	automationGroup.POST("/actions/create-invoice", automationHandler.CreateInvoice)
+	automationGroup.GET("/triggers/:event", automationHandler.RecentEvents)
+	automationGroup.POST("/hooks", automationHandler.Subscribe)
+	automationGroup.DELETE("/hooks/:id", automationHandler.Unsubscribe)
+
 	// Authenticated endpoints
 	authGroup := api.Group("", authHandler.AuthMiddleware())
 	authGroup.POST("/auth/logout", authHandler.Logout)
 	authGroup.GET("/auth/me", authHandler.GetCurrentUser)
+	authGroup.GET("/menus/:menu", menuHandler.GetMenu)
 	authGroup.PUT("/auth/profile", authHandler.UpdateProfile)
 	authGroup.PUT("/auth/password", authHandler.ChangePassword)
+	authGroup.GET("/account/security-events", accountHandler.ListSecurityEvents)
+	authGroup.GET("/account/vat-number", vatHandler.GetVATNumber)
+	authGroup.PUT("/account/vat-number", vatHandler.UpdateVATNumber)
+	authGroup.GET("/account/currency", accountHandler.GetCurrency)
+	authGroup.PUT("/account/currency", accountHandler.UpdateCurrency)
+	authGroup.GET("/account/appearance", accountHandler.GetAppearance)
+	authGroup.PUT("/account/appearance", accountHandler.UpdateAppearance)
+	authGroup.GET("/account/consents", accountHandler.GetConsents)
+	authGroup.POST("/account/consents", accountHandler.GiveConsent)
+	authGroup.GET("/account/consents/history", accountHandler.GetConsentHistory)
+	authGroup.GET("/account/consents/export", accountHandler.ExportConsentHistory)
+	authGroup.GET("/account/email-preferences", notificationHandler.GetEmailPreferences)
+	authGroup.PUT("/account/email-preferences", notificationHandler.UpdateEmailPreferences)
 
 	authGroup.GET("/orders", orderHandler.ListOrders)
 	authGroup.GET("/orders/:id", orderHandler.GetOrder)
 	authGroup.POST("/orders", orderHandler.CreateOrder)
+	authGroup.POST("/checkout/address/validate", addressHandler.ValidateAddress)
 	authGroup.GET("/services", orderHandler.ListServices)
 	authGroup.GET("/services/:id", orderHandler.GetService)
+	authGroup.POST("/services/:id/credentials/reveal", orderHandler.RevealServiceCredentials)
+	authGroup.GET("/services/:id/billing-cycle", orderHandler.GetBillingCycleChange)
+	authGroup.GET("/services/:id/billing-cycle/quote", orderHandler.QuoteBillingCycleChange)
+	authGroup.POST("/services/:id/billing-cycle", orderHandler.ChangeBillingCycle)
+	authGroup.DELETE("/services/:id/billing-cycle", orderHandler.CancelBillingCycleChange)
+	authGroup.GET("/services/:id/addons", addonHandler.ListServiceAddons)
+	authGroup.GET("/services/:id/addons/available", addonHandler.ListAvailableAddons)
+	authGroup.POST("/services/:id/addons", addonHandler.OrderAddon)
+	authGroup.POST("/services/:id/addons/:addon_id/cancel", addonHandler.CancelServiceAddon)
+	authGroup.GET("/services/:id/custom-fields", customFieldHandler.GetServiceFields)
+	authGroup.GET("/services/:id/cancellation", cancellationHandler.GetCancellation)
+	authGroup.POST("/services/:id/cancellation", cancellationHandler.RequestCancellation)
+	authGroup.POST("/services/:id/cancellation/withdraw", cancellationHandler.WithdrawCancellation)
+	authGroup.GET("/services/:id/cancellation/offers", cancellationHandler.GetRetentionOffers)
+	authGroup.POST("/services/:id/cancellation/offers/:offer_id/accept", cancellationHandler.AcceptRetentionOffer)
+	authGroup.POST("/services/:id/transfer", transferHandler.InitiateTransfer)
+	authGroup.GET("/services/:id/files", serviceFileHandler.ListFiles)
+	authGroup.POST("/services/:id/files", serviceFileHandler.UploadFile)
+	authGroup.GET("/services/:id/files/:file_id/download", serviceFileHandler.DownloadFile)
+	authGroup.GET("/services/:id/maintenance", networkHandler.GetServiceMaintenance)
+	authGroup.GET("/maintenance", networkHandler.GetMyMaintenance)
+	authGroup.DELETE("/services/:id/files/:file_id", serviceFileHandler.DeleteFile)
+	authGroup.GET("/service-transfers", transferHandler.ListOutgoingTransfers)
+	authGroup.POST("/service-transfers/:id/cancel", transferHandler.CancelTransfer)
+	authGroup.GET("/service-transfers/code/:code", transferHandler.LookupTransfer)
+	authGroup.POST("/service-transfers/accept", transferHandler.AcceptTransfer)
+
+	authGroup.GET("/trials", trialHandler.ListTrials)
+	authGroup.POST("/trials", trialHandler.StartTrial)
+	authGroup.POST("/trials/:id/cancel", trialHandler.CancelTrial)
 
 	authGroup.GET("/invoices", invoiceHandler.ListInvoices)
 	authGroup.GET("/invoices/:id", invoiceHandler.GetInvoice)
+	authGroup.GET("/invoices/:id/custom-fields", customFieldHandler.GetInvoiceFields)
 	authGroup.GET("/invoices/unpaid", invoiceHandler.GetUnpaidInvoices)
 
+	authGroup.POST("/markup/preview", markupHandler.Preview)
 	authGroup.GET("/tickets", ticketHandler.ListTickets)
 	authGroup.GET("/tickets/:id", ticketHandler.GetTicket)
 	authGroup.POST("/tickets", ticketHandler.CreateTicket)
 	authGroup.POST("/tickets/:id/reply", ticketHandler.ReplyToTicket)
+	authGroup.GET("/tickets/:id/attachments/:attachmentId", ticketHandler.DownloadAttachment)
 	authGroup.POST("/tickets/:id/close", ticketHandler.CloseTicket)
 	authGroup.GET("/tickets/stats", ticketHandler.GetTicketStats)
 
@@ -246,6 +795,7 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 	authGroup.POST("/affiliate/withdraw", affiliateHandler.RequestWithdrawal)
 	authGroup.PUT("/affiliate/settings", affiliateHandler.UpdateSettings)
 	authGroup.GET("/affiliate/banners", affiliateHandler.GetBanners)
+	authGroup.GET("/affiliate/stats", affiliateHandler.GetStats)
 
 	authGroup.GET("/notifications", notificationHandler.GetUnreadNotifications)
 	authGroup.POST("/notifications/:id/read", notificationHandler.MarkAsRead)
@@ -270,26 +820,195 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 	authGroup.DELETE("/subusers/invites/:id", subUserHandler.CancelInvite)
 
 	// Admin endpoints
-	adminGroup := api.Group("/admin", authHandler.AuthMiddleware(), apiHandlers.AdminMiddleware())
+	// Locked out admins trust their address with a recovery token
+	authGroup.POST("/admin-access/recover", adminAccessHandler.RecoverAdminAccess)
+
+	adminGroup := api.Group("/admin", authHandler.AuthMiddleware(), apiHandlers.AdminMiddleware(), adminAccessHandler.Middleware(), responseCache.InvalidateMiddleware())
+	adminGroup.GET("/metrics", handlers.Metrics(db))
+	adminGroup.POST("/system/clear-template-cache", systemHandler.ClearTemplateCache)
+	adminGroup.GET("/system/info", systemHandler.GetInfo)
+	adminGroup.GET("/system/diagnostics", systemHandler.DownloadDiagnostics)
+	adminGroup.GET("/translations/missing", translationHandler.GetMissingKeys)
+	adminGroup.DELETE("/translations/missing", translationHandler.ResetMissingKeys)
+	adminGroup.POST("/translations/reload", translationHandler.ReloadTranslations)
+
+	adminGroup.GET("/customers/health", healthHandler.AdminListHealth)
+	adminGroup.GET("/customers/:id/health", healthHandler.AdminGetHealth)
+	adminGroup.POST("/customers/:id/health/recompute", healthHandler.AdminRecomputeHealth)
+	adminGroup.PUT("/customers/:id/account-manager", healthHandler.AdminSetAccountManager)
+	adminGroup.GET("/customers/:id", noteHandler.AdminGetCustomer)
+	adminGroup.GET("/customers/:id/notes", noteHandler.AdminListNotes(domain.NoteSubjectCustomer))
+	adminGroup.POST("/customers/:id/notes", noteHandler.AdminAddNote(domain.NoteSubjectCustomer))
+	adminGroup.PUT("/customers/:id/notes/:note_id", noteHandler.AdminUpdateNote(domain.NoteSubjectCustomer))
+	adminGroup.DELETE("/customers/:id/notes/:note_id", noteHandler.AdminDeleteNote(domain.NoteSubjectCustomer))
+	adminGroup.GET("/customers/:id/notes/:note_id/history", noteHandler.AdminNoteHistory(domain.NoteSubjectCustomer))
+	adminGroup.GET("/orders/:id/notes", noteHandler.AdminListNotes(domain.NoteSubjectOrder))
+	adminGroup.POST("/orders/:id/notes", noteHandler.AdminAddNote(domain.NoteSubjectOrder))
+	adminGroup.PUT("/orders/:id/notes/:note_id", noteHandler.AdminUpdateNote(domain.NoteSubjectOrder))
+	adminGroup.DELETE("/orders/:id/notes/:note_id", noteHandler.AdminDeleteNote(domain.NoteSubjectOrder))
+	adminGroup.GET("/orders/:id/notes/:note_id/history", noteHandler.AdminNoteHistory(domain.NoteSubjectOrder))
+	adminGroup.GET("/tasks", taskHandler.AdminListTasks)
+	adminGroup.POST("/tasks", taskHandler.AdminCreateTask)
+	adminGroup.GET("/tasks/:id", taskHandler.AdminGetTask)
+	adminGroup.PUT("/tasks/:id", taskHandler.AdminUpdateTask)
+	adminGroup.PUT("/tasks/:id/status", taskHandler.AdminSetTaskStatus)
+	adminGroup.DELETE("/tasks/:id", taskHandler.AdminDeleteTask)
+
 	adminGroup.GET("/orders", orderHandler.AdminListOrders)
 	adminGroup.PUT("/orders/:id/status", orderHandler.AdminUpdateOrderStatus)
+	adminGroup.GET("/orders/:id/custom-fields", customFieldHandler.AdminGetOrderFieldValues)
+	adminGroup.PUT("/orders/:id/custom-fields", customFieldHandler.AdminUpdateOrderFieldValues)
+	adminGroup.GET("/order-fields", customFieldHandler.AdminListOrderFields)
+	adminGroup.POST("/order-fields", customFieldHandler.AdminCreateOrderField)
 	adminGroup.POST("/services/:id/suspend", orderHandler.AdminSuspendService)
 	adminGroup.POST("/services/:id/unsuspend", orderHandler.AdminUnsuspendService)
 	adminGroup.POST("/services/:id/terminate", orderHandler.AdminTerminateService)
+	adminGroup.POST("/services/:id/credentials/reveal", orderHandler.AdminRevealServiceCredentials)
+	adminGroup.GET("/services/:id/credentials/reveals", orderHandler.AdminListCredentialReveals)
+	adminGroup.POST("/services/:id/welcome-email", notificationHandler.AdminResendWelcomeEmail)
+	adminGroup.GET("/services/:id/custom-fields", customFieldHandler.AdminGetServiceFields)
+	adminGroup.PUT("/services/:id/custom-fields", customFieldHandler.AdminUpdateServiceFields)
+	adminGroup.GET("/services/:id/custom-fields/history", customFieldHandler.AdminListServiceFieldHistory)
+	adminGroup.GET("/services/:id/files", serviceFileHandler.AdminListFiles)
+	adminGroup.POST("/services/:id/files", serviceFileHandler.AdminUploadFile)
+	adminGroup.GET("/services/:id/files/:file_id/download", serviceFileHandler.AdminDownloadFile)
+	adminGroup.DELETE("/services/:id/files/:file_id", serviceFileHandler.AdminDeleteFile)
+	adminGroup.GET("/quarantine", quarantineHandler.AdminListFiles)
+	adminGroup.GET("/quarantine/:id", quarantineHandler.AdminGetFile)
+	adminGroup.GET("/quarantine/:id/download", quarantineHandler.AdminDownloadFile)
+	adminGroup.DELETE("/quarantine/:id", quarantineHandler.AdminDeleteFile)
+	adminGroup.GET("/spam", spamHandler.AdminListMessages)
+	adminGroup.GET("/spam/lists", spamHandler.AdminListEntries)
+	adminGroup.POST("/spam/lists", spamHandler.AdminAddEntry)
+	adminGroup.DELETE("/spam/lists/:id", spamHandler.AdminDeleteEntry)
+	adminGroup.GET("/spam/:id", spamHandler.AdminGetMessage)
+	adminGroup.POST("/spam/:id/release", spamHandler.AdminReleaseMessage)
+	adminGroup.DELETE("/spam/:id", spamHandler.AdminDeleteMessage)
+	adminGroup.GET("/media", mediaHandler.AdminListMedia)
+	adminGroup.POST("/media", mediaHandler.AdminUploadMedia)
+	adminGroup.GET("/media/folders", mediaHandler.AdminListFolders)
+	adminGroup.GET("/media/:id", mediaHandler.AdminGetMedia)
+	adminGroup.PUT("/media/:id", mediaHandler.AdminUpdateMedia)
+	adminGroup.DELETE("/media/:id", mediaHandler.AdminDeleteMedia)
+	adminGroup.GET("/cancellations", cancellationHandler.AdminListCancellations)
+	adminGroup.POST("/cancellations/:id/approve", cancellationHandler.AdminApproveCancellation)
+	adminGroup.POST("/cancellations/:id/reject", cancellationHandler.AdminRejectCancellation)
+	adminGroup.GET("/retention-offers", cancellationHandler.AdminListRetentionOffers)
+	adminGroup.POST("/retention-offers", cancellationHandler.AdminCreateRetentionOffer)
+	adminGroup.PUT("/retention-offers/:id", cancellationHandler.AdminUpdateRetentionOffer)
+	adminGroup.DELETE("/retention-offers/:id", cancellationHandler.AdminDeleteRetentionOffer)
+	adminGroup.GET("/service-transfers", transferHandler.AdminListTransfers)
+	adminGroup.POST("/service-addons/:id/activate", addonHandler.AdminActivateServiceAddon)
 
 	adminGroup.GET("/invoices", invoiceHandler.AdminListInvoices)
+	adminGroup.GET("/invoices/:id/custom-fields", customFieldHandler.AdminGetInvoiceFieldValues)
+	adminGroup.PUT("/invoices/:id/custom-fields", customFieldHandler.AdminUpdateInvoiceFieldValues)
+	adminGroup.GET("/invoice-fields", customFieldHandler.AdminListInvoiceFields)
+	adminGroup.POST("/invoice-fields", customFieldHandler.AdminCreateInvoiceField)
+	adminGroup.GET("/reports/tax", reportHandler.AdminTaxReport)
+	adminGroup.GET("/tax/vat", vatHandler.AdminGetVATSettings)
+	adminGroup.PUT("/tax/vat", vatHandler.AdminUpdateVATSettings)
+	adminGroup.POST("/tax/vat/check", vatHandler.AdminCheckVATNumber)
+	adminGroup.GET("/reports/gateways", reportHandler.AdminGatewayReport)
+	adminGroup.GET("/reports/aging", reportHandler.AdminAgingReport)
+	adminGroup.POST("/network/components", networkHandler.AdminCreateComponent)
+	adminGroup.GET("/network/maintenance", networkHandler.AdminListMaintenance)
+	adminGroup.POST("/network/maintenance", networkHandler.AdminScheduleMaintenance)
+	adminGroup.PUT("/network/maintenance/:id", networkHandler.AdminUpdateMaintenance)
+	adminGroup.DELETE("/network/maintenance/:id", networkHandler.AdminDeleteMaintenance)
+	adminGroup.GET("/announcements", announcementHandler.AdminListAnnouncements)
+	adminGroup.POST("/announcements", announcementHandler.AdminCreateAnnouncement)
+	adminGroup.POST("/announcements/:id/publish", announcementHandler.AdminPublishAnnouncement)
+	adminGroup.POST("/announcements/:id/unpublish", announcementHandler.AdminUnpublishAnnouncement)
+	adminGroup.GET("/reports/revenue", recognitionHandler.AdminRevenueReport)
 	adminGroup.POST("/invoices/:id/cancel", invoiceHandler.AdminCancelInvoice)
+	adminGroup.GET("/invoices/drafts", invoiceHandler.AdminListDrafts)
+	adminGroup.POST("/invoices/publish", invoiceHandler.AdminPublishInvoices)
+	adminGroup.POST("/invoices/:id/publish", invoiceHandler.AdminPublishInvoice)
+	adminGroup.PUT("/invoices/:id/publish-at", invoiceHandler.AdminScheduleInvoice)
+	adminGroup.GET("/invoices/review-window", invoiceHandler.AdminGetReviewWindow)
+	adminGroup.PUT("/invoices/review-window", invoiceHandler.AdminSetReviewWindow)
+	adminGroup.POST("/invoices/merge", invoiceHandler.AdminMergeInvoices)
+	adminGroup.PUT("/customers/:id/invoice-consolidation", invoiceHandler.AdminSetConsolidation)
+	adminGroup.GET("/dunning", dunningHandler.AdminGetDunningSettings)
+	adminGroup.PUT("/dunning", dunningHandler.AdminUpdateDunningSettings)
+	adminGroup.GET("/invoices/:id/promises", dunningHandler.AdminListPromises)
+	adminGroup.POST("/invoices/:id/promise", dunningHandler.AdminRecordPromise)
+	adminGroup.DELETE("/invoices/:id/promise", dunningHandler.AdminCancelPromise)
+	adminGroup.GET("/customer-groups", customerGroupHandler.AdminListGroups)
+	adminGroup.POST("/customer-groups", customerGroupHandler.AdminCreateGroup)
+	adminGroup.PUT("/customer-groups/:id", customerGroupHandler.AdminUpdateGroup)
+	adminGroup.DELETE("/customer-groups/:id", customerGroupHandler.AdminDeleteGroup)
+	adminGroup.GET("/customer-groups/:id/members", customerGroupHandler.AdminListMembers)
+	adminGroup.POST("/customer-groups/:id/members", customerGroupHandler.AdminAddMember)
+	adminGroup.DELETE("/customer-groups/:id/members/:customer_id", customerGroupHandler.AdminRemoveMember)
+	adminGroup.GET("/customer-groups/:id/prices", customerGroupHandler.AdminListPrices)
+	adminGroup.PUT("/customer-groups/:id/prices", customerGroupHandler.AdminSetPrice)
+	adminGroup.DELETE("/customer-groups/:id/prices/:product_id", customerGroupHandler.AdminDeletePrice)
 
 	adminGroup.GET("/tickets", ticketHandler.AdminListTickets)
 	adminGroup.GET("/tickets/stats", ticketHandler.AdminGetTicketStats)
 	adminGroup.PUT("/tickets/:id/status", ticketHandler.AdminUpdateTicketStatus)
 	adminGroup.PUT("/tickets/:id/priority", ticketHandler.AdminUpdateTicketPriority)
+	adminGroup.PUT("/tickets/:id/customer", ticketHandler.AdminAssignCustomer)
 	adminGroup.DELETE("/tickets/:id", ticketHandler.AdminDeleteTicket)
+	adminGroup.PUT("/tickets/:id/assignee", routingHandler.AdminAssignTicket)
+	adminGroup.GET("/departments/:id/schedule", routingHandler.AdminGetDepartmentSchedule)
+	adminGroup.PUT("/departments/:id/schedule", routingHandler.AdminUpdateDepartmentSchedule)
+	adminGroup.POST("/departments/:id/holidays", routingHandler.AdminAddDepartmentHoliday)
+	adminGroup.DELETE("/departments/:id/holidays/:holiday_id", routingHandler.AdminDeleteDepartmentHoliday)
+	adminGroup.GET("/on-call", routingHandler.AdminListOnCall)
+	adminGroup.POST("/on-call", routingHandler.AdminAddOnCall)
+	adminGroup.DELETE("/on-call/:id", routingHandler.AdminDeleteOnCall)
+	adminGroup.PUT("/staff/availability", routingHandler.AdminSetAvailability)
 
 	adminGroup.POST("/products/groups", productHandler.CreateProductGroup)
 	adminGroup.POST("/products", productHandler.CreateProduct)
 	adminGroup.PUT("/products/:id", productHandler.UpdateProduct)
 	adminGroup.DELETE("/products/:id", productHandler.DeleteProduct)
+	adminGroup.PUT("/products/:id/restricted", productHandler.AdminSetProductRestricted)
+	adminGroup.GET("/checkout/countries", addressHandler.AdminGetCountrySettings)
+	adminGroup.PUT("/checkout/countries", addressHandler.AdminUpdateCountrySettings)
+	adminGroup.GET("/products/:id/stock", stockHandler.AdminGetStock)
+	adminGroup.PUT("/products/:id/stock", stockHandler.AdminSetStock)
+	adminGroup.DELETE("/products/:id/stock", stockHandler.AdminStopTracking)
+	adminGroup.POST("/products/:id/restock", stockHandler.AdminRestock)
+	adminGroup.GET("/stock", stockHandler.AdminListStock)
+	adminGroup.PUT("/products/:id/trial", trialHandler.AdminSetProductTrial)
+	adminGroup.GET("/products/:id/welcome-email", notificationHandler.AdminGetWelcomeEmail)
+	adminGroup.PUT("/products/:id/welcome-email", notificationHandler.AdminSetWelcomeEmail)
+	adminGroup.GET("/products/:id/custom-fields", customFieldHandler.AdminListProductFields)
+	adminGroup.POST("/products/:id/custom-fields", customFieldHandler.AdminCreateProductField)
+	adminGroup.PUT("/custom-fields/:id", customFieldHandler.AdminUpdateProductField)
+	adminGroup.DELETE("/custom-fields/:id", customFieldHandler.AdminDeleteProductField)
+	adminGroup.GET("/trials", trialHandler.AdminListTrials)
+	adminGroup.GET("/bundles", bundleHandler.AdminListBundles)
+	adminGroup.POST("/bundles", bundleHandler.AdminCreateBundle)
+	adminGroup.PUT("/bundles/:id", bundleHandler.AdminUpdateBundle)
+	adminGroup.DELETE("/bundles/:id", bundleHandler.AdminDeleteBundle)
+	adminGroup.PUT("/config-sub-options/:id/stock", productHandler.AdminSetSubOptionStock)
+	adminGroup.GET("/catalog/export", productHandler.AdminExportCatalog)
+	adminGroup.POST("/catalog/import/preview", productHandler.AdminPreviewCatalogImport)
+	adminGroup.POST("/catalog/import", productHandler.AdminImportCatalog)
+
+	adminGroup.GET("/pricing/revisions", pricingHandler.AdminListRevisions)
+	adminGroup.POST("/pricing/revisions", pricingHandler.AdminStageRevision)
+	adminGroup.POST("/pricing/revisions/apply", pricingHandler.AdminApplyDueRevisions)
+	adminGroup.GET("/pricing/revisions/:id", pricingHandler.AdminGetRevision)
+	adminGroup.PUT("/pricing/revisions/:id/items/:itemId", pricingHandler.AdminUpdateRevisionItem)
+	adminGroup.POST("/pricing/revisions/:id/cancel", pricingHandler.AdminCancelRevision)
+	adminGroup.GET("/pricing/tiers", pricingHandler.AdminListTiers)
+	adminGroup.POST("/pricing/tiers", pricingHandler.AdminCreateTier)
+	adminGroup.PUT("/pricing/tiers/:id", pricingHandler.AdminUpdateTier)
+	adminGroup.DELETE("/pricing/tiers/:id", pricingHandler.AdminDeleteTier)
+
+	adminGroup.GET("/coupons/batches", couponHandler.AdminListBatches)
+	adminGroup.POST("/coupons/batches", couponHandler.AdminGenerateBatch)
+	adminGroup.GET("/coupons/batches/:id", couponHandler.AdminGetBatch)
+	adminGroup.GET("/coupons/batches/:id/codes", couponHandler.AdminExportBatchCodes)
+
+	adminGroup.GET("/numbering", numberingHandler.AdminListSequences)
+	adminGroup.PUT("/numbering/:kind", numberingHandler.AdminUpdateSequence)
 
 	adminGroup.GET("/kb/categories", knowledgeBaseHandler.AdminListCategories)
 	adminGroup.POST("/kb/categories", knowledgeBaseHandler.AdminCreateCategory)
@@ -301,7 +1020,28 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 	adminGroup.POST("/kb/articles/:id/publish", knowledgeBaseHandler.AdminPublishArticle)
 	adminGroup.POST("/kb/articles/:id/unpublish", knowledgeBaseHandler.AdminUnpublishArticle)
 	adminGroup.DELETE("/kb/articles/:id", knowledgeBaseHandler.AdminDeleteArticle)
+	adminGroup.POST("/kb/articles/:id/attachments", knowledgeBaseHandler.AdminUploadAttachment)
+	adminGroup.DELETE("/kb/attachments/:id", knowledgeBaseHandler.AdminDeleteAttachment)
+
+	adminGroup.GET("/downloads/categories", downloadHandler.AdminListCategories)
+	adminGroup.POST("/downloads/categories", downloadHandler.AdminCreateCategory)
+	adminGroup.PUT("/downloads/categories/:id", downloadHandler.AdminUpdateCategory)
+	adminGroup.DELETE("/downloads/categories/:id", downloadHandler.AdminDeleteCategory)
+	adminGroup.GET("/downloads", downloadHandler.AdminListDownloads)
+	adminGroup.POST("/downloads", downloadHandler.AdminCreateDownload)
+	adminGroup.PUT("/downloads/:id", downloadHandler.AdminUpdateDownload)
+	adminGroup.POST("/downloads/:id/versions", downloadHandler.AdminAddVersion)
+	adminGroup.DELETE("/downloads/:id", downloadHandler.AdminDeleteDownload)
+	adminGroup.GET("/downloads/:id/logs", downloadHandler.AdminListLogs)
 	adminGroup.GET("/kb/search-stats", knowledgeBaseHandler.AdminGetSearchStats)
+	adminGroup.GET("/kb/deflection-stats", knowledgeBaseHandler.AdminGetDeflectionStats)
+
+	// AI assist; drafts are returned to the admin and never sent
+	adminGroup.GET("/assist/settings", assistHandler.AdminGetSettings)
+	adminGroup.PUT("/assist/settings", assistHandler.AdminUpdateSettings)
+	adminGroup.GET("/assist/logs", assistHandler.AdminListLogs)
+	adminGroup.POST("/tickets/:id/draft-reply", assistHandler.AdminDraftTicketReply)
+	adminGroup.POST("/kb/articles/:id/summary", assistHandler.AdminSummarizeArticle)
 
 	adminGroup.POST("/notifications/send", notificationHandler.AdminSendNotification)
 	adminGroup.GET("/email-templates", notificationHandler.AdminListEmailTemplates)
@@ -309,14 +1049,230 @@ func registerAPIRoutes(api *gin.RouterGroup, db *gorm.DB) {
 	adminGroup.PUT("/email-templates/:id", notificationHandler.AdminUpdateEmailTemplate)
 	adminGroup.POST("/email-templates/test", notificationHandler.AdminTestEmail)
 	adminGroup.POST("/webhooks", notificationHandler.AdminCreateWebhook)
+	adminGroup.GET("/email/suppressions", notificationHandler.AdminListSuppressions)
+	adminGroup.POST("/email/suppressions", notificationHandler.AdminAddSuppression)
+	adminGroup.DELETE("/email/suppressions/:id", notificationHandler.AdminRemoveSuppression)
+	adminGroup.GET("/email/skipped", notificationHandler.AdminListSkippedEmails)
+	adminGroup.GET("/email/dkim", notificationHandler.AdminListDKIMKeys)
+	adminGroup.POST("/email/dkim", notificationHandler.AdminGenerateDKIMKey)
+	adminGroup.DELETE("/email/dkim/:id", notificationHandler.AdminDeleteDKIMKey)
+	adminGroup.PUT("/email/smtp/:id/return-path", notificationHandler.AdminSetReturnPath)
+	adminGroup.GET("/email/dns-check", notificationHandler.AdminCheckDNS)
+	adminGroup.GET("/email/tracking", notificationHandler.AdminGetTracking)
+	adminGroup.PUT("/email/tracking", notificationHandler.AdminSetTracking)
+	adminGroup.GET("/email/logs/:id", notificationHandler.AdminGetEmailLog)
+	adminGroup.GET("/email/postmaster", notificationHandler.AdminGetPostmaster)
 
 	adminGroup.POST("/payments/credit", paymentHandler.AdminAddCredit)
 	adminGroup.POST("/payments/:id/refund", paymentHandler.AdminRefundPayment)
+	adminGroup.PUT("/payments/gateways/:id/fees", paymentHandler.AdminSetGatewayFees)
+	adminGroup.PUT("/payments/gateways/:id/currencies", paymentHandler.AdminSetGatewayCurrencies)
+	adminGroup.PUT("/payments/gateways/:id/test-mode", paymentHandler.AdminSetGatewayTestMode)
 
 	adminGroup.GET("/affiliates", affiliateHandler.AdminListAffiliates)
 	adminGroup.POST("/affiliates/:id/approve", affiliateHandler.AdminApproveAffiliate)
 	adminGroup.POST("/affiliates/:id/suspend", affiliateHandler.AdminSuspendAffiliate)
 	adminGroup.POST("/affiliates/withdrawals/:id/process", affiliateHandler.AdminProcessWithdrawal)
+	adminGroup.GET("/affiliates/banners", affiliateHandler.AdminListBanners)
+	adminGroup.POST("/affiliates/banners", affiliateHandler.AdminCreateBanner)
+	adminGroup.PUT("/affiliates/banners/:id", affiliateHandler.AdminUpdateBanner)
+	adminGroup.DELETE("/affiliates/banners/:id", affiliateHandler.AdminDeleteBanner)
+
+	adminGroup.GET("/archive/policies", archiveHandler.AdminListPolicies)
+	adminGroup.PUT("/archive/policies/:type", archiveHandler.AdminUpdatePolicy)
+	adminGroup.POST("/archive/run", archiveHandler.AdminRunArchive)
+	adminGroup.GET("/archive/exports", archiveHandler.AdminListArchives)
+
+	adminGroup.GET("/exports/invoices", exportHandler.AdminExportInvoices)
+	adminGroup.GET("/exports/transactions", exportHandler.AdminExportTransactions)
+	adminGroup.GET("/exports/customers", exportHandler.AdminExportCustomers)
+
+	adminGroup.GET("/nodes", agentHandler.AdminListNodes)
+	adminGroup.POST("/nodes", agentHandler.AdminCreateNode)
+	adminGroup.GET("/nodes/:id", agentHandler.AdminGetNode)
+	adminGroup.PUT("/nodes/:id", agentHandler.AdminUpdateNode)
+	adminGroup.DELETE("/nodes/:id", agentHandler.AdminDeleteNode)
+	adminGroup.POST("/nodes/:id/enroll", agentHandler.AdminEnrollNode)
+	adminGroup.GET("/nodes/:id/tasks", agentHandler.AdminListNodeTasks)
+	adminGroup.POST("/nodes/:id/tasks", agentHandler.AdminCreateNodeTask)
+	adminGroup.GET("/agent-tasks/:id", agentHandler.AdminGetAgentTask)
+
+	adminGroup.GET("/backups/configs", backupHandler.AdminListConfigs)
+	adminGroup.POST("/backups/configs", backupHandler.AdminCreateConfig)
+	adminGroup.PUT("/backups/configs/:id", backupHandler.AdminUpdateConfig)
+	adminGroup.DELETE("/backups/configs/:id", backupHandler.AdminDeleteConfig)
+	adminGroup.POST("/backups/configs/:id/run", backupHandler.AdminRunBackup)
+	adminGroup.GET("/backups", backupHandler.AdminListRestorePoints)
+
+	adminGroup.POST("/bulk", bulkHandler.AdminSubmitBulk)
+	adminGroup.GET("/bulk", bulkHandler.AdminListBulkJobs)
+	adminGroup.GET("/bulk/:id", bulkHandler.AdminGetBulkJob)
+
+	adminGroup.GET("/legal-documents", accountHandler.AdminListLegalDocuments)
+	adminGroup.POST("/legal-documents", accountHandler.AdminPublishLegalDocument)
+	adminGroup.PUT("/legal-documents/:id", accountHandler.AdminUpdateLegalDocument)
+	adminGroup.GET("/legal-acceptances", accountHandler.AdminListLegalAcceptances)
+	adminGroup.GET("/whmcs-credentials", whmcsHandler.AdminListCredentials)
+	adminGroup.POST("/whmcs-credentials", whmcsHandler.AdminCreateCredential)
+	adminGroup.DELETE("/whmcs-credentials/:id", whmcsHandler.AdminRevokeCredential)
+	adminGroup.GET("/automation-keys", automationHandler.AdminListKeys)
+	adminGroup.POST("/automation-keys", automationHandler.AdminCreateKey)
+	adminGroup.DELETE("/automation-keys/:id", automationHandler.AdminRevokeKey)
+	adminGroup.GET("/maintenance", maintenanceHandler.AdminGetMaintenanceMode)
+	adminGroup.PUT("/maintenance", maintenanceHandler.AdminUpdateMaintenanceMode)
+	adminGroup.GET("/access", adminAccessHandler.AdminGetAccess)
+	adminGroup.PUT("/access/allowed-ips", adminAccessHandler.AdminUpdateAllowedIPs)
+	adminGroup.PUT("/access/admins/:id/trusted-ips", adminAccessHandler.AdminUpdateTrustedIPs)
+	adminGroup.POST("/access/recovery-token", adminAccessHandler.AdminCreateRecoveryToken)
+	adminGroup.GET("/access/blocked", adminAccessHandler.AdminListBlockedAccess)
+	adminGroup.GET("/security/bans", securityMonitorHandler.AdminListBans)
+	adminGroup.POST("/security/bans", securityMonitorHandler.AdminCreateBan)
+	adminGroup.DELETE("/security/bans/:id", securityMonitorHandler.AdminLiftBan)
+	adminGroup.GET("/security/events", securityMonitorHandler.AdminListAbuseEvents)
+	adminGroup.GET("/approvals/settings", approvalHandler.AdminGetApprovalSettings)
+	adminGroup.PUT("/approvals/settings", approvalHandler.AdminUpdateApprovalSettings)
+	adminGroup.GET("/approvals", approvalHandler.AdminListApprovals)
+	adminGroup.GET("/approvals/:id", approvalHandler.AdminGetApproval)
+	adminGroup.POST("/approvals/:id/approve", approvalHandler.AdminApprove)
+	adminGroup.POST("/approvals/:id/reject", approvalHandler.AdminReject)
+	adminGroup.GET("/api-logs", apiLogHandler.AdminListLogs)
+	adminGroup.GET("/api-logs/:id", apiLogHandler.AdminGetLog)
+	adminGroup.GET("/feature-flags", featureFlagHandler.AdminListFlags)
+	adminGroup.GET("/feature-flags/:key", featureFlagHandler.AdminGetFlag)
+	adminGroup.PUT("/feature-flags/:key", featureFlagHandler.AdminUpdateFlag)
+	adminGroup.DELETE("/feature-flags/:key", featureFlagHandler.AdminDeleteFlag)
+	adminGroup.GET("/license", licenseHandler.AdminGetLicense)
+	adminGroup.PUT("/license", licenseHandler.AdminUpdateLicense)
+	adminGroup.POST("/license/check", licenseHandler.AdminCheckLicense)
+
+	return paymentService
+}
+
+// startAgentAPI serves the gRPC API node agents connect to, when an
+// address is configured
+func startAgentAPI(agentService *agent.Service, cfg config.AgentConfig) {
+	if cfg.Listen == "" {
+		return
+	}
+	server := agentrpc.NewServer(agentService)
+	go func() {
+		if err := server.Listen(context.Background(), cfg.Listen, cfg.CertFile, cfg.KeyFile); err != nil {
+			log.Printf("agent API stopped: %v", err)
+		}
+	}()
+}
+
+// startQueue starts the Redis backed task worker and returns the function
+// used to enqueue bulk jobs. It returns nil when no Redis address is
+// configured, in which case bulk jobs run in-process.
+// registerCartRoutes serves the cart API. Signed in customers fill the
+// cart their orders are placed from, guests one kept by X-Session-ID.
+func registerCartRoutes(api *gin.RouterGroup, authHandler *apiHandlers.AuthHandler, orderHandler *apiHandlers.OrderHandler) {
+	cart := api.Group("/cart", authHandler.OptionalAuthMiddleware())
+	cart.GET("", orderHandler.GetCart)
+	cart.POST("/items", orderHandler.AddToCart)
+	cart.POST("/bundles", orderHandler.AddBundleToCart)
+	cart.PUT("/items/:id", orderHandler.UpdateCartItem)
+	cart.DELETE("/items/:id", orderHandler.RemoveCartItem)
+	cart.POST("/coupon", orderHandler.ApplyCoupon)
+	cart.DELETE("/coupon", orderHandler.RemoveCoupon)
+	cart.DELETE("", orderHandler.ClearCart)
+	cart.PUT("/country", orderHandler.SetCartCountry)
+}
+
+// registerWHMCSRoutes serves the WHMCS compatible API at the path WHMCS
+// integrations expect
+func registerWHMCSRoutes(router *gin.Engine, db *gorm.DB, cfg config.Config) {
+	whmcsHandler := apiHandlers.NewWHMCSHandler(whmcs.NewService(db), cfg.WHMCS.AllowedIPs, cfg.WHMCS.AccessKey)
+	// WHMCS credentials act for staff, so they are held to the admin
+	// allow-list as well as the WHMCS allowed IPs
+	adminAccessHandler := apiHandlers.NewAdminAccessHandler(adminaccess.NewService(db), auth.NewService(db))
+	router.POST("/includes/api.php", apiLogMiddleware(db, cfg.APILog), whmcsHandler.KeyMiddleware(), adminAccessHandler.Middleware(), whmcsHandler.API)
+}
+
+// apiLogMiddleware records the calls made with API keys, unless the log
+// is disabled
+func apiLogMiddleware(db *gorm.DB, cfg config.APILogConfig) gin.HandlerFunc {
+	if cfg.Disabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+	apiLogService := apilog.NewService(db)
+	apiLogService.SetBodyLimit(cfg.BodyLimit)
+	return apiHandlers.NewAPILogHandler(apiLogService).Middleware()
+}
+
+// newResponseCache caches the public catalog, knowledge base and
+// announcement responses. Catalog responses depend on the customer group
+// of a signed-in customer, so only anonymous ones are cached.
+func newResponseCache(db *gorm.DB, cfg config.ResponseCacheConfig) *httpcache.Cache {
+	cache := httpcache.New()
+	cache.SetMaxAge(time.Duration(cfg.MaxAge) * time.Second)
+	cache.SetTTL(time.Duration(cfg.TTL) * time.Second)
+	if cfg.Disabled {
+		cache.Disable()
+	}
+
+	cache.Register(httpcache.Scope{
+		Name: "catalog",
+		Version: httpcache.TableVersion(db, "product_groups", "products", "product_pricings", "config_groups",
+			"product_config_groups", "config_options", "config_sub_options", "config_stock_reservations"),
+		Writes: []string{"/api/v1/admin/products", "/api/v1/admin/catalog", "/api/v1/admin/pricing",
+			"/api/v1/admin/config-sub-options"},
+		Personal: func(c *gin.Context) bool { return apiHandlers.GetCurrentUserID(c) != 0 },
+	})
+	cache.Register(httpcache.Scope{
+		Name:    "kb",
+		Version: httpcache.TableVersion(db, "knowledge_base_categories", "knowledge_base_articles", "kb_article_attachments"),
+		Writes:  []string{"/api/v1/admin/kb"},
+	})
+	cache.Register(httpcache.Scope{
+		Name:    "announcements",
+		Version: httpcache.TableVersion(db, "announcements"),
+		Writes:  []string{"/api/v1/admin/announcements"},
+	})
+	return cache
+}
+
+func startQueue(db *gorm.DB, cfg config.QueueConfig, testMode bool) bulk.EnqueueFunc {
+	if cfg.RedisAddr == "" {
+		return nil
+	}
+
+	redisOpt := redisClientOpt(cfg)
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	worker := tasks.NewWorker(db, nil, nil)
+	worker.SetTestMode(testMode)
+	server := asynq.NewServer(redisOpt, asynq.Config{
+		Concurrency:    concurrency,
+		RetryDelayFunc: tasks.DefaultRetryDelay,
+	})
+	go func() {
+		if err := server.Run(asynq.HandlerFunc(worker.ProcessTask)); err != nil {
+			log.Printf("task worker stopped: %v", err)
+		}
+	}()
+
+	client := asynq.NewClient(redisOpt)
+	return func(jobID uint64) error {
+		task, err := tasks.NewBulkTask(jobID)
+		if err != nil {
+			return err
+		}
+		_, err = client.Enqueue(task, asynq.MaxRetry(3))
+		return err
+	}
+}
+
+func redisClientOpt(cfg config.QueueConfig) asynq.RedisClientOpt {
+	return asynq.RedisClientOpt{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	}
 }
 
 func ensureAdminUser(db *gorm.DB, admin config.AdminConfig) error {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/order"
+	apiHandlers "github.com/openhost/openhost/internal/infrastructure/http/handlers/api"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// TestCartRoutesUseSignedInCustomer checks that the cart API serves a
+// signed in customer the cart their orders are placed from
+func TestCartRoutesUseSignedInCustomer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.OpenDB(t)
+	authService := auth.NewService(db)
+	accountService := account.NewService(db)
+
+	user, err := authService.Register("customer@example.com", "correct-horse-battery", "Ada", "Lovelace", "", nil, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := authService.Login(user.Email, "correct-horse-battery", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	registerCartRoutes(router.Group("/api/v1"),
+		apiHandlers.NewAuthHandler(authService, accountService),
+		apiHandlers.NewOrderHandler(order.NewService(db), order.NewCartService(db), accountService))
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil)
+	request.Header.Set("Authorization", "Bearer "+session.ID)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("GET /cart as a customer returned %d: %s", response.Code, response.Body)
+	}
+
+	var carts int64
+	db.Model(&domain.Cart{}).Where("customer_id = ?", user.ID).Count(&carts)
+	if carts != 1 {
+		t.Errorf("customer has %d carts, want 1", carts)
+	}
+
+	guest := httptest.NewRecorder()
+	router.ServeHTTP(guest, httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil))
+	if guest.Code != http.StatusBadRequest {
+		t.Errorf("GET /cart without a session or X-Session-ID returned %d, want %d", guest.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/infrastructure/backup"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// runRestore implements "server restore", which lists restore points and
+// restores a backup by ID or from a file. The server must be stopped while
+// the database and attachment files are replaced.
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server restore -list | -id <restore point> | -file <backup archive> [-yes]")
+		flags.PrintDefaults()
+	}
+	list := flags.Bool("list", false, "list restore points")
+	id := flags.Uint64("id", 0, "restore the restore point with this ID")
+	file := flags.String("file", "", "restore a backup archive from a local file")
+	yes := flags.Bool("yes", false, "skip the confirmation prompt")
+	configPath := flags.String("config", config.DefaultPath, "configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !*list && (*id == 0) == (*file == "") {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	backupService := backup.NewService(db, cfg)
+
+	if *list {
+		points, _, err := backupService.ListRestorePoints(0, 50, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list restore points: %v\n", err)
+			return 1
+		}
+		for _, point := range points {
+			fmt.Printf("%6d  %s  %-20s  %-8s  %10d  %s\n", point.ID, point.StartedAt.Format(time.RFC3339),
+				point.BackupConfig.Name, point.BackupConfig.Type, point.FileSize, point.FilePath)
+		}
+		return 0
+	}
+
+	source := *file
+	if *id != 0 {
+		point, err := backupService.GetRestorePoint(*id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		source = fmt.Sprintf("%s backup %q of %s", point.BackupConfig.Type, point.BackupConfig.Name, point.StartedAt.Format(time.RFC3339))
+	}
+
+	if !*yes {
+		fmt.Printf("Restoring %s replaces the database and attachment files.\n", source)
+		fmt.Println("Stop the OpenHost server before continuing.")
+		fmt.Print(`Type "restore" to continue: `)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "restore" {
+			fmt.Println("Restore cancelled")
+			return 1
+		}
+	}
+
+	var result *backup.RestoreResult
+	if *id != 0 {
+		result, err = backupService.Restore(context.Background(), *id)
+	} else {
+		result, err = backupService.RestoreFile(context.Background(), *file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore failed: %v\n", err)
+		if result != nil && result.PreviousDatabase != "" {
+			fmt.Fprintf(os.Stderr, "the previous database was moved to %s\n", result.PreviousDatabase)
+		}
+		return 1
+	}
+
+	fmt.Printf("Restored %s backup taken %s\n", result.Manifest.Type, result.Manifest.CreatedAt.Format(time.RFC3339))
+	if result.PreviousDatabase != "" {
+		fmt.Printf("The previous database was moved to %s\n", result.PreviousDatabase)
+	}
+	if result.Files > 0 {
+		fmt.Printf("Restored %d attachment file(s)\n", result.Files)
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+	"github.com/openhost/openhost/internal/infrastructure/secrets"
+)
+
+// configureSecrets loads the key service credentials are encrypted with.
+// Without one they are stored unencrypted.
+func configureSecrets(cfg config.SecretsConfig) (*secrets.Keyring, error) {
+	keyring, err := secrets.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if keyring == nil {
+		log.Printf("secrets: no key configured, service credentials are stored unencrypted")
+		domain.SetSecretCipher(nil)
+		return nil, nil
+	}
+	domain.SetSecretCipher(keyring)
+	return keyring, nil
+}
+
+// configureSecretResolver lets gateway, SMTP and provisioning credentials
+// refer to environment variables and Vault secrets
+func configureSecretResolver(cfg config.SecretsConfig) {
+	domain.SetSecretResolver(secrets.NewResolver(cfg.Vault))
+}
+
+// runRotateSecrets implements "server rotate-secrets", which encrypts the
+// service credentials not encrypted with the current key: those stored
+// before a key was configured and those encrypted with a previous key.
+// Previous keys can be removed from the configuration once it succeeds.
+func runRotateSecrets(args []string) int {
+	flags := flag.NewFlagSet("rotate-secrets", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server rotate-secrets [-dry-run]")
+		flags.PrintDefaults()
+	}
+	dryRun := flags.Bool("dry-run", false, "only count the values to encrypt")
+	configPath := flags.String("config", config.DefaultPath, "configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	keyring, err := configureSecrets(cfg.Secrets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load secrets key: %v\n", err)
+		return 1
+	}
+	if keyring == nil {
+		fmt.Fprintf(os.Stderr, "no secrets key configured, set secrets.key or %s\n", secrets.KeyEnv)
+		return 1
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate database: %v\n", err)
+		return 1
+	}
+
+	columns, err := secrets.Rotate(context.Background(), db, keyring, database.Models(), *dryRun)
+	verb := "Encrypted"
+	if *dryRun {
+		verb = "Would encrypt"
+	}
+	for _, column := range columns {
+		fmt.Printf("%s.%s: %s %d value(s), %d already on key %s\n",
+			column.Table, column.Column, verb, column.Rotated, column.Current, keyring.KeyID())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotation failed: %v\n", err)
+		fmt.Fprintln(os.Stderr, "values encrypted so far are saved; run the command again to continue")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/service/demo"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// runSeed implements "server seed -demo", which fills the database with
+// demo customers, products, services with their billing history, tickets
+// and knowledge base articles. The same -seed and -date always give the
+// same data.
+func runSeed(args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server seed -demo [-customers N] [-seed N] [-date YYYY-MM-DD]")
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", config.DefaultPath, "configuration file")
+	withDemo := flags.Bool("demo", false, "generate demo data")
+	customers := flags.Int("customers", 25, "number of demo customers")
+	seed := flags.Int64("seed", 1, "random seed")
+	date := flags.String("date", "", "date the histories lead up to (default today)")
+	password := flags.String("password", demo.DefaultPassword, "password of the demo accounts")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !*withDemo {
+		flags.Usage()
+		return 2
+	}
+
+	var now time.Time
+	if *date != "" {
+		parsed, err := time.Parse("2006-01-02", *date)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -date: %v\n", err)
+			return 2
+		}
+		now = parsed.Add(12 * time.Hour)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate database: %v\n", err)
+		return 1
+	}
+
+	summary, err := demo.NewService(db).Generate(demo.Options{
+		Customers: *customers,
+		Seed:      *seed,
+		Now:       now,
+		Password:  *password,
+	})
+	if errors.Is(err, demo.ErrAlreadySeeded) {
+		fmt.Fprintln(os.Stderr, "Demo data is already present; start from an empty database to seed again.")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate demo data: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Created %d customers, %d products, %d services, %d orders, %d invoices, %d transactions, %d tickets and %d articles.\n",
+		summary.Customers, summary.Products, summary.Services, summary.Orders,
+		summary.Invoices, summary.Transactions, summary.Tickets, summary.Articles)
+	fmt.Printf("Staff: %s\n", demo.StaffEmail)
+	for _, email := range summary.CustomerEmails {
+		fmt.Printf("Customer: %s\n", email)
+	}
+	fmt.Printf("Every demo account signs in with the password %q.\n", *password)
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+)
+
+// runStorageMigrate implements "server storage-migrate", which moves
+// attachments kept in the database or as local paths into the configured
+// file store. With -from it first copies the files of a previous local
+// store, e.g. after switching the driver to s3.
+func runStorageMigrate(args []string) int {
+	flags := flag.NewFlagSet("storage-migrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server storage-migrate [-from <local directory>] [-keep]")
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "", "copy files from this previous local storage directory")
+	keep := flags.Bool("keep", false, "keep attachment content in the database and local files on disk")
+	configPath := flags.String("config", config.DefaultPath, "configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate database: %v\n", err)
+		return 1
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open file storage: %v\n", err)
+		return 1
+	}
+
+	opts := storage.MigrateOptions{Keep: *keep}
+	if *from != "" {
+		opts.From = storage.NewLocal(*from, nil)
+	}
+
+	result, err := storage.Migrate(context.Background(), db, store, opts)
+	if result != nil {
+		if *from != "" {
+			fmt.Printf("Copied %d file(s) from %s\n", result.Copied, *from)
+		}
+		fmt.Printf("Moved %d ticket attachment(s), %d knowledge base attachment(s) and %d download(s)\n",
+			result.TicketAttachments, result.KBAttachments, result.Downloads)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		fmt.Fprintln(os.Stderr, "files moved so far are recorded; run the command again to continue")
+		return 1
+	}
+	return 0
+}
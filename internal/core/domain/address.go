@@ -0,0 +1,9 @@
+package domain
+
+// Checkout country settings, comma separated ISO 3166-1 alpha-2 codes.
+// When allowed countries are set, only customers with a billing address in
+// one of them can check out; customers in an embargoed country never can.
+const (
+	SettingAllowedCountries   = "checkout.allowed_countries"
+	SettingEmbargoedCountries = "checkout.embargoed_countries"
+)
@@ -70,6 +70,12 @@ type AffiliateReferral struct {
 	ConvertedAt   *time.Time // When they made their first purchase
 	CreatedAt     time.Time `gorm:"not null;index"`
 
+	// Token identifies the referral in the attribution cookie. ClickID is
+	// the click it came from and OrderID the first order it converted with.
+	Token   string  `gorm:"size:64;index"`
+	ClickID *uint64 `gorm:"index"`
+	OrderID *uint64 `gorm:"index"`
+
 	Affiliate Affiliate `gorm:"foreignKey:AffiliateID"`
 	Customer  *User     `gorm:"foreignKey:CustomerID"`
 }
@@ -170,6 +176,13 @@ type AffiliateBanner struct {
 	SortOrder   int       `gorm:"not null;default:0"`
 	CreatedAt   time.Time `gorm:"not null"`
 	UpdatedAt   time.Time `gorm:"not null"`
+
+	// ProductID links the banner to the order page of a product instead of
+	// TargetURL. Impressions counts the times it was served.
+	ProductID   *uint64 `gorm:"index"`
+	Impressions int64   `gorm:"not null;default:0"`
+
+	Product *Product `gorm:"foreignKey:ProductID"`
 }
 
 // AffiliateClick represents a click tracked for an affiliate
@@ -183,6 +196,13 @@ type AffiliateClick struct {
 	LandingPage string    `gorm:"size:500"`
 	CreatedAt   time.Time `gorm:"not null;index"`
 
+	// UTM parameters of the affiliate link
+	UTMSource   string `gorm:"size:100;index"`
+	UTMMedium   string `gorm:"size:100"`
+	UTMCampaign string `gorm:"size:100;index"`
+	UTMTerm     string `gorm:"size:100"`
+	UTMContent  string `gorm:"size:100"`
+
 	Affiliate Affiliate        `gorm:"foreignKey:AffiliateID"`
 	Banner    *AffiliateBanner `gorm:"foreignKey:BannerID"`
 }
@@ -0,0 +1,107 @@
+package domain
+
+import "time"
+
+// AgentNodeStatus is the state of a node running the agent
+type AgentNodeStatus string
+
+const (
+	AgentNodeStatusPending  AgentNodeStatus = "pending" // Waiting for the agent to register
+	AgentNodeStatusActive   AgentNodeStatus = "active"
+	AgentNodeStatusDisabled AgentNodeStatus = "disabled" // Its agent is refused
+)
+
+// AgentNode is a machine running the node agent, which reports its
+// capacity and health and runs the tasks queued for it. A node may be
+// linked to a server, whose capacity and usage it then keeps up to date.
+type AgentNode struct {
+	ID       uint64          `gorm:"primaryKey"`
+	Name     string          `gorm:"size:100;not null"`
+	ServerID *uint64         `gorm:"index"`
+	Status   AgentNodeStatus `gorm:"size:32;not null;default:'pending';index"`
+
+	// The enrollment token is handed to the agent once and traded for the
+	// node token when it registers. Only their SHA-256 hashes are kept.
+	EnrollmentHash      string `gorm:"size:64;index"`
+	EnrollmentExpiresAt *time.Time
+	TokenHash           string `gorm:"size:64;index"`
+
+	// Reported by the agent
+	Hostname        string  `gorm:"size:255"`
+	Version         string  `gorm:"size:50"`
+	OS              string  `gorm:"size:50"`
+	Arch            string  `gorm:"size:50"`
+	CPUCores        int     `gorm:"not null;default:0"`
+	MemoryBytes     int64   `gorm:"not null;default:0"`
+	DiskBytes       int64   `gorm:"not null;default:0"`
+	Load1           float64 `gorm:"not null;default:0"`
+	MemoryUsedBytes int64   `gorm:"not null;default:0"`
+	DiskUsedBytes   int64   `gorm:"not null;default:0"`
+	UptimeSeconds   int64   `gorm:"not null;default:0"`
+
+	RegisteredAt *time.Time
+	LastSeenAt   *time.Time `gorm:"index"`
+	CreatedAt    time.Time  `gorm:"not null"`
+	UpdatedAt    time.Time  `gorm:"not null"`
+
+	Server *Server `gorm:"foreignKey:ServerID"`
+}
+
+// AgentTaskStatus is the state of a task queued for a node
+type AgentTaskStatus string
+
+const (
+	AgentTaskStatusQueued    AgentTaskStatus = "queued"
+	AgentTaskStatusSent      AgentTaskStatus = "sent" // Handed to the agent, not yet started
+	AgentTaskStatusRunning   AgentTaskStatus = "running"
+	AgentTaskStatusSucceeded AgentTaskStatus = "succeeded"
+	AgentTaskStatusFailed    AgentTaskStatus = "failed"
+	AgentTaskStatusExpired   AgentTaskStatus = "expired" // Not picked up before it expired
+)
+
+// Finished reports whether the task will not change any more
+func (s AgentTaskStatus) Finished() bool {
+	return s == AgentTaskStatusSucceeded || s == AgentTaskStatusFailed || s == AgentTaskStatusExpired
+}
+
+// AgentTask is an action for the agent of a node to run, such as creating
+// the account of a service. Tasks are signed when sent, and the agent runs
+// only those signed by the panel.
+type AgentTask struct {
+	ID             uint64          `gorm:"primaryKey"`
+	NodeID         uint64          `gorm:"not null;index"`
+	ServiceID      *uint64         `gorm:"index"`
+	Action         string          `gorm:"size:64;not null"` // Name of the executable the agent runs
+	Args           JSONMap         `gorm:"type:jsonb"`
+	Status         AgentTaskStatus `gorm:"size:32;not null;default:'queued';index"`
+	TimeoutSeconds int             `gorm:"not null;default:0"`
+	ExpiresAt      time.Time       `gorm:"not null"`  // Tasks not started by then are not run
+	Output         string          `gorm:"type:text"` // Result reported by the agent
+	Error          string          `gorm:"type:text"`
+	CreatedBy      *uint64
+	SentAt         *time.Time
+	StartedAt      *time.Time
+	FinishedAt     *time.Time
+	CreatedAt      time.Time `gorm:"not null;index"`
+	UpdatedAt      time.Time `gorm:"not null"`
+
+	Node AgentNode `gorm:"foreignKey:NodeID"`
+}
+
+// AgentTaskLog is a line a task wrote, as streamed back by the agent
+type AgentTaskLog struct {
+	ID       uint64    `gorm:"primaryKey"`
+	TaskID   uint64    `gorm:"not null;index"`
+	Stream   string    `gorm:"size:10;not null"` // stdout or stderr
+	Line     string    `gorm:"type:text;not null"`
+	LoggedAt time.Time `gorm:"not null"`
+}
+
+// AgentSigningKey is the Ed25519 key tasks are signed with. Agents are
+// given the public key when they register.
+type AgentSigningKey struct {
+	ID         uint64    `gorm:"primaryKey"`
+	PrivateKey Secret    `gorm:"type:text;not null" json:"-"` // Base64 seed
+	PublicKey  string    `gorm:"size:64;not null"`            // Base64
+	CreatedAt  time.Time `gorm:"not null"`
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+)
+
+// APIRequestLog records a call made with an API key so admins can debug
+// customer integrations. Bodies are redacted of passwords, secrets and
+// card data before they are stored, and cut to the configured length.
+type APIRequestLog struct {
+	ID           uint64    `gorm:"primaryKey"`
+	APIKeyID     uint64    `gorm:"not null;index"`
+	UserID       uint64    `gorm:"not null;index"` // User the key acts as
+	Method       string    `gorm:"size:10;not null"`
+	Path         string    `gorm:"size:255;not null;index"`
+	Action       string    `gorm:"size:100;index"` // WHMCS API action
+	Query        string    `gorm:"type:text"`
+	Status       int       `gorm:"not null;index"`
+	DurationMS   int64     `gorm:"not null;default:0"`
+	IPAddress    string    `gorm:"size:45"`
+	UserAgent    string    `gorm:"size:512"`
+	RequestBody  string    `gorm:"type:text"`
+	ResponseBody string    `gorm:"type:text"`
+	Truncated    bool      `gorm:"not null;default:false"` // A body was cut to the length limit
+	CreatedAt    time.Time `gorm:"not null;index"`
+
+	APIKey APIKey `gorm:"foreignKey:APIKeyID"`
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+)
+
+// ApprovalStatus is where an approval request is in the two-person rule
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"   // Waiting for a second admin
+	ApprovalApproved  ApprovalStatus = "approved"  // Approved, being carried out
+	ApprovalExecuted  ApprovalStatus = "executed"  // Approved and carried out
+	ApprovalFailed    ApprovalStatus = "failed"    // Approved, but the action failed
+	ApprovalRejected  ApprovalStatus = "rejected"  // Refused by another admin
+	ApprovalCancelled ApprovalStatus = "cancelled" // Withdrawn by the requester
+	ApprovalExpired   ApprovalStatus = "expired"   // Not approved within the window
+)
+
+// ApprovalRequest is a dangerous admin action, such as terminating a
+// service or refunding a payment, held until a second admin approves it.
+// The audit log entries of the request and of the action have it as
+// their entity.
+type ApprovalRequest struct {
+	ID            uint64         `gorm:"primaryKey"`
+	Action        string         `gorm:"size:64;not null;index"`
+	Params        JSONMap        `gorm:"type:jsonb"` // What the action is carried out with
+	Summary       string         `gorm:"size:255;not null"`
+	Status        ApprovalStatus `gorm:"size:16;not null;default:'pending';index"`
+	RequestedByID uint64         `gorm:"not null;index"`
+	DecidedByID   *uint64        // The admin who approved or rejected it
+	DecisionNote  string         `gorm:"size:500"`
+	Result        string         `gorm:"type:text"` // Outcome or error of the action
+	ExpiresAt     time.Time      `gorm:"not null;index"`
+	DecidedAt     *time.Time
+	CreatedAt     time.Time `gorm:"not null;index"`
+	UpdatedAt     time.Time `gorm:"not null"`
+
+	RequestedBy *User `gorm:"foreignKey:RequestedByID"`
+	DecidedBy   *User `gorm:"foreignKey:DecidedByID"`
+}
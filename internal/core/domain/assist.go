@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ChatMessage is a message of a conversation with a language model
+type ChatMessage struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// CompletionRequest asks a language model to continue a conversation
+type CompletionRequest struct {
+	Messages    []ChatMessage
+	MaxTokens   int
+	Temperature float64
+}
+
+// CompletionResponse is the answer of a language model
+type CompletionResponse struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// CompletionProvider generates text with a language model, such as the
+// OpenAI API or a compatible server running locally
+type CompletionProvider interface {
+	Name() string
+	Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
+}
+
+// Kinds of AI assist requests
+const (
+	AssistKindTicketReply    = "ticket_reply"
+	AssistKindArticleSummary = "article_summary"
+)
+
+// Logging levels of AI assist requests
+const (
+	AssistLogNone     = "none"     // Nothing is recorded
+	AssistLogMetadata = "metadata" // Who asked for what, tokens and errors
+	AssistLogFull     = "full"     // Metadata with the prompt and response
+)
+
+// AssistSetting is the choice of an admin to use AI assist. It is off
+// until the admin turns it on.
+type AssistSetting struct {
+	ID        uint64    `gorm:"primaryKey"`
+	AdminID   uint64    `gorm:"not null;uniqueIndex"`
+	Enabled   bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// AssistLog records a request for a draft. Prompt and Response are kept
+// only when full logging is configured.
+type AssistLog struct {
+	ID               uint64    `gorm:"primaryKey"`
+	AdminID          uint64    `gorm:"not null;index"`
+	Kind             string    `gorm:"size:32;not null;index"`
+	SubjectID        uint64    `gorm:"not null"` // Ticket or article
+	Provider         string    `gorm:"size:32;not null"`
+	Model            string    `gorm:"size:100"`
+	Prompt           string    `gorm:"type:text"`
+	Response         string    `gorm:"type:text"`
+	PromptTokens     int       `gorm:"not null;default:0"`
+	CompletionTokens int       `gorm:"not null;default:0"`
+	DurationMS       int64     `gorm:"not null;default:0"`
+	Error            string    `gorm:"size:500"`
+	CreatedAt        time.Time `gorm:"not null;index"`
+}
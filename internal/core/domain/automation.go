@@ -261,6 +261,7 @@ type DataRetentionPolicy struct {
 	ID                    uint64    `gorm:"primaryKey"`
 	DataType              string    `gorm:"size:50;not null;uniqueIndex"` // invoices, tickets, logs, etc.
 	RetentionDays         int       `gorm:"not null;default:0"` // 0 = keep forever
+	ArchiveAfterDays      int       `gorm:"not null;default:0"` // Move to archive table after X days (0 = no archive stage)
 	AnonymizeInstead      bool      `gorm:"not null;default:false"` // Anonymize instead of delete
 	RequireInactive       bool      `gorm:"not null;default:true"` // Only delete for inactive customers
 	InactiveDays          int       `gorm:"not null;default:365"`
@@ -271,6 +272,20 @@ type DataRetentionPolicy struct {
 	UpdatedAt             time.Time `gorm:"not null"`
 }
 
+// LogArchive records a compressed export of log rows taken before they were purged
+type LogArchive struct {
+	ID          uint64    `gorm:"primaryKey"`
+	DataType    string    `gorm:"size:50;not null;index"` // email_logs, webhook_deliveries, kb_search_logs, download_logs
+	SourceTable string    `gorm:"size:100;not null"`
+	PeriodStart time.Time `gorm:"not null"`
+	PeriodEnd   time.Time `gorm:"not null"`
+	RowCount    int64     `gorm:"not null;default:0"`
+	FilePath    string    `gorm:"size:500;not null"`
+	FileSize    int64     `gorm:"not null;default:0"`
+	Checksum    string    `gorm:"size:64;not null"` // SHA-256 of the compressed file
+	CreatedAt   time.Time `gorm:"not null;index"`
+}
+
 // SystemTask represents a system background task
 type SystemTask struct {
 	ID          uint64    `gorm:"primaryKey"`
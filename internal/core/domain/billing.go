@@ -39,9 +39,26 @@ type Invoice struct {
 	CreatedAt     time.Time `gorm:"not null"`
 	UpdatedAt     time.Time `gorm:"not null"`
 
+	// Drafts are held for review: they are not emailed or payable until
+	// published, by hand or at PublishAt
+	PublishAt   *time.Time `gorm:"index"`
+	PublishedAt *time.Time
+
+	// Dunning reminders sent since the invoice fell overdue
+	RemindersSent  int `gorm:"not null;default:0"`
+	LastReminderAt *time.Time
+
+	// Reverse charged invoices carry no VAT; the buyer's VAT number and
+	// the VIES check it passed are stamped on them
+	ReverseCharge   bool   `gorm:"not null;default:false"`
+	VATNumber       string `gorm:"size:20"`
+	VATCheckedAt    *time.Time
+	VATConsultation string `gorm:"size:64"`
+
 	// Relations
 	Customer  User          `gorm:"foreignKey:CustomerID"`
 	LineItems []InvoiceItem `gorm:"foreignKey:InvoiceID"`
+	Taxes     []InvoiceTax  `gorm:"foreignKey:InvoiceID"`
 }
 
 // IsPaid checks if the invoice is fully paid
@@ -49,6 +66,16 @@ func (i *Invoice) IsPaid() bool {
 	return i.Status == InvoiceStatusPaid
 }
 
+// IsDraft reports whether the invoice is held for review
+func (i *Invoice) IsDraft() bool {
+	return i.Status == InvoiceStatusDraft
+}
+
+// SettingInvoiceReviewHours is the setting holding generated renewal
+// invoices as drafts for review for that many hours, 0 to publish them
+// right away
+const SettingInvoiceReviewHours = "billing.invoice_review_hours"
+
 // IsOverdue checks if the invoice is overdue
 func (i *Invoice) IsOverdue() bool {
 	if i.Status == InvoiceStatusPaid || i.Status == InvoiceStatusCancelled {
@@ -122,6 +149,7 @@ type Transaction struct {
 	Currency          string            `gorm:"size:3;not null"`
 	Amount            decimal.Decimal   `gorm:"type:numeric(20,8);not null"`
 	Fee               decimal.Decimal   `gorm:"type:numeric(20,8);not null;default:0"`
+	FeeCalculated     bool              `gorm:"not null;default:false"` // Fee from the gateway fee settings, not the processor
 	Gateway           string            `gorm:"size:50"`
 	GatewayTransID    string            `gorm:"size:255"`
 	Description       string            `gorm:"size:500"`
@@ -129,6 +157,7 @@ type Transaction struct {
 	RefundTransID     *uint64           `gorm:"index"`
 	IPAddress         string            `gorm:"size:45"`
 	Metadata          JSONMap           `gorm:"type:jsonb"`
+	Test              bool              `gorm:"not null;default:false;index"` // Charged in a gateway sandbox, excluded from reports
 	CreatedAt         time.Time         `gorm:"not null;index"`
 	UpdatedAt         time.Time         `gorm:"not null"`
 
@@ -209,6 +238,24 @@ func (p *PaymentMethod) DisplayName() string {
 	}
 }
 
+// MaskedName names the payment method on receipts without its label,
+// which customers may have written the full number into, such as
+// "Visa **** 4242"
+func (p *PaymentMethod) MaskedName() string {
+	switch {
+	case p.Type != PaymentMethodCard:
+		masked := *p
+		masked.Label = ""
+		return masked.DisplayName()
+	case p.Last4 == "":
+		return "Card"
+	case p.Brand != "":
+		return p.Brand + " **** " + p.Last4
+	default:
+		return "Card **** " + p.Last4
+	}
+}
+
 // IsExpired checks if a card payment method has expired
 func (p *PaymentMethod) IsExpired() bool {
 	if p.Type != PaymentMethodCard {
@@ -270,6 +317,13 @@ type Coupon struct {
 	ExpiresAt       *time.Time
 	CreatedAt       time.Time `gorm:"not null"`
 	UpdatedAt       time.Time `gorm:"not null"`
+
+	// BatchID is the batch of single-use codes the coupon was generated in.
+	// Such codes record who redeemed them with which order.
+	BatchID         *uint64 `gorm:"index"`
+	RedeemedBy      *uint64 `gorm:"index"`
+	RedeemedOrderID *uint64
+	RedeemedAt      *time.Time
 }
 
 // IsValid checks if the coupon is currently valid
@@ -290,6 +344,28 @@ func (c *Coupon) IsValid() bool {
 	return true
 }
 
+// RecurringDiscount returns the discount of the coupon on a recurring
+// amount, capped at the amount
+func (c *Coupon) RecurringDiscount(amount decimal.Decimal) decimal.Decimal {
+	discount := decimal.Zero
+	switch c.Type {
+	case CouponTypePercentage:
+		discount = amount.Mul(c.Amount).Div(decimal.NewFromInt(100)).Round(2)
+	case CouponTypeFixed:
+		discount = c.Amount
+	case CouponTypeOverride:
+		discount = amount.Sub(c.Amount)
+	}
+
+	if discount.IsNegative() {
+		return decimal.Zero
+	}
+	if discount.GreaterThan(amount) {
+		return amount
+	}
+	return discount
+}
+
 // CouponUsage tracks usage of coupons per customer
 type CouponUsage struct {
 	ID         uint64    `gorm:"primaryKey"`
@@ -320,6 +396,24 @@ type TaxRule struct {
 	UpdatedAt   time.Time       `gorm:"not null"`
 }
 
+// InvoiceTax records a tax charged on an invoice, one for each tax rule
+// applied, so tax can be reported per jurisdiction and rate. The rule is
+// copied because rules change over time.
+type InvoiceTax struct {
+	ID            uint64          `gorm:"primaryKey"`
+	InvoiceID     uint64          `gorm:"not null;index"`
+	TaxRuleID     *uint64         `gorm:"index"`
+	Name          string          `gorm:"size:100;not null"`
+	Country       string          `gorm:"size:2;not null;index"`
+	State         string          `gorm:"size:100"`
+	TaxType       string          `gorm:"size:32;not null"`
+	Rate          decimal.Decimal `gorm:"type:numeric(10,4);not null"`
+	IsInclusive   bool            `gorm:"not null;default:false"`
+	TaxableAmount decimal.Decimal `gorm:"type:numeric(20,8);not null"` // Net amount the tax is charged on
+	Amount        decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	CreatedAt     time.Time       `gorm:"not null"`
+}
+
 // Credit represents a credit adjustment on a customer account
 type Credit struct {
 	ID          uint64          `gorm:"primaryKey"`
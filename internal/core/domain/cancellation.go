@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+)
+
+// CancellationType represents when a cancelled service is terminated
+type CancellationType string
+
+const (
+	CancellationTypeImmediate  CancellationType = "immediate"
+	CancellationTypeEndOfCycle CancellationType = "end_of_cycle"
+)
+
+// CancellationStatus represents the status of a cancellation request
+type CancellationStatus string
+
+const (
+	CancellationStatusPending   CancellationStatus = "pending"  // Awaiting admin approval
+	CancellationStatusApproved  CancellationStatus = "approved" // Termination scheduled
+	CancellationStatusRejected  CancellationStatus = "rejected"
+	CancellationStatusWithdrawn CancellationStatus = "withdrawn"
+	CancellationStatusRetained  CancellationStatus = "retained"  // Retention offer accepted instead
+	CancellationStatusCompleted CancellationStatus = "completed" // Service terminated
+)
+
+// CancellationRequest represents a customer's request to cancel a service
+type CancellationRequest struct {
+	ID               uint64             `gorm:"primaryKey"`
+	ServiceID        uint64             `gorm:"not null;index"`
+	CustomerID       uint64             `gorm:"not null;index"`
+	Type             CancellationType   `gorm:"size:32;not null"`
+	Reason           string             `gorm:"type:text"`
+	Status           CancellationStatus `gorm:"size:32;not null;default:'pending';index"`
+	RetentionOfferID *uint64            `gorm:"index"`
+	ScheduledFor     *time.Time         `gorm:"index"` // Termination date once approved
+	ReviewedBy       *uint64
+	ReviewedAt       *time.Time
+	AdminNotes       string `gorm:"type:text"`
+	CompletedAt      *time.Time
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time `gorm:"not null"`
+
+	Service        Service         `gorm:"foreignKey:ServiceID"`
+	Customer       User            `gorm:"foreignKey:CustomerID"`
+	RetentionOffer *RetentionOffer `gorm:"foreignKey:RetentionOfferID"`
+}
+
+// IsOpen checks if the request still leads to a termination
+func (r *CancellationRequest) IsOpen() bool {
+	return r.Status == CancellationStatusPending || r.Status == CancellationStatusApproved
+}
+
+// RetentionOffer represents a discount offered to customers before they
+// confirm a cancellation. Accepting it applies the coupon to the renewals of
+// the service.
+type RetentionOffer struct {
+	ID          uint64    `gorm:"primaryKey"`
+	Name        string    `gorm:"size:255;not null"`
+	Description string    `gorm:"type:text"`
+	ProductID   *uint64   `gorm:"index"` // nil = all products
+	CouponID    uint64    `gorm:"not null;index"`
+	Active      bool      `gorm:"not null;default:true"`
+	SortOrder   int       `gorm:"not null;default:0"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+
+	Product *Product `gorm:"foreignKey:ProductID"`
+	Coupon  Coupon   `gorm:"foreignKey:CouponID"`
+}
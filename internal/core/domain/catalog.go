@@ -26,6 +26,7 @@ type Product struct {
 	Description    string        `gorm:"type:text"`
 	ModuleName     string        `gorm:"size:128;not null;index"`
 	Active         bool          `gorm:"not null;default:true"`
+	Restricted     bool          `gorm:"not null;default:false"` // Only shown to customer groups with prices for it
 	ConfigGroups   []ConfigGroup `gorm:"many2many:product_config_groups"`
 	CreatedAt      time.Time     `gorm:"not null"`
 	UpdatedAt      time.Time     `gorm:"not null"`
@@ -65,10 +66,27 @@ type ConfigSubOption struct {
 	Name           string    `gorm:"size:255;not null"`
 	SortOrder      int       `gorm:"not null;default:0"`
 	Pricing        Pricing   `gorm:"embedded"`
+	StockControl   bool      `gorm:"not null;default:false"`
+	StockQuantity  int       `gorm:"not null;default:0"`
+	OutOfStockMsg  string    `gorm:"size:255"`
+	SoldOut        bool      `gorm:"-"`
 	CreatedAt      time.Time `gorm:"not null"`
 	UpdatedAt      time.Time `gorm:"not null"`
 }
 
+// ConfigStockReservation holds stock of a config sub-option for a cart item
+// until the cart expires, then for the order placed from it until the order
+// is completed or cancelled
+type ConfigStockReservation struct {
+	ID          uint64     `gorm:"primaryKey"`
+	SubOptionID uint64     `gorm:"not null;index"`
+	CartItemID  *uint64    `gorm:"index"`
+	OrderID     *uint64    `gorm:"index"`
+	Quantity    int        `gorm:"not null"`
+	ExpiresAt   *time.Time `gorm:"index"` // Nil while held by an order
+	CreatedAt   time.Time  `gorm:"not null"`
+}
+
 type Pricing struct {
 	SetupFee    decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"`
 	Monthly     decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"`
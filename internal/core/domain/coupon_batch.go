@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// CouponBatch is a set of single-use coupons generated together from a
+// pattern, sharing the same discount and rules
+type CouponBatch struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Name      string `gorm:"size:100;not null"`
+	Pattern   string `gorm:"size:50;not null"` // X is a random character, e.g. BF25-XXXXXX
+	Quantity  int    `gorm:"not null"`
+	CreatedBy *uint64
+	CreatedAt time.Time `gorm:"not null"`
+
+	Coupons []Coupon `gorm:"foreignKey:BatchID"`
+}
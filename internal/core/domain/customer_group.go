@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CustomerGroupPrice overrides the price of a product in a currency for
+// the members of a customer group. Cycles set to -1 keep the product
+// price; other cycles are sold at the group price even when the product
+// does not offer them. A group with prices for a restricted product can
+// see and order it.
+type CustomerGroupPrice struct {
+	ID              uint64          `gorm:"primaryKey"`
+	CustomerGroupID uint64          `gorm:"not null;uniqueIndex:idx_group_product_currency"`
+	ProductID       uint64          `gorm:"not null;uniqueIndex:idx_group_product_currency;index"`
+	Currency        string          `gorm:"size:3;not null;uniqueIndex:idx_group_product_currency"`
+	SetupFee        decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	Monthly         decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	Quarterly       decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	SemiAnnually    decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	Annually        decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	Biennially      decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	Triennially     decimal.Decimal `gorm:"type:numeric(20,8);not null;default:-1"`
+	CreatedAt       time.Time       `gorm:"not null"`
+	UpdatedAt       time.Time       `gorm:"not null"`
+
+	Product Product `gorm:"foreignKey:ProductID"`
+}
+
+// ApplyTo replaces the prices of a product pricing the group price sets
+func (p *CustomerGroupPrice) ApplyTo(pricing *ProductPricing) {
+	override := func(price decimal.Decimal, target *decimal.Decimal) {
+		if !price.IsNegative() {
+			*target = price
+		}
+	}
+	override(p.SetupFee, &pricing.SetupFee)
+	override(p.Monthly, &pricing.Monthly)
+	override(p.Quarterly, &pricing.Quarterly)
+	override(p.SemiAnnually, &pricing.SemiAnnually)
+	override(p.Annually, &pricing.Annually)
+	override(p.Biennially, &pricing.Biennially)
+	override(p.Triennially, &pricing.Triennially)
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CycleChangeStatus represents the status of a billing cycle change
+type CycleChangeStatus string
+
+const (
+	CycleChangeStatusPending   CycleChangeStatus = "pending"   // Awaiting payment of the adjustment invoice
+	CycleChangeStatusCompleted CycleChangeStatus = "completed" // Applied to the service
+	CycleChangeStatusCancelled CycleChangeStatus = "cancelled"
+)
+
+// CycleChange represents a customer's switch of a service to another
+// billing cycle. The unused part of the current period is credited against
+// a full period of the new cycle starting when the change was requested.
+type CycleChange struct {
+	ID             uint64            `gorm:"primaryKey"`
+	ServiceID      uint64            `gorm:"not null;index"`
+	CustomerID     uint64            `gorm:"not null;index"`
+	InvoiceID      *uint64           `gorm:"index"` // Adjustment invoice, nil when nothing was due
+	Status         CycleChangeStatus `gorm:"size:32;not null;default:'pending';index"`
+	FromCycle      string            `gorm:"size:32;not null"`
+	ToCycle        string            `gorm:"size:32;not null"`
+	OldAmount      decimal.Decimal   `gorm:"type:numeric(20,8);not null"` // Recurring amount of the service and its addons
+	NewAmount      decimal.Decimal   `gorm:"type:numeric(20,8);not null"` // Recurring amount of the service on the new cycle
+	AddonAmounts   JSONMap           `gorm:"type:jsonb"`                  // New per unit amounts of recurring addons, by service addon ID
+	Credit         decimal.Decimal   `gorm:"type:numeric(20,8);not null"` // Unused part of the current period
+	Charge         decimal.Decimal   `gorm:"type:numeric(20,8);not null"` // First period of the new cycle
+	AmountDue      decimal.Decimal   `gorm:"type:numeric(20,8);not null"`
+	AccountCredit  decimal.Decimal   `gorm:"type:numeric(20,8);not null;default:0"` // Credit in excess of the charge, added to the balance
+	PreviousDueAt  time.Time         `gorm:"not null"`
+	NewNextDueDate time.Time         `gorm:"not null"`
+	CompletedAt    *time.Time
+	CreatedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time `gorm:"not null"`
+
+	Service Service  `gorm:"foreignKey:ServiceID"`
+	Invoice *Invoice `gorm:"foreignKey:InvoiceID"`
+}
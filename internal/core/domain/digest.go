@@ -0,0 +1,82 @@
+package domain
+
+import "time"
+
+// EmailCategory groups the non-critical emails a user chooses how often
+// to receive. Other emails, such as password resets and overdue notices,
+// are always sent at once.
+type EmailCategory string
+
+const (
+	EmailCategoryAnnouncement  EmailCategory = "announcement"
+	EmailCategoryKnowledgeBase EmailCategory = "knowledge_base"
+	EmailCategoryMarketing     EmailCategory = "marketing"
+	EmailCategoryBilling       EmailCategory = "billing" // New invoices
+)
+
+// EmailCategories lists the categories users set a frequency for
+var EmailCategories = []EmailCategory{
+	EmailCategoryAnnouncement,
+	EmailCategoryKnowledgeBase,
+	EmailCategoryMarketing,
+	EmailCategoryBilling,
+}
+
+// Valid reports whether the category is a known email category
+func (c EmailCategory) Valid() bool {
+	for _, category := range EmailCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// CanOptOut reports whether users can unsubscribe from the category.
+// Invoices are always sent; every other category is marketing-class and
+// its emails carry an unsubscribe link.
+func (c EmailCategory) CanOptOut() bool {
+	return c.Valid() && c != EmailCategoryBilling
+}
+
+// EmailFrequency is how often a user gets the emails of a category
+type EmailFrequency string
+
+const (
+	EmailFrequencyImmediate EmailFrequency = "immediate"
+	EmailFrequencyDaily     EmailFrequency = "daily"
+	EmailFrequencyWeekly    EmailFrequency = "weekly"
+	EmailFrequencyNever     EmailFrequency = "never" // Unsubscribed
+)
+
+// Valid reports whether the frequency is a known email frequency
+func (f EmailFrequency) Valid() bool {
+	return f == EmailFrequencyImmediate || f == EmailFrequencyDaily || f == EmailFrequencyWeekly ||
+		f == EmailFrequencyNever
+}
+
+// EmailDigestPreference is how often a user gets the emails of a
+// category. Categories without a preference are sent at once.
+type EmailDigestPreference struct {
+	ID        uint64         `gorm:"primaryKey"`
+	UserID    uint64         `gorm:"not null;uniqueIndex:idx_email_digest_preference"`
+	Category  EmailCategory  `gorm:"size:32;not null;uniqueIndex:idx_email_digest_preference"`
+	Frequency EmailFrequency `gorm:"size:16;not null"`
+	CreatedAt time.Time      `gorm:"not null"`
+	UpdatedAt time.Time      `gorm:"not null"`
+}
+
+// EmailDigestItem is an email held back for the next digest of a user
+type EmailDigestItem struct {
+	ID        uint64        `gorm:"primaryKey"`
+	UserID    uint64        `gorm:"not null;index"`
+	Category  EmailCategory `gorm:"size:32;not null"`
+	Subject   string        `gorm:"size:500;not null"`
+	BodyHTML  string        `gorm:"type:text"`
+	BodyPlain string        `gorm:"type:text"`
+	// Attachments go out with the digest, as those of EmailQueue
+	Attachments JSONMap    `gorm:"type:jsonb"`
+	DueAt       time.Time  `gorm:"not null;index"` // When the digest holding it is sent
+	SentAt      *time.Time `gorm:"index"`
+	CreatedAt   time.Time  `gorm:"not null"`
+}
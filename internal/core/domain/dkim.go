@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// DKIMKey is the key outbound email from a sending domain is signed with.
+// The public key is published in DNS at <selector>._domainkey.<domain>.
+type DKIMKey struct {
+	ID         uint64    `gorm:"primaryKey"`
+	Domain     string    `gorm:"size:255;not null;uniqueIndex"` // Lower case
+	Selector   string    `gorm:"size:63;not null"`
+	PrivateKey string    `gorm:"type:text;not null" json:"-"` // PKCS#1 PEM
+	PublicKey  string    `gorm:"type:text;not null"`          // Base64 DER, the p= tag of the DNS record
+	Active     bool      `gorm:"not null;default:true"`
+	CreatedAt  time.Time `gorm:"not null"`
+	UpdatedAt  time.Time `gorm:"not null"`
+}
+
+// DNSRecord returns the TXT record publishing the key
+func (k *DKIMKey) DNSRecord() string {
+	return "v=DKIM1; k=rsa; p=" + k.PublicKey
+}
+
+// DNSName returns the name the key is published at
+func (k *DKIMKey) DNSName() string {
+	return k.Selector + "._domainkey." + k.Domain
+}
@@ -0,0 +1,12 @@
+package domain
+
+// InvoiceRenderer renders invoices as PDF documents in the language of the
+// reader. The invoice is loaded with its line items, taxes and customer.
+type InvoiceRenderer interface {
+	RenderInvoice(invoice *Invoice, language string) ([]byte, error)
+}
+
+// AttachmentInvoicePDF is the key of queued email attachments holding the
+// IDs of invoices, whose PDFs are rendered when the email is sent so they
+// show the invoices as they are then
+const AttachmentInvoicePDF = "invoice_pdf"
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Dunning settings. Reminder days are the days overdue, comma separated,
+// on which customers are reminded of an unpaid invoice; suspend days are
+// the days overdue after which the services billed on it are suspended, 0
+// to never suspend them.
+const (
+	SettingDunningReminderDays = "billing.dunning_reminder_days"
+	SettingDunningSuspendDays  = "billing.dunning_suspend_days"
+)
+
+// PaymentPromiseStatus is the state of a promise to pay
+type PaymentPromiseStatus string
+
+const (
+	PaymentPromiseActive    PaymentPromiseStatus = "active"
+	PaymentPromiseKept      PaymentPromiseStatus = "kept"
+	PaymentPromiseBroken    PaymentPromiseStatus = "broken"
+	PaymentPromiseCancelled PaymentPromiseStatus = "cancelled"
+)
+
+// PaymentPromise is a customer's promise to pay an overdue invoice by a
+// date, recorded by staff. While it is active the invoice is left out of
+// dunning; it is broken when the invoice is still unpaid after that day.
+type PaymentPromise struct {
+	ID           uint64               `gorm:"primaryKey"`
+	InvoiceID    uint64               `gorm:"not null;index"`
+	CustomerID   uint64               `gorm:"not null;index"`
+	PromisedDate time.Time            `gorm:"not null"` // Paid by the end of this day
+	Note         string               `gorm:"size:500"`
+	Status       PaymentPromiseStatus `gorm:"size:16;not null;default:'active';index"`
+	RecordedBy   uint64               `gorm:"not null"`
+	ResolvedAt   *time.Time
+	CreatedAt    time.Time `gorm:"not null"`
+
+	Invoice Invoice `gorm:"foreignKey:InvoiceID"`
+}
+
+// IsActive reports whether the promise still pauses dunning
+func (p *PaymentPromise) IsActive() bool {
+	return p.Status == PaymentPromiseActive
+}
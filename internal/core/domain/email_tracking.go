@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// EmailLink is a link of a tracked email. The email links to the click
+// tracker, which counts the click and redirects to URL.
+type EmailLink struct {
+	ID            uint64 `gorm:"primaryKey"`
+	EmailLogID    uint64 `gorm:"not null;uniqueIndex:idx_email_link_position"`
+	Position      int    `gorm:"not null;uniqueIndex:idx_email_link_position"` // Order in the email, from 0
+	URL           string `gorm:"type:text;not null"`
+	Clicks        int    `gorm:"not null;default:0"`
+	LastClickedAt *time.Time
+}
+
+// SettingEmailTracking is the setting turning the open and click tracking
+// of emails on
+const SettingEmailTracking = "email.tracking"
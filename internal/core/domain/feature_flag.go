@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// Feature flags gating subsystems that are rolled out gradually
+const (
+	FeatureNewCheckout = "new_checkout"
+	FeatureGraphQL     = "graphql"
+	FeatureLiveChat    = "live_chat"
+)
+
+// KnownFeatureFlags describes the flags the code checks. They are listed
+// to admins, off, until they are first saved.
+var KnownFeatureFlags = map[string]string{
+	FeatureNewCheckout: "New checkout flow",
+	FeatureGraphQL:     "GraphQL API",
+	FeatureLiveChat:    "Live chat widget",
+}
+
+// FeatureFlagTargets are who a flag is turned on for besides the share of
+// users it is rolled out to
+type FeatureFlagTargets struct {
+	Roles            []UserRole `json:"roles,omitempty"`
+	CustomerGroupIDs []uint64   `json:"customer_group_ids,omitempty"`
+	UserIDs          []uint64   `json:"user_ids,omitempty"`
+}
+
+// Value implements driver.Valuer for FeatureFlagTargets
+func (t FeatureFlagTargets) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// Scan implements sql.Scanner for FeatureFlagTargets
+func (t *FeatureFlagTargets) Scan(value interface{}) error {
+	data, err := normalizeJSONBytes(value)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		*t = FeatureFlagTargets{}
+		return nil
+	}
+	return json.Unmarshal(data, t)
+}
+
+// FeatureFlag turns a subsystem on for some users without a redeploy.
+// While Enabled it is on for the targeted roles, customer groups and users,
+// and for Percentage of the other signed in users, picked by a hash of the
+// user so each keeps the same answer. Guests only get it at 100 percent.
+type FeatureFlag struct {
+	ID          uint64             `gorm:"primaryKey"`
+	Key         string             `gorm:"size:64;not null;uniqueIndex"`
+	Description string             `gorm:"size:255"`
+	Enabled     bool               `gorm:"not null;default:false"` // Off for everyone when false
+	Percentage  int                `gorm:"not null;default:0"`     // Share of users it is rolled out to, 0 to 100
+	Targets     FeatureFlagTargets `gorm:"type:jsonb"`
+	UpdatedBy   *uint64
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// HealthRisk groups customers by their health score
+type HealthRisk string
+
+const (
+	HealthRiskHealthy HealthRisk = "healthy"   // Score of 70 or more
+	HealthRiskAtRisk  HealthRisk = "at_risk"   // Score of 40 to 69
+	HealthRiskHigh    HealthRisk = "high_risk" // Score below 40
+)
+
+// RiskForScore returns the risk group of a health score
+func RiskForScore(score int) HealthRisk {
+	switch {
+	case score >= 70:
+		return HealthRiskHealthy
+	case score >= 40:
+		return HealthRiskAtRisk
+	default:
+		return HealthRiskHigh
+	}
+}
+
+// Valid reports whether the risk is a known group
+func (r HealthRisk) Valid() bool {
+	return r == HealthRiskHealthy || r == HealthRiskAtRisk || r == HealthRiskHigh
+}
+
+// Churn-risk flags explaining a low health score
+const (
+	HealthFlagLatePayments      = "late_payments"
+	HealthFlagOverdueInvoices   = "overdue_invoices"
+	HealthFlagTicketVolume      = "high_ticket_volume"
+	HealthFlagNegativeSentiment = "negative_sentiment"
+	HealthFlagSuspended         = "suspended_services"
+	HealthFlagCancellation      = "cancellation_requested"
+	HealthFlagNoServices        = "no_active_services"
+	HealthFlagInactive          = "inactive_login"
+)
+
+// HealthFlags are the churn-risk flags of a customer
+type HealthFlags []string
+
+// Value implements driver.Valuer for HealthFlags
+func (f HealthFlags) Value() (driver.Value, error) {
+	if f == nil {
+		f = HealthFlags{}
+	}
+	return json.Marshal(f)
+}
+
+// Scan implements sql.Scanner for HealthFlags
+func (f *HealthFlags) Scan(value interface{}) error {
+	data, err := normalizeJSONBytes(value)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		*f = HealthFlags{}
+		return nil
+	}
+	return json.Unmarshal(data, f)
+}
+
+// CustomerHealth is the latest health score of a customer, from 0 to 100,
+// and the part scores it is weighted from. It is recomputed periodically;
+// PreviousScore keeps the score before the latest change.
+type CustomerHealth struct {
+	CustomerID      uint64      `gorm:"primaryKey;autoIncrement:false"`
+	Score           int         `gorm:"not null;index"`
+	Risk            HealthRisk  `gorm:"size:16;not null;index"`
+	PaymentScore    int         `gorm:"not null"` // Invoices paid on time
+	SupportScore    int         `gorm:"not null"` // Ticket volume and tone
+	UsageScore      int         `gorm:"not null"` // Active, suspended and cancelled services
+	EngagementScore int         `gorm:"not null"` // Recency of the last login
+	Flags           HealthFlags `gorm:"type:jsonb"`
+	PreviousScore   *int
+	ComputedAt      time.Time  `gorm:"not null"`
+	AlertedAt       *time.Time // Last time staff was alerted of a drop
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"image"
+	"io"
+	"time"
+)
+
+// WebPEncoder converts images to WebP, which the standard library cannot
+// encode
+type WebPEncoder interface {
+	EncodeWebP(ctx context.Context, img image.Image, w io.Writer) error
+}
+
+// MediaFile is an image of the media library, hosted for knowledge base
+// articles and product descriptions. Large images are scaled down on
+// upload; the thumbnail and WebP variants are kept next to the image and
+// WebPKey and ThumbnailWebPKey are empty when no WebP encoder is set.
+type MediaFile struct {
+	ID               uint64    `gorm:"primaryKey"`
+	FileName         string    `gorm:"size:255;not null"`
+	Folder           string    `gorm:"size:255;not null;default:'';index"`
+	AltText          string    `gorm:"size:500"`
+	ContentType      string    `gorm:"size:100;not null"`
+	Width            int       `gorm:"not null"`
+	Height           int       `gorm:"not null"`
+	FileSize         int64     `gorm:"not null"`
+	StorageKey       string    `gorm:"size:500;not null"`
+	ThumbnailKey     string    `gorm:"size:500;not null"`
+	ThumbnailType    string    `gorm:"size:100;not null"`
+	WebPKey          string    `gorm:"size:500"`
+	ThumbnailWebPKey string    `gorm:"size:500"`
+	UploadedBy       uint64    `gorm:"not null"`
+	CreatedAt        time.Time `gorm:"not null;index"`
+	UpdatedAt        time.Time `gorm:"not null"`
+
+	Uploader User `gorm:"foreignKey:UploadedBy"`
+}
+
+// StorageKeys returns the keys of the image and all its variants
+func (m *MediaFile) StorageKeys() []string {
+	keys := []string{m.StorageKey, m.ThumbnailKey}
+	for _, key := range []string{m.WebPKey, m.ThumbnailWebPKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -177,9 +177,10 @@ type Translation struct {
 type CustomField struct {
 	ID           uint64    `gorm:"primaryKey"`
 	Type         string    `gorm:"size:32;not null"` // client, product, service, order
+	ProductID    *uint64   `gorm:"index"` // Product of a service field
 	Name         string    `gorm:"size:100;not null"`
 	FieldName    string    `gorm:"size:100;not null"` // Internal field name
-	FieldType    string    `gorm:"size:32;not null"` // text, textarea, select, checkbox, radio, date
+	FieldType    string    `gorm:"size:32;not null"` // text, textarea, select, password, checkbox, radio, date
 	Description  string    `gorm:"type:text"`
 	Options      JSONMap   `gorm:"type:jsonb"` // For select/radio
 	Required     bool      `gorm:"not null;default:false"`
@@ -208,6 +209,43 @@ type CustomFieldValue struct {
 	CustomField CustomField `gorm:"foreignKey:CustomFieldID"`
 }
 
+// Custom field types
+const (
+	CustomFieldTypeText     = "text"
+	CustomFieldTypeTextarea = "textarea"
+	CustomFieldTypeSelect   = "select" // Dropdown of the keys of Options
+	CustomFieldTypePassword = "password"
+	CustomFieldTypeCheckbox = "checkbox"
+)
+
+// Custom field entity types. Order fields are filled in at checkout and
+// carried onto the invoice of the order; invoice fields are set by staff.
+const (
+	CustomFieldEntityService = "service"
+	CustomFieldEntityOrder   = "order"
+	CustomFieldEntityInvoice = "invoice"
+)
+
+// IsSecret checks if values of the field must not be shown in history
+func (f *CustomField) IsSecret() bool {
+	return f.FieldType == CustomFieldTypePassword
+}
+
+// CustomFieldValueChange records an edit of a custom field value
+type CustomFieldValueChange struct {
+	ID            uint64    `gorm:"primaryKey"`
+	CustomFieldID uint64    `gorm:"not null;index"`
+	EntityType    string    `gorm:"size:32;not null;index:idx_custom_field_change_entity"`
+	EntityID      uint64    `gorm:"not null;index:idx_custom_field_change_entity"`
+	OldValue      string    `gorm:"type:text"` // Masked for secret fields
+	NewValue      string    `gorm:"type:text"`
+	ChangedBy     *uint64   `gorm:"index"`
+	CreatedAt     time.Time `gorm:"not null"`
+
+	CustomField CustomField `gorm:"foreignKey:CustomFieldID"`
+	User        *User       `gorm:"foreignKey:ChangedBy"`
+}
+
 // SystemConfig represents system configuration settings
 type SystemConfig struct {
 	ID        uint64    `gorm:"primaryKey"`
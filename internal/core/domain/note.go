@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// NoteSubject is the kind of record a staff note is written on
+type NoteSubject string
+
+const (
+	NoteSubjectCustomer NoteSubject = "customer" // AdminNote
+	NoteSubjectOrder    NoteSubject = "order"    // OrderNote
+)
+
+// NoteRevision keeps the text a staff note had before an edit
+type NoteRevision struct {
+	ID        uint64      `gorm:"primaryKey"`
+	Subject   NoteSubject `gorm:"size:16;not null;index:idx_note_revision_note"`
+	NoteID    uint64      `gorm:"not null;index:idx_note_revision_note"`
+	Note      string      `gorm:"type:text;not null"`
+	EditedBy  uint64      `gorm:"not null"` // Staff member who replaced the text
+	CreatedAt time.Time   `gorm:"not null"`
+
+	Editor *User `gorm:"foreignKey:EditedBy"`
+}
@@ -17,6 +17,7 @@ const (
 	EmailTypeInvoicePaid      EmailTemplateType = "invoice_paid"
 	EmailTypePaymentReceipt   EmailTemplateType = "payment_receipt"
 	EmailTypePaymentFailed    EmailTemplateType = "payment_failed"
+	EmailTypePaymentRefunded  EmailTemplateType = "payment_refunded"
 	EmailTypePaymentReminder  EmailTemplateType = "payment_reminder"
 	EmailTypeOverdueNotice    EmailTemplateType = "overdue_notice"
 	EmailTypeServiceActivated EmailTemplateType = "service_activated"
@@ -101,6 +102,18 @@ type SMTPConfig struct {
 	LastSent    *time.Time
 	CreatedAt   time.Time `gorm:"not null"`
 	UpdatedAt   time.Time `gorm:"not null"`
+
+	// ReturnPath is the envelope sender bounces go to. Empty sends them to
+	// FromEmail.
+	ReturnPath string `gorm:"size:255"`
+}
+
+// EnvelopeFrom returns the address bounces of the config go to
+func (s *SMTPConfig) EnvelopeFrom(fromEmail string) string {
+	if s.ReturnPath != "" {
+		return s.ReturnPath
+	}
+	return fromEmail
 }
 
 // CanSend checks if the SMTP config can send emails
@@ -108,12 +121,35 @@ func (s *SMTPConfig) CanSend() bool {
 	if !s.Active {
 		return false
 	}
-	if s.DailyLimit > 0 && s.SentToday >= s.DailyLimit {
+	if s.DailyLimit > 0 && s.SentOn(time.Now()) >= s.DailyLimit {
 		return false
 	}
 	return true
 }
 
+// SentOn returns how many emails the config sent on the day of now.
+// SentToday counts from the day of LastSent, so it is stale the next day.
+func (s *SMTPConfig) SentOn(now time.Time) int {
+	if s.LastSent == nil {
+		return 0
+	}
+	y, m, d := s.LastSent.In(now.Location()).Date()
+	ny, nm, nd := now.Date()
+	if y != ny || m != nm || d != nd {
+		return 0
+	}
+	return s.SentToday
+}
+
+// LimitUsage returns the share of the daily limit used on the day of now,
+// or 0 for an unlimited config
+func (s *SMTPConfig) LimitUsage(now time.Time) float64 {
+	if s.DailyLimit <= 0 {
+		return 0
+	}
+	return float64(s.SentOn(now)) / float64(s.DailyLimit)
+}
+
 // EmailQueue represents a queued email
 type EmailQueue struct {
 	ID           uint64    `gorm:"primaryKey"`
@@ -130,9 +166,9 @@ type EmailQueue struct {
 	CC           string    `gorm:"size:500"`
 	BCC          string    `gorm:"size:500"`
 	Headers      JSONMap   `gorm:"type:jsonb"`
-	Attachments  JSONMap   `gorm:"type:jsonb"` // File paths
+	Attachments  JSONMap   `gorm:"type:jsonb"` // Documents rendered when sent, such as AttachmentInvoicePDF
 	Priority     int       `gorm:"not null;default:5"` // 1-10, lower is higher
-	Status       string    `gorm:"size:32;not null;default:'pending'"` // pending, sending, sent, failed
+	Status       string    `gorm:"size:32;not null;default:'pending'"` // pending, sending, sent, failed, skipped
 	Attempts     int       `gorm:"not null;default:0"`
 	MaxAttempts  int       `gorm:"not null;default:3"`
 	LastError    string    `gorm:"type:text"`
@@ -144,6 +180,15 @@ type EmailQueue struct {
 	CreatedAt    time.Time `gorm:"not null;index"`
 	UpdatedAt    time.Time `gorm:"not null"`
 
+	// Category lists the email categories of a marketing-class email,
+	// comma separated for digests. Such emails carry a one-click
+	// unsubscribe link holding UnsubscribeToken.
+	Category         string `gorm:"size:100"`
+	UnsubscribeToken string `gorm:"size:64;index"`
+	// SkipReason says why the queue skipped the email instead of sending
+	// it, with Status skipped
+	SkipReason string `gorm:"size:255"`
+
 	Template   *EmailTemplate `gorm:"foreignKey:TemplateID"`
 	SMTPConfig *SMTPConfig    `gorm:"foreignKey:SMTPConfigID"`
 	Customer   *User          `gorm:"foreignKey:CustomerID"`
@@ -222,6 +267,7 @@ type SMSMessage struct {
 type WebhookConfig struct {
 	ID            uint64    `gorm:"primaryKey"`
 	CustomerID    *uint64   `gorm:"index"` // null = system webhook
+	APIKeyID      *uint64   `gorm:"index"` // Subscribed through the automation API with this key
 	Name          string    `gorm:"size:100;not null"`
 	URL           string    `gorm:"size:500;not null"`
 	Secret        string    `gorm:"size:100"` // For signature verification
@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// NumberKind is a kind of document numbered from its own sequence
+type NumberKind string
+
+const (
+	NumberKindInvoice NumberKind = "invoice"
+	NumberKindOrder   NumberKind = "order"
+)
+
+// NumberReset is when a sequence starts again from 1
+type NumberReset string
+
+const (
+	NumberResetNever   NumberReset = "never"
+	NumberResetYearly  NumberReset = "yearly"
+	NumberResetMonthly NumberReset = "monthly"
+)
+
+// NumberSequence is the numbering scheme of a kind of document, such as
+// INV-{YEAR}-{SEQ:5}
+type NumberSequence struct {
+	ID        uint64      `gorm:"primaryKey"`
+	Kind      NumberKind  `gorm:"size:32;uniqueIndex;not null"`
+	Format    string      `gorm:"size:50;not null"`
+	Reset     NumberReset `gorm:"size:16;not null;default:'never'"`
+	CreatedAt time.Time   `gorm:"not null"`
+	UpdatedAt time.Time   `gorm:"not null"`
+}
+
+// NumberCounter is the last number given out by a sequence in a period.
+// Period is the year or month of sequences that reset, and empty
+// otherwise.
+type NumberCounter struct {
+	ID         uint64     `gorm:"primaryKey"`
+	Kind       NumberKind `gorm:"size:32;not null;uniqueIndex:idx_number_counter_period"`
+	Period     string     `gorm:"size:7;not null;uniqueIndex:idx_number_counter_period"`
+	LastNumber uint64     `gorm:"not null;default:0"`
+	UpdatedAt  time.Time  `gorm:"not null"`
+}
@@ -63,6 +63,8 @@ type OrderItem struct {
 	ConfigOptions JSONMap         `gorm:"type:jsonb"`
 	Domain        string          `gorm:"size:255"`
 	Hostname      string          `gorm:"size:255"`
+	BundleID      *uint64         `gorm:"index"` // Bundle the item was ordered in
+	CustomFields  JSONMap         `gorm:"type:jsonb"` // Field name => value collected at order time
 	CreatedAt     time.Time       `gorm:"not null"`
 	UpdatedAt     time.Time       `gorm:"not null"`
 
@@ -93,7 +95,7 @@ type Service struct {
 	Domain            string          `gorm:"size:255"`
 	Hostname          string          `gorm:"size:255"`
 	Username          string          `gorm:"size:100"`
-	Password          string          `gorm:"size:255"` // Encrypted
+	Password          Secret          `gorm:"type:text"`
 	BillingCycle      string          `gorm:"size:32"`
 	Currency          string          `gorm:"size:3;not null;default:'USD'"`
 	RecurringAmount   decimal.Decimal `gorm:"type:numeric(20,8);not null"`
@@ -104,12 +106,14 @@ type Service struct {
 	OverrideAutoSusp  bool            `gorm:"not null;default:false"`
 	OverrideAutoTerm  bool            `gorm:"not null;default:false"`
 	ExternalID        string          `gorm:"size:255;index"` // ID in external system
+	Test              bool            `gorm:"not null;default:false;index"` // Provisioned by the mock driver
 	TimesUsed         int             `gorm:"not null;default:0"`
 	IPAddressID       *uint64         `gorm:"index"`
 	ConfigSelection   JSONMap         `gorm:"type:jsonb;not null"`
 	PluginConfig      PluginConfig    `gorm:"type:jsonb;not null"`
 	Notes             string          `gorm:"type:text"`
 	AdminNotes        string          `gorm:"type:text"`
+	PriceUpdatedAt    *time.Time      // Last price revision applied to RecurringAmount
 	CreatedAt         time.Time       `gorm:"not null"`
 	UpdatedAt         time.Time       `gorm:"not null"`
 
@@ -136,6 +140,31 @@ func (s *Service) IsDueForRenewal() bool {
 	return time.Now().After(s.NextDueDate)
 }
 
+// Scan results of service files
+const (
+	ScanStatusClean     = "clean"
+	ScanStatusUnscanned = "unscanned" // No scanner was configured
+)
+
+// ServiceFile is a file exchanged between staff and the customer of a
+// service, such as a configuration file or a report
+type ServiceFile struct {
+	ID          uint64    `gorm:"primaryKey"`
+	ServiceID   uint64    `gorm:"not null;index"`
+	UploadedBy  uint64    `gorm:"not null"`
+	FromStaff   bool      `gorm:"not null;default:false"`
+	FileName    string    `gorm:"size:255;not null"`
+	StorageKey  string    `gorm:"size:500;not null"`
+	FileSize    int64     `gorm:"not null"`
+	ContentType string    `gorm:"size:100;not null"`
+	Note        string    `gorm:"size:1000"`
+	ScanStatus  string    `gorm:"size:32;not null;default:'unscanned'"`
+	CreatedAt   time.Time `gorm:"not null"`
+
+	Service  Service `gorm:"foreignKey:ServiceID"`
+	Uploader User    `gorm:"foreignKey:UploadedBy"`
+}
+
 // Cart represents a shopping cart
 type Cart struct {
 	ID         uint64    `gorm:"primaryKey"`
@@ -147,6 +176,12 @@ type Cart struct {
 	CreatedAt  time.Time `gorm:"not null"`
 	UpdatedAt  time.Time `gorm:"not null"`
 
+	// Where the currency and the country guests are presumed to pay tax in
+	// came from: user, profile, geoip or default
+	CurrencySource   string `gorm:"size:16"`
+	TaxCountry       string `gorm:"size:2"`
+	TaxCountrySource string `gorm:"size:16"`
+
 	Customer *User      `gorm:"foreignKey:CustomerID"`
 	Coupon   *Coupon    `gorm:"foreignKey:CouponID"`
 	Items    []CartItem `gorm:"foreignKey:CartID"`
@@ -165,12 +200,18 @@ type CartItem struct {
 	SetupFee      decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"`
 	RecurringFee  decimal.Decimal `gorm:"type:numeric(20,8);not null"`
 	Discount      decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"`
+	PromoDiscount decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"` // First term promotion
+	Savings       JSONMap         `gorm:"type:jsonb"`                            // Pricing tier label => amount saved
 	Total         decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	BundleID      *uint64         `gorm:"index"`
+	BundleKey     string          `gorm:"size:64;index"` // Shared by the items of one bundle added to the cart
+	CustomFields  JSONMap         `gorm:"type:jsonb"` // Field name => value
 	CreatedAt     time.Time       `gorm:"not null"`
 	UpdatedAt     time.Time       `gorm:"not null"`
 
-	Cart    Cart    `gorm:"foreignKey:CartID"`
-	Product Product `gorm:"foreignKey:ProductID"`
+	Cart    Cart           `gorm:"foreignKey:CartID"`
+	Product Product        `gorm:"foreignKey:ProductID"`
+	Bundle  *ProductBundle `gorm:"foreignKey:BundleID"`
 }
 
 type JSONMap map[string]any
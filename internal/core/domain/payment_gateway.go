@@ -3,6 +3,7 @@ package domain
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -19,6 +20,10 @@ const (
 	GatewayTypeManual   PaymentGatewayType = "manual"
 )
 
+// GatewayCreditBalance is the gateway of payments made from the credit
+// balance of the customer
+const GatewayCreditBalance = "credit_balance"
+
 // PaymentGatewayConfig represents gateway configuration
 type PaymentGatewayConfig struct {
 	APIKey           string `json:"api_key,omitempty"`
@@ -30,6 +35,8 @@ type PaymentGatewayConfig struct {
 	SandboxMode      bool   `json:"sandbox_mode,omitempty"`
 	SupportedCurrencies []string `json:"supported_currencies,omitempty"`
 	Extra            map[string]string `json:"extra,omitempty"`
+	// Sandbox are the credentials used in test mode; live ones never are
+	Sandbox *PaymentGatewayConfig `json:"sandbox,omitempty"`
 }
 
 // Value implements driver.Valuer for PaymentGatewayConfig
@@ -72,7 +79,7 @@ type PaymentGatewayModule struct {
 	MaxAmount         decimal.Decimal      `gorm:"type:numeric(20,8);not null;default:0"` // 0 = unlimited
 	FeePercent        decimal.Decimal      `gorm:"type:numeric(10,4);not null;default:0"`
 	FeeFixed          decimal.Decimal      `gorm:"type:numeric(20,8);not null;default:0"`
-	TestMode          bool                 `gorm:"not null;default:false"`
+	TestMode          bool                 `gorm:"not null;default:false"` // Charges go to the sandbox
 	RequiresSSL       bool                 `gorm:"not null;default:true"`
 	Active            bool                 `gorm:"not null;default:true"`
 	Visible           bool                 `gorm:"not null;default:true"`
@@ -87,6 +94,20 @@ func (g *PaymentGatewayModule) CalculateFee(amount decimal.Decimal) decimal.Deci
 	return percentFee.Add(g.FeeFixed)
 }
 
+// SupportsCurrency reports whether the gateway takes payments in a
+// currency. Gateways without supported currencies take any.
+func (g *PaymentGatewayModule) SupportsCurrency(code string) bool {
+	if len(g.Config.SupportedCurrencies) == 0 {
+		return true
+	}
+	for _, supported := range g.Config.SupportedCurrencies {
+		if strings.EqualFold(supported, code) {
+			return true
+		}
+	}
+	return false
+}
+
 // PaymentRequest represents a payment request/attempt
 type PaymentRequest struct {
 	ID              uint64          `gorm:"primaryKey"`
@@ -109,6 +130,7 @@ type PaymentRequest struct {
 	ProcessedAt     *time.Time
 	ExpiresAt       *time.Time
 	TransactionID   *uint64   `gorm:"index"` // Created transaction
+	Test            bool      `gorm:"not null;default:false;index"` // Made in test mode
 	CreatedAt       time.Time `gorm:"not null"`
 	UpdatedAt       time.Time `gorm:"not null"`
 
@@ -176,6 +198,7 @@ type PaymentSubscription struct {
 	NextPaymentAt   *time.Time
 	FailedPayments  int                `gorm:"not null;default:0"`
 	Metadata        JSONMap            `gorm:"type:jsonb"`
+	Test            bool               `gorm:"not null;default:false;index"` // Created in test mode
 	CreatedAt       time.Time          `gorm:"not null"`
 	UpdatedAt       time.Time          `gorm:"not null"`
 
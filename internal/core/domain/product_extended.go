@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -59,6 +61,37 @@ type ProductAddon struct {
 	Products []Product `gorm:"many2many:product_addon_assignments"`
 }
 
+// Addon types
+const (
+	AddonTypeRecurring = "recurring"
+	AddonTypeOneTime   = "onetime"
+)
+
+// IsRecurring returns true if the addon renews with its parent service
+func (a *ProductAddon) IsRecurring() bool {
+	return a.Type != AddonTypeOneTime
+}
+
+// CyclePrice returns the recurring price of one unit of the addon for a
+// billing cycle
+func (a *ProductAddon) CyclePrice(cycle string) decimal.Decimal {
+	switch normalizeCycle(cycle) {
+	case "monthly":
+		return a.Monthly
+	case "quarterly":
+		return a.Quarterly
+	case "semiannually":
+		return a.SemiAnnually
+	case "annually":
+		return a.Annually
+	case "biennially":
+		return a.Biennially
+	case "triennially":
+		return a.Triennially
+	}
+	return decimal.Zero
+}
+
 // ProductAddonAssignment represents the assignment of an addon to a product
 type ProductAddonAssignment struct {
 	ProductID uint64    `gorm:"primaryKey"`
@@ -128,6 +161,120 @@ type ProductBundleItem struct {
 	Product Product       `gorm:"foreignKey:ProductID"`
 }
 
+// CyclePrice returns the fixed recurring price of the bundle for a billing
+// cycle. Zero means the bundle is priced from its items and their discounts.
+func (b *ProductBundle) CyclePrice(cycle string) decimal.Decimal {
+	switch normalizeCycle(cycle) {
+	case "monthly":
+		return b.Monthly
+	case "quarterly":
+		return b.Quarterly
+	case "semiannually":
+		return b.SemiAnnually
+	case "annually":
+		return b.Annually
+	case "biennially":
+		return b.Biennially
+	case "triennially":
+		return b.Triennially
+	}
+	return decimal.Zero
+}
+
+// BundleLine is a product of a bundle with its list fees and the fees it is
+// sold at within the bundle. SetupFee is charged once per line, RecurringFee
+// per unit.
+type BundleLine struct {
+	Item             ProductBundleItem
+	ListSetupFee     decimal.Decimal
+	ListRecurringFee decimal.Decimal
+	SetupFee         decimal.Decimal
+	RecurringFee     decimal.Decimal
+}
+
+// ListTotal returns the first term price of the line outside the bundle
+func (l *BundleLine) ListTotal() decimal.Decimal {
+	return l.ListSetupFee.Add(l.ListRecurringFee.Mul(decimal.NewFromInt(int64(l.Item.Quantity))))
+}
+
+// Total returns the first term price of the line within the bundle
+func (l *BundleLine) Total() decimal.Decimal {
+	return l.SetupFee.Add(l.RecurringFee.Mul(decimal.NewFromInt(int64(l.Item.Quantity))))
+}
+
+// Saving returns how much less the line costs within the bundle
+func (l *BundleLine) Saving() decimal.Decimal {
+	return l.ListTotal().Sub(l.Total())
+}
+
+// Price sets the bundle fees of its lines for a billing cycle. When the
+// bundle has a fixed price for the cycle it is spread over the required
+// lines in proportion to their list fees, otherwise every line gets its
+// percentage discount. Optional lines always keep their own discount.
+func (b *ProductBundle) Price(cycle string, lines []BundleLine) {
+	fixed := b.CyclePrice(cycle)
+	hundred := decimal.NewFromInt(100)
+
+	var required []int
+	for i := range lines {
+		line := &lines[i]
+		if fixed.IsPositive() && !line.Item.Optional {
+			required = append(required, i)
+			continue
+		}
+		factor := hundred.Sub(line.Item.Discount).Div(hundred)
+		if factor.IsNegative() {
+			factor = decimal.Zero
+		}
+		line.SetupFee = line.ListSetupFee.Mul(factor).Round(2)
+		line.RecurringFee = line.ListRecurringFee.Mul(factor).Round(2)
+	}
+	if len(required) == 0 {
+		return
+	}
+
+	listSetup := decimal.Zero
+	listRecurring := decimal.Zero
+	for _, i := range required {
+		listSetup = listSetup.Add(lines[i].ListSetupFee)
+		listRecurring = listRecurring.Add(lines[i].ListRecurringFee.Mul(decimal.NewFromInt(int64(lines[i].Item.Quantity))))
+	}
+
+	setup := decimal.Zero
+	recurring := decimal.Zero
+	for n, i := range required {
+		line := &lines[i]
+		quantity := decimal.NewFromInt(int64(line.Item.Quantity))
+		last := n == len(required)-1
+
+		// The last line takes the rounding remainder so the lines add up to
+		// the bundle price
+		switch {
+		case last:
+			line.SetupFee = b.SetupFee.Sub(setup)
+		case listSetup.IsPositive():
+			line.SetupFee = line.ListSetupFee.Mul(b.SetupFee).Div(listSetup).Round(2)
+		default:
+			line.SetupFee = decimal.Zero
+		}
+		switch {
+		case last:
+			line.RecurringFee = fixed.Sub(recurring).Div(quantity).Round(2)
+		case listRecurring.IsPositive():
+			line.RecurringFee = line.ListRecurringFee.Mul(fixed).Div(listRecurring).Round(2)
+		default:
+			line.RecurringFee = decimal.Zero
+		}
+		setup = setup.Add(line.SetupFee)
+		recurring = recurring.Add(line.RecurringFee.Mul(quantity))
+	}
+}
+
+// SavingsLabel returns the label of the saving shown for the bundle
+func (b *ProductBundle) SavingsLabel() string {
+	return fmt.Sprintf("Bundle: %s", b.Name)
+}
+
 // ProductUpgrade represents upgrade/downgrade paths for a product
 type ProductUpgrade struct {
 	ID              uint64          `gorm:"primaryKey"`
@@ -253,6 +400,7 @@ type ProductStock struct {
 	OutOfStockMsg  string    `gorm:"size:500"`
 	AllowBackorder bool      `gorm:"not null;default:false"`
 	LastRestocked  *time.Time
+	LowStockSentAt *time.Time // Cleared on restock
 	CreatedAt      time.Time `gorm:"not null"`
 	UpdatedAt      time.Time `gorm:"not null"`
 
@@ -269,6 +417,12 @@ func (s *ProductStock) IsLowStock() bool {
 	return s.AvailableQuantity() <= s.LowStockAlert
 }
 
+// CanFulfil checks if quantity more units can be sold, either from stock or
+// as a backorder
+func (s *ProductStock) CanFulfil(quantity int) bool {
+	return s.AllowBackorder || s.AvailableQuantity() >= quantity
+}
+
 // ProductPricing represents detailed pricing for a product
 type ProductPricing struct {
 	ID             uint64          `gorm:"primaryKey"`
@@ -284,7 +438,8 @@ type ProductPricing struct {
 	CreatedAt      time.Time       `gorm:"not null"`
 	UpdatedAt      time.Time       `gorm:"not null"`
 
-	Product Product `gorm:"foreignKey:ProductID"`
+	Product Product       `gorm:"foreignKey:ProductID"`
+	Tiers   []PricingTier `gorm:"foreignKey:ProductPricingID"`
 }
 
 // GetPrice returns the price for a billing cycle
@@ -312,6 +467,222 @@ func (p *ProductPricing) IsCycleEnabled(cycle string) bool {
 	return p.GetPrice(cycle).GreaterThanOrEqual(decimal.Zero)
 }
 
+// Pricing tier types
+const (
+	PricingTierQuantity = "quantity" // Applies from a minimum quantity
+	PricingTierTerm     = "term"     // Applies to a billing cycle
+)
+
+// Pricing tier discount types
+const (
+	PricingTierPercent = "percent"
+	PricingTierFixed   = "fixed" // Amount off the unit price
+)
+
+// PricingTier is a quantity break or term length promotion on the
+// recurring price of a ProductPricing
+type PricingTier struct {
+	ID               uint64          `gorm:"primaryKey"`
+	ProductPricingID uint64          `gorm:"not null;index"`
+	Type             string          `gorm:"size:16;not null"`
+	BillingCycle     string          `gorm:"size:32"` // Empty = every cycle
+	MinQuantity      int             `gorm:"not null;default:1"`
+	DiscountType     string          `gorm:"size:16;not null;default:'percent'"`
+	Value            decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	FirstTermOnly    bool            `gorm:"not null;default:false"` // Only discounts the first invoice
+	Label            string          `gorm:"size:255"`
+	StartsAt         *time.Time
+	EndsAt           *time.Time
+	Active           bool      `gorm:"not null;default:true"`
+	CreatedAt        time.Time `gorm:"not null"`
+	UpdatedAt        time.Time `gorm:"not null"`
+}
+
+// Applies checks if the tier discounts an order of quantity units on a
+// billing cycle at the given time
+func (t *PricingTier) Applies(cycle string, quantity int, now time.Time) bool {
+	if !t.Active {
+		return false
+	}
+	if t.StartsAt != nil && now.Before(*t.StartsAt) {
+		return false
+	}
+	if t.EndsAt != nil && !now.Before(*t.EndsAt) {
+		return false
+	}
+	if t.BillingCycle != "" && normalizeCycle(t.BillingCycle) != normalizeCycle(cycle) {
+		return false
+	}
+	if t.Type == PricingTierTerm && t.BillingCycle == "" {
+		return false
+	}
+	return quantity >= t.MinQuantity
+}
+
+// UnitDiscount returns the discount the tier gives on a unit price, capped
+// at the price
+func (t *PricingTier) UnitDiscount(price decimal.Decimal) decimal.Decimal {
+	discount := t.Value
+	if t.DiscountType != PricingTierFixed {
+		discount = price.Mul(t.Value).Div(decimal.NewFromInt(100))
+	}
+	discount = discount.Round(2)
+	if discount.GreaterThan(price) {
+		return price
+	}
+	if discount.IsNegative() {
+		return decimal.Zero
+	}
+	return discount
+}
+
+// DisplayLabel returns the label shown next to the savings of the tier
+func (t *PricingTier) DisplayLabel() string {
+	if t.Label != "" {
+		return t.Label
+	}
+	off := t.Value.StringFixed(2) + " off"
+	if t.DiscountType != PricingTierFixed {
+		off = t.Value.String() + "% off"
+	}
+	if t.Type == PricingTierQuantity {
+		return fmt.Sprintf("%d+ units: %s", t.MinQuantity, off)
+	}
+	if t.FirstTermOnly {
+		return fmt.Sprintf("%s first term (%s)", off, normalizeCycle(t.BillingCycle))
+	}
+	return fmt.Sprintf("%s (%s)", off, normalizeCycle(t.BillingCycle))
+}
+
+// TieredPrice is a recurring unit price after pricing tiers
+type TieredPrice struct {
+	ListPrice         decimal.Decimal // Unit price before tiers
+	UnitPrice         decimal.Decimal // Unit price charged on every term
+	FirstTermDiscount decimal.Decimal // Per unit, first invoice only
+	Savings           []PriceSaving
+}
+
+// PriceSaving is the amount saved on all units by one pricing tier
+type PriceSaving struct {
+	Label  string          `json:"label"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// TieredPrice returns the recurring unit price of a billing cycle for
+// quantity units. The quantity break with the highest minimum quantity
+// applies first, then the largest term promotion for the cycle. Tiers must
+// be loaded.
+func (p *ProductPricing) TieredPrice(cycle string, quantity int, now time.Time) TieredPrice {
+	price := p.GetPrice(cycle)
+	result := TieredPrice{ListPrice: price, UnitPrice: price, FirstTermDiscount: decimal.Zero}
+	if price.LessThanOrEqual(decimal.Zero) || len(p.Tiers) == 0 {
+		return result
+	}
+	qty := decimal.NewFromInt(int64(quantity))
+
+	var volume *PricingTier
+	for i := range p.Tiers {
+		tier := &p.Tiers[i]
+		if tier.Type != PricingTierQuantity || !tier.Applies(cycle, quantity, now) {
+			continue
+		}
+		if volume == nil || tier.MinQuantity > volume.MinQuantity ||
+			(tier.MinQuantity == volume.MinQuantity && tier.UnitDiscount(price).GreaterThan(volume.UnitDiscount(price))) {
+			volume = tier
+		}
+	}
+	if volume != nil {
+		if discount := volume.UnitDiscount(result.UnitPrice); discount.IsPositive() {
+			result.UnitPrice = result.UnitPrice.Sub(discount)
+			result.Savings = append(result.Savings, PriceSaving{Label: volume.DisplayLabel(), Amount: discount.Mul(qty)})
+		}
+	}
+
+	var promo *PricingTier
+	for i := range p.Tiers {
+		tier := &p.Tiers[i]
+		if tier.Type != PricingTierTerm || !tier.Applies(cycle, quantity, now) {
+			continue
+		}
+		if promo == nil || tier.UnitDiscount(result.UnitPrice).GreaterThan(promo.UnitDiscount(result.UnitPrice)) {
+			promo = tier
+		}
+	}
+	if promo != nil {
+		if discount := promo.UnitDiscount(result.UnitPrice); discount.IsPositive() {
+			if promo.FirstTermOnly {
+				result.FirstTermDiscount = discount
+			} else {
+				result.UnitPrice = result.UnitPrice.Sub(discount)
+			}
+			result.Savings = append(result.Savings, PriceSaving{Label: promo.DisplayLabel(), Amount: discount.Mul(qty)})
+		}
+	}
+
+	return result
+}
+
+func normalizeCycle(cycle string) string {
+	switch strings.ToLower(cycle) {
+	case "semi-annually", "semiannually":
+		return "semiannually"
+	case "yearly", "annually":
+		return "annually"
+	default:
+		return strings.ToLower(cycle)
+	}
+}
+
+// PriceRevisionStatus represents the state of a staged price change
+type PriceRevisionStatus string
+
+const (
+	PriceRevisionScheduled PriceRevisionStatus = "scheduled"
+	PriceRevisionApplied   PriceRevisionStatus = "applied"
+	PriceRevisionCancelled PriceRevisionStatus = "cancelled"
+)
+
+// Service policies for a price revision
+const (
+	PriceRevisionGrandfather = "grandfather" // Existing services keep their price
+	PriceRevisionMigrate     = "migrate"     // Existing services renew at the new price
+)
+
+// PriceRevision represents a staged change to product prices that takes
+// effect at a given date
+type PriceRevision struct {
+	ID            uint64              `gorm:"primaryKey"`
+	Name          string              `gorm:"size:255;not null"`
+	Description   string              `gorm:"type:text"`
+	Status        PriceRevisionStatus `gorm:"size:32;not null;default:'scheduled';index"`
+	ServicePolicy string              `gorm:"size:32;not null;default:'grandfather'"`
+	Percent       decimal.Decimal     `gorm:"type:numeric(10,4);not null;default:0"`
+	Amount        decimal.Decimal     `gorm:"type:numeric(20,8);not null;default:0"`
+	EffectiveAt   time.Time           `gorm:"not null;index"`
+	AppliedAt     *time.Time
+	CreatedBy     *uint64
+	CreatedAt     time.Time `gorm:"not null"`
+	UpdatedAt     time.Time `gorm:"not null"`
+
+	Items []PriceRevisionItem `gorm:"foreignKey:RevisionID"`
+}
+
+// PriceRevisionItem is the old and new price of one product, currency and
+// billing cycle in a revision
+type PriceRevisionItem struct {
+	ID         uint64          `gorm:"primaryKey"`
+	RevisionID uint64          `gorm:"not null;index"`
+	ProductID  uint64          `gorm:"not null;index:idx_price_revision_lookup"`
+	Currency   string          `gorm:"size:3;not null;index:idx_price_revision_lookup"`
+	Cycle      string          `gorm:"size:32;not null;index:idx_price_revision_lookup"`
+	OldPrice   decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	NewPrice   decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	CreatedAt  time.Time       `gorm:"not null"`
+
+	Revision PriceRevision `gorm:"foreignKey:RevisionID"`
+	Product  Product       `gorm:"foreignKey:ProductID"`
+}
+
 // ProductWelcomeEmail represents a custom welcome email for a product
 type ProductWelcomeEmail struct {
 	ID        uint64    `gorm:"primaryKey"`
@@ -340,3 +711,43 @@ type FreeTrialConfig struct {
 
 	Product Product `gorm:"foreignKey:ProductID"`
 }
+
+// TrialStatus represents the status of a free trial
+type TrialStatus string
+
+const (
+	TrialStatusActive    TrialStatus = "active"
+	TrialStatusConverted TrialStatus = "converted"
+	TrialStatusExpired   TrialStatus = "expired"
+	TrialStatusCancelled TrialStatus = "cancelled"
+)
+
+// ProductTrial represents a free trial taken by a customer. The trial
+// service is created by a zero-amount order and bills from EndsAt once
+// converted.
+type ProductTrial struct {
+	ID              uint64      `gorm:"primaryKey"`
+	CustomerID      uint64      `gorm:"not null;index:idx_trial_customer_product"`
+	ProductID       uint64      `gorm:"not null;index:idx_trial_customer_product"`
+	OrderID         uint64      `gorm:"not null;index"`
+	ServiceID       uint64      `gorm:"not null;uniqueIndex"`
+	PaymentMethodID *uint64     `gorm:"index"`
+	InvoiceID       *uint64     `gorm:"index"` // First invoice after conversion
+	Status          TrialStatus `gorm:"size:32;not null;default:'active';index"`
+	EndsAt          time.Time   `gorm:"not null;index"`
+	ReminderSentAt  *time.Time
+	ConvertedAt     *time.Time
+	CreatedAt       time.Time   `gorm:"not null"`
+	UpdatedAt       time.Time   `gorm:"not null"`
+
+	Customer      User           `gorm:"foreignKey:CustomerID"`
+	Product       Product        `gorm:"foreignKey:ProductID"`
+	Service       Service        `gorm:"foreignKey:ServiceID"`
+	PaymentMethod *PaymentMethod `gorm:"foreignKey:PaymentMethodID"`
+}
+
+// IsActive returns true if the trial has not ended, converted or been
+// cancelled
+func (t *ProductTrial) IsActive() bool {
+	return t.Status == TrialStatusActive
+}
@@ -82,7 +82,7 @@ type ProvisioningServerModule struct {
 	Slug            string    `gorm:"size:100;uniqueIndex;not null"`
 	ModuleType      string    `gorm:"size:50;not null"` // cpanel, plesk, directadmin, virtualizor, etc.
 	Config          JSONMap   `gorm:"type:jsonb"`
-	TestMode        bool      `gorm:"not null;default:false"`
+	TestMode        bool      `gorm:"not null;default:false"` // Services are provisioned by the mock driver
 	SupportsCreate  bool      `gorm:"not null;default:true"`
 	SupportsSuspend bool      `gorm:"not null;default:true"`
 	SupportsUnsuspend bool    `gorm:"not null;default:true"`
@@ -104,8 +104,8 @@ type ProvisioningServer struct {
 	IPAddress     string    `gorm:"size:45"`
 	Port          int       `gorm:"not null;default:0"`
 	Username      string    `gorm:"size:100"`
-	Password      string    `gorm:"size:255"` // Encrypted
-	AccessHash    string    `gorm:"type:text"` // For WHM
+	Password      Secret    `gorm:"type:text"`
+	AccessHash    Secret    `gorm:"type:text"` // For WHM
 	SecureAPI     bool      `gorm:"not null;default:true"`
 	MaxAccounts   int       `gorm:"not null;default:0"` // 0 = unlimited
 	CurrentAccounts int     `gorm:"not null;default:0"`
@@ -182,7 +182,7 @@ type ServiceProvisioningData struct {
 	ServiceID    uint64    `gorm:"not null;uniqueIndex"`
 	ServerID     uint64    `gorm:"not null;index"`
 	Username     string    `gorm:"size:100"`
-	Password     string    `gorm:"size:255"` // Encrypted
+	Password     Secret    `gorm:"type:text"`
 	Domain       string    `gorm:"size:255"`
 	Package      string    `gorm:"size:100"` // Server-side package name
 	DiskLimit    int64     `gorm:"not null;default:0"` // MB
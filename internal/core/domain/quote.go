@@ -159,6 +159,7 @@ type OrderNote struct {
 	OrderID   uint64    `gorm:"not null;index"`
 	StaffID   uint64    `gorm:"not null;index"`
 	Note      string    `gorm:"type:text;not null"`
+	Sticky    bool      `gorm:"not null;default:false"`
 	CreatedAt time.Time `gorm:"not null"`
 	UpdatedAt time.Time `gorm:"not null"`
 
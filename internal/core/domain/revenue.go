@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RevenueEntry is the part of a paid invoice item recognized as revenue in
+// a month. Items billed for a service period are spread over the months of
+// the period by days; the rest is recognized in the month it was billed.
+type RevenueEntry struct {
+	ID            uint64          `gorm:"primaryKey"`
+	InvoiceID     uint64          `gorm:"not null;index"`
+	InvoiceItemID uint64          `gorm:"not null;index"`
+	ServiceID     *uint64         `gorm:"index"`
+	Currency      string          `gorm:"size:3;not null"`
+	Month         time.Time       `gorm:"not null;index"` // First day of the month, UTC
+	BilledAt      time.Time       `gorm:"not null;index"` // When the invoice was paid
+	Amount        decimal.Decimal `gorm:"type:numeric(20,8);not null"`
+	CreatedAt     time.Time       `gorm:"not null"`
+}
@@ -0,0 +1,60 @@
+package domain
+
+import "time"
+
+// AssignmentMode is how new tickets of a department are given to staff
+type AssignmentMode string
+
+const (
+	AssignmentNone       AssignmentMode = "none"        // Tickets wait for staff to pick them
+	AssignmentRoundRobin AssignmentMode = "round_robin" // Members take turns
+	AssignmentLoadBased  AssignmentMode = "load_based"  // The member with the fewest open tickets
+)
+
+// Valid reports whether the mode is a known assignment mode
+func (m AssignmentMode) Valid() bool {
+	return m == AssignmentNone || m == AssignmentRoundRobin || m == AssignmentLoadBased
+}
+
+// DepartmentMember is a staff member answering the tickets of a department
+type DepartmentMember struct {
+	ID           uint64    `gorm:"primaryKey"`
+	DepartmentID uint64    `gorm:"not null;uniqueIndex:idx_department_member"`
+	UserID       uint64    `gorm:"not null;uniqueIndex:idx_department_member"`
+	CreatedAt    time.Time `gorm:"not null"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// DepartmentHours is a span of a weekday a department works, such as
+// Monday 09:00 to 17:00 in the time zone of the department. A department
+// without hours works around the clock.
+type DepartmentHours struct {
+	ID           uint64 `gorm:"primaryKey"`
+	DepartmentID uint64 `gorm:"not null;index"`
+	Weekday      int    `gorm:"not null"`        // 0 is Sunday
+	Opens        string `gorm:"size:5;not null"` // HH:MM
+	Closes       string `gorm:"size:5;not null"` // HH:MM, 24:00 for midnight
+}
+
+// DepartmentHoliday is a day a department does not work
+type DepartmentHoliday struct {
+	ID           uint64    `gorm:"primaryKey"`
+	DepartmentID uint64    `gorm:"not null;uniqueIndex:idx_department_holiday"`
+	Date         string    `gorm:"size:10;not null;uniqueIndex:idx_department_holiday"` // YYYY-MM-DD
+	Name         string    `gorm:"size:100"`
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+// OnCallShift makes a staff member take the high priority tickets of a
+// department, or of every department, that arrive outside working hours
+type OnCallShift struct {
+	ID           uint64    `gorm:"primaryKey"`
+	DepartmentID *uint64   `gorm:"index"` // Nil for every department
+	UserID       uint64    `gorm:"not null;index"`
+	StartsAt     time.Time `gorm:"not null;index"`
+	EndsAt       time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time `gorm:"not null"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
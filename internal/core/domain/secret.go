@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// SecretPrefix starts the stored value of every encrypted Secret, which is
+// "enc:<format version>:<key ID>:<sealed>", the sealed part in base64.
+// Values without this header were stored before encryption was configured
+// and are read as they are.
+const SecretPrefix = "enc:"
+
+// secretHeader matches the header of an encrypted Secret
+var secretHeader = regexp.MustCompile(`^enc:(v[0-9]+):([0-9a-f]{8}):`)
+
+// ParseSecret splits an encrypted Secret value into its format version,
+// the ID of its key and the sealed bytes. It returns false for values
+// stored unencrypted, including ones that only look encrypted but do not
+// decode, such as a password starting with "enc:".
+func ParseSecret(stored string) (version, keyID string, sealed []byte, ok bool) {
+	match := secretHeader.FindStringSubmatch(stored)
+	if match == nil {
+		return "", "", nil, false
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(stored[len(match[0]):])
+	if err != nil || len(sealed) == 0 {
+		return "", "", nil, false
+	}
+	return match[1], match[2], sealed, true
+}
+
+// ErrSecretCipherMissing is returned reading an encrypted Secret when no
+// cipher is configured
+var ErrSecretCipherMissing = errors.New("secret is encrypted but no encryption key is configured")
+
+// SecretCipher encrypts Secret columns at rest. Decrypt must accept every
+// value Encrypt returned, with any of the keys still configured.
+type SecretCipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+var secretCipher atomic.Pointer[SecretCipher]
+
+// SetSecretCipher sets the cipher Secret columns are encrypted with. Until
+// one is set, or when it is nil, new values are stored unencrypted.
+func SetSecretCipher(cipher SecretCipher) {
+	if cipher == nil {
+		secretCipher.Store(nil)
+		return
+	}
+	secretCipher.Store(&cipher)
+}
+
+func currentSecretCipher() SecretCipher {
+	if cipher := secretCipher.Load(); cipher != nil {
+		return *cipher
+	}
+	return nil
+}
+
+// Secret is a credential, such as a service password or a server API
+// token, encrypted in the database with the configured SecretCipher and
+// held in plain text in memory
+type Secret string
+
+// Masked returns the secret hidden for display, or an empty string when
+// none is set
+func (s Secret) Masked() string {
+	if s == "" {
+		return ""
+	}
+	return "********"
+}
+
+func (s Secret) Value() (driver.Value, error) {
+	cipher := currentSecretCipher()
+	if s == "" || cipher == nil {
+		return string(s), nil
+	}
+	return cipher.Encrypt(string(s))
+}
+
+func (s *Secret) Scan(value any) error {
+	var stored string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("secret scan: unsupported type %T", value)
+	}
+	if _, _, _, ok := ParseSecret(stored); !ok {
+		*s = Secret(stored)
+		return nil
+	}
+	cipher := currentSecretCipher()
+	if cipher == nil {
+		return ErrSecretCipherMissing
+	}
+	plaintext, err := cipher.Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	*s = Secret(plaintext)
+	return nil
+}
+
+// SecretResolver resolves credentials configured as references to secrets
+// kept outside the database, such as "env:SMTP_PASSWORD". Values that are
+// not references are returned as they are.
+type SecretResolver interface {
+	Resolve(value string) (string, error)
+}
+
+var secretResolver atomic.Pointer[SecretResolver]
+
+// SetSecretResolver sets the resolver of ResolveSecret. Until one is set,
+// or when it is nil, credentials are used as they are stored.
+func SetSecretResolver(resolver SecretResolver) {
+	if resolver == nil {
+		secretResolver.Store(nil)
+		return
+	}
+	secretResolver.Store(&resolver)
+}
+
+// ResolveSecret returns the credential a configured value refers to.
+// Only values set by staff may be resolved, never values customers enter,
+// which could otherwise read any secret.
+func ResolveSecret(value string) (string, error) {
+	resolver := secretResolver.Load()
+	if value == "" || resolver == nil {
+		return value, nil
+	}
+	return (*resolver).Resolve(value)
+}
@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"time"
+)
+
+// SecurityEventType represents a security relevant change to an account
+type SecurityEventType string
+
+const (
+	SecurityEventLogin             SecurityEventType = "login"
+	SecurityEventLoginFailed       SecurityEventType = "login_failed"
+	SecurityEventPasswordChanged   SecurityEventType = "password_changed"
+	SecurityEventPasswordReset     SecurityEventType = "password_reset"
+	SecurityEventTwoFactorEnabled  SecurityEventType = "two_factor_enabled"
+	SecurityEventTwoFactorDisabled SecurityEventType = "two_factor_disabled"
+	SecurityEventConsentGiven      SecurityEventType = "consent_given"
+	SecurityEventSessionEnded      SecurityEventType = "session_ended"
+)
+
+// SecurityEvent represents an entry of a customer's security log
+type SecurityEvent struct {
+	ID        uint64            `gorm:"primaryKey"`
+	UserID    uint64            `gorm:"not null;index"`
+	Type      SecurityEventType `gorm:"size:50;not null;index"`
+	IPAddress string            `gorm:"size:45"`
+	UserAgent string            `gorm:"size:512"`
+	Details   string            `gorm:"size:255"`
+	CreatedAt time.Time         `gorm:"not null;index"`
+}
+
+// AbuseEventKind identifies what the security monitor counted
+type AbuseEventKind string
+
+const (
+	AbuseLoginFailed   AbuseEventKind = "login_failed"
+	AbusePasswordReset AbuseEventKind = "password_reset"
+	AbuseCardDeclined  AbuseEventKind = "card_declined"
+)
+
+// AbuseEvent is a failed sign in, password reset request or declined card
+// the security monitor counts toward bans. Events are kept for a day.
+type AbuseEvent struct {
+	ID        uint64         `gorm:"primaryKey"`
+	Kind      AbuseEventKind `gorm:"size:32;not null;index:idx_abuse_event_ip"`
+	IPAddress string         `gorm:"size:45;index:idx_abuse_event_ip"`
+	UserID    *uint64        `gorm:"index"`
+	Email     string         `gorm:"size:255"`
+	CreatedAt time.Time      `gorm:"not null;index"`
+}
+
+// SecurityBan blocks an IP address or range from the site, or a user from
+// signing in and paying, until it expires or is lifted
+type SecurityBan struct {
+	ID          uint64     `gorm:"primaryKey"`
+	IPAddress   string     `gorm:"size:64;index"` // Address or CIDR range, empty for a user ban
+	UserID      *uint64    `gorm:"index"`
+	Reason      string     `gorm:"size:255;not null"`
+	Automatic   bool       `gorm:"not null;default:false"` // Applied by the security monitor
+	ExpiresAt   *time.Time `gorm:"index"`                  // Nil for a permanent ban
+	CreatedByID *uint64
+	LiftedAt    *time.Time
+	LiftedByID  *uint64
+	CreatedAt   time.Time `gorm:"not null"`
+
+	User *User `gorm:"foreignKey:UserID"`
+}
+
+// Active reports whether the ban is in force
+func (b *SecurityBan) Active(now time.Time) bool {
+	return b.LiftedAt == nil && (b.ExpiresAt == nil || now.Before(*b.ExpiresAt))
+}
+
+// LegalDocumentType identifies a legal document customers consent to
+type LegalDocumentType string
+
+const (
+	LegalDocumentTerms   LegalDocumentType = "terms"
+	LegalDocumentPrivacy LegalDocumentType = "privacy"
+	LegalDocumentAUP     LegalDocumentType = "aup"
+	LegalDocumentSLA     LegalDocumentType = "sla"
+)
+
+// LegalDocumentTypes lists the legal document types in display order
+var LegalDocumentTypes = []LegalDocumentType{
+	LegalDocumentTerms,
+	LegalDocumentPrivacy,
+	LegalDocumentAUP,
+	LegalDocumentSLA,
+}
+
+// ConsentContext identifies where a customer accepted a legal document
+type ConsentContext string
+
+const (
+	ConsentContextRegistration ConsentContext = "registration"
+	ConsentContextCheckout     ConsentContext = "checkout"
+	ConsentContextAccount      ConsentContext = "account"
+)
+
+// LegalDocument represents a published version of a legal document. The
+// latest version of each type is current; publishing a new one that
+// requires consent prompts customers to accept it again. Versions that are
+// scheduled but not yet published can still be edited.
+type LegalDocument struct {
+	ID              uint64            `gorm:"primaryKey"`
+	Type            LegalDocumentType `gorm:"size:32;not null;uniqueIndex:idx_legal_document_version"`
+	Version         string            `gorm:"size:32;not null;uniqueIndex:idx_legal_document_version"`
+	Title           string            `gorm:"size:255;not null"`
+	Content         string            `gorm:"type:text;not null"`
+	Summary         string            `gorm:"type:text"` // What changed since the previous version
+	RequiresConsent bool              `gorm:"not null;default:true"`
+	PublishedAt     time.Time         `gorm:"not null;index"`
+	CreatedAt       time.Time         `gorm:"not null"`
+}
+
+// ConsentRecord represents a customer's acceptance of a legal document
+// version. Records are never changed so they form the consent history.
+type ConsentRecord struct {
+	ID           uint64            `gorm:"primaryKey"`
+	UserID       uint64            `gorm:"not null;index"`
+	DocumentID   uint64            `gorm:"not null;index"`
+	DocumentType LegalDocumentType `gorm:"size:32;not null"`
+	Version      string            `gorm:"size:32;not null"`
+	Context      ConsentContext    `gorm:"size:20;not null;default:'account';index"`
+	OrderID      *uint64           `gorm:"index"` // Order placed when accepted at checkout
+	IPAddress    string            `gorm:"size:45"`
+	UserAgent    string            `gorm:"size:512"`
+	CreatedAt    time.Time         `gorm:"not null;index"`
+
+	Document LegalDocument `gorm:"foreignKey:DocumentID"`
+	User     *User         `gorm:"foreignKey:UserID"`
+}
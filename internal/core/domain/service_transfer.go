@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+)
+
+// ServiceTransferStatus represents the status of a service transfer
+type ServiceTransferStatus string
+
+const (
+	ServiceTransferStatusPending   ServiceTransferStatus = "pending"
+	ServiceTransferStatusAccepted  ServiceTransferStatus = "accepted"
+	ServiceTransferStatusCancelled ServiceTransferStatus = "cancelled"
+)
+
+// ServiceTransfer represents the hand over of a service from one customer
+// account to another. The owner shares the code with the receiving account,
+// which accepts it before it expires.
+type ServiceTransfer struct {
+	ID             uint64                `gorm:"primaryKey"`
+	ServiceID      uint64                `gorm:"not null;index"`
+	FromCustomerID uint64                `gorm:"not null;index"`
+	ToCustomerID   *uint64               `gorm:"index"`    // Set once accepted
+	RecipientEmail string                `gorm:"size:255"` // Optional, restricts who can accept
+	Code           string                `gorm:"size:64;uniqueIndex;not null"`
+	Status         ServiceTransferStatus `gorm:"size:32;not null;default:'pending';index"`
+	MovedInvoices  int                   `gorm:"not null;default:0"` // Unpaid invoices for later periods moved to the recipient
+	ExpiresAt      time.Time             `gorm:"not null"`
+	AcceptedAt     *time.Time
+	CreatedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time `gorm:"not null"`
+
+	Service      Service `gorm:"foreignKey:ServiceID"`
+	FromCustomer User    `gorm:"foreignKey:FromCustomerID"`
+	ToCustomer   *User   `gorm:"foreignKey:ToCustomerID"`
+}
+
+// IsValid checks if the transfer can still be accepted
+func (t *ServiceTransfer) IsValid() bool {
+	return t.Status == ServiceTransferStatusPending && time.Now().Before(t.ExpiresAt)
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// EmailImporter turns an inbound email into a ticket message, opening a
+// new ticket unless the subject refers to an existing one
+type EmailImporter interface {
+	ImportEmail(raw []byte) (*TicketMessage, error)
+}
+
+// Spam lists senders are matched against before a message is scored
+const (
+	SpamListAllow = "allow"
+	SpamListBlock = "block"
+)
+
+// SpamListEntry allows or blocks a sender. Pattern is an email address
+// or a domain, which also matches its subdomains.
+type SpamListEntry struct {
+	ID        uint64 `gorm:"primaryKey"`
+	ListType  string `gorm:"size:10;not null;uniqueIndex:idx_spam_list_pattern"`
+	Pattern   string `gorm:"size:255;not null;uniqueIndex:idx_spam_list_pattern"`
+	Note      string `gorm:"size:255"`
+	CreatedBy *uint64
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// SpamMessageStatus is the state of a quarantined email
+type SpamMessageStatus string
+
+const (
+	SpamStatusPending  SpamMessageStatus = "pending"
+	SpamStatusReleased SpamMessageStatus = "released"
+)
+
+// SpamReasons are the rules that added to the score of a message
+type SpamReasons []string
+
+// Value implements driver.Valuer for SpamReasons
+func (r SpamReasons) Value() (driver.Value, error) {
+	if r == nil {
+		r = SpamReasons{}
+	}
+	return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner for SpamReasons
+func (r *SpamReasons) Scan(value interface{}) error {
+	data, err := normalizeJSONBytes(value)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		*r = SpamReasons{}
+		return nil
+	}
+	return json.Unmarshal(data, r)
+}
+
+// SpamMessage is an email the spam filter held back instead of turning
+// it into a ticket. Admins review the queue and either release a message,
+// which imports it as if it had just arrived, or delete it.
+type SpamMessage struct {
+	ID         uint64            `gorm:"primaryKey"`
+	Sender     string            `gorm:"size:255;not null;index"`
+	Subject    string            `gorm:"size:500;not null"`
+	Score      float64           `gorm:"not null"`
+	Reasons    SpamReasons       `gorm:"type:jsonb"`
+	Status     SpamMessageStatus `gorm:"size:20;not null;default:'pending';index"`
+	Raw        []byte            `gorm:"not null"`
+	TicketID   *uint64           // Ticket the message was released to
+	ReleasedBy *uint64
+	ReleasedAt *time.Time
+	CreatedAt  time.Time `gorm:"not null;index"`
+}
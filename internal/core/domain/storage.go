@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFileNotFound is returned by a FileStore for keys it does not hold
+var ErrFileNotFound = errors.New("file not found")
+
+// FileStore keeps uploaded files such as ticket and knowledge base
+// attachments, on local disk or in an S3 compatible bucket. Keys are
+// slash separated paths such as "tickets/12/34/<random>".
+type FileStore interface {
+	// Put streams a file into the store; size is -1 when unknown
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the file as fileName until
+	// it expires, without further authentication
+	SignedURL(key, fileName string, expires time.Duration) (string, error)
+}
+
+// FileScanner checks uploaded files for malware
+type FileScanner interface {
+	// Scan reads a file and returns the name of the threat found in it,
+	// or "" when the file is clean
+	Scan(ctx context.Context, r io.Reader) (threat string, err error)
+}
+
+// Upload sources of quarantined files
+const (
+	UploadSourceTicket   = "ticket"
+	UploadSourceKB       = "kb"
+	UploadSourceDownload = "download"
+	UploadSourceService  = "service"
+	UploadSourceMedia    = "media"
+)
+
+// QuarantinedFile is an upload the malware scanner rejected. The file is
+// kept in the file store under the quarantine prefix so staff can review
+// it; SourceID is the ticket, article, download or service it was
+// uploaded to, zero for a download that did not exist yet.
+type QuarantinedFile struct {
+	ID          uint64    `gorm:"primaryKey"`
+	Source      string    `gorm:"size:32;not null;index"`
+	SourceID    uint64    `gorm:"not null"`
+	UploadedBy  *uint64   `gorm:"index"`
+	FileName    string    `gorm:"size:255;not null"`
+	ContentType string    `gorm:"size:100;not null"`
+	FileSize    int64     `gorm:"not null"`
+	Threat      string    `gorm:"size:255;not null"`
+	StorageKey  string    `gorm:"size:500;not null"`
+	CreatedAt   time.Time `gorm:"not null;index"`
+
+	Uploader *User `gorm:"foreignKey:UploadedBy"`
+}
+
+// NewFileKey returns a new unguessable key below prefix and the given
+// IDs, e.g. NewFileKey("tickets", 12, 34) = "tickets/12/34/<random>"
+func NewFileKey(prefix string, ids ...uint64) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	parts := []string{prefix}
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatUint(id, 10))
+	}
+	return strings.Join(append(parts, hex.EncodeToString(random)), "/"), nil
+}
+
+// CountingReader counts the bytes read through it, for the size of an
+// upload put into a FileStore without knowing it
+type CountingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.R.Read(p)
+	c.N += int64(n)
+	return n, err
+}
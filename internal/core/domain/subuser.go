@@ -141,6 +141,12 @@ type CustomerGroup struct {
 	Active      bool      `gorm:"not null;default:true"`
 	CreatedAt   time.Time `gorm:"not null"`
 	UpdatedAt   time.Time `gorm:"not null"`
+
+	// Terms of the members. A customer in several groups gets the payment
+	// terms of the first by sort order that sets them, and is tax exempt
+	// when any of them is.
+	PaymentTermsDays *int // Days invoices are due after they are issued, nil for the default
+	TaxExempt        bool `gorm:"not null;default:false"`
 }
 
 // CustomerGroupMembership represents customer membership in groups
@@ -29,6 +29,7 @@ type KnowledgeBaseArticle struct {
 	Title       string    `gorm:"size:255;not null"`
 	Slug        string    `gorm:"size:255;uniqueIndex;not null"`
 	Content     string    `gorm:"type:text;not null"`
+	ContentHTML string    `gorm:"type:text"` // Content rendered from Markdown and sanitized
 	Excerpt     string    `gorm:"size:500"`
 	AuthorID    uint64    `gorm:"not null;index"`
 	Status      string    `gorm:"size:32;not null;default:'draft'"` // draft, published, archived
@@ -59,7 +60,8 @@ type KBArticleAttachment struct {
 	ID          uint64    `gorm:"primaryKey"`
 	ArticleID   uint64    `gorm:"not null;index"`
 	FileName    string    `gorm:"size:255;not null"`
-	FilePath    string    `gorm:"size:500;not null"`
+	FilePath    string    `gorm:"size:500;not null"` // Local path of files added before the file store
+	StorageKey  string    `gorm:"size:500;index"`
 	FileSize    int64     `gorm:"not null"`
 	ContentType string    `gorm:"size:100;not null"`
 	Downloads   int64     `gorm:"not null;default:0"`
@@ -94,6 +96,22 @@ type KBSearchLog struct {
 	Customer *User `gorm:"foreignKey:CustomerID"`
 }
 
+// KBSuggestion records the articles suggested for a ticket being written
+// and what the customer did with them. A suggestion is deflected when the
+// customer marks it as resolving their problem and sends no ticket.
+type KBSuggestion struct {
+	ID              uint64    `gorm:"primaryKey"`
+	CustomerID      *uint64   `gorm:"index"`
+	Subject         string    `gorm:"size:255;not null"`
+	ArticleIDs      string    `gorm:"size:255;not null"` // Comma separated, best match first
+	ResultCount     int       `gorm:"not null"`
+	ViewedArticleID *uint64   `gorm:"index"`
+	Deflected       bool      `gorm:"not null;default:false;index"`
+	IPAddress       string    `gorm:"size:45"`
+	CreatedAt       time.Time `gorm:"not null;index"`
+	UpdatedAt       time.Time `gorm:"not null"`
+}
+
 // DownloadCategory represents a category for downloads
 type DownloadCategory struct {
 	ID          uint64    `gorm:"primaryKey"`
@@ -118,7 +136,8 @@ type Download struct {
 	Description   string    `gorm:"type:text"`
 	Version       string    `gorm:"size:50"`
 	FileName      string    `gorm:"size:255;not null"`
-	FilePath      string    `gorm:"size:500;not null"`
+	FilePath      string    `gorm:"size:500;not null"` // Local path of files added before the file store
+	StorageKey    string    `gorm:"size:500;index"`
 	FileSize      int64     `gorm:"not null"`
 	ContentType   string    `gorm:"size:100;not null"`
 	Downloads     int64     `gorm:"not null;default:0"`
@@ -167,6 +186,12 @@ type TicketDepartment struct {
 	CreatedAt         time.Time `gorm:"not null"`
 	UpdatedAt         time.Time `gorm:"not null"`
 
+	// Working hours of the department are in Timezone (IANA, empty for
+	// UTC). New tickets are assigned to its members by AssignmentMode.
+	Timezone       string         `gorm:"size:64"`
+	AssignmentMode AssignmentMode `gorm:"size:16;not null;default:'none'"`
+	LastAssigneeID *uint64        // Last member given a ticket by round robin
+
 	Tickets []Ticket `gorm:"foreignKey:DepartmentID"`
 }
 
@@ -289,7 +314,7 @@ type NetworkIncident struct {
 	ID            uint64    `gorm:"primaryKey"`
 	ComponentID   uint64    `gorm:"not null;index"`
 	Title         string    `gorm:"size:255;not null"`
-	Status        string    `gorm:"size:32;not null"` // investigating, identified, monitoring, resolved
+	Status        string    `gorm:"size:32;not null"` // investigating, identified, monitoring, resolved; scheduled, in_progress, completed for maintenance
 	Impact        string    `gorm:"size:32;not null"` // none, minor, major, critical
 	Message       string    `gorm:"type:text"`
 	ScheduledAt   *time.Time // For maintenance
@@ -299,9 +324,36 @@ type NetworkIncident struct {
 	CreatedAt     time.Time `gorm:"not null"`
 	UpdatedAt     time.Time `gorm:"not null"`
 
+	// Maintenance can target servers and services, whose customers are
+	// emailed NoticeHours before it starts
+	NoticeHours  int        `gorm:"not null;default:48"`
+	NoticeSentAt *time.Time
+
 	Component NetworkStatusPage        `gorm:"foreignKey:ComponentID"`
 	Creator   User                     `gorm:"foreignKey:CreatedBy"`
 	Updates   []NetworkIncidentUpdate  `gorm:"foreignKey:IncidentID"`
+	Targets   []NetworkIncidentTarget  `gorm:"foreignKey:IncidentID"`
+}
+
+// Statuses of scheduled maintenance
+const (
+	MaintenanceScheduled  = "scheduled"
+	MaintenanceInProgress = "in_progress"
+	MaintenanceCompleted  = "completed"
+)
+
+// IsMaintenance reports whether the incident is scheduled maintenance
+func (i *NetworkIncident) IsMaintenance() bool {
+	return i.ScheduledAt != nil && i.ScheduledEnd != nil
+}
+
+// NetworkIncidentTarget is a server or service affected by maintenance.
+// Targeting a server affects every service on it.
+type NetworkIncidentTarget struct {
+	ID         uint64  `gorm:"primaryKey"`
+	IncidentID uint64  `gorm:"not null;index"`
+	ServerID   *uint64 `gorm:"index"`
+	ServiceID  *uint64 `gorm:"index"`
 }
 
 // NetworkIncidentUpdate represents an update to an incident
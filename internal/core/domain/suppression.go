@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// SuppressionReason says why an address is on the suppression list
+type SuppressionReason string
+
+const (
+	SuppressionBounced   SuppressionReason = "bounced"   // Hard bounce
+	SuppressionComplaint SuppressionReason = "complaint" // Marked as spam
+	SuppressionManual    SuppressionReason = "manual"    // Added by staff
+)
+
+// Valid reports whether the reason is a known suppression reason
+func (r SuppressionReason) Valid() bool {
+	return r == SuppressionBounced || r == SuppressionComplaint || r == SuppressionManual
+}
+
+// EmailSuppression is an address the email queue never sends to. Queued
+// emails to it are skipped and keep the reason.
+type EmailSuppression struct {
+	ID        uint64            `gorm:"primaryKey"`
+	Email     string            `gorm:"size:255;not null;uniqueIndex"` // Lower case
+	Reason    SuppressionReason `gorm:"size:32;not null"`
+	Note      string            `gorm:"size:500"`
+	CreatedBy *uint64
+	CreatedAt time.Time `gorm:"not null"`
+}
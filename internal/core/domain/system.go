@@ -36,8 +36,8 @@ type Server struct {
 	IPAddress      string          `gorm:"size:45;not null"`
 	Port           int             `gorm:"not null;default:443"`
 	Username       string          `gorm:"size:100"`
-	Password       string          `gorm:"size:255"` // Encrypted
-	AccessHash     string          `gorm:"size:500"` // API key/token
+	Password       Secret          `gorm:"type:text"`
+	AccessHash     Secret          `gorm:"type:text"` // API key/token
 	Secure         bool            `gorm:"not null;default:true"`
 	Status         ServerStatus    `gorm:"size:32;not null;default:'active'"`
 	MaxAccounts    int             `gorm:"not null;default:0"` // 0 = unlimited
@@ -103,6 +103,38 @@ type Setting struct {
 	UpdatedAt time.Time `gorm:"not null"`
 }
 
+// Maintenance mode settings. While it is on customers get a 503 page,
+// background jobs changing services and webhook deliveries are held, and
+// staff sessions and API keys keep working.
+const (
+	SettingMaintenance          = "system.maintenance"
+	SettingMaintenanceMessage   = "system.maintenance_message"
+	SettingMaintenanceStartedAt = "system.maintenance_started_at"
+	SettingMaintenanceEndsAt    = "system.maintenance_ends_at"
+)
+
+// Admin area access settings: the networks the admin panel and admin API
+// are reached from, one IP address or CIDR range per line, and the hash of
+// the one-time token that lets a locked out admin trust their address
+const (
+	SettingAdminAllowedIPs    = "security.admin_allowed_ips"
+	SettingAdminRecoveryToken = "security.admin_recovery_token"
+)
+
+// Two-person rule settings: the dangerous admin actions a second admin
+// must approve, comma separated, and how many minutes they have to
+const (
+	SettingApprovalActions = "security.approval_actions"
+	SettingApprovalWindow  = "security.approval_window_minutes"
+)
+
+// License settings: the key entered by an admin and the last answer of the
+// update server, kept so the edition survives restarts while it is offline
+const (
+	SettingLicenseKey   = "license.key"
+	SettingLicenseState = "license.state"
+)
+
 // EmailTemplate represents an email template
 type EmailTemplate struct {
 	ID          uint64    `gorm:"primaryKey"`
@@ -127,15 +159,29 @@ type EmailLog struct {
 	FromEmail   string    `gorm:"size:255"`
 	Subject     string    `gorm:"size:500;not null"`
 	Body        string    `gorm:"type:text"`
-	Status      string    `gorm:"size:32;not null"` // sent, failed, queued
+	Status      string    `gorm:"size:32;not null"` // sent, failed, bounced, skipped
 	ErrorMsg    string    `gorm:"type:text"`
 	RelatedType string    `gorm:"size:50;index"`
 	RelatedID   *uint64   `gorm:"index"`
 	SentAt      *time.Time
 	CreatedAt   time.Time `gorm:"not null"`
 
+	// SMTPConfigID is the config the email was sent or failed through
+	SMTPConfigID *uint64 `gorm:"index"`
+
+	// Opens and clicks of the email, recorded through its open pixel and
+	// wrapped links when tracking is on. TrackingToken identifies it in
+	// their URLs.
+	TrackingToken  string `gorm:"size:64;index"`
+	Opens          int    `gorm:"not null;default:0"`
+	Clicks         int    `gorm:"not null;default:0"`
+	FirstOpenedAt  *time.Time
+	LastOpenedAt   *time.Time
+	FirstClickedAt *time.Time
+
 	Customer *User          `gorm:"foreignKey:CustomerID"`
 	Template *EmailTemplate `gorm:"foreignKey:TemplateID"`
+	Links    []EmailLink    `gorm:"foreignKey:EmailLogID"`
 }
 
 // Currency represents a supported currency
@@ -0,0 +1,57 @@
+package domain
+
+import "time"
+
+// AdminTaskStatus is the state of an admin task
+type AdminTaskStatus string
+
+const (
+	AdminTaskStatusOpen AdminTaskStatus = "open"
+	AdminTaskStatusDone AdminTaskStatus = "done"
+)
+
+// TaskEntity is the kind of record a task is about
+type TaskEntity string
+
+const (
+	TaskEntityCustomer TaskEntity = "customer"
+	TaskEntityOrder    TaskEntity = "order"
+	TaskEntityInvoice  TaskEntity = "invoice"
+	TaskEntityService  TaskEntity = "service"
+	TaskEntityTicket   TaskEntity = "ticket"
+)
+
+// Valid reports whether the entity is a known kind of record
+func (e TaskEntity) Valid() bool {
+	switch e {
+	case TaskEntityCustomer, TaskEntityOrder, TaskEntityInvoice, TaskEntityService, TaskEntityTicket:
+		return true
+	}
+	return false
+}
+
+// AdminTask is a to-do of the staff, optionally about a customer, order,
+// invoice, service or ticket
+type AdminTask struct {
+	ID                uint64          `gorm:"primaryKey"`
+	Title             string          `gorm:"size:255;not null"`
+	Description       string          `gorm:"type:text"`
+	Status            AdminTaskStatus `gorm:"size:16;not null;default:'open';index"`
+	EntityType        TaskEntity      `gorm:"size:32;index:idx_admin_task_entity"`
+	EntityID          *uint64         `gorm:"index:idx_admin_task_entity"`
+	AssigneeID        *uint64         `gorm:"index"`
+	CreatedBy         uint64          `gorm:"not null"`
+	DueAt             *time.Time      `gorm:"index"`
+	CompletedAt       *time.Time
+	CompletedBy       *uint64
+	OverdueNotifiedAt *time.Time // When the assignee was told the task is overdue
+	CreatedAt         time.Time  `gorm:"not null"`
+	UpdatedAt         time.Time  `gorm:"not null"`
+
+	Assignee *User `gorm:"foreignKey:AssigneeID"`
+}
+
+// IsOverdue reports whether an open task is past its due date
+func (t *AdminTask) IsOverdue(now time.Time) bool {
+	return t.Status == AdminTaskStatusOpen && t.DueAt != nil && t.DueAt.Before(now)
+}
@@ -1,6 +1,13 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrSenderRejected is returned when an email may not open or answer a
+// ticket, such as mail from unknown senders to a clients only department
+var ErrSenderRejected = errors.New("sender is not allowed to open tickets")
 
 type TicketStatus string
 
@@ -19,15 +26,29 @@ const (
 )
 
 type Ticket struct {
-	ID         uint64          `gorm:"primaryKey"`
-	CustomerID *uint64         `gorm:"index"`
-	Subject    string          `gorm:"size:255;not null"`
-	Status     TicketStatus    `gorm:"size:32;not null;index"`
-	Priority   TicketPriority  `gorm:"size:32;not null"`
-	Source     string          `gorm:"size:32;not null"`
-	Messages   []TicketMessage `gorm:"foreignKey:TicketID"`
-	CreatedAt  time.Time       `gorm:"not null"`
-	UpdatedAt  time.Time       `gorm:"not null"`
+	ID           uint64          `gorm:"primaryKey"`
+	CustomerID   *uint64         `gorm:"index"`
+	DepartmentID *uint64         `gorm:"index"`
+	Subject      string          `gorm:"size:255;not null"`
+	Status       TicketStatus    `gorm:"size:32;not null;index"`
+	Priority     TicketPriority  `gorm:"size:32;not null"`
+	Source       string          `gorm:"size:32;not null"`
+	Messages     []TicketMessage `gorm:"foreignKey:TicketID"`
+	CreatedAt    time.Time       `gorm:"not null"`
+	UpdatedAt    time.Time       `gorm:"not null"`
+
+	// UnknownSender flags tickets opened by email from an address of no
+	// customer, until staff assign one
+	UnknownSender bool `gorm:"not null;default:false"`
+
+	// Staff member handling the ticket. RoutedAt is set once the ticket
+	// was given an SLA and offered for assignment.
+	AssigneeID *uint64 `gorm:"index"`
+	RoutedAt   *time.Time
+
+	// Filled by list queries instead of loading Messages
+	MessageCount   int64 `gorm:"-"`
+	LastReplyStaff bool  `gorm:"-"`
 }
 
 type TicketMessage struct {
@@ -35,12 +56,20 @@ type TicketMessage struct {
 	TicketID    uint64             `gorm:"not null;index"`
 	SenderEmail string             `gorm:"size:255;not null"`
 	Body        string             `gorm:"type:text;not null"`
+	BodyHTML    string             `gorm:"type:text"` // Body rendered from Markdown and sanitized
 	IsStaff     bool               `gorm:"not null;default:false"`
 	Attachments []TicketAttachment `gorm:"foreignKey:TicketMessageID"`
 	CreatedAt   time.Time          `gorm:"not null"`
 	UpdatedAt   time.Time          `gorm:"not null"`
+
+	// OriginalBody is the full text of an emailed message whose quoted
+	// history and signature were removed from Body, kept for audit
+	OriginalBody string `gorm:"type:text"`
 }
 
+// TicketAttachment is a file attached to a ticket message. Files are kept
+// in the file store under StorageKey; attachments saved before the file
+// store existed keep their content in Data until they are migrated.
 type TicketAttachment struct {
 	ID              uint64    `gorm:"primaryKey"`
 	TicketMessageID uint64    `gorm:"not null;index"`
@@ -48,6 +77,7 @@ type TicketAttachment struct {
 	ContentType     string    `gorm:"size:128;not null"`
 	SizeBytes       int64     `gorm:"not null"`
 	Data            []byte    `gorm:"type:bytea;not null"`
+	StorageKey      string    `gorm:"size:500;index"`
 	CreatedAt       time.Time `gorm:"not null"`
 	UpdatedAt       time.Time `gorm:"not null"`
 }
@@ -28,6 +28,20 @@ const (
 	UserStatusPending   UserStatus = "pending"
 )
 
+// Appearance is the color scheme a user prefers
+type Appearance string
+
+const (
+	AppearanceAuto  Appearance = "auto" // Follow the system setting
+	AppearanceLight Appearance = "light"
+	AppearanceDark  Appearance = "dark"
+)
+
+// Valid reports whether the appearance is a known color scheme
+func (a Appearance) Valid() bool {
+	return a == AppearanceAuto || a == AppearanceLight || a == AppearanceDark
+}
+
 // User represents a system user (customer, admin, or staff)
 type User struct {
 	ID            uint64          `gorm:"primaryKey"`
@@ -47,6 +61,9 @@ type User struct {
 	Country       string          `gorm:"size:2"` // ISO 3166-1 alpha-2
 	Language      string          `gorm:"size:10;default:'en'"`
 	Currency      string          `gorm:"size:3;default:'USD'"` // ISO 4217
+	Appearance    Appearance      `gorm:"size:10;not null;default:'auto'"`
+	Theme         string          `gorm:"size:64"` // Preferred theme, empty for the site theme
+	Timezone      string          `gorm:"size:64"` // IANA time zone, empty for the server time zone
 	TaxID         string          `gorm:"size:50"`
 	Credit        decimal.Decimal `gorm:"type:numeric(20,8);not null;default:0"`
 	TwoFactorAuth bool            `gorm:"not null;default:false"`
@@ -57,6 +74,21 @@ type User struct {
 	CreatedAt     time.Time `gorm:"not null"`
 	UpdatedAt     time.Time `gorm:"not null"`
 
+	// Staff member looking after the customer, alerted when the customer
+	// health score drops
+	AccountManagerID *uint64 `gorm:"index"`
+
+	// Staff set themselves away to get no new tickets
+	Away bool `gorm:"not null;default:false"`
+
+	// Networks an admin may also reach the admin area from, one IP address
+	// or CIDR range per line
+	TrustedIPs string `gorm:"type:text"`
+
+	// Renewals falling due within this many days of an open renewal invoice
+	// are added to it instead of getting their own, 0 for one per service
+	ConsolidateDays int `gorm:"not null;default:0"`
+
 	// Relations
 	Services       []Service       `gorm:"foreignKey:CustomerID"`
 	Orders         []Order         `gorm:"foreignKey:CustomerID"`
@@ -80,6 +112,19 @@ func (u *User) FullName() string {
 	return u.FirstName + " " + u.LastName
 }
 
+// Location returns the user's time zone, or the server time zone when the
+// user has none or it is unknown
+func (u *User) Location() *time.Location {
+	if u == nil || u.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
 // IsAdmin checks if the user has admin role
 func (u *User) IsAdmin() bool {
 	return u.Role == UserRoleAdmin
@@ -102,8 +147,11 @@ type Session struct {
 	UserAgent string    `gorm:"size:512"`
 	IPAddress string    `gorm:"size:45"`
 	ExpiresAt time.Time `gorm:"not null;index"`
-	CreatedAt time.Time `gorm:"not null"`
-	UpdatedAt time.Time `gorm:"not null"`
+	// Role is that of the user at sign in; the session ends when it changes
+	Role       UserRole   `gorm:"size:32"`
+	LastSeenAt *time.Time // Last request, for the idle timeout
+	CreatedAt  time.Time  `gorm:"not null"`
+	UpdatedAt  time.Time  `gorm:"not null"`
 
 	User User `gorm:"foreignKey:UserID"`
 }
@@ -164,6 +212,40 @@ type AuditLog struct {
 	User *User `gorm:"foreignKey:UserID"`
 }
 
+// AuditActionCredentialsRevealed is the audit log action of showing the
+// password of a service
+const AuditActionCredentialsRevealed = "service.credentials_revealed"
+
+// Audit log actions of admin area access: requests blocked by the
+// allow-lists, changes to them, and recovery tokens created and used
+const (
+	AuditActionAdminAccessBlocked   = "admin_access.blocked"
+	AuditActionAdminAccessUpdated   = "admin_access.updated"
+	AuditActionAdminRecoveryCreated = "admin_access.recovery_token_created"
+	AuditActionAdminRecovered       = "admin_access.recovered"
+	AuditActionAdminRecoveryFailed  = "admin_access.recovery_failed"
+)
+
+// Audit log actions of the security monitor: patterns of abuse staff are
+// alerted of, and bans applied and lifted
+const (
+	AuditActionSecurityAnomaly = "security.anomaly"
+	AuditActionBanCreated      = "security.ban_created"
+	AuditActionBanLifted       = "security.ban_lifted"
+)
+
+// Audit log actions of the two-person rule. Their entity is the approval
+// request, linking the request, the decision and the action carried out.
+const (
+	AuditActionApprovalRequested = "approval.requested"
+	AuditActionApprovalRejected  = "approval.rejected"
+	AuditActionApprovalCancelled = "approval.cancelled"
+	AuditActionApprovalExpired   = "approval.expired"
+	AuditActionApprovalExecuted  = "approval.executed"
+	AuditActionApprovalFailed    = "approval.failed"
+	AuditActionApprovalSettings  = "approval.settings_updated"
+)
+
 // AdminNote represents a staff note on a customer account
 type AdminNote struct {
 	ID         uint64    `gorm:"primaryKey"`
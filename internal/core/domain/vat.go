@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// VAT settings of the seller. Customers in another EU member state with a
+// valid VAT number are reverse charged; the seller's VAT number is sent to
+// VIES so checks get a consultation number as proof.
+const (
+	SettingSellerCountry   = "tax.seller_country"
+	SettingSellerVATNumber = "tax.seller_vat_number"
+)
+
+// ReverseChargeNote is printed on reverse charged invoices
+const ReverseChargeNote = "Reverse charge: VAT to be accounted for by the recipient under Article 196 of Council Directive 2006/112/EC."
+
+// VATValidation is the last VIES check of a VAT number, cached so checkout
+// does not query VIES every time
+type VATValidation struct {
+	ID                 uint64    `gorm:"primaryKey"`
+	VATNumber          string    `gorm:"size:20;not null;uniqueIndex"` // With the VIES country prefix, e.g. DE123456789
+	Valid              bool      `gorm:"not null;default:false"`
+	Name               string    `gorm:"size:255"`
+	Address            string    `gorm:"type:text"`
+	ConsultationNumber string    `gorm:"size:64"` // VIES request identifier
+	CheckedAt          time.Time `gorm:"not null"`
+	CreatedAt          time.Time `gorm:"not null"`
+	UpdatedAt          time.Time `gorm:"not null"`
+}
@@ -0,0 +1,53 @@
+package account
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Service provides the security log and legal consents of customer
+// accounts
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new account service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// RecordEvent adds an entry to a user's security log
+func (s *Service) RecordEvent(userID uint64, eventType domain.SecurityEventType, ipAddress, userAgent, details string) error {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	if len(details) > 255 {
+		details = details[:255]
+	}
+	return s.db.Create(&domain.SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Details:   details,
+	}).Error
+}
+
+// ListEvents returns a user's security log, newest first
+func (s *Service) ListEvents(userID uint64, eventType domain.SecurityEventType, limit, offset int) ([]domain.SecurityEvent, int64, error) {
+	var events []domain.SecurityEvent
+	var total int64
+
+	query := s.db.Model(&domain.SecurityEvent{}).Where("user_id = ?", userID)
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,43 @@
+package account
+
+import (
+	"errors"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ErrInvalidAppearance = errors.New("appearance must be auto, light or dark")
+
+// UpdateAppearance changes a user's color scheme and preferred theme. Nil
+// fields are left unchanged and an empty theme follows the site theme.
+// Callers check that the theme may be chosen.
+func (s *Service) UpdateAppearance(userID uint64, input AppearanceInput) (*domain.User, error) {
+	updates := make(map[string]interface{})
+	if input.Appearance != nil {
+		if !input.Appearance.Valid() {
+			return nil, ErrInvalidAppearance
+		}
+		updates["appearance"] = *input.Appearance
+	}
+	if input.Theme != nil {
+		updates["theme"] = *input.Theme
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(&domain.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var user domain.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AppearanceInput holds the appearance settings to change
+type AppearanceInput struct {
+	Appearance *domain.Appearance
+	Theme      *string
+}
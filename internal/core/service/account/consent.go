@@ -0,0 +1,366 @@
+package account
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrDocumentNotFound  = errors.New("legal document not found")
+	ErrDocumentOutdated  = errors.New("a newer version of this document has been published")
+	ErrInvalidDocument   = errors.New("invalid legal document")
+	ErrVersionExists     = errors.New("this version has already been published")
+	ErrDocumentPublished = errors.New("published documents cannot be edited, publish a new version instead")
+	ErrConsentRequired   = errors.New("the current legal documents must be accepted")
+)
+
+// CurrentDocument returns the latest published version of a legal document
+func (s *Service) CurrentDocument(docType domain.LegalDocumentType) (*domain.LegalDocument, error) {
+	var doc domain.LegalDocument
+	result := s.db.Where("type = ? AND published_at <= ?", docType, time.Now()).
+		Order("published_at DESC, id DESC").Limit(1).Find(&doc)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDocumentNotFound
+	}
+	return &doc, nil
+}
+
+// ConsentStatus returns the current version of every legal document with
+// the version a user last accepted. Documents whose current version
+// requires consent and was not accepted need the user to consent again.
+func (s *Service) ConsentStatus(userID uint64) ([]Consent, error) {
+	consents := []Consent{}
+	for _, docType := range domain.LegalDocumentTypes {
+		doc, err := s.CurrentDocument(docType)
+		if err == ErrDocumentNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		consent := Consent{Document: *doc}
+		var record domain.ConsentRecord
+		result := s.db.Where("user_id = ? AND document_type = ?", userID, docType).
+			Order("created_at DESC, id DESC").Limit(1).Find(&record)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			consent.Accepted = &record
+		}
+		consent.RequiresAction = doc.RequiresConsent && (consent.Accepted == nil || consent.Accepted.DocumentID != doc.ID)
+		consents = append(consents, consent)
+	}
+	return consents, nil
+}
+
+// GiveConsent records a user's acceptance of the current version of a
+// legal document
+func (s *Service) GiveConsent(userID, documentID uint64, ipAddress, userAgent string) (*domain.ConsentRecord, error) {
+	var doc domain.LegalDocument
+	if err := s.db.First(&doc, documentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	current, err := s.CurrentDocument(doc.Type)
+	if err != nil {
+		return nil, err
+	}
+	if current.ID != doc.ID {
+		return nil, ErrDocumentOutdated
+	}
+
+	records, err := s.AcceptDocuments(userID, []domain.LegalDocument{doc}, domain.ConsentContextAccount, nil, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+// RequiredDocuments returns the current versions of the legal documents
+// customers must accept when registering and at checkout
+func (s *Service) RequiredDocuments() ([]domain.LegalDocument, error) {
+	docs := []domain.LegalDocument{}
+	for _, docType := range domain.LegalDocumentTypes {
+		doc, err := s.CurrentDocument(docType)
+		if err == ErrDocumentNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc.RequiresConsent {
+			docs = append(docs, *doc)
+		}
+	}
+	return docs, nil
+}
+
+// CheckAcceptance verifies that the documents a customer accepted cover
+// every required document and are all current versions. It returns the
+// accepted documents.
+func (s *Service) CheckAcceptance(documentIDs []uint64) ([]domain.LegalDocument, error) {
+	required, err := s.RequiredDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := make(map[uint64]bool, len(documentIDs))
+	for _, id := range documentIDs {
+		accepted[id] = true
+	}
+	for _, doc := range required {
+		if !accepted[doc.ID] {
+			return nil, ErrConsentRequired
+		}
+		delete(accepted, doc.ID)
+	}
+	if len(accepted) == 0 {
+		return required, nil
+	}
+
+	// Optional documents may be accepted as well, as long as they are current
+	docs := required
+	for id := range accepted {
+		var doc domain.LegalDocument
+		if err := s.db.First(&doc, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrDocumentNotFound
+			}
+			return nil, err
+		}
+		current, err := s.CurrentDocument(doc.Type)
+		if err != nil {
+			return nil, err
+		}
+		if current.ID != doc.ID {
+			return nil, ErrDocumentOutdated
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// AcceptDocuments records a user's acceptance of legal documents. orderID
+// links acceptances given at checkout to the order placed.
+func (s *Service) AcceptDocuments(userID uint64, docs []domain.LegalDocument, context domain.ConsentContext, orderID *uint64, ipAddress, userAgent string) ([]domain.ConsentRecord, error) {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	records := make([]domain.ConsentRecord, 0, len(docs))
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, doc := range docs {
+			record := domain.ConsentRecord{
+				UserID:       userID,
+				DocumentID:   doc.ID,
+				DocumentType: doc.Type,
+				Version:      doc.Version,
+				Context:      context,
+				OrderID:      orderID,
+				IPAddress:    ipAddress,
+				UserAgent:    userAgent,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			if err := NewService(tx).RecordEvent(userID, domain.SecurityEventConsentGiven, ipAddress, userAgent,
+				string(doc.Type)+" "+doc.Version+" ("+string(context)+")"); err != nil {
+				return err
+			}
+			record.Document = doc
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ConsentHistory returns every consent a user has given, newest first
+func (s *Service) ConsentHistory(userID uint64) ([]domain.ConsentRecord, error) {
+	var records []domain.ConsentRecord
+	err := s.db.Preload("Document").Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").Find(&records).Error
+	return records, err
+}
+
+// WriteConsentHistoryCSV writes a consent history as CSV
+func WriteConsentHistoryCSV(w io.Writer, records []domain.ConsentRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"accepted_at", "document", "title", "version", "published_at", "context", "ip_address", "user_agent"}); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := writer.Write([]string{
+			record.CreatedAt.UTC().Format(time.RFC3339),
+			string(record.DocumentType),
+			record.Document.Title,
+			record.Version,
+			record.Document.PublishedAt.UTC().Format(time.RFC3339),
+			string(record.Context),
+			record.IPAddress,
+			record.UserAgent,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// --- Admin ---
+
+// ListDocuments returns every version of the legal documents, newest first
+func (s *Service) ListDocuments(docType domain.LegalDocumentType) ([]domain.LegalDocument, error) {
+	var docs []domain.LegalDocument
+	query := s.db.Order("published_at DESC, id DESC")
+	if docType != "" {
+		query = query.Where("type = ?", docType)
+	}
+	err := query.Find(&docs).Error
+	return docs, err
+}
+
+// PublishDocument publishes a new version of a legal document. When it
+// requires consent, customers who accepted an earlier version are asked to
+// accept it again. A zero PublishedAt publishes it now.
+func (s *Service) PublishDocument(doc *domain.LegalDocument) error {
+	doc.Version = strings.TrimSpace(doc.Version)
+	if doc.Version == "" || strings.TrimSpace(doc.Title) == "" || strings.TrimSpace(doc.Content) == "" {
+		return ErrInvalidDocument
+	}
+	if !isLegalDocumentType(doc.Type) {
+		return ErrInvalidDocument
+	}
+
+	var count int64
+	if err := s.db.Model(&domain.LegalDocument{}).
+		Where("type = ? AND version = ?", doc.Type, doc.Version).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionExists
+	}
+
+	if doc.PublishedAt.IsZero() {
+		doc.PublishedAt = time.Now()
+	}
+	requiresConsent := doc.RequiresConsent
+	doc.ID = 0
+	if err := s.db.Create(doc).Error; err != nil {
+		return err
+	}
+	// RequiresConsent defaults to true, so false is written explicitly
+	if !requiresConsent {
+		return s.db.Model(doc).Update("requires_consent", false).Error
+	}
+	return nil
+}
+
+// UpdateDocument edits a legal document version that is scheduled but not
+// yet published
+func (s *Service) UpdateDocument(id uint64, updates map[string]interface{}) (*domain.LegalDocument, error) {
+	var doc domain.LegalDocument
+	if err := s.db.First(&doc, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	if !doc.PublishedAt.After(time.Now()) {
+		return nil, ErrDocumentPublished
+	}
+
+	for _, field := range []string{"title", "content"} {
+		if value, ok := updates[field].(string); ok && strings.TrimSpace(value) == "" {
+			return nil, ErrInvalidDocument
+		}
+	}
+	if publishedAt, ok := updates["published_at"].(time.Time); ok && publishedAt.IsZero() {
+		return nil, ErrInvalidDocument
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(&doc).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.First(&doc, id).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListAcceptances returns the recorded acceptances of legal documents,
+// newest first
+func (s *Service) ListAcceptances(filter AcceptanceFilter, limit, offset int) ([]domain.ConsentRecord, int64, error) {
+	var records []domain.ConsentRecord
+	var total int64
+
+	query := s.db.Model(&domain.ConsentRecord{})
+	if filter.DocumentID != 0 {
+		query = query.Where("document_id = ?", filter.DocumentID)
+	}
+	if filter.DocumentType != "" {
+		query = query.Where("document_type = ?", filter.DocumentType)
+	}
+	if filter.Version != "" {
+		query = query.Where("version = ?", filter.Version)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Context != "" {
+		query = query.Where("context = ?", filter.Context)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Preload("Document").Preload("User").Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+func isLegalDocumentType(docType domain.LegalDocumentType) bool {
+	for _, t := range domain.LegalDocumentTypes {
+		if t == docType {
+			return true
+		}
+	}
+	return false
+}
+
+// Consent is the current version of a legal document with a user's
+// latest acceptance
+type Consent struct {
+	Document       domain.LegalDocument
+	Accepted       *domain.ConsentRecord // Latest acceptance of any version, nil if never accepted
+	RequiresAction bool
+}
+
+// AcceptanceFilter narrows down the acceptances listed for admins
+type AcceptanceFilter struct {
+	DocumentID   uint64
+	DocumentType domain.LegalDocumentType
+	Version      string
+	UserID       uint64
+	Context      domain.ConsentContext
+}
@@ -0,0 +1,123 @@
+package account
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrCurrencyUnavailable = errors.New("currency is not offered")
+	ErrCurrencyLocked      = errors.New("currency cannot be changed once the customer has been invoiced")
+)
+
+// defaultCurrency is offered when no currency is configured
+const defaultCurrency = "USD"
+
+// Currencies returns the codes of the currencies customers can be billed
+// in, the default one first
+func Currencies(db *gorm.DB) ([]string, error) {
+	var rows []domain.Currency
+	if err := db.Select("code", "is_default").Where("active = ?", true).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []string{defaultCurrency}, nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].IsDefault != rows[j].IsDefault {
+			return rows[i].IsDefault
+		}
+		return rows[i].Code < rows[j].Code
+	})
+	codes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		codes = append(codes, strings.ToUpper(row.Code))
+	}
+	return codes, nil
+}
+
+// OfferedCurrency returns a currency code in upper case if customers can
+// be billed in it. An empty code gives the default currency.
+func OfferedCurrency(db *gorm.DB, code string) (string, error) {
+	codes, err := Currencies(db)
+	if err != nil {
+		return "", err
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return codes[0], nil
+	}
+	for _, offered := range codes {
+		if offered == code {
+			return code, nil
+		}
+	}
+	return "", ErrCurrencyUnavailable
+}
+
+// CustomerCurrency returns the currency a customer is billed in, the
+// default currency for guests
+func CustomerCurrency(db *gorm.DB, customerID uint64) (string, error) {
+	if customerID != 0 {
+		var user domain.User
+		if err := db.Select("id", "currency").First(&user, customerID).Error; err != nil {
+			return "", err
+		}
+		if user.Currency != "" {
+			return strings.ToUpper(user.Currency), nil
+		}
+	}
+	return OfferedCurrency(db, "")
+}
+
+// Currencies returns the codes of the currencies customers can pick
+func (s *Service) Currencies() ([]string, error) {
+	return Currencies(s.db)
+}
+
+// Currency returns the currency a customer is billed in
+func (s *Service) Currency(customerID uint64) (string, error) {
+	return CustomerCurrency(s.db, customerID)
+}
+
+// CurrencyLocked reports whether a customer has been invoiced, after which
+// their currency is fixed
+func (s *Service) CurrencyLocked(customerID uint64) (bool, error) {
+	var count int64
+	if err := s.db.Model(&domain.Invoice{}).Where("customer_id = ?", customerID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SetCurrency changes the currency a customer sees prices and is billed
+// in. It can only change until the first invoice.
+func (s *Service) SetCurrency(customerID uint64, code string) (string, error) {
+	code, err := OfferedCurrency(s.db, code)
+	if err != nil {
+		return "", err
+	}
+	current, err := CustomerCurrency(s.db, customerID)
+	if err != nil {
+		return "", err
+	}
+	if current == code {
+		return code, nil
+	}
+	locked, err := s.CurrencyLocked(customerID)
+	if err != nil {
+		return "", err
+	}
+	if locked {
+		return "", ErrCurrencyLocked
+	}
+	if err := s.db.Model(&domain.User{}).Where("id = ?", customerID).Update("currency", code).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,308 @@
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+)
+
+var (
+	ErrServiceNotFound      = errors.New("service not found")
+	ErrServiceNotActive     = errors.New("addons can only be ordered for active services")
+	ErrAddonNotFound        = errors.New("addon not found")
+	ErrAddonNotAvailable    = errors.New("addon is not available for this service")
+	ErrAddonAlreadyActive   = errors.New("addon is already active on this service")
+	ErrInvalidQuantity      = errors.New("invalid addon quantity")
+	ErrServiceAddonNotFound = errors.New("service addon not found")
+	ErrAddonNotCancellable  = errors.New("addon cannot be cancelled")
+)
+
+// Service manages addons ordered on existing services. Recurring addons
+// share the billing cycle and due date of their parent service and are
+// billed on its renewal invoices.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new addon service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// AvailableAddons returns the active addons assigned to the product of a
+// customer's service, priced for its billing cycle and prorated to its
+// next due date
+func (s *Service) AvailableAddons(customerID, serviceID uint64) ([]Offer, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var addons []domain.ProductAddon
+	if err := s.db.Joins("JOIN product_addon_assignments ON product_addon_assignments.addon_id = product_addons.id").
+		Where("product_addon_assignments.product_id = ? AND product_addons.active = ?", service.ProductID, true).
+		Order("product_addon_assignments.sort_order, product_addons.weight, product_addons.id").
+		Find(&addons).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	offers := make([]Offer, 0, len(addons))
+	for i := range addons {
+		offers = append(offers, s.quote(service, &addons[i], 1, now))
+	}
+	return offers, nil
+}
+
+// ListServiceAddons returns the addons of a customer's service
+func (s *Service) ListServiceAddons(customerID, serviceID uint64) ([]domain.ServiceAddon, error) {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return nil, err
+	}
+
+	var addons []domain.ServiceAddon
+	if err := s.db.Preload("Addon").Where("service_id = ?", serviceID).
+		Order("created_at").Find(&addons).Error; err != nil {
+		return nil, err
+	}
+	return addons, nil
+}
+
+// OrderAddon adds an addon to a customer's active service. The setup fee
+// and the price of the rest of the current period, prorated to the
+// parent's next due date, are invoiced straight away. The returned invoice
+// is nil when there is nothing to pay.
+func (s *Service) OrderAddon(customerID, serviceID, addonID uint64, quantity int) (*domain.ServiceAddon, *domain.Invoice, error) {
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if service.Status != domain.ServiceStatusActive {
+		return nil, nil, ErrServiceNotActive
+	}
+
+	var addon domain.ProductAddon
+	if err := s.db.First(&addon, addonID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAddonNotFound
+		}
+		return nil, nil, err
+	}
+
+	var assigned int64
+	if err := s.db.Model(&domain.ProductAddonAssignment{}).
+		Where("product_id = ? AND addon_id = ?", service.ProductID, addonID).
+		Count(&assigned).Error; err != nil {
+		return nil, nil, err
+	}
+	if assigned == 0 || !addon.Active {
+		return nil, nil, ErrAddonNotAvailable
+	}
+
+	if !addon.AllowQuantity && quantity > 1 {
+		return nil, nil, ErrInvalidQuantity
+	}
+	if addon.MaxQuantity > 0 && quantity > addon.MaxQuantity {
+		return nil, nil, ErrInvalidQuantity
+	}
+	if !addon.AllowQuantity && addon.IsRecurring() {
+		var active int64
+		if err := s.db.Model(&domain.ServiceAddon{}).
+			Where("service_id = ? AND addon_id = ? AND status IN ?", serviceID, addonID,
+				[]domain.ServiceStatus{domain.ServiceStatusActive, domain.ServiceStatusPending, domain.ServiceStatusSuspended}).
+			Count(&active).Error; err != nil {
+			return nil, nil, err
+		}
+		if active > 0 {
+			return nil, nil, ErrAddonAlreadyActive
+		}
+	}
+
+	now := time.Now()
+	offer := s.quote(service, &addon, quantity, now)
+
+	status := domain.ServiceStatusPending
+	if addon.ProvisionAutomatically {
+		status = domain.ServiceStatusActive
+	}
+	serviceAddon := &domain.ServiceAddon{
+		ServiceID:       service.ID,
+		AddonID:         addon.ID,
+		Quantity:        quantity,
+		Status:          status,
+		BillingCycle:    service.BillingCycle,
+		RecurringAmount: offer.RecurringFee,
+		NextDueDate:     service.NextDueDate,
+		SetupFeeApplied: offer.SetupFee.IsPositive(),
+	}
+	if !addon.IsRecurring() {
+		serviceAddon.BillingCycle = domain.AddonTypeOneTime
+	}
+
+	var items []invoice.InvoiceItemRequest
+	qty := decimal.NewFromInt(int64(quantity))
+	if offer.SetupFee.IsPositive() {
+		items = append(items, invoice.InvoiceItemRequest{
+			ServiceID:   &service.ID,
+			Type:        "addon",
+			Description: fmt.Sprintf("%s - %s setup fee", service.Product.Name, addon.Name),
+			Quantity:    decimal.NewFromInt(1),
+			UnitPrice:   offer.SetupFee,
+			Taxable:     true,
+		})
+	}
+	if offer.DueNow.IsPositive() {
+		description := fmt.Sprintf("%s - %s", service.Product.Name, addon.Name)
+		item := invoice.InvoiceItemRequest{
+			ServiceID:   &service.ID,
+			Type:        "addon",
+			Description: description,
+			Quantity:    qty,
+			UnitPrice:   offer.DueNow.Div(qty).Round(2),
+			Taxable:     true,
+		}
+		if addon.IsRecurring() {
+			periodEnd := service.NextDueDate
+			item.Description = fmt.Sprintf("%s (%s to %s, prorated)", description,
+				now.Format("Jan 2, 2006"), periodEnd.Format("Jan 2, 2006"))
+			item.PeriodStart = &now
+			item.PeriodEnd = &periodEnd
+		}
+		items = append(items, item)
+	}
+
+	var inv *domain.Invoice
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(serviceAddon).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		inv, err = invoice.NewService(tx).CreateInvoice(service.CustomerID, service.Currency, now, items)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceAddon.Addon = addon
+	return serviceAddon, inv, nil
+}
+
+// CancelAddon stops a recurring addon of a customer's service from renewing
+func (s *Service) CancelAddon(customerID, serviceID, serviceAddonID uint64) error {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return err
+	}
+
+	var serviceAddon domain.ServiceAddon
+	result := s.db.Where("id = ? AND service_id = ?", serviceAddonID, serviceID).Limit(1).Find(&serviceAddon)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrServiceAddonNotFound
+	}
+	if serviceAddon.Status == domain.ServiceStatusCancelled || serviceAddon.Status == domain.ServiceStatusTerminated {
+		return ErrAddonNotCancellable
+	}
+
+	return s.db.Model(&serviceAddon).Update("status", domain.ServiceStatusCancelled).Error
+}
+
+// ActivateAddon activates an addon that was ordered without automatic
+// provisioning
+func (s *Service) ActivateAddon(serviceAddonID uint64) error {
+	result := s.db.Model(&domain.ServiceAddon{}).
+		Where("id = ? AND status = ?", serviceAddonID, domain.ServiceStatusPending).
+		Update("status", domain.ServiceStatusActive)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrServiceAddonNotFound
+	}
+	return nil
+}
+
+// quote prices quantity units of an addon on a service at now
+func (s *Service) quote(service *domain.Service, addon *domain.ProductAddon, quantity int, now time.Time) Offer {
+	qty := decimal.NewFromInt(int64(quantity))
+	offer := Offer{
+		Addon:    *addon,
+		SetupFee: addon.SetupFee,
+	}
+
+	if !addon.IsRecurring() {
+		offer.DueNow = addon.OneTimePrice.Mul(qty)
+		return offer
+	}
+
+	offer.RecurringFee = addon.CyclePrice(service.BillingCycle)
+	offer.DueNow = offer.RecurringFee.Mul(qty).Mul(ProrataFactor(service.NextDueDate, service.BillingCycle, now)).Round(2)
+	return offer
+}
+
+// ProrataFactor returns the share of the billing period ending at dueDate
+// that is left at now, between 0 and 1
+func ProrataFactor(dueDate time.Time, billingCycle string, now time.Time) decimal.Decimal {
+	periodStart := subtractBillingPeriod(dueDate, billingCycle)
+	period := dueDate.Sub(periodStart)
+	remaining := dueDate.Sub(now)
+	if remaining <= 0 || period <= 0 {
+		return decimal.Zero
+	}
+	if remaining >= period {
+		return decimal.NewFromInt(1)
+	}
+	return decimal.NewFromInt(int64(remaining)).Div(decimal.NewFromInt(int64(period)))
+}
+
+func subtractBillingPeriod(from time.Time, billingCycle string) time.Time {
+	switch billingCycle {
+	case "quarterly":
+		return from.AddDate(0, -3, 0)
+	case "semi-annually", "semiannually":
+		return from.AddDate(0, -6, 0)
+	case "annually", "yearly":
+		return from.AddDate(-1, 0, 0)
+	case "biennially":
+		return from.AddDate(-2, 0, 0)
+	case "triennially":
+		return from.AddDate(-3, 0, 0)
+	default:
+		return from.AddDate(0, -1, 0)
+	}
+}
+
+// customerService loads a service of a customer with its product
+func (s *Service) customerService(customerID, serviceID uint64) (*domain.Service, error) {
+	var service domain.Service
+	result := s.db.Preload("Product").Where("id = ? AND customer_id = ?", serviceID, customerID).Limit(1).Find(&service)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return &service, nil
+}
+
+// Offer is an addon priced for a service
+type Offer struct {
+	Addon        domain.ProductAddon
+	SetupFee     decimal.Decimal
+	RecurringFee decimal.Decimal // Per unit and billing cycle of the service
+	DueNow       decimal.Decimal // One-time price or the prorated rest of the current period
+}
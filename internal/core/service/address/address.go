@@ -0,0 +1,284 @@
+// Package address checks the billing addresses of customers at checkout:
+// the fields each country requires, the format of postal codes, the
+// countries sales are restricted to and the countries under embargo. An
+// external API can normalize addresses before they are checked.
+package address
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidAddress   = errors.New("invalid billing address")
+	ErrCountryNotSold   = errors.New("we do not sell to customers in this country")
+	ErrCountryEmbargoed = errors.New("we cannot sell to customers in this country")
+	ErrCustomerNotFound = errors.New("customer not found")
+	ErrInvalidCountry   = errors.New("countries must be ISO 3166-1 alpha-2 codes")
+	ErrConflictingLists = errors.New("a country cannot be both allowed and embargoed")
+)
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// normalizeTimeout bounds a call to the normalization API so a slow API
+// does not hold up checkout
+const normalizeTimeout = 10 * time.Second
+
+// Address is a billing address
+type Address struct {
+	Address1   string `json:"address1"`
+	Address2   string `json:"address2"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"` // ISO 3166-1 alpha-2
+}
+
+// Normalizer standardizes an address with an external service. Valid is
+// false when the service knows the address does not exist.
+type Normalizer interface {
+	Normalize(ctx context.Context, addr Address) (normalized Address, valid bool, err error)
+}
+
+// Settings are the countries sales are restricted to and never made to
+type Settings struct {
+	AllowedCountries   []string // Empty sells to every country
+	EmbargoedCountries []string
+}
+
+// Service checks billing addresses
+type Service struct {
+	db         *gorm.DB
+	normalizer Normalizer
+}
+
+// NewService creates a new address service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetNormalizer sets the API addresses are normalized with before they are
+// checked. Without one addresses are only checked locally.
+func (s *Service) SetNormalizer(normalizer Normalizer) {
+	s.normalizer = normalizer
+}
+
+// Settings returns the allowed and embargoed countries
+func (s *Service) Settings() (Settings, error) {
+	settings := Settings{AllowedCountries: []string{}, EmbargoedCountries: []string{}}
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{domain.SettingAllowedCountries, domain.SettingEmbargoedCountries}).
+		Find(&rows).Error; err != nil {
+		return settings, err
+	}
+	for _, row := range rows {
+		countries, err := parseCountries(strings.Split(row.Value, ","))
+		if err != nil {
+			continue
+		}
+		switch row.Key {
+		case domain.SettingAllowedCountries:
+			settings.AllowedCountries = countries
+		case domain.SettingEmbargoedCountries:
+			settings.EmbargoedCountries = countries
+		}
+	}
+	return settings, nil
+}
+
+// UpdateSettings sets the allowed and embargoed countries
+func (s *Service) UpdateSettings(settings Settings) (Settings, error) {
+	allowed, err := parseCountries(settings.AllowedCountries)
+	if err != nil {
+		return Settings{}, err
+	}
+	embargoed, err := parseCountries(settings.EmbargoedCountries)
+	if err != nil {
+		return Settings{}, err
+	}
+	for _, country := range embargoed {
+		if contains(allowed, country) {
+			return Settings{}, ErrConflictingLists
+		}
+	}
+
+	values := []domain.Setting{
+		{Key: domain.SettingAllowedCountries, Value: strings.Join(allowed, ","), Type: "string", Group: "checkout", Label: "Countries sales are restricted to"},
+		{Key: domain.SettingEmbargoedCountries, Value: strings.Join(embargoed, ","), Type: "string", Group: "checkout", Label: "Embargoed countries"},
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			setting := domain.Setting{Key: value.Key}
+			if err := tx.Where("key = ?", value.Key).
+				Assign(domain.Setting{Value: value.Value, Type: value.Type, Group: value.Group, Label: value.Label}).
+				FirstOrCreate(&setting).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{AllowedCountries: allowed, EmbargoedCountries: embargoed}, nil
+}
+
+// Validate normalizes an address and checks it can be billed. The
+// normalization API is used when set; when it fails the address is only
+// checked locally so checkout is not blocked by an outage.
+func (s *Service) Validate(ctx context.Context, addr Address) (Address, error) {
+	addr = clean(addr)
+	if s.normalizer != nil && addr.Country != "" {
+		callCtx, cancel := context.WithTimeout(ctx, normalizeTimeout)
+		normalized, valid, err := s.normalizer.Normalize(callCtx, addr)
+		cancel()
+		switch {
+		case err != nil:
+			log.Printf("address: normalize: %v", err)
+		case !valid:
+			return addr, fmt.Errorf("%w: the address could not be found", ErrInvalidAddress)
+		default:
+			addr = clean(normalized)
+		}
+	}
+
+	if err := checkFields(&addr); err != nil {
+		return addr, err
+	}
+
+	settings, err := s.Settings()
+	if err != nil {
+		return addr, err
+	}
+	if contains(settings.EmbargoedCountries, addr.Country) {
+		return addr, ErrCountryEmbargoed
+	}
+	if len(settings.AllowedCountries) > 0 && !contains(settings.AllowedCountries, addr.Country) {
+		return addr, ErrCountryNotSold
+	}
+	return addr, nil
+}
+
+// CheckCustomer checks the billing address of a customer at checkout and
+// stores it normalized
+func (s *Service) CheckCustomer(ctx context.Context, customerID uint64) error {
+	var user domain.User
+	if err := s.db.Select("id", "address1", "address2", "city", "state", "postal_code", "country").
+		First(&user, customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCustomerNotFound
+		}
+		return err
+	}
+
+	current := Address{
+		Address1:   user.Address1,
+		Address2:   user.Address2,
+		City:       user.City,
+		State:      user.State,
+		PostalCode: user.PostalCode,
+		Country:    user.Country,
+	}
+	addr, err := s.Validate(ctx, current)
+	if err != nil {
+		return err
+	}
+	if addr == current {
+		return nil
+	}
+	return s.db.Model(&domain.User{}).Where("id = ?", customerID).Updates(map[string]interface{}{
+		"address1":    addr.Address1,
+		"address2":    addr.Address2,
+		"city":        addr.City,
+		"state":       addr.State,
+		"postal_code": addr.PostalCode,
+		"country":     addr.Country,
+	}).Error
+}
+
+// checkFields checks the fields an address needs in its country, turning
+// state names into codes where the country uses them
+func checkFields(addr *Address) error {
+	if addr.Country == "" {
+		return fmt.Errorf("%w: country is required", ErrInvalidAddress)
+	}
+	if !countryCode.MatchString(addr.Country) {
+		return fmt.Errorf("%w: country must be an ISO 3166-1 alpha-2 code", ErrInvalidAddress)
+	}
+	if addr.Address1 == "" {
+		return fmt.Errorf("%w: street address is required", ErrInvalidAddress)
+	}
+	if addr.City == "" {
+		return fmt.Errorf("%w: city is required", ErrInvalidAddress)
+	}
+
+	if states, ok := stateCodes[addr.Country]; ok {
+		if addr.State == "" {
+			return fmt.Errorf("%w: state or province is required in %s", ErrInvalidAddress, addr.Country)
+		}
+		code, ok := states.lookup(addr.State)
+		if !ok {
+			return fmt.Errorf("%w: unknown state or province %q in %s", ErrInvalidAddress, addr.State, addr.Country)
+		}
+		addr.State = code
+	}
+
+	if format, ok := postalFormats[addr.Country]; ok {
+		if addr.PostalCode == "" {
+			return fmt.Errorf("%w: postal code is required in %s", ErrInvalidAddress, addr.Country)
+		}
+		if !format.MatchString(addr.PostalCode) {
+			return fmt.Errorf("%w: invalid postal code %q for %s", ErrInvalidAddress, addr.PostalCode, addr.Country)
+		}
+	}
+	return nil
+}
+
+// clean trims an address and puts the country and postal code in their
+// usual case
+func clean(addr Address) Address {
+	addr.Address1 = strings.TrimSpace(addr.Address1)
+	addr.Address2 = strings.TrimSpace(addr.Address2)
+	addr.City = strings.TrimSpace(addr.City)
+	addr.State = strings.TrimSpace(addr.State)
+	addr.PostalCode = strings.ToUpper(strings.Join(strings.Fields(addr.PostalCode), " "))
+	addr.Country = strings.ToUpper(strings.TrimSpace(addr.Country))
+	return addr
+}
+
+func parseCountries(values []string) ([]string, error) {
+	countries := []string{}
+	for _, value := range values {
+		country := strings.ToUpper(strings.TrimSpace(value))
+		if country == "" {
+			continue
+		}
+		if !countryCode.MatchString(country) {
+			return nil, ErrInvalidCountry
+		}
+		if !contains(countries, country) {
+			countries = append(countries, country)
+		}
+	}
+	sort.Strings(countries)
+	return countries, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
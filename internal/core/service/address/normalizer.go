@@ -0,0 +1,73 @@
+package address
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPNormalizer normalizes addresses with a JSON API. The address is
+// POSTed to the URL as an Address and the API answers with
+// {"valid": true, "address": {...}}, valid being false for addresses it
+// knows do not exist.
+type HTTPNormalizer struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTPNormalizer creates a client of the normalization API at url, or
+// returns nil when url is empty. The API key, when set, is sent as a
+// bearer token.
+func NewHTTPNormalizer(url, apiKey string) *HTTPNormalizer {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return nil
+	}
+	return &HTTPNormalizer{url: url, apiKey: apiKey, client: &http.Client{Timeout: normalizeTimeout}}
+}
+
+// Normalize sends an address to the API
+func (n *HTTPNormalizer) Normalize(ctx context.Context, addr Address) (Address, bool, error) {
+	payload, err := json.Marshal(addr)
+	if err != nil {
+		return addr, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return addr, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+n.apiKey)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return addr, false, fmt.Errorf("address api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return addr, false, fmt.Errorf("address api: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Valid   bool     `json:"valid"`
+		Address *Address `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return addr, false, fmt.Errorf("address api: %w", err)
+	}
+	if !result.Valid {
+		return addr, false, nil
+	}
+	if result.Address == nil {
+		return addr, true, nil
+	}
+	return *result.Address, true, nil
+}
@@ -0,0 +1,407 @@
+// Package adminaccess restricts from where the admin area is reached. The
+// admin panel and admin API answer only requests from the site-wide
+// allow-list and, for a signed in admin, from their own trusted ranges.
+// While neither lists anything the admin area is reachable from anywhere.
+// An admin locked out, such as after their address changed, trusts their
+// new address with a one-time recovery token.
+package adminaccess
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidRange = errors.New("allowed addresses must be IP addresses or CIDR ranges such as 203.0.113.0/24")
+	ErrSelfLockout  = errors.New("the change would block the address you are connecting from")
+	ErrNotAdmin     = errors.New("only admins have trusted ranges")
+	ErrInvalidToken = errors.New("invalid or already used recovery token")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// cacheTTL is how long the allow-list is cached. Other instances sharing
+// the database notice a change within it.
+const cacheTTL = 5 * time.Second
+
+// blockedLogInterval is how often a blocked address is recorded in the
+// audit log, so a client retrying does not flood it
+const blockedLogInterval = time.Minute
+
+// Service reads and changes the admin area allow-lists
+type Service struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	allowed  []netip.Prefix
+	loadedAt time.Time
+	logged   map[string]time.Time // When a blocked address was last recorded
+}
+
+// NewService creates a new admin access service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, logged: make(map[string]time.Time)}
+}
+
+// AllowedIPs returns the site-wide allow-list. It is cached for a few
+// seconds as it is checked on every admin request; a failed read keeps
+// the last list.
+func (s *Service) AllowedIPs() []netip.Prefix {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < cacheTTL {
+		return s.allowed
+	}
+	allowed, err := s.load()
+	if err != nil {
+		log.Printf("failed to read admin allow-list: %v", err)
+	} else {
+		s.allowed = allowed
+	}
+	s.loadedAt = time.Now()
+	return s.allowed
+}
+
+// Allowed reports whether the admin area is reachable from an address.
+// Without a user only the site-wide allow-list counts; an admin is also
+// let through from their trusted ranges.
+func (s *Service) Allowed(ip string, user *domain.User) bool {
+	ranges := s.AllowedIPs()
+	if user != nil && user.IsAdmin() {
+		trusted, _ := ParseRanges(user.TrustedIPs)
+		ranges = append(append([]netip.Prefix{}, ranges...), trusted...)
+	}
+	return allows(ranges, ip)
+}
+
+// SetAllowedIPs replaces the site-wide allow-list, refusing a list that
+// would block the admin making the change
+func (s *Service) SetAllowedIPs(ranges []string, actor *domain.User, ip, userAgent string) ([]netip.Prefix, error) {
+	allowed, err := ParseRanges(strings.Join(ranges, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	trusted, _ := ParseRanges(actor.TrustedIPs)
+	if !allows(append(append([]netip.Prefix{}, allowed...), trusted...), ip) {
+		return nil, ErrSelfLockout
+	}
+	previous, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	setting := domain.Setting{Key: domain.SettingAdminAllowedIPs}
+	if err := s.db.Where("key = ?", setting.Key).
+		Assign(domain.Setting{Value: FormatRanges(allowed), Type: "text", Group: "security", Label: "Admin allowed IPs"}).
+		FirstOrCreate(&setting).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &actor.ID,
+		Action:      domain.AuditActionAdminAccessUpdated,
+		EntityType:  "setting",
+		OldValues:   domain.JSONMap{"allowed_ips": FormatRanges(previous)},
+		NewValues:   domain.JSONMap{"allowed_ips": FormatRanges(allowed)},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: "Admin allow-list changed",
+	})
+
+	s.mu.Lock()
+	s.allowed = allowed
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return allowed, nil
+}
+
+// SetTrustedIPs replaces the trusted ranges of an admin. Admins changing
+// their own are refused a list that would block them.
+func (s *Service) SetTrustedIPs(userID uint64, ranges []string, actor *domain.User, ip, userAgent string) (*domain.User, error) {
+	trusted, err := ParseRanges(strings.Join(ranges, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	var user domain.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !user.IsAdmin() {
+		return nil, ErrNotAdmin
+	}
+	if user.ID == actor.ID && !allows(append(append([]netip.Prefix{}, s.AllowedIPs()...), trusted...), ip) {
+		return nil, ErrSelfLockout
+	}
+
+	previous := user.TrustedIPs
+	user.TrustedIPs = FormatRanges(trusted)
+	if err := s.db.Model(&user).Update("trusted_ips", user.TrustedIPs).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &actor.ID,
+		Action:      domain.AuditActionAdminAccessUpdated,
+		EntityType:  "user",
+		EntityID:    &user.ID,
+		OldValues:   domain.JSONMap{"trusted_ips": previous},
+		NewValues:   domain.JSONMap{"trusted_ips": user.TrustedIPs},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: fmt.Sprintf("Trusted IPs of %s changed", user.Email),
+	})
+	return &user, nil
+}
+
+// RecordBlocked records a blocked request in the audit log, at most once
+// a minute for each address and user
+func (s *Service) RecordBlocked(ip, userAgent, path string, user *domain.User) {
+	entry := domain.AuditLog{
+		Action:      domain.AuditActionAdminAccessBlocked,
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		NewValues:   domain.JSONMap{"path": path},
+		Description: "Admin area request blocked from " + ip,
+	}
+	key := ip
+	if user != nil {
+		entry.UserID = &user.ID
+		key = fmt.Sprintf("%s/%d", ip, user.ID)
+	}
+	if s.throttled(key) {
+		return
+	}
+	s.audit(entry)
+}
+
+// CreateRecoveryToken creates the one-time token a locked out admin
+// trusts their address with, replacing any previous one. Only its hash is
+// stored, so the token is shown once.
+func (s *Service) CreateRecoveryToken(actorID *uint64, ip, userAgent string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	setting := domain.Setting{Key: domain.SettingAdminRecoveryToken}
+	if err := s.db.Where("key = ?", setting.Key).
+		Assign(domain.Setting{Value: hashToken(token), Type: "string", Group: "security", Label: "Admin recovery token", Protected: true}).
+		FirstOrCreate(&setting).Error; err != nil {
+		return "", err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      actorID,
+		Action:      domain.AuditActionAdminRecoveryCreated,
+		EntityType:  "setting",
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: "Admin recovery token created",
+	})
+	return token, nil
+}
+
+// RecoveryTokenSet reports whether a recovery token is waiting to be used
+func (s *Service) RecoveryTokenSet() (bool, error) {
+	var count int64
+	err := s.db.Model(&domain.Setting{}).
+		Where("key = ? AND value <> ''", domain.SettingAdminRecoveryToken).Count(&count).Error
+	return count > 0, err
+}
+
+// Recover uses the recovery token to add the address of an admin to
+// their trusted ranges. The token works once.
+func (s *Service) Recover(token string, user *domain.User, ip, userAgent string) (*domain.User, error) {
+	if !user.IsAdmin() {
+		return nil, ErrNotAdmin
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("client address %q: %w", ip, err)
+	}
+
+	var setting domain.Setting
+	err = s.db.Where("key = ?", domain.SettingAdminRecoveryToken).First(&setting).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	hash := hashToken(strings.TrimSpace(token))
+	if setting.Value == "" || subtle.ConstantTimeCompare([]byte(setting.Value), []byte(hash)) != 1 {
+		if !s.throttled("recover/" + ip) {
+			s.audit(domain.AuditLog{
+				UserID:      &user.ID,
+				Action:      domain.AuditActionAdminRecoveryFailed,
+				IPAddress:   ip,
+				UserAgent:   userAgent,
+				Description: "Invalid admin recovery token used from " + ip,
+			})
+		}
+		return nil, ErrInvalidToken
+	}
+
+	addr = addr.Unmap()
+	prefix := netip.PrefixFrom(addr, addr.BitLen())
+	trusted, _ := ParseRanges(user.TrustedIPs)
+	if !contains(trusted, addr) {
+		trusted = append(trusted, prefix)
+	}
+	updated := *user
+	updated.TrustedIPs = FormatRanges(trusted)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Consumed only if no one used it first
+		result := tx.Model(&domain.Setting{}).
+			Where("key = ? AND value = ?", domain.SettingAdminRecoveryToken, hash).
+			Update("value", "")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+		return tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("trusted_ips", updated.TrustedIPs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &user.ID,
+		Action:      domain.AuditActionAdminRecovered,
+		EntityType:  "user",
+		EntityID:    &user.ID,
+		NewValues:   domain.JSONMap{"trusted_ip": prefix.String()},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: "Recovery token used to trust " + prefix.String(),
+	})
+	return &updated, nil
+}
+
+// ListBlocked returns the recorded blocked requests, newest first
+func (s *Service) ListBlocked(limit, offset int) ([]domain.AuditLog, int64, error) {
+	query := s.db.Model(&domain.AuditLog{}).Where("action = ?", domain.AuditActionAdminAccessBlocked)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []domain.AuditLog
+	if err := query.Preload("User").Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ParseRanges parses IP addresses and CIDR ranges separated by lines,
+// commas or spaces. A single address becomes a range of just itself.
+func ParseRanges(text string) ([]netip.Prefix, error) {
+	var ranges []netip.Prefix
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	}) {
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidRange, field)
+			}
+			ranges = append(ranges, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRange, field)
+		}
+		addr = addr.Unmap()
+		ranges = append(ranges, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return ranges, nil
+}
+
+// FormatRanges formats ranges one per line, as they are stored
+func FormatRanges(ranges []netip.Prefix) string {
+	lines := make([]string, len(ranges))
+	for i, prefix := range ranges {
+		lines[i] = prefix.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *Service) load() ([]netip.Prefix, error) {
+	var setting domain.Setting
+	err := s.db.Where("key = ?", domain.SettingAdminAllowedIPs).Limit(1).Find(&setting).Error
+	if err != nil {
+		return nil, err
+	}
+	// Entries are validated when saved; any edited in by hand that do not
+	// parse are skipped rather than locking everyone out
+	var ranges []netip.Prefix
+	for _, line := range strings.Split(setting.Value, "\n") {
+		if parsed, err := ParseRanges(line); err == nil {
+			ranges = append(ranges, parsed...)
+		} else {
+			log.Printf("admin allow-list: %v", err)
+		}
+	}
+	return ranges, nil
+}
+
+// throttled reports whether an event was recorded within the last
+// interval, marking it recorded now otherwise
+func (s *Service) throttled(key string) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.logged[key]; ok && now.Sub(last) < blockedLogInterval {
+		return true
+	}
+	if len(s.logged) > 1000 {
+		for k, last := range s.logged {
+			if now.Sub(last) >= blockedLogInterval {
+				delete(s.logged, k)
+			}
+		}
+	}
+	s.logged[key] = now
+	return false
+}
+
+func (s *Service) audit(entry domain.AuditLog) {
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("failed to record %s in the audit log: %v", entry.Action, err)
+	}
+}
+
+// allows reports whether an address is in any of the ranges. No ranges
+// allow every address.
+func allows(ranges []netip.Prefix, ip string) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && contains(ranges, addr.Unmap())
+}
+
+func contains(ranges []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range ranges {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,322 @@
+package adminlist
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+)
+
+// MaxLimit caps the rows returned for one page
+const MaxLimit = 100
+
+// Service pages through the admin lists in the database, so lists never
+// load a whole table
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new admin list service. Lists are read from a
+// replica when read replicas are configured.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db.Clauses(dbresolver.Read).Session(&gorm.Session{})}
+}
+
+// list describes the columns of an admin list. Only the columns named here
+// can be sorted and searched. Lists with a field entity also search the
+// custom field values of their rows.
+type list struct {
+	table       string
+	sortColumns map[string]string
+	search      []string
+	defaultSort string
+	fieldEntity string
+}
+
+var customerList = list{
+	table: "users",
+	sortColumns: map[string]string{
+		"id":         "users.id",
+		"name":       "users.first_name",
+		"email":      "users.email",
+		"company":    "users.company",
+		"status":     "users.status",
+		"health":     "customer_healths.score",
+		"created_at": "users.created_at",
+	},
+	search:      []string{"users.email", "users.first_name", "users.last_name", "users.company"},
+	defaultSort: "created_at",
+}
+
+var orderList = list{
+	table: "orders",
+	sortColumns: map[string]string{
+		"id":           "orders.id",
+		"order_number": "orders.order_number",
+		"customer":     "users.email",
+		"total":        "orders.total",
+		"status":       "orders.status",
+		"created_at":   "orders.created_at",
+	},
+	search:      []string{"orders.order_number", "users.email", "users.first_name", "users.last_name"},
+	defaultSort: "created_at",
+	fieldEntity: domain.CustomFieldEntityOrder,
+}
+
+var invoiceList = list{
+	table: "invoices",
+	sortColumns: map[string]string{
+		"id":             "invoices.id",
+		"invoice_number": "invoices.invoice_number",
+		"customer":       "users.email",
+		"total":          "invoices.total",
+		"balance":        "invoices.balance",
+		"status":         "invoices.status",
+		"due_date":       "invoices.due_date",
+		"created_at":     "invoices.created_at",
+	},
+	search:      []string{"invoices.invoice_number", "users.email", "users.first_name", "users.last_name"},
+	defaultSort: "created_at",
+	fieldEntity: domain.CustomFieldEntityInvoice,
+}
+
+var ticketList = list{
+	table: "tickets",
+	sortColumns: map[string]string{
+		"id":         "tickets.id",
+		"subject":    "tickets.subject",
+		"customer":   "users.email",
+		"status":     "tickets.status",
+		"priority":   "tickets.priority",
+		"created_at": "tickets.created_at",
+		"updated_at": "tickets.updated_at",
+	},
+	search:      []string{"tickets.subject", "users.email", "users.first_name", "users.last_name"},
+	defaultSort: "updated_at",
+}
+
+var taskList = list{
+	table: "admin_tasks",
+	sortColumns: map[string]string{
+		"id":         "admin_tasks.id",
+		"title":      "admin_tasks.title",
+		"status":     "admin_tasks.status",
+		"due_at":     "admin_tasks.due_at",
+		"created_at": "admin_tasks.created_at",
+	},
+	search:      []string{"admin_tasks.title", "admin_tasks.description"},
+	defaultSort: "created_at",
+}
+
+// Customers returns a page of customer accounts with their health
+// scores. Customers never scored have none.
+func (s *Service) Customers(q Query) ([]CustomerRow, Counts, error) {
+	base := s.db.Model(&domain.User{}).
+		Joins("LEFT JOIN customer_healths ON customer_healths.customer_id = users.id").
+		Where("users.role = ?", domain.UserRoleCustomer)
+	if q.Risk != "" {
+		base = base.Where("customer_healths.risk = ?", q.Risk)
+	}
+
+	var users []domain.User
+	counts, err := s.page(customerList, base, q, &users)
+	if err != nil {
+		return nil, counts, err
+	}
+
+	ids := make([]uint64, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	healths := make(map[uint64]domain.CustomerHealth, len(ids))
+	if len(ids) > 0 {
+		var list []domain.CustomerHealth
+		if err := s.db.Where("customer_id IN ?", ids).Find(&list).Error; err != nil {
+			return nil, counts, err
+		}
+		for _, health := range list {
+			healths[health.CustomerID] = health
+		}
+	}
+
+	rows := make([]CustomerRow, 0, len(users))
+	for _, user := range users {
+		row := CustomerRow{User: user}
+		if health, ok := healths[user.ID]; ok {
+			row.Health = &health
+		}
+		rows = append(rows, row)
+	}
+	return rows, counts, nil
+}
+
+// Orders returns a page of orders with their customers
+func (s *Service) Orders(q Query) ([]domain.Order, Counts, error) {
+	base := s.db.Model(&domain.Order{}).Joins("LEFT JOIN users ON users.id = orders.customer_id")
+	base = customfield.MatchValues(s.db, base, domain.CustomFieldEntityOrder, "orders", q.Fields)
+
+	var orders []domain.Order
+	counts, err := s.page(orderList, base.Preload("Customer"), q, &orders)
+	return orders, counts, err
+}
+
+// Invoices returns a page of invoices with their customers
+func (s *Service) Invoices(q Query) ([]domain.Invoice, Counts, error) {
+	base := s.db.Model(&domain.Invoice{}).Joins("LEFT JOIN users ON users.id = invoices.customer_id")
+	base = customfield.MatchValues(s.db, base, domain.CustomFieldEntityInvoice, "invoices", q.Fields)
+
+	var invoices []domain.Invoice
+	counts, err := s.page(invoiceList, base.Preload("Customer"), q, &invoices)
+	return invoices, counts, err
+}
+
+// Tickets returns a page of tickets. Customer holds the ticket owner of
+// each ticket, guest tickets have none.
+func (s *Service) Tickets(q Query) ([]TicketRow, Counts, error) {
+	base := s.db.Model(&domain.Ticket{}).Joins("LEFT JOIN users ON users.id = tickets.customer_id")
+
+	var tickets []domain.Ticket
+	counts, err := s.page(ticketList, base, q, &tickets)
+	if err != nil {
+		return nil, counts, err
+	}
+
+	customerIDs := make([]uint64, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.CustomerID != nil {
+			customerIDs = append(customerIDs, *ticket.CustomerID)
+		}
+	}
+	customers := make(map[uint64]domain.User, len(customerIDs))
+	if len(customerIDs) > 0 {
+		var users []domain.User
+		if err := s.db.Where("id IN ?", customerIDs).Find(&users).Error; err != nil {
+			return nil, counts, err
+		}
+		for _, user := range users {
+			customers[user.ID] = user
+		}
+	}
+
+	rows := make([]TicketRow, 0, len(tickets))
+	for _, ticket := range tickets {
+		row := TicketRow{Ticket: ticket}
+		if ticket.CustomerID != nil {
+			if customer, ok := customers[*ticket.CustomerID]; ok {
+				row.Customer = &customer
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, counts, nil
+}
+
+// Tasks returns a page of admin tasks with their assignees
+func (s *Service) Tasks(q Query) ([]domain.AdminTask, Counts, error) {
+	base := s.db.Model(&domain.AdminTask{}).Preload("Assignee")
+	if q.AssigneeID != nil {
+		base = base.Where("admin_tasks.assignee_id = ?", *q.AssigneeID)
+	}
+
+	var tasks []domain.AdminTask
+	counts, err := s.page(taskList, base, q, &tasks)
+	return tasks, counts, err
+}
+
+// page counts the rows of a list before and after filtering and loads the
+// requested page into dest
+func (s *Service) page(l list, base *gorm.DB, q Query, dest interface{}) (Counts, error) {
+	var counts Counts
+
+	filtered := base
+	if q.Status != "" {
+		filtered = filtered.Where(l.table+".status = ?", q.Status)
+	}
+	if err := filtered.Session(&gorm.Session{}).Count(&counts.Total).Error; err != nil {
+		return counts, err
+	}
+
+	if search := strings.ToLower(strings.TrimSpace(q.Search)); search != "" {
+		pattern := "%" + search + "%"
+		conditions := make([]string, 0, len(l.search))
+		args := make([]interface{}, 0, len(l.search))
+		for _, column := range l.search {
+			conditions = append(conditions, "LOWER("+column+") LIKE ?")
+			args = append(args, pattern)
+		}
+		if l.fieldEntity != "" {
+			conditions = append(conditions, l.table+".id IN (?)")
+			args = append(args, s.db.Model(&domain.CustomFieldValue{}).Select("entity_id").
+				Where("entity_type = ? AND LOWER(value) LIKE ?", l.fieldEntity, pattern))
+		}
+		filtered = filtered.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	if err := filtered.Session(&gorm.Session{}).Count(&counts.Filtered).Error; err != nil {
+		return counts, err
+	}
+
+	// Lists without a known sort column show the latest rows first
+	column, ok := l.sortColumns[q.Sort]
+	desc := q.Desc
+	if !ok {
+		column = l.sortColumns[l.defaultSort]
+		desc = true
+	}
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	err := filtered.Select(l.table + ".*").
+		Order(column + direction).Order(l.table + ".id" + direction).
+		Limit(limit).Offset(offset).Find(dest).Error
+	return counts, err
+}
+
+// Query selects a page of an admin list
+type Query struct {
+	Search string
+	Status string
+	Risk   domain.HealthRisk // Health risk of customers, only for the customer list
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+
+	AssigneeID *uint64 // Assignee of tasks, only for the task list
+
+	// Texts the custom field values of orders or invoices must contain,
+	// by field name
+	Fields map[string]string
+}
+
+// Counts are the number of rows of a list, before and after the search
+// is applied
+type Counts struct {
+	Total    int64
+	Filtered int64
+}
+
+// CustomerRow is a customer in the admin customer list
+type CustomerRow struct {
+	User   domain.User
+	Health *domain.CustomerHealth
+}
+
+// TicketRow is a ticket in the admin ticket list
+type TicketRow struct {
+	Ticket   domain.Ticket
+	Customer *domain.User
+}
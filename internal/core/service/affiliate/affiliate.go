@@ -24,12 +24,14 @@ var (
 
 // Service provides affiliate management operations
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	cookieDays int
+	baseURL    string
 }
 
 // NewService creates a new affiliate service
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, cookieDays: DefaultCookieDays}
 }
 
 // ApplyForAffiliate creates an affiliate application for a customer
@@ -428,7 +430,7 @@ func (s *Service) UpdateAffiliateSettings(affiliateID uint64, commissionRate, mi
 // GetBanners retrieves active affiliate banners
 func (s *Service) GetBanners() ([]domain.AffiliateBanner, error) {
 	var banners []domain.AffiliateBanner
-	if err := s.db.Where("active = ?", true).Order("sort_order ASC").Find(&banners).Error; err != nil {
+	if err := s.db.Preload("Product").Where("active = ?", true).Order("sort_order ASC").Find(&banners).Error; err != nil {
 		return nil, err
 	}
 	return banners, nil
@@ -0,0 +1,263 @@
+package affiliate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrReferralNotFound = errors.New("referral not found")
+	ErrReferralExpired  = errors.New("referral has expired")
+)
+
+const (
+	// DefaultCookieDays is how long a referral is credited to its affiliate
+	// when the cookie duration is not configured
+	DefaultCookieDays = 30
+	// ReferralCookie holds the token of the referral a visitor came through
+	ReferralCookie = "openhost_ref"
+)
+
+// UTM are the UTM parameters of an affiliate link
+type UTM struct {
+	Source   string
+	Medium   string
+	Campaign string
+	Term     string
+	Content  string
+}
+
+// Visit is a visit through an affiliate link
+type Visit struct {
+	IPAddress   string
+	UserAgent   string
+	ReferrerURL string
+	LandingPage string
+	BannerID    *uint64
+	UTM         UTM
+}
+
+// Funnel follows the clicks on the links of an affiliate to the signups
+// and first orders they brought
+type Funnel struct {
+	Clicks       int64
+	Signups      int64
+	Orders       int64
+	Sources      []FunnelRow // By UTM source and campaign
+	LandingPages []FunnelRow
+}
+
+// FunnelRow is the funnel of the clicks with the same source, campaign or
+// landing page
+type FunnelRow struct {
+	UTMSource   string
+	UTMCampaign string
+	LandingPage string
+	Clicks      int64
+	Signups     int64
+	Orders      int64
+}
+
+// SignupRate returns the share of clicks that signed up
+func (f Funnel) SignupRate() float64 {
+	return rate(f.Signups, f.Clicks)
+}
+
+// OrderRate returns the share of clicks that ordered
+func (f Funnel) OrderRate() float64 {
+	return rate(f.Orders, f.Clicks)
+}
+
+// SetCookieDays sets how long a referral is credited to its affiliate. Zero
+// keeps the default of 30 days.
+func (s *Service) SetCookieDays(days int) {
+	if days > 0 {
+		s.cookieDays = days
+	}
+}
+
+// CookieDays returns how long a referral is credited to its affiliate
+func (s *Service) CookieDays() int {
+	return s.cookieDays
+}
+
+// TrackVisit records a click on the link of an affiliate, and on the banner
+// it came from if any, and the referral it starts. The token of the
+// referral goes in the attribution cookie.
+func (s *Service) TrackVisit(code string, visit Visit) (*domain.AffiliateReferral, error) {
+	affiliate, err := s.GetAffiliateByCode(code)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newReferralToken()
+	if err != nil {
+		return nil, err
+	}
+
+	referral := &domain.AffiliateReferral{
+		AffiliateID: affiliate.ID,
+		IPAddress:   visit.IPAddress,
+		UserAgent:   truncate(visit.UserAgent, 512),
+		ReferrerURL: truncate(visit.ReferrerURL, 500),
+		LandingPage: truncate(visit.LandingPage, 500),
+		Token:       token,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		bannerID := visit.BannerID
+		if bannerID != nil {
+			found, err := countBannerClick(tx, *bannerID)
+			if err != nil {
+				return err
+			}
+			if !found {
+				bannerID = nil
+			}
+		}
+
+		click := &domain.AffiliateClick{
+			AffiliateID: affiliate.ID,
+			BannerID:    bannerID,
+			IPAddress:   visit.IPAddress,
+			UserAgent:   referral.UserAgent,
+			ReferrerURL: referral.ReferrerURL,
+			LandingPage: referral.LandingPage,
+			UTMSource:   truncate(visit.UTM.Source, 100),
+			UTMMedium:   truncate(visit.UTM.Medium, 100),
+			UTMCampaign: truncate(visit.UTM.Campaign, 100),
+			UTMTerm:     truncate(visit.UTM.Term, 100),
+			UTMContent:  truncate(visit.UTM.Content, 100),
+		}
+		if err := tx.Create(click).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.Affiliate{}).Where("id = ?", affiliate.ID).
+			Update("clicks", gorm.Expr("clicks + 1")).Error; err != nil {
+			return err
+		}
+		referral.ClickID = &click.ID
+		return tx.Create(referral).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	referral.Affiliate = *affiliate
+	return referral, nil
+}
+
+// AttributeSignup credits a new customer to the affiliate whose link they
+// came through, if they did so within the cookie duration. Affiliates are
+// not credited for signing themselves up.
+func (s *Service) AttributeSignup(token string, customerID uint64, now time.Time) error {
+	if token == "" {
+		return ErrReferralNotFound
+	}
+	var referral domain.AffiliateReferral
+	if err := s.db.Preload("Affiliate").Where("token = ?", token).First(&referral).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReferralNotFound
+		}
+		return err
+	}
+	if referral.CustomerID != nil || referral.Affiliate.CustomerID == customerID {
+		return nil
+	}
+	if now.Sub(referral.CreatedAt) > time.Duration(s.cookieDays)*24*time.Hour {
+		return ErrReferralExpired
+	}
+	return s.ConvertReferral(referral.ID, customerID)
+}
+
+// AttributeOrder marks the referral of a customer converted by their first
+// order and records the commission of its affiliate on the order. Orders
+// of customers no affiliate referred are ignored.
+func (s *Service) AttributeOrder(order *domain.Order, now time.Time) error {
+	var referral domain.AffiliateReferral
+	result := s.db.Preload("Affiliate").
+		Where("customer_id = ? AND converted_at IS NULL", order.CustomerID).
+		Order("signed_up_at ASC").Limit(1).Find(&referral)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 || !referral.Affiliate.IsActive() {
+		return nil
+	}
+
+	if err := s.db.Model(&referral).Updates(map[string]interface{}{
+		"converted_at": now,
+		"order_id":     order.ID,
+	}).Error; err != nil {
+		return err
+	}
+	if !order.Total.IsPositive() {
+		return nil
+	}
+	_, err := s.RecordCommission(referral.AffiliateID, &referral.ID, nil, &order.ID, "purchase",
+		order.Total, referral.Affiliate.CommissionRate, order.Currency,
+		fmt.Sprintf("Order %s", order.OrderNumber))
+	return err
+}
+
+// GetFunnel returns the funnel of the clicks on the links of an affiliate
+// between two times: how many signed up and how many of those ordered
+func (s *Service) GetFunnel(affiliateID uint64, from, to time.Time) (*Funnel, error) {
+	var total []FunnelRow
+	if err := s.funnelQuery(affiliateID, from, to, "").Scan(&total).Error; err != nil {
+		return nil, err
+	}
+	funnel := &Funnel{}
+	if len(total) > 0 {
+		funnel.Clicks, funnel.Signups, funnel.Orders = total[0].Clicks, total[0].Signups, total[0].Orders
+	}
+
+	if err := s.funnelQuery(affiliateID, from, to, "c.utm_source AS utm_source, c.utm_campaign AS utm_campaign").
+		Group("c.utm_source, c.utm_campaign").Order("clicks DESC").
+		Scan(&funnel.Sources).Error; err != nil {
+		return nil, err
+	}
+	if err := s.funnelQuery(affiliateID, from, to, "c.landing_page AS landing_page").
+		Group("c.landing_page").Order("clicks DESC").
+		Scan(&funnel.LandingPages).Error; err != nil {
+		return nil, err
+	}
+	return funnel, nil
+}
+
+func (s *Service) funnelQuery(affiliateID uint64, from, to time.Time, columns string) *gorm.DB {
+	counts := "COUNT(c.id) AS clicks, COUNT(r.signed_up_at) AS signups, COUNT(r.converted_at) AS orders"
+	if columns != "" {
+		counts = columns + ", " + counts
+	}
+	return s.db.Table("affiliate_clicks AS c").
+		Select(counts).
+		Joins("LEFT JOIN affiliate_referrals AS r ON r.click_id = c.id").
+		Where("c.affiliate_id = ? AND c.created_at BETWEEN ? AND ?", affiliateID, from, to)
+}
+
+func newReferralToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func rate(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
@@ -0,0 +1,215 @@
+package affiliate
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrBannerNotFound  = errors.New("banner not found")
+	ErrBannerName      = errors.New("banner name is required")
+	ErrBannerCreative  = errors.New("banner needs an image or HTML code")
+	ErrBannerTargetURL = errors.New("banner target must be a path on this site, such as /products")
+	ErrBannerProduct   = errors.New("banner product not found")
+)
+
+// BannerInput are the fields of a banner staff can set
+type BannerInput struct {
+	Name      string
+	ImageURL  string
+	Width     int
+	Height    int
+	TargetURL string
+	ProductID *uint64
+	HTMLCode  string
+	Active    bool
+	SortOrder int
+}
+
+// SetBaseURL sets the address of the site, which banner links point to
+func (s *Service) SetBaseURL(baseURL string) {
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// ListBanners returns every banner, active or not, in display order
+func (s *Service) ListBanners() ([]domain.AffiliateBanner, error) {
+	var banners []domain.AffiliateBanner
+	err := s.db.Order("sort_order ASC, id ASC").Find(&banners).Error
+	return banners, err
+}
+
+// CreateBanner adds a banner
+func (s *Service) CreateBanner(input BannerInput) (*domain.AffiliateBanner, error) {
+	banner := &domain.AffiliateBanner{}
+	if err := applyBannerInput(banner, input); err != nil {
+		return nil, err
+	}
+	if err := s.checkBannerProduct(input.ProductID); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(banner).Error; err != nil {
+		return nil, err
+	}
+	return banner, nil
+}
+
+// UpdateBanner replaces the fields of a banner. Its counters are kept.
+func (s *Service) UpdateBanner(id uint64, input BannerInput) (*domain.AffiliateBanner, error) {
+	banner, err := s.getBanner(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyBannerInput(banner, input); err != nil {
+		return nil, err
+	}
+	if err := s.checkBannerProduct(input.ProductID); err != nil {
+		return nil, err
+	}
+	if err := s.db.Select("name", "image_url", "width", "height", "target_url", "product_id",
+		"html_code", "active", "sort_order").Save(banner).Error; err != nil {
+		return nil, err
+	}
+	return banner, nil
+}
+
+// DeleteBanner removes a banner. Clicks it brought keep their record.
+func (s *Service) DeleteBanner(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&domain.AffiliateBanner{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBannerNotFound
+		}
+		return tx.Model(&domain.AffiliateClick{}).Where("banner_id = ?", id).
+			Update("banner_id", nil).Error
+	})
+}
+
+// ServeBanner returns the HTML of an active banner for an affiliate and
+// counts an impression
+func (s *Service) ServeBanner(id uint64, code string) (string, error) {
+	affiliate, err := s.GetAffiliateByCode(code)
+	if err != nil {
+		return "", err
+	}
+	var banner domain.AffiliateBanner
+	if err := s.db.Preload("Product").Where("id = ? AND active = ?", id, true).First(&banner).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrBannerNotFound
+		}
+		return "", err
+	}
+	if err := s.db.Model(&banner).Update("impressions", gorm.Expr("impressions + 1")).Error; err != nil {
+		return "", err
+	}
+	return s.BannerHTML(&banner, affiliate), nil
+}
+
+// BannerLink returns the link of a banner for an affiliate. It goes
+// through the referral link of the affiliate, which counts the click.
+func (s *Service) BannerLink(banner *domain.AffiliateBanner, affiliate *domain.Affiliate) string {
+	target := banner.TargetURL
+	if banner.Product != nil {
+		target = "/order/configure/" + banner.Product.Slug
+	}
+	query := url.Values{"banner": {fmt.Sprint(banner.ID)}}
+	if target != "" {
+		query.Set("to", target)
+	}
+	return s.baseURL + "/ref/" + url.PathEscape(affiliate.ReferralCode) + "?" + query.Encode()
+}
+
+// BannerEmbedURL returns the address serving a banner for an affiliate,
+// for embedding in an iframe
+func (s *Service) BannerEmbedURL(banner *domain.AffiliateBanner, affiliate *domain.Affiliate) string {
+	return fmt.Sprintf("%s/banners/%d/%s", s.baseURL, banner.ID, url.PathEscape(affiliate.ReferralCode))
+}
+
+// BannerHTML returns the HTML affiliates embed for a banner. The HTML code
+// of the banner may use {code}, {link}, {image}, {width} and {height};
+// banners without one are an image linking to the target.
+func (s *Service) BannerHTML(banner *domain.AffiliateBanner, affiliate *domain.Affiliate) string {
+	code := banner.HTMLCode
+	if code == "" {
+		code = `<a href="{link}"><img src="{image}" width="{width}" height="{height}" alt="` +
+			html.EscapeString(banner.Name) + `"></a>`
+	}
+	return strings.NewReplacer(
+		"{code}", html.EscapeString(affiliate.ReferralCode),
+		"{link}", html.EscapeString(s.BannerLink(banner, affiliate)),
+		"{image}", html.EscapeString(banner.ImageURL),
+		"{width}", fmt.Sprint(banner.Width),
+		"{height}", fmt.Sprint(banner.Height),
+	).Replace(code)
+}
+
+// countBannerClick counts a click on a banner and reports whether the
+// banner exists
+func countBannerClick(tx *gorm.DB, bannerID uint64) (bool, error) {
+	result := tx.Model(&domain.AffiliateBanner{}).Where("id = ?", bannerID).
+		Update("clicks", gorm.Expr("clicks + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *Service) getBanner(id uint64) (*domain.AffiliateBanner, error) {
+	var banner domain.AffiliateBanner
+	if err := s.db.First(&banner, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBannerNotFound
+		}
+		return nil, err
+	}
+	return &banner, nil
+}
+
+func (s *Service) checkBannerProduct(productID *uint64) error {
+	if productID == nil {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&domain.Product{}).Where("id = ?", *productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBannerProduct
+	}
+	return nil
+}
+
+func applyBannerInput(banner *domain.AffiliateBanner, input BannerInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return ErrBannerName
+	}
+	if input.ImageURL == "" && strings.TrimSpace(input.HTMLCode) == "" {
+		return ErrBannerCreative
+	}
+	if input.TargetURL != "" && !isLocalPath(input.TargetURL) {
+		return ErrBannerTargetURL
+	}
+
+	banner.Name = input.Name
+	banner.ImageURL = input.ImageURL
+	banner.Width = input.Width
+	banner.Height = input.Height
+	banner.TargetURL = input.TargetURL
+	banner.ProductID = input.ProductID
+	banner.HTMLCode = input.HTMLCode
+	banner.Active = input.Active
+	banner.SortOrder = input.SortOrder
+	return nil
+}
+
+// isLocalPath reports whether a path stays on this site
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
@@ -0,0 +1,745 @@
+// Package agent manages the nodes running the node agent and the tasks
+// queued for them.
+//
+// A node is created by an admin, which yields a one-time enrollment
+// token. The agent trades it for a node token when it registers, then
+// sends a heartbeat with the capacity and health of its machine and
+// receives the tasks queued for the node. Tasks are signed with the
+// panel's Ed25519 key, whose public half the agent is given when it
+// registers, so an agent runs only tasks the panel issued.
+package agent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrNodeNotFound    = errors.New("node not found")
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrInvalidToken    = errors.New("invalid or expired token")
+	ErrNodeDisabled    = errors.New("node is disabled")
+	ErrInvalidAction   = errors.New("action must be lower case letters, digits and underscores, starting with a letter")
+	ErrInvalidTimeout  = errors.New("timeout must be between 1 second and 24 hours")
+	ErrTaskFinished    = errors.New("task has already finished")
+	ErrServerNotFound  = errors.New("server not found")
+	ErrNameRequired    = errors.New("name is required")
+	ErrInvalidNodeInfo = errors.New("invalid node information")
+)
+
+const (
+	// HeartbeatInterval is how often agents report in
+	HeartbeatInterval = 30 * time.Second
+	// offlineAfter is how long a node may go without a heartbeat before
+	// it counts as offline
+	offlineAfter = 3 * HeartbeatInterval
+
+	// EnrollmentTTL is how long an enrollment token can be used
+	EnrollmentTTL = 24 * time.Hour
+
+	DefaultTaskTimeout = 10 * time.Minute
+	MaxTaskTimeout     = 24 * time.Hour
+	// DefaultTaskTTL is how long a task waits for its node before it
+	// expires
+	DefaultTaskTTL = time.Hour
+	// startGrace is how long a running task may outlive its timeout before
+	// it is failed as lost, covering the agent's own clean-up
+	startGrace = time.Minute
+
+	// maxLogLine is the longest log line kept
+	maxLogLine = 4096
+)
+
+var actionPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Service manages agent nodes and their tasks
+type Service struct {
+	db *gorm.DB
+
+	mu         sync.Mutex
+	signingKey ed25519.PrivateKey
+}
+
+// NewService creates a new agent service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// NodeInfo describes the machine an agent runs on
+type NodeInfo struct {
+	Hostname    string
+	Version     string
+	OS          string
+	Arch        string
+	CPUCores    int
+	MemoryBytes int64
+	DiskBytes   int64
+}
+
+// Health is the usage an agent reports with each heartbeat
+type Health struct {
+	Load1           float64
+	MemoryUsedBytes int64
+	DiskUsedBytes   int64
+	UptimeSeconds   int64
+}
+
+// NodeUpdate changes a node. Nil fields are left as they are.
+type NodeUpdate struct {
+	Name     *string
+	ServerID *uint64 // 0 unlinks the node
+	Disabled *bool
+}
+
+// TaskRequest is a task to queue for a node
+type TaskRequest struct {
+	Action    string
+	Args      domain.JSONMap
+	ServiceID *uint64
+	Timeout   time.Duration // How long the agent lets it run, DefaultTaskTimeout when 0
+	TTL       time.Duration // How long it waits for the node, DefaultTaskTTL when 0
+	CreatedBy *uint64
+}
+
+// LogLine is a line a task wrote
+type LogLine struct {
+	Stream string
+	Text   string
+	Time   time.Time
+}
+
+// --- Nodes ---
+
+// CreateNode adds a node and returns it with its enrollment token, which
+// is shown once
+func (s *Service) CreateNode(name string, serverID *uint64) (*domain.AgentNode, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrNameRequired
+	}
+	if serverID != nil {
+		if err := s.checkServer(*serverID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	expires := time.Now().Add(EnrollmentTTL)
+	node := &domain.AgentNode{
+		Name:                name,
+		ServerID:            serverID,
+		Status:              domain.AgentNodeStatusPending,
+		EnrollmentHash:      hashToken(token),
+		EnrollmentExpiresAt: &expires,
+	}
+	if err := s.db.Create(node).Error; err != nil {
+		return nil, "", err
+	}
+	return node, token, nil
+}
+
+// Enroll issues a new enrollment token for a node, such as when its agent
+// is reinstalled. The node token of the current agent stops working.
+func (s *Service) Enroll(id uint64) (*domain.AgentNode, string, error) {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	expires := time.Now().Add(EnrollmentTTL)
+	updates := map[string]any{
+		"enrollment_hash":       hashToken(token),
+		"enrollment_expires_at": &expires,
+		"token_hash":            "",
+	}
+	if node.Status != domain.AgentNodeStatusDisabled {
+		updates["status"] = domain.AgentNodeStatusPending
+	}
+	if err := s.db.Model(node).Updates(updates).Error; err != nil {
+		return nil, "", err
+	}
+	return node, token, nil
+}
+
+// Register trades an enrollment token for a node token, which the agent
+// authenticates with from then on
+func (s *Service) Register(enrollmentToken string, info NodeInfo) (*domain.AgentNode, string, error) {
+	if enrollmentToken == "" {
+		return nil, "", ErrInvalidToken
+	}
+	if err := info.validate(); err != nil {
+		return nil, "", err
+	}
+
+	var node domain.AgentNode
+	if err := s.db.Where("enrollment_hash = ?", hashToken(enrollmentToken)).First(&node).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrInvalidToken
+		}
+		return nil, "", err
+	}
+	if node.EnrollmentExpiresAt == nil || time.Now().After(*node.EnrollmentExpiresAt) {
+		return nil, "", ErrInvalidToken
+	}
+	if node.Status == domain.AgentNodeStatusDisabled {
+		return nil, "", ErrNodeDisabled
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	updates := info.updates()
+	updates["status"] = domain.AgentNodeStatusActive
+	updates["token_hash"] = hashToken(token)
+	updates["enrollment_hash"] = ""
+	updates["enrollment_expires_at"] = nil
+	updates["registered_at"] = &now
+	updates["last_seen_at"] = &now
+	// The enrollment hash is matched again so a token raced by two agents
+	// registers only one of them
+	result := s.db.Model(&domain.AgentNode{}).
+		Where("id = ? AND enrollment_hash = ?", node.ID, node.EnrollmentHash).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", ErrInvalidToken
+	}
+	registered, err := s.GetNode(node.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return registered, token, nil
+}
+
+// Authenticate returns the active node a node token belongs to
+func (s *Service) Authenticate(token string) (*domain.AgentNode, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	var node domain.AgentNode
+	if err := s.db.Where("token_hash = ?", hashToken(token)).First(&node).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if node.Status == domain.AgentNodeStatusDisabled {
+		return nil, ErrNodeDisabled
+	}
+	return &node, nil
+}
+
+// Heartbeat records the capacity and health a node reports. A server
+// linked to the node gets its memory and disk figures, in GB, and is
+// marked active again if it was offline.
+func (s *Service) Heartbeat(node *domain.AgentNode, info NodeInfo, health Health) error {
+	if err := info.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	updates := info.updates()
+	updates["load1"] = health.Load1
+	updates["memory_used_bytes"] = max(health.MemoryUsedBytes, 0)
+	updates["disk_used_bytes"] = max(health.DiskUsedBytes, 0)
+	updates["uptime_seconds"] = max(health.UptimeSeconds, 0)
+	updates["last_seen_at"] = &now
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.AgentNode{}).Where("id = ?", node.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if node.ServerID == nil {
+			return nil
+		}
+		serverUpdates := map[string]any{
+			"memory":          gigabytes(info.MemoryBytes),
+			"used_memory":     gigabytes(health.MemoryUsedBytes),
+			"disk_space":      gigabytes(info.DiskBytes),
+			"used_disk_space": gigabytes(health.DiskUsedBytes),
+			"last_check":      &now,
+		}
+		if err := tx.Model(&domain.Server{}).Where("id = ?", *node.ServerID).Updates(serverUpdates).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Server{}).
+			Where("id = ? AND status = ?", *node.ServerID, domain.ServerStatusOffline).
+			Update("status", domain.ServerStatusActive).Error
+	})
+}
+
+// MarkOffline marks the active servers of nodes that stopped sending
+// heartbeats offline and returns how many it marked
+func (s *Service) MarkOffline() (int64, error) {
+	stale := s.db.Model(&domain.AgentNode{}).Select("server_id").
+		Where("server_id IS NOT NULL AND status = ? AND last_seen_at < ?",
+			domain.AgentNodeStatusActive, time.Now().Add(-offlineAfter))
+	result := s.db.Model(&domain.Server{}).
+		Where("id IN (?) AND status = ?", stale, domain.ServerStatusActive).
+		Update("status", domain.ServerStatusOffline)
+	return result.RowsAffected, result.Error
+}
+
+// Online reports whether a node sent a heartbeat recently
+func (s *Service) Online(node *domain.AgentNode) bool {
+	return node.Status == domain.AgentNodeStatusActive && node.LastSeenAt != nil &&
+		time.Since(*node.LastSeenAt) < offlineAfter
+}
+
+// ListNodes returns the nodes, by name
+func (s *Service) ListNodes(limit, offset int) ([]domain.AgentNode, int64, error) {
+	var total int64
+	if err := s.db.Model(&domain.AgentNode{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var nodes []domain.AgentNode
+	err := s.db.Preload("Server").Order("name, id").Limit(limit).Offset(offset).Find(&nodes).Error
+	return nodes, total, err
+}
+
+// GetNode returns a node
+func (s *Service) GetNode(id uint64) (*domain.AgentNode, error) {
+	var node domain.AgentNode
+	if err := s.db.Preload("Server").First(&node, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		return nil, err
+	}
+	return &node, nil
+}
+
+// UpdateNode renames, links or disables a node. A disabled node keeps its
+// tokens, but its agent is refused until it is enabled again.
+func (s *Service) UpdateNode(id uint64, update NodeUpdate) (*domain.AgentNode, error) {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{}
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, ErrNameRequired
+		}
+		updates["name"] = name
+	}
+	if update.ServerID != nil {
+		if *update.ServerID == 0 {
+			updates["server_id"] = nil
+		} else {
+			if err := s.checkServer(*update.ServerID); err != nil {
+				return nil, err
+			}
+			updates["server_id"] = *update.ServerID
+		}
+	}
+	if update.Disabled != nil {
+		switch {
+		case *update.Disabled:
+			updates["status"] = domain.AgentNodeStatusDisabled
+		case node.Status == domain.AgentNodeStatusDisabled && node.TokenHash != "":
+			updates["status"] = domain.AgentNodeStatusActive
+		case node.Status == domain.AgentNodeStatusDisabled:
+			updates["status"] = domain.AgentNodeStatusPending
+		}
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(node).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return s.GetNode(id)
+}
+
+// DeleteNode removes a node with its tasks and their logs
+func (s *Service) DeleteNode(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&domain.AgentNode{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNodeNotFound
+		}
+		tasks := tx.Model(&domain.AgentTask{}).Select("id").Where("node_id = ?", id)
+		if err := tx.Where("task_id IN (?)", tasks).Delete(&domain.AgentTaskLog{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("node_id = ?", id).Delete(&domain.AgentTask{}).Error
+	})
+}
+
+// NodeForServer returns the node linked to a server
+func (s *Service) NodeForServer(serverID uint64) (*domain.AgentNode, error) {
+	var node domain.AgentNode
+	if err := s.db.Where("server_id = ?", serverID).Order("id").First(&node).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		return nil, err
+	}
+	return &node, nil
+}
+
+func (s *Service) checkServer(id uint64) error {
+	var count int64
+	if err := s.db.Model(&domain.Server{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrServerNotFound
+	}
+	return nil
+}
+
+// --- Tasks ---
+
+// Enqueue queues a task for a node. The action names an executable in
+// the agent's actions directory.
+func (s *Service) Enqueue(nodeID uint64, req TaskRequest) (*domain.AgentTask, error) {
+	if !actionPattern.MatchString(req.Action) {
+		return nil, ErrInvalidAction
+	}
+	timeout := req.Timeout
+	if timeout == 0 {
+		timeout = DefaultTaskTimeout
+	}
+	if timeout < time.Second || timeout > MaxTaskTimeout {
+		return nil, ErrInvalidTimeout
+	}
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = DefaultTaskTTL
+	}
+	if _, err := s.GetNode(nodeID); err != nil {
+		return nil, err
+	}
+
+	task := &domain.AgentTask{
+		NodeID:         nodeID,
+		ServiceID:      req.ServiceID,
+		Action:         req.Action,
+		Args:           req.Args,
+		Status:         domain.AgentTaskStatusQueued,
+		TimeoutSeconds: int(timeout / time.Second),
+		ExpiresAt:      time.Now().Add(ttl),
+		CreatedBy:      req.CreatedBy,
+	}
+	if task.Args == nil {
+		task.Args = domain.JSONMap{}
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// NextTasks hands out up to limit queued tasks of a node, oldest first,
+// marking them sent. Tasks past their expiry are expired instead.
+func (s *Service) NextTasks(nodeID uint64, limit int) ([]domain.AgentTask, error) {
+	now := time.Now()
+	if err := s.db.Model(&domain.AgentTask{}).
+		Where("node_id = ? AND status = ? AND expires_at <= ?", nodeID, domain.AgentTaskStatusQueued, now).
+		Updates(map[string]any{"status": domain.AgentTaskStatusExpired, "finished_at": &now}).Error; err != nil {
+		return nil, err
+	}
+
+	var tasks []domain.AgentTask
+	err := s.db.Where("node_id = ? AND status = ?", nodeID, domain.AgentTaskStatusQueued).
+		Order("id").Limit(limit).Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	sent := tasks[:0]
+	for _, task := range tasks {
+		// Claimed by status so a task is sent once though the node has two
+		// streams open
+		result := s.db.Model(&domain.AgentTask{}).
+			Where("id = ? AND status = ?", task.ID, domain.AgentTaskStatusQueued).
+			Updates(map[string]any{"status": domain.AgentTaskStatusSent, "sent_at": &now})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			task.Status = domain.AgentTaskStatusSent
+			task.SentAt = &now
+			sent = append(sent, task)
+		}
+	}
+	return sent, nil
+}
+
+// Requeue puts the tasks sent to a node but not started back in its
+// queue, so they are sent again when its agent reconnects
+func (s *Service) Requeue(nodeID uint64) error {
+	return s.db.Model(&domain.AgentTask{}).
+		Where("node_id = ? AND status = ?", nodeID, domain.AgentTaskStatusSent).
+		Updates(map[string]any{"status": domain.AgentTaskStatusQueued, "sent_at": nil}).Error
+}
+
+// FailLost fails the running tasks that outlived their timeout without
+// the agent reporting an end, such as after the node rebooted, and
+// returns how many it failed
+func (s *Service) FailLost() (int64, error) {
+	var tasks []domain.AgentTask
+	if err := s.db.Where("status = ?", domain.AgentTaskStatusRunning).Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var failed int64
+	for _, task := range tasks {
+		if task.StartedAt == nil ||
+			now.Before(task.StartedAt.Add(time.Duration(task.TimeoutSeconds)*time.Second+startGrace)) {
+			continue
+		}
+		result := s.db.Model(&domain.AgentTask{}).
+			Where("id = ? AND status = ?", task.ID, domain.AgentTaskStatusRunning).
+			Updates(map[string]any{
+				"status":      domain.AgentTaskStatusFailed,
+				"error":       "the agent stopped reporting on the task",
+				"finished_at": &now,
+			})
+		if result.Error != nil {
+			return failed, result.Error
+		}
+		failed += result.RowsAffected
+	}
+	return failed, nil
+}
+
+// StartTask marks a task sent to a node running
+func (s *Service) StartTask(nodeID, taskID uint64) error {
+	task, err := s.nodeTask(nodeID, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status.Finished() {
+		return ErrTaskFinished
+	}
+	if task.Status == domain.AgentTaskStatusRunning {
+		return nil
+	}
+	now := time.Now()
+	return s.db.Model(task).Updates(map[string]any{"status": domain.AgentTaskStatusRunning, "started_at": &now}).Error
+}
+
+// AppendLogs stores lines a running task wrote
+func (s *Service) AppendLogs(nodeID, taskID uint64, lines []LogLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	task, err := s.nodeTask(nodeID, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status.Finished() {
+		return ErrTaskFinished
+	}
+
+	logs := make([]domain.AgentTaskLog, 0, len(lines))
+	for _, line := range lines {
+		stream := line.Stream
+		if stream != "stderr" {
+			stream = "stdout"
+		}
+		text := line.Text
+		if len(text) > maxLogLine {
+			text = strings.ToValidUTF8(text[:maxLogLine], "")
+		}
+		at := line.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		logs = append(logs, domain.AgentTaskLog{TaskID: taskID, Stream: stream, Line: text, LoggedAt: at})
+	}
+	return s.db.CreateInBatches(logs, 100).Error
+}
+
+// FinishTask records the end of a task
+func (s *Service) FinishTask(nodeID, taskID uint64, success bool, output, message string) error {
+	task, err := s.nodeTask(nodeID, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status.Finished() {
+		return ErrTaskFinished
+	}
+	status := domain.AgentTaskStatusFailed
+	if success {
+		status = domain.AgentTaskStatusSucceeded
+	}
+	now := time.Now()
+	updates := map[string]any{
+		"status":      status,
+		"output":      output,
+		"error":       message,
+		"finished_at": &now,
+	}
+	if task.StartedAt == nil {
+		updates["started_at"] = &now
+	}
+	return s.db.Model(task).Updates(updates).Error
+}
+
+// ListTasks returns the tasks of a node, newest first
+func (s *Service) ListTasks(nodeID uint64, limit, offset int) ([]domain.AgentTask, int64, error) {
+	query := s.db.Model(&domain.AgentTask{}).Where("node_id = ?", nodeID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var tasks []domain.AgentTask
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&tasks).Error
+	return tasks, total, err
+}
+
+// GetTask returns a task
+func (s *Service) GetTask(id uint64) (*domain.AgentTask, error) {
+	var task domain.AgentTask
+	if err := s.db.First(&task, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// TaskLogs returns up to limit log lines of a task after the line with
+// ID afterID, in order, so a running task can be followed
+func (s *Service) TaskLogs(taskID, afterID uint64, limit int) ([]domain.AgentTaskLog, error) {
+	var logs []domain.AgentTaskLog
+	err := s.db.Where("task_id = ? AND id > ?", taskID, afterID).Order("id").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// nodeTask returns a task of a node, so an agent reports only on its own
+func (s *Service) nodeTask(nodeID, taskID uint64) (*domain.AgentTask, error) {
+	var task domain.AgentTask
+	if err := s.db.Where("id = ? AND node_id = ?", taskID, nodeID).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// --- Signing ---
+
+// SigningKey returns the key tasks are signed with, creating it on first
+// use
+func (s *Service) SigningKey() (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.signingKey != nil {
+		return s.signingKey, nil
+	}
+
+	var stored domain.AgentSigningKey
+	err := s.db.Order("id").First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, private, genErr := ed25519.GenerateKey(rand.Reader)
+		if genErr != nil {
+			return nil, genErr
+		}
+		stored = domain.AgentSigningKey{
+			PrivateKey: domain.Secret(base64.StdEncoding.EncodeToString(private.Seed())),
+			PublicKey:  base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)),
+		}
+		if err := s.db.Create(&stored).Error; err != nil {
+			return nil, err
+		}
+		// Another instance may have created one first; use the oldest
+		err = s.db.Order("id").First(&stored).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(string(stored.PrivateKey))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("stored agent signing key is invalid")
+	}
+	s.signingKey = ed25519.NewKeyFromSeed(seed)
+	return s.signingKey, nil
+}
+
+// PublicKey returns the base64 public key agents verify tasks with
+func (s *Service) PublicKey() (string, error) {
+	key, err := s.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// --- Helpers ---
+
+func (info NodeInfo) validate() error {
+	if info.CPUCores < 0 || info.MemoryBytes < 0 || info.DiskBytes < 0 {
+		return ErrInvalidNodeInfo
+	}
+	return nil
+}
+
+func (info NodeInfo) updates() map[string]any {
+	return map[string]any{
+		"hostname":     truncate(info.Hostname, 255),
+		"version":      truncate(info.Version, 50),
+		"os":           truncate(info.OS, 50),
+		"arch":         truncate(info.Arch, 50),
+		"cpu_cores":    info.CPUCores,
+		"memory_bytes": info.MemoryBytes,
+		"disk_bytes":   info.DiskBytes,
+	}
+}
+
+func truncate(value string, size int) string {
+	if len(value) > size {
+		return strings.ToValidUTF8(value[:size], "")
+	}
+	return value
+}
+
+// gigabytes converts bytes to the GB servers record capacity in
+func gigabytes(bytes int64) decimal.Decimal {
+	return decimal.NewFromInt(max(bytes, 0)).Div(decimal.NewFromInt(1 << 30)).Round(2)
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+// Package announcement keeps the announcements shown to customers.
+// Customers are emailed an announcement when it is first published, at
+// once or in their digest depending on their email preferences.
+package announcement
+
+import (
+	"errors"
+	"html"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/markup"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrTitleRequired        = errors.New("announcement title is required")
+	ErrInvalidType          = errors.New("type must be general, maintenance or security")
+)
+
+// announcementMarkup renders announcement bodies, which are written by
+// admins only
+var announcementMarkup = markup.Options{Trusted: true}
+
+// Service manages announcements
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new announcement service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Create adds an unpublished announcement
+func (s *Service) Create(title, body, announcementType string, priority int, expiresAt *time.Time) (*domain.Announcement, error) {
+	if title == "" {
+		return nil, ErrTitleRequired
+	}
+	if announcementType == "" {
+		announcementType = "general"
+	}
+	if announcementType != "general" && announcementType != "maintenance" && announcementType != "security" {
+		return nil, ErrInvalidType
+	}
+
+	announcement := &domain.Announcement{
+		Title:     title,
+		Body:      body,
+		Type:      announcementType,
+		Priority:  priority,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(announcement).Error; err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+// List returns every announcement, newest first
+func (s *Service) List() ([]domain.Announcement, error) {
+	var announcements []domain.Announcement
+	err := s.db.Order("created_at DESC").Find(&announcements).Error
+	return announcements, err
+}
+
+// ListActive returns the published announcements that have not expired,
+// most important first
+func (s *Service) ListActive(now time.Time) ([]domain.Announcement, error) {
+	var announcements []domain.Announcement
+	err := s.db.Where("published = ? AND (expires_at IS NULL OR expires_at > ?)", true, now).
+		Order("priority DESC, published_at DESC").Find(&announcements).Error
+	return announcements, err
+}
+
+// Publish publishes an announcement. Customers are emailed the first time
+// an announcement is published.
+func (s *Service) Publish(id uint64) (*domain.Announcement, error) {
+	var announcement domain.Announcement
+	if err := s.db.First(&announcement, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAnnouncementNotFound
+		}
+		return nil, err
+	}
+
+	firstPublish := announcement.PublishedAt == nil
+	now := time.Now()
+	announcement.Published = true
+	if firstPublish {
+		announcement.PublishedAt = &now
+	}
+	if err := s.db.Model(&announcement).Updates(map[string]interface{}{
+		"published":    true,
+		"published_at": announcement.PublishedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	if firstPublish {
+		bodyHTML, err := markup.Render(announcement.Body, announcementMarkup)
+		if err != nil {
+			bodyHTML = "<p>" + html.EscapeString(announcement.Body) + "</p>"
+		}
+		if _, err := notification.NewService(s.db).EmailCustomers(domain.EmailCategoryAnnouncement,
+			announcement.Title, bodyHTML, announcement.Body); err != nil && !errors.Is(err, notification.ErrSMTPNotConfigured) {
+			log.Printf("failed to email customers about announcement %d: %v", id, err)
+		}
+	}
+	return &announcement, nil
+}
+
+// Unpublish hides an announcement from customers
+func (s *Service) Unpublish(id uint64) error {
+	result := s.db.Model(&domain.Announcement{}).Where("id = ?", id).Update("published", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAnnouncementNotFound
+	}
+	return nil
+}
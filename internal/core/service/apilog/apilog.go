@@ -0,0 +1,184 @@
+// Package apilog keeps a log of the calls made with API keys, such as
+// those of the automation and WHMCS compatible APIs, so admins can debug
+// customer integrations. Passwords, secrets and card data are redacted
+// before anything is stored.
+package apilog
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrLogNotFound = errors.New("API request log not found")
+)
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// DefaultBodyLimit is how many bytes of each request and response body
+// are kept
+const DefaultBodyLimit = 4096
+
+// Service records and searches API request logs
+type Service struct {
+	db        *gorm.DB
+	bodyLimit int
+}
+
+// NewService creates a new API log service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, bodyLimit: DefaultBodyLimit}
+}
+
+// SetBodyLimit sets how many bytes of each body are kept, 0 for the
+// default
+func (s *Service) SetBodyLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultBodyLimit
+	}
+	s.bodyLimit = limit
+}
+
+// BodyLimit returns how many bytes of each body are kept
+func (s *Service) BodyLimit() int {
+	return s.bodyLimit
+}
+
+// Entry is a call to record. Bodies and the query string are given as
+// received; Record redacts them.
+type Entry struct {
+	APIKeyID     uint64
+	UserID       uint64
+	Method       string
+	Path         string
+	Action       string
+	Query        string
+	Status       int
+	Duration     time.Duration
+	IPAddress    string
+	UserAgent    string
+	ContentType  string // Of the request body
+	RequestBody  []byte
+	ResponseBody []byte
+	Truncated    bool // The bodies given are already cut short
+}
+
+// Record redacts and stores a call
+func (s *Service) Record(entry Entry) (*domain.APIRequestLog, error) {
+	request, cutRequest := truncate(RedactBody(entry.RequestBody, entry.ContentType), s.bodyLimit)
+	response, cutResponse := truncate(RedactBody(entry.ResponseBody, "application/json"), s.bodyLimit)
+
+	log := &domain.APIRequestLog{
+		APIKeyID:     entry.APIKeyID,
+		UserID:       entry.UserID,
+		Method:       entry.Method,
+		Path:         cut(entry.Path, 255),
+		Action:       cut(entry.Action, 100),
+		Query:        RedactQuery(entry.Query),
+		Status:       entry.Status,
+		DurationMS:   entry.Duration.Milliseconds(),
+		IPAddress:    entry.IPAddress,
+		UserAgent:    cut(entry.UserAgent, 512),
+		RequestBody:  request,
+		ResponseBody: response,
+		Truncated:    entry.Truncated || cutRequest || cutResponse,
+	}
+	if err := s.db.Create(log).Error; err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// Filter narrows down the logs listed for admins. Zero values match
+// everything; Path matches a prefix.
+type Filter struct {
+	APIKeyID  uint64
+	UserID    uint64
+	Path      string
+	Action    string
+	Method    string
+	Status    int
+	StatusMin int // Lowest status, e.g. 400 for failed calls
+	From      *time.Time
+	To        *time.Time
+}
+
+// List returns the logs matching a filter, newest first, without bodies
+func (s *Service) List(filter Filter, limit, offset int) ([]domain.APIRequestLog, int64, error) {
+	query := s.db.Model(&domain.APIRequestLog{})
+	if filter.APIKeyID != 0 {
+		query = query.Where("api_key_id = ?", filter.APIKeyID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Path != "" {
+		query = query.Where(`path LIKE ? ESCAPE '\'`, likeEscaper.Replace(filter.Path)+"%")
+	}
+	if filter.Action != "" {
+		query = query.Where("LOWER(action) = ?", strings.ToLower(filter.Action))
+	}
+	if filter.Method != "" {
+		query = query.Where("method = ?", strings.ToUpper(filter.Method))
+	}
+	if filter.Status != 0 {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.StatusMin != 0 {
+		query = query.Where("status >= ?", filter.StatusMin)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []domain.APIRequestLog
+	if err := query.Omit("request_body", "response_body").Preload("APIKey").
+		Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// Get returns a log with its bodies
+func (s *Service) Get(id uint64) (*domain.APIRequestLog, error) {
+	var log domain.APIRequestLog
+	if err := s.db.Preload("APIKey").First(&log, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLogNotFound
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
+// truncate cuts s to n bytes without splitting a character and reports
+// whether it did
+func truncate(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	return cut(s, n), true
+}
+
+func cut(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,196 @@
+package apilog
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redacted replaces sensitive values in stored logs
+const Redacted = "[REDACTED]"
+
+// sensitiveParts are parts of field names whose values are never stored,
+// compared without case, dashes and underscores
+var sensitiveParts = []string{
+	"password", "passwd", "secret", "token", "apikey", "accesskey", "authorization",
+	"cardnumber", "ccnumber", "cvv", "cvc", "securitycode", "iban", "privatekey",
+}
+
+// sensitiveNames are field names whose values are never stored, compared
+// like sensitiveParts but in full
+var sensitiveNames = map[string]bool{
+	"pan": true, "pin": true, "card": true, "cc": true, "key": true, "pass": true, "pwd": true,
+}
+
+var (
+	// cardPattern finds runs of 13 to 19 digits, optionally grouped with
+	// spaces or dashes, that may be card numbers
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// jsonFieldPattern finds string fields of JSON that could not be parsed,
+	// such as a body cut short
+	jsonFieldPattern = regexp.MustCompile(`"([^"\\]{1,64})"(\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	// formFieldPattern finds fields of form encoded text
+	formFieldPattern = regexp.MustCompile(`(^|[?&])([^=&]{1,64})=([^&]*)`)
+)
+
+// Sensitive reports whether the value of a field must not be stored
+func Sensitive(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(name))
+	if sensitiveNames[name] {
+		return true
+	}
+	for _, part := range sensitiveParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactBody returns a body as text with the values of sensitive fields
+// and anything looking like a card number replaced. JSON and form bodies
+// are parsed; other text is searched for fields.
+func RedactBody(body []byte, contentType string) string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ""
+	}
+	if !utf8.Valid(body) {
+		return "[binary body omitted]"
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "multipart/form-data" {
+		return "[multipart body omitted]"
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		var out bytes.Buffer
+		encoder := json.NewEncoder(&out)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(redactValue(value)); err == nil {
+			return strings.TrimSuffix(out.String(), "\n")
+		}
+	}
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return redactValues(values).Encode()
+		}
+	}
+	return redactText(string(body))
+}
+
+// RedactQuery returns a query string with the values of sensitive
+// parameters and card numbers replaced
+func RedactQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+	if values, err := url.ParseQuery(query); err == nil {
+		return redactValues(values).Encode()
+	}
+	return redactText(query)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if Sensitive(key) && item != nil {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	case string:
+		return redactCards(v)
+	case json.Number:
+		if cardPattern.MatchString(v.String()) && luhn(v.String()) {
+			return Redacted
+		}
+		return v
+	}
+	return value
+}
+
+func redactValues(values url.Values) url.Values {
+	for key, items := range values {
+		for i, item := range items {
+			if Sensitive(key) {
+				items[i] = Redacted
+			} else {
+				items[i] = redactCards(item)
+			}
+		}
+	}
+	return values
+}
+
+// redactText redacts fields found in text that is neither valid JSON nor
+// form encoded
+func redactText(text string) string {
+	text = jsonFieldPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := jsonFieldPattern.FindStringSubmatch(match)
+		if !Sensitive(parts[1]) {
+			return match
+		}
+		return `"` + parts[1] + `"` + parts[2] + `"` + Redacted + `"`
+	})
+	text = formFieldPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := formFieldPattern.FindStringSubmatch(match)
+		name, err := url.QueryUnescape(parts[2])
+		if err != nil {
+			name = parts[2]
+		}
+		if !Sensitive(name) {
+			return match
+		}
+		return parts[1] + parts[2] + "=" + url.QueryEscape(Redacted)
+	})
+	return redactCards(text)
+}
+
+// redactCards replaces numbers that pass the Luhn check of card numbers
+func redactCards(s string) string {
+	return cardPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if luhn(match) {
+			return Redacted
+		}
+		return match
+	})
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,517 @@
+// Package approval implements the two-person rule: dangerous admin
+// actions, such as terminating a service or refunding a payment, are held
+// as approval requests until a second admin approves them within a
+// window, and only then carried out. Which actions need approval is
+// configured by admins; the others run at once.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrUnknownAction = errors.New("unknown action")
+	ErrInvalidWindow = errors.New("the approval window must be between 5 minutes and 7 days")
+	ErrNotFound      = errors.New("approval request not found")
+	ErrNotPending    = errors.New("the approval request has already been decided")
+	ErrExpired       = errors.New("the approval request has expired")
+	ErrSelfApproval  = errors.New("a second admin must approve the request")
+	ErrNotAdmin      = errors.New("only admins decide approval requests")
+)
+
+// Actions held for approval when configured
+const (
+	ActionTerminateService = "terminate_service"
+	ActionBulkTerminate    = "bulk_terminate_services"
+	ActionRefundPayment    = "refund_payment"
+)
+
+// Notifications of the two-person rule: admins are asked to approve a
+// request, and the requester learns what became of it
+const (
+	NotificationApprovalRequested = "approval_requested"
+	NotificationApprovalDecided   = "approval_decided"
+)
+
+const (
+	// DefaultWindow is how long a request waits for approval by default
+	DefaultWindow = time.Hour
+	minWindow     = 5 * time.Minute
+	maxWindow     = 7 * 24 * time.Hour
+	// cacheTTL is how long the settings are cached. Other instances
+	// sharing the database notice a change within it.
+	cacheTTL = 5 * time.Second
+)
+
+// Executor carries out an approved request and describes the outcome
+type Executor func(request *domain.ApprovalRequest) (string, error)
+
+// Settings are the actions needing approval and how long they wait
+type Settings struct {
+	Actions []string
+	Window  time.Duration
+}
+
+// Service holds dangerous actions for approval and carries them out
+type Service struct {
+	db        *gorm.DB
+	executors map[string]Executor
+
+	mu       sync.Mutex
+	settings Settings
+	loadedAt time.Time
+}
+
+// NewService creates a new approval service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, executors: make(map[string]Executor)}
+}
+
+// Register sets how an action is carried out once approved. Only
+// registered actions can be made to need approval.
+func (s *Service) Register(action string, executor Executor) {
+	s.executors[action] = executor
+}
+
+// Actions returns the registered actions
+func (s *Service) Actions() []string {
+	actions := make([]string, 0, len(s.executors))
+	for action := range s.executors {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Settings returns the actions needing approval and the window. They are
+// cached for a few seconds; a failed read keeps the last ones.
+func (s *Service) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < cacheTTL {
+		return s.settings
+	}
+	settings, err := s.load()
+	if err != nil {
+		log.Printf("failed to read approval settings: %v", err)
+	} else {
+		s.settings = settings
+	}
+	s.loadedAt = time.Now()
+	return s.settings
+}
+
+// Required reports whether an action needs the approval of a second admin
+func (s *Service) Required(action string) bool {
+	for _, required := range s.Settings().Actions {
+		if required == action {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateSettings sets the actions needing approval and the window
+func (s *Service) UpdateSettings(actions []string, window time.Duration, actorID uint64, ip, userAgent string) (Settings, error) {
+	if window < minWindow || window > maxWindow {
+		return Settings{}, ErrInvalidWindow
+	}
+	seen := make(map[string]bool)
+	var cleaned []string
+	for _, action := range actions {
+		action = strings.TrimSpace(action)
+		if _, ok := s.executors[action]; !ok {
+			return Settings{}, fmt.Errorf("%w: %s", ErrUnknownAction, action)
+		}
+		if !seen[action] {
+			seen[action] = true
+			cleaned = append(cleaned, action)
+		}
+	}
+	sort.Strings(cleaned)
+
+	previous, err := s.load()
+	if err != nil {
+		return Settings{}, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveSetting(tx, domain.SettingApprovalActions, strings.Join(cleaned, ","), "text", "Actions needing a second admin's approval"); err != nil {
+			return err
+		}
+		return saveSetting(tx, domain.SettingApprovalWindow, strconv.Itoa(int(window.Minutes())), "number", "Approval window in minutes")
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+
+	settings := Settings{Actions: cleaned, Window: window}
+	s.audit(domain.AuditLog{
+		UserID:      &actorID,
+		Action:      domain.AuditActionApprovalSettings,
+		EntityType:  "setting",
+		OldValues:   domain.JSONMap{"actions": previous.Actions, "window_minutes": int(previous.Window.Minutes())},
+		NewValues:   domain.JSONMap{"actions": cleaned, "window_minutes": int(window.Minutes())},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: "Two-person rule changed",
+	})
+
+	s.mu.Lock()
+	s.settings = settings
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return settings, nil
+}
+
+// Request holds an action for approval and asks the other admins to
+// approve it
+func (s *Service) Request(action string, params domain.JSONMap, summary string, requesterID uint64, ip, userAgent string) (*domain.ApprovalRequest, error) {
+	if _, ok := s.executors[action]; !ok {
+		return nil, ErrUnknownAction
+	}
+	request := &domain.ApprovalRequest{
+		Action:        action,
+		Params:        params,
+		Summary:       summary,
+		Status:        domain.ApprovalPending,
+		RequestedByID: requesterID,
+		ExpiresAt:     time.Now().Add(s.Settings().Window),
+	}
+	if err := s.db.Create(request).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &requesterID,
+		Action:      domain.AuditActionApprovalRequested,
+		EntityType:  "approval_request",
+		EntityID:    &request.ID,
+		NewValues:   domain.JSONMap{"action": action, "params": map[string]interface{}(params)},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: summary,
+	})
+
+	var admins []uint64
+	if err := s.db.Model(&domain.User{}).
+		Where("role = ? AND status = ? AND id <> ?", domain.UserRoleAdmin, domain.UserStatusActive, requesterID).
+		Pluck("id", &admins).Error; err != nil {
+		log.Printf("approval: failed to find admins to notify: %v", err)
+	}
+	notifier := notification.NewService(s.db)
+	for _, id := range admins {
+		message := fmt.Sprintf("%s needs your approval before %s.", summary, request.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC"))
+		if err := notifier.SendNotification(id, NotificationApprovalRequested, "Approval needed: "+summary, message, s.link(request)); err != nil {
+			log.Printf("approval: failed to notify admin %d: %v", id, err)
+		}
+	}
+	return request, nil
+}
+
+// Approve carries out a request with the approval of an admin other than
+// the requester. The request is executed or failed afterwards; a failed
+// action is not retried.
+func (s *Service) Approve(id uint64, approver *domain.User, note, ip, userAgent string) (*domain.ApprovalRequest, error) {
+	request, err := s.decidable(id, approver)
+	if err != nil {
+		return nil, err
+	}
+	if request.RequestedByID == approver.ID {
+		return nil, ErrSelfApproval
+	}
+	executor, ok := s.executors[request.Action]
+	if !ok {
+		return nil, ErrUnknownAction
+	}
+
+	// Only one admin gets to approve, even when two try at once
+	now := time.Now()
+	result := s.db.Model(&domain.ApprovalRequest{}).
+		Where("id = ? AND status = ?", request.ID, domain.ApprovalPending).
+		Updates(map[string]interface{}{
+			"status":        domain.ApprovalApproved,
+			"decided_by_id": approver.ID,
+			"decision_note": note,
+			"decided_at":    now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPending
+	}
+	request.Status, request.DecidedByID, request.DecisionNote, request.DecidedAt = domain.ApprovalApproved, &approver.ID, note, &now
+
+	outcome, execErr := executor(request)
+	request.Status, request.Result = domain.ApprovalExecuted, outcome
+	action := domain.AuditActionApprovalExecuted
+	if execErr != nil {
+		request.Status, request.Result = domain.ApprovalFailed, execErr.Error()
+		action = domain.AuditActionApprovalFailed
+	}
+	if err := s.db.Model(request).Updates(map[string]interface{}{
+		"status": request.Status,
+		"result": request.Result,
+	}).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:     &approver.ID,
+		Action:     action,
+		EntityType: "approval_request",
+		EntityID:   &request.ID,
+		NewValues: domain.JSONMap{
+			"action":          request.Action,
+			"params":          map[string]interface{}(request.Params),
+			"requested_by_id": request.RequestedByID,
+			"approved_by_id":  approver.ID,
+			"result":          request.Result,
+		},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: fmt.Sprintf("%s, approved by %s: %s", request.Summary, approver.Email, request.Result),
+	})
+	title := "Approved: " + request.Summary
+	if execErr != nil {
+		title = "Approved but failed: " + request.Summary
+	}
+	s.notifyRequester(request, title, fmt.Sprintf("%s was approved by %s. %s", request.Summary, approver.Email, request.Result))
+	return request, nil
+}
+
+// Reject refuses a request. The requester withdrawing their own request
+// cancels it.
+func (s *Service) Reject(id uint64, actor *domain.User, note, ip, userAgent string) (*domain.ApprovalRequest, error) {
+	request, err := s.decidable(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	status, action := domain.ApprovalRejected, domain.AuditActionApprovalRejected
+	if request.RequestedByID == actor.ID {
+		status, action = domain.ApprovalCancelled, domain.AuditActionApprovalCancelled
+	}
+
+	now := time.Now()
+	result := s.db.Model(&domain.ApprovalRequest{}).
+		Where("id = ? AND status = ?", request.ID, domain.ApprovalPending).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"decided_by_id": actor.ID,
+			"decision_note": note,
+			"decided_at":    now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotPending
+	}
+	request.Status, request.DecidedByID, request.DecisionNote, request.DecidedAt = status, &actor.ID, note, &now
+
+	s.audit(domain.AuditLog{
+		UserID:      &actor.ID,
+		Action:      action,
+		EntityType:  "approval_request",
+		EntityID:    &request.ID,
+		NewValues:   domain.JSONMap{"note": note},
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		Description: request.Summary,
+	})
+	if status == domain.ApprovalRejected {
+		message := fmt.Sprintf("%s was rejected by %s.", request.Summary, actor.Email)
+		if note != "" {
+			message += " " + note
+		}
+		s.notifyRequester(request, "Rejected: "+request.Summary, message)
+	}
+	return request, nil
+}
+
+// Get returns a request with the admins who made and decided it
+func (s *Service) Get(id uint64) (*domain.ApprovalRequest, error) {
+	var request domain.ApprovalRequest
+	if err := s.db.Preload("RequestedBy").Preload("DecidedBy").First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// List returns requests newest first, optionally of one status
+func (s *Service) List(status domain.ApprovalStatus, limit, offset int) ([]domain.ApprovalRequest, int64, error) {
+	query := s.db.Model(&domain.ApprovalRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var requests []domain.ApprovalRequest
+	if err := query.Preload("RequestedBy").Preload("DecidedBy").
+		Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
+
+// AuditTrail returns the audit log entries of a request oldest first:
+// its request, decision and the action carried out
+func (s *Service) AuditTrail(id uint64) ([]domain.AuditLog, error) {
+	var entries []domain.AuditLog
+	err := s.db.Where("entity_type = ? AND entity_id = ?", "approval_request", id).
+		Order("created_at, id").Find(&entries).Error
+	return entries, err
+}
+
+// Monitor expires the requests not approved within the window, every
+// interval until ctx is done
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ExpireRequests(time.Now()); err != nil {
+				log.Printf("approval: failed to expire requests: %v", err)
+			}
+		}
+	}
+}
+
+// ExpireRequests expires the pending requests past their window and tells
+// the requesters
+func (s *Service) ExpireRequests(now time.Time) error {
+	var requests []domain.ApprovalRequest
+	if err := s.db.Where("status = ? AND expires_at <= ?", domain.ApprovalPending, now).Find(&requests).Error; err != nil {
+		return err
+	}
+	for i := range requests {
+		request := &requests[i]
+		result := s.db.Model(&domain.ApprovalRequest{}).
+			Where("id = ? AND status = ?", request.ID, domain.ApprovalPending).
+			Update("status", domain.ApprovalExpired)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		request.Status = domain.ApprovalExpired
+		s.audit(domain.AuditLog{
+			Action:      domain.AuditActionApprovalExpired,
+			EntityType:  "approval_request",
+			EntityID:    &request.ID,
+			Description: request.Summary,
+		})
+		s.notifyRequester(request, "Expired: "+request.Summary, request.Summary+" expired without approval and was not carried out.")
+	}
+	return nil
+}
+
+// decidable returns a request an admin may decide, expiring it when its
+// window has passed
+func (s *Service) decidable(id uint64, actor *domain.User) (*domain.ApprovalRequest, error) {
+	if actor == nil || !actor.IsAdmin() {
+		return nil, ErrNotAdmin
+	}
+	request, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != domain.ApprovalPending {
+		return nil, ErrNotPending
+	}
+	if !time.Now().Before(request.ExpiresAt) {
+		if err := s.ExpireRequests(time.Now()); err != nil {
+			return nil, err
+		}
+		return nil, ErrExpired
+	}
+	return request, nil
+}
+
+func (s *Service) notifyRequester(request *domain.ApprovalRequest, title, message string) {
+	if err := notification.NewService(s.db).SendNotification(request.RequestedByID, NotificationApprovalDecided, title, message, s.link(request)); err != nil {
+		log.Printf("approval: failed to notify admin %d: %v", request.RequestedByID, err)
+	}
+}
+
+// EncodeParams turns what an action is carried out with into request
+// params
+func EncodeParams(v interface{}) (domain.JSONMap, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var params domain.JSONMap
+	err = json.Unmarshal(payload, &params)
+	return params, err
+}
+
+// DecodeParams reads the params of a request into v
+func DecodeParams(request *domain.ApprovalRequest, v interface{}) error {
+	payload, err := json.Marshal(request.Params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (s *Service) link(request *domain.ApprovalRequest) string {
+	return fmt.Sprintf("/admin/approvals?id=%d", request.ID)
+}
+
+func (s *Service) load() (Settings, error) {
+	settings := Settings{Window: DefaultWindow}
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{domain.SettingApprovalActions, domain.SettingApprovalWindow}).Find(&rows).Error; err != nil {
+		return settings, err
+	}
+	for _, row := range rows {
+		switch row.Key {
+		case domain.SettingApprovalActions:
+			for _, action := range strings.Split(row.Value, ",") {
+				if action = strings.TrimSpace(action); action != "" {
+					settings.Actions = append(settings.Actions, action)
+				}
+			}
+		case domain.SettingApprovalWindow:
+			if minutes, err := strconv.Atoi(row.Value); err == nil && minutes > 0 {
+				settings.Window = time.Duration(minutes) * time.Minute
+			}
+		}
+	}
+	return settings, nil
+}
+
+func (s *Service) audit(entry domain.AuditLog) {
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("failed to record %s in the audit log: %v", entry.Action, err)
+	}
+}
+
+func saveSetting(tx *gorm.DB, key, value, valueType, label string) error {
+	setting := domain.Setting{Key: key}
+	return tx.Where("key = ?", key).
+		Assign(domain.Setting{Value: value, Type: valueType, Group: "security", Label: label}).
+		FirstOrCreate(&setting).Error
+}
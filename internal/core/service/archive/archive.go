@@ -0,0 +1,587 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrUnknownDataType = errors.New("unknown archive data type")
+	ErrInvalidPolicy   = errors.New("archive_after_days must be lower than retention_days")
+)
+
+const (
+	archiveSuffix = "_archive"
+	dirPerm       = 0o750
+	filePerm      = 0o600
+	// runInterval is how often Monitor runs an active policy
+	runInterval = 24 * time.Hour
+)
+
+// Target describes a log table managed by the archival subsystem
+type Target struct {
+	DataType string
+	Model    interface{}
+}
+
+// Targets lists the log tables that grow without bound and are archived
+var Targets = []Target{
+	{DataType: "email_logs", Model: &domain.EmailLog{}},
+	{DataType: "webhook_deliveries", Model: &domain.WebhookDelivery{}},
+	{DataType: "kb_search_logs", Model: &domain.KBSearchLog{}},
+	{DataType: "download_logs", Model: &domain.DownloadLog{}},
+	{DataType: "api_request_logs", Model: &domain.APIRequestLog{}},
+}
+
+// Service provides log archival operations
+type Service struct {
+	db  *gorm.DB
+	dir string
+}
+
+// NewService creates a new archive service writing exports below dir
+func NewService(db *gorm.DB, dir string) *Service {
+	if dir == "" {
+		dir = "./data/archive"
+	}
+	return &Service{db: db, dir: dir}
+}
+
+// --- Policies ---
+
+// GetPolicies returns the retention policy of every archive target,
+// creating inactive defaults for targets without one
+func (s *Service) GetPolicies() ([]domain.DataRetentionPolicy, error) {
+	policies := make([]domain.DataRetentionPolicy, 0, len(Targets))
+	for _, target := range Targets {
+		policy := domain.DataRetentionPolicy{
+			DataType:         target.DataType,
+			RetentionDays:    365,
+			ArchiveAfterDays: 90,
+		}
+		if err := s.db.Where("data_type = ?", target.DataType).
+			FirstOrCreate(&policy).Error; err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// UpdatePolicy updates the retention settings of an archive target
+func (s *Service) UpdatePolicy(dataType string, retentionDays, archiveAfterDays int, active bool) (*domain.DataRetentionPolicy, error) {
+	if _, ok := findTarget(dataType); !ok {
+		return nil, ErrUnknownDataType
+	}
+	if retentionDays < 0 || archiveAfterDays < 0 {
+		return nil, ErrInvalidPolicy
+	}
+	if retentionDays > 0 && archiveAfterDays >= retentionDays {
+		return nil, ErrInvalidPolicy
+	}
+
+	var policy domain.DataRetentionPolicy
+	if err := s.db.Where("data_type = ?", dataType).
+		Attrs(domain.DataRetentionPolicy{DataType: dataType}).
+		FirstOrCreate(&policy).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&policy).Updates(map[string]interface{}{
+		"retention_days":     retentionDays,
+		"archive_after_days": archiveAfterDays,
+		"active":             active,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	policy.RetentionDays = retentionDays
+	policy.ArchiveAfterDays = archiveAfterDays
+	policy.Active = active
+	return &policy, nil
+}
+
+// --- Runs ---
+
+// Monitor runs the active policies not run in the last day, checking
+// every interval until ctx is done
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		results, err := s.run(now, func(policy domain.DataRetentionPolicy) bool {
+			return policy.LastRunAt == nil || now.Sub(*policy.LastRunAt) >= runInterval
+		})
+		if err != nil {
+			log.Printf("failed to archive logs: %v", err)
+		}
+		for _, result := range results {
+			if result.Archived > 0 || result.Purged > 0 {
+				log.Printf("archived %d and purged %d %s", result.Archived, result.Purged, result.DataType)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run archives and purges every target with an active policy
+func (s *Service) Run(now time.Time) ([]RunResult, error) {
+	return s.run(now, func(domain.DataRetentionPolicy) bool { return true })
+}
+
+// run archives and purges the targets with an active policy that due
+// selects
+func (s *Service) run(now time.Time, due func(domain.DataRetentionPolicy) bool) ([]RunResult, error) {
+	policies, err := s.GetPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RunResult
+	for _, policy := range policies {
+		if !policy.Active || !due(policy) {
+			continue
+		}
+		target, _ := findTarget(policy.DataType)
+		result, err := s.runTarget(target, policy, now)
+		if err != nil {
+			return results, fmt.Errorf("archive %s: %w", policy.DataType, err)
+		}
+		results = append(results, *result)
+
+		runAt := now
+		if err := s.db.Model(&domain.DataRetentionPolicy{}).Where("id = ?", policy.ID).
+			Update("last_run_at", &runAt).Error; err != nil {
+			return results, fmt.Errorf("archive %s: %w", policy.DataType, err)
+		}
+	}
+	return results, nil
+}
+
+// RunTarget archives and purges a single target regardless of its active flag
+func (s *Service) RunTarget(dataType string, now time.Time) (*RunResult, error) {
+	target, ok := findTarget(dataType)
+	if !ok {
+		return nil, ErrUnknownDataType
+	}
+
+	var policy domain.DataRetentionPolicy
+	if err := s.db.Where("data_type = ?", dataType).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownDataType
+		}
+		return nil, err
+	}
+
+	result, err := s.runTarget(target, policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	runAt := now
+	if err := s.db.Model(&policy).Update("last_run_at", &runAt).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Service) runTarget(target Target, policy domain.DataRetentionPolicy, now time.Time) (*RunResult, error) {
+	result := &RunResult{DataType: target.DataType}
+
+	table, err := s.tableName(target.Model)
+	if err != nil {
+		return nil, err
+	}
+	if !s.db.Migrator().HasTable(table) {
+		result.Skipped = "table does not exist"
+		return result, nil
+	}
+
+	source := table
+	if policy.ArchiveAfterDays > 0 {
+		archiveTable, err := s.ensureArchiveTable(table)
+		if err != nil {
+			return nil, err
+		}
+		cutoff := now.AddDate(0, 0, -policy.ArchiveAfterDays)
+		moved, err := s.moveRows(table, archiveTable, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		result.Archived = moved
+		source = archiveTable
+	}
+
+	if policy.RetentionDays > 0 {
+		cutoff := now.AddDate(0, 0, -policy.RetentionDays)
+		exports, purged, err := s.purgeMonths(target.DataType, source, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		result.Exports = exports
+		result.Purged = purged
+	}
+
+	return result, nil
+}
+
+// ListArchives returns the recorded exports, newest first
+func (s *Service) ListArchives(dataType string, limit, offset int) ([]domain.LogArchive, int64, error) {
+	var archives []domain.LogArchive
+	var total int64
+
+	query := s.db.Model(&domain.LogArchive{})
+	if dataType != "" {
+		query = query.Where("data_type = ?", dataType)
+	}
+	query.Count(&total)
+
+	if err := query.Order("period_start DESC").Limit(limit).Offset(offset).
+		Find(&archives).Error; err != nil {
+		return nil, 0, err
+	}
+	return archives, total, nil
+}
+
+// --- Storage ---
+
+// ensureArchiveTable creates the archive table for a log table. On Postgres the
+// archive is range-partitioned by month so whole months can be dropped cheaply.
+func (s *Service) ensureArchiveTable(table string) (string, error) {
+	archiveTable := table + archiveSuffix
+	if s.db.Migrator().HasTable(archiveTable) {
+		return archiveTable, s.syncArchiveColumns(table, archiveTable)
+	}
+
+	var stmt string
+	if s.isPostgres() {
+		stmt = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (created_at)",
+			s.quote(archiveTable), s.quote(table))
+	} else {
+		// Copy the declared column types so drivers keep decoding timestamps
+		columnTypes, err := s.db.Migrator().ColumnTypes(table)
+		if err != nil {
+			return "", err
+		}
+		definitions := make([]string, 0, len(columnTypes))
+		for _, column := range columnTypes {
+			definitions = append(definitions, s.quote(column.Name())+" "+column.DatabaseTypeName())
+		}
+		stmt = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+			s.quote(archiveTable), strings.Join(definitions, ", "))
+	}
+	if err := s.db.Exec(stmt).Error; err != nil {
+		return "", fmt.Errorf("create archive table: %w", err)
+	}
+	return archiveTable, nil
+}
+
+// syncArchiveColumns adds columns that were migrated onto the live table after
+// its archive table was created
+func (s *Service) syncArchiveColumns(table, archiveTable string) error {
+	liveColumns, err := s.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return err
+	}
+	archived, err := s.columnNames(archiveTable)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range liveColumns {
+		if archived[column.Name()] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+			s.quote(archiveTable), s.quote(column.Name()), column.DatabaseTypeName())
+		if err := s.db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("add archive column %s: %w", column.Name(), err)
+		}
+	}
+	return nil
+}
+
+// ensurePartitions creates the monthly partitions covering [from, to)
+func (s *Service) ensurePartitions(archiveTable string, from, to time.Time) error {
+	for month := monthStart(from); month.Before(to); month = month.AddDate(0, 1, 0) {
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			s.quote(partitionName(archiveTable, month)), s.quote(archiveTable),
+			month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+		if err := s.db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("create partition: %w", err)
+		}
+	}
+	return nil
+}
+
+// moveRows copies rows older than cutoff into the archive table and removes
+// them from the live table in a single transaction
+func (s *Service) moveRows(table, archiveTable string, cutoff time.Time) (int64, error) {
+	oldest, ok, err := s.oldestCreatedAt(table)
+	if err != nil || !ok || !oldest.Before(cutoff) {
+		return 0, err
+	}
+
+	if s.isPostgres() {
+		if err := s.ensurePartitions(archiveTable, oldest, cutoff); err != nil {
+			return 0, err
+		}
+	}
+
+	columns, err := s.columnNames(archiveTable)
+	if err != nil {
+		return 0, err
+	}
+	liveColumns, err := s.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return 0, err
+	}
+	var quoted []string
+	for _, column := range liveColumns {
+		if columns[column.Name()] {
+			quoted = append(quoted, s.quote(column.Name()))
+		}
+	}
+	columnList := strings.Join(quoted, ", ")
+
+	var moved int64
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		insert := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE created_at < ?",
+			s.quote(archiveTable), columnList, columnList, s.quote(table)), cutoff)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		moved = insert.RowsAffected
+		return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE created_at < ?", s.quote(table)), cutoff).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("move rows: %w", err)
+	}
+	return moved, nil
+}
+
+// purgeMonths exports and removes every full calendar month older than cutoff
+func (s *Service) purgeMonths(dataType, table string, cutoff time.Time) ([]domain.LogArchive, int64, error) {
+	oldest, ok, err := s.oldestCreatedAt(table)
+	if err != nil || !ok {
+		return nil, 0, err
+	}
+
+	partitioned := s.isPostgres() && strings.HasSuffix(table, archiveSuffix)
+
+	var exports []domain.LogArchive
+	var purged int64
+	for month := monthStart(oldest); !month.AddDate(0, 1, 0).After(cutoff); month = month.AddDate(0, 1, 0) {
+		end := month.AddDate(0, 1, 0)
+
+		export, err := s.exportRange(dataType, table, month, end)
+		if err != nil {
+			return exports, purged, err
+		}
+		if export != nil {
+			exports = append(exports, *export)
+			purged += export.RowCount
+		}
+
+		if partitioned {
+			stmt := fmt.Sprintf("DROP TABLE IF EXISTS %s", s.quote(partitionName(table, month)))
+			if err := s.db.Exec(stmt).Error; err != nil {
+				return exports, purged, fmt.Errorf("drop partition: %w", err)
+			}
+			continue
+		}
+		if err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE created_at >= ? AND created_at < ?", s.quote(table)),
+			month, end).Error; err != nil {
+			return exports, purged, fmt.Errorf("purge rows: %w", err)
+		}
+	}
+	return exports, purged, nil
+}
+
+// exportRange writes the rows created in [start, end) to a gzip-compressed
+// JSON lines file and records it. It returns nil when the range is empty.
+func (s *Service) exportRange(dataType, table string, start, end time.Time) (*domain.LogArchive, error) {
+	dir := filepath.Join(s.dir, dataType)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("create archive dir: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "export-*.jsonl.gz")
+	if err != nil {
+		return nil, fmt.Errorf("create export file: %w", err)
+	}
+	tmpName := file.Name()
+	defer os.Remove(tmpName)
+
+	hasher := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(file, hasher))
+	encoder := json.NewEncoder(gz)
+
+	rows, err := s.db.Table(table).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Order("id").Rows()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+
+	var count int64
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			rows.Close()
+			_ = file.Close()
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		if err := encoder.Encode(row); err != nil {
+			rows.Close()
+			_ = file.Close()
+			return nil, fmt.Errorf("encode row: %w", err)
+		}
+		count++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("compress export: %w", err)
+	}
+	if count == 0 {
+		_ = file.Close()
+		return nil, nil
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("sync export: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("stat export: %w", err)
+	}
+	if err := file.Chmod(filePerm); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("chmod export: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("close export: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.jsonl.gz",
+		table, start.Format("2006-01"), time.Now().UTC().Format("20060102150405")))
+	if err := os.Rename(tmpName, path); err != nil {
+		return nil, fmt.Errorf("move export: %w", err)
+	}
+
+	archive := &domain.LogArchive{
+		DataType:    dataType,
+		SourceTable: table,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		RowCount:    count,
+		FilePath:    path,
+		FileSize:    info.Size(),
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+	}
+	if err := s.db.Create(archive).Error; err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// --- Helpers ---
+
+func (s *Service) tableName(model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+func (s *Service) columnNames(table string) (map[string]bool, error) {
+	columnTypes, err := s.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(columnTypes))
+	for _, column := range columnTypes {
+		names[column.Name()] = true
+	}
+	return names, nil
+}
+
+func (s *Service) oldestCreatedAt(table string) (time.Time, bool, error) {
+	var rows []struct {
+		CreatedAt time.Time
+	}
+	if err := s.db.Table(table).Select("created_at").
+		Order("created_at ASC").Limit(1).Scan(&rows).Error; err != nil {
+		return time.Time{}, false, err
+	}
+	if len(rows) == 0 {
+		return time.Time{}, false, nil
+	}
+	return rows[0].CreatedAt, true, nil
+}
+
+func (s *Service) isPostgres() bool {
+	return s.db.Dialector.Name() == "postgres"
+}
+
+func (s *Service) quote(name string) string {
+	return s.db.Statement.Quote(name)
+}
+
+func findTarget(dataType string) (Target, bool) {
+	for _, target := range Targets {
+		if target.DataType == dataType {
+			return target, true
+		}
+	}
+	return Target{}, false
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(archiveTable string, month time.Time) string {
+	return fmt.Sprintf("%s_p%s", archiveTable, month.Format("200601"))
+}
+
+// RunResult summarizes an archival run for one target
+type RunResult struct {
+	DataType string              `json:"data_type"`
+	Archived int64               `json:"archived"`
+	Purged   int64               `json:"purged"`
+	Exports  []domain.LogArchive `json:"exports,omitempty"`
+	Skipped  string              `json:"skipped,omitempty"`
+}
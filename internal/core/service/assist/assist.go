@@ -0,0 +1,290 @@
+// Package assist drafts ticket replies and article summaries for staff
+// with a language model. Drafts are only returned to the admin who asked
+// for them; nothing is sent or saved on their behalf.
+package assist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrNotConfigured   = errors.New("AI assist is not configured")
+	ErrDisabled        = errors.New("AI assist is turned off in your settings")
+	ErrTicketNotFound  = errors.New("ticket not found")
+	ErrArticleNotFound = errors.New("article not found")
+	ErrProviderFailed  = errors.New("AI assist provider failed")
+	ErrInvalidLogLevel = errors.New("assist logging must be none, metadata or full")
+)
+
+const (
+	// DefaultMaxTokens limits the length of a draft
+	DefaultMaxTokens = 800
+	// maxContextMessages is how many of the latest ticket messages are
+	// sent to the model
+	maxContextMessages = 20
+	// maxMessageLength truncates long messages and articles in prompts
+	maxMessageLength = 4000
+	maxArticleLength = 12000
+)
+
+const replySystemPrompt = `You are a support agent of a web hosting company writing a reply to a customer ticket.
+Write only the body of the reply in the language of the customer, in Markdown.
+Be accurate and concise. Do not invent account details, prices or promises; when information is missing, ask for it.
+Do not include a subject line. End with the signature given, if any.`
+
+const summarySystemPrompt = `You summarize knowledge base articles of a web hosting company.
+Write a summary of two or three sentences in the language of the article, in plain text, suitable as the article excerpt.`
+
+// Service generates drafts with a completion provider
+type Service struct {
+	db        *gorm.DB
+	provider  domain.CompletionProvider
+	maxTokens int
+	logging   string
+}
+
+// NewService creates a new assist service. It does nothing until a
+// provider is set.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, maxTokens: DefaultMaxTokens, logging: domain.AssistLogMetadata}
+}
+
+// SetProvider sets the language model drafts are generated with; nil
+// turns AI assist off
+func (s *Service) SetProvider(provider domain.CompletionProvider) {
+	s.provider = provider
+}
+
+// SetLimits sets the maximum tokens of a draft; zero keeps the default
+func (s *Service) SetLimits(maxTokens int) {
+	if maxTokens > 0 {
+		s.maxTokens = maxTokens
+	}
+}
+
+// SetLogging sets what is recorded of each request, one of the
+// domain.AssistLog levels; empty keeps metadata
+func (s *Service) SetLogging(level string) error {
+	switch level {
+	case "":
+		s.logging = domain.AssistLogMetadata
+	case domain.AssistLogNone, domain.AssistLogMetadata, domain.AssistLogFull:
+		s.logging = level
+	default:
+		return ErrInvalidLogLevel
+	}
+	return nil
+}
+
+// Available reports whether a provider is configured
+func (s *Service) Available() bool {
+	return s.provider != nil
+}
+
+// Logging returns the configured logging level
+func (s *Service) Logging() string {
+	return s.logging
+}
+
+// IsEnabled reports whether an admin turned AI assist on
+func (s *Service) IsEnabled(adminID uint64) (bool, error) {
+	var setting domain.AssistSetting
+	if err := s.db.Where("admin_id = ?", adminID).Limit(1).Find(&setting).Error; err != nil {
+		return false, err
+	}
+	return setting.Enabled, nil
+}
+
+// SetEnabled turns AI assist on or off for an admin
+func (s *Service) SetEnabled(adminID uint64, enabled bool) error {
+	var setting domain.AssistSetting
+	if err := s.db.Where("admin_id = ?", adminID).Limit(1).Find(&setting).Error; err != nil {
+		return err
+	}
+	if setting.ID == 0 {
+		return s.db.Create(&domain.AssistSetting{AdminID: adminID, Enabled: enabled}).Error
+	}
+	return s.db.Model(&setting).Update("enabled", enabled).Error
+}
+
+// Draft is generated text for an admin to review and edit
+type Draft struct {
+	Content string
+	Model   string
+}
+
+// DraftTicketReply drafts a reply to the latest messages of a ticket.
+// instructions tell the model what the reply should say, e.g. "the
+// refund was approved"; they may be empty.
+func (s *Service) DraftTicketReply(ctx context.Context, admin *domain.User, ticketID uint64, instructions string) (*Draft, error) {
+	if err := s.check(admin.ID); err != nil {
+		return nil, err
+	}
+
+	var ticket domain.Ticket
+	if err := s.db.First(&ticket, ticketID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTicketNotFound
+		}
+		return nil, err
+	}
+	var messages []domain.TicketMessage
+	if err := s.db.Where("ticket_id = ?", ticketID).
+		Order("id DESC").Limit(maxContextMessages).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	var customerName string
+	if ticket.CustomerID != nil {
+		var customer domain.User
+		if err := s.db.Select("first_name", "last_name", "email").
+			Limit(1).Find(&customer, *ticket.CustomerID).Error; err == nil && customer.Email != "" {
+			customerName = customer.FullName()
+		}
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Ticket #%d: %s\n", ticket.ID, ticket.Subject)
+	if customerName != "" {
+		fmt.Fprintf(&prompt, "Customer: %s\n", customerName)
+	}
+	prompt.WriteString("\nConversation, oldest first:\n")
+	for i := len(messages) - 1; i >= 0; i-- {
+		author := "Customer"
+		if messages[i].IsStaff {
+			author = "Staff"
+		}
+		fmt.Fprintf(&prompt, "\n[%s, %s]\n%s\n", author, messages[i].CreatedAt.Format("2006-01-02 15:04"),
+			truncate(messages[i].Body, maxMessageLength))
+	}
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		fmt.Fprintf(&prompt, "\nThe reply should cover: %s\n", instructions)
+	}
+	if name := strings.TrimSpace(admin.FirstName); name != "" {
+		fmt.Fprintf(&prompt, "\nSignature: %s\n", name)
+	}
+
+	return s.complete(ctx, admin.ID, domain.AssistKindTicketReply, ticketID, replySystemPrompt, prompt.String(), 0.3)
+}
+
+// SummarizeArticle drafts a short summary of a knowledge base article,
+// e.g. for its excerpt
+func (s *Service) SummarizeArticle(ctx context.Context, admin *domain.User, articleID uint64) (*Draft, error) {
+	if err := s.check(admin.ID); err != nil {
+		return nil, err
+	}
+
+	var article domain.KnowledgeBaseArticle
+	if err := s.db.First(&article, articleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArticleNotFound
+		}
+		return nil, err
+	}
+
+	prompt := fmt.Sprintf("Title: %s\n\n%s", article.Title, truncate(article.Content, maxArticleLength))
+	return s.complete(ctx, admin.ID, domain.AssistKindArticleSummary, articleID, summarySystemPrompt, prompt, 0.2)
+}
+
+// check returns why an admin may not use AI assist
+func (s *Service) check(adminID uint64) error {
+	if s.provider == nil {
+		return ErrNotConfigured
+	}
+	enabled, err := s.IsEnabled(adminID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrDisabled
+	}
+	return nil
+}
+
+// complete asks the provider for a draft and logs the request
+func (s *Service) complete(ctx context.Context, adminID uint64, kind string, subjectID uint64, system, prompt string, temperature float64) (*Draft, error) {
+	started := time.Now()
+	resp, err := s.provider.Complete(ctx, domain.CompletionRequest{
+		Messages: []domain.ChatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:   s.maxTokens,
+		Temperature: temperature,
+	})
+
+	if s.logging != domain.AssistLogNone {
+		entry := &domain.AssistLog{
+			AdminID:    adminID,
+			Kind:       kind,
+			SubjectID:  subjectID,
+			Provider:   s.provider.Name(),
+			DurationMS: time.Since(started).Milliseconds(),
+		}
+		if resp != nil {
+			entry.Model = resp.Model
+			entry.PromptTokens = resp.PromptTokens
+			entry.CompletionTokens = resp.CompletionTokens
+		}
+		if err != nil {
+			entry.Error = truncate(err.Error(), 500)
+		}
+		if s.logging == domain.AssistLogFull {
+			entry.Prompt = system + "\n\n" + prompt
+			if resp != nil {
+				entry.Response = resp.Content
+			}
+		}
+		if logErr := s.db.Create(entry).Error; logErr != nil {
+			log.Printf("assist: failed to log request: %v", logErr)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderFailed, err)
+	}
+	return &Draft{Content: resp.Content, Model: resp.Model}, nil
+}
+
+// ListLogs returns the logged requests, newest first, optionally of one
+// admin
+func (s *Service) ListLogs(adminID *uint64, limit, offset int) ([]domain.AssistLog, int64, error) {
+	query := s.db.Model(&domain.AssistLog{})
+	if adminID != nil {
+		query = query.Where("admin_id = ?", *adminID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []domain.AssistLog
+	if err := query.Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
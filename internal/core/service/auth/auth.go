@@ -4,12 +4,17 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/securitymonitor"
 )
 
 var (
@@ -22,6 +27,8 @@ var (
 	ErrPasswordTooShort      = errors.New("password must be at least 8 characters")
 	ErrSessionExpired        = errors.New("session has expired")
 	ErrTooManyLoginAttempts  = errors.New("too many failed login attempts, please try again later")
+	ErrInvalidTimezone       = errors.New("unknown time zone")
+	ErrUserBanned            = errors.New("sign in is blocked for this account, please try again later")
 )
 
 const (
@@ -32,20 +39,73 @@ const (
 	BcryptCost            = 12
 	MaxLoginAttempts      = 5
 	LoginLockoutDuration  = 15 * time.Minute
+	// lastSeenInterval is how often the last request of a session is
+	// saved for the idle timeout
+	lastSeenInterval = time.Minute
 )
 
+// SessionTimeouts end a session a while after sign in and after a while
+// without requests
+type SessionTimeouts struct {
+	Absolute time.Duration // SessionDuration when zero
+	Idle     time.Duration // 0 for no idle timeout
+}
+
+// SessionPolicy sets how long sessions last and how many a user may have
+type SessionPolicy struct {
+	MaxConcurrent int // Signing in ends the oldest sessions over it; 0 for no limit
+	Customer      SessionTimeouts
+	Staff         SessionTimeouts // Of staff and admins
+}
+
+// DefaultSessionPolicy keeps customers signed in for 30 days and staff
+// for 12 hours or until an hour without requests
+var DefaultSessionPolicy = SessionPolicy{
+	Customer: SessionTimeouts{Absolute: SessionDuration},
+	Staff:    SessionTimeouts{Absolute: 12 * time.Hour, Idle: time.Hour},
+}
+
+// timeouts returns the timeouts of the sessions of a role
+func (p SessionPolicy) timeouts(role domain.UserRole) SessionTimeouts {
+	timeouts := p.Customer
+	if role == domain.UserRoleStaff || role == domain.UserRoleAdmin {
+		timeouts = p.Staff
+	}
+	if timeouts.Absolute <= 0 {
+		timeouts.Absolute = SessionDuration
+	}
+	return timeouts
+}
+
 // Service provides authentication operations
 type Service struct {
-	db *gorm.DB
+	db      *gorm.DB
+	monitor *securitymonitor.Service
+	policy  SessionPolicy
 }
 
 // NewService creates a new auth service
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, policy: DefaultSessionPolicy}
+}
+
+// SetSessionPolicy sets the timeouts of sessions and how many a user may
+// have. The timeouts also apply to the sessions already signed in.
+func (s *Service) SetSessionPolicy(policy SessionPolicy) {
+	s.policy = policy
 }
 
-// Register creates a new user account
-func (s *Service) Register(email, password, firstName, lastName string) (*domain.User, error) {
+// SetSecurityMonitor reports failed sign ins and password reset requests
+// to the security monitor, which bans the addresses abusing them, and
+// refuses sign in to banned users
+func (s *Service) SetSecurityMonitor(monitor *securitymonitor.Service) {
+	s.monitor = monitor
+}
+
+// Register creates a new user account billed in currency, the default
+// currency when empty, and records the acceptance of the legal documents
+// the user agreed to
+func (s *Service) Register(email, password, firstName, lastName, currency string, accepted []domain.LegalDocument, ipAddress, userAgent string) (*domain.User, error) {
 	if len(password) < MinPasswordLength {
 		return nil, ErrPasswordTooShort
 	}
@@ -56,6 +116,11 @@ func (s *Service) Register(email, password, firstName, lastName string) (*domain
 		return nil, ErrEmailExists
 	}
 
+	currency, err := account.OfferedCurrency(s.db, currency)
+	if err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
 	if err != nil {
@@ -70,10 +135,21 @@ func (s *Service) Register(email, password, firstName, lastName string) (*domain
 		Role:         domain.UserRoleCustomer,
 		Status:       domain.UserStatusActive,
 		Language:     "en",
-		Currency:     "USD",
+		Currency:     currency,
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if len(accepted) > 0 {
+			if _, err := account.NewService(tx).AcceptDocuments(user.ID, accepted, domain.ConsentContextRegistration, nil, ipAddress, userAgent); err != nil {
+				return err
+			}
+		}
+		return notification.NewService(tx).CustomerCreated(user)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -92,6 +168,9 @@ func (s *Service) Login(email, password, ipAddress, userAgent string) (*domain.S
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			s.logLoginAttempt(email, ipAddress, userAgent, false, "user_not_found")
+			if s.monitor != nil {
+				s.monitor.RecordLoginFailure(email, ipAddress, nil)
+			}
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
@@ -100,16 +179,28 @@ func (s *Service) Login(email, password, ipAddress, userAgent string) (*domain.S
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
 		s.logLoginAttempt(email, ipAddress, userAgent, false, "invalid_password")
+		s.logSecurityEvent(user.ID, domain.SecurityEventLoginFailed, ipAddress, userAgent, "invalid_password")
+		if s.monitor != nil {
+			s.monitor.RecordLoginFailure(email, ipAddress, &user.ID)
+		}
 		return nil, ErrInvalidCredentials
 	}
 
+	if s.monitor != nil && s.monitor.UserBanned(user.ID) {
+		s.logLoginAttempt(email, ipAddress, userAgent, false, "banned")
+		s.logSecurityEvent(user.ID, domain.SecurityEventLoginFailed, ipAddress, userAgent, "banned")
+		return nil, ErrUserBanned
+	}
+
 	// Check user status
 	switch user.Status {
 	case domain.UserStatusInactive:
 		s.logLoginAttempt(email, ipAddress, userAgent, false, "inactive")
+		s.logSecurityEvent(user.ID, domain.SecurityEventLoginFailed, ipAddress, userAgent, "inactive")
 		return nil, ErrUserInactive
 	case domain.UserStatusSuspended:
 		s.logLoginAttempt(email, ipAddress, userAgent, false, "suspended")
+		s.logSecurityEvent(user.ID, domain.SecurityEventLoginFailed, ipAddress, userAgent, "suspended")
 		return nil, ErrUserSuspended
 	}
 
@@ -119,17 +210,21 @@ func (s *Service) Login(email, password, ipAddress, userAgent string) (*domain.S
 		return nil, err
 	}
 
+	now := time.Now()
 	session := &domain.Session{
-		ID:        sessionID,
-		UserID:    user.ID,
-		UserAgent: userAgent,
-		IPAddress: ipAddress,
-		ExpiresAt: time.Now().Add(SessionDuration),
+		ID:         sessionID,
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		ExpiresAt:  now.Add(s.policy.timeouts(user.Role).Absolute),
+		Role:       user.Role,
+		LastSeenAt: &now,
 	}
 
 	if err := s.db.Create(session).Error; err != nil {
 		return nil, err
 	}
+	s.limitSessions(user.ID, ipAddress, userAgent)
 
 	// Update last login
 	s.db.Model(&user).Updates(map[string]interface{}{
@@ -139,6 +234,7 @@ func (s *Service) Login(email, password, ipAddress, userAgent string) (*domain.S
 
 	// Log successful login
 	s.logLoginAttempt(email, ipAddress, userAgent, true, "")
+	s.logSecurityEvent(user.ID, domain.SecurityEventLogin, ipAddress, userAgent, "")
 
 	return session, nil
 }
@@ -158,20 +254,115 @@ func (s *Service) ValidateSession(sessionID string) (*domain.User, error) {
 		return nil, err
 	}
 
-	if session.IsExpired() {
+	now := time.Now()
+	timeouts := s.policy.timeouts(session.User.Role)
+	lastSeen := session.UpdatedAt
+	if session.LastSeenAt != nil {
+		lastSeen = *session.LastSeenAt
+	}
+	switch {
+	case session.IsExpired(), now.After(session.CreatedAt.Add(timeouts.Absolute)):
+		s.db.Delete(&session)
+		return nil, ErrSessionExpired
+	case timeouts.Idle > 0 && now.Sub(lastSeen) > timeouts.Idle:
 		s.db.Delete(&session)
 		return nil, ErrSessionExpired
+	case session.Role != "" && session.Role != session.User.Role:
+		// The user signs in again for a session of the new role, so an ID
+		// planted before the change does not carry it
+		s.db.Delete(&session)
+		s.logSecurityEvent(session.UserID, domain.SecurityEventSessionEnded, session.IPAddress, session.UserAgent, "role_changed")
+		return nil, ErrSessionExpired
 	}
 
 	if !session.User.IsActive() {
 		return nil, ErrUserInactive
 	}
 
+	if now.Sub(lastSeen) >= lastSeenInterval {
+		s.db.Model(&domain.Session{}).Where("id = ?", session.ID).UpdateColumn("last_seen_at", now)
+	}
+
 	return &session.User, nil
 }
 
+// RotateSession replaces the ID of a session after a privilege change,
+// such as a new password, so an ID an attacker planted or saw before it
+// stops working. The session keeps its sign in time and expiry.
+func (s *Service) RotateSession(sessionID string) (*domain.Session, error) {
+	var rotated *domain.Session
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rotated, err = rotateSession(tx, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+// rotateSession replaces the ID of a session in a transaction
+func rotateSession(tx *gorm.DB, sessionID string) (*domain.Session, error) {
+	var session domain.Session
+	if err := tx.Preload("User").First(&session, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	newID, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rotated := session
+	rotated.ID = newID
+	rotated.Role = session.User.Role
+	rotated.LastSeenAt = &now
+	if err := tx.Omit("User").Create(&rotated).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&domain.Session{}, "id = ?", sessionID).Error; err != nil {
+		return nil, err
+	}
+	return &rotated, nil
+}
+
+// SessionExpiry returns when a session ends at the latest under the
+// timeouts of the role it was signed in with
+func (s *Service) SessionExpiry(session *domain.Session) time.Time {
+	expiry := session.CreatedAt.Add(s.policy.timeouts(session.Role).Absolute)
+	if session.ExpiresAt.Before(expiry) {
+		return session.ExpiresAt
+	}
+	return expiry
+}
+
+// limitSessions ends the oldest sessions of a user over the limit
+func (s *Service) limitSessions(userID uint64, ipAddress, userAgent string) {
+	if s.policy.MaxConcurrent <= 0 {
+		return
+	}
+	var ids []string
+	if err := s.db.Model(&domain.Session{}).Where("user_id = ?", userID).
+		Order("created_at DESC").Pluck("id", &ids).Error; err != nil || len(ids) <= s.policy.MaxConcurrent {
+		return
+	}
+	stale := ids[s.policy.MaxConcurrent:]
+	if err := s.db.Delete(&domain.Session{}, "id IN ?", stale).Error; err != nil {
+		return
+	}
+	s.logSecurityEvent(userID, domain.SecurityEventSessionEnded, ipAddress, userAgent,
+		fmt.Sprintf("concurrent_limit: %d ended", len(stale)))
+}
+
 // CreatePasswordResetToken creates a password reset token
-func (s *Service) CreatePasswordResetToken(email string) (*domain.PasswordResetToken, error) {
+func (s *Service) CreatePasswordResetToken(email, ipAddress string) (*domain.PasswordResetToken, error) {
+	if s.monitor != nil {
+		s.monitor.RecordPasswordReset(email, ipAddress)
+	}
 	var user domain.User
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -199,7 +390,7 @@ func (s *Service) CreatePasswordResetToken(email string) (*domain.PasswordResetT
 }
 
 // ResetPassword resets a user's password using a token
-func (s *Service) ResetPassword(token, newPassword string) error {
+func (s *Service) ResetPassword(token, newPassword, ipAddress, userAgent string) error {
 	if len(newPassword) < MinPasswordLength {
 		return ErrPasswordTooShort
 	}
@@ -235,32 +426,63 @@ func (s *Service) ResetPassword(token, newPassword string) error {
 	// Invalidate all sessions for this user
 	s.db.Delete(&domain.Session{}, "user_id = ?", resetToken.UserID)
 
+	s.logSecurityEvent(resetToken.UserID, domain.SecurityEventPasswordReset, ipAddress, userAgent, "")
+
 	return nil
 }
 
-// ChangePassword changes a user's password
-func (s *Service) ChangePassword(userID uint64, currentPassword, newPassword string) error {
+// ChangePassword changes a user's password and ends their other sessions.
+// The session the change was made from, if any, is kept under a new ID,
+// which is returned; it is nil for a change made without a session, such
+// as with an API key.
+func (s *Service) ChangePassword(userID uint64, sessionID, currentPassword, newPassword, ipAddress, userAgent string) (*domain.Session, error) {
 	if len(newPassword) < MinPasswordLength {
-		return ErrPasswordTooShort
+		return nil, ErrPasswordTooShort
 	}
 
 	var user domain.User
 	if err := s.db.First(&user, userID).Error; err != nil {
-		return ErrUserNotFound
+		return nil, ErrUserNotFound
 	}
 
 	// Verify current password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
-		return ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
 	}
 
 	// Hash new password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), BcryptCost)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.db.Model(&user).Update("password_hash", string(passwordHash)).Error
+	var session *domain.Session
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", string(passwordHash)).Error; err != nil {
+			return err
+		}
+		if sessionID != "" {
+			rotated, err := rotateSession(tx, sessionID)
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				return err
+			}
+			session = rotated
+		}
+
+		// Sessions signed in before the change end, a stolen one included
+		others := tx.Where("user_id = ?", userID)
+		if session != nil {
+			others = others.Where("id <> ?", session.ID)
+		}
+		return others.Delete(&domain.Session{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logSecurityEvent(userID, domain.SecurityEventPasswordChanged, ipAddress, userAgent, "")
+
+	return session, nil
 }
 
 // CreateEmailVerificationToken creates an email verification token
@@ -334,8 +556,15 @@ func (s *Service) GetUserByEmail(email string) (*domain.User, error) {
 	return &user, nil
 }
 
-// UpdateProfile updates a user's profile
-func (s *Service) UpdateProfile(userID uint64, firstName, lastName, company, phone, address1, address2, city, state, postalCode, country string) error {
+// UpdateProfile updates a user's profile. The time zone is an IANA name
+// like "Europe/Berlin", or empty for the server time zone.
+func (s *Service) UpdateProfile(userID uint64, firstName, lastName, company, phone, address1, address2, city, state, postalCode, country, timezone string) error {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+
 	updates := map[string]interface{}{
 		"first_name":  firstName,
 		"last_name":   lastName,
@@ -347,6 +576,7 @@ func (s *Service) UpdateProfile(userID uint64, firstName, lastName, company, pho
 		"state":       state,
 		"postal_code": postalCode,
 		"country":     country,
+		"timezone":    timezone,
 	}
 
 	return s.db.Model(&domain.User{}).Where("id = ?", userID).Updates(updates).Error
@@ -369,6 +599,13 @@ func (s *Service) logLoginAttempt(email, ipAddress, userAgent string, success bo
 	s.db.Create(attempt)
 }
 
+// logSecurityEvent records an entry in a user's security log
+func (s *Service) logSecurityEvent(userID uint64, eventType domain.SecurityEventType, ipAddress, userAgent, details string) {
+	if err := account.NewService(s.db).RecordEvent(userID, eventType, ipAddress, userAgent, details); err != nil {
+		log.Printf("failed to record %s event for user %d: %v", eventType, userID, err)
+	}
+}
+
 // isLockedOut checks if an IP/email is locked out due to failed attempts
 func (s *Service) isLockedOut(email, ipAddress string) bool {
 	cutoff := time.Now().Add(-LoginLockoutDuration)
@@ -0,0 +1,290 @@
+package automation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/payment"
+	"github.com/openhost/openhost/internal/core/service/ticket"
+)
+
+// --- Actions ---
+
+// CreateCustomer creates a customer account. A random password is set
+// when none is given; the customer can reset it.
+func (s *Service) CreateCustomer(input CustomerInput) (*domain.User, error) {
+	input.Email = strings.TrimSpace(input.Email)
+	input.FirstName = strings.TrimSpace(input.FirstName)
+	input.LastName = strings.TrimSpace(input.LastName)
+	if input.Email == "" || input.FirstName == "" || input.LastName == "" {
+		return nil, ErrInvalidCustomer
+	}
+
+	password := input.Password
+	if password == "" {
+		bytes := make([]byte, 16)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, err
+		}
+		password = hex.EncodeToString(bytes)
+	}
+
+	// Legal documents are accepted by the customer, not the integration
+	user, err := auth.NewService(s.db).Register(input.Email, password, input.FirstName, input.LastName, "", nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"company":     input.Company,
+		"phone":       input.Phone,
+		"address1":    input.Address1,
+		"address2":    input.Address2,
+		"city":        input.City,
+		"state":       input.State,
+		"postal_code": input.PostalCode,
+		"country":     strings.ToUpper(input.Country),
+	}
+	if err := s.db.Model(user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateTicket opens a support ticket for a customer, given by ID or by
+// email. Emails without an account open a guest ticket.
+func (s *Service) CreateTicket(input TicketInput) (*domain.Ticket, error) {
+	input.Email = strings.TrimSpace(input.Email)
+	if strings.TrimSpace(input.Subject) == "" || strings.TrimSpace(input.Message) == "" {
+		return nil, ErrInvalidTicket
+	}
+	if input.CustomerID == 0 && input.Email == "" {
+		return nil, ErrInvalidTicket
+	}
+
+	var customer domain.User
+	query := s.db.Where("email = ?", input.Email)
+	if input.CustomerID != 0 {
+		query = s.db.Where("id = ?", input.CustomerID)
+	}
+	result := query.Limit(1).Find(&customer)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 && input.CustomerID != 0 {
+		return nil, ErrCustomerMissing
+	}
+
+	var customerID *uint64
+	email := input.Email
+	if result.RowsAffected > 0 {
+		customerID = &customer.ID
+		email = customer.Email
+	}
+
+	priority := domain.TicketPriority(strings.ToLower(input.Priority))
+	switch priority {
+	case domain.TicketPriorityLow, domain.TicketPriorityNormal, domain.TicketPriorityHigh:
+	default:
+		priority = domain.TicketPriorityNormal
+	}
+
+	return ticket.NewService(s.db).CreateTicket(customerID, input.Subject, input.Message, email, priority, "automation")
+}
+
+// AddCredit adds credit to a customer account on behalf of the staff user
+// of the API key
+func (s *Service) AddCredit(staffID uint64, input CreditInput) (*domain.CreditAdjustment, error) {
+	if !input.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	customer, err := s.customer(input.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(input.Currency)
+	if currency == "" {
+		currency = customer.Currency
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		reason = "Added by automation"
+	}
+	return payment.NewService(s.db).AddCredit(customer.ID, input.Amount, currency, reason, &staffID)
+}
+
+// CreateInvoice creates an unpaid invoice for a customer. It is due in 7
+// days unless a due date is given.
+func (s *Service) CreateInvoice(input InvoiceInput) (*domain.Invoice, error) {
+	if len(input.Items) == 0 {
+		return nil, ErrInvalidInvoice
+	}
+	customer, err := s.customer(input.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]invoice.InvoiceItemRequest, 0, len(input.Items))
+	for _, item := range input.Items {
+		if strings.TrimSpace(item.Description) == "" || item.Amount.IsNegative() {
+			return nil, ErrInvalidInvoice
+		}
+		quantity := item.Quantity
+		if !quantity.IsPositive() {
+			quantity = decimal.NewFromInt(1)
+		}
+		items = append(items, invoice.InvoiceItemRequest{
+			Type:        "manual",
+			Description: item.Description,
+			Quantity:    quantity,
+			UnitPrice:   item.Amount,
+			Taxable:     item.Taxable,
+		})
+	}
+
+	currency := strings.ToUpper(input.Currency)
+	if currency == "" {
+		currency = customer.Currency
+	}
+	dueDate := input.DueDate
+	if dueDate.IsZero() {
+		dueDate = time.Now().Add(7 * 24 * time.Hour)
+	}
+	return invoice.NewService(s.db).CreateInvoice(customer.ID, currency, dueDate, items)
+}
+
+// --- Triggers ---
+
+// RecentEvents returns the payloads of the latest records of a trigger
+// event, newest first. Automation platforms poll it and use it for sample
+// data when a trigger is set up.
+func (s *Service) RecentEvents(event string, limit int) ([]interface{}, error) {
+	events := []interface{}{}
+	switch event {
+	case notification.EventCustomerCreated:
+		var users []domain.User
+		if err := s.db.Where("role = ?", domain.UserRoleCustomer).
+			Order("created_at DESC, id DESC").Limit(limit).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for i := range users {
+			events = append(events, notification.NewCustomerEvent(&users[i]))
+		}
+	case notification.EventTicketCreated:
+		var tickets []domain.Ticket
+		if err := s.db.Preload("Messages", "is_staff = ?", false).
+			Order("created_at DESC, id DESC").Limit(limit).Find(&tickets).Error; err != nil {
+			return nil, err
+		}
+		for i := range tickets {
+			events = append(events, notification.NewTicketEvent(&tickets[i]))
+		}
+	case notification.EventCreditAdded:
+		var adjustments []domain.CreditAdjustment
+		if err := s.db.Where("type = ?", "add").
+			Order("created_at DESC, id DESC").Limit(limit).Find(&adjustments).Error; err != nil {
+			return nil, err
+		}
+		for i := range adjustments {
+			events = append(events, notification.NewCreditEvent(&adjustments[i]))
+		}
+	case notification.EventInvoiceCreated:
+		var invoices []domain.Invoice
+		if err := s.db.Order("created_at DESC, id DESC").Limit(limit).Find(&invoices).Error; err != nil {
+			return nil, err
+		}
+		for i := range invoices {
+			events = append(events, notification.NewInvoiceEvent(&invoices[i]))
+		}
+	case notification.EventCustomerHealthDropped:
+		var healths []domain.CustomerHealth
+		if err := s.db.Where("alerted_at IS NOT NULL").
+			Order("alerted_at DESC, customer_id DESC").Limit(limit).Find(&healths).Error; err != nil {
+			return nil, err
+		}
+		for i := range healths {
+			var customer domain.User
+			if err := s.db.Limit(1).Find(&customer, healths[i].CustomerID).Error; err != nil {
+				return nil, err
+			}
+			previous := healths[i].Score
+			if healths[i].PreviousScore != nil {
+				previous = *healths[i].PreviousScore
+			}
+			events = append(events, notification.NewCustomerHealthEvent(&customer, &healths[i], previous))
+		}
+	default:
+		return nil, ErrUnknownEvent
+	}
+	return events, nil
+}
+
+func (s *Service) customer(id uint64) (*domain.User, error) {
+	var customer domain.User
+	result := s.db.Limit(1).Find(&customer, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCustomerMissing
+	}
+	return &customer, nil
+}
+
+// CustomerInput are the fields of the create customer action
+type CustomerInput struct {
+	Email      string
+	FirstName  string
+	LastName   string
+	Password   string
+	Company    string
+	Phone      string
+	Address1   string
+	Address2   string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+}
+
+// TicketInput are the fields of the create ticket action
+type TicketInput struct {
+	CustomerID uint64
+	Email      string
+	Subject    string
+	Message    string
+	Priority   string
+}
+
+// CreditInput are the fields of the add credit action
+type CreditInput struct {
+	CustomerID uint64
+	Amount     decimal.Decimal
+	Currency   string
+	Reason     string
+}
+
+// InvoiceInput are the fields of the create invoice action
+type InvoiceInput struct {
+	CustomerID uint64
+	Currency   string
+	DueDate    time.Time
+	Items      []InvoiceItemInput
+}
+
+// InvoiceItemInput is a line of the create invoice action
+type InvoiceItemInput struct {
+	Description string
+	Amount      decimal.Decimal
+	Quantity    decimal.Decimal
+	Taxable     bool
+}
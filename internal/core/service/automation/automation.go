@@ -0,0 +1,231 @@
+package automation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrInvalidKey      = errors.New("invalid API key")
+	ErrKeyNotFound     = errors.New("API key not found")
+	ErrNotStaff        = errors.New("API keys can only be issued to admins and staff")
+	ErrUnknownEvent    = errors.New("unknown trigger event")
+	ErrInvalidHookURL  = errors.New("target URL must be an absolute http or https URL")
+	ErrHookNotFound    = errors.New("subscription not found")
+	ErrInvalidCustomer = errors.New("email, first name and last name are required")
+	ErrInvalidTicket   = errors.New("subject, message and a customer or email are required")
+	ErrInvalidAmount   = errors.New("amount must be greater than zero")
+	ErrInvalidInvoice  = errors.New("an invoice needs at least one item with a description")
+	ErrCustomerMissing = errors.New("customer not found")
+)
+
+// keyPermission marks API keys issued for the automation API
+const keyPermission = "automation"
+
+// Events lists the trigger events automation platforms can subscribe to
+var Events = []string{
+	notification.EventCustomerCreated,
+	notification.EventTicketCreated,
+	notification.EventCreditAdded,
+	notification.EventInvoiceCreated,
+	notification.EventCustomerHealthDropped,
+}
+
+// Service provides the inbound actions and trigger subscriptions used by
+// no-code automation platforms such as Zapier and n8n
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new automation service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// --- API keys ---
+
+// CreateKey issues an API key acting as a staff user. The key is only
+// returned here, a hash is stored.
+func (s *Service) CreateKey(userID uint64, name string) (*Key, error) {
+	var user domain.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Role != domain.UserRoleAdmin && user.Role != domain.UserRoleStaff {
+		return nil, ErrNotStaff
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+	secret := "oh_" + hex.EncodeToString(bytes)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Automation"
+	}
+	key := &domain.APIKey{
+		UserID:  userID,
+		Name:    name,
+		KeyHash: hashKey(secret),
+		Permissions: domain.JSONMap{
+			keyPermission: true,
+			"prefix":      secret[:10],
+		},
+		Active: true,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, err
+	}
+
+	return &Key{APIKey: *key, Secret: secret}, nil
+}
+
+// ListKeys returns the API keys issued for the automation API
+func (s *Service) ListKeys() ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	if err := s.db.Preload("User").Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.APIKey, 0, len(keys))
+	for _, key := range keys {
+		if isAutomationKey(&key) {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+// RevokeKey deactivates an API key and the trigger subscriptions made
+// with it
+func (s *Service) RevokeKey(id uint64) error {
+	var key domain.APIKey
+	if err := s.db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrKeyNotFound
+		}
+		return err
+	}
+	if !isAutomationKey(&key) {
+		return ErrKeyNotFound
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.WebhookConfig{}).Where("api_key_id = ?", key.ID).Update("active", false).Error
+	})
+}
+
+// Authenticate returns the API key with the staff user it acts as
+func (s *Service) Authenticate(secret string) (*domain.APIKey, error) {
+	if secret == "" {
+		return nil, ErrInvalidKey
+	}
+
+	var key domain.APIKey
+	result := s.db.Preload("User").Where("key_hash = ?", hashKey(secret)).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !isAutomationKey(&key) || !key.IsValid() {
+		return nil, ErrInvalidKey
+	}
+	if key.User.Status != domain.UserStatusActive ||
+		(key.User.Role != domain.UserRoleAdmin && key.User.Role != domain.UserRoleStaff) {
+		return nil, ErrInvalidKey
+	}
+
+	now := time.Now()
+	s.db.Model(&key).Update("last_used_at", &now)
+	return &key, nil
+}
+
+// --- Trigger subscriptions ---
+
+// Subscribe registers a webhook delivering an event to targetURL, as
+// REST hook subscriptions of automation platforms do
+func (s *Service) Subscribe(key *domain.APIKey, event, targetURL string) (*domain.WebhookConfig, error) {
+	if !IsEvent(event) {
+		return nil, ErrUnknownEvent
+	}
+	parsed, err := url.Parse(strings.TrimSpace(targetURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidHookURL
+	}
+
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+
+	var webhook *domain.WebhookConfig
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		created, err := notification.NewService(tx).CreateWebhook(nil, "Automation: "+key.Name, parsed.String(),
+			hex.EncodeToString(bytes), []string{event})
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(created).Update("api_key_id", key.ID).Error; err != nil {
+			return err
+		}
+		created.APIKeyID = &key.ID
+		webhook = created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// Unsubscribe removes a webhook registered with an API key
+func (s *Service) Unsubscribe(keyID, webhookID uint64) error {
+	result := s.db.Where("id = ? AND api_key_id = ?", webhookID, keyID).Delete(&domain.WebhookConfig{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHookNotFound
+	}
+	return nil
+}
+
+// IsEvent reports whether an event can be subscribed to
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func isAutomationKey(key *domain.APIKey) bool {
+	enabled, _ := key.Permissions[keyPermission].(bool)
+	return enabled
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Key is a newly issued API key with its secret
+type Key struct {
+	APIKey domain.APIKey
+	Secret string
+}
@@ -0,0 +1,495 @@
+package bulk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/order"
+	"github.com/openhost/openhost/internal/core/service/payment"
+)
+
+var (
+	ErrUnknownOperation = errors.New("unknown bulk operation")
+	ErrNoTargets        = errors.New("no records match the given filter")
+	ErrEmptyFilter      = errors.New("at least one filter is required")
+	ErrInvalidAmount    = errors.New("amount must be greater than 0")
+	ErrInvalidPercent   = errors.New("percent must be non-zero and greater than -100")
+	ErrJobNotFound      = errors.New("bulk job not found")
+)
+
+// Operations supported by the bulk API
+const (
+	OpSuspendServices   = "suspend_services"
+	OpUnsuspendServices = "unsuspend_services"
+	OpTerminateServices = "terminate_services"
+	OpAddCredit         = "add_credit"
+	OpAdjustPricing     = "adjust_pricing"
+)
+
+// TaskType is the SystemTask type used to track bulk jobs
+const TaskType = "bulk_operation"
+
+// Job statuses, stored in SystemTask.Status
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const maxErrors = 100
+
+// EnqueueFunc hands a stored bulk job to the job queue
+type EnqueueFunc func(jobID uint64) error
+
+// Service runs admin operations across many records as background jobs
+type Service struct {
+	db      *gorm.DB
+	enqueue EnqueueFunc
+}
+
+// NewService creates a new bulk service. When enqueue is nil, jobs are run
+// in a goroutine of the current process.
+func NewService(db *gorm.DB, enqueue EnqueueFunc) *Service {
+	return &Service{db: db, enqueue: enqueue}
+}
+
+// Submit validates a request, snapshots the matching record IDs and queues
+// the job. The returned task can be polled with GetJob.
+func (s *Service) Submit(req Request) (*domain.SystemTask, error) {
+	targets, err := s.resolveTargets(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	req.TargetIDs = targets
+
+	data, err := toJSONMap(req)
+	if err != nil {
+		return nil, err
+	}
+	result, err := toJSONMap(Progress{Total: len(targets)})
+	if err != nil {
+		return nil, err
+	}
+
+	task := &domain.SystemTask{
+		Type:        TaskType,
+		Status:      StatusPending,
+		Data:        data,
+		Result:      result,
+		ScheduledAt: time.Now(),
+		MaxAttempts: 3,
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, err
+	}
+
+	if s.enqueue == nil {
+		go func() {
+			if err := s.Execute(task.ID); err != nil {
+				log.Printf("bulk job %d failed: %v", task.ID, err)
+			}
+		}()
+		return task, nil
+	}
+
+	if err := s.enqueue(task.ID); err != nil {
+		s.db.Model(task).Updates(map[string]interface{}{
+			"status": StatusFailed,
+			"error":  fmt.Sprintf("enqueue: %v", err),
+		})
+		return nil, err
+	}
+	return task, nil
+}
+
+// Targets validates a request and returns the IDs of the records it would
+// change now, without queueing anything
+func (s *Service) Targets(req Request) ([]uint64, error) {
+	targets, err := s.resolveTargets(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	return targets, nil
+}
+
+// GetJob returns a bulk job with its progress
+func (s *Service) GetJob(id uint64) (*domain.SystemTask, error) {
+	var task domain.SystemTask
+	if err := s.db.Where("type = ?", TaskType).First(&task, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ListJobs returns bulk jobs, newest first
+func (s *Service) ListJobs(status string, limit, offset int) ([]domain.SystemTask, int64, error) {
+	var tasks []domain.SystemTask
+	var total int64
+
+	query := s.db.Model(&domain.SystemTask{}).Where("type = ?", TaskType)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return tasks, total, nil
+}
+
+// Execute runs a stored bulk job. Each record is changed in the same
+// transaction that saves the progress, so a job interrupted part way is
+// resumed after the last record changed and none is changed twice.
+func (s *Service) Execute(jobID uint64) error {
+	task, err := s.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	if task.Status == StatusCompleted {
+		return nil
+	}
+
+	var req Request
+	if err := fromJSONMap(task.Data, &req); err != nil {
+		return s.fail(task, fmt.Errorf("decode request: %w", err))
+	}
+	var progress Progress
+	if err := fromJSONMap(task.Result, &progress); err != nil {
+		return s.fail(task, fmt.Errorf("decode progress: %w", err))
+	}
+	progress.Total = len(req.TargetIDs)
+
+	if _, err := s.operation(s.db, req); err != nil {
+		return s.fail(task, err)
+	}
+
+	now := time.Now()
+	if err := s.db.Model(task).Updates(map[string]interface{}{
+		"status":     StatusRunning,
+		"started_at": &now,
+		"attempts":   task.Attempts + 1,
+	}).Error; err != nil {
+		return err
+	}
+
+	for i := progress.Processed; i < len(req.TargetIDs); i++ {
+		next, err := s.executeOne(task, req, progress, req.TargetIDs[i])
+		if err != nil {
+			return err
+		}
+		progress = next
+	}
+
+	result, err := toJSONMap(progress)
+	if err != nil {
+		return err
+	}
+	completed := time.Now()
+	return s.db.Model(task).Updates(map[string]interface{}{
+		"status":       StatusCompleted,
+		"result":       result,
+		"completed_at": &completed,
+	}).Error
+}
+
+// executeOne applies the operation to one record and saves the progress
+// after it in one transaction. A record that fails is rolled back to a
+// savepoint and counted as failed.
+func (s *Service) executeOne(task *domain.SystemTask, req Request, progress Progress, id uint64) (Progress, error) {
+	next := progress
+	next.Errors = append([]ItemError(nil), progress.Errors...)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		applyErr := tx.Transaction(func(tx *gorm.DB) error {
+			apply, err := s.operation(tx, req)
+			if err != nil {
+				return err
+			}
+			return apply(id)
+		})
+		if applyErr != nil {
+			next.Failed++
+			if len(next.Errors) < maxErrors {
+				next.Errors = append(next.Errors, ItemError{ID: id, Error: applyErr.Error()})
+			}
+		} else {
+			next.Succeeded++
+		}
+		next.Processed++
+
+		result, err := toJSONMap(next)
+		if err != nil {
+			return err
+		}
+		return tx.Model(task).Update("result", result).Error
+	})
+	if err != nil {
+		return progress, err
+	}
+	return next, nil
+}
+
+func (s *Service) fail(task *domain.SystemTask, cause error) error {
+	now := time.Now()
+	s.db.Model(task).Updates(map[string]interface{}{
+		"status":       StatusFailed,
+		"error":        cause.Error(),
+		"completed_at": &now,
+	})
+	return cause
+}
+
+// --- Targets ---
+
+func (s *Service) resolveTargets(req Request) ([]uint64, error) {
+	switch req.Operation {
+	case OpSuspendServices, OpUnsuspendServices, OpTerminateServices:
+		return s.serviceTargets(req.Operation, req.Services)
+	case OpAddCredit:
+		if !req.Amount.GreaterThan(decimal.Zero) {
+			return nil, ErrInvalidAmount
+		}
+		return s.customerTargets(req.CustomerIDs)
+	case OpAdjustPricing:
+		if req.Percent.IsZero() || req.Percent.LessThanOrEqual(decimal.NewFromInt(-100)) {
+			return nil, ErrInvalidPercent
+		}
+		return s.pricingTargets(req.Pricing)
+	default:
+		return nil, ErrUnknownOperation
+	}
+}
+
+func (s *Service) serviceTargets(op string, filter ServiceFilter) ([]uint64, error) {
+	if len(filter.ServiceIDs) == 0 && len(filter.ProductIDs) == 0 && len(filter.CustomerIDs) == 0 &&
+		filter.ServerID == nil && filter.Status == "" {
+		return nil, ErrEmptyFilter
+	}
+
+	query := s.db.Model(&domain.Service{})
+	if len(filter.ServiceIDs) > 0 {
+		query = query.Where("id IN ?", filter.ServiceIDs)
+	}
+	if len(filter.ProductIDs) > 0 {
+		query = query.Where("product_id IN ?", filter.ProductIDs)
+	}
+	if len(filter.CustomerIDs) > 0 {
+		query = query.Where("customer_id IN ?", filter.CustomerIDs)
+	}
+	if filter.ServerID != nil {
+		query = query.Where("server_id = ?", *filter.ServerID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	// Skip services the operation would not change
+	switch op {
+	case OpSuspendServices:
+		query = query.Where("status = ?", domain.ServiceStatusActive)
+	case OpUnsuspendServices:
+		query = query.Where("status = ?", domain.ServiceStatusSuspended)
+	case OpTerminateServices:
+		query = query.Where("status <> ?", domain.ServiceStatusTerminated)
+	}
+
+	var ids []uint64
+	err := query.Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (s *Service) customerTargets(customerIDs []uint64) ([]uint64, error) {
+	if len(customerIDs) == 0 {
+		return nil, ErrEmptyFilter
+	}
+	var ids []uint64
+	err := s.db.Model(&domain.User{}).Where("id IN ?", customerIDs).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (s *Service) pricingTargets(filter PricingFilter) ([]uint64, error) {
+	if len(filter.ProductIDs) == 0 && filter.ProductGroupID == 0 {
+		return nil, ErrEmptyFilter
+	}
+
+	query := s.db.Model(&domain.ProductPricing{})
+	if len(filter.ProductIDs) > 0 {
+		query = query.Where("product_id IN ?", filter.ProductIDs)
+	}
+	if filter.ProductGroupID != 0 {
+		query = query.Where("product_id IN (?)",
+			s.db.Model(&domain.Product{}).Select("id").Where("product_group_id = ?", filter.ProductGroupID))
+	}
+	if filter.Currency != "" {
+		query = query.Where("currency = ?", filter.Currency)
+	}
+
+	var ids []uint64
+	err := query.Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// --- Operations ---
+
+// operation returns the change of a request for one record, made on db
+func (s *Service) operation(db *gorm.DB, req Request) (func(id uint64) error, error) {
+	orders := order.NewService(db)
+
+	switch req.Operation {
+	case OpSuspendServices:
+		return func(id uint64) error {
+			return orders.SuspendService(id, req.Reason)
+		}, nil
+	case OpUnsuspendServices:
+		return orders.UnsuspendService, nil
+	case OpTerminateServices:
+		return orders.TerminateService, nil
+	case OpAddCredit:
+		payments := payment.NewService(db)
+		currency := req.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+		return func(id uint64) error {
+			_, err := payments.AddCredit(id, req.Amount, currency, req.Reason, req.StaffID)
+			return err
+		}, nil
+	case OpAdjustPricing:
+		return func(id uint64) error {
+			return adjustPricing(db, id, req.Percent, req.Pricing.Cycles)
+		}, nil
+	default:
+		return nil, ErrUnknownOperation
+	}
+}
+
+// adjustPricing changes the enabled cycle prices of one pricing row by
+// percent. Disabled cycles (negative prices) are left untouched.
+func adjustPricing(db *gorm.DB, pricingID uint64, percent decimal.Decimal, cycles []string) error {
+	var pricing domain.ProductPricing
+	if err := db.First(&pricing, pricingID).Error; err != nil {
+		return err
+	}
+
+	factor := decimal.NewFromInt(1).Add(percent.Div(decimal.NewFromInt(100)))
+	columns := map[string]decimal.Decimal{
+		"monthly":      pricing.Monthly,
+		"quarterly":    pricing.Quarterly,
+		"semiannually": pricing.SemiAnnually,
+		"annually":     pricing.Annually,
+		"biennially":   pricing.Biennially,
+		"triennially":  pricing.Triennially,
+	}
+	if len(cycles) == 0 {
+		cycles = []string{"monthly", "quarterly", "semiannually", "annually", "biennially", "triennially"}
+	}
+
+	updates := map[string]interface{}{}
+	for _, cycle := range cycles {
+		price, ok := columns[cycle]
+		if !ok {
+			return fmt.Errorf("unknown billing cycle %q", cycle)
+		}
+		if price.IsNegative() {
+			continue
+		}
+		column := cycle
+		if cycle == "semiannually" {
+			column = "semi_annually"
+		}
+		updates[column] = price.Mul(factor).Round(2)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return db.Model(&pricing).Updates(updates).Error
+}
+
+// --- Helpers ---
+
+func toJSONMap(v interface{}) (domain.JSONMap, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m domain.JSONMap
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func fromJSONMap(m domain.JSONMap, v interface{}) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// Request describes a bulk operation and the records it applies to
+type Request struct {
+	Operation   string          `json:"operation"`
+	Services    ServiceFilter   `json:"services,omitempty"`
+	CustomerIDs []uint64        `json:"customer_ids,omitempty"`
+	Pricing     PricingFilter   `json:"pricing,omitempty"`
+	Amount      decimal.Decimal `json:"amount"`
+	Currency    string          `json:"currency,omitempty"`
+	Percent     decimal.Decimal `json:"percent"`
+	Reason      string          `json:"reason,omitempty"`
+	StaffID     *uint64         `json:"staff_id,omitempty"`
+	// TargetIDs is filled by Submit with the records matched at submit time
+	TargetIDs []uint64 `json:"target_ids,omitempty"`
+}
+
+// ServiceFilter selects services for the service operations
+type ServiceFilter struct {
+	ServiceIDs  []uint64 `json:"service_ids,omitempty"`
+	ProductIDs  []uint64 `json:"product_ids,omitempty"`
+	CustomerIDs []uint64 `json:"customer_ids,omitempty"`
+	ServerID    *uint64  `json:"server_id,omitempty"`
+	Status      string   `json:"status,omitempty"`
+}
+
+// PricingFilter selects pricing rows for OpAdjustPricing
+type PricingFilter struct {
+	ProductIDs     []uint64 `json:"product_ids,omitempty"`
+	ProductGroupID uint64   `json:"product_group_id,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	Cycles         []string `json:"cycles,omitempty"`
+}
+
+// Progress is stored in SystemTask.Result while a job runs
+type Progress struct {
+	Total     int         `json:"total"`
+	Processed int         `json:"processed"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Errors    []ItemError `json:"errors,omitempty"`
+}
+
+// ItemError records why a single record failed
+type ItemError struct {
+	ID    uint64 `json:"id"`
+	Error string `json:"error"`
+}
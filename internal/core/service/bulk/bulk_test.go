@@ -0,0 +1,98 @@
+package bulk
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// TestExecuteResumesWithoutReapplying interrupts a credit job part way and
+// checks that running it again credits every customer exactly once
+func TestExecuteResumesWithoutReapplying(t *testing.T) {
+	db := testutil.OpenDB(t)
+
+	var customerIDs []uint64
+	for i := 0; i < 10; i++ {
+		customer := &domain.User{
+			Email:        fmt.Sprintf("customer%d@example.com", i),
+			PasswordHash: "x",
+			Role:         domain.UserRoleCustomer,
+			Status:       domain.UserStatusActive,
+		}
+		if err := db.Create(customer).Error; err != nil {
+			t.Fatal(err)
+		}
+		customerIDs = append(customerIDs, customer.ID)
+	}
+
+	service := NewService(db, func(uint64) error { return nil })
+	task, err := service.Submit(Request{
+		Operation:   OpAddCredit,
+		CustomerIDs: customerIDs,
+		Amount:      decimal.NewFromInt(5),
+		Currency:    "USD",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail saving the progress after the fourth customer, as a crash of
+	// the worker would
+	crash := errors.New("worker crashed")
+	saves := 0
+	if err := db.Callback().Update().Before("gorm:update").Register("test:crash", func(tx *gorm.DB) {
+		values, _ := tx.Statement.Dest.(map[string]interface{})
+		if _, progress := values["result"]; tx.Statement.Table != "system_tasks" || !progress || values["status"] != nil {
+			return
+		}
+		saves++
+		if saves == 4 {
+			tx.AddError(crash)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Execute(task.ID); !errors.Is(err, crash) {
+		t.Fatalf("first run: got %v, want the crash", err)
+	}
+	if err := db.Callback().Update().Remove("test:crash"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Execute(task.ID); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	for _, id := range customerIDs {
+		var customer domain.User
+		if err := db.First(&customer, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !customer.Credit.Equal(decimal.NewFromInt(5)) {
+			t.Errorf("customer %d has credit %s, want 5", id, customer.Credit)
+		}
+		var adjustments int64
+		db.Model(&domain.CreditAdjustment{}).Where("customer_id = ?", id).Count(&adjustments)
+		if adjustments != 1 {
+			t.Errorf("customer %d has %d credit adjustments, want 1", id, adjustments)
+		}
+	}
+
+	job, err := service.GetJob(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress Progress
+	if err := fromJSONMap(job.Result, &progress); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusCompleted || progress.Processed != 10 || progress.Succeeded != 10 || progress.Failed != 0 {
+		t.Errorf("job ended %s with %+v, want completed with 10 succeeded", job.Status, progress)
+	}
+}
@@ -0,0 +1,544 @@
+package cancellation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/order"
+)
+
+var (
+	ErrServiceNotFound   = errors.New("service not found")
+	ErrServiceNotActive  = errors.New("only active or suspended services can be cancelled")
+	ErrInvalidType       = errors.New("invalid cancellation type")
+	ErrRequestExists     = errors.New("a cancellation request is already open for this service")
+	ErrRequestNotFound   = errors.New("cancellation request not found")
+	ErrRequestNotPending = errors.New("cancellation request is not awaiting approval")
+	ErrRequestNotOpen    = errors.New("cancellation request can no longer be withdrawn")
+	ErrOfferNotFound     = errors.New("retention offer not found")
+	ErrOfferNotAvailable = errors.New("retention offer is not available for this service")
+	ErrCouponNotFound    = errors.New("coupon not found")
+)
+
+const (
+	NotificationCancellationApproved = "cancellation_approved"
+	NotificationCancellationRejected = "cancellation_rejected"
+	NotificationServiceCancelled     = "service_cancelled"
+)
+
+// Service manages cancellation requests, the retention offers shown before
+// they are confirmed and the termination of approved cancellations
+type Service struct {
+	db     *gorm.DB
+	paused func() bool
+}
+
+// NewService creates a new cancellation service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetPause sets a check that holds back the terminations of Monitor while
+// it returns true, such as during maintenance
+func (s *Service) SetPause(paused func() bool) {
+	s.paused = paused
+}
+
+// --- Customer requests ---
+
+// AvailableOffers returns the retention offers a customer can accept
+// instead of cancelling a service. A service gets at most one offer.
+func (s *Service) AvailableOffers(customerID, serviceID uint64) ([]domain.RetentionOffer, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.availableOffers(service)
+}
+
+// AcceptOffer applies a retention offer to a customer's service. An open
+// request for the service is closed as retained; otherwise the acceptance
+// is recorded as a retained request.
+func (s *Service) AcceptOffer(customerID, serviceID, offerID uint64) (*domain.CancellationRequest, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	offers, err := s.availableOffers(service)
+	if err != nil {
+		return nil, err
+	}
+	var offer *domain.RetentionOffer
+	for i := range offers {
+		if offers[i].ID == offerID {
+			offer = &offers[i]
+			break
+		}
+	}
+	if offer == nil {
+		return nil, ErrOfferNotAvailable
+	}
+
+	// Once a cancellation is approved its renewal invoices are cancelled,
+	// so it has to be withdrawn rather than retained
+	request, err := s.openRequest(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if request != nil && request.Status == domain.CancellationStatusApproved {
+		return nil, ErrOfferNotAvailable
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if request == nil {
+			request = &domain.CancellationRequest{
+				ServiceID:        serviceID,
+				CustomerID:       customerID,
+				Type:             domain.CancellationTypeEndOfCycle,
+				Status:           domain.CancellationStatusRetained,
+				RetentionOfferID: &offer.ID,
+			}
+			if err := tx.Create(request).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(request).Updates(map[string]interface{}{
+			"status":             domain.CancellationStatusRetained,
+			"retention_offer_id": offer.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&domain.Coupon{}).Where("id = ?", offer.CouponID).
+			Update("current_uses", gorm.Expr("current_uses + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRequest(request.ID)
+}
+
+// RequestCancellation submits a customer's request to cancel a service,
+// either immediately or at the end of the current billing cycle. The
+// request awaits admin approval.
+func (s *Service) RequestCancellation(customerID, serviceID uint64, cancellationType domain.CancellationType, reason string) (*domain.CancellationRequest, error) {
+	if cancellationType != domain.CancellationTypeImmediate && cancellationType != domain.CancellationTypeEndOfCycle {
+		return nil, ErrInvalidType
+	}
+
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if service.Status != domain.ServiceStatusActive && service.Status != domain.ServiceStatusSuspended {
+		return nil, ErrServiceNotActive
+	}
+
+	open, err := s.openRequest(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if open != nil {
+		return nil, ErrRequestExists
+	}
+
+	request := &domain.CancellationRequest{
+		ServiceID:  serviceID,
+		CustomerID: customerID,
+		Type:       cancellationType,
+		Reason:     reason,
+		Status:     domain.CancellationStatusPending,
+	}
+	if err := s.db.Create(request).Error; err != nil {
+		return nil, err
+	}
+	return s.GetRequest(request.ID)
+}
+
+// GetServiceRequest returns the latest cancellation request of a
+// customer's service
+func (s *Service) GetServiceRequest(customerID, serviceID uint64) (*domain.CancellationRequest, error) {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return nil, err
+	}
+
+	var request domain.CancellationRequest
+	result := s.db.Preload("Service.Product").Preload("RetentionOffer.Coupon").
+		Where("service_id = ?", serviceID).Order("id DESC").Limit(1).Find(&request)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRequestNotFound
+	}
+	return &request, nil
+}
+
+// WithdrawRequest withdraws the open cancellation request of a customer's
+// service, including an approved one until the service is terminated
+func (s *Service) WithdrawRequest(customerID, serviceID uint64) error {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return err
+	}
+
+	request, err := s.openRequest(serviceID)
+	if err != nil {
+		return err
+	}
+	if request == nil {
+		return ErrRequestNotOpen
+	}
+
+	return s.db.Model(request).Updates(map[string]interface{}{
+		"status":        domain.CancellationStatusWithdrawn,
+		"scheduled_for": nil,
+	}).Error
+}
+
+// --- Approval ---
+
+// GetRequest retrieves a cancellation request by ID
+func (s *Service) GetRequest(id uint64) (*domain.CancellationRequest, error) {
+	var request domain.CancellationRequest
+	if err := s.db.Preload("Service.Product").Preload("Customer").Preload("RetentionOffer.Coupon").
+		First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// ListRequests lists cancellation requests, optionally by status, oldest
+// first so the approval queue is worked in order
+func (s *Service) ListRequests(status domain.CancellationStatus, limit, offset int) ([]domain.CancellationRequest, int64, error) {
+	var requests []domain.CancellationRequest
+	var total int64
+
+	query := s.db.Model(&domain.CancellationRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Count(&total)
+
+	if err := query.Preload("Service.Product").Preload("Customer").Preload("RetentionOffer.Coupon").
+		Order("created_at, id").
+		Limit(limit).Offset(offset).
+		Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
+
+// ApproveRequest approves a pending request. Immediate cancellations are
+// terminated straight away, end of cycle ones are scheduled for the
+// service's next due date. Unpaid renewal invoices for periods after the
+// termination are cancelled.
+func (s *Service) ApproveRequest(id, adminID uint64, notes string) (*domain.CancellationRequest, error) {
+	request, err := s.GetRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != domain.CancellationStatusPending {
+		return nil, ErrRequestNotPending
+	}
+
+	now := time.Now()
+	scheduledFor := now
+	if request.Type == domain.CancellationTypeEndOfCycle && request.Service.NextDueDate.After(now) {
+		scheduledFor = request.Service.NextDueDate
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(request).Updates(map[string]interface{}{
+			"status":        domain.CancellationStatusApproved,
+			"scheduled_for": &scheduledFor,
+			"reviewed_by":   adminID,
+			"reviewed_at":   &now,
+			"admin_notes":   notes,
+		}).Error; err != nil {
+			return err
+		}
+		return cancelRenewalInvoices(tx, request.ServiceID, scheduledFor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Type == domain.CancellationTypeImmediate {
+		if err := s.complete(request, now); err != nil {
+			return nil, err
+		}
+	} else {
+		title := fmt.Sprintf("Cancellation of %s approved", request.Service.Product.Name)
+		message := fmt.Sprintf("Your %s service will be terminated on %s and will not be renewed.",
+			request.Service.Product.Name, scheduledFor.Format("Jan 2, 2006"))
+		link := fmt.Sprintf("/client/services/%d", request.ServiceID)
+		if err := notification.NewService(s.db).SendNotification(request.CustomerID, NotificationCancellationApproved, title, message, link); err != nil {
+			log.Printf("failed to notify approval of cancellation %d: %v", request.ID, err)
+		}
+	}
+	return s.GetRequest(id)
+}
+
+// RejectRequest rejects a pending request
+func (s *Service) RejectRequest(id, adminID uint64, notes string) (*domain.CancellationRequest, error) {
+	request, err := s.GetRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != domain.CancellationStatusPending {
+		return nil, ErrRequestNotPending
+	}
+
+	now := time.Now()
+	if err := s.db.Model(request).Updates(map[string]interface{}{
+		"status":      domain.CancellationStatusRejected,
+		"reviewed_by": adminID,
+		"reviewed_at": &now,
+		"admin_notes": notes,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	title := fmt.Sprintf("Cancellation of %s declined", request.Service.Product.Name)
+	message := fmt.Sprintf("Your request to cancel %s was declined.", request.Service.Product.Name)
+	if notes != "" {
+		message += " " + notes
+	}
+	link := fmt.Sprintf("/client/services/%d", request.ServiceID)
+	if err := notification.NewService(s.db).SendNotification(request.CustomerID, NotificationCancellationRejected, title, message, link); err != nil {
+		log.Printf("failed to notify rejection of cancellation %d: %v", request.ID, err)
+	}
+	return s.GetRequest(id)
+}
+
+// ProcessScheduled terminates the services of approved requests that are
+// due and returns how many were terminated
+func (s *Service) ProcessScheduled(now time.Time) (int, error) {
+	var requests []domain.CancellationRequest
+	if err := s.db.Preload("Service.Product").
+		Where("status = ? AND scheduled_for <= ?", domain.CancellationStatusApproved, now).
+		Find(&requests).Error; err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for i := range requests {
+		if err := s.complete(&requests[i], now); err != nil {
+			log.Printf("failed to complete cancellation %d: %v", requests[i].ID, err)
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// Monitor terminates services with due cancellations on the given interval
+// until ctx is cancelled
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.paused == nil || !s.paused() {
+			if n, err := s.ProcessScheduled(time.Now()); err != nil {
+				log.Printf("failed to process cancellations: %v", err)
+			} else if n > 0 {
+				log.Printf("terminated %d cancelled service(s)", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// --- Retention offers ---
+
+// ListOffers returns every retention offer
+func (s *Service) ListOffers() ([]domain.RetentionOffer, error) {
+	var offers []domain.RetentionOffer
+	if err := s.db.Preload("Coupon").Preload("Product").
+		Order("sort_order, id").Find(&offers).Error; err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// CreateOffer creates a retention offer
+func (s *Service) CreateOffer(offer *domain.RetentionOffer) (*domain.RetentionOffer, error) {
+	if err := s.validateOffer(offer); err != nil {
+		return nil, err
+	}
+
+	active := offer.Active
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(offer).Error; err != nil {
+			return err
+		}
+		// Written explicitly so false is not replaced by the column default
+		return tx.Model(offer).Update("active", active).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getOffer(offer.ID)
+}
+
+// UpdateOffer replaces the details of a retention offer
+func (s *Service) UpdateOffer(id uint64, offer *domain.RetentionOffer) (*domain.RetentionOffer, error) {
+	if _, err := s.getOffer(id); err != nil {
+		return nil, err
+	}
+	if err := s.validateOffer(offer); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&domain.RetentionOffer{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":        offer.Name,
+		"description": offer.Description,
+		"product_id":  offer.ProductID,
+		"coupon_id":   offer.CouponID,
+		"active":      offer.Active,
+		"sort_order":  offer.SortOrder,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return s.getOffer(id)
+}
+
+// DeleteOffer deletes a retention offer. Offers already accepted keep
+// discounting renewals, so they are deactivated instead.
+func (s *Service) DeleteOffer(id uint64) error {
+	if _, err := s.getOffer(id); err != nil {
+		return err
+	}
+
+	var accepted int64
+	if err := s.db.Model(&domain.CancellationRequest{}).Where("retention_offer_id = ?", id).Count(&accepted).Error; err != nil {
+		return err
+	}
+	if accepted > 0 {
+		return s.db.Model(&domain.RetentionOffer{}).Where("id = ?", id).Update("active", false).Error
+	}
+	return s.db.Delete(&domain.RetentionOffer{}, id).Error
+}
+
+// complete terminates the service of an approved request
+func (s *Service) complete(request *domain.CancellationRequest, now time.Time) error {
+	if err := order.NewService(s.db).TerminateService(request.ServiceID); err != nil {
+		return err
+	}
+	if err := s.db.Model(request).Updates(map[string]interface{}{
+		"status":       domain.CancellationStatusCompleted,
+		"completed_at": &now,
+	}).Error; err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("%s cancelled", request.Service.Product.Name)
+	message := fmt.Sprintf("Your %s service has been cancelled and terminated.", request.Service.Product.Name)
+	if err := notification.NewService(s.db).SendNotification(request.CustomerID, NotificationServiceCancelled, title, message, "/client/services"); err != nil {
+		log.Printf("failed to notify completion of cancellation %d: %v", request.ID, err)
+	}
+	return nil
+}
+
+// availableOffers returns the active offers with a valid coupon for the
+// product of a service that has not been retained before
+func (s *Service) availableOffers(service *domain.Service) ([]domain.RetentionOffer, error) {
+	var retained int64
+	if err := s.db.Model(&domain.CancellationRequest{}).
+		Where("service_id = ? AND status = ?", service.ID, domain.CancellationStatusRetained).
+		Count(&retained).Error; err != nil {
+		return nil, err
+	}
+	if retained > 0 {
+		return []domain.RetentionOffer{}, nil
+	}
+
+	var offers []domain.RetentionOffer
+	if err := s.db.Preload("Coupon").
+		Where("active = ? AND (product_id IS NULL OR product_id = ?)", true, service.ProductID).
+		Order("sort_order, id").Find(&offers).Error; err != nil {
+		return nil, err
+	}
+
+	available := make([]domain.RetentionOffer, 0, len(offers))
+	for _, offer := range offers {
+		if offer.Coupon.IsValid() {
+			available = append(available, offer)
+		}
+	}
+	return available, nil
+}
+
+// openRequest returns the pending or approved request of a service, or nil
+func (s *Service) openRequest(serviceID uint64) (*domain.CancellationRequest, error) {
+	var request domain.CancellationRequest
+	result := s.db.Where("service_id = ? AND status IN ?", serviceID,
+		[]domain.CancellationStatus{domain.CancellationStatusPending, domain.CancellationStatusApproved}).
+		Limit(1).Find(&request)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &request, nil
+}
+
+// customerService loads a service of a customer
+func (s *Service) customerService(customerID, serviceID uint64) (*domain.Service, error) {
+	var service domain.Service
+	result := s.db.Where("id = ? AND customer_id = ?", serviceID, customerID).Limit(1).Find(&service)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return &service, nil
+}
+
+func (s *Service) getOffer(id uint64) (*domain.RetentionOffer, error) {
+	var offer domain.RetentionOffer
+	if err := s.db.Preload("Coupon").Preload("Product").First(&offer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOfferNotFound
+		}
+		return nil, err
+	}
+	return &offer, nil
+}
+
+func (s *Service) validateOffer(offer *domain.RetentionOffer) error {
+	var count int64
+	if err := s.db.Model(&domain.Coupon{}).Where("id = ?", offer.CouponID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// cancelRenewalInvoices cancels the unpaid invoices billing a service for
+// periods starting on or after from. Consolidated invoices only lose the
+// lines of the service.
+func cancelRenewalInvoices(tx *gorm.DB, serviceID uint64, from time.Time) error {
+	return invoice.CancelServiceRenewals(tx, serviceID, from)
+}
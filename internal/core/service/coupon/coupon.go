@@ -0,0 +1,333 @@
+// Package coupon generates batches of single-use coupon codes from a
+// pattern, such as BF25-XXXXXX, and reports on their redemption.
+package coupon
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrBatchNotFound   = errors.New("coupon batch not found")
+	ErrNameRequired    = errors.New("batch name is required")
+	ErrInvalidQuantity = errors.New("quantity must be between 1 and 10000")
+	ErrInvalidPattern  = errors.New("pattern must have at most 50 characters and enough X placeholders for the quantity")
+	ErrInvalidType     = errors.New("type must be percentage, fixed, override or free_setup")
+	ErrInvalidAmount   = errors.New("amount must not be negative")
+)
+
+const (
+	// MaxBatchSize is the most codes a batch can have
+	MaxBatchSize = 10000
+	// placeholder is the character of a pattern replaced with a random one
+	placeholder = 'X'
+	// codeAlphabet leaves out characters easily mistaken for one another
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// insertBatch is the number of coupons inserted at once
+	insertBatch = 500
+)
+
+// Service generates and reports on coupon batches
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new coupon service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// BatchInput describes a batch to generate: the pattern of its codes and
+// the rules they share
+type BatchInput struct {
+	Name           string
+	Pattern        string
+	Quantity       int
+	Description    string
+	Type           domain.CouponType
+	Amount         decimal.Decimal
+	Currency       string
+	BillingCycles  int
+	MinOrderAmount decimal.Decimal
+	AppliesToNew   bool
+	AppliesToRenew bool
+	ProductIDs     []uint64
+	StartsAt       *time.Time
+	ExpiresAt      *time.Time
+}
+
+// BatchReport is how many codes of a batch were redeemed, and by whom
+type BatchReport struct {
+	Batch       domain.CouponBatch
+	Redeemed    int64
+	Redemptions []domain.Coupon // Redeemed codes, latest first
+}
+
+// RedemptionRate returns the share of the codes redeemed
+func (r *BatchReport) RedemptionRate() float64 {
+	if r.Batch.Quantity == 0 {
+		return 0
+	}
+	return float64(r.Redeemed) / float64(r.Batch.Quantity)
+}
+
+// GenerateBatch generates a batch of unique single-use codes. Codes that
+// exist already are drawn again.
+func (s *Service) GenerateBatch(input BatchInput, createdBy *uint64) (*domain.CouponBatch, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Pattern = strings.ToUpper(strings.TrimSpace(input.Pattern))
+	if input.Name == "" {
+		return nil, ErrNameRequired
+	}
+	if input.Quantity < 1 || input.Quantity > MaxBatchSize {
+		return nil, ErrInvalidQuantity
+	}
+	if !validPattern(input.Pattern, input.Quantity) {
+		return nil, ErrInvalidPattern
+	}
+	switch input.Type {
+	case domain.CouponTypePercentage, domain.CouponTypeFixed, domain.CouponTypeOverride, domain.CouponTypeFreeSetup:
+	default:
+		return nil, ErrInvalidType
+	}
+	if input.Amount.IsNegative() {
+		return nil, ErrInvalidAmount
+	}
+
+	var productIDs domain.JSONMap
+	if len(input.ProductIDs) > 0 {
+		productIDs = domain.JSONMap{"product_ids": input.ProductIDs}
+	}
+
+	batch := &domain.CouponBatch{
+		Name:      input.Name,
+		Pattern:   input.Pattern,
+		Quantity:  input.Quantity,
+		CreatedBy: createdBy,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err := uniqueCodes(tx, input.Pattern, input.Quantity)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+
+		coupons := make([]domain.Coupon, 0, len(codes))
+		for _, code := range codes {
+			coupons = append(coupons, domain.Coupon{
+				Code:           code,
+				Description:    input.Description,
+				Type:           input.Type,
+				Amount:         input.Amount,
+				Currency:       input.Currency,
+				Status:         domain.CouponStatusActive,
+				MaxUses:        1,
+				MaxUsesPerUser: 1,
+				BillingCycles:  input.BillingCycles,
+				MinOrderAmount: input.MinOrderAmount,
+				AppliesToNew:   input.AppliesToNew,
+				AppliesToRenew: input.AppliesToRenew,
+				ProductIDs:     productIDs,
+				StartsAt:       input.StartsAt,
+				ExpiresAt:      input.ExpiresAt,
+				BatchID:        &batch.ID,
+			})
+		}
+		return tx.CreateInBatches(coupons, insertBatch).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ListBatches returns the batches, newest first
+func (s *Service) ListBatches() ([]domain.CouponBatch, error) {
+	var batches []domain.CouponBatch
+	err := s.db.Order("created_at DESC").Find(&batches).Error
+	return batches, err
+}
+
+// Redeemed counts the redeemed codes of each batch, by batch ID
+func (s *Service) Redeemed() (map[uint64]int64, error) {
+	var rows []struct {
+		BatchID  uint64
+		Redeemed int64
+	}
+	if err := s.db.Model(&domain.Coupon{}).
+		Select("batch_id, COUNT(*) AS redeemed").
+		Where("batch_id IS NOT NULL AND redeemed_at IS NOT NULL").
+		Group("batch_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	redeemed := make(map[uint64]int64, len(rows))
+	for _, row := range rows {
+		redeemed[row.BatchID] = row.Redeemed
+	}
+	return redeemed, nil
+}
+
+// Report returns the redemptions of a batch
+func (s *Service) Report(batchID uint64) (*BatchReport, error) {
+	batch, err := s.getBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	report := &BatchReport{Batch: *batch}
+	if err := s.db.Where("batch_id = ? AND redeemed_at IS NOT NULL", batchID).
+		Order("redeemed_at DESC").Find(&report.Redemptions).Error; err != nil {
+		return nil, err
+	}
+	report.Redeemed = int64(len(report.Redemptions))
+	return report, nil
+}
+
+// WriteCodesCSV writes the codes of a batch as CSV, with who redeemed each
+// and when
+func (s *Service) WriteCodesCSV(w io.Writer, batchID uint64) error {
+	if _, err := s.getBatch(batchID); err != nil {
+		return err
+	}
+	var coupons []domain.Coupon
+	if err := s.db.Where("batch_id = ?", batchID).Order("id").Find(&coupons).Error; err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"code", "status", "redeemed_by", "order_id", "redeemed_at"}); err != nil {
+		return err
+	}
+	for _, coupon := range coupons {
+		record := []string{coupon.Code, string(coupon.Status), "", "", ""}
+		if coupon.RedeemedBy != nil {
+			record[2] = strconv.FormatUint(*coupon.RedeemedBy, 10)
+		}
+		if coupon.RedeemedOrderID != nil {
+			record[3] = strconv.FormatUint(*coupon.RedeemedOrderID, 10)
+		}
+		if coupon.RedeemedAt != nil {
+			record[4] = coupon.RedeemedAt.UTC().Format(time.RFC3339)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Redeem counts a use of a coupon by an order. It fails when the coupon
+// has been used up, so two orders cannot both take the last use.
+// Single-use codes of a batch record the customer and order.
+func Redeem(tx *gorm.DB, coupon *domain.Coupon, customerID, orderID uint64, now time.Time) (bool, error) {
+	updates := map[string]interface{}{"current_uses": gorm.Expr("current_uses + 1")}
+	if coupon.BatchID != nil {
+		updates["redeemed_by"] = customerID
+		updates["redeemed_order_id"] = orderID
+		updates["redeemed_at"] = now
+	}
+	result := tx.Model(&domain.Coupon{}).
+		Where("id = ? AND (max_uses = 0 OR current_uses < max_uses)", coupon.ID).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *Service) getBatch(id uint64) (*domain.CouponBatch, error) {
+	var batch domain.CouponBatch
+	if err := s.db.First(&batch, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBatchNotFound
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// validPattern reports whether a pattern fits the code column and has
+// room for at least a hundred times the codes asked for, so drawing
+// unique codes stays quick
+func validPattern(pattern string, quantity int) bool {
+	if pattern == "" || len(pattern) > 50 {
+		return false
+	}
+	space := big.NewInt(1)
+	alphabet := big.NewInt(int64(len(codeAlphabet)))
+	for _, r := range pattern {
+		if r == placeholder {
+			space.Mul(space, alphabet)
+		}
+	}
+	return space.Cmp(big.NewInt(int64(quantity)*100)) >= 0
+}
+
+// uniqueCodes draws codes from a pattern until it has the quantity asked
+// for, none of them in use by another coupon
+func uniqueCodes(tx *gorm.DB, pattern string, quantity int) ([]string, error) {
+	codes := make([]string, 0, quantity)
+	seen := make(map[string]bool, quantity)
+	for len(codes) < quantity {
+		draw := make([]string, 0, quantity-len(codes))
+		for len(draw) < quantity-len(codes) {
+			code, err := randomCode(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[code] {
+				seen[code] = true
+				draw = append(draw, code)
+			}
+		}
+
+		taken := make(map[string]bool)
+		for start := 0; start < len(draw); start += insertBatch {
+			end := start + insertBatch
+			if end > len(draw) {
+				end = len(draw)
+			}
+			var existing []string
+			if err := tx.Model(&domain.Coupon{}).Where("code IN ?", draw[start:end]).
+				Pluck("code", &existing).Error; err != nil {
+				return nil, err
+			}
+			for _, code := range existing {
+				taken[code] = true
+			}
+		}
+		for _, code := range draw {
+			if !taken[code] {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
+
+func randomCode(pattern string) (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for _, r := range pattern {
+		if r != placeholder {
+			b.WriteRune(r)
+			continue
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
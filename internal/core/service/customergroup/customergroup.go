@@ -0,0 +1,383 @@
+// Package customergroup manages customer groups, such as VIP, NET-30 or
+// resellers, and the terms they give their members: payment terms, tax
+// exemption, product prices and access to restricted products.
+//
+// Only active groups apply. A customer in several groups gets the payment
+// terms of the first group by sort order that sets them and the price of
+// the first group by sort order with a price for the product, and is tax
+// exempt when any of the groups is.
+package customergroup
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrGroupNotFound     = errors.New("customer group not found")
+	ErrNameRequired      = errors.New("group name is required")
+	ErrNameExists        = errors.New("a customer group with this name already exists")
+	ErrInvalidTerms      = errors.New("payment terms must be between 0 and 365 days")
+	ErrCustomerNotFound  = errors.New("customer not found")
+	ErrProductNotFound   = errors.New("product not found")
+	ErrPriceNotFound     = errors.New("group price not found")
+	ErrInvalidCurrency   = errors.New("currency must be a 3 letter code")
+	ErrInvalidGroupPrice = errors.New("prices must be -1 to keep the product price, or 0 and above")
+)
+
+// maxTermsDays is the longest payment terms a group can give
+const maxTermsDays = 365
+
+// Input is the editable fields of a customer group
+type Input struct {
+	Name             string
+	Description      string
+	Color            string
+	SortOrder        int
+	Active           bool
+	PaymentTermsDays *int
+	TaxExempt        bool
+}
+
+// Service manages customer groups
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new customer group service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// ListGroups returns the customer groups in sort order with their member
+// counts
+func (s *Service) ListGroups() ([]domain.CustomerGroup, map[uint64]int64, error) {
+	var groups []domain.CustomerGroup
+	if err := s.db.Order("sort_order, name").Find(&groups).Error; err != nil {
+		return nil, nil, err
+	}
+	var counts []struct {
+		CustomerGroupID uint64
+		Count           int64
+	}
+	if err := s.db.Model(&domain.CustomerGroupMembership{}).
+		Select("customer_group_id, COUNT(*) AS count").
+		Group("customer_group_id").
+		Scan(&counts).Error; err != nil {
+		return nil, nil, err
+	}
+	members := make(map[uint64]int64, len(counts))
+	for _, c := range counts {
+		members[c.CustomerGroupID] = c.Count
+	}
+	return groups, members, nil
+}
+
+// GetGroup returns a customer group
+func (s *Service) GetGroup(id uint64) (*domain.CustomerGroup, error) {
+	var group domain.CustomerGroup
+	if err := s.db.First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup creates a customer group
+func (s *Service) CreateGroup(input Input) (*domain.CustomerGroup, error) {
+	if err := s.validate(&input, 0); err != nil {
+		return nil, err
+	}
+	group := &domain.CustomerGroup{}
+	input.apply(group)
+	if err := s.db.Create(group).Error; err != nil {
+		return nil, err
+	}
+	// Create skips false for a column defaulting to true
+	if !input.Active {
+		if err := s.db.Model(group).Update("active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// UpdateGroup replaces the fields of a customer group
+func (s *Service) UpdateGroup(id uint64, input Input) (*domain.CustomerGroup, error) {
+	group, err := s.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(&input, id); err != nil {
+		return nil, err
+	}
+	input.apply(group)
+	if err := s.db.Model(group).Select("name", "description", "color", "sort_order", "active",
+		"payment_terms_days", "tax_exempt").Updates(group).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteGroup deletes a customer group with its memberships and prices
+func (s *Service) DeleteGroup(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&domain.CustomerGroup{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGroupNotFound
+		}
+		if err := tx.Where("customer_group_id = ?", id).Delete(&domain.CustomerGroupMembership{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("customer_group_id = ?", id).Delete(&domain.CustomerGroupPrice{}).Error
+	})
+}
+
+// ListMembers returns the customers of a group
+func (s *Service) ListMembers(groupID uint64) ([]domain.User, error) {
+	if _, err := s.GetGroup(groupID); err != nil {
+		return nil, err
+	}
+	var customers []domain.User
+	err := s.db.Where("id IN (?)", s.db.Model(&domain.CustomerGroupMembership{}).
+		Select("customer_id").Where("customer_group_id = ?", groupID)).
+		Order("id").Find(&customers).Error
+	return customers, err
+}
+
+// AddMember adds a customer to a group. Adding a member twice does nothing.
+func (s *Service) AddMember(groupID, customerID uint64) error {
+	if _, err := s.GetGroup(groupID); err != nil {
+		return err
+	}
+	var count int64
+	if err := s.db.Model(&domain.User{}).Where("id = ?", customerID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCustomerNotFound
+	}
+	membership := domain.CustomerGroupMembership{CustomerID: customerID, CustomerGroupID: groupID}
+	return s.db.Where("customer_id = ? AND customer_group_id = ?", customerID, groupID).
+		FirstOrCreate(&membership).Error
+}
+
+// RemoveMember removes a customer from a group
+func (s *Service) RemoveMember(groupID, customerID uint64) error {
+	return s.db.Where("customer_id = ? AND customer_group_id = ?", customerID, groupID).
+		Delete(&domain.CustomerGroupMembership{}).Error
+}
+
+// ListPrices returns the product prices of a group
+func (s *Service) ListPrices(groupID uint64) ([]domain.CustomerGroupPrice, error) {
+	if _, err := s.GetGroup(groupID); err != nil {
+		return nil, err
+	}
+	var prices []domain.CustomerGroupPrice
+	err := s.db.Preload("Product").Where("customer_group_id = ?", groupID).
+		Order("product_id, currency").Find(&prices).Error
+	return prices, err
+}
+
+// SetPrice sets the price of a product in a currency for a group. Only
+// the group ID, product ID, currency and prices of price are used.
+func (s *Service) SetPrice(price domain.CustomerGroupPrice) (*domain.CustomerGroupPrice, error) {
+	if _, err := s.GetGroup(price.CustomerGroupID); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&domain.Product{}).Where("id = ?", price.ProductID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrProductNotFound
+	}
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+	if len(price.Currency) != 3 {
+		return nil, ErrInvalidCurrency
+	}
+	minusOne := decimal.NewFromInt(-1)
+	for _, p := range []decimal.Decimal{price.SetupFee, price.Monthly, price.Quarterly, price.SemiAnnually,
+		price.Annually, price.Biennially, price.Triennially} {
+		if p.IsNegative() && !p.Equal(minusOne) {
+			return nil, ErrInvalidGroupPrice
+		}
+	}
+
+	existing := domain.CustomerGroupPrice{}
+	err := s.db.Where("customer_group_id = ? AND product_id = ? AND currency = ?",
+		price.CustomerGroupID, price.ProductID, price.Currency).
+		Assign(map[string]interface{}{
+			"setup_fee":     price.SetupFee,
+			"monthly":       price.Monthly,
+			"quarterly":     price.Quarterly,
+			"semi_annually": price.SemiAnnually,
+			"annually":      price.Annually,
+			"biennially":    price.Biennially,
+			"triennially":   price.Triennially,
+		}).
+		Attrs(domain.CustomerGroupPrice{
+			CustomerGroupID: price.CustomerGroupID,
+			ProductID:       price.ProductID,
+			Currency:        price.Currency,
+		}).
+		FirstOrCreate(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// DeletePrice removes the price of a product in a currency from a group
+func (s *Service) DeletePrice(groupID, productID uint64, currency string) error {
+	result := s.db.Where("customer_group_id = ? AND product_id = ? AND currency = ?",
+		groupID, productID, strings.ToUpper(currency)).Delete(&domain.CustomerGroupPrice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPriceNotFound
+	}
+	return nil
+}
+
+// CustomerGroups returns the active groups of a customer in sort order
+func CustomerGroups(db *gorm.DB, customerID uint64) ([]domain.CustomerGroup, error) {
+	var groups []domain.CustomerGroup
+	err := db.Where("active = ? AND id IN (?)", true, memberGroups(db, customerID)).
+		Order("sort_order, id").Find(&groups).Error
+	return groups, err
+}
+
+// PaymentTerms returns the days invoices of a customer are due after they
+// are issued, and false when none of their groups sets payment terms
+func PaymentTerms(db *gorm.DB, customerID uint64) (int, bool, error) {
+	groups, err := CustomerGroups(db, customerID)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, group := range groups {
+		if group.PaymentTermsDays != nil {
+			return *group.PaymentTermsDays, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// IsTaxExempt reports whether a customer is in a tax exempt group
+func IsTaxExempt(db *gorm.DB, customerID uint64) (bool, error) {
+	var count int64
+	err := db.Model(&domain.CustomerGroup{}).
+		Where("active = ? AND tax_exempt = ? AND id IN (?)", true, true, memberGroups(db, customerID)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ApplyPrices replaces the product prices of a pricing with those of the
+// customer's groups
+func ApplyPrices(db *gorm.DB, customerID uint64, pricing *domain.ProductPricing) error {
+	price, err := groupPrice(db, customerID, pricing.ProductID, pricing.Currency)
+	if err != nil || price == nil {
+		return err
+	}
+	price.ApplyTo(pricing)
+	return nil
+}
+
+// CanSee reports whether a customer can see and order a product. Products
+// not restricted are open to everyone; restricted products to the members
+// of groups with a price for them. Guests pass 0.
+func CanSee(db *gorm.DB, customerID uint64, product *domain.Product) (bool, error) {
+	if !product.Restricted {
+		return true, nil
+	}
+	if customerID == 0 {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&domain.CustomerGroupPrice{}).
+		Where("product_id = ?", product.ID).
+		Where("customer_group_id IN (?)", activeMemberGroups(db, customerID)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Visible restricts a product query to the products a customer can see.
+// Guests pass 0.
+func Visible(db *gorm.DB, query *gorm.DB, customerID uint64) *gorm.DB {
+	if customerID == 0 {
+		return query.Where("products.restricted = ?", false)
+	}
+	return query.Where("products.restricted = ? OR products.id IN (?)", false,
+		db.Model(&domain.CustomerGroupPrice{}).Select("product_id").
+			Where("customer_group_id IN (?)", activeMemberGroups(db, customerID)))
+}
+
+// groupPrice returns the price of the first group of a customer by sort
+// order with a price for a product in a currency, or nil
+func groupPrice(db *gorm.DB, customerID, productID uint64, currency string) (*domain.CustomerGroupPrice, error) {
+	if customerID == 0 {
+		return nil, nil
+	}
+	var price domain.CustomerGroupPrice
+	result := db.Joins("JOIN customer_groups ON customer_groups.id = customer_group_prices.customer_group_id").
+		Where("customer_group_prices.product_id = ? AND customer_group_prices.currency = ?", productID, currency).
+		Where("customer_groups.active = ? AND customer_groups.id IN (?)", true, memberGroups(db, customerID)).
+		Order("customer_groups.sort_order, customer_groups.id").
+		Limit(1).Find(&price)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &price, nil
+}
+
+func memberGroups(db *gorm.DB, customerID uint64) *gorm.DB {
+	return db.Model(&domain.CustomerGroupMembership{}).Select("customer_group_id").Where("customer_id = ?", customerID)
+}
+
+func activeMemberGroups(db *gorm.DB, customerID uint64) *gorm.DB {
+	return db.Model(&domain.CustomerGroup{}).Select("id").
+		Where("active = ? AND id IN (?)", true, memberGroups(db, customerID))
+}
+
+func (s *Service) validate(input *Input, id uint64) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return ErrNameRequired
+	}
+	if input.PaymentTermsDays != nil && (*input.PaymentTermsDays < 0 || *input.PaymentTermsDays > maxTermsDays) {
+		return ErrInvalidTerms
+	}
+	var count int64
+	if err := s.db.Model(&domain.CustomerGroup{}).Where("name = ? AND id <> ?", input.Name, id).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrNameExists
+	}
+	return nil
+}
+
+func (input Input) apply(group *domain.CustomerGroup) {
+	group.Name = input.Name
+	group.Description = input.Description
+	group.Color = input.Color
+	group.SortOrder = input.SortOrder
+	group.Active = input.Active
+	group.PaymentTermsDays = input.PaymentTermsDays
+	group.TaxExempt = input.TaxExempt
+}
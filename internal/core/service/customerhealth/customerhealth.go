@@ -0,0 +1,451 @@
+// Package customerhealth scores how likely customers are to stay, from how they
+// pay, what they write to support, which services they keep and when they
+// last signed in. Staff are alerted when a score drops.
+package customerhealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrCustomerNotFound = errors.New("customer not found")
+	ErrManagerNotFound  = errors.New("account manager must be a staff member")
+	ErrInvalidRisk      = errors.New("risk must be healthy, at_risk or high_risk")
+)
+
+// NotificationHealthDropped is the notification staff get when the score
+// of a customer drops
+const NotificationHealthDropped = "customer_health_dropped"
+
+// DefaultAlertDrop is the drop in points that alerts staff
+const DefaultAlertDrop = 15
+
+// Weights of the part scores in the health score, in percent
+const (
+	paymentWeight    = 35
+	supportWeight    = 20
+	usageWeight      = 25
+	engagementWeight = 20
+)
+
+const (
+	// paymentWindow is how far back invoices are scored
+	paymentWindow = 365 * 24 * time.Hour
+	// supportWindow is how far back tickets are scored
+	supportWindow = 90 * 24 * time.Hour
+	// gracePeriod is how late a payment may be and still count as on time
+	gracePeriod = 24 * time.Hour
+	// usualTickets is the number of tickets in the support window that
+	// costs no points
+	usualTickets = 3
+	// recomputeBatch is the number of customers scored at once
+	recomputeBatch = 100
+)
+
+// negativeTerms mark a customer message as unhappy
+var negativeTerms = []string{
+	"angry", "annoyed", "awful", "chargeback", "complain", "disappointed",
+	"frustrat", "horrible", "lawyer", "ridiculous", "terrible", "unacceptable",
+	"unhappy", "useless", "worst", "still not working", "cancel my", "refund",
+	"switch provider", "move to another",
+	"投诉", "失望", "退款", "太差", "垃圾", "取消",
+}
+
+// Service computes customer health scores
+type Service struct {
+	db        *gorm.DB
+	alertDrop int
+}
+
+// NewService creates a new health service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, alertDrop: DefaultAlertDrop}
+}
+
+// SetAlertDrop sets the drop in points that alerts staff; zero keeps the
+// default
+func (s *Service) SetAlertDrop(points int) {
+	if points > 0 {
+		s.alertDrop = points
+	}
+}
+
+// Get returns the health of a customer, computing it when it was never
+// computed
+func (s *Service) Get(customerID uint64) (*domain.CustomerHealth, error) {
+	var health domain.CustomerHealth
+	result := s.db.Where("customer_id = ?", customerID).Limit(1).Find(&health)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return s.Compute(customerID, time.Now())
+	}
+	return &health, nil
+}
+
+// List returns the customer health scores, lowest first, optionally of
+// one risk group
+func (s *Service) List(risk domain.HealthRisk, limit, offset int) ([]domain.CustomerHealth, int64, error) {
+	query := s.db.Model(&domain.CustomerHealth{})
+	if risk != "" {
+		if !risk.Valid() {
+			return nil, 0, ErrInvalidRisk
+		}
+		query = query.Where("risk = ?", risk)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var healths []domain.CustomerHealth
+	if err := query.Order("score ASC, customer_id ASC").
+		Limit(limit).Offset(offset).Find(&healths).Error; err != nil {
+		return nil, 0, err
+	}
+	return healths, total, nil
+}
+
+// Compute scores a customer, saves the result and alerts staff when the
+// score dropped
+func (s *Service) Compute(customerID uint64, now time.Time) (*domain.CustomerHealth, error) {
+	var customer domain.User
+	result := s.db.Where("role = ?", domain.UserRoleCustomer).Limit(1).Find(&customer, customerID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCustomerNotFound
+	}
+	return s.compute(&customer, now)
+}
+
+// RecomputeAll scores every active customer and returns how many were
+// scored
+func (s *Service) RecomputeAll(now time.Time) (int, error) {
+	var customers []domain.User
+	count := 0
+	err := s.db.Where("role = ? AND status = ?", domain.UserRoleCustomer, domain.UserStatusActive).
+		FindInBatches(&customers, recomputeBatch, func(tx *gorm.DB, batch int) error {
+			for i := range customers {
+				if _, err := s.compute(&customers[i], now); err != nil {
+					log.Printf("failed to compute health of customer %d: %v", customers[i].ID, err)
+					continue
+				}
+				count++
+			}
+			return nil
+		}).Error
+	return count, err
+}
+
+// Monitor recomputes the health scores on the given interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.RecomputeAll(time.Now()); err != nil {
+			log.Printf("failed to compute customer health: %v", err)
+		} else if n > 0 {
+			log.Printf("computed health of %d customer(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetAccountManager assigns the staff member alerted of drops in the
+// health of a customer; nil alerts all admins
+func (s *Service) SetAccountManager(customerID uint64, managerID *uint64) error {
+	if managerID != nil {
+		var manager domain.User
+		result := s.db.Select("id", "role").Limit(1).Find(&manager, *managerID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || !manager.IsStaff() {
+			return ErrManagerNotFound
+		}
+	}
+
+	result := s.db.Model(&domain.User{}).
+		Where("id = ? AND role = ?", customerID, domain.UserRoleCustomer).
+		Update("account_manager_id", managerID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCustomerNotFound
+	}
+	return nil
+}
+
+func (s *Service) compute(customer *domain.User, now time.Time) (*domain.CustomerHealth, error) {
+	health := domain.CustomerHealth{CustomerID: customer.ID, Flags: domain.HealthFlags{}, ComputedAt: now}
+
+	var err error
+	if health.PaymentScore, err = s.paymentScore(customer.ID, now, &health.Flags); err != nil {
+		return nil, err
+	}
+	if health.SupportScore, err = s.supportScore(customer.ID, now, &health.Flags); err != nil {
+		return nil, err
+	}
+	if health.UsageScore, err = s.usageScore(customer.ID, &health.Flags); err != nil {
+		return nil, err
+	}
+	health.EngagementScore = engagementScore(customer, now, &health.Flags)
+
+	weighted := health.PaymentScore*paymentWeight + health.SupportScore*supportWeight +
+		health.UsageScore*usageWeight + health.EngagementScore*engagementWeight
+	health.Score = int(math.Round(float64(weighted) / 100))
+	health.Risk = domain.RiskForScore(health.Score)
+
+	var previous domain.CustomerHealth
+	result := s.db.Where("customer_id = ?", customer.ID).Limit(1).Find(&previous)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	dropped := false
+	if result.RowsAffected > 0 {
+		health.PreviousScore = previous.PreviousScore
+		health.AlertedAt = previous.AlertedAt
+		if previous.Score != health.Score {
+			score := previous.Score
+			health.PreviousScore = &score
+		}
+		dropped = previous.Score-health.Score >= s.alertDrop ||
+			(health.Risk == domain.HealthRiskHigh && previous.Risk != domain.HealthRiskHigh)
+	}
+	if dropped {
+		health.AlertedAt = &now
+	}
+
+	if err := s.db.Save(&health).Error; err != nil {
+		return nil, err
+	}
+	if dropped {
+		s.alert(customer, &health, previous.Score)
+	}
+	return &health, nil
+}
+
+// paymentScore is the share of invoices of the last year paid on time,
+// less 15 points for each invoice overdue now
+func (s *Service) paymentScore(customerID uint64, now time.Time, flags *domain.HealthFlags) (int, error) {
+	var invoices []domain.Invoice
+	if err := s.db.Select("id", "status", "due_date", "paid_at").
+		Where("customer_id = ? AND due_date >= ? AND due_date <= ? AND status IN ?", customerID, now.Add(-paymentWindow), now,
+			[]domain.InvoiceStatus{domain.InvoiceStatusPaid, domain.InvoiceStatusUnpaid, domain.InvoiceStatusOverdue}).
+		Find(&invoices).Error; err != nil {
+		return 0, err
+	}
+	if len(invoices) == 0 {
+		return 100, nil
+	}
+
+	onTime, late, overdue := 0, 0, 0
+	for _, inv := range invoices {
+		switch {
+		case inv.Status == domain.InvoiceStatusPaid && inv.PaidAt != nil && !inv.PaidAt.After(inv.DueDate.Add(gracePeriod)):
+			onTime++
+		case inv.Status == domain.InvoiceStatusPaid:
+			late++
+		case now.After(inv.DueDate.Add(gracePeriod)):
+			overdue++
+		default:
+			// Due today, not counted yet
+		}
+	}
+	if late > 0 {
+		*flags = append(*flags, domain.HealthFlagLatePayments)
+	}
+	if overdue > 0 {
+		*flags = append(*flags, domain.HealthFlagOverdueInvoices)
+	}
+	scored := onTime + late + overdue
+	if scored == 0 {
+		return 100, nil
+	}
+	return clamp(onTime*100/scored - overdue*15), nil
+}
+
+// supportScore loses points for tickets beyond the usual number, for
+// unhappy messages and for open high priority tickets
+func (s *Service) supportScore(customerID uint64, now time.Time, flags *domain.HealthFlags) (int, error) {
+	since := now.Add(-supportWindow)
+	var tickets []domain.Ticket
+	if err := s.db.Select("id", "status", "priority").
+		Where("customer_id = ? AND created_at >= ?", customerID, since).
+		Find(&tickets).Error; err != nil {
+		return 0, err
+	}
+	if len(tickets) == 0 {
+		return 100, nil
+	}
+
+	score := 100
+	if extra := len(tickets) - usualTickets; extra > 0 {
+		score -= min(extra*5, 40)
+		*flags = append(*flags, domain.HealthFlagTicketVolume)
+	}
+
+	ids := make([]uint64, 0, len(tickets))
+	for _, ticket := range tickets {
+		ids = append(ids, ticket.ID)
+		if ticket.Status != domain.TicketStatusClosed && ticket.Priority == domain.TicketPriorityHigh {
+			score -= 10
+		}
+	}
+
+	var bodies []string
+	if err := s.db.Model(&domain.TicketMessage{}).
+		Where("ticket_id IN ? AND is_staff = ? AND created_at >= ?", ids, false, since).
+		Pluck("body", &bodies).Error; err != nil {
+		return 0, err
+	}
+	negative := 0
+	for _, body := range bodies {
+		if isNegative(body) {
+			negative++
+		}
+	}
+	if negative > 0 {
+		score -= min(negative*10, 50)
+		*flags = append(*flags, domain.HealthFlagNegativeSentiment)
+	}
+	return clamp(score), nil
+}
+
+// usageScore is the share of kept services that are active, less 30
+// points for each open cancellation request
+func (s *Service) usageScore(customerID uint64, flags *domain.HealthFlags) (int, error) {
+	var counts []struct {
+		Status domain.ServiceStatus
+		Total  int
+	}
+	if err := s.db.Model(&domain.Service{}).Select("status, COUNT(*) AS total").
+		Where("customer_id = ?", customerID).Group("status").Scan(&counts).Error; err != nil {
+		return 0, err
+	}
+
+	active, suspended, ended := 0, 0, 0
+	for _, c := range counts {
+		switch c.Status {
+		case domain.ServiceStatusActive:
+			active = c.Total
+		case domain.ServiceStatusSuspended:
+			suspended = c.Total
+		case domain.ServiceStatusTerminated, domain.ServiceStatusCancelled:
+			ended += c.Total
+		}
+	}
+
+	var score int
+	switch {
+	case active+suspended > 0:
+		score = active * 100 / (active + suspended)
+	case ended > 0:
+		// Every service is gone
+		*flags = append(*flags, domain.HealthFlagNoServices)
+		return 0, nil
+	default:
+		// Nothing ordered yet, neither good nor bad
+		score = 50
+	}
+	if suspended > 0 {
+		*flags = append(*flags, domain.HealthFlagSuspended)
+	}
+
+	var cancellations int64
+	if err := s.db.Model(&domain.CancellationRequest{}).
+		Where("customer_id = ? AND status IN ?", customerID,
+			[]domain.CancellationStatus{domain.CancellationStatusPending, domain.CancellationStatusApproved}).
+		Count(&cancellations).Error; err != nil {
+		return 0, err
+	}
+	if cancellations > 0 {
+		score -= int(cancellations) * 30
+		*flags = append(*flags, domain.HealthFlagCancellation)
+	}
+	return clamp(score), nil
+}
+
+// engagementScore falls the longer the customer has not signed in
+func engagementScore(customer *domain.User, now time.Time, flags *domain.HealthFlags) int {
+	last := customer.CreatedAt
+	if customer.LastLoginAt != nil {
+		last = *customer.LastLoginAt
+	}
+	switch since := now.Sub(last); {
+	case since <= 30*24*time.Hour:
+		return 100
+	case since <= 90*24*time.Hour:
+		return 70
+	case since <= 180*24*time.Hour:
+		*flags = append(*flags, domain.HealthFlagInactive)
+		return 40
+	default:
+		*flags = append(*flags, domain.HealthFlagInactive)
+		return 10
+	}
+}
+
+func isNegative(text string) bool {
+	text = strings.ToLower(text)
+	for _, term := range negativeTerms {
+		if strings.Contains(text, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func clamp(score int) int {
+	return max(0, min(score, 100))
+}
+
+// alert notifies the account manager of the customer, or every admin when
+// there is none, and raises the customer.health_dropped webhooks
+func (s *Service) alert(customer *domain.User, health *domain.CustomerHealth, previous int) {
+	var recipients []uint64
+	if customer.AccountManagerID != nil {
+		recipients = append(recipients, *customer.AccountManagerID)
+	} else if err := s.db.Model(&domain.User{}).
+		Where("role = ? AND status = ?", domain.UserRoleAdmin, domain.UserStatusActive).
+		Pluck("id", &recipients).Error; err != nil {
+		log.Printf("failed to find admins to alert of customer %d: %v", customer.ID, err)
+	}
+
+	notifier := notification.NewService(s.db)
+	title := fmt.Sprintf("Health of %s dropped to %d", customer.FullName(), health.Score)
+	message := fmt.Sprintf("The health score of %s fell from %d to %d (%s).", customer.FullName(), previous, health.Score, health.Risk)
+	if len(health.Flags) > 0 {
+		message += " Flags: " + strings.Join(health.Flags, ", ") + "."
+	}
+	link := fmt.Sprintf("/admin/customers?id=%d", customer.ID)
+	for _, id := range recipients {
+		if err := notifier.SendNotification(id, NotificationHealthDropped, title, message, link); err != nil {
+			log.Printf("failed to alert staff %d of customer %d: %v", id, customer.ID, err)
+		}
+	}
+	if err := notifier.CustomerHealthDropped(customer, health, previous); err != nil {
+		log.Printf("failed to queue health webhooks of customer %d: %v", customer.ID, err)
+	}
+}
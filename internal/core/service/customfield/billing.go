@@ -0,0 +1,272 @@
+package customfield
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidEntity   = errors.New("custom fields can only be defined for orders and invoices")
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrInvoiceNotFound = errors.New("invoice not found")
+)
+
+// --- Order and invoice fields ---
+
+// ListBillingFields returns the active fields of orders or invoices.
+// Admin-only fields are left out for customers.
+func (s *Service) ListBillingFields(entityType string, includeAdminOnly bool) ([]domain.CustomField, error) {
+	var fields []domain.CustomField
+	query := s.db.Where("type = ? AND product_id IS NULL AND active = ?", entityType, true)
+	if !includeAdminOnly {
+		query = query.Where("admin_only = ?", false)
+	}
+	if err := query.Order("sort_order, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ListAllBillingFields returns every field of orders or invoices,
+// including inactive ones
+func (s *Service) ListAllBillingFields(entityType string) ([]domain.CustomField, error) {
+	var fields []domain.CustomField
+	if err := s.db.Where("type = ? AND product_id IS NULL", entityType).
+		Order("sort_order, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// CreateBillingField adds a field to orders or invoices
+func (s *Service) CreateBillingField(entityType string, field *domain.CustomField) (*domain.CustomField, error) {
+	if entityType != domain.CustomFieldEntityOrder && entityType != domain.CustomFieldEntityInvoice {
+		return nil, ErrInvalidEntity
+	}
+
+	field.ID = 0
+	field.Type = entityType
+	field.ProductID = nil
+	if err := s.validateField(field); err != nil {
+		return nil, err
+	}
+
+	active := field.Active
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(field).Error; err != nil {
+			return err
+		}
+		// Written explicitly so false is not replaced by the column default
+		return tx.Model(field).Update("active", active).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// ValidateCheckoutValues checks the values a customer entered for the
+// order fields shown at checkout and returns them keyed by field name,
+// with defaults filled in
+func (s *Service) ValidateCheckoutValues(values map[string]string) (domain.JSONMap, error) {
+	fields, err := s.ListBillingFields(domain.CustomFieldEntityOrder, false)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(fields))
+	result := domain.JSONMap{}
+	for i := range fields {
+		field := &fields[i]
+		if !field.ShowOnOrder {
+			continue
+		}
+		known[field.FieldName] = true
+
+		value := strings.TrimSpace(values[field.FieldName])
+		if value == "" {
+			value = field.DefaultValue
+		}
+		if err := validateValue(field, value); err != nil {
+			return nil, err
+		}
+		if value != "" {
+			result[field.FieldName] = value
+		}
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+	}
+	return result, nil
+}
+
+// CreateOrderValues stores the values collected at checkout on a new
+// order. Fields that were not collected get their default value.
+func (s *Service) CreateOrderValues(orderID uint64, values domain.JSONMap) error {
+	fields, err := s.ListBillingFields(domain.CustomFieldEntityOrder, true)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		value := field.DefaultValue
+		if v, ok := values[field.FieldName].(string); ok {
+			value = v
+		}
+		if value == "" {
+			continue
+		}
+		if err := s.db.Create(&domain.CustomFieldValue{
+			CustomFieldID: field.ID,
+			EntityType:    domain.CustomFieldEntityOrder,
+			EntityID:      orderID,
+			Value:         value,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyOrderValues carries the order field values of an order onto its
+// invoice
+func (s *Service) CopyOrderValues(orderID, invoiceID uint64) error {
+	var values []domain.CustomFieldValue
+	if err := s.db.Where("entity_type = ? AND entity_id = ?", domain.CustomFieldEntityOrder, orderID).
+		Find(&values).Error; err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := s.db.Create(&domain.CustomFieldValue{
+			CustomFieldID: value.CustomFieldID,
+			EntityType:    domain.CustomFieldEntityInvoice,
+			EntityID:      invoiceID,
+			Value:         value.Value,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrderValues returns the order fields with their values on an order
+func (s *Service) GetOrderValues(orderID uint64) ([]ServiceValue, error) {
+	if err := s.exists(&domain.Order{}, orderID, ErrOrderNotFound); err != nil {
+		return nil, err
+	}
+	fields, err := s.ListBillingFields(domain.CustomFieldEntityOrder, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.entityValues(domain.CustomFieldEntityOrder, orderID, fields)
+}
+
+// UpdateOrderValues changes order field values of an order by field name
+// and records every change. An empty value clears the field.
+func (s *Service) UpdateOrderValues(orderID uint64, values map[string]string, changedBy uint64) ([]ServiceValue, error) {
+	current, err := s.GetOrderValues(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateValues(domain.CustomFieldEntityOrder, orderID, current, values, changedBy); err != nil {
+		return nil, err
+	}
+	return s.GetOrderValues(orderID)
+}
+
+// GetInvoiceValues returns the order and invoice fields with their values
+// on an invoice
+func (s *Service) GetInvoiceValues(invoiceID uint64) ([]ServiceValue, error) {
+	if err := s.exists(&domain.Invoice{}, invoiceID, ErrInvoiceNotFound); err != nil {
+		return nil, err
+	}
+	return s.invoiceValues(invoiceID, true)
+}
+
+// UpdateInvoiceValues changes field values of an invoice by field name and
+// records every change. An empty value clears the field.
+func (s *Service) UpdateInvoiceValues(invoiceID uint64, values map[string]string, changedBy uint64) ([]ServiceValue, error) {
+	current, err := s.GetInvoiceValues(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateValues(domain.CustomFieldEntityInvoice, invoiceID, current, values, changedBy); err != nil {
+		return nil, err
+	}
+	return s.GetInvoiceValues(invoiceID)
+}
+
+// PrintedInvoiceValues returns the filled in fields of a customer's
+// invoice that are printed on it
+func (s *Service) PrintedInvoiceValues(customerID, invoiceID uint64) ([]ServiceValue, error) {
+	var count int64
+	if err := s.db.Model(&domain.Invoice{}).Where("id = ? AND customer_id = ?", invoiceID, customerID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrInvoiceNotFound
+	}
+
+	values, err := s.invoiceValues(invoiceID, false)
+	if err != nil {
+		return nil, err
+	}
+	printed := make([]ServiceValue, 0, len(values))
+	for _, value := range values {
+		if value.Field.ShowOnInvoice && value.Value != "" {
+			printed = append(printed, value)
+		}
+	}
+	return printed, nil
+}
+
+// MatchValues restricts a query of orders or invoices to those with a
+// value containing text for each field name given, ignoring case. Table is
+// the table of the query.
+func MatchValues(db *gorm.DB, query *gorm.DB, entityType, table string, filters map[string]string) *gorm.DB {
+	for name, text := range filters {
+		text = strings.ToLower(strings.TrimSpace(text))
+		if text == "" {
+			continue
+		}
+		query = query.Where(table+".id IN (?)", db.Model(&domain.CustomFieldValue{}).
+			Select("custom_field_values.entity_id").
+			Joins("JOIN custom_fields ON custom_fields.id = custom_field_values.custom_field_id").
+			Where("custom_field_values.entity_type = ? AND custom_fields.field_name = ?", entityType, name).
+			Where("LOWER(custom_field_values.value) LIKE ?", "%"+text+"%"))
+	}
+	return query
+}
+
+func (s *Service) invoiceValues(invoiceID uint64, includeAdminOnly bool) ([]ServiceValue, error) {
+	var fields []domain.CustomField
+	query := s.db.Where("type IN ? AND product_id IS NULL AND active = ?",
+		[]string{domain.CustomFieldEntityOrder, domain.CustomFieldEntityInvoice}, true)
+	if !includeAdminOnly {
+		query = query.Where("admin_only = ?", false)
+	}
+	if err := query.Order("sort_order, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return s.entityValues(domain.CustomFieldEntityInvoice, invoiceID, fields)
+}
+
+func (s *Service) exists(model interface{}, id uint64, notFound error) error {
+	var count int64
+	if err := s.db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return nil
+}
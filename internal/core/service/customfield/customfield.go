@@ -0,0 +1,481 @@
+package customfield
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrFieldNotFound    = errors.New("custom field not found")
+	ErrProductNotFound  = errors.New("product not found")
+	ErrServiceNotFound  = errors.New("service not found")
+	ErrInvalidFieldType = errors.New("invalid custom field type")
+	ErrDuplicateField   = errors.New("custom field name already in use")
+	ErrFieldRequired    = errors.New("custom field is required")
+	ErrInvalidValue     = errors.New("invalid custom field value")
+	ErrUnknownField     = errors.New("unknown custom field")
+)
+
+// SecretMask replaces the values of secret fields in change history
+const SecretMask = "********"
+
+// ProvisioningPrefix prefixes custom field names in the options passed to
+// provisioning modules
+const ProvisioningPrefix = "customfield_"
+
+// Service manages the custom fields of products, orders and invoices and
+// their values
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new custom field service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// --- Fields ---
+
+// ListProductFields returns the active service fields of a product.
+// Admin-only fields are left out for customers.
+func (s *Service) ListProductFields(productID uint64, includeAdminOnly bool) ([]domain.CustomField, error) {
+	var fields []domain.CustomField
+	query := s.db.Where("type = ? AND product_id = ? AND active = ?", domain.CustomFieldEntityService, productID, true)
+	if !includeAdminOnly {
+		query = query.Where("admin_only = ?", false)
+	}
+	if err := query.Order("sort_order, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ListAllProductFields returns every service field of a product, including
+// inactive ones
+func (s *Service) ListAllProductFields(productID uint64) ([]domain.CustomField, error) {
+	var fields []domain.CustomField
+	if err := s.db.Where("type = ? AND product_id = ?", domain.CustomFieldEntityService, productID).
+		Order("sort_order, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// CreateField adds a service field to a product
+func (s *Service) CreateField(productID uint64, field *domain.CustomField) (*domain.CustomField, error) {
+	var count int64
+	if err := s.db.Model(&domain.Product{}).Where("id = ?", productID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	field.ID = 0
+	field.Type = domain.CustomFieldEntityService
+	field.ProductID = &productID
+	if err := s.validateField(field); err != nil {
+		return nil, err
+	}
+
+	active := field.Active
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(field).Error; err != nil {
+			return err
+		}
+		// Written explicitly so false is not replaced by the column default
+		return tx.Model(field).Update("active", active).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// UpdateField replaces the definition of a custom field. The product and
+// entity type of a field cannot be changed.
+func (s *Service) UpdateField(id uint64, field *domain.CustomField) (*domain.CustomField, error) {
+	existing, err := s.getField(id)
+	if err != nil {
+		return nil, err
+	}
+
+	field.ID = existing.ID
+	field.Type = existing.Type
+	field.ProductID = existing.ProductID
+	if err := s.validateField(field); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(existing).Updates(map[string]interface{}{
+		"name":            field.Name,
+		"field_name":      field.FieldName,
+		"field_type":      field.FieldType,
+		"description":     field.Description,
+		"options":         field.Options,
+		"required":        field.Required,
+		"show_on_order":   field.ShowOnOrder,
+		"show_on_invoice": field.ShowOnInvoice,
+		"admin_only":      field.AdminOnly,
+		"validation":      field.Validation,
+		"default_value":   field.DefaultValue,
+		"sort_order":      field.SortOrder,
+		"active":          field.Active,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return s.getField(id)
+}
+
+// DeleteField deletes a custom field with its values and history
+func (s *Service) DeleteField(id uint64) error {
+	if _, err := s.getField(id); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("custom_field_id = ?", id).Delete(&domain.CustomFieldValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("custom_field_id = ?", id).Delete(&domain.CustomFieldValueChange{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.CustomField{}, id).Error
+	})
+}
+
+// --- Order values ---
+
+// ValidateOrderValues checks the values a customer entered for the fields
+// of a product shown on the order form and returns them keyed by field
+// name, with defaults filled in
+func (s *Service) ValidateOrderValues(productID uint64, values map[string]string) (domain.JSONMap, error) {
+	fields, err := s.ListProductFields(productID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(fields))
+	result := domain.JSONMap{}
+	for i := range fields {
+		field := &fields[i]
+		if !field.ShowOnOrder {
+			continue
+		}
+		known[field.FieldName] = true
+
+		value := strings.TrimSpace(values[field.FieldName])
+		if value == "" {
+			value = field.DefaultValue
+		}
+		if err := validateValue(field, value); err != nil {
+			return nil, err
+		}
+		if value != "" {
+			result[field.FieldName] = value
+		}
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+	}
+	return result, nil
+}
+
+// CreateServiceValues stores the values collected at order time on a new
+// service. Fields that were not collected get their default value.
+func (s *Service) CreateServiceValues(serviceID, productID uint64, values domain.JSONMap) error {
+	fields, err := s.ListProductFields(productID, true)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		value := field.DefaultValue
+		if v, ok := values[field.FieldName].(string); ok {
+			value = v
+		}
+		if value == "" {
+			continue
+		}
+		if err := s.db.Create(&domain.CustomFieldValue{
+			CustomFieldID: field.ID,
+			EntityType:    domain.CustomFieldEntityService,
+			EntityID:      serviceID,
+			Value:         value,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Service values ---
+
+// GetServiceValues returns the fields of a service's product with the
+// values stored on the service
+func (s *Service) GetServiceValues(serviceID uint64) ([]ServiceValue, error) {
+	var service domain.Service
+	result := s.db.Limit(1).Find(&service, serviceID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return s.serviceValues(&service, true)
+}
+
+// GetCustomerServiceValues returns the fields of a customer's service that
+// are visible to the customer
+func (s *Service) GetCustomerServiceValues(customerID, serviceID uint64) ([]ServiceValue, error) {
+	var service domain.Service
+	result := s.db.Where("id = ? AND customer_id = ?", serviceID, customerID).Limit(1).Find(&service)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return s.serviceValues(&service, false)
+}
+
+// UpdateServiceValues changes field values of a service by field name and
+// records every change. An empty value clears the field.
+func (s *Service) UpdateServiceValues(serviceID uint64, values map[string]string, changedBy uint64) ([]ServiceValue, error) {
+	current, err := s.GetServiceValues(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateValues(domain.CustomFieldEntityService, serviceID, current, values, changedBy); err != nil {
+		return nil, err
+	}
+	return s.GetServiceValues(serviceID)
+}
+
+// ListServiceChanges returns the change history of a service's field
+// values, newest first
+func (s *Service) ListServiceChanges(serviceID uint64, limit, offset int) ([]domain.CustomFieldValueChange, int64, error) {
+	var changes []domain.CustomFieldValueChange
+	var total int64
+
+	query := s.db.Model(&domain.CustomFieldValueChange{}).
+		Where("entity_type = ? AND entity_id = ?", domain.CustomFieldEntityService, serviceID)
+	query.Count(&total)
+
+	if err := query.Preload("CustomField").Preload("User").
+		Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).
+		Find(&changes).Error; err != nil {
+		return nil, 0, err
+	}
+	return changes, total, nil
+}
+
+// ProvisioningValues returns the field values of a service keyed for the
+// options of a provisioning request
+func (s *Service) ProvisioningValues(serviceID uint64) (map[string]string, error) {
+	var values []domain.CustomFieldValue
+	if err := s.db.Preload("CustomField").
+		Where("entity_type = ? AND entity_id = ?", domain.CustomFieldEntityService, serviceID).
+		Find(&values).Error; err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]string, len(values))
+	for _, value := range values {
+		options[ProvisioningPrefix+value.CustomField.FieldName] = value.Value
+	}
+	return options, nil
+}
+
+// serviceValues pairs the fields of a service's product with its values
+func (s *Service) serviceValues(service *domain.Service, includeAdminOnly bool) ([]ServiceValue, error) {
+	fields, err := s.ListProductFields(service.ProductID, includeAdminOnly)
+	if err != nil {
+		return nil, err
+	}
+	return s.entityValues(domain.CustomFieldEntityService, service.ID, fields)
+}
+
+// entityValues pairs fields with their values on an entity
+func (s *Service) entityValues(entityType string, entityID uint64, fields []domain.CustomField) ([]ServiceValue, error) {
+	var values []domain.CustomFieldValue
+	if err := s.db.Where("entity_type = ? AND entity_id = ?", entityType, entityID).
+		Find(&values).Error; err != nil {
+		return nil, err
+	}
+	byField := make(map[uint64]string, len(values))
+	for _, value := range values {
+		byField[value.CustomFieldID] = value.Value
+	}
+
+	result := make([]ServiceValue, 0, len(fields))
+	for _, field := range fields {
+		result = append(result, ServiceValue{Field: field, Value: byField[field.ID]})
+	}
+	return result, nil
+}
+
+// updateValues changes the values of an entity by field name, given its
+// fields with their current values, and records every change
+func (s *Service) updateValues(entityType string, entityID uint64, current []ServiceValue, values map[string]string, changedBy uint64) error {
+	byName := make(map[string]ServiceValue, len(current))
+	for _, value := range current {
+		byName[value.Field.FieldName] = value
+	}
+	for name, value := range values {
+		existing, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+		if err := validateValue(&existing.Field, strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for name, value := range values {
+			value = strings.TrimSpace(value)
+			existing := byName[name]
+			if existing.Value == value {
+				continue
+			}
+
+			if err := tx.Where("custom_field_id = ? AND entity_type = ? AND entity_id = ?",
+				existing.Field.ID, entityType, entityID).
+				Delete(&domain.CustomFieldValue{}).Error; err != nil {
+				return err
+			}
+			if value != "" {
+				if err := tx.Create(&domain.CustomFieldValue{
+					CustomFieldID: existing.Field.ID,
+					EntityType:    entityType,
+					EntityID:      entityID,
+					Value:         value,
+				}).Error; err != nil {
+					return err
+				}
+			}
+
+			change := &domain.CustomFieldValueChange{
+				CustomFieldID: existing.Field.ID,
+				EntityType:    entityType,
+				EntityID:      entityID,
+				OldValue:      existing.Value,
+				NewValue:      value,
+				ChangedBy:     &changedBy,
+			}
+			if existing.Field.IsSecret() {
+				change.OldValue = maskSecret(change.OldValue)
+				change.NewValue = maskSecret(change.NewValue)
+			}
+			if err := tx.Create(change).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Service) getField(id uint64) (*domain.CustomField, error) {
+	var field domain.CustomField
+	result := s.db.Limit(1).Find(&field, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrFieldNotFound
+	}
+	return &field, nil
+}
+
+func (s *Service) validateField(field *domain.CustomField) error {
+	switch field.FieldType {
+	case domain.CustomFieldTypeText, domain.CustomFieldTypeTextarea, domain.CustomFieldTypePassword, domain.CustomFieldTypeCheckbox:
+	case domain.CustomFieldTypeSelect:
+		if len(field.Options) == 0 {
+			return fmt.Errorf("%w: dropdown fields need options", ErrInvalidFieldType)
+		}
+	default:
+		return ErrInvalidFieldType
+	}
+	if field.Validation != "" {
+		if _, err := regexp.Compile(field.Validation); err != nil {
+			return fmt.Errorf("%w: invalid validation pattern", ErrInvalidFieldType)
+		}
+	}
+
+	// Order fields are carried onto invoices, so their names are shared
+	// with the invoice fields
+	types := []string{field.Type}
+	if field.Type == domain.CustomFieldEntityOrder || field.Type == domain.CustomFieldEntityInvoice {
+		types = []string{domain.CustomFieldEntityOrder, domain.CustomFieldEntityInvoice}
+	}
+	query := s.db.Model(&domain.CustomField{}).
+		Where("type IN ? AND field_name = ? AND id <> ?", types, field.FieldName, field.ID)
+	if field.ProductID != nil {
+		query = query.Where("product_id = ?", *field.ProductID)
+	} else {
+		query = query.Where("product_id IS NULL")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateField
+	}
+	return nil
+}
+
+// validateValue checks a value against the type and rules of a field
+func validateValue(field *domain.CustomField, value string) error {
+	if value == "" {
+		if field.Required {
+			return fmt.Errorf("%w: %s", ErrFieldRequired, field.Name)
+		}
+		return nil
+	}
+
+	switch field.FieldType {
+	case domain.CustomFieldTypeSelect:
+		if _, ok := field.Options[value]; !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, field.Name)
+		}
+	case domain.CustomFieldTypeCheckbox:
+		if value != "on" && value != "true" && value != "1" {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, field.Name)
+		}
+	}
+
+	if field.Validation != "" {
+		pattern, err := regexp.Compile(field.Validation)
+		if err != nil || !pattern.MatchString(value) {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, field.Name)
+		}
+	}
+	return nil
+}
+
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return SecretMask
+}
+
+// ServiceValue is a custom field with its value on a service, order or
+// invoice
+type ServiceValue struct {
+	Field domain.CustomField
+	Value string
+}
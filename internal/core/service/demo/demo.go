@@ -0,0 +1,833 @@
+// Package demo fills a database with realistic demo data: customers,
+// products, services with their order, invoice and payment histories,
+// support tickets and knowledge base articles. The same seed and date
+// always give the same data, so it also serves integration tests.
+package demo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/markup"
+)
+
+var (
+	ErrAlreadySeeded   = errors.New("demo data is already present")
+	ErrInvalidCount    = errors.New("customers must be between 1 and 1000")
+	ErrInvalidPassword = errors.New("the demo password must be at least 8 characters")
+)
+
+// GroupSlug is the slug of the product group of the demo products. Its
+// presence marks a database as seeded.
+const GroupSlug = "demo-hosting"
+
+// StaffEmail is the sign in of the demo staff member who answers tickets
+// and wrote the knowledge base
+const StaffEmail = "demo.staff@example.com"
+
+// DefaultPassword is the password of the demo accounts when none is given
+const DefaultPassword = "demo-password"
+
+// Options control what Generate creates
+type Options struct {
+	Customers int       // 25 when zero
+	Seed      int64     // Random seed; the same seed and Now give the same data
+	Now       time.Time // Date the histories lead up to, now when zero
+	Password  string    // Password of every demo account, DefaultPassword when empty
+}
+
+// Summary counts the records Generate created
+type Summary struct {
+	Customers    int
+	Products     int
+	Services     int
+	Orders       int
+	Invoices     int
+	Transactions int
+	Tickets      int
+	Articles     int
+	// CustomerEmails are the sign ins of the first customers, to try the
+	// client area with
+	CustomerEmails []string
+}
+
+// Service generates demo data
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new demo data service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Seeded reports whether the demo data was generated already
+func (s *Service) Seeded() (bool, error) {
+	var count int64
+	if err := s.db.Model(&domain.ProductGroup{}).Where("slug = ?", GroupSlug).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Generate creates the demo data in one transaction. It refuses to run
+// twice on a database.
+func (s *Service) Generate(opts Options) (*Summary, error) {
+	if opts.Customers == 0 {
+		opts.Customers = 25
+	}
+	if opts.Customers < 1 || opts.Customers > 1000 {
+		return nil, ErrInvalidCount
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if len(opts.Password) < 8 {
+		return nil, ErrInvalidPassword
+	}
+
+	seeded, err := s.Seeded()
+	if err != nil {
+		return nil, err
+	}
+	if seeded {
+		return nil, ErrAlreadySeeded
+	}
+
+	// One hash serves every account; hashing each would take seconds
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		rng:     rand.New(rand.NewSource(opts.Seed)),
+		now:     opts.Now.UTC().Truncate(time.Second),
+		hash:    string(hash),
+		summary: &Summary{},
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		g.tx = tx
+		return g.run(opts.Customers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g.summary, nil
+}
+
+type generator struct {
+	tx      *gorm.DB
+	rng     *rand.Rand
+	now     time.Time
+	hash    string
+	summary *Summary
+
+	staff       *domain.User
+	products    []demoProduct
+	departments map[string]uint64
+	invoiceSeq  int
+	orderSeq    int
+}
+
+type demoProduct struct {
+	product domain.Product
+	monthly decimal.Decimal
+	annual  decimal.Decimal
+	setup   decimal.Decimal
+}
+
+func (g *generator) run(customers int) error {
+	steps := []func() error{g.createStaff, g.createProducts, g.createDepartments, g.createKnowledgeBase}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < customers; i++ {
+		if err := g.createCustomer(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) createStaff() error {
+	created := g.now.AddDate(-2, 0, 0)
+	g.staff = &domain.User{
+		Email:         StaffEmail,
+		PasswordHash:  g.hash,
+		FirstName:     "Alex",
+		LastName:      "Morgan",
+		Role:          domain.UserRoleStaff,
+		Status:        domain.UserStatusActive,
+		Country:       "US",
+		EmailVerified: true,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	return g.tx.Create(g.staff).Error
+}
+
+func (g *generator) createProducts() error {
+	created := g.now.AddDate(-2, -1, 0)
+	group := &domain.ProductGroup{
+		Name:        "Hosting",
+		Slug:        GroupSlug,
+		Description: "Shared hosting, virtual servers and dedicated servers",
+		Active:      true,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	}
+	if err := g.tx.Create(group).Error; err != nil {
+		return err
+	}
+
+	catalog := []struct {
+		name, module, description string
+		monthly, setup            string
+	}{
+		{"Shared Starter", "cpanel", "1 website, 10 GB SSD storage and free SSL", "3.99", "0"},
+		{"Shared Business", "cpanel", "Unlimited websites, 50 GB SSD storage and daily backups", "9.99", "0"},
+		{"VPS 2 GB", "virtualizor", "2 vCPU, 2 GB RAM, 40 GB NVMe and 2 TB traffic", "12.00", "0"},
+		{"VPS 8 GB", "virtualizor", "4 vCPU, 8 GB RAM, 160 GB NVMe and 5 TB traffic", "36.00", "0"},
+		{"Dedicated E-2388G", "ipmi", "8 cores, 64 GB ECC RAM and 2 x 1 TB NVMe", "149.00", "99.00"},
+	}
+	for _, item := range catalog {
+		product := domain.Product{
+			ProductGroupID: group.ID,
+			Name:           item.name,
+			Slug:           "demo-" + slugify(item.name),
+			Description:    item.description,
+			ModuleName:     item.module,
+			Active:         true,
+			CreatedAt:      created,
+			UpdatedAt:      created,
+		}
+		if err := g.tx.Create(&product).Error; err != nil {
+			return err
+		}
+		monthly := decimal.RequireFromString(item.monthly)
+		setup := decimal.RequireFromString(item.setup)
+		// Paying yearly gets two months free
+		annual := monthly.Mul(decimal.NewFromInt(10))
+		for _, currency := range []string{"USD", "EUR"} {
+			pricing := domain.ProductPricing{
+				ProductID:    product.ID,
+				Currency:     currency,
+				SetupFee:     setup,
+				Monthly:      monthly,
+				Quarterly:    monthly.Mul(decimal.NewFromInt(3)),
+				SemiAnnually: decimal.NewFromInt(-1),
+				Annually:     annual,
+				Biennially:   decimal.NewFromInt(-1),
+				Triennially:  decimal.NewFromInt(-1),
+				CreatedAt:    created,
+				UpdatedAt:    created,
+			}
+			if err := g.tx.Create(&pricing).Error; err != nil {
+				return err
+			}
+		}
+		g.products = append(g.products, demoProduct{product: product, monthly: monthly, annual: annual, setup: setup})
+	}
+	g.summary.Products = len(g.products)
+	return nil
+}
+
+func (g *generator) createDepartments() error {
+	created := g.now.AddDate(-2, -1, 0)
+	g.departments = make(map[string]uint64)
+	for i, name := range []string{"Technical Support", "Billing"} {
+		department := &domain.TicketDepartment{
+			Name:             name,
+			Description:      name + " questions",
+			ClientsOnly:      true,
+			SLAResponseHours: 24,
+			SLAResolveHours:  72,
+			DefaultPriority:  string(domain.TicketPriorityNormal),
+			SortOrder:        i,
+			Active:           true,
+			CreatedAt:        created,
+			UpdatedAt:        created,
+		}
+		if err := g.tx.Create(department).Error; err != nil {
+			return err
+		}
+		g.departments[name] = department.ID
+	}
+	return nil
+}
+
+func (g *generator) createKnowledgeBase() error {
+	for i, category := range knowledgeBase {
+		created := g.now.AddDate(-1, -6, i)
+		record := &domain.KnowledgeBaseCategory{
+			Name:        category.name,
+			Slug:        "demo-" + slugify(category.name),
+			Description: category.description,
+			SortOrder:   i,
+			Active:      true,
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		}
+		if err := g.tx.Create(record).Error; err != nil {
+			return err
+		}
+		for j, article := range category.articles {
+			published := created.AddDate(0, 0, 7*j+1)
+			html, err := markup.Render(article.content, markup.Options{Trusted: true, Highlight: true})
+			if err != nil {
+				return err
+			}
+			views := int64(50 + g.rng.Intn(2000))
+			record := &domain.KnowledgeBaseArticle{
+				CategoryID:    record.ID,
+				Title:         article.title,
+				Slug:          "demo-" + slugify(article.title),
+				Content:       article.content,
+				ContentHTML:   html,
+				Excerpt:       article.excerpt,
+				AuthorID:      g.staff.ID,
+				Status:        "published",
+				ViewCount:     views,
+				HelpfulYes:    views / int64(8+g.rng.Intn(8)),
+				HelpfulNo:     views / int64(60+g.rng.Intn(60)),
+				Featured:      j == 0,
+				AllowComments: true,
+				Tags:          domain.JSONMap{"tags": article.tags},
+				PublishedAt:   &published,
+				CreatedAt:     published,
+				UpdatedAt:     published,
+			}
+			if err := g.tx.Create(record).Error; err != nil {
+				return err
+			}
+			g.summary.Articles++
+		}
+	}
+	return nil
+}
+
+func (g *generator) createCustomer(index int) error {
+	first := firstNames[g.rng.Intn(len(firstNames))]
+	last := lastNames[g.rng.Intn(len(lastNames))]
+	place := places[g.rng.Intn(len(places))]
+	created := g.now.Add(-time.Duration(3+g.rng.Intn(727)) * 24 * time.Hour).Add(-time.Duration(g.rng.Intn(86400)) * time.Second)
+
+	customer := &domain.User{
+		Email:         fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), index+1),
+		PasswordHash:  g.hash,
+		FirstName:     first,
+		LastName:      last,
+		Role:          domain.UserRoleCustomer,
+		Status:        domain.UserStatusActive,
+		Phone:         fmt.Sprintf("+%s %03d %04d", place.dialCode, g.rng.Intn(1000), g.rng.Intn(10000)),
+		Address1:      fmt.Sprintf("%d %s", 1+g.rng.Intn(250), streets[g.rng.Intn(len(streets))]),
+		City:          place.city,
+		State:         place.state,
+		PostalCode:    place.postalCode,
+		Country:       place.country,
+		Currency:      place.currency,
+		EmailVerified: true,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	if g.rng.Intn(3) == 0 {
+		customer.Company = companies[g.rng.Intn(len(companies))]
+	}
+	lastLogin := g.now.Add(-time.Duration(g.rng.Intn(30*24)) * time.Hour)
+	if lastLogin.Before(created) {
+		lastLogin = created
+	}
+	customer.LastLoginAt = &lastLogin
+	customer.LastLoginIP = fmt.Sprintf("198.51.100.%d", 1+g.rng.Intn(254))
+	if err := g.tx.Create(customer).Error; err != nil {
+		return err
+	}
+	g.summary.Customers++
+	if len(g.summary.CustomerEmails) < 5 {
+		g.summary.CustomerEmails = append(g.summary.CustomerEmails, customer.Email)
+	}
+
+	services := 1 + g.rng.Intn(3)
+	for i := 0; i < services; i++ {
+		if err := g.createService(customer); err != nil {
+			return err
+		}
+	}
+	if g.rng.Intn(5) < 2 {
+		tickets := 1 + g.rng.Intn(2)
+		for i := 0; i < tickets; i++ {
+			if err := g.createTicket(customer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createService creates a service with the order that placed it and an
+// invoice for every period it was billed, paid but for the latest ones
+func (g *generator) createService(customer *domain.User) error {
+	item := g.products[g.rng.Intn(len(g.products))]
+	cycle, price := "monthly", item.monthly
+	if g.rng.Intn(10) < 3 {
+		cycle, price = "annually", item.annual
+	}
+
+	registered := customer.CreatedAt.Add(time.Duration(g.rng.Intn(30*24)) * time.Hour)
+	if latest := g.now.AddDate(0, 0, -1); registered.After(latest) {
+		registered = latest
+	}
+
+	status := pickStatus(g.rng.Intn(100))
+	if status == domain.ServiceStatusPending {
+		registered = g.now.Add(-time.Duration(1+g.rng.Intn(48)) * time.Hour)
+	}
+	// Services that ended did so after a few billing periods
+	var ended *time.Time
+	if status == domain.ServiceStatusTerminated || status == domain.ServiceStatusCancelled {
+		end := nextPeriod(registered, cycle)
+		for i := g.rng.Intn(6); i > 0 && nextPeriod(end, cycle).Before(g.now); i-- {
+			end = nextPeriod(end, cycle)
+		}
+		if end.After(g.now) {
+			end = g.now.AddDate(0, 0, -1)
+		}
+		ended = &end
+		// Too new to have ended: keep it running
+		if !end.After(registered) {
+			status, ended = domain.ServiceStatusActive, nil
+		}
+	}
+
+	service := &domain.Service{
+		CustomerID:       customer.ID,
+		ProductID:        item.product.ID,
+		Status:           status,
+		Username:         fmt.Sprintf("%s%d", strings.ToLower(customer.FirstName[:1]+customer.LastName), g.rng.Intn(100)),
+		BillingCycle:     cycle,
+		Currency:         customer.Currency,
+		RecurringAmount:  price,
+		NextDueDate:      registered,
+		RegistrationDate: registered,
+		ConfigSelection:  domain.JSONMap{},
+		CreatedAt:        registered,
+		UpdatedAt:        registered,
+	}
+	if item.product.ModuleName == "cpanel" {
+		service.Domain = domains[g.rng.Intn(len(domains))](customer)
+	} else {
+		service.Hostname = fmt.Sprintf("srv%d.%s", 100+g.rng.Intn(900), "example.net")
+	}
+	if ended != nil {
+		service.TerminationDate = ended
+	}
+	if err := g.tx.Create(service).Error; err != nil {
+		return err
+	}
+	g.summary.Services++
+
+	invoices, nextDue, err := g.bill(customer, service, item, ended)
+	if err != nil {
+		return err
+	}
+	if err := g.placeOrder(customer, service, item, invoices); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"next_due_date": nextDue}
+	switch status {
+	case domain.ServiceStatusSuspended:
+		reason := "Overdue on invoice"
+		if last := invoices[len(invoices)-1]; last.Status == domain.InvoiceStatusOverdue {
+			reason = "Overdue on invoice " + last.InvoiceNumber
+		}
+		updates["suspension_reason"] = reason
+	case domain.ServiceStatusCancelled:
+		if err := g.cancel(customer, service, *ended); err != nil {
+			return err
+		}
+	}
+	return g.tx.Model(service).Updates(updates).Error
+}
+
+// bill invoices a service for each period from its registration up to
+// the renewal issued a week ahead, and returns the invoices and the start
+// of the first period left unpaid
+func (g *generator) bill(customer *domain.User, service *domain.Service, item demoProduct, ended *time.Time) ([]*domain.Invoice, time.Time, error) {
+	var invoices []*domain.Invoice
+	var unpaid *time.Time
+	periodStart := service.RegistrationDate
+	for {
+		periodEnd := nextPeriod(periodStart, service.BillingCycle)
+		issued := periodStart.AddDate(0, 0, -7)
+		if len(invoices) == 0 {
+			issued = periodStart
+		}
+		if issued.After(g.now) || (ended != nil && !periodStart.Before(*ended)) {
+			break
+		}
+
+		// The period running now, or the last one of a service that ended
+		current := !periodEnd.Before(g.now) || (ended != nil && !periodEnd.Before(*ended))
+		status := domain.InvoiceStatusPaid
+		switch {
+		case service.Status == domain.ServiceStatusPending:
+			status = domain.InvoiceStatusUnpaid
+		case periodStart.After(g.now):
+			// Renewals not due yet are unpaid, some held for review
+			status = domain.InvoiceStatusUnpaid
+			if g.rng.Intn(4) == 0 {
+				status = domain.InvoiceStatusDraft
+			}
+		case current && service.Status == domain.ServiceStatusSuspended:
+			status = domain.InvoiceStatusOverdue
+		case current && service.Status == domain.ServiceStatusTerminated && g.rng.Intn(2) == 0:
+			status = domain.InvoiceStatusCancelled
+		}
+
+		amount := service.RecurringAmount
+		lineType := "renewal"
+		description := fmt.Sprintf("%s - %s to %s", item.product.Name, periodStart.Format("Jan 2, 2006"), periodEnd.Format("Jan 2, 2006"))
+		if len(invoices) == 0 {
+			// The first invoice carries the setup fee, as orders do
+			lineType = "service"
+			amount = amount.Add(item.setup)
+		}
+		items := []domain.InvoiceItem{{
+			ServiceID:   &service.ID,
+			Type:        lineType,
+			Description: description,
+			Quantity:    decimal.NewFromInt(1),
+			UnitPrice:   amount,
+			Total:       amount,
+			Taxable:     true,
+			PeriodStart: timePtr(periodStart),
+			PeriodEnd:   timePtr(periodEnd),
+			CreatedAt:   issued,
+			UpdatedAt:   issued,
+		}}
+		invoice, err := g.createInvoice(customer, items, status, issued, periodStart)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		invoices = append(invoices, invoice)
+		if status != domain.InvoiceStatusPaid && unpaid == nil {
+			unpaid = timePtr(periodStart)
+		}
+		periodStart = periodEnd
+		if current && service.Status != domain.ServiceStatusActive {
+			break
+		}
+	}
+	if unpaid != nil {
+		return invoices, *unpaid, nil
+	}
+	return invoices, periodStart, nil
+}
+
+func (g *generator) createInvoice(customer *domain.User, items []domain.InvoiceItem, status domain.InvoiceStatus, issued, due time.Time) (*domain.Invoice, error) {
+	total := decimal.Zero
+	for _, item := range items {
+		total = total.Add(item.Total)
+	}
+	g.invoiceSeq++
+	invoice := &domain.Invoice{
+		CustomerID:    customer.ID,
+		InvoiceNumber: fmt.Sprintf("DEMO-%05d", g.invoiceSeq),
+		Status:        status,
+		Currency:      customer.Currency,
+		Subtotal:      total,
+		Total:         total,
+		Balance:       total,
+		DueDate:       due,
+		LineItems:     items,
+		CreatedAt:     issued,
+		UpdatedAt:     issued,
+	}
+	switch status {
+	case domain.InvoiceStatusDraft:
+		publish := due.AddDate(0, 0, -7)
+		if publish.Before(g.now) {
+			publish = g.now.Add(24 * time.Hour)
+		}
+		invoice.PublishAt = &publish
+	case domain.InvoiceStatusCancelled:
+		invoice.Balance = decimal.Zero
+	case domain.InvoiceStatusPaid:
+		paid := due.Add(-time.Duration(g.rng.Intn(5*24)) * time.Hour)
+		if g.rng.Intn(10) == 0 {
+			paid = due.Add(time.Duration(1+g.rng.Intn(6*24)) * time.Hour)
+		}
+		if paid.Before(issued) {
+			paid = issued.Add(time.Hour)
+		}
+		if paid.After(g.now) {
+			paid = g.now
+		}
+		invoice.PaidAt = &paid
+		invoice.AmountPaid = total
+		invoice.Balance = decimal.Zero
+		invoice.PaymentMethod = gateways[g.rng.Intn(len(gateways))].slug
+		invoice.UpdatedAt = paid
+	}
+	if status != domain.InvoiceStatusDraft {
+		published := issued
+		invoice.PublishedAt = &published
+	}
+	if err := g.tx.Create(invoice).Error; err != nil {
+		return nil, err
+	}
+	g.summary.Invoices++
+
+	if status == domain.InvoiceStatusPaid {
+		if err := g.pay(invoice); err != nil {
+			return nil, err
+		}
+	}
+	return invoice, nil
+}
+
+// pay records the payment of an invoice, now and then refunded in part
+func (g *generator) pay(invoice *domain.Invoice) error {
+	gateway := gatewayBySlug(invoice.PaymentMethod)
+	fee := invoice.Total.Mul(gateway.percent).Div(decimal.NewFromInt(100)).Add(gateway.fixed).Round(2)
+	payment := &domain.Transaction{
+		CustomerID:     invoice.CustomerID,
+		InvoiceID:      &invoice.ID,
+		Type:           domain.TransactionTypePayment,
+		Status:         domain.TransactionStatusCompleted,
+		Currency:       invoice.Currency,
+		Amount:         invoice.Total,
+		Fee:            fee,
+		Gateway:        gateway.slug,
+		GatewayTransID: fmt.Sprintf("demo_%s_%06d", gateway.slug, invoice.ID),
+		Description:    "Payment of invoice " + invoice.InvoiceNumber,
+		IPAddress:      fmt.Sprintf("198.51.100.%d", 1+g.rng.Intn(254)),
+		CreatedAt:      *invoice.PaidAt,
+		UpdatedAt:      *invoice.PaidAt,
+	}
+	if err := g.tx.Create(payment).Error; err != nil {
+		return err
+	}
+	g.summary.Transactions++
+
+	if g.rng.Intn(40) != 0 || gateway.slug == "bank_transfer" {
+		return nil
+	}
+	refunded := invoice.Total.Div(decimal.NewFromInt(2)).Round(2)
+	at := invoice.PaidAt.Add(time.Duration(1+g.rng.Intn(72)) * time.Hour)
+	if at.After(g.now) {
+		at = g.now
+	}
+	refund := &domain.Transaction{
+		CustomerID:    invoice.CustomerID,
+		InvoiceID:     &invoice.ID,
+		Type:          domain.TransactionTypeRefund,
+		Status:        domain.TransactionStatusCompleted,
+		Currency:      invoice.Currency,
+		Amount:        refunded.Neg(),
+		Gateway:       gateway.slug,
+		RefundTransID: &payment.ID,
+		Description:   "Refund: Goodwill credit for downtime",
+		CreatedAt:     at,
+		UpdatedAt:     at,
+	}
+	if err := g.tx.Create(refund).Error; err != nil {
+		return err
+	}
+	g.summary.Transactions++
+	return g.tx.Model(payment).Update("refunded_amount", refunded).Error
+}
+
+func (g *generator) placeOrder(customer *domain.User, service *domain.Service, item demoProduct, invoices []*domain.Invoice) error {
+	first := invoices[0]
+	status := domain.OrderStatusCompleted
+	if service.Status == domain.ServiceStatusPending {
+		status = domain.OrderStatusPending
+	}
+	g.orderSeq++
+	order := &domain.Order{
+		OrderNumber: fmt.Sprintf("DEMO-ORD-%05d", g.orderSeq),
+		CustomerID:  customer.ID,
+		InvoiceID:   &first.ID,
+		Status:      status,
+		Currency:    first.Currency,
+		Subtotal:    first.Total,
+		Total:       first.Total,
+		IPAddress:   customer.LastLoginIP,
+		CreatedAt:   service.RegistrationDate,
+		UpdatedAt:   service.RegistrationDate,
+		Items: []domain.OrderItem{{
+			ProductID:    item.product.ID,
+			ServiceID:    &service.ID,
+			Description:  item.product.Name,
+			Quantity:     1,
+			BillingCycle: service.BillingCycle,
+			SetupFee:     item.setup,
+			RecurringFee: service.RecurringAmount,
+			Total:        first.Total,
+			Domain:       service.Domain,
+			Hostname:     service.Hostname,
+			CreatedAt:    service.RegistrationDate,
+			UpdatedAt:    service.RegistrationDate,
+		}},
+	}
+	if err := g.tx.Create(order).Error; err != nil {
+		return err
+	}
+	g.summary.Orders++
+	return g.tx.Model(service).Update("order_id", order.ID).Error
+}
+
+// cancel records the cancellation request a cancelled service ended with
+func (g *generator) cancel(customer *domain.User, service *domain.Service, ended time.Time) error {
+	requested := ended.AddDate(0, 0, -(3 + g.rng.Intn(20)))
+	if requested.Before(service.RegistrationDate) {
+		requested = service.RegistrationDate
+	}
+	reviewed := requested.Add(time.Duration(2+g.rng.Intn(20)) * time.Hour)
+	request := &domain.CancellationRequest{
+		ServiceID:    service.ID,
+		CustomerID:   customer.ID,
+		Type:         domain.CancellationTypeEndOfCycle,
+		Reason:       cancellationReasons[g.rng.Intn(len(cancellationReasons))],
+		Status:       domain.CancellationStatusCompleted,
+		ScheduledFor: &ended,
+		ReviewedBy:   &g.staff.ID,
+		ReviewedAt:   &reviewed,
+		CompletedAt:  &ended,
+		CreatedAt:    requested,
+		UpdatedAt:    ended,
+	}
+	return g.tx.Create(request).Error
+}
+
+// createTicket opens a ticket with a conversation between the customer
+// and staff, closed unless it is recent
+func (g *generator) createTicket(customer *domain.User) error {
+	topic := ticketTopics[g.rng.Intn(len(ticketTopics))]
+	opened := customer.CreatedAt.Add(time.Duration(g.rng.Int63n(int64(g.now.Sub(customer.CreatedAt)) + 1)))
+	if g.rng.Intn(4) == 0 {
+		// Keep a few recent tickets waiting on staff
+		opened = g.now.Add(-time.Duration(1+g.rng.Intn(5*24)) * time.Hour)
+		if opened.Before(customer.CreatedAt) {
+			opened = customer.CreatedAt
+		}
+	}
+	departmentID := g.departments[topic.department]
+
+	status := domain.TicketStatusClosed
+	switch age := g.now.Sub(opened); {
+	case age < 3*24*time.Hour:
+		status = domain.TicketStatusOpen
+	case age < 10*24*time.Hour && g.rng.Intn(3) == 0:
+		status = domain.TicketStatusOnHold
+	}
+	priority := domain.TicketPriorityNormal
+	if topic.urgent {
+		priority = domain.TicketPriorityHigh
+	}
+
+	ticket := &domain.Ticket{
+		CustomerID:   &customer.ID,
+		DepartmentID: &departmentID,
+		Subject:      topic.subject,
+		Status:       status,
+		Priority:     priority,
+		Source:       "web",
+		CreatedAt:    opened,
+		UpdatedAt:    opened,
+	}
+	if status != domain.TicketStatusOpen {
+		ticket.AssigneeID = &g.staff.ID
+		ticket.RoutedAt = &opened
+	}
+	if err := g.tx.Create(ticket).Error; err != nil {
+		return err
+	}
+	g.summary.Tickets++
+
+	at := opened
+	messages := topic.messages
+	if status == domain.TicketStatusOpen {
+		messages = messages[:1]
+	}
+	for i, body := range messages {
+		staff := i%2 == 1
+		sender := customer.Email
+		if staff {
+			sender = g.staff.Email
+			body += "\n\nBest regards,\nAlex"
+		}
+		message := &domain.TicketMessage{
+			TicketID:    ticket.ID,
+			SenderEmail: sender,
+			Body:        body,
+			IsStaff:     staff,
+			CreatedAt:   at,
+			UpdatedAt:   at,
+		}
+		if err := g.tx.Create(message).Error; err != nil {
+			return err
+		}
+		at = at.Add(time.Duration(20+g.rng.Intn(600)) * time.Minute)
+		if at.After(g.now) {
+			at = g.now
+		}
+	}
+	return g.tx.Model(ticket).Update("updated_at", at).Error
+}
+
+// pickStatus spreads services over the statuses as in a live install
+func pickStatus(n int) domain.ServiceStatus {
+	switch {
+	case n < 72:
+		return domain.ServiceStatusActive
+	case n < 82:
+		return domain.ServiceStatusSuspended
+	case n < 90:
+		return domain.ServiceStatusTerminated
+	case n < 96:
+		return domain.ServiceStatusCancelled
+	default:
+		return domain.ServiceStatusPending
+	}
+}
+
+func nextPeriod(start time.Time, cycle string) time.Time {
+	if cycle == "annually" {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func slugify(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,215 @@
+package demo
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var firstNames = []string{
+	"Emma", "Liam", "Olivia", "Noah", "Sophie", "Lucas", "Mia", "Jonas",
+	"Chloe", "Mateo", "Hannah", "Elias", "Julia", "Daniel", "Sara", "Leon",
+	"Aiko", "Ravi", "Amara", "Tomás",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Brown", "Garcia", "Miller", "Martin", "Schmidt",
+	"Dubois", "Rossi", "Novak", "Jensen", "Kowalski", "Tanaka", "Patel",
+	"Okafor", "Silva",
+}
+
+var companies = []string{
+	"Brightleaf Studio", "Northwind Traders", "Bluepeak Labs", "Copperline Media",
+	"Harbor & Finch", "Quartz Analytics", "Greenfield Bakery", "Atlas Legal",
+}
+
+var streets = []string{
+	"Main Street", "Oak Avenue", "Market Street", "Elm Road", "Harbour Lane",
+	"Station Road", "Park Avenue", "Mill Street",
+}
+
+// places pair a city with its country and the currency customers there
+// are billed in
+var places = []struct {
+	city, state, postalCode, country, currency, dialCode string
+}{
+	{"Austin", "TX", "78701", "US", "USD", "1"},
+	{"Portland", "OR", "97205", "US", "USD", "1"},
+	{"Chicago", "IL", "60601", "US", "USD", "1"},
+	{"Toronto", "ON", "M5H 2N2", "CA", "USD", "1"},
+	{"London", "", "EC1A 1BB", "GB", "USD", "44"},
+	{"Berlin", "", "10115", "DE", "EUR", "49"},
+	{"Lyon", "", "69002", "FR", "EUR", "33"},
+	{"Amsterdam", "", "1012 AB", "NL", "EUR", "31"},
+	{"Milan", "", "20121", "IT", "EUR", "39"},
+	{"Vienna", "", "1010", "AT", "EUR", "43"},
+}
+
+// domains build the domain name of a hosting account
+var domains = []func(customer *domain.User) string{
+	func(c *domain.User) string { return strings.ToLower(c.FirstName+c.LastName) + ".com" },
+	func(c *domain.User) string { return strings.ToLower(c.LastName) + "-family.net" },
+	func(c *domain.User) string {
+		return "blog." + strings.ToLower(c.FirstName) + strings.ToLower(c.LastName) + ".org"
+	},
+	func(c *domain.User) string { return strings.ToLower(c.LastName) + "shop.eu" },
+}
+
+type demoGateway struct {
+	slug    string
+	percent decimal.Decimal
+	fixed   decimal.Decimal
+}
+
+var gateways = []demoGateway{
+	{"stripe", decimal.RequireFromString("2.9"), decimal.RequireFromString("0.30")},
+	{"stripe", decimal.RequireFromString("2.9"), decimal.RequireFromString("0.30")},
+	{"paypal", decimal.RequireFromString("3.49"), decimal.RequireFromString("0.49")},
+	{"bank_transfer", decimal.Zero, decimal.Zero},
+}
+
+func gatewayBySlug(slug string) demoGateway {
+	for _, gateway := range gateways {
+		if gateway.slug == slug {
+			return gateway
+		}
+	}
+	return gateways[0]
+}
+
+var cancellationReasons = []string{
+	"Moving the site to a managed platform",
+	"Project ended",
+	"Too expensive for our current budget",
+	"Consolidating servers with another provider",
+}
+
+// ticketTopics alternate between the customer and staff, the customer
+// writing first
+var ticketTopics = []struct {
+	department string
+	subject    string
+	urgent     bool
+	messages   []string
+}{
+	{
+		department: "Technical Support",
+		subject:    "Website down after plugin update",
+		urgent:     true,
+		messages: []string{
+			"Hi, my site shows a 500 error since I updated a plugin this morning. Can you take a look?",
+			"Hello, the error log shows a fatal error in the plugin you updated. We renamed its folder to disable it and the site is back online. Please check with the plugin author before enabling it again.",
+			"That worked, thank you for the quick help!",
+		},
+	},
+	{
+		department: "Technical Support",
+		subject:    "How do I point my domain to the server?",
+		messages: []string{
+			"I registered my domain elsewhere. Which nameservers should I use?",
+			"Hello, please set ns1.example.net and ns2.example.net at your registrar. The change can take up to 24 hours to spread.",
+		},
+	},
+	{
+		department: "Technical Support",
+		subject:    "Server unreachable over SSH",
+		urgent:     true,
+		messages: []string{
+			"I can't connect over SSH since yesterday evening. Ping still works.",
+			"Hello, the firewall on the server blocked your address after several failed logins. We removed the block; you should be able to connect again.",
+			"Confirmed, I'm in. Thanks.",
+		},
+	},
+	{
+		department: "Billing",
+		subject:    "Question about my latest invoice",
+		messages: []string{
+			"Why is my invoice higher this month?",
+			"Hello, the invoice includes the setup fee of the server you ordered along with the first month. Later invoices will only have the monthly price.",
+		},
+	},
+	{
+		department: "Billing",
+		subject:    "Switch to yearly billing",
+		messages: []string{
+			"Can I switch my plan to yearly billing to get the discount?",
+			"Hello, yes. We changed the billing cycle; your next invoice will be for a full year at the yearly price.",
+			"Great, thank you.",
+		},
+	},
+}
+
+type demoArticle struct {
+	title, excerpt, content string
+	tags                    []interface{}
+}
+
+var knowledgeBase = []struct {
+	name, description string
+	articles          []demoArticle
+}{
+	{
+		name:        "Getting Started",
+		description: "First steps with your new service",
+		articles: []demoArticle{
+			{
+				title:   "Connecting to your server with SSH",
+				excerpt: "Log in to a VPS or dedicated server from your computer.",
+				content: "Your server's address and root password are in the welcome email.\n\n" +
+					"## From Linux or macOS\n\n```bash\nssh root@your-server-ip\n```\n\n" +
+					"## From Windows\n\nUse the built-in OpenSSH client from PowerShell, or an SSH client such as PuTTY.\n\n" +
+					"Change the root password on first login with `passwd`.",
+				tags: []interface{}{"ssh", "vps"},
+			},
+			{
+				title:   "Pointing your domain to us",
+				excerpt: "Nameservers and DNS records for your hosting account.",
+				content: "Set these nameservers at your domain registrar:\n\n- ns1.example.net\n- ns2.example.net\n\n" +
+					"If you would rather keep your DNS elsewhere, create an **A record** for your domain pointing to the address in your welcome email.",
+				tags: []interface{}{"dns", "domains"},
+			},
+		},
+	},
+	{
+		name:        "Billing",
+		description: "Invoices, payments and cancellations",
+		articles: []demoArticle{
+			{
+				title:   "Paying an invoice",
+				excerpt: "Pay by card, PayPal or bank transfer.",
+				content: "Open **Billing > Invoices** in the client area and choose **Pay now**.\n\n" +
+					"Card and PayPal payments are applied at once. Bank transfers are applied when they reach us, usually within two working days; put the invoice number in the reference.",
+				tags: []interface{}{"invoices", "payments"},
+			},
+			{
+				title:   "Cancelling a service",
+				excerpt: "End a service at the end of its billing period or right away.",
+				content: "Open the service and choose **Request cancellation**. Cancelling at the end of the billing period keeps the service running until the period you paid for ends.\n\n" +
+					"Back up your data first: it is deleted when the service is terminated.",
+				tags: []interface{}{"cancellation"},
+			},
+		},
+	},
+	{
+		name:        "Web Hosting",
+		description: "Managing websites, email and databases",
+		articles: []demoArticle{
+			{
+				title:   "Creating an email account",
+				excerpt: "Add mailboxes on your domain.",
+				content: "1. Log in to the control panel from the service page.\n2. Open **Email Accounts** and choose **Create**.\n3. Enter the address and a strong password.\n\n" +
+					"Use `mail.yourdomain.com` as the incoming and outgoing server, on ports 993 (IMAP) and 465 (SMTP).",
+				tags: []interface{}{"email", "cpanel"},
+			},
+			{
+				title:   "Installing a free SSL certificate",
+				excerpt: "Serve your site over HTTPS.",
+				content: "Certificates are issued and renewed automatically once your domain points to us. " +
+					"To force HTTPS, add this to your `.htaccess`:\n\n```apache\nRewriteEngine On\nRewriteCond %{HTTPS} off\nRewriteRule ^ https://%{HTTP_HOST}%{REQUEST_URI} [L,R=301]\n```",
+				tags: []interface{}{"ssl", "https"},
+			},
+		},
+	},
+}
@@ -0,0 +1,527 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("download category not found")
+	ErrCategoryNotEmpty = errors.New("download category still has downloads or subcategories")
+	ErrDownloadNotFound = errors.New("download not found")
+	ErrLoginRequired    = errors.New("download requires login")
+	ErrAccessDenied     = errors.New("download requires an active service of another product")
+	ErrNoFileStore      = errors.New("file storage is not configured")
+	ErrNameRequired     = errors.New("download name is required")
+)
+
+// Service provides the downloads area: categories of files that are
+// public, limited to logged in clients or to owners of certain products
+type Service struct {
+	db         *gorm.DB
+	files      domain.FileStore
+	quarantine *quarantine.Service
+}
+
+// NewService creates a new download service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetFileStore sets the store download files are uploaded to
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetQuarantine scans new files for malware before they are stored
+func (s *Service) SetQuarantine(q *quarantine.Service) {
+	s.quarantine = q
+}
+
+// DownloadInput holds the editable fields of a download. A nil Version
+// or Changelog keeps the current one.
+type DownloadInput struct {
+	CategoryID  uint64
+	Name        string
+	Description string
+	Version     *string
+	Changelog   *string
+	ClientsOnly bool
+	ProductIDs  []uint64
+	SortOrder   int
+	Active      bool
+}
+
+// FileInput is the file of a new download or version
+type FileInput struct {
+	FileName    string
+	ContentType string
+	Reader      io.Reader
+	Size        int64
+}
+
+// --- Categories ---
+
+// CreateCategory creates a new download category
+func (s *Service) CreateCategory(name, description string, parentID *uint64, sortOrder int) (*domain.DownloadCategory, error) {
+	if parentID != nil {
+		if err := s.db.Select("id").First(&domain.DownloadCategory{}, *parentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrCategoryNotFound
+			}
+			return nil, err
+		}
+	}
+
+	category := &domain.DownloadCategory{
+		ParentID:    parentID,
+		Name:        name,
+		Description: description,
+		SortOrder:   sortOrder,
+		Active:      true,
+	}
+	if err := s.db.Create(category).Error; err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// ListCategories lists the top level categories with their children
+func (s *Service) ListCategories(activeOnly bool) ([]domain.DownloadCategory, error) {
+	var categories []domain.DownloadCategory
+	query := s.db.Where("parent_id IS NULL").Order("sort_order ASC, name ASC")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Preload("Children", func(db *gorm.DB) *gorm.DB {
+		if activeOnly {
+			db = db.Where("active = ?", true)
+		}
+		return db.Order("sort_order ASC, name ASC")
+	}).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// UpdateCategory updates a category
+func (s *Service) UpdateCategory(id uint64, name, description string, sortOrder int, active bool) error {
+	result := s.db.Model(&domain.DownloadCategory{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"sort_order":  sortOrder,
+			"active":      active,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// DeleteCategory deletes an empty category
+func (s *Service) DeleteCategory(id uint64) error {
+	var count int64
+	if err := s.db.Model(&domain.Download{}).Where("category_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := s.db.Model(&domain.DownloadCategory{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return ErrCategoryNotEmpty
+	}
+
+	result := s.db.Delete(&domain.DownloadCategory{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// --- Downloads ---
+
+// ListDownloads lists the active downloads user may download, optionally
+// of one category. A nil user sees the public downloads only.
+func (s *Service) ListDownloads(user *domain.User, categoryID *uint64) ([]domain.Download, error) {
+	query := s.db.Preload("Category").
+		Where("active = ? AND category_id IN (?)", true,
+			s.db.Model(&domain.DownloadCategory{}).Select("id").Where("active = ?", true)).
+		Order("sort_order ASC, name ASC")
+	if categoryID != nil {
+		query = query.Where("category_id = ?", *categoryID)
+	}
+	if user == nil {
+		query = query.Where("clients_only = ?", false)
+	}
+
+	var downloads []domain.Download
+	if err := query.Find(&downloads).Error; err != nil {
+		return nil, err
+	}
+
+	owned, err := s.ownedProducts(user)
+	if err != nil {
+		return nil, err
+	}
+	visible := downloads[:0]
+	for _, d := range downloads {
+		if checkAccess(&d, user, owned) == nil {
+			visible = append(visible, d)
+		}
+	}
+	return visible, nil
+}
+
+// AdminListDownloads lists all downloads, optionally of one category
+func (s *Service) AdminListDownloads(categoryID *uint64, limit, offset int) ([]domain.Download, int64, error) {
+	query := s.db.Model(&domain.Download{})
+	if categoryID != nil {
+		query = query.Where("category_id = ?", *categoryID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var downloads []domain.Download
+	if err := query.Preload("Category").Order("category_id ASC, sort_order ASC, name ASC").
+		Limit(limit).Offset(offset).Find(&downloads).Error; err != nil {
+		return nil, 0, err
+	}
+	return downloads, total, nil
+}
+
+// GetDownload retrieves a download with its category
+func (s *Service) GetDownload(id uint64) (*domain.Download, error) {
+	var download domain.Download
+	if err := s.db.Preload("Category").First(&download, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDownloadNotFound
+		}
+		return nil, err
+	}
+	return &download, nil
+}
+
+// CheckAccess reports whether user may download d. Inactive downloads are
+// only available to staff.
+func (s *Service) CheckAccess(d *domain.Download, user *domain.User) error {
+	if user != nil && user.IsStaff() {
+		return nil
+	}
+	if !d.Active || !d.Category.Active {
+		return ErrDownloadNotFound
+	}
+	owned, err := s.ownedProducts(user)
+	if err != nil {
+		return err
+	}
+	return checkAccess(d, user, owned)
+}
+
+// CreateDownload uploads a file and creates a download for it
+func (s *Service) CreateDownload(ctx context.Context, input DownloadInput, file FileInput, uploadedBy uint64) (*domain.Download, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, ErrNameRequired
+	}
+	if err := s.categoryExists(input.CategoryID); err != nil {
+		return nil, err
+	}
+
+	download := &domain.Download{UploadedBy: uploadedBy}
+	applyInput(download, input)
+	if err := s.storeFile(ctx, download, file); err != nil {
+		return nil, err
+	}
+	if err := s.db.Omit("Category", "Uploader").Create(download).Error; err != nil {
+		s.removeFile(download.StorageKey)
+		return nil, err
+	}
+	return download, nil
+}
+
+// UpdateDownload updates the fields of a download, keeping its file
+func (s *Service) UpdateDownload(id uint64, input DownloadInput) (*domain.Download, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, ErrNameRequired
+	}
+	download, err := s.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if download.CategoryID != input.CategoryID {
+		if err := s.categoryExists(input.CategoryID); err != nil {
+			return nil, err
+		}
+	}
+
+	applyInput(download, input)
+	if err := s.db.Omit("Category", "Uploader").Save(download).Error; err != nil {
+		return nil, err
+	}
+	return s.GetDownload(id)
+}
+
+// AddVersion replaces the file of a download with a new version. The
+// changelog of the version is put on top of the existing changelog and
+// the file of the previous version is deleted.
+func (s *Service) AddVersion(ctx context.Context, id uint64, version, changelog string, file FileInput, uploadedBy uint64) (*domain.Download, error) {
+	download, err := s.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	previousKey := download.StorageKey
+
+	download.UploadedBy = uploadedBy
+	if err := s.storeFile(ctx, download, file); err != nil {
+		return nil, err
+	}
+	download.Version = version
+	if changelog = strings.TrimSpace(changelog); changelog != "" {
+		entry := changelog
+		if version != "" {
+			entry = version + "\n" + changelog
+		}
+		if download.Changelog != "" {
+			entry += "\n\n" + download.Changelog
+		}
+		download.Changelog = entry
+	}
+
+	if err := s.db.Omit("Category", "Uploader").Save(download).Error; err != nil {
+		s.removeFile(download.StorageKey)
+		return nil, err
+	}
+	s.removeFile(previousKey)
+	return download, nil
+}
+
+// DeleteDownload deletes a download, its log and its file
+func (s *Service) DeleteDownload(id uint64) error {
+	var download domain.Download
+	if err := s.db.First(&download, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDownloadNotFound
+		}
+		return err
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("download_id = ?", id).Delete(&domain.DownloadLog{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&download).Error
+	}); err != nil {
+		return err
+	}
+	s.removeFile(download.StorageKey)
+	return nil
+}
+
+// DownloadURL returns a signed URL of the file of a download, or "" for
+// files added by local path before the file store
+func (s *Service) DownloadURL(d *domain.Download, expires time.Duration) (string, error) {
+	if d.StorageKey == "" || s.files == nil {
+		return "", nil
+	}
+	return s.files.SignedURL(d.StorageKey, d.FileName, expires)
+}
+
+// OpenFile returns the file of a download added by local path
+func (s *Service) OpenFile(d *domain.Download) (*os.File, error) {
+	if d.FilePath == "" {
+		return nil, ErrDownloadNotFound
+	}
+	return os.Open(d.FilePath)
+}
+
+// RecordDownload counts a download and logs who downloaded it
+func (s *Service) RecordDownload(downloadID uint64, customerID *uint64, ipAddress, userAgent string) error {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Download{}).Where("id = ?", downloadID).
+			Update("downloads", gorm.Expr("downloads + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Create(&domain.DownloadLog{
+			DownloadID: downloadID,
+			CustomerID: customerID,
+			IPAddress:  ipAddress,
+			UserAgent:  userAgent,
+		}).Error
+	})
+}
+
+// ListLogs lists the download log of a download, newest first
+func (s *Service) ListLogs(downloadID uint64, limit, offset int) ([]domain.DownloadLog, int64, error) {
+	query := s.db.Model(&domain.DownloadLog{}).Where("download_id = ?", downloadID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []domain.DownloadLog
+	if err := query.Preload("Customer").Order("created_at DESC").
+		Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// ProductIDs returns the products a download is limited to
+func ProductIDs(d *domain.Download) []uint64 {
+	values, _ := d.ProductIDs["products"].([]interface{})
+	ids := make([]uint64, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(float64); ok {
+			ids = append(ids, uint64(id))
+		}
+	}
+	return ids
+}
+
+// checkAccess checks the login and product restrictions of a download
+// against the products the user owns an active service of
+func checkAccess(d *domain.Download, user *domain.User, owned map[uint64]bool) error {
+	products := ProductIDs(d)
+	if user == nil {
+		if d.ClientsOnly || len(products) > 0 {
+			return ErrLoginRequired
+		}
+		return nil
+	}
+	if user.IsStaff() || len(products) == 0 {
+		return nil
+	}
+	for _, id := range products {
+		if owned[id] {
+			return nil
+		}
+	}
+	return ErrAccessDenied
+}
+
+// ownedProducts returns the products user has an active service of
+func (s *Service) ownedProducts(user *domain.User) (map[uint64]bool, error) {
+	owned := make(map[uint64]bool)
+	if user == nil {
+		return owned, nil
+	}
+	var ids []uint64
+	if err := s.db.Model(&domain.Service{}).
+		Where("customer_id = ? AND status = ?", user.ID, domain.ServiceStatusActive).
+		Distinct().Pluck("product_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		owned[id] = true
+	}
+	return owned, nil
+}
+
+func (s *Service) categoryExists(id uint64) error {
+	if err := s.db.Select("id").First(&domain.DownloadCategory{}, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func applyInput(d *domain.Download, input DownloadInput) {
+	d.CategoryID = input.CategoryID
+	d.Name = strings.TrimSpace(input.Name)
+	d.Description = input.Description
+	if input.Version != nil {
+		d.Version = *input.Version
+	}
+	if input.Changelog != nil {
+		d.Changelog = *input.Changelog
+	}
+	d.ClientsOnly = input.ClientsOnly
+	d.SortOrder = input.SortOrder
+	d.Active = input.Active
+
+	products := make([]interface{}, 0, len(input.ProductIDs))
+	for _, id := range input.ProductIDs {
+		products = append(products, float64(id))
+	}
+	d.ProductIDs = domain.JSONMap{"products": products}
+}
+
+// storeFile scans and uploads the file of a download and sets its file
+// fields
+func (s *Service) storeFile(ctx context.Context, d *domain.Download, file FileInput) error {
+	if s.files == nil {
+		return ErrNoFileStore
+	}
+	uploadedBy := d.UploadedBy
+	checked, err := s.quarantine.Check(ctx, quarantine.Upload{
+		Source:      domain.UploadSourceDownload,
+		SourceID:    d.ID,
+		UploadedBy:  &uploadedBy,
+		FileName:    file.FileName,
+		ContentType: file.ContentType,
+		Reader:      file.Reader,
+		Size:        file.Size,
+	})
+	if err != nil {
+		return err
+	}
+	defer checked.Close()
+
+	key, err := domain.NewFileKey("downloads", d.CategoryID)
+	if err != nil {
+		return err
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	counter := &domain.CountingReader{R: checked}
+	if err := s.files.Put(ctx, key, counter, checked.Size, contentType); err != nil {
+		return err
+	}
+
+	d.FileName = file.FileName
+	d.FilePath = ""
+	d.StorageKey = key
+	d.FileSize = counter.N
+	d.ContentType = contentType
+	return nil
+}
+
+// removeFile deletes a stored file. Files added by path before the file
+// store are left alone.
+func (s *Service) removeFile(key string) {
+	if key == "" || s.files == nil {
+		return
+	}
+	if err := s.files.Delete(context.Background(), key); err != nil {
+		log.Printf("download: failed to delete file %s: %v", key, err)
+	}
+}
@@ -0,0 +1,449 @@
+// Package dunning chases overdue invoices: it reminds customers on set
+// days overdue, suspends the services billed on invoices left unpaid for
+// too long and tracks the promises to pay staff record, which pause both
+// until the promised day.
+package dunning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/order"
+)
+
+var (
+	ErrInvoiceNotFound     = errors.New("invoice not found")
+	ErrInvoiceNotDue       = errors.New("only unpaid and overdue invoices with a balance can be promised")
+	ErrInvalidPromiseDate  = errors.New("the promised date must be between today and 90 days from now")
+	ErrNoActivePromise     = errors.New("invoice has no active promise to pay")
+	ErrInvalidReminderDays = errors.New("reminder days must be up to 10 distinct days between 1 and 365")
+	ErrInvalidSuspendDays  = errors.New("suspend days must be between 0 and 365")
+)
+
+const NotificationPromiseBroken = "payment_promise_broken"
+
+const (
+	// maxPromiseDays is the furthest ahead a payment can be promised
+	maxPromiseDays = 90
+	// maxDunningDays is the latest day overdue a step can be set on
+	maxDunningDays = 365
+	maxReminders   = 10
+)
+
+// DefaultReminderDays are the days overdue customers are reminded on when
+// none are set
+var DefaultReminderDays = []int{1, 7, 14}
+
+// Settings are the steps of dunning
+type Settings struct {
+	ReminderDays []int // Days overdue a reminder is sent on, ascending
+	SuspendDays  int   // Days overdue services are suspended after, 0 never
+}
+
+// Result counts what a dunning run did
+type Result struct {
+	Kept      int
+	Broken    int
+	Reminded  int
+	Suspended int
+}
+
+// Service chases overdue invoices
+type Service struct {
+	db     *gorm.DB
+	paused func() bool
+}
+
+// NewService creates a new dunning service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetPause sets a check that skips the dunning runs of Monitor while it
+// returns true, such as during maintenance. Overdue invoices are caught
+// up with on the next run.
+func (s *Service) SetPause(paused func() bool) {
+	s.paused = paused
+}
+
+// Settings returns the dunning steps
+func (s *Service) Settings() (Settings, error) {
+	settings := Settings{ReminderDays: DefaultReminderDays}
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{domain.SettingDunningReminderDays, domain.SettingDunningSuspendDays}).
+		Find(&rows).Error; err != nil {
+		return settings, err
+	}
+	for _, row := range rows {
+		switch row.Key {
+		case domain.SettingDunningReminderDays:
+			if days, err := parseDays(row.Value); err == nil {
+				settings.ReminderDays = days
+			}
+		case domain.SettingDunningSuspendDays:
+			if days, err := strconv.Atoi(row.Value); err == nil && days >= 0 {
+				settings.SuspendDays = days
+			}
+		}
+	}
+	return settings, nil
+}
+
+// UpdateSettings sets the dunning steps. Empty reminder days send no
+// reminders.
+func (s *Service) UpdateSettings(settings Settings) (Settings, error) {
+	days := append([]int(nil), settings.ReminderDays...)
+	sort.Ints(days)
+	for i, day := range days {
+		if day < 1 || day > maxDunningDays || (i > 0 && day == days[i-1]) {
+			return Settings{}, ErrInvalidReminderDays
+		}
+	}
+	if len(days) > maxReminders {
+		return Settings{}, ErrInvalidReminderDays
+	}
+	if settings.SuspendDays < 0 || settings.SuspendDays > maxDunningDays {
+		return Settings{}, ErrInvalidSuspendDays
+	}
+
+	values := []domain.Setting{
+		{Key: domain.SettingDunningReminderDays, Value: formatDays(days), Type: "string", Group: "billing", Label: "Overdue reminder days"},
+		{Key: domain.SettingDunningSuspendDays, Value: strconv.Itoa(settings.SuspendDays), Type: "int", Group: "billing", Label: "Suspend services after days overdue"},
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			setting := domain.Setting{Key: value.Key}
+			if err := tx.Where("key = ?", value.Key).
+				Assign(domain.Setting{Value: value.Value, Type: value.Type, Group: value.Group, Label: value.Label}).
+				FirstOrCreate(&setting).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{ReminderDays: days, SuspendDays: settings.SuspendDays}, nil
+}
+
+// RecordPromise records a customer's promise to pay an invoice by a date,
+// pausing dunning until the end of that day. A promise already active is
+// replaced.
+func (s *Service) RecordPromise(invoiceID uint64, promisedDate time.Time, note string, staffID uint64, now time.Time) (*domain.PaymentPromise, error) {
+	promisedDate = startOfDay(promisedDate)
+	today := startOfDay(now)
+	if promisedDate.Before(today) || promisedDate.After(today.AddDate(0, 0, maxPromiseDays)) {
+		return nil, ErrInvalidPromiseDate
+	}
+
+	var promise *domain.PaymentPromise
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var inv domain.Invoice
+		if err := tx.First(&inv, invoiceID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvoiceNotFound
+			}
+			return err
+		}
+		if (inv.Status != domain.InvoiceStatusUnpaid && inv.Status != domain.InvoiceStatusOverdue) || !inv.Balance.IsPositive() {
+			return ErrInvoiceNotDue
+		}
+		if err := resolveActive(tx, invoiceID, domain.PaymentPromiseCancelled, now); err != nil {
+			return err
+		}
+		promise = &domain.PaymentPromise{
+			InvoiceID:    inv.ID,
+			CustomerID:   inv.CustomerID,
+			PromisedDate: promisedDate,
+			Note:         strings.TrimSpace(note),
+			Status:       domain.PaymentPromiseActive,
+			RecordedBy:   staffID,
+		}
+		return tx.Create(promise).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promise, nil
+}
+
+// CancelPromise withdraws the active promise to pay an invoice, resuming
+// dunning
+func (s *Service) CancelPromise(invoiceID uint64, now time.Time) error {
+	result := s.db.Model(&domain.PaymentPromise{}).
+		Where("invoice_id = ? AND status = ?", invoiceID, domain.PaymentPromiseActive).
+		Updates(map[string]interface{}{"status": domain.PaymentPromiseCancelled, "resolved_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoActivePromise
+	}
+	return nil
+}
+
+// ListPromises returns the promises to pay an invoice, the latest first
+func (s *Service) ListPromises(invoiceID uint64) ([]domain.PaymentPromise, error) {
+	var promises []domain.PaymentPromise
+	err := s.db.Where("invoice_id = ?", invoiceID).Order("id DESC").Find(&promises).Error
+	return promises, err
+}
+
+// Run marks invoices past their due date overdue, settles the promises to
+// pay and then reminds customers and suspends services as the dunning
+// steps say
+func (s *Service) Run(now time.Time) (Result, error) {
+	var result Result
+	settings, err := s.Settings()
+	if err != nil {
+		return result, err
+	}
+	if err := invoice.NewService(s.db).MarkOverdueInvoices(); err != nil {
+		return result, err
+	}
+	if result.Kept, result.Broken, err = s.settlePromises(now); err != nil {
+		return result, err
+	}
+	if result.Reminded, err = s.remind(settings, now); err != nil {
+		return result, err
+	}
+	if result.Suspended, err = s.suspend(settings, now); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Monitor runs dunning on the given interval until ctx is cancelled
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.paused == nil || !s.paused() {
+			if result, err := s.Run(time.Now()); err != nil {
+				log.Printf("failed to run dunning: %v", err)
+			} else if result != (Result{}) {
+				log.Printf("dunning: %d reminder(s), %d service(s) suspended, %d promise(s) kept, %d broken",
+					result.Reminded, result.Suspended, result.Kept, result.Broken)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// settlePromises closes the active promises of invoices no longer due as
+// kept and breaks those whose day has passed unpaid
+func (s *Service) settlePromises(now time.Time) (int, int, error) {
+	var promises []domain.PaymentPromise
+	if err := s.db.Preload("Invoice").Where("status = ?", domain.PaymentPromiseActive).
+		Order("id").Find(&promises).Error; err != nil {
+		return 0, 0, err
+	}
+
+	kept, broken := 0, 0
+	notifier := notification.NewService(s.db)
+	for i := range promises {
+		promise := &promises[i]
+		due := promise.Invoice.Status == domain.InvoiceStatusUnpaid || promise.Invoice.Status == domain.InvoiceStatusOverdue
+		switch {
+		case !due || !promise.Invoice.Balance.IsPositive():
+			status := domain.PaymentPromiseKept
+			if promise.Invoice.Status == domain.InvoiceStatusCancelled {
+				status = domain.PaymentPromiseCancelled
+			}
+			if err := s.resolve(promise, status, now); err != nil {
+				return kept, broken, err
+			}
+			if status == domain.PaymentPromiseKept {
+				kept++
+			}
+		case !now.Before(promise.PromisedDate.AddDate(0, 0, 1)):
+			if err := s.resolve(promise, domain.PaymentPromiseBroken, now); err != nil {
+				return kept, broken, err
+			}
+			s.escalate(notifier, promise)
+			broken++
+		}
+	}
+	return kept, broken, nil
+}
+
+// escalate tells the customer and the staff member who recorded a broken
+// promise. Dunning resumes on the next reminder step.
+func (s *Service) escalate(notifier *notification.Service, promise *domain.PaymentPromise) {
+	inv := &promise.Invoice
+	err := notifier.SendCategoryEmail(inv.CustomerID, domain.EmailCategoryBilling, "invoice_promise_broken", map[string]interface{}{
+		"InvoiceID":     inv.ID,
+		"InvoiceNumber": inv.InvoiceNumber,
+		"Currency":      inv.Currency,
+		"Balance":       inv.Balance.StringFixed(2),
+		"PromisedDate":  promise.PromisedDate.Format("2006-01-02"),
+	})
+	if err != nil && !errors.Is(err, notification.ErrTemplateNotFound) && !errors.Is(err, notification.ErrSMTPNotConfigured) {
+		log.Printf("failed to email broken promise of invoice %d: %v", inv.ID, err)
+	}
+
+	title := fmt.Sprintf("Promise to pay broken: %s", inv.InvoiceNumber)
+	message := fmt.Sprintf("Invoice %s was promised to be paid by %s and still has %s %s due.",
+		inv.InvoiceNumber, promise.PromisedDate.Format("2006-01-02"), inv.Balance.StringFixed(2), inv.Currency)
+	link := fmt.Sprintf("/admin/invoices?id=%d", inv.ID)
+	if err := notifier.SendNotification(promise.RecordedBy, NotificationPromiseBroken, title, message, link); err != nil {
+		log.Printf("failed to notify staff %d of broken promise %d: %v", promise.RecordedBy, promise.ID, err)
+	}
+}
+
+// remind sends the next reminder of the overdue invoices without an active
+// promise that reached its day. Steps passed while dunning was paused are
+// skipped rather than sent at once.
+func (s *Service) remind(settings Settings, now time.Time) (int, error) {
+	if len(settings.ReminderDays) == 0 {
+		return 0, nil
+	}
+	first := now.AddDate(0, 0, -settings.ReminderDays[0])
+
+	var invoices []domain.Invoice
+	if err := s.overdue(first).Where("reminders_sent < ?", len(settings.ReminderDays)).
+		Order("due_date, id").Find(&invoices).Error; err != nil {
+		return 0, err
+	}
+
+	reminded := 0
+	notifier := notification.NewService(s.db)
+	for i := range invoices {
+		inv := &invoices[i]
+		days := int(now.Sub(inv.DueDate) / (24 * time.Hour))
+		step := 0
+		for step < len(settings.ReminderDays) && settings.ReminderDays[step] <= days {
+			step++
+		}
+		if step <= inv.RemindersSent {
+			continue
+		}
+
+		err := notifier.SendCategoryEmail(inv.CustomerID, domain.EmailCategoryBilling, "invoice_overdue", map[string]interface{}{
+			"InvoiceID":     inv.ID,
+			"InvoiceNumber": inv.InvoiceNumber,
+			"Currency":      inv.Currency,
+			"Balance":       inv.Balance.StringFixed(2),
+			"DueDate":       inv.DueDate.Format("2006-01-02"),
+			"DaysOverdue":   days,
+		})
+		if err != nil && !errors.Is(err, notification.ErrTemplateNotFound) && !errors.Is(err, notification.ErrSMTPNotConfigured) {
+			log.Printf("failed to remind customer of invoice %d: %v", inv.ID, err)
+			continue
+		}
+		if err := s.db.Model(inv).Updates(map[string]interface{}{
+			"reminders_sent":   step,
+			"last_reminder_at": now,
+		}).Error; err != nil {
+			return reminded, err
+		}
+		reminded++
+	}
+	return reminded, nil
+}
+
+// suspend suspends the active services billed on the overdue invoices
+// without an active promise that passed the suspension day
+func (s *Service) suspend(settings Settings, now time.Time) (int, error) {
+	if settings.SuspendDays == 0 {
+		return 0, nil
+	}
+
+	var invoices []domain.Invoice
+	if err := s.overdue(now.AddDate(0, 0, -settings.SuspendDays)).Preload("LineItems").
+		Order("due_date, id").Find(&invoices).Error; err != nil {
+		return 0, err
+	}
+
+	suspended := 0
+	orders := order.NewService(s.db)
+	for _, inv := range invoices {
+		for _, item := range inv.LineItems {
+			if item.ServiceID == nil {
+				continue
+			}
+			var count int64
+			if err := s.db.Model(&domain.Service{}).
+				Where("id = ? AND status = ?", *item.ServiceID, domain.ServiceStatusActive).
+				Count(&count).Error; err != nil {
+				return suspended, err
+			}
+			if count == 0 {
+				continue
+			}
+			if err := orders.SuspendService(*item.ServiceID, fmt.Sprintf("Overdue invoice %s", inv.InvoiceNumber)); err != nil {
+				return suspended, err
+			}
+			suspended++
+		}
+	}
+	return suspended, nil
+}
+
+// overdue selects the overdue invoices with a balance due before a time
+// and no active promise to pay
+func (s *Service) overdue(dueBefore time.Time) *gorm.DB {
+	return s.db.Where("status = ? AND balance > 0 AND due_date <= ?", domain.InvoiceStatusOverdue, dueBefore).
+		Where("id NOT IN (?)", s.db.Model(&domain.PaymentPromise{}).Select("invoice_id").
+			Where("status = ?", domain.PaymentPromiseActive))
+}
+
+func (s *Service) resolve(promise *domain.PaymentPromise, status domain.PaymentPromiseStatus, now time.Time) error {
+	// The status condition keeps a promise from being settled twice
+	return s.db.Model(&domain.PaymentPromise{}).
+		Where("id = ? AND status = ?", promise.ID, domain.PaymentPromiseActive).
+		Updates(map[string]interface{}{"status": status, "resolved_at": now}).Error
+}
+
+func resolveActive(tx *gorm.DB, invoiceID uint64, status domain.PaymentPromiseStatus, now time.Time) error {
+	return tx.Model(&domain.PaymentPromise{}).
+		Where("invoice_id = ? AND status = ?", invoiceID, domain.PaymentPromiseActive).
+		Updates(map[string]interface{}{"status": status, "resolved_at": now}).Error
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func parseDays(value string) ([]int, error) {
+	days := []int{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		day, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	return days, nil
+}
+
+func formatDays(days []int) string {
+	parts := make([]string, len(days))
+	for i, day := range days {
+		parts[i] = strconv.Itoa(day)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,320 @@
+// Package export streams invoices, transactions and customers as NDJSON
+// or CSV. Rows are read from the database in keyset batches and written
+// out as they arrive, so an export of millions of rows holds one batch in
+// memory and a slow reader holds back the next query instead of queuing
+// rows.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ErrUnknownFormat = errors.New("format must be ndjson or csv")
+
+// Format is the encoding of an export
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson" // One JSON object per line
+	FormatCSV    Format = "csv"    // A header row, then one record per row
+)
+
+// ParseFormat reads an export format, NDJSON when empty
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case "", FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Filter narrows an export. Zero fields match everything.
+type Filter struct {
+	Status     string
+	CustomerID uint64     // Invoices and transactions only
+	From       *time.Time // Created at or after
+	To         *time.Time // Created before
+	AfterID    uint64     // Resume an interrupted export after this ID
+}
+
+// InvoiceRow is an exported invoice
+type InvoiceRow struct {
+	ID            uint64          `json:"id"`
+	InvoiceNumber string          `json:"invoice_number"`
+	CustomerID    uint64          `json:"customer_id"`
+	CustomerEmail string          `json:"customer_email"`
+	Status        string          `json:"status"`
+	Currency      string          `json:"currency"`
+	Subtotal      decimal.Decimal `json:"subtotal"`
+	Discount      decimal.Decimal `json:"discount"`
+	TaxAmount     decimal.Decimal `json:"tax_amount"`
+	Total         decimal.Decimal `json:"total"`
+	AmountPaid    decimal.Decimal `json:"amount_paid"`
+	Balance       decimal.Decimal `json:"balance"`
+	DueDate       time.Time       `json:"due_date"`
+	PaidAt        *time.Time      `json:"paid_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+var invoiceHeader = []string{"id", "invoice_number", "customer_id", "customer_email", "status", "currency",
+	"subtotal", "discount", "tax_amount", "total", "amount_paid", "balance", "due_date", "paid_at", "created_at"}
+
+func (r *InvoiceRow) record() []string {
+	return []string{
+		formatID(r.ID), r.InvoiceNumber, formatID(r.CustomerID), r.CustomerEmail, r.Status, r.Currency,
+		r.Subtotal.String(), r.Discount.String(), r.TaxAmount.String(), r.Total.String(),
+		r.AmountPaid.String(), r.Balance.String(),
+		formatTime(&r.DueDate), formatTime(r.PaidAt), formatTime(&r.CreatedAt),
+	}
+}
+
+// TransactionRow is an exported transaction
+type TransactionRow struct {
+	ID             uint64          `json:"id"`
+	CustomerID     uint64          `json:"customer_id"`
+	CustomerEmail  string          `json:"customer_email"`
+	InvoiceID      *uint64         `json:"invoice_id"`
+	Type           string          `json:"type"`
+	Status         string          `json:"status"`
+	Currency       string          `json:"currency"`
+	Amount         decimal.Decimal `json:"amount"`
+	Fee            decimal.Decimal `json:"fee"`
+	RefundedAmount decimal.Decimal `json:"refunded_amount"`
+	Gateway        string          `json:"gateway"`
+	GatewayTransID string          `json:"gateway_trans_id"`
+	Test           bool            `json:"test"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+var transactionHeader = []string{"id", "customer_id", "customer_email", "invoice_id", "type", "status", "currency",
+	"amount", "fee", "refunded_amount", "gateway", "gateway_trans_id", "test", "created_at"}
+
+func (r *TransactionRow) record() []string {
+	invoiceID := ""
+	if r.InvoiceID != nil {
+		invoiceID = formatID(*r.InvoiceID)
+	}
+	return []string{
+		formatID(r.ID), formatID(r.CustomerID), r.CustomerEmail, invoiceID, r.Type, r.Status, r.Currency,
+		r.Amount.String(), r.Fee.String(), r.RefundedAmount.String(), r.Gateway, r.GatewayTransID,
+		strconv.FormatBool(r.Test), formatTime(&r.CreatedAt),
+	}
+}
+
+// CustomerRow is an exported customer
+type CustomerRow struct {
+	ID          uint64          `json:"id"`
+	Email       string          `json:"email"`
+	FirstName   string          `json:"first_name"`
+	LastName    string          `json:"last_name"`
+	Company     string          `json:"company"`
+	Status      string          `json:"status"`
+	Country     string          `json:"country"`
+	Currency    string          `json:"currency"`
+	Credit      decimal.Decimal `json:"credit"`
+	LastLoginAt *time.Time      `json:"last_login_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+var customerHeader = []string{"id", "email", "first_name", "last_name", "company", "status", "country",
+	"currency", "credit", "last_login_at", "created_at"}
+
+func (r *CustomerRow) record() []string {
+	return []string{
+		formatID(r.ID), r.Email, r.FirstName, r.LastName, r.Company, r.Status, r.Country,
+		r.Currency, r.Credit.String(), formatTime(r.LastLoginAt), formatTime(&r.CreatedAt),
+	}
+}
+
+// Service streams exports
+type Service struct {
+	db        *gorm.DB
+	batchSize int
+}
+
+// NewService creates a new export service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, batchSize: DefaultBatchSize}
+}
+
+// SetBatchSize sets how many rows are read from the database at a time
+func (s *Service) SetBatchSize(size int) {
+	if size > 0 {
+		s.batchSize = size
+	}
+}
+
+// Invoices writes the invoices matching filter to w in ID order and
+// returns how many were written
+func (s *Service) Invoices(ctx context.Context, w io.Writer, format Format, filter Filter) (int64, error) {
+	query := s.db.Table("invoices").
+		Select("invoices.id, invoices.invoice_number, invoices.customer_id, users.email AS customer_email, " +
+			"invoices.status, invoices.currency, invoices.subtotal, invoices.discount, invoices.tax_amount, " +
+			"invoices.total, invoices.amount_paid, invoices.balance, invoices.due_date, invoices.paid_at, " +
+			"invoices.created_at").
+		Joins("LEFT JOIN users ON users.id = invoices.customer_id")
+	query = applyFilter(query, "invoices", filter, true)
+
+	return writeRows(ctx, w, format, invoiceHeader, query, "invoices.id", filter.AfterID, s.batchSize,
+		func(r *InvoiceRow) uint64 { return r.ID })
+}
+
+// Transactions writes the transactions matching filter to w in ID order
+// and returns how many were written
+func (s *Service) Transactions(ctx context.Context, w io.Writer, format Format, filter Filter) (int64, error) {
+	query := s.db.Table("transactions").
+		Select("transactions.id, transactions.customer_id, users.email AS customer_email, " +
+			"transactions.invoice_id, transactions.type, transactions.status, transactions.currency, " +
+			"transactions.amount, transactions.fee, transactions.refunded_amount, transactions.gateway, " +
+			"transactions.gateway_trans_id, transactions.test, transactions.created_at").
+		Joins("LEFT JOIN users ON users.id = transactions.customer_id")
+	query = applyFilter(query, "transactions", filter, true)
+
+	return writeRows(ctx, w, format, transactionHeader, query, "transactions.id", filter.AfterID, s.batchSize,
+		func(r *TransactionRow) uint64 { return r.ID })
+}
+
+// Customers writes the customers matching filter to w in ID order and
+// returns how many were written
+func (s *Service) Customers(ctx context.Context, w io.Writer, format Format, filter Filter) (int64, error) {
+	query := s.db.Table("users").
+		Select("id, email, first_name, last_name, company, status, country, currency, credit, "+
+			"last_login_at, created_at").
+		Where("role = ?", domain.UserRoleCustomer)
+	query = applyFilter(query, "users", filter, false)
+
+	return writeRows(ctx, w, format, customerHeader, query, "users.id", filter.AfterID, s.batchSize,
+		func(r *CustomerRow) uint64 { return r.ID })
+}
+
+// writeRows streams the rows of query in keyset batches, flushing w after
+// each batch, and returns how many rows were written
+func writeRows[T any, R interface {
+	*T
+	recorder
+}](ctx context.Context, w io.Writer, format Format, header []string, query *gorm.DB, column string, after uint64, size int, key func(*T) uint64) (int64, error) {
+	enc := newEncoder(w, format)
+	if err := enc.header(header); err != nil {
+		return 0, err
+	}
+	err := Keyset(ctx, query, column, after, size, key, func(rows []T) error {
+		for i := range rows {
+			if err := enc.row(R(&rows[i])); err != nil {
+				return err
+			}
+		}
+		return enc.flush()
+	})
+	if err == nil {
+		// An empty CSV export still gets its header
+		err = enc.flush()
+	}
+	return enc.count, err
+}
+
+func applyFilter(query *gorm.DB, table string, filter Filter, byCustomer bool) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where(table+".status = ?", filter.Status)
+	}
+	if byCustomer && filter.CustomerID != 0 {
+		query = query.Where(table+".customer_id = ?", filter.CustomerID)
+	}
+	if filter.From != nil {
+		query = query.Where(table+".created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where(table+".created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// recorder is a row that can be written as a CSV record
+type recorder interface {
+	record() []string
+}
+
+// flusher is a writer that buffers, such as an HTTP response
+type flusher interface {
+	Flush()
+}
+
+// encoder writes rows in one format. Each batch is flushed through to
+// the underlying writer, which blocks while its reader falls behind.
+type encoder struct {
+	w      io.Writer
+	format Format
+	json   *json.Encoder
+	csv    *csv.Writer
+	count  int64
+}
+
+func newEncoder(w io.Writer, format Format) *encoder {
+	e := &encoder{w: w, format: format}
+	if format == FormatCSV {
+		e.csv = csv.NewWriter(w)
+	} else {
+		e.json = json.NewEncoder(w)
+	}
+	return e
+}
+
+func (e *encoder) header(columns []string) error {
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(columns)
+}
+
+func (e *encoder) row(row recorder) error {
+	e.count++
+	if e.csv != nil {
+		return e.csv.Write(row.record())
+	}
+	return e.json.Encode(row)
+}
+
+func (e *encoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := e.w.(flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func formatID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
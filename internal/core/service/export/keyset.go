@@ -0,0 +1,46 @@
+package export
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DefaultBatchSize is how many rows Keyset reads at a time when no batch
+// size is given
+const DefaultBatchSize = 500
+
+// Keyset runs query in batches ordered by the integer key column, each
+// batch starting after the last key of the one before, and calls fn with
+// every batch until the rows run out or fn fails.
+//
+// Unlike LIMIT and OFFSET, every batch is an index range scan costing the
+// same however deep into the table it starts, and rows inserted while
+// iterating never shift the ones not yet read. Only one batch is held in
+// memory at a time. The query must select column and key must return it.
+func Keyset[T any](ctx context.Context, query *gorm.DB, column string, after uint64, size int, key func(*T) uint64, fn func([]T) error) error {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var rows []T
+		err := query.Session(&gorm.Session{}).WithContext(ctx).
+			Where(column+" > ?", after).Order(column).Limit(size).Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+		if len(rows) < size {
+			return nil
+		}
+		after = key(&rows[len(rows)-1])
+	}
+}
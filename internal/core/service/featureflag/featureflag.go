@@ -0,0 +1,251 @@
+// Package featureflag decides which users get subsystems that are rolled
+// out gradually, such as the new checkout, and lets admins change that
+// without a redeploy.
+package featureflag
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrFlagNotFound      = errors.New("feature flag not found")
+	ErrInvalidKey        = errors.New("flag key must be 2 to 64 lowercase letters, digits, dots, dashes or underscores, starting with a letter")
+	ErrInvalidPercentage = errors.New("percentage must be between 0 and 100")
+	ErrInvalidRole       = errors.New("unknown role")
+)
+
+// cacheTTL is how long flags are cached. Other instances sharing the
+// database notice a change within it.
+const cacheTTL = 30 * time.Second
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{1,63}$`)
+
+// Input is the rollout of a flag as set by an admin
+type Input struct {
+	Description string
+	Enabled     bool
+	Percentage  int
+	Targets     domain.FeatureFlagTargets
+}
+
+// Service evaluates and changes feature flags
+type Service struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	flags    map[string]domain.FeatureFlag
+	loadedAt time.Time
+}
+
+// NewService creates a new feature flag service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Enabled reports whether a flag is on for a user, nil for a guest.
+// Unknown flags are off.
+func (s *Service) Enabled(key string, user *domain.User) bool {
+	flags := s.cached()
+	flag, ok := flags[key]
+	if !ok {
+		return false
+	}
+	var groups []uint64
+	if user != nil && len(flag.Targets.CustomerGroupIDs) > 0 {
+		groups = s.customerGroups(user.ID)
+	}
+	return evaluate(&flag, user, groups)
+}
+
+// EnabledFor returns the keys of the flags that are on for a user, nil
+// for a guest, sorted
+func (s *Service) EnabledFor(user *domain.User) []string {
+	flags := s.cached()
+	var groups []uint64
+	if user != nil {
+		for _, flag := range flags {
+			if flag.Enabled && len(flag.Targets.CustomerGroupIDs) > 0 {
+				groups = s.customerGroups(user.ID)
+				break
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(flags))
+	for key, flag := range flags {
+		if evaluate(&flag, user, groups) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// List returns every flag sorted by key, including the known flags that
+// were never saved
+func (s *Service) List() ([]domain.FeatureFlag, error) {
+	var flags []domain.FeatureFlag
+	if err := s.db.Order("key ASC").Find(&flags).Error; err != nil {
+		return nil, err
+	}
+	saved := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		saved[flag.Key] = true
+	}
+	for key, description := range domain.KnownFeatureFlags {
+		if !saved[key] {
+			flags = append(flags, domain.FeatureFlag{Key: key, Description: description})
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags, nil
+}
+
+// Get returns a flag. Known flags that were never saved are returned off.
+func (s *Service) Get(key string) (*domain.FeatureFlag, error) {
+	var flag domain.FeatureFlag
+	err := s.db.Where("key = ?", key).First(&flag).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if description, ok := domain.KnownFeatureFlags[key]; ok {
+			return &domain.FeatureFlag{Key: key, Description: description}, nil
+		}
+		return nil, ErrFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// Save creates or changes a flag. It applies on this instance at once.
+func (s *Service) Save(key string, input Input, updatedBy uint64) (*domain.FeatureFlag, error) {
+	if !keyPattern.MatchString(key) {
+		return nil, ErrInvalidKey
+	}
+	if input.Percentage < 0 || input.Percentage > 100 {
+		return nil, ErrInvalidPercentage
+	}
+	for _, role := range input.Targets.Roles {
+		if role != domain.UserRoleCustomer && role != domain.UserRoleStaff && role != domain.UserRoleAdmin {
+			return nil, ErrInvalidRole
+		}
+	}
+	description := strings.TrimSpace(input.Description)
+	if description == "" {
+		description = domain.KnownFeatureFlags[key]
+	}
+
+	flag := domain.FeatureFlag{Key: key}
+	if err := s.db.Where("key = ?", key).
+		Assign(map[string]interface{}{
+			"description": description,
+			"enabled":     input.Enabled,
+			"percentage":  input.Percentage,
+			"targets":     input.Targets,
+			"updated_by":  updatedBy,
+		}).
+		FirstOrCreate(&flag).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("feature flag %s set: enabled=%t percentage=%d", key, flag.Enabled, flag.Percentage)
+	s.invalidate()
+	return &flag, nil
+}
+
+// Delete removes a flag, turning it off for everyone
+func (s *Service) Delete(key string) error {
+	result := s.db.Where("key = ?", key).Delete(&domain.FeatureFlag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// cached returns the flags by key, read again once the cache expired. A
+// failed read keeps the last flags.
+func (s *Service) cached() map[string]domain.FeatureFlag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flags != nil && time.Since(s.loadedAt) < cacheTTL {
+		return s.flags
+	}
+	var rows []domain.FeatureFlag
+	if err := s.db.Find(&rows).Error; err != nil {
+		log.Printf("failed to read feature flags: %v", err)
+		if s.flags == nil {
+			s.flags = map[string]domain.FeatureFlag{}
+		}
+	} else {
+		flags := make(map[string]domain.FeatureFlag, len(rows))
+		for _, row := range rows {
+			flags[row.Key] = row
+		}
+		s.flags = flags
+	}
+	s.loadedAt = time.Now()
+	return s.flags
+}
+
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	s.flags = nil
+	s.mu.Unlock()
+}
+
+func (s *Service) customerGroups(userID uint64) []uint64 {
+	var ids []uint64
+	if err := s.db.Model(&domain.CustomerGroupMembership{}).
+		Where("customer_id = ?", userID).
+		Pluck("customer_group_id", &ids).Error; err != nil {
+		log.Printf("failed to read customer groups of user %d: %v", userID, err)
+	}
+	return ids
+}
+
+// evaluate reports whether a flag is on for a user in the given customer
+// groups
+func evaluate(flag *domain.FeatureFlag, user *domain.User, groups []uint64) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if flag.Percentage >= 100 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	if slices.Contains(flag.Targets.UserIDs, user.ID) || slices.Contains(flag.Targets.Roles, user.Role) {
+		return true
+	}
+	for _, group := range groups {
+		if slices.Contains(flag.Targets.CustomerGroupIDs, group) {
+			return true
+		}
+	}
+	return bucket(flag.Key, user.ID) < flag.Percentage
+}
+
+// bucket places a user in one of 100 buckets of a flag. Hashing the key
+// with the user spreads the users of different flags independently.
+func bucket(key string, userID uint64) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + strconv.FormatUint(userID, 10)))
+	return int(h.Sum32() % 100)
+}
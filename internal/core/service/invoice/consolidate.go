@@ -0,0 +1,303 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/tax"
+)
+
+var (
+	ErrMergeTooFew          = errors.New("select at least two invoices to merge")
+	ErrMergeMixed           = errors.New("merged invoices must belong to one customer and share a currency")
+	ErrMergeNotOpen         = errors.New("only unpaid and draft invoices without payments can be merged")
+	ErrInvalidConsolidation = errors.New("consolidation days must be between 0 and 90")
+	ErrCustomerNotFound     = errors.New("customer not found")
+)
+
+// maxConsolidateDays is the widest window renewals can be consolidated in
+const maxConsolidateDays = 90
+
+// openStatuses are the statuses of invoices that can still change
+var openStatuses = []domain.InvoiceStatus{
+	domain.InvoiceStatusDraft,
+	domain.InvoiceStatusUnpaid,
+	domain.InvoiceStatusOverdue,
+}
+
+// SetConsolidateDays sets the window within which the renewals of a
+// customer are billed on one invoice, 0 for one invoice per service
+func (s *Service) SetConsolidateDays(customerID uint64, days int) error {
+	if days < 0 || days > maxConsolidateDays {
+		return ErrInvalidConsolidation
+	}
+	result := s.db.Model(&domain.User{}).Where("id = ?", customerID).Update("consolidate_days", days)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCustomerNotFound
+	}
+	return nil
+}
+
+// consolidationTarget returns the open renewal invoice of a customer a
+// renewal due on dueDate is added to, or nil when it gets its own invoice
+func (s *Service) consolidationTarget(tx *gorm.DB, customerID uint64, currency string, dueDate time.Time) (*domain.Invoice, error) {
+	var customer domain.User
+	if err := tx.Select("id", "consolidate_days").First(&customer, customerID).Error; err != nil {
+		return nil, err
+	}
+	if customer.ConsolidateDays <= 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(customer.ConsolidateDays) * 24 * time.Hour
+	var target domain.Invoice
+	result := tx.Where("customer_id = ? AND currency = ? AND status IN ? AND amount_paid = 0", customerID, currency, openStatuses).
+		Where("due_date BETWEEN ? AND ?", dueDate.Add(-window), dueDate.Add(window)).
+		Where("id IN (?)", tx.Model(&domain.InvoiceItem{}).Select("invoice_id").Where("type = ?", "renewal")).
+		Order("due_date, id").Limit(1).Find(&target)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &target, nil
+}
+
+// consolidate adds the lines of a new renewal invoice to an open one and
+// recalculates it. The earlier due date of the two is kept.
+func consolidate(tx *gorm.DB, target, renewal *domain.Invoice) error {
+	for i := range renewal.LineItems {
+		item := renewal.LineItems[i]
+		item.ID = 0
+		item.InvoiceID = target.ID
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+	if renewal.DueDate.Before(target.DueDate) {
+		target.DueDate = renewal.DueDate
+	}
+	if err := recalculate(tx, target); err != nil {
+		return err
+	}
+	*renewal = *target
+	return nil
+}
+
+// MergeInvoices merges open invoices of one customer into a new invoice
+// due on the earliest due date, with the lines copied and the tax
+// recalculated on their sum. The merged invoices are cancelled. The new
+// invoice is a draft when all merged invoices were.
+func (s *Service) MergeInvoices(invoiceIDs []uint64, staffID uint64, now time.Time) (*domain.Invoice, error) {
+	ids := uniqueIDs(invoiceIDs)
+	if len(ids) < 2 {
+		return nil, ErrMergeTooFew
+	}
+
+	var merged *domain.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var sources []domain.Invoice
+		if err := tx.Preload("LineItems").Where("id IN ?", ids).Order("due_date, id").Find(&sources).Error; err != nil {
+			return err
+		}
+		if len(sources) != len(ids) {
+			return ErrInvoiceNotFound
+		}
+
+		first := sources[0]
+		invoice := &domain.Invoice{
+			CustomerID: first.CustomerID,
+			Status:     domain.InvoiceStatusDraft,
+			Currency:   first.Currency,
+			DueDate:    first.DueDate,
+		}
+		numbers := make([]string, 0, len(sources))
+		for _, source := range sources {
+			if source.CustomerID != first.CustomerID || source.Currency != first.Currency {
+				return ErrMergeMixed
+			}
+			if !isOpen(source.Status) || !source.AmountPaid.IsZero() {
+				return ErrMergeNotOpen
+			}
+			if !source.IsDraft() {
+				invoice.Status = domain.InvoiceStatusUnpaid
+			}
+			if source.PublishAt != nil && (invoice.PublishAt == nil || source.PublishAt.Before(*invoice.PublishAt)) {
+				invoice.PublishAt = source.PublishAt
+			}
+			for _, item := range source.LineItems {
+				item.ID = 0
+				item.InvoiceID = 0
+				invoice.LineItems = append(invoice.LineItems, item)
+			}
+			numbers = append(numbers, source.InvoiceNumber)
+		}
+		if !invoice.IsDraft() {
+			invoice.PublishAt = nil
+			invoice.PublishedAt = &now
+		}
+		invoice.Notes = fmt.Sprintf("Merged from %s", strings.Join(numbers, ", "))
+
+		if err := createInvoice(tx, invoice); err != nil {
+			return err
+		}
+		if err := recalculate(tx, invoice); err != nil {
+			return err
+		}
+
+		for _, source := range sources {
+			if err := tx.Model(&domain.Invoice{}).Where("id = ?", source.ID).Updates(map[string]interface{}{
+				"status":     domain.InvoiceStatusCancelled,
+				"publish_at": nil,
+				"notes":      strings.TrimSpace(source.Notes + "\nMerged into " + invoice.InvoiceNumber),
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&domain.InvoiceMerge{
+				MergedInvoiceID: invoice.ID,
+				SourceInvoiceID: source.ID,
+				MergedBy:        staffID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if !invoice.IsDraft() {
+			if err := notification.NewService(tx).InvoiceCreated(invoice); err != nil {
+				return err
+			}
+		}
+		merged = invoice
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// CancelServiceRenewals takes the renewal and addon lines billing a
+// service for periods starting on or after from off the unpaid and draft
+// invoices.
+// Invoices left without lines are cancelled and consolidated invoices
+// billing other services too are recalculated.
+func CancelServiceRenewals(tx *gorm.DB, serviceID uint64, from time.Time) error {
+	var invoices []domain.Invoice
+	if err := tx.Preload("LineItems").
+		Where("status IN ?", []domain.InvoiceStatus{domain.InvoiceStatusDraft, domain.InvoiceStatusUnpaid}).
+		Where("id IN (?)", tx.Model(&domain.InvoiceItem{}).Select("invoice_id").
+			Where("service_id = ? AND type IN ? AND period_start >= ?", serviceID, []string{"renewal", "addon"}, from)).
+		Find(&invoices).Error; err != nil {
+		return err
+	}
+
+	for i := range invoices {
+		invoice := &invoices[i]
+		var remove []uint64
+		for _, item := range invoice.LineItems {
+			if item.ServiceID != nil && *item.ServiceID == serviceID &&
+				(item.Type == "renewal" || item.Type == "addon") &&
+				item.PeriodStart != nil && !item.PeriodStart.Before(from) {
+				remove = append(remove, item.ID)
+			}
+		}
+		if len(remove) == len(invoice.LineItems) {
+			if err := tx.Model(invoice).Update("status", domain.InvoiceStatusCancelled).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Delete(&domain.InvoiceItem{}, remove).Error; err != nil {
+			return err
+		}
+		if err := recalculate(tx, invoice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recalculate sums the lines of an invoice and charges the tax on the
+// taxable ones again
+func recalculate(tx *gorm.DB, invoice *domain.Invoice) error {
+	var items []domain.InvoiceItem
+	if err := tx.Where("invoice_id = ?", invoice.ID).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+
+	subtotal := decimal.Zero
+	discount := decimal.Zero
+	taxable := decimal.Zero
+	for _, item := range items {
+		subtotal = subtotal.Add(item.UnitPrice.Mul(item.Quantity))
+		discount = discount.Add(item.Discount)
+		if item.Taxable {
+			taxable = taxable.Add(item.Total)
+		}
+	}
+
+	taxes, err := tax.NewCalculator(tx).BreakdownForCustomer(invoice.CustomerID, taxable)
+	if err != nil {
+		return err
+	}
+	if err := tx.Where("invoice_id = ?", invoice.ID).Delete(&domain.InvoiceTax{}).Error; err != nil {
+		return err
+	}
+	for i := range taxes {
+		taxes[i].ID = 0
+		taxes[i].InvoiceID = invoice.ID
+	}
+	if len(taxes) > 0 {
+		if err := tx.Create(&taxes).Error; err != nil {
+			return err
+		}
+	}
+
+	invoice.LineItems = items
+	invoice.Taxes = taxes
+	invoice.Subtotal = subtotal
+	invoice.Discount = discount
+	invoice.TaxAmount = tax.Total(taxes)
+	invoice.Total = subtotal.Sub(discount).Add(invoice.TaxAmount)
+	invoice.Balance = invoice.Total.Sub(invoice.AmountPaid)
+	return tx.Model(&domain.Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+		"subtotal":   invoice.Subtotal,
+		"discount":   invoice.Discount,
+		"tax_amount": invoice.TaxAmount,
+		"total":      invoice.Total,
+		"balance":    invoice.Balance,
+		"due_date":   invoice.DueDate,
+	}).Error
+}
+
+func isOpen(status domain.InvoiceStatus) bool {
+	for _, open := range openStatuses {
+		if status == open {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueIDs(ids []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(ids))
+	unique := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
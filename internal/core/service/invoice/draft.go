@@ -0,0 +1,188 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrInvoiceNotDraft    = errors.New("invoice is not a draft")
+	ErrInvalidReviewHours = errors.New("review hours must be between 0 and 720")
+)
+
+// maxReviewHours is the longest renewal invoices can be held for review
+const maxReviewHours = 720
+
+// ReviewHours returns how many hours generated renewal invoices are held
+// as drafts for review, 0 when they are published right away
+func (s *Service) ReviewHours() (int, error) {
+	var setting domain.Setting
+	result := s.db.Where("key = ?", domain.SettingInvoiceReviewHours).Limit(1).Find(&setting)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return 0, result.Error
+	}
+	hours, err := strconv.Atoi(setting.Value)
+	if err != nil || hours < 0 {
+		return 0, nil
+	}
+	return hours, nil
+}
+
+// SetReviewHours sets how many hours generated renewal invoices are held
+// as drafts for review. Drafts already held keep their publish time.
+func (s *Service) SetReviewHours(hours int) error {
+	if hours < 0 || hours > maxReviewHours {
+		return ErrInvalidReviewHours
+	}
+	setting := domain.Setting{Key: domain.SettingInvoiceReviewHours}
+	return s.db.Where("key = ?", domain.SettingInvoiceReviewHours).
+		Assign(domain.Setting{
+			Value: strconv.Itoa(hours),
+			Type:  "int",
+			Group: "billing",
+			Label: "Hold renewal invoices for review (hours)",
+		}).FirstOrCreate(&setting).Error
+}
+
+// holdForReview makes a new invoice a draft published after the review
+// window, if one is set
+func (s *Service) holdForReview(invoice *domain.Invoice, now time.Time) error {
+	hours, err := s.ReviewHours()
+	if err != nil || hours == 0 {
+		return err
+	}
+	publishAt := now.Add(time.Duration(hours) * time.Hour)
+	invoice.Status = domain.InvoiceStatusDraft
+	invoice.PublishAt = &publishAt
+	return nil
+}
+
+// ListDrafts returns the draft invoices, the first to be published first
+// and those held without a publish time last
+func (s *Service) ListDrafts() ([]domain.Invoice, error) {
+	var invoices []domain.Invoice
+	err := s.db.Preload("Customer").
+		Where("status = ?", domain.InvoiceStatusDraft).
+		Order("publish_at IS NULL, publish_at, id").
+		Find(&invoices).Error
+	return invoices, err
+}
+
+// SchedulePublish sets when a draft invoice is published. A nil time holds
+// it until it is published by hand.
+func (s *Service) SchedulePublish(invoiceID uint64, publishAt *time.Time) (*domain.Invoice, error) {
+	invoice, err := s.getDraft(s.db, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(invoice).Update("publish_at", publishAt).Error; err != nil {
+		return nil, err
+	}
+	invoice.PublishAt = publishAt
+	return invoice, nil
+}
+
+// Publish makes a draft invoice payable and emails it to the customer
+func (s *Service) Publish(invoiceID uint64, now time.Time) (*domain.Invoice, error) {
+	var invoice *domain.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		draft, err := s.getDraft(tx, invoiceID)
+		if err != nil {
+			return err
+		}
+		// The status condition keeps a draft from being published twice
+		result := tx.Model(&domain.Invoice{}).
+			Where("id = ? AND status = ?", draft.ID, domain.InvoiceStatusDraft).
+			Updates(map[string]interface{}{
+				"status":       domain.InvoiceStatusUnpaid,
+				"publish_at":   nil,
+				"published_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvoiceNotDraft
+		}
+		draft.Status = domain.InvoiceStatusUnpaid
+		draft.PublishAt = nil
+		draft.PublishedAt = &now
+		invoice = draft
+		return notification.NewService(tx).InvoiceCreated(invoice)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// PublishMany publishes draft invoices, skipping those that are no longer
+// drafts. It returns the invoices published.
+func (s *Service) PublishMany(invoiceIDs []uint64, now time.Time) ([]uint64, error) {
+	published := make([]uint64, 0, len(invoiceIDs))
+	for _, id := range invoiceIDs {
+		if _, err := s.Publish(id, now); err != nil {
+			if errors.Is(err, ErrInvoiceNotDraft) || errors.Is(err, ErrInvoiceNotFound) {
+				continue
+			}
+			return published, err
+		}
+		published = append(published, id)
+	}
+	return published, nil
+}
+
+// PublishDue publishes the draft invoices whose publish time has come
+func (s *Service) PublishDue(now time.Time) (int, error) {
+	var ids []uint64
+	if err := s.db.Model(&domain.Invoice{}).
+		Where("status = ? AND publish_at <= ?", domain.InvoiceStatusDraft, now).
+		Order("publish_at").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	published, err := s.PublishMany(ids, now)
+	return len(published), err
+}
+
+// MonitorDrafts publishes due draft invoices on the given interval until
+// ctx is cancelled
+func (s *Service) MonitorDrafts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PublishDue(time.Now()); err != nil {
+			log.Printf("failed to publish draft invoices: %v", err)
+		} else if n > 0 {
+			log.Printf("published %d draft invoice(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) getDraft(db *gorm.DB, invoiceID uint64) (*domain.Invoice, error) {
+	var invoice domain.Invoice
+	if err := db.First(&invoice, invoiceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	if !invoice.IsDraft() {
+		return nil, ErrInvoiceNotDraft
+	}
+	return &invoice, nil
+}
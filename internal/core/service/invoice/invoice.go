@@ -1,14 +1,22 @@
 package invoice
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/numbering"
+	"github.com/openhost/openhost/internal/core/service/pricing"
 	"github.com/openhost/openhost/internal/core/service/tax"
 )
 
@@ -17,6 +25,8 @@ var (
 	ErrInvoiceAlreadyPaid = errors.New("invoice is already paid")
 	ErrInvalidAmount      = errors.New("invalid payment amount")
 	ErrInvoiceCancelled   = errors.New("invoice is cancelled")
+	ErrServiceCancelling  = errors.New("service is scheduled for cancellation")
+	ErrInvoiceDraft       = errors.New("invoice is a draft")
 )
 
 // Service provides invoice management operations
@@ -29,17 +39,21 @@ func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
+// WithContext returns a copy of the service whose queries run with ctx,
+// such as the request context so slow queries are logged with its ID
+func (s *Service) WithContext(ctx context.Context) *Service {
+	clone := *s
+	clone.db = s.db.WithContext(ctx)
+	return &clone
+}
+
 // CreateInvoice creates a new invoice
 func (s *Service) CreateInvoice(customerID uint64, currency string, dueDate time.Time, items []InvoiceItemRequest) (*domain.Invoice, error) {
-	// Generate invoice number
-	invoiceNumber := s.generateInvoiceNumber()
-
 	invoice := &domain.Invoice{
-		CustomerID:    customerID,
-		InvoiceNumber: invoiceNumber,
-		Status:        domain.InvoiceStatusUnpaid,
-		Currency:      currency,
-		DueDate:       dueDate,
+		CustomerID: customerID,
+		Status:     domain.InvoiceStatusUnpaid,
+		Currency:   currency,
+		DueDate:    dueDate,
 	}
 
 	// Calculate totals
@@ -66,17 +80,24 @@ func (s *Service) CreateInvoice(customerID uint64, currency string, dueDate time
 		})
 	}
 
-	taxAmount, err := tax.NewCalculator(s.db).CalculateForCustomer(customerID, taxableSubtotal)
+	taxes, err := tax.NewCalculator(s.db).BreakdownForCustomer(customerID, taxableSubtotal)
 	if err != nil {
 		return nil, err
 	}
+	taxAmount := tax.Total(taxes)
 
 	invoice.Subtotal = subtotal
 	invoice.TaxAmount = taxAmount
+	invoice.Taxes = taxes
 	invoice.Total = subtotal.Add(taxAmount).Sub(invoice.Discount)
 	invoice.Balance = invoice.Total
 
-	if err := s.db.Create(invoice).Error; err != nil {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return createInvoice(tx, invoice)
+	}); err != nil {
+		return nil, err
+	}
+	if err := notification.NewService(s.db).InvoiceCreated(invoice); err != nil {
 		return nil, err
 	}
 
@@ -85,19 +106,28 @@ func (s *Service) CreateInvoice(customerID uint64, currency string, dueDate time
 
 // CreateInvoiceFromOrder creates an invoice from an order
 func (s *Service) CreateInvoiceFromOrder(order *domain.Order, dueDate time.Time) (*domain.Invoice, error) {
-	invoiceNumber := s.generateInvoiceNumber()
-
 	invoice := &domain.Invoice{
-		CustomerID:    order.CustomerID,
-		InvoiceNumber: invoiceNumber,
-		Status:        domain.InvoiceStatusUnpaid,
-		Currency:      order.Currency,
-		DueDate:       dueDate,
-		Subtotal:      order.Subtotal,
-		Discount:      order.Discount,
-		TaxAmount:     order.TaxAmount,
-		Total:         order.Total,
-		Balance:       order.Total,
+		CustomerID: order.CustomerID,
+		Status:     domain.InvoiceStatusUnpaid,
+		Currency:   order.Currency,
+		DueDate:    dueDate,
+		Subtotal:   order.Subtotal,
+		Discount:   order.Discount,
+		TaxAmount:  order.TaxAmount,
+		Total:      order.Total,
+		Balance:    order.Total,
+	}
+
+	// The order only kept its tax total; the lines are recorded when the
+	// rules still give the same tax
+	if order.TaxAmount.GreaterThan(decimal.Zero) {
+		taxes, err := tax.NewCalculator(s.db).BreakdownForCustomer(order.CustomerID, order.Subtotal.Sub(order.Discount))
+		if err != nil {
+			return nil, err
+		}
+		if tax.Total(taxes).Equal(order.TaxAmount) {
+			invoice.Taxes = taxes
+		}
 	}
 
 	// Create line items from order items
@@ -115,7 +145,17 @@ func (s *Service) CreateInvoiceFromOrder(order *domain.Order, dueDate time.Time)
 		invoice.LineItems = append(invoice.LineItems, invoiceItem)
 	}
 
-	if err := s.db.Create(invoice).Error; err != nil {
+	// Order fields such as the purchase order number are carried onto the
+	// invoice
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := createInvoice(tx, invoice); err != nil {
+			return err
+		}
+		return customfield.NewService(tx).CopyOrderValues(order.ID, invoice.ID)
+	}); err != nil {
+		return nil, err
+	}
+	if err := notification.NewService(s.db).InvoiceCreated(invoice); err != nil {
 		return nil, err
 	}
 
@@ -127,29 +167,56 @@ func (s *Service) CreateInvoiceFromOrder(order *domain.Order, dueDate time.Time)
 
 // CreateServiceRenewalInvoice creates a renewal invoice for a service
 func (s *Service) CreateServiceRenewalInvoice(service *domain.Service, dueDate time.Time) (*domain.Invoice, error) {
-	invoiceNumber := s.generateInvoiceNumber()
-
 	// Calculate period
 	periodStart := service.NextDueDate
 	periodEnd := s.addBillingPeriod(periodStart, service.BillingCycle)
 
+	// Services cancelled at the end of their cycle are not renewed
+	var cancelling int64
+	if err := s.db.Model(&domain.CancellationRequest{}).
+		Where("service_id = ? AND status = ? AND scheduled_for <= ?", service.ID, domain.CancellationStatusApproved, periodStart).
+		Count(&cancelling).Error; err != nil {
+		return nil, err
+	}
+	if cancelling > 0 {
+		return nil, ErrServiceCancelling
+	}
+
+	// Price revisions that migrate existing services apply from the first
+	// period starting on or after their effective date
+	amount, revisedAt, err := pricing.NewService(s.db).RenewalAmount(service, periodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retention offers accepted instead of cancelling discount the renewal
+	coupon, err := s.retentionCoupon(service.ID)
+	if err != nil {
+		return nil, err
+	}
+	discount := decimal.Zero
+	if coupon != nil {
+		discount = coupon.RecurringDiscount(amount)
+	}
+
 	invoice := &domain.Invoice{
-		CustomerID:    service.CustomerID,
-		InvoiceNumber: invoiceNumber,
-		Status:        domain.InvoiceStatusUnpaid,
-		Currency:      service.Currency,
-		DueDate:       dueDate,
-		Subtotal:      service.RecurringAmount,
-		Total:         service.RecurringAmount,
-		Balance:       service.RecurringAmount,
+		CustomerID: service.CustomerID,
+		Status:     domain.InvoiceStatusUnpaid,
+		Currency:   service.Currency,
+		DueDate:    dueDate,
+		Subtotal:   amount,
+		Discount:   discount,
+		Total:      amount,
+		Balance:    amount,
 		LineItems: []domain.InvoiceItem{
 			{
 				ServiceID:   &service.ID,
 				Type:        "renewal",
 				Description: fmt.Sprintf("%s - %s to %s", service.Product.Name, periodStart.Format("Jan 2, 2006"), periodEnd.Format("Jan 2, 2006")),
 				Quantity:    decimal.NewFromInt(1),
-				UnitPrice:   service.RecurringAmount,
-				Total:       service.RecurringAmount,
+				UnitPrice:   amount,
+				Discount:    discount,
+				Total:       amount.Sub(discount),
 				Taxable:     true,
 				PeriodStart: &periodStart,
 				PeriodEnd:   &periodEnd,
@@ -157,21 +224,127 @@ func (s *Service) CreateServiceRenewalInvoice(service *domain.Service, dueDate t
 		},
 	}
 
-	taxAmount, err := tax.NewCalculator(s.db).CalculateForCustomer(service.CustomerID, service.RecurringAmount)
+	// Recurring addons renew with their parent service, including while it
+	// is suspended
+	var addons []domain.ServiceAddon
+	if err := s.db.Preload("Addon").
+		Where("service_id = ? AND status IN ? AND billing_cycle <> ? AND next_due_date <= ?", service.ID,
+			[]domain.ServiceStatus{domain.ServiceStatusActive, domain.ServiceStatusSuspended}, domain.AddonTypeOneTime, periodStart).
+		Order("id").Find(&addons).Error; err != nil {
+		return nil, err
+	}
+	for _, addon := range addons {
+		quantity := decimal.NewFromInt(int64(addon.Quantity))
+		total := addon.RecurringAmount.Mul(quantity)
+		invoice.LineItems = append(invoice.LineItems, domain.InvoiceItem{
+			ServiceID:   &service.ID,
+			Type:        "addon",
+			Description: fmt.Sprintf("%s - %s - %s to %s", service.Product.Name, addon.Addon.Name, periodStart.Format("Jan 2, 2006"), periodEnd.Format("Jan 2, 2006")),
+			Quantity:    quantity,
+			UnitPrice:   addon.RecurringAmount,
+			Total:       total,
+			Taxable:     true,
+			PeriodStart: &periodStart,
+			PeriodEnd:   &periodEnd,
+		})
+		invoice.Subtotal = invoice.Subtotal.Add(total)
+	}
+
+	taxes, err := tax.NewCalculator(s.db).BreakdownForCustomer(service.CustomerID, invoice.Subtotal.Sub(discount))
 	if err != nil {
 		return nil, err
 	}
+	taxAmount := tax.Total(taxes)
 	invoice.TaxAmount = taxAmount
-	invoice.Total = invoice.Subtotal.Add(taxAmount)
+	invoice.Taxes = taxes
+	invoice.Total = invoice.Subtotal.Sub(discount).Add(taxAmount)
 	invoice.Balance = invoice.Total
 
-	if err := s.db.Create(invoice).Error; err != nil {
+	// Renewals may be held as drafts for review before they are emailed
+	if err := s.holdForReview(invoice, time.Now()); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Customers consolidating renewals get them added to an open
+		// renewal invoice due around the same time
+		target, err := s.consolidationTarget(tx, service.CustomerID, service.Currency, dueDate)
+		if err != nil {
+			return err
+		}
+		if target != nil {
+			if err := consolidate(tx, target, invoice); err != nil {
+				return err
+			}
+		} else {
+			if err := createInvoice(tx, invoice); err != nil {
+				return err
+			}
+			if !invoice.IsDraft() {
+				if err := notification.NewService(tx).InvoiceCreated(invoice); err != nil {
+					return err
+				}
+			}
+		}
+		if coupon != nil {
+			if err := tx.Create(&domain.CouponUsage{
+				CouponID:   coupon.ID,
+				CustomerID: service.CustomerID,
+				InvoiceID:  invoice.ID,
+				ServiceID:  &service.ID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if revisedAt == nil {
+			return nil
+		}
+		if err := tx.Model(service).Updates(map[string]interface{}{
+			"recurring_amount": amount,
+			"price_updated_at": revisedAt,
+		}).Error; err != nil {
+			return err
+		}
+		service.RecurringAmount = amount
+		service.PriceUpdatedAt = revisedAt
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return invoice, nil
 }
 
+// retentionCoupon returns the coupon of the retention offer accepted for a
+// service while it has renewal cycles left
+func (s *Service) retentionCoupon(serviceID uint64) (*domain.Coupon, error) {
+	var request domain.CancellationRequest
+	result := s.db.Preload("RetentionOffer.Coupon").
+		Where("service_id = ? AND status = ? AND retention_offer_id IS NOT NULL", serviceID, domain.CancellationStatusRetained).
+		Order("id DESC").Limit(1).Find(&request)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || request.RetentionOffer == nil {
+		return nil, nil
+	}
+
+	coupon := request.RetentionOffer.Coupon
+	if coupon.BillingCycles > 0 {
+		var used int64
+		if err := s.db.Model(&domain.CouponUsage{}).
+			Where("coupon_id = ? AND service_id = ? AND created_at >= ?", coupon.ID, serviceID, request.CreatedAt).
+			Count(&used).Error; err != nil {
+			return nil, err
+		}
+		if used >= int64(coupon.BillingCycles) {
+			return nil, nil
+		}
+	}
+	return &coupon, nil
+}
+
 // GetInvoice retrieves an invoice by ID
 func (s *Service) GetInvoice(id uint64) (*domain.Invoice, error) {
 	var invoice domain.Invoice
@@ -197,18 +370,33 @@ func (s *Service) GetInvoiceByNumber(invoiceNumber string) (*domain.Invoice, err
 	return &invoice, nil
 }
 
-// ListInvoices returns invoices for a customer
+// ListInvoices returns invoices for a customer. Customers do not see draft
+// invoices.
 func (s *Service) ListInvoices(customerID uint64, status domain.InvoiceStatus, limit, offset int) ([]domain.Invoice, int64, error) {
+	query := s.db.Model(&domain.Invoice{}).
+		Where("customer_id = ? AND status <> ?", customerID, domain.InvoiceStatusDraft)
+	return listInvoices(query, status, limit, offset)
+}
+
+// ListAllInvoices returns the invoices of all customers, drafts included
+// (admin only)
+func (s *Service) ListAllInvoices(status domain.InvoiceStatus, limit, offset int) ([]domain.Invoice, int64, error) {
+	return listInvoices(s.db.Model(&domain.Invoice{}), status, limit, offset)
+}
+
+func listInvoices(query *gorm.DB, status domain.InvoiceStatus, limit, offset int) ([]domain.Invoice, int64, error) {
 	var invoices []domain.Invoice
 	var total int64
 
-	query := s.db.Model(&domain.Invoice{}).Where("customer_id = ?", customerID)
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
-	query.Count(&total)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 
-	if err := query.Preload("LineItems").Order("created_at DESC").
+	// Line items are only needed by the detail view, see GetInvoice
+	if err := query.Select(invoiceListColumns).Order("created_at DESC").
 		Limit(limit).Offset(offset).Find(&invoices).Error; err != nil {
 		return nil, 0, err
 	}
@@ -216,6 +404,12 @@ func (s *Service) ListInvoices(customerID uint64, status domain.InvoiceStatus, l
 	return invoices, total, nil
 }
 
+// invoiceListColumns are the invoice columns needed to render a listing
+var invoiceListColumns = []string{
+	"id", "customer_id", "invoice_number", "status", "currency", "total",
+	"balance", "due_date", "paid_at", "publish_at", "created_at", "updated_at",
+}
+
 // GetUnpaidInvoices returns all unpaid invoices for a customer
 func (s *Service) GetUnpaidInvoices(customerID uint64) ([]domain.Invoice, error) {
 	var invoices []domain.Invoice
@@ -240,6 +434,9 @@ func (s *Service) AddPayment(invoiceID uint64, amount decimal.Decimal, gateway,
 	if invoice.Status == domain.InvoiceStatusCancelled {
 		return nil, ErrInvoiceCancelled
 	}
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceDraft
+	}
 	if amount.LessThanOrEqual(decimal.Zero) {
 		return nil, ErrInvalidAmount
 	}
@@ -257,6 +454,16 @@ func (s *Service) AddPayment(invoiceID uint64, amount decimal.Decimal, gateway,
 		Description:    fmt.Sprintf("Payment for invoice %s", invoice.InvoiceNumber),
 	}
 
+	// Gateways that report no fee are charged the configured one
+	var module domain.PaymentGatewayModule
+	if err := s.db.Where("slug = ?", gateway).Limit(1).Find(&module).Error; err != nil {
+		return nil, err
+	}
+	if module.ID != 0 {
+		transaction.Fee = module.CalculateFee(amount)
+		transaction.FeeCalculated = !transaction.Fee.IsZero()
+	}
+
 	if err := s.db.Create(transaction).Error; err != nil {
 		return nil, err
 	}
@@ -281,6 +488,11 @@ func (s *Service) AddPayment(invoiceID uint64, amount decimal.Decimal, gateway,
 		return nil, err
 	}
 
+	// The payment stands even when its webhooks cannot be queued
+	if err := notification.NewService(s.db).PaymentReceived(transaction); err != nil {
+		log.Printf("failed to notify payment %d: %v", transaction.ID, err)
+	}
+
 	return transaction, nil
 }
 
@@ -333,6 +545,10 @@ func (s *Service) RefundInvoice(invoiceID uint64, amount decimal.Decimal, reason
 		s.db.Model(&invoice).Update("status", domain.InvoiceStatusRefunded)
 	}
 
+	if err := notification.NewService(s.db).PaymentRefunded(transaction, reason); err != nil {
+		log.Printf("failed to notify refund %d: %v", transaction.ID, err)
+	}
+
 	return transaction, nil
 }
 
@@ -343,9 +559,48 @@ func (s *Service) MarkOverdueInvoices() error {
 		Update("status", domain.InvoiceStatusOverdue).Error
 }
 
-// generateInvoiceNumber generates a unique invoice number
-func (s *Service) generateInvoiceNumber() string {
-	return fmt.Sprintf("INV-%d-%d", time.Now().Year(), time.Now().UnixNano()%100000)
+// createInvoice numbers an invoice and creates it. The number is taken in
+// the same transaction, so a failed invoice does not leave a gap. Customers
+// with payment terms from their group get at least that many days to pay.
+func createInvoice(tx *gorm.DB, invoice *domain.Invoice) error {
+	now := time.Now()
+	days, ok, err := customergroup.PaymentTerms(tx, invoice.CustomerID)
+	if err != nil {
+		return err
+	}
+	if termsDue := now.AddDate(0, 0, days); ok && invoice.DueDate.Before(termsDue) {
+		invoice.DueDate = termsDue
+	}
+
+	// Invoices of reverse charged customers carry the VAT number and its
+	// check with the mandatory note, unless VAT was charged after all
+	if invoice.TaxAmount.IsZero() {
+		validation, err := tax.ReverseCharge(tx, invoice.CustomerID)
+		if err != nil {
+			return err
+		}
+		if validation != nil {
+			stampReverseCharge(invoice, validation)
+		}
+	}
+
+	number, err := numbering.NewService(tx).Next(domain.NumberKindInvoice, now)
+	if err != nil {
+		return err
+	}
+	invoice.InvoiceNumber = number
+	return tx.Create(invoice).Error
+}
+
+func stampReverseCharge(invoice *domain.Invoice, validation *domain.VATValidation) {
+	checkedAt := validation.CheckedAt
+	invoice.ReverseCharge = true
+	invoice.VATNumber = validation.VATNumber
+	invoice.VATCheckedAt = &checkedAt
+	invoice.VATConsultation = validation.ConsultationNumber
+	if !strings.Contains(invoice.Notes, domain.ReverseChargeNote) {
+		invoice.Notes = strings.TrimSpace(invoice.Notes + "\n\n" + domain.ReverseChargeNote)
+	}
 }
 
 // addBillingPeriod adds a billing period to a date
@@ -1,7 +1,12 @@
 package knowledgebase
 
 import (
+	"context"
 	"errors"
+	"html"
+	"io"
+	"log"
+	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -9,16 +14,27 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/markup"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
 )
 
 var (
-	ErrArticleNotFound  = errors.New("article not found")
-	ErrCategoryNotFound = errors.New("category not found")
+	ErrArticleNotFound    = errors.New("article not found")
+	ErrCategoryNotFound   = errors.New("category not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrNoFileStore        = errors.New("file storage is not configured")
 )
 
+// articleMarkup renders article content. Articles are written by admins
+// only, so their HTML is trusted and code blocks are highlighted.
+var articleMarkup = markup.Options{Trusted: true, Highlight: true}
+
 // Service provides knowledge base operations
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	files      domain.FileStore
+	quarantine *quarantine.Service
 }
 
 // NewService creates a new knowledge base service
@@ -26,6 +42,16 @@ func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
+// SetFileStore sets the store attachments are uploaded to
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetQuarantine scans new attachments for malware before they are stored
+func (s *Service) SetQuarantine(q *quarantine.Service) {
+	s.quarantine = q
+}
+
 // --- Categories ---
 
 // CreateCategory creates a new knowledge base category
@@ -113,6 +139,11 @@ func (s *Service) DeleteCategory(id uint64) error {
 func (s *Service) CreateArticle(categoryID, authorID uint64, title, content, excerpt string, featured bool, tags []string) (*domain.KnowledgeBaseArticle, error) {
 	slug := s.generateSlug(title)
 
+	contentHTML, err := markup.Render(content, articleMarkup)
+	if err != nil {
+		return nil, err
+	}
+
 	tagsMap := make(domain.JSONMap)
 	tagsMap["tags"] = tags
 
@@ -121,6 +152,7 @@ func (s *Service) CreateArticle(categoryID, authorID uint64, title, content, exc
 		Title:         title,
 		Slug:          slug,
 		Content:       content,
+		ContentHTML:   contentHTML,
 		Excerpt:       excerpt,
 		AuthorID:      authorID,
 		Status:        "draft",
@@ -146,6 +178,7 @@ func (s *Service) GetArticle(id uint64) (*domain.KnowledgeBaseArticle, error) {
 		}
 		return nil, err
 	}
+	renderLegacy(&article)
 	return &article, nil
 }
 
@@ -159,9 +192,21 @@ func (s *Service) GetArticleBySlug(slug string) (*domain.KnowledgeBaseArticle, e
 		}
 		return nil, err
 	}
+	renderLegacy(&article)
 	return &article, nil
 }
 
+// renderLegacy renders the content of articles saved before content was
+// rendered on write
+func renderLegacy(article *domain.KnowledgeBaseArticle) {
+	if article.ContentHTML != "" || article.Content == "" {
+		return
+	}
+	if html, err := markup.Render(article.Content, articleMarkup); err == nil {
+		article.ContentHTML = html
+	}
+}
+
 // ListArticles lists articles with optional filters
 func (s *Service) ListArticles(categoryID *uint64, status string, featured bool, limit, offset int) ([]domain.KnowledgeBaseArticle, int64, error) {
 	var articles []domain.KnowledgeBaseArticle
@@ -190,6 +235,11 @@ func (s *Service) ListArticles(categoryID *uint64, status string, featured bool,
 
 // UpdateArticle updates an article
 func (s *Service) UpdateArticle(id uint64, title, content, excerpt, metaTitle, metaDescription string, featured bool, tags []string) error {
+	contentHTML, err := markup.Render(content, articleMarkup)
+	if err != nil {
+		return err
+	}
+
 	tagsMap := make(domain.JSONMap)
 	tagsMap["tags"] = tags
 
@@ -197,6 +247,7 @@ func (s *Service) UpdateArticle(id uint64, title, content, excerpt, metaTitle, m
 		Updates(map[string]interface{}{
 			"title":            title,
 			"content":          content,
+			"content_html":     contentHTML,
 			"excerpt":          excerpt,
 			"featured":         featured,
 			"meta_title":       metaTitle,
@@ -205,14 +256,32 @@ func (s *Service) UpdateArticle(id uint64, title, content, excerpt, metaTitle, m
 		}).Error
 }
 
-// PublishArticle publishes an article
+// PublishArticle publishes an article. Customers are emailed about an
+// article the first time it is published, at once or in their digest.
 func (s *Service) PublishArticle(id uint64) error {
+	article, err := s.GetArticle(id)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
-	return s.db.Model(&domain.KnowledgeBaseArticle{}).Where("id = ?", id).
+	if err := s.db.Model(&domain.KnowledgeBaseArticle{}).Where("id = ?", id).
 		Updates(map[string]interface{}{
 			"status":       "published",
 			"published_at": &now,
-		}).Error
+		}).Error; err != nil {
+		return err
+	}
+
+	if article.PublishedAt == nil {
+		bodyHTML := "<p>" + html.EscapeString(article.Excerpt) + "</p>"
+		bodyPlain := article.Excerpt + "\n\n/kb/articles/" + article.Slug
+		if _, err := notification.NewService(s.db).EmailCustomers(domain.EmailCategoryKnowledgeBase,
+			"New article: "+article.Title, bodyHTML, bodyPlain); err != nil && !errors.Is(err, notification.ErrSMTPNotConfigured) {
+			log.Printf("failed to email customers about article %d: %v", id, err)
+		}
+	}
+	return nil
 }
 
 // UnpublishArticle unpublishes an article
@@ -223,8 +292,12 @@ func (s *Service) UnpublishArticle(id uint64) error {
 
 // DeleteArticle deletes an article
 func (s *Service) DeleteArticle(id uint64) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	var attachments []domain.KBArticleAttachment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// Delete attachments
+		if err := tx.Where("article_id = ?", id).Find(&attachments).Error; err != nil {
+			return err
+		}
 		if err := tx.Delete(&domain.KBArticleAttachment{}, "article_id = ?", id).Error; err != nil {
 			return err
 		}
@@ -235,12 +308,21 @@ func (s *Service) DeleteArticle(id uint64) error {
 		// Delete article
 		return tx.Delete(&domain.KnowledgeBaseArticle{}, id).Error
 	})
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		s.removeAttachmentFile(&attachments[i])
+	}
+	return nil
 }
 
-// IncrementViewCount increments the view count for an article
-func (s *Service) IncrementViewCount(id uint64) error {
-	return s.db.Model(&domain.KnowledgeBaseArticle{}).Where("id = ?", id).
-		Update("view_count", gorm.Expr("view_count + 1")).Error
+// IncrementViewCount increments the view count of the published article
+// with a slug. The update time is kept, as a view does not change the
+// article.
+func (s *Service) IncrementViewCount(slug string) error {
+	return s.db.Model(&domain.KnowledgeBaseArticle{}).Where("slug = ? AND status = ?", slug, "published").
+		UpdateColumn("view_count", gorm.Expr("view_count + 1")).Error
 }
 
 // RecordFeedback records feedback on an article
@@ -316,26 +398,114 @@ func (s *Service) GetRelatedArticles(articleID uint64, limit int) ([]domain.Know
 	return articles, nil
 }
 
-// AddAttachment adds an attachment to an article
-func (s *Service) AddAttachment(articleID uint64, fileName, filePath, contentType string, fileSize int64) (*domain.KBArticleAttachment, error) {
+// AddAttachment scans an attachment of an article and uploads it to the
+// file store. size is -1 when unknown.
+func (s *Service) AddAttachment(ctx context.Context, articleID uint64, fileName, contentType string, r io.Reader, size int64) (*domain.KBArticleAttachment, error) {
+	if s.files == nil {
+		return nil, ErrNoFileStore
+	}
+	if err := s.db.Select("id").First(&domain.KnowledgeBaseArticle{}, articleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArticleNotFound
+		}
+		return nil, err
+	}
+
+	checked, err := s.quarantine.Check(ctx, quarantine.Upload{
+		Source:      domain.UploadSourceKB,
+		SourceID:    articleID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Reader:      r,
+		Size:        size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer checked.Close()
+
+	key, err := domain.NewFileKey("kb", articleID)
+	if err != nil {
+		return nil, err
+	}
+	counter := &domain.CountingReader{R: checked}
+	size = checked.Size
+	if err := s.files.Put(ctx, key, counter, size, contentType); err != nil {
+		return nil, err
+	}
+
 	attachment := &domain.KBArticleAttachment{
 		ArticleID:   articleID,
 		FileName:    fileName,
-		FilePath:    filePath,
-		FileSize:    fileSize,
+		StorageKey:  key,
+		FileSize:    counter.N,
 		ContentType: contentType,
 	}
-
 	if err := s.db.Create(attachment).Error; err != nil {
+		s.removeAttachmentFile(attachment)
 		return nil, err
 	}
 
 	return attachment, nil
 }
 
-// DeleteAttachment deletes an attachment
+// GetAttachment retrieves an attachment with its article
+func (s *Service) GetAttachment(attachmentID uint64) (*domain.KBArticleAttachment, error) {
+	var attachment domain.KBArticleAttachment
+	if err := s.db.Preload("Article").First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// AttachmentURL returns a signed download URL of an attachment kept in
+// the file store, or "" for files added by path before the file store
+func (s *Service) AttachmentURL(attachment *domain.KBArticleAttachment, expires time.Duration) (string, error) {
+	if attachment.StorageKey == "" || s.files == nil {
+		return "", nil
+	}
+	return s.files.SignedURL(attachment.StorageKey, attachment.FileName, expires)
+}
+
+// OpenAttachment returns the content of an attachment
+func (s *Service) OpenAttachment(ctx context.Context, attachment *domain.KBArticleAttachment) (io.ReadCloser, error) {
+	if attachment.StorageKey == "" {
+		return os.Open(attachment.FilePath)
+	}
+	if s.files == nil {
+		return nil, ErrNoFileStore
+	}
+	return s.files.Get(ctx, attachment.StorageKey)
+}
+
+// DeleteAttachment deletes an attachment and its file
 func (s *Service) DeleteAttachment(attachmentID uint64) error {
-	return s.db.Delete(&domain.KBArticleAttachment{}, attachmentID).Error
+	var attachment domain.KBArticleAttachment
+	if err := s.db.First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAttachmentNotFound
+		}
+		return err
+	}
+	if err := s.db.Delete(&attachment).Error; err != nil {
+		return err
+	}
+	s.removeAttachmentFile(&attachment)
+	return nil
+}
+
+// removeAttachmentFile deletes the stored file of an attachment. Files
+// added by path before the file store are left alone.
+func (s *Service) removeAttachmentFile(attachment *domain.KBArticleAttachment) {
+	if attachment.StorageKey == "" || s.files == nil {
+		return
+	}
+	if err := s.files.Delete(context.Background(), attachment.StorageKey); err != nil {
+		log.Printf("knowledgebase: failed to delete attachment %s: %v", attachment.StorageKey, err)
+	}
 }
 
 // IncrementAttachmentDownload increments the download count for an attachment
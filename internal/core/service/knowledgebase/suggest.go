@@ -0,0 +1,274 @@
+package knowledgebase
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ErrSuggestionNotFound = errors.New("suggestion not found")
+
+const (
+	// maxSuggestTerms limits the keywords taken from a draft ticket
+	maxSuggestTerms = 12
+	// suggestCandidates limits the articles scored for a draft
+	suggestCandidates = 200
+)
+
+// Weights of a keyword found in the parts of an article
+const (
+	titleWeight   = 5
+	excerptWeight = 2
+	contentWeight = 1
+)
+
+// stopWords are left out of the keywords of a draft ticket
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"have": true, "has": true, "had": true, "not": true, "are": true, "was": true,
+	"were": true, "but": true, "can": true, "cannot": true, "can't": true, "you": true,
+	"your": true, "from": true, "when": true, "what": true, "how": true, "why": true,
+	"does": true, "doesn't": true, "don't": true, "did": true, "didn't": true,
+	"there": true, "their": true, "they": true, "them": true, "then": true, "than": true,
+	"into": true, "about": true, "after": true, "before": true, "again": true,
+	"any": true, "all": true, "some": true, "get": true, "got": true, "just": true,
+	"please": true, "help": true, "thanks": true, "thank": true, "hello": true,
+	"would": true, "could": true, "should": true, "will": true, "been": true,
+	"being": true, "also": true, "still": true, "now": true, "our": true, "out": true,
+	"its": true, "it's": true, "i'm": true, "i've": true, "problem": true, "issue": true,
+}
+
+// Suggestion is the result of SuggestArticles
+type Suggestion struct {
+	ID       uint64
+	Articles []domain.KnowledgeBaseArticle
+}
+
+// SuggestArticles returns the published articles that best match a draft
+// ticket, so customers may find an answer before sending it. Every call
+// is recorded for the deflection report.
+func (s *Service) SuggestArticles(subject, body string, customerID *uint64, ipAddress string, limit int) (*Suggestion, error) {
+	if limit <= 0 || limit > 10 {
+		limit = 5
+	}
+
+	articles, err := s.matchArticles(keywords(subject+"\n"+body), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(articles))
+	for i, article := range articles {
+		ids[i] = strconv.FormatUint(article.ID, 10)
+	}
+	if len(subject) > 255 {
+		subject = subject[:255]
+		for !utf8.ValidString(subject) {
+			subject = subject[:len(subject)-1]
+		}
+	}
+	record := &domain.KBSuggestion{
+		CustomerID:  customerID,
+		Subject:     subject,
+		ArticleIDs:  strings.Join(ids, ","),
+		ResultCount: len(articles),
+		IPAddress:   ipAddress,
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	return &Suggestion{ID: record.ID, Articles: articles}, nil
+}
+
+// matchArticles scores the published articles containing any keyword by
+// where the keywords occur
+func (s *Service) matchArticles(terms []string, limit int) ([]domain.KnowledgeBaseArticle, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	query := s.db.Where("status = ?", "published")
+	conditions := s.db
+	for i, term := range terms {
+		pattern := "%" + term + "%"
+		condition := "LOWER(title) LIKE ? OR LOWER(excerpt) LIKE ? OR LOWER(content) LIKE ?"
+		if i == 0 {
+			conditions = conditions.Where(condition, pattern, pattern, pattern)
+		} else {
+			conditions = conditions.Or(condition, pattern, pattern, pattern)
+		}
+	}
+
+	var candidates []domain.KnowledgeBaseArticle
+	if err := query.Where(conditions).
+		Preload("Category").
+		Order("view_count DESC").
+		Limit(suggestCandidates).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	scores := make(map[uint64]int, len(candidates))
+	for _, article := range candidates {
+		title := strings.ToLower(article.Title)
+		excerpt := strings.ToLower(article.Excerpt)
+		content := strings.ToLower(article.Content)
+		for _, term := range terms {
+			if strings.Contains(title, term) {
+				scores[article.ID] += titleWeight
+			}
+			if strings.Contains(excerpt, term) {
+				scores[article.ID] += excerptWeight
+			}
+			if strings.Contains(content, term) {
+				scores[article.ID] += contentWeight
+			}
+		}
+	}
+
+	// Candidates come ordered by views, which breaks ties
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].ID] > scores[candidates[j].ID]
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// keywords returns the distinct lower cased words of a draft worth
+// searching for, in order of appearance. Runs of CJK characters, which
+// are written without spaces, are kept as one keyword.
+func keywords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '-' && r != '.'
+	})
+
+	seen := make(map[string]bool)
+	var terms []string
+	for _, field := range fields {
+		field = strings.Trim(field, "'-.")
+		minLength := 3
+		if isCJK(field) {
+			minLength = 2
+		}
+		if utf8.RuneCountInString(field) < minLength || stopWords[field] || seen[field] {
+			continue
+		}
+		seen[field] = true
+		terms = append(terms, field)
+		if len(terms) == maxSuggestTerms {
+			break
+		}
+	}
+	return terms
+}
+
+func isCJK(word string) bool {
+	for _, r := range word {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordSuggestionOutcome records that the customer opened one of the
+// suggested articles and whether it resolved their problem, so no ticket
+// was sent
+func (s *Service) RecordSuggestionOutcome(id uint64, customerID *uint64, articleID *uint64, resolved bool) error {
+	var suggestion domain.KBSuggestion
+	if err := s.db.First(&suggestion, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSuggestionNotFound
+		}
+		return err
+	}
+	// Suggestions of a customer are theirs only; anonymous ones may be
+	// updated by whoever holds the ID
+	if suggestion.CustomerID != nil && (customerID == nil || *suggestion.CustomerID != *customerID) {
+		return ErrSuggestionNotFound
+	}
+
+	updates := map[string]interface{}{"deflected": resolved}
+	if articleID != nil {
+		if !containsID(suggestion.ArticleIDs, *articleID) {
+			return ErrArticleNotFound
+		}
+		updates["viewed_article_id"] = *articleID
+	}
+	return s.db.Model(&suggestion).Updates(updates).Error
+}
+
+func containsID(list string, id uint64) bool {
+	want := strconv.FormatUint(id, 10)
+	for _, item := range strings.Split(list, ",") {
+		if item == want {
+			return true
+		}
+	}
+	return false
+}
+
+// DeflectionStats summarizes the article suggestions of a period
+type DeflectionStats struct {
+	Suggestions    int64               `json:"suggestions"`
+	WithResults    int64               `json:"with_results"`
+	ArticlesViewed int64               `json:"articles_viewed"`
+	Deflected      int64               `json:"deflected"`
+	DeflectionRate float64             `json:"deflection_rate"` // Deflected of those with results
+	TopArticles    []DeflectingArticle `json:"top_articles"`
+}
+
+// DeflectingArticle is an article customers opened from suggestions
+type DeflectingArticle struct {
+	ArticleID uint64 `json:"article_id"`
+	Title     string `json:"title"`
+	Views     int64  `json:"views"`
+	Deflected int64  `json:"deflected"`
+}
+
+// GetDeflectionStats returns the suggestion metrics since the given time
+func (s *Service) GetDeflectionStats(since time.Time, limit int) (*DeflectionStats, error) {
+	stats := &DeflectionStats{}
+	base := func() *gorm.DB {
+		return s.db.Model(&domain.KBSuggestion{}).Where("created_at >= ?", since)
+	}
+	if err := base().Count(&stats.Suggestions).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("result_count > 0").Count(&stats.WithResults).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("viewed_article_id IS NOT NULL").Count(&stats.ArticlesViewed).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("deflected = ?", true).Count(&stats.Deflected).Error; err != nil {
+		return nil, err
+	}
+	if stats.WithResults > 0 {
+		stats.DeflectionRate = float64(stats.Deflected) / float64(stats.WithResults)
+	}
+
+	if err := s.db.Table("kb_suggestions").
+		Select(`kb_suggestions.viewed_article_id AS article_id, knowledge_base_articles.title,
+			COUNT(*) AS views, SUM(CASE WHEN kb_suggestions.deflected THEN 1 ELSE 0 END) AS deflected`).
+		Joins("JOIN knowledge_base_articles ON knowledge_base_articles.id = kb_suggestions.viewed_article_id").
+		Where("kb_suggestions.created_at >= ?", since).
+		Group("kb_suggestions.viewed_article_id, knowledge_base_articles.title").
+		Order("deflected DESC, views DESC").
+		Limit(limit).
+		Scan(&stats.TopArticles).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,426 @@
+// Package license validates the license key of an installation with the
+// update server and decides its edition. Enterprise modules such as the
+// reseller module and SSO are only served to the enterprise edition. The
+// last answer is kept, so an installation that cannot reach the server
+// keeps its edition for a grace period. The server also lists the newer
+// releases and their changelogs for the admin panel.
+package license
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Editions of OpenHost
+const (
+	EditionCommunity  = "community"
+	EditionEnterprise = "enterprise"
+)
+
+// Modules only served to the enterprise edition
+const (
+	FeatureReseller = "reseller"
+	FeatureSSO      = "sso"
+)
+
+// editionFeatures are the modules each edition is served
+var editionFeatures = map[string][]string{
+	EditionCommunity:  {},
+	EditionEnterprise: {FeatureReseller, FeatureSSO},
+}
+
+var (
+	ErrNoServer          = errors.New("no update server is configured")
+	ErrServerUnavailable = errors.New("the update server could not be reached")
+	ErrKeyRequired       = errors.New("license key is required")
+)
+
+// DefaultGracePeriod is how long an installation keeps its edition when
+// the update server cannot be reached
+const DefaultGracePeriod = 14 * 24 * time.Hour
+
+// cacheTTL is how long the stored state is cached, as edition checks run
+// on requests to enterprise modules
+const cacheTTL = time.Minute
+
+// state is what is stored of the last check
+type state struct {
+	Valid         bool       `json:"valid"`
+	Edition       string     `json:"edition,omitempty"`
+	Licensee      string     `json:"licensee,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Message       string     `json:"message,omitempty"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"` // Last answer of the update server
+	AttemptedAt   *time.Time `json:"attempted_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"` // Why the last attempt failed
+	Releases      []Release  `json:"releases,omitempty"`
+	ReleasesKnown bool       `json:"releases_known,omitempty"`
+}
+
+// Status is the license of the installation as shown to admins
+type Status struct {
+	Edition         string // Edition in effect
+	LicensedEdition string // Edition of the key at the last check
+	Features        []string
+	Key             string // Masked
+	Valid           bool
+	Licensee        string
+	ExpiresAt       *time.Time
+	Message         string
+	CheckedAt       *time.Time
+	AttemptedAt     *time.Time
+	LastError       string
+	Offline         bool       // The last attempt to reach the update server failed
+	GraceEndsAt     *time.Time // When the edition lapses unless the server is reached
+	Version         string
+	LatestVersion   string
+	UpdateAvailable bool
+	Releases        []Release // Releases newer than Version, newest first
+}
+
+// Service validates the license and checks for updates
+type Service struct {
+	db         *gorm.DB
+	version    string
+	instance   string
+	defaultKey string
+	server     Server
+	grace      time.Duration
+
+	mu       sync.Mutex
+	cached   *state
+	cacheKey string
+	loadedAt time.Time
+}
+
+// NewService creates a new license service for the running version.
+// Instance identifies the installation to the update server, such as its
+// base URL. Without a server every installation is community edition.
+func NewService(db *gorm.DB, version, instance string) *Service {
+	return &Service{db: db, version: version, instance: instance, grace: DefaultGracePeriod}
+}
+
+// SetServer sets the update server keys are validated with
+func (s *Service) SetServer(server Server) {
+	s.server = server
+}
+
+// SetGracePeriod sets how long the edition is kept while the update
+// server cannot be reached; zero keeps the default
+func (s *Service) SetGracePeriod(grace time.Duration) {
+	if grace > 0 {
+		s.grace = grace
+	}
+}
+
+// SetDefaultKey sets the key used until an admin enters one, such as one
+// from the configuration file
+func (s *Service) SetDefaultKey(key string) {
+	s.defaultKey = strings.TrimSpace(key)
+}
+
+// Edition returns the edition in effect
+func (s *Service) Edition() string {
+	key, st := s.load()
+	return s.edition(key, st, time.Now())
+}
+
+// Allows reports whether the edition in effect is served a module
+func (s *Service) Allows(feature string) bool {
+	for _, f := range editionFeatures[s.Edition()] {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredEdition returns the lowest edition served a module
+func RequiredEdition(feature string) string {
+	for _, edition := range []string{EditionCommunity, EditionEnterprise} {
+		for _, f := range editionFeatures[edition] {
+			if f == feature {
+				return edition
+			}
+		}
+	}
+	return EditionEnterprise
+}
+
+// Status returns the license and the newer releases
+func (s *Service) Status(now time.Time) *Status {
+	key, st := s.load()
+	edition := s.edition(key, st, now)
+	status := &Status{
+		Edition:         edition,
+		LicensedEdition: st.Edition,
+		Features:        append([]string{}, editionFeatures[edition]...),
+		Key:             maskKey(key),
+		Valid:           st.Valid,
+		Licensee:        st.Licensee,
+		ExpiresAt:       st.ExpiresAt,
+		Message:         st.Message,
+		CheckedAt:       st.CheckedAt,
+		AttemptedAt:     st.AttemptedAt,
+		LastError:       st.LastError,
+		Offline:         st.LastError != "",
+		Version:         s.version,
+	}
+	if st.Valid && st.CheckedAt != nil && status.Offline {
+		ends := st.CheckedAt.Add(s.grace)
+		status.GraceEndsAt = &ends
+	}
+
+	releases := newerReleases(st.Releases, s.version)
+	status.Releases = releases
+	if len(releases) > 0 {
+		status.LatestVersion = releases[0].Version
+		status.UpdateAvailable = true
+	} else if st.ReleasesKnown {
+		status.LatestVersion = s.version
+	}
+	return status
+}
+
+// SetKey stores the license key and validates it. The key is kept even
+// when the update server cannot be reached; ErrServerUnavailable is
+// returned with the status then.
+func (s *Service) SetKey(ctx context.Context, key string) (*Status, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, ErrKeyRequired
+	}
+	setting := domain.Setting{Key: domain.SettingLicenseKey}
+	if err := s.db.Where("key = ?", domain.SettingLicenseKey).
+		Assign(domain.Setting{Value: key, Type: "string", Group: "license", Label: "License key", Protected: true}).
+		FirstOrCreate(&setting).Error; err != nil {
+		return nil, err
+	}
+	// A new key starts without the answers about the previous one
+	if err := s.save(key, &state{}); err != nil {
+		return nil, err
+	}
+	return s.Check(ctx, time.Now())
+}
+
+// Check validates the key with the update server and reads the releases.
+// When the server cannot be reached the last answer is kept and
+// ErrServerUnavailable is returned with the status.
+func (s *Service) Check(ctx context.Context, now time.Time) (*Status, error) {
+	if s.server == nil {
+		return nil, ErrNoServer
+	}
+	key, current := s.load()
+	st := *current
+	attempted := now.UTC()
+	st.AttemptedAt = &attempted
+
+	var failure error
+	if key != "" {
+		validation, err := s.server.Validate(ctx, key, s.version, s.instance)
+		if err != nil {
+			failure = err
+		} else {
+			st.Valid = validation.Valid
+			st.Edition = validation.Edition
+			st.Licensee = validation.Licensee
+			st.ExpiresAt = validation.ExpiresAt
+			st.Message = validation.Message
+			if !st.Valid {
+				st.Edition = ""
+			}
+			st.CheckedAt = &attempted
+		}
+	}
+	if failure == nil {
+		releases, err := s.server.Releases(ctx, key, s.version)
+		if err != nil {
+			failure = err
+		} else {
+			st.Releases = releases
+			st.ReleasesKnown = true
+		}
+	}
+	st.LastError = ""
+	if failure != nil {
+		log.Printf("license check failed: %v", failure)
+		st.LastError = failure.Error()
+	}
+
+	if err := s.save(key, &st); err != nil {
+		return nil, err
+	}
+	status := s.Status(now)
+	if failure != nil {
+		return status, ErrServerUnavailable
+	}
+	return status, nil
+}
+
+// Monitor checks the license and releases every interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	if s.server == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Check(ctx, time.Now()); err != nil && err != ErrServerUnavailable {
+			log.Printf("license check failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// edition decides the edition in effect from the last answer
+func (s *Service) edition(key string, st *state, now time.Time) string {
+	if key == "" || !st.Valid || st.CheckedAt == nil {
+		return EditionCommunity
+	}
+	if st.ExpiresAt != nil && now.After(*st.ExpiresAt) {
+		return EditionCommunity
+	}
+	if now.Sub(*st.CheckedAt) > s.grace {
+		return EditionCommunity
+	}
+	if _, ok := editionFeatures[st.Edition]; !ok {
+		return EditionCommunity
+	}
+	return st.Edition
+}
+
+// load returns the key and the stored state, cached for a minute. A
+// failed read keeps the last state.
+func (s *Service) load() (string, *state) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil && time.Since(s.loadedAt) < cacheTTL {
+		return s.cacheKey, s.cached
+	}
+
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{domain.SettingLicenseKey, domain.SettingLicenseState}).
+		Find(&rows).Error; err != nil {
+		log.Printf("failed to read license: %v", err)
+		if s.cached == nil {
+			return s.defaultKey, &state{}
+		}
+		return s.cacheKey, s.cached
+	}
+	key, st := s.defaultKey, &state{}
+	for _, row := range rows {
+		switch row.Key {
+		case domain.SettingLicenseKey:
+			if row.Value != "" {
+				key = row.Value
+			}
+		case domain.SettingLicenseState:
+			if err := json.Unmarshal([]byte(row.Value), st); err != nil {
+				log.Printf("failed to read license state: %v", err)
+				st = &state{}
+			}
+		}
+	}
+	s.cached, s.cacheKey, s.loadedAt = st, key, time.Now()
+	return key, st
+}
+
+func (s *Service) save(key string, st *state) error {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	setting := domain.Setting{Key: domain.SettingLicenseState}
+	if err := s.db.Where("key = ?", domain.SettingLicenseState).
+		Assign(domain.Setting{Value: string(payload), Type: "json", Group: "license", Label: "License state", Protected: true}).
+		FirstOrCreate(&setting).Error; err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cached, s.cacheKey, s.loadedAt = st, key, time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// maskKey shows only the end of a key
+func maskKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// newerReleases returns the releases newer than version, newest first.
+// All are returned when the version is not a release, such as "dev".
+func newerReleases(releases []Release, version string) []Release {
+	current, ok := parseVersion(version)
+	newer := make([]Release, 0, len(releases))
+	for _, release := range releases {
+		v, valid := parseVersion(release.Version)
+		if !valid {
+			continue
+		}
+		if !ok || compareVersions(v, current) > 0 {
+			newer = append(newer, release)
+		}
+	}
+	sort.SliceStable(newer, func(i, j int) bool {
+		a, _ := parseVersion(newer[i].Version)
+		b, _ := parseVersion(newer[j].Version)
+		return compareVersions(a, b) > 0
+	})
+	return newer
+}
+
+// parseVersion reads a version such as "v1.2.3". Pre-release and build
+// suffixes are ignored.
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] > b[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
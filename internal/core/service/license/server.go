@@ -0,0 +1,124 @@
+package license
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// serverTimeout bounds a call so a slow update server does not hold up
+// the admin panel
+const serverTimeout = 15 * time.Second
+
+// Validation is the answer of the update server about a license key
+type Validation struct {
+	Valid     bool
+	Edition   string
+	Licensee  string
+	ExpiresAt *time.Time
+	Message   string // Why a key is not valid
+}
+
+// Release is a version of OpenHost published on the update server
+type Release struct {
+	Version    string    `json:"version"`
+	ReleasedAt time.Time `json:"released_at"`
+	Changelog  string    `json:"changelog"`
+	URL        string    `json:"url,omitempty"`
+	Security   bool      `json:"security,omitempty"` // Fixes security issues
+}
+
+// Server validates license keys and lists releases
+type Server interface {
+	Validate(ctx context.Context, key, version, instance string) (*Validation, error)
+	Releases(ctx context.Context, key, version string) ([]Release, error)
+}
+
+// UpdateServer is an update server reached over HTTP. Keys are posted to
+// {url}/licenses/validate and releases are read from {url}/releases.
+type UpdateServer struct {
+	url    string
+	client *http.Client
+}
+
+// NewUpdateServer creates a client of the update server at url
+func NewUpdateServer(url string) *UpdateServer {
+	return &UpdateServer{
+		url:    strings.TrimRight(strings.TrimSpace(url), "/"),
+		client: &http.Client{Timeout: serverTimeout},
+	}
+}
+
+// Validate asks the update server whether a license key is valid
+func (u *UpdateServer) Validate(ctx context.Context, key, version, instance string) (*Validation, error) {
+	payload, err := json.Marshal(map[string]string{"key": key, "version": version, "instance": instance})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url+"/licenses/validate", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Valid     bool       `json:"valid"`
+		Edition   string     `json:"edition"`
+		Licensee  string     `json:"licensee"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		Message   string     `json:"message"`
+	}
+	if err := u.do(req, &result); err != nil {
+		return nil, err
+	}
+	return &Validation{
+		Valid:     result.Valid,
+		Edition:   strings.ToLower(strings.TrimSpace(result.Edition)),
+		Licensee:  result.Licensee,
+		ExpiresAt: result.ExpiresAt,
+		Message:   result.Message,
+	}, nil
+}
+
+// Releases returns the releases the update server offers to a version
+func (u *UpdateServer) Releases(ctx context.Context, key, version string) ([]Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url+"/releases?version="+url.QueryEscape(version), nil)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	var result struct {
+		Releases []Release `json:"releases"`
+	}
+	if err := u.do(req, &result); err != nil {
+		return nil, err
+	}
+	return result.Releases, nil
+}
+
+func (u *UpdateServer) do(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("update server: %w", err)
+	}
+	defer resp.Body.Close()
+	// A rejected key is answered with 200 and valid set to false
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("update server: %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("update server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package maintenance turns the maintenance mode on and off. While it is
+// on the site answers customers with a 503, and background jobs that
+// change services and deliver webhooks hold off until it ends; staff
+// sessions and API keys keep working.
+package maintenance
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrEndsInPast = errors.New("end of maintenance must be in the future")
+)
+
+// cacheTTL is how long the mode is cached. Other instances sharing the
+// database notice a change within it.
+const cacheTTL = 5 * time.Second
+
+// State is the maintenance mode
+type State struct {
+	Enabled   bool
+	Message   string     // Shown to customers instead of the default text
+	StartedAt *time.Time // When it was turned on
+	EndsAt    *time.Time // When it is expected to end, sent as Retry-After
+}
+
+// Service reads and changes the maintenance mode
+type Service struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	state    State
+	loadedAt time.Time
+	onResume []func()
+}
+
+// NewService creates a new maintenance service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// OnResume adds a function called once maintenance ends, such as to send
+// the webhooks held during it
+func (s *Service) OnResume(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onResume = append(s.onResume, fn)
+}
+
+// State returns the maintenance mode. It is cached for a few seconds as
+// it is checked on every request; a failed read keeps the last state.
+func (s *Service) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < cacheTTL {
+		return s.state
+	}
+	state, err := s.load()
+	if err != nil {
+		log.Printf("failed to read maintenance mode: %v", err)
+	} else {
+		s.state = state
+	}
+	s.loadedAt = time.Now()
+	return s.state
+}
+
+// Active reports whether the maintenance mode is on
+func (s *Service) Active() bool {
+	return s.State().Enabled
+}
+
+// Enable turns the maintenance mode on, or updates its message and end
+// while it is on
+func (s *Service) Enable(message string, endsAt *time.Time, now time.Time) (State, error) {
+	if endsAt != nil && !endsAt.After(now) {
+		return State{}, ErrEndsInPast
+	}
+	current, err := s.load()
+	if err != nil {
+		return State{}, err
+	}
+
+	state := State{Enabled: true, Message: strings.TrimSpace(message), StartedAt: current.StartedAt, EndsAt: endsAt}
+	if !current.Enabled || state.StartedAt == nil {
+		started := now.UTC()
+		state.StartedAt = &started
+	}
+	if err := s.save(state); err != nil {
+		return State{}, err
+	}
+	if !current.Enabled {
+		log.Printf("maintenance mode on")
+	}
+	return state, nil
+}
+
+// Disable turns the maintenance mode off and resumes what it held
+func (s *Service) Disable() (State, error) {
+	current, err := s.load()
+	if err != nil {
+		return State{}, err
+	}
+	if err := s.save(State{}); err != nil {
+		return State{}, err
+	}
+	if current.Enabled {
+		log.Printf("maintenance mode off")
+		s.mu.Lock()
+		resume := append([]func(){}, s.onResume...)
+		s.mu.Unlock()
+		for _, fn := range resume {
+			go fn()
+		}
+	}
+	return State{}, nil
+}
+
+func (s *Service) load() (State, error) {
+	var state State
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{
+		domain.SettingMaintenance, domain.SettingMaintenanceMessage,
+		domain.SettingMaintenanceStartedAt, domain.SettingMaintenanceEndsAt,
+	}).Find(&rows).Error; err != nil {
+		return state, err
+	}
+	for _, row := range rows {
+		switch row.Key {
+		case domain.SettingMaintenance:
+			state.Enabled = row.Value == "true"
+		case domain.SettingMaintenanceMessage:
+			state.Message = row.Value
+		case domain.SettingMaintenanceStartedAt:
+			state.StartedAt = parseTime(row.Value)
+		case domain.SettingMaintenanceEndsAt:
+			state.EndsAt = parseTime(row.Value)
+		}
+	}
+	if !state.Enabled {
+		return State{}, nil
+	}
+	return state, nil
+}
+
+func (s *Service) save(state State) error {
+	enabled := "false"
+	if state.Enabled {
+		enabled = "true"
+	}
+	values := []domain.Setting{
+		{Key: domain.SettingMaintenance, Value: enabled, Type: "bool", Label: "Maintenance mode"},
+		{Key: domain.SettingMaintenanceMessage, Value: state.Message, Type: "string", Label: "Maintenance message"},
+		{Key: domain.SettingMaintenanceStartedAt, Value: formatTime(state.StartedAt), Type: "string", Label: "Maintenance started at"},
+		{Key: domain.SettingMaintenanceEndsAt, Value: formatTime(state.EndsAt), Type: "string", Label: "Maintenance ends at"},
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			setting := domain.Setting{Key: value.Key}
+			if err := tx.Where("key = ?", value.Key).
+				Assign(domain.Setting{Value: value.Value, Type: value.Type, Group: "system", Label: value.Label}).
+				FirstOrCreate(&setting).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.state = state
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func parseTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
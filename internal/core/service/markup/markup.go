@@ -0,0 +1,112 @@
+package markup
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// highlightStyle is the chroma style of code blocks in articles
+const highlightStyle = "github"
+
+// Options selects how Markdown is rendered
+type Options struct {
+	// Trusted keeps raw HTML such as classes and sandboxed iframes. Only
+	// content written by admins is trusted; everything else is limited to
+	// the HTML Markdown itself produces.
+	Trusted bool
+	// Highlight colors fenced code blocks with the classes of HighlightCSS
+	Highlight bool
+	// HardWraps turns every line break into <br>, which suits plain text
+	// such as ticket messages and emails
+	HardWraps bool
+}
+
+var (
+	// codeClass matches the classes of highlighted and fenced code
+	codeClass = regexp.MustCompile(`^[\w -]+$`)
+
+	strict  = strictPolicy()
+	trusted = trustedPolicy()
+)
+
+// Render converts Markdown to HTML and sanitizes the result. HTML in the
+// source passes through the parser and is then cleaned by the policy of
+// opts, so existing HTML content renders as before.
+func Render(source string, opts Options) (string, error) {
+	var buf bytes.Buffer
+	if err := newMarkdown(opts).Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	policy := strict
+	if opts.Trusted {
+		policy = trusted
+	}
+	return policy.SanitizeReader(&buf).String(), nil
+}
+
+// HighlightCSS writes the stylesheet of highlighted code blocks
+func HighlightCSS(w io.Writer) error {
+	return chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(w, styles.Get(highlightStyle))
+}
+
+func newMarkdown(opts Options) goldmark.Markdown {
+	extensions := []goldmark.Extender{extension.GFM}
+	if opts.Highlight {
+		extensions = append(extensions, highlighting.NewHighlighting(
+			highlighting.WithStyle(highlightStyle),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		))
+	}
+	var parserOptions []parser.Option
+	if opts.Trusted {
+		// Anchors for the headings of articles; untrusted content gets no
+		// IDs that could clash with those of the page
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+	// Raw HTML is rendered here and left to the sanitizer, which strips
+	// what the policy does not allow but keeps the text
+	rendererOptions := []renderer.Option{html.WithUnsafe()}
+	if opts.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
+
+// strictPolicy allows the HTML Markdown produces: formatting, links,
+// images, tables, code and task lists
+func strictPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(codeClass).OnElements("pre", "code", "span")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// trustedPolicy also allows classes everywhere and iframes, e.g. embedded
+// videos. Iframes are always sandboxed; their sandbox attribute may only
+// allow scripts, same-origin and presentation.
+func trustedPolicy() *bluemonday.Policy {
+	p := strictPolicy()
+	p.AllowStyling()
+	p.AllowElements("iframe")
+	p.AllowAttrs("src").Matching(regexp.MustCompile(`^https://`)).OnElements("iframe")
+	p.AllowAttrs("width", "height", "title", "allowfullscreen").OnElements("iframe")
+	p.AllowIFrames(bluemonday.SandboxAllowScripts, bluemonday.SandboxAllowSameOrigin, bluemonday.SandboxAllowPresentation)
+	return p
+}
@@ -0,0 +1,416 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+)
+
+// Default limits of the media library
+const (
+	DefaultMaxFileSize   = 10 << 20
+	DefaultMaxDimension  = 2048
+	DefaultThumbnailSize = 320
+
+	// maxPixels bounds the size of decoded images, which take four bytes
+	// per pixel in memory however small the file is
+	maxPixels = 50_000_000
+)
+
+var (
+	ErrMediaNotFound    = errors.New("media file not found")
+	ErrFileTooLarge     = errors.New("image exceeds the maximum upload size")
+	ErrUnsupportedImage = errors.New("file is not a JPEG, PNG or GIF image")
+	ErrImageTooLarge    = errors.New("image has too many pixels")
+	ErrInUse            = errors.New("image is used by articles or products")
+	ErrNoFileStore      = errors.New("file storage is not configured")
+)
+
+// Service manages the media library: images uploaded once and hosted for
+// knowledge base articles and product descriptions
+type Service struct {
+	db            *gorm.DB
+	files         domain.FileStore
+	quarantine    *quarantine.Service
+	webp          domain.WebPEncoder
+	maxFileSize   int64
+	maxDimension  int
+	thumbnailSize int
+}
+
+// NewService creates a new media service
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:            db,
+		maxFileSize:   DefaultMaxFileSize,
+		maxDimension:  DefaultMaxDimension,
+		thumbnailSize: DefaultThumbnailSize,
+	}
+}
+
+// SetFileStore sets the store images are uploaded to
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetQuarantine scans uploads for malware before they are processed
+func (s *Service) SetQuarantine(q *quarantine.Service) {
+	s.quarantine = q
+}
+
+// SetWebPEncoder makes WebP variants of new images with encoder
+func (s *Service) SetWebPEncoder(encoder domain.WebPEncoder) {
+	s.webp = encoder
+}
+
+// SetLimits sets the largest upload, the size images are scaled down to
+// and the size of thumbnails. Zero keeps the default.
+func (s *Service) SetLimits(maxFileSize int64, maxDimension, thumbnailSize int) {
+	if maxFileSize > 0 {
+		s.maxFileSize = maxFileSize
+	}
+	if maxDimension > 0 {
+		s.maxDimension = maxDimension
+	}
+	if thumbnailSize > 0 {
+		s.thumbnailSize = thumbnailSize
+	}
+}
+
+// MaxFileSize returns the largest image that can be uploaded
+func (s *Service) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// UploadInput is an uploaded image
+type UploadInput struct {
+	FileName string
+	Folder   string
+	AltText  string
+	Reader   io.Reader
+	Size     int64
+}
+
+// MediaUpdate holds the editable fields of an image
+type MediaUpdate struct {
+	FileName string
+	Folder   string
+	AltText  string
+}
+
+// Folder is a folder of the media library with its number of images
+type Folder struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// References lists the content that shows an image
+type References struct {
+	ArticleIDs []uint64
+	ProductIDs []uint64
+}
+
+// Empty reports whether nothing shows the image
+func (r References) Empty() bool {
+	return len(r.ArticleIDs) == 0 && len(r.ProductIDs) == 0
+}
+
+// variant is an encoded image waiting to be stored
+type variant struct {
+	key         *string
+	suffix      string
+	data        []byte
+	contentType string
+}
+
+// Upload scans an image, scales it down to the maximum dimension and
+// stores it with a thumbnail and, with a WebP encoder, WebP variants of
+// both. Animated GIFs are kept as they are; their thumbnail shows the
+// first frame.
+func (s *Service) Upload(ctx context.Context, input UploadInput, uploadedBy uint64) (*domain.MediaFile, error) {
+	if s.files == nil {
+		return nil, ErrNoFileStore
+	}
+	if input.Size > s.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	checked, err := s.quarantine.Check(ctx, quarantine.Upload{
+		Source:      domain.UploadSourceMedia,
+		UploadedBy:  &uploadedBy,
+		FileName:    input.FileName,
+		ContentType: "application/octet-stream",
+		Reader:      input.Reader,
+		Size:        input.Size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer checked.Close()
+
+	data, err := io.ReadAll(io.LimitReader(checked, s.maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || contentTypes[format] == "" {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	file := &domain.MediaFile{
+		FileName:    input.FileName,
+		Folder:      cleanFolder(input.Folder),
+		AltText:     strings.TrimSpace(input.AltText),
+		ContentType: contentTypes[format],
+		Width:       config.Width,
+		Height:      config.Height,
+		UploadedBy:  uploadedBy,
+	}
+	if format != "gif" {
+		if w, h := fit(config.Width, config.Height, s.maxDimension); w != config.Width || h != config.Height {
+			img = resize(img, w, h)
+			if data, err = encode(img, format); err != nil {
+				return nil, err
+			}
+			file.Width, file.Height = w, h
+		}
+	}
+	file.FileSize = int64(len(data))
+
+	thumbnail := img
+	if w, h := fit(file.Width, file.Height, s.thumbnailSize); w != file.Width || h != file.Height || format == "gif" {
+		thumbnail = resize(img, w, h)
+	}
+	thumbnailFormat := "png"
+	if format == "jpeg" {
+		thumbnailFormat = "jpeg"
+	}
+	thumbnailData, err := encode(thumbnail, thumbnailFormat)
+	if err != nil {
+		return nil, err
+	}
+	file.ThumbnailType = contentTypes[thumbnailFormat]
+
+	variants := []variant{
+		{&file.StorageKey, "", data, file.ContentType},
+		{&file.ThumbnailKey, "-thumb", thumbnailData, file.ThumbnailType},
+	}
+	if s.webp != nil && format != "gif" {
+		for _, v := range []struct {
+			key    *string
+			suffix string
+			img    image.Image
+		}{{&file.WebPKey, "-webp", img}, {&file.ThumbnailWebPKey, "-thumb-webp", thumbnail}} {
+			var buf bytes.Buffer
+			if err := s.webp.EncodeWebP(ctx, v.img, &buf); err != nil {
+				// WebP only saves bandwidth; the image works without it
+				log.Printf("media: failed to convert %q to WebP: %v", input.FileName, err)
+				break
+			}
+			variants = append(variants, variant{v.key, v.suffix, buf.Bytes(), "image/webp"})
+		}
+	}
+
+	base, err := domain.NewFileKey("media")
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		key := base + v.suffix
+		if err := s.files.Put(ctx, key, bytes.NewReader(v.data), int64(len(v.data)), v.contentType); err != nil {
+			s.removeFiles(file)
+			return nil, err
+		}
+		*v.key = key
+	}
+
+	if err := s.db.Omit("Uploader").Create(file).Error; err != nil {
+		s.removeFiles(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+// ListMedia lists images, newest first, optionally of a folder or with a
+// file name or alt text matching search
+func (s *Service) ListMedia(folder *string, search string, limit, offset int) ([]domain.MediaFile, int64, error) {
+	query := s.db.Model(&domain.MediaFile{})
+	if folder != nil {
+		query = query.Where("folder = ?", cleanFolder(*folder))
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		pattern := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(file_name) LIKE ? OR LOWER(alt_text) LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var files []domain.MediaFile
+	if err := query.Preload("Uploader").Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&files).Error; err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// ListFolders lists the folders of the media library by name
+func (s *Service) ListFolders() ([]Folder, error) {
+	var folders []Folder
+	if err := s.db.Model(&domain.MediaFile{}).
+		Select("folder AS name, COUNT(*) AS count").
+		Group("folder").Order("folder").
+		Scan(&folders).Error; err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// GetMedia retrieves an image
+func (s *Service) GetMedia(id uint64) (*domain.MediaFile, error) {
+	var file domain.MediaFile
+	if err := s.db.Preload("Uploader").First(&file, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UpdateMedia updates the name, folder and alt text of an image
+func (s *Service) UpdateMedia(id uint64, update MediaUpdate) (*domain.MediaFile, error) {
+	file, err := s.GetMedia(id)
+	if err != nil {
+		return nil, err
+	}
+	if name := strings.TrimSpace(update.FileName); name != "" {
+		file.FileName = name
+	}
+	file.Folder = cleanFolder(update.Folder)
+	file.AltText = strings.TrimSpace(update.AltText)
+	if err := s.db.Omit("Uploader").Save(file).Error; err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Open returns the content and content type of an image or its
+// thumbnail, as WebP when the client accepts it and a variant exists
+func (s *Service) Open(ctx context.Context, file *domain.MediaFile, thumbnail, acceptWebP bool) (io.ReadCloser, string, error) {
+	if s.files == nil {
+		return nil, "", ErrNoFileStore
+	}
+	key, contentType := file.StorageKey, file.ContentType
+	webpKey := file.WebPKey
+	if thumbnail {
+		key, contentType = file.ThumbnailKey, file.ThumbnailType
+		webpKey = file.ThumbnailWebPKey
+	}
+	if acceptWebP && webpKey != "" {
+		key, contentType = webpKey, "image/webp"
+	}
+	r, err := s.files.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return r, contentType, nil
+}
+
+// FindReferences lists the knowledge base articles and products whose
+// content links to an image
+func (s *Service) FindReferences(id uint64) (References, error) {
+	refs := References{ArticleIDs: []uint64{}, ProductIDs: []uint64{}}
+	path := fmt.Sprintf("/media/%d", id)
+	// LIKE also matches longer IDs such as /media/12 for /media/1
+	exact := regexp.MustCompile(regexp.QuoteMeta(path) + `(\D|$)`)
+
+	var articles []domain.KnowledgeBaseArticle
+	if err := s.db.Select("id, content").Where("content LIKE ?", "%"+path+"%").Find(&articles).Error; err != nil {
+		return refs, err
+	}
+	for _, a := range articles {
+		if exact.MatchString(a.Content) {
+			refs.ArticleIDs = append(refs.ArticleIDs, a.ID)
+		}
+	}
+
+	var products []domain.Product
+	if err := s.db.Select("id, description").Where("description LIKE ?", "%"+path+"%").Find(&products).Error; err != nil {
+		return refs, err
+	}
+	for _, p := range products {
+		if exact.MatchString(p.Description) {
+			refs.ProductIDs = append(refs.ProductIDs, p.ID)
+		}
+	}
+	return refs, nil
+}
+
+// DeleteMedia deletes an image and its variants. Images still shown by
+// articles or products are only deleted with force.
+func (s *Service) DeleteMedia(id uint64, force bool) error {
+	file, err := s.GetMedia(id)
+	if err != nil {
+		return err
+	}
+	if !force {
+		refs, err := s.FindReferences(id)
+		if err != nil {
+			return err
+		}
+		if !refs.Empty() {
+			return ErrInUse
+		}
+	}
+	if err := s.db.Delete(&domain.MediaFile{}, id).Error; err != nil {
+		return err
+	}
+	s.removeFiles(file)
+	return nil
+}
+
+func (s *Service) removeFiles(file *domain.MediaFile) {
+	for _, key := range file.StorageKeys() {
+		if key == "" {
+			continue
+		}
+		if err := s.files.Delete(context.Background(), key); err != nil {
+			log.Printf("media: failed to delete file %s: %v", key, err)
+		}
+	}
+}
+
+// cleanFolder normalizes a folder path such as " /Products//VPS/ " to
+// "Products/VPS"
+func cleanFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,250 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Symbol placements
+const (
+	SymbolLeft  = "left"
+	SymbolRight = "right"
+)
+
+// Currency describes how amounts of a currency are written
+type Currency struct {
+	Code      string
+	Symbol    string
+	Exponent  int    // Number of minor unit digits (JPY 0, USD 2, BHD 3)
+	SymbolPos string // SymbolLeft or SymbolRight
+}
+
+// Locale is the number format of a language. Pattern places the currency
+// symbol "¤" around the number "#", e.g. "# ¤"; when empty the placement
+// of the currency is used.
+type Locale struct {
+	DecimalSeparator string
+	GroupSeparator   string
+	Pattern          string
+}
+
+// DefaultLocale formats numbers like 1,234.56
+var DefaultLocale = Locale{DecimalSeparator: ".", GroupSeparator: ","}
+
+// DefaultCurrency is used when the database has no default currency
+const DefaultCurrency = "USD"
+
+// isoCurrencies are the ISO 4217 minor units and common symbols of the
+// currencies OpenHost knows without database configuration
+var isoCurrencies = map[string]Currency{
+	"USD": {Symbol: "$", Exponent: 2},
+	"EUR": {Symbol: "€", Exponent: 2},
+	"GBP": {Symbol: "£", Exponent: 2},
+	"CNY": {Symbol: "¥", Exponent: 2},
+	"JPY": {Symbol: "¥", Exponent: 0},
+	"KRW": {Symbol: "₩", Exponent: 0},
+	"HKD": {Symbol: "HK$", Exponent: 2},
+	"TWD": {Symbol: "NT$", Exponent: 2},
+	"SGD": {Symbol: "S$", Exponent: 2},
+	"AUD": {Symbol: "A$", Exponent: 2},
+	"CAD": {Symbol: "CA$", Exponent: 2},
+	"NZD": {Symbol: "NZ$", Exponent: 2},
+	"CHF": {Symbol: "CHF", Exponent: 2},
+	"INR": {Symbol: "₹", Exponent: 2},
+	"RUB": {Symbol: "₽", Exponent: 2, SymbolPos: SymbolRight},
+	"BRL": {Symbol: "R$", Exponent: 2},
+	"MXN": {Symbol: "MX$", Exponent: 2},
+	"SEK": {Symbol: "kr", Exponent: 2, SymbolPos: SymbolRight},
+	"NOK": {Symbol: "kr", Exponent: 2, SymbolPos: SymbolRight},
+	"DKK": {Symbol: "kr", Exponent: 2, SymbolPos: SymbolRight},
+	"PLN": {Symbol: "zł", Exponent: 2, SymbolPos: SymbolRight},
+	"CZK": {Symbol: "Kč", Exponent: 2, SymbolPos: SymbolRight},
+	"HUF": {Symbol: "Ft", Exponent: 2, SymbolPos: SymbolRight},
+	"TRY": {Symbol: "₺", Exponent: 2},
+	"ZAR": {Symbol: "R", Exponent: 2},
+	"IDR": {Symbol: "Rp", Exponent: 2},
+	"VND": {Symbol: "₫", Exponent: 0, SymbolPos: SymbolRight},
+	"CLP": {Symbol: "CLP$", Exponent: 0},
+	"ISK": {Symbol: "kr", Exponent: 0, SymbolPos: SymbolRight},
+	"PYG": {Symbol: "₲", Exponent: 0},
+	"UGX": {Symbol: "USh", Exponent: 0},
+	"XAF": {Symbol: "FCFA", Exponent: 0, SymbolPos: SymbolRight},
+	"XOF": {Symbol: "CFA", Exponent: 0, SymbolPos: SymbolRight},
+	"BHD": {Symbol: "BD", Exponent: 3},
+	"KWD": {Symbol: "KD", Exponent: 3},
+	"OMR": {Symbol: "OMR", Exponent: 3},
+	"JOD": {Symbol: "JD", Exponent: 3},
+	"TND": {Symbol: "DT", Exponent: 3},
+	"LYD": {Symbol: "LD", Exponent: 3},
+	"IQD": {Symbol: "IQD", Exponent: 3},
+}
+
+// Service formats monetary amounts in the minor units of their currency.
+// Currencies configured in the database take precedence over the ISO 4217
+// defaults.
+type Service struct {
+	db *gorm.DB
+
+	mu              sync.RWMutex
+	currencies      map[string]Currency
+	defaultCurrency string
+}
+
+// NewService creates a new money service. A nil database uses the ISO
+// 4217 defaults only.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, currencies: make(map[string]Currency), defaultCurrency: DefaultCurrency}
+}
+
+// LoadCurrencies loads the active currencies from the database, replacing
+// the ones loaded before
+func (s *Service) LoadCurrencies() error {
+	if s.db == nil {
+		return nil
+	}
+
+	var rows []domain.Currency
+	if err := s.db.Where("active = ?", true).Find(&rows).Error; err != nil {
+		return fmt.Errorf("load currencies: %w", err)
+	}
+
+	currencies := make(map[string]Currency, len(rows))
+	defaultCurrency := DefaultCurrency
+	for _, row := range rows {
+		code := strings.ToUpper(row.Code)
+		if row.IsDefault {
+			defaultCurrency = code
+		}
+		currencies[code] = Currency{
+			Code:      code,
+			Symbol:    row.Symbol,
+			Exponent:  row.DecimalPlaces,
+			SymbolPos: row.SymbolPos,
+		}
+	}
+
+	s.mu.Lock()
+	s.currencies = currencies
+	s.defaultCurrency = defaultCurrency
+	s.mu.Unlock()
+	return nil
+}
+
+// DefaultCurrency returns the code of the default currency
+func (s *Service) DefaultCurrency() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultCurrency
+}
+
+// Active reports whether a currency is active, so customers can be billed
+// in it. Without configured currencies only the default one is.
+func (s *Service) Active(code string) bool {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.currencies) == 0 {
+		return code == s.defaultCurrency
+	}
+	_, ok := s.currencies[code]
+	return ok
+}
+
+// Currency returns how amounts of a currency are written. Unknown codes
+// get two decimals and the code as symbol.
+func (s *Service) Currency(code string) Currency {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	s.mu.RLock()
+	currency, ok := s.currencies[code]
+	s.mu.RUnlock()
+	if !ok {
+		currency, ok = isoCurrencies[code]
+		currency.Code = code
+	}
+	if !ok {
+		currency = Currency{Code: code, Symbol: code, Exponent: 2, SymbolPos: SymbolRight}
+	}
+	if currency.Symbol == "" {
+		currency.Symbol = code
+	}
+	if currency.SymbolPos == "" {
+		currency.SymbolPos = SymbolLeft
+	}
+	return currency
+}
+
+// Round rounds an amount to the minor units of its currency
+func (s *Service) Round(amount decimal.Decimal, code string) decimal.Decimal {
+	return amount.Round(int32(s.Currency(code).Exponent))
+}
+
+// Amount returns an amount with the decimals of its currency and a dot as
+// decimal separator, as used in API string fields (e.g. "12.50", "1250"
+// for JPY and "12.500" for BHD)
+func (s *Service) Amount(amount decimal.Decimal, code string) string {
+	return amount.StringFixed(int32(s.Currency(code).Exponent))
+}
+
+// Format returns an amount for display, with the decimals and symbol of
+// its currency and the separators and symbol placement of the locale
+func (s *Service) Format(amount decimal.Decimal, code string, locale Locale) string {
+	currency := s.Currency(code)
+	if locale.DecimalSeparator == "" {
+		locale.DecimalSeparator = DefaultLocale.DecimalSeparator
+	}
+	if locale.GroupSeparator == "" {
+		locale.GroupSeparator = DefaultLocale.GroupSeparator
+	}
+
+	number := groupDigits(amount.Abs().StringFixed(int32(currency.Exponent)), locale)
+
+	pattern := locale.Pattern
+	if pattern == "" {
+		pattern = "¤#"
+		if currency.SymbolPos == SymbolRight {
+			pattern = "# ¤"
+		}
+	}
+	// Alphabetic symbols need a space to stay readable, as in "CHF 12.50"
+	if pattern == "¤#" && endsWithLetter(currency.Symbol) {
+		pattern = "¤ #"
+	}
+
+	formatted := strings.Replace(strings.Replace(pattern, "#", number, 1), "¤", currency.Symbol, 1)
+	if amount.IsNegative() && !amount.Round(int32(currency.Exponent)).IsZero() {
+		return "-" + formatted
+	}
+	return formatted
+}
+
+// groupDigits applies the separators of a locale to a plain decimal string
+func groupDigits(plain string, locale Locale) string {
+	intPart, fracPart, hasFrac := strings.Cut(plain, ".")
+
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(locale.GroupSeparator)
+		}
+		b.WriteRune(c)
+	}
+	if hasFrac {
+		b.WriteString(locale.DecimalSeparator)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+func endsWithLetter(s string) bool {
+	runes := []rune(s)
+	return len(runes) > 0 && unicode.IsLetter(runes[len(runes)-1])
+}
@@ -0,0 +1,449 @@
+// Package network keeps the network status page: its components, their
+// incidents and scheduled maintenance. Maintenance can target servers and
+// services; the customers of the affected services are emailed ahead of
+// the window and shown a banner on their services while it lasts.
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrComponentNotFound   = errors.New("component not found")
+	ErrMaintenanceNotFound = errors.New("maintenance not found")
+	ErrNameRequired        = errors.New("component name is required")
+	ErrTitleRequired       = errors.New("maintenance title is required")
+	ErrInvalidWindow       = errors.New("maintenance must end after it starts")
+	ErrInvalidImpact       = errors.New("impact must be none, minor, major or critical")
+	ErrTargetNotFound      = errors.New("targeted server or service not found")
+	ErrServiceNotFound     = errors.New("service not found")
+)
+
+// NotificationMaintenanceNotice is the email template and notification
+// type customers get ahead of maintenance of their services
+const NotificationMaintenanceNotice = "maintenance_notice"
+
+// Service manages the network status page
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new network status service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// MaintenanceInput is the editable part of scheduled maintenance
+type MaintenanceInput struct {
+	ComponentID uint64
+	Title       string
+	Message     string
+	Impact      string
+	StartsAt    time.Time
+	EndsAt      time.Time
+	NoticeHours int
+	ServerIDs   []uint64
+	ServiceIDs  []uint64
+}
+
+// Affected is maintenance with the services of a customer it affects
+type Affected struct {
+	Maintenance domain.NetworkIncident
+	ServiceIDs  []uint64
+}
+
+// ListComponents returns the active components of the status page
+func (s *Service) ListComponents() ([]domain.NetworkStatusPage, error) {
+	var components []domain.NetworkStatusPage
+	err := s.db.Where("active = ?", true).Order("sort_order, name").Find(&components).Error
+	return components, err
+}
+
+// CreateComponent adds a component to the status page
+func (s *Service) CreateComponent(name, description string, sortOrder int) (*domain.NetworkStatusPage, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+
+	component := &domain.NetworkStatusPage{
+		Name:        name,
+		Description: description,
+		Status:      "operational",
+		Active:      true,
+		SortOrder:   sortOrder,
+	}
+	if err := s.db.Create(component).Error; err != nil {
+		return nil, err
+	}
+	return component, nil
+}
+
+// ScheduleMaintenance adds maintenance of a component, optionally
+// targeting servers and services
+func (s *Service) ScheduleMaintenance(createdBy uint64, input MaintenanceInput) (*domain.NetworkIncident, error) {
+	if err := s.validate(&input); err != nil {
+		return nil, err
+	}
+
+	maintenance := &domain.NetworkIncident{
+		ComponentID:  input.ComponentID,
+		Title:        input.Title,
+		Status:       domain.MaintenanceScheduled,
+		Impact:       input.Impact,
+		Message:      input.Message,
+		ScheduledAt:  &input.StartsAt,
+		ScheduledEnd: &input.EndsAt,
+		NoticeHours:  input.NoticeHours,
+		CreatedBy:    createdBy,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(maintenance).Error; err != nil {
+			return err
+		}
+		return createTargets(tx, maintenance.ID, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMaintenance(maintenance.ID)
+}
+
+// UpdateMaintenance replaces the fields and targets of maintenance. Moving
+// the window of maintenance that was announced announces it again.
+func (s *Service) UpdateMaintenance(id uint64, input MaintenanceInput) (*domain.NetworkIncident, error) {
+	maintenance, err := s.GetMaintenance(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(&input); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"component_id":  input.ComponentID,
+		"title":         input.Title,
+		"message":       input.Message,
+		"impact":        input.Impact,
+		"scheduled_at":  input.StartsAt,
+		"scheduled_end": input.EndsAt,
+		"notice_hours":  input.NoticeHours,
+	}
+	if !maintenance.ScheduledAt.Equal(input.StartsAt) || !maintenance.ScheduledEnd.Equal(input.EndsAt) {
+		updates["notice_sent_at"] = nil
+		updates["status"] = domain.MaintenanceScheduled
+		updates["resolved_at"] = nil
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(maintenance).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("incident_id = ?", id).Delete(&domain.NetworkIncidentTarget{}).Error; err != nil {
+			return err
+		}
+		return createTargets(tx, id, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMaintenance(id)
+}
+
+// DeleteMaintenance cancels maintenance
+func (s *Service) DeleteMaintenance(id uint64) error {
+	if _, err := s.GetMaintenance(id); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("incident_id = ?", id).Delete(&domain.NetworkIncidentTarget{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("incident_id = ?", id).Delete(&domain.NetworkIncidentUpdate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.NetworkIncident{}, id).Error
+	})
+}
+
+// GetMaintenance returns maintenance with its component and targets
+func (s *Service) GetMaintenance(id uint64) (*domain.NetworkIncident, error) {
+	var maintenance domain.NetworkIncident
+	result := s.db.Preload("Component").Preload("Targets").
+		Where("scheduled_at IS NOT NULL AND scheduled_end IS NOT NULL").Limit(1).Find(&maintenance, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMaintenanceNotFound
+	}
+	return &maintenance, nil
+}
+
+// Calendar returns the maintenance overlapping a period, the first
+// starting first
+func (s *Service) Calendar(from, to time.Time) ([]domain.NetworkIncident, error) {
+	var maintenance []domain.NetworkIncident
+	err := s.db.Preload("Component").Preload("Targets").
+		Where("scheduled_at IS NOT NULL AND scheduled_at < ? AND scheduled_end > ?", to, from).
+		Order("scheduled_at, id").Find(&maintenance).Error
+	return maintenance, err
+}
+
+// ForCustomer returns the maintenance not over yet that affects services
+// of a customer
+func (s *Service) ForCustomer(customerID uint64, now time.Time) ([]Affected, error) {
+	return s.affecting(now, "services.customer_id = ?", customerID)
+}
+
+// ForService returns the maintenance not over yet that affects a service
+// of a customer
+func (s *Service) ForService(serviceID, customerID uint64, now time.Time) ([]Affected, error) {
+	var count int64
+	if err := s.db.Model(&domain.Service{}).Where("id = ? AND customer_id = ?", serviceID, customerID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return s.affecting(now, "services.id = ?", serviceID)
+}
+
+// SendNotices emails and notifies the customers affected by maintenance
+// starting within its notice period. It returns how many maintenance
+// windows were announced.
+func (s *Service) SendNotices(now time.Time) (int, error) {
+	var pending []domain.NetworkIncident
+	if err := s.db.Preload("Component").
+		Where("scheduled_at IS NOT NULL AND notice_sent_at IS NULL AND scheduled_end > ?", now).
+		Find(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	notifier := notification.NewService(s.db)
+	sent := 0
+	for i := range pending {
+		maintenance := &pending[i]
+		if maintenance.ScheduledAt.Add(-time.Duration(maintenance.NoticeHours) * time.Hour).After(now) {
+			continue
+		}
+		if err := s.db.Model(maintenance).Update("notice_sent_at", now).Error; err != nil {
+			return sent, err
+		}
+
+		var rows []struct {
+			CustomerID uint64
+			ServiceID  uint64
+		}
+		if err := s.affectedServices(maintenance.ID).Select("services.customer_id, services.id AS service_id").
+			Order("services.customer_id, services.id").Scan(&rows).Error; err != nil {
+			return sent, err
+		}
+		services := map[uint64][]uint64{}
+		var customers []uint64
+		for _, row := range rows {
+			if _, ok := services[row.CustomerID]; !ok {
+				customers = append(customers, row.CustomerID)
+			}
+			services[row.CustomerID] = append(services[row.CustomerID], row.ServiceID)
+		}
+
+		window := fmt.Sprintf("%s to %s", maintenance.ScheduledAt.UTC().Format("Jan 2, 2006 15:04"),
+			maintenance.ScheduledEnd.UTC().Format("Jan 2, 2006 15:04 MST"))
+		for _, customerID := range customers {
+			var customer domain.User
+			if err := s.db.Select("id", "email").First(&customer, customerID).Error; err != nil {
+				log.Printf("failed to load customer %d for maintenance %d: %v", customerID, maintenance.ID, err)
+				continue
+			}
+			serviceIDs := services[customerID]
+			title := "Scheduled maintenance: " + maintenance.Title
+			message := fmt.Sprintf("Maintenance of %s from %s affects %d of your services.", maintenance.Component.Name, window, len(serviceIDs))
+			link := fmt.Sprintf("/client/services/%d", serviceIDs[0])
+			if err := notifier.SendNotification(customerID, NotificationMaintenanceNotice, title, message, link); err != nil {
+				log.Printf("failed to notify customer %d of maintenance %d: %v", customerID, maintenance.ID, err)
+			}
+			if err := notifier.SendEmail(NotificationMaintenanceNotice, customer.Email, map[string]interface{}{
+				"Title":      maintenance.Title,
+				"Message":    maintenance.Message,
+				"Component":  maintenance.Component.Name,
+				"Impact":     maintenance.Impact,
+				"StartsAt":   maintenance.ScheduledAt.UTC().Format("Jan 2, 2006 15:04 MST"),
+				"EndsAt":     maintenance.ScheduledEnd.UTC().Format("Jan 2, 2006 15:04 MST"),
+				"ServiceIDs": serviceIDs,
+			}); err != nil && err != notification.ErrTemplateNotFound {
+				log.Printf("failed to email customer %d of maintenance %d: %v", customerID, maintenance.ID, err)
+			}
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// UpdateStatuses starts and completes maintenance as its window opens
+// and closes
+func (s *Service) UpdateStatuses(now time.Time) error {
+	if err := s.db.Model(&domain.NetworkIncident{}).
+		Where("status = ? AND scheduled_at <= ? AND scheduled_end > ?", domain.MaintenanceScheduled, now, now).
+		Update("status", domain.MaintenanceInProgress).Error; err != nil {
+		return err
+	}
+	return s.db.Model(&domain.NetworkIncident{}).
+		Where("status IN ? AND scheduled_end <= ?", []string{domain.MaintenanceScheduled, domain.MaintenanceInProgress}, now).
+		Updates(map[string]interface{}{"status": domain.MaintenanceCompleted, "resolved_at": now}).Error
+}
+
+// Monitor announces upcoming maintenance and keeps its status on the
+// given interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if n, err := s.SendNotices(now); err != nil {
+			log.Printf("failed to send maintenance notices: %v", err)
+		} else if n > 0 {
+			log.Printf("announced %d maintenance window(s)", n)
+		}
+		if err := s.UpdateStatuses(now); err != nil {
+			log.Printf("failed to update maintenance statuses: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// affectedServices selects the services targeted by maintenance, directly
+// or through their server
+func (s *Service) affectedServices(maintenanceID uint64) *gorm.DB {
+	return s.db.Table("services").
+		Joins("JOIN network_incident_targets ON network_incident_targets.service_id = services.id OR network_incident_targets.server_id = services.server_id").
+		Where("network_incident_targets.incident_id = ? AND services.status IN ?", maintenanceID,
+			[]domain.ServiceStatus{domain.ServiceStatusActive, domain.ServiceStatusSuspended}).
+		Group("services.customer_id, services.id")
+}
+
+func (s *Service) affecting(now time.Time, condition string, id uint64) ([]Affected, error) {
+	var rows []struct {
+		IncidentID uint64
+		ServiceID  uint64
+	}
+	err := s.db.Table("network_incident_targets").
+		Select("network_incident_targets.incident_id, services.id AS service_id").
+		Joins("JOIN network_incidents ON network_incidents.id = network_incident_targets.incident_id").
+		Joins("JOIN services ON network_incident_targets.service_id = services.id OR network_incident_targets.server_id = services.server_id").
+		Where("network_incidents.scheduled_at IS NOT NULL AND network_incidents.scheduled_end > ?", now).
+		Where(condition, id).
+		Group("network_incident_targets.incident_id, services.id").
+		Order("services.id").Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	services := map[uint64][]uint64{}
+	ids := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		if _, ok := services[row.IncidentID]; !ok {
+			ids = append(ids, row.IncidentID)
+		}
+		services[row.IncidentID] = append(services[row.IncidentID], row.ServiceID)
+	}
+
+	var maintenance []domain.NetworkIncident
+	if err := s.db.Preload("Component").Where("id IN ?", ids).Order("scheduled_at, id").Find(&maintenance).Error; err != nil {
+		return nil, err
+	}
+	affected := make([]Affected, 0, len(maintenance))
+	for _, m := range maintenance {
+		affected = append(affected, Affected{Maintenance: m, ServiceIDs: services[m.ID]})
+	}
+	return affected, nil
+}
+
+func (s *Service) validate(input *MaintenanceInput) error {
+	input.Title = strings.TrimSpace(input.Title)
+	if input.Title == "" {
+		return ErrTitleRequired
+	}
+	if !input.EndsAt.After(input.StartsAt) {
+		return ErrInvalidWindow
+	}
+	switch input.Impact {
+	case "":
+		input.Impact = "minor"
+	case "none", "minor", "major", "critical":
+	default:
+		return ErrInvalidImpact
+	}
+	if input.NoticeHours < 0 {
+		input.NoticeHours = 0
+	}
+
+	var count int64
+	if err := s.db.Model(&domain.NetworkStatusPage{}).Where("id = ?", input.ComponentID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrComponentNotFound
+	}
+	input.ServerIDs = unique(input.ServerIDs)
+	input.ServiceIDs = unique(input.ServiceIDs)
+	if err := s.checkExist(&domain.Server{}, input.ServerIDs); err != nil {
+		return err
+	}
+	return s.checkExist(&domain.Service{}, input.ServiceIDs)
+}
+
+func (s *Service) checkExist(model interface{}, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(model).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return ErrTargetNotFound
+	}
+	return nil
+}
+
+func unique(ids []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(ids))
+	result := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func createTargets(tx *gorm.DB, maintenanceID uint64, input MaintenanceInput) error {
+	for _, id := range input.ServerIDs {
+		if err := tx.Create(&domain.NetworkIncidentTarget{IncidentID: maintenanceID, ServerID: &id}).Error; err != nil {
+			return err
+		}
+	}
+	for _, id := range input.ServiceIDs {
+		if err := tx.Create(&domain.NetworkIncidentTarget{IncidentID: maintenanceID, ServiceID: &id}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
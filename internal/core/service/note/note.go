@@ -0,0 +1,417 @@
+// Package note keeps the internal staff notes on customers and orders.
+// Notes can mention other staff members with @, who are notified, can be
+// pinned to the top of the record and keep the text they had before each
+// edit.
+package note
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrNoteNotFound    = errors.New("note not found")
+	ErrSubjectNotFound = errors.New("customer or order not found")
+	ErrNoteRequired    = errors.New("note text is required")
+	ErrInvalidSubject  = errors.New("notes can be written on customers and orders")
+)
+
+// NotificationMentioned is the notification staff get when a note mentions
+// them
+const NotificationMentioned = "note_mention"
+
+// mentionPattern matches @ followed by the email of a staff member or the
+// part of it before the @
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.+-]+(?:@[\w-]+(?:\.[\w-]+)+)?)`)
+
+// likeEscaper escapes the LIKE wildcards of a mention
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Note is a staff note on a customer or an order
+type Note struct {
+	ID        uint64
+	Subject   domain.NoteSubject
+	SubjectID uint64 // Customer or order ID
+	StaffID   uint64
+	Staff     *domain.User
+	Text      string
+	Pinned    bool
+	Edits     int64 // Number of earlier versions kept
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Service manages staff notes
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new note service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// List returns the notes of a customer or order, pinned notes first and
+// then the newest first
+func (s *Service) List(subject domain.NoteSubject, subjectID uint64) ([]Note, error) {
+	return s.list(subject, subjectID, false)
+}
+
+// Pinned returns the pinned notes of a customer or order, newest first
+func (s *Service) Pinned(subject domain.NoteSubject, subjectID uint64) ([]Note, error) {
+	return s.list(subject, subjectID, true)
+}
+
+func (s *Service) list(subject domain.NoteSubject, subjectID uint64, pinnedOnly bool) ([]Note, error) {
+	var notes []Note
+	switch subject {
+	case domain.NoteSubjectCustomer:
+		query := s.db.Preload("Staff").Where("customer_id = ?", subjectID)
+		if pinnedOnly {
+			query = query.Where("sticky = ?", true)
+		}
+		var rows []domain.AdminNote
+		if err := query.Order("sticky DESC").Order("created_at DESC").Order("id DESC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			notes = append(notes, fromAdminNote(&rows[i]))
+		}
+	case domain.NoteSubjectOrder:
+		query := s.db.Preload("Staff").Where("order_id = ?", subjectID)
+		if pinnedOnly {
+			query = query.Where("sticky = ?", true)
+		}
+		var rows []domain.OrderNote
+		if err := query.Order("sticky DESC").Order("created_at DESC").Order("id DESC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			notes = append(notes, fromOrderNote(&rows[i]))
+		}
+	default:
+		return nil, ErrInvalidSubject
+	}
+	if err := s.countEdits(subject, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// Get returns a note of a customer or order
+func (s *Service) Get(subject domain.NoteSubject, subjectID, id uint64) (*Note, error) {
+	var note Note
+	switch subject {
+	case domain.NoteSubjectCustomer:
+		var row domain.AdminNote
+		result := s.db.Preload("Staff").Where("customer_id = ?", subjectID).Limit(1).Find(&row, id)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrNoteNotFound
+		}
+		note = fromAdminNote(&row)
+	case domain.NoteSubjectOrder:
+		var row domain.OrderNote
+		result := s.db.Preload("Staff").Where("order_id = ?", subjectID).Limit(1).Find(&row, id)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrNoteNotFound
+		}
+		note = fromOrderNote(&row)
+	default:
+		return nil, ErrInvalidSubject
+	}
+
+	notes := []Note{note}
+	if err := s.countEdits(subject, notes); err != nil {
+		return nil, err
+	}
+	return &notes[0], nil
+}
+
+// Add writes a note on a customer or order and notifies the staff it
+// mentions
+func (s *Service) Add(subject domain.NoteSubject, subjectID, staffID uint64, text string, pinned bool) (*Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrNoteRequired
+	}
+
+	var id uint64
+	switch subject {
+	case domain.NoteSubjectCustomer:
+		if err := s.exists(&domain.User{}, "id = ? AND role = ?", subjectID, domain.UserRoleCustomer); err != nil {
+			return nil, err
+		}
+		row := &domain.AdminNote{CustomerID: subjectID, StaffID: staffID, Note: text, Sticky: pinned}
+		if err := s.db.Create(row).Error; err != nil {
+			return nil, err
+		}
+		id = row.ID
+	case domain.NoteSubjectOrder:
+		if err := s.exists(&domain.Order{}, "id = ?", subjectID); err != nil {
+			return nil, err
+		}
+		row := &domain.OrderNote{OrderID: subjectID, StaffID: staffID, Note: text, Sticky: pinned}
+		if err := s.db.Create(row).Error; err != nil {
+			return nil, err
+		}
+		id = row.ID
+	default:
+		return nil, ErrInvalidSubject
+	}
+
+	note, err := s.Get(subject, subjectID, id)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyMentions(note, text, "")
+	return note, nil
+}
+
+// Edit replaces the text of a note, keeping the previous text in its
+// history. Staff mentioned for the first time are notified.
+func (s *Service) Edit(subject domain.NoteSubject, subjectID, id, staffID uint64, text string) (*Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrNoteRequired
+	}
+	note, err := s.Get(subject, subjectID, id)
+	if err != nil {
+		return nil, err
+	}
+	if note.Text == text {
+		return note, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&domain.NoteRevision{
+			Subject:  subject,
+			NoteID:   id,
+			Note:     note.Text,
+			EditedBy: staffID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(noteModel(subject)).Where("id = ?", id).Update("note", text).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	previous := note.Text
+	if note, err = s.Get(subject, subjectID, id); err != nil {
+		return nil, err
+	}
+	s.notifyMentions(note, text, previous)
+	return note, nil
+}
+
+// SetPinned pins a note to the top of its record or unpins it
+func (s *Service) SetPinned(subject domain.NoteSubject, subjectID, id uint64, pinned bool) (*Note, error) {
+	if _, err := s.Get(subject, subjectID, id); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(noteModel(subject)).Where("id = ?", id).Update("sticky", pinned).Error; err != nil {
+		return nil, err
+	}
+	return s.Get(subject, subjectID, id)
+}
+
+// Delete removes a note with its history
+func (s *Service) Delete(subject domain.NoteSubject, subjectID, id uint64) error {
+	if _, err := s.Get(subject, subjectID, id); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subject = ? AND note_id = ?", subject, id).Delete(&domain.NoteRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(noteModel(subject), id).Error
+	})
+}
+
+// History returns the earlier versions of a note, newest first
+func (s *Service) History(subject domain.NoteSubject, subjectID, id uint64) ([]domain.NoteRevision, error) {
+	if _, err := s.Get(subject, subjectID, id); err != nil {
+		return nil, err
+	}
+	var revisions []domain.NoteRevision
+	err := s.db.Preload("Editor").Where("subject = ? AND note_id = ?", subject, id).
+		Order("created_at DESC").Order("id DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// Mentions returns the active staff members mentioned in a text. A mention
+// is @ followed by the email of a staff member or the part before its @.
+func (s *Service) Mentions(text string) ([]domain.User, error) {
+	handles := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handles[strings.ToLower(strings.TrimRight(match[1], "."))] = true
+	}
+	if len(handles) == 0 {
+		return nil, nil
+	}
+
+	conditions := make([]string, 0, len(handles))
+	args := make([]interface{}, 0, len(handles))
+	for handle := range handles {
+		if strings.Contains(handle, "@") {
+			conditions = append(conditions, "LOWER(email) = ?")
+			args = append(args, handle)
+		} else {
+			conditions = append(conditions, `LOWER(email) LIKE ? ESCAPE '\'`)
+			args = append(args, likeEscaper.Replace(handle)+"@%")
+		}
+	}
+
+	var staff []domain.User
+	err := s.db.Where("role IN ? AND status = ?", []domain.UserRole{domain.UserRoleAdmin, domain.UserRoleStaff}, domain.UserStatusActive).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Order("id").Find(&staff).Error
+	return staff, err
+}
+
+// notifyMentions notifies the staff mentioned in a note and not in its
+// previous text, except its author
+func (s *Service) notifyMentions(note *Note, text, previous string) {
+	mentioned, err := s.Mentions(text)
+	if err != nil {
+		log.Printf("failed to find the staff mentioned in %s note %d: %v", note.Subject, note.ID, err)
+		return
+	}
+	if len(mentioned) == 0 {
+		return
+	}
+	already := make(map[uint64]bool)
+	if previous != "" {
+		before, err := s.Mentions(previous)
+		if err != nil {
+			log.Printf("failed to find the staff mentioned in %s note %d: %v", note.Subject, note.ID, err)
+			return
+		}
+		for _, user := range before {
+			already[user.ID] = true
+		}
+	}
+
+	author := "A staff member"
+	if note.Staff != nil {
+		author = note.Staff.FullName()
+	}
+	title := fmt.Sprintf("%s mentioned you on %s #%d", author, note.Subject, note.SubjectID)
+	link := fmt.Sprintf("/admin/%ss?id=%d", note.Subject, note.SubjectID)
+	notifier := notification.NewService(s.db)
+	for _, user := range mentioned {
+		if user.ID == note.StaffID || already[user.ID] {
+			continue
+		}
+		if err := notifier.SendNotification(user.ID, NotificationMentioned, title, excerpt(text), link); err != nil {
+			log.Printf("failed to notify staff %d of %s note %d: %v", user.ID, note.Subject, note.ID, err)
+		}
+	}
+}
+
+func (s *Service) exists(model interface{}, query string, args ...interface{}) error {
+	var count int64
+	if err := s.db.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSubjectNotFound
+	}
+	return nil
+}
+
+// countEdits sets the number of earlier versions of the notes
+func (s *Service) countEdits(subject domain.NoteSubject, notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+	var counts []struct {
+		NoteID uint64
+		Edits  int64
+	}
+	if err := s.db.Model(&domain.NoteRevision{}).Select("note_id, COUNT(*) AS edits").
+		Where("subject = ? AND note_id IN ?", subject, ids).
+		Group("note_id").Scan(&counts).Error; err != nil {
+		return err
+	}
+	edits := make(map[uint64]int64, len(counts))
+	for _, count := range counts {
+		edits[count.NoteID] = count.Edits
+	}
+	for i := range notes {
+		notes[i].Edits = edits[notes[i].ID]
+	}
+	return nil
+}
+
+func noteModel(subject domain.NoteSubject) interface{} {
+	if subject == domain.NoteSubjectOrder {
+		return &domain.OrderNote{}
+	}
+	return &domain.AdminNote{}
+}
+
+func fromAdminNote(n *domain.AdminNote) Note {
+	return Note{
+		ID:        n.ID,
+		Subject:   domain.NoteSubjectCustomer,
+		SubjectID: n.CustomerID,
+		StaffID:   n.StaffID,
+		Staff:     staffOf(n.Staff),
+		Text:      n.Note,
+		Pinned:    n.Sticky,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
+
+func fromOrderNote(n *domain.OrderNote) Note {
+	return Note{
+		ID:        n.ID,
+		Subject:   domain.NoteSubjectOrder,
+		SubjectID: n.OrderID,
+		StaffID:   n.StaffID,
+		Staff:     staffOf(n.Staff),
+		Text:      n.Note,
+		Pinned:    n.Sticky,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
+
+func staffOf(user domain.User) *domain.User {
+	if user.ID == 0 {
+		return nil
+	}
+	return &user
+}
+
+// excerpt shortens a note for a notification
+func excerpt(text string) string {
+	const max = 200
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max]) + "…"
+}
@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// attachment is a file sent with an email
+type attachment struct {
+	fileName    string
+	contentType string
+	data        []byte
+}
+
+// SetInvoiceRenderer attaches the PDF of invoices to the emails about
+// them. Without a renderer those emails go out without the PDF.
+func (s *Service) SetInvoiceRenderer(renderer domain.InvoiceRenderer) {
+	s.invoices = renderer
+}
+
+// invoiceAttachments returns the attachments of an email carrying the PDF
+// of an invoice
+func invoiceAttachments(invoiceID uint64) domain.JSONMap {
+	return domain.JSONMap{domain.AttachmentInvoicePDF: []uint64{invoiceID}}
+}
+
+// mergeAttachments gathers the attachments of the items of a digest
+func mergeAttachments(items []domain.EmailDigestItem) domain.JSONMap {
+	var ids []uint64
+	for _, item := range items {
+		ids = append(ids, attachmentIDs(item.Attachments, domain.AttachmentInvoicePDF)...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return domain.JSONMap{domain.AttachmentInvoicePDF: ids}
+}
+
+// attachmentIDs returns the IDs held under a key of attachments, which
+// read back from the database as JSON numbers
+func attachmentIDs(attachments domain.JSONMap, key string) []uint64 {
+	var ids []uint64
+	switch values := attachments[key].(type) {
+	case []uint64:
+		ids = values
+	case []any:
+		for _, value := range values {
+			if id, ok := value.(float64); ok && id > 0 {
+				ids = append(ids, uint64(id))
+			}
+		}
+	}
+	return ids
+}
+
+// renderAttachments renders the documents attached to a queued email.
+// Invoices deleted since it was queued are left out.
+func (s *Service) renderAttachments(email *domain.EmailQueue) ([]attachment, error) {
+	ids := attachmentIDs(email.Attachments, domain.AttachmentInvoicePDF)
+	if len(ids) == 0 || s.invoices == nil {
+		return nil, nil
+	}
+
+	attachments := make([]attachment, 0, len(ids))
+	for _, id := range ids {
+		var invoice domain.Invoice
+		err := s.db.Preload("LineItems").Preload("Taxes").Preload("Customer").First(&invoice, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("email %d: invoice %d to attach no longer exists", email.ID, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.invoices.RenderInvoice(&invoice, invoice.Customer.Language)
+		if err != nil {
+			return nil, fmt.Errorf("render invoice %d: %w", id, err)
+		}
+		attachments = append(attachments, attachment{
+			fileName:    attachmentFileName(invoice.InvoiceNumber, ".pdf"),
+			contentType: "application/pdf",
+			data:        data,
+		})
+	}
+	return attachments, nil
+}
+
+// attachmentFileName keeps the characters of a name that are safe in file
+// names on every system
+func attachmentFileName(name, extension string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == "" {
+		safe = "attachment"
+	}
+	return safe + extension
+}
+
+// writeAttachment writes a file as a base64 encoded part of a multipart
+// message, in lines of 76 characters
+func writeAttachment(buf *bytes.Buffer, boundary string, file attachment) {
+	buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	buf.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", file.contentType, file.fileName))
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString(fmt.Sprintf("Content-Disposition: %s\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": file.fileName})))
+	buf.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString(file.data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
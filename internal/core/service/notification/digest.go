@@ -0,0 +1,287 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidCategory  = errors.New("category must be announcement, knowledge_base, marketing or billing")
+	ErrInvalidFrequency = errors.New("frequency must be immediate, daily or weekly")
+)
+
+// digestHour is the hour of the day, in UTC, digests are sent. Weekly
+// digests go out on Mondays.
+const digestHour = 8
+
+// EmailFrequencies returns how often a user gets the emails of each
+// category
+func (s *Service) EmailFrequencies(userID uint64) (map[domain.EmailCategory]domain.EmailFrequency, error) {
+	var prefs []domain.EmailDigestPreference
+	if err := s.db.Where("user_id = ?", userID).Find(&prefs).Error; err != nil {
+		return nil, err
+	}
+
+	frequencies := make(map[domain.EmailCategory]domain.EmailFrequency, len(domain.EmailCategories))
+	for _, category := range domain.EmailCategories {
+		frequencies[category] = domain.EmailFrequencyImmediate
+	}
+	for _, pref := range prefs {
+		frequencies[pref.Category] = pref.Frequency
+	}
+	return frequencies, nil
+}
+
+// SetEmailFrequency changes how often a user gets the emails of a
+// category. Emails already held back move to the next digest of the new
+// frequency, or go out with the next run when sent at once; they are
+// dropped when the user unsubscribes.
+func (s *Service) SetEmailFrequency(userID uint64, category domain.EmailCategory, frequency domain.EmailFrequency) error {
+	if !category.Valid() {
+		return ErrInvalidCategory
+	}
+	if !frequency.Valid() {
+		return ErrInvalidFrequency
+	}
+	if frequency == domain.EmailFrequencyNever && !category.CanOptOut() {
+		return ErrCannotOptOut
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		pref := domain.EmailDigestPreference{UserID: userID, Category: category}
+		if err := tx.Where("user_id = ? AND category = ?", userID, category).
+			Assign(domain.EmailDigestPreference{Frequency: frequency}).FirstOrCreate(&pref).Error; err != nil {
+			return err
+		}
+		if frequency == domain.EmailFrequencyNever {
+			return tx.Where("user_id = ? AND category = ? AND sent_at IS NULL", userID, category).
+				Delete(&domain.EmailDigestItem{}).Error
+		}
+		return tx.Model(&domain.EmailDigestItem{}).
+			Where("user_id = ? AND category = ? AND sent_at IS NULL", userID, category).
+			Update("due_at", nextDigest(time.Now(), frequency)).Error
+	})
+}
+
+// SendCategoryEmail emails a user using the template in their language,
+// at once or in their next digest depending on how often they get the
+// emails of the category
+func (s *Service) SendCategoryEmail(userID uint64, category domain.EmailCategory, templateType string, data map[string]interface{}) error {
+	return s.sendCategoryEmail(userID, category, templateType, data, nil)
+}
+
+// sendCategoryEmail emails a user using a template, with attachments that
+// go out with the digest when the email is held for it
+func (s *Service) sendCategoryEmail(userID uint64, category domain.EmailCategory, templateType string, data map[string]interface{}, attachments domain.JSONMap) error {
+	var user domain.User
+	if err := s.db.Select("id", "language").Limit(1).Find(&user, userID).Error; err != nil {
+		return err
+	}
+	rendered, err := s.renderTemplate(templateType, user.Language, data)
+	if err != nil {
+		return err
+	}
+	return s.queueCategoryEmail(userID, category, &rendered.templateID, rendered.subject, rendered.bodyHTML, rendered.bodyPlain, attachments)
+}
+
+// QueueCategoryEmail emails a user at once, or holds the email for their
+// next digest when they get the emails of the category less often. Emails
+// of a category the user unsubscribed from are queued and then skipped, so
+// staff can see why they were not sent.
+func (s *Service) QueueCategoryEmail(userID uint64, category domain.EmailCategory, subject, bodyHTML, bodyPlain string) error {
+	return s.queueCategoryEmail(userID, category, nil, subject, bodyHTML, bodyPlain, nil)
+}
+
+// queueCategoryEmail queues a category email, keeping the template it was
+// rendered from when sent at once. Digests have no template.
+func (s *Service) queueCategoryEmail(userID uint64, category domain.EmailCategory, templateID *uint64, subject, bodyHTML, bodyPlain string, attachments domain.JSONMap) error {
+	var pref domain.EmailDigestPreference
+	result := s.db.Where("user_id = ? AND category = ?", userID, category).Limit(1).Find(&pref)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 || pref.Frequency == domain.EmailFrequencyImmediate || pref.Frequency == domain.EmailFrequencyNever {
+		var user domain.User
+		if err := s.db.Select("id", "email", "first_name", "last_name").First(&user, userID).Error; err != nil {
+			return err
+		}
+		var smtp domain.SMTPConfig
+		if err := s.db.Where("active = ? AND \"default\" = ?", true, true).First(&smtp).Error; err != nil {
+			return ErrSMTPNotConfigured
+		}
+		email, err := newCategoryEmail(smtp.ID, &user, []domain.EmailCategory{category}, subject, bodyHTML, bodyPlain)
+		if err != nil {
+			return err
+		}
+		email.TemplateID = templateID
+		email.Attachments = attachments
+		return s.db.Create(email).Error
+	}
+
+	return s.db.Create(&domain.EmailDigestItem{
+		UserID:      userID,
+		Category:    category,
+		Subject:     subject,
+		BodyHTML:    bodyHTML,
+		BodyPlain:   bodyPlain,
+		Attachments: attachments,
+		DueAt:       nextDigest(time.Now(), pref.Frequency),
+	}).Error
+}
+
+// EmailCustomers emails every active customer, at once or in their
+// digest. It returns how many customers were emailed or had the email held
+// for their digest.
+func (s *Service) EmailCustomers(category domain.EmailCategory, subject, bodyHTML, bodyPlain string) (int, error) {
+	var userIDs []uint64
+	if err := s.db.Model(&domain.User{}).
+		Where("role = ? AND status = ?", domain.UserRoleCustomer, domain.UserStatusActive).
+		Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		if err := s.QueueCategoryEmail(userID, category, subject, bodyHTML, bodyPlain); err != nil {
+			if errors.Is(err, ErrSMTPNotConfigured) {
+				return sent, err
+			}
+			log.Printf("failed to email customer %d: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// CompileDigests queues one email per user holding the emails due for
+// their digest. It returns how many digests were queued.
+func (s *Service) CompileDigests(now time.Time) (int, error) {
+	var userIDs []uint64
+	if err := s.db.Model(&domain.EmailDigestItem{}).
+		Where("sent_at IS NULL AND due_at <= ?", now).
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	var smtp domain.SMTPConfig
+	if err := s.db.Where("active = ? AND \"default\" = ?", true, true).First(&smtp).Error; err != nil {
+		return 0, ErrSMTPNotConfigured
+	}
+
+	queued := 0
+	for _, userID := range userIDs {
+		var user domain.User
+		if err := s.db.Select("id", "email", "first_name", "last_name").First(&user, userID).Error; err != nil {
+			log.Printf("failed to load user %d for email digest: %v", userID, err)
+			continue
+		}
+
+		var items []domain.EmailDigestItem
+		if err := s.db.Where("user_id = ? AND sent_at IS NULL AND due_at <= ?", userID, now).
+			Order("category, created_at").Find(&items).Error; err != nil {
+			return queued, err
+		}
+		subject, bodyHTML, bodyPlain := buildDigest(items)
+		var categories []domain.EmailCategory
+		for _, item := range items {
+			if len(categories) == 0 || categories[len(categories)-1] != item.Category {
+				categories = append(categories, item.Category)
+			}
+		}
+		email, err := newCategoryEmail(smtp.ID, &user, categories, subject, bodyHTML, bodyPlain)
+		if err != nil {
+			return queued, err
+		}
+		email.Attachments = mergeAttachments(items)
+
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(email).Error; err != nil {
+				return err
+			}
+			ids := make([]uint64, 0, len(items))
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			return tx.Model(&domain.EmailDigestItem{}).Where("id IN ?", ids).Update("sent_at", now).Error
+		})
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// MonitorDigests compiles due email digests on the given interval
+func (s *Service) MonitorDigests(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.CompileDigests(time.Now()); err != nil && !errors.Is(err, ErrSMTPNotConfigured) {
+			log.Printf("failed to compile email digests: %v", err)
+		} else if n > 0 {
+			log.Printf("queued %d email digest(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextDigest returns when the next digest of a frequency is sent. Emails
+// sent at once are due right away.
+func nextDigest(now time.Time, frequency domain.EmailFrequency) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), digestHour, 0, 0, 0, time.UTC)
+	switch frequency {
+	case domain.EmailFrequencyDaily:
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+	case domain.EmailFrequencyWeekly:
+		next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 7)
+		}
+	default:
+		return now
+	}
+	return next
+}
+
+// buildDigest puts the held back emails of a user into one email
+func buildDigest(items []domain.EmailDigestItem) (string, string, string) {
+	subject := fmt.Sprintf("Your email digest: %d update(s)", len(items))
+	if len(items) == 1 {
+		subject = items[0].Subject
+	}
+
+	var htmlBody, plainBody strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			htmlBody.WriteString("<hr>\n")
+			plainBody.WriteString("\n----\n\n")
+		}
+		fmt.Fprintf(&htmlBody, "<h2>%s</h2>\n%s\n", html.EscapeString(item.Subject), item.BodyHTML)
+		fmt.Fprintf(&plainBody, "%s\n\n%s\n", item.Subject, item.BodyPlain)
+	}
+	return subject, htmlBody.String(), plainBody.String()
+}
@@ -0,0 +1,341 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidDomain        = errors.New("invalid domain")
+	ErrInvalidSelector      = errors.New("selector must be letters, digits and hyphens")
+	ErrInvalidReturnPath    = errors.New("return path must be an email address")
+	ErrDKIMKeyNotFound      = errors.New("DKIM key not found")
+	ErrSMTPConfigNotFound   = errors.New("SMTP configuration not found")
+	errInvalidMessageFormat = errors.New("message has no header")
+)
+
+// dkimKeyBits is the size of generated DKIM keys
+const dkimKeyBits = 2048
+
+// dkimSignedHeaders are the headers signed when present, in order
+var dkimSignedHeaders = []string{
+	"from", "to", "subject", "date", "mime-version", "content-type",
+	"auto-submitted", "list-unsubscribe", "list-unsubscribe-post",
+}
+
+var (
+	domainPattern   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+	selectorPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	whitespaceRun   = regexp.MustCompile(`[ \t]+`)
+)
+
+// lookupTXT resolves the TXT records the DNS check reads
+var lookupTXT = net.DefaultResolver.LookupTXT
+
+// GenerateDKIMKey creates the DKIM key of a sending domain. A domain that
+// already has a key gets a new one, which must be published again.
+func (s *Service) GenerateDKIMKey(sendingDomain, selector string) (*domain.DKIMKey, error) {
+	sendingDomain = strings.ToLower(strings.TrimSpace(sendingDomain))
+	selector = strings.ToLower(strings.TrimSpace(selector))
+	if !domainPattern.MatchString(sendingDomain) {
+		return nil, ErrInvalidDomain
+	}
+	if !selectorPattern.MatchString(selector) {
+		return nil, ErrInvalidSelector
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, dkimKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := domain.DKIMKey{Domain: sendingDomain}
+	if err := s.db.Where("domain = ?", sendingDomain).
+		Assign(domain.DKIMKey{
+			Selector: selector,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+			})),
+			PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+			Active:    true,
+		}).FirstOrCreate(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListDKIMKeys returns the DKIM keys of every sending domain
+func (s *Service) ListDKIMKeys() ([]domain.DKIMKey, error) {
+	var keys []domain.DKIMKey
+	err := s.db.Order("domain").Find(&keys).Error
+	return keys, err
+}
+
+// DeleteDKIMKey stops signing the email of a domain
+func (s *Service) DeleteDKIMKey(id uint64) error {
+	result := s.db.Delete(&domain.DKIMKey{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDKIMKeyNotFound
+	}
+	return nil
+}
+
+// SetReturnPath sets the address bounces of an SMTP configuration go to.
+// An empty address sends them to its from address.
+func (s *Service) SetReturnPath(smtpConfigID uint64, returnPath string) error {
+	returnPath = strings.TrimSpace(returnPath)
+	if returnPath != "" {
+		at := strings.LastIndex(returnPath, "@")
+		if at < 1 || !domainPattern.MatchString(strings.ToLower(returnPath[at+1:])) {
+			return ErrInvalidReturnPath
+		}
+	}
+
+	result := s.db.Model(&domain.SMTPConfig{}).Where("id = ?", smtpConfigID).Update("return_path", returnPath)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSMTPConfigNotFound
+	}
+	return nil
+}
+
+// dkimKeyFor returns the active DKIM key of the domain of a from address,
+// or nil when the domain has none
+func (s *Service) dkimKeyFor(fromEmail string) (*domain.DKIMKey, error) {
+	at := strings.LastIndex(fromEmail, "@")
+	if at < 0 {
+		return nil, nil
+	}
+	var key domain.DKIMKey
+	err := s.db.Where("domain = ? AND active = ?", strings.ToLower(fromEmail[at+1:]), true).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// signDKIM prepends a DKIM-Signature header (RFC 6376) to a message, using
+// relaxed canonicalization of the header and body
+func signDKIM(message []byte, key *domain.DKIMKey, now time.Time) ([]byte, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("DKIM key of %s is not PEM encoded", key.Domain)
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// SMTP sends lines ending in CRLF, so sign them that way
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	message = bytes.ReplaceAll(message, []byte("\n"), []byte("\r\n"))
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, errInvalidMessageFormat
+	}
+	fields := headerFields(string(message[:end+2]))
+	body := string(message[end+4:])
+
+	bodyHash := sha256.Sum256([]byte(relaxedBody(body)))
+
+	var signed []string
+	var canonical strings.Builder
+	for _, name := range dkimSignedHeaders {
+		if value, ok := fields[name]; ok {
+			signed = append(signed, name)
+			canonical.WriteString(relaxedHeader(name, value))
+		}
+	}
+
+	signature := fmt.Sprintf("v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		key.Domain, key.Selector, now.Unix(), strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	canonical.WriteString(strings.TrimSuffix(relaxedHeader("dkim-signature", signature), "\r\n"))
+
+	digest := sha256.Sum256([]byte(canonical.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	header := "DKIM-Signature: " + signature + base64.StdEncoding.EncodeToString(sig) + "\r\n"
+	return append([]byte(header), message...), nil
+}
+
+// headerFields returns the unfolded header fields of a message by lower
+// case name. The last field of a name wins, as DKIM signs fields from the
+// bottom up.
+func headerFields(header string) map[string]string {
+	fields := make(map[string]string)
+	var name string
+	for _, line := range strings.Split(strings.TrimSuffix(header, "\r\n"), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && name != "" {
+			fields[name] += line
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(line[:colon]))
+		fields[name] = line[colon+1:]
+	}
+	return fields
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed algorithm
+func relaxedHeader(name, value string) string {
+	value = whitespaceRun.ReplaceAllString(value, " ")
+	return strings.ToLower(name) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm
+func relaxedBody(body string) string {
+	lines := strings.Split(body, "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(whitespaceRun.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// DNS check statuses
+const (
+	DNSStatusOK       = "ok"
+	DNSStatusMissing  = "missing"
+	DNSStatusInvalid  = "invalid"
+	DNSStatusMismatch = "mismatch"
+	DNSStatusError    = "error"
+)
+
+// DNSRecordCheck is the result of checking one DNS record
+type DNSRecordCheck struct {
+	Name     string
+	Status   string
+	Record   string
+	Expected string
+	Message  string
+}
+
+// DNSCheck is the result of checking the email DNS records of a domain
+type DNSCheck struct {
+	Domain string
+	SPF    DNSRecordCheck
+	DKIM   DNSRecordCheck
+	DMARC  DNSRecordCheck
+}
+
+// CheckDNS verifies the SPF, DKIM and DMARC records of a sending domain.
+// The DKIM record must publish the key the domain's email is signed with.
+func (s *Service) CheckDNS(ctx context.Context, sendingDomain string) (*DNSCheck, error) {
+	sendingDomain = strings.ToLower(strings.TrimSpace(sendingDomain))
+	if !domainPattern.MatchString(sendingDomain) {
+		return nil, ErrInvalidDomain
+	}
+
+	check := &DNSCheck{Domain: sendingDomain}
+
+	check.SPF = checkTXT(ctx, sendingDomain, "v=spf1")
+	if check.SPF.Status == DNSStatusMissing {
+		check.SPF.Message = "no SPF record; receivers cannot tell which servers may send for the domain"
+	}
+
+	check.DMARC = checkTXT(ctx, "_dmarc."+sendingDomain, "v=DMARC1")
+	if check.DMARC.Status == DNSStatusMissing {
+		check.DMARC.Message = "no DMARC record; receivers apply their own policy to failing email"
+	}
+
+	var key domain.DKIMKey
+	err := s.db.Where("domain = ?", sendingDomain).First(&key).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		check.DKIM = DNSRecordCheck{Status: DNSStatusMissing, Message: "no DKIM key generated for the domain"}
+	case err != nil:
+		return nil, err
+	default:
+		check.DKIM = checkTXT(ctx, key.DNSName(), "v=DKIM1")
+		check.DKIM.Expected = key.DNSRecord()
+		if check.DKIM.Status == DNSStatusOK && dkimPublicKey(check.DKIM.Record) != key.PublicKey {
+			check.DKIM.Status = DNSStatusMismatch
+			check.DKIM.Message = "the published key is not the key email is signed with"
+		}
+	}
+	return check, nil
+}
+
+// checkTXT looks up the one TXT record of a name starting with prefix
+func checkTXT(ctx context.Context, name, prefix string) DNSRecordCheck {
+	result := DNSRecordCheck{Name: name}
+	records, err := lookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		result.Status = DNSStatusError
+		result.Message = err.Error()
+		return result
+	}
+
+	var matching []string
+	for _, record := range records {
+		if strings.HasPrefix(strings.ToLower(record), strings.ToLower(prefix)) {
+			matching = append(matching, record)
+		}
+	}
+	switch len(matching) {
+	case 0:
+		result.Status = DNSStatusMissing
+	case 1:
+		result.Status = DNSStatusOK
+		result.Record = matching[0]
+	default:
+		result.Status = DNSStatusInvalid
+		result.Record = strings.Join(matching, "\n")
+		result.Message = fmt.Sprintf("%d records found, there must be one", len(matching))
+	}
+	return result
+}
+
+// dkimPublicKey returns the p= tag of a DKIM record
+func dkimPublicKey(record string) string {
+	for _, tag := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(tag), "=")
+		if ok && strings.TrimSpace(name) == "p" {
+			return whitespaceRun.ReplaceAllString(strings.TrimSpace(value), "")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package notification
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Webhook events raised when records are created, whichever way they were
+// created. Automation platforms subscribe to them as triggers.
+const (
+	EventCustomerCreated = "customer.created"
+	EventTicketCreated   = "ticket.created"
+	EventCreditAdded     = "credit.added"
+	EventInvoiceCreated  = "invoice.created"
+)
+
+// EventCustomerHealthDropped is raised when the health score of a customer
+// drops enough to alert staff
+const EventCustomerHealthDropped = "customer.health_dropped"
+
+
+// CustomerCreated queues the customer.created webhooks
+func (s *Service) CustomerCreated(user *domain.User) error {
+	return s.TriggerWebhooks(EventCustomerCreated, NewCustomerEvent(user))
+}
+
+// TicketCreated queues the ticket.created webhooks
+func (s *Service) TicketCreated(ticket *domain.Ticket) error {
+	return s.TriggerWebhooks(EventTicketCreated, NewTicketEvent(ticket))
+}
+
+// CreditAdded queues the credit.added webhooks
+func (s *Service) CreditAdded(adjustment *domain.CreditAdjustment) error {
+	return s.TriggerWebhooks(EventCreditAdded, NewCreditEvent(adjustment))
+}
+
+// InvoiceCreated queues the invoice.created webhooks and emails the
+// customer the invoice with its PDF, at once or in their billing digest.
+// A failed email is logged rather than failing the invoice.
+func (s *Service) InvoiceCreated(invoice *domain.Invoice) error {
+	err := s.sendCategoryEmail(invoice.CustomerID, domain.EmailCategoryBilling, string(domain.EmailTypeInvoiceCreated), invoiceEmailData(invoice), invoiceAttachments(invoice.ID))
+	if err != nil && !errors.Is(err, ErrTemplateNotFound) && !errors.Is(err, ErrSMTPNotConfigured) {
+		log.Printf("failed to email invoice %d: %v", invoice.ID, err)
+	}
+	return s.TriggerWebhooks(EventInvoiceCreated, NewInvoiceEvent(invoice))
+}
+
+// invoiceEmailData returns the template data of an invoice
+func invoiceEmailData(invoice *domain.Invoice) map[string]interface{} {
+	data := map[string]interface{}{
+		"InvoiceID":     invoice.ID,
+		"InvoiceNumber": invoice.InvoiceNumber,
+		"Currency":      invoice.Currency,
+		"Total":         invoice.Total.StringFixed(2),
+		"AmountPaid":    invoice.AmountPaid.StringFixed(2),
+		"DueDate":       invoice.DueDate.Format("2006-01-02"),
+	}
+	if invoice.PaidAt != nil {
+		data["PaidDate"] = invoice.PaidAt.Format("2006-01-02")
+	}
+	return data
+}
+
+// CustomerHealthDropped queues the customer.health_dropped webhooks
+func (s *Service) CustomerHealthDropped(user *domain.User, health *domain.CustomerHealth, previous int) error {
+	return s.TriggerWebhooks(EventCustomerHealthDropped, NewCustomerHealthEvent(user, health, previous))
+}
+
+// NewCustomerEvent builds the customer.created payload
+func NewCustomerEvent(user *domain.User) CustomerEvent {
+	return CustomerEvent{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Company:   user.Company,
+		Phone:     user.Phone,
+		Country:   user.Country,
+		Currency:  user.Currency,
+		CreatedAt: user.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewTicketEvent builds the ticket.created payload
+func NewTicketEvent(ticket *domain.Ticket) TicketEvent {
+	event := TicketEvent{
+		ID:         ticket.ID,
+		CustomerID: ticket.CustomerID,
+		Subject:    ticket.Subject,
+		Status:     string(ticket.Status),
+		Priority:   string(ticket.Priority),
+		Source:     ticket.Source,
+		CreatedAt:  ticket.CreatedAt.Format(time.RFC3339),
+	}
+	if len(ticket.Messages) > 0 {
+		event.Email = ticket.Messages[0].SenderEmail
+		event.Message = ticket.Messages[0].Body
+	}
+	return event
+}
+
+// NewCreditEvent builds the credit.added payload
+func NewCreditEvent(adjustment *domain.CreditAdjustment) CreditEvent {
+	return CreditEvent{
+		ID:         adjustment.ID,
+		CustomerID: adjustment.CustomerID,
+		Amount:     adjustment.Amount.String(),
+		Currency:   adjustment.Currency,
+		Reason:     adjustment.Reason,
+		Balance:    adjustment.BalanceAfter.String(),
+		CreatedAt:  adjustment.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewInvoiceEvent builds the invoice.created payload
+func NewInvoiceEvent(invoice *domain.Invoice) InvoiceEvent {
+	return InvoiceEvent{
+		ID:            invoice.ID,
+		CustomerID:    invoice.CustomerID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		Status:        string(invoice.Status),
+		Currency:      invoice.Currency,
+		Total:         invoice.Total.String(),
+		Balance:       invoice.Balance.String(),
+		DueDate:       invoice.DueDate.Format(time.RFC3339),
+		CreatedAt:     invoice.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewCustomerHealthEvent builds the customer.health_dropped payload
+func NewCustomerHealthEvent(user *domain.User, health *domain.CustomerHealth, previous int) CustomerHealthEvent {
+	flags := []string(health.Flags)
+	if flags == nil {
+		flags = []string{}
+	}
+	return CustomerHealthEvent{
+		CustomerID:       user.ID,
+		Email:            user.Email,
+		Name:             user.FullName(),
+		AccountManagerID: user.AccountManagerID,
+		Score:            health.Score,
+		PreviousScore:    previous,
+		Risk:             string(health.Risk),
+		Flags:            flags,
+		ComputedAt:       health.ComputedAt.Format(time.RFC3339),
+	}
+}
+
+// CustomerEvent is the payload of customer.created
+type CustomerEvent struct {
+	ID        uint64 `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Company   string `json:"company"`
+	Phone     string `json:"phone"`
+	Country   string `json:"country"`
+	Currency  string `json:"currency"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TicketEvent is the payload of ticket.created
+type TicketEvent struct {
+	ID         uint64  `json:"id"`
+	CustomerID *uint64 `json:"customer_id"`
+	Email      string  `json:"email"`
+	Subject    string  `json:"subject"`
+	Message    string  `json:"message"`
+	Status     string  `json:"status"`
+	Priority   string  `json:"priority"`
+	Source     string  `json:"source"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// CreditEvent is the payload of credit.added
+type CreditEvent struct {
+	ID         uint64 `json:"id"`
+	CustomerID uint64 `json:"customer_id"`
+	Amount     string `json:"amount"`
+	Currency   string `json:"currency"`
+	Reason     string `json:"reason"`
+	Balance    string `json:"balance"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// InvoiceEvent is the payload of invoice.created
+type InvoiceEvent struct {
+	ID            uint64 `json:"id"`
+	CustomerID    uint64 `json:"customer_id"`
+	InvoiceNumber string `json:"invoice_number"`
+	Status        string `json:"status"`
+	Currency      string `json:"currency"`
+	Total         string `json:"total"`
+	Balance       string `json:"balance"`
+	DueDate       string `json:"due_date"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// CustomerHealthEvent is the payload of customer.health_dropped
+type CustomerHealthEvent struct {
+	CustomerID       uint64   `json:"customer_id"`
+	Email            string   `json:"email"`
+	Name             string   `json:"name"`
+	AccountManagerID *uint64  `json:"account_manager_id"`
+	Score            int      `json:"score"`
+	PreviousScore    int      `json:"previous_score"`
+	Risk             string   `json:"risk"`
+	Flags            []string `json:"flags"`
+	ComputedAt       string   `json:"computed_at"`
+}
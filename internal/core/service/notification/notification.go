@@ -2,6 +2,7 @@ package notification
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/tls"
@@ -10,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
 	"net/smtp"
 	"strings"
@@ -28,7 +30,10 @@ var (
 
 // Service provides notification operations
 type Service struct {
-	db *gorm.DB
+	db       *gorm.DB
+	baseURL  string
+	paused   func() bool
+	invoices domain.InvoiceRenderer
 }
 
 // NewService creates a new notification service
@@ -38,12 +43,8 @@ func NewService(db *gorm.DB) *Service {
 
 // SendEmail sends an email using a template
 func (s *Service) SendEmail(templateType string, recipient string, data map[string]interface{}) error {
-	// Get template
-	var tmpl domain.EmailTemplate
-	if err := s.db.Where("type = ? AND active = ?", templateType, true).First(&tmpl).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrTemplateNotFound
-		}
+	rendered, err := s.renderTemplate(templateType, "", data)
+	if err != nil {
 		return err
 	}
 
@@ -53,24 +54,70 @@ func (s *Service) SendEmail(templateType string, recipient string, data map[stri
 		return ErrSMTPNotConfigured
 	}
 
-	// Parse and execute template
+	// Queue the email, keeping its template for the template stats
+	return s.db.Create(&domain.EmailQueue{
+		TemplateID:   &rendered.templateID,
+		SMTPConfigID: &smtp.ID,
+		ToEmail:      recipient,
+		Subject:      rendered.subject,
+		BodyHTML:     rendered.bodyHTML,
+		BodyPlain:    rendered.bodyPlain,
+		Status:       "pending",
+		Priority:     5,
+		MaxAttempts:  3,
+	}).Error
+}
+
+// renderedEmail is a template filled with data
+type renderedEmail struct {
+	templateID uint64
+	subject    string
+	bodyHTML   string
+	bodyPlain  string
+}
+
+// renderTemplate fills the active template of a type with data, in the
+// language of the recipient when the template has it and else in English
+// or the language it has
+func (s *Service) renderTemplate(templateType, language string, data map[string]interface{}) (*renderedEmail, error) {
+	var templates []domain.EmailTemplate
+	if err := s.db.Where("type = ? AND active = ?", templateType, true).Order("id").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrTemplateNotFound
+	}
+	tmpl := templateVariant(templates, language)
+
 	subject, err := s.parseTemplate(tmpl.Subject, data)
 	if err != nil {
-		return fmt.Errorf("failed to parse subject: %w", err)
+		return nil, fmt.Errorf("failed to parse subject: %w", err)
 	}
 
 	bodyHTML, err := s.parseTemplate(tmpl.BodyHTML, data)
 	if err != nil {
-		return fmt.Errorf("failed to parse HTML body: %w", err)
+		return nil, fmt.Errorf("failed to parse HTML body: %w", err)
 	}
 
 	bodyPlain, err := s.parseTemplate(tmpl.BodyPlain, data)
 	if err != nil {
 		bodyPlain = "" // Plain text is optional
 	}
+	return &renderedEmail{templateID: tmpl.ID, subject: subject, bodyHTML: bodyHTML, bodyPlain: bodyPlain}, nil
+}
 
-	// Queue the email
-	return s.QueueEmail(smtp.ID, recipient, "", subject, bodyHTML, bodyPlain, nil, nil)
+// templateVariant picks the template of a language among the variants of
+// a template, matching "zh" for "zh-CN"
+func templateVariant(templates []domain.EmailTemplate, language string) domain.EmailTemplate {
+	base, _, _ := strings.Cut(language, "-")
+	for _, wanted := range []string{language, base, "en"} {
+		for _, tmpl := range templates {
+			if wanted != "" && strings.EqualFold(tmpl.Language, wanted) {
+				return tmpl
+			}
+		}
+	}
+	return templates[0]
 }
 
 // SendEmailDirect sends an email directly without using a template
@@ -112,6 +159,15 @@ func (s *Service) ProcessEmailQueue(batchSize int) error {
 	}
 
 	for _, email := range emails {
+		reason, err := s.skipReason(&email)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			s.skipEmail(&email, reason)
+			continue
+		}
+
 		if err := s.sendQueuedEmail(&email); err != nil {
 			// Update with error
 			s.db.Model(&email).Updates(map[string]interface{}{
@@ -159,30 +215,68 @@ func (s *Service) sendQueuedEmail(email *domain.EmailQueue) error {
 		fromName = email.FromName
 	}
 
-	message := s.buildMIMEMessage(fromEmail, fromName, email.ToEmail, email.ToName, email.Subject, email.BodyHTML, email.BodyPlain)
+	bodyHTML, tracked, err := s.trackEmail(email.BodyHTML)
+	if err != nil {
+		return err
+	}
+	bodyPlain := email.BodyPlain
+	headers := s.unsubscribeHeaders(email)
+	if len(headers) > 0 {
+		bodyHTML, bodyPlain = s.addUnsubscribeFooter(email, bodyHTML, bodyPlain)
+	}
+
+	dkimKey, err := s.dkimKeyFor(fromEmail)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := s.renderAttachments(email)
+	if err != nil {
+		return err
+	}
+
+	message, err := s.buildMIMEMessage(fromEmail, fromName, email.ToEmail, email.ToName, email.Subject, bodyHTML, bodyPlain, headers, attachments, dkimKey)
+	if err != nil {
+		return err
+	}
 
-	// Send email
-	if err := s.sendSMTP(&smtpConfig, fromEmail, email.ToEmail, message); err != nil {
+	// Send email; bounces go to the return path
+	if err := s.sendSMTP(&smtpConfig, smtpConfig.EnvelopeFrom(fromEmail), email.ToEmail, message); err != nil {
+		status := "failed"
+		if isHardBounce(err) {
+			status = "bounced"
+		}
+		s.logEmail(email, &smtpConfig, status, err.Error(), nil)
 		return err
 	}
 
-	// Update SMTP sent count
+	// Update SMTP sent count, which starts over each day
+	now := time.Now()
 	s.db.Model(&smtpConfig).Updates(map[string]interface{}{
-		"sent_today": smtpConfig.SentToday + 1,
-		"last_sent":  time.Now(),
+		"sent_today": smtpConfig.SentOn(now) + 1,
+		"last_sent":  now,
 	})
 
 	// Log the email
-	s.logEmail(email, &smtpConfig, "sent", "")
+	s.logEmail(email, &smtpConfig, "sent", "", tracked)
 
 	return nil
 }
 
-// sendSMTP sends an email via SMTP
+// sendSMTP sends an email via SMTP. The username and password may refer
+// to secrets kept outside the database.
 func (s *Service) sendSMTP(config *domain.SMTPConfig, from, to string, message []byte) error {
+	username, err := domain.ResolveSecret(config.Username)
+	if err != nil {
+		return fmt.Errorf("smtp username: %w", err)
+	}
+	password, err := domain.ResolveSecret(config.Password)
+	if err != nil {
+		return fmt.Errorf("smtp password: %w", err)
+	}
 	var auth smtp.Auth
-	if config.Username != "" && config.Password != "" {
-		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	if username != "" && password != "" {
+		auth = smtp.PlainAuth("", username, password, config.Host)
 	}
 
 	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
@@ -287,11 +381,13 @@ func (s *Service) sendSSL(addr string, auth smtp.Auth, from, to string, message
 	return c.Quit()
 }
 
-// buildMIMEMessage builds a MIME email message
-func (s *Service) buildMIMEMessage(fromEmail, fromName, toEmail, toName, subject, bodyHTML, bodyPlain string) []byte {
+// buildMIMEMessage builds a MIME email message with its attachments,
+// signed with the DKIM key of the sending domain when it has one
+func (s *Service) buildMIMEMessage(fromEmail, fromName, toEmail, toName, subject, bodyHTML, bodyPlain string, headers []string, attachments []attachment, dkimKey *domain.DKIMKey) ([]byte, error) {
 	var buf bytes.Buffer
 
 	boundary := "OPENHOST_BOUNDARY_" + time.Now().Format("20060102150405")
+	mixedBoundary := "OPENHOST_MIXED_" + time.Now().Format("20060102150405")
 
 	// Headers
 	if fromName != "" {
@@ -307,8 +403,22 @@ func (s *Service) buildMIMEMessage(fromEmail, fromName, toEmail, toName, subject
 	}
 
 	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	buf.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	// Marks the mail as automatic (RFC 3834) so autoresponders stay quiet
+	// and the email pipe rejects it should it come back
+	buf.WriteString("Auto-Submitted: auto-generated\r\n")
+	for _, header := range headers {
+		buf.WriteString(header + "\r\n")
+	}
 	buf.WriteString("MIME-Version: 1.0\r\n")
 
+	// Attachments follow the body, which becomes the first part
+	if len(attachments) > 0 {
+		buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", mixedBoundary))
+		buf.WriteString("\r\n")
+		buf.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
+	}
+
 	if bodyHTML != "" && bodyPlain != "" {
 		buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
 		buf.WriteString("\r\n")
@@ -338,7 +448,18 @@ func (s *Service) buildMIMEMessage(fromEmail, fromName, toEmail, toName, subject
 		buf.WriteString(bodyPlain)
 	}
 
-	return buf.Bytes()
+	if len(attachments) > 0 {
+		buf.WriteString("\r\n")
+		for _, file := range attachments {
+			writeAttachment(&buf, mixedBoundary, file)
+		}
+		buf.WriteString(fmt.Sprintf("--%s--\r\n", mixedBoundary))
+	}
+
+	if dkimKey == nil {
+		return buf.Bytes(), nil
+	}
+	return signDKIM(buf.Bytes(), dkimKey, time.Now())
 }
 
 // parseTemplate parses and executes a template string
@@ -356,8 +477,8 @@ func (s *Service) parseTemplate(templateStr string, data map[string]interface{})
 	return buf.String(), nil
 }
 
-// logEmail logs a sent email
-func (s *Service) logEmail(email *domain.EmailQueue, smtp *domain.SMTPConfig, status, errorMsg string) {
+// logEmail logs a sent email, with the links of a tracked email
+func (s *Service) logEmail(email *domain.EmailQueue, smtp *domain.SMTPConfig, status, errorMsg string, tracked *trackedEmail) {
 	log := &domain.EmailLog{
 		CustomerID:  email.CustomerID,
 		TemplateID:  email.TemplateID,
@@ -370,11 +491,22 @@ func (s *Service) logEmail(email *domain.EmailQueue, smtp *domain.SMTPConfig, st
 		RelatedType: email.RelatedType,
 		RelatedID:   email.RelatedID,
 	}
+	if smtp.ID != 0 {
+		log.SMTPConfigID = &smtp.ID
+	}
 	if status == "sent" {
 		now := time.Now()
 		log.SentAt = &now
 	}
-	s.db.Create(log)
+	if tracked != nil {
+		log.TrackingToken = tracked.token
+	}
+	if err := s.db.Create(log).Error; err != nil || tracked == nil {
+		return
+	}
+	for i, url := range tracked.links {
+		s.db.Create(&domain.EmailLink{EmailLogID: log.ID, Position: i, URL: url})
+	}
 }
 
 // CreateWebhook creates a webhook configuration
@@ -401,7 +533,9 @@ func (s *Service) CreateWebhook(customerID *uint64, name, url, secret string, ev
 	return webhook, nil
 }
 
-// TriggerWebhooks triggers webhooks for an event
+// TriggerWebhooks queues deliveries of an event to the subscribed webhooks.
+// Deliveries are stored with the caller's database handle, so events raised
+// inside a transaction are only sent once it commits.
 func (s *Service) TriggerWebhooks(eventType string, payload interface{}) error {
 	var webhooks []domain.WebhookConfig
 	if err := s.db.Where("active = ?", true).Find(&webhooks).Error; err != nil {
@@ -413,6 +547,7 @@ func (s *Service) TriggerWebhooks(eventType string, payload interface{}) error {
 		return err
 	}
 
+	now := time.Now()
 	for _, webhook := range webhooks {
 		// Check if webhook is subscribed to this event
 		if events, ok := webhook.Events["events"].([]interface{}); ok {
@@ -428,90 +563,150 @@ func (s *Service) TriggerWebhooks(eventType string, payload interface{}) error {
 			}
 		}
 
-		// Queue webhook delivery
-		go s.deliverWebhook(&webhook, eventType, payloadJSON)
+		delivery := &domain.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			EventType:   eventType,
+			Payload:     string(payloadJSON),
+			Status:      "pending",
+			NextRetryAt: &now,
+		}
+		if err := s.db.Create(delivery).Error; err != nil {
+			return err
+		}
+		// Attempts defaults to 1, no attempt has been made yet
+		if err := s.db.Model(delivery).Update("attempts", 0).Error; err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// deliverWebhook delivers a webhook
-func (s *Service) deliverWebhook(webhook *domain.WebhookConfig, eventType string, payload []byte) {
-	delivery := &domain.WebhookDelivery{
-		WebhookID: webhook.ID,
-		EventType: eventType,
-		Payload:   string(payload),
-		Status:    "pending",
-		Attempts:  0,
+// DeliverPendingWebhooks sends the webhook deliveries that are due. Failed
+// deliveries are retried with a growing delay until the webhook's retry
+// attempts are used up.
+func (s *Service) DeliverPendingWebhooks(now time.Time) (int, error) {
+	var deliveries []domain.WebhookDelivery
+	if err := s.db.Preload("Webhook").
+		Where("status = ? AND next_retry_at <= ?", "pending", now).
+		Order("id ASC").Limit(100).Find(&deliveries).Error; err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i := range deliveries {
+		if s.deliverWebhook(&deliveries[i]) {
+			delivered++
+		}
 	}
-	s.db.Create(delivery)
+	return delivered, nil
+}
 
-	// Try delivery with retries
-	for attempt := 1; attempt <= webhook.RetryAttempts; attempt++ {
-		delivery.Attempts = attempt
+// SetPause sets a check holding webhook deliveries back while it returns
+// true, such as during maintenance. Held deliveries stay pending and go
+// out once it returns false.
+func (s *Service) SetPause(paused func() bool) {
+	s.paused = paused
+}
 
-		req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(payload))
-		if err != nil {
-			delivery.Status = "failed"
-			delivery.ErrorMsg = err.Error()
-			s.db.Save(delivery)
-			continue
+// MonitorWebhooks periodically sends pending webhook deliveries
+func (s *Service) MonitorWebhooks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.paused != nil && s.paused() {
+				continue
+			}
+			if _, err := s.DeliverPendingWebhooks(time.Now()); err != nil {
+				log.Printf("webhooks: delivery failed: %v", err)
+			}
 		}
+	}
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-OpenHost-Event", eventType)
-		req.Header.Set("X-OpenHost-Delivery", fmt.Sprintf("%d", delivery.ID))
+// deliverWebhook makes one attempt to deliver a webhook and reports
+// whether it succeeded
+func (s *Service) deliverWebhook(delivery *domain.WebhookDelivery) bool {
+	webhook := &delivery.Webhook
+	delivery.Attempts++
+	delivery.NextRetryAt = nil
 
-		// Add signature if secret is set
-		if webhook.Secret != "" {
-			signature := s.signPayload(payload, webhook.Secret)
-			req.Header.Set("X-OpenHost-Signature", signature)
-		}
+	err := s.postWebhook(webhook, delivery)
+	if err == nil {
+		now := time.Now()
+		delivery.Status = "success"
+		delivery.ErrorMsg = ""
+		delivery.DeliveredAt = &now
+		s.db.Save(delivery)
 
-		client := &http.Client{
-			Timeout: time.Duration(webhook.Timeout) * time.Second,
-		}
+		// Update webhook last triggered
+		s.db.Model(webhook).Update("last_triggered", &now)
+		return true
+	}
 
-		start := time.Now()
-		resp, err := client.Do(req)
-		responseTime := int(time.Since(start).Milliseconds())
+	delivery.ErrorMsg = err.Error()
+	if webhook.Active && delivery.Attempts < webhook.RetryAttempts {
+		// Wait before retry
+		next := time.Now().Add(time.Duration(delivery.Attempts*delivery.Attempts) * time.Minute)
+		delivery.NextRetryAt = &next
+		s.db.Save(delivery)
+		return false
+	}
 
-		delivery.ResponseTime = responseTime
+	delivery.Status = "failed"
+	s.db.Save(delivery)
 
-		if err != nil {
-			delivery.Status = "failed"
-			delivery.ErrorMsg = err.Error()
-			s.db.Save(delivery)
-			
-			// Wait before retry
-			time.Sleep(time.Duration(attempt*attempt) * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
+	// Increment failure count
+	if webhook.ID != 0 {
+		s.db.Model(webhook).Update("failure_count", gorm.Expr("failure_count + 1"))
+	}
+	return false
+}
 
-		delivery.ResponseCode = resp.StatusCode
+// postWebhook sends a delivery to the webhook URL
+func (s *Service) postWebhook(webhook *domain.WebhookConfig, delivery *domain.WebhookDelivery) error {
+	if !webhook.Active {
+		return errors.New("webhook is disabled")
+	}
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			now := time.Now()
-			delivery.Status = "success"
-			delivery.DeliveredAt = &now
-			s.db.Save(delivery)
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
 
-			// Update webhook last triggered
-			s.db.Model(webhook).Update("last_triggered", &now)
-			return
-		}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-OpenHost-Event", delivery.EventType)
+	req.Header.Set("X-OpenHost-Delivery", fmt.Sprintf("%d", delivery.ID))
 
-		delivery.Status = "failed"
-		delivery.ErrorMsg = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		s.db.Save(delivery)
+	// Add signature if secret is set
+	if webhook.Secret != "" {
+		signature := s.signPayload(payload, webhook.Secret)
+		req.Header.Set("X-OpenHost-Signature", signature)
+	}
 
-		// Wait before retry
-		time.Sleep(time.Duration(attempt*attempt) * time.Second)
+	client := &http.Client{
+		Timeout: time.Duration(webhook.Timeout) * time.Second,
 	}
 
-	// Increment failure count
-	s.db.Model(webhook).Update("failure_count", webhook.FailureCount+1)
+	start := time.Now()
+	resp, err := client.Do(req)
+	delivery.ResponseTime = int(time.Since(start).Milliseconds())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	delivery.ResponseCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
 }
 
 // signPayload signs a payload for webhook verification using HMAC-SHA256
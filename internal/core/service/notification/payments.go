@@ -0,0 +1,188 @@
+package notification
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Webhook events raised by payments, whichever way they were made:
+// through a gateway, from the credit balance or recorded by staff
+const (
+	EventPaymentReceived = "payment.received"
+	EventPaymentFailed   = "payment.failed"
+	EventPaymentRefunded = "payment.refunded"
+)
+
+// PaymentReceived queues the payment.received webhooks and emails the
+// customer a receipt with the PDF of the invoice paid. A payment settling
+// its invoice is receipted with the invoice_paid template, others with
+// payment_receipt. A failed email is logged rather than failing the
+// payment.
+func (s *Service) PaymentReceived(transaction *domain.Transaction) error {
+	event := s.newPaymentEvent(transaction)
+	data := paymentEmailData(event)
+	templateType := string(domain.EmailTypePaymentReceipt)
+	var attachments domain.JSONMap
+	if invoice := s.paymentInvoice(transaction.InvoiceID); invoice != nil {
+		for key, value := range invoiceEmailData(invoice) {
+			data[key] = value
+		}
+		if invoice.IsPaid() {
+			templateType = string(domain.EmailTypeInvoicePaid)
+		}
+		attachments = invoiceAttachments(invoice.ID)
+	}
+	s.emailPayment(transaction.CustomerID, templateType, data, attachments)
+	return s.TriggerWebhooks(EventPaymentReceived, event)
+}
+
+// PaymentFailed queues the payment.failed webhooks and emails the
+// customer that a payment through a gateway did not go through
+func (s *Service) PaymentFailed(request *domain.PaymentRequest, reason string) error {
+	event := PaymentEvent{
+		PaymentRequestID: request.ID,
+		CustomerID:       request.CustomerID,
+		InvoiceID:        &request.InvoiceID,
+		Amount:           request.Amount.String(),
+		Currency:         request.Currency,
+		Gateway:          request.Gateway.Slug,
+		Method:           s.paymentMethodName(request.Gateway.Slug, request.PaymentMethodID),
+		Reason:           reason,
+		CreatedAt:        time.Now().Format(time.RFC3339),
+	}
+	if invoice := s.paymentInvoice(event.InvoiceID); invoice != nil {
+		event.InvoiceNumber = invoice.InvoiceNumber
+	}
+	s.emailPayment(request.CustomerID, string(domain.EmailTypePaymentFailed), paymentEmailData(event), nil)
+	return s.TriggerWebhooks(EventPaymentFailed, event)
+}
+
+// PaymentRefunded queues the payment.refunded webhooks and emails the
+// customer a receipt of the refund, with the PDF of the invoice refunded
+func (s *Service) PaymentRefunded(refund *domain.Transaction, reason string) error {
+	event := s.newPaymentEvent(refund)
+	event.Amount = refund.Amount.Abs().String()
+	event.RefundOf = refund.RefundTransID
+	event.Reason = reason
+	var attachments domain.JSONMap
+	if refund.InvoiceID != nil {
+		attachments = invoiceAttachments(*refund.InvoiceID)
+	}
+	s.emailPayment(refund.CustomerID, string(domain.EmailTypePaymentRefunded), paymentEmailData(event), attachments)
+	return s.TriggerWebhooks(EventPaymentRefunded, event)
+}
+
+// newPaymentEvent builds the payload of a payment or refund. Refunds are
+// named after the payment method of the payment refunded.
+func (s *Service) newPaymentEvent(transaction *domain.Transaction) PaymentEvent {
+	event := PaymentEvent{
+		TransactionID:        transaction.ID,
+		CustomerID:           transaction.CustomerID,
+		InvoiceID:            transaction.InvoiceID,
+		Amount:               transaction.Amount.String(),
+		Currency:             transaction.Currency,
+		Gateway:              transaction.Gateway,
+		GatewayTransactionID: transaction.GatewayTransID,
+		CreatedAt:            transaction.CreatedAt.Format(time.RFC3339),
+	}
+	gateway, methodID := transaction.Gateway, transaction.PaymentMethodID
+	if transaction.RefundTransID != nil {
+		var original domain.Transaction
+		if err := s.db.Select("id", "gateway", "payment_method_id").Limit(1).Find(&original, *transaction.RefundTransID).Error; err == nil && original.ID != 0 {
+			gateway, methodID = original.Gateway, original.PaymentMethodID
+		}
+	}
+	event.Method = s.paymentMethodName(gateway, methodID)
+	if invoice := s.paymentInvoice(transaction.InvoiceID); invoice != nil {
+		event.InvoiceNumber = invoice.InvoiceNumber
+	}
+	return event
+}
+
+// paymentMethodName names how a payment was made with the card number
+// masked: the saved payment method when there is one, else the gateway
+func (s *Service) paymentMethodName(gateway string, methodID *uint64) string {
+	if methodID != nil {
+		var method domain.PaymentMethod
+		if err := s.db.Limit(1).Find(&method, *methodID).Error; err == nil && method.ID != 0 {
+			return method.MaskedName()
+		}
+	}
+	switch gateway {
+	case "":
+		return "Manual"
+	case domain.GatewayCreditBalance:
+		return "Account credit"
+	}
+	var module domain.PaymentGatewayModule
+	if err := s.db.Select("id", "display_name").Where("slug = ?", gateway).Limit(1).Find(&module).Error; err == nil && module.DisplayName != "" {
+		return module.DisplayName
+	}
+	return gateway
+}
+
+// paymentInvoice loads the invoice of a payment, nil when it has none
+func (s *Service) paymentInvoice(invoiceID *uint64) *domain.Invoice {
+	if invoiceID == nil {
+		return nil
+	}
+	var invoice domain.Invoice
+	if err := s.db.Limit(1).Find(&invoice, *invoiceID).Error; err != nil || invoice.ID == 0 {
+		return nil
+	}
+	return &invoice
+}
+
+// emailPayment emails the customer about a payment using a template
+func (s *Service) emailPayment(customerID uint64, templateType string, data map[string]interface{}, attachments domain.JSONMap) {
+	err := s.sendCategoryEmail(customerID, domain.EmailCategoryBilling, templateType, data, attachments)
+	if err != nil && !errors.Is(err, ErrTemplateNotFound) && !errors.Is(err, ErrSMTPNotConfigured) {
+		log.Printf("failed to email %s to customer %d: %v", templateType, customerID, err)
+	}
+}
+
+// paymentEmailData returns the template data of a payment
+func paymentEmailData(event PaymentEvent) map[string]interface{} {
+	data := map[string]interface{}{
+		"TransactionID":        event.TransactionID,
+		"Amount":               event.Amount,
+		"Currency":             event.Currency,
+		"Method":               event.Method,
+		"GatewayTransactionID": event.GatewayTransactionID,
+		"Reason":               event.Reason,
+		"InvoiceNumber":        event.InvoiceNumber,
+	}
+	if amount, err := decimal.NewFromString(event.Amount); err == nil {
+		data["Amount"] = amount.StringFixed(2)
+	}
+	if event.InvoiceID != nil {
+		data["InvoiceID"] = *event.InvoiceID
+	}
+	if createdAt, err := time.Parse(time.RFC3339, event.CreatedAt); err == nil {
+		data["Date"] = createdAt.Format("2006-01-02")
+	}
+	return data
+}
+
+// PaymentEvent is the payload of payment.received, payment.failed and
+// payment.refunded. Amounts are positive, refunds included.
+type PaymentEvent struct {
+	TransactionID        uint64  `json:"transaction_id,omitempty"`     // Not set for failed payments
+	PaymentRequestID     uint64  `json:"payment_request_id,omitempty"` // Set for failed payments
+	RefundOf             *uint64 `json:"refund_of,omitempty"`          // Transaction refunded
+	CustomerID           uint64  `json:"customer_id"`
+	InvoiceID            *uint64 `json:"invoice_id"`
+	InvoiceNumber        string  `json:"invoice_number,omitempty"`
+	Amount               string  `json:"amount"`
+	Currency             string  `json:"currency"`
+	Gateway              string  `json:"gateway"`
+	GatewayTransactionID string  `json:"gateway_transaction_id,omitempty"`
+	Method               string  `json:"method"` // Masked, such as "Visa **** 4242"
+	Reason               string  `json:"reason,omitempty"`
+	CreatedAt            string  `json:"created_at"`
+}
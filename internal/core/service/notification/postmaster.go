@@ -0,0 +1,222 @@
+package notification
+
+import (
+	"errors"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+const (
+	// recentBounceLimit is how many hard bounces the postmaster report lists
+	recentBounceLimit = 20
+	// domainMinAttempts is how many emails a recipient domain must have
+	// been sent before its failure rate is reported
+	domainMinAttempts = 5
+	// domainFailureRate is the failure rate from which a recipient domain
+	// is reported
+	domainFailureRate = 0.2
+)
+
+// Postmaster is the state of email delivery: the queue, how each SMTP
+// config is doing and where emails fail
+type Postmaster struct {
+	Since          time.Time
+	Queue          QueueStats
+	SMTPConfigs    []SMTPStats
+	RecentBounces  []domain.EmailLog
+	FailingDomains []DomainStats
+}
+
+// QueueStats counts the queued emails by status
+type QueueStats struct {
+	Pending       int64
+	Sending       int64
+	Failed        int64
+	Skipped       int64
+	OldestPending *time.Time
+}
+
+// SMTPStats are the sends of an SMTP config since the start of the report
+type SMTPStats struct {
+	Config  domain.SMTPConfig
+	Sent    int64
+	Failed  int64 // Includes bounces
+	Bounced int64
+}
+
+// FailureRate returns the share of sends that failed
+func (s SMTPStats) FailureRate() float64 {
+	return failureRate(s.Sent, s.Failed)
+}
+
+// DomainStats are the sends to a recipient domain
+type DomainStats struct {
+	Domain string
+	Sent   int64
+	Failed int64 // Includes bounces
+}
+
+// FailureRate returns the share of sends that failed
+func (d DomainStats) FailureRate() float64 {
+	return failureRate(d.Sent, d.Failed)
+}
+
+// PostmasterReport returns the state of email delivery since the given
+// time
+func (s *Service) PostmasterReport(since time.Time) (*Postmaster, error) {
+	report := &Postmaster{Since: since}
+	if err := s.queueStats(&report.Queue); err != nil {
+		return nil, err
+	}
+
+	var configs []domain.SMTPConfig
+	if err := s.db.Order("id").Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		SMTPConfigID uint64
+		Status       string
+		Count        int64
+	}
+	if err := s.db.Model(&domain.EmailLog{}).
+		Select("smtp_config_id, status, COUNT(*) AS count").
+		Where("smtp_config_id IS NOT NULL AND created_at >= ?", since).
+		Group("smtp_config_id, status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		stats := SMTPStats{Config: config}
+		for _, row := range rows {
+			if row.SMTPConfigID != config.ID {
+				continue
+			}
+			switch row.Status {
+			case "sent":
+				stats.Sent += row.Count
+			case "failed":
+				stats.Failed += row.Count
+			case "bounced":
+				stats.Failed += row.Count
+				stats.Bounced += row.Count
+			}
+		}
+		report.SMTPConfigs = append(report.SMTPConfigs, stats)
+	}
+
+	if err := s.db.Where("status = ? AND created_at >= ?", "bounced", since).
+		Order("created_at DESC").Limit(recentBounceLimit).
+		Find(&report.RecentBounces).Error; err != nil {
+		return nil, err
+	}
+
+	failing, err := s.failingDomains(since)
+	if err != nil {
+		return nil, err
+	}
+	report.FailingDomains = failing
+	return report, nil
+}
+
+func (s *Service) queueStats(stats *QueueStats) error {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := s.db.Model(&domain.EmailQueue{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case "pending":
+			stats.Pending = row.Count
+		case "sending":
+			stats.Sending = row.Count
+		case "failed":
+			stats.Failed = row.Count
+		case "skipped":
+			stats.Skipped = row.Count
+		}
+	}
+
+	var oldest domain.EmailQueue
+	result := s.db.Select("created_at").Where("status = ?", "pending").
+		Order("created_at ASC").Limit(1).Find(&oldest)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		stats.OldestPending = &oldest.CreatedAt
+	}
+	return nil
+}
+
+// failingDomains returns the recipient domains whose failure rate since
+// the given time is elevated, the worst first
+func (s *Service) failingDomains(since time.Time) ([]DomainStats, error) {
+	var logs []domain.EmailLog
+	if err := s.db.Select("to_email", "status").
+		Where("status IN ? AND created_at >= ?", []string{"sent", "failed", "bounced"}, since).
+		Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	byDomain := make(map[string]*DomainStats)
+	for _, log := range logs {
+		at := strings.LastIndex(log.ToEmail, "@")
+		if at < 0 {
+			continue
+		}
+		name := strings.ToLower(log.ToEmail[at+1:])
+		stats, ok := byDomain[name]
+		if !ok {
+			stats = &DomainStats{Domain: name}
+			byDomain[name] = stats
+		}
+		if log.Status == "sent" {
+			stats.Sent++
+		} else {
+			stats.Failed++
+		}
+	}
+
+	var failing []DomainStats
+	for _, stats := range byDomain {
+		if stats.Sent+stats.Failed >= domainMinAttempts && stats.FailureRate() >= domainFailureRate {
+			failing = append(failing, *stats)
+		}
+	}
+	sort.Slice(failing, func(i, j int) bool {
+		if failing[i].FailureRate() != failing[j].FailureRate() {
+			return failing[i].FailureRate() > failing[j].FailureRate()
+		}
+		return failing[i].Domain < failing[j].Domain
+	})
+	return failing, nil
+}
+
+// isHardBounce reports whether an SMTP error rejects the recipient for
+// good, as opposed to a failure worth retrying
+func isHardBounce(err error) bool {
+	var smtpErr *textproto.Error
+	if !errors.As(err, &smtpErr) {
+		return false
+	}
+	switch smtpErr.Code {
+	case 550, 551, 553, 554:
+		return true
+	}
+	return false
+}
+
+func failureRate(sent, failed int64) float64 {
+	if sent+failed == 0 {
+		return 0
+	}
+	return float64(failed) / float64(sent+failed)
+}
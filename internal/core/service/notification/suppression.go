@@ -0,0 +1,290 @@
+package notification
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrCannotOptOut         = errors.New("invoice emails cannot be unsubscribed from")
+	ErrInvalidReason        = errors.New("reason must be bounced, complaint or manual")
+	ErrInvalidEmail         = errors.New("email address is required")
+	ErrSuppressionNotFound  = errors.New("suppressed address not found")
+	ErrUnsubscribeNotFound  = errors.New("unsubscribe link not found")
+	errNothingToUnsubscribe = errors.New("email has no category to unsubscribe from")
+)
+
+// queueBatchSize is how many queued emails MonitorQueue sends per run
+const queueBatchSize = 50
+
+// SetBaseURL sets the address of the site, which unsubscribe links point
+// to. Without it marketing-class emails go out without them.
+func (s *Service) SetBaseURL(baseURL string) {
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// MonitorQueue sends queued emails on the given interval
+func (s *Service) MonitorQueue(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ProcessEmailQueue(queueBatchSize); err != nil {
+			log.Printf("failed to process email queue: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AddSuppression puts an address on the suppression list, or changes the
+// reason it is on it
+func (s *Service) AddSuppression(email string, reason domain.SuppressionReason, note string, createdBy *uint64) (*domain.EmailSuppression, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, ErrInvalidEmail
+	}
+	if !reason.Valid() {
+		return nil, ErrInvalidReason
+	}
+
+	suppression := domain.EmailSuppression{Email: email}
+	if err := s.db.Where("email = ?", email).
+		Assign(domain.EmailSuppression{Reason: reason, Note: note, CreatedBy: createdBy}).
+		FirstOrCreate(&suppression).Error; err != nil {
+		return nil, err
+	}
+	return &suppression, nil
+}
+
+// ListSuppressions returns the suppression list, newest first
+func (s *Service) ListSuppressions() ([]domain.EmailSuppression, error) {
+	var suppressions []domain.EmailSuppression
+	err := s.db.Order("created_at DESC").Find(&suppressions).Error
+	return suppressions, err
+}
+
+// RemoveSuppression takes an address off the suppression list
+func (s *Service) RemoveSuppression(id uint64) error {
+	result := s.db.Delete(&domain.EmailSuppression{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSuppressionNotFound
+	}
+	return nil
+}
+
+// ListSkipped returns the emails the queue skipped, newest first, with
+// the reason each was skipped. An address limits them to its emails.
+func (s *Service) ListSkipped(email string, limit int) ([]domain.EmailQueue, error) {
+	query := s.db.Where("status = ?", "skipped")
+	if email != "" {
+		query = query.Where("LOWER(to_email) = ?", strings.ToLower(strings.TrimSpace(email)))
+	}
+	var emails []domain.EmailQueue
+	err := query.Order("created_at DESC").Limit(limit).Find(&emails).Error
+	return emails, err
+}
+
+// Unsubscription is what an unsubscribe link unsubscribes from
+type Unsubscription struct {
+	Email      string
+	Categories []domain.EmailCategory
+}
+
+// LookupUnsubscribe returns what an unsubscribe link unsubscribes from
+func (s *Service) LookupUnsubscribe(token string) (*Unsubscription, error) {
+	email, err := s.unsubscribeEmail(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Unsubscription{Email: email.ToEmail, Categories: optOutCategories(email.Category)}, nil
+}
+
+// Unsubscribe opts the recipient of an email out of its categories. It is
+// safe to repeat.
+func (s *Service) Unsubscribe(token string) (*Unsubscription, error) {
+	email, err := s.unsubscribeEmail(token)
+	if err != nil {
+		return nil, err
+	}
+	categories := optOutCategories(email.Category)
+	if email.CustomerID == nil || len(categories) == 0 {
+		return nil, errNothingToUnsubscribe
+	}
+
+	for _, category := range categories {
+		if err := s.SetEmailFrequency(*email.CustomerID, category, domain.EmailFrequencyNever); err != nil {
+			return nil, err
+		}
+	}
+	return &Unsubscription{Email: email.ToEmail, Categories: categories}, nil
+}
+
+func (s *Service) unsubscribeEmail(token string) (*domain.EmailQueue, error) {
+	if token == "" {
+		return nil, ErrUnsubscribeNotFound
+	}
+	var email domain.EmailQueue
+	if err := s.db.Where("unsubscribe_token = ?", token).First(&email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnsubscribeNotFound
+		}
+		return nil, err
+	}
+	return &email, nil
+}
+
+// skipReason returns why a queued email must not be sent: its address is
+// suppressed or its recipient unsubscribed from all of its categories. It
+// returns an empty reason when the email can be sent.
+func (s *Service) skipReason(email *domain.EmailQueue) (string, error) {
+	var suppression domain.EmailSuppression
+	result := s.db.Where("email = ?", strings.ToLower(email.ToEmail)).Limit(1).Find(&suppression)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected > 0 {
+		return fmt.Sprintf("address suppressed: %s", suppression.Reason), nil
+	}
+
+	categories := optOutCategories(email.Category)
+	if email.CustomerID == nil || len(categories) == 0 {
+		return "", nil
+	}
+	var optedOut int64
+	if err := s.db.Model(&domain.EmailDigestPreference{}).
+		Where("user_id = ? AND category IN ? AND frequency = ?", *email.CustomerID, categories, domain.EmailFrequencyNever).
+		Count(&optedOut).Error; err != nil {
+		return "", err
+	}
+	if int(optedOut) == len(categories) {
+		names := make([]string, 0, len(categories))
+		for _, category := range categories {
+			names = append(names, string(category))
+		}
+		return "unsubscribed from " + strings.Join(names, ", "), nil
+	}
+	return "", nil
+}
+
+// skipEmail marks a queued email skipped and logs it with the reason
+func (s *Service) skipEmail(email *domain.EmailQueue, reason string) {
+	s.db.Model(email).Updates(map[string]interface{}{
+		"status":      "skipped",
+		"skip_reason": reason,
+	})
+	s.db.Create(&domain.EmailLog{
+		CustomerID:  email.CustomerID,
+		TemplateID:  email.TemplateID,
+		ToEmail:     email.ToEmail,
+		Subject:     email.Subject,
+		Status:      "skipped",
+		ErrorMsg:    reason,
+		RelatedType: email.RelatedType,
+		RelatedID:   email.RelatedID,
+	})
+}
+
+// unsubscribeURL returns the one-click unsubscribe link of an email, or
+// an empty string when it has none
+func (s *Service) unsubscribeURL(email *domain.EmailQueue) string {
+	if s.baseURL == "" || email.UnsubscribeToken == "" {
+		return ""
+	}
+	return s.baseURL + "/unsubscribe/" + email.UnsubscribeToken
+}
+
+// unsubscribeHeaders returns the List-Unsubscribe headers of RFC 8058,
+// which let mail clients unsubscribe with one click
+func (s *Service) unsubscribeHeaders(email *domain.EmailQueue) []string {
+	link := s.unsubscribeURL(email)
+	if link == "" {
+		return nil
+	}
+	return []string{
+		"List-Unsubscribe: <" + link + ">",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+	}
+}
+
+// addUnsubscribeFooter appends the unsubscribe link to the bodies of an
+// email
+func (s *Service) addUnsubscribeFooter(email *domain.EmailQueue, bodyHTML, bodyPlain string) (string, string) {
+	link := s.unsubscribeURL(email)
+	if bodyHTML != "" {
+		bodyHTML += fmt.Sprintf("\n<p style=\"font-size:12px;color:#888\"><a href=\"%s\">Unsubscribe</a></p>\n", html.EscapeString(link))
+	}
+	if bodyPlain != "" {
+		bodyPlain += "\n\nUnsubscribe: " + link + "\n"
+	}
+	return bodyHTML, bodyPlain
+}
+
+// newCategoryEmail builds a queued email of the given categories. Emails
+// of categories users can opt out of get an unsubscribe token.
+func newCategoryEmail(smtpConfigID uint64, user *domain.User, categories []domain.EmailCategory, subject, bodyHTML, bodyPlain string) (*domain.EmailQueue, error) {
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		names = append(names, string(category))
+	}
+	email := &domain.EmailQueue{
+		SMTPConfigID: &smtpConfigID,
+		ToEmail:      user.Email,
+		ToName:       user.FullName(),
+		Subject:      subject,
+		BodyHTML:     bodyHTML,
+		BodyPlain:    bodyPlain,
+		CustomerID:   &user.ID,
+		Status:       "pending",
+		Priority:     5,
+		MaxAttempts:  3,
+		Category:     strings.Join(names, ","),
+	}
+	if len(optOutCategories(email.Category)) > 0 {
+		token, err := newEmailToken()
+		if err != nil {
+			return nil, err
+		}
+		email.UnsubscribeToken = token
+	}
+	return email, nil
+}
+
+// optOutCategories returns the categories of a queued email users can
+// unsubscribe from
+func optOutCategories(list string) []domain.EmailCategory {
+	var categories []domain.EmailCategory
+	for _, name := range strings.Split(list, ",") {
+		category := domain.EmailCategory(strings.TrimSpace(name))
+		if category.CanOptOut() {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+func newEmailToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,214 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ErrTrackingNotFound = errors.New("tracked email not found")
+
+// trackedLink matches the absolute links of an HTML body
+var trackedLink = regexp.MustCompile(`(?i)(<a\s[^>]*?href\s*=\s*")(https?://[^"]+)(")`)
+
+// trackedEmail is an email sent with tracking: its token and the links
+// it was sent with, in order
+type trackedEmail struct {
+	token string
+	links []string
+}
+
+// TemplateStats are the opens and clicks of the emails sent from a
+// template. Only emails sent with tracking count.
+type TemplateStats struct {
+	Sent    int64
+	Opened  int64 // Emails opened at least once
+	Clicked int64 // Emails with a link clicked at least once
+}
+
+// OpenRate returns the share of emails opened
+func (t TemplateStats) OpenRate() float64 {
+	if t.Sent == 0 {
+		return 0
+	}
+	return float64(t.Opened) / float64(t.Sent)
+}
+
+// ClickRate returns the share of emails with a link clicked
+func (t TemplateStats) ClickRate() float64 {
+	if t.Sent == 0 {
+		return 0
+	}
+	return float64(t.Clicked) / float64(t.Sent)
+}
+
+// TrackingEnabled reports whether emails are sent with an open pixel and
+// wrapped links. Tracking is off unless turned on.
+func (s *Service) TrackingEnabled() bool {
+	var setting domain.Setting
+	result := s.db.Where("key = ?", domain.SettingEmailTracking).Limit(1).Find(&setting)
+	return result.Error == nil && result.RowsAffected > 0 && setting.Value == "true"
+}
+
+// SetTracking turns the open and click tracking of emails on or off.
+// Turning it off stops tracking emails sent from then on and no longer
+// records opens and clicks of emails already sent.
+func (s *Service) SetTracking(enabled bool) error {
+	setting := domain.Setting{Key: domain.SettingEmailTracking}
+	return s.db.Where("key = ?", domain.SettingEmailTracking).
+		Assign(domain.Setting{
+			Value: strconv.FormatBool(enabled),
+			Type:  "bool",
+			Group: "email",
+			Label: "Track email opens and clicks",
+		}).FirstOrCreate(&setting).Error
+}
+
+// RecordOpen counts an open of a tracked email
+func (s *Service) RecordOpen(token string, now time.Time) error {
+	if !s.TrackingEnabled() {
+		return nil
+	}
+	log, err := s.trackedLog(token)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"opens":          gorm.Expr("opens + 1"),
+		"last_opened_at": now,
+	}
+	if log.FirstOpenedAt == nil {
+		updates["first_opened_at"] = now
+	}
+	return s.db.Model(&domain.EmailLog{}).Where("id = ?", log.ID).Updates(updates).Error
+}
+
+// RecordClick counts a click on a link of a tracked email and returns
+// where the link goes. A click also counts as an open, as images may be
+// blocked.
+func (s *Service) RecordClick(token string, position int, now time.Time) (string, error) {
+	log, err := s.trackedLog(token)
+	if err != nil {
+		return "", err
+	}
+	var link domain.EmailLink
+	if err := s.db.Where("email_log_id = ? AND position = ?", log.ID, position).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrTrackingNotFound
+		}
+		return "", err
+	}
+	if !s.TrackingEnabled() {
+		return link.URL, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&link).Updates(map[string]interface{}{
+			"clicks":          gorm.Expr("clicks + 1"),
+			"last_clicked_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"clicks": gorm.Expr("clicks + 1")}
+		if log.FirstClickedAt == nil {
+			updates["first_clicked_at"] = now
+		}
+		if log.FirstOpenedAt == nil {
+			updates["first_opened_at"] = now
+			updates["last_opened_at"] = now
+			updates["opens"] = gorm.Expr("opens + 1")
+		}
+		return tx.Model(&domain.EmailLog{}).Where("id = ?", log.ID).Updates(updates).Error
+	})
+	return link.URL, err
+}
+
+// GetEmailLog returns a logged email with the links it was sent with
+func (s *Service) GetEmailLog(id uint64) (*domain.EmailLog, error) {
+	var log domain.EmailLog
+	err := s.db.Preload("Links", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).First(&log, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTrackingNotFound
+	}
+	return &log, err
+}
+
+// TemplateStats returns the open and click stats of the emails sent from
+// each template, by template ID
+func (s *Service) TemplateStats() (map[uint64]TemplateStats, error) {
+	var rows []struct {
+		TemplateID uint64
+		Sent       int64
+		Opened     int64
+		Clicked    int64
+	}
+	if err := s.db.Model(&domain.EmailLog{}).
+		Select("template_id, COUNT(*) AS sent, " +
+			"SUM(CASE WHEN opens > 0 THEN 1 ELSE 0 END) AS opened, " +
+			"SUM(CASE WHEN clicks > 0 THEN 1 ELSE 0 END) AS clicked").
+		Where("template_id IS NOT NULL AND status = ? AND tracking_token <> ''", "sent").
+		Group("template_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint64]TemplateStats, len(rows))
+	for _, row := range rows {
+		stats[row.TemplateID] = TemplateStats{Sent: row.Sent, Opened: row.Opened, Clicked: row.Clicked}
+	}
+	return stats, nil
+}
+
+func (s *Service) trackedLog(token string) (*domain.EmailLog, error) {
+	if token == "" {
+		return nil, ErrTrackingNotFound
+	}
+	var log domain.EmailLog
+	if err := s.db.Select("id", "first_opened_at", "first_clicked_at").
+		Where("tracking_token = ?", token).First(&log).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTrackingNotFound
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
+// trackEmail wraps the links of an HTML body with the click tracker and
+// adds the open pixel. The body is returned as is when tracking is off,
+// the base URL is not set or there is no HTML body.
+func (s *Service) trackEmail(bodyHTML string) (string, *trackedEmail, error) {
+	if bodyHTML == "" || s.baseURL == "" || !s.TrackingEnabled() {
+		return bodyHTML, nil, nil
+	}
+	token, err := newEmailToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tracked := &trackedEmail{token: token}
+	bodyHTML = trackedLink.ReplaceAllStringFunc(bodyHTML, func(match string) string {
+		parts := trackedLink.FindStringSubmatch(match)
+		position := len(tracked.links)
+		tracked.links = append(tracked.links, html.UnescapeString(parts[2]))
+		return parts[1] + fmt.Sprintf("%s/t/c/%s/%d", s.baseURL, token, position) + parts[3]
+	})
+
+	pixel := fmt.Sprintf(`<img src="%s/t/o/%s" width="1" height="1" alt="" style="display:none">`, s.baseURL, token)
+	if i := strings.LastIndex(strings.ToLower(bodyHTML), "</body>"); i >= 0 {
+		bodyHTML = bodyHTML[:i] + pixel + bodyHTML[i:]
+	} else {
+		bodyHTML += pixel
+	}
+	return bodyHTML, tracked, nil
+}
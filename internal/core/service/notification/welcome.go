@@ -0,0 +1,167 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrWelcomeEmailNotFound = errors.New("welcome email not found")
+	ErrServiceNotFound      = errors.New("service not found")
+	ErrProductNotFound      = errors.New("product not found")
+)
+
+// GetWelcomeEmail retrieves the welcome email of a product
+func (s *Service) GetWelcomeEmail(productID uint64) (*domain.ProductWelcomeEmail, error) {
+	var email domain.ProductWelcomeEmail
+	result := s.db.Where("product_id = ?", productID).Limit(1).Find(&email)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrWelcomeEmailNotFound
+	}
+	return &email, nil
+}
+
+// SetWelcomeEmail creates or replaces the welcome email of a product
+func (s *Service) SetWelcomeEmail(productID uint64, subject, body string, active bool) (*domain.ProductWelcomeEmail, error) {
+	var count int64
+	if err := s.db.Model(&domain.Product{}).Where("id = ?", productID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	// Templates are checked up front so a broken one is not only noticed
+	// when a service is activated
+	if _, err := template.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("failed to parse subject: %w", err)
+	}
+	if _, err := template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("failed to parse body: %w", err)
+	}
+
+	email, err := s.GetWelcomeEmail(productID)
+	if err != nil && err != ErrWelcomeEmailNotFound {
+		return nil, err
+	}
+	if email == nil {
+		email = &domain.ProductWelcomeEmail{ProductID: productID, Subject: subject, Body: body}
+		if err := s.db.Create(email).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Model(email).Updates(map[string]interface{}{
+		"subject": subject,
+		"body":    body,
+		"active":  active,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return email, nil
+}
+
+// SendWelcomeEmail renders the welcome email of a service's product with
+// the service details and credentials and queues it for the customer
+func (s *Service) SendWelcomeEmail(serviceID uint64) error {
+	var service domain.Service
+	if err := s.db.Preload("Product").Preload("Customer").Preload("IPAddress").
+		First(&service, serviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrServiceNotFound
+		}
+		return err
+	}
+
+	email, err := s.GetWelcomeEmail(service.ProductID)
+	if err != nil {
+		return err
+	}
+	if !email.Active {
+		return ErrWelcomeEmailNotFound
+	}
+
+	data, err := s.welcomeEmailData(&service)
+	if err != nil {
+		return err
+	}
+
+	subject, err := s.parseTemplate(email.Subject, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse subject: %w", err)
+	}
+	body, err := s.parseTemplate(email.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse body: %w", err)
+	}
+
+	var smtpConfig domain.SMTPConfig
+	if err := s.db.Where("active = ? AND \"default\" = ?", true, true).First(&smtpConfig).Error; err != nil {
+		return ErrSMTPNotConfigured
+	}
+
+	toName := service.Customer.FirstName + " " + service.Customer.LastName
+	queued := &domain.EmailQueue{
+		SMTPConfigID: &smtpConfig.ID,
+		ToEmail:      service.Customer.Email,
+		ToName:       toName,
+		Subject:      subject,
+		BodyHTML:     body,
+		CustomerID:   &service.CustomerID,
+		RelatedType:  "service",
+		RelatedID:    &service.ID,
+		Status:       "pending",
+		Priority:     3,
+		MaxAttempts:  3,
+	}
+	return s.db.Create(queued).Error
+}
+
+// welcomeEmailData builds the template data of a service's welcome email.
+// Custom service fields are available as .Fields and configurable options
+// as .Options, both keyed by name.
+func (s *Service) welcomeEmailData(service *domain.Service) (map[string]interface{}, error) {
+	var values []domain.CustomFieldValue
+	if err := s.db.Preload("CustomField").
+		Where("entity_type = ? AND entity_id = ?", "service", service.ID).
+		Find(&values).Error; err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(values))
+	for _, value := range values {
+		fields[value.CustomField.FieldName] = value.Value
+	}
+
+	ipAddress := ""
+	if service.IPAddress != nil {
+		ipAddress = service.IPAddress.IP
+	}
+
+	return map[string]interface{}{
+		"ClientName":   service.Customer.FirstName + " " + service.Customer.LastName,
+		"FirstName":    service.Customer.FirstName,
+		"LastName":     service.Customer.LastName,
+		"Email":        service.Customer.Email,
+		"ServiceID":    service.ID,
+		"ProductName":  service.Product.Name,
+		"Domain":       service.Domain,
+		"Hostname":     service.Hostname,
+		"Username":     service.Username,
+		"Password":     string(service.Password),
+		"IPAddress":    ipAddress,
+		"BillingCycle": service.BillingCycle,
+		"Amount":       service.RecurringAmount.StringFixed(2),
+		"Currency":     service.Currency,
+		"NextDueDate":  service.NextDueDate.Format("Jan 2, 2006"),
+		"Options":      service.ConfigSelection,
+		"Fields":       fields,
+	}, nil
+}
@@ -0,0 +1,374 @@
+// Package numbering gives out the numbers of invoices and orders from
+// configurable sequences, such as INV-{YEAR}-{SEQ:5}.
+//
+// A number is taken in the transaction creating the document: the counter
+// row stays locked until the transaction ends and a rollback returns the
+// number, so invoice numbers have no gaps. A counter starts after the
+// highest number its format already gave out, such as before an upgrade.
+package numbering
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrUnknownKind    = errors.New("unknown number kind")
+	ErrInvalidFormat  = errors.New("format must have one {SEQ} or {SEQ:n} placeholder and only {YEAR}, {YY}, {MONTH} and {DAY} besides")
+	ErrInvalidReset   = errors.New("reset must be never, yearly or monthly")
+	ErrResetNeedsDate = errors.New("a yearly sequence needs {YEAR} or {YY} in its format, a monthly one {MONTH} as well")
+	ErrNextTooLow     = errors.New("the next number must be higher than the last number given out")
+	ErrNumbersIssued  = errors.New("the sequence would give out numbers already issued; set a next number past them")
+)
+
+// maxSeqWidth is the most digits a sequence number can be padded to
+const maxSeqWidth = 10
+
+// Defaults are the sequences of the kinds not configured
+var Defaults = map[domain.NumberKind]domain.NumberSequence{
+	domain.NumberKindInvoice: {Kind: domain.NumberKindInvoice, Format: "INV-{YEAR}-{SEQ:5}", Reset: domain.NumberResetYearly},
+	domain.NumberKindOrder:   {Kind: domain.NumberKindOrder, Format: "ORD-{SEQ:6}", Reset: domain.NumberResetNever},
+}
+
+// documentColumns are the columns the numbers of each kind of document
+// are stored in
+var documentColumns = map[domain.NumberKind]struct{ table, column string }{
+	domain.NumberKindInvoice: {"invoices", "invoice_number"},
+	domain.NumberKindOrder:   {"orders", "order_number"},
+}
+
+// Kinds are the kinds of documents numbered, in display order
+var Kinds = []domain.NumberKind{
+	domain.NumberKindInvoice,
+	domain.NumberKindOrder,
+}
+
+// Service gives out document numbers
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new numbering service. To take numbers without
+// gaps, pass the transaction creating the document.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Sequence returns the numbering scheme of a kind of document
+func (s *Service) Sequence(kind domain.NumberKind) (domain.NumberSequence, error) {
+	def, ok := Defaults[kind]
+	if !ok {
+		return domain.NumberSequence{}, ErrUnknownKind
+	}
+	var sequence domain.NumberSequence
+	result := s.db.Where("kind = ?", kind).Limit(1).Find(&sequence)
+	if result.Error != nil {
+		return domain.NumberSequence{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return def, nil
+	}
+	return sequence, nil
+}
+
+// UpdateSequence changes the numbering scheme of a kind of document and,
+// when next is not 0, sets the number the next document gets in the
+// current period, such as to carry on from numbers given out by another
+// system. The numbers given out so far stay as they are. A scheme that
+// would give out a number already issued is refused unless next is past
+// it, and numbers cannot be lowered.
+func (s *Service) UpdateSequence(kind domain.NumberKind, format string, reset domain.NumberReset, next uint64, now time.Time) (domain.NumberSequence, error) {
+	if _, ok := Defaults[kind]; !ok {
+		return domain.NumberSequence{}, ErrUnknownKind
+	}
+	format = strings.TrimSpace(format)
+	if err := Validate(format, reset); err != nil {
+		return domain.NumberSequence{}, err
+	}
+
+	sequence := domain.NumberSequence{Kind: kind}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		counter, err := lockCounter(tx, domain.NumberSequence{Kind: kind, Format: format, Reset: reset}, now)
+		if err != nil {
+			return err
+		}
+		issued, err := highestIssued(tx, kind, format, now)
+		if err != nil {
+			return err
+		}
+		if next > 0 {
+			if next <= counter.LastNumber {
+				return ErrNextTooLow
+			}
+			if next <= issued {
+				return ErrNumbersIssued
+			}
+			if err := tx.Model(counter).Updates(map[string]interface{}{
+				"last_number": next - 1,
+				"updated_at":  now,
+			}).Error; err != nil {
+				return err
+			}
+		} else if issued > counter.LastNumber {
+			return ErrNumbersIssued
+		}
+
+		return tx.Where("kind = ?", kind).
+			Assign(domain.NumberSequence{Format: format, Reset: reset}).
+			FirstOrCreate(&sequence).Error
+	})
+	return sequence, err
+}
+
+// Last returns the last number given out by a kind of document in the
+// period of the given time, 0 if none
+func (s *Service) Last(kind domain.NumberKind, now time.Time) (uint64, error) {
+	sequence, err := s.Sequence(kind)
+	if err != nil {
+		return 0, err
+	}
+	var counter domain.NumberCounter
+	result := s.db.Where("kind = ? AND period = ?", kind, period(sequence.Reset, now)).
+		Limit(1).Find(&counter)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// The counter starts after the numbers already given out
+		return highestIssued(s.db, kind, sequence.Format, now)
+	}
+	return counter.LastNumber, nil
+}
+
+// Preview returns the number the next document of a kind will get,
+// without taking it
+func (s *Service) Preview(kind domain.NumberKind, now time.Time) (string, error) {
+	sequence, err := s.Sequence(kind)
+	if err != nil {
+		return "", err
+	}
+	last, err := s.Last(kind, now)
+	if err != nil {
+		return "", err
+	}
+	return Format(sequence.Format, now, last+1), nil
+}
+
+// Next takes the next number of a kind of document
+func (s *Service) Next(kind domain.NumberKind, now time.Time) (string, error) {
+	sequence, err := s.Sequence(kind)
+	if err != nil {
+		return "", err
+	}
+	var number string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		counter, err := lockCounter(tx, sequence, now)
+		if err != nil {
+			return err
+		}
+		counter.LastNumber++
+		if err := tx.Model(counter).Updates(map[string]interface{}{
+			"last_number": counter.LastNumber,
+			"updated_at":  now,
+		}).Error; err != nil {
+			return err
+		}
+		number = Format(sequence.Format, now, counter.LastNumber)
+		return nil
+	})
+	return number, err
+}
+
+// lockCounter returns the counter of a sequence in the period of now,
+// locked until the end of the transaction. A counter created here starts
+// after the highest number its format already gave out.
+func lockCounter(tx *gorm.DB, sequence domain.NumberSequence, now time.Time) (*domain.NumberCounter, error) {
+	kind, period := sequence.Kind, period(sequence.Reset, now)
+	created := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.NumberCounter{Kind: kind, Period: period, UpdatedAt: now})
+	if created.Error != nil {
+		return nil, created.Error
+	}
+	var counter domain.NumberCounter
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("kind = ? AND period = ?", kind, period).First(&counter).Error; err != nil {
+		return nil, err
+	}
+	if created.RowsAffected == 0 {
+		return &counter, nil
+	}
+
+	issued, err := highestIssued(tx, kind, sequence.Format, now)
+	if err != nil || issued == 0 {
+		return &counter, err
+	}
+	if err := tx.Model(&counter).Update("last_number", issued).Error; err != nil {
+		return nil, err
+	}
+	counter.LastNumber = issued
+	return &counter, nil
+}
+
+// highestIssued returns the highest sequence number of the documents of a
+// kind whose number the format gives in the period of now, 0 if none.
+// Numbers longer than maxSeqWidth digits are not sequence numbers, such as
+// the timestamps orders were numbered with before.
+func highestIssued(tx *gorm.DB, kind domain.NumberKind, format string, now time.Time) (uint64, error) {
+	doc, ok := documentColumns[kind]
+	if !ok {
+		return 0, nil
+	}
+	prefix, suffix := affixes(format, now)
+	var numbers []string
+	if err := tx.Table(doc.table).
+		Where(doc.column+` LIKE ? ESCAPE '\'`, escapeLike(prefix)+"%"+escapeLike(suffix)).
+		Pluck(doc.column, &numbers).Error; err != nil {
+		return 0, err
+	}
+
+	var highest uint64
+	for _, number := range numbers {
+		if len(number) < len(prefix)+len(suffix) {
+			continue
+		}
+		digits := number[len(prefix) : len(number)-len(suffix)]
+		if digits == "" || len(digits) > maxSeqWidth || strings.Trim(digits, "0123456789") != "" {
+			continue
+		}
+		seq, err := strconv.ParseUint(digits, 10, 64)
+		if err != nil || Format(format, now, seq) != number {
+			continue
+		}
+		highest = max(highest, seq)
+	}
+	return highest, nil
+}
+
+// affixes returns the text a format renders before and after its
+// sequence number. The format is expected to be valid.
+func affixes(format string, t time.Time) (prefix, suffix string) {
+	start := strings.Index(format, "{SEQ")
+	end := start + strings.IndexByte(format[start:], '}')
+	return Format(format[:start], t, 0), Format(format[end+1:], t, 0)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// period returns the period of a sequence a time falls in
+func period(reset domain.NumberReset, t time.Time) string {
+	switch reset {
+	case domain.NumberResetYearly:
+		return t.Format("2006")
+	case domain.NumberResetMonthly:
+		return t.Format("2006-01")
+	}
+	return ""
+}
+
+// Validate checks a format and the reset of its sequence
+func Validate(format string, reset domain.NumberReset) error {
+	switch reset {
+	case domain.NumberResetNever, domain.NumberResetYearly, domain.NumberResetMonthly:
+	default:
+		return ErrInvalidReset
+	}
+	if format == "" || len(format) > 50 || strings.Count(format, "{") != strings.Count(format, "}") {
+		return ErrInvalidFormat
+	}
+
+	seqs := 0
+	hasYear, hasMonth := false, false
+	rest := format
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return ErrInvalidFormat
+		}
+		token := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+
+		switch {
+		case token == "YEAR" || token == "YY":
+			hasYear = true
+		case token == "MONTH":
+			hasMonth = true
+		case token == "DAY":
+		case token == "SEQ":
+			seqs++
+		case strings.HasPrefix(token, "SEQ:"):
+			width, err := strconv.Atoi(token[len("SEQ:"):])
+			if err != nil || width < 1 || width > maxSeqWidth {
+				return ErrInvalidFormat
+			}
+			seqs++
+		default:
+			return ErrInvalidFormat
+		}
+	}
+	if seqs != 1 {
+		return ErrInvalidFormat
+	}
+
+	if reset == domain.NumberResetYearly && !hasYear {
+		return ErrResetNeedsDate
+	}
+	if reset == domain.NumberResetMonthly && !(hasYear && hasMonth) {
+		return ErrResetNeedsDate
+	}
+	return nil
+}
+
+// Format renders a number of a sequence. The format is expected to be
+// valid.
+func Format(format string, t time.Time, seq uint64) string {
+	var b strings.Builder
+	rest := format
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(rest[:start])
+		token := rest[start+1 : start+end]
+		rest = rest[start+end+1:]
+
+		switch {
+		case token == "YEAR":
+			b.WriteString(t.Format("2006"))
+		case token == "YY":
+			b.WriteString(t.Format("06"))
+		case token == "MONTH":
+			b.WriteString(t.Format("01"))
+		case token == "DAY":
+			b.WriteString(t.Format("02"))
+		case token == "SEQ":
+			b.WriteString(strconv.FormatUint(seq, 10))
+		case strings.HasPrefix(token, "SEQ:"):
+			width, _ := strconv.Atoi(token[len("SEQ:"):])
+			fmt.Fprintf(&b, "%0*d", width, seq)
+		default:
+			b.WriteString("{" + token + "}")
+		}
+	}
+	b.WriteString(rest)
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package numbering
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// TestNextSkipsIssuedNumbers checks that a new counter starts after the
+// numbers given out before it, and that a scheme giving them out again is
+// refused
+func TestNextSkipsIssuedNumbers(t *testing.T) {
+	db := testutil.OpenDB(t)
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Numbers given out before the counter existed
+	for _, number := range []string{"INV-2026-00417", "INV-2026-83", "INV-2025-99999", "INV-2026-0000000000012"} {
+		invoice := &domain.Invoice{InvoiceNumber: number}
+		if err := db.Create(invoice).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewService(db)
+	if preview, err := service.Preview(domain.NumberKindInvoice, now); err != nil || preview != "INV-2026-00418" {
+		t.Errorf("preview got %q (%v), want INV-2026-00418", preview, err)
+	}
+	if number, err := service.Next(domain.NumberKindInvoice, now); err != nil || number != "INV-2026-00418" {
+		t.Errorf("next got %q (%v), want INV-2026-00418", number, err)
+	}
+
+	// Unpadded, the scheme carries on from the counter
+	if _, err := service.UpdateSequence(domain.NumberKindInvoice, "INV-{YEAR}-{SEQ}", domain.NumberResetYearly, 0, now); err != nil {
+		t.Fatalf("update to an unpadded scheme: %v", err)
+	}
+	if number, err := service.Next(domain.NumberKindInvoice, now); err != nil || number != "INV-2026-419" {
+		t.Errorf("next after the update got %q (%v), want INV-2026-419", number, err)
+	}
+
+	// A number the counter has not reached yet, such as one imported
+	if err := db.Create(&domain.Invoice{InvoiceNumber: "INV-2026-900"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.UpdateSequence(domain.NumberKindInvoice, "INV-{YEAR}-{SEQ}", domain.NumberResetYearly, 0, now); !errors.Is(err, ErrNumbersIssued) {
+		t.Errorf("update reusing an issued number got %v, want ErrNumbersIssued", err)
+	}
+	if _, err := service.UpdateSequence(domain.NumberKindInvoice, "INV-{YEAR}-{SEQ}", domain.NumberResetYearly, 900, now); !errors.Is(err, ErrNumbersIssued) {
+		t.Errorf("update with a next number already issued got %v, want ErrNumbersIssued", err)
+	}
+	if _, err := service.UpdateSequence(domain.NumberKindInvoice, "INV-{YEAR}-{SEQ}", domain.NumberResetYearly, 901, now); err != nil {
+		t.Fatalf("update with a next number past the issued ones: %v", err)
+	}
+
+	// A new period starts after the numbers its format gave out
+	if _, err := service.UpdateSequence(domain.NumberKindInvoice, "INV-{YEAR}-{SEQ}", domain.NumberResetNever, 0, now); err != nil {
+		t.Fatalf("update to a sequence never reset: %v", err)
+	}
+	if number, err := service.Next(domain.NumberKindInvoice, now); err != nil || number != "INV-2026-901" {
+		t.Errorf("next in the new period got %q (%v), want INV-2026-901", number, err)
+	}
+}
@@ -3,13 +3,22 @@ package order
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/product"
+	"github.com/openhost/openhost/internal/core/service/stock"
 	"github.com/openhost/openhost/internal/core/service/tax"
 )
 
@@ -18,10 +27,29 @@ var (
 	ErrCartItemNotFound    = errors.New("cart item not found")
 	ErrPricingNotFound     = errors.New("product pricing not found")
 	ErrInvalidBillingCycle = errors.New("billing cycle not available")
+	ErrBundleNotFound      = errors.New("bundle not found")
+	ErrBundleItem          = errors.New("bundle items can only be removed with their bundle")
 )
 
 const CartExpiration = 7 * 24 * time.Hour // 7 days
 
+// Sources of the currency and tax country of a cart, kept for audit
+const (
+	SourceUser    = "user"    // Picked by the visitor
+	SourceProfile = "profile" // The customer's account
+	SourceGeoIP   = "geoip"   // Country of the visitor's IP address
+	SourceDefault = "default"
+)
+
+// CartLocation is the currency and the country a guest presumably shops
+// in, with where each came from
+type CartLocation struct {
+	Currency       string
+	CurrencySource string
+	Country        string
+	CountrySource  string
+}
+
 // CartService provides shopping cart operations
 type CartService struct {
 	db *gorm.DB
@@ -32,7 +60,8 @@ func NewCartService(db *gorm.DB) *CartService {
 	return &CartService{db: db}
 }
 
-// GetOrCreateCart gets an existing cart or creates a new one
+// GetOrCreateCart gets an existing cart or creates a new one. Carts of
+// customers are in the currency they are billed in.
 func (s *CartService) GetOrCreateCart(customerID *uint64, sessionID string) (*domain.Cart, error) {
 	var cart domain.Cart
 	var err error
@@ -48,10 +77,25 @@ func (s *CartService) GetOrCreateCart(customerID *uint64, sessionID string) (*do
 	if err == nil {
 		// Check if cart is expired
 		if time.Now().After(cart.ExpiresAt) {
+			releaseCartStock(s.db, cart.ID)
 			s.db.Delete(&domain.CartItem{}, "cart_id = ?", cart.ID)
 			s.db.Delete(&cart)
 			return s.createCart(customerID, sessionID)
 		}
+		if customerID != nil {
+			currency, err := account.CustomerCurrency(s.db, *customerID)
+			if err != nil {
+				return nil, err
+			}
+			if cart.Currency != currency {
+				if err := s.switchCurrency(&cart, currency, SourceProfile); err != nil {
+					return nil, err
+				}
+				if err := s.db.Preload("Items.Product").First(&cart, cart.ID).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
 		return &cart, nil
 	}
 
@@ -62,13 +106,26 @@ func (s *CartService) GetOrCreateCart(customerID *uint64, sessionID string) (*do
 	return nil, err
 }
 
-// createCart creates a new cart
+// createCart creates a new cart in the currency of the customer, the
+// default currency for guests
 func (s *CartService) createCart(customerID *uint64, sessionID string) (*domain.Cart, error) {
+	var id uint64
+	source := SourceDefault
+	if customerID != nil {
+		id = *customerID
+		source = SourceProfile
+	}
+	currency, err := account.CustomerCurrency(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+
 	cart := &domain.Cart{
-		CustomerID: customerID,
-		SessionID:  sessionID,
-		Currency:   "USD",
-		ExpiresAt:  time.Now().Add(CartExpiration),
+		CustomerID:     customerID,
+		SessionID:      sessionID,
+		Currency:       currency,
+		CurrencySource: source,
+		ExpiresAt:      time.Now().Add(CartExpiration),
 	}
 
 	if err := s.db.Create(cart).Error; err != nil {
@@ -79,7 +136,7 @@ func (s *CartService) createCart(customerID *uint64, sessionID string) (*domain.
 }
 
 // AddItem adds a product to the cart
-func (s *CartService) AddItem(cartID, productID uint64, quantity int, billingCycle, domainName, hostname string, configOptions domain.JSONMap) (*domain.CartItem, error) {
+func (s *CartService) AddItem(cartID, productID uint64, quantity int, billingCycle, domainName, hostname string, configOptions domain.JSONMap, customFields map[string]string) (*domain.CartItem, error) {
 	if quantity <= 0 {
 		quantity = 1
 	}
@@ -98,64 +155,167 @@ func (s *CartService) AddItem(cartID, productID uint64, quantity int, billingCyc
 	if err := s.db.Preload("ConfigGroups.Options.SubOptions").First(&product, productID).Error; err != nil {
 		return nil, ErrProductNotFound
 	}
-
-	var pricing domain.ProductPricing
-	if err := s.db.Where("product_id = ? AND currency = ?", productID, cart.Currency).First(&pricing).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrPricingNotFound
-		}
+	if visible, err := customergroup.CanSee(s.db, cartCustomer(&cart), &product); err != nil {
 		return nil, err
+	} else if !visible {
+		return nil, ErrProductNotFound
 	}
 
-	recurringFee := pricing.GetPrice(billingCycle)
+	pricing, err := s.loadPricing(productID, &cart)
+	if err != nil {
+		return nil, err
+	}
 	if !pricing.IsCycleEnabled(billingCycle) {
 		return nil, ErrInvalidBillingCycle
 	}
 
-	setupFee := pricing.SetupFee
-	optionSetupFee, optionRecurring := calculateConfigOptionPricing(product, billingCycle, configOptions)
-	setupFee = setupFee.Add(optionSetupFee)
-	recurringFee = recurringFee.Add(optionRecurring)
-
 	// Check if item already exists in cart
-	var existingItem domain.CartItem
-	if err := s.db.Where("cart_id = ? AND product_id = ?", cartID, productID).First(&existingItem).Error; err == nil {
-		// Update existing item
-		existingItem.Quantity += quantity
-		existingItem.Total = existingItem.SetupFee.Add(existingItem.RecurringFee.Mul(decimal.NewFromInt(int64(existingItem.Quantity))))
-		if err := s.db.Save(&existingItem).Error; err != nil {
+	item := &domain.CartItem{}
+	if err := s.db.Where("cart_id = ? AND product_id = ? AND bundle_id IS NULL", cartID, productID).First(item).Error; err == nil {
+		// Update existing item, repricing it for the new quantity
+		item.Quantity += quantity
+	} else {
+		fieldValues, err := customfield.NewService(s.db).ValidateOrderValues(productID, customFields)
+		if err != nil {
 			return nil, err
 		}
-		return &existingItem, nil
+		item = &domain.CartItem{
+			CartID:        cartID,
+			ProductID:     productID,
+			Quantity:      quantity,
+			BillingCycle:  billingCycle,
+			ConfigOptions: configOptions,
+			Domain:        domainName,
+			Hostname:      hostname,
+			Discount:      decimal.Zero,
+			CustomFields:  fieldValues,
+		}
 	}
+	priceCartItem(item, pricing, product)
 
-	// Create new cart item
-	total := setupFee.Add(recurringFee.Mul(decimal.NewFromInt(int64(quantity))))
-
-	item := &domain.CartItem{
-		CartID:        cartID,
-		ProductID:     productID,
-		Quantity:      quantity,
-		BillingCycle:  billingCycle,
-		ConfigOptions: configOptions,
-		Domain:        domainName,
-		Hostname:      hostname,
-		SetupFee:      setupFee,
-		RecurringFee:  recurringFee,
-		Discount:      decimal.Zero,
-		Total:         total,
+	if err := stock.NewService(s.db).Check(productID, item.Quantity); err != nil {
+		return nil, productOutOfStock(product, err)
 	}
 
-	if err := s.db.Create(item).Error; err != nil {
+	// Stock controlled options are reserved until the cart expires, so the
+	// item, its reservations and the new expiry are saved together
+	expiresAt := time.Now().Add(CartExpiration)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+		if err := reserveStock(tx, item, product, expiresAt); err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.Cart{}).Where("id = ?", cartID).Update("expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+		return extendCartStock(tx, cartID, expiresAt)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Update cart expiration
-	s.db.Model(&domain.Cart{}).Where("id = ?", cartID).Update("expires_at", time.Now().Add(CartExpiration))
-
 	return item, nil
 }
 
+// AddBundle adds the products of a bundle to the cart at their bundle
+// prices. Optional products are only added when listed in
+// optionalProductIDs. The items share a bundle key and are removed together.
+func (s *CartService) AddBundle(cartID, bundleID uint64, billingCycle string, optionalProductIDs []uint64) ([]domain.CartItem, error) {
+	if billingCycle == "" {
+		billingCycle = "monthly"
+	}
+
+	var cart domain.Cart
+	if err := s.db.First(&cart, cartID).Error; err != nil {
+		return nil, ErrCartNotFound
+	}
+
+	bundle, err := product.NewService(s.db).GetBundle(bundleID)
+	if err != nil || !bundle.Active {
+		return nil, ErrBundleNotFound
+	}
+
+	bundleItems := product.IncludedBundleItems(bundle, optionalProductIDs)
+	items := make([]domain.CartItem, 0, len(bundleItems))
+	lines := make([]domain.BundleLine, 0, len(bundleItems))
+	bundleKey := fmt.Sprintf("%d-%d", bundle.ID, time.Now().UnixNano())
+	for _, bundleItem := range bundleItems {
+		if visible, err := customergroup.CanSee(s.db, cartCustomer(&cart), &bundleItem.Product); err != nil {
+			return nil, err
+		} else if !visible {
+			return nil, ErrBundleNotFound
+		}
+		pricing, err := s.loadPricing(bundleItem.ProductID, &cart)
+		if err != nil {
+			return nil, err
+		}
+		if !pricing.IsCycleEnabled(billingCycle) {
+			return nil, ErrInvalidBillingCycle
+		}
+		if err := stock.NewService(s.db).Check(bundleItem.ProductID, bundleItem.Quantity); err != nil {
+			return nil, productOutOfStock(bundleItem.Product, err)
+		}
+
+		item := domain.CartItem{
+			CartID:       cartID,
+			ProductID:    bundleItem.ProductID,
+			Quantity:     bundleItem.Quantity,
+			BillingCycle: billingCycle,
+			Discount:     decimal.Zero,
+			BundleID:     &bundle.ID,
+			BundleKey:    bundleKey,
+		}
+		priceCartItem(&item, pricing, bundleItem.Product)
+		items = append(items, item)
+		lines = append(lines, domain.BundleLine{
+			Item:             bundleItem,
+			ListSetupFee:     item.SetupFee,
+			ListRecurringFee: item.RecurringFee,
+		})
+	}
+	if len(items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	// The bundle price replaces the product fees, so services renew at it
+	bundle.Price(billingCycle, lines)
+	for i := range items {
+		item := &items[i]
+		item.SetupFee = lines[i].SetupFee
+		item.RecurringFee = lines[i].RecurringFee
+		if saving := lines[i].Saving(); bundle.ShowSavings && saving.IsPositive() {
+			if item.Savings == nil {
+				item.Savings = domain.JSONMap{}
+			}
+			item.Savings[bundle.SavingsLabel()] = saving.String()
+		}
+		item.Total = cartItemSubtotal(*item)
+	}
+
+	expiresAt := time.Now().Add(CartExpiration)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range items {
+			if err := tx.Create(&items[i]).Error; err != nil {
+				return err
+			}
+			if err := reserveStock(tx, &items[i], bundleItems[i].Product, expiresAt); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&domain.Cart{}).Where("id = ?", cartID).Update("expires_at", expiresAt).Error; err != nil {
+			return err
+		}
+		return extendCartStock(tx, cartID, expiresAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
 // UpdateItem updates a cart item
 func (s *CartService) UpdateItem(cartItemID uint64, quantity int) (*domain.CartItem, error) {
 	var item domain.CartItem
@@ -170,20 +330,67 @@ func (s *CartService) UpdateItem(cartItemID uint64, quantity int) (*domain.CartI
 		// Remove item if quantity is 0 or less
 		return nil, s.RemoveItem(cartItemID)
 	}
+	if item.BundleKey != "" {
+		return nil, ErrBundleItem
+	}
 
+	var cart domain.Cart
+	if err := s.db.First(&cart, item.CartID).Error; err != nil {
+		return nil, ErrCartNotFound
+	}
+
+	var product domain.Product
+	if err := s.db.Preload("ConfigGroups.Options.SubOptions").First(&product, item.ProductID).Error; err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	pricing, err := s.loadPricing(item.ProductID, &cart)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stock.NewService(s.db).Check(item.ProductID, quantity); err != nil {
+		return nil, productOutOfStock(product, err)
+	}
+
+	// Quantity breaks depend on the quantity, so the item is repriced
 	item.Quantity = quantity
-	item.Total = item.SetupFee.Add(item.RecurringFee.Mul(decimal.NewFromInt(int64(quantity)))).Sub(item.Discount)
+	priceCartItem(&item, pricing, product)
 
-	if err := s.db.Save(&item).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		return reserveStock(tx, &item, product, cart.ExpiresAt)
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &item, nil
 }
 
-// RemoveItem removes an item from the cart
+// RemoveItem removes an item from the cart. Items added from a bundle are
+// removed with the rest of the bundle.
 func (s *CartService) RemoveItem(cartItemID uint64) error {
-	return s.db.Delete(&domain.CartItem{}, cartItemID).Error
+	itemIDs := []uint64{cartItemID}
+	var item domain.CartItem
+	if err := s.db.Select("id", "cart_id", "bundle_key").Limit(1).Find(&item, cartItemID).Error; err != nil {
+		return err
+	}
+	if item.BundleKey != "" {
+		if err := s.db.Model(&domain.CartItem{}).Where("cart_id = ? AND bundle_key = ?", item.CartID, item.BundleKey).
+			Pluck("id", &itemIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cart_item_id IN ?", itemIDs).Delete(&domain.ConfigStockReservation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.CartItem{}, itemIDs).Error
+	})
 }
 
 // ApplyCoupon applies a coupon to the cart
@@ -228,7 +435,7 @@ func (s *CartService) recalculateCartDiscounts(cartID uint64, coupon *domain.Cou
 
 	for _, item := range items {
 		discount := decimal.Zero
-		itemSubtotal := item.SetupFee.Add(item.RecurringFee.Mul(decimal.NewFromInt(int64(item.Quantity))))
+		itemSubtotal := cartItemSubtotal(item)
 
 		switch coupon.Type {
 		case domain.CouponTypePercentage:
@@ -255,30 +462,44 @@ func (s *CartService) recalculateCartDiscounts(cartID uint64, coupon *domain.Cou
 // GetCartSummary returns a summary of the cart
 func (s *CartService) GetCartSummary(cartID uint64) (*CartSummary, error) {
 	var cart domain.Cart
-	if err := s.db.Preload("Items.Product").Preload("Coupon").First(&cart, cartID).Error; err != nil {
+	if err := s.db.Preload("Items.Product").Preload("Items.Bundle").Preload("Coupon").First(&cart, cartID).Error; err != nil {
 		return nil, ErrCartNotFound
 	}
 
 	summary := &CartSummary{
-		CartID:   cart.ID,
-		Currency: cart.Currency,
-		Items:    make([]CartItemSummary, 0, len(cart.Items)),
+		CartID:           cart.ID,
+		Currency:         cart.Currency,
+		CurrencySource:   cart.CurrencySource,
+		TaxCountry:       cart.TaxCountry,
+		TaxCountrySource: cart.TaxCountrySource,
+		Items:            make([]CartItemSummary, 0, len(cart.Items)),
 	}
 
 	for _, item := range cart.Items {
-		summary.Items = append(summary.Items, CartItemSummary{
-			ID:           item.ID,
-			ProductID:    item.ProductID,
-			ProductName:  item.Product.Name,
-			Quantity:     item.Quantity,
-			BillingCycle: item.BillingCycle,
-			SetupFee:     item.SetupFee,
-			RecurringFee: item.RecurringFee,
-			Discount:     item.Discount,
-			Total:        item.Total,
-		})
+		itemSummary := CartItemSummary{
+			ID:            item.ID,
+			ProductID:     item.ProductID,
+			ProductName:   item.Product.Name,
+			Quantity:      item.Quantity,
+			BillingCycle:  item.BillingCycle,
+			SetupFee:      item.SetupFee,
+			RecurringFee:  item.RecurringFee,
+			Discount:      item.Discount,
+			PromoDiscount: item.PromoDiscount,
+			Savings:       cartItemSavings(item),
+			Total:         item.Total,
+			BundleKey:     item.BundleKey,
+		}
+		if item.Bundle != nil {
+			itemSummary.BundleID = &item.Bundle.ID
+			itemSummary.BundleName = item.Bundle.Name
+		}
+		for _, saving := range itemSummary.Savings {
+			summary.TotalSavings = summary.TotalSavings.Add(saving.Amount)
+		}
+		summary.Items = append(summary.Items, itemSummary)
 		summary.Subtotal = summary.Subtotal.Add(item.SetupFee.Add(item.RecurringFee.Mul(decimal.NewFromInt(int64(item.Quantity)))))
-		summary.TotalDiscount = summary.TotalDiscount.Add(item.Discount)
+		summary.TotalDiscount = summary.TotalDiscount.Add(item.Discount).Add(item.PromoDiscount)
 	}
 
 	taxableAmount := summary.Subtotal.Sub(summary.TotalDiscount)
@@ -288,6 +509,15 @@ func (s *CartService) GetCartSummary(cartID uint64) (*CartSummary, error) {
 			return nil, err
 		}
 		summary.Tax = taxAmount
+	} else if cart.CustomerID == nil && cart.TaxCountry != "" && taxableAmount.GreaterThan(decimal.Zero) {
+		// Guests are shown the tax of the country they presumably shop
+		// from until their billing address is known
+		taxAmount, err := tax.NewCalculator(s.db).CalculateForCountry(cart.TaxCountry, taxableAmount)
+		if err != nil {
+			return nil, err
+		}
+		summary.Tax = taxAmount
+		summary.TaxEstimated = true
 	}
 	summary.Total = taxableAmount.Add(summary.Tax)
 
@@ -300,6 +530,9 @@ func (s *CartService) GetCartSummary(cartID uint64) (*CartSummary, error) {
 
 // ClearCart removes all items from a cart
 func (s *CartService) ClearCart(cartID uint64) error {
+	if err := releaseCartStock(s.db, cartID); err != nil {
+		return err
+	}
 	return s.db.Delete(&domain.CartItem{}, "cart_id = ?", cartID).Error
 }
 
@@ -320,6 +553,14 @@ func (s *CartService) MergeCart(sessionID string, customerID uint64) error {
 		return err
 	}
 
+	// Bundles were priced in the currency of the guest cart and are not
+	// carried over to a cart in another one
+	if guestCart.Currency != userCart.Currency {
+		if err := removeBundles(s.db, guestCart.ID); err != nil {
+			return err
+		}
+	}
+
 	// Move items from guest cart to user cart
 	if err := s.db.Model(&domain.CartItem{}).Where("cart_id = ?", guestCart.ID).
 		Update("cart_id", userCart.ID).Error; err != nil {
@@ -327,7 +568,133 @@ func (s *CartService) MergeCart(sessionID string, customerID uint64) error {
 	}
 
 	// Delete guest cart
-	return s.db.Delete(&guestCart).Error
+	if err := s.db.Delete(&guestCart).Error; err != nil {
+		return err
+	}
+
+	// The items were priced for a guest; the customer's group prices
+	// and currency apply now
+	return s.repriceItems(userCart)
+}
+
+// SetCurrency changes the currency of a cart, such as when a visitor picks
+// another one. Items are repriced in it; items whose product is not sold in
+// it are removed, as are bundles.
+func (s *CartService) SetCurrency(cartID uint64, currency string) (*domain.Cart, error) {
+	var cart domain.Cart
+	if err := s.db.First(&cart, cartID).Error; err != nil {
+		return nil, ErrCartNotFound
+	}
+	currency, err := account.OfferedCurrency(s.db, currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.switchCurrency(&cart, currency, SourceUser); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// Locate sets the currency and the country a guest cart is presumed to pay
+// tax in from where the visitor is. What a visitor picked is kept over
+// what was detected, and currencies not on sale are ignored. Carts of
+// customers follow their account.
+func (s *CartService) Locate(cart *domain.Cart, location CartLocation) error {
+	if cart.CustomerID != nil {
+		return nil
+	}
+	if location.Currency != "" && overrides(cart.CurrencySource, location.CurrencySource) {
+		currency, err := account.OfferedCurrency(s.db, location.Currency)
+		if err != nil && err != account.ErrCurrencyUnavailable {
+			return err
+		}
+		if err == nil {
+			if err := s.switchCurrency(cart, currency, location.CurrencySource); err != nil {
+				return err
+			}
+		}
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(location.Country))
+	if country != "" && overrides(cart.TaxCountrySource, location.CountrySource) &&
+		(country != cart.TaxCountry || location.CountrySource != cart.TaxCountrySource) {
+		if err := s.db.Model(cart).Updates(map[string]interface{}{
+			"tax_country":        country,
+			"tax_country_source": location.CountrySource,
+		}).Error; err != nil {
+			return err
+		}
+		cart.TaxCountry, cart.TaxCountrySource = country, location.CountrySource
+	}
+	return nil
+}
+
+// overrides reports whether a value from source may replace one from
+// current: only the visitor's own choice replaces their choice
+func overrides(current, source string) bool {
+	return current != SourceUser || source == SourceUser
+}
+
+// switchCurrency moves a cart to another currency, dropping its bundles
+// and repricing its items, and records where the currency came from
+func (s *CartService) switchCurrency(cart *domain.Cart, currency, source string) error {
+	if cart.Currency == currency {
+		if cart.CurrencySource == source {
+			return nil
+		}
+		cart.CurrencySource = source
+		return s.db.Model(cart).Update("currency_source", source).Error
+	}
+	if err := s.db.Model(cart).Updates(map[string]interface{}{
+		"currency":        currency,
+		"currency_source": source,
+	}).Error; err != nil {
+		return err
+	}
+	cart.Currency, cart.CurrencySource = currency, source
+	if err := removeBundles(s.db, cart.ID); err != nil {
+		return err
+	}
+	return s.repriceItems(cart)
+}
+
+// repriceItems prices the items of a cart at its currency and customer.
+// Bundle items keep their bundle prices. Items whose product has no
+// pricing in the currency of the cart are removed.
+func (s *CartService) repriceItems(cart *domain.Cart) error {
+	var items []domain.CartItem
+	if err := s.db.Preload("Product.ConfigGroups.Options.SubOptions").
+		Where("cart_id = ? AND bundle_id IS NULL", cart.ID).Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		pricing, err := s.loadPricing(items[i].ProductID, cart)
+		if errors.Is(err, ErrPricingNotFound) {
+			if err := s.RemoveItem(items[i].ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		priceCartItem(&items[i], pricing, items[i].Product)
+		if err := s.db.Omit(clause.Associations).Save(&items[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeBundles removes the items added from bundles to a cart
+func removeBundles(db *gorm.DB, cartID uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		items := tx.Model(&domain.CartItem{}).Select("id").Where("cart_id = ? AND bundle_id IS NOT NULL", cartID)
+		if err := tx.Where("cart_item_id IN (?)", items).Delete(&domain.ConfigStockReservation{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("cart_id = ? AND bundle_id IS NOT NULL", cartID).Delete(&domain.CartItem{}).Error
+	})
 }
 
 // CleanupExpiredCarts removes expired carts
@@ -338,18 +705,102 @@ func (s *CartService) CleanupExpiredCarts() error {
 	}
 
 	for _, cart := range carts {
+		releaseCartStock(s.db, cart.ID)
 		s.db.Delete(&domain.CartItem{}, "cart_id = ?", cart.ID)
 		s.db.Delete(&cart)
 	}
 
-	return nil
+	// Reservations of carts that were left behind no longer count against
+	// stock once expired
+	return s.db.Where("expires_at < ?", time.Now()).Delete(&domain.ConfigStockReservation{}).Error
+}
+
+// loadPricing returns the pricing of a product in the currency of a cart
+// with its tiers, at the prices of the customer's groups
+func (s *CartService) loadPricing(productID uint64, cart *domain.Cart) (*domain.ProductPricing, error) {
+	var pricing domain.ProductPricing
+	if err := s.db.Preload("Tiers").Where("product_id = ? AND currency = ?", productID, cart.Currency).First(&pricing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPricingNotFound
+		}
+		return nil, err
+	}
+	if err := customergroup.ApplyPrices(s.db, cartCustomer(cart), &pricing); err != nil {
+		return nil, err
+	}
+	return &pricing, nil
+}
+
+// cartCustomer returns the customer of a cart, 0 for a guest
+func cartCustomer(cart *domain.Cart) uint64 {
+	if cart.CustomerID == nil {
+		return 0
+	}
+	return *cart.CustomerID
+}
+
+// priceCartItem sets the fees of a cart item from the product pricing.
+// Quantity breaks and term promotions lower the recurring fee, while first
+// term promotions are kept in PromoDiscount so they only reach the first
+// invoice.
+func priceCartItem(item *domain.CartItem, pricing *domain.ProductPricing, product domain.Product) {
+	tiered := pricing.TieredPrice(item.BillingCycle, item.Quantity, time.Now())
+	optionSetup, optionRecurring := calculateConfigOptionPricing(product, item.BillingCycle, item.ConfigOptions)
+
+	item.SetupFee = pricing.SetupFee.Add(optionSetup)
+	item.RecurringFee = tiered.UnitPrice.Add(optionRecurring)
+	item.PromoDiscount = tiered.FirstTermDiscount.Mul(decimal.NewFromInt(int64(item.Quantity)))
+	item.Savings = nil
+	if len(tiered.Savings) > 0 {
+		item.Savings = domain.JSONMap{}
+		for _, saving := range tiered.Savings {
+			item.Savings[saving.Label] = saving.Amount.String()
+		}
+	}
+
+	subtotal := cartItemSubtotal(*item)
+	if item.Discount.GreaterThan(subtotal) {
+		item.Discount = subtotal
+	}
+	item.Total = subtotal.Sub(item.Discount)
+}
+
+// cartItemSubtotal returns the first term price of a cart item before
+// coupon discounts
+func cartItemSubtotal(item domain.CartItem) decimal.Decimal {
+	return item.SetupFee.Add(item.RecurringFee.Mul(decimal.NewFromInt(int64(item.Quantity)))).Sub(item.PromoDiscount)
+}
+
+// cartItemSavings returns the pricing tier savings of a cart item sorted by
+// label
+func cartItemSavings(item domain.CartItem) []domain.PriceSaving {
+	savings := make([]domain.PriceSaving, 0, len(item.Savings))
+	for label, value := range item.Savings {
+		amount, err := decimal.NewFromString(fmt.Sprint(value))
+		if err != nil {
+			continue
+		}
+		savings = append(savings, domain.PriceSaving{Label: label, Amount: amount})
+	}
+	sort.Slice(savings, func(i, j int) bool { return savings[i].Label < savings[j].Label })
+	return savings
 }
 
 func calculateConfigOptionPricing(product domain.Product, billingCycle string, configOptions domain.JSONMap) (decimal.Decimal, decimal.Decimal) {
 	optionSetup := decimal.Zero
 	optionRecurring := decimal.Zero
+	for _, subOption := range selectedSubOptions(product, configOptions) {
+		optionSetup = optionSetup.Add(subOption.Pricing.SetupFee)
+		optionRecurring = optionRecurring.Add(priceForCycle(subOption.Pricing, billingCycle))
+	}
+	return optionSetup, optionRecurring
+}
+
+// selectedSubOptions returns the sub-options of a product chosen in a cart
+// item's config options, which map option IDs to sub-option IDs
+func selectedSubOptions(product domain.Product, configOptions domain.JSONMap) []domain.ConfigSubOption {
 	if len(configOptions) == 0 {
-		return optionSetup, optionRecurring
+		return nil
 	}
 
 	selectedOptions := map[uint64]uint64{}
@@ -365,6 +816,7 @@ func calculateConfigOptionPricing(product domain.Product, billingCycle string, c
 		selectedOptions[optionID] = subOptionID
 	}
 
+	var selected []domain.ConfigSubOption
 	for _, group := range product.ConfigGroups {
 		for _, option := range group.Options {
 			subOptionID, ok := selectedOptions[option.ID]
@@ -372,16 +824,13 @@ func calculateConfigOptionPricing(product domain.Product, billingCycle string, c
 				continue
 			}
 			for _, subOption := range option.SubOptions {
-				if subOption.ID != subOptionID {
-					continue
+				if subOption.ID == subOptionID {
+					selected = append(selected, subOption)
 				}
-				optionSetup = optionSetup.Add(subOption.Pricing.SetupFee)
-				optionRecurring = optionRecurring.Add(priceForCycle(subOption.Pricing, billingCycle))
 			}
 		}
 	}
-
-	return optionSetup, optionRecurring
+	return selected
 }
 
 func priceForCycle(pricing domain.Pricing, billingCycle string) decimal.Decimal {
@@ -442,25 +891,35 @@ func parseJSONNumber(value any) (uint64, bool) {
 
 // CartSummary represents a summary of cart contents
 type CartSummary struct {
-	CartID        uint64            `json:"cart_id"`
-	Currency      string            `json:"currency"`
-	Items         []CartItemSummary `json:"items"`
-	Subtotal      decimal.Decimal   `json:"subtotal"`
-	TotalDiscount decimal.Decimal   `json:"total_discount"`
-	Tax           decimal.Decimal   `json:"tax"`
-	Total         decimal.Decimal   `json:"total"`
-	CouponCode    string            `json:"coupon_code,omitempty"`
+	CartID           uint64            `json:"cart_id"`
+	Currency         string            `json:"currency"`
+	CurrencySource   string            `json:"currency_source"`
+	TaxCountry       string            `json:"tax_country,omitempty"`
+	TaxCountrySource string            `json:"tax_country_source,omitempty"`
+	Items            []CartItemSummary `json:"items"`
+	Subtotal         decimal.Decimal   `json:"subtotal"`
+	TotalDiscount    decimal.Decimal   `json:"total_discount"`
+	TotalSavings     decimal.Decimal   `json:"total_savings"`
+	Tax              decimal.Decimal   `json:"tax"`
+	TaxEstimated     bool              `json:"tax_estimated"` // Guest tax of the presumed country
+	Total            decimal.Decimal   `json:"total"`
+	CouponCode       string            `json:"coupon_code,omitempty"`
 }
 
 // CartItemSummary represents a summary of a cart item
 type CartItemSummary struct {
-	ID           uint64          `json:"id"`
-	ProductID    uint64          `json:"product_id"`
-	ProductName  string          `json:"product_name"`
-	Quantity     int             `json:"quantity"`
-	BillingCycle string          `json:"billing_cycle"`
-	SetupFee     decimal.Decimal `json:"setup_fee"`
-	RecurringFee decimal.Decimal `json:"recurring_fee"`
-	Discount     decimal.Decimal `json:"discount"`
-	Total        decimal.Decimal `json:"total"`
+	ID            uint64               `json:"id"`
+	ProductID     uint64               `json:"product_id"`
+	ProductName   string               `json:"product_name"`
+	Quantity      int                  `json:"quantity"`
+	BillingCycle  string               `json:"billing_cycle"`
+	SetupFee      decimal.Decimal      `json:"setup_fee"`
+	RecurringFee  decimal.Decimal      `json:"recurring_fee"`
+	Discount      decimal.Decimal      `json:"discount"`
+	PromoDiscount decimal.Decimal      `json:"promo_discount"`
+	Savings       []domain.PriceSaving `json:"savings,omitempty"`
+	Total         decimal.Decimal      `json:"total"`
+	BundleID      *uint64              `json:"bundle_id,omitempty"`
+	BundleName    string               `json:"bundle_name,omitempty"`
+	BundleKey     string               `json:"bundle_key,omitempty"`
 }
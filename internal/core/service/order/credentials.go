@@ -0,0 +1,58 @@
+package order
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// ServiceCredentials are the login details of a service
+type ServiceCredentials struct {
+	Username string
+	Password string
+}
+
+// RevealCredentials returns the login details of a service in plain text
+// and records in the audit log who saw them, from where
+func (s *Service) RevealCredentials(serviceID, viewerID uint64, ipAddress, userAgent string) (*ServiceCredentials, error) {
+	var service domain.Service
+	if err := s.db.Select("id", "username", "password").First(&service, serviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceNotFound
+		}
+		return nil, err
+	}
+
+	entry := domain.AuditLog{
+		UserID:      &viewerID,
+		Action:      domain.AuditActionCredentialsRevealed,
+		EntityType:  "service",
+		EntityID:    &service.ID,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Description: "Service password revealed",
+	}
+	// Credentials are not shown unless the reveal is recorded
+	if err := s.db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &ServiceCredentials{Username: service.Username, Password: string(service.Password)}, nil
+}
+
+// ListCredentialReveals returns who revealed the credentials of a
+// service, newest first
+func (s *Service) ListCredentialReveals(serviceID uint64, limit, offset int) ([]domain.AuditLog, int64, error) {
+	query := s.db.Model(&domain.AuditLog{}).
+		Where("action = ? AND entity_type = ? AND entity_id = ?", domain.AuditActionCredentialsRevealed, "service", serviceID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []domain.AuditLog
+	if err := query.Preload("User").Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,436 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/addon"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/payment"
+	"github.com/openhost/openhost/internal/core/service/pricing"
+)
+
+var (
+	ErrServiceNotActive    = errors.New("only active services can change billing cycle")
+	ErrServiceOverdue      = errors.New("service must be renewed before changing billing cycle")
+	ErrServiceCancelling   = errors.New("service is scheduled for cancellation")
+	ErrSameBillingCycle    = errors.New("service is already on this billing cycle")
+	ErrCycleChangePending  = errors.New("a billing cycle change is already pending for this service")
+	ErrCycleChangeNotFound = errors.New("billing cycle change not found")
+)
+
+// QuoteCycleChange prices switching a customer's service to another billing
+// cycle without changing anything
+func (s *Service) QuoteCycleChange(customerID, serviceID uint64, billingCycle string) (*CycleQuote, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCycleChange(service, billingCycle); err != nil {
+		return nil, err
+	}
+	return s.quoteCycleChange(service, billingCycle, time.Now())
+}
+
+// ChangeBillingCycle switches a customer's active service to another
+// billing cycle. The unused part of the current period is credited against
+// a full period of the new cycle starting now, and the difference is
+// invoiced. The service keeps its cycle, amount and due date until the
+// adjustment invoice is paid; when nothing is due the change is applied
+// straight away and any excess credit is added to the account balance.
+func (s *Service) ChangeBillingCycle(customerID, serviceID uint64, billingCycle string) (*domain.CycleChange, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCycleChange(service, billingCycle); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	quote, err := s.quoteCycleChange(service, billingCycle, now)
+	if err != nil {
+		return nil, err
+	}
+
+	addonAmounts := domain.JSONMap{}
+	for id, amount := range quote.AddonAmounts {
+		addonAmounts[fmt.Sprint(id)] = amount.String()
+	}
+	change := &domain.CycleChange{
+		ServiceID:      service.ID,
+		CustomerID:     service.CustomerID,
+		Status:         domain.CycleChangeStatusPending,
+		FromCycle:      service.BillingCycle,
+		ToCycle:        quote.BillingCycle,
+		OldAmount:      quote.OldAmount,
+		NewAmount:      quote.NewAmount,
+		AddonAmounts:   addonAmounts,
+		Credit:         quote.Credit,
+		Charge:         quote.Charge,
+		AmountDue:      quote.AmountDue,
+		AccountCredit:  quote.AccountCredit,
+		PreviousDueAt:  service.NextDueDate,
+		NewNextDueDate: quote.NextDueDate,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		if !quote.AmountDue.IsPositive() {
+			return applyCycleChange(tx, change, now)
+		}
+
+		periodEnd := quote.NextDueDate
+		items := []invoice.InvoiceItemRequest{
+			{
+				ServiceID: &service.ID,
+				Type:      "cycle_change",
+				Description: fmt.Sprintf("%s - %s billing (%s to %s)", service.Product.Name, quote.BillingCycle,
+					now.Format("Jan 2, 2006"), periodEnd.Format("Jan 2, 2006")),
+				Quantity:    decimal.NewFromInt(1),
+				UnitPrice:   quote.Charge,
+				Taxable:     true,
+				PeriodStart: &now,
+				PeriodEnd:   &periodEnd,
+			},
+		}
+		if quote.Credit.IsPositive() {
+			items = append(items, invoice.InvoiceItemRequest{
+				ServiceID: &service.ID,
+				Type:      "cycle_change",
+				Description: fmt.Sprintf("%s - unused %s period credit (%s to %s)", service.Product.Name, service.BillingCycle,
+					now.Format("Jan 2, 2006"), service.NextDueDate.Format("Jan 2, 2006")),
+				Quantity:  decimal.NewFromInt(1),
+				UnitPrice: quote.Credit.Neg(),
+				Taxable:   true,
+			})
+		}
+		inv, err := invoice.NewService(tx).CreateInvoice(service.CustomerID, service.Currency, now, items)
+		if err != nil {
+			return err
+		}
+		change.InvoiceID = &inv.ID
+		return tx.Model(change).Update("invoice_id", inv.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getCycleChange(change.ID)
+}
+
+// GetCycleChange returns the latest billing cycle change of a customer's
+// service
+func (s *Service) GetCycleChange(customerID, serviceID uint64) (*domain.CycleChange, error) {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return nil, err
+	}
+
+	var change domain.CycleChange
+	result := s.db.Preload("Invoice").Where("service_id = ?", serviceID).
+		Order("created_at DESC, id DESC").Limit(1).Find(&change)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCycleChangeNotFound
+	}
+	return &change, nil
+}
+
+// CancelCycleChange withdraws the pending billing cycle change of a
+// customer's service along with its unpaid adjustment invoice
+func (s *Service) CancelCycleChange(customerID, serviceID uint64) error {
+	if _, err := s.customerService(customerID, serviceID); err != nil {
+		return err
+	}
+
+	var change domain.CycleChange
+	result := s.db.Preload("Invoice").
+		Where("service_id = ? AND status = ?", serviceID, domain.CycleChangeStatusPending).
+		Limit(1).Find(&change)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCycleChangeNotFound
+	}
+	// A paid change is about to be applied and can no longer be withdrawn
+	if change.Invoice != nil && change.Invoice.Status == domain.InvoiceStatusPaid {
+		return ErrCycleChangePending
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return cancelCycleChange(tx, &change)
+	})
+}
+
+// ApplyCycleChanges applies the pending billing cycle changes whose
+// adjustment invoices have been paid. Changes still unpaid when the period
+// they credit ends, or whose invoice was cancelled, are cancelled. It
+// returns the number of changes applied.
+func (s *Service) ApplyCycleChanges(now time.Time) (int, error) {
+	var changes []domain.CycleChange
+	if err := s.db.Preload("Invoice").Where("status = ?", domain.CycleChangeStatusPending).
+		Order("created_at, id").Find(&changes).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for i := range changes {
+		change := &changes[i]
+		paid := change.Invoice != nil && change.Invoice.Status == domain.InvoiceStatusPaid
+		expired := change.Invoice == nil || change.Invoice.Status == domain.InvoiceStatusCancelled || !now.Before(change.PreviousDueAt)
+
+		var err error
+		switch {
+		case paid:
+			err = s.db.Transaction(func(tx *gorm.DB) error {
+				return applyCycleChange(tx, change, now)
+			})
+			if err == nil {
+				applied++
+			}
+		case expired:
+			err = s.db.Transaction(func(tx *gorm.DB) error {
+				return cancelCycleChange(tx, change)
+			})
+		}
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// MonitorCycleChanges applies paid billing cycle changes on the given
+// interval until ctx is cancelled
+func (s *Service) MonitorCycleChanges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.ApplyCycleChanges(time.Now()); err != nil {
+			log.Printf("failed to apply billing cycle changes: %v", err)
+		} else if n > 0 {
+			log.Printf("applied %d billing cycle change(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkCycleChange checks that a service can switch to a billing cycle
+func (s *Service) checkCycleChange(service *domain.Service, billingCycle string) error {
+	if service.Status != domain.ServiceStatusActive {
+		return ErrServiceNotActive
+	}
+	if pricing.NormalizeCycle(billingCycle) == pricing.NormalizeCycle(service.BillingCycle) {
+		return ErrSameBillingCycle
+	}
+	if !service.NextDueDate.After(time.Now()) {
+		return ErrServiceOverdue
+	}
+
+	var pending int64
+	if err := s.db.Model(&domain.CycleChange{}).
+		Where("service_id = ? AND status = ?", service.ID, domain.CycleChangeStatusPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return ErrCycleChangePending
+	}
+
+	var cancelling int64
+	if err := s.db.Model(&domain.CancellationRequest{}).
+		Where("service_id = ? AND status = ?", service.ID, domain.CancellationStatusApproved).
+		Count(&cancelling).Error; err != nil {
+		return err
+	}
+	if cancelling > 0 {
+		return ErrServiceCancelling
+	}
+	return nil
+}
+
+// quoteCycleChange prices a service and its recurring addons on a billing
+// cycle, crediting the part of the current period left at now
+func (s *Service) quoteCycleChange(service *domain.Service, billingCycle string, now time.Time) (*CycleQuote, error) {
+	billingCycle = pricing.NormalizeCycle(billingCycle)
+
+	var price domain.ProductPricing
+	result := s.db.Preload("Tiers").Where("product_id = ? AND currency = ?", service.ProductID, service.Currency).Limit(1).Find(&price)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !price.IsCycleEnabled(billingCycle) {
+		return nil, ErrInvalidBillingCycle
+	}
+
+	var product domain.Product
+	if err := s.db.Preload("ConfigGroups.Options.SubOptions").First(&product, service.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	_, optionRecurring := calculateConfigOptionPricing(product, billingCycle, service.ConfigSelection)
+
+	quote := &CycleQuote{
+		BillingCycle: billingCycle,
+		OldAmount:    service.RecurringAmount,
+		NewAmount:    price.TieredPrice(billingCycle, 1, now).UnitPrice.Add(optionRecurring),
+		AddonAmounts: map[uint64]decimal.Decimal{},
+		NextDueDate:  s.addBillingPeriod(now, billingCycle),
+	}
+	quote.Charge = quote.NewAmount
+
+	var addons []domain.ServiceAddon
+	if err := s.db.Preload("Addon").
+		Where("service_id = ? AND status IN ? AND billing_cycle <> ?", service.ID,
+			[]domain.ServiceStatus{domain.ServiceStatusActive, domain.ServiceStatusPending, domain.ServiceStatusSuspended}, domain.AddonTypeOneTime).
+		Order("id").Find(&addons).Error; err != nil {
+		return nil, err
+	}
+	for _, serviceAddon := range addons {
+		quantity := decimal.NewFromInt(int64(serviceAddon.Quantity))
+		amount := serviceAddon.Addon.CyclePrice(billingCycle)
+		quote.AddonAmounts[serviceAddon.ID] = amount
+		quote.OldAmount = quote.OldAmount.Add(serviceAddon.RecurringAmount.Mul(quantity))
+		quote.Charge = quote.Charge.Add(amount.Mul(quantity))
+	}
+
+	quote.Credit = quote.OldAmount.Mul(addon.ProrataFactor(service.NextDueDate, service.BillingCycle, now)).Round(2)
+	quote.AmountDue = quote.Charge.Sub(quote.Credit)
+	if quote.AmountDue.IsNegative() {
+		quote.AccountCredit = quote.AmountDue.Neg()
+		quote.AmountDue = decimal.Zero
+	}
+	return quote, nil
+}
+
+func (s *Service) customerService(customerID, serviceID uint64) (*domain.Service, error) {
+	var service domain.Service
+	result := s.db.Preload("Product").Where("id = ? AND customer_id = ?", serviceID, customerID).Limit(1).Find(&service)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return &service, nil
+}
+
+func (s *Service) getCycleChange(id uint64) (*domain.CycleChange, error) {
+	var change domain.CycleChange
+	if err := s.db.Preload("Invoice").First(&change, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCycleChangeNotFound
+		}
+		return nil, err
+	}
+	return &change, nil
+}
+
+// applyCycleChange moves a service and its recurring addons to the new
+// billing cycle, amount and due date of a change. Unpaid renewals of the
+// old cycle are cancelled and excess credit goes to the account balance.
+func applyCycleChange(tx *gorm.DB, change *domain.CycleChange, now time.Time) error {
+	// The status guard keeps a change from being applied twice
+	result := tx.Model(&domain.CycleChange{}).
+		Where("id = ? AND status = ?", change.ID, domain.CycleChangeStatusPending).
+		Updates(map[string]interface{}{
+			"status":       domain.CycleChangeStatusCompleted,
+			"completed_at": &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&domain.Service{}).Where("id = ?", change.ServiceID).
+		Updates(map[string]interface{}{
+			"billing_cycle":    change.ToCycle,
+			"recurring_amount": change.NewAmount,
+			"next_due_date":    change.NewNextDueDate,
+			"price_updated_at": &change.CreatedAt,
+		}).Error; err != nil {
+		return err
+	}
+
+	for id, value := range change.AddonAmounts {
+		amount, err := decimal.NewFromString(fmt.Sprint(value))
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.ServiceAddon{}).
+			Where("id = ? AND service_id = ? AND status NOT IN ?", id, change.ServiceID,
+				[]domain.ServiceStatus{domain.ServiceStatusCancelled, domain.ServiceStatusTerminated}).
+			Updates(map[string]interface{}{
+				"billing_cycle":    change.ToCycle,
+				"recurring_amount": amount,
+				"next_due_date":    change.NewNextDueDate,
+			}).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := invoice.CancelServiceRenewals(tx, change.ServiceID, change.PreviousDueAt); err != nil {
+		return err
+	}
+
+	change.Status = domain.CycleChangeStatusCompleted
+	change.CompletedAt = &now
+	if !change.AccountCredit.IsPositive() {
+		return nil
+	}
+	var service domain.Service
+	if err := tx.Select("id", "currency").First(&service, change.ServiceID).Error; err != nil {
+		return err
+	}
+	_, err := payment.NewService(tx).AddCredit(change.CustomerID, change.AccountCredit, service.Currency,
+		fmt.Sprintf("Unused credit from billing cycle change of service #%d", change.ServiceID), nil)
+	return err
+}
+
+// cancelCycleChange cancels a pending change and its unpaid invoice
+func cancelCycleChange(tx *gorm.DB, change *domain.CycleChange) error {
+	if err := tx.Model(change).Update("status", domain.CycleChangeStatusCancelled).Error; err != nil {
+		return err
+	}
+	if change.InvoiceID == nil {
+		return nil
+	}
+	return tx.Model(&domain.Invoice{}).
+		Where("id = ? AND status = ?", *change.InvoiceID, domain.InvoiceStatusUnpaid).
+		Update("status", domain.InvoiceStatusCancelled).Error
+}
+
+// CycleQuote is the price of switching a service to another billing cycle
+type CycleQuote struct {
+	BillingCycle  string
+	OldAmount     decimal.Decimal            // Recurring amount of the service and its addons on the current cycle
+	NewAmount     decimal.Decimal            // Recurring amount of the service on the new cycle
+	AddonAmounts  map[uint64]decimal.Decimal // Per unit amounts of recurring addons on the new cycle
+	Credit        decimal.Decimal            // Unused part of the current period
+	Charge        decimal.Decimal            // First period of the new cycle, addons included
+	AmountDue     decimal.Decimal            // Before tax
+	AccountCredit decimal.Decimal            // Credit left over when it exceeds the charge
+	NextDueDate   time.Time
+}
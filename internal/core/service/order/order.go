@@ -1,14 +1,21 @@
 package order
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/address"
+	"github.com/openhost/openhost/internal/core/service/affiliate"
+	"github.com/openhost/openhost/internal/core/service/coupon"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/numbering"
+	"github.com/openhost/openhost/internal/core/service/stock"
 	"github.com/openhost/openhost/internal/core/service/tax"
 )
 
@@ -23,18 +30,37 @@ var (
 
 // Service provides order management operations
 type Service struct {
-	db *gorm.DB
+	db             *gorm.DB
+	addressService *address.Service
 }
 
 // NewService creates a new order service
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, addressService: address.NewService(db)}
 }
 
-// CreateOrder creates a new order from cart items
-func (s *Service) CreateOrder(customerID uint64, cartID uint64, ipAddress string) (*domain.Order, error) {
+// WithContext returns a copy of the service whose queries run with ctx,
+// such as the request context so slow queries are logged with its ID
+func (s *Service) WithContext(ctx context.Context) *Service {
+	clone := *s
+	clone.db = s.db.WithContext(ctx)
+	return &clone
+}
+
+// SetAddressService sets the service billing addresses are checked with at
+// checkout, such as one normalizing them with an external API
+func (s *Service) SetAddressService(addressService *address.Service) {
+	s.addressService = addressService
+}
+
+// CreateOrder creates a new order from cart items and records the
+// acceptance of the legal documents the customer agreed to at checkout.
+// Fields holds the values of the order fields, such as a purchase order
+// number, by field name. The customer's billing address must be valid for
+// their country, which sales must not be restricted or embargoed in.
+func (s *Service) CreateOrder(customerID uint64, cartID uint64, accepted []domain.LegalDocument, fields map[string]string, ipAddress, userAgent string) (*domain.Order, error) {
 	var cart domain.Cart
-	if err := s.db.Preload("Items.Product").Preload("Coupon").First(&cart, cartID).Error; err != nil {
+	if err := s.db.Preload("Items.Product.ConfigGroups.Options.SubOptions").Preload("Coupon").First(&cart, cartID).Error; err != nil {
 		return nil, err
 	}
 
@@ -42,6 +68,15 @@ func (s *Service) CreateOrder(customerID uint64, cartID uint64, ipAddress string
 		return nil, ErrCartEmpty
 	}
 
+	fieldValues, err := customfield.NewService(s.db).ValidateCheckoutValues(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addressService.CheckCustomer(context.Background(), customerID); err != nil {
+		return nil, err
+	}
+
 	// Calculate totals
 	subtotal := decimal.Zero
 	discount := decimal.Zero
@@ -49,8 +84,11 @@ func (s *Service) CreateOrder(customerID uint64, cartID uint64, ipAddress string
 
 	for _, item := range cart.Items {
 		itemTotal := item.SetupFee.Add(item.RecurringFee).Mul(decimal.NewFromInt(int64(item.Quantity)))
+		// First term promotions are charged as a discount on the order only,
+		// the service renews at the recurring fee
+		itemDiscount := item.Discount.Add(item.PromoDiscount)
 		subtotal = subtotal.Add(itemTotal)
-		discount = discount.Add(item.Discount)
+		discount = discount.Add(itemDiscount)
 
 		orderItems = append(orderItems, domain.OrderItem{
 			ProductID:     item.ProductID,
@@ -59,11 +97,13 @@ func (s *Service) CreateOrder(customerID uint64, cartID uint64, ipAddress string
 			BillingCycle:  item.BillingCycle,
 			SetupFee:      item.SetupFee,
 			RecurringFee:  item.RecurringFee,
-			Discount:      item.Discount,
-			Total:         itemTotal.Sub(item.Discount),
+			Discount:      itemDiscount,
+			Total:         itemTotal.Sub(itemDiscount),
 			ConfigOptions: item.ConfigOptions,
 			Domain:        item.Domain,
 			Hostname:      item.Hostname,
+			BundleID:      item.BundleID,
+			CustomFields:  item.CustomFields,
 		})
 	}
 
@@ -75,24 +115,62 @@ func (s *Service) CreateOrder(customerID uint64, cartID uint64, ipAddress string
 
 	total := taxableAmount.Add(taxAmount)
 
-	// Generate order number
-	orderNumber := s.generateOrderNumber()
-
 	order := &domain.Order{
-		OrderNumber: orderNumber,
-		CustomerID:  customerID,
-		Status:      domain.OrderStatusPending,
-		Currency:    cart.Currency,
-		Subtotal:    subtotal,
-		Discount:    discount,
-		TaxAmount:   taxAmount,
-		Total:       total,
-		CouponID:    cart.CouponID,
-		IPAddress:   ipAddress,
-		Items:       orderItems,
+		CustomerID: customerID,
+		Status:     domain.OrderStatusPending,
+		Currency:   cart.Currency,
+		Subtotal:   subtotal,
+		Discount:   discount,
+		TaxAmount:  taxAmount,
+		Total:      total,
+		CouponID:   cart.CouponID,
+		IPAddress:  ipAddress,
+		Items:      orderItems,
 	}
 
-	if err := s.db.Create(order).Error; err != nil {
+	// Product stock is reserved and config option reservations are renewed
+	// in case the cart outlived them, then held by the order until it is
+	// completed or cancelled
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		itemIDs := make([]uint64, 0, len(cart.Items))
+		for i := range cart.Items {
+			item := &cart.Items[i]
+			if err := stock.NewService(tx).Reserve(item.ProductID, item.Quantity); err != nil {
+				return productOutOfStock(item.Product, err)
+			}
+			if err := reserveStock(tx, item, item.Product, cart.ExpiresAt); err != nil {
+				return err
+			}
+			itemIDs = append(itemIDs, item.ID)
+		}
+		number, err := numbering.NewService(tx).Next(domain.NumberKindOrder, time.Now())
+		if err != nil {
+			return err
+		}
+		order.OrderNumber = number
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		if cart.Coupon != nil {
+			redeemed, err := coupon.Redeem(tx, cart.Coupon, customerID, order.ID, time.Now())
+			if err != nil {
+				return err
+			}
+			if !redeemed {
+				return ErrInvalidCoupon
+			}
+		}
+		if err := customfield.NewService(tx).CreateOrderValues(order.ID, fieldValues); err != nil {
+			return err
+		}
+		if len(accepted) > 0 {
+			if _, err := account.NewService(tx).AcceptDocuments(customerID, accepted, domain.ConsentContextCheckout, &order.ID, ipAddress, userAgent); err != nil {
+				return err
+			}
+		}
+		return holdStockForOrder(tx, itemIDs, order.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -164,10 +242,37 @@ func (s *Service) ListAllOrders(status domain.OrderStatus, limit, offset int) ([
 	return orders, total, nil
 }
 
-// UpdateOrderStatus updates the status of an order
+// UpdateOrderStatus updates the status of an order. Stock held by the order
+// is taken when it becomes active or completed and released when it is
+// cancelled or marked as fraud. An order becoming active or completed also
+// converts the affiliate referral of its customer.
 func (s *Service) UpdateOrderStatus(orderID uint64, status domain.OrderStatus) error {
-	return s.db.Model(&domain.Order{}).Where("id = ?", orderID).
-		Update("status", status).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var order domain.Order
+		if err := tx.Preload("Items").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		wasPending := order.Status == domain.OrderStatusPending
+		if err := tx.Model(&order).Update("status", status).Error; err != nil {
+			return err
+		}
+		if !wasPending {
+			return nil
+		}
+		switch status {
+		case domain.OrderStatusActive, domain.OrderStatusCompleted:
+			if err := consumeOrderStock(tx, &order); err != nil {
+				return err
+			}
+			return affiliate.NewService(tx).AttributeOrder(&order, time.Now())
+		case domain.OrderStatusCancelled, domain.OrderStatusFraud:
+			return releaseOrderStock(tx, &order)
+		}
+		return nil
+	})
 }
 
 // ActivateOrder activates an order and creates services
@@ -179,29 +284,53 @@ func (s *Service) ActivateOrder(orderID uint64) error {
 
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		for i, item := range order.Items {
-			// Create service for each order item
-			service := &domain.Service{
-				CustomerID:       order.CustomerID,
-				ProductID:        item.ProductID,
-				OrderID:          &order.ID,
-				Status:           domain.ServiceStatusPending,
-				Domain:           item.Domain,
-				Hostname:         item.Hostname,
-				BillingCycle:     item.BillingCycle,
-				Currency:         order.Currency,
-				RecurringAmount:  item.RecurringFee,
-				NextDueDate:      s.calculateNextDueDate(item.BillingCycle),
-				RegistrationDate: time.Now(),
-				ConfigSelection:  item.ConfigOptions,
+			// Create service for each order item. Bundles provision a
+			// service for every unit of their products, the order item
+			// keeps the first one.
+			units := 1
+			if item.BundleID != nil && item.Quantity > 1 {
+				units = item.Quantity
 			}
 
-			if err := tx.Create(service).Error; err != nil {
-				return err
+			for unit := 0; unit < units; unit++ {
+				service := &domain.Service{
+					CustomerID:       order.CustomerID,
+					ProductID:        item.ProductID,
+					OrderID:          &order.ID,
+					Status:           domain.ServiceStatusPending,
+					Domain:           item.Domain,
+					Hostname:         item.Hostname,
+					BillingCycle:     item.BillingCycle,
+					Currency:         order.Currency,
+					RecurringAmount:  item.RecurringFee,
+					NextDueDate:      s.calculateNextDueDate(item.BillingCycle),
+					RegistrationDate: time.Now(),
+					ConfigSelection:  item.ConfigOptions,
+				}
+
+				if err := tx.Create(service).Error; err != nil {
+					return err
+				}
+				if err := customfield.NewService(tx).CreateServiceValues(service.ID, item.ProductID, item.CustomFields); err != nil {
+					return err
+				}
+				if unit > 0 {
+					continue
+				}
+
+				// Update order item with service ID
+				order.Items[i].ServiceID = &service.ID
+				if err := tx.Model(&order.Items[i]).Update("service_id", service.ID).Error; err != nil {
+					return err
+				}
 			}
+		}
 
-			// Update order item with service ID
-			order.Items[i].ServiceID = &service.ID
-			if err := tx.Model(&order.Items[i]).Update("service_id", service.ID).Error; err != nil {
+		if order.Status == domain.OrderStatusPending {
+			if err := consumeOrderStock(tx, &order); err != nil {
+				return err
+			}
+			if err := affiliate.NewService(tx).AttributeOrder(&order, time.Now()); err != nil {
 				return err
 			}
 		}
@@ -214,14 +343,21 @@ func (s *Service) ActivateOrder(orderID uint64) error {
 // CancelOrder cancels an order
 func (s *Service) CancelOrder(orderID uint64, reason string) error {
 	var order domain.Order
-	if err := s.db.First(&order, orderID).Error; err != nil {
+	if err := s.db.Preload("Items").First(&order, orderID).Error; err != nil {
 		return ErrOrderNotFound
 	}
 
-	return s.db.Model(&order).Updates(map[string]interface{}{
-		"status":      domain.OrderStatusCancelled,
-		"admin_notes": reason,
-	}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if order.Status == domain.OrderStatusPending {
+			if err := releaseOrderStock(tx, &order); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&order).Updates(map[string]interface{}{
+			"status":      domain.OrderStatusCancelled,
+			"admin_notes": reason,
+		}).Error
+	})
 }
 
 // GetService retrieves a service by ID
@@ -242,13 +378,20 @@ func (s *Service) ListServices(customerID uint64, status domain.ServiceStatus, l
 	var services []domain.Service
 	var total int64
 
-	query := s.db.Model(&domain.Service{}).Where("customer_id = ?", customerID)
+	query := s.db.Model(&domain.Service{}).Where("services.customer_id = ?", customerID)
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("services.status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
 	}
-	query.Count(&total)
 
-	if err := query.Preload("Product").Order("created_at DESC").
+	// Product and IP are joined into the same query and only the columns
+	// shown in listings are loaded
+	if err := query.Select(serviceListColumns).
+		Joins("Product", s.db.Select("id", "name")).
+		Joins("IPAddress", s.db.Select("id", "ip")).
+		Order("services.created_at DESC").
 		Limit(limit).Offset(offset).Find(&services).Error; err != nil {
 		return nil, 0, err
 	}
@@ -256,32 +399,69 @@ func (s *Service) ListServices(customerID uint64, status domain.ServiceStatus, l
 	return services, total, nil
 }
 
-// SuspendService suspends a service
+// serviceListColumns are the service columns needed to render a listing.
+// Credentials, notes and plugin configuration are only loaded by GetService.
+var serviceListColumns = []string{
+	"services.id", "services.customer_id", "services.product_id", "services.ip_address_id",
+	"services.status", "services.domain", "services.hostname", "services.billing_cycle",
+	"services.currency", "services.recurring_amount", "services.next_due_date",
+	"services.registration_date", "services.created_at", "services.updated_at",
+}
+
+// SuspendService suspends a service and the addons set to suspend with it
 func (s *Service) SuspendService(serviceID uint64, reason string) error {
-	return s.db.Model(&domain.Service{}).Where("id = ?", serviceID).
-		Updates(map[string]interface{}{
-			"status":            domain.ServiceStatusSuspended,
-			"suspension_reason": reason,
-		}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Service{}).Where("id = ?", serviceID).
+			Updates(map[string]interface{}{
+				"status":            domain.ServiceStatusSuspended,
+				"suspension_reason": reason,
+			}).Error; err != nil {
+			return err
+		}
+		return setParentAddonStatus(tx, serviceID, domain.ServiceStatusActive, domain.ServiceStatusSuspended)
+	})
 }
 
-// UnsuspendService unsuspends a service
+// UnsuspendService unsuspends a service and the addons suspended with it
 func (s *Service) UnsuspendService(serviceID uint64) error {
-	return s.db.Model(&domain.Service{}).Where("id = ?", serviceID).
-		Updates(map[string]interface{}{
-			"status":            domain.ServiceStatusActive,
-			"suspension_reason": "",
-		}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Service{}).Where("id = ?", serviceID).
+			Updates(map[string]interface{}{
+				"status":            domain.ServiceStatusActive,
+				"suspension_reason": "",
+			}).Error; err != nil {
+			return err
+		}
+		return setParentAddonStatus(tx, serviceID, domain.ServiceStatusSuspended, domain.ServiceStatusActive)
+	})
+}
+
+// setParentAddonStatus moves the addons of a service that follow the
+// suspension of their parent from one status to another
+func setParentAddonStatus(tx *gorm.DB, serviceID uint64, from, to domain.ServiceStatus) error {
+	return tx.Model(&domain.ServiceAddon{}).
+		Where("service_id = ? AND status = ?", serviceID, from).
+		Where("addon_id IN (?)", tx.Model(&domain.ProductAddon{}).Select("id").Where("suspend_parent = ?", true)).
+		Update("status", to).Error
 }
 
 // TerminateService terminates a service
 func (s *Service) TerminateService(serviceID uint64) error {
 	now := time.Now()
-	return s.db.Model(&domain.Service{}).Where("id = ?", serviceID).
-		Updates(map[string]interface{}{
-			"status":           domain.ServiceStatusTerminated,
-			"termination_date": &now,
-		}).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Service{}).Where("id = ?", serviceID).
+			Updates(map[string]interface{}{
+				"status":           domain.ServiceStatusTerminated,
+				"termination_date": &now,
+			}).Error; err != nil {
+			return err
+		}
+		// Addons never outlive their parent service
+		return tx.Model(&domain.ServiceAddon{}).
+			Where("service_id = ? AND status NOT IN ?", serviceID,
+				[]domain.ServiceStatus{domain.ServiceStatusCancelled, domain.ServiceStatusTerminated}).
+			Update("status", domain.ServiceStatusTerminated).Error
+	})
 }
 
 // RenewService extends the next due date for a service
@@ -297,13 +477,23 @@ func (s *Service) RenewService(serviceID uint64) error {
 		nextDueDate = s.addBillingPeriod(service.NextDueDate, service.BillingCycle)
 	}
 
-	return s.db.Model(&service).Update("next_due_date", nextDueDate).Error
+	// Recurring addons stay on the due date of their parent service
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&service).Update("next_due_date", nextDueDate).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.ServiceAddon{}).
+			Where("service_id = ? AND billing_cycle <> ?", serviceID, domain.AddonTypeOneTime).
+			Update("next_due_date", nextDueDate).Error
+	})
 }
 
 // GetDueServices returns services due for renewal before the given date
 func (s *Service) GetDueServices(beforeDate time.Time, limit int) ([]domain.Service, error) {
 	var services []domain.Service
+	// Services with a scheduled cancellation are not renewed
 	if err := s.db.Where("status = ? AND next_due_date <= ?", domain.ServiceStatusActive, beforeDate).
+		Where("NOT EXISTS (SELECT 1 FROM cancellation_requests WHERE cancellation_requests.service_id = services.id AND cancellation_requests.status = ?)", domain.CancellationStatusApproved).
 		Preload("Product").Preload("Customer").
 		Limit(limit).Find(&services).Error; err != nil {
 		return nil, err
@@ -311,11 +501,6 @@ func (s *Service) GetDueServices(beforeDate time.Time, limit int) ([]domain.Serv
 	return services, nil
 }
 
-// generateOrderNumber generates a unique order number
-func (s *Service) generateOrderNumber() string {
-	return fmt.Sprintf("ORD-%d", time.Now().UnixNano())
-}
-
 // calculateNextDueDate calculates the next due date based on billing cycle
 func (s *Service) calculateNextDueDate(billingCycle string) time.Time {
 	return s.addBillingPeriod(time.Now(), billingCycle)
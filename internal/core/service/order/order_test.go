@@ -0,0 +1,103 @@
+package order
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// benchRows is the number of services listed by the benchmarks
+const benchRows = 10000
+
+// BenchmarkListServices compares loading the product and IP of each listed
+// service one row at a time, preloading them, and joining them as
+// ListServices does
+func BenchmarkListServices(b *testing.B) {
+	db := testutil.OpenDB(b)
+	now := time.Now()
+
+	product := &domain.Product{ProductGroupID: 1, Name: "VPS", Slug: "vps", ModuleName: "mock"}
+	if err := db.Create(product).Error; err != nil {
+		b.Fatal(err)
+	}
+	ips := make([]domain.IPAddress, benchRows)
+	for i := range ips {
+		ips[i] = domain.IPAddress{SubnetID: 1, IP: fmt.Sprintf("10.%d.%d.%d", i>>16, (i>>8)&0xff, i&0xff)}
+	}
+	if err := db.CreateInBatches(ips, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+	services := make([]domain.Service, benchRows)
+	for i := range services {
+		services[i] = domain.Service{
+			CustomerID:       1,
+			ProductID:        product.ID,
+			IPAddressID:      &ips[i].ID,
+			Status:           domain.ServiceStatusActive,
+			Hostname:         fmt.Sprintf("host%d.example.com", i),
+			Currency:         "USD",
+			RecurringAmount:  decimal.NewFromInt(10),
+			NextDueDate:      now,
+			RegistrationDate: now,
+			ConfigSelection:  domain.JSONMap{},
+			PluginConfig:     domain.PluginConfig{},
+			Notes:            "notes kept out of listings",
+		}
+	}
+	if err := db.CreateInBatches(services, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	service := NewService(db)
+	b.Run("per_row", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var listed []domain.Service
+			if err := db.Where("customer_id = ?", 1).Order("created_at DESC").Limit(benchRows).Find(&listed).Error; err != nil {
+				b.Fatal(err)
+			}
+			for j := range listed {
+				if err := db.First(&listed[j].Product, listed[j].ProductID).Error; err != nil {
+					b.Fatal(err)
+				}
+				listed[j].IPAddress = &domain.IPAddress{}
+				if err := db.First(listed[j].IPAddress, *listed[j].IPAddressID).Error; err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+	b.Run("preload", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var listed []domain.Service
+			if err := db.Where("customer_id = ?", 1).Preload("Product").Preload("IPAddress").
+				Order("created_at DESC").Limit(benchRows).Find(&listed).Error; err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+	b.Run("joins", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listed, _, err := service.ListServices(1, "", benchRows, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(listed) != benchRows || listed[0].IPAddress == nil || listed[0].Product.Name != "VPS" {
+				b.Fatalf("listed %d services without their relations", len(listed))
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+}
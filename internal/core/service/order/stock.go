@@ -0,0 +1,158 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/stock"
+)
+
+// ErrOutOfStock is matched by every OutOfStockError
+var ErrOutOfStock = errors.New("out of stock")
+
+// OutOfStockError reports a product or stock controlled sub-option without
+// enough stock left for a cart item
+type OutOfStockError struct {
+	ProductID   uint64
+	SubOptionID uint64
+	Name        string
+	Message     string
+}
+
+func (e *OutOfStockError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s is out of stock", e.Name)
+}
+
+func (e *OutOfStockError) Is(target error) bool {
+	return target == ErrOutOfStock
+}
+
+// productOutOfStock converts a stock service error for a product into an
+// OutOfStockError naming it
+func productOutOfStock(product domain.Product, err error) error {
+	var stockErr *stock.OutOfStockError
+	if errors.As(err, &stockErr) {
+		return &OutOfStockError{ProductID: product.ID, Name: product.Name, Message: stockErr.Message}
+	}
+	return err
+}
+
+// AvailableStock returns the stock of a sub-option that is not reserved by
+// carts or pending orders
+func AvailableStock(db *gorm.DB, subOption *domain.ConfigSubOption, now time.Time) (int, error) {
+	var reserved int64
+	if err := db.Model(&domain.ConfigStockReservation{}).
+		Where("sub_option_id = ? AND (expires_at IS NULL OR expires_at > ?)", subOption.ID, now).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error; err != nil {
+		return 0, err
+	}
+	return subOption.StockQuantity - int(reserved), nil
+}
+
+// reserveStock replaces the reservations of a cart item with reservations
+// for its current quantity. The sub-option rows are locked so concurrent
+// carts cannot reserve the same units.
+func reserveStock(tx *gorm.DB, item *domain.CartItem, product domain.Product, expiresAt time.Time) error {
+	if err := tx.Where("cart_item_id = ?", item.ID).Delete(&domain.ConfigStockReservation{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, selected := range selectedSubOptions(product, item.ConfigOptions) {
+		if !selected.StockControl {
+			continue
+		}
+
+		var subOption domain.ConfigSubOption
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subOption, selected.ID).Error; err != nil {
+			return err
+		}
+		available, err := AvailableStock(tx, &subOption, now)
+		if err != nil {
+			return err
+		}
+		if available < item.Quantity {
+			return &OutOfStockError{SubOptionID: subOption.ID, Name: subOption.Name, Message: subOption.OutOfStockMsg}
+		}
+
+		reservation := &domain.ConfigStockReservation{
+			SubOptionID: subOption.ID,
+			CartItemID:  &item.ID,
+			Quantity:    item.Quantity,
+			ExpiresAt:   &expiresAt,
+		}
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseCartStock drops the reservations of every item in a cart
+func releaseCartStock(db *gorm.DB, cartID uint64) error {
+	return db.Where("cart_item_id IN (?)",
+		db.Model(&domain.CartItem{}).Select("id").Where("cart_id = ?", cartID)).
+		Delete(&domain.ConfigStockReservation{}).Error
+}
+
+// extendCartStock moves the expiry of the reservations of a cart
+func extendCartStock(tx *gorm.DB, cartID uint64, expiresAt time.Time) error {
+	return tx.Model(&domain.ConfigStockReservation{}).
+		Where("cart_item_id IN (?)", tx.Model(&domain.CartItem{}).Select("id").Where("cart_id = ?", cartID)).
+		Update("expires_at", expiresAt).Error
+}
+
+// holdStockForOrder moves the reservations of cart items to an order. They
+// no longer expire with the cart.
+func holdStockForOrder(tx *gorm.DB, cartItemIDs []uint64, orderID uint64) error {
+	if len(cartItemIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&domain.ConfigStockReservation{}).
+		Where("cart_item_id IN ?", cartItemIDs).
+		Updates(map[string]interface{}{
+			"order_id":     orderID,
+			"cart_item_id": nil,
+			"expires_at":   nil,
+		}).Error
+}
+
+// consumeOrderStock takes the product units and config sub-option units
+// held by a pending order out of stock
+func consumeOrderStock(tx *gorm.DB, order *domain.Order) error {
+	for _, item := range order.Items {
+		if err := stock.NewService(tx).Commit(item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	var reservations []domain.ConfigStockReservation
+	if err := tx.Where("order_id = ?", order.ID).Find(&reservations).Error; err != nil {
+		return err
+	}
+	for _, reservation := range reservations {
+		if err := tx.Model(&domain.ConfigSubOption{}).Where("id = ?", reservation.SubOptionID).
+			Update("stock_quantity", gorm.Expr("stock_quantity - ?", reservation.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("order_id = ?", order.ID).Delete(&domain.ConfigStockReservation{}).Error
+}
+
+// releaseOrderStock returns the stock held by a pending order
+func releaseOrderStock(tx *gorm.DB, order *domain.Order) error {
+	for _, item := range order.Items {
+		if err := stock.NewService(tx).Release(item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+	return tx.Where("order_id = ?", order.ID).Delete(&domain.ConfigStockReservation{}).Error
+}
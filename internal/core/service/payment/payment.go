@@ -6,12 +6,17 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/securitymonitor"
 )
 
 var (
@@ -22,6 +27,11 @@ var (
 	ErrRefundFailed           = errors.New("refund failed")
 	ErrSubscriptionNotFound   = errors.New("subscription not found")
 	ErrInsufficientBalance    = errors.New("insufficient credit balance")
+	ErrInvalidFee             = errors.New("fee percent must be between 0 and 100 and the fixed fee not negative")
+	ErrInvoiceDraft           = errors.New("invoice is a draft")
+	ErrCurrencyNotSupported   = errors.New("payment gateway does not take payments in the invoice currency")
+	ErrInvalidCurrency        = errors.New("currencies must be 3 letter ISO 4217 codes")
+	ErrCustomerBanned         = errors.New("payments are blocked for this account, please contact support")
 )
 
 // PaymentProcessor defines the interface for payment gateway implementations
@@ -50,6 +60,7 @@ type PaymentRequest struct {
 	CancelURL       string
 	IPAddress       string
 	Metadata        map[string]string
+	Credentials     domain.PaymentGatewayConfig // Of the gateway, references resolved
 }
 
 // PaymentResult represents the result of a payment
@@ -84,6 +95,7 @@ type SubscriptionRequest struct {
 	IntervalCount   int
 	PaymentMethodID uint64
 	TrialDays       int
+	Credentials     domain.PaymentGatewayConfig // Of the gateway, references resolved
 }
 
 // SubscriptionResult represents the result of subscription creation
@@ -108,6 +120,8 @@ type CardDetails struct {
 type Service struct {
 	db         *gorm.DB
 	processors map[string]PaymentProcessor
+	monitor    *securitymonitor.Service
+	testMode   bool
 }
 
 // NewService creates a new payment service
@@ -118,6 +132,25 @@ func NewService(db *gorm.DB) *Service {
 	}
 }
 
+// SetSecurityMonitor reports declined payments customers make to the
+// security monitor, which bans those testing cards, and refuses payments
+// of banned customers
+func (s *Service) SetSecurityMonitor(monitor *securitymonitor.Service) {
+	s.monitor = monitor
+}
+
+// SetTestMode sends the charges of every gateway to its sandbox, as on a
+// staging copy of production data, whatever the gateway test mode
+func (s *Service) SetTestMode(enabled bool) {
+	s.testMode = enabled
+}
+
+// TestMode reports whether charges made through a gateway go to its
+// sandbox. Their payments and transactions are flagged as tests.
+func (s *Service) TestMode(gateway *domain.PaymentGatewayModule) bool {
+	return s.testMode || gateway.TestMode
+}
+
 // RegisterProcessor registers a payment processor
 func (s *Service) RegisterProcessor(name string, processor PaymentProcessor) {
 	s.processors[name] = processor
@@ -135,14 +168,141 @@ func (s *Service) GetGateway(id uint64) (*domain.PaymentGatewayModule, error) {
 	return &gateway, nil
 }
 
-// ListActiveGateways returns all active payment gateways
-func (s *Service) ListActiveGateways() ([]domain.PaymentGatewayModule, error) {
+// GatewayCredentials returns the configuration of a gateway with its keys
+// and secrets resolved, as they may refer to environment variables or
+// Vault secrets instead of being stored in the database. In test mode the
+// sandbox credentials are returned with SandboxMode set.
+func (s *Service) GatewayCredentials(gateway *domain.PaymentGatewayModule) (domain.PaymentGatewayConfig, error) {
+	return s.credentials(gateway, s.TestMode(gateway))
+}
+
+// credentials resolves the live or sandbox credentials of a gateway. A
+// gateway without sandbox credentials gets none in test mode rather than
+// the live ones.
+func (s *Service) credentials(gateway *domain.PaymentGatewayModule, test bool) (domain.PaymentGatewayConfig, error) {
+	config := gateway.Config
+	if test {
+		config = domain.PaymentGatewayConfig{}
+		if gateway.Config.Sandbox != nil {
+			config = *gateway.Config.Sandbox
+		}
+		config.SandboxMode = true
+		config.SupportedCurrencies = gateway.Config.SupportedCurrencies
+	}
+	config.Sandbox = nil
+	credentials := map[string]*string{
+		"api_key":        &config.APIKey,
+		"api_secret":     &config.APISecret,
+		"merchant_id":    &config.MerchantID,
+		"public_key":     &config.PublicKey,
+		"private_key":    &config.PrivateKey,
+		"webhook_secret": &config.WebhookSecret,
+	}
+	for name, value := range credentials {
+		resolved, err := domain.ResolveSecret(*value)
+		if err != nil {
+			return domain.PaymentGatewayConfig{}, fmt.Errorf("gateway %s %s: %w", gateway.Slug, name, err)
+		}
+		*value = resolved
+	}
+	if len(config.Extra) > 0 {
+		extra := make(map[string]string, len(config.Extra))
+		for name, value := range config.Extra {
+			resolved, err := domain.ResolveSecret(value)
+			if err != nil {
+				return domain.PaymentGatewayConfig{}, fmt.Errorf("gateway %s %s: %w", gateway.Slug, name, err)
+			}
+			extra[name] = resolved
+		}
+		config.Extra = extra
+	}
+	return config, nil
+}
+
+// ListActiveGateways returns all active payment gateways taking payments
+// in a currency, or in any currency when empty
+func (s *Service) ListActiveGateways(currency string) ([]domain.PaymentGatewayModule, error) {
 	var gateways []domain.PaymentGatewayModule
 	if err := s.db.Where("active = ? AND visible = ?", true, true).
 		Order("sort_order ASC").Find(&gateways).Error; err != nil {
 		return nil, err
 	}
-	return gateways, nil
+	if currency == "" {
+		return gateways, nil
+	}
+	available := gateways[:0]
+	for _, gateway := range gateways {
+		if gateway.SupportsCurrency(currency) {
+			available = append(available, gateway)
+		}
+	}
+	return available, nil
+}
+
+// SetGatewayCurrencies restricts a gateway to payments in currencies, such
+// as a wallet that only settles CNY. No currencies lets it take any.
+func (s *Service) SetGatewayCurrencies(id uint64, currencies []string) (*domain.PaymentGatewayModule, error) {
+	codes := make([]string, 0, len(currencies))
+	for _, code := range currencies {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return nil, ErrInvalidCurrency
+		}
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	gateway, err := s.GetGateway(id)
+	if err != nil {
+		return nil, err
+	}
+	gateway.Config.SupportedCurrencies = codes
+	if err := s.db.Model(gateway).Update("config", gateway.Config).Error; err != nil {
+		return nil, err
+	}
+	return gateway, nil
+}
+
+// SetGatewayFees sets the percent and fixed fee a gateway charges on each
+// payment. They are used for payments whose processor reports no fee.
+func (s *Service) SetGatewayFees(id uint64, percent, fixed decimal.Decimal) (*domain.PaymentGatewayModule, error) {
+	if percent.IsNegative() || percent.GreaterThan(decimal.NewFromInt(100)) || fixed.IsNegative() {
+		return nil, ErrInvalidFee
+	}
+	gateway, err := s.GetGateway(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(gateway).Updates(map[string]interface{}{
+		"fee_percent": percent,
+		"fee_fixed":   fixed,
+	}).Error; err != nil {
+		return nil, err
+	}
+	gateway.FeePercent, gateway.FeeFixed = percent, fixed
+	return gateway, nil
+}
+
+// SetGatewayTestMode turns test mode of a gateway on or off. Sandbox
+// credentials replace those stored when given; live credentials are not
+// used in test mode.
+func (s *Service) SetGatewayTestMode(id uint64, enabled bool, sandbox *domain.PaymentGatewayConfig) (*domain.PaymentGatewayModule, error) {
+	gateway, err := s.GetGateway(id)
+	if err != nil {
+		return nil, err
+	}
+	if sandbox != nil {
+		sandbox.Sandbox, sandbox.SandboxMode, sandbox.SupportedCurrencies = nil, true, nil
+		gateway.Config.Sandbox = sandbox
+	}
+	if err := s.db.Model(gateway).Updates(map[string]interface{}{
+		"test_mode": enabled,
+		"config":    gateway.Config,
+	}).Error; err != nil {
+		return nil, err
+	}
+	gateway.TestMode = enabled
+	return gateway, nil
 }
 
 // CreatePaymentRequest creates a new payment request
@@ -158,6 +318,21 @@ func (s *Service) CreatePaymentRequest(customerID, invoiceID, gatewayID uint64,
 	if amount.LessThanOrEqual(decimal.Zero) {
 		return nil, ErrInvalidAmount
 	}
+	if s.monitor != nil && s.monitor.UserBanned(customerID) {
+		return nil, ErrCustomerBanned
+	}
+
+	// Drafts are not payable until they are published
+	var invoice domain.Invoice
+	if err := s.db.Select("id", "status", "currency").First(&invoice, invoiceID).Error; err != nil {
+		return nil, err
+	}
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceDraft
+	}
+	if !gateway.SupportsCurrency(invoice.Currency) {
+		return nil, ErrCurrencyNotSupported
+	}
 
 	expiresAt := time.Now().Add(24 * time.Hour)
 	request := &domain.PaymentRequest{
@@ -169,6 +344,7 @@ func (s *Service) CreatePaymentRequest(customerID, invoiceID, gatewayID uint64,
 		Status:     "pending",
 		IPAddress:  ipAddress,
 		ExpiresAt:  &expiresAt,
+		Test:       s.TestMode(gateway),
 	}
 
 	if err := s.db.Create(request).Error; err != nil {
@@ -189,6 +365,11 @@ func (s *Service) ProcessPayment(requestID uint64) (*PaymentResult, error) {
 	if !ok {
 		return nil, fmt.Errorf("processor not registered: %s", request.Gateway.Slug)
 	}
+	// The request keeps the mode it was made in
+	credentials, err := s.credentials(&request.Gateway, request.Test)
+	if err != nil {
+		return nil, err
+	}
 
 	result, err := processor.ProcessPayment(&PaymentRequest{
 		CustomerID:  request.CustomerID,
@@ -196,6 +377,7 @@ func (s *Service) ProcessPayment(requestID uint64) (*PaymentResult, error) {
 		Amount:      request.Amount,
 		Currency:    request.Currency,
 		IPAddress:   request.IPAddress,
+		Credentials: credentials,
 	})
 
 	now := time.Now()
@@ -205,6 +387,8 @@ func (s *Service) ProcessPayment(requestID uint64) (*PaymentResult, error) {
 			"error_message": err.Error(),
 			"processed_at":  &now,
 		})
+		s.notify(notification.NewService(s.db).PaymentFailed(&request, err.Error()))
+		s.recordDecline(&request)
 		return nil, err
 	}
 
@@ -218,21 +402,42 @@ func (s *Service) ProcessPayment(requestID uint64) (*PaymentResult, error) {
 	if result.Success {
 		// Create transaction
 		transaction := &domain.Transaction{
-			CustomerID:     request.CustomerID,
-			InvoiceID:      &request.InvoiceID,
-			Type:           domain.TransactionTypePayment,
-			Status:         domain.TransactionStatusCompleted,
-			Currency:       request.Currency,
-			Amount:         result.Amount,
-			Fee:            result.Fee,
-			Gateway:        request.Gateway.Slug,
-			GatewayTransID: result.TransactionID,
-			IPAddress:      request.IPAddress,
+			CustomerID:      request.CustomerID,
+			InvoiceID:       &request.InvoiceID,
+			Type:            domain.TransactionTypePayment,
+			Status:          domain.TransactionStatusCompleted,
+			Currency:        request.Currency,
+			Amount:          result.Amount,
+			Fee:             result.Fee,
+			Gateway:         request.Gateway.Slug,
+			GatewayTransID:  result.TransactionID,
+			IPAddress:       request.IPAddress,
+			PaymentMethodID: request.PaymentMethodID,
+			Test:            request.Test,
+		}
+		if transaction.Fee.IsZero() {
+			transaction.Fee = request.Gateway.CalculateFee(result.Amount)
+			transaction.FeeCalculated = !transaction.Fee.IsZero()
 		}
-		if err := s.db.Create(transaction).Error; err != nil {
+		// The payment settles the invoice it was made for
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			var invoice domain.Invoice
+			if err := tx.First(&invoice, request.InvoiceID).Error; err != nil {
+				return err
+			}
+			return applyToInvoice(tx, &invoice, result.Amount)
+		})
+		if err != nil {
 			return nil, err
 		}
 		updates["transaction_id"] = transaction.ID
+		s.notify(notification.NewService(s.db).PaymentReceived(transaction))
+	} else {
+		s.notify(notification.NewService(s.db).PaymentFailed(&request, result.Message))
+		s.recordDecline(&request)
 	}
 
 	s.db.Model(&request).Updates(updates)
@@ -240,6 +445,15 @@ func (s *Service) ProcessPayment(requestID uint64) (*PaymentResult, error) {
 	return result, nil
 }
 
+// recordDecline reports a declined payment the customer made to the
+// security monitor. Payments without an address are taken automatically
+// and not counted.
+func (s *Service) recordDecline(request *domain.PaymentRequest) {
+	if s.monitor != nil && request.IPAddress != "" {
+		s.monitor.RecordCardDecline(request.IPAddress, request.CustomerID)
+	}
+}
+
 // PayWithCredit pays an invoice using customer credit balance
 func (s *Service) PayWithCredit(customerID, invoiceID uint64, amount decimal.Decimal) (*domain.Transaction, error) {
 	var customer domain.User
@@ -255,6 +469,9 @@ func (s *Service) PayWithCredit(customerID, invoiceID uint64, amount decimal.Dec
 	if err := s.db.First(&invoice, invoiceID).Error; err != nil {
 		return nil, err
 	}
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceDraft
+	}
 
 	var transaction *domain.Transaction
 	err := s.db.Transaction(func(tx *gorm.DB) error {
@@ -287,30 +504,39 @@ func (s *Service) PayWithCredit(customerID, invoiceID uint64, amount decimal.Dec
 			Status:      domain.TransactionStatusCompleted,
 			Currency:    invoice.Currency,
 			Amount:      amount,
-			Gateway:     "credit_balance",
+			Gateway:     domain.GatewayCreditBalance,
 			Description: fmt.Sprintf("Credit balance payment for invoice %s", invoice.InvoiceNumber),
 		}
 		if err := tx.Create(transaction).Error; err != nil {
 			return err
 		}
 
-		// Update invoice
-		newAmountPaid := invoice.AmountPaid.Add(amount)
-		newBalance := invoice.Total.Sub(newAmountPaid)
-		updates := map[string]interface{}{
-			"amount_paid": newAmountPaid,
-			"balance":     newBalance,
-		}
-		if newBalance.LessThanOrEqual(decimal.Zero) {
-			now := time.Now()
-			updates["status"] = domain.InvoiceStatusPaid
-			updates["paid_at"] = &now
-			updates["balance"] = decimal.Zero
-		}
-		return tx.Model(&invoice).Updates(updates).Error
+		return applyToInvoice(tx, &invoice, amount)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(notification.NewService(s.db).PaymentReceived(transaction))
+	return transaction, nil
+}
 
-	return transaction, err
+// applyToInvoice adds a payment to the amount paid of an invoice, marking
+// it paid once nothing is left to pay
+func applyToInvoice(tx *gorm.DB, invoice *domain.Invoice, amount decimal.Decimal) error {
+	newAmountPaid := invoice.AmountPaid.Add(amount)
+	newBalance := invoice.Total.Sub(newAmountPaid)
+	updates := map[string]interface{}{
+		"amount_paid": newAmountPaid,
+		"balance":     newBalance,
+	}
+	if newBalance.LessThanOrEqual(decimal.Zero) {
+		now := time.Now()
+		updates["status"] = domain.InvoiceStatusPaid
+		updates["paid_at"] = &now
+		updates["balance"] = decimal.Zero
+	}
+	return tx.Model(invoice).Updates(updates).Error
 }
 
 // AddCredit adds credit to a customer account
@@ -335,7 +561,10 @@ func (s *Service) AddCredit(customerID uint64, amount decimal.Decimal, currency,
 		if err := tx.Model(&customer).Update("credit", customer.Credit.Add(amount)).Error; err != nil {
 			return err
 		}
-		return tx.Create(adjustment).Error
+		if err := tx.Create(adjustment).Error; err != nil {
+			return err
+		}
+		return notification.NewService(tx).CreditAdded(adjustment)
 	})
 
 	return adjustment, err
@@ -368,6 +597,7 @@ func (s *Service) ProcessRefund(transactionID uint64, amount decimal.Decimal, re
 			Gateway:        original.Gateway,
 			RefundTransID:  &original.ID,
 			Description:    fmt.Sprintf("Refund: %s", reason),
+			Test:           original.Test,
 		}
 
 		// Update original transaction's refunded amount
@@ -376,8 +606,12 @@ func (s *Service) ProcessRefund(transactionID uint64, amount decimal.Decimal, re
 		}
 		return tx.Create(refund).Error
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return refund, err
+	s.notify(notification.NewService(s.db).PaymentRefunded(refund, reason))
+	return refund, nil
 }
 
 // CreateSubscription creates a recurring payment subscription
@@ -394,6 +628,10 @@ func (s *Service) CreateSubscription(request *SubscriptionRequest, gatewayID uin
 	if !ok {
 		return nil, fmt.Errorf("processor not registered: %s", gateway.Slug)
 	}
+	test := s.TestMode(gateway)
+	if request.Credentials, err = s.credentials(gateway, test); err != nil {
+		return nil, err
+	}
 
 	result, err := processor.CreateSubscription(request)
 	if err != nil {
@@ -413,6 +651,7 @@ func (s *Service) CreateSubscription(request *SubscriptionRequest, gatewayID uin
 		Status:             domain.SubscriptionActive,
 		CurrentPeriodStart: time.Now(),
 		CurrentPeriodEnd:   result.CurrentPeriodEnd,
+		Test:               test,
 	}
 
 	if err := s.db.Create(subscription).Error; err != nil {
@@ -456,6 +695,14 @@ func (s *Service) CancelSubscription(subscriptionID uint64, immediately bool) er
 	return s.db.Model(&subscription).Updates(updates).Error
 }
 
+// notify logs a failure to raise a payment event, as the payment stands
+// even when its webhooks cannot be queued
+func (s *Service) notify(err error) {
+	if err != nil {
+		log.Printf("failed to notify payment event: %v", err)
+	}
+}
+
 // ProcessWebhook processes a payment gateway webhook
 func (s *Service) ProcessWebhook(gatewaySlug string, payload []byte, signature string) error {
 	var gateway domain.PaymentGatewayModule
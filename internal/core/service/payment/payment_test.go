@@ -0,0 +1,100 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// approvingProcessor is a gateway approving every charge
+type approvingProcessor struct{}
+
+func (approvingProcessor) Name() string { return "approving" }
+
+func (approvingProcessor) ProcessPayment(request *PaymentRequest) (*PaymentResult, error) {
+	return &PaymentResult{Success: true, TransactionID: "ch_1", GatewayRef: "ch_1", Amount: request.Amount, Status: "completed"}, nil
+}
+
+func (approvingProcessor) ProcessRefund(string, decimal.Decimal) (*RefundResult, error) {
+	return nil, errors.New("not supported")
+}
+
+func (approvingProcessor) CreateSubscription(*SubscriptionRequest) (*SubscriptionResult, error) {
+	return nil, errors.New("not supported")
+}
+
+func (approvingProcessor) CancelSubscription(string) error { return errors.New("not supported") }
+
+func (approvingProcessor) ValidateWebhook([]byte, string) bool { return false }
+
+func (approvingProcessor) GetPaymentURL(*PaymentRequest) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (approvingProcessor) TokenizeCard(*CardDetails) (string, error) {
+	return "", errors.New("not supported")
+}
+
+// TestProcessPaymentSettlesInvoice checks that gateway payments are added
+// to the invoice they were made for, which is paid once nothing is due
+func TestProcessPaymentSettlesInvoice(t *testing.T) {
+	db := testutil.OpenDB(t)
+
+	customer := &domain.User{Email: "customer@example.com", PasswordHash: "x", Role: domain.UserRoleCustomer, Status: domain.UserStatusActive}
+	if err := db.Create(customer).Error; err != nil {
+		t.Fatal(err)
+	}
+	gateway := &domain.PaymentGatewayModule{Name: "Approving", Slug: "approving", DisplayName: "Approving", Type: domain.GatewayTypeCard, Active: true}
+	if err := db.Create(gateway).Error; err != nil {
+		t.Fatal(err)
+	}
+	invoice := &domain.Invoice{
+		CustomerID:    customer.ID,
+		InvoiceNumber: "INV-1",
+		Status:        domain.InvoiceStatusUnpaid,
+		Currency:      "USD",
+		Subtotal:      decimal.NewFromInt(20),
+		Total:         decimal.NewFromInt(20),
+		Balance:       decimal.NewFromInt(20),
+		DueDate:       time.Now(),
+	}
+	if err := db.Create(invoice).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewService(db)
+	service.RegisterProcessor(gateway.Slug, approvingProcessor{})
+	pay := func(amount int64) domain.Invoice {
+		t.Helper()
+		request, err := service.CreatePaymentRequest(customer.ID, invoice.ID, gateway.ID, decimal.NewFromInt(amount), "USD", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.ProcessPayment(request.ID); err != nil {
+			t.Fatal(err)
+		}
+		var paid domain.Invoice
+		if err := db.First(&paid, invoice.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return paid
+	}
+
+	if paid := pay(12); paid.Status != domain.InvoiceStatusUnpaid || !paid.Balance.Equal(decimal.NewFromInt(8)) || !paid.AmountPaid.Equal(decimal.NewFromInt(12)) {
+		t.Errorf("after a part payment the invoice is %s with %s paid and %s due, want unpaid with 12 paid and 8 due", paid.Status, paid.AmountPaid, paid.Balance)
+	}
+	if paid := pay(8); paid.Status != domain.InvoiceStatusPaid || !paid.Balance.IsZero() || paid.PaidAt == nil {
+		t.Errorf("after the rest is paid the invoice is %s with %s due, want paid", paid.Status, paid.Balance)
+	}
+
+	var transactions int64
+	db.Model(&domain.Transaction{}).Where("invoice_id = ? AND type = ?", invoice.ID, domain.TransactionTypePayment).Count(&transactions)
+	if transactions != 2 {
+		t.Errorf("got %d payment transactions, want 2", transactions)
+	}
+}
@@ -0,0 +1,416 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrRevisionNotFound   = errors.New("price revision not found")
+	ErrRevisionNotPending = errors.New("price revision is not scheduled")
+	ErrInvalidAdjustment  = errors.New("either percent or amount must be set")
+	ErrInvalidPolicy      = errors.New("service policy must be grandfather or migrate")
+	ErrInvalidCycle       = errors.New("unknown billing cycle")
+	ErrNoPrices           = errors.New("no enabled prices match the given filter")
+	ErrPricingNotFound    = errors.New("product has no pricing in this currency")
+	ErrTierNotFound       = errors.New("pricing tier not found")
+	ErrInvalidTier        = errors.New("invalid pricing tier")
+)
+
+// Cycles lists the billing cycles of ProductPricing in order
+var Cycles = []string{"monthly", "quarterly", "semiannually", "annually", "biennially", "triennially"}
+
+// Service manages staged price revisions
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new pricing service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// StageRevision computes the new price of every matching product, currency
+// and cycle and stores them as a scheduled revision. Prices change when the
+// revision is applied at its effective date.
+func (s *Service) StageRevision(req RevisionRequest) (*domain.PriceRevision, error) {
+	if req.Percent.IsZero() == req.Amount.IsZero() {
+		return nil, ErrInvalidAdjustment
+	}
+	if req.ServicePolicy == "" {
+		req.ServicePolicy = domain.PriceRevisionGrandfather
+	}
+	if req.ServicePolicy != domain.PriceRevisionGrandfather && req.ServicePolicy != domain.PriceRevisionMigrate {
+		return nil, ErrInvalidPolicy
+	}
+	if len(req.Cycles) == 0 {
+		req.Cycles = Cycles
+	}
+	cycles := make([]string, 0, len(req.Cycles))
+	for _, cycle := range req.Cycles {
+		cycle = NormalizeCycle(cycle)
+		if column(cycle) == "" {
+			return nil, ErrInvalidCycle
+		}
+		cycles = append(cycles, cycle)
+	}
+	if req.EffectiveAt.IsZero() {
+		req.EffectiveAt = time.Now()
+	}
+
+	query := s.db.Model(&domain.ProductPricing{})
+	if len(req.ProductIDs) > 0 {
+		query = query.Where("product_id IN ?", req.ProductIDs)
+	}
+	if req.ProductGroupID != 0 {
+		query = query.Where("product_id IN (?)",
+			s.db.Model(&domain.Product{}).Select("id").Where("product_group_id = ?", req.ProductGroupID))
+	}
+	if len(req.Currencies) > 0 {
+		query = query.Where("currency IN ?", req.Currencies)
+	}
+	var prices []domain.ProductPricing
+	if err := query.Order("product_id, currency").Find(&prices).Error; err != nil {
+		return nil, err
+	}
+
+	revision := &domain.PriceRevision{
+		Name:          req.Name,
+		Description:   req.Description,
+		Status:        domain.PriceRevisionScheduled,
+		ServicePolicy: req.ServicePolicy,
+		Percent:       req.Percent,
+		Amount:        req.Amount,
+		EffectiveAt:   req.EffectiveAt,
+		CreatedBy:     req.CreatedBy,
+	}
+	for _, price := range prices {
+		for _, cycle := range cycles {
+			old := price.GetPrice(cycle)
+			if old.IsNegative() {
+				continue
+			}
+			revision.Items = append(revision.Items, domain.PriceRevisionItem{
+				ProductID: price.ProductID,
+				Currency:  price.Currency,
+				Cycle:     cycle,
+				OldPrice:  old,
+				NewPrice:  adjust(old, req.Percent, req.Amount),
+			})
+		}
+	}
+	if len(revision.Items) == 0 {
+		return nil, ErrNoPrices
+	}
+
+	if err := s.db.Create(revision).Error; err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// GetRevision returns a revision with its items
+func (s *Service) GetRevision(id uint64) (*domain.PriceRevision, error) {
+	var revision domain.PriceRevision
+	if err := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_id, currency, id")
+	}).Preload("Items.Product").First(&revision, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// ListRevisions returns revisions, latest effective date first
+func (s *Service) ListRevisions(status domain.PriceRevisionStatus, limit, offset int) ([]domain.PriceRevision, int64, error) {
+	var revisions []domain.PriceRevision
+	var total int64
+
+	query := s.db.Model(&domain.PriceRevision{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("effective_at DESC").Limit(limit).Offset(offset).Find(&revisions).Error; err != nil {
+		return nil, 0, err
+	}
+	return revisions, total, nil
+}
+
+// UpdateItemPrice overrides the computed new price of one item of a
+// scheduled revision
+func (s *Service) UpdateItemPrice(revisionID, itemID uint64, price decimal.Decimal) error {
+	revision, err := s.GetRevision(revisionID)
+	if err != nil {
+		return err
+	}
+	if revision.Status != domain.PriceRevisionScheduled {
+		return ErrRevisionNotPending
+	}
+	result := s.db.Model(&domain.PriceRevisionItem{}).
+		Where("id = ? AND revision_id = ?", itemID, revisionID).
+		Update("new_price", price)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRevisionNotFound
+	}
+	return nil
+}
+
+// CancelRevision cancels a revision that has not been applied yet
+func (s *Service) CancelRevision(id uint64) error {
+	result := s.db.Model(&domain.PriceRevision{}).
+		Where("id = ? AND status = ?", id, domain.PriceRevisionScheduled).
+		Update("status", domain.PriceRevisionCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetRevision(id); err != nil {
+			return err
+		}
+		return ErrRevisionNotPending
+	}
+	return nil
+}
+
+// ApplyDueRevisions writes the new prices of every scheduled revision whose
+// effective date has passed to the product pricing table. It returns the
+// number of revisions applied.
+func (s *Service) ApplyDueRevisions(now time.Time) (int, error) {
+	var revisions []domain.PriceRevision
+	if err := s.db.Preload("Items").
+		Where("status = ? AND effective_at <= ?", domain.PriceRevisionScheduled, now).
+		Order("effective_at, id").Find(&revisions).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, revision := range revisions {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			for _, item := range revision.Items {
+				if err := tx.Model(&domain.ProductPricing{}).
+					Where("product_id = ? AND currency = ?", item.ProductID, item.Currency).
+					Update(column(item.Cycle), item.NewPrice).Error; err != nil {
+					return err
+				}
+			}
+			appliedAt := time.Now()
+			return tx.Model(&revision).Updates(map[string]interface{}{
+				"status":     domain.PriceRevisionApplied,
+				"applied_at": &appliedAt,
+			}).Error
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Monitor applies due revisions on the given interval until ctx is
+// cancelled
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.ApplyDueRevisions(time.Now()); err != nil {
+			log.Printf("failed to apply price revisions: %v", err)
+		} else if n > 0 {
+			log.Printf("applied %d price revision(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenewalAmount returns the recurring amount a service renews at for a
+// period starting at periodStart. Revisions with the migrate policy that
+// took effect after the service was last priced are applied as a price
+// difference, so config option charges in RecurringAmount are kept. The
+// returned time is the effective date of the last revision applied, or nil
+// when the amount is unchanged.
+func (s *Service) RenewalAmount(service *domain.Service, periodStart time.Time) (decimal.Decimal, *time.Time, error) {
+	pricedAt := service.RegistrationDate
+	if service.PriceUpdatedAt != nil {
+		pricedAt = *service.PriceUpdatedAt
+	}
+
+	var items []domain.PriceRevisionItem
+	err := s.db.Joins("Revision").
+		Where("price_revision_items.product_id = ? AND price_revision_items.currency = ? AND price_revision_items.cycle = ?",
+			service.ProductID, service.Currency, NormalizeCycle(service.BillingCycle)).
+		Where("Revision.status IN ? AND Revision.service_policy = ?",
+			[]domain.PriceRevisionStatus{domain.PriceRevisionScheduled, domain.PriceRevisionApplied}, domain.PriceRevisionMigrate).
+		Where("Revision.effective_at > ? AND Revision.effective_at <= ?", pricedAt, periodStart).
+		Order("Revision.effective_at, price_revision_items.id").
+		Find(&items).Error
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	if len(items) == 0 {
+		return service.RecurringAmount, nil, nil
+	}
+
+	amount := service.RecurringAmount
+	for _, item := range items {
+		amount = amount.Add(item.NewPrice.Sub(item.OldPrice))
+	}
+	if amount.IsNegative() {
+		amount = decimal.Zero
+	}
+	effectiveAt := items[len(items)-1].Revision.EffectiveAt
+	return amount, &effectiveAt, nil
+}
+
+// --- Pricing tiers ---
+
+// ListTiers returns the quantity breaks and term promotions of a product
+func (s *Service) ListTiers(productID uint64) ([]domain.PricingTier, error) {
+	var tiers []domain.PricingTier
+	err := s.db.Where("product_pricing_id IN (?)",
+		s.db.Model(&domain.ProductPricing{}).Select("id").Where("product_id = ?", productID)).
+		Order("product_pricing_id, type, min_quantity, id").Find(&tiers).Error
+	return tiers, err
+}
+
+// CreateTier adds a pricing tier to the price of a product in a currency.
+// Term promotions must name a billing cycle.
+func (s *Service) CreateTier(productID uint64, currency string, tier *domain.PricingTier) error {
+	if tier.Type != domain.PricingTierQuantity && tier.Type != domain.PricingTierTerm {
+		return ErrInvalidTier
+	}
+	if tier.DiscountType == "" {
+		tier.DiscountType = domain.PricingTierPercent
+	}
+	if tier.DiscountType != domain.PricingTierPercent && tier.DiscountType != domain.PricingTierFixed {
+		return ErrInvalidTier
+	}
+	if !tier.Value.IsPositive() || (tier.DiscountType == domain.PricingTierPercent && tier.Value.GreaterThan(decimal.NewFromInt(100))) {
+		return ErrInvalidTier
+	}
+	if tier.BillingCycle != "" {
+		tier.BillingCycle = NormalizeCycle(tier.BillingCycle)
+		if column(tier.BillingCycle) == "" {
+			return ErrInvalidCycle
+		}
+	} else if tier.Type == domain.PricingTierTerm {
+		return ErrInvalidCycle
+	}
+	if tier.MinQuantity < 1 {
+		tier.MinQuantity = 1
+	}
+	if tier.StartsAt != nil && tier.EndsAt != nil && !tier.EndsAt.After(*tier.StartsAt) {
+		return ErrInvalidTier
+	}
+
+	var price domain.ProductPricing
+	result := s.db.Where("product_id = ? AND currency = ?", productID, currency).Limit(1).Find(&price)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPricingNotFound
+	}
+
+	tier.ID = 0
+	tier.ProductPricingID = price.ID
+	tier.Active = true
+	return s.db.Create(tier).Error
+}
+
+// SetTierActive enables or disables a pricing tier
+func (s *Service) SetTierActive(id uint64, active bool) error {
+	result := s.db.Model(&domain.PricingTier{}).Where("id = ?", id).Update("active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTierNotFound
+	}
+	return nil
+}
+
+// DeleteTier removes a pricing tier. Carts already priced with it keep
+// their price.
+func (s *Service) DeleteTier(id uint64) error {
+	result := s.db.Delete(&domain.PricingTier{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTierNotFound
+	}
+	return nil
+}
+
+// NormalizeCycle maps billing cycle aliases to the names used in revisions
+func NormalizeCycle(cycle string) string {
+	switch strings.ToLower(cycle) {
+	case "semi-annually", "semiannually":
+		return "semiannually"
+	case "yearly", "annually":
+		return "annually"
+	default:
+		return strings.ToLower(cycle)
+	}
+}
+
+// column returns the ProductPricing column of a normalized cycle
+func column(cycle string) string {
+	switch cycle {
+	case "monthly", "quarterly", "annually", "biennially", "triennially":
+		return cycle
+	case "semiannually":
+		return "semi_annually"
+	default:
+		return ""
+	}
+}
+
+func adjust(price, percent, amount decimal.Decimal) decimal.Decimal {
+	if !percent.IsZero() {
+		price = price.Mul(decimal.NewFromInt(1).Add(percent.Div(decimal.NewFromInt(100))))
+	}
+	price = price.Add(amount)
+	if price.IsNegative() {
+		return decimal.Zero
+	}
+	return price.Round(2)
+}
+
+// RevisionRequest describes a price change to stage
+type RevisionRequest struct {
+	Name           string
+	Description    string
+	ProductIDs     []uint64
+	ProductGroupID uint64
+	Currencies     []string
+	Cycles         []string
+	Percent        decimal.Decimal
+	Amount         decimal.Decimal
+	EffectiveAt    time.Time
+	ServicePolicy  string
+	CreatedBy      *uint64
+}
@@ -0,0 +1,245 @@
+package product
+
+import (
+	"errors"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrBundleNotFound = errors.New("bundle not found")
+	ErrInvalidBundle  = errors.New("bundle must contain at least one product")
+)
+
+// ListBundles returns bundles with their products in display order
+func (s *Service) ListBundles(activeOnly bool) ([]domain.ProductBundle, error) {
+	var bundles []domain.ProductBundle
+	query := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order, id")
+	}).Preload("Items.Product")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Order("sort_order, id").Find(&bundles).Error; err != nil {
+		return nil, err
+	}
+	return bundles, nil
+}
+
+// GetBundle retrieves a bundle with its products
+func (s *Service) GetBundle(id uint64) (*domain.ProductBundle, error) {
+	var bundle domain.ProductBundle
+	if err := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order, id")
+	}).Preload("Items.Product").First(&bundle, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBundleNotFound
+		}
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// CreateBundle creates a bundle with its products
+func (s *Service) CreateBundle(bundle *domain.ProductBundle) (*domain.ProductBundle, error) {
+	if err := s.validateBundleItems(bundle.Items); err != nil {
+		return nil, err
+	}
+
+	active := bundle.Active
+	showSavings := bundle.ShowSavings
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(bundle).Error; err != nil {
+			return err
+		}
+		// Flags are written explicitly so false is not replaced by the
+		// column defaults
+		return tx.Model(bundle).Updates(map[string]interface{}{
+			"active":       active,
+			"show_savings": showSavings,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBundle(bundle.ID)
+}
+
+// UpdateBundle replaces the details and products of a bundle
+func (s *Service) UpdateBundle(id uint64, bundle *domain.ProductBundle) (*domain.ProductBundle, error) {
+	if _, err := s.GetBundle(id); err != nil {
+		return nil, err
+	}
+	if err := s.validateBundleItems(bundle.Items); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.ProductBundle{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"name":            bundle.Name,
+			"description":     bundle.Description,
+			"setup_fee":       bundle.SetupFee,
+			"monthly":         bundle.Monthly,
+			"quarterly":       bundle.Quarterly,
+			"semi_annually":   bundle.SemiAnnually,
+			"annually":        bundle.Annually,
+			"biennially":      bundle.Biennially,
+			"triennially":     bundle.Triennially,
+			"allow_customize": bundle.AllowCustomize,
+			"show_savings":    bundle.ShowSavings,
+			"active":          bundle.Active,
+			"sort_order":      bundle.SortOrder,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("bundle_id = ?", id).Delete(&domain.ProductBundleItem{}).Error; err != nil {
+			return err
+		}
+		for i := range bundle.Items {
+			item := bundle.Items[i]
+			item.ID = 0
+			item.BundleID = id
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBundle(id)
+}
+
+// DeleteBundle deletes a bundle and its products. Services already ordered
+// in the bundle are kept.
+func (s *Service) DeleteBundle(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bundle_id = ?", id).Delete(&domain.ProductBundleItem{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&domain.ProductBundle{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBundleNotFound
+		}
+		return nil
+	})
+}
+
+// QuoteBundle prices a bundle for a billing cycle and currency. Optional
+// products are only included when listed in optionalProductIDs.
+func (s *Service) QuoteBundle(bundleID uint64, billingCycle, currency string, optionalProductIDs []uint64) (*BundleQuote, error) {
+	bundle, err := s.GetBundle(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	var lines []domain.BundleLine
+	for _, item := range IncludedBundleItems(bundle, optionalProductIDs) {
+		price, err := s.GetProductPricing(item.ProductID, billingCycle, nil, item.Quantity, currency, 0)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, domain.BundleLine{
+			Item:             item,
+			ListSetupFee:     price.SetupFee,
+			ListRecurringFee: price.RecurringFee,
+		})
+	}
+	bundle.Price(billingCycle, lines)
+
+	quote := &BundleQuote{
+		BundleID:     bundle.ID,
+		Name:         bundle.Name,
+		BillingCycle: billingCycle,
+		Currency:     currency,
+		ListPrice:    decimal.Zero,
+		Price:        decimal.Zero,
+		Items:        make([]BundleQuoteItem, 0, len(lines)),
+	}
+	for _, line := range lines {
+		quote.ListPrice = quote.ListPrice.Add(line.ListTotal())
+		quote.Price = quote.Price.Add(line.Total())
+		quote.Items = append(quote.Items, BundleQuoteItem{
+			ProductID:    line.Item.ProductID,
+			ProductName:  line.Item.Product.Name,
+			Quantity:     line.Item.Quantity,
+			Optional:     line.Item.Optional,
+			SetupFee:     line.SetupFee,
+			RecurringFee: line.RecurringFee,
+			Saving:       line.Saving(),
+		})
+	}
+	quote.Savings = quote.ListPrice.Sub(quote.Price)
+	return quote, nil
+}
+
+// IncludedBundleItems returns the required products of a bundle and the
+// optional ones that were chosen
+func IncludedBundleItems(bundle *domain.ProductBundle, optionalProductIDs []uint64) []domain.ProductBundleItem {
+	chosen := make(map[uint64]bool, len(optionalProductIDs))
+	for _, id := range optionalProductIDs {
+		chosen[id] = true
+	}
+
+	items := make([]domain.ProductBundleItem, 0, len(bundle.Items))
+	for _, item := range bundle.Items {
+		if item.Optional && !chosen[item.ProductID] {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *Service) validateBundleItems(items []domain.ProductBundleItem) error {
+	if len(items) == 0 {
+		return ErrInvalidBundle
+	}
+	for i := range items {
+		if items[i].Quantity <= 0 {
+			items[i].Quantity = 1
+		}
+		var count int64
+		if err := s.db.Model(&domain.Product{}).Where("id = ?", items[i].ProductID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrProductNotFound
+		}
+	}
+	return nil
+}
+
+// BundleQuote is the price of a bundle for a billing cycle
+type BundleQuote struct {
+	BundleID     uint64            `json:"bundle_id"`
+	Name         string            `json:"name"`
+	BillingCycle string            `json:"billing_cycle"`
+	Currency     string            `json:"currency"`
+	ListPrice    decimal.Decimal   `json:"list_price"` // First term price of the products bought separately
+	Price        decimal.Decimal   `json:"price"`      // First term price of the bundle
+	Savings      decimal.Decimal   `json:"savings"`
+	Items        []BundleQuoteItem `json:"items"`
+}
+
+// BundleQuoteItem is a product of a bundle quote with its bundle fees
+type BundleQuoteItem struct {
+	ProductID    uint64          `json:"product_id"`
+	ProductName  string          `json:"product_name"`
+	Quantity     int             `json:"quantity"`
+	Optional     bool            `json:"optional"`
+	SetupFee     decimal.Decimal `json:"setup_fee"`
+	RecurringFee decimal.Decimal `json:"recurring_fee"` // Per unit
+	Saving       decimal.Decimal `json:"saving"`
+}
@@ -0,0 +1,1209 @@
+package product
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// CatalogVersion is the format version written by ExportCatalog
+const CatalogVersion = 1
+
+// Import plan actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+// ValidationError lists every problem found in an imported catalog
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid catalog: " + strings.Join(e.Problems, "; ")
+}
+
+// ExportCatalog returns the full product catalog. Records reference each
+// other by slug or name so the export can be imported into another
+// installation.
+func (s *Service) ExportCatalog() (*Catalog, error) {
+	catalog := &Catalog{Version: CatalogVersion, ExportedAt: time.Now().UTC()}
+
+	var groups []domain.ProductGroup
+	if err := s.db.Order("sort_order, id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	groupSlugs := map[uint64]string{}
+	for _, g := range groups {
+		groupSlugs[g.ID] = g.Slug
+		catalog.Groups = append(catalog.Groups, CatalogGroup{
+			Slug:        g.Slug,
+			Name:        g.Name,
+			Description: g.Description,
+			SortOrder:   g.SortOrder,
+			Active:      g.Active,
+		})
+	}
+
+	var configGroups []domain.ConfigGroup
+	if err := s.db.Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order, id")
+	}).Preload("Options.SubOptions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order, id")
+	}).Order("id").Find(&configGroups).Error; err != nil {
+		return nil, err
+	}
+	configGroupNames := map[uint64]string{}
+	for _, g := range configGroups {
+		configGroupNames[g.ID] = g.Name
+		item := CatalogConfigGroup{Name: g.Name, Description: g.Description}
+		for _, o := range g.Options {
+			option := CatalogConfigOption{
+				Name:      o.Name,
+				InputType: o.InputType,
+				Required:  o.Required,
+				SortOrder: o.SortOrder,
+			}
+			for _, so := range o.SubOptions {
+				option.SubOptions = append(option.SubOptions, CatalogConfigSubOption{
+					Name:      so.Name,
+					SortOrder: so.SortOrder,
+					Pricing: CatalogOptionPricing{
+						SetupFee:    so.Pricing.SetupFee,
+						Monthly:     so.Pricing.Monthly,
+						Quarterly:   so.Pricing.Quarterly,
+						Yearly:      so.Pricing.Yearly,
+						Triennially: so.Pricing.Triennially,
+					},
+				})
+			}
+			item.Options = append(item.Options, option)
+		}
+		catalog.ConfigGroups = append(catalog.ConfigGroups, item)
+	}
+
+	var addons []domain.ProductAddon
+	if err := s.db.Order("weight, id").Find(&addons).Error; err != nil {
+		return nil, err
+	}
+	addonNames := map[uint64]string{}
+	for _, a := range addons {
+		addonNames[a.ID] = a.Name
+		catalog.Addons = append(catalog.Addons, catalogAddonFromDomain(a))
+	}
+
+	var products []domain.Product
+	if err := s.db.Order("id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	var pricing []domain.ProductPricing
+	if err := s.db.Order("product_id, currency").Find(&pricing).Error; err != nil {
+		return nil, err
+	}
+	var configLinks []domain.ProductConfigGroup
+	if err := s.db.Order("product_id, config_group_id").Find(&configLinks).Error; err != nil {
+		return nil, err
+	}
+	var addonLinks []domain.ProductAddonAssignment
+	if err := s.db.Order("product_id, sort_order, addon_id").Find(&addonLinks).Error; err != nil {
+		return nil, err
+	}
+
+	for _, p := range products {
+		item := CatalogProduct{
+			Slug:        p.Slug,
+			GroupSlug:   groupSlugs[p.ProductGroupID],
+			Name:        p.Name,
+			Description: p.Description,
+			ModuleName:  p.ModuleName,
+			Active:      p.Active,
+		}
+		for _, pr := range pricing {
+			if pr.ProductID == p.ID {
+				item.Pricing = append(item.Pricing, catalogPricingFromDomain(pr))
+			}
+		}
+		for _, link := range configLinks {
+			if link.ProductID == p.ID {
+				item.ConfigGroups = append(item.ConfigGroups, configGroupNames[link.ConfigGroupID])
+			}
+		}
+		for _, link := range addonLinks {
+			if link.ProductID == p.ID {
+				item.Addons = append(item.Addons, CatalogAddonLink{
+					Name:      addonNames[link.AddonID],
+					Required:  link.Required,
+					SortOrder: link.SortOrder,
+				})
+			}
+		}
+		catalog.Products = append(catalog.Products, item)
+	}
+
+	return catalog, nil
+}
+
+// PreviewImport validates a catalog and returns the changes ImportCatalog
+// would make without writing anything
+func (s *Service) PreviewImport(catalog *Catalog) (*ImportPlan, error) {
+	if err := s.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	return s.planImport(s.db, catalog, false)
+}
+
+// ImportCatalog validates a catalog and upserts it in one transaction.
+// Records are matched by slug or name; records missing from the catalog
+// are left untouched, except that a product's config group and addon
+// assignments are replaced by the ones listed for it.
+func (s *Service) ImportCatalog(catalog *Catalog) (*ImportPlan, error) {
+	if err := s.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+
+	var plan *ImportPlan
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = s.planImport(tx, catalog, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ValidateCatalog checks a catalog for missing keys, duplicates and
+// references that resolve neither in the catalog nor in the database
+func (s *Service) ValidateCatalog(catalog *Catalog) error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if catalog.Version != CatalogVersion {
+		addf("unsupported catalog version %d", catalog.Version)
+	}
+
+	groups := map[string]bool{}
+	for i, g := range catalog.Groups {
+		switch {
+		case g.Slug == "":
+			addf("groups[%d]: slug is required", i)
+		case groups[g.Slug]:
+			addf("groups[%d]: duplicate slug %q", i, g.Slug)
+		}
+		if g.Name == "" {
+			addf("groups[%d]: name is required", i)
+		}
+		groups[g.Slug] = true
+	}
+
+	configGroups := map[string]bool{}
+	for i, g := range catalog.ConfigGroups {
+		switch {
+		case g.Name == "":
+			addf("config_groups[%d]: name is required", i)
+		case configGroups[g.Name]:
+			addf("config_groups[%d]: duplicate name %q", i, g.Name)
+		}
+		configGroups[g.Name] = true
+
+		options := map[string]bool{}
+		for j, o := range g.Options {
+			switch {
+			case o.Name == "":
+				addf("config_groups[%d].options[%d]: name is required", i, j)
+			case options[o.Name]:
+				addf("config_groups[%d].options[%d]: duplicate name %q", i, j, o.Name)
+			}
+			if o.InputType == "" {
+				addf("config_groups[%d].options[%d]: input_type is required", i, j)
+			}
+			options[o.Name] = true
+
+			subOptions := map[string]bool{}
+			for k, so := range o.SubOptions {
+				switch {
+				case so.Name == "":
+					addf("config_groups[%d].options[%d].sub_options[%d]: name is required", i, j, k)
+				case subOptions[so.Name]:
+					addf("config_groups[%d].options[%d].sub_options[%d]: duplicate name %q", i, j, k, so.Name)
+				}
+				subOptions[so.Name] = true
+			}
+		}
+	}
+
+	addons := map[string]bool{}
+	for i, a := range catalog.Addons {
+		switch {
+		case a.Name == "":
+			addf("addons[%d]: name is required", i)
+		case addons[a.Name]:
+			addf("addons[%d]: duplicate name %q", i, a.Name)
+		}
+		if a.Type != "recurring" && a.Type != "onetime" {
+			addf("addons[%d]: type must be recurring or onetime", i)
+		}
+		addons[a.Name] = true
+	}
+
+	products := map[string]bool{}
+	for i, p := range catalog.Products {
+		switch {
+		case p.Slug == "":
+			addf("products[%d]: slug is required", i)
+		case products[p.Slug]:
+			addf("products[%d]: duplicate slug %q", i, p.Slug)
+		}
+		if p.Name == "" {
+			addf("products[%d]: name is required", i)
+		}
+		products[p.Slug] = true
+
+		if p.GroupSlug == "" {
+			addf("products[%d]: group_slug is required", i)
+		} else if !groups[p.GroupSlug] && !s.exists(&domain.ProductGroup{}, "slug = ?", p.GroupSlug) {
+			addf("products[%d]: unknown group %q", i, p.GroupSlug)
+		}
+
+		currencies := map[string]bool{}
+		for j, pr := range p.Pricing {
+			if len(pr.Currency) != 3 {
+				addf("products[%d].pricing[%d]: currency must be a 3 letter code", i, j)
+			} else if currencies[pr.Currency] {
+				addf("products[%d].pricing[%d]: duplicate currency %q", i, j, pr.Currency)
+			}
+			currencies[pr.Currency] = true
+		}
+
+		for _, name := range p.ConfigGroups {
+			if !configGroups[name] && !s.exists(&domain.ConfigGroup{}, "name = ?", name) {
+				addf("products[%d]: unknown config group %q", i, name)
+			}
+		}
+		for _, link := range p.Addons {
+			if !addons[link.Name] && !s.exists(&domain.ProductAddon{}, "name = ?", link.Name) {
+				addf("products[%d]: unknown addon %q", i, link.Name)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (s *Service) exists(model interface{}, query string, args ...interface{}) bool {
+	var count int64
+	s.db.Model(model).Where(query, args...).Count(&count)
+	return count > 0
+}
+
+// planImport diffs the catalog against db and, when apply is set, writes
+// the creates and updates it finds. Without apply the records the catalog
+// would create have no ID yet and are mapped to 0 by their key.
+func (s *Service) planImport(db *gorm.DB, catalog *Catalog, apply bool) (*ImportPlan, error) {
+	plan := &ImportPlan{Applied: apply}
+
+	groupIDs := map[string]uint64{}
+	for _, g := range catalog.Groups {
+		var existing domain.ProductGroup
+		found, err := findBy(db, &existing, "slug = ?", g.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			plan.record("group", g.Slug, ActionCreate, nil)
+			if apply {
+				group := &domain.ProductGroup{Slug: g.Slug, Name: g.Name, Description: g.Description, SortOrder: g.SortOrder, Active: g.Active}
+				if err := create(db, group, map[string]interface{}{"active": g.Active}); err != nil {
+					return nil, err
+				}
+				groupIDs[g.Slug] = group.ID
+			} else {
+				groupIDs[g.Slug] = 0
+			}
+			continue
+		}
+		groupIDs[g.Slug] = existing.ID
+
+		diff := fieldDiff{}
+		diff.str("name", existing.Name, g.Name)
+		diff.str("description", existing.Description, g.Description)
+		diff.int("sort_order", existing.SortOrder, g.SortOrder)
+		diff.bool("active", existing.Active, g.Active)
+		if err := plan.update(db, &existing, "group", g.Slug, diff, apply); err != nil {
+			return nil, err
+		}
+	}
+
+	configGroupIDs := map[string]uint64{}
+	for _, g := range catalog.ConfigGroups {
+		var existing domain.ConfigGroup
+		found, err := findBy(db, &existing, "name = ?", g.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			plan.record("config_group", g.Name, ActionCreate, nil)
+			if apply {
+				existing = domain.ConfigGroup{Name: g.Name, Description: g.Description}
+				if err := db.Create(&existing).Error; err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			diff := fieldDiff{}
+			diff.str("description", existing.Description, g.Description)
+			if err := plan.update(db, &existing, "config_group", g.Name, diff, apply); err != nil {
+				return nil, err
+			}
+		}
+		configGroupIDs[g.Name] = existing.ID
+
+		if err := planConfigOptions(db, plan, existing.ID, g, apply); err != nil {
+			return nil, err
+		}
+	}
+
+	addonIDs := map[string]uint64{}
+	for _, a := range catalog.Addons {
+		var existing domain.ProductAddon
+		found, err := findBy(db, &existing, "name = ?", a.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			plan.record("addon", a.Name, ActionCreate, nil)
+			if apply {
+				addon := a.toDomain()
+				if err := create(db, &addon, map[string]interface{}{
+					"show_on_order":           a.ShowOnOrder,
+					"active":                  a.Active,
+					"provision_automatically": a.ProvisionAutomatically,
+				}); err != nil {
+					return nil, err
+				}
+				addonIDs[a.Name] = addon.ID
+			} else {
+				addonIDs[a.Name] = 0
+			}
+			continue
+		}
+		addonIDs[a.Name] = existing.ID
+		if err := plan.update(db, &existing, "addon", a.Name, diffAddon(existing, a), apply); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range catalog.Products {
+		groupID, err := resolveID(db, groupIDs, &domain.ProductGroup{}, "slug", p.GroupSlug)
+		if err != nil {
+			return nil, err
+		}
+
+		var existing domain.Product
+		found, err := findBy(db, &existing, "slug = ?", p.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			plan.record("product", p.Slug, ActionCreate, nil)
+			if apply {
+				existing = domain.Product{
+					ProductGroupID: groupID,
+					Slug:           p.Slug,
+					Name:           p.Name,
+					Description:    p.Description,
+					ModuleName:     p.ModuleName,
+					Active:         p.Active,
+				}
+				if err := create(db, &existing, map[string]interface{}{"active": p.Active}); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			diff := fieldDiff{}
+			if existing.ProductGroupID != groupID {
+				diff["product_group_id"] = groupID
+			}
+			diff.str("name", existing.Name, p.Name)
+			diff.str("description", existing.Description, p.Description)
+			diff.str("module_name", existing.ModuleName, p.ModuleName)
+			diff.bool("active", existing.Active, p.Active)
+			if err := plan.update(db, &existing, "product", p.Slug, diff, apply); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := planPricing(db, plan, existing.ID, p, apply); err != nil {
+			return nil, err
+		}
+		if err := planProductLinks(db, plan, existing.ID, p, configGroupIDs, addonIDs, apply); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+func planConfigOptions(db *gorm.DB, plan *ImportPlan, groupID uint64, g CatalogConfigGroup, apply bool) error {
+	for _, o := range g.Options {
+		key := g.Name + "/" + o.Name
+
+		var existing domain.ConfigOption
+		found := false
+		if groupID != 0 {
+			var err error
+			found, err = findBy(db, &existing, "config_group_id = ? AND name = ?", groupID, o.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if !found {
+			plan.record("config_option", key, ActionCreate, nil)
+			if apply {
+				existing = domain.ConfigOption{ConfigGroupID: groupID, Name: o.Name, InputType: o.InputType, Required: o.Required, SortOrder: o.SortOrder}
+				if err := db.Create(&existing).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			diff := fieldDiff{}
+			diff.str("input_type", existing.InputType, o.InputType)
+			diff.bool("required", existing.Required, o.Required)
+			diff.int("sort_order", existing.SortOrder, o.SortOrder)
+			if err := plan.update(db, &existing, "config_option", key, diff, apply); err != nil {
+				return err
+			}
+		}
+
+		for _, so := range o.SubOptions {
+			subKey := key + "/" + so.Name
+
+			var sub domain.ConfigSubOption
+			subFound := false
+			if existing.ID != 0 {
+				var err error
+				subFound, err = findBy(db, &sub, "config_option_id = ? AND name = ?", existing.ID, so.Name)
+				if err != nil {
+					return err
+				}
+			}
+			if !subFound {
+				plan.record("config_sub_option", subKey, ActionCreate, nil)
+				if apply {
+					sub = domain.ConfigSubOption{ConfigOptionID: existing.ID, Name: so.Name, SortOrder: so.SortOrder, Pricing: domain.Pricing{
+						SetupFee:    so.Pricing.SetupFee,
+						Monthly:     so.Pricing.Monthly,
+						Quarterly:   so.Pricing.Quarterly,
+						Yearly:      so.Pricing.Yearly,
+						Triennially: so.Pricing.Triennially,
+					}}
+					if err := db.Create(&sub).Error; err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			diff := fieldDiff{}
+			diff.int("sort_order", sub.SortOrder, so.SortOrder)
+			diff.num("setup_fee", sub.Pricing.SetupFee, so.Pricing.SetupFee)
+			diff.num("monthly", sub.Pricing.Monthly, so.Pricing.Monthly)
+			diff.num("quarterly", sub.Pricing.Quarterly, so.Pricing.Quarterly)
+			diff.num("yearly", sub.Pricing.Yearly, so.Pricing.Yearly)
+			diff.num("triennially", sub.Pricing.Triennially, so.Pricing.Triennially)
+			if err := plan.update(db, &sub, "config_sub_option", subKey, diff, apply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func planPricing(db *gorm.DB, plan *ImportPlan, productID uint64, p CatalogProduct, apply bool) error {
+	for _, pr := range p.Pricing {
+		key := p.Slug + "/" + pr.Currency
+
+		var existing domain.ProductPricing
+		found := false
+		if productID != 0 {
+			var err error
+			found, err = findBy(db, &existing, "product_id = ? AND currency = ?", productID, pr.Currency)
+			if err != nil {
+				return err
+			}
+		}
+		if !found {
+			plan.record("pricing", key, ActionCreate, nil)
+			if apply {
+				// A price of 0 is free, not the disabled default of -1
+				pricing := pr.toDomain(productID)
+				if err := create(db, &pricing, map[string]interface{}{
+					"monthly":       pr.Monthly,
+					"quarterly":     pr.Quarterly,
+					"semi_annually": pr.SemiAnnually,
+					"annually":      pr.Annually,
+					"biennially":    pr.Biennially,
+					"triennially":   pr.Triennially,
+				}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		diff := fieldDiff{}
+		diff.num("setup_fee", existing.SetupFee, pr.SetupFee)
+		diff.num("monthly", existing.Monthly, pr.Monthly)
+		diff.num("quarterly", existing.Quarterly, pr.Quarterly)
+		diff.num("semi_annually", existing.SemiAnnually, pr.SemiAnnually)
+		diff.num("annually", existing.Annually, pr.Annually)
+		diff.num("biennially", existing.Biennially, pr.Biennially)
+		diff.num("triennially", existing.Triennially, pr.Triennially)
+		if err := plan.update(db, &existing, "pricing", key, diff, apply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planProductLinks replaces the config group and addon assignments of a
+// product with the ones listed in the catalog
+func planProductLinks(db *gorm.DB, plan *ImportPlan, productID uint64, p CatalogProduct,
+	configGroupIDs, addonIDs map[string]uint64, apply bool) error {
+	var currentConfig []domain.ProductConfigGroup
+	var currentAddons []domain.ProductAddonAssignment
+	if productID != 0 {
+		if err := db.Where("product_id = ?", productID).Find(&currentConfig).Error; err != nil {
+			return err
+		}
+		if err := db.Where("product_id = ?", productID).Find(&currentAddons).Error; err != nil {
+			return err
+		}
+	}
+
+	// The wanted links are keyed by name, as config groups and addons a
+	// preview would create all have the ID 0
+	wantConfig := map[string]uint64{}
+	for _, name := range p.ConfigGroups {
+		id, err := resolveID(db, configGroupIDs, &domain.ConfigGroup{}, "name", name)
+		if err != nil {
+			return err
+		}
+		wantConfig[name] = id
+	}
+	wantAddons := map[string]domain.ProductAddonAssignment{}
+	for _, link := range p.Addons {
+		id, err := resolveID(db, addonIDs, &domain.ProductAddon{}, "name", link.Name)
+		if err != nil {
+			return err
+		}
+		wantAddons[link.Name] = domain.ProductAddonAssignment{AddonID: id, Required: link.Required, SortOrder: link.SortOrder}
+	}
+
+	var fields []string
+	linkedConfig := map[uint64]bool{}
+	for _, link := range currentConfig {
+		linkedConfig[link.ConfigGroupID] = true
+	}
+	configChanged := len(currentConfig) != len(wantConfig)
+	for _, id := range wantConfig {
+		if id == 0 || !linkedConfig[id] {
+			configChanged = true
+		}
+	}
+	if configChanged {
+		fields = append(fields, "config_groups")
+	}
+	linkedAddons := map[uint64]domain.ProductAddonAssignment{}
+	for _, link := range currentAddons {
+		linkedAddons[link.AddonID] = link
+	}
+	addonsChanged := len(currentAddons) != len(wantAddons)
+	for _, want := range wantAddons {
+		link, ok := linkedAddons[want.AddonID]
+		if want.AddonID == 0 || !ok || want.Required != link.Required || want.SortOrder != link.SortOrder {
+			addonsChanged = true
+		}
+	}
+	if addonsChanged {
+		fields = append(fields, "addons")
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if productID == 0 || len(currentConfig)+len(currentAddons) == 0 {
+		plan.record("product_links", p.Slug, ActionCreate, fields)
+	} else {
+		plan.record("product_links", p.Slug, ActionUpdate, fields)
+	}
+	if !apply {
+		return nil
+	}
+
+	if configChanged {
+		if err := db.Where("product_id = ?", productID).Delete(&domain.ProductConfigGroup{}).Error; err != nil {
+			return err
+		}
+		for _, id := range wantConfig {
+			if err := db.Create(&domain.ProductConfigGroup{ProductID: productID, ConfigGroupID: id}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if addonsChanged {
+		if err := db.Where("product_id = ?", productID).Delete(&domain.ProductAddonAssignment{}).Error; err != nil {
+			return err
+		}
+		for _, assignment := range wantAddons {
+			assignment.ProductID = productID
+			if err := db.Create(&assignment).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func diffAddon(existing domain.ProductAddon, a CatalogAddon) fieldDiff {
+	diff := fieldDiff{}
+	diff.str("description", existing.Description, a.Description)
+	diff.str("type", existing.Type, a.Type)
+	diff.num("setup_fee", existing.SetupFee, a.SetupFee)
+	diff.num("monthly", existing.Monthly, a.Monthly)
+	diff.num("quarterly", existing.Quarterly, a.Quarterly)
+	diff.num("semi_annually", existing.SemiAnnually, a.SemiAnnually)
+	diff.num("annually", existing.Annually, a.Annually)
+	diff.num("biennially", existing.Biennially, a.Biennially)
+	diff.num("triennially", existing.Triennially, a.Triennially)
+	diff.num("one_time_price", existing.OneTimePrice, a.OneTimePrice)
+	diff.int("weight", existing.Weight, a.Weight)
+	diff.bool("show_on_order", existing.ShowOnOrder, a.ShowOnOrder)
+	diff.bool("active", existing.Active, a.Active)
+	diff.bool("suspend_parent", existing.SuspendParent, a.SuspendParent)
+	diff.bool("provision_automatically", existing.ProvisionAutomatically, a.ProvisionAutomatically)
+	diff.bool("allow_quantity", existing.AllowQuantity, a.AllowQuantity)
+	diff.int("max_quantity", existing.MaxQuantity, a.MaxQuantity)
+	return diff
+}
+
+// --- Helpers ---
+
+// fieldDiff collects changed columns and their new values
+type fieldDiff map[string]interface{}
+
+func (d fieldDiff) str(column, from, to string) {
+	if from != to {
+		d[column] = to
+	}
+}
+
+func (d fieldDiff) int(column string, from, to int) {
+	if from != to {
+		d[column] = to
+	}
+}
+
+func (d fieldDiff) bool(column string, from, to bool) {
+	if from != to {
+		d[column] = to
+	}
+}
+
+func (d fieldDiff) num(column string, from, to decimal.Decimal) {
+	if !from.Equal(to) {
+		d[column] = to
+	}
+}
+
+func (d fieldDiff) fields() []string {
+	fields := make([]string, 0, len(d))
+	for column := range d {
+		fields = append(fields, column)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (p *ImportPlan) record(kind, key, action string, fields []string) {
+	p.Changes = append(p.Changes, CatalogChange{Kind: kind, Key: key, Action: action, Fields: fields})
+	if action == ActionCreate {
+		p.Created++
+	} else {
+		p.Updated++
+	}
+}
+
+func (p *ImportPlan) update(db *gorm.DB, model interface{}, kind, key string, diff fieldDiff, apply bool) error {
+	if len(diff) == 0 {
+		p.Unchanged++
+		return nil
+	}
+	p.record(kind, key, ActionUpdate, diff.fields())
+	if !apply {
+		return nil
+	}
+	return db.Model(model).Updates(map[string]interface{}(diff)).Error
+}
+
+func findBy(db *gorm.DB, dest interface{}, query string, args ...interface{}) (bool, error) {
+	result := db.Where(query, args...).Limit(1).Find(dest)
+	return result.RowsAffected > 0, result.Error
+}
+
+// create inserts a record and then writes columns whose false or zero
+// value would otherwise be replaced by a database default
+func create(db *gorm.DB, model interface{}, columns map[string]interface{}) error {
+	if err := db.Create(model).Error; err != nil {
+		return err
+	}
+	for column, value := range columns {
+		if amount, ok := value.(decimal.Decimal); ok && amount.IsZero() {
+			if err := db.Model(model).Update(column, amount).Error; err != nil {
+				return err
+			}
+		}
+		if value == false {
+			if err := db.Model(model).Update(column, false).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveID looks a key up in the IDs collected from the catalog and falls
+// back to the database for records the catalog does not include
+func resolveID(db *gorm.DB, ids map[string]uint64, model interface{}, column, key string) (uint64, error) {
+	if id, ok := ids[key]; ok {
+		return id, nil
+	}
+	var found []uint64
+	if err := db.Model(model).Where(column+" = ?", key).Limit(1).Pluck("id", &found).Error; err != nil {
+		return 0, err
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+	return found[0], nil
+}
+
+func catalogAddonFromDomain(a domain.ProductAddon) CatalogAddon {
+	return CatalogAddon{
+		Name:                   a.Name,
+		Description:            a.Description,
+		Type:                   a.Type,
+		SetupFee:               a.SetupFee,
+		Monthly:                a.Monthly,
+		Quarterly:              a.Quarterly,
+		SemiAnnually:           a.SemiAnnually,
+		Annually:               a.Annually,
+		Biennially:             a.Biennially,
+		Triennially:            a.Triennially,
+		OneTimePrice:           a.OneTimePrice,
+		Weight:                 a.Weight,
+		ShowOnOrder:            a.ShowOnOrder,
+		Active:                 a.Active,
+		SuspendParent:          a.SuspendParent,
+		ProvisionAutomatically: a.ProvisionAutomatically,
+		AllowQuantity:          a.AllowQuantity,
+		MaxQuantity:            a.MaxQuantity,
+	}
+}
+
+func (a CatalogAddon) toDomain() domain.ProductAddon {
+	return domain.ProductAddon{
+		Name:                   a.Name,
+		Description:            a.Description,
+		Type:                   a.Type,
+		SetupFee:               a.SetupFee,
+		Monthly:                a.Monthly,
+		Quarterly:              a.Quarterly,
+		SemiAnnually:           a.SemiAnnually,
+		Annually:               a.Annually,
+		Biennially:             a.Biennially,
+		Triennially:            a.Triennially,
+		OneTimePrice:           a.OneTimePrice,
+		Weight:                 a.Weight,
+		ShowOnOrder:            a.ShowOnOrder,
+		Active:                 a.Active,
+		SuspendParent:          a.SuspendParent,
+		ProvisionAutomatically: a.ProvisionAutomatically,
+		AllowQuantity:          a.AllowQuantity,
+		MaxQuantity:            a.MaxQuantity,
+	}
+}
+
+func catalogPricingFromDomain(p domain.ProductPricing) CatalogPricing {
+	return CatalogPricing{
+		Currency:     p.Currency,
+		SetupFee:     p.SetupFee,
+		Monthly:      p.Monthly,
+		Quarterly:    p.Quarterly,
+		SemiAnnually: p.SemiAnnually,
+		Annually:     p.Annually,
+		Biennially:   p.Biennially,
+		Triennially:  p.Triennially,
+	}
+}
+
+func (p CatalogPricing) toDomain(productID uint64) domain.ProductPricing {
+	return domain.ProductPricing{
+		ProductID:    productID,
+		Currency:     p.Currency,
+		SetupFee:     p.SetupFee,
+		Monthly:      p.Monthly,
+		Quarterly:    p.Quarterly,
+		SemiAnnually: p.SemiAnnually,
+		Annually:     p.Annually,
+		Biennially:   p.Biennially,
+		Triennially:  p.Triennially,
+	}
+}
+
+// --- CSV ---
+
+// catalogCSVHeader lists the CSV columns. There is one row per product and
+// pricing currency; config groups and addons are referenced by name and are
+// only exported and imported in the JSON format.
+var catalogCSVHeader = []string{
+	"group_slug", "group_name", "group_description", "group_sort_order", "group_active",
+	"product_slug", "product_name", "product_description", "module_name", "product_active",
+	"currency", "setup_fee", "monthly", "quarterly", "semiannually", "annually", "biennially", "triennially",
+	"config_groups", "addons", "required_addons",
+}
+
+// WriteCatalogCSV writes the groups, products, pricing and product
+// assignments of a catalog as CSV
+func WriteCatalogCSV(w io.Writer, catalog *Catalog) error {
+	groups := map[string]CatalogGroup{}
+	for _, g := range catalog.Groups {
+		groups[g.Slug] = g
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(catalogCSVHeader); err != nil {
+		return err
+	}
+
+	for _, p := range catalog.Products {
+		g := groups[p.GroupSlug]
+
+		var addons, required []string
+		for _, link := range p.Addons {
+			if link.Required {
+				required = append(required, link.Name)
+			} else {
+				addons = append(addons, link.Name)
+			}
+		}
+
+		base := []string{
+			p.GroupSlug, g.Name, g.Description, strconv.Itoa(g.SortOrder), strconv.FormatBool(g.Active),
+			p.Slug, p.Name, p.Description, p.ModuleName, strconv.FormatBool(p.Active),
+		}
+		links := []string{strings.Join(p.ConfigGroups, ";"), strings.Join(addons, ";"), strings.Join(required, ";")}
+
+		pricing := p.Pricing
+		if len(pricing) == 0 {
+			pricing = []CatalogPricing{{}}
+		}
+		for _, pr := range pricing {
+			prices := make([]string, 8)
+			if pr.Currency != "" {
+				prices = []string{
+					pr.Currency, pr.SetupFee.String(), pr.Monthly.String(), pr.Quarterly.String(),
+					pr.SemiAnnually.String(), pr.Annually.String(), pr.Biennially.String(), pr.Triennially.String(),
+				}
+			}
+			row := append(append(append([]string{}, base...), prices...), links...)
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadCatalogCSV parses a CSV written by WriteCatalogCSV
+func ReadCatalogCSV(r io.Reader) (*Catalog, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range catalogCSVHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, &ValidationError{Problems: []string{fmt.Sprintf("missing csv column %q", name)}}
+		}
+	}
+
+	catalog := &Catalog{Version: CatalogVersion}
+	groups := map[string]bool{}
+	products := map[string]int{}
+	var problems []string
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		get := func(name string) string {
+			return strings.TrimSpace(record[columns[name]])
+		}
+		addf := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+
+		groupSlug := get("group_slug")
+		if groupSlug != "" && !groups[groupSlug] && get("group_name") != "" {
+			groups[groupSlug] = true
+			sortOrder, err := parseCSVInt(get("group_sort_order"))
+			if err != nil {
+				addf("invalid group_sort_order")
+			}
+			catalog.Groups = append(catalog.Groups, CatalogGroup{
+				Slug:        groupSlug,
+				Name:        get("group_name"),
+				Description: get("group_description"),
+				SortOrder:   sortOrder,
+				Active:      parseCSVBool(get("group_active")),
+			})
+		}
+
+		slug := get("product_slug")
+		index, seen := products[slug]
+		if !seen {
+			product := CatalogProduct{
+				Slug:         slug,
+				GroupSlug:    groupSlug,
+				Name:         get("product_name"),
+				Description:  get("product_description"),
+				ModuleName:   get("module_name"),
+				Active:       parseCSVBool(get("product_active")),
+				ConfigGroups: splitCSVList(get("config_groups")),
+			}
+			for i, name := range splitCSVList(get("addons")) {
+				product.Addons = append(product.Addons, CatalogAddonLink{Name: name, SortOrder: i})
+			}
+			for _, name := range splitCSVList(get("required_addons")) {
+				product.Addons = append(product.Addons, CatalogAddonLink{Name: name, Required: true, SortOrder: len(product.Addons)})
+			}
+			catalog.Products = append(catalog.Products, product)
+			index = len(catalog.Products) - 1
+			products[slug] = index
+		}
+
+		if currency := strings.ToUpper(get("currency")); currency != "" {
+			pricing := CatalogPricing{Currency: currency}
+			targets := []struct {
+				column string
+				value  *decimal.Decimal
+			}{
+				{"setup_fee", &pricing.SetupFee},
+				{"monthly", &pricing.Monthly},
+				{"quarterly", &pricing.Quarterly},
+				{"semiannually", &pricing.SemiAnnually},
+				{"annually", &pricing.Annually},
+				{"biennially", &pricing.Biennially},
+				{"triennially", &pricing.Triennially},
+			}
+			for _, t := range targets {
+				raw := get(t.column)
+				if raw == "" {
+					// Empty cells disable the cycle, except the setup fee
+					if t.column == "setup_fee" {
+						*t.value = decimal.Zero
+					} else {
+						*t.value = decimal.NewFromInt(-1)
+					}
+					continue
+				}
+				value, err := decimal.NewFromString(raw)
+				if err != nil {
+					addf("invalid %s %q", t.column, raw)
+					continue
+				}
+				*t.value = value
+			}
+			catalog.Products[index].Pricing = append(catalog.Products[index].Pricing, pricing)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return catalog, nil
+}
+
+func parseCSVInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func parseCSVBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y":
+		return true
+	}
+	return false
+}
+
+func splitCSVList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Catalog is a portable snapshot of the product catalog
+type Catalog struct {
+	Version      int                  `json:"version"`
+	ExportedAt   time.Time            `json:"exported_at"`
+	Groups       []CatalogGroup       `json:"groups"`
+	ConfigGroups []CatalogConfigGroup `json:"config_groups"`
+	Addons       []CatalogAddon       `json:"addons"`
+	Products     []CatalogProduct     `json:"products"`
+}
+
+// CatalogGroup is a product group keyed by slug
+type CatalogGroup struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+	Active      bool   `json:"active"`
+}
+
+// CatalogConfigGroup is a config group keyed by name
+type CatalogConfigGroup struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Options     []CatalogConfigOption `json:"options"`
+}
+
+// CatalogConfigOption is a config option keyed by name within its group
+type CatalogConfigOption struct {
+	Name       string                   `json:"name"`
+	InputType  string                   `json:"input_type"`
+	Required   bool                     `json:"required"`
+	SortOrder  int                      `json:"sort_order"`
+	SubOptions []CatalogConfigSubOption `json:"sub_options"`
+}
+
+// CatalogConfigSubOption is a sub-option keyed by name within its option
+type CatalogConfigSubOption struct {
+	Name      string               `json:"name"`
+	SortOrder int                  `json:"sort_order"`
+	Pricing   CatalogOptionPricing `json:"pricing"`
+}
+
+// CatalogOptionPricing is the price of a config sub-option
+type CatalogOptionPricing struct {
+	SetupFee    decimal.Decimal `json:"setup_fee"`
+	Monthly     decimal.Decimal `json:"monthly"`
+	Quarterly   decimal.Decimal `json:"quarterly"`
+	Yearly      decimal.Decimal `json:"yearly"`
+	Triennially decimal.Decimal `json:"triennially"`
+}
+
+// CatalogAddon is a product addon keyed by name
+type CatalogAddon struct {
+	Name                   string          `json:"name"`
+	Description            string          `json:"description"`
+	Type                   string          `json:"type"`
+	SetupFee               decimal.Decimal `json:"setup_fee"`
+	Monthly                decimal.Decimal `json:"monthly"`
+	Quarterly              decimal.Decimal `json:"quarterly"`
+	SemiAnnually           decimal.Decimal `json:"semiannually"`
+	Annually               decimal.Decimal `json:"annually"`
+	Biennially             decimal.Decimal `json:"biennially"`
+	Triennially            decimal.Decimal `json:"triennially"`
+	OneTimePrice           decimal.Decimal `json:"one_time_price"`
+	Weight                 int             `json:"weight"`
+	ShowOnOrder            bool            `json:"show_on_order"`
+	Active                 bool            `json:"active"`
+	SuspendParent          bool            `json:"suspend_parent"`
+	ProvisionAutomatically bool            `json:"provision_automatically"`
+	AllowQuantity          bool            `json:"allow_quantity"`
+	MaxQuantity            int             `json:"max_quantity"`
+}
+
+// CatalogProduct is a product keyed by slug
+type CatalogProduct struct {
+	Slug         string             `json:"slug"`
+	GroupSlug    string             `json:"group_slug"`
+	Name         string             `json:"name"`
+	Description  string             `json:"description"`
+	ModuleName   string             `json:"module_name"`
+	Active       bool               `json:"active"`
+	Pricing      []CatalogPricing   `json:"pricing"`
+	ConfigGroups []string           `json:"config_groups"`
+	Addons       []CatalogAddonLink `json:"addons"`
+}
+
+// CatalogPricing is the pricing of a product in one currency
+type CatalogPricing struct {
+	Currency     string          `json:"currency"`
+	SetupFee     decimal.Decimal `json:"setup_fee"`
+	Monthly      decimal.Decimal `json:"monthly"`
+	Quarterly    decimal.Decimal `json:"quarterly"`
+	SemiAnnually decimal.Decimal `json:"semiannually"`
+	Annually     decimal.Decimal `json:"annually"`
+	Biennially   decimal.Decimal `json:"biennially"`
+	Triennially  decimal.Decimal `json:"triennially"`
+}
+
+// CatalogAddonLink assigns an addon to a product
+type CatalogAddonLink struct {
+	Name      string `json:"name"`
+	Required  bool   `json:"required"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// ImportPlan lists the changes found, or made, by a catalog import
+type ImportPlan struct {
+	Applied   bool            `json:"applied"`
+	Created   int             `json:"created"`
+	Updated   int             `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Changes   []CatalogChange `json:"changes"`
+}
+
+// CatalogChange is one record created or updated by an import
+type CatalogChange struct {
+	Kind   string   `json:"kind"`
+	Key    string   `json:"key"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
@@ -0,0 +1,85 @@
+package product
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// TestPreviewMatchesImport checks that previewing a catalog reports the
+// changes importing it makes, including links to records it creates
+func TestPreviewMatchesImport(t *testing.T) {
+	service := NewService(testutil.OpenDB(t))
+
+	addon := func(name string) CatalogAddon {
+		return CatalogAddon{Name: name, Type: "recurring", Monthly: decimal.NewFromInt(2), ShowOnOrder: true, Active: true}
+	}
+	pricing := []CatalogPricing{{Currency: "USD", Monthly: decimal.NewFromInt(10)}}
+	existing := &Catalog{
+		Version:      CatalogVersion,
+		Groups:       []CatalogGroup{{Slug: "hosting", Name: "Hosting", Active: true}},
+		ConfigGroups: []CatalogConfigGroup{{Name: "OS", Options: []CatalogConfigOption{{Name: "Image", InputType: "dropdown"}}}},
+		Addons:       []CatalogAddon{addon("Backups")},
+		Products: []CatalogProduct{{
+			Slug: "basic", GroupSlug: "hosting", Name: "Basic", ModuleName: "mock", Active: true, Pricing: pricing,
+			ConfigGroups: []string{"OS"},
+			Addons:       []CatalogAddonLink{{Name: "Backups"}},
+		}},
+	}
+	if _, err := service.ImportCatalog(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moves the existing product to a new group and links it to several
+	// new config groups and addons, which a preview cannot give IDs yet
+	catalog := &Catalog{
+		Version: CatalogVersion,
+		Groups: []CatalogGroup{
+			{Slug: "hosting", Name: "Shared Hosting", Active: true},
+			{Slug: "vps", Name: "VPS", Active: true},
+		},
+		ConfigGroups: []CatalogConfigGroup{
+			{Name: "OS", Options: []CatalogConfigOption{{Name: "Image", InputType: "dropdown"}}},
+			{Name: "Location", Options: []CatalogConfigOption{{Name: "Region", InputType: "dropdown",
+				SubOptions: []CatalogConfigSubOption{{Name: "EU"}, {Name: "US"}}}}},
+			{Name: "Panel"},
+		},
+		Addons: []CatalogAddon{addon("Backups"), addon("IPv4"), addon("Support")},
+		Products: []CatalogProduct{
+			{
+				Slug: "basic", GroupSlug: "vps", Name: "Basic", ModuleName: "mock", Active: true, Pricing: pricing,
+				ConfigGroups: []string{"OS", "Location", "Panel"},
+				Addons:       []CatalogAddonLink{{Name: "Backups", Required: true}, {Name: "IPv4"}, {Name: "Support", SortOrder: 1}},
+			},
+			{
+				Slug: "cloud", GroupSlug: "vps", Name: "Cloud", ModuleName: "mock", Active: true, Pricing: pricing,
+				ConfigGroups: []string{"Location", "Panel"},
+				Addons:       []CatalogAddonLink{{Name: "IPv4"}, {Name: "Support"}},
+			},
+		},
+	}
+
+	preview, err := service.PreviewImport(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := service.ImportCatalog(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview.Applied = applied.Applied
+	if !reflect.DeepEqual(preview, applied) {
+		t.Errorf("preview reported\n%+v\nimport made\n%+v", preview, applied)
+	}
+
+	again, err := service.PreviewImport(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Created != 0 || again.Updated != 0 {
+		t.Errorf("preview after the import reported %+v, want no changes", again.Changes)
+	}
+}
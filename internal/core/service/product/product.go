@@ -2,17 +2,21 @@ package product
 
 import (
 	"errors"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
 )
 
 var (
 	ErrProductNotFound      = errors.New("product not found")
 	ErrProductGroupNotFound = errors.New("product group not found")
 	ErrConfigGroupNotFound  = errors.New("config group not found")
+	ErrSubOptionNotFound    = errors.New("config sub-option not found")
 	ErrSlugExists           = errors.New("slug already exists")
 )
 
@@ -39,6 +43,20 @@ func (s *Service) GetPricing(productID uint64, currency string) (*domain.Product
 	return &pricing, nil
 }
 
+// GetCustomerPricing returns the pricing of a product in a currency with
+// the prices of the customer's groups in place of the product prices.
+// Guests pass 0.
+func (s *Service) GetCustomerPricing(productID uint64, currency string, customerID uint64) (*domain.ProductPricing, error) {
+	pricing, err := s.GetPricing(productID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := customergroup.ApplyPrices(s.db, customerID, pricing); err != nil {
+		return nil, err
+	}
+	return pricing, nil
+}
+
 // CreateProductGroup creates a new product group
 func (s *Service) CreateProductGroup(name, slug, description string, sortOrder int, active bool) (*domain.ProductGroup, error) {
 	// Check if slug already exists
@@ -154,6 +172,9 @@ func (s *Service) GetProduct(id uint64) (*domain.Product, error) {
 		}
 		return nil, err
 	}
+	if err := s.markSoldOut(&product); err != nil {
+		return nil, err
+	}
 	return &product, nil
 }
 
@@ -167,9 +188,77 @@ func (s *Service) GetProductBySlug(slug string) (*domain.Product, error) {
 		}
 		return nil, err
 	}
+	if err := s.markSoldOut(&product); err != nil {
+		return nil, err
+	}
 	return &product, nil
 }
 
+// markSoldOut flags the stock controlled sub-options of a product that have
+// no stock left after cart and order reservations
+func (s *Service) markSoldOut(product *domain.Product) error {
+	var ids []uint64
+	for _, group := range product.ConfigGroups {
+		for _, option := range group.Options {
+			for _, sub := range option.SubOptions {
+				if sub.StockControl {
+					ids = append(ids, sub.ID)
+				}
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		SubOptionID uint64
+		Reserved    int
+	}
+	if err := s.db.Model(&domain.ConfigStockReservation{}).
+		Select("sub_option_id, SUM(quantity) AS reserved").
+		Where("sub_option_id IN ? AND (expires_at IS NULL OR expires_at > ?)", ids, time.Now()).
+		Group("sub_option_id").Scan(&rows).Error; err != nil {
+		return err
+	}
+	reserved := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		reserved[row.SubOptionID] = row.Reserved
+	}
+
+	for g := range product.ConfigGroups {
+		for o := range product.ConfigGroups[g].Options {
+			subs := product.ConfigGroups[g].Options[o].SubOptions
+			for i := range subs {
+				if subs[i].StockControl {
+					subs[i].SoldOut = subs[i].StockQuantity-reserved[subs[i].ID] <= 0
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SetSubOptionStock configures stock control of a config sub-option
+func (s *Service) SetSubOptionStock(subOptionID uint64, stockControl bool, quantity int, outOfStockMsg string) (*domain.ConfigSubOption, error) {
+	var subOption domain.ConfigSubOption
+	if err := s.db.First(&subOption, subOptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubOptionNotFound
+		}
+		return nil, err
+	}
+
+	if err := s.db.Model(&subOption).Updates(map[string]interface{}{
+		"stock_control":    stockControl,
+		"stock_quantity":   quantity,
+		"out_of_stock_msg": outOfStockMsg,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &subOption, nil
+}
+
 // ListProducts returns products with optional filters
 func (s *Service) ListProducts(groupID *uint64, activeOnly bool, limit, offset int) ([]domain.Product, int64, error) {
 	var products []domain.Product
@@ -191,6 +280,48 @@ func (s *Service) ListProducts(groupID *uint64, activeOnly bool, limit, offset i
 	return products, total, nil
 }
 
+// ListCatalog lists the products a customer can see, leaving out
+// restricted products their groups have no prices for. Guests pass 0.
+func (s *Service) ListCatalog(customerID uint64, groupID *uint64, activeOnly bool, limit, offset int) ([]domain.Product, int64, error) {
+	var products []domain.Product
+	var total int64
+
+	query := customergroup.Visible(s.db, s.db.Model(&domain.Product{}), customerID)
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if groupID != nil {
+		query = query.Where("product_group_id = ?", *groupID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Order("name ASC").Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// IsVisible reports whether a customer can see and order a product.
+// Guests pass 0.
+func (s *Service) IsVisible(customerID uint64, product *domain.Product) (bool, error) {
+	return customergroup.CanSee(s.db, customerID, product)
+}
+
+// SetRestricted sets whether a product is only shown to and orderable by
+// the customer groups with prices for it
+func (s *Service) SetRestricted(id uint64, restricted bool) error {
+	result := s.db.Model(&domain.Product{}).Where("id = ?", id).Update("restricted", restricted)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
 // UpdateProduct updates a product
 func (s *Service) UpdateProduct(id uint64, name, description, moduleName string, active bool) error {
 	updates := map[string]interface{}{
@@ -281,19 +412,52 @@ func (s *Service) CreateConfigSubOption(optionID uint64, name string, sortOrder
 	return subOption, nil
 }
 
-// GetProductPricing returns pricing for a product based on selected options
-func (s *Service) GetProductPricing(productID uint64, billingCycle string, selectedOptions map[uint64]uint64) (*ProductPricingResult, error) {
+// GetProductPricing returns pricing for quantity units of a product based
+// on selected options. Quantity breaks and term promotions of the product
+// price in the currency are applied and listed as savings. Without a
+// currency the customer is priced in the currency they are billed in. The
+// prices of the customer's groups replace the product prices; guests pass 0.
+func (s *Service) GetProductPricing(productID uint64, billingCycle string, selectedOptions map[uint64]uint64, quantity int, currency string, customerID uint64) (*ProductPricingResult, error) {
 	product, err := s.GetProduct(productID)
 	if err != nil {
 		return nil, err
 	}
+	if quantity <= 0 {
+		quantity = 1
+	}
+	if currency == "" {
+		if currency, err = account.CustomerCurrency(s.db, customerID); err != nil {
+			return nil, err
+		}
+	}
 
 	result := &ProductPricingResult{
-		ProductID:    productID,
-		ProductName:  product.Name,
-		BillingCycle: billingCycle,
-		SetupFee:     decimal.Zero,
-		RecurringFee: decimal.Zero,
+		ProductID:         productID,
+		ProductName:       product.Name,
+		BillingCycle:      billingCycle,
+		Quantity:          quantity,
+		Currency:          currency,
+		SetupFee:          decimal.Zero,
+		RecurringFee:      decimal.Zero,
+		FirstTermDiscount: decimal.Zero,
+	}
+
+	var pricing domain.ProductPricing
+	query := s.db.Preload("Tiers").Where("product_id = ? AND currency = ?", productID, currency).Limit(1).Find(&pricing)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	if query.RowsAffected > 0 {
+		if err := customergroup.ApplyPrices(s.db, customerID, &pricing); err != nil {
+			return nil, err
+		}
+	}
+	if query.RowsAffected > 0 && pricing.IsCycleEnabled(billingCycle) {
+		tiered := pricing.TieredPrice(billingCycle, quantity, time.Now())
+		result.SetupFee = pricing.SetupFee
+		result.RecurringFee = tiered.UnitPrice
+		result.FirstTermDiscount = tiered.FirstTermDiscount.Mul(decimal.NewFromInt(int64(quantity)))
+		result.Savings = tiered.Savings
 	}
 
 	// Calculate pricing from selected options
@@ -332,7 +496,7 @@ func (s *Service) GetProductPricing(productID uint64, billingCycle string, selec
 		}
 	}
 
-	result.Total = result.SetupFee.Add(result.RecurringFee)
+	result.Total = result.SetupFee.Add(result.RecurringFee.Mul(decimal.NewFromInt(int64(quantity)))).Sub(result.FirstTermDiscount)
 	return result, nil
 }
 
@@ -357,13 +521,17 @@ type PricingRequest struct {
 
 // ProductPricingResult represents the calculated pricing for a product
 type ProductPricingResult struct {
-	ProductID       uint64                 `json:"product_id"`
-	ProductName     string                 `json:"product_name"`
-	BillingCycle    string                 `json:"billing_cycle"`
-	SetupFee        decimal.Decimal        `json:"setup_fee"`
-	RecurringFee    decimal.Decimal        `json:"recurring_fee"`
-	Total           decimal.Decimal        `json:"total"`
-	SelectedOptions []SelectedOptionDetail `json:"selected_options"`
+	ProductID         uint64                 `json:"product_id"`
+	ProductName       string                 `json:"product_name"`
+	BillingCycle      string                 `json:"billing_cycle"`
+	Quantity          int                    `json:"quantity"`
+	Currency          string                 `json:"currency"`
+	SetupFee          decimal.Decimal        `json:"setup_fee"`
+	RecurringFee      decimal.Decimal        `json:"recurring_fee"` // Per unit, after tiers
+	FirstTermDiscount decimal.Decimal        `json:"first_term_discount"`
+	Total             decimal.Decimal        `json:"total"`
+	Savings           []domain.PriceSaving   `json:"savings,omitempty"`
+	SelectedOptions   []SelectedOptionDetail `json:"selected_options"`
 }
 
 // SelectedOptionDetail represents a selected configuration option
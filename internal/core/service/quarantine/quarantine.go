@@ -0,0 +1,276 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+// NotificationMalwareDetected is sent to the admins for every rejected
+// upload
+const NotificationMalwareDetected = "malware_detected"
+
+// sourceNames names the upload sources in alerts
+var sourceNames = map[string]string{
+	domain.UploadSourceTicket:   "ticket",
+	domain.UploadSourceKB:       "knowledge base article",
+	domain.UploadSourceDownload: "download",
+	domain.UploadSourceService:  "service",
+	domain.UploadSourceMedia:    "media library image",
+}
+
+var (
+	ErrInfected     = errors.New("file was rejected by the malware scanner")
+	ErrScanFailed   = errors.New("file could not be scanned for malware")
+	ErrFileNotFound = errors.New("quarantined file not found")
+	ErrNoFileStore  = errors.New("file storage is not configured")
+)
+
+// Service scans uploads for malware before they are stored. Infected
+// files are moved to quarantine instead and reported to the admins.
+type Service struct {
+	db      *gorm.DB
+	files   domain.FileStore
+	scanner domain.FileScanner
+}
+
+// NewService creates a new quarantine service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetFileStore sets the store quarantined files are kept in
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetScanner sets the malware scanner uploads are checked with
+func (s *Service) SetScanner(scanner domain.FileScanner) {
+	s.scanner = scanner
+}
+
+// Enabled reports whether uploads are scanned
+func (s *Service) Enabled() bool {
+	return s != nil && s.scanner != nil
+}
+
+// Upload is a file to be scanned
+type Upload struct {
+	Source      string
+	SourceID    uint64
+	UploadedBy  *uint64
+	FileName    string
+	ContentType string
+	Reader      io.Reader
+	// Size is -1 when unknown
+	Size int64
+}
+
+// Checked is an upload that passed the scanner, ready to be stored from
+// its start. Close releases the spool file of uploads that could not
+// seek.
+type Checked struct {
+	io.Reader
+	Size       int64
+	ScanStatus string
+	spool      *os.File
+}
+
+// Close removes the spool file of the upload, if any
+func (c *Checked) Close() error {
+	if c.spool == nil {
+		return nil
+	}
+	c.spool.Close()
+	return os.Remove(c.spool.Name())
+}
+
+// Check scans an upload. A nil Service, or one without a scanner, passes
+// uploads through unscanned. Infected files are quarantined and reported
+// to the admins, and ErrInfected is returned naming the threat.
+func (s *Service) Check(ctx context.Context, upload Upload) (*Checked, error) {
+	if !s.Enabled() {
+		return &Checked{Reader: upload.Reader, Size: upload.Size, ScanStatus: domain.ScanStatusUnscanned}, nil
+	}
+
+	checked := &Checked{Size: upload.Size, ScanStatus: domain.ScanStatusClean}
+	r, ok := upload.Reader.(io.ReadSeeker)
+	if !ok {
+		spool, size, err := spoolFile(upload.Reader)
+		if err != nil {
+			return nil, err
+		}
+		r, checked.spool, checked.Size = spool, spool, size
+	}
+	checked.Reader = r
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		checked.Close()
+		return nil, err
+	}
+
+	threat, err := s.scanner.Scan(ctx, r)
+	if err == nil {
+		_, err = r.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		checked.Close()
+		log.Printf("quarantine: failed to scan %q from %s %d: %v", upload.FileName, upload.Source, upload.SourceID, err)
+		return nil, ErrScanFailed
+	}
+	if threat != "" {
+		defer checked.Close()
+		upload.Reader, upload.Size = r, checked.Size
+		s.quarantine(ctx, upload, threat)
+		return nil, fmt.Errorf("%w: %s", ErrInfected, threat)
+	}
+	return checked, nil
+}
+
+// spoolFile copies a stream to a temporary file so it can be read twice
+func spoolFile(r io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "openhost-scan-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// quarantine keeps an infected upload for review and alerts the admins.
+// Failures are logged; the upload is rejected either way.
+func (s *Service) quarantine(ctx context.Context, upload Upload, threat string) {
+	contentType := upload.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	record := &domain.QuarantinedFile{
+		Source:      upload.Source,
+		SourceID:    upload.SourceID,
+		UploadedBy:  upload.UploadedBy,
+		FileName:    upload.FileName,
+		ContentType: contentType,
+		FileSize:    upload.Size,
+		Threat:      threat,
+	}
+
+	if s.files != nil {
+		key, err := domain.NewFileKey("quarantine/" + upload.Source)
+		if err == nil {
+			err = s.files.Put(ctx, key, upload.Reader, upload.Size, contentType)
+		}
+		if err != nil {
+			log.Printf("quarantine: failed to store %q: %v", upload.FileName, err)
+		} else {
+			record.StorageKey = key
+		}
+	}
+	if err := s.db.Omit("Uploader").Create(record).Error; err != nil {
+		log.Printf("quarantine: failed to record %q: %v", upload.FileName, err)
+		s.removeFile(record.StorageKey)
+		return
+	}
+	log.Printf("quarantine: rejected %q from %s %d: %s", upload.FileName, upload.Source, upload.SourceID, threat)
+
+	s.alert(record)
+}
+
+// alert notifies the admins of a quarantined file
+func (s *Service) alert(file *domain.QuarantinedFile) {
+	var admins []domain.User
+	if err := s.db.Select("id").Where("role = ?", domain.UserRoleAdmin).Find(&admins).Error; err != nil {
+		log.Printf("quarantine: failed to load admins: %v", err)
+		return
+	}
+
+	notifier := notification.NewService(s.db)
+	source := sourceNames[file.Source]
+	if source == "" {
+		source = file.Source
+	}
+	title := fmt.Sprintf("Malware detected in %s", file.FileName)
+	message := fmt.Sprintf("%s uploaded to %s #%d contains %s and was quarantined.", file.FileName, source, file.SourceID, file.Threat)
+	if file.SourceID == 0 {
+		message = fmt.Sprintf("%s uploaded as a new %s contains %s and was quarantined.", file.FileName, source, file.Threat)
+	}
+	link := fmt.Sprintf("/admin/quarantine/%d", file.ID)
+	for _, admin := range admins {
+		if err := notifier.SendNotification(admin.ID, NotificationMalwareDetected, title, message, link); err != nil {
+			log.Printf("quarantine: failed to notify user %d: %v", admin.ID, err)
+		}
+	}
+}
+
+// ListFiles lists quarantined files, newest first, optionally of a source
+func (s *Service) ListFiles(source string, limit, offset int) ([]domain.QuarantinedFile, int64, error) {
+	query := s.db.Model(&domain.QuarantinedFile{})
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var files []domain.QuarantinedFile
+	if err := query.Preload("Uploader").Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&files).Error; err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// GetFile retrieves a quarantined file
+func (s *Service) GetFile(id uint64) (*domain.QuarantinedFile, error) {
+	var file domain.QuarantinedFile
+	if err := s.db.Preload("Uploader").First(&file, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// FileURL returns a signed URL of a quarantined file, for analysis
+func (s *Service) FileURL(file *domain.QuarantinedFile, expires time.Duration) (string, error) {
+	if s.files == nil || file.StorageKey == "" {
+		return "", ErrNoFileStore
+	}
+	return s.files.SignedURL(file.StorageKey, file.FileName, expires)
+}
+
+// DeleteFile deletes a quarantined file and its stored content
+func (s *Service) DeleteFile(file *domain.QuarantinedFile) error {
+	if err := s.db.Delete(&domain.QuarantinedFile{}, file.ID).Error; err != nil {
+		return err
+	}
+	s.removeFile(file.StorageKey)
+	return nil
+}
+
+func (s *Service) removeFile(key string) {
+	if key == "" || s.files == nil {
+		return
+	}
+	if err := s.files.Delete(context.Background(), key); err != nil {
+		log.Printf("quarantine: failed to delete file %s: %v", key, err)
+	}
+}
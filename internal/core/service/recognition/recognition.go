@@ -0,0 +1,241 @@
+// Package recognition spreads the revenue of prepaid invoices over the
+// months of the service periods they pay for, so finance can tell the
+// revenue earned in a month from the revenue still owed as service.
+package recognition
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ErrInvalidPeriod = errors.New("the period must end after it starts")
+
+// scheduleBatch is the number of invoices scheduled at once
+const scheduleBatch = 100
+
+// Service builds and reports revenue recognition schedules
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new recognition service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Schedule creates the recognition entries of paid invoices that have
+// none and removes the entries of invoices refunded or cancelled since.
+// It returns how many invoices were scheduled.
+func (s *Service) Schedule() (int, error) {
+	if err := s.db.Where("invoice_id IN (?)", s.db.Model(&domain.Invoice{}).Select("id").
+		Where("status IN ?", []domain.InvoiceStatus{domain.InvoiceStatusRefunded, domain.InvoiceStatusCancelled})).
+		Delete(&domain.RevenueEntry{}).Error; err != nil {
+		return 0, err
+	}
+
+	var invoices []domain.Invoice
+	count := 0
+	err := s.db.Preload("LineItems").
+		Where("status = ? AND paid_at IS NOT NULL", domain.InvoiceStatusPaid).
+		Where("NOT EXISTS (SELECT 1 FROM revenue_entries WHERE revenue_entries.invoice_id = invoices.id)").
+		FindInBatches(&invoices, scheduleBatch, func(tx *gorm.DB, batch int) error {
+			for i := range invoices {
+				entries := Entries(&invoices[i])
+				if len(entries) == 0 {
+					continue
+				}
+				if err := s.db.Create(&entries).Error; err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		}).Error
+	return count, err
+}
+
+// Monitor schedules newly paid invoices on the given interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Schedule(); err != nil {
+			log.Printf("failed to schedule revenue recognition: %v", err)
+		} else if n > 0 {
+			log.Printf("scheduled revenue of %d invoice(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Entries splits the net amount of a paid invoice into monthly entries.
+// The invoice discount is shared by the items in proportion to their
+// totals, and months of a period before the invoice was paid are
+// recognized in the month of payment.
+func Entries(invoice *domain.Invoice) []domain.RevenueEntry {
+	if invoice.PaidAt == nil {
+		return nil
+	}
+
+	itemsTotal := decimal.Zero
+	for _, item := range invoice.LineItems {
+		itemsTotal = itemsTotal.Add(item.Total)
+	}
+	net := invoice.Total.Sub(invoice.TaxAmount)
+	if itemsTotal.IsZero() || net.IsZero() {
+		return nil
+	}
+
+	billed := invoice.PaidAt.UTC()
+	billedMonth := monthOf(billed)
+	var entries []domain.RevenueEntry
+	remaining := net
+	for i, item := range invoice.LineItems {
+		amount := item.Total.Mul(net).Div(itemsTotal).Round(8)
+		if i == len(invoice.LineItems)-1 {
+			amount = remaining
+		}
+		remaining = remaining.Sub(amount)
+		if amount.IsZero() {
+			continue
+		}
+
+		for _, part := range split(amount, item.PeriodStart, item.PeriodEnd, billedMonth) {
+			entries = append(entries, domain.RevenueEntry{
+				InvoiceID:     invoice.ID,
+				InvoiceItemID: item.ID,
+				ServiceID:     item.ServiceID,
+				Currency:      invoice.Currency,
+				Month:         part.month,
+				BilledAt:      billed,
+				Amount:        part.amount,
+			})
+		}
+	}
+	return entries
+}
+
+type monthAmount struct {
+	month  time.Time
+	amount decimal.Decimal
+}
+
+// split spreads an amount over the months of [start, end) by days. Items
+// without a period are recognized in the month they were billed.
+func split(amount decimal.Decimal, start, end *time.Time, billedMonth time.Time) []monthAmount {
+	if start == nil || end == nil || !end.After(*start) {
+		return []monthAmount{{month: billedMonth, amount: amount}}
+	}
+
+	from, to := start.UTC(), end.UTC()
+	total := decimal.NewFromFloat(to.Sub(from).Hours())
+	var parts []monthAmount
+	remaining := amount
+	for month := monthOf(from); month.Before(to); month = month.AddDate(0, 1, 0) {
+		partStart, partEnd := maxTime(from, month), minTime(to, month.AddDate(0, 1, 0))
+		share := amount.Mul(decimal.NewFromFloat(partEnd.Sub(partStart).Hours())).Div(total).Round(8)
+		if !month.AddDate(0, 1, 0).Before(to) {
+			share = remaining
+		}
+		remaining = remaining.Sub(share)
+
+		recognizedIn := month
+		if month.Before(billedMonth) {
+			recognizedIn = billedMonth
+		}
+		if n := len(parts); n > 0 && parts[n-1].month.Equal(recognizedIn) {
+			parts[n-1].amount = parts[n-1].amount.Add(share)
+			continue
+		}
+		parts = append(parts, monthAmount{month: recognizedIn, amount: share})
+	}
+	return parts
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// MonthReport is the revenue of a month in one currency
+type MonthReport struct {
+	Month      time.Time
+	Currency   string
+	Billed     decimal.Decimal // Paid in the month
+	Recognized decimal.Decimal // Earned in the month
+	Deferred   decimal.Decimal // Paid by the end of the month and not earned yet
+}
+
+// Report returns the billed, recognized and deferred revenue of the months
+// from the month of from to the month of to, per currency
+func (s *Service) Report(from, to time.Time, currency string) ([]MonthReport, error) {
+	from, to = monthOf(from), monthOf(to).AddDate(0, 1, 0)
+	if !to.After(from) {
+		return nil, ErrInvalidPeriod
+	}
+
+	currencies := []string{currency}
+	if currency == "" {
+		currencies = nil
+		if err := s.db.Model(&domain.RevenueEntry{}).Distinct("currency").
+			Where("month < ? AND billed_at < ?", to, to).Order("currency").
+			Pluck("currency", &currencies).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	report := []MonthReport{}
+	for month := from; month.Before(to); month = month.AddDate(0, 1, 0) {
+		next := month.AddDate(0, 1, 0)
+		for _, code := range currencies {
+			row := MonthReport{Month: month, Currency: code}
+			sums := []struct {
+				dest  *decimal.Decimal
+				where string
+				args  []interface{}
+			}{
+				{&row.Billed, "billed_at >= ? AND billed_at < ?", []interface{}{month, next}},
+				{&row.Recognized, "month = ?", []interface{}{month}},
+				{&row.Deferred, "billed_at < ? AND month >= ?", []interface{}{next, next}},
+			}
+			for _, sum := range sums {
+				var total decimal.NullDecimal
+				if err := s.db.Model(&domain.RevenueEntry{}).Select("SUM(amount)").
+					Where("currency = ?", code).Where(sum.where, sum.args...).
+					Scan(&total).Error; err != nil {
+					return nil, err
+				}
+				*sum.dest = total.Decimal
+			}
+			report = append(report, row)
+		}
+	}
+	return report, nil
+}
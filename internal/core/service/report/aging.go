@@ -0,0 +1,193 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// AgingRow is the balance a customer owes in one currency, by how long it
+// has been due. Promised is the part under an active promise to pay.
+type AgingRow struct {
+	CustomerID     uint64
+	Customer       string
+	Currency       string
+	Current        decimal.Decimal // Not due yet
+	Days1To30      decimal.Decimal
+	Days31To60     decimal.Decimal
+	Days61To90     decimal.Decimal
+	Over90         decimal.Decimal
+	Total          decimal.Decimal
+	Promised       decimal.Decimal
+	PromisedDate   *time.Time // Earliest promised day of the active promises
+	BrokenPromises int64      // Promises of the customer ever broken
+}
+
+// AgingReport is the accounts receivable aging of the open invoices
+type AgingReport struct {
+	AsOf   time.Time
+	Rows   []AgingRow
+	Totals []AgingRow // Per currency, without a customer
+}
+
+// Aging returns the accounts receivable aging of the unpaid and overdue
+// invoices at a time, per customer and currency
+func (s *Service) Aging(now time.Time) (*AgingReport, error) {
+	var invoices []domain.Invoice
+	if err := s.db.Select("id", "customer_id", "currency", "balance", "due_date").
+		Where("status IN ? AND balance > 0", []domain.InvoiceStatus{domain.InvoiceStatusUnpaid, domain.InvoiceStatusOverdue}).
+		Order("customer_id, currency").
+		Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+
+	var promises []domain.PaymentPromise
+	if err := s.db.Where("status = ?", domain.PaymentPromiseActive).Find(&promises).Error; err != nil {
+		return nil, err
+	}
+	promised := make(map[uint64]time.Time, len(promises))
+	for _, p := range promises {
+		promised[p.InvoiceID] = p.PromisedDate
+	}
+
+	type rowKey struct {
+		customerID uint64
+		currency   string
+	}
+	rows := make(map[rowKey]*AgingRow)
+	totals := make(map[string]*AgingRow)
+	customerIDs := []uint64{}
+	for _, inv := range invoices {
+		key := rowKey{inv.CustomerID, inv.Currency}
+		row, ok := rows[key]
+		if !ok {
+			row = &AgingRow{CustomerID: inv.CustomerID, Currency: inv.Currency}
+			rows[key] = row
+			customerIDs = append(customerIDs, inv.CustomerID)
+		}
+		total, ok := totals[inv.Currency]
+		if !ok {
+			total = &AgingRow{Currency: inv.Currency}
+			totals[inv.Currency] = total
+		}
+
+		days := int(now.Sub(inv.DueDate) / (24 * time.Hour))
+		for _, r := range []*AgingRow{row, total} {
+			switch {
+			case !now.After(inv.DueDate):
+				r.Current = r.Current.Add(inv.Balance)
+			case days <= 30:
+				r.Days1To30 = r.Days1To30.Add(inv.Balance)
+			case days <= 60:
+				r.Days31To60 = r.Days31To60.Add(inv.Balance)
+			case days <= 90:
+				r.Days61To90 = r.Days61To90.Add(inv.Balance)
+			default:
+				r.Over90 = r.Over90.Add(inv.Balance)
+			}
+			r.Total = r.Total.Add(inv.Balance)
+			if date, ok := promised[inv.ID]; ok {
+				r.Promised = r.Promised.Add(inv.Balance)
+				if r.PromisedDate == nil || date.Before(*r.PromisedDate) {
+					d := date
+					r.PromisedDate = &d
+				}
+			}
+		}
+	}
+
+	names := make(map[uint64]string, len(customerIDs))
+	broken := make(map[uint64]int64, len(customerIDs))
+	if len(customerIDs) > 0 {
+		var customers []domain.User
+		if err := s.db.Select("id", "first_name", "last_name", "company").
+			Where("id IN ?", customerIDs).Find(&customers).Error; err != nil {
+			return nil, err
+		}
+		for _, c := range customers {
+			name := strings.TrimSpace(c.FirstName + " " + c.LastName)
+			if c.Company != "" {
+				name = c.Company
+			}
+			names[c.ID] = name
+		}
+
+		var counts []struct {
+			CustomerID uint64
+			Count      int64
+		}
+		if err := s.db.Model(&domain.PaymentPromise{}).
+			Select("customer_id, COUNT(*) AS count").
+			Where("status = ? AND customer_id IN ?", domain.PaymentPromiseBroken, customerIDs).
+			Group("customer_id").
+			Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+		for _, c := range counts {
+			broken[c.CustomerID] = c.Count
+		}
+	}
+
+	report := &AgingReport{AsOf: now, Rows: make([]AgingRow, 0, len(rows)), Totals: make([]AgingRow, 0, len(totals))}
+	for _, row := range rows {
+		row.Customer = names[row.CustomerID]
+		row.BrokenPromises = broken[row.CustomerID]
+		report.Rows = append(report.Rows, *row)
+	}
+	// The most overdue balances first
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if !a.Over90.Equal(b.Over90) {
+			return a.Over90.GreaterThan(b.Over90)
+		}
+		if !a.Total.Equal(b.Total) {
+			return a.Total.GreaterThan(b.Total)
+		}
+		return a.CustomerID < b.CustomerID
+	})
+	for _, total := range totals {
+		report.Totals = append(report.Totals, *total)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+	return report, nil
+}
+
+// WriteAgingCSV writes the customer rows of an aging report as CSV
+func WriteAgingCSV(w io.Writer, report *AgingReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"customer_id", "customer", "currency", "current", "1_30", "31_60", "61_90", "over_90",
+		"total", "promised", "promised_date", "broken_promises"}); err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		promisedDate := ""
+		if row.PromisedDate != nil {
+			promisedDate = row.PromisedDate.Format("2006-01-02")
+		}
+		if err := writer.Write([]string{
+			strconv.FormatUint(row.CustomerID, 10),
+			row.Customer,
+			row.Currency,
+			row.Current.StringFixed(2),
+			row.Days1To30.StringFixed(2),
+			row.Days31To60.StringFixed(2),
+			row.Days61To90.StringFixed(2),
+			row.Over90.StringFixed(2),
+			row.Total.StringFixed(2),
+			row.Promised.StringFixed(2),
+			promisedDate,
+			strconv.FormatInt(row.BrokenPromises, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
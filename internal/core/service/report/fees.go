@@ -0,0 +1,227 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// GatewayProfit is the revenue and fees of a gateway in one currency
+type GatewayProfit struct {
+	Gateway       string
+	Currency      string
+	Payments      int64
+	Gross         decimal.Decimal // Payments received
+	Refunds       decimal.Decimal // Refunds paid back
+	Fees          decimal.Decimal // Fees charged by the gateway
+	CalculatedFee decimal.Decimal // Part of Fees taken from the gateway fee settings
+	Net           decimal.Decimal // Gross less refunds and fees
+}
+
+// ProductProfit is the revenue and fees of a product in one currency.
+// Payments are shared by the items of the invoice they paid.
+type ProductProfit struct {
+	ProductID uint64 // Zero for items not billed for a product
+	Product   string
+	Currency  string
+	Gross     decimal.Decimal
+	Refunds   decimal.Decimal
+	Fees      decimal.Decimal
+	Net       decimal.Decimal
+}
+
+// Profitability compares the net revenue of the gateways and products
+type Profitability struct {
+	From     time.Time
+	To       time.Time
+	Gateways []GatewayProfit
+	Products []ProductProfit
+}
+
+// Profitability returns the payments, refunds and gateway fees of a period
+// per gateway and per product. To is exclusive. Test transactions are left
+// out.
+func (s *Service) Profitability(from, to time.Time) (*Profitability, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidPeriod
+	}
+
+	var transactions []domain.Transaction
+	if err := s.db.Preload("Invoice.LineItems").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Where("(type = ? AND status IN ?) OR (type = ? AND status = ?)",
+			domain.TransactionTypePayment, []domain.TransactionStatus{domain.TransactionStatusCompleted, domain.TransactionStatusRefunded},
+			domain.TransactionTypeRefund, domain.TransactionStatusCompleted).
+		Where("gateway <> ?", domain.GatewayCreditBalance).
+		Where("test = ?", false).
+		Order("id").
+		Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+
+	products, err := s.itemProducts(transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	type gatewayKey struct{ gateway, currency string }
+	type productKey struct {
+		productID uint64
+		currency  string
+	}
+	gateways := make(map[gatewayKey]*GatewayProfit)
+	byProduct := make(map[productKey]*ProductProfit)
+
+	for _, t := range transactions {
+		gk := gatewayKey{t.Gateway, t.Currency}
+		g, ok := gateways[gk]
+		if !ok {
+			g = &GatewayProfit{Gateway: t.Gateway, Currency: t.Currency}
+			gateways[gk] = g
+		}
+
+		gross, refund := decimal.Zero, decimal.Zero
+		if t.Type == domain.TransactionTypeRefund {
+			refund = t.Amount.Abs()
+			g.Refunds = g.Refunds.Add(refund)
+		} else {
+			gross = t.Amount
+			g.Payments++
+			g.Gross = g.Gross.Add(gross)
+		}
+		g.Fees = g.Fees.Add(t.Fee)
+		if t.FeeCalculated {
+			g.CalculatedFee = g.CalculatedFee.Add(t.Fee)
+		}
+
+		for _, share := range shares(t.Invoice, products) {
+			pk := productKey{share.productID, t.Currency}
+			p, ok := byProduct[pk]
+			if !ok {
+				p = &ProductProfit{ProductID: share.productID, Product: share.name, Currency: t.Currency}
+				byProduct[pk] = p
+			}
+			p.Gross = p.Gross.Add(gross.Mul(share.weight))
+			p.Refunds = p.Refunds.Add(refund.Mul(share.weight))
+			p.Fees = p.Fees.Add(t.Fee.Mul(share.weight))
+		}
+	}
+
+	result := &Profitability{From: from, To: to, Gateways: []GatewayProfit{}, Products: []ProductProfit{}}
+	for _, g := range gateways {
+		g.Net = g.Gross.Sub(g.Refunds).Sub(g.Fees)
+		result.Gateways = append(result.Gateways, *g)
+	}
+	for _, p := range byProduct {
+		p.Gross, p.Refunds, p.Fees = p.Gross.Round(2), p.Refunds.Round(2), p.Fees.Round(2)
+		p.Net = p.Gross.Sub(p.Refunds).Sub(p.Fees)
+		result.Products = append(result.Products, *p)
+	}
+	sort.Slice(result.Gateways, func(i, j int) bool {
+		a, b := result.Gateways[i], result.Gateways[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.Net.GreaterThan(b.Net)
+	})
+	sort.Slice(result.Products, func(i, j int) bool {
+		a, b := result.Products[i], result.Products[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.Net.GreaterThan(b.Net)
+	})
+	return result, nil
+}
+
+type productName struct {
+	id   uint64
+	name string
+}
+
+// itemProducts returns the product of each service billed by the invoices
+// of the transactions
+func (s *Service) itemProducts(transactions []domain.Transaction) (map[uint64]productName, error) {
+	serviceIDs := make(map[uint64]bool)
+	for _, t := range transactions {
+		if t.Invoice == nil {
+			continue
+		}
+		for _, item := range t.Invoice.LineItems {
+			if item.ServiceID != nil {
+				serviceIDs[*item.ServiceID] = true
+			}
+		}
+	}
+	products := make(map[uint64]productName, len(serviceIDs))
+	if len(serviceIDs) == 0 {
+		return products, nil
+	}
+
+	ids := make([]uint64, 0, len(serviceIDs))
+	for id := range serviceIDs {
+		ids = append(ids, id)
+	}
+	var rows []struct {
+		ServiceID uint64
+		ProductID uint64
+		Name      string
+	}
+	if err := s.db.Table("services").
+		Select("services.id AS service_id, products.id AS product_id, products.name").
+		Joins("JOIN products ON products.id = services.product_id").
+		Where("services.id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		products[row.ServiceID] = productName{id: row.ProductID, name: row.Name}
+	}
+	return products, nil
+}
+
+type productShare struct {
+	productID uint64
+	name      string
+	weight    decimal.Decimal
+}
+
+// shares splits an invoice between the products of its items by their
+// totals. Items of no product, and transactions of no invoice, count as
+// product zero.
+func shares(invoice *domain.Invoice, products map[uint64]productName) []productShare {
+	other := []productShare{{name: "Other", weight: decimal.NewFromInt(1)}}
+	if invoice == nil {
+		return other
+	}
+
+	total := decimal.Zero
+	for _, item := range invoice.LineItems {
+		total = total.Add(item.Total)
+	}
+	if total.LessThanOrEqual(decimal.Zero) {
+		return other
+	}
+
+	index := make(map[uint64]int)
+	var result []productShare
+	for _, item := range invoice.LineItems {
+		product := productName{name: "Other"}
+		if item.ServiceID != nil {
+			if p, ok := products[*item.ServiceID]; ok {
+				product = p
+			}
+		}
+		weight := item.Total.Div(total)
+		if i, ok := index[product.id]; ok {
+			result[i].weight = result[i].weight.Add(weight)
+			continue
+		}
+		index[product.id] = len(result)
+		result = append(result, productShare{productID: product.id, name: product.name, weight: weight})
+	}
+	return result
+}
@@ -0,0 +1,298 @@
+// Package report builds the finance reports of the admin area from the
+// billing records.
+package report
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrInvalidPeriod  = errors.New("the period must end after it starts")
+	ErrInvalidBasis   = errors.New("basis must be paid or invoiced")
+	ErrInvalidQuarter = errors.New("quarter must look like 2024-Q1")
+	ErrNotEUCountry   = errors.New("home country must be an EU member state")
+)
+
+// Bases of the tax report
+const (
+	// BasisPaid reports the tax of invoices paid in the period, the tax
+	// actually collected
+	BasisPaid = "paid"
+	// BasisInvoiced reports the tax of invoices issued in the period,
+	// paid or not
+	BasisInvoiced = "invoiced"
+)
+
+// euCountries are the EU member states, whose VAT on sales to consumers
+// in other member states is declared in the One-Stop Shop (OSS). Greece
+// is EL in OSS returns.
+var euCountries = map[string]string{
+	"AT": "AT", "BE": "BE", "BG": "BG", "HR": "HR", "CY": "CY", "CZ": "CZ",
+	"DK": "DK", "EE": "EE", "FI": "FI", "FR": "FR", "DE": "DE", "GR": "EL",
+	"HU": "HU", "IE": "IE", "IT": "IT", "LV": "LV", "LT": "LT", "LU": "LU",
+	"MT": "MT", "NL": "NL", "PL": "PL", "PT": "PT", "RO": "RO", "SK": "SK",
+	"SI": "SI", "ES": "ES", "SE": "SE",
+}
+
+// IsEUCountry reports whether an ISO 3166-1 alpha-2 code is an EU member
+// state
+func IsEUCountry(country string) bool {
+	_, ok := euCountries[strings.ToUpper(country)]
+	return ok
+}
+
+// Service builds finance reports
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new report service. Its queries are read from a
+// replica when read replicas are configured.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db.Clauses(dbresolver.Read).Session(&gorm.Session{})}
+}
+
+// TaxQuery selects the invoices of a tax report. To is exclusive.
+type TaxQuery struct {
+	From  time.Time
+	To    time.Time
+	Basis string
+}
+
+// TaxReport totals the tax charged per jurisdiction, rate and currency
+type TaxReport struct {
+	From       time.Time
+	To         time.Time
+	Basis      string
+	Rows       []TaxRow
+	Totals     []TaxTotal
+	Unrecorded []TaxTotal // Invoices with tax but no tax lines, from before they were recorded
+}
+
+// TaxRow is the tax of one jurisdiction and rate in one currency
+type TaxRow struct {
+	Country       string
+	State         string
+	TaxType       string
+	Rate          decimal.Decimal
+	Currency      string
+	Invoices      int64
+	TaxableAmount decimal.Decimal
+	TaxAmount     decimal.Decimal
+}
+
+// TaxTotal is the tax of a currency
+type TaxTotal struct {
+	Currency      string
+	Invoices      int64
+	TaxableAmount decimal.Decimal
+	TaxAmount     decimal.Decimal
+}
+
+// QuarterPeriod returns the first day of a quarter such as "2024-Q3" and
+// the first day of the next quarter, in UTC
+func QuarterPeriod(quarter string) (time.Time, time.Time, error) {
+	var year, q int
+	if _, err := fmt.Sscanf(strings.ToUpper(strings.TrimSpace(quarter)), "%d-Q%d", &year, &q); err != nil || q < 1 || q > 4 {
+		return time.Time{}, time.Time{}, ErrInvalidQuarter
+	}
+	from := time.Date(year, time.Month((q-1)*3+1), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 3, 0), nil
+}
+
+// Tax returns the tax report of a period
+func (s *Service) Tax(q TaxQuery) (*TaxReport, error) {
+	if q.Basis == "" {
+		q.Basis = BasisPaid
+	}
+	if q.Basis != BasisPaid && q.Basis != BasisInvoiced {
+		return nil, ErrInvalidBasis
+	}
+	if !q.To.After(q.From) {
+		return nil, ErrInvalidPeriod
+	}
+
+	report := &TaxReport{From: q.From, To: q.To, Basis: q.Basis, Rows: []TaxRow{}, Totals: []TaxTotal{}, Unrecorded: []TaxTotal{}}
+
+	if err := s.invoicesOf(q, s.db.Table("invoice_taxes").
+		Joins("JOIN invoices ON invoices.id = invoice_taxes.invoice_id")).
+		Select(`invoice_taxes.country, invoice_taxes.state, invoice_taxes.tax_type, invoice_taxes.rate,
+			invoices.currency, COUNT(DISTINCT invoices.id) AS invoices,
+			SUM(invoice_taxes.taxable_amount) AS taxable_amount, SUM(invoice_taxes.amount) AS tax_amount`).
+		Group("invoice_taxes.country, invoice_taxes.state, invoice_taxes.tax_type, invoice_taxes.rate, invoices.currency").
+		Order("invoice_taxes.country, invoice_taxes.state, invoice_taxes.rate DESC, invoices.currency").
+		Scan(&report.Rows).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*TaxTotal)
+	for _, row := range report.Rows {
+		total, ok := totals[row.Currency]
+		if !ok {
+			total = &TaxTotal{Currency: row.Currency}
+			totals[row.Currency] = total
+		}
+		total.TaxAmount = total.TaxAmount.Add(row.TaxAmount)
+	}
+	// An invoice taxed by several rules counts once in the totals
+	var counts []TaxTotal
+	if err := s.invoicesOf(q, s.db.Table("invoices")).
+		Where("EXISTS (SELECT 1 FROM invoice_taxes WHERE invoice_taxes.invoice_id = invoices.id)").
+		Select("invoices.currency, COUNT(*) AS invoices, SUM(invoices.total - invoices.tax_amount) AS taxable_amount").
+		Group("invoices.currency").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		if total, ok := totals[count.Currency]; ok {
+			total.Invoices = count.Invoices
+			total.TaxableAmount = count.TaxableAmount
+		}
+	}
+	for _, total := range totals {
+		report.Totals = append(report.Totals, *total)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+
+	if err := s.invoicesOf(q, s.db.Table("invoices")).
+		Where("invoices.tax_amount > 0").
+		Where("NOT EXISTS (SELECT 1 FROM invoice_taxes WHERE invoice_taxes.invoice_id = invoices.id)").
+		Select(`invoices.currency, COUNT(*) AS invoices,
+			SUM(invoices.total - invoices.tax_amount) AS taxable_amount, SUM(invoices.tax_amount) AS tax_amount`).
+		Group("invoices.currency").
+		Order("invoices.currency").
+		Scan(&report.Unrecorded).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// invoicesOf restricts a query joined with invoices to the invoices of the
+// report period
+func (s *Service) invoicesOf(q TaxQuery, query *gorm.DB) *gorm.DB {
+	if q.Basis == BasisInvoiced {
+		return query.Where("invoices.status IN ? AND invoices.created_at >= ? AND invoices.created_at < ?",
+			[]domain.InvoiceStatus{domain.InvoiceStatusUnpaid, domain.InvoiceStatusPaid, domain.InvoiceStatusOverdue}, q.From, q.To)
+	}
+	return query.Where("invoices.status = ? AND invoices.paid_at >= ? AND invoices.paid_at < ?",
+		domain.InvoiceStatusPaid, q.From, q.To)
+}
+
+// WriteTaxReportCSV writes the rows of a tax report as CSV
+func WriteTaxReportCSV(w io.Writer, report *TaxReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"country", "state", "tax_type", "rate", "currency", "invoices", "taxable_amount", "tax_amount"}); err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		if err := writer.Write([]string{
+			row.Country,
+			row.State,
+			row.TaxType,
+			row.Rate.String(),
+			row.Currency,
+			fmt.Sprint(row.Invoices),
+			row.TaxableAmount.StringFixed(2),
+			row.TaxAmount.StringFixed(2),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// OSSRow is a line of an EU One-Stop Shop VAT return: the sales to
+// consumers of one member state at one rate
+type OSSRow struct {
+	MemberState   string // OSS code of the member state of consumption
+	RateType      string // STANDARD or REDUCED
+	Rate          decimal.Decimal
+	Currency      string
+	TaxableAmount decimal.Decimal
+	VATAmount     decimal.Decimal
+}
+
+// OSSRows returns the lines of the OSS return of a tax report: the VAT
+// charged in EU member states other than the home country of the
+// business. The highest rate of a member state is taken as its standard
+// rate. Amounts are in the invoice currency; OSS returns are filed in EUR.
+func OSSRows(report *TaxReport, homeCountry string) ([]OSSRow, error) {
+	homeCountry = strings.ToUpper(strings.TrimSpace(homeCountry))
+	if !IsEUCountry(homeCountry) {
+		return nil, ErrNotEUCountry
+	}
+
+	standard := make(map[string]decimal.Decimal)
+	for _, row := range report.Rows {
+		if current, ok := standard[row.Country]; !ok || row.Rate.GreaterThan(current) {
+			standard[row.Country] = row.Rate
+		}
+	}
+
+	type key struct {
+		country, currency, rate string
+	}
+	index := make(map[key]int)
+	rows := []OSSRow{}
+	for _, row := range report.Rows {
+		code, ok := euCountries[row.Country]
+		if !ok || row.Country == homeCountry {
+			continue
+		}
+		k := key{row.Country, row.Currency, row.Rate.String()}
+		i, ok := index[k]
+		if !ok {
+			rateType := "REDUCED"
+			if row.Rate.Equal(standard[row.Country]) {
+				rateType = "STANDARD"
+			}
+			rows = append(rows, OSSRow{MemberState: code, RateType: rateType, Rate: row.Rate, Currency: row.Currency})
+			i = len(rows) - 1
+			index[k] = i
+		}
+		rows[i].TaxableAmount = rows[i].TaxableAmount.Add(row.TaxableAmount)
+		rows[i].VATAmount = rows[i].VATAmount.Add(row.TaxAmount)
+	}
+	return rows, nil
+}
+
+// WriteOSSCSV writes the lines of an OSS return as CSV, in the order of
+// the return: member state of consumption, type of supply, rate type,
+// rate, taxable amount and VAT
+func WriteOSSCSV(w io.Writer, rows []OSSRow, from, to time.Time) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"period_from", "period_to", "member_state", "supply_type", "rate_type", "rate", "currency", "taxable_amount", "vat_amount"}); err != nil {
+		return err
+	}
+	periodTo := to.AddDate(0, 0, -1).Format("2006-01-02")
+	for _, row := range rows {
+		if err := writer.Write([]string{
+			from.Format("2006-01-02"),
+			periodTo,
+			row.MemberState,
+			"SERVICES",
+			row.RateType,
+			row.Rate.StringFixed(2),
+			row.Currency,
+			row.TaxableAmount.StringFixed(2),
+			row.VATAmount.StringFixed(2),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
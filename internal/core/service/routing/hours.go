@@ -0,0 +1,151 @@
+package routing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// maxScheduleDays bounds the days searched for working time, so that a
+// department closed on every day it has hours still gets a deadline
+const maxScheduleDays = 3660
+
+// span is a working period of a day, in minutes since midnight
+type span struct {
+	opens, closes int
+}
+
+// Schedule is when a department works: its hours in its time zone, less
+// its holidays. A schedule without hours works around the clock.
+type Schedule struct {
+	loc      *time.Location
+	hours    map[time.Weekday][]span
+	holidays map[string]bool
+}
+
+// NewSchedule builds the schedule of a department
+func NewSchedule(timezone string, hours []domain.DepartmentHours, holidays []domain.DepartmentHoliday) (*Schedule, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+
+	schedule := &Schedule{loc: loc, hours: map[time.Weekday][]span{}, holidays: map[string]bool{}}
+	for _, h := range hours {
+		opens, closes, err := parseSpan(h.Opens, h.Closes)
+		if err != nil {
+			return nil, err
+		}
+		day := time.Weekday(h.Weekday)
+		schedule.hours[day] = append(schedule.hours[day], span{opens, closes})
+	}
+	for _, h := range holidays {
+		schedule.holidays[h.Date] = true
+	}
+	return schedule, nil
+}
+
+// IsOpen reports whether the department works at t
+func (s *Schedule) IsOpen(t time.Time) bool {
+	t = t.In(s.loc)
+	minute := t.Hour()*60 + t.Minute()
+	for _, sp := range s.spans(t) {
+		if minute >= sp.opens && minute < sp.closes {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBusinessHours returns when the given number of working hours after
+// start have passed. Time outside the schedule does not count.
+func (s *Schedule) AddBusinessHours(start time.Time, hours int) time.Time {
+	remaining := time.Duration(hours) * time.Hour
+	if len(s.hours) == 0 && len(s.holidays) == 0 {
+		return start.Add(remaining)
+	}
+
+	local := start.In(s.loc)
+	for i := 0; i < maxScheduleDays; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, s.loc)
+		for _, sp := range s.spans(day) {
+			opens := atMinute(day, sp.opens)
+			closes := atMinute(day, sp.closes)
+			if opens.Before(start) {
+				opens = start
+			}
+			if !closes.After(opens) {
+				continue
+			}
+			available := closes.Sub(opens)
+			if available >= remaining {
+				return opens.Add(remaining)
+			}
+			remaining -= available
+		}
+	}
+	return start.Add(time.Duration(hours) * time.Hour)
+}
+
+// spans returns the working periods of the day of t
+func (s *Schedule) spans(t time.Time) []span {
+	if s.holidays[t.Format("2006-01-02")] {
+		return nil
+	}
+	if len(s.hours) == 0 {
+		return []span{{0, 24 * 60}}
+	}
+	return s.hours[t.Weekday()]
+}
+
+// ValidateHours checks the hours of a department
+func ValidateHours(hours []domain.DepartmentHours) error {
+	for _, h := range hours {
+		if h.Weekday < 0 || h.Weekday > 6 {
+			return ErrInvalidHours
+		}
+		if _, _, err := parseSpan(h.Opens, h.Closes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSpan(opens, closes string) (int, int, error) {
+	from, err := parseClock(opens)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseClock(closes)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to <= from {
+		return 0, 0, ErrInvalidHours
+	}
+	return from, to, nil
+}
+
+// parseClock parses HH:MM into minutes since midnight. 24:00 is the end
+// of the day.
+func parseClock(clock string) (int, error) {
+	hh, mm, ok := strings.Cut(clock, ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidHours, clock)
+	}
+	hour, err1 := strconv.Atoi(hh)
+	minute, err2 := strconv.Atoi(mm)
+	if err1 != nil || err2 != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidHours, clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// atMinute returns the time of a day at the given minute, respecting
+// daylight saving changes of the day
+func atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, day.Location())
+}
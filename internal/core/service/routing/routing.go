@@ -0,0 +1,513 @@
+// Package routing sends new tickets to the staff. Each department has
+// working hours and holidays in its time zone, which the SLA deadlines
+// of its tickets count. New tickets are assigned to an online member of
+// the department by round robin or by load, and high priority tickets
+// arriving outside working hours go to the staff member on call.
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrDepartmentNotFound = errors.New("department not found")
+	ErrTicketNotFound     = errors.New("ticket not found")
+	ErrShiftNotFound      = errors.New("on-call shift not found")
+	ErrHolidayNotFound    = errors.New("holiday not found")
+	ErrInvalidTimezone    = errors.New("invalid time zone")
+	ErrInvalidHours       = errors.New("hours must be a weekday from 0 to 6 with HH:MM times, closing after opening")
+	ErrInvalidMode        = errors.New("assignment mode must be none, round_robin or load_based")
+	ErrInvalidDate        = errors.New("date must be YYYY-MM-DD")
+	ErrInvalidShift       = errors.New("shift must end after it starts")
+	ErrNotStaff           = errors.New("user must be a staff member")
+)
+
+// Notifications staff get about tickets routed to them
+const (
+	NotificationTicketAssigned = "ticket_assigned"
+	NotificationTicketOnCall   = "ticket_on_call"
+)
+
+// routeBatch is the number of new tickets routed at once
+const routeBatch = 100
+
+// Service routes tickets and keeps department schedules
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new routing service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// DepartmentSchedule is the working time and staff of a department
+type DepartmentSchedule struct {
+	Department domain.TicketDepartment
+	Hours      []domain.DepartmentHours
+	Holidays   []domain.DepartmentHoliday
+	Members    []domain.DepartmentMember
+}
+
+// ScheduleInput replaces the working time and staff of a department
+type ScheduleInput struct {
+	Timezone       string
+	AssignmentMode domain.AssignmentMode
+	Hours          []domain.DepartmentHours
+	MemberIDs      []uint64
+}
+
+// ShiftInput is an on-call shift to add
+type ShiftInput struct {
+	DepartmentID *uint64
+	UserID       uint64
+	StartsAt     time.Time
+	EndsAt       time.Time
+}
+
+// GetSchedule returns the hours, holidays and members of a department
+func (s *Service) GetSchedule(departmentID uint64) (*DepartmentSchedule, error) {
+	var schedule DepartmentSchedule
+	result := s.db.Limit(1).Find(&schedule.Department, departmentID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDepartmentNotFound
+	}
+
+	if err := s.db.Where("department_id = ?", departmentID).Order("weekday, opens").Find(&schedule.Hours).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("department_id = ?", departmentID).Order("date").Find(&schedule.Holidays).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Preload("User").Where("department_id = ?", departmentID).Order("user_id").Find(&schedule.Members).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// UpdateSchedule replaces the time zone, assignment mode, hours and
+// members of a department
+func (s *Service) UpdateSchedule(departmentID uint64, input ScheduleInput) (*DepartmentSchedule, error) {
+	if _, err := s.GetSchedule(departmentID); err != nil {
+		return nil, err
+	}
+	if input.AssignmentMode == "" {
+		input.AssignmentMode = domain.AssignmentNone
+	}
+	if !input.AssignmentMode.Valid() {
+		return nil, ErrInvalidMode
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	if err := ValidateHours(input.Hours); err != nil {
+		return nil, err
+	}
+	for _, userID := range input.MemberIDs {
+		if err := s.checkStaff(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.TicketDepartment{}).Where("id = ?", departmentID).Updates(map[string]interface{}{
+			"timezone":        input.Timezone,
+			"assignment_mode": input.AssignmentMode,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("department_id = ?", departmentID).Delete(&domain.DepartmentHours{}).Error; err != nil {
+			return err
+		}
+		for _, h := range input.Hours {
+			hours := domain.DepartmentHours{DepartmentID: departmentID, Weekday: h.Weekday, Opens: h.Opens, Closes: h.Closes}
+			if err := tx.Create(&hours).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("department_id = ?", departmentID).Delete(&domain.DepartmentMember{}).Error; err != nil {
+			return err
+		}
+		seen := map[uint64]bool{}
+		for _, userID := range input.MemberIDs {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+			if err := tx.Create(&domain.DepartmentMember{DepartmentID: departmentID, UserID: userID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(departmentID)
+}
+
+// AddHoliday closes a department for a day
+func (s *Service) AddHoliday(departmentID uint64, date, name string) (*domain.DepartmentHoliday, error) {
+	if _, err := s.GetSchedule(departmentID); err != nil {
+		return nil, err
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, ErrInvalidDate
+	}
+
+	holiday := &domain.DepartmentHoliday{DepartmentID: departmentID, Date: date, Name: strings.TrimSpace(name)}
+	if err := s.db.Where("department_id = ? AND date = ?", departmentID, date).
+		Assign(domain.DepartmentHoliday{Name: holiday.Name}).FirstOrCreate(holiday).Error; err != nil {
+		return nil, err
+	}
+	return holiday, nil
+}
+
+// DeleteHoliday removes a holiday of a department
+func (s *Service) DeleteHoliday(departmentID, holidayID uint64) error {
+	result := s.db.Where("department_id = ?", departmentID).Delete(&domain.DepartmentHoliday{}, holidayID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHolidayNotFound
+	}
+	return nil
+}
+
+// ListShifts returns the on-call shifts that have not ended, the first
+// starting first
+func (s *Service) ListShifts(now time.Time) ([]domain.OnCallShift, error) {
+	var shifts []domain.OnCallShift
+	err := s.db.Preload("User").Where("ends_at > ?", now).Order("starts_at, id").Find(&shifts).Error
+	return shifts, err
+}
+
+// AddShift puts a staff member on call
+func (s *Service) AddShift(input ShiftInput) (*domain.OnCallShift, error) {
+	if !input.EndsAt.After(input.StartsAt) {
+		return nil, ErrInvalidShift
+	}
+	if err := s.checkStaff(input.UserID); err != nil {
+		return nil, err
+	}
+	if input.DepartmentID != nil {
+		if _, err := s.GetSchedule(*input.DepartmentID); err != nil {
+			return nil, err
+		}
+	}
+
+	shift := &domain.OnCallShift{
+		DepartmentID: input.DepartmentID,
+		UserID:       input.UserID,
+		StartsAt:     input.StartsAt,
+		EndsAt:       input.EndsAt,
+	}
+	if err := s.db.Create(shift).Error; err != nil {
+		return nil, err
+	}
+	return shift, s.db.Preload("User").First(shift, shift.ID).Error
+}
+
+// DeleteShift removes an on-call shift
+func (s *Service) DeleteShift(id uint64) error {
+	result := s.db.Delete(&domain.OnCallShift{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShiftNotFound
+	}
+	return nil
+}
+
+// SetAway marks a staff member away, so they get no new tickets, or back
+func (s *Service) SetAway(userID uint64, away bool) error {
+	return s.db.Model(&domain.User{}).Where("id = ?", userID).Update("away", away).Error
+}
+
+// Assign gives a ticket to a staff member, who is notified, or takes it
+// back from its assignee when assigneeID is nil
+func (s *Service) Assign(ticketID uint64, assigneeID *uint64, assignedBy uint64) (*domain.Ticket, error) {
+	var ticket domain.Ticket
+	result := s.db.Limit(1).Find(&ticket, ticketID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTicketNotFound
+	}
+	if assigneeID != nil {
+		if err := s.checkStaff(*assigneeID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Model(&ticket).Update("assignee_id", assigneeID).Error; err != nil {
+		return nil, err
+	}
+	ticket.AssigneeID = assigneeID
+	if assigneeID != nil && *assigneeID != assignedBy {
+		s.notify(&ticket, *assigneeID, NotificationTicketAssigned)
+	}
+	return &ticket, nil
+}
+
+// Route starts the SLA of a new ticket, counting the working hours of
+// its department, and assigns it. High priority tickets arriving while
+// the department is closed go to the staff member on call; others go to
+// an online member by the assignment mode of the department.
+func (s *Service) Route(ticket *domain.Ticket, now time.Time) error {
+	department, schedule, err := s.departmentOf(ticket)
+	if err != nil {
+		return err
+	}
+
+	responseHours, resolveHours := 24, 72
+	if department != nil {
+		responseHours, resolveHours = department.SLAResponseHours, department.SLAResolveHours
+	}
+	sla := domain.TicketSLA{
+		TicketID:    ticket.ID,
+		ResponseDue: schedule.AddBusinessHours(ticket.CreatedAt, responseHours),
+		ResolveDue:  schedule.AddBusinessHours(ticket.CreatedAt, resolveHours),
+	}
+	if err := s.db.Where("ticket_id = ?", ticket.ID).FirstOrCreate(&sla).Error; err != nil {
+		return err
+	}
+
+	if ticket.AssigneeID == nil && ticket.Status == domain.TicketStatusOpen {
+		if ticket.Priority == domain.TicketPriorityHigh && !schedule.IsOpen(now) {
+			if userID, ok, err := s.onCall(ticket.DepartmentID, now); err != nil {
+				return err
+			} else if ok {
+				if err := s.assignRouted(ticket, userID, NotificationTicketOnCall); err != nil {
+					return err
+				}
+			}
+		}
+		if ticket.AssigneeID == nil && department != nil && department.AssignmentMode != domain.AssignmentNone {
+			if userID, ok, err := s.pickMember(department, now); err != nil {
+				return err
+			} else if ok {
+				if err := s.assignRouted(ticket, userID, NotificationTicketAssigned); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ticket.RoutedAt = &now
+	return s.db.Model(ticket).Update("routed_at", now).Error
+}
+
+// RouteNew routes the tickets not routed yet. It returns how many were
+// routed.
+func (s *Service) RouteNew(now time.Time) (int, error) {
+	var tickets []domain.Ticket
+	count := 0
+	err := s.db.Where("routed_at IS NULL").Order("id").
+		FindInBatches(&tickets, routeBatch, func(tx *gorm.DB, batch int) error {
+			for i := range tickets {
+				if err := s.Route(&tickets[i], now); err != nil {
+					log.Printf("failed to route ticket %d: %v", tickets[i].ID, err)
+					continue
+				}
+				count++
+			}
+			return nil
+		}).Error
+	return count, err
+}
+
+// UpdateSLAs records the first staff reply and the closing of tickets on
+// their SLA, and flags the deadlines that passed
+func (s *Service) UpdateSLAs(now time.Time) error {
+	firstReply := s.db.Model(&domain.TicketMessage{}).Select("MIN(created_at)").
+		Where("ticket_messages.ticket_id = ticket_slas.ticket_id AND is_staff = ?", true)
+	if err := s.db.Model(&domain.TicketSLA{}).Where("first_response_at IS NULL").
+		Update("first_response_at", firstReply).Error; err != nil {
+		return err
+	}
+
+	closed := s.db.Model(&domain.Ticket{}).Select("id").Where("status = ?", domain.TicketStatusClosed)
+	if err := s.db.Model(&domain.TicketSLA{}).Where("resolved_at IS NULL AND ticket_id IN (?)", closed).
+		Update("resolved_at", now).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Model(&domain.TicketSLA{}).
+		Where("response_breached = ? AND ((first_response_at IS NULL AND response_due < ?) OR first_response_at > response_due)", false, now).
+		Update("response_breached", true).Error; err != nil {
+		return err
+	}
+	return s.db.Model(&domain.TicketSLA{}).
+		Where("resolve_breached = ? AND ((resolved_at IS NULL AND resolve_due < ?) OR resolved_at > resolve_due)", false, now).
+		Update("resolve_breached", true).Error
+}
+
+// Monitor routes new tickets and updates SLAs on the given interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if n, err := s.RouteNew(now); err != nil {
+			log.Printf("failed to route tickets: %v", err)
+		} else if n > 0 {
+			log.Printf("routed %d ticket(s)", n)
+		}
+		if err := s.UpdateSLAs(now); err != nil {
+			log.Printf("failed to update ticket SLAs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// departmentOf returns the department of a ticket and its schedule. A
+// ticket without a department is worked around the clock.
+func (s *Service) departmentOf(ticket *domain.Ticket) (*domain.TicketDepartment, *Schedule, error) {
+	if ticket.DepartmentID == nil {
+		schedule, err := NewSchedule("", nil, nil)
+		return nil, schedule, err
+	}
+
+	department, err := s.GetSchedule(*ticket.DepartmentID)
+	if errors.Is(err, ErrDepartmentNotFound) {
+		schedule, err := NewSchedule("", nil, nil)
+		return nil, schedule, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	schedule, err := NewSchedule(department.Department.Timezone, department.Hours, department.Holidays)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &department.Department, schedule, nil
+}
+
+// onCall returns the staff member on call for a department at now,
+// preferring a shift of the department over one of every department
+func (s *Service) onCall(departmentID *uint64, now time.Time) (uint64, bool, error) {
+	query := s.db.Model(&domain.OnCallShift{}).Where("starts_at <= ? AND ends_at > ?", now, now)
+	if departmentID != nil {
+		query = query.Where("department_id = ? OR department_id IS NULL", *departmentID)
+	} else {
+		query = query.Where("department_id IS NULL")
+	}
+
+	var shift domain.OnCallShift
+	result := query.Order("CASE WHEN department_id IS NULL THEN 1 ELSE 0 END").Order("starts_at DESC").Limit(1).Find(&shift)
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+	return shift.UserID, result.RowsAffected > 0, nil
+}
+
+// pickMember chooses the online member of a department to get the next
+// ticket. Members are online when they are active, not away and signed
+// in.
+func (s *Service) pickMember(department *domain.TicketDepartment, now time.Time) (uint64, bool, error) {
+	var online []uint64
+	err := s.db.Model(&domain.DepartmentMember{}).
+		Joins("JOIN users ON users.id = department_members.user_id").
+		Where("department_members.department_id = ? AND users.away = ? AND users.status = ? AND users.role IN ?",
+			department.ID, false, domain.UserStatusActive, []domain.UserRole{domain.UserRoleAdmin, domain.UserRoleStaff}).
+		Where("EXISTS (SELECT 1 FROM sessions WHERE sessions.user_id = users.id AND sessions.expires_at > ?)", now).
+		Order("department_members.user_id").
+		Pluck("department_members.user_id", &online).Error
+	if err != nil || len(online) == 0 {
+		return 0, false, err
+	}
+
+	if department.AssignmentMode == domain.AssignmentRoundRobin {
+		next := online[0]
+		if department.LastAssigneeID != nil {
+			i := sort.Search(len(online), func(i int) bool { return online[i] > *department.LastAssigneeID })
+			if i < len(online) {
+				next = online[i]
+			}
+		}
+		if err := s.db.Model(department).Update("last_assignee_id", next).Error; err != nil {
+			return 0, false, err
+		}
+		return next, true, nil
+	}
+
+	var loads []struct {
+		AssigneeID uint64
+		Open       int64
+	}
+	if err := s.db.Model(&domain.Ticket{}).Select("assignee_id, COUNT(*) AS open").
+		Where("assignee_id IN ? AND status <> ?", online, domain.TicketStatusClosed).
+		Group("assignee_id").Scan(&loads).Error; err != nil {
+		return 0, false, err
+	}
+	open := make(map[uint64]int64, len(loads))
+	for _, l := range loads {
+		open[l.AssigneeID] = l.Open
+	}
+	best := online[0]
+	for _, userID := range online[1:] {
+		if open[userID] < open[best] {
+			best = userID
+		}
+	}
+	return best, true, nil
+}
+
+func (s *Service) assignRouted(ticket *domain.Ticket, userID uint64, kind string) error {
+	if err := s.db.Model(ticket).Update("assignee_id", userID).Error; err != nil {
+		return err
+	}
+	ticket.AssigneeID = &userID
+	s.notify(ticket, userID, kind)
+	return nil
+}
+
+func (s *Service) notify(ticket *domain.Ticket, userID uint64, kind string) {
+	title := fmt.Sprintf("Ticket #%d assigned to you", ticket.ID)
+	if kind == NotificationTicketOnCall {
+		title = fmt.Sprintf("Urgent ticket #%d while on call", ticket.ID)
+	}
+	message := fmt.Sprintf("%s (%s priority)", ticket.Subject, ticket.Priority)
+	link := fmt.Sprintf("/admin/tickets?id=%d", ticket.ID)
+	if err := notification.NewService(s.db).SendNotification(userID, kind, title, message, link); err != nil {
+		log.Printf("failed to notify staff %d of ticket %d: %v", userID, ticket.ID, err)
+	}
+}
+
+func (s *Service) checkStaff(userID uint64) error {
+	var user domain.User
+	result := s.db.Select("id", "role").Limit(1).Find(&user, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 || !user.IsStaff() {
+		return ErrNotStaff
+	}
+	return nil
+}
@@ -0,0 +1,550 @@
+// Package securitymonitor watches for brute force and abuse: failed sign
+// ins, password reset requests and declined cards, by address and by user.
+// Addresses going over a limit are banned for a while, customers testing
+// cards are kept from paying, and admins are alerted of patterns such as
+// credential stuffing. Staff can also ban and lift bans themselves.
+package securitymonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/adminaccess"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrBanTarget    = errors.New("a ban needs an IP address, CIDR range or user")
+	ErrBanNotFound  = errors.New("ban not found")
+	ErrBanTrusted   = errors.New("the address is trusted and cannot be banned")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// NotificationAnomaly is the notification admins get when a pattern of
+// abuse is detected
+const NotificationAnomaly = "security_anomaly"
+
+const (
+	// loginWindow is the window failed sign ins are counted in
+	loginWindow = 15 * time.Minute
+	// abuseWindow is the window password resets and declines are counted in
+	abuseWindow = time.Hour
+	// eventRetention is how long events are kept
+	eventRetention = 24 * time.Hour
+	// cacheTTL is how long the IP bans are cached. Other instances sharing
+	// the database notice a change within it.
+	cacheTTL = 5 * time.Second
+	// stuffingEmails is how many different accounts failing to sign in from
+	// one address count as credential stuffing
+	stuffingEmails = 5
+	// distributedIPs is how many addresses failing to sign in to one account
+	// count as a distributed attack on it
+	distributedIPs = 5
+)
+
+// Limits are the counts that get an address or customer banned
+type Limits struct {
+	LoginFailures  int           // Failed sign ins from an address in 15 minutes
+	PasswordResets int           // Password reset requests from an address in an hour
+	CardDeclines   int           // Declined payments from an address or customer in an hour
+	BanDuration    time.Duration // How long automatic bans last
+}
+
+// DefaultLimits are used for the limits not configured
+var DefaultLimits = Limits{
+	LoginFailures:  10,
+	PasswordResets: 5,
+	CardDeclines:   5,
+	BanDuration:    time.Hour,
+}
+
+// Service counts abuse and manages bans
+type Service struct {
+	db      *gorm.DB
+	limits  Limits
+	trusted []netip.Prefix
+	// proxied is set when client addresses are those of a proxy
+	proxied bool
+
+	mu       sync.Mutex
+	bans     []ipBan
+	loadedAt time.Time
+}
+
+// ipBan is an active IP ban as it is checked on requests
+type ipBan struct {
+	prefix  netip.Prefix
+	expires *time.Time
+}
+
+// NewService creates a new security monitor
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, limits: DefaultLimits}
+}
+
+// SetLimits sets the counts that get an address or customer banned; zero
+// values keep the defaults
+func (s *Service) SetLimits(limits Limits) {
+	if limits.LoginFailures > 0 {
+		s.limits.LoginFailures = limits.LoginFailures
+	}
+	if limits.PasswordResets > 0 {
+		s.limits.PasswordResets = limits.PasswordResets
+	}
+	if limits.CardDeclines > 0 {
+		s.limits.CardDeclines = limits.CardDeclines
+	}
+	if limits.BanDuration > 0 {
+		s.limits.BanDuration = limits.BanDuration
+	}
+}
+
+// SetTrusted sets the addresses and ranges that are never banned, such
+// as those of the office or of monitoring
+func (s *Service) SetTrusted(ranges []string) error {
+	trusted, err := adminaccess.ParseRanges(strings.Join(ranges, "\n"))
+	if err != nil {
+		return err
+	}
+	s.trusted = trusted
+	return nil
+}
+
+// SetBehindUntrustedProxy tells the monitor that the client addresses it
+// is given are those of a reverse proxy that is not trusted. Addresses are
+// not banned automatically then, as the ban would shut out every client
+// behind the proxy.
+func (s *Service) SetBehindUntrustedProxy(proxied bool) {
+	s.proxied = proxied
+}
+
+// Monitor deletes the events that no longer count toward bans, every
+// interval until ctx is done
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-eventRetention)
+			if err := s.db.Where("created_at < ?", cutoff).Delete(&domain.AbuseEvent{}).Error; err != nil {
+				log.Printf("security monitor: failed to delete old events: %v", err)
+			}
+		}
+	}
+}
+
+// RecordLoginFailure counts a failed sign in. The address is banned once
+// it fails too often or tries several accounts, and admins are alerted of
+// credential stuffing and of accounts attacked from many addresses.
+func (s *Service) RecordLoginFailure(email, ip string, userID *uint64) {
+	now := time.Now()
+	if !s.record(domain.AbuseEvent{Kind: domain.AbuseLoginFailed, IPAddress: ip, UserID: userID, Email: strings.ToLower(email)}) {
+		return
+	}
+	since := now.Add(-loginWindow)
+
+	if ip != "" {
+		var emails int64
+		s.db.Model(&domain.AbuseEvent{}).
+			Where("kind = ? AND ip_address = ? AND created_at > ?", domain.AbuseLoginFailed, ip, since).
+			Distinct("email").Count(&emails)
+		if emails >= stuffingEmails {
+			reason := fmt.Sprintf("Credential stuffing: sign in failed for %d accounts in 15 minutes", emails)
+			if s.autoBan(ip, nil, reason) {
+				s.report("ip", nil, ip, "Credential stuffing from "+ip, reason+" from "+ip+". The address is banned.", "")
+			}
+			return
+		}
+		if count := s.count(domain.AbuseLoginFailed, "ip_address", ip, since); count >= int64(s.limits.LoginFailures) {
+			s.autoBan(ip, nil, fmt.Sprintf("%d failed sign ins in 15 minutes", count))
+		}
+	}
+
+	if userID != nil {
+		var ips int64
+		s.db.Model(&domain.AbuseEvent{}).
+			Where("kind = ? AND user_id = ? AND created_at > ?", domain.AbuseLoginFailed, *userID, now.Add(-abuseWindow)).
+			Distinct("ip_address").Count(&ips)
+		if ips >= distributedIPs && !s.alertedRecently("user", *userID) {
+			s.report("user", userID, ip, "Sign in attempts on "+email+" from many addresses",
+				fmt.Sprintf("Sign in to %s failed from %d addresses in an hour.", email, ips),
+				fmt.Sprintf("/admin/customers?id=%d", *userID))
+		}
+	}
+}
+
+// RecordPasswordReset counts a password reset request, banning the
+// address once it asks too often
+func (s *Service) RecordPasswordReset(email, ip string) {
+	if ip == "" || !s.record(domain.AbuseEvent{Kind: domain.AbusePasswordReset, IPAddress: ip, Email: strings.ToLower(email)}) {
+		return
+	}
+	if count := s.count(domain.AbusePasswordReset, "ip_address", ip, time.Now().Add(-abuseWindow)); count >= int64(s.limits.PasswordResets) {
+		s.autoBan(ip, nil, fmt.Sprintf("%d password reset requests in an hour", count))
+	}
+}
+
+// RecordCardDecline counts a declined payment. Bursts from an address or
+// of a customer look like card testing: the address or customer is banned
+// and admins are alerted.
+func (s *Service) RecordCardDecline(ip string, customerID uint64) {
+	if !s.record(domain.AbuseEvent{Kind: domain.AbuseCardDeclined, IPAddress: ip, UserID: &customerID}) {
+		return
+	}
+	since := time.Now().Add(-abuseWindow)
+	if ip != "" {
+		if count := s.count(domain.AbuseCardDeclined, "ip_address", ip, since); count >= int64(s.limits.CardDeclines) {
+			reason := fmt.Sprintf("Card testing: %d declined payments in an hour", count)
+			if s.autoBan(ip, nil, reason) {
+				s.report("ip", nil, ip, "Card testing from "+ip, reason+" from "+ip+". The address is banned.", "")
+			}
+		}
+	}
+	if count := s.count(domain.AbuseCardDeclined, "user_id", customerID, since); count >= int64(s.limits.CardDeclines) {
+		reason := fmt.Sprintf("Card testing: %d declined payments in an hour", count)
+		if s.autoBan("", &customerID, reason) {
+			s.report("user", &customerID, ip, fmt.Sprintf("Card testing by customer %d", customerID),
+				reason+". The customer cannot pay until the ban ends or is lifted.", fmt.Sprintf("/admin/customers?id=%d", customerID))
+		}
+	}
+}
+
+// IPBanned returns when the ban of an address ends, nil for a permanent
+// ban. The bans are cached for a few seconds as they are checked on every
+// request; a failed read keeps the last bans.
+func (s *Service) IPBanned(ip string) (banned bool, until *time.Time) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, nil
+	}
+	addr = addr.Unmap()
+	now := time.Now()
+
+	s.mu.Lock()
+	if s.loadedAt.IsZero() || now.Sub(s.loadedAt) >= cacheTTL {
+		if bans, err := s.loadIPBans(now); err != nil {
+			log.Printf("failed to read IP bans: %v", err)
+		} else {
+			s.bans = bans
+		}
+		s.loadedAt = now
+	}
+	bans := s.bans
+	s.mu.Unlock()
+
+	for _, ban := range bans {
+		if ban.prefix.Contains(addr) && (ban.expires == nil || now.Before(*ban.expires)) {
+			return true, ban.expires
+		}
+	}
+	return false, nil
+}
+
+// UserBanned reports whether a user is banned from signing in and paying
+func (s *Service) UserBanned(userID uint64) bool {
+	var count int64
+	err := s.activeBans(time.Now()).Where("user_id = ?", userID).Count(&count).Error
+	if err != nil {
+		log.Printf("failed to check bans of user %d: %v", userID, err)
+		return false
+	}
+	return count > 0
+}
+
+// Ban bans an address, CIDR range or user for a duration, zero for good
+func (s *Service) Ban(ip string, userID *uint64, reason string, duration time.Duration, actorID uint64, actorIP string) (*domain.SecurityBan, error) {
+	ip = strings.TrimSpace(ip)
+	if ip == "" && userID == nil {
+		return nil, ErrBanTarget
+	}
+	if ip != "" {
+		ranges, err := adminaccess.ParseRanges(ip)
+		if err != nil || len(ranges) != 1 {
+			return nil, adminaccess.ErrInvalidRange
+		}
+		if s.trustedRange(ranges[0]) {
+			return nil, ErrBanTrusted
+		}
+		ip = ranges[0].String()
+		if ranges[0].IsSingleIP() {
+			ip = ranges[0].Addr().String()
+		}
+	}
+	if userID != nil {
+		if err := s.db.Select("id").First(&domain.User{}, *userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrUserNotFound
+			}
+			return nil, err
+		}
+	}
+
+	ban := &domain.SecurityBan{
+		IPAddress:   ip,
+		UserID:      userID,
+		Reason:      strings.TrimSpace(reason),
+		CreatedByID: &actorID,
+	}
+	if ban.Reason == "" {
+		ban.Reason = "Banned by staff"
+	}
+	if duration > 0 {
+		expires := time.Now().Add(duration)
+		ban.ExpiresAt = &expires
+	}
+	if err := s.db.Create(ban).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &actorID,
+		Action:      domain.AuditActionBanCreated,
+		EntityType:  "security_ban",
+		EntityID:    &ban.ID,
+		IPAddress:   actorIP,
+		Description: describeBan(ban),
+	})
+	s.invalidate()
+	return ban, nil
+}
+
+// Lift ends a ban early
+func (s *Service) Lift(banID, actorID uint64, actorIP string) (*domain.SecurityBan, error) {
+	var ban domain.SecurityBan
+	if err := s.db.First(&ban, banID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBanNotFound
+		}
+		return nil, err
+	}
+	if ban.LiftedAt != nil {
+		return &ban, nil
+	}
+	now := time.Now()
+	ban.LiftedAt, ban.LiftedByID = &now, &actorID
+	if err := s.db.Model(&ban).Updates(map[string]interface{}{"lifted_at": now, "lifted_by_id": actorID}).Error; err != nil {
+		return nil, err
+	}
+	s.audit(domain.AuditLog{
+		UserID:      &actorID,
+		Action:      domain.AuditActionBanLifted,
+		EntityType:  "security_ban",
+		EntityID:    &ban.ID,
+		IPAddress:   actorIP,
+		Description: "Lifted: " + describeBan(&ban),
+	})
+	s.invalidate()
+	return &ban, nil
+}
+
+// ListBans returns bans newest first, only those in force when active
+func (s *Service) ListBans(active bool, limit, offset int) ([]domain.SecurityBan, int64, error) {
+	query := s.db.Model(&domain.SecurityBan{})
+	if active {
+		query = s.activeBans(time.Now())
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var bans []domain.SecurityBan
+	if err := query.Preload("User").Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&bans).Error; err != nil {
+		return nil, 0, err
+	}
+	return bans, total, nil
+}
+
+// ListEvents returns the counted events of the last day newest first,
+// optionally only of an address
+func (s *Service) ListEvents(ip string, limit, offset int) ([]domain.AbuseEvent, int64, error) {
+	query := s.db.Model(&domain.AbuseEvent{})
+	if ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []domain.AbuseEvent
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// record saves an event, reporting whether it counts: events from trusted
+// addresses do not
+func (s *Service) record(event domain.AbuseEvent) bool {
+	if addr, err := netip.ParseAddr(event.IPAddress); err == nil && s.trustedAddr(addr.Unmap()) {
+		return false
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		log.Printf("security monitor: failed to record %s: %v", event.Kind, err)
+		return false
+	}
+	return true
+}
+
+func (s *Service) count(kind domain.AbuseEventKind, column string, value any, since time.Time) int64 {
+	var count int64
+	if err := s.db.Model(&domain.AbuseEvent{}).
+		Where("kind = ? AND "+column+" = ? AND created_at > ?", kind, value, since).
+		Count(&count).Error; err != nil {
+		log.Printf("security monitor: failed to count %s: %v", kind, err)
+	}
+	return count
+}
+
+// autoBan bans an address or user for the ban duration unless a ban is
+// already in force, reporting whether it banned
+func (s *Service) autoBan(ip string, userID *uint64, reason string) bool {
+	if userID == nil && s.proxied {
+		return false
+	}
+	now := time.Now()
+	query := s.activeBans(now)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("ip_address = ?", ip)
+	}
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil || existing > 0 {
+		return false
+	}
+
+	expires := now.Add(s.limits.BanDuration)
+	ban := &domain.SecurityBan{IPAddress: ip, UserID: userID, Reason: reason, Automatic: true, ExpiresAt: &expires}
+	if err := s.db.Create(ban).Error; err != nil {
+		log.Printf("security monitor: failed to ban: %v", err)
+		return false
+	}
+	log.Printf("security monitor: %s", describeBan(ban))
+	s.audit(domain.AuditLog{
+		UserID:      userID,
+		Action:      domain.AuditActionBanCreated,
+		EntityType:  "security_ban",
+		EntityID:    &ban.ID,
+		IPAddress:   ip,
+		Description: describeBan(ban),
+	})
+	s.invalidate()
+	return true
+}
+
+// report records a detected pattern in the audit log and alerts admins
+func (s *Service) report(entityType string, entityID *uint64, ip, title, message, link string) {
+	s.audit(domain.AuditLog{
+		Action:      domain.AuditActionSecurityAnomaly,
+		EntityType:  entityType,
+		EntityID:    entityID,
+		IPAddress:   ip,
+		Description: message,
+	})
+	s.alert(title, message, link)
+}
+
+// alertedRecently reports whether an anomaly of a record was recorded
+// within the last hour, so admins are alerted once per attack
+func (s *Service) alertedRecently(entityType string, entityID uint64) bool {
+	var count int64
+	s.db.Model(&domain.AuditLog{}).
+		Where("action = ? AND entity_type = ? AND entity_id = ? AND created_at > ?",
+			domain.AuditActionSecurityAnomaly, entityType, entityID, time.Now().Add(-abuseWindow)).
+		Count(&count)
+	return count > 0
+}
+
+// alert notifies every active admin
+func (s *Service) alert(title, message, link string) {
+	var admins []uint64
+	if err := s.db.Model(&domain.User{}).
+		Where("role = ? AND status = ?", domain.UserRoleAdmin, domain.UserStatusActive).
+		Pluck("id", &admins).Error; err != nil {
+		log.Printf("security monitor: failed to find admins to alert: %v", err)
+		return
+	}
+	notifier := notification.NewService(s.db)
+	for _, id := range admins {
+		if err := notifier.SendNotification(id, NotificationAnomaly, title, message, link); err != nil {
+			log.Printf("security monitor: failed to alert admin %d: %v", id, err)
+		}
+	}
+}
+
+func (s *Service) audit(entry domain.AuditLog) {
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("failed to record %s in the audit log: %v", entry.Action, err)
+	}
+}
+
+func (s *Service) activeBans(now time.Time) *gorm.DB {
+	return s.db.Model(&domain.SecurityBan{}).Where("lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", now)
+}
+
+func (s *Service) loadIPBans(now time.Time) ([]ipBan, error) {
+	var rows []domain.SecurityBan
+	if err := s.activeBans(now).Where("ip_address <> ''").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	bans := make([]ipBan, 0, len(rows))
+	for _, row := range rows {
+		ranges, err := adminaccess.ParseRanges(row.IPAddress)
+		if err != nil || len(ranges) != 1 {
+			continue
+		}
+		bans = append(bans, ipBan{prefix: ranges[0], expires: row.ExpiresAt})
+	}
+	return bans, nil
+}
+
+// invalidate makes the next check read the bans again
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+func (s *Service) trustedAddr(addr netip.Addr) bool {
+	for _, prefix := range s.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) trustedRange(banned netip.Prefix) bool {
+	for _, prefix := range s.trusted {
+		if prefix.Overlaps(banned) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeBan(ban *domain.SecurityBan) string {
+	target := ban.IPAddress
+	if ban.UserID != nil {
+		target = fmt.Sprintf("user %d", *ban.UserID)
+		if ban.IPAddress != "" {
+			target += " and " + ban.IPAddress
+		}
+	}
+	until := "permanently"
+	if ban.ExpiresAt != nil {
+		until = "until " + ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("Banned %s %s: %s", target, until, ban.Reason)
+}
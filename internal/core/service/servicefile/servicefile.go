@@ -0,0 +1,269 @@
+package servicefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+)
+
+// Notification types sent for new files
+const (
+	NotificationFileFromStaff    = "service_file_from_staff"
+	NotificationFileFromCustomer = "service_file_from_customer"
+)
+
+// Default limits of customer uploads
+const (
+	DefaultMaxFileSize = 25 << 20
+	DefaultQuota       = 100 << 20
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrFileNotFound    = errors.New("file not found")
+	ErrFileTooLarge    = errors.New("file exceeds the maximum upload size")
+	ErrQuotaExceeded   = errors.New("file exceeds the storage quota of the service")
+	ErrNoFileStore     = errors.New("file storage is not configured")
+)
+
+// Service manages the files staff and customers exchange for a service
+type Service struct {
+	db          *gorm.DB
+	files       domain.FileStore
+	quarantine  *quarantine.Service
+	maxFileSize int64
+	quota       int64
+}
+
+// NewService creates a new service file service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, maxFileSize: DefaultMaxFileSize, quota: DefaultQuota}
+}
+
+// SetFileStore sets the store files are uploaded to
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetQuarantine scans uploads for malware before they are stored
+func (s *Service) SetQuarantine(q *quarantine.Service) {
+	s.quarantine = q
+}
+
+// SetLimits sets the largest file a customer may upload and the total
+// size of the customer uploads of a service. Zero keeps the default.
+func (s *Service) SetLimits(maxFileSize, quota int64) {
+	if maxFileSize > 0 {
+		s.maxFileSize = maxFileSize
+	}
+	if quota > 0 {
+		s.quota = quota
+	}
+}
+
+// Limits returns the largest file a customer may upload and the total
+// size of the customer uploads of a service
+func (s *Service) Limits() (maxFileSize, quota int64) {
+	return s.maxFileSize, s.quota
+}
+
+// FileInput is an uploaded file
+type FileInput struct {
+	FileName    string
+	ContentType string
+	Reader      io.Reader
+	Size        int64
+	Note        string
+}
+
+// GetService retrieves a service, limited to customerID unless it is nil
+func (s *Service) GetService(serviceID uint64, customerID *uint64) (*domain.Service, error) {
+	query := s.db.Where("id = ?", serviceID)
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+	var service domain.Service
+	if err := query.Preload("Product").First(&service).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceNotFound
+		}
+		return nil, err
+	}
+	return &service, nil
+}
+
+// ListFiles lists the files of a service, newest first
+func (s *Service) ListFiles(serviceID uint64) ([]domain.ServiceFile, error) {
+	var files []domain.ServiceFile
+	if err := s.db.Where("service_id = ?", serviceID).Preload("Uploader").
+		Order("created_at DESC, id DESC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Usage returns the total size of the customer uploads of a service
+func (s *Service) Usage(serviceID uint64) (int64, error) {
+	var used int64
+	if err := s.db.Model(&domain.ServiceFile{}).
+		Where("service_id = ? AND from_staff = ?", serviceID, false).
+		Select("COALESCE(SUM(file_size), 0)").Scan(&used).Error; err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// GetFile retrieves a file of a service
+func (s *Service) GetFile(serviceID, fileID uint64) (*domain.ServiceFile, error) {
+	var file domain.ServiceFile
+	if err := s.db.Where("id = ? AND service_id = ?", fileID, serviceID).First(&file).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Upload scans a file, stores it and notifies the other side: the
+// customer of files from staff, and the admins of files from the
+// customer. Customer uploads count against the limits of the service.
+func (s *Service) Upload(ctx context.Context, service *domain.Service, uploader *domain.User, fromStaff bool, file FileInput) (*domain.ServiceFile, error) {
+	if s.files == nil {
+		return nil, ErrNoFileStore
+	}
+	if !fromStaff {
+		if file.Size > s.maxFileSize {
+			return nil, ErrFileTooLarge
+		}
+		used, err := s.Usage(service.ID)
+		if err != nil {
+			return nil, err
+		}
+		if used+file.Size > s.quota {
+			return nil, ErrQuotaExceeded
+		}
+	}
+
+	checked, err := s.quarantine.Check(ctx, quarantine.Upload{
+		Source:      domain.UploadSourceService,
+		SourceID:    service.ID,
+		UploadedBy:  &uploader.ID,
+		FileName:    file.FileName,
+		ContentType: file.ContentType,
+		Reader:      file.Reader,
+		Size:        file.Size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer checked.Close()
+
+	key, err := domain.NewFileKey("services", service.ID)
+	if err != nil {
+		return nil, err
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := s.files.Put(ctx, key, checked, checked.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	record := &domain.ServiceFile{
+		ServiceID:   service.ID,
+		UploadedBy:  uploader.ID,
+		FromStaff:   fromStaff,
+		FileName:    file.FileName,
+		StorageKey:  key,
+		FileSize:    file.Size,
+		ContentType: contentType,
+		Note:        strings.TrimSpace(file.Note),
+		ScanStatus:  checked.ScanStatus,
+	}
+	if err := s.db.Omit("Service", "Uploader").Create(record).Error; err != nil {
+		s.removeFile(key)
+		return nil, err
+	}
+	record.Uploader = *uploader
+
+	s.notify(service, record)
+	return record, nil
+}
+
+// FileURL returns a signed URL of a file
+func (s *Service) FileURL(file *domain.ServiceFile, expires time.Duration) (string, error) {
+	if s.files == nil {
+		return "", ErrNoFileStore
+	}
+	return s.files.SignedURL(file.StorageKey, file.FileName, expires)
+}
+
+// DeleteFile deletes a file and its stored content
+func (s *Service) DeleteFile(file *domain.ServiceFile) error {
+	if err := s.db.Delete(&domain.ServiceFile{}, file.ID).Error; err != nil {
+		return err
+	}
+	s.removeFile(file.StorageKey)
+	return nil
+}
+
+// notify tells the other side of the exchange about a new file. Failures
+// are logged; the upload itself succeeded.
+func (s *Service) notify(service *domain.Service, file *domain.ServiceFile) {
+	notifier := notification.NewService(s.db)
+	name := service.Product.Name
+	if service.Domain != "" {
+		name += " (" + service.Domain + ")"
+	}
+
+	if file.FromStaff {
+		title := fmt.Sprintf("New file for %s", name)
+		message := fmt.Sprintf("%s has been added to your service %s.", file.FileName, name)
+		if file.Note != "" {
+			message += "\n\n" + file.Note
+		}
+		link := fmt.Sprintf("/client/services/%d", service.ID)
+		if err := notifier.SendNotification(service.CustomerID, NotificationFileFromStaff, title, message, link); err != nil {
+			log.Printf("servicefile: failed to notify customer %d: %v", service.CustomerID, err)
+		}
+		return
+	}
+
+	var admins []domain.User
+	if err := s.db.Select("id").Where("role = ?", domain.UserRoleAdmin).Find(&admins).Error; err != nil {
+		log.Printf("servicefile: failed to load admins: %v", err)
+		return
+	}
+	title := fmt.Sprintf("Customer uploaded %s", file.FileName)
+	message := fmt.Sprintf("%s uploaded %s to service #%d %s.", file.Uploader.Email, file.FileName, service.ID, name)
+	if file.Note != "" {
+		message += "\n\n" + file.Note
+	}
+	link := fmt.Sprintf("/admin/services/%d", service.ID)
+	for _, admin := range admins {
+		if err := notifier.SendNotification(admin.ID, NotificationFileFromCustomer, title, message, link); err != nil {
+			log.Printf("servicefile: failed to notify user %d: %v", admin.ID, err)
+		}
+	}
+}
+
+func (s *Service) removeFile(key string) {
+	if s.files == nil {
+		return
+	}
+	if err := s.files.Delete(context.Background(), key); err != nil {
+		log.Printf("servicefile: failed to delete file %s: %v", key, err)
+	}
+}
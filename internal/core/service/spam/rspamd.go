@@ -0,0 +1,66 @@
+package spam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rspamdTimeout bounds a check so a slow rspamd does not hold up mail
+const rspamdTimeout = 30 * time.Second
+
+// Rspamd checks messages with the HTTP API of an rspamd worker
+type Rspamd struct {
+	url      string
+	password string
+	client   *http.Client
+}
+
+// RspamdResult is the verdict of rspamd on a message
+type RspamdResult struct {
+	Score         float64 `json:"score"`
+	RequiredScore float64 `json:"required_score"`
+	Action        string  `json:"action"`
+}
+
+// NewRspamd creates a client of the rspamd worker at url, such as
+// "http://127.0.0.1:11333", or returns nil when url is empty
+func NewRspamd(url, password string) *Rspamd {
+	url = strings.TrimRight(strings.TrimSpace(url), "/")
+	if url == "" {
+		return nil
+	}
+	return &Rspamd{url: url, password: password, client: &http.Client{Timeout: rspamdTimeout}}
+}
+
+// Check sends a raw message to rspamd
+func (r *Rspamd) Check(ctx context.Context, raw []byte) (*RspamdResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+"/checkv2", bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if r.password != "" {
+		req.Header.Set("Password", r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rspamd: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rspamd: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result RspamdResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("rspamd: %w", err)
+	}
+	return &result, nil
+}
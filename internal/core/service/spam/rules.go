@@ -0,0 +1,178 @@
+package spam
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Scores of the header heuristics. A message reaching the threshold of
+// the service, 5 by default, is quarantined.
+const (
+	scoreSPFFail      = 3.0
+	scoreSPFSoftFail  = 1.5
+	scoreDKIMFail     = 2.0
+	scoreDMARCFail    = 3.0
+	scoreAuthPass     = -1.0
+	scoreUpstreamSpam = 5.0
+	scoreNoFrom       = 2.0
+	scoreNoMessageID  = 1.0
+	scoreNoDate       = 1.0
+	scoreReplyTo      = 1.0
+	scoreBulk         = 1.5
+	scoreShouting     = 1.0
+)
+
+// authResult matches the method results of an Authentication-Results
+// header such as "mx.example.com; spf=pass smtp.mailfrom=...; dkim=fail"
+var authResult = regexp.MustCompile(`(?i)\b(spf|dkim|dmarc)\s*=\s*([a-z]+)`)
+
+var wordDecoder = new(mime.WordDecoder)
+
+// bounceLoop returns why a message is an automatic reply or bounce, or ""
+// for a message written by a person. Answering those with a ticket and
+// its notification is what starts a mail loop, so they are rejected.
+func bounceLoop(h mail.Header, sender string) string {
+	if value := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); value != "" && value != "no" {
+		return "auto-submitted message (" + value + ")"
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" ||
+		strings.EqualFold(strings.TrimSpace(h.Get("Precedence")), "auto_reply") {
+		return "automatic reply"
+	}
+	if strings.TrimSpace(h.Get("Return-Path")) == "<>" {
+		return "delivery status notification"
+	}
+	if local, _, _ := strings.Cut(sender, "@"); local == "mailer-daemon" || local == "postmaster" {
+		return "delivery status notification"
+	}
+	if mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type")); err == nil && mediaType == "multipart/report" {
+		return "delivery report"
+	}
+	return ""
+}
+
+// scoreHeaders applies the header heuristics to a message
+func scoreHeaders(h mail.Header) (float64, []string) {
+	var score float64
+	var reasons []string
+	add := func(points float64, reason string) {
+		score += points
+		reasons = append(reasons, fmt.Sprintf("%s (%+.1f)", reason, points))
+	}
+
+	results := authResults(h)
+	switch results["spf"] {
+	case "fail":
+		add(scoreSPFFail, "SPF failed")
+	case "softfail":
+		add(scoreSPFSoftFail, "SPF soft failed")
+	case "pass":
+		add(scoreAuthPass, "SPF passed")
+	}
+	switch results["dkim"] {
+	case "fail":
+		add(scoreDKIMFail, "DKIM failed")
+	case "pass":
+		add(scoreAuthPass, "DKIM passed")
+	}
+	switch results["dmarc"] {
+	case "fail":
+		add(scoreDMARCFail, "DMARC failed")
+	case "pass":
+		add(scoreAuthPass, "DMARC passed")
+	}
+
+	if strings.EqualFold(strings.TrimSpace(h.Get("X-Spam-Flag")), "yes") ||
+		strings.HasPrefix(strings.ToLower(strings.TrimSpace(h.Get("X-Spam-Status"))), "yes") {
+		add(scoreUpstreamSpam, "marked as spam upstream")
+	}
+
+	from, err := mail.ParseAddress(h.Get("From"))
+	if err != nil {
+		add(scoreNoFrom, "missing or invalid From")
+	}
+	if h.Get("Message-Id") == "" {
+		add(scoreNoMessageID, "missing Message-ID")
+	}
+	if h.Get("Date") == "" {
+		add(scoreNoDate, "missing Date")
+	}
+	if replyTo, err := mail.ParseAddress(h.Get("Reply-To")); err == nil && from != nil &&
+		!strings.EqualFold(addressDomain(replyTo.Address), addressDomain(from.Address)) {
+		add(scoreReplyTo, "Reply-To domain differs from From")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "junk", "list":
+		add(scoreBulk, "bulk mail")
+	default:
+		if h.Get("List-Unsubscribe") != "" {
+			add(scoreBulk, "bulk mail")
+		}
+	}
+
+	if shouting(decodeHeader(h.Get("Subject"))) {
+		add(scoreShouting, "subject in capitals")
+	}
+	return score, reasons
+}
+
+// authResults returns the SPF, DKIM and DMARC results the receiving mail
+// server recorded. Only the topmost Authentication-Results header is
+// read, as the ones below it may come from the sender. A pass of any
+// DKIM signature counts as pass.
+func authResults(h mail.Header) map[string]string {
+	results := make(map[string]string)
+	if headers := h["Authentication-Results"]; len(headers) > 0 {
+		for _, match := range authResult.FindAllStringSubmatch(headers[0], -1) {
+			method, result := strings.ToLower(match[1]), strings.ToLower(match[2])
+			if results[method] != "pass" {
+				results[method] = result
+			}
+		}
+	}
+	if _, ok := results["spf"]; !ok {
+		if fields := strings.Fields(h.Get("Received-SPF")); len(fields) > 0 {
+			results["spf"] = strings.ToLower(fields[0])
+		}
+	}
+	return results
+}
+
+// shouting reports whether a subject of some length is mostly capitals
+func shouting(subject string) bool {
+	var letters, upper int
+	for _, r := range subject {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 10 && upper*10 >= letters*7
+}
+
+// senderAddress returns the lower case address of the From header
+func senderAddress(h mail.Header) string {
+	if from, err := mail.ParseAddress(h.Get("From")); err == nil {
+		return strings.ToLower(from.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(h.Get("From")))
+}
+
+func addressDomain(address string) string {
+	_, domain, _ := strings.Cut(address, "@")
+	return strings.ToLower(domain)
+}
+
+func decodeHeader(value string) string {
+	if decoded, err := wordDecoder.DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
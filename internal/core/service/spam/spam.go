@@ -0,0 +1,411 @@
+package spam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Default thresholds. Messages scoring at least DefaultThreshold are
+// quarantined for review; those reaching DefaultRejectThreshold are
+// dropped.
+const (
+	DefaultThreshold       = 5.0
+	DefaultRejectThreshold = 15.0
+)
+
+// A sender whose mail opened more than loopLimit messages within
+// loopWindow is taken to be an autoresponder answering our notifications
+const (
+	loopLimit  = 10
+	loopWindow = 10 * time.Minute
+)
+
+var (
+	ErrMessageNotFound = errors.New("spam message not found")
+	ErrAlreadyReleased = errors.New("message was already released")
+	ErrNoImporter      = errors.New("email import is not configured")
+	ErrEntryNotFound   = errors.New("spam list entry not found")
+	ErrInvalidList     = errors.New("list must be allow or block")
+	ErrInvalidPattern  = errors.New("pattern must be an email address or a domain")
+)
+
+// Action is what happens to an inbound message
+type Action string
+
+const (
+	ActionAccept     Action = "accept"
+	ActionQuarantine Action = "quarantine"
+	ActionReject     Action = "reject"
+)
+
+// Verdict is the outcome of checking an inbound message
+type Verdict struct {
+	Action  Action
+	Score   float64
+	Reasons []string
+	Sender  string // Lower case address of the From header
+	Subject string
+}
+
+func (v *Verdict) reject(reason string) *Verdict {
+	v.Action = ActionReject
+	v.Reasons = append(v.Reasons, reason)
+	return v
+}
+
+// Service filters the email piped into tickets. Messages are matched
+// against the allow and block lists, scored by header heuristics and
+// optionally rspamd, and accepted, held in the spam queue or rejected.
+type Service struct {
+	db              *gorm.DB
+	threshold       float64
+	rejectThreshold float64
+	rspamd          *Rspamd
+	importer        domain.EmailImporter
+}
+
+// NewService creates a new spam service with the default thresholds
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, threshold: DefaultThreshold, rejectThreshold: DefaultRejectThreshold}
+}
+
+// SetThresholds sets the scores from which messages are quarantined and
+// rejected. A reject threshold of 0 quarantines all spam instead.
+func (s *Service) SetThresholds(threshold, rejectThreshold float64) {
+	if threshold > 0 {
+		s.threshold = threshold
+	}
+	s.rejectThreshold = rejectThreshold
+}
+
+// SetRspamd adds the score of rspamd to that of the header heuristics
+func (s *Service) SetRspamd(rspamd *Rspamd) {
+	s.rspamd = rspamd
+}
+
+// SetImporter sets how released messages become tickets
+func (s *Service) SetImporter(importer domain.EmailImporter) {
+	s.importer = importer
+}
+
+// Check decides what happens to a raw inbound message. Bounces,
+// automatic replies and blocked senders are rejected outright; allowed
+// senders skip scoring.
+func (s *Service) Check(ctx context.Context, raw []byte) (*Verdict, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse email: %w", err)
+	}
+	h := msg.Header
+	v := &Verdict{Action: ActionAccept, Sender: senderAddress(h), Subject: decodeHeader(h.Get("Subject"))}
+
+	if reason := bounceLoop(h, v.Sender); reason != "" {
+		return v.reject(reason), nil
+	}
+	looping, err := s.senderLooping(h.Get("From"), v.Sender)
+	if err != nil {
+		return nil, err
+	}
+	if looping {
+		return v.reject("mail loop: too many messages from sender"), nil
+	}
+
+	entry, err := s.matchList(v.Sender)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if entry.ListType == domain.SpamListBlock {
+			return v.reject("sender is on the block list (" + entry.Pattern + ")"), nil
+		}
+		v.Reasons = append(v.Reasons, "sender is on the allow list ("+entry.Pattern+")")
+		return v, nil
+	}
+
+	v.Score, v.Reasons = scoreHeaders(h)
+	if s.rspamd != nil {
+		result, err := s.rspamd.Check(ctx, raw)
+		if err != nil {
+			// Mail keeps flowing when rspamd is down; the heuristics
+			// still apply
+			log.Printf("spam: %v", err)
+		} else {
+			v.Score += result.Score
+			v.Reasons = append(v.Reasons, fmt.Sprintf("rspamd: %s (%+.1f)", result.Action, result.Score))
+		}
+	}
+
+	switch {
+	case s.rejectThreshold > 0 && v.Score >= s.rejectThreshold:
+		v.Action = ActionReject
+	case v.Score >= s.threshold:
+		v.Action = ActionQuarantine
+	}
+	return v, nil
+}
+
+// senderLooping reports whether a sender has sent more messages than a
+// person would within the loop window, counting both ticket messages and
+// quarantined ones
+func (s *Service) senderLooping(from, sender string) (bool, error) {
+	if sender == "" {
+		return false, nil
+	}
+	since := time.Now().Add(-loopWindow)
+	var messages, spam int64
+	if err := s.db.Model(&domain.TicketMessage{}).
+		Where("sender_email = ? AND is_staff = ? AND created_at >= ?", strings.TrimSpace(from), false, since).
+		Count(&messages).Error; err != nil {
+		return false, err
+	}
+	if err := s.db.Model(&domain.SpamMessage{}).
+		Where("sender = ? AND created_at >= ?", sender, since).
+		Count(&spam).Error; err != nil {
+		return false, err
+	}
+	return messages+spam >= loopLimit, nil
+}
+
+// matchList returns the most specific list entry matching a sender: its
+// address, then its domain and parent domains. Block wins over allow for
+// the same pattern.
+func (s *Service) matchList(sender string) (*domain.SpamListEntry, error) {
+	if sender == "" {
+		return nil, nil
+	}
+	candidates := []string{sender}
+	for domainName := addressDomain(sender); domainName != ""; {
+		candidates = append(candidates, domainName)
+		_, parent, ok := strings.Cut(domainName, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			break
+		}
+		domainName = parent
+	}
+
+	var entries []domain.SpamListEntry
+	if err := s.db.Where("pattern IN ?", candidates).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	var best *domain.SpamListEntry
+	for i := range entries {
+		entry := &entries[i]
+		if best == nil || len(entry.Pattern) > len(best.Pattern) ||
+			(entry.Pattern == best.Pattern && entry.ListType == domain.SpamListBlock) {
+			best = entry
+		}
+	}
+	return best, nil
+}
+
+// --- Spam queue ---
+
+// Quarantine holds a message back for review by the admins
+func (s *Service) Quarantine(raw []byte, v *Verdict) (*domain.SpamMessage, error) {
+	message := &domain.SpamMessage{
+		Sender:  truncate(v.Sender, 255),
+		Subject: truncate(v.Subject, 500),
+		Score:   v.Score,
+		Reasons: v.Reasons,
+		Status:  domain.SpamStatusPending,
+		Raw:     raw,
+	}
+	if err := s.db.Create(message).Error; err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// ListMessages lists quarantined messages, newest first, optionally of a
+// status
+func (s *Service) ListMessages(status domain.SpamMessageStatus, limit, offset int) ([]domain.SpamMessage, int64, error) {
+	query := s.db.Model(&domain.SpamMessage{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var messages []domain.SpamMessage
+	if err := query.Omit("raw").Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+// GetMessage retrieves a quarantined message with its raw content
+func (s *Service) GetMessage(id uint64) (*domain.SpamMessage, error) {
+	var message domain.SpamMessage
+	if err := s.db.First(&message, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// ReleaseMessage imports a quarantined message as a ticket message. With
+// allowSender its sender is added to the allow list, so their next
+// messages are not held back again.
+func (s *Service) ReleaseMessage(id, adminID uint64, allowSender bool) (*domain.SpamMessage, error) {
+	if s.importer == nil {
+		return nil, ErrNoImporter
+	}
+	message, err := s.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the message first so two admins cannot release it twice
+	now := time.Now()
+	result := s.db.Model(&domain.SpamMessage{}).
+		Where("id = ? AND status = ?", id, domain.SpamStatusPending).
+		Updates(map[string]interface{}{
+			"status":      domain.SpamStatusReleased,
+			"released_by": adminID,
+			"released_at": &now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAlreadyReleased
+	}
+
+	imported, err := s.importer.ImportEmail(message.Raw)
+	if err != nil {
+		s.db.Model(&domain.SpamMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":      domain.SpamStatusPending,
+			"released_by": nil,
+			"released_at": nil,
+		})
+		return nil, err
+	}
+	if err := s.db.Model(&domain.SpamMessage{}).Where("id = ?", id).
+		Update("ticket_id", imported.TicketID).Error; err != nil {
+		return nil, err
+	}
+
+	if allowSender && message.Sender != "" {
+		if _, err := s.AddEntry(domain.SpamListAllow, message.Sender, "Released from the spam queue", &adminID); err != nil {
+			log.Printf("spam: failed to allow %s: %v", message.Sender, err)
+		}
+	}
+
+	message.Status = domain.SpamStatusReleased
+	message.ReleasedBy = &adminID
+	message.ReleasedAt = &now
+	message.TicketID = &imported.TicketID
+	return message, nil
+}
+
+// DeleteMessage deletes a quarantined message
+func (s *Service) DeleteMessage(id uint64) error {
+	result := s.db.Delete(&domain.SpamMessage{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// --- Allow and block lists ---
+
+// ListEntries lists the entries of a list, or of both lists
+func (s *Service) ListEntries(listType string) ([]domain.SpamListEntry, error) {
+	query := s.db.Order("list_type, pattern")
+	if listType != "" {
+		query = query.Where("list_type = ?", listType)
+	}
+	var entries []domain.SpamListEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// AddEntry adds an address or domain to a list. Adding a pattern that is
+// already listed updates its note.
+func (s *Service) AddEntry(listType, pattern, note string, createdBy *uint64) (*domain.SpamListEntry, error) {
+	if listType != domain.SpamListAllow && listType != domain.SpamListBlock {
+		return nil, ErrInvalidList
+	}
+	pattern, err := normalizePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry domain.SpamListEntry
+	err = s.db.Where("list_type = ? AND pattern = ?", listType, pattern).First(&entry).Error
+	switch {
+	case err == nil:
+		if note != "" && note != entry.Note {
+			entry.Note = note
+			if err := s.db.Model(&entry).Update("note", note).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &entry, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	entry = domain.SpamListEntry{ListType: listType, Pattern: pattern, Note: note, CreatedBy: createdBy}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// DeleteEntry removes an entry from its list
+func (s *Service) DeleteEntry(id uint64) error {
+	result := s.db.Delete(&domain.SpamListEntry{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// normalizePattern lower cases an address or domain, dropping the "@" of
+// patterns such as "@example.com"
+func normalizePattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(pattern), "@"))
+	if strings.Contains(pattern, "@") {
+		address, err := mail.ParseAddress(pattern)
+		if err != nil || address.Address != pattern {
+			return "", ErrInvalidPattern
+		}
+		return pattern, nil
+	}
+	if !strings.Contains(pattern, ".") || strings.ContainsAny(pattern, " \t<>,;") ||
+		strings.HasPrefix(pattern, ".") || strings.HasSuffix(pattern, ".") {
+		return "", ErrInvalidPattern
+	}
+	return pattern, nil
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return strings.ToValidUTF8(value[:max], "")
+}
@@ -0,0 +1,290 @@
+package stock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrNotTracked      = errors.New("product stock is not tracked")
+	ErrOutOfStock      = errors.New("product is out of stock")
+	ErrInvalidQuantity = errors.New("quantity must be positive")
+	ErrProductNotFound = errors.New("product not found")
+)
+
+// NotificationLowStock is the notification type of low stock alerts
+const NotificationLowStock = "low_stock"
+
+// Service tracks product stock. Products without a ProductStock record are
+// not stock controlled and can always be ordered.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new stock service. Pass a transaction to check and
+// reserve stock as part of it.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// GetStock returns the stock record of a product
+func (s *Service) GetStock(productID uint64) (*domain.ProductStock, error) {
+	var stock domain.ProductStock
+	result := s.db.Where("product_id = ?", productID).Limit(1).Find(&stock)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotTracked
+	}
+	return &stock, nil
+}
+
+// ListStock returns stock records with their products, lowest available
+// quantity first
+func (s *Service) ListStock(lowOnly bool, limit, offset int) ([]domain.ProductStock, int64, error) {
+	var stocks []domain.ProductStock
+	var total int64
+
+	query := s.db.Model(&domain.ProductStock{})
+	if lowOnly {
+		query = query.Where("quantity - reserved_qty <= low_stock_alert")
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Preload("Product").Order("quantity - reserved_qty, id").
+		Limit(limit).Offset(offset).Find(&stocks).Error; err != nil {
+		return nil, 0, err
+	}
+	return stocks, total, nil
+}
+
+// SetStock starts or updates stock tracking for a product
+func (s *Service) SetStock(productID uint64, settings Settings) (*domain.ProductStock, error) {
+	if settings.Quantity < 0 || settings.LowStockAlert < 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	var product domain.Product
+	result := s.db.Select("id").Limit(1).Find(&product, productID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stock domain.ProductStock
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", productID).Limit(1).Find(&stock)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			stock = domain.ProductStock{ProductID: productID}
+			if err := tx.Create(&stock).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{
+			"quantity":         settings.Quantity,
+			"low_stock_alert":  settings.LowStockAlert,
+			"out_of_stock_msg": settings.OutOfStockMsg,
+			"allow_backorder":  settings.AllowBackorder,
+		}
+		if settings.Quantity > stock.Quantity {
+			updates["low_stock_sent_at"] = nil
+		}
+		return tx.Model(&stock).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStock(productID)
+}
+
+// StopTracking removes the stock record of a product so it can be ordered
+// without limit
+func (s *Service) StopTracking(productID uint64) error {
+	result := s.db.Where("product_id = ?", productID).Delete(&domain.ProductStock{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotTracked
+	}
+	return nil
+}
+
+// Restock adds units to the stock of a product and re-arms the low stock
+// alert
+func (s *Service) Restock(productID uint64, quantity int) (*domain.ProductStock, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	now := time.Now()
+	result := s.db.Model(&domain.ProductStock{}).Where("product_id = ?", productID).
+		Updates(map[string]interface{}{
+			"quantity":          gorm.Expr("quantity + ?", quantity),
+			"last_restocked":    &now,
+			"low_stock_sent_at": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotTracked
+	}
+	return s.GetStock(productID)
+}
+
+// Check returns ErrOutOfStock when quantity units of a product cannot be
+// sold and backorders are not allowed
+func (s *Service) Check(productID uint64, quantity int) error {
+	stock, err := s.GetStock(productID)
+	if err == ErrNotTracked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !stock.CanFulfil(quantity) {
+		return s.outOfStock(stock)
+	}
+	return nil
+}
+
+// Reserve holds quantity units of a product for a pending order
+func (s *Service) Reserve(productID uint64, quantity int) error {
+	return s.adjust(productID, func(stock *domain.ProductStock) error {
+		if !stock.CanFulfil(quantity) {
+			return s.outOfStock(stock)
+		}
+		stock.ReservedQty += quantity
+		return nil
+	})
+}
+
+// Release returns units reserved by an order that was cancelled
+func (s *Service) Release(productID uint64, quantity int) error {
+	return s.adjust(productID, func(stock *domain.ProductStock) error {
+		stock.ReservedQty -= quantity
+		if stock.ReservedQty < 0 {
+			stock.ReservedQty = 0
+		}
+		return nil
+	})
+}
+
+// Commit takes units reserved by an order out of stock once it completes.
+// Backordered units leave the quantity negative until restocked.
+func (s *Service) Commit(productID uint64, quantity int) error {
+	return s.adjust(productID, func(stock *domain.ProductStock) error {
+		stock.Quantity -= quantity
+		stock.ReservedQty -= quantity
+		if stock.ReservedQty < 0 {
+			stock.ReservedQty = 0
+		}
+		return nil
+	})
+}
+
+// adjust locks the stock row of a product, applies fn and saves the
+// quantities. Untracked products are skipped.
+func (s *Service) adjust(productID uint64, fn func(stock *domain.ProductStock) error) error {
+	var stock domain.ProductStock
+	result := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", productID).Limit(1).Find(&stock)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	if err := fn(&stock); err != nil {
+		return err
+	}
+	if err := s.db.Model(&stock).Updates(map[string]interface{}{
+		"quantity":     stock.Quantity,
+		"reserved_qty": stock.ReservedQty,
+	}).Error; err != nil {
+		return err
+	}
+
+	if stock.IsLowStock() && stock.LowStockSentAt == nil {
+		s.alertLowStock(&stock)
+	}
+	return nil
+}
+
+// alertLowStock notifies every admin once until the product is restocked.
+// Failures are logged so they never block an order.
+func (s *Service) alertLowStock(stock *domain.ProductStock) {
+	now := time.Now()
+	if err := s.db.Model(stock).Update("low_stock_sent_at", &now).Error; err != nil {
+		log.Printf("failed to record low stock alert for product %d: %v", stock.ProductID, err)
+		return
+	}
+
+	var product domain.Product
+	s.db.Select("id", "name").Limit(1).Find(&product, stock.ProductID)
+
+	var admins []domain.User
+	if err := s.db.Select("id").Where("role = ?", domain.UserRoleAdmin).Find(&admins).Error; err != nil {
+		log.Printf("failed to load admins for low stock alert: %v", err)
+		return
+	}
+
+	notifier := notification.NewService(s.db)
+	title := fmt.Sprintf("Low stock: %s", product.Name)
+	message := fmt.Sprintf("%s has %d unit(s) available, at or below the alert level of %d.",
+		product.Name, stock.AvailableQuantity(), stock.LowStockAlert)
+	link := fmt.Sprintf("/admin/products/%d", stock.ProductID)
+	for _, admin := range admins {
+		if err := notifier.SendNotification(admin.ID, NotificationLowStock, title, message, link); err != nil {
+			log.Printf("failed to send low stock alert to user %d: %v", admin.ID, err)
+		}
+	}
+}
+
+func (s *Service) outOfStock(stock *domain.ProductStock) error {
+	return &OutOfStockError{ProductID: stock.ProductID, Message: stock.OutOfStockMsg}
+}
+
+// OutOfStockError reports a product without enough stock. It matches
+// ErrOutOfStock.
+type OutOfStockError struct {
+	ProductID uint64
+	Message   string
+}
+
+func (e *OutOfStockError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return ErrOutOfStock.Error()
+}
+
+func (e *OutOfStockError) Is(target error) bool {
+	return target == ErrOutOfStock
+}
+
+// Settings are the stock tracking settings of a product
+type Settings struct {
+	Quantity       int
+	LowStockAlert  int
+	OutOfStockMsg  string
+	AllowBackorder bool
+}
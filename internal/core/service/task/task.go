@@ -0,0 +1,336 @@
+// Package task keeps the to-do list of the staff. Tasks can be about a
+// customer, order, invoice, service or ticket, are assigned to a staff
+// member and may have a due date, after which the assignee is reminded.
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+var (
+	ErrTaskNotFound     = errors.New("task not found")
+	ErrTitleRequired    = errors.New("task title is required")
+	ErrInvalidEntity    = errors.New("entity type must be customer, order, invoice, service or ticket")
+	ErrEntityNotFound   = errors.New("linked record not found")
+	ErrAssigneeNotStaff = errors.New("assignee must be a staff member")
+	ErrInvalidStatus    = errors.New("status must be open or done")
+)
+
+// Notifications staff get about their tasks
+const (
+	NotificationTaskAssigned = "task_assigned"
+	NotificationTaskOverdue  = "task_overdue"
+)
+
+// overdueBatch is the number of overdue tasks notified at once
+const overdueBatch = 100
+
+// Service manages admin tasks
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new task service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Input is the editable part of a task
+type Input struct {
+	Title       string
+	Description string
+	EntityType  domain.TaskEntity
+	EntityID    *uint64
+	AssigneeID  *uint64
+	DueAt       *time.Time
+}
+
+// Filter selects the tasks to list. Zero fields match every task.
+type Filter struct {
+	Status     domain.AdminTaskStatus
+	AssigneeID *uint64
+	EntityType domain.TaskEntity
+	EntityID   *uint64
+	Overdue    bool // Only open tasks past their due date
+}
+
+// Create adds a task and tells the assignee about it
+func (s *Service) Create(createdBy uint64, input Input) (*domain.AdminTask, error) {
+	if err := s.validate(&input); err != nil {
+		return nil, err
+	}
+
+	task := &domain.AdminTask{
+		Title:       input.Title,
+		Description: input.Description,
+		Status:      domain.AdminTaskStatusOpen,
+		EntityType:  input.EntityType,
+		EntityID:    input.EntityID,
+		AssigneeID:  input.AssigneeID,
+		CreatedBy:   createdBy,
+		DueAt:       input.DueAt,
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, err
+	}
+
+	if task.AssigneeID != nil && *task.AssigneeID != createdBy {
+		s.notifyAssigned(task)
+	}
+	return task, nil
+}
+
+// Update replaces the editable fields of a task. A new assignee is told
+// about the task, and a new due date can make it overdue again.
+func (s *Service) Update(id, updatedBy uint64, input Input) (*domain.AdminTask, error) {
+	task, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(&input); err != nil {
+		return nil, err
+	}
+
+	reassigned := input.AssigneeID != nil && (task.AssigneeID == nil || *task.AssigneeID != *input.AssigneeID)
+	updates := map[string]interface{}{
+		"title":       input.Title,
+		"description": input.Description,
+		"entity_type": input.EntityType,
+		"entity_id":   input.EntityID,
+		"assignee_id": input.AssigneeID,
+		"due_at":      input.DueAt,
+	}
+	if !sameTime(task.DueAt, input.DueAt) {
+		updates["overdue_notified_at"] = nil
+	}
+	if err := s.db.Model(task).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	task, err = s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if reassigned && *task.AssigneeID != updatedBy {
+		s.notifyAssigned(task)
+	}
+	return task, nil
+}
+
+// SetStatus marks a task done or opens it again
+func (s *Service) SetStatus(id, staffID uint64, status domain.AdminTaskStatus) (*domain.AdminTask, error) {
+	task, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case domain.AdminTaskStatusDone:
+		now := time.Now()
+		updates["completed_at"] = &now
+		updates["completed_by"] = &staffID
+	case domain.AdminTaskStatusOpen:
+		updates["completed_at"] = nil
+		updates["completed_by"] = nil
+	default:
+		return nil, ErrInvalidStatus
+	}
+	if err := s.db.Model(task).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.Get(id)
+}
+
+// Delete removes a task
+func (s *Service) Delete(id uint64) error {
+	result := s.db.Delete(&domain.AdminTask{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// Get returns a task with its assignee
+func (s *Service) Get(id uint64) (*domain.AdminTask, error) {
+	var task domain.AdminTask
+	result := s.db.Preload("Assignee").Limit(1).Find(&task, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotFound
+	}
+	return &task, nil
+}
+
+// List returns the tasks matching a filter, the ones due first first and
+// the ones without a due date last
+func (s *Service) List(filter Filter, limit, offset int) ([]domain.AdminTask, int64, error) {
+	query := s.db.Model(&domain.AdminTask{})
+	if filter.Status != "" {
+		if filter.Status != domain.AdminTaskStatusOpen && filter.Status != domain.AdminTaskStatusDone {
+			return nil, 0, ErrInvalidStatus
+		}
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.AssigneeID != nil {
+		query = query.Where("assignee_id = ?", *filter.AssigneeID)
+	}
+	if filter.EntityType != "" {
+		if !filter.EntityType.Valid() {
+			return nil, 0, ErrInvalidEntity
+		}
+		query = query.Where("entity_type = ?", filter.EntityType)
+		if filter.EntityID != nil {
+			query = query.Where("entity_id = ?", *filter.EntityID)
+		}
+	}
+	if filter.Overdue {
+		query = query.Where("status = ? AND due_at < ?", domain.AdminTaskStatusOpen, time.Now())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tasks []domain.AdminTask
+	err := query.Preload("Assignee").
+		Order("CASE WHEN due_at IS NULL THEN 1 ELSE 0 END").Order("due_at").Order("id DESC").
+		Limit(limit).Offset(offset).Find(&tasks).Error
+	return tasks, total, err
+}
+
+// NotifyOverdue reminds the assignees of open tasks that passed their due
+// date since the last run. It returns how many tasks were notified.
+func (s *Service) NotifyOverdue(now time.Time) (int, error) {
+	var tasks []domain.AdminTask
+	count := 0
+	err := s.db.Where("status = ? AND due_at < ? AND overdue_notified_at IS NULL AND assignee_id IS NOT NULL",
+		domain.AdminTaskStatusOpen, now).
+		FindInBatches(&tasks, overdueBatch, func(tx *gorm.DB, batch int) error {
+			notifier := notification.NewService(s.db)
+			for i := range tasks {
+				task := &tasks[i]
+				title := fmt.Sprintf("Task overdue: %s", task.Title)
+				message := fmt.Sprintf("The task \"%s\" was due %s.", task.Title, task.DueAt.UTC().Format("2006-01-02 15:04 MST"))
+				if err := notifier.SendNotification(*task.AssigneeID, NotificationTaskOverdue, title, message, EntityLink(task)); err != nil {
+					log.Printf("failed to notify staff %d of overdue task %d: %v", *task.AssigneeID, task.ID, err)
+					continue
+				}
+				if err := s.db.Model(task).Update("overdue_notified_at", now).Error; err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		}).Error
+	return count, err
+}
+
+// Monitor reminds assignees of overdue tasks on the given interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.NotifyOverdue(time.Now()); err != nil {
+			log.Printf("failed to notify overdue tasks: %v", err)
+		} else if n > 0 {
+			log.Printf("notified %d overdue task(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EntityLink returns the admin page of the record a task is about
+func EntityLink(task *domain.AdminTask) string {
+	if task.EntityType == "" || task.EntityID == nil {
+		return "/admin"
+	}
+	return fmt.Sprintf("/admin/%ss?id=%d", task.EntityType, *task.EntityID)
+}
+
+func (s *Service) validate(input *Input) error {
+	input.Title = strings.TrimSpace(input.Title)
+	if input.Title == "" {
+		return ErrTitleRequired
+	}
+
+	if input.EntityType == "" {
+		input.EntityID = nil
+	} else {
+		if !input.EntityType.Valid() || input.EntityID == nil {
+			return ErrInvalidEntity
+		}
+		var count int64
+		query := s.db.Table(entityTables[input.EntityType]).Where("id = ?", *input.EntityID)
+		if input.EntityType == domain.TaskEntityCustomer {
+			query = query.Where("role = ?", domain.UserRoleCustomer)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrEntityNotFound
+		}
+	}
+
+	if input.AssigneeID != nil {
+		var assignee domain.User
+		result := s.db.Select("id", "role").Limit(1).Find(&assignee, *input.AssigneeID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || !assignee.IsStaff() {
+			return ErrAssigneeNotStaff
+		}
+	}
+	return nil
+}
+
+// entityTables are the tables of the records tasks can be about
+var entityTables = map[domain.TaskEntity]string{
+	domain.TaskEntityCustomer: "users",
+	domain.TaskEntityOrder:    "orders",
+	domain.TaskEntityInvoice:  "invoices",
+	domain.TaskEntityService:  "services",
+	domain.TaskEntityTicket:   "tickets",
+}
+
+func (s *Service) notifyAssigned(task *domain.AdminTask) {
+	message := fmt.Sprintf("You were assigned the task \"%s\".", task.Title)
+	if task.DueAt != nil {
+		message += fmt.Sprintf(" It is due %s.", task.DueAt.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if err := notification.NewService(s.db).SendNotification(*task.AssigneeID, NotificationTaskAssigned,
+		"New task: "+task.Title, message, EntityLink(task)); err != nil {
+		log.Printf("failed to notify staff %d of task %d: %v", *task.AssigneeID, task.ID, err)
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
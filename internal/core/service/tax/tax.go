@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
 )
 
 type Calculator struct {
@@ -18,51 +19,123 @@ func NewCalculator(db *gorm.DB) *Calculator {
 }
 
 func (c *Calculator) CalculateForCustomer(customerID uint64, amount decimal.Decimal) (decimal.Decimal, error) {
+	lines, err := c.BreakdownForCustomer(customerID, amount)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return Total(lines), nil
+}
+
+// BreakdownForCustomer returns the tax a customer pays on an amount, one
+// line for each tax rule of their region. Invoices keep the lines for the
+// tax report. Customers in a tax exempt group pay none, nor do EU
+// businesses reverse charged on their VAT number.
+func (c *Calculator) BreakdownForCustomer(customerID uint64, amount decimal.Decimal) ([]domain.InvoiceTax, error) {
 	if amount.LessThanOrEqual(decimal.Zero) {
-		return decimal.Zero, nil
+		return nil, nil
+	}
+	if exempt, err := customergroup.IsTaxExempt(c.db, customerID); err != nil || exempt {
+		return nil, err
+	}
+	if validation, err := ReverseCharge(c.db, customerID); err != nil || validation != nil {
+		return nil, err
 	}
 
 	var user domain.User
 	if err := c.db.Select("id", "country", "state").First(&user, customerID).Error; err != nil {
+		return nil, err
+	}
+
+	return c.breakdownForRegion(user.Country, user.State, amount)
+}
+
+// CalculateForCountry returns the tax on an amount in a country, before
+// the state and exemptions of a customer are known, such as for guests
+func (c *Calculator) CalculateForCountry(country string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, nil
+	}
+	lines, err := c.breakdownForRegion(country, "", amount)
+	if err != nil {
 		return decimal.Zero, err
 	}
+	return Total(lines), nil
+}
 
-	return c.calculateForRegion(user.Country, user.State, amount)
+// Total returns the tax of all lines
+func Total(lines []domain.InvoiceTax) decimal.Decimal {
+	total := decimal.Zero
+	for _, line := range lines {
+		total = total.Add(line.Amount)
+	}
+	return total
 }
 
-func (c *Calculator) calculateForRegion(country, state string, amount decimal.Decimal) (decimal.Decimal, error) {
+func (c *Calculator) breakdownForRegion(country, state string, amount decimal.Decimal) ([]domain.InvoiceTax, error) {
 	country = strings.TrimSpace(strings.ToUpper(country))
 	state = strings.TrimSpace(state)
 	if country == "" {
-		return decimal.Zero, nil
+		return nil, nil
 	}
 
 	var rules []domain.TaxRule
 	if err := c.db.Where("active = ? AND country = ? AND (state = ? OR state = '')", true, country, state).
 		Order("priority DESC, id ASC").
 		Find(&rules).Error; err != nil {
-		return decimal.Zero, err
+		return nil, err
 	}
 	if len(rules) == 0 {
-		return decimal.Zero, nil
+		return nil, nil
 	}
 
 	totalRate := decimal.Zero
 	inclusive := false
+	applied := make([]domain.TaxRule, 0, len(rules))
 	for _, rule := range rules {
 		totalRate = totalRate.Add(rule.Rate)
 		if rule.IsInclusive {
 			inclusive = true
 		}
+		if rule.Rate.GreaterThan(decimal.Zero) {
+			applied = append(applied, rule)
+		}
 	}
 
 	if totalRate.LessThanOrEqual(decimal.Zero) {
-		return decimal.Zero, nil
+		return nil, nil
 	}
 
+	// Inclusive amounts already contain the tax of every rule; the tax is
+	// split between the rules by rate and the last one takes the rest
+	net := amount
+	totalTax := amount.Mul(totalRate).Div(decimal.NewFromInt(100))
 	if inclusive {
 		rateFactor := totalRate.Div(decimal.NewFromInt(100))
-		return amount.Sub(amount.Div(decimal.NewFromInt(1).Add(rateFactor))), nil
+		net = amount.Div(decimal.NewFromInt(1).Add(rateFactor))
+		totalTax = amount.Sub(net)
+	}
+
+	lines := make([]domain.InvoiceTax, 0, len(applied))
+	remaining := totalTax
+	for i, rule := range applied {
+		tax := totalTax.Mul(rule.Rate).Div(totalRate)
+		if i == len(applied)-1 {
+			tax = remaining
+		}
+		remaining = remaining.Sub(tax)
+
+		ruleID := rule.ID
+		lines = append(lines, domain.InvoiceTax{
+			TaxRuleID:     &ruleID,
+			Name:          rule.Name,
+			Country:       country,
+			State:         rule.State,
+			TaxType:       rule.TaxType,
+			Rate:          rule.Rate,
+			IsInclusive:   inclusive,
+			TaxableAmount: net,
+			Amount:        tax,
+		})
 	}
-	return amount.Mul(totalRate).Div(decimal.NewFromInt(100)), nil
+	return lines, nil
 }
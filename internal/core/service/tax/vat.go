@@ -0,0 +1,92 @@
+package tax
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// VATCheckTTL is how long a VIES check of a VAT number holds. Customers
+// whose number was last checked longer ago pay VAT until it is checked
+// again.
+const VATCheckTTL = 24 * time.Hour
+
+// vatPrefixes are the VIES country prefixes of the EU member states by
+// ISO country code; Greece uses EL
+var vatPrefixes = map[string]string{
+	"AT": "AT", "BE": "BE", "BG": "BG", "CY": "CY", "CZ": "CZ", "DE": "DE", "DK": "DK",
+	"EE": "EE", "ES": "ES", "FI": "FI", "FR": "FR", "GR": "EL", "HR": "HR", "HU": "HU",
+	"IE": "IE", "IT": "IT", "LT": "LT", "LU": "LU", "LV": "LV", "MT": "MT", "NL": "NL",
+	"PL": "PL", "PT": "PT", "RO": "RO", "SE": "SE", "SI": "SI", "SK": "SK",
+}
+
+// VATPrefix returns the VIES prefix of VAT numbers of a country, false
+// outside the EU
+func VATPrefix(country string) (string, bool) {
+	prefix, ok := vatPrefixes[strings.ToUpper(strings.TrimSpace(country))]
+	return prefix, ok
+}
+
+// NormalizeVATNumber upper cases a VAT number and strips its spaces, dots
+// and dashes. Numbers of a customer in an EU country get its prefix when
+// they were entered without it.
+func NormalizeVATNumber(number, country string) string {
+	number = strings.ToUpper(number)
+	number = strings.NewReplacer(" ", "", ".", "", "-", "").Replace(number)
+	if number == "" {
+		return ""
+	}
+	if prefix, ok := VATPrefix(country); ok && number[0] >= '0' && number[0] <= '9' {
+		number = prefix + number
+	}
+	return number
+}
+
+// ReverseCharge returns the VIES check of the VAT number a customer is
+// reverse charged on, or nil when they pay VAT. Customers are reverse
+// charged when the seller and the customer are in different EU member
+// states and the customer's VAT number of their country was found valid
+// within VATCheckTTL.
+func ReverseCharge(db *gorm.DB, customerID uint64) (*domain.VATValidation, error) {
+	var setting domain.Setting
+	err := db.Where("key = ?", domain.SettingSellerCountry).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seller := strings.ToUpper(strings.TrimSpace(setting.Value))
+	if _, ok := VATPrefix(seller); !ok {
+		return nil, nil
+	}
+
+	var user domain.User
+	if err := db.Select("id", "country", "tax_id").First(&user, customerID).Error; err != nil {
+		return nil, err
+	}
+	country := strings.ToUpper(strings.TrimSpace(user.Country))
+	prefix, ok := VATPrefix(country)
+	if !ok || country == seller {
+		return nil, nil
+	}
+	number := NormalizeVATNumber(user.TaxID, country)
+	if !strings.HasPrefix(number, prefix) {
+		return nil, nil
+	}
+
+	var validation domain.VATValidation
+	err = db.Where("vat_number = ? AND valid = ? AND checked_at > ?", number, true, time.Now().Add(-VATCheckTTL)).
+		First(&validation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &validation, nil
+}
@@ -1,12 +1,19 @@
 package ticket
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"log"
 	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/markup"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
 )
 
 var (
@@ -14,11 +21,35 @@ var (
 	ErrTicketClosed      = errors.New("ticket is closed")
 	ErrMessageNotFound   = errors.New("message not found")
 	ErrUnauthorized      = errors.New("not authorized to access this ticket")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrCustomerNotFound   = errors.New("customer not found")
 )
 
+// renderBody renders a message body as Markdown. Only admins may use raw
+// HTML; messages of customers and other staff are sanitized strictly.
+func renderBody(body string, trusted bool) (string, error) {
+	return markup.Render(body, markup.Options{Trusted: trusted, HardWraps: true})
+}
+
+// renderLegacy renders the bodies of messages saved without HTML, such as
+// those of tickets opened by email
+func renderLegacy(ticket *domain.Ticket) {
+	for i := range ticket.Messages {
+		message := &ticket.Messages[i]
+		if message.BodyHTML != "" || message.Body == "" {
+			continue
+		}
+		if html, err := renderBody(message.Body, false); err == nil {
+			message.BodyHTML = html
+		}
+	}
+}
+
 // Service provides ticket management operations
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	files      domain.FileStore
+	quarantine *quarantine.Service
 }
 
 // NewService creates a new ticket service
@@ -26,6 +57,24 @@ func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
+// WithContext returns a copy of the service whose queries run with ctx,
+// such as the request context so slow queries are logged with its ID
+func (s *Service) WithContext(ctx context.Context) *Service {
+	clone := *s
+	clone.db = s.db.WithContext(ctx)
+	return &clone
+}
+
+// SetFileStore keeps new attachments in files instead of the database
+func (s *Service) SetFileStore(files domain.FileStore) {
+	s.files = files
+}
+
+// SetQuarantine scans new attachments for malware before they are stored
+func (s *Service) SetQuarantine(q *quarantine.Service) {
+	s.quarantine = q
+}
+
 // CreateTicket creates a new support ticket
 func (s *Service) CreateTicket(customerID *uint64, subject, body, senderEmail string, priority domain.TicketPriority, source string) (*domain.Ticket, error) {
 	if priority == "" {
@@ -43,6 +92,11 @@ func (s *Service) CreateTicket(customerID *uint64, subject, body, senderEmail st
 		Source:     source,
 	}
 
+	bodyHTML, err := renderBody(body, false)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := s.db.Create(ticket).Error; err != nil {
 		return nil, err
 	}
@@ -52,6 +106,7 @@ func (s *Service) CreateTicket(customerID *uint64, subject, body, senderEmail st
 		TicketID:    ticket.ID,
 		SenderEmail: senderEmail,
 		Body:        body,
+		BodyHTML:    bodyHTML,
 		IsStaff:     false,
 	}
 
@@ -60,6 +115,9 @@ func (s *Service) CreateTicket(customerID *uint64, subject, body, senderEmail st
 	}
 
 	ticket.Messages = append(ticket.Messages, *message)
+	if err := notification.NewService(s.db).TicketCreated(ticket); err != nil {
+		return nil, err
+	}
 	return ticket, nil
 }
 
@@ -72,6 +130,7 @@ func (s *Service) GetTicket(id uint64) (*domain.Ticket, error) {
 		}
 		return nil, err
 	}
+	renderLegacy(&ticket)
 	return &ticket, nil
 }
 
@@ -86,6 +145,7 @@ func (s *Service) GetTicketForCustomer(ticketID, customerID uint64) (*domain.Tic
 		}
 		return nil, err
 	}
+	renderLegacy(&ticket)
 	return &ticket, nil
 }
 
@@ -101,17 +161,65 @@ func (s *Service) ListTickets(customerID *uint64, status domain.TicketStatus, li
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
-	query.Count(&total)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 
 	if err := query.Order("updated_at DESC").Limit(limit).Offset(offset).Find(&tickets).Error; err != nil {
 		return nil, 0, err
 	}
 
+	if err := s.loadMessageSummaries(tickets); err != nil {
+		return nil, 0, err
+	}
+
 	return tickets, total, nil
 }
 
-// AddReply adds a reply to a ticket
-func (s *Service) AddReply(ticketID uint64, senderEmail, body string, isStaff bool, attachments []AttachmentData) (*domain.TicketMessage, error) {
+// loadMessageSummaries sets MessageCount and LastReplyStaff on a page of
+// tickets using one aggregate query instead of loading every message
+func (s *Service) loadMessageSummaries(tickets []domain.Ticket) error {
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	ids := make([]uint64, len(tickets))
+	for i, t := range tickets {
+		ids[i] = t.ID
+	}
+
+	var rows []struct {
+		TicketID       uint64
+		MessageCount   int64
+		LastReplyStaff bool
+	}
+	err := s.db.Model(&domain.TicketMessage{}).
+		Select(`ticket_messages.ticket_id, COUNT(*) AS message_count,
+			MAX(CASE WHEN ticket_messages.id = latest.id AND ticket_messages.is_staff THEN 1 ELSE 0 END) = 1 AS last_reply_staff`).
+		Joins(`JOIN (SELECT ticket_id, MAX(id) AS id FROM ticket_messages WHERE ticket_id IN ? GROUP BY ticket_id) latest
+			ON latest.ticket_id = ticket_messages.ticket_id`, ids).
+		Group("ticket_messages.ticket_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	byTicket := make(map[uint64]int, len(tickets))
+	for i, t := range tickets {
+		byTicket[t.ID] = i
+	}
+	for _, row := range rows {
+		if i, ok := byTicket[row.TicketID]; ok {
+			tickets[i].MessageCount = row.MessageCount
+			tickets[i].LastReplyStaff = row.LastReplyStaff
+		}
+	}
+	return nil
+}
+
+// AddReply adds a reply to a ticket. The body is rendered as Markdown;
+// raw HTML in it is kept only when trustedHTML is set.
+func (s *Service) AddReply(ticketID uint64, senderEmail, body string, isStaff, trustedHTML bool, attachments []AttachmentData) (*domain.TicketMessage, error) {
 	var ticket domain.Ticket
 	if err := s.db.First(&ticket, ticketID).Error; err != nil {
 		return nil, ErrTicketNotFound
@@ -121,10 +229,43 @@ func (s *Service) AddReply(ticketID uint64, senderEmail, body string, isStaff bo
 		return nil, ErrTicketClosed
 	}
 
+	// Scan every attachment before anything is saved, so a rejected
+	// file leaves no reply behind
+	var uploadedBy *uint64
+	if !isStaff {
+		uploadedBy = ticket.CustomerID
+	}
+	for i, att := range attachments {
+		r, size := att.Reader, att.Size
+		if r == nil {
+			r, size = bytes.NewReader(att.Data), int64(len(att.Data))
+		}
+		checked, err := s.quarantine.Check(context.Background(), quarantine.Upload{
+			Source:      domain.UploadSourceTicket,
+			SourceID:    ticketID,
+			UploadedBy:  uploadedBy,
+			FileName:    att.FileName,
+			ContentType: att.ContentType,
+			Reader:      r,
+			Size:        size,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer checked.Close()
+		attachments[i].Reader, attachments[i].Size = checked, checked.Size
+	}
+
+	bodyHTML, err := renderBody(body, trustedHTML)
+	if err != nil {
+		return nil, err
+	}
+
 	message := &domain.TicketMessage{
 		TicketID:    ticketID,
 		SenderEmail: senderEmail,
 		Body:        body,
+		BodyHTML:    bodyHTML,
 		IsStaff:     isStaff,
 	}
 
@@ -134,12 +275,9 @@ func (s *Service) AddReply(ticketID uint64, senderEmail, body string, isStaff bo
 
 	// Add attachments
 	for _, att := range attachments {
-		attachment := &domain.TicketAttachment{
-			TicketMessageID: message.ID,
-			FileName:        att.FileName,
-			ContentType:     att.ContentType,
-			SizeBytes:       int64(len(att.Data)),
-			Data:            att.Data,
+		attachment, err := s.storeAttachment(ticketID, message.ID, att)
+		if err != nil {
+			return nil, err
 		}
 		if err := s.db.Create(attachment).Error; err != nil {
 			return nil, err
@@ -175,6 +313,33 @@ func (s *Service) UpdateTicketPriority(ticketID uint64, priority domain.TicketPr
 		Update("priority", priority).Error
 }
 
+// AssignCustomer attaches a ticket to a customer, clearing the unknown
+// sender flag of tickets opened by email
+func (s *Service) AssignCustomer(ticketID, customerID uint64) error {
+	var count int64
+	if err := s.db.Model(&domain.User{}).
+		Where("id = ? AND role = ?", customerID, domain.UserRoleCustomer).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCustomerNotFound
+	}
+
+	result := s.db.Model(&domain.Ticket{}).Where("id = ?", ticketID).
+		Updates(map[string]interface{}{
+			"customer_id":    customerID,
+			"unknown_sender": false,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTicketNotFound
+	}
+	return nil
+}
+
 // CloseTicket closes a ticket
 func (s *Service) CloseTicket(ticketID uint64) error {
 	return s.UpdateTicketStatus(ticketID, domain.TicketStatusClosed)
@@ -192,13 +357,22 @@ func (s *Service) PutTicketOnHold(ticketID uint64) error {
 
 // DeleteTicket deletes a ticket and all its messages
 func (s *Service) DeleteTicket(ticketID uint64) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	var keys []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// Delete attachments
 		var messages []domain.TicketMessage
 		if err := tx.Where("ticket_id = ?", ticketID).Find(&messages).Error; err != nil {
 			return err
 		}
+		keys = nil
 		for _, msg := range messages {
+			var msgKeys []string
+			if err := tx.Model(&domain.TicketAttachment{}).
+				Where("ticket_message_id = ? AND storage_key <> ''", msg.ID).
+				Pluck("storage_key", &msgKeys).Error; err != nil {
+				return err
+			}
+			keys = append(keys, msgKeys...)
 			if err := tx.Delete(&domain.TicketAttachment{}, "ticket_message_id = ?", msg.ID).Error; err != nil {
 				return err
 			}
@@ -212,6 +386,20 @@ func (s *Service) DeleteTicket(ticketID uint64) error {
 		// Delete ticket
 		return tx.Delete(&domain.Ticket{}, ticketID).Error
 	})
+	if err != nil {
+		return err
+	}
+
+	// Files are removed once the rows are gone; a failure leaves an
+	// unreferenced file rather than an attachment without content
+	if s.files != nil {
+		for _, key := range keys {
+			if err := s.files.Delete(context.Background(), key); err != nil {
+				log.Printf("tickets: failed to delete attachment %s: %v", key, err)
+			}
+		}
+	}
+	return nil
 }
 
 // GetAttachment retrieves an attachment by ID
@@ -219,13 +407,87 @@ func (s *Service) GetAttachment(attachmentID uint64) (*domain.TicketAttachment,
 	var attachment domain.TicketAttachment
 	if err := s.db.First(&attachment, attachmentID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("attachment not found")
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetTicketAttachment retrieves an attachment of a message of the ticket
+func (s *Service) GetTicketAttachment(ticketID, attachmentID uint64) (*domain.TicketAttachment, error) {
+	var attachment domain.TicketAttachment
+	if err := s.db.Joins("JOIN ticket_messages ON ticket_messages.id = ticket_attachments.ticket_message_id").
+		Where("ticket_messages.ticket_id = ?", ticketID).
+		First(&attachment, "ticket_attachments.id = ?", attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
 		}
 		return nil, err
 	}
 	return &attachment, nil
 }
 
+// AttachmentURL returns a signed download URL of an attachment kept in
+// the file store, or "" for attachments still kept in the database
+func (s *Service) AttachmentURL(attachment *domain.TicketAttachment, expires time.Duration) (string, error) {
+	if attachment.StorageKey == "" || s.files == nil {
+		return "", nil
+	}
+	return s.files.SignedURL(attachment.StorageKey, attachment.FileName, expires)
+}
+
+// OpenAttachment returns the content of an attachment
+func (s *Service) OpenAttachment(ctx context.Context, attachment *domain.TicketAttachment) (io.ReadCloser, error) {
+	if attachment.StorageKey == "" {
+		return io.NopCloser(bytes.NewReader(attachment.Data)), nil
+	}
+	if s.files == nil {
+		return nil, ErrAttachmentNotFound
+	}
+	return s.files.Get(ctx, attachment.StorageKey)
+}
+
+// storeAttachment puts the content of a new attachment into the file
+// store, or into the attachment itself when there is no file store
+func (s *Service) storeAttachment(ticketID, messageID uint64, att AttachmentData) (*domain.TicketAttachment, error) {
+	attachment := &domain.TicketAttachment{
+		TicketMessageID: messageID,
+		FileName:        att.FileName,
+		ContentType:     att.ContentType,
+		Data:            []byte{},
+	}
+
+	if s.files == nil {
+		data := att.Data
+		if att.Reader != nil {
+			var err error
+			if data, err = io.ReadAll(att.Reader); err != nil {
+				return nil, err
+			}
+		}
+		attachment.Data = data
+		attachment.SizeBytes = int64(len(data))
+		return attachment, nil
+	}
+
+	key, err := domain.NewFileKey("tickets", ticketID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	r, size := att.Reader, att.Size
+	if r == nil {
+		r, size = bytes.NewReader(att.Data), int64(len(att.Data))
+	}
+	counter := &domain.CountingReader{R: r}
+	if err := s.files.Put(context.Background(), key, counter, size, att.ContentType); err != nil {
+		return nil, err
+	}
+	attachment.StorageKey = key
+	attachment.SizeBytes = counter.N
+	return attachment, nil
+}
+
 // GetTicketStats returns ticket statistics
 func (s *Service) GetTicketStats() (*TicketStats, error) {
 	stats := &TicketStats{}
@@ -289,11 +551,15 @@ func (s *Service) AssignTicketToCustomer(ticketID, customerID uint64) error {
 		Update("customer_id", customerID).Error
 }
 
-// AttachmentData represents attachment data for creating attachments
+// AttachmentData represents attachment data for creating attachments.
+// Uploads are streamed from Reader when it is set, with Size -1 when the
+// size is unknown.
 type AttachmentData struct {
 	FileName    string
 	ContentType string
 	Data        []byte
+	Reader      io.Reader
+	Size        int64
 }
 
 // TicketStats represents ticket statistics
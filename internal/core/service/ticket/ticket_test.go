@@ -0,0 +1,102 @@
+package ticket
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// The benchmarks list benchTickets tickets of benchMessages messages each
+const (
+	benchTickets  = 1000
+	benchMessages = 10
+)
+
+// BenchmarkListTickets compares counting the messages of each listed ticket
+// one ticket at a time, preloading every message, and the one aggregate
+// query ListTickets runs
+func BenchmarkListTickets(b *testing.B) {
+	db := testutil.OpenDB(b)
+
+	tickets := make([]domain.Ticket, benchTickets)
+	for i := range tickets {
+		tickets[i] = domain.Ticket{
+			Subject:  fmt.Sprintf("Ticket %d", i),
+			Status:   domain.TicketStatusOpen,
+			Priority: domain.TicketPriorityNormal,
+			Source:   "web",
+		}
+	}
+	if err := db.CreateInBatches(tickets, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+	messages := make([]domain.TicketMessage, 0, benchTickets*benchMessages)
+	for _, t := range tickets {
+		for j := 0; j < benchMessages; j++ {
+			messages = append(messages, domain.TicketMessage{
+				TicketID:    t.ID,
+				SenderEmail: "customer@example.com",
+				Body:        "A message body that listings do not show",
+				IsStaff:     j%2 == 1,
+			})
+		}
+	}
+	if err := db.CreateInBatches(messages, 500).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	service := NewService(db)
+	b.Run("per_row", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var listed []domain.Ticket
+			if err := db.Order("updated_at DESC").Limit(benchTickets).Find(&listed).Error; err != nil {
+				b.Fatal(err)
+			}
+			for j := range listed {
+				var last domain.TicketMessage
+				if err := db.Model(&domain.TicketMessage{}).Where("ticket_id = ?", listed[j].ID).
+					Count(&listed[j].MessageCount).Error; err != nil {
+					b.Fatal(err)
+				}
+				if err := db.Where("ticket_id = ?", listed[j].ID).Order("id DESC").First(&last).Error; err != nil {
+					b.Fatal(err)
+				}
+				listed[j].LastReplyStaff = last.IsStaff
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+	b.Run("preload", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var listed []domain.Ticket
+			if err := db.Preload("Messages").Order("updated_at DESC").Limit(benchTickets).Find(&listed).Error; err != nil {
+				b.Fatal(err)
+			}
+			for j := range listed {
+				listed[j].MessageCount = int64(len(listed[j].Messages))
+				listed[j].LastReplyStaff = listed[j].Messages[len(listed[j].Messages)-1].IsStaff
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+	b.Run("summaries", func(b *testing.B) {
+		queries := testutil.CountQueries(b, db)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listed, _, err := service.ListTickets(nil, "", benchTickets, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(listed) != benchTickets || listed[0].MessageCount != benchMessages || !listed[0].LastReplyStaff {
+				b.Fatalf("listed %d tickets without their message summaries", len(listed))
+			}
+		}
+		b.ReportMetric(float64(*queries)/float64(b.N), "queries/op")
+	})
+}
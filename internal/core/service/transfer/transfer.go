@@ -0,0 +1,356 @@
+package transfer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+// TransferDuration is how long a transfer code can be accepted
+const TransferDuration = 7 * 24 * time.Hour
+
+const (
+	NotificationTransferReceived  = "service_transfer_received"
+	NotificationTransferCompleted = "service_transfer_completed"
+)
+
+var (
+	ErrServiceNotFound    = errors.New("service not found")
+	ErrServiceNotActive   = errors.New("only active or suspended services can be transferred")
+	ErrServiceCancelling  = errors.New("service has an open cancellation request")
+	ErrCycleChangePending = errors.New("service has a pending billing cycle change")
+	ErrTransferPending    = errors.New("a transfer is already pending for this service")
+	ErrTransferNotFound   = errors.New("transfer not found")
+	ErrTransferInvalid    = errors.New("transfer code is invalid or has expired")
+	ErrSelfTransfer       = errors.New("service is already owned by this account")
+	ErrRecipientMismatch  = errors.New("transfer is addressed to another account")
+	ErrTransferNotPending = errors.New("transfer is no longer pending")
+	ErrOwnerChanged       = errors.New("service is no longer owned by the sender")
+	ErrCustomerNotFound   = errors.New("customer not found")
+	ErrInvalidRecipient   = errors.New("invalid recipient email")
+)
+
+// Service moves services between customer accounts. The owner pushes a
+// transfer and shares its code; the receiving account accepts it.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new transfer service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// --- Sending ---
+
+// InitiateTransfer starts the transfer of a customer's service and returns
+// it with the code to share. When recipientEmail is set only that account
+// can accept, and it is notified if it exists.
+func (s *Service) InitiateTransfer(customerID, serviceID uint64, recipientEmail string) (*domain.ServiceTransfer, error) {
+	service, err := s.customerService(customerID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkService(service); err != nil {
+		return nil, err
+	}
+
+	var pending int64
+	if err := s.db.Model(&domain.ServiceTransfer{}).
+		Where("service_id = ? AND status = ? AND expires_at > ?", serviceID, domain.ServiceTransferStatusPending, time.Now()).
+		Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrTransferPending
+	}
+
+	recipientEmail = strings.ToLower(strings.TrimSpace(recipientEmail))
+	var recipient *domain.User
+	if recipientEmail != "" {
+		if !strings.Contains(recipientEmail, "@") {
+			return nil, ErrInvalidRecipient
+		}
+		var user domain.User
+		result := s.db.Where("LOWER(email) = ?", recipientEmail).Limit(1).Find(&user)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			if user.ID == customerID {
+				return nil, ErrSelfTransfer
+			}
+			recipient = &user
+		}
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := &domain.ServiceTransfer{
+		ServiceID:      serviceID,
+		FromCustomerID: customerID,
+		RecipientEmail: recipientEmail,
+		Code:           code,
+		Status:         domain.ServiceTransferStatusPending,
+		ExpiresAt:      time.Now().Add(TransferDuration),
+	}
+	if err := s.db.Create(transfer).Error; err != nil {
+		return nil, err
+	}
+
+	if recipient != nil {
+		title := "Service transfer waiting"
+		message := fmt.Sprintf("A %s service is being transferred to your account. Accept it with code %s before %s.",
+			service.Product.Name, code, transfer.ExpiresAt.Format("Jan 2, 2006"))
+		if err := notification.NewService(s.db).SendNotification(recipient.ID, NotificationTransferReceived, title, message, "/client/services/transfer"); err != nil {
+			log.Printf("failed to notify recipient of transfer %d: %v", transfer.ID, err)
+		}
+	}
+
+	transfer.Service = *service
+	return transfer, nil
+}
+
+// ListOutgoing returns the transfers a customer has started
+func (s *Service) ListOutgoing(customerID uint64) ([]domain.ServiceTransfer, error) {
+	var transfers []domain.ServiceTransfer
+	err := s.db.Preload("Service.Product").
+		Where("from_customer_id = ?", customerID).
+		Order("created_at DESC").Find(&transfers).Error
+	return transfers, err
+}
+
+// CancelTransfer withdraws a pending transfer started by a customer
+func (s *Service) CancelTransfer(customerID, transferID uint64) error {
+	result := s.db.Model(&domain.ServiceTransfer{}).
+		Where("id = ? AND from_customer_id = ? AND status = ?", transferID, customerID, domain.ServiceTransferStatusPending).
+		Update("status", domain.ServiceTransferStatusCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTransferNotFound
+	}
+	return nil
+}
+
+// --- Receiving ---
+
+// GetTransferByCode returns the pending transfer a customer can accept with
+// a code, so the service can be reviewed before accepting it
+func (s *Service) GetTransferByCode(customerID uint64, code string) (*domain.ServiceTransfer, error) {
+	var transfer domain.ServiceTransfer
+	result := s.db.Preload("Service.Product").Preload("FromCustomer").
+		Where("code = ?", normalizeCode(code)).Limit(1).Find(&transfer)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !transfer.IsValid() {
+		return nil, ErrTransferInvalid
+	}
+	if err := s.checkRecipient(&transfer, customerID); err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// AcceptTransfer moves the service of a transfer to the accepting customer.
+// Invoices already issued stay with the sender, except unpaid ones billing
+// the service alone for periods that have not started yet, which move over
+// with it. Renewals invoiced from then on go to the new owner.
+func (s *Service) AcceptTransfer(customerID uint64, code string) (*domain.ServiceTransfer, error) {
+	transfer, err := s.GetTransferByCode(customerID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &transfer.Service
+	if service.CustomerID != transfer.FromCustomerID {
+		return nil, ErrOwnerChanged
+	}
+	if err := s.checkService(service); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The status guard keeps a code from being accepted twice
+		result := tx.Model(&domain.ServiceTransfer{}).
+			Where("id = ? AND status = ?", transfer.ID, domain.ServiceTransferStatusPending).
+			Updates(map[string]interface{}{
+				"status":         domain.ServiceTransferStatusAccepted,
+				"to_customer_id": customerID,
+				"accepted_at":    &now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransferNotPending
+		}
+
+		if err := tx.Model(&domain.Service{}).Where("id = ?", service.ID).
+			Update("customer_id", customerID).Error; err != nil {
+			return err
+		}
+
+		moved := tx.Model(&domain.Invoice{}).
+			Where("customer_id = ? AND status IN ?", transfer.FromCustomerID,
+				[]domain.InvoiceStatus{domain.InvoiceStatusDraft, domain.InvoiceStatusUnpaid}).
+			Where("id IN (?)", tx.Model(&domain.InvoiceItem{}).Select("invoice_id").
+				Where("service_id = ? AND period_start >= ?", service.ID, now)).
+			Where("id NOT IN (?)", tx.Model(&domain.InvoiceItem{}).Select("invoice_id").
+				Where("service_id IS NULL OR service_id <> ? OR period_start IS NULL OR period_start < ?", service.ID, now)).
+			Update("customer_id", customerID)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		transfer.MovedInvoices = int(moved.RowsAffected)
+		return tx.Model(&domain.ServiceTransfer{}).Where("id = ?", transfer.ID).
+			Update("moved_invoices", transfer.MovedInvoices).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.Status = domain.ServiceTransferStatusAccepted
+	transfer.ToCustomerID = &customerID
+	transfer.AcceptedAt = &now
+	service.CustomerID = customerID
+
+	var recipient domain.User
+	s.db.First(&recipient, customerID)
+	notifier := notification.NewService(s.db)
+	title := fmt.Sprintf("%s transferred", service.Product.Name)
+	message := fmt.Sprintf("Your %s service #%d has been transferred to %s. Invoices issued before the transfer stay on your account.",
+		service.Product.Name, service.ID, recipient.Email)
+	if err := notifier.SendNotification(transfer.FromCustomerID, NotificationTransferCompleted, title, message, "/client/services"); err != nil {
+		log.Printf("failed to notify sender of transfer %d: %v", transfer.ID, err)
+	}
+	message = fmt.Sprintf("The %s service #%d from %s is now on your account.",
+		service.Product.Name, service.ID, transfer.FromCustomer.Email)
+	if err := notifier.SendNotification(customerID, NotificationTransferCompleted, title, message, fmt.Sprintf("/client/services/%d", service.ID)); err != nil {
+		log.Printf("failed to notify recipient of transfer %d: %v", transfer.ID, err)
+	}
+
+	return transfer, nil
+}
+
+// --- Admin ---
+
+// ListTransfers returns transfers, newest first
+func (s *Service) ListTransfers(status domain.ServiceTransferStatus, limit, offset int) ([]domain.ServiceTransfer, int64, error) {
+	var transfers []domain.ServiceTransfer
+	var total int64
+
+	query := s.db.Model(&domain.ServiceTransfer{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Preload("Service.Product").Preload("FromCustomer").Preload("ToCustomer").
+		Order("created_at DESC").Limit(limit).Offset(offset).Find(&transfers).Error; err != nil {
+		return nil, 0, err
+	}
+	return transfers, total, nil
+}
+
+// checkService checks that a service can change owner
+func (s *Service) checkService(service *domain.Service) error {
+	if service.Status != domain.ServiceStatusActive && service.Status != domain.ServiceStatusSuspended {
+		return ErrServiceNotActive
+	}
+
+	var cancelling int64
+	if err := s.db.Model(&domain.CancellationRequest{}).
+		Where("service_id = ? AND status IN ?", service.ID,
+			[]domain.CancellationStatus{domain.CancellationStatusPending, domain.CancellationStatusApproved}).
+		Count(&cancelling).Error; err != nil {
+		return err
+	}
+	if cancelling > 0 {
+		return ErrServiceCancelling
+	}
+
+	var changing int64
+	if err := s.db.Model(&domain.CycleChange{}).
+		Where("service_id = ? AND status = ?", service.ID, domain.CycleChangeStatusPending).
+		Count(&changing).Error; err != nil {
+		return err
+	}
+	if changing > 0 {
+		return ErrCycleChangePending
+	}
+	return nil
+}
+
+// checkRecipient checks that a customer can accept a transfer
+func (s *Service) checkRecipient(transfer *domain.ServiceTransfer, customerID uint64) error {
+	if transfer.FromCustomerID == customerID {
+		return ErrSelfTransfer
+	}
+	if transfer.RecipientEmail == "" {
+		return nil
+	}
+
+	var customer domain.User
+	result := s.db.Select("id", "email").Where("id = ?", customerID).Limit(1).Find(&customer)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCustomerNotFound
+	}
+	if !strings.EqualFold(customer.Email, transfer.RecipientEmail) {
+		return ErrRecipientMismatch
+	}
+	return nil
+}
+
+// customerService loads a service of a customer with its product
+func (s *Service) customerService(customerID, serviceID uint64) (*domain.Service, error) {
+	var service domain.Service
+	result := s.db.Preload("Product").Where("id = ? AND customer_id = ?", serviceID, customerID).Limit(1).Find(&service)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return &service, nil
+}
+
+// generateCode returns a random transfer code grouped for reading aloud,
+// e.g. 3F9A-C21B-77E0-54DD
+func generateCode() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	raw := strings.ToUpper(hex.EncodeToString(bytes))
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeCode accepts codes typed in lower case, with spaces or without
+// dashes
+func normalizeCode(code string) string {
+	raw := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	if len(raw) != 16 {
+		return raw
+	}
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+}
@@ -0,0 +1,562 @@
+package trial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/core/service/numbering"
+	"github.com/openhost/openhost/internal/core/service/product"
+	"github.com/openhost/openhost/internal/core/service/stock"
+)
+
+var (
+	ErrTrialNotAvailable     = errors.New("free trial is not available for this product")
+	ErrTrialLimitReached     = errors.New("free trial limit reached for this product")
+	ErrPaymentMethodRequired = errors.New("a payment method is required to start this trial")
+	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	ErrTrialNotFound         = errors.New("trial not found")
+	ErrTrialNotActive        = errors.New("trial is not active")
+	ErrProductNotFound       = errors.New("product not found")
+	ErrInvalidDays           = errors.New("trial days must be greater than 0")
+)
+
+// ReminderBefore is how long before the end of a trial the customer is
+// reminded that it expires
+const ReminderBefore = 3 * 24 * time.Hour
+
+// Notification types sent to customers during a trial
+const (
+	NotificationTrialExpiring = "trial_expiring"
+	NotificationTrialEnded    = "trial_ended"
+)
+
+// Service manages free trials of products configured with a
+// FreeTrialConfig
+type Service struct {
+	db     *gorm.DB
+	paused func() bool
+}
+
+// NewService creates a new trial service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetPause sets a check that holds Monitor back while it returns true,
+// such as during maintenance. Reminders and trials that came due are
+// handled on the next run.
+func (s *Service) SetPause(paused func() bool) {
+	s.paused = paused
+}
+
+// --- Configuration ---
+
+// GetConfig returns the trial configuration of a product. Products without
+// one get a disabled configuration with the default settings.
+func (s *Service) GetConfig(productID uint64) (*domain.FreeTrialConfig, error) {
+	var config domain.FreeTrialConfig
+	result := s.db.Where("product_id = ?", productID).Limit(1).Find(&config)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &domain.FreeTrialConfig{
+			ProductID:        productID,
+			Days:             7,
+			LimitPerCustomer: 1,
+			AutoActivate:     true,
+			ConvertToService: true,
+		}, nil
+	}
+	return &config, nil
+}
+
+// SetConfig creates or updates the trial configuration of a product
+func (s *Service) SetConfig(productID uint64, settings Settings) (*domain.FreeTrialConfig, error) {
+	if settings.Days <= 0 {
+		return nil, ErrInvalidDays
+	}
+	if settings.LimitPerCustomer < 0 {
+		settings.LimitPerCustomer = 0
+	}
+
+	var p domain.Product
+	result := s.db.Select("id").Limit(1).Find(&p, productID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	var config domain.FreeTrialConfig
+	result = s.db.Where("product_id = ?", productID).Limit(1).Find(&config)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		config = domain.FreeTrialConfig{ProductID: productID}
+		if err := s.db.Create(&config).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Updated with a map so false and zero values are written over the
+	// column defaults
+	if err := s.db.Model(&config).Updates(map[string]interface{}{
+		"enabled":            settings.Enabled,
+		"days":               settings.Days,
+		"require_payment":    settings.RequirePayment,
+		"limit_per_customer": settings.LimitPerCustomer,
+		"auto_activate":      settings.AutoActivate,
+		"convert_to_service": settings.ConvertToService,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return s.GetConfig(productID)
+}
+
+// --- Trials ---
+
+// StartTrial signs a customer up for a free trial of a product. A
+// zero-amount order and a service due at the end of the trial are created.
+func (s *Service) StartTrial(customerID, productID uint64, req StartRequest) (*domain.ProductTrial, error) {
+	var p domain.Product
+	result := s.db.Select("id", "active", "restricted").Limit(1).Find(&p, productID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrProductNotFound
+	}
+	visible, err := customergroup.CanSee(s.db, customerID, &p)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrProductNotFound
+	}
+
+	config, err := s.GetConfig(productID)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled || !p.Active {
+		return nil, ErrTrialNotAvailable
+	}
+
+	if config.LimitPerCustomer > 0 {
+		var taken int64
+		if err := s.db.Model(&domain.ProductTrial{}).
+			Where("customer_id = ? AND product_id = ?", customerID, productID).
+			Count(&taken).Error; err != nil {
+			return nil, err
+		}
+		if int(taken) >= config.LimitPerCustomer {
+			return nil, ErrTrialLimitReached
+		}
+	}
+
+	paymentMethodID, err := s.paymentMethod(customerID, req.PaymentMethodID, config.RequirePayment)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.BillingCycle == "" {
+		req.BillingCycle = "monthly"
+	}
+	if req.Currency == "" {
+		req.Currency = "USD"
+	}
+	price, err := product.NewService(s.db).GetProductPricing(productID, req.BillingCycle, nil, 1, req.Currency, customerID)
+	if err != nil {
+		if err == product.ErrProductNotFound {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	endsAt := now.AddDate(0, 0, config.Days)
+
+	orderStatus := domain.OrderStatusPending
+	serviceStatus := domain.ServiceStatusPending
+	if config.AutoActivate {
+		orderStatus = domain.OrderStatusActive
+		serviceStatus = domain.ServiceStatusActive
+	}
+
+	// The trial is recorded at the price it converts to and discounted in
+	// full
+	itemTotal := price.SetupFee.Add(price.RecurringFee)
+	order := &domain.Order{
+		CustomerID: customerID,
+		Status:     orderStatus,
+		Currency:   req.Currency,
+		Subtotal:   itemTotal,
+		Discount:   itemTotal,
+		TaxAmount:  decimal.Zero,
+		Total:      decimal.Zero,
+		IPAddress:  req.IPAddress,
+		Notes:      fmt.Sprintf("Free trial (%d days)", config.Days),
+		Items: []domain.OrderItem{
+			{
+				ProductID:     productID,
+				Description:   fmt.Sprintf("%s - free trial", price.ProductName),
+				Quantity:      1,
+				BillingCycle:  req.BillingCycle,
+				SetupFee:      price.SetupFee,
+				RecurringFee:  price.RecurringFee,
+				Discount:      itemTotal,
+				Total:         decimal.Zero,
+				ConfigOptions: domain.JSONMap{},
+				Domain:        req.Domain,
+				Hostname:      req.Hostname,
+			},
+		},
+	}
+
+	trial := &domain.ProductTrial{
+		CustomerID:      customerID,
+		ProductID:       productID,
+		PaymentMethodID: paymentMethodID,
+		Status:          domain.TrialStatusActive,
+		EndsAt:          endsAt,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Trials take a unit of stock like any other order
+		stockService := stock.NewService(tx)
+		if err := stockService.Reserve(productID, 1); err != nil {
+			return err
+		}
+		if config.AutoActivate {
+			if err := stockService.Commit(productID, 1); err != nil {
+				return err
+			}
+		}
+
+		number, err := numbering.NewService(tx).Next(domain.NumberKindOrder, now)
+		if err != nil {
+			return err
+		}
+		order.OrderNumber = number
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		service := &domain.Service{
+			CustomerID:       customerID,
+			ProductID:        productID,
+			OrderID:          &order.ID,
+			Status:           serviceStatus,
+			Domain:           req.Domain,
+			Hostname:         req.Hostname,
+			BillingCycle:     req.BillingCycle,
+			Currency:         req.Currency,
+			RecurringAmount:  price.RecurringFee,
+			NextDueDate:      endsAt,
+			RegistrationDate: now,
+			ConfigSelection:  domain.JSONMap{},
+			PluginConfig:     domain.PluginConfig{},
+		}
+		if err := tx.Create(service).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&order.Items[0]).Update("service_id", service.ID).Error; err != nil {
+			return err
+		}
+
+		trial.OrderID = order.ID
+		trial.ServiceID = service.ID
+		return tx.Create(trial).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AutoActivate {
+		if err := notification.NewService(s.db).SendWelcomeEmail(trial.ServiceID); err != nil &&
+			err != notification.ErrWelcomeEmailNotFound {
+			log.Printf("failed to queue welcome email for trial %d: %v", trial.ID, err)
+		}
+	}
+
+	return s.GetTrial(trial.ID)
+}
+
+// GetTrial retrieves a trial by ID
+func (s *Service) GetTrial(id uint64) (*domain.ProductTrial, error) {
+	var trial domain.ProductTrial
+	if err := s.db.Preload("Product").Preload("Service").First(&trial, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTrialNotFound
+		}
+		return nil, err
+	}
+	return &trial, nil
+}
+
+// ListTrials lists trials, optionally for a single customer (customerID 0
+// lists every customer) and status
+func (s *Service) ListTrials(customerID uint64, status domain.TrialStatus, limit, offset int) ([]domain.ProductTrial, int64, error) {
+	var trials []domain.ProductTrial
+	var total int64
+
+	query := s.db.Model(&domain.ProductTrial{})
+	if customerID > 0 {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Preload("Product").Preload("Customer").Order("created_at DESC").
+		Limit(limit).Offset(offset).Find(&trials).Error; err != nil {
+		return nil, 0, err
+	}
+	return trials, total, nil
+}
+
+// CancelTrial ends an active trial of a customer without converting it.
+// The trial service is cancelled.
+func (s *Service) CancelTrial(customerID, trialID uint64) error {
+	trial, err := s.GetTrial(trialID)
+	if err != nil {
+		return err
+	}
+	if trial.CustomerID != customerID {
+		return ErrTrialNotFound
+	}
+	if !trial.IsActive() {
+		return ErrTrialNotActive
+	}
+	return s.end(trial, domain.TrialStatusCancelled, time.Now())
+}
+
+// --- Lifecycle ---
+
+// SendReminders notifies customers whose trials end within ReminderBefore.
+// Each trial is reminded once.
+func (s *Service) SendReminders(now time.Time) (int, error) {
+	var trials []domain.ProductTrial
+	if err := s.db.Preload("Product").Preload("Customer").
+		Where("status = ? AND reminder_sent_at IS NULL AND ends_at <= ?", domain.TrialStatusActive, now.Add(ReminderBefore)).
+		Find(&trials).Error; err != nil {
+		return 0, err
+	}
+
+	notifier := notification.NewService(s.db)
+	sent := 0
+	for i := range trials {
+		trial := &trials[i]
+		if err := s.db.Model(trial).Update("reminder_sent_at", &now).Error; err != nil {
+			return sent, err
+		}
+
+		converts := s.converts(trial.ProductID)
+		title := fmt.Sprintf("Your %s trial ends soon", trial.Product.Name)
+		message := fmt.Sprintf("Your free trial of %s ends on %s.", trial.Product.Name, trial.EndsAt.Format("Jan 2, 2006"))
+		if converts {
+			message += " It will then continue as a paid service and your first invoice will be issued."
+		} else {
+			message += " The service will be cancelled when it ends."
+		}
+		link := fmt.Sprintf("/client/services/%d", trial.ServiceID)
+		if err := notifier.SendNotification(trial.CustomerID, NotificationTrialExpiring, title, message, link); err != nil {
+			log.Printf("failed to send trial reminder for trial %d: %v", trial.ID, err)
+		}
+		if err := notifier.SendEmail(NotificationTrialExpiring, trial.Customer.Email, map[string]interface{}{
+			"ProductName": trial.Product.Name,
+			"EndsAt":      trial.EndsAt.Format("Jan 2, 2006"),
+			"Converts":    converts,
+			"ServiceID":   trial.ServiceID,
+		}); err != nil && err != notification.ErrTemplateNotFound {
+			log.Printf("failed to email trial reminder for trial %d: %v", trial.ID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// ProcessExpired ends trials that reached their end date. Trials of
+// products set to convert continue as paid services with their first
+// invoice due at the end of the trial, the others are cancelled.
+func (s *Service) ProcessExpired(now time.Time) (int, error) {
+	var trials []domain.ProductTrial
+	if err := s.db.Preload("Product").
+		Where("status = ? AND ends_at <= ?", domain.TrialStatusActive, now).
+		Find(&trials).Error; err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for i := range trials {
+		trial := &trials[i]
+		var err error
+		if s.converts(trial.ProductID) {
+			err = s.convert(trial, now)
+		} else {
+			err = s.end(trial, domain.TrialStatusExpired, now)
+		}
+		if err != nil {
+			log.Printf("failed to end trial %d: %v", trial.ID, err)
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// Monitor sends reminders and ends expired trials on the given interval
+// until ctx is cancelled
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.paused == nil || !s.paused() {
+			now := time.Now()
+			if n, err := s.SendReminders(now); err != nil {
+				log.Printf("failed to send trial reminders: %v", err)
+			} else if n > 0 {
+				log.Printf("sent %d trial reminder(s)", n)
+			}
+			if n, err := s.ProcessExpired(now); err != nil {
+				log.Printf("failed to process expired trials: %v", err)
+			} else if n > 0 {
+				log.Printf("ended %d trial(s)", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// convert turns a trial into a paid service by issuing its first invoice
+func (s *Service) convert(trial *domain.ProductTrial, now time.Time) error {
+	var service domain.Service
+	if err := s.db.Preload("Product").First(&service, trial.ServiceID).Error; err != nil {
+		return err
+	}
+
+	inv, err := invoice.NewService(s.db).CreateServiceRenewalInvoice(&service, trial.EndsAt)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Model(trial).Updates(map[string]interface{}{
+		"status":       domain.TrialStatusConverted,
+		"converted_at": &now,
+		"invoice_id":   inv.ID,
+	}).Error; err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("Your %s trial has ended", trial.Product.Name)
+	message := fmt.Sprintf("Your free trial of %s has ended and continues as a paid service. Invoice %s is due on %s.",
+		trial.Product.Name, inv.InvoiceNumber, inv.DueDate.Format("Jan 2, 2006"))
+	link := fmt.Sprintf("/client/invoices/%d", inv.ID)
+	if err := notification.NewService(s.db).SendNotification(trial.CustomerID, NotificationTrialEnded, title, message, link); err != nil {
+		log.Printf("failed to notify conversion of trial %d: %v", trial.ID, err)
+	}
+	return nil
+}
+
+// end closes a trial with the given status and cancels its service
+func (s *Service) end(trial *domain.ProductTrial, status domain.TrialStatus, now time.Time) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Service{}).Where("id = ?", trial.ServiceID).Updates(map[string]interface{}{
+			"status":           domain.ServiceStatusCancelled,
+			"termination_date": &now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(trial).Update("status", status).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if status == domain.TrialStatusExpired {
+		title := fmt.Sprintf("Your %s trial has ended", trial.Product.Name)
+		message := fmt.Sprintf("Your free trial of %s has ended and the service was cancelled.", trial.Product.Name)
+		if err := notification.NewService(s.db).SendNotification(trial.CustomerID, NotificationTrialEnded, title, message, "/client/services"); err != nil {
+			log.Printf("failed to notify end of trial %d: %v", trial.ID, err)
+		}
+	}
+	return nil
+}
+
+// converts reports whether trials of a product continue as paid services
+func (s *Service) converts(productID uint64) bool {
+	config, err := s.GetConfig(productID)
+	if err != nil {
+		return true
+	}
+	return config.ConvertToService
+}
+
+// paymentMethod resolves the payment method a trial is started with. The
+// customer's default method is used when none is given.
+func (s *Service) paymentMethod(customerID uint64, id *uint64, required bool) (*uint64, error) {
+	var method domain.PaymentMethod
+	query := s.db.Where("customer_id = ? AND active = ?", customerID, true)
+	if id != nil {
+		query = query.Where("id = ?", *id)
+	} else {
+		query = query.Order("is_default DESC, id")
+	}
+
+	result := query.Limit(1).Find(&method)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if id != nil {
+			return nil, ErrPaymentMethodNotFound
+		}
+		if required {
+			return nil, ErrPaymentMethodRequired
+		}
+		return nil, nil
+	}
+	return &method.ID, nil
+}
+
+// Settings are the trial settings of a product
+type Settings struct {
+	Enabled          bool
+	Days             int
+	RequirePayment   bool
+	LimitPerCustomer int
+	AutoActivate     bool
+	ConvertToService bool
+}
+
+// StartRequest holds the details of a trial signup
+type StartRequest struct {
+	BillingCycle    string
+	Currency        string
+	PaymentMethodID *uint64
+	Domain          string
+	Hostname        string
+	IPAddress       string
+}
@@ -0,0 +1,305 @@
+// Package vat checks the VAT numbers of EU business customers with VIES.
+// Customers with a valid number in another member state than the seller
+// are reverse charged: the tax package charges them no VAT and their
+// invoices carry the number, the check and the mandatory note. Checks are
+// cached so checkout does not query VIES every time.
+package vat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/tax"
+)
+
+var (
+	ErrInvalidVATNumber  = errors.New("VAT number is not valid")
+	ErrVATFormat         = errors.New("VAT number must be the country prefix followed by 2 to 12 letters or digits")
+	ErrCountryMismatch   = errors.New("VAT number must be issued by the country of the billing address")
+	ErrVIESUnavailable   = errors.New("the VAT number could not be checked, VIES is unavailable")
+	ErrCustomerNotFound  = errors.New("customer not found")
+	ErrInvalidSeller     = errors.New("seller country must be an EU member state")
+	ErrSellerVATMismatch = errors.New("seller VAT number must be issued by the seller country")
+)
+
+var numberFormat = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,12}$`)
+
+// cacheTTL is how long a VIES answer is reused before the number is
+// checked again. Reverse charging stops when it runs out.
+const cacheTTL = tax.VATCheckTTL
+
+// refreshAge is the age at which Monitor checks the valid numbers of
+// customers again, early enough that their reverse charge does not lapse
+// while VIES is reachable
+const refreshAge = cacheTTL / 2
+
+// Settings are the seller's country and VAT number
+type Settings struct {
+	SellerCountry   string
+	SellerVATNumber string
+}
+
+// Service checks VAT numbers
+type Service struct {
+	db      *gorm.DB
+	checker Checker
+}
+
+// NewService creates a new VAT service checking numbers with VIES
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, checker: NewVIES("")}
+}
+
+// SetChecker sets the service VAT numbers are checked with
+func (s *Service) SetChecker(checker Checker) {
+	s.checker = checker
+}
+
+// Settings returns the seller's country and VAT number
+func (s *Service) Settings() (Settings, error) {
+	var settings Settings
+	var rows []domain.Setting
+	if err := s.db.Where("key IN ?", []string{domain.SettingSellerCountry, domain.SettingSellerVATNumber}).
+		Find(&rows).Error; err != nil {
+		return settings, err
+	}
+	for _, row := range rows {
+		switch row.Key {
+		case domain.SettingSellerCountry:
+			settings.SellerCountry = row.Value
+		case domain.SettingSellerVATNumber:
+			settings.SellerVATNumber = row.Value
+		}
+	}
+	return settings, nil
+}
+
+// UpdateSettings sets the seller's country and VAT number. An empty
+// country turns reverse charging off.
+func (s *Service) UpdateSettings(settings Settings) (Settings, error) {
+	country := strings.ToUpper(strings.TrimSpace(settings.SellerCountry))
+	number := ""
+	if country != "" {
+		prefix, ok := tax.VATPrefix(country)
+		if !ok {
+			return Settings{}, ErrInvalidSeller
+		}
+		number = tax.NormalizeVATNumber(settings.SellerVATNumber, country)
+		if number != "" {
+			if !numberFormat.MatchString(number) {
+				return Settings{}, ErrVATFormat
+			}
+			if !strings.HasPrefix(number, prefix) {
+				return Settings{}, ErrSellerVATMismatch
+			}
+		}
+	}
+
+	values := []domain.Setting{
+		{Key: domain.SettingSellerCountry, Value: country, Type: "string", Group: "tax", Label: "Seller country"},
+		{Key: domain.SettingSellerVATNumber, Value: number, Type: "string", Group: "tax", Label: "Seller VAT number"},
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			setting := domain.Setting{Key: value.Key}
+			if err := tx.Where("key = ?", value.Key).
+				Assign(domain.Setting{Value: value.Value, Type: value.Type, Group: value.Group, Label: value.Label}).
+				FirstOrCreate(&setting).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{SellerCountry: country, SellerVATNumber: number}, nil
+}
+
+// Check returns the VIES check of a VAT number with its country prefix.
+// A check younger than a day is reused unless force is set. When VIES
+// cannot be reached the last check is returned, or ErrVIESUnavailable if
+// the number was never checked.
+func (s *Service) Check(ctx context.Context, number string, force bool, now time.Time) (*domain.VATValidation, error) {
+	number = tax.NormalizeVATNumber(number, "")
+	if !numberFormat.MatchString(number) {
+		return nil, ErrVATFormat
+	}
+
+	var cached domain.VATValidation
+	err := s.db.Where("vat_number = ?", number).First(&cached).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if found && !force && now.Sub(cached.CheckedAt) < cacheTTL {
+		return &cached, nil
+	}
+
+	settings, err := s.Settings()
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.checker.Check(ctx, number[:2], number[2:], settings.SellerVATNumber)
+	if err != nil {
+		log.Printf("vat: check %s: %v", number, err)
+		if found {
+			return &cached, nil
+		}
+		return nil, ErrVIESUnavailable
+	}
+
+	validation := domain.VATValidation{VATNumber: number}
+	if found {
+		validation = cached
+	}
+	validation.Valid = result.Valid
+	validation.Name = result.Name
+	validation.Address = result.Address
+	validation.ConsultationNumber = result.ConsultationNumber
+	validation.CheckedAt = now
+	if err := s.db.Save(&validation).Error; err != nil {
+		return nil, err
+	}
+	// Written explicitly so false is not replaced by the column default
+	if err := s.db.Model(&validation).Update("valid", validation.Valid).Error; err != nil {
+		return nil, err
+	}
+	return &validation, nil
+}
+
+// RefreshChecks checks again the valid VAT numbers of customers last
+// checked refreshAge or longer ago, and returns how many were checked
+func (s *Service) RefreshChecks(ctx context.Context, now time.Time) (int, error) {
+	var numbers []string
+	if err := s.db.Model(&domain.VATValidation{}).
+		Where("valid = ? AND checked_at <= ?", true, now.Add(-refreshAge)).
+		Where("vat_number IN (?)", s.db.Model(&domain.User{}).Select("tax_id")).
+		Pluck("vat_number", &numbers).Error; err != nil {
+		return 0, err
+	}
+	checked := 0
+	for _, number := range numbers {
+		if ctx.Err() != nil {
+			break
+		}
+		validation, err := s.Check(ctx, number, true, now)
+		if err != nil {
+			log.Printf("vat: refresh %s: %v", number, err)
+			continue
+		}
+		// Check keeps the last answer when VIES is unavailable
+		if validation.CheckedAt.Equal(now) {
+			checked++
+		}
+	}
+	return checked, ctx.Err()
+}
+
+// Monitor keeps the checks of customers' VAT numbers fresh on the given
+// interval
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.RefreshChecks(ctx, time.Now()); err != nil {
+			log.Printf("failed to refresh VAT number checks: %v", err)
+		} else if n > 0 {
+			log.Printf("checked %d VAT number(s) again", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetCustomerVATNumber checks the VAT number a customer gave, at checkout
+// or in their account, and stores it. An empty number removes it. Numbers
+// of EU customers must be issued by their billing country and found valid
+// by VIES; when VIES is unavailable the number is stored unchecked and
+// ErrVIESUnavailable returned, so VAT is charged until it is checked.
+// Numbers of customers outside the EU are stored as they are.
+func (s *Service) SetCustomerVATNumber(ctx context.Context, customerID uint64, number string, now time.Time) (*domain.VATValidation, error) {
+	var user domain.User
+	if err := s.db.Select("id", "country").First(&user, customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+
+	number = strings.TrimSpace(number)
+	prefix, eu := tax.VATPrefix(user.Country)
+	var validation *domain.VATValidation
+	var checkErr error
+	if number != "" && eu {
+		number = tax.NormalizeVATNumber(number, user.Country)
+		if !numberFormat.MatchString(number) {
+			return nil, ErrVATFormat
+		}
+		if !strings.HasPrefix(number, prefix) {
+			return nil, ErrCountryMismatch
+		}
+		validation, checkErr = s.Check(ctx, number, false, now)
+		if checkErr != nil && checkErr != ErrVIESUnavailable {
+			return nil, checkErr
+		}
+		if validation != nil && !validation.Valid {
+			return validation, fmt.Errorf("%w: %s", ErrInvalidVATNumber, number)
+		}
+	}
+
+	if err := s.db.Model(&domain.User{}).Where("id = ?", customerID).Update("tax_id", number).Error; err != nil {
+		return nil, err
+	}
+	return validation, checkErr
+}
+
+// CustomerVAT is a customer's VAT number with its last check
+type CustomerVAT struct {
+	VATNumber     string
+	Check         *domain.VATValidation // None when never checked
+	ReverseCharge bool
+}
+
+// Customer returns a customer's VAT number, its last check and whether
+// they are reverse charged
+func (s *Service) Customer(customerID uint64) (*CustomerVAT, error) {
+	var user domain.User
+	if err := s.db.Select("id", "tax_id").First(&user, customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+
+	result := &CustomerVAT{VATNumber: user.TaxID}
+	if user.TaxID != "" {
+		var check domain.VATValidation
+		err := s.db.Where("vat_number = ?", user.TaxID).First(&check).Error
+		if err == nil {
+			result.Check = &check
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	validation, err := tax.ReverseCharge(s.db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	result.ReverseCharge = validation != nil
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package vat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/tax"
+	"github.com/openhost/openhost/internal/testutil"
+)
+
+// stubChecker answers VAT checks without VIES, or fails when down
+type stubChecker struct {
+	down bool
+}
+
+func (c stubChecker) Check(context.Context, string, string, string) (*Result, error) {
+	if c.down {
+		return nil, errors.New("VIES unavailable")
+	}
+	return &Result{Valid: true, ConsultationNumber: "WAPIAAAAA"}, nil
+}
+
+// TestExpiredCheckChargesVAT checks that a customer whose VAT number was
+// last found valid longer ago than a check holds pays VAT until VIES
+// confirms the number again
+func TestExpiredCheckChargesVAT(t *testing.T) {
+	db := testutil.OpenDB(t)
+	now := time.Now()
+
+	if err := db.Create(&domain.Setting{Key: domain.SettingSellerCountry, Value: "DE", Type: "string", Group: "tax"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	customer := &domain.User{Email: "business@example.com", PasswordHash: "x", Role: domain.UserRoleCustomer,
+		Status: domain.UserStatusActive, Country: "FR", TaxID: "FR12345678901"}
+	if err := db.Create(customer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&domain.VATValidation{VATNumber: customer.TaxID, Valid: true, CheckedAt: now.Add(-cacheTTL - time.Hour)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	reverseCharged := func() bool {
+		t.Helper()
+		validation, err := tax.ReverseCharge(db, customer.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return validation != nil
+	}
+	if reverseCharged() {
+		t.Error("customer with an expired check is reverse charged")
+	}
+
+	service := NewService(db)
+	service.SetChecker(stubChecker{down: true})
+	if n, err := service.RefreshChecks(context.Background(), now); err != nil || n != 0 {
+		t.Errorf("refresh while VIES is down checked %d numbers, %v", n, err)
+	}
+	if reverseCharged() {
+		t.Error("customer is reverse charged on the expired check while VIES is down")
+	}
+
+	service.SetChecker(stubChecker{})
+	if n, err := service.RefreshChecks(context.Background(), now); err != nil || n != 1 {
+		t.Fatalf("refresh checked %d numbers, %v, want 1", n, err)
+	}
+	if !reverseCharged() {
+		t.Error("customer is not reverse charged after their number was checked again")
+	}
+}
@@ -0,0 +1,111 @@
+package vat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultVIESURL is the VAT number check of the VIES REST API of the
+// European Commission
+const DefaultVIESURL = "https://ec.europa.eu/taxation_customs/vies/rest-api/check-vat-number"
+
+// viesTimeout bounds a check so a slow VIES does not hold up checkout
+const viesTimeout = 15 * time.Second
+
+// Result is the answer of VIES about a VAT number
+type Result struct {
+	Valid              bool
+	Name               string
+	Address            string
+	ConsultationNumber string // Only given when the requester's number is sent
+}
+
+// Checker checks VAT numbers. Country is the VIES prefix, number the
+// number without it; the requester is the seller's VAT number, if any.
+type Checker interface {
+	Check(ctx context.Context, country, number, requester string) (*Result, error)
+}
+
+// VIES checks VAT numbers with the VIES REST API
+type VIES struct {
+	url    string
+	client *http.Client
+}
+
+// NewVIES creates a client of the VIES API at url, DefaultVIESURL when
+// empty
+func NewVIES(url string) *VIES {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		url = DefaultVIESURL
+	}
+	return &VIES{url: url, client: &http.Client{Timeout: viesTimeout}}
+}
+
+// Check asks VIES whether a VAT number is valid
+func (v *VIES) Check(ctx context.Context, country, number, requester string) (*Result, error) {
+	body := map[string]string{"countryCode": country, "vatNumber": number}
+	if len(requester) > 2 {
+		body["requesterMemberStateCode"] = requester[:2]
+		body["requesterNumber"] = requester[2:]
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vies: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("vies: %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+
+	var result struct {
+		Valid             bool   `json:"valid"`
+		Name              string `json:"name"`
+		Address           string `json:"address"`
+		RequestIdentifier string `json:"requestIdentifier"`
+		ErrorWrappers     []struct {
+			Error string `json:"error"`
+		} `json:"errorWrappers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("vies: %w", err)
+	}
+	// Member state services being down is reported with a 200
+	if len(result.ErrorWrappers) > 0 {
+		return nil, fmt.Errorf("vies: %s", result.ErrorWrappers[0].Error)
+	}
+	return &Result{
+		Valid:              result.Valid,
+		Name:               cleanTrader(result.Name),
+		Address:            cleanTrader(result.Address),
+		ConsultationNumber: result.RequestIdentifier,
+	}, nil
+}
+
+// cleanTrader drops the "---" VIES gives for details a member state does
+// not share
+func cleanTrader(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "---" {
+		return ""
+	}
+	return value
+}
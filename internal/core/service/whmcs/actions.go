@@ -0,0 +1,237 @@
+package whmcs
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/ticket"
+)
+
+var (
+	ErrClientNotFound  = errors.New("client not found")
+	ErrInvalidClient   = errors.New("first name, last name and email are required")
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrInvalidTicket   = errors.New("subject and message are required")
+	ErrTicketSender    = errors.New("a client ID or name and email are required")
+)
+
+// --- AddClient ---
+
+// AddClient creates a customer account. A random password is set when
+// none is given.
+func (s *Service) AddClient(details ClientDetails) (*domain.User, error) {
+	details.Email = strings.TrimSpace(details.Email)
+	details.FirstName = strings.TrimSpace(details.FirstName)
+	details.LastName = strings.TrimSpace(details.LastName)
+	if details.Email == "" || details.FirstName == "" || details.LastName == "" {
+		return nil, ErrInvalidClient
+	}
+
+	password := details.Password
+	if password == "" {
+		generated, err := generateToken(16)
+		if err != nil {
+			return nil, err
+		}
+		password = generated
+	}
+
+	// Legal documents are accepted by the customer, not the integration
+	user, err := auth.NewService(s.db).Register(details.Email, password, details.FirstName, details.LastName, "", nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"company":     details.Company,
+		"address1":    details.Address1,
+		"address2":    details.Address2,
+		"city":        details.City,
+		"state":       details.State,
+		"postal_code": details.PostalCode,
+		"country":     strings.ToUpper(details.Country),
+		"phone":       details.Phone,
+	}
+	if details.Language != "" {
+		updates["language"] = details.Language
+	}
+	if details.Currency != "" {
+		updates["currency"] = strings.ToUpper(details.Currency)
+	}
+	if err := s.db.Model(user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// --- GetClientsProducts ---
+
+// ListClientServices returns services with the product group and custom
+// field values WHMCS includes for each product
+func (s *Service) ListClientServices(filter ServiceFilter, limit, offset int) ([]ClientService, int64, error) {
+	if filter.ClientID != 0 {
+		var count int64
+		if err := s.db.Model(&domain.User{}).Where("id = ?", filter.ClientID).Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		if count == 0 {
+			return nil, 0, ErrClientNotFound
+		}
+	}
+
+	query := s.db.Model(&domain.Service{})
+	if filter.ClientID != 0 {
+		query = query.Where("customer_id = ?", filter.ClientID)
+	}
+	if filter.ServiceID != 0 {
+		query = query.Where("id = ?", filter.ServiceID)
+	}
+	if filter.ProductID != 0 {
+		query = query.Where("product_id = ?", filter.ProductID)
+	}
+	if filter.Domain != "" {
+		query = query.Where("domain = ?", filter.Domain)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var services []domain.Service
+	if err := query.Preload("Product").Preload("Order").Preload("Server").Preload("IPAddress").
+		Order("id ASC").Limit(limit).Offset(offset).Find(&services).Error; err != nil {
+		return nil, 0, err
+	}
+
+	groupIDs := make([]uint64, 0, len(services))
+	for _, service := range services {
+		groupIDs = append(groupIDs, service.Product.ProductGroupID)
+	}
+	var groups []domain.ProductGroup
+	if len(groupIDs) > 0 {
+		if err := s.db.Where("id IN ?", groupIDs).Find(&groups).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	groupNames := make(map[uint64]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	fields := customfield.NewService(s.db)
+	result := make([]ClientService, 0, len(services))
+	for _, service := range services {
+		values, err := fields.GetServiceValues(service.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, ClientService{
+			Service:      service,
+			GroupName:    groupNames[service.Product.ProductGroupID],
+			CustomFields: values,
+		})
+	}
+	return result, total, nil
+}
+
+// --- AddInvoicePayment ---
+
+// AddInvoicePayment records a payment against an invoice. A zero amount
+// pays the outstanding balance.
+func (s *Service) AddInvoicePayment(invoiceID uint64, amount decimal.Decimal, gateway, transactionID string) (*domain.Transaction, error) {
+	var inv domain.Invoice
+	if err := s.db.First(&inv, invoiceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, err
+	}
+	if amount.IsZero() {
+		amount = inv.Balance
+	}
+	return invoice.NewService(s.db).AddPayment(inv.ID, amount, gateway, transactionID)
+}
+
+// --- OpenTicket ---
+
+// OpenTicket opens a support ticket for a customer or for a guest given by
+// name and email
+func (s *Service) OpenTicket(details TicketDetails) (*domain.Ticket, error) {
+	if strings.TrimSpace(details.Subject) == "" || strings.TrimSpace(details.Message) == "" {
+		return nil, ErrInvalidTicket
+	}
+
+	var customerID *uint64
+	senderEmail := strings.TrimSpace(details.Email)
+	if details.ClientID != 0 {
+		var user domain.User
+		result := s.db.Limit(1).Find(&user, details.ClientID)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrClientNotFound
+		}
+		customerID = &user.ID
+		senderEmail = user.Email
+	} else if senderEmail == "" || strings.TrimSpace(details.Name) == "" {
+		return nil, ErrTicketSender
+	}
+
+	return ticket.NewService(s.db).CreateTicket(customerID, details.Subject, details.Message, senderEmail, details.Priority, "api")
+}
+
+// ClientDetails are the fields of a customer created through AddClient
+type ClientDetails struct {
+	FirstName  string
+	LastName   string
+	Email      string
+	Password   string
+	Company    string
+	Address1   string
+	Address2   string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+	Phone      string
+	Language   string
+	Currency   string
+}
+
+// ServiceFilter narrows down the services returned by GetClientsProducts
+type ServiceFilter struct {
+	ClientID  uint64
+	ServiceID uint64
+	ProductID uint64
+	Domain    string
+	Username  string
+}
+
+// ClientService is a service with the details GetClientsProducts returns
+type ClientService struct {
+	Service      domain.Service
+	GroupName    string
+	CustomFields []customfield.ServiceValue
+}
+
+// TicketDetails are the fields of a ticket opened through OpenTicket
+type TicketDetails struct {
+	ClientID uint64
+	Name     string
+	Email    string
+	Subject  string
+	Message  string
+	Priority domain.TicketPriority
+}
@@ -0,0 +1,161 @@
+package whmcs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var (
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	ErrCredentialNotFound   = errors.New("API credential not found")
+	ErrNotStaff             = errors.New("API credentials can only be issued to admins and staff")
+)
+
+// credentialPermission marks API keys issued for the WHMCS compatible API
+const credentialPermission = "whmcs_api"
+
+// Service maps the most common WHMCS API actions onto OpenHost so existing
+// integrations keep working during a migration. Integrations authenticate
+// with an API identifier and secret; WHMCS admin username and MD5 password
+// authentication is not supported.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new WHMCS compatibility service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// --- Credentials ---
+
+// CreateCredential issues an API identifier and secret acting as a staff
+// user. The secret is only returned here, a hash is stored.
+func (s *Service) CreateCredential(userID uint64, name string) (*Credential, error) {
+	var user domain.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Role != domain.UserRoleAdmin && user.Role != domain.UserRoleStaff {
+		return nil, ErrNotStaff
+	}
+
+	identifier, err := generateToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := generateToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "WHMCS API"
+	}
+	key := &domain.APIKey{
+		UserID:  userID,
+		Name:    name,
+		KeyHash: hashCredential(identifier, secret),
+		Permissions: domain.JSONMap{
+			credentialPermission: true,
+			"identifier":         identifier,
+		},
+		Active: true,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, err
+	}
+
+	return &Credential{Key: *key, Identifier: identifier, Secret: secret}, nil
+}
+
+// ListCredentials returns the API credentials issued for the WHMCS
+// compatible API
+func (s *Service) ListCredentials() ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	if err := s.db.Preload("User").Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	credentials := make([]domain.APIKey, 0, len(keys))
+	for _, key := range keys {
+		if isCredential(&key) {
+			credentials = append(credentials, key)
+		}
+	}
+	return credentials, nil
+}
+
+// RevokeCredential deactivates an API credential
+func (s *Service) RevokeCredential(id uint64) error {
+	var key domain.APIKey
+	if err := s.db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCredentialNotFound
+		}
+		return err
+	}
+	if !isCredential(&key) {
+		return ErrCredentialNotFound
+	}
+	return s.db.Model(&key).Update("active", false).Error
+}
+
+// Authenticate returns the credential of an API identifier and secret with
+// the staff user it acts as
+func (s *Service) Authenticate(identifier, secret string) (*domain.APIKey, error) {
+	if identifier == "" || secret == "" {
+		return nil, ErrAuthenticationFailed
+	}
+
+	var key domain.APIKey
+	result := s.db.Preload("User").Where("key_hash = ?", hashCredential(identifier, secret)).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || !isCredential(&key) || !key.IsValid() {
+		return nil, ErrAuthenticationFailed
+	}
+	if key.User.Status != domain.UserStatusActive ||
+		(key.User.Role != domain.UserRoleAdmin && key.User.Role != domain.UserRoleStaff) {
+		return nil, ErrAuthenticationFailed
+	}
+
+	now := time.Now()
+	s.db.Model(&key).Update("last_used_at", &now)
+	return &key, nil
+}
+
+func isCredential(key *domain.APIKey) bool {
+	enabled, _ := key.Permissions[credentialPermission].(bool)
+	return enabled
+}
+
+func hashCredential(identifier, secret string) string {
+	sum := sha256.Sum256([]byte(identifier + ":" + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken(length int) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Credential is a newly issued API credential with its secret
+type Credential struct {
+	Key        domain.APIKey
+	Identifier string
+	Secret     string
+}
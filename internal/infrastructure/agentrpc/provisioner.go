@@ -0,0 +1,167 @@
+package agentrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/agent"
+	provisionerv1 "github.com/openhost/openhost/pkg/proto/provisioner/v1"
+)
+
+// ModuleName is the provisioning module of products whose services are
+// provisioned by the agent on the server they are placed on
+const ModuleName = "agent"
+
+// Provisioner provisions services through the agent of a node. Each call
+// queues a task named after it, such as create_service, and waits for the
+// agent to finish it. The task args hold the request; the last line the
+// action prints is its result, JSON such as {"external_id": "..."} or
+// plain text taken as the message.
+type Provisioner struct {
+	agents       *agent.Service
+	nodeID       uint64
+	serviceID    *uint64
+	pollInterval time.Duration
+}
+
+// NewProvisioner creates a provisioner running tasks on a node, recorded
+// against a service
+func NewProvisioner(agents *agent.Service, nodeID uint64, serviceID *uint64) *Provisioner {
+	return &Provisioner{agents: agents, nodeID: nodeID, serviceID: serviceID, pollInterval: time.Second}
+}
+
+var _ provisionerv1.ProvisionerServiceClient = (*Provisioner)(nil)
+
+// result is what an action prints as its last line
+type result struct {
+	ExternalID string                       `json:"external_id"`
+	Message    string                       `json:"message"`
+	Metrics    []*provisionerv1.UsageMetric `json:"metrics"`
+}
+
+// credentialOptions are the server credentials of a provisioning
+// request, which the agent runs on the server itself without
+var credentialOptions = []string{"server_username", "server_password", "server_access_hash"}
+
+func (p *Provisioner) CreateService(ctx context.Context, in *provisionerv1.CreateServiceRequest, _ ...grpc.CallOption) (*provisionerv1.CreateServiceResponse, error) {
+	options := make(map[string]string, len(in.Options))
+	for key, value := range in.Options {
+		options[key] = value
+	}
+	for _, key := range credentialOptions {
+		delete(options, key)
+	}
+	res, err := p.run(ctx, "create_service", domain.JSONMap{
+		"service_id":  in.ServiceId,
+		"customer_id": in.CustomerId,
+		"package_id":  in.PackageId,
+		"options":     options,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.CreateServiceResponse{ExternalId: res.ExternalID, Message: res.Message}, nil
+}
+
+func (p *Provisioner) Suspend(ctx context.Context, in *provisionerv1.SuspendRequest, _ ...grpc.CallOption) (*provisionerv1.SuspendResponse, error) {
+	res, err := p.run(ctx, "suspend_service", domain.JSONMap{"service_id": in.ServiceId, "reason": in.Reason})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.SuspendResponse{Message: res.Message}, nil
+}
+
+func (p *Provisioner) Terminate(ctx context.Context, in *provisionerv1.TerminateRequest, _ ...grpc.CallOption) (*provisionerv1.TerminateResponse, error) {
+	res, err := p.run(ctx, "terminate_service", domain.JSONMap{"service_id": in.ServiceId, "reason": in.Reason})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.TerminateResponse{Message: res.Message}, nil
+}
+
+func (p *Provisioner) ChangePackage(ctx context.Context, in *provisionerv1.ChangePackageRequest, _ ...grpc.CallOption) (*provisionerv1.ChangePackageResponse, error) {
+	res, err := p.run(ctx, "change_package", domain.JSONMap{
+		"service_id":         in.ServiceId,
+		"current_package_id": in.CurrentPackageId,
+		"target_package_id":  in.TargetPackageId,
+		"reason":             in.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.ChangePackageResponse{Message: res.Message}, nil
+}
+
+func (p *Provisioner) PowerControl(ctx context.Context, in *provisionerv1.PowerControlRequest, _ ...grpc.CallOption) (*provisionerv1.PowerControlResponse, error) {
+	var action string
+	switch in.Action {
+	case provisionerv1.PowerAction_POWER_ACTION_START:
+		action = "start"
+	case provisionerv1.PowerAction_POWER_ACTION_STOP:
+		action = "stop"
+	case provisionerv1.PowerAction_POWER_ACTION_REBOOT:
+		action = "reboot"
+	default:
+		return nil, errors.New("unknown power action")
+	}
+	res, err := p.run(ctx, "power_control", domain.JSONMap{"service_id": in.ServiceId, "action": action})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.PowerControlResponse{Message: res.Message}, nil
+}
+
+func (p *Provisioner) GetUsage(ctx context.Context, in *provisionerv1.GetUsageRequest, _ ...grpc.CallOption) (*provisionerv1.GetUsageResponse, error) {
+	res, err := p.run(ctx, "get_usage", domain.JSONMap{"service_id": in.ServiceId})
+	if err != nil {
+		return nil, err
+	}
+	return &provisionerv1.GetUsageResponse{Metrics: res.Metrics, Message: res.Message}, nil
+}
+
+// run queues a task and waits for it to finish. A task still queued when
+// ctx ends is left to run or expire.
+func (p *Provisioner) run(ctx context.Context, action string, args domain.JSONMap) (*result, error) {
+	task, err := p.agents.Enqueue(p.nodeID, agent.TaskRequest{Action: action, Args: args, ServiceID: p.serviceID})
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for !task.Status.Finished() {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("agent task %d: %w", task.ID, ctx.Err())
+		case <-ticker.C:
+		}
+		if task, err = p.agents.GetTask(task.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	switch task.Status {
+	case domain.AgentTaskStatusExpired:
+		return nil, fmt.Errorf("agent task %d expired before node %d picked it up", task.ID, p.nodeID)
+	case domain.AgentTaskStatusFailed:
+		message := task.Error
+		if message == "" {
+			message = "failed"
+		}
+		return nil, fmt.Errorf("agent task %d: %s", task.ID, message)
+	}
+
+	var res result
+	output := strings.TrimSpace(task.Output)
+	if err := json.Unmarshal([]byte(output), &res); err != nil {
+		res = result{Message: output}
+	}
+	return &res, nil
+}
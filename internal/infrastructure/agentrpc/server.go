@@ -0,0 +1,316 @@
+// Package agentrpc serves the gRPC API node agents connect to, the panel
+// half of the agent provisioning channel. Agents register with an
+// enrollment token, then authenticate with their node token as a bearer
+// token in the call metadata.
+package agentrpc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/agent"
+	agentv1 "github.com/openhost/openhost/pkg/proto/agent/v1"
+)
+
+const (
+	// DefaultPollInterval is how often open task streams look for new
+	// tasks
+	DefaultPollInterval = 2 * time.Second
+	// tasksPerPoll bounds the tasks sent to a node at a time
+	tasksPerPoll = 10
+)
+
+// Server answers node agents
+type Server struct {
+	agents       *agent.Service
+	pollInterval time.Duration
+}
+
+// NewServer creates the agent API server
+func NewServer(agents *agent.Service) *Server {
+	return &Server{agents: agents, pollInterval: DefaultPollInterval}
+}
+
+// SetPollInterval sets how often open task streams look for new tasks
+func (s *Server) SetPollInterval(interval time.Duration) {
+	if interval > 0 {
+		s.pollInterval = interval
+	}
+}
+
+var _ agentv1.AgentServiceServer = (*Server)(nil)
+
+// Listen serves the agent API on addr until ctx is done. Without a
+// certificate the API is served in plaintext, which only suits a private
+// network or a TLS terminating proxy in front of it.
+func (s *Server) Listen(ctx context.Context, addr, certFile, keyFile string) error {
+	opts := []grpc.ServerOption{
+		// Agents ping every 30 seconds to notice a dead task stream
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             15 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	if certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		log.Printf("agent API on %s is served without TLS; set agent.cert_file and agent.key_file", addr)
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer(opts...)
+	agentv1.RegisterAgentServiceServer(server, s)
+
+	go s.sweep(ctx)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	return server.Serve(lis)
+}
+
+// sweep marks the servers of silent nodes offline and fails the tasks
+// their agents stopped reporting on
+func (s *Server) sweep(ctx context.Context) {
+	ticker := time.NewTicker(agent.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.agents.MarkOffline(); err != nil {
+			log.Printf("failed to mark silent nodes offline: %v", err)
+		}
+		if _, err := s.agents.FailLost(); err != nil {
+			log.Printf("failed to fail lost agent tasks: %v", err)
+		}
+	}
+}
+
+// Register trades an enrollment token for a node token
+func (s *Server) Register(_ context.Context, in *agentv1.RegisterRequest) (*agentv1.RegisterResponse, error) {
+	node, token, err := s.agents.Register(in.EnrollmentToken, nodeInfo(in.Hostname, in.Version, in.Os, in.Arch, in.Capacity))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	publicKey, err := s.agents.PublicKey()
+	if err != nil {
+		log.Printf("failed to load the agent signing key: %v", err)
+		return nil, status.Error(codes.Internal, "signing key unavailable")
+	}
+	log.Printf("agent registered for node %d (%s)", node.ID, node.Hostname)
+	return &agentv1.RegisterResponse{
+		NodeId:           node.ID,
+		NodeToken:        token,
+		SigningKey:       publicKey,
+		HeartbeatSeconds: int32(agent.HeartbeatInterval / time.Second),
+	}, nil
+}
+
+// Heartbeat records the capacity and health of a node
+func (s *Server) Heartbeat(ctx context.Context, in *agentv1.HeartbeatRequest) (*agentv1.HeartbeatResponse, error) {
+	node, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := nodeInfo(node.Hostname, in.Version, node.OS, node.Arch, in.Capacity)
+	var health agent.Health
+	if in.Health != nil {
+		health = agent.Health{
+			Load1:           in.Health.Load1,
+			MemoryUsedBytes: in.Health.MemoryUsedBytes,
+			DiskUsedBytes:   in.Health.DiskUsedBytes,
+			UptimeSeconds:   in.Health.UptimeSeconds,
+		}
+	}
+	if err := s.agents.Heartbeat(node, info, health); err != nil {
+		return nil, toStatus(err)
+	}
+	return &agentv1.HeartbeatResponse{HeartbeatSeconds: int32(agent.HeartbeatInterval / time.Second)}, nil
+}
+
+// Tasks streams the tasks queued for a node, signed, until the agent
+// disconnects. Tasks sent on an earlier stream but never started are
+// sent again.
+func (s *Server) Tasks(_ *agentv1.TasksRequest, stream agentv1.AgentService_TasksServer) error {
+	ctx := stream.Context()
+	node, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := s.agents.SigningKey()
+	if err != nil {
+		log.Printf("failed to load the agent signing key: %v", err)
+		return status.Error(codes.Internal, "signing key unavailable")
+	}
+	if err := s.agents.Requeue(node.ID); err != nil {
+		return toStatus(err)
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Checked on every poll so a disabled node stops getting tasks
+		if _, err := s.authenticate(ctx); err != nil {
+			return err
+		}
+		tasks, err := s.agents.NextTasks(node.ID, tasksPerPoll)
+		if err != nil {
+			return toStatus(err)
+		}
+		for i := range tasks {
+			task, err := signedTask(&tasks[i], key)
+			if err != nil {
+				return toStatus(err)
+			}
+			if err := stream.Send(task); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report records the log lines and result of the tasks an agent runs.
+// The first report on a task marks it running.
+func (s *Server) Report(stream agentv1.AgentService_ReportServer) error {
+	node, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	started := make(map[uint64]bool)
+	for {
+		report, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&agentv1.ReportResponse{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !started[report.TaskId] {
+			if err := s.agents.StartTask(node.ID, report.TaskId); err != nil {
+				return toStatus(err)
+			}
+			started[report.TaskId] = true
+		}
+		lines := make([]agent.LogLine, 0, len(report.Lines))
+		for _, line := range report.Lines {
+			if line == nil {
+				continue
+			}
+			lines = append(lines, agent.LogLine{Stream: line.Stream, Text: line.Text, Time: unixTime(line.Time)})
+		}
+		if err := s.agents.AppendLogs(node.ID, report.TaskId, lines); err != nil {
+			return toStatus(err)
+		}
+		if report.Done {
+			if err := s.agents.FinishTask(node.ID, report.TaskId, report.Success, report.Output, report.Error); err != nil {
+				return toStatus(err)
+			}
+		}
+	}
+}
+
+// authenticate returns the node of the bearer token a call carries
+func (s *Server) authenticate(ctx context.Context) (*domain.AgentNode, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+	}
+	node, err := s.agents.Authenticate(token)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return node, nil
+}
+
+// signedTask turns a queued task into the message sent to the agent and
+// signs it
+func signedTask(task *domain.AgentTask, key ed25519.PrivateKey) (*agentv1.Task, error) {
+	args, err := json.Marshal(task.Args)
+	if err != nil {
+		return nil, err
+	}
+	issued := time.Now()
+	if task.SentAt != nil {
+		issued = *task.SentAt
+	}
+	msg := &agentv1.Task{
+		Id:             task.ID,
+		NodeId:         task.NodeID,
+		Action:         task.Action,
+		Args:           args,
+		IssuedAt:       issued.Unix(),
+		ExpiresAt:      task.ExpiresAt.Unix(),
+		TimeoutSeconds: int32(task.TimeoutSeconds),
+	}
+	msg.Signature = ed25519.Sign(key, msg.SigningPayload())
+	return msg, nil
+}
+
+func nodeInfo(hostname, version, os, arch string, capacity *agentv1.Capacity) agent.NodeInfo {
+	info := agent.NodeInfo{Hostname: hostname, Version: version, OS: os, Arch: arch}
+	if capacity != nil {
+		info.CPUCores = int(capacity.CpuCores)
+		info.MemoryBytes = capacity.MemoryBytes
+		info.DiskBytes = capacity.DiskBytes
+	}
+	return info
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// toStatus maps agent service errors to gRPC status codes
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, agent.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, agent.ErrNodeDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, agent.ErrTaskNotFound), errors.Is(err, agent.ErrNodeNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, agent.ErrTaskFinished):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, agent.ErrInvalidNodeInfo):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("agent API: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
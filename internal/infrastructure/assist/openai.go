@@ -0,0 +1,187 @@
+// Package assist connects AI assist to language models behind the
+// domain.CompletionProvider interface.
+package assist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// Providers
+const (
+	ProviderOpenAI = "openai"
+	ProviderLocal  = "local"
+)
+
+const (
+	// DefaultOpenAIURL is the API of OpenAI
+	DefaultOpenAIURL = "https://api.openai.com/v1"
+	// DefaultLocalURL is the OpenAI compatible API of Ollama; llama.cpp,
+	// vLLM and LM Studio serve the same API on their own ports
+	DefaultLocalURL = "http://127.0.0.1:11434/v1"
+
+	defaultOpenAIModel = "gpt-4o-mini"
+	defaultTimeout     = 60 * time.Second
+)
+
+var (
+	ErrUnknownProvider = errors.New("assist provider must be openai or local")
+	ErrMissingAPIKey   = errors.New("openai assist provider needs an api_key")
+	ErrMissingModel    = errors.New("local assist provider needs a model")
+)
+
+// New creates the provider of the configuration, or returns nil when AI
+// assist is not configured
+func New(cfg config.AssistConfig) (domain.CompletionProvider, error) {
+	timeout := defaultTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case ProviderOpenAI:
+		if cfg.APIKey == "" {
+			return nil, ErrMissingAPIKey
+		}
+		return NewOpenAI(ProviderOpenAI, firstNonEmpty(cfg.BaseURL, DefaultOpenAIURL), cfg.APIKey,
+			firstNonEmpty(cfg.Model, defaultOpenAIModel), timeout), nil
+	case ProviderLocal:
+		if cfg.Model == "" {
+			return nil, ErrMissingModel
+		}
+		return NewOpenAI(ProviderLocal, firstNonEmpty(cfg.BaseURL, DefaultLocalURL), cfg.APIKey, cfg.Model, timeout), nil
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
+// OpenAI generates text with the chat completions API of OpenAI or of a
+// compatible server
+type OpenAI struct {
+	name    string
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAI creates a client of the chat completions API at baseURL, such
+// as "https://api.openai.com/v1". apiKey may be empty for local servers.
+func NewOpenAI(name, baseURL, apiKey, model string, timeout time.Duration) *OpenAI {
+	return &OpenAI{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *OpenAI) Name() string {
+	return p.name
+}
+
+type chatRequest struct {
+	Model       string               `json:"model"`
+	Messages    []domain.ChatMessage `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens,omitempty"`
+	Temperature float64              `json:"temperature"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message domain.ChatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAI) Complete(ctx context.Context, req domain.CompletionRequest) (*domain.CompletionResponse, error) {
+	payload, err := json.Marshal(chatRequest{
+		Model:       p.model,
+		Messages:    req.Messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	var result chatResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s: %s", p.name, resp.Status, truncate(strings.TrimSpace(string(body)), 200))
+		}
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != nil {
+		message := resp.Status
+		if result.Error != nil {
+			message = result.Error.Message
+		}
+		return nil, fmt.Errorf("%s: %s", p.name, message)
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("%s: no completion returned", p.name)
+	}
+
+	return &domain.CompletionResponse{
+		Content:          strings.TrimSpace(result.Choices[0].Message.Content),
+		Model:            firstNonEmpty(result.Model, p.model),
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,617 @@
+// Package backup dumps the database and attachment directories into
+// compressed, optionally encrypted archives on local disk or S3, rotates
+// them by age and restores them.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+)
+
+var (
+	ErrUnsupportedDestination = errors.New("backup destination must be local or s3")
+	ErrInvalidType            = errors.New("backup type must be database, files or full")
+	ErrInvalidSchedule        = errors.New("invalid backup schedule")
+	ErrConfigNotFound         = errors.New("backup configuration not found")
+	ErrRestorePointNotFound   = errors.New("restore point not found")
+	ErrBackupRunning          = errors.New("a backup of this configuration is already running")
+	ErrEncryptionKeyRequired  = errors.New("an encryption key is required, set backup.encryption_key or OPENHOST_BACKUP_KEY")
+	ErrDatabaseMismatch       = errors.New("backup was taken from a different database type")
+)
+
+// Backup types
+const (
+	TypeDatabase = "database"
+	TypeFiles    = "files"
+	TypeFull     = "full"
+)
+
+// Backup log statuses
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+const (
+	dirPerm  = 0o750
+	filePerm = 0o600
+
+	manifestName   = "manifest.json"
+	sqliteDumpName = "database.sqlite"
+	pgDumpName     = "database.sql"
+	filesPrefix    = "files/"
+)
+
+// KeyEnv overrides the configured encryption key
+const KeyEnv = "OPENHOST_BACKUP_KEY"
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	ConfigID  uint64    `json:"config_id"`
+	Type      string    `json:"type"`
+	Database  string    `json:"database,omitempty"` // sqlite or postgres
+	Paths     []string  `json:"paths,omitempty"`    // Directory of files/<index>/
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service provides backup operations
+type Service struct {
+	db       *gorm.DB
+	database config.DatabaseConfig
+	dir      string
+	paths    []string
+	key      []byte
+
+	mu      sync.Mutex
+	running map[uint64]bool
+}
+
+// NewService creates a backup service for the configured database and
+// attachment directories. Local backups and temporary files go below the
+// backup directory.
+func NewService(db *gorm.DB, cfg config.Config) *Service {
+	dir := cfg.Backup.Directory
+	if dir == "" {
+		dir = "./data/backups"
+	}
+	s := &Service{
+		db:       db,
+		database: cfg.Database,
+		dir:      dir,
+		paths:    cfg.Backup.Paths,
+		running:  make(map[uint64]bool),
+	}
+	// Uploaded files kept on local disk are always backed up
+	if cfg.Storage.Driver == storage.DriverLocal || cfg.Storage.Driver == "" {
+		filesDir := cfg.Storage.Directory
+		if filesDir == "" {
+			filesDir = storage.DefaultDirectory
+		}
+		if !slices.Contains(s.paths, filesDir) {
+			s.paths = append(slices.Clone(s.paths), filesDir)
+		}
+	}
+
+	key := os.Getenv(KeyEnv)
+	if key == "" {
+		key = cfg.Backup.EncryptionKey
+	}
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		s.key = sum[:]
+	}
+	return s
+}
+
+// Encrypted reports whether new backups are encrypted
+func (s *Service) Encrypted() bool {
+	return s.key != nil
+}
+
+// --- Configurations ---
+
+// ListConfigs returns all backup configurations
+func (s *Service) ListConfigs() ([]domain.BackupConfig, error) {
+	var configs []domain.BackupConfig
+	err := s.db.Order("name").Find(&configs).Error
+	return configs, err
+}
+
+// GetConfig returns a backup configuration
+func (s *Service) GetConfig(id uint64) (*domain.BackupConfig, error) {
+	var config domain.BackupConfig
+	if err := s.db.First(&config, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConfigNotFound
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+// SaveConfig validates and creates or updates a backup configuration
+func (s *Service) SaveConfig(config *domain.BackupConfig) error {
+	switch config.Type {
+	case TypeDatabase, TypeFiles, TypeFull:
+	default:
+		return ErrInvalidType
+	}
+	if config.Destination == "" {
+		config.Destination = DestinationLocal
+	}
+	if _, err := s.storageFor(config); err != nil {
+		return err
+	}
+	// Backups leaving the server must not be readable by the storage provider
+	if config.Destination == DestinationS3 && s.key == nil {
+		return ErrEncryptionKeyRequired
+	}
+	if config.Schedule != "" {
+		if _, err := parseSchedule(config.Schedule); err != nil {
+			return err
+		}
+	}
+	if config.Retention <= 0 {
+		config.Retention = 7
+	}
+	return s.db.Save(config).Error
+}
+
+// DeleteConfig deletes a backup configuration and its logs. Backup files
+// are kept.
+func (s *Service) DeleteConfig(id uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("backup_config_id = ?", id).Delete(&domain.BackupLog{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&domain.BackupConfig{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConfigNotFound
+		}
+		return nil
+	})
+}
+
+// --- Backups ---
+
+// Start begins a backup in the background and returns its log
+func (s *Service) Start(configID uint64) (*domain.BackupLog, error) {
+	config, entry, err := s.begin(configID)
+	if err != nil {
+		return nil, err
+	}
+	started := *entry
+	go s.execute(context.Background(), config, entry)
+	return &started, nil
+}
+
+// Run makes a backup and waits for it to finish
+func (s *Service) Run(ctx context.Context, configID uint64) (*domain.BackupLog, error) {
+	config, entry, err := s.begin(configID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.execute(ctx, config, entry); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// begin marks a configuration as running and logs the start of a backup
+func (s *Service) begin(configID uint64) (*domain.BackupConfig, *domain.BackupLog, error) {
+	config, err := s.GetConfig(configID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	if s.running[configID] {
+		s.mu.Unlock()
+		return nil, nil, ErrBackupRunning
+	}
+	s.running[configID] = true
+	s.mu.Unlock()
+
+	entry := &domain.BackupLog{
+		BackupConfigID: configID,
+		Status:         StatusRunning,
+		StartedAt:      time.Now(),
+	}
+	if err := s.db.Create(entry).Error; err != nil {
+		s.release(configID)
+		return nil, nil, err
+	}
+	return config, entry, nil
+}
+
+func (s *Service) release(configID uint64) {
+	s.mu.Lock()
+	delete(s.running, configID)
+	s.mu.Unlock()
+}
+
+// execute makes the backup, records the outcome and rotates old backups
+func (s *Service) execute(ctx context.Context, config *domain.BackupConfig, entry *domain.BackupLog) error {
+	defer s.release(config.ID)
+
+	name, size, err := s.backup(ctx, config, entry.StartedAt)
+
+	now := time.Now()
+	entry.CompletedAt = &now
+	entry.Status = StatusSuccess
+	entry.FilePath = name
+	entry.FileSize = size
+	if err != nil {
+		entry.Status = StatusFailed
+		entry.ErrorMsg = err.Error()
+		log.Printf("backup %q failed: %v", config.Name, err)
+	}
+	if dbErr := s.db.Save(entry).Error; dbErr != nil {
+		log.Printf("backup %q: failed to save log: %v", config.Name, dbErr)
+	}
+	if dbErr := s.db.Model(config).Updates(map[string]interface{}{
+		"last_run":    entry.StartedAt,
+		"last_status": entry.Status,
+		"last_error":  entry.ErrorMsg,
+	}).Error; dbErr != nil {
+		log.Printf("backup %q: failed to update configuration: %v", config.Name, dbErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, err := s.rotate(ctx, config, now); err != nil {
+		log.Printf("backup %q: rotation failed: %v", config.Name, err)
+	} else if n > 0 {
+		log.Printf("backup %q: removed %d expired backup(s)", config.Name, n)
+	}
+	return nil
+}
+
+// backup writes the archive of a configuration to its storage and returns
+// the stored name and size
+func (s *Service) backup(ctx context.Context, config *domain.BackupConfig, startedAt time.Time) (string, int64, error) {
+	store, err := s.storageFor(config)
+	if err != nil {
+		return "", 0, err
+	}
+	staging, err := s.stagingDir("backup")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.RemoveAll(staging)
+
+	name := fmt.Sprintf("openhost-%d-%s.tar.gz", config.ID, startedAt.UTC().Format("20060102-150405"))
+	if s.key != nil {
+		name += ".enc"
+	}
+	archivePath := filepath.Join(staging, name)
+	if err := s.writeArchive(ctx, config, staging, archivePath); err != nil {
+		return "", 0, err
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := store.Put(ctx, name, f, fi.Size(), "application/octet-stream"); err != nil {
+		return "", 0, err
+	}
+	return name, fi.Size(), nil
+}
+
+// writeArchive writes the manifest, the database dump and the attachment
+// files into a gzipped tar archive, encrypted when a key is configured
+func (s *Service) writeArchive(ctx context.Context, config *domain.BackupConfig, staging, path string) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var w io.Writer = out
+	var enc *encryptWriter
+	if s.key != nil {
+		if enc, err = newEncryptWriter(out, s.key); err != nil {
+			return err
+		}
+		w = enc
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := Manifest{ConfigID: config.ID, Type: config.Type, CreatedAt: time.Now()}
+	withDatabase := config.Type == TypeDatabase || config.Type == TypeFull
+	withFiles := config.Type == TypeFiles || config.Type == TypeFull
+	if withDatabase {
+		manifest.Database = s.db.Dialector.Name()
+	}
+	if withFiles {
+		manifest.Paths = s.paths
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: filePerm, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if withDatabase {
+		dump, archiveName, err := s.dumpDatabase(ctx, staging)
+		if err != nil {
+			return fmt.Errorf("database dump failed: %w", err)
+		}
+		if err := addFile(tw, dump, archiveName); err != nil {
+			return err
+		}
+		os.Remove(dump)
+	}
+
+	if withFiles {
+		for i, dir := range s.paths {
+			if err := addDirectory(ctx, tw, dir, filesPrefix+strconv.Itoa(i)); err != nil {
+				return fmt.Errorf("backup of %s failed: %w", dir, err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// dumpDatabase writes a consistent copy of the database into dir and
+// returns its path and archive name
+func (s *Service) dumpDatabase(ctx context.Context, dir string) (string, string, error) {
+	switch s.db.Dialector.Name() {
+	case "sqlite":
+		path := filepath.Join(dir, sqliteDumpName)
+		// VACUUM INTO copies the database in a single transaction
+		if err := s.db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error; err != nil {
+			return "", "", err
+		}
+		return path, sqliteDumpName, nil
+	case "postgres":
+		path := filepath.Join(dir, pgDumpName)
+		cmd := s.postgresCommand(ctx, "pg_dump", "--clean", "--if-exists", "--no-owner", "--file", path)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", "", fmt.Errorf("%w: %s", err, output)
+		}
+		return path, pgDumpName, nil
+	default:
+		return "", "", fmt.Errorf("database type %q cannot be backed up", s.db.Dialector.Name())
+	}
+}
+
+// postgresCommand runs a PostgreSQL client tool against the configured
+// database
+func (s *Service) postgresCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	pg := s.database.Postgres
+	args = append([]string{
+		"--host", pg.Host,
+		"--port", strconv.Itoa(pg.Port),
+		"--username", pg.User,
+		"--dbname", pg.Database,
+	}, args...)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+pg.Password)
+	if pg.SSLMode != "" {
+		cmd.Env = append(cmd.Env, "PGSSLMODE="+pg.SSLMode)
+	}
+	return cmd
+}
+
+func addFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// addDirectory adds the regular files below dir under prefix. A missing
+// directory is skipped, as attachment directories are created on first
+// upload.
+func addDirectory(ctx context.Context, tw *tar.Writer, dir, prefix string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return addFile(tw, path, prefix+"/"+filepath.ToSlash(rel))
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// stagingDir creates a temporary directory below the backup directory, so
+// dumps never leave the volume set aside for backups
+func (s *Service) stagingDir(kind string) (string, error) {
+	if err := os.MkdirAll(s.dir, dirPerm); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(s.dir, "."+kind+"-")
+}
+
+// rotate deletes the backups of a configuration older than its retention.
+// The newest successful backup is always kept.
+func (s *Service) rotate(ctx context.Context, config *domain.BackupConfig, now time.Time) (int, error) {
+	var newest domain.BackupLog
+	if err := s.db.Where("backup_config_id = ? AND status = ?", config.ID, StatusSuccess).
+		Order("started_at DESC").First(&newest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	cutoff := now.AddDate(0, 0, -config.Retention)
+	var expired []domain.BackupLog
+	if err := s.db.Where("backup_config_id = ? AND status <> ? AND started_at < ? AND id <> ?",
+		config.ID, StatusRunning, cutoff, newest.ID).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	store, err := s.storageFor(config)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range expired {
+		if entry.FilePath != "" {
+			if err := store.Delete(ctx, entry.FilePath); err != nil {
+				return removed, err
+			}
+		}
+		if err := s.db.Delete(&entry).Error; err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ListRestorePoints returns successful backups, newest first. A zero
+// configID lists the backups of all configurations.
+func (s *Service) ListRestorePoints(configID uint64, limit, offset int) ([]domain.BackupLog, int64, error) {
+	query := s.db.Model(&domain.BackupLog{}).Where("status = ?", StatusSuccess)
+	if configID != 0 {
+		query = query.Where("backup_config_id = ?", configID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var points []domain.BackupLog
+	err := query.Preload("BackupConfig").Order("started_at DESC").Limit(limit).Offset(offset).Find(&points).Error
+	return points, total, err
+}
+
+// --- Schedules ---
+
+// RunDue makes the backups whose schedule came due since their last run
+// and returns the number made
+func (s *Service) RunDue(ctx context.Context, now time.Time) (int, error) {
+	var configs []domain.BackupConfig
+	if err := s.db.Where("active = ? AND schedule <> ''", true).Find(&configs).Error; err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for _, config := range configs {
+		sched, err := parseSchedule(config.Schedule)
+		if err != nil {
+			log.Printf("backup %q: %v", config.Name, err)
+			continue
+		}
+		last := config.CreatedAt
+		if config.LastRun != nil {
+			last = *config.LastRun
+		}
+		next := sched.next(last.In(now.Location()))
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		// Failures are logged and recorded on the configuration
+		if _, err := s.Run(ctx, config.ID); err != nil {
+			continue
+		}
+		ran++
+	}
+	return ran, nil
+}
+
+// Monitor makes scheduled backups until ctx is cancelled
+func (s *Service) Monitor(ctx context.Context, interval time.Duration) {
+	// Backups running when the server stopped never finish
+	if err := s.db.Model(&domain.BackupLog{}).Where("status = ?", StatusRunning).
+		Updates(map[string]interface{}{"status": StatusFailed, "error_msg": "interrupted"}).Error; err != nil {
+		log.Printf("backups: failed to mark interrupted backups: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunDue(ctx, time.Now()); err != nil {
+				log.Printf("backups: schedule check failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted backups start with a magic string and a random salt, followed
+// by AES-256-GCM sealed chunks. Each chunk has a flag byte marking the
+// last chunk, so a truncated backup fails to decrypt instead of restoring
+// part of the data.
+const (
+	cryptMagic     = "OHBK1"
+	cryptSaltSize  = 32
+	cryptChunkSize = 64 * 1024
+
+	chunkMore = 0
+	chunkLast = 1
+)
+
+var (
+	ErrNotEncrypted = errors.New("backup is not encrypted")
+	ErrCorrupted    = errors.New("backup is corrupted or the encryption key is wrong")
+)
+
+// fileCipher derives the cipher of one backup from the key and its salt,
+// so nonces never repeat across backups made with the same key
+func fileCipher(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+// encryptWriter encrypts everything written to it. Close writes the last
+// chunk and must be called.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	salt := make([]byte, cryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := fileCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, cryptMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, cryptChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so the
+		// last chunk can be sealed as last on Close
+		if len(e.buf) == cryptChunkSize {
+			if err := e.seal(chunkMore); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):cryptChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(chunkLast)
+}
+
+func (e *encryptWriter) seal(flag byte) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.aead, e.counter), e.buf, []byte{flag})
+	e.counter++
+	e.buf = e.buf[:0]
+
+	header := make([]byte, 5)
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader decrypts a backup written by encryptWriter
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, key []byte) (*decryptReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(cryptMagic)+cryptSaltSize)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(cryptMagic)]) != cryptMagic {
+		return nil, ErrNotEncrypted
+	}
+	aead, err := fileCipher(key, header[len(cryptMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return fmt.Errorf("%w: truncated", ErrCorrupted)
+	}
+	flag := header[0]
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > cryptChunkSize+uint32(d.aead.Overhead()) {
+		return ErrCorrupted
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("%w: truncated", ErrCorrupted)
+	}
+	plain, err := d.aead.Open(nil, chunkNonce(d.aead, d.counter), sealed, []byte{flag})
+	if err != nil {
+		return ErrCorrupted
+	}
+	d.counter++
+	d.buf = plain
+	d.done = flag == chunkLast
+	return nil
+}
+
+// isEncrypted reports whether a backup starts with the encryption header
+func isEncrypted(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(cryptMagic))
+	return err == nil && string(magic) == cryptMagic
+}
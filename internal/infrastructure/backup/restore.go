@@ -0,0 +1,255 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// RestoreResult describes what a restore replaced
+type RestoreResult struct {
+	Manifest Manifest
+	// PreviousDatabase is where the replaced SQLite database was moved
+	PreviousDatabase string
+	Files            int
+}
+
+// GetRestorePoint returns a successful backup with its configuration
+func (s *Service) GetRestorePoint(id uint64) (*domain.BackupLog, error) {
+	var point domain.BackupLog
+	if err := s.db.Preload("BackupConfig").
+		Where("status = ?", StatusSuccess).
+		First(&point, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRestorePointNotFound
+		}
+		return nil, err
+	}
+	return &point, nil
+}
+
+// Restore restores a restore point from its storage. The server must be
+// stopped, as the database and attachment files are replaced.
+func (s *Service) Restore(ctx context.Context, id uint64) (*RestoreResult, error) {
+	point, err := s.GetRestorePoint(id)
+	if err != nil {
+		return nil, err
+	}
+	store, err := s.storageFor(&point.BackupConfig)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.Get(ctx, point.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return s.restore(ctx, r)
+}
+
+// RestoreFile restores a backup archive from a local file, for backups
+// copied from another server or made by an installation that was lost
+func (s *Service) RestoreFile(ctx context.Context, path string) (*RestoreResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.restore(ctx, f)
+}
+
+// restore unpacks the whole archive before touching anything, so a
+// corrupted or truncated backup leaves the installation as it was
+func (s *Service) restore(ctx context.Context, r io.Reader) (*RestoreResult, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if isEncrypted(br) {
+		if s.key == nil {
+			return nil, ErrEncryptionKeyRequired
+		}
+		dr, err := newDecryptReader(br, s.key)
+		if err != nil {
+			return nil, err
+		}
+		src = dr
+	}
+
+	staging, err := s.stagingDir("restore")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extract(src, staging); err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{}
+	data, err := os.ReadFile(filepath.Join(staging, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing manifest", ErrCorrupted)
+	}
+	if err := json.Unmarshal(data, &result.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest", ErrCorrupted)
+	}
+	manifest := result.Manifest
+
+	if manifest.Database != "" {
+		if manifest.Database != s.db.Dialector.Name() {
+			return nil, fmt.Errorf("%w: %s backup, %s database", ErrDatabaseMismatch, manifest.Database, s.db.Dialector.Name())
+		}
+		if err := s.restoreDatabase(ctx, staging, result); err != nil {
+			return result, fmt.Errorf("database restore failed: %w", err)
+		}
+	}
+
+	for i, dir := range manifest.Paths {
+		n, err := copyTree(filepath.Join(staging, filesPrefix+strconv.Itoa(i)), dir)
+		result.Files += n
+		if err != nil {
+			return result, fmt.Errorf("restore of %s failed: %w", dir, err)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) restoreDatabase(ctx context.Context, staging string, result *RestoreResult) error {
+	switch result.Manifest.Database {
+	case "sqlite":
+		target := s.database.SQLite.Path
+		if target == "" {
+			return errors.New("sqlite path is not configured")
+		}
+		// Keep the replaced database, a restore of the wrong backup must
+		// not lose data
+		if _, err := os.Stat(target); err == nil {
+			result.PreviousDatabase = target + ".pre-restore-" + time.Now().Format("20060102-150405")
+			if err := os.Rename(target, result.PreviousDatabase); err != nil {
+				return err
+			}
+			for _, suffix := range []string{"-wal", "-shm"} {
+				os.Rename(target+suffix, result.PreviousDatabase+suffix)
+			}
+		}
+		_, err := copyFile(filepath.Join(staging, sqliteDumpName), target)
+		return err
+	case "postgres":
+		cmd := s.postgresCommand(ctx, "psql", "--set", "ON_ERROR_STOP=1", "--single-transaction", "--quiet",
+			"--file", filepath.Join(staging, pgDumpName))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		return nil
+	default:
+		return fmt.Errorf("database type %q cannot be restored", result.Manifest.Database)
+	}
+}
+
+// extract unpacks a gzipped tar archive into dir, rejecting entries that
+// would escape it
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if errors.Is(err, ErrCorrupted) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%w: invalid entry %q", ErrCorrupted, header.Name)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// copyTree copies the files below src into dst, replacing files of the
+// same name and keeping others
+func copyTree(src, dst string) (int, error) {
+	copied := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if _, err := copyFile(path, filepath.Join(dst, rel)); err != nil {
+			return err
+		}
+		copied++
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return copied, nil
+	}
+	return copied, err
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), dirPerm); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"strings"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+)
+
+// Backup destinations
+const (
+	DestinationLocal = "local"
+	DestinationS3    = "s3"
+)
+
+// storageFor returns the storage of a backup configuration. Local backups
+// without a directory of their own go to the configured backup directory.
+// S3 backups read the bucket, region, access_key and secret_key settings,
+// and the optional endpoint of S3 compatible services, prefix and
+// path_style.
+func (s *Service) storageFor(backupConfig *domain.BackupConfig) (domain.FileStore, error) {
+	settings := backupConfig.Config
+	switch backupConfig.Destination {
+	case DestinationLocal, "":
+		dir := configString(settings, "directory")
+		if dir == "" {
+			dir = s.dir
+		}
+		return storage.NewLocal(dir, nil), nil
+	case DestinationS3:
+		pathStyle, _ := settings["path_style"].(bool)
+		return storage.NewS3(config.S3Config{
+			Endpoint:  configString(settings, "endpoint"),
+			Region:    configString(settings, "region"),
+			Bucket:    configString(settings, "bucket"),
+			Prefix:    configString(settings, "prefix"),
+			AccessKey: configString(settings, "access_key"),
+			SecretKey: configString(settings, "secret_key"),
+			PathStyle: pathStyle,
+		})
+	default:
+		return nil, ErrUnsupportedDestination
+	}
+}
+
+// configString reads a string setting of a backup configuration
+func configString(settings domain.JSONMap, key string) string {
+	if settings == nil {
+		return ""
+	}
+	value, _ := settings[key].(string)
+	return strings.TrimSpace(value)
+}
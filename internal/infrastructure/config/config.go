@@ -14,20 +14,54 @@ const filePerm = 0o600
 const dirPerm = 0o750
 
 type Config struct {
-	App      AppConfig      `json:"app"`
-	Database DatabaseConfig `json:"database"`
-	Admin    AdminConfig    `json:"admin"`
+	App             AppConfig             `json:"app"`
+	Database        DatabaseConfig        `json:"database"`
+	Admin           AdminConfig           `json:"admin"`
+	Archive         ArchiveConfig         `json:"archive"`
+	Queue           QueueConfig           `json:"queue"`
+	Backup          BackupConfig          `json:"backup"`
+	Storage         StorageConfig         `json:"storage"`
+	ServiceFiles    ServiceFilesConfig    `json:"service_files"`
+	Media           MediaConfig           `json:"media"`
+	WHMCS           WHMCSConfig           `json:"whmcs"`
+	Assist          AssistConfig          `json:"assist"`
+	Health          HealthConfig          `json:"health"`
+	Affiliate       AffiliateConfig       `json:"affiliate"`
+	Address         AddressConfig         `json:"address"`
+	GeoIP           GeoIPConfig           `json:"geoip"`
+	APILog          APILogConfig          `json:"api_log"`
+	License         LicenseConfig         `json:"license"`
+	Secrets         SecretsConfig         `json:"secrets"`
+	Headers         HeadersConfig         `json:"headers"`
+	SecurityMonitor SecurityMonitorConfig `json:"security_monitor"`
+	Sessions        SessionsConfig        `json:"sessions"`
+	TestMode        TestModeConfig        `json:"test_mode"`
+	ResponseCache   ResponseCacheConfig   `json:"response_cache"`
+	Agent           AgentConfig           `json:"agent"`
 }
 
 type AppConfig struct {
 	Name    string `json:"name"`
 	BaseURL string `json:"base_url"`
+	// TrustedProxies are the addresses and CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For header gives the client address. When
+	// unset no proxy is trusted and the header is ignored.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
 }
 
 type DatabaseConfig struct {
-	Type     string         `json:"type"`
-	SQLite   SQLiteConfig   `json:"sqlite"`
-	Postgres PostgresConfig `json:"postgres"`
+	Type     string           `json:"type"`
+	SQLite   SQLiteConfig     `json:"sqlite"`
+	Postgres PostgresConfig   `json:"postgres"`
+	Replicas []PostgresConfig `json:"replicas,omitempty"`
+	// ReplicaCheckInterval is the replica health check period in seconds.
+	ReplicaCheckInterval int `json:"replica_check_interval,omitempty"`
+	MaxOpenConns         int `json:"max_open_conns,omitempty"`
+	MaxIdleConns         int `json:"max_idle_conns,omitempty"`
+	// ConnMaxLifetime is the maximum connection age in seconds.
+	ConnMaxLifetime int `json:"conn_max_lifetime,omitempty"`
+	// SlowQueryThreshold is in milliseconds; 0 uses the default, negative disables.
+	SlowQueryThreshold int `json:"slow_query_threshold,omitempty"`
 }
 
 type SQLiteConfig struct {
@@ -48,6 +82,155 @@ type AdminConfig struct {
 	PasswordHash string `json:"password_hash"`
 }
 
+type ArchiveConfig struct {
+	Directory string `json:"directory"`
+}
+
+// QueueConfig configures the Redis backed job queue. Background jobs run
+// in-process when RedisAddr is empty.
+type QueueConfig struct {
+	RedisAddr     string `json:"redis_addr,omitempty"`
+	RedisPassword string `json:"redis_password,omitempty"`
+	RedisDB       int    `json:"redis_db,omitempty"`
+	Concurrency   int    `json:"concurrency,omitempty"`
+}
+
+// BackupConfig configures database and attachment backups. Backups are
+// encrypted with EncryptionKey, or the OPENHOST_BACKUP_KEY environment
+// variable when set.
+type BackupConfig struct {
+	// Directory holds local backups and the files of running backups
+	Directory string `json:"directory,omitempty"`
+	// Paths are the attachment directories included in file backups
+	Paths         []string `json:"paths,omitempty"`
+	EncryptionKey string   `json:"encryption_key,omitempty"`
+}
+
+// StorageConfig selects where uploaded files such as ticket and knowledge
+// base attachments are kept: a local directory or an S3 compatible bucket
+type StorageConfig struct {
+	Driver    string `json:"driver,omitempty"` // local (default) or s3
+	Directory string `json:"directory,omitempty"`
+	// SigningKey signs download URLs of local files. Without it a random
+	// key is used and URLs stop working on restart.
+	SigningKey string        `json:"signing_key,omitempty"`
+	S3         S3Config      `json:"s3"`
+	Scanner    ScannerConfig `json:"scanner"`
+}
+
+// S3Config configures an S3 bucket. Endpoint and PathStyle are set for S3
+// compatible services such as MinIO.
+type S3Config struct {
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"`
+}
+
+// ScannerConfig enables malware scanning of uploads with a ClamAV daemon,
+// given as "tcp://host:3310" or a unix socket path, or with a command that
+// reads the file on stdin and exits 1 for infected files, printing the
+// threat found.
+type ScannerConfig struct {
+	ClamAV  string `json:"clamav,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// ServiceFilesConfig limits the files customers upload to their services,
+// in megabytes. Zero uses the defaults of 25 MB per file and 100 MB per
+// service.
+type ServiceFilesConfig struct {
+	MaxFileSizeMB int `json:"max_file_size_mb,omitempty"`
+	QuotaMB       int `json:"quota_mb,omitempty"`
+}
+
+// MediaConfig controls the images of the media library. Zero values use
+// the defaults of 10 MB per upload, images scaled down to 2048 pixels and
+// thumbnails of 320 pixels. WebPCommand converts images to WebP, e.g.
+// "cwebp -quiet -q 80 {input} -o {output}"; without it no WebP variants
+// are made.
+type MediaConfig struct {
+	MaxFileSizeMB int    `json:"max_file_size_mb,omitempty"`
+	MaxDimension  int    `json:"max_dimension,omitempty"`
+	ThumbnailSize int    `json:"thumbnail_size,omitempty"`
+	WebPCommand   string `json:"webp_command,omitempty"`
+}
+
+// WHMCSConfig enables the WHMCS compatible /includes/api.php endpoint for
+// integrations migrating from WHMCS. Requests from addresses outside
+// AllowedIPs are rejected unless they pass AccessKey; an empty AllowedIPs
+// accepts any address.
+type WHMCSConfig struct {
+	Enabled    bool     `json:"enabled"`
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+	AccessKey  string   `json:"access_key,omitempty"`
+}
+
+// AssistConfig enables AI drafted ticket replies and article summaries
+// for staff. Provider is "openai", or "local" for an OpenAI compatible
+// server such as Ollama at BaseURL. Logging is "none", "metadata"
+// (default) or "full", which also keeps prompts and responses.
+type AssistConfig struct {
+	Provider       string `json:"provider,omitempty"`
+	BaseURL        string `json:"base_url,omitempty"`
+	APIKey         string `json:"api_key,omitempty"`
+	Model          string `json:"model,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	MaxTokens      int    `json:"max_tokens,omitempty"`
+	Logging        string `json:"logging,omitempty"`
+}
+
+// HealthConfig tunes the customer health score. AlertDrop is the drop in
+// points that alerts the account manager, 15 by default; falling into
+// high risk always alerts.
+type HealthConfig struct {
+	AlertDrop int `json:"alert_drop,omitempty"`
+}
+
+// AffiliateConfig tunes the affiliate program. CookieDays is how long a
+// visitor coming through an affiliate link is credited to the affiliate
+// when they sign up, 30 days by default.
+type AffiliateConfig struct {
+	CookieDays int `json:"cookie_days,omitempty"`
+}
+
+// AddressConfig sets an optional API billing addresses are normalized
+// with at checkout. Without NormalizeURL addresses are only checked
+// locally.
+type AddressConfig struct {
+	NormalizeURL string `json:"normalize_url,omitempty"`
+	APIKey       string `json:"api_key,omitempty"`
+}
+
+// GeoIPConfig sets the MaxMind DB file, such as GeoLite2-Country.mmdb,
+// visitors are located with to preselect their currency, language and the
+// country their cart's tax is estimated for. Without DatabasePath visitors
+// are not located.
+type GeoIPConfig struct {
+	DatabasePath string `json:"database_path,omitempty"`
+}
+
+// APILogConfig tunes the log of calls made with API keys. BodyLimit is how
+// many bytes of each request and response body are kept, 4096 by default.
+type APILogConfig struct {
+	Disabled  bool `json:"disabled,omitempty"`
+	BodyLimit int  `json:"body_limit,omitempty"`
+}
+
+// LicenseConfig sets the update server license keys are validated with
+// and releases are read from. Without ServerURL the installation is the
+// community edition and does not check for updates. Key is used until an
+// admin enters one; GraceDays is how long the edition is kept while the
+// server cannot be reached, 14 days by default.
+type LicenseConfig struct {
+	ServerURL string `json:"server_url,omitempty"`
+	Key       string `json:"key,omitempty"`
+	GraceDays int    `json:"grace_days,omitempty"`
+}
+
 func Exists(path string) (bool, error) {
 	if path == "" {
 		path = DefaultPath
@@ -111,3 +294,108 @@ func Load(path string) (Config, error) {
 	}
 	return cfg, nil
 }
+
+// SecretsConfig sets the key service passwords and server credentials are
+// encrypted with in the database: Key, the OPENHOST_SECRETS_KEY
+// environment variable when set, or the output of KeyCommand, which can
+// fetch it from a KMS. PreviousKeys still decrypt values until "server
+// rotate-secrets" has encrypted them with the current key. Without a key
+// credentials are stored unencrypted.
+//
+// Gateway, SMTP and provisioning credentials can instead refer to secrets
+// kept outside the database: "env:NAME" reads an environment variable and
+// "vault:path#field" a field of a HashiCorp Vault secret.
+type SecretsConfig struct {
+	Key          string      `json:"key,omitempty"`
+	KeyCommand   string      `json:"key_command,omitempty"`
+	PreviousKeys []string    `json:"previous_keys,omitempty"`
+	Vault        VaultConfig `json:"vault"`
+}
+
+// VaultConfig sets the HashiCorp Vault server secrets are read from, by
+// default the VAULT_ADDR and VAULT_TOKEN environment variables. Secrets
+// are cached for CacheSeconds, 300 by default.
+type VaultConfig struct {
+	Address      string `json:"address,omitempty"`
+	Token        string `json:"token,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	CacheSeconds int    `json:"cache_seconds,omitempty"`
+}
+
+// HeadersConfig sets the security headers of responses. CSP directives
+// replace the built-in ones of the same name, an empty list removing one;
+// themes add sources to them in their manifest. HSTSMaxAge in seconds
+// sends Strict-Transport-Security over HTTPS. FrameOptions is DENY,
+// SAMEORIGIN or "off", by default what the theme sets, else SAMEORIGIN.
+type HeadersConfig struct {
+	CSP                   map[string][]string `json:"csp,omitempty"`
+	CSPDisabled           bool                `json:"csp_disabled,omitempty"`
+	CSPReportOnly         bool                `json:"csp_report_only,omitempty"`
+	HSTSMaxAge            int                 `json:"hsts_max_age,omitempty"`
+	HSTSIncludeSubdomains bool                `json:"hsts_include_subdomains,omitempty"`
+	HSTSPreload           bool                `json:"hsts_preload,omitempty"`
+	FrameOptions          string              `json:"frame_options,omitempty"`
+}
+
+// SecurityMonitorConfig tunes the detection of brute force and abuse. An
+// address is banned for BanMinutes (60) after LoginFailures failed sign
+// ins in 15 minutes (10), PasswordResets password reset requests in an
+// hour (5), or CardDeclines declined payments in an hour (5), which also
+// bans a customer declined that often. TrustedIPs, addresses and CIDR
+// ranges, are never banned. Disabled turns the detection off; bans staff
+// make still apply.
+type SecurityMonitorConfig struct {
+	Disabled       bool     `json:"disabled,omitempty"`
+	LoginFailures  int      `json:"login_failures,omitempty"`
+	PasswordResets int      `json:"password_resets,omitempty"`
+	CardDeclines   int      `json:"card_declines,omitempty"`
+	BanMinutes     int      `json:"ban_minutes,omitempty"`
+	TrustedIPs     []string `json:"trusted_ips,omitempty"`
+}
+
+// SessionsConfig sets how long sign ins last. MaxConcurrent limits the
+// sessions of a user, signing in ending the oldest; 0 allows any number.
+// Customer and Staff set the timeouts of customers and of staff and
+// admins.
+type SessionsConfig struct {
+	MaxConcurrent int                   `json:"max_concurrent,omitempty"`
+	Customer      SessionTimeoutsConfig `json:"customer"`
+	Staff         SessionTimeoutsConfig `json:"staff"`
+}
+
+// SessionTimeoutsConfig ends a session AbsoluteHours after sign in and
+// after IdleMinutes without requests. Unset values keep the defaults: 30
+// days and no idle timeout for customers, 12 hours and 60 minutes for
+// staff. A negative IdleMinutes turns the idle timeout off.
+type SessionTimeoutsConfig struct {
+	AbsoluteHours int `json:"absolute_hours,omitempty"`
+	IdleMinutes   int `json:"idle_minutes,omitempty"`
+}
+
+// TestModeConfig makes an instance safe to run on a copy of production
+// data, such as for staging: the charges of every gateway go to its
+// sandbox and services are provisioned by the mock driver. Gateways and
+// provisioning modules can also be put in test mode one at a time.
+type TestModeConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// ResponseCacheConfig tunes the cache of the public catalog, knowledge
+// base and announcement responses. MaxAge is how many seconds browsers
+// and proxies may reuse a response, 60 by default; TTL is how many
+// seconds the server keeps one, 300 by default.
+type ResponseCacheConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+	MaxAge   int  `json:"max_age,omitempty"`
+	TTL      int  `json:"ttl,omitempty"`
+}
+
+// AgentConfig sets where node agents connect. Listen is the address of
+// the gRPC API, such as :6422, which is not served while empty. CertFile
+// and KeyFile serve it over TLS; without them it is plaintext, for a
+// private network or behind a TLS terminating proxy.
+type AgentConfig struct {
+	Listen   string `json:"listen,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
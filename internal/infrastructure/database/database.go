@@ -11,19 +11,42 @@ import (
 )
 
 func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{Logger: newQueryLogger(cfg)}
+
+	var db *gorm.DB
+	var err error
 	switch cfg.Type {
 	case "sqlite":
-		return gorm.Open(sqlite.Open(cfg.SQLite.Path), &gorm.Config{})
+		db, err = gorm.Open(sqlite.Open(cfg.SQLite.Path), gormConfig)
 	case "postgres":
 		dsn := postgresDSN(cfg.Postgres)
-		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(dsn), gormConfig)
+		if err == nil && len(cfg.Replicas) > 0 {
+			if err := useReplicas(db, cfg); err != nil {
+				return nil, fmt.Errorf("configure read replicas: %w", err)
+			}
+		}
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configurePool(db, cfg); err != nil {
+		return nil, fmt.Errorf("configure connection pool: %w", err)
+	}
+	return db, nil
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	return db.AutoMigrate(Models()...)
+}
+
+// Models returns the domain models stored in the database, in migration
+// order
+func Models() []any {
+	return []any{
 		// User & Auth
 		&domain.User{},
 		&domain.Session{},
@@ -33,16 +56,28 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.LoginAttempt{},
 		&domain.ContactEmail{},
 		&domain.AdminNote{},
+		&domain.NoteRevision{},
 		&domain.AuditLog{},
+		&domain.SecurityEvent{},
+		&domain.AbuseEvent{},
+		&domain.SecurityBan{},
+		&domain.ApprovalRequest{},
+		&domain.LegalDocument{},
+		&domain.ConsentRecord{},
+		&domain.CustomerHealth{},
 
 		// Products & Catalog
 		&domain.ProductGroup{},
 		&domain.Product{},
 		&domain.ProductPricing{},
+		&domain.PricingTier{},
+		&domain.PriceRevision{},
+		&domain.PriceRevisionItem{},
 		&domain.ConfigGroup{},
 		&domain.ProductConfigGroup{},
 		&domain.ConfigOption{},
 		&domain.ConfigSubOption{},
+		&domain.ConfigStockReservation{},
 		&domain.ProductAddon{},
 		&domain.ProductAddonAssignment{},
 		&domain.ServiceAddon{},
@@ -56,17 +91,25 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.ProductStock{},
 		&domain.ProductWelcomeEmail{},
 		&domain.FreeTrialConfig{},
+		&domain.ProductTrial{},
 
 		// Orders & Services
 		&domain.Order{},
 		&domain.OrderItem{},
 		&domain.Service{},
+		&domain.ServiceFile{},
 		&domain.Cart{},
 		&domain.CartItem{},
+		&domain.CancellationRequest{},
+		&domain.RetentionOffer{},
+		&domain.CycleChange{},
+		&domain.ServiceTransfer{},
 
 		// Billing & Payments
 		&domain.Invoice{},
 		&domain.InvoiceItem{},
+		&domain.InvoiceTax{},
+		&domain.RevenueEntry{},
 		&domain.Transaction{},
 		&domain.PaymentMethod{},
 		&domain.PaymentGatewayModule{},
@@ -76,11 +119,15 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.AutoPayment{},
 		&domain.Coupon{},
 		&domain.CouponUsage{},
+		&domain.CouponBatch{},
 		&domain.TaxRule{},
+		&domain.VATValidation{},
 		&domain.Credit{},
 		&domain.PromoCode{},
 		&domain.Quote{},
 		&domain.QuoteItem{},
+		&domain.NumberSequence{},
+		&domain.NumberCounter{},
 		&domain.OrderApproval{},
 		&domain.OrderFraudCheck{},
 		&domain.OrderNote{},
@@ -88,6 +135,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.RecurringInvoice{},
 		&domain.RecurringInvoiceItem{},
 		&domain.InvoiceMerge{},
+		&domain.PaymentPromise{},
 		&domain.DraftInvoice{},
 		&domain.DraftInvoiceItem{},
 		&domain.CreditAdjustment{},
@@ -119,14 +167,36 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.WHOISPrivacy{},
 
 		// Support
+		&domain.TicketDepartment{},
+		&domain.DepartmentMember{},
+		&domain.DepartmentHours{},
+		&domain.DepartmentHoliday{},
+		&domain.OnCallShift{},
 		&domain.Ticket{},
 		&domain.TicketMessage{},
 		&domain.TicketAttachment{},
+		&domain.TicketSLA{},
+		&domain.NetworkStatusPage{},
+		&domain.NetworkIncident{},
+		&domain.NetworkIncidentUpdate{},
+		&domain.NetworkIncidentTarget{},
 		&domain.KnowledgeBaseCategory{},
 		&domain.KnowledgeBaseArticle{},
 		&domain.KBArticleAttachment{},
 		&domain.KBArticleFeedback{},
 		&domain.KBSearchLog{},
+		&domain.KBSuggestion{},
+		&domain.AssistSetting{},
+		&domain.AssistLog{},
+		&domain.APIRequestLog{},
+		&domain.FeatureFlag{},
+		&domain.DownloadCategory{},
+		&domain.Download{},
+		&domain.DownloadLog{},
+		&domain.QuarantinedFile{},
+		&domain.MediaFile{},
+		&domain.SpamListEntry{},
+		&domain.SpamMessage{},
 
 		// Servers & Provisioning
 		&domain.Server{},
@@ -141,6 +211,10 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.ServiceProvisioningData{},
 		&domain.ProvisioningLog{},
 		&domain.ResellersConfig{},
+		&domain.AgentNode{},
+		&domain.AgentTask{},
+		&domain.AgentTaskLog{},
+		&domain.AgentSigningKey{},
 
 		// System
 		&domain.Setting{},
@@ -151,6 +225,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.PaymentGateway{},
 		&domain.CronTask{},
 		&domain.ActivityLog{},
+		&domain.AdminTask{},
 		&domain.Notification{},
 		&domain.Module{},
 		&domain.ModuleHook{},
@@ -162,6 +237,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.Translation{},
 		&domain.CustomField{},
 		&domain.CustomFieldValue{},
+		&domain.CustomFieldValueChange{},
 		&domain.SystemConfig{},
 		&domain.IPBan{},
 		&domain.CountryRestriction{},
@@ -173,6 +249,11 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.UsageTier{},
 		&domain.EmailQueue{},
 		&domain.NotificationPreference{},
+		&domain.EmailDigestPreference{},
+		&domain.EmailDigestItem{},
+		&domain.EmailSuppression{},
+		&domain.DKIMKey{},
+		&domain.EmailLink{},
 		&domain.SMSConfig{},
 		&domain.SMSMessage{},
 		&domain.WebhookConfig{},
@@ -197,6 +278,7 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.OrderAutoSettings{},
 		&domain.TicketAutoSettings{},
 		&domain.DataRetentionPolicy{},
+		&domain.LogArchive{},
 		&domain.SystemTask{},
 		&domain.DiscountRule{},
 
@@ -204,7 +286,10 @@ func AutoMigrate(db *gorm.DB) error {
 		&domain.SubUser{},
 		&domain.SubUserInvite{},
 		&domain.SubUserSession{},
-	)
+		&domain.CustomerGroup{},
+		&domain.CustomerGroupMembership{},
+		&domain.CustomerGroupPrice{},
+	}
 }
 
 func postgresDSN(cfg config.PostgresConfig) string {
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+const defaultSlowQueryThreshold = 200 * time.Millisecond
+
+// requestIDKey is the context key of the request ID of a query
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose slow queries are logged with the
+// ID of the request that issued them
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// queryLogger logs errors like the default GORM logger and reports queries
+// slower than the configured threshold together with their request ID
+type queryLogger struct {
+	logger.Interface
+	writer        logger.Writer
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+func newQueryLogger(cfg config.DatabaseConfig) logger.Interface {
+	writer := log.New(os.Stdout, "\r\n", log.LstdFlags)
+
+	threshold := defaultSlowQueryThreshold
+	switch {
+	case cfg.SlowQueryThreshold > 0:
+		threshold = time.Duration(cfg.SlowQueryThreshold) * time.Millisecond
+	case cfg.SlowQueryThreshold < 0:
+		threshold = 0
+	}
+
+	return &queryLogger{
+		// Slow queries are reported below, so the wrapped logger skips them
+		Interface: logger.New(writer, logger.Config{
+			LogLevel: logger.Warn,
+			Colorful: true,
+		}),
+		writer:        writer,
+		level:         logger.Warn,
+		slowThreshold: threshold,
+	}
+}
+
+// LogMode implements logger.Interface
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	clone.Interface = l.Interface.LogMode(level)
+	clone.level = level
+	return &clone
+}
+
+// Trace implements logger.Interface
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.Interface.Trace(ctx, begin, fc, err)
+
+	elapsed := time.Since(begin)
+	if err != nil || l.level < logger.Warn || l.slowThreshold == 0 || elapsed <= l.slowThreshold {
+		return
+	}
+
+	sql, rows := fc()
+	affected := fmt.Sprint(rows)
+	if rows == -1 {
+		affected = "-"
+	}
+	l.writer.Printf("%s SLOW SQL >= %v request_id=%s [%.3fms] [rows:%s] %s",
+		utils.FileWithLineNum(), l.slowThreshold, requestIDFromContext(ctx),
+		float64(elapsed.Nanoseconds())/1e6, affected, sql)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return "-"
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return "-"
+}
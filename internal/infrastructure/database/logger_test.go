@@ -0,0 +1,51 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestSlowQueryLogsRequestID checks that a slow query run with a request
+// context is logged with the request ID
+func TestSlowQueryLogsRequestID(t *testing.T) {
+	var out bytes.Buffer
+	writer := log.New(&out, "", 0)
+	queryLog := &queryLogger{
+		Interface:     logger.New(writer, logger.Config{LogLevel: logger.Warn}),
+		writer:        writer,
+		level:         logger.Warn,
+		slowThreshold: time.Nanosecond,
+	}
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory"), &gorm.Config{Logger: queryLog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		t.Cleanup(func() { sqlDB.Close() })
+	}
+
+	ctx := WithRequestID(context.Background(), "req-4873")
+	var n int
+	if err := db.WithContext(ctx).Raw("SELECT 1").Scan(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if line := out.String(); !strings.Contains(line, "SLOW SQL") || !strings.Contains(line, "request_id=req-4873") {
+		t.Errorf("slow query log %q has no request ID", line)
+	}
+
+	out.Reset()
+	if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if line := out.String(); !strings.Contains(line, "request_id=-") {
+		t.Errorf("slow query log %q of a query without a request", line)
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// PendingMigrations returns the tables and columns of the domain models
+// missing from the database, e.g. after a new version was deployed
+// without running its migrations
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	migrator := db.Migrator()
+
+	var pending []string
+	for _, model := range Models() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("parse model %T: %w", model, err)
+		}
+		table := stmt.Schema.Table
+
+		if !migrator.HasTable(model) {
+			pending = append(pending, "create table "+table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, "add column "+table+"."+field.DBName)
+			}
+		}
+	}
+	return pending, nil
+}
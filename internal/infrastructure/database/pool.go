@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// PoolStats describes the state of one connection pool
+type PoolStats struct {
+	Name              string `json:"name"`
+	MaxOpen           int    `json:"max_open"`
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDurationMs    int64  `json:"wait_duration_ms"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// configurePool applies the pool limits from cfg to the primary and every
+// replica pool
+func configurePool(db *gorm.DB, cfg config.DatabaseConfig) error {
+	return forEachPool(db, func(_ string, pool *sql.DB) {
+		if cfg.MaxOpenConns > 0 {
+			pool.SetMaxOpenConns(cfg.MaxOpenConns)
+		}
+		if cfg.MaxIdleConns > 0 {
+			pool.SetMaxIdleConns(cfg.MaxIdleConns)
+		}
+		if cfg.ConnMaxLifetime > 0 {
+			pool.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+		}
+	})
+}
+
+// Stats returns connection pool statistics for the primary and replicas
+func Stats(db *gorm.DB) ([]PoolStats, error) {
+	var stats []PoolStats
+	err := forEachPool(db, func(name string, pool *sql.DB) {
+		s := pool.Stats()
+		stats = append(stats, PoolStats{
+			Name:              name,
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitDurationMs:    s.WaitDuration.Milliseconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		})
+	})
+	return stats, err
+}
+
+// forEachPool calls fn for the primary pool and, when read replicas are
+// registered, for each replica pool. The primary fallback pool used by the
+// replica policy is reported as "fallback".
+func forEachPool(db *gorm.DB, fn func(name string, pool *sql.DB)) error {
+	primary, err := db.DB()
+	if err != nil {
+		return err
+	}
+	fn("primary", primary)
+
+	plugin, ok := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]
+	if !ok {
+		return nil
+	}
+	resolver, ok := plugin.(*dbresolver.DBResolver)
+	if !ok {
+		return nil
+	}
+
+	var replicas []*sql.DB
+	resolver.Call(func(connPool gorm.ConnPool) error {
+		if pool, ok := connPool.(*sql.DB); ok && pool != primary {
+			replicas = append(replicas, pool)
+		}
+		return nil
+	})
+	for i, pool := range replicas {
+		name := fmt.Sprintf("replica-%d", i+1)
+		if i == len(replicas)-1 {
+			name = "fallback"
+		}
+		fn(name, pool)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+const defaultReplicaCheckInterval = 10 * time.Second
+
+const (
+	// resolverCallback is the name dbresolver registers its callbacks under
+	resolverCallback = "gorm:db_resolver"
+	// readSetting is the statement setting dbresolver.Read stores
+	readSetting = "gorm:db_resolver:read"
+	// primaryCallback runs after the resolver to keep unmarked reads on
+	// the primary
+	primaryCallback = "openhost:primary_reads"
+)
+
+// useReplicas registers the configured read replicas
+func useReplicas(db *gorm.DB, cfg config.DatabaseConfig) error {
+	dialectors := make([]gorm.Dialector, 0, len(cfg.Replicas)+1)
+	for _, replica := range cfg.Replicas {
+		dialectors = append(dialectors, postgres.Open(postgresDSN(replica)))
+	}
+	// The primary is appended last and only serves reads while every
+	// replica is failing its health checks.
+	dialectors = append(dialectors, postgres.Open(postgresDSN(cfg.Postgres)))
+
+	interval := time.Duration(cfg.ReplicaCheckInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	return registerReplicas(db, dialectors, interval)
+}
+
+// registerReplicas routes the reads marked with dbresolver.Read, such as
+// those of listings and reports, to a healthy replica. Every other query
+// uses the primary, so a read right after a write sees it; writes, locking
+// reads and transactions always do.
+func registerReplicas(db *gorm.DB, replicas []gorm.Dialector, interval time.Duration) error {
+	primary := db.Config.ConnPool
+	policy := NewReplicaPolicy()
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   policy,
+	})
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+
+	// dbresolver sends every read to the replicas; put the reads not
+	// asking for a replica back on the primary
+	keep := keepOnPrimary(primary)
+	if err := db.Callback().Query().After(resolverCallback).Before("gorm:query").Register(primaryCallback, keep); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After(resolverCallback).Before("gorm:row").Register(primaryCallback, keep); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().After(resolverCallback).Before("gorm:raw").Register(primaryCallback, keep); err != nil {
+		return err
+	}
+
+	var pools []gorm.ConnPool
+	resolver.Call(func(pool gorm.ConnPool) error {
+		pools = append(pools, pool)
+		return nil
+	})
+	go policy.Monitor(context.Background(), pools, interval)
+	return nil
+}
+
+// keepOnPrimary returns a callback moving the statements outside
+// transactions that are not marked with dbresolver.Read to the primary
+func keepOnPrimary(primary gorm.ConnPool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if _, tx := db.Statement.ConnPool.(gorm.TxCommitter); tx {
+			return
+		}
+		if _, ok := db.Statement.Settings.Load(readSetting); !ok {
+			db.Statement.ConnPool = primary
+		}
+	}
+}
+
+// ReplicaPolicy is a dbresolver policy that rotates reads over healthy
+// replicas. The last pool it is given is treated as the primary fallback.
+type ReplicaPolicy struct {
+	mu      sync.RWMutex
+	down    map[gorm.ConnPool]bool
+	counter uint64
+}
+
+// NewReplicaPolicy creates a policy that considers every replica healthy
+// until a health check fails
+func NewReplicaPolicy() *ReplicaPolicy {
+	return &ReplicaPolicy{down: map[gorm.ConnPool]bool{}}
+}
+
+// Resolve implements dbresolver.Policy
+func (p *ReplicaPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	fallback := pools[len(pools)-1]
+	replicas := pools[:len(pools)-1]
+	if len(replicas) == 0 {
+		return fallback
+	}
+
+	start := atomic.AddUint64(&p.counter, 1)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for i := range replicas {
+		pool := replicas[(start+uint64(i))%uint64(len(replicas))]
+		if !p.down[pool] {
+			return pool
+		}
+	}
+	return fallback
+}
+
+// Check pings every pool once and updates its health. A pool that answers
+// again is put back into rotation.
+func (p *ReplicaPolicy) Check(ctx context.Context, pools []gorm.ConnPool) {
+	for _, pool := range pools {
+		pinger, ok := pool.(interface {
+			PingContext(ctx context.Context) error
+		})
+		if !ok {
+			continue
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := pinger.PingContext(pingCtx)
+		cancel()
+
+		p.mu.Lock()
+		wasDown := p.down[pool]
+		if err != nil {
+			p.down[pool] = true
+		} else {
+			delete(p.down, pool)
+		}
+		p.mu.Unlock()
+
+		switch {
+		case err != nil && !wasDown:
+			log.Printf("database replica marked unhealthy: %v", err)
+		case err == nil && wasDown:
+			log.Printf("database replica recovered, resuming reads")
+		}
+	}
+}
+
+// Monitor runs Check on the given interval until ctx is cancelled
+func (p *ReplicaPolicy) Monitor(ctx context.Context, pools []gorm.ConnPool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	p.Check(ctx, pools)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Check(ctx, pools)
+		}
+	}
+}
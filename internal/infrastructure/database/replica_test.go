@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+type replicaTestRow struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Name string
+}
+
+// TestReadAfterWriteUsesPrimary checks that only reads marked with
+// dbresolver.Read go to a replica, so a read right after a write sees it
+func TestReadAfterWriteUsesPrimary(t *testing.T) {
+	dir := t.TempDir()
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	replicaPath := filepath.Join(dir, "replica.db")
+
+	// The replica lags: it has the table but not the row written below
+	replica, err := gorm.Open(sqlite.Open(replicaPath), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.AutoMigrate(&replicaTestRow{}); err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := replica.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "primary.db")), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&replicaTestRow{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerReplicas(db, []gorm.Dialector{sqlite.Open(replicaPath)}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	row := replicaTestRow{Name: "written"}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var read replicaTestRow
+	if err := db.First(&read, row.ID).Error; err != nil {
+		t.Fatalf("read after write: %v", err)
+	}
+	if read.Name != "written" {
+		t.Errorf("read after write got %q, want %q", read.Name, "written")
+	}
+	var count int64
+	if err := db.Model(&replicaTestRow{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("count after write got %d (%v), want 1", count, err)
+	}
+	if err := db.Raw("SELECT name FROM replica_test_rows WHERE id = ?", row.ID).Scan(&read.Name).Error; err != nil || read.Name != "written" {
+		t.Errorf("raw read after write got %q (%v), want %q", read.Name, err, "written")
+	}
+
+	err = db.Clauses(dbresolver.Read).First(&replicaTestRow{}, row.ID).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("read marked for the replica got %v, want the lagging replica", err)
+	}
+}
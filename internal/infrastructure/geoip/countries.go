@@ -0,0 +1,49 @@
+package geoip
+
+import "strings"
+
+// euroCountries use the euro
+var euroCountries = []string{
+	"AD", "AT", "BE", "CY", "DE", "EE", "ES", "FI", "FR", "GR", "HR", "IE", "IT", "LT",
+	"LU", "LV", "MC", "ME", "MT", "NL", "PT", "SI", "SK", "SM", "VA", "XK",
+}
+
+// currencies are the currencies of countries not using the euro
+var currencies = map[string]string{
+	"AE": "AED", "AR": "ARS", "AU": "AUD", "BD": "BDT", "BG": "BGN", "BR": "BRL",
+	"CA": "CAD", "CH": "CHF", "CL": "CLP", "CN": "CNY", "CO": "COP", "CZ": "CZK",
+	"DK": "DKK", "EG": "EGP", "GB": "GBP", "HK": "HKD", "HU": "HUF", "ID": "IDR",
+	"IL": "ILS", "IN": "INR", "IS": "ISK", "JP": "JPY", "KR": "KRW", "LI": "CHF",
+	"MO": "MOP", "MX": "MXN", "MY": "MYR", "NG": "NGN", "NO": "NOK", "NZ": "NZD",
+	"PE": "PEN", "PH": "PHP", "PK": "PKR", "PL": "PLN", "RO": "RON", "RS": "RSD",
+	"RU": "RUB", "SA": "SAR", "SE": "SEK", "SG": "SGD", "TH": "THB", "TR": "TRY",
+	"TW": "TWD", "UA": "UAH", "US": "USD", "VN": "VND", "ZA": "ZAR",
+}
+
+// languages are the languages of countries visitors are greeted in when
+// their browser does not say. Countries not listed get the default.
+var languages = map[string]string{
+	"CN": "zh", "HK": "zh", "MO": "zh", "TW": "zh", "SG": "zh",
+	"DE": "de", "AT": "de", "LI": "de",
+	"FR": "fr", "MC": "fr",
+	"ES": "es", "MX": "es", "AR": "es", "CO": "es", "CL": "es", "PE": "es",
+	"IT": "it", "SM": "it", "VA": "it",
+	"JP": "ja", "KR": "ko", "RU": "ru", "PT": "pt", "BR": "pt", "NL": "nl",
+	"PL": "pl", "TR": "tr", "VN": "vi", "TH": "th", "ID": "id",
+}
+
+func init() {
+	for _, country := range euroCountries {
+		currencies[country] = "EUR"
+	}
+}
+
+// Currency returns the currency of a country, empty when unknown
+func Currency(country string) string {
+	return currencies[strings.ToUpper(strings.TrimSpace(country))]
+}
+
+// Language returns the language of a country, empty when unknown
+func Language(country string) string {
+	return languages[strings.ToUpper(strings.TrimSpace(country))]
+}
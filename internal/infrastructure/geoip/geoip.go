@@ -0,0 +1,73 @@
+// Package geoip finds the country of visitors from their IP address with a
+// MaxMind DB file, such as GeoLite2 Country or GeoIP2 City, and suggests
+// the currency and language to greet them with.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Locator finds the country of an IP address
+type Locator interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country of an IP
+	// address, or ErrNotFound
+	Country(ip net.IP) (string, error)
+}
+
+// Reader looks countries up in a MaxMind DB file loaded in memory
+type Reader struct {
+	db *database
+}
+
+// Open loads a MaxMind DB file. An empty path gives nil, so visitors are
+// not located.
+func Open(path string) (*Reader, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	db, err := parse(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// DatabaseType returns the edition of the database, such as
+// GeoLite2-Country
+func (r *Reader) DatabaseType() string {
+	return r.db.databaseType
+}
+
+// Country returns the country of an IP address. Registered countries are
+// used for addresses without a located country, such as anycast ranges.
+func (r *Reader) Country(ip net.IP) (string, error) {
+	if ip == nil {
+		return "", ErrNotFound
+	}
+	record, err := r.db.lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	fields, ok := record.(map[string]any)
+	if !ok {
+		return "", ErrNotFound
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		country, ok := fields[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return strings.ToUpper(code), nil
+		}
+	}
+	return "", ErrNotFound
+}
@@ -0,0 +1,293 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+var (
+	ErrInvalidDatabase = errors.New("geoip: not a MaxMind DB file")
+	ErrNotFound        = errors.New("geoip: address not found")
+)
+
+// metadataMarker starts the metadata section at the end of a MaxMind DB
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the gap of zero bytes between the search tree
+// and the data section
+const dataSectionSeparator = 16
+
+// Data types of the MaxMind DB format
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// database is a MaxMind DB file held in memory. Only what country lookups
+// need is decoded: records are read as maps, strings and numbers.
+type database struct {
+	buf          []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	ipv4Start    uint
+}
+
+// parse reads the metadata and search tree layout of a MaxMind DB
+func parse(buf []byte) (*database, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := start + len(metadataMarker)
+	meta, _, err := decode(buf[metaStart:], 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	db := &database{buf: buf}
+	db.nodeCount = uintField(fields, "node_count")
+	db.recordSize = uintField(fields, "record_size")
+	db.ipVersion = uintField(fields, "ip_version")
+	db.databaseType, _ = fields["database_type"].(string)
+	if db.nodeCount == 0 || (db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32) {
+		return nil, ErrInvalidDatabase
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start) {
+		return nil, ErrInvalidDatabase
+	}
+	db.data = buf[treeSize+dataSectionSeparator : start]
+
+	// IPv4 addresses are found under ::/96 of IPv6 databases
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// lookup returns the record of an IP address
+func (db *database) lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	bits := 128
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		bits = 32
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, ErrNotFound
+	}
+
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, ErrNotFound
+	}
+
+	offset := node - db.nodeCount - dataSectionSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, ErrInvalidDatabase
+	}
+	value, _, err := decode(db.data, offset)
+	return value, err
+}
+
+// record returns the left (0) or right (1) record of a search tree node
+func (db *database) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[off : off+4]))
+	}
+}
+
+// decode decodes the value at offset of a data section and returns it
+// with the offset following it
+func decode(data []byte, offset uint) (any, uint, error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := readPointer(data, ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := decode(data, pointer)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(data)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		n := uint(0)
+		for _, b := range data[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		value := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			item, after, err := decode(data, next)
+			if err != nil {
+				return nil, 0, err
+			}
+			value[name] = item
+			offset = after
+		}
+		return value, offset, nil
+	case typeArray:
+		value := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			item, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value = append(value, item)
+			offset = next
+		}
+		return value, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEnd:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	raw := data[offset : offset+size]
+	offset += size
+	switch kind {
+	case typeString:
+		return string(raw), offset, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), raw...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		n := uint64(0)
+		for _, b := range raw {
+			n = n<<8 | uint64(b)
+		}
+		return n, offset, nil
+	case typeInt32:
+		n := uint32(0)
+		for _, b := range raw {
+			n = n<<8 | uint32(b)
+		}
+		return int32(n), offset, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrInvalidDatabase, kind)
+}
+
+// readPointer returns the data section offset a pointer points to and the
+// offset following the pointer
+func readPointer(data []byte, ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3)&0x3 + 1
+	if offset+size > uint(len(data)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	b := data[offset : offset+size]
+	var pointer uint
+	switch size {
+	case 1:
+		pointer = uint(ctrl&0x7)<<8 | uint(b[0])
+	case 2:
+		pointer = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + size, nil
+}
+
+func uintField(fields map[string]any, name string) uint {
+	if n, ok := fields[name].(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// Cache durations of the slower checks
+const (
+	MigrationCacheFor = time.Minute
+	SMTPCacheFor      = 5 * time.Minute
+)
+
+// DatabaseCheck pings the primary database
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "database",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// MigrationCheck fails while tables or columns of the domain models are
+// missing from the database
+func MigrationCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "migrations",
+		Critical: true,
+		CacheFor: MigrationCacheFor,
+		Run: func(ctx context.Context) error {
+			pending, err := database.PendingMigrations(db.WithContext(ctx))
+			if err != nil {
+				return err
+			}
+			if len(pending) == 0 {
+				return nil
+			}
+			shown := pending
+			if len(shown) > 5 {
+				shown = shown[:5]
+			}
+			return fmt.Errorf("%d pending migrations: %s", len(pending), strings.Join(shown, ", "))
+		},
+	}
+}
+
+// QueueCheck reaches the Redis server of the job queue. Jobs wait in the
+// queue while it is down, so the service stays ready.
+func QueueCheck(opt asynq.RedisConnOpt) Check {
+	inspector := asynq.NewInspector(opt)
+	return Check{
+		Name: "queue",
+		Run: func(ctx context.Context) error {
+			done := make(chan error, 1)
+			go func() {
+				_, err := inspector.Queues()
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// SMTPCheck connects to the default SMTP server. Emails are queued while
+// it is unreachable, so the service stays ready. Without a default SMTP
+// server the check passes.
+func SMTPCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "smtp",
+		CacheFor: SMTPCacheFor,
+		Run: func(ctx context.Context) error {
+			var config domain.SMTPConfig
+			err := db.WithContext(ctx).Where("active = ? AND \"default\" = ?", true, true).First(&config).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
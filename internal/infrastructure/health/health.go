@@ -0,0 +1,142 @@
+// Package health checks the dependencies OpenHost needs to serve requests,
+// for the readiness probe of orchestrators like Kubernetes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded" // Only non-critical checks failed
+)
+
+// DefaultTimeout bounds a single check
+const DefaultTimeout = 5 * time.Second
+
+// Check is a dependency check
+type Check struct {
+	Name string
+	// Critical checks make the service not ready when they fail; others
+	// only degrade it
+	Critical bool
+	// CacheFor reuses the last result for checks too slow or too costly to
+	// run on every probe
+	CacheFor time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+	Cached     bool      `json:"cached,omitempty"`
+}
+
+// Report is the outcome of all checks
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether all critical checks passed
+func (r Report) Ready() bool {
+	return r.Status != StatusFail
+}
+
+// Checker runs the registered checks
+type Checker struct {
+	mu      sync.Mutex
+	checks  []Check
+	cache   map[string]Result
+	timeout time.Duration
+}
+
+// NewChecker creates a checker without checks
+func NewChecker() *Checker {
+	return &Checker{cache: make(map[string]Result), timeout: DefaultTimeout}
+}
+
+// Add registers a check
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+// Run runs the checks concurrently and returns their results in the order
+// they were added
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs a check, or returns its cached result while that is fresh
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	if check.CacheFor > 0 {
+		c.mu.Lock()
+		cached, ok := c.cache[check.Name]
+		c.mu.Unlock()
+		if ok && time.Since(cached.CheckedAt) < check.CacheFor {
+			cached.Cached = true
+			return cached
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := Result{
+		Name:       check.Name,
+		Status:     StatusOK,
+		Critical:   check.Critical,
+		DurationMs: time.Since(start).Milliseconds(),
+		CheckedAt:  start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	if check.CacheFor > 0 {
+		c.mu.Lock()
+		c.cache[check.Name] = result
+		c.mu.Unlock()
+	}
+	return result
+}
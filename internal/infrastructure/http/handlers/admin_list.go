@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/adminlist"
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// defaultAdminPageLength is the page size when a request does not give one
+const defaultAdminPageLength = 25
+
+// AdminListHandler serves the rows of the HTML admin lists. Tables load
+// them page by page, so sorting, searching and paging happen in the
+// database instead of the browser.
+//
+// Requests use the DataTables server-side parameters: draw, start, length,
+// search[value], order[0][column], order[0][dir] and columns[i][data].
+// The shorter search, sort and dir parameters do the same for HTMX and
+// plain links, status filters the list, risk filters customers by
+// health and assignee filters tasks by staff member, "me" being the one
+// signed in. field[name] filters orders and invoices by a custom field
+// such as field[po_number]; search also looks in their custom field
+// values. Every list answers with
+//
+//	{"draw": 1, "recordsTotal": 120, "recordsFiltered": 8, "data": [...]}
+//
+// Timestamps are in the time zone of the signed in staff member.
+type AdminListHandler struct {
+	listService *adminlist.Service
+}
+
+// NewAdminListHandler creates a new admin list handler
+func NewAdminListHandler(listService *adminlist.Service) *AdminListHandler {
+	return &AdminListHandler{listService: listService}
+}
+
+// StaffMiddleware restricts the admin lists to signed in staff
+func (h *AdminListHandler) StaffMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, adminListResponse{Error: "Authentication required"})
+			return
+		}
+		if !user.IsStaff() {
+			c.AbortWithStatusJSON(http.StatusForbidden, adminListResponse{Error: "Staff access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Customers serves the rows of the admin customer list
+func (h *AdminListHandler) Customers(c *gin.Context) {
+	q, draw := parseAdminListQuery(c)
+	customers, counts, err := h.listService.Customers(q)
+	if err != nil {
+		writeAdminListError(c, draw, "Failed to fetch customers")
+		return
+	}
+
+	loc := web.UserLocation(c)
+	rows := make([]adminCustomerRow, 0, len(customers))
+	for _, customer := range customers {
+		user := customer.User
+		row := adminCustomerRow{
+			ID:        user.ID,
+			Name:      strings.TrimSpace(user.FirstName + " " + user.LastName),
+			Email:     user.Email,
+			Company:   user.Company,
+			Status:    string(user.Status),
+			CreatedAt: user.CreatedAt.In(loc).Format(time.RFC3339),
+		}
+		if customer.Health != nil {
+			score := customer.Health.Score
+			row.Health = &score
+			row.Risk = string(customer.Health.Risk)
+		}
+		rows = append(rows, row)
+	}
+	writeAdminList(c, draw, counts, rows)
+}
+
+// Orders serves the rows of the admin order list
+func (h *AdminListHandler) Orders(c *gin.Context) {
+	q, draw := parseAdminListQuery(c)
+	orders, counts, err := h.listService.Orders(q)
+	if err != nil {
+		writeAdminListError(c, draw, "Failed to fetch orders")
+		return
+	}
+
+	loc := web.UserLocation(c)
+	rows := make([]adminOrderRow, 0, len(orders))
+	for _, order := range orders {
+		rows = append(rows, adminOrderRow{
+			ID:          order.ID,
+			OrderNumber: order.OrderNumber,
+			CustomerID:  order.CustomerID,
+			Customer:    order.Customer.Email,
+			Total:       web.Money().Amount(order.Total, order.Currency),
+			TotalLabel:  web.FormatMoney(c, order.Total, order.Currency),
+			Currency:    order.Currency,
+			Status:      string(order.Status),
+			CreatedAt:   order.CreatedAt.In(loc).Format(time.RFC3339),
+		})
+	}
+	writeAdminList(c, draw, counts, rows)
+}
+
+// Invoices serves the rows of the admin invoice list
+func (h *AdminListHandler) Invoices(c *gin.Context) {
+	q, draw := parseAdminListQuery(c)
+	invoices, counts, err := h.listService.Invoices(q)
+	if err != nil {
+		writeAdminListError(c, draw, "Failed to fetch invoices")
+		return
+	}
+
+	loc := web.UserLocation(c)
+	rows := make([]adminInvoiceRow, 0, len(invoices))
+	for _, inv := range invoices {
+		rows = append(rows, adminInvoiceRow{
+			ID:            inv.ID,
+			InvoiceNumber: inv.InvoiceNumber,
+			CustomerID:    inv.CustomerID,
+			Customer:      inv.Customer.Email,
+			Total:         web.Money().Amount(inv.Total, inv.Currency),
+			TotalLabel:    web.FormatMoney(c, inv.Total, inv.Currency),
+			Balance:       web.Money().Amount(inv.Balance, inv.Currency),
+			BalanceLabel:  web.FormatMoney(c, inv.Balance, inv.Currency),
+			Currency:      inv.Currency,
+			Status:        string(inv.Status),
+			DueDate:       inv.DueDate.Format("2006-01-02"),
+			CreatedAt:     inv.CreatedAt.In(loc).Format(time.RFC3339),
+		})
+	}
+	writeAdminList(c, draw, counts, rows)
+}
+
+// Tickets serves the rows of the admin ticket list
+func (h *AdminListHandler) Tickets(c *gin.Context) {
+	q, draw := parseAdminListQuery(c)
+	tickets, counts, err := h.listService.Tickets(q)
+	if err != nil {
+		writeAdminListError(c, draw, "Failed to fetch tickets")
+		return
+	}
+
+	loc := web.UserLocation(c)
+	rows := make([]adminTicketRow, 0, len(tickets))
+	for _, t := range tickets {
+		row := adminTicketRow{
+			ID:         t.Ticket.ID,
+			Subject:    t.Ticket.Subject,
+			CustomerID: t.Ticket.CustomerID,
+			Status:     string(t.Ticket.Status),
+			Priority:   string(t.Ticket.Priority),
+			CreatedAt:  t.Ticket.CreatedAt.In(loc).Format(time.RFC3339),
+			UpdatedAt:  t.Ticket.UpdatedAt.In(loc).Format(time.RFC3339),
+		}
+		if t.Customer != nil {
+			row.Customer = t.Customer.Email
+		}
+		rows = append(rows, row)
+	}
+	writeAdminList(c, draw, counts, rows)
+}
+
+// Tasks serves the rows of the admin task list
+func (h *AdminListHandler) Tasks(c *gin.Context) {
+	q, draw := parseAdminListQuery(c)
+	switch assignee := c.Query("assignee"); assignee {
+	case "":
+	case "me":
+		id := currentUser(c).ID
+		q.AssigneeID = &id
+	default:
+		id, err := strconv.ParseUint(assignee, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, adminListResponse{Draw: draw, Data: []struct{}{}, Error: "Invalid assignee"})
+			return
+		}
+		q.AssigneeID = &id
+	}
+
+	tasks, counts, err := h.listService.Tasks(q)
+	if err != nil {
+		writeAdminListError(c, draw, "Failed to fetch tasks")
+		return
+	}
+
+	loc := web.UserLocation(c)
+	now := time.Now()
+	rows := make([]adminTaskRow, 0, len(tasks))
+	for i := range tasks {
+		t := &tasks[i]
+		row := adminTaskRow{
+			ID:         t.ID,
+			Title:      t.Title,
+			EntityType: string(t.EntityType),
+			EntityID:   t.EntityID,
+			AssigneeID: t.AssigneeID,
+			Status:     string(t.Status),
+			Overdue:    t.IsOverdue(now),
+			CreatedAt:  t.CreatedAt.In(loc).Format(time.RFC3339),
+		}
+		if t.EntityID != nil {
+			row.Entity = fmt.Sprintf("%s #%d", t.EntityType, *t.EntityID)
+		}
+		if t.Assignee != nil {
+			row.Assignee = t.Assignee.FullName()
+		}
+		if t.DueAt != nil {
+			row.DueAt = t.DueAt.In(loc).Format(time.RFC3339)
+		}
+		rows = append(rows, row)
+	}
+	writeAdminList(c, draw, counts, rows)
+}
+
+// parseAdminListQuery reads the page, search and sort parameters of an
+// admin list request and the draw counter to echo back
+func parseAdminListQuery(c *gin.Context) (adminlist.Query, int) {
+	draw, _ := strconv.Atoi(c.Query("draw"))
+
+	q := adminlist.Query{
+		Search: c.Query("search[value]"),
+		Status: c.Query("status"),
+		Risk:   domain.HealthRisk(c.Query("risk")),
+		Sort:   c.Query("sort"),
+		Desc:   strings.EqualFold(c.Query("dir"), "desc"),
+		Fields: c.QueryMap("field"),
+	}
+	if q.Search == "" {
+		q.Search = c.Query("search")
+	}
+	if column := c.Query("order[0][column]"); column != "" {
+		q.Sort = c.Query("columns[" + column + "][data]")
+		q.Desc = strings.EqualFold(c.Query("order[0][dir]"), "desc")
+	}
+
+	q.Offset, _ = strconv.Atoi(c.Query("start"))
+	q.Limit, _ = strconv.Atoi(c.Query("length"))
+	if q.Limit <= 0 {
+		q.Limit = defaultAdminPageLength
+	}
+	return q, draw
+}
+
+func writeAdminList(c *gin.Context, draw int, counts adminlist.Counts, rows interface{}) {
+	c.JSON(http.StatusOK, adminListResponse{
+		Draw:            draw,
+		RecordsTotal:    counts.Total,
+		RecordsFiltered: counts.Filtered,
+		Data:            rows,
+	})
+}
+
+func writeAdminListError(c *gin.Context, draw int, message string) {
+	c.JSON(http.StatusInternalServerError, adminListResponse{Draw: draw, Data: []struct{}{}, Error: message})
+}
+
+type adminListResponse struct {
+	Draw            int         `json:"draw"`
+	RecordsTotal    int64       `json:"recordsTotal"`
+	RecordsFiltered int64       `json:"recordsFiltered"`
+	Data            interface{} `json:"data"`
+	Error           string      `json:"error,omitempty"`
+}
+
+type adminCustomerRow struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Company   string `json:"company"`
+	Status    string `json:"status"`
+	Health    *int   `json:"health"` // Health score, null until computed
+	Risk      string `json:"risk"`
+	CreatedAt string `json:"created_at"`
+}
+
+type adminOrderRow struct {
+	ID          uint64 `json:"id"`
+	OrderNumber string `json:"order_number"`
+	CustomerID  uint64 `json:"customer_id"`
+	Customer    string `json:"customer"`
+	Total       string `json:"total"`
+	TotalLabel  string `json:"total_label"`
+	Currency    string `json:"currency"`
+	Status      string `json:"status"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type adminInvoiceRow struct {
+	ID            uint64 `json:"id"`
+	InvoiceNumber string `json:"invoice_number"`
+	CustomerID    uint64 `json:"customer_id"`
+	Customer      string `json:"customer"`
+	Total         string `json:"total"`
+	TotalLabel    string `json:"total_label"`
+	Balance       string `json:"balance"`
+	BalanceLabel  string `json:"balance_label"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	DueDate       string `json:"due_date"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type adminTicketRow struct {
+	ID         uint64  `json:"id"`
+	Subject    string  `json:"subject"`
+	CustomerID *uint64 `json:"customer_id"`
+	Customer   string  `json:"customer"`
+	Status     string  `json:"status"`
+	Priority   string  `json:"priority"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+type adminTaskRow struct {
+	ID         uint64  `json:"id"`
+	Title      string  `json:"title"`
+	Entity     string  `json:"entity"` // Record the task is about, such as "order #12"
+	EntityType string  `json:"entity_type"`
+	EntityID   *uint64 `json:"entity_id"`
+	AssigneeID *uint64 `json:"assignee_id"`
+	Assignee   string  `json:"assignee"`
+	Status     string  `json:"status"`
+	Overdue    bool    `json:"overdue"`
+	DueAt      string  `json:"due_at"`
+	CreatedAt  string  `json:"created_at"`
+}
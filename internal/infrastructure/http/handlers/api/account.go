@@ -0,0 +1,733 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// AccountHandler handles the security log, legal consent and appearance
+// endpoints of the client area
+type AccountHandler struct {
+	accountService *account.Service
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(accountService *account.Service) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// ListSecurityEvents godoc
+// @Summary List security events
+// @Description Returns the current user's security log: logins, failed logins, password and two-factor changes and consents
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Filter by event type"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/account/security-events [get]
+func (h *AccountHandler) ListSecurityEvents(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	limit, offset := PaginationParams(c)
+
+	events, total, err := h.accountService.ListEvents(userID, domain.SecurityEventType(c.Query("type")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch security events"})
+		return
+	}
+
+	response := make([]SecurityEventResponse, 0, len(events))
+	for _, e := range events {
+		response = append(response, SecurityEventResponse{
+			ID:        e.ID,
+			Type:      string(e.Type),
+			IPAddress: e.IPAddress,
+			UserAgent: e.UserAgent,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// GetConsents godoc
+// @Summary Get consents
+// @Description Returns the current legal documents with the versions the current user accepted. Documents with requires_action set must be accepted again.
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ConsentStatusResponse
+// @Router /api/v1/account/consents [get]
+func (h *AccountHandler) GetConsents(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	consents, err := h.accountService.ConsentStatus(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch consents"})
+		return
+	}
+
+	response := ConsentStatusResponse{Documents: make([]ConsentResponse, 0, len(consents))}
+	for _, consent := range consents {
+		resp := ConsentResponse{
+			Document:       toLegalDocumentSummary(&consent.Document),
+			RequiresAction: consent.RequiresAction,
+		}
+		if consent.Accepted != nil {
+			resp.AcceptedVersion = consent.Accepted.Version
+			resp.AcceptedAt = consent.Accepted.CreatedAt.Format(time.RFC3339)
+		}
+		if consent.RequiresAction {
+			response.PendingCount++
+		}
+		response.Documents = append(response.Documents, resp)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GiveConsent godoc
+// @Summary Accept legal document
+// @Description Records the current user's acceptance of the current version of a legal document
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body GiveConsentRequest true "Document"
+// @Success 201 {object} ConsentRecordResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/account/consents [post]
+func (h *AccountHandler) GiveConsent(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	var req GiveConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	record, err := h.accountService.GiveConsent(userID, req.DocumentID, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		switch err {
+		case account.ErrDocumentNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Document not found"})
+		case account.ErrDocumentOutdated:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to record consent"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toConsentRecordResponse(record))
+}
+
+// GetConsentHistory godoc
+// @Summary Get consent history
+// @Description Returns every consent the current user has given, newest first
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ConsentRecordResponse
+// @Router /api/v1/account/consents/history [get]
+func (h *AccountHandler) GetConsentHistory(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	records, err := h.accountService.ConsentHistory(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch consent history"})
+		return
+	}
+
+	response := make([]ConsentRecordResponse, 0, len(records))
+	for i := range records {
+		response = append(response, toConsentRecordResponse(&records[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportConsentHistory godoc
+// @Summary Download consent history
+// @Description Downloads the current user's consent history as CSV
+// @Tags account
+// @Produce text/csv
+// @Security BearerAuth
+// @Success 200 {file} file
+// @Router /api/v1/account/consents/export [get]
+func (h *AccountHandler) ExportConsentHistory(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	records, err := h.accountService.ConsentHistory(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export consent history"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := account.WriteConsentHistoryCSV(&buf, records); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export consent history"})
+		return
+	}
+
+	name := "consent-history-" + time.Now().Format("20060102")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// GetAppearance godoc
+// @Summary Get appearance
+// @Description Returns the current user's color scheme and preferred theme, with the themes they may choose
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AppearanceResponse
+// @Router /api/v1/account/appearance [get]
+func (h *AccountHandler) GetAppearance(c *gin.Context) {
+	c.JSON(http.StatusOK, toAppearanceResponse(GetCurrentUser(c)))
+}
+
+// UpdateAppearance godoc
+// @Summary Update appearance
+// @Description Changes the current user's color scheme (auto, light or dark) and preferred theme. An empty theme follows the site theme; omitted fields are left unchanged.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateAppearanceRequest true "Appearance"
+// @Success 200 {object} AppearanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/account/appearance [put]
+func (h *AccountHandler) UpdateAppearance(c *gin.Context) {
+	var req UpdateAppearanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	input := account.AppearanceInput{Theme: req.Theme}
+	if req.Appearance != nil {
+		appearance := domain.Appearance(*req.Appearance)
+		input.Appearance = &appearance
+	}
+	if req.Theme != nil && *req.Theme != "" && !web.DefaultThemeManager.IsUserSelectable(*req.Theme) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "This theme cannot be chosen"})
+		return
+	}
+
+	user, err := h.accountService.UpdateAppearance(GetCurrentUserID(c), input)
+	if err != nil {
+		if err == account.ErrInvalidAppearance {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update appearance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAppearanceResponse(user))
+}
+
+// ListCurrencies godoc
+// @Summary List currencies
+// @Description Returns the currencies customers can pick when registering, the default one first
+// @Tags account
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/currencies [get]
+func (h *AccountHandler) ListCurrencies(c *gin.Context) {
+	currencies, err := h.accountService.Currencies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch currencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, currencies)
+}
+
+// GetCurrency godoc
+// @Summary Get currency
+// @Description Returns the currency the current user sees prices and is billed in, whether it is locked and the currencies they can pick
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} CurrencyResponse
+// @Router /api/v1/account/currency [get]
+func (h *AccountHandler) GetCurrency(c *gin.Context) {
+	resp, err := h.currencyResponse(GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateCurrency godoc
+// @Summary Update currency
+// @Description Changes the currency the current user sees prices and is billed in. The cart is repriced in it. It cannot change once the user has been invoiced.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateCurrencyRequest true "Currency"
+// @Success 200 {object} CurrencyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/account/currency [put]
+func (h *AccountHandler) UpdateCurrency(c *gin.Context) {
+	var req UpdateCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID := GetCurrentUserID(c)
+	if _, err := h.accountService.SetCurrency(userID, req.Currency); err != nil {
+		switch err {
+		case account.ErrCurrencyUnavailable:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case account.ErrCurrencyLocked:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update currency"})
+		}
+		return
+	}
+
+	resp, err := h.currencyResponse(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AccountHandler) currencyResponse(userID uint64) (CurrencyResponse, error) {
+	var resp CurrencyResponse
+	var err error
+	if resp.Currency, err = h.accountService.Currency(userID); err != nil {
+		return resp, err
+	}
+	if resp.Locked, err = h.accountService.CurrencyLocked(userID); err != nil {
+		return resp, err
+	}
+	if resp.Available, err = h.accountService.Currencies(); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// ListLegalDocuments godoc
+// @Summary List legal documents
+// @Description Returns the current version of every legal document. Documents with requires_consent set must be accepted when registering and at checkout.
+// @Tags account
+// @Produce json
+// @Success 200 {array} LegalDocumentResponse
+// @Router /api/v1/legal [get]
+func (h *AccountHandler) ListLegalDocuments(c *gin.Context) {
+	response := make([]LegalDocumentResponse, 0, len(domain.LegalDocumentTypes))
+	for _, docType := range domain.LegalDocumentTypes {
+		doc, err := h.accountService.CurrentDocument(docType)
+		if err == account.ErrDocumentNotFound {
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch documents"})
+			return
+		}
+		response = append(response, toLegalDocumentSummary(doc))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLegalDocument godoc
+// @Summary Get legal document
+// @Description Returns the current version of a legal document
+// @Tags account
+// @Produce json
+// @Param type path string true "Document type (terms, privacy, aup, sla)"
+// @Success 200 {object} LegalDocumentResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/legal/{type} [get]
+func (h *AccountHandler) GetLegalDocument(c *gin.Context) {
+	doc, err := h.accountService.CurrentDocument(domain.LegalDocumentType(c.Param("type")))
+	if err != nil {
+		if err == account.ErrDocumentNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLegalDocumentResponse(doc))
+}
+
+// AdminListLegalDocuments godoc
+// @Summary List legal document versions (Admin)
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Filter by document type (terms, privacy, aup, sla)"
+// @Success 200 {array} LegalDocumentResponse
+// @Router /api/v1/admin/legal-documents [get]
+func (h *AccountHandler) AdminListLegalDocuments(c *gin.Context) {
+	docs, err := h.accountService.ListDocuments(domain.LegalDocumentType(c.Query("type")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch documents"})
+		return
+	}
+
+	response := make([]LegalDocumentResponse, 0, len(docs))
+	for i := range docs {
+		response = append(response, toLegalDocumentResponse(&docs[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminPublishLegalDocument godoc
+// @Summary Publish legal document version (Admin)
+// @Description Publishes a new version of a legal document, now or at published_at. When it requires consent, customers are asked to accept it again.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body PublishLegalDocumentRequest true "Document"
+// @Success 201 {object} LegalDocumentResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/legal-documents [post]
+func (h *AccountHandler) AdminPublishLegalDocument(c *gin.Context) {
+	var req PublishLegalDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	doc := &domain.LegalDocument{
+		Type:            domain.LegalDocumentType(req.Type),
+		Version:         req.Version,
+		Title:           req.Title,
+		Content:         req.Content,
+		Summary:         req.Summary,
+		RequiresConsent: true,
+	}
+	if req.RequiresConsent != nil {
+		doc.RequiresConsent = *req.RequiresConsent
+	}
+	if req.PublishedAt != nil {
+		doc.PublishedAt = *req.PublishedAt
+	}
+
+	if err := h.accountService.PublishDocument(doc); err != nil {
+		switch err {
+		case account.ErrInvalidDocument:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case account.ErrVersionExists:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to publish document"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toLegalDocumentResponse(doc))
+}
+
+// AdminUpdateLegalDocument godoc
+// @Summary Update legal document version (Admin)
+// @Description Edits a legal document version that is scheduled but not yet published
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Document ID"
+// @Param request body UpdateLegalDocumentRequest true "Changes"
+// @Success 200 {object} LegalDocumentResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/legal-documents/{id} [put]
+func (h *AccountHandler) AdminUpdateLegalDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+		return
+	}
+
+	var req UpdateLegalDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Content != nil {
+		updates["content"] = *req.Content
+	}
+	if req.Summary != nil {
+		updates["summary"] = *req.Summary
+	}
+	if req.RequiresConsent != nil {
+		updates["requires_consent"] = *req.RequiresConsent
+	}
+	if req.PublishedAt != nil {
+		updates["published_at"] = *req.PublishedAt
+	}
+
+	doc, err := h.accountService.UpdateDocument(id, updates)
+	if err != nil {
+		switch err {
+		case account.ErrDocumentNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Document not found"})
+		case account.ErrInvalidDocument:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case account.ErrDocumentPublished:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update document"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toLegalDocumentResponse(doc))
+}
+
+// AdminListLegalAcceptances godoc
+// @Summary List legal document acceptances (Admin)
+// @Description Returns who accepted which legal document version, when, from which IP address and where
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param document_id query int false "Filter by document version ID"
+// @Param type query string false "Filter by document type (terms, privacy, aup, sla)"
+// @Param version query string false "Filter by version"
+// @Param user_id query int false "Filter by user"
+// @Param context query string false "Filter by context (registration, checkout, account)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/legal-acceptances [get]
+func (h *AccountHandler) AdminListLegalAcceptances(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	filter := account.AcceptanceFilter{
+		DocumentType: domain.LegalDocumentType(c.Query("type")),
+		Version:      c.Query("version"),
+		Context:      domain.ConsentContext(c.Query("context")),
+	}
+	if v := c.Query("document_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid document ID"})
+			return
+		}
+		filter.DocumentID = id
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+		filter.UserID = id
+	}
+
+	records, total, err := h.accountService.ListAcceptances(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch acceptances"})
+		return
+	}
+
+	response := make([]LegalAcceptanceResponse, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		resp := LegalAcceptanceResponse{
+			ConsentRecordResponse: toConsentRecordResponse(record),
+			UserID:                record.UserID,
+			UserAgent:             record.UserAgent,
+		}
+		if record.User != nil {
+			resp.UserEmail = record.User.Email
+			resp.UserName = record.User.FirstName + " " + record.User.LastName
+		}
+		response = append(response, resp)
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// writeAcceptanceError writes the response for legal documents not
+// accepted when registering or at checkout
+func writeAcceptanceError(c *gin.Context, err error) {
+	switch err {
+	case account.ErrConsentRequired:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case account.ErrDocumentNotFound:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Accepted document not found"})
+	case account.ErrDocumentOutdated:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check legal documents"})
+	}
+}
+
+func toLegalDocumentSummary(doc *domain.LegalDocument) LegalDocumentResponse {
+	return LegalDocumentResponse{
+		ID:              doc.ID,
+		Type:            string(doc.Type),
+		Version:         doc.Version,
+		Title:           doc.Title,
+		Summary:         doc.Summary,
+		RequiresConsent: doc.RequiresConsent,
+		PublishedAt:     doc.PublishedAt.Format(time.RFC3339),
+	}
+}
+
+func toLegalDocumentResponse(doc *domain.LegalDocument) LegalDocumentResponse {
+	resp := toLegalDocumentSummary(doc)
+	resp.Content = doc.Content
+	return resp
+}
+
+func toConsentRecordResponse(record *domain.ConsentRecord) ConsentRecordResponse {
+	return ConsentRecordResponse{
+		ID:           record.ID,
+		DocumentID:   record.DocumentID,
+		DocumentType: string(record.DocumentType),
+		Title:        record.Document.Title,
+		Version:      record.Version,
+		Context:      string(record.Context),
+		OrderID:      record.OrderID,
+		IPAddress:    record.IPAddress,
+		AcceptedAt:   record.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toAppearanceResponse(user *domain.User) AppearanceResponse {
+	appearance := user.Appearance
+	if !appearance.Valid() {
+		appearance = domain.AppearanceAuto
+	}
+	themes := web.DefaultThemeManager.UserSelectableThemes()
+	if themes == nil {
+		themes = []string{}
+	}
+	return AppearanceResponse{Appearance: string(appearance), Theme: user.Theme, Themes: themes}
+}
+
+// Request/Response types
+
+type UpdateAppearanceRequest struct {
+	Appearance *string `json:"appearance"`
+	Theme      *string `json:"theme"`
+}
+
+type AppearanceResponse struct {
+	Appearance string   `json:"appearance"`
+	Theme      string   `json:"theme"`
+	Themes     []string `json:"themes"`
+}
+
+type UpdateCurrencyRequest struct {
+	Currency string `json:"currency" binding:"required,len=3"`
+}
+
+type CurrencyResponse struct {
+	Currency  string   `json:"currency"`
+	Locked    bool     `json:"locked"` // Set once the user has been invoiced
+	Available []string `json:"available"`
+}
+
+type GiveConsentRequest struct {
+	DocumentID uint64 `json:"document_id" binding:"required"`
+}
+
+type PublishLegalDocumentRequest struct {
+	Type            string     `json:"type" binding:"required,oneof=terms privacy aup sla"`
+	Version         string     `json:"version" binding:"required"`
+	Title           string     `json:"title" binding:"required"`
+	Content         string     `json:"content" binding:"required"`
+	Summary         string     `json:"summary"`
+	RequiresConsent *bool      `json:"requires_consent"`
+	PublishedAt     *time.Time `json:"published_at"`
+}
+
+type UpdateLegalDocumentRequest struct {
+	Title           *string    `json:"title"`
+	Content         *string    `json:"content"`
+	Summary         *string    `json:"summary"`
+	RequiresConsent *bool      `json:"requires_consent"`
+	PublishedAt     *time.Time `json:"published_at"`
+}
+
+type SecurityEventResponse struct {
+	ID        uint64 `json:"id"`
+	Type      string `json:"type"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type LegalDocumentResponse struct {
+	ID              uint64 `json:"id"`
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	Title           string `json:"title"`
+	Summary         string `json:"summary,omitempty"`
+	Content         string `json:"content,omitempty"`
+	RequiresConsent bool   `json:"requires_consent"`
+	PublishedAt     string `json:"published_at"`
+}
+
+type ConsentResponse struct {
+	Document        LegalDocumentResponse `json:"document"`
+	AcceptedVersion string                `json:"accepted_version,omitempty"`
+	AcceptedAt      string                `json:"accepted_at,omitempty"`
+	RequiresAction  bool                  `json:"requires_action"`
+}
+
+type ConsentStatusResponse struct {
+	Documents    []ConsentResponse `json:"documents"`
+	PendingCount int               `json:"pending_count"`
+}
+
+type ConsentRecordResponse struct {
+	ID           uint64  `json:"id"`
+	DocumentID   uint64  `json:"document_id"`
+	DocumentType string  `json:"document_type"`
+	Title        string  `json:"title"`
+	Version      string  `json:"version"`
+	Context      string  `json:"context"`
+	OrderID      *uint64 `json:"order_id,omitempty"`
+	IPAddress    string  `json:"ip_address,omitempty"`
+	AcceptedAt   string  `json:"accepted_at"`
+}
+
+type LegalAcceptanceResponse struct {
+	ConsentRecordResponse
+	UserID    uint64 `json:"user_id"`
+	UserEmail string `json:"user_email,omitempty"`
+	UserName  string `json:"user_name,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/addon"
+)
+
+// AddonHandler handles service addon endpoints
+type AddonHandler struct {
+	addonService *addon.Service
+}
+
+// NewAddonHandler creates a new addon handler
+func NewAddonHandler(addonService *addon.Service) *AddonHandler {
+	return &AddonHandler{addonService: addonService}
+}
+
+// ListAvailableAddons godoc
+// @Summary List available addons
+// @Description Returns the addons that can be ordered for a service, priced for its billing cycle with the prorated amount due now
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} AddonOfferResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/addons/available [get]
+func (h *AddonHandler) ListAvailableAddons(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	offers, err := h.addonService.AvailableAddons(userID, serviceID)
+	if err != nil {
+		if err == addon.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch addons"})
+		return
+	}
+
+	response := make([]AddonOfferResponse, 0, len(offers))
+	for _, offer := range offers {
+		response = append(response, AddonOfferResponse{
+			ID:            offer.Addon.ID,
+			Name:          offer.Addon.Name,
+			Description:   offer.Addon.Description,
+			Type:          offer.Addon.Type,
+			SetupFee:      offer.SetupFee.String(),
+			RecurringFee:  offer.RecurringFee.String(),
+			DueNow:        offer.DueNow.String(),
+			AllowQuantity: offer.Addon.AllowQuantity,
+			MaxQuantity:   offer.Addon.MaxQuantity,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListServiceAddons godoc
+// @Summary List service addons
+// @Description Returns the addons ordered on a service
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} ServiceAddonResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/addons [get]
+func (h *AddonHandler) ListServiceAddons(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	addons, err := h.addonService.ListServiceAddons(userID, serviceID)
+	if err != nil {
+		if err == addon.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch addons"})
+		return
+	}
+
+	response := make([]ServiceAddonResponse, 0, len(addons))
+	for i := range addons {
+		response = append(response, toServiceAddonResponse(&addons[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// OrderAddon godoc
+// @Summary Order addon
+// @Description Adds an addon to an active service. The setup fee and the rest of the current period, prorated to the service's next due date, are invoiced straight away; the addon then renews with the service.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param request body OrderAddonRequest true "Addon"
+// @Success 201 {object} OrderAddonResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/addons [post]
+func (h *AddonHandler) OrderAddon(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req OrderAddonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	serviceAddon, inv, err := h.addonService.OrderAddon(userID, serviceID, req.AddonID, req.Quantity)
+	if err != nil {
+		switch err {
+		case addon.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case addon.ErrAddonNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Addon not found"})
+		case addon.ErrAddonNotAvailable, addon.ErrInvalidQuantity, addon.ErrServiceNotActive:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case addon.ErrAddonAlreadyActive:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to order addon"})
+		}
+		return
+	}
+
+	response := OrderAddonResponse{Addon: toServiceAddonResponse(serviceAddon)}
+	if inv != nil {
+		response.InvoiceID = &inv.ID
+		response.InvoiceTotal = inv.Total.String()
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CancelServiceAddon godoc
+// @Summary Cancel service addon
+// @Description Cancels an addon so it is no longer renewed with the service
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param addon_id path int true "Service addon ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/addons/{addon_id}/cancel [post]
+func (h *AddonHandler) CancelServiceAddon(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+	serviceAddonID, err := strconv.ParseUint(c.Param("addon_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid addon ID"})
+		return
+	}
+
+	if err := h.addonService.CancelAddon(userID, serviceID, serviceAddonID); err != nil {
+		switch err {
+		case addon.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case addon.ErrServiceAddonNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Addon not found"})
+		case addon.ErrAddonNotCancellable:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to cancel addon"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Addon cancelled"})
+}
+
+// AdminActivateServiceAddon godoc
+// @Summary Activate service addon (Admin)
+// @Description Activates an addon ordered without automatic provisioning
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service addon ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/service-addons/{id}/activate [post]
+func (h *AddonHandler) AdminActivateServiceAddon(c *gin.Context) {
+	serviceAddonID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid addon ID"})
+		return
+	}
+
+	if err := h.addonService.ActivateAddon(serviceAddonID); err != nil {
+		if err == addon.ErrServiceAddonNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Pending addon not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to activate addon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Addon activated"})
+}
+
+func toServiceAddonResponse(a *domain.ServiceAddon) ServiceAddonResponse {
+	return ServiceAddonResponse{
+		ID:              a.ID,
+		ServiceID:       a.ServiceID,
+		AddonID:         a.AddonID,
+		Name:            a.Addon.Name,
+		Quantity:        a.Quantity,
+		Status:          string(a.Status),
+		BillingCycle:    a.BillingCycle,
+		RecurringAmount: a.RecurringAmount.String(),
+		NextDueDate:     a.NextDueDate.Format(time.RFC3339),
+	}
+}
+
+// Request/Response types
+
+type OrderAddonRequest struct {
+	AddonID  uint64 `json:"addon_id" binding:"required"`
+	Quantity int    `json:"quantity"`
+}
+
+type AddonOfferResponse struct {
+	ID            uint64 `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Type          string `json:"type"`
+	SetupFee      string `json:"setup_fee"`
+	RecurringFee  string `json:"recurring_fee"`
+	DueNow        string `json:"due_now"`
+	AllowQuantity bool   `json:"allow_quantity"`
+	MaxQuantity   int    `json:"max_quantity"`
+}
+
+type ServiceAddonResponse struct {
+	ID              uint64 `json:"id"`
+	ServiceID       uint64 `json:"service_id"`
+	AddonID         uint64 `json:"addon_id"`
+	Name            string `json:"name"`
+	Quantity        int    `json:"quantity"`
+	Status          string `json:"status"`
+	BillingCycle    string `json:"billing_cycle"`
+	RecurringAmount string `json:"recurring_amount"`
+	NextDueDate     string `json:"next_due_date"`
+}
+
+type OrderAddonResponse struct {
+	Addon        ServiceAddonResponse `json:"addon"`
+	InvoiceID    *uint64              `json:"invoice_id,omitempty"`
+	InvoiceTotal string               `json:"invoice_total,omitempty"`
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/address"
+)
+
+// AddressHandler handles the checks of billing addresses and the countries
+// sales are restricted to
+type AddressHandler struct {
+	addressService *address.Service
+}
+
+// NewAddressHandler creates a new address handler
+func NewAddressHandler(addressService *address.Service) *AddressHandler {
+	return &AddressHandler{addressService: addressService}
+}
+
+// ValidateAddress godoc
+// @Summary Validate billing address
+// @Description Normalizes a billing address and checks it would be accepted at checkout: the state or province is required in the US and Canada, postal codes must match the format of their country and the country must not be restricted or embargoed. Returns the normalized address, which is not saved.
+// @Tags checkout
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AddressRequest true "Billing address"
+// @Success 200 {object} AddressRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/checkout/address/validate [post]
+func (h *AddressHandler) ValidateAddress(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	addr, err := h.addressService.Validate(c.Request.Context(), address.Address{
+		Address1:   req.Address1,
+		Address2:   req.Address2,
+		City:       req.City,
+		State:      req.State,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+	})
+	if err != nil {
+		writeAddressError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AddressRequest(addr))
+}
+
+// AdminGetCountrySettings godoc
+// @Summary Get checkout countries (Admin)
+// @Description Returns the countries sales are restricted to, empty to sell to every country, and the embargoed countries customers can never check out from
+// @Tags admin/checkout
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} CountrySettingsRequest
+// @Router /api/v1/admin/checkout/countries [get]
+func (h *AddressHandler) AdminGetCountrySettings(c *gin.Context) {
+	settings, err := h.addressService.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch checkout countries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CountrySettingsRequest{
+		AllowedCountries:   settings.AllowedCountries,
+		EmbargoedCountries: settings.EmbargoedCountries,
+	})
+}
+
+// AdminUpdateCountrySettings godoc
+// @Summary Update checkout countries (Admin)
+// @Description Sets the countries sales are restricted to and the embargoed countries as ISO 3166-1 alpha-2 codes. A country cannot be in both lists.
+// @Tags admin/checkout
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CountrySettingsRequest true "Checkout countries"
+// @Success 200 {object} CountrySettingsRequest
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/checkout/countries [put]
+func (h *AddressHandler) AdminUpdateCountrySettings(c *gin.Context) {
+	var req CountrySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	settings, err := h.addressService.UpdateSettings(address.Settings{
+		AllowedCountries:   req.AllowedCountries,
+		EmbargoedCountries: req.EmbargoedCountries,
+	})
+	if err != nil {
+		writeAddressError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CountrySettingsRequest{
+		AllowedCountries:   settings.AllowedCountries,
+		EmbargoedCountries: settings.EmbargoedCountries,
+	})
+}
+
+func writeAddressError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, address.ErrInvalidAddress), err == address.ErrInvalidCountry, err == address.ErrConflictingLists:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err == address.ErrCountryNotSold, err == address.ErrCountryEmbargoed:
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check address"})
+	}
+}
+
+// Request/Response types
+
+type AddressRequest struct {
+	Address1   string `json:"address1" binding:"max=255"`
+	Address2   string `json:"address2" binding:"max=255"`
+	City       string `json:"city" binding:"max=100"`
+	State      string `json:"state" binding:"max=100"`
+	PostalCode string `json:"postal_code" binding:"max=20"`
+	Country    string `json:"country" binding:"max=2"` // ISO 3166-1 alpha-2
+}
+
+type CountrySettingsRequest struct {
+	AllowedCountries   []string `json:"allowed_countries"` // Empty sells to every country
+	EmbargoedCountries []string `json:"embargoed_countries"`
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/adminaccess"
+	"github.com/openhost/openhost/internal/core/service/auth"
+)
+
+// adminAccessBlockedMessage explains a blocked admin request and how to
+// get access again
+const adminAccessBlockedMessage = "Admin access is not allowed from %s. Ask another admin to add this address to the admin allow-list or your trusted IPs, or use a recovery token at POST /api/v1/admin-access/recover."
+
+// AdminAccessHandler restricts the admin area to allowed addresses and
+// lets admins manage the allow-lists
+type AdminAccessHandler struct {
+	accessService *adminaccess.Service
+	authService   *auth.Service
+}
+
+// NewAdminAccessHandler creates a new admin access handler
+func NewAdminAccessHandler(accessService *adminaccess.Service, authService *auth.Service) *AdminAccessHandler {
+	return &AdminAccessHandler{accessService: accessService, authService: authService}
+}
+
+// Middleware blocks admin API requests from addresses outside the admin
+// allow-list and the trusted IPs of the admin. It goes after
+// AdminMiddleware.
+func (h *AdminAccessHandler) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetCurrentUser(c)
+		ip := c.ClientIP()
+		if h.accessService.Allowed(ip, user) {
+			c.Next()
+			return
+		}
+		h.accessService.RecordBlocked(ip, c.GetHeader("User-Agent"), c.Request.URL.Path, user)
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf(adminAccessBlockedMessage, ip)})
+	}
+}
+
+// PageAccess reports whether a request may reach the admin panel pages,
+// recording it in the audit log when not. Signed in admins are also let
+// through from their trusted IPs.
+func (h *AdminAccessHandler) PageAccess(c *gin.Context) bool {
+	var user *domain.User
+	if token := extractToken(c); token != "" {
+		if u, err := h.authService.ValidateSession(token); err == nil {
+			user = u
+		}
+	}
+	ip := c.ClientIP()
+	if h.accessService.Allowed(ip, user) {
+		return true
+	}
+	h.accessService.RecordBlocked(ip, c.GetHeader("User-Agent"), c.Request.URL.Path, user)
+	return false
+}
+
+// AdminGetAccess godoc
+// @Summary Admin: Get admin area access restrictions
+// @Description Returns the admin allow-list, the trusted IPs of the admin, the address the request came from and whether a recovery token is waiting to be used
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AdminAccessResponse
+// @Router /api/v1/admin/access [get]
+func (h *AdminAccessHandler) AdminGetAccess(c *gin.Context) {
+	tokenSet, err := h.accessService.RecoveryTokenSet()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch admin access settings"})
+		return
+	}
+	user := GetCurrentUser(c)
+	trusted, _ := adminaccess.ParseRanges(user.TrustedIPs)
+	c.JSON(http.StatusOK, AdminAccessResponse{
+		AllowedIPs:       formatRanges(h.accessService.AllowedIPs()),
+		TrustedIPs:       formatRanges(trusted),
+		YourIP:           c.ClientIP(),
+		RecoveryTokenSet: tokenSet,
+	})
+}
+
+// AdminUpdateAllowedIPs godoc
+// @Summary Admin: Set the admin allow-list
+// @Description Only requests from these addresses reach the admin panel and admin API, plus those from the trusted IPs of each admin. An empty list with no trusted IPs allows every address. A list that would block the address of the request is refused.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateIPRangesRequest true "IP addresses and CIDR ranges"
+// @Success 200 {object} AdminAccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/access/allowed-ips [put]
+func (h *AdminAccessHandler) AdminUpdateAllowedIPs(c *gin.Context) {
+	var req UpdateIPRangesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user := GetCurrentUser(c)
+	if _, err := h.accessService.SetAllowedIPs(req.IPs, user, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		h.writeUpdateError(c, err)
+		return
+	}
+	h.AdminGetAccess(c)
+}
+
+// AdminUpdateTrustedIPs godoc
+// @Summary Admin: Set the trusted IPs of an admin
+// @Description The admin also reaches the admin area from these addresses. Admins setting their own are refused a list that would block the address of the request.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Admin user ID"
+// @Param request body UpdateIPRangesRequest true "IP addresses and CIDR ranges"
+// @Success 200 {object} TrustedIPsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/access/admins/{id}/trusted-ips [put]
+func (h *AdminAccessHandler) AdminUpdateTrustedIPs(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+	var req UpdateIPRangesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	updated, err := h.accessService.SetTrustedIPs(userID, req.IPs, GetCurrentUser(c), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		h.writeUpdateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toTrustedIPsResponse(updated))
+}
+
+// AdminCreateRecoveryToken godoc
+// @Summary Admin: Create an admin recovery token
+// @Description Creates the one-time token a locked out admin adds their address to their trusted IPs with, replacing any previous one. The token is shown only in this response.
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} RecoveryTokenResponse
+// @Router /api/v1/admin/access/recovery-token [post]
+func (h *AdminAccessHandler) AdminCreateRecoveryToken(c *gin.Context) {
+	adminID := GetCurrentUserID(c)
+	token, err := h.accessService.CreateRecoveryToken(&adminID, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create recovery token"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, RecoveryTokenResponse{Token: token})
+}
+
+// AdminListBlockedAccess godoc
+// @Summary Admin: List blocked admin area requests
+// @Description Returns the audit log of admin area requests blocked by the allow-lists, newest first. Each address is recorded at most once a minute.
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Items per page" default(20)
+// @Param page query int false "Page number" default(1)
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/access/blocked [get]
+func (h *AdminAccessHandler) AdminListBlockedAccess(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	entries, total, err := h.accessService.ListBlocked(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch blocked requests"})
+		return
+	}
+
+	response := make([]BlockedAccessResponse, 0, len(entries))
+	for _, entry := range entries {
+		item := BlockedAccessResponse{
+			ID:        entry.ID,
+			UserID:    entry.UserID,
+			IPAddress: entry.IPAddress,
+			UserAgent: entry.UserAgent,
+			CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+		}
+		if path, ok := entry.NewValues["path"].(string); ok {
+			item.Path = path
+		}
+		if entry.User != nil {
+			item.UserEmail = entry.User.Email
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// RecoverAdminAccess godoc
+// @Summary Recover admin area access
+// @Description Adds the address of the request to the trusted IPs of the signed in admin with a recovery token, created by another admin or with "server admin-access-recover". The token works once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RecoverAdminAccessRequest true "Recovery token"
+// @Success 200 {object} TrustedIPsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/admin-access/recover [post]
+func (h *AdminAccessHandler) RecoverAdminAccess(c *gin.Context) {
+	var req RecoverAdminAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	updated, err := h.accessService.Recover(req.Token, GetCurrentUser(c), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		switch {
+		case errors.Is(err, adminaccess.ErrNotAdmin):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Admin access required"})
+		case errors.Is(err, adminaccess.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or already used recovery token"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to recover admin access"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, toTrustedIPsResponse(updated))
+}
+
+func (h *AdminAccessHandler) writeUpdateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, adminaccess.ErrInvalidRange), errors.Is(err, adminaccess.ErrNotAdmin):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, adminaccess.ErrSelfLockout):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "The change would block your address " + c.ClientIP() + "; include it in the allow-list or your trusted IPs"})
+	case errors.Is(err, adminaccess.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update admin access settings"})
+	}
+}
+
+func toTrustedIPsResponse(user *domain.User) TrustedIPsResponse {
+	trusted, _ := adminaccess.ParseRanges(user.TrustedIPs)
+	return TrustedIPsResponse{UserID: user.ID, TrustedIPs: formatRanges(trusted)}
+}
+
+func formatRanges(ranges []netip.Prefix) []string {
+	list := make([]string, len(ranges))
+	for i, prefix := range ranges {
+		list[i] = prefix.String()
+	}
+	return list
+}
+
+// Request/Response types
+
+type UpdateIPRangesRequest struct {
+	IPs []string `json:"ips" binding:"max=500"` // IP addresses and CIDR ranges, empty to remove the restriction
+}
+
+type RecoverAdminAccessRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type AdminAccessResponse struct {
+	AllowedIPs       []string `json:"allowed_ips"`
+	TrustedIPs       []string `json:"trusted_ips"` // Of the signed in admin
+	YourIP           string   `json:"your_ip"`
+	RecoveryTokenSet bool     `json:"recovery_token_set"`
+}
+
+type TrustedIPsResponse struct {
+	UserID     uint64   `json:"user_id"`
+	TrustedIPs []string `json:"trusted_ips"`
+}
+
+type RecoveryTokenResponse struct {
+	Token string `json:"token"`
+}
+
+type BlockedAccessResponse struct {
+	ID        uint64  `json:"id"`
+	UserID    *uint64 `json:"user_id"`
+	UserEmail string  `json:"user_email,omitempty"`
+	IPAddress string  `json:"ip_address"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Path      string  `json:"path,omitempty"`
+	CreatedAt string  `json:"created_at"`
+}
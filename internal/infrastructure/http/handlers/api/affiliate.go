@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
@@ -243,7 +246,7 @@ func (h *AffiliateHandler) UpdateSettings(c *gin.Context) {
 
 // GetBanners gets available promotional banners
 // @Summary Get promotional banners
-// @Description Get available banners for affiliates
+// @Description Get available banners for affiliates, with the link and HTML code of each for the current affiliate
 // @Tags Affiliates
 // @Produce json
 // @Success 200 {object} map[string]interface{}
@@ -255,43 +258,185 @@ func (h *AffiliateHandler) GetBanners(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"banners": banners})
+	// Affiliates get the codes to embed each banner with
+	var aff *domain.Affiliate
+	if customerID, exists := c.Get("customer_id"); exists {
+		if found, err := h.service.GetAffiliateByCustomer(customerID.(uint64)); err == nil && found.IsActive() {
+			aff = found
+		}
+	}
+
+	response := make([]AffiliateBannerResponse, 0, len(banners))
+	for i := range banners {
+		banner := toAffiliateBannerResponse(&banners[i])
+		if aff != nil {
+			banner.Link = h.service.BannerLink(&banners[i], aff)
+			banner.HTML = h.service.BannerHTML(&banners[i], aff)
+			banner.EmbedURL = h.service.BannerEmbedURL(&banners[i], aff)
+		}
+		response = append(response, banner)
+	}
+	c.JSON(http.StatusOK, gin.H{"banners": response})
+}
+
+// GetStats gets the click funnel of the current affiliate
+// @Summary Get affiliate funnel
+// @Description Get the clicks on the affiliate links, the signups and first orders they brought, by UTM source and campaign and by landing page
+// @Tags Affiliates
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD), 30 days ago by default"
+// @Param to query string false "End date (YYYY-MM-DD), today by default"
+// @Success 200 {object} AffiliateFunnelResponse
+// @Router /api/v1/affiliate/stats [get]
+func (h *AffiliateHandler) GetStats(c *gin.Context) {
+	customerID, exists := c.Get("customer_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	aff, err := h.service.GetAffiliateByCustomer(customerID.(uint64))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an affiliate"})
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		to = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	funnel, err := h.service.GetFunnel(aff.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := AffiliateFunnelResponse{
+		From:         from,
+		To:           to,
+		Clicks:       funnel.Clicks,
+		Signups:      funnel.Signups,
+		Orders:       funnel.Orders,
+		SignupRate:   funnel.SignupRate(),
+		OrderRate:    funnel.OrderRate(),
+		Sources:      toFunnelRowResponses(funnel.Sources),
+		LandingPages: toFunnelRowResponses(funnel.LandingPages),
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // TrackClick tracks an affiliate referral click
 // @Summary Track click
-// @Description Track a click on an affiliate link
+// @Description Track a click on an affiliate link with its landing page and UTM parameters, and set the attribution cookie crediting a signup to the affiliate
 // @Tags Affiliates
 // @Accept json
 // @Produce json
 // @Param code path string true "Referral code"
+// @Param landing query string false "Landing page path"
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/ref/{code} [get]
 func (h *AffiliateHandler) TrackClick(c *gin.Context) {
-	code := c.Param("code")
+	landingPage := c.Query("landing")
+	if landingPage == "" {
+		landingPage = c.Request.URL.String()
+	}
 
-	aff, err := h.service.GetAffiliateByCode(code)
+	referral, err := h.service.TrackVisit(c.Param("code"), referralVisit(c, landingPage))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "invalid referral code"})
+		if errors.Is(err, affiliate.ErrAffiliateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid referral code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setReferralCookie(c, referral.Token, h.service.CookieDays())
+
+	c.JSON(http.StatusOK, gin.H{
+		"referral_id": referral.ID,
+		"affiliate":   referral.Affiliate.CustomerID,
+	})
+}
+
+// referralVisit describes a visit through an affiliate link from its
+// request
+func referralVisit(c *gin.Context, landingPage string) affiliate.Visit {
+	return affiliate.Visit{
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.GetHeader("User-Agent"),
+		ReferrerURL: c.GetHeader("Referer"),
+		LandingPage: landingPage,
+		UTM: affiliate.UTM{
+			Source:   c.Query("utm_source"),
+			Medium:   c.Query("utm_medium"),
+			Campaign: c.Query("utm_campaign"),
+			Term:     c.Query("utm_term"),
+			Content:  c.Query("utm_content"),
+		},
+	}
+}
 
-	ipAddress := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
-	referrer := c.GetHeader("Referer")
-	landingPage := c.Request.URL.String()
+// setReferralCookie keeps the referral of a visitor for the given days
+func setReferralCookie(c *gin.Context, token string, days int) {
+	c.SetCookie(affiliate.ReferralCookie, token, days*24*60*60, "/", "", c.Request.TLS != nil, true)
+}
 
-	if err := h.service.TrackClick(aff.ID, ipAddress, userAgent, referrer, landingPage, nil); err != nil {
-		// Log error but don't fail
+// attributeSignup credits a new customer to the affiliate in the referral
+// cookie of the request, if any
+func attributeSignup(c *gin.Context, service *affiliate.Service, customerID uint64) {
+	token, err := c.Cookie(affiliate.ReferralCookie)
+	if err != nil || token == "" || service == nil {
+		return
+	}
+	err = service.AttributeSignup(token, customerID, time.Now())
+	if err != nil && !errors.Is(err, affiliate.ErrReferralNotFound) && !errors.Is(err, affiliate.ErrReferralExpired) {
+		log.Printf("failed to credit signup of customer %d to affiliate: %v", customerID, err)
 	}
+}
 
-	// Create referral
-	referral, _ := h.service.CreateReferral(aff.ID, ipAddress, userAgent, referrer, landingPage)
+func toAffiliateBannerResponse(banner *domain.AffiliateBanner) AffiliateBannerResponse {
+	return AffiliateBannerResponse{
+		ID:          banner.ID,
+		Name:        banner.Name,
+		ImageURL:    banner.ImageURL,
+		Width:       banner.Width,
+		Height:      banner.Height,
+		TargetURL:   banner.TargetURL,
+		ProductID:   banner.ProductID,
+		HTMLCode:    banner.HTMLCode,
+		Active:      banner.Active,
+		SortOrder:   banner.SortOrder,
+		Impressions: banner.Impressions,
+		Clicks:      banner.Clicks,
+	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"referral_id": referral.ID,
-		"affiliate":   aff.CustomerID,
-	})
+func toFunnelRowResponses(rows []affiliate.FunnelRow) []FunnelRowResponse {
+	response := make([]FunnelRowResponse, 0, len(rows))
+	for _, row := range rows {
+		response = append(response, FunnelRowResponse{
+			UTMSource:   row.UTMSource,
+			UTMCampaign: row.UTMCampaign,
+			LandingPage: row.LandingPage,
+			Clicks:      row.Clicks,
+			Signups:     row.Signups,
+			Orders:      row.Orders,
+		})
+	}
+	return response
 }
 
 // Request/Response types
@@ -309,6 +454,71 @@ type UpdateAffiliateSettingsRequest struct {
 	PayoutEmail  string `json:"payout_email"`
 }
 
+type BannerRequest struct {
+	Name      string  `json:"name" binding:"required"`
+	ImageURL  string  `json:"image_url"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	TargetURL string  `json:"target_url"`
+	ProductID *uint64 `json:"product_id"`
+	HTMLCode  string  `json:"html_code"`
+	Active    *bool   `json:"active"`
+	SortOrder int     `json:"sort_order"`
+}
+
+func (r BannerRequest) input() affiliate.BannerInput {
+	return affiliate.BannerInput{
+		Name:      r.Name,
+		ImageURL:  r.ImageURL,
+		Width:     r.Width,
+		Height:    r.Height,
+		TargetURL: r.TargetURL,
+		ProductID: r.ProductID,
+		HTMLCode:  r.HTMLCode,
+		Active:    r.Active == nil || *r.Active,
+		SortOrder: r.SortOrder,
+	}
+}
+
+type AffiliateBannerResponse struct {
+	ID          uint64  `json:"id"`
+	Name        string  `json:"name"`
+	ImageURL    string  `json:"image_url"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	TargetURL   string  `json:"target_url,omitempty"`
+	ProductID   *uint64 `json:"product_id,omitempty"`
+	HTMLCode    string  `json:"html_code,omitempty"`
+	Active      bool    `json:"active"`
+	SortOrder   int     `json:"sort_order"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	Link        string  `json:"link,omitempty"`
+	HTML        string  `json:"html,omitempty"`
+	EmbedURL    string  `json:"embed_url,omitempty"`
+}
+
+type AffiliateFunnelResponse struct {
+	From         time.Time           `json:"from"`
+	To           time.Time           `json:"to"`
+	Clicks       int64               `json:"clicks"`
+	Signups      int64               `json:"signups"`
+	Orders       int64               `json:"orders"`
+	SignupRate   float64             `json:"signup_rate"`
+	OrderRate    float64             `json:"order_rate"`
+	Sources      []FunnelRowResponse `json:"sources"`
+	LandingPages []FunnelRowResponse `json:"landing_pages"`
+}
+
+type FunnelRowResponse struct {
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+	LandingPage string `json:"landing_page,omitempty"`
+	Clicks      int64  `json:"clicks"`
+	Signups     int64  `json:"signups"`
+	Orders      int64  `json:"orders"`
+}
+
 // Admin handlers
 
 // AdminListAffiliates lists all affiliates (admin only)
@@ -398,3 +608,86 @@ func (h *AffiliateHandler) AdminProcessWithdrawal(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Withdrawal processed"})
 }
+
+// AdminListBanners lists every affiliate banner with its counters
+func (h *AffiliateHandler) AdminListBanners(c *gin.Context) {
+	banners, err := h.service.ListBanners()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]AffiliateBannerResponse, 0, len(banners))
+	for i := range banners {
+		response = append(response, toAffiliateBannerResponse(&banners[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"banners": response})
+}
+
+// AdminCreateBanner adds an affiliate banner
+func (h *AffiliateHandler) AdminCreateBanner(c *gin.Context) {
+	var req BannerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	banner, err := h.service.CreateBanner(req.input())
+	if err != nil {
+		writeBannerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"banner": toAffiliateBannerResponse(banner)})
+}
+
+// AdminUpdateBanner replaces the fields of an affiliate banner
+func (h *AffiliateHandler) AdminUpdateBanner(c *gin.Context) {
+	bannerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid banner ID"})
+		return
+	}
+
+	var req BannerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	banner, err := h.service.UpdateBanner(bannerID, req.input())
+	if err != nil {
+		writeBannerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"banner": toAffiliateBannerResponse(banner)})
+}
+
+// AdminDeleteBanner removes an affiliate banner
+func (h *AffiliateHandler) AdminDeleteBanner(c *gin.Context) {
+	bannerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid banner ID"})
+		return
+	}
+
+	if err := h.service.DeleteBanner(bannerID); err != nil {
+		writeBannerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Banner deleted"})
+}
+
+func writeBannerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, affiliate.ErrBannerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, affiliate.ErrBannerName), errors.Is(err, affiliate.ErrBannerCreative),
+		errors.Is(err, affiliate.ErrBannerTargetURL), errors.Is(err, affiliate.ErrBannerProduct):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
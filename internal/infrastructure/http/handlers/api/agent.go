@@ -0,0 +1,480 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/agent"
+)
+
+// taskLogPage bounds the log lines returned with a task
+const taskLogPage = 1000
+
+// AgentHandler lets admins enroll nodes running the node agent and queue
+// tasks for them
+type AgentHandler struct {
+	agentService *agent.Service
+}
+
+// NewAgentHandler creates a new agent handler
+func NewAgentHandler(agentService *agent.Service) *AgentHandler {
+	return &AgentHandler{agentService: agentService}
+}
+
+// AdminListNodes godoc
+// @Summary Admin: List nodes
+// @Description Returns the nodes running the agent with the capacity and health they last reported
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/nodes [get]
+func (h *AgentHandler) AdminListNodes(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	nodes, total, err := h.agentService.ListNodes(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch nodes"})
+		return
+	}
+
+	response := make([]NodeResponse, 0, len(nodes))
+	for i := range nodes {
+		response = append(response, h.toNodeResponse(&nodes[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminCreateNode godoc
+// @Summary Admin: Create node
+// @Description Adds a node and returns its enrollment token, shown once. The agent registers with the token within 24 hours. A node linked to a server keeps the server's memory, disk and status up to date.
+// @Tags admin/nodes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateNodeRequest true "Node details"
+// @Success 201 {object} NodeEnrollmentResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes [post]
+func (h *AgentHandler) AdminCreateNode(c *gin.Context) {
+	var req CreateNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	node, token, err := h.agentService.CreateNode(req.Name, req.ServerID)
+	if err != nil {
+		h.writeNodeError(c, err, "Failed to create node")
+		return
+	}
+	c.JSON(http.StatusCreated, h.toEnrollmentResponse(node, token))
+}
+
+// AdminGetNode godoc
+// @Summary Admin: Get node
+// @Description Returns a node with the capacity and health it last reported
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Success 200 {object} NodeResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id} [get]
+func (h *AgentHandler) AdminGetNode(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	node, err := h.agentService.GetNode(id)
+	if err != nil {
+		h.writeNodeError(c, err, "Failed to fetch node")
+		return
+	}
+	c.JSON(http.StatusOK, h.toNodeResponse(node))
+}
+
+// AdminUpdateNode godoc
+// @Summary Admin: Update node
+// @Description Renames a node, links it to a server (0 unlinks it) or disables it. The agent of a disabled node is refused and gets no tasks until it is enabled again.
+// @Tags admin/nodes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Param request body UpdateNodeRequest true "Changes"
+// @Success 200 {object} NodeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id} [put]
+func (h *AgentHandler) AdminUpdateNode(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	var req UpdateNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	node, err := h.agentService.UpdateNode(id, agent.NodeUpdate{
+		Name:     req.Name,
+		ServerID: req.ServerID,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		h.writeNodeError(c, err, "Failed to update node")
+		return
+	}
+	c.JSON(http.StatusOK, h.toNodeResponse(node))
+}
+
+// AdminDeleteNode godoc
+// @Summary Admin: Delete node
+// @Description Deletes a node with its tasks and their logs. Its agent is refused from then on.
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id} [delete]
+func (h *AgentHandler) AdminDeleteNode(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	if err := h.agentService.DeleteNode(id); err != nil {
+		h.writeNodeError(c, err, "Failed to delete node")
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Node deleted"})
+}
+
+// AdminEnrollNode godoc
+// @Summary Admin: Re-enroll node
+// @Description Issues a new enrollment token for a node, such as after its agent was reinstalled, shown once. The node token of the current agent stops working.
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Success 200 {object} NodeEnrollmentResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id}/enroll [post]
+func (h *AgentHandler) AdminEnrollNode(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	node, token, err := h.agentService.Enroll(id)
+	if err != nil {
+		h.writeNodeError(c, err, "Failed to enroll node")
+		return
+	}
+	node, err = h.agentService.GetNode(node.ID)
+	if err != nil {
+		h.writeNodeError(c, err, "Failed to fetch node")
+		return
+	}
+	c.JSON(http.StatusOK, h.toEnrollmentResponse(node, token))
+}
+
+// AdminCreateNodeTask godoc
+// @Summary Admin: Queue a task on a node
+// @Description Queues an action for the agent of a node. The agent runs the executable of that name in its actions directory with the args as JSON on stdin, streaming its output back. Tasks not picked up before ttl_seconds expire.
+// @Tags admin/nodes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Param request body CreateNodeTaskRequest true "Task"
+// @Success 201 {object} AgentTaskResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id}/tasks [post]
+func (h *AgentHandler) AdminCreateNodeTask(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	var req CreateNodeTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID := GetCurrentUserID(c)
+	task, err := h.agentService.Enqueue(id, agent.TaskRequest{
+		Action:    req.Action,
+		Args:      req.Args,
+		ServiceID: req.ServiceID,
+		Timeout:   time.Duration(req.TimeoutSeconds) * time.Second,
+		TTL:       time.Duration(req.TTLSeconds) * time.Second,
+		CreatedBy: &userID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, agent.ErrInvalidAction), errors.Is(err, agent.ErrInvalidTimeout):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			h.writeNodeError(c, err, "Failed to queue task")
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, toAgentTaskResponse(task))
+}
+
+// AdminListNodeTasks godoc
+// @Summary Admin: List the tasks of a node
+// @Description Returns the tasks queued for a node, newest first, without their logs
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Node ID"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/nodes/{id}/tasks [get]
+func (h *AgentHandler) AdminListNodeTasks(c *gin.Context) {
+	id, ok := parseNodeID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.agentService.GetNode(id); err != nil {
+		h.writeNodeError(c, err, "Failed to fetch node")
+		return
+	}
+
+	limit, offset := PaginationParams(c)
+	tasks, total, err := h.agentService.ListTasks(id, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch tasks"})
+		return
+	}
+	response := make([]AgentTaskResponse, 0, len(tasks))
+	for i := range tasks {
+		response = append(response, toAgentTaskResponse(&tasks[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetAgentTask godoc
+// @Summary Admin: Get agent task
+// @Description Returns a task with up to 1000 of its log lines. Pass the ID of the last line received as after_log to follow a running task.
+// @Tags admin/nodes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param after_log query int false "Only log lines after this ID"
+// @Success 200 {object} AgentTaskResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/agent-tasks/{id} [get]
+func (h *AgentHandler) AdminGetAgentTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid task ID"})
+		return
+	}
+	var afterLog uint64
+	if v := c.Query("after_log"); v != "" {
+		if afterLog, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid after_log"})
+			return
+		}
+	}
+
+	task, err := h.agentService.GetTask(id)
+	if err != nil {
+		if errors.Is(err, agent.ErrTaskNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch task"})
+		return
+	}
+	logs, err := h.agentService.TaskLogs(task.ID, afterLog, taskLogPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch task logs"})
+		return
+	}
+
+	resp := toAgentTaskResponse(task)
+	resp.Logs = make([]AgentTaskLogResponse, 0, len(logs))
+	for _, l := range logs {
+		resp.Logs = append(resp.Logs, AgentTaskLogResponse{
+			ID:       l.ID,
+			Stream:   l.Stream,
+			Line:     l.Line,
+			LoggedAt: l.LoggedAt.Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func parseNodeID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid node ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *AgentHandler) writeNodeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, agent.ErrNodeNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Node not found"})
+	case errors.Is(err, agent.ErrServerNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Server not found"})
+	case errors.Is(err, agent.ErrNameRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fallback})
+	}
+}
+
+func (h *AgentHandler) toNodeResponse(n *domain.AgentNode) NodeResponse {
+	resp := NodeResponse{
+		ID:              n.ID,
+		Name:            n.Name,
+		ServerID:        n.ServerID,
+		Status:          string(n.Status),
+		Online:          h.agentService.Online(n),
+		Hostname:        n.Hostname,
+		Version:         n.Version,
+		OS:              n.OS,
+		Arch:            n.Arch,
+		CPUCores:        n.CPUCores,
+		MemoryBytes:     n.MemoryBytes,
+		DiskBytes:       n.DiskBytes,
+		Load1:           n.Load1,
+		MemoryUsedBytes: n.MemoryUsedBytes,
+		DiskUsedBytes:   n.DiskUsedBytes,
+		UptimeSeconds:   n.UptimeSeconds,
+		CreatedAt:       n.CreatedAt.Format(time.RFC3339),
+	}
+	if n.Server != nil {
+		resp.ServerName = n.Server.Name
+	}
+	if n.RegisteredAt != nil {
+		resp.RegisteredAt = n.RegisteredAt.Format(time.RFC3339)
+	}
+	if n.LastSeenAt != nil {
+		resp.LastSeenAt = n.LastSeenAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func (h *AgentHandler) toEnrollmentResponse(n *domain.AgentNode, token string) NodeEnrollmentResponse {
+	resp := NodeEnrollmentResponse{Node: h.toNodeResponse(n), EnrollmentToken: token}
+	if n.EnrollmentExpiresAt != nil {
+		resp.ExpiresAt = n.EnrollmentExpiresAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func toAgentTaskResponse(t *domain.AgentTask) AgentTaskResponse {
+	resp := AgentTaskResponse{
+		ID:             t.ID,
+		NodeID:         t.NodeID,
+		ServiceID:      t.ServiceID,
+		Action:         t.Action,
+		Args:           t.Args,
+		Status:         string(t.Status),
+		TimeoutSeconds: t.TimeoutSeconds,
+		Output:         t.Output,
+		Error:          t.Error,
+		ExpiresAt:      t.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:      t.CreatedAt.Format(time.RFC3339),
+	}
+	if t.StartedAt != nil {
+		resp.StartedAt = t.StartedAt.Format(time.RFC3339)
+	}
+	if t.FinishedAt != nil {
+		resp.FinishedAt = t.FinishedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type CreateNodeRequest struct {
+	Name     string  `json:"name" binding:"required,max=100"`
+	ServerID *uint64 `json:"server_id"`
+}
+
+type UpdateNodeRequest struct {
+	Name     *string `json:"name" binding:"omitempty,max=100"`
+	ServerID *uint64 `json:"server_id"` // 0 unlinks the node
+	Disabled *bool   `json:"disabled"`
+}
+
+type CreateNodeTaskRequest struct {
+	Action         string         `json:"action" binding:"required"`
+	Args           domain.JSONMap `json:"args"`
+	ServiceID      *uint64        `json:"service_id"`
+	TimeoutSeconds int            `json:"timeout_seconds" binding:"min=0"` // 600 when 0
+	TTLSeconds     int            `json:"ttl_seconds" binding:"min=0"`     // 3600 when 0
+}
+
+type NodeResponse struct {
+	ID              uint64  `json:"id"`
+	Name            string  `json:"name"`
+	ServerID        *uint64 `json:"server_id"`
+	ServerName      string  `json:"server_name,omitempty"`
+	Status          string  `json:"status"`
+	Online          bool    `json:"online"` // Sent a heartbeat in the last 90 seconds
+	Hostname        string  `json:"hostname"`
+	Version         string  `json:"version"`
+	OS              string  `json:"os"`
+	Arch            string  `json:"arch"`
+	CPUCores        int     `json:"cpu_cores"`
+	MemoryBytes     int64   `json:"memory_bytes"`
+	DiskBytes       int64   `json:"disk_bytes"`
+	Load1           float64 `json:"load1"`
+	MemoryUsedBytes int64   `json:"memory_used_bytes"`
+	DiskUsedBytes   int64   `json:"disk_used_bytes"`
+	UptimeSeconds   int64   `json:"uptime_seconds"`
+	RegisteredAt    string  `json:"registered_at,omitempty"`
+	LastSeenAt      string  `json:"last_seen_at,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+type NodeEnrollmentResponse struct {
+	Node            NodeResponse `json:"node"`
+	EnrollmentToken string       `json:"enrollment_token"` // Shown once
+	ExpiresAt       string       `json:"expires_at"`
+}
+
+type AgentTaskResponse struct {
+	ID             uint64                 `json:"id"`
+	NodeID         uint64                 `json:"node_id"`
+	ServiceID      *uint64                `json:"service_id"`
+	Action         string                 `json:"action"`
+	Args           domain.JSONMap         `json:"args"`
+	Status         string                 `json:"status"`
+	TimeoutSeconds int                    `json:"timeout_seconds"`
+	Output         string                 `json:"output,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	ExpiresAt      string                 `json:"expires_at"`
+	StartedAt      string                 `json:"started_at,omitempty"`
+	FinishedAt     string                 `json:"finished_at,omitempty"`
+	CreatedAt      string                 `json:"created_at"`
+	Logs           []AgentTaskLogResponse `json:"logs,omitempty"`
+}
+
+type AgentTaskLogResponse struct {
+	ID       uint64 `json:"id"`
+	Stream   string `json:"stream"`
+	Line     string `json:"line"`
+	LoggedAt string `json:"logged_at"`
+}
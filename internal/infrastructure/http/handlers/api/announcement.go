@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/announcement"
+)
+
+// AnnouncementHandler serves announcements
+type AnnouncementHandler struct {
+	announcementService *announcement.Service
+}
+
+// NewAnnouncementHandler creates a new announcement handler
+func NewAnnouncementHandler(announcementService *announcement.Service) *AnnouncementHandler {
+	return &AnnouncementHandler{announcementService: announcementService}
+}
+
+// ListAnnouncements godoc
+// @Summary List announcements
+// @Description Returns the published announcements that have not expired, most important first
+// @Tags announcements
+// @Produce json
+// @Success 200 {array} AnnouncementResponse
+// @Router /api/v1/announcements [get]
+func (h *AnnouncementHandler) ListAnnouncements(c *gin.Context) {
+	announcements, err := h.announcementService.ListActive(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list announcements"})
+		return
+	}
+	c.JSON(http.StatusOK, toAnnouncementResponses(announcements))
+}
+
+// AdminListAnnouncements godoc
+// @Summary List all announcements
+// @Description Returns every announcement, published or not, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} AnnouncementResponse
+// @Router /api/v1/admin/announcements [get]
+func (h *AnnouncementHandler) AdminListAnnouncements(c *gin.Context) {
+	announcements, err := h.announcementService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list announcements"})
+		return
+	}
+	c.JSON(http.StatusOK, toAnnouncementResponses(announcements))
+}
+
+// AdminCreateAnnouncement godoc
+// @Summary Create announcement
+// @Description Adds an unpublished announcement. The body is Markdown.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAnnouncementRequest true "Announcement"
+// @Success 201 {object} AnnouncementResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/announcements [post]
+func (h *AnnouncementHandler) AdminCreateAnnouncement(c *gin.Context) {
+	var req CreateAnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	created, err := h.announcementService.Create(req.Title, req.Body, req.Type, req.Priority, req.ExpiresAt)
+	if err != nil {
+		writeAnnouncementError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toAnnouncementResponse(created))
+}
+
+// AdminPublishAnnouncement godoc
+// @Summary Publish announcement
+// @Description Publishes an announcement. Customers are emailed the first time it is published, at once or in their digest.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Announcement ID"
+// @Success 200 {object} AnnouncementResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/announcements/{id}/publish [post]
+func (h *AnnouncementHandler) AdminPublishAnnouncement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid announcement ID"})
+		return
+	}
+
+	published, err := h.announcementService.Publish(id)
+	if err != nil {
+		writeAnnouncementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toAnnouncementResponse(published))
+}
+
+// AdminUnpublishAnnouncement godoc
+// @Summary Unpublish announcement
+// @Description Hides an announcement from customers
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Announcement ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/announcements/{id}/unpublish [post]
+func (h *AnnouncementHandler) AdminUnpublishAnnouncement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid announcement ID"})
+		return
+	}
+
+	if err := h.announcementService.Unpublish(id); err != nil {
+		writeAnnouncementError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Announcement unpublished"})
+}
+
+func writeAnnouncementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, announcement.ErrAnnouncementNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Announcement not found"})
+	case errors.Is(err, announcement.ErrTitleRequired), errors.Is(err, announcement.ErrInvalidType):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save announcement"})
+	}
+}
+
+func toAnnouncementResponses(announcements []domain.Announcement) []AnnouncementResponse {
+	response := make([]AnnouncementResponse, 0, len(announcements))
+	for i := range announcements {
+		response = append(response, toAnnouncementResponse(&announcements[i]))
+	}
+	return response
+}
+
+func toAnnouncementResponse(a *domain.Announcement) AnnouncementResponse {
+	return AnnouncementResponse{
+		ID:          a.ID,
+		Title:       a.Title,
+		Body:        a.Body,
+		Type:        a.Type,
+		Priority:    a.Priority,
+		Published:   a.Published,
+		PublishedAt: a.PublishedAt,
+		ExpiresAt:   a.ExpiresAt,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+// Request/Response types
+
+type CreateAnnouncementRequest struct {
+	Title     string     `json:"title" binding:"required"`
+	Body      string     `json:"body"`
+	Type      string     `json:"type"`
+	Priority  int        `json:"priority"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type AnnouncementResponse struct {
+	ID          uint64     `json:"id"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	Type        string     `json:"type"`
+	Priority    int        `json:"priority"`
+	Published   bool       `json:"published"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
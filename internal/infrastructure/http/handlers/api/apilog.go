@@ -0,0 +1,303 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/apilog"
+)
+
+const (
+	// apiKeyContextKey holds the API key a request authenticated with
+	apiKeyContextKey = "api_key"
+	// apiActionContextKey holds the action of APIs taking it as a
+	// parameter, such as the WHMCS compatible API
+	apiActionContextKey = "api_action"
+	// apiLogCaptureLimit is how much of each body is read for redaction
+	// before it is cut to the body limit
+	apiLogCaptureLimit = 64 << 10
+)
+
+// APILogHandler records calls made with API keys and serves them to admins
+type APILogHandler struct {
+	apiLogService *apilog.Service
+}
+
+// NewAPILogHandler creates a new API log handler
+func NewAPILogHandler(apiLogService *apilog.Service) *APILogHandler {
+	return &APILogHandler{apiLogService: apiLogService}
+}
+
+// Middleware records the requests of a route group once they are done.
+// Requests that did not authenticate with an API key are not recorded.
+func (h *APILogHandler) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := max(apiLogCaptureLimit, h.apiLogService.BodyLimit())
+		start := time.Now()
+
+		request := &captureReader{ReadCloser: c.Request.Body, limit: limit}
+		if c.Request.Body != nil {
+			c.Request.Body = request
+		}
+		response := &captureWriter{ResponseWriter: c.Writer, limit: limit}
+		c.Writer = response
+
+		c.Next()
+
+		key := requestAPIKey(c)
+		if key == nil {
+			return
+		}
+		_, err := h.apiLogService.Record(apilog.Entry{
+			APIKeyID:     key.ID,
+			UserID:       key.UserID,
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			Action:       c.GetString(apiActionContextKey),
+			Query:        c.Request.URL.RawQuery,
+			Status:       c.Writer.Status(),
+			Duration:     time.Since(start),
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			ContentType:  c.ContentType(),
+			RequestBody:  request.buf.Bytes(),
+			ResponseBody: response.buf.Bytes(),
+			Truncated:    request.truncated || response.truncated,
+		})
+		if err != nil {
+			log.Printf("failed to record API request %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+	}
+}
+
+// AdminListLogs godoc
+// @Summary Admin: List API request logs
+// @Description Returns the calls made with API keys, newest first, without bodies. Passwords, secrets and card data are redacted.
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param api_key_id query int false "API key ID"
+// @Param user_id query int false "User the key acts as"
+// @Param path query string false "Path prefix"
+// @Param action query string false "WHMCS API action"
+// @Param method query string false "HTTP method"
+// @Param status query int false "Response status"
+// @Param failed query bool false "Only calls answered with a status of 400 or more"
+// @Param from query string false "From date (YYYY-MM-DD)"
+// @Param to query string false "To date (YYYY-MM-DD)"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/api-logs [get]
+func (h *APILogHandler) AdminListLogs(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	filter := apilog.Filter{
+		Path:   c.Query("path"),
+		Action: c.Query("action"),
+		Method: c.Query("method"),
+	}
+	if v := c.Query("api_key_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid API key ID"})
+			return
+		}
+		filter.APIKeyID = id
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+		filter.UserID = id
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid status"})
+			return
+		}
+		filter.Status = status
+	}
+	if failed, _ := strconv.ParseBool(c.Query("failed")); failed {
+		filter.StatusMin = http.StatusBadRequest
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date"})
+			return
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date"})
+			return
+		}
+		to := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		filter.To = &to
+	}
+
+	logs, total, err := h.apiLogService.List(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch API logs"})
+		return
+	}
+
+	response := make([]APIRequestLogResponse, 0, len(logs))
+	for i := range logs {
+		response = append(response, toAPIRequestLogResponse(&logs[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetLog godoc
+// @Summary Admin: Get API request log
+// @Description Returns a call made with an API key with its redacted request and response bodies
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Log ID"
+// @Success 200 {object} APIRequestLogResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/api-logs/{id} [get]
+func (h *APILogHandler) AdminGetLog(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid log ID"})
+		return
+	}
+
+	entry, err := h.apiLogService.Get(id)
+	if err != nil {
+		if err == apilog.ErrLogNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "API log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch API log"})
+		return
+	}
+
+	resp := toAPIRequestLogResponse(entry)
+	resp.RequestBody = entry.RequestBody
+	resp.ResponseBody = entry.ResponseBody
+	c.JSON(http.StatusOK, resp)
+}
+
+// setRequestAPIKey records the API key a request authenticated with
+func setRequestAPIKey(c *gin.Context, key *domain.APIKey) {
+	c.Set(apiKeyContextKey, key)
+}
+
+// requestAPIKey returns the API key a request authenticated with, nil if
+// none
+func requestAPIKey(c *gin.Context) *domain.APIKey {
+	if key, exists := c.Get(apiKeyContextKey); exists {
+		if k, ok := key.(*domain.APIKey); ok {
+			return k
+		}
+	}
+	return nil
+}
+
+// captureReader keeps the start of a request body as the handler reads it
+type captureReader struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.keep(p[:n])
+	return n, err
+}
+
+func (r *captureReader) keep(p []byte) {
+	if room := r.limit - r.buf.Len(); len(p) > room {
+		r.buf.Write(p[:room])
+		r.truncated = true
+		return
+	}
+	r.buf.Write(p)
+}
+
+// captureWriter keeps the start of a response body as it is written
+type captureWriter struct {
+	gin.ResponseWriter
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.keep(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) keep(p []byte) {
+	if room := w.limit - w.buf.Len(); len(p) > room {
+		w.buf.Write(p[:room])
+		w.truncated = true
+		return
+	}
+	w.buf.Write(p)
+}
+
+func toAPIRequestLogResponse(l *domain.APIRequestLog) APIRequestLogResponse {
+	return APIRequestLogResponse{
+		ID:         l.ID,
+		APIKeyID:   l.APIKeyID,
+		APIKeyName: l.APIKey.Name,
+		UserID:     l.UserID,
+		Method:     l.Method,
+		Path:       l.Path,
+		Action:     l.Action,
+		Query:      l.Query,
+		Status:     l.Status,
+		DurationMS: l.DurationMS,
+		IPAddress:  l.IPAddress,
+		UserAgent:  l.UserAgent,
+		Truncated:  l.Truncated,
+		CreatedAt:  l.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// Request/Response types
+
+type APIRequestLogResponse struct {
+	ID           uint64 `json:"id"`
+	APIKeyID     uint64 `json:"api_key_id"`
+	APIKeyName   string `json:"api_key_name"`
+	UserID       uint64 `json:"user_id"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Action       string `json:"action,omitempty"`
+	Query        string `json:"query,omitempty"`
+	Status       int    `json:"status"`
+	DurationMS   int64  `json:"duration_ms"`
+	IPAddress    string `json:"ip_address"`
+	UserAgent    string `json:"user_agent"`
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Truncated    bool   `json:"truncated"` // A body was cut to the length limit
+	CreatedAt    string `json:"created_at"`
+}
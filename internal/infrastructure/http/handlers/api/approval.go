@@ -0,0 +1,323 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/approval"
+)
+
+// ApprovalHandler lets admins configure the two-person rule and decide the
+// approval requests of dangerous actions
+type ApprovalHandler struct {
+	approvals *approval.Service
+}
+
+// NewApprovalHandler creates a new approval handler
+func NewApprovalHandler(approvals *approval.Service) *ApprovalHandler {
+	return &ApprovalHandler{approvals: approvals}
+}
+
+// holdForApproval answers a request for an action needing the approval of
+// a second admin with 202 and the approval request, reporting whether it
+// did. The action is carried out once approved.
+func holdForApproval(c *gin.Context, approvals *approval.Service, action string, params interface{}, summary string) bool {
+	if approvals == nil || !approvals.Required(action) {
+		return false
+	}
+	encoded, err := approval.EncodeParams(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request approval"})
+		return true
+	}
+	request, err := approvals.Request(action, encoded, summary, GetCurrentUserID(c), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request approval"})
+		return true
+	}
+	c.JSON(http.StatusAccepted, ApprovalPendingResponse{
+		Message:  "A second admin must approve this action before it is carried out",
+		Approval: toApprovalResponse(request),
+	})
+	return true
+}
+
+// AdminGetApprovalSettings godoc
+// @Summary Admin: Get the two-person rule
+// @Description Returns the actions a second admin must approve, those that can be made to, and the approval window
+// @Tags admin/approvals
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ApprovalSettingsResponse
+// @Router /api/v1/admin/approvals/settings [get]
+func (h *ApprovalHandler) AdminGetApprovalSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, h.toSettingsResponse(h.approvals.Settings()))
+}
+
+// AdminUpdateApprovalSettings godoc
+// @Summary Admin: Set the two-person rule
+// @Description Sets the actions a second admin must approve, none to turn the rule off, and how many minutes a request waits for approval
+// @Tags admin/approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateApprovalSettingsRequest true "Two-person rule"
+// @Success 200 {object} ApprovalSettingsResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/approvals/settings [put]
+func (h *ApprovalHandler) AdminUpdateApprovalSettings(c *gin.Context) {
+	var req UpdateApprovalSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	window := approval.DefaultWindow
+	if req.WindowMinutes != 0 {
+		window = time.Duration(req.WindowMinutes) * time.Minute
+	}
+
+	settings, err := h.approvals.UpdateSettings(req.Actions, window, GetCurrentUserID(c), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		if errors.Is(err, approval.ErrUnknownAction) || errors.Is(err, approval.ErrInvalidWindow) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update the two-person rule"})
+		return
+	}
+	c.JSON(http.StatusOK, h.toSettingsResponse(settings))
+}
+
+// AdminListApprovals godoc
+// @Summary Admin: List approval requests
+// @Description Returns the approval requests newest first, optionally of one status: pending, executed, failed, rejected, cancelled or expired
+// @Tags admin/approvals
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Status"
+// @Param limit query int false "Items per page" default(20)
+// @Param page query int false "Page number" default(1)
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/approvals [get]
+func (h *ApprovalHandler) AdminListApprovals(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	requests, total, err := h.approvals.List(domain.ApprovalStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch approval requests"})
+		return
+	}
+
+	response := make([]ApprovalResponse, 0, len(requests))
+	for i := range requests {
+		response = append(response, toApprovalResponse(&requests[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetApproval godoc
+// @Summary Admin: Get an approval request
+// @Description Returns an approval request with its audit trail: the request, the decision and the action carried out
+// @Tags admin/approvals
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Approval request ID"
+// @Success 200 {object} ApprovalDetailResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/approvals/{id} [get]
+func (h *ApprovalHandler) AdminGetApproval(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid approval request ID"})
+		return
+	}
+	request, err := h.approvals.Get(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	entries, err := h.approvals.AuditTrail(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch the audit trail"})
+		return
+	}
+
+	response := ApprovalDetailResponse{ApprovalResponse: toApprovalResponse(request), AuditTrail: make([]ApprovalAuditResponse, 0, len(entries))}
+	for _, entry := range entries {
+		response.AuditTrail = append(response.AuditTrail, ApprovalAuditResponse{
+			ID:          entry.ID,
+			Action:      entry.Action,
+			UserID:      entry.UserID,
+			IPAddress:   entry.IPAddress,
+			Description: entry.Description,
+			CreatedAt:   entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminApprove godoc
+// @Summary Admin: Approve a request
+// @Description Approves a pending request of another admin and carries out the action. The request is executed, or failed with the error of the action.
+// @Tags admin/approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Approval request ID"
+// @Param request body DecideApprovalRequest false "Note"
+// @Success 200 {object} ApprovalResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/approvals/{id}/approve [post]
+func (h *ApprovalHandler) AdminApprove(c *gin.Context) {
+	h.decide(c, h.approvals.Approve)
+}
+
+// AdminReject godoc
+// @Summary Admin: Reject a request
+// @Description Rejects a pending request without carrying out the action. Rejecting your own request cancels it.
+// @Tags admin/approvals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Approval request ID"
+// @Param request body DecideApprovalRequest false "Reason"
+// @Success 200 {object} ApprovalResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/approvals/{id}/reject [post]
+func (h *ApprovalHandler) AdminReject(c *gin.Context) {
+	h.decide(c, h.approvals.Reject)
+}
+
+func (h *ApprovalHandler) decide(c *gin.Context, decide func(id uint64, actor *domain.User, note, ip, userAgent string) (*domain.ApprovalRequest, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid approval request ID"})
+		return
+	}
+	var req DecideApprovalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	request, err := decide(id, GetCurrentUser(c), req.Note, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toApprovalResponse(request))
+}
+
+func (h *ApprovalHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, approval.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Approval request not found"})
+	case errors.Is(err, approval.ErrSelfApproval), errors.Is(err, approval.ErrNotAdmin):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrExpired):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to decide the approval request"})
+	}
+}
+
+func (h *ApprovalHandler) toSettingsResponse(settings approval.Settings) ApprovalSettingsResponse {
+	actions := settings.Actions
+	if actions == nil {
+		actions = []string{}
+	}
+	return ApprovalSettingsResponse{
+		Actions:          actions,
+		AvailableActions: h.approvals.Actions(),
+		WindowMinutes:    int(settings.Window.Minutes()),
+	}
+}
+
+func toApprovalResponse(request *domain.ApprovalRequest) ApprovalResponse {
+	response := ApprovalResponse{
+		ID:            request.ID,
+		Action:        request.Action,
+		Params:        request.Params,
+		Summary:       request.Summary,
+		Status:        string(request.Status),
+		RequestedByID: request.RequestedByID,
+		DecidedByID:   request.DecidedByID,
+		DecisionNote:  request.DecisionNote,
+		Result:        request.Result,
+		ExpiresAt:     request.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:     request.CreatedAt.Format(time.RFC3339),
+	}
+	if request.RequestedBy != nil {
+		response.RequestedByEmail = request.RequestedBy.Email
+	}
+	if request.DecidedBy != nil {
+		response.DecidedByEmail = request.DecidedBy.Email
+	}
+	if request.DecidedAt != nil {
+		decided := request.DecidedAt.Format(time.RFC3339)
+		response.DecidedAt = &decided
+	}
+	return response
+}
+
+// Request/Response types
+
+type UpdateApprovalSettingsRequest struct {
+	Actions       []string `json:"actions"`                                  // Empty turns the two-person rule off
+	WindowMinutes int      `json:"window_minutes" binding:"omitempty,min=5"` // 60 when unset
+}
+
+type DecideApprovalRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+type ApprovalSettingsResponse struct {
+	Actions          []string `json:"actions"`
+	AvailableActions []string `json:"available_actions"`
+	WindowMinutes    int      `json:"window_minutes"`
+}
+
+type ApprovalResponse struct {
+	ID               uint64         `json:"id"`
+	Action           string         `json:"action"`
+	Params           domain.JSONMap `json:"params"`
+	Summary          string         `json:"summary"`
+	Status           string         `json:"status"`
+	RequestedByID    uint64         `json:"requested_by_id"`
+	RequestedByEmail string         `json:"requested_by_email,omitempty"`
+	DecidedByID      *uint64        `json:"decided_by_id"`
+	DecidedByEmail   string         `json:"decided_by_email,omitempty"`
+	DecisionNote     string         `json:"decision_note,omitempty"`
+	Result           string         `json:"result,omitempty"`
+	ExpiresAt        string         `json:"expires_at"`
+	DecidedAt        *string        `json:"decided_at"`
+	CreatedAt        string         `json:"created_at"`
+}
+
+type ApprovalPendingResponse struct {
+	Message  string           `json:"message"`
+	Approval ApprovalResponse `json:"approval"`
+}
+
+type ApprovalDetailResponse struct {
+	ApprovalResponse
+	AuditTrail []ApprovalAuditResponse `json:"audit_trail"`
+}
+
+type ApprovalAuditResponse struct {
+	ID          uint64  `json:"id"`
+	Action      string  `json:"action"`
+	UserID      *uint64 `json:"user_id"`
+	IPAddress   string  `json:"ip_address,omitempty"`
+	Description string  `json:"description"`
+	CreatedAt   string  `json:"created_at"`
+}
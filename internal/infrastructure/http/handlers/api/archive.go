@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/archive"
+)
+
+// ArchiveHandler handles log archival API endpoints
+type ArchiveHandler struct {
+	archiveService *archive.Service
+}
+
+// NewArchiveHandler creates a new archive handler
+func NewArchiveHandler(archiveService *archive.Service) *ArchiveHandler {
+	return &ArchiveHandler{archiveService: archiveService}
+}
+
+// AdminListPolicies godoc
+// @Summary List archive policies (Admin)
+// @Description Returns the retention policy of every archived log table
+// @Tags admin/archive
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ArchivePolicyResponse
+// @Router /api/v1/admin/archive/policies [get]
+func (h *ArchiveHandler) AdminListPolicies(c *gin.Context) {
+	policies, err := h.archiveService.GetPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch archive policies"})
+		return
+	}
+
+	response := make([]ArchivePolicyResponse, 0, len(policies))
+	for _, policy := range policies {
+		item := ArchivePolicyResponse{
+			DataType:         policy.DataType,
+			RetentionDays:    policy.RetentionDays,
+			ArchiveAfterDays: policy.ArchiveAfterDays,
+			Active:           policy.Active,
+		}
+		if policy.LastRunAt != nil {
+			item.LastRunAt = policy.LastRunAt.Format(time.RFC3339)
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminUpdatePolicy godoc
+// @Summary Update archive policy (Admin)
+// @Description Updates retention and archive settings for a log table
+// @Tags admin/archive
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param type path string true "Data type"
+// @Param request body UpdateArchivePolicyRequest true "Policy settings"
+// @Success 200 {object} ArchivePolicyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/archive/policies/{type} [put]
+func (h *ArchiveHandler) AdminUpdatePolicy(c *gin.Context) {
+	var req UpdateArchivePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	policy, err := h.archiveService.UpdatePolicy(c.Param("type"), req.RetentionDays, req.ArchiveAfterDays, req.Active)
+	if err != nil {
+		switch err {
+		case archive.ErrUnknownDataType:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Unknown data type"})
+		case archive.ErrInvalidPolicy:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update archive policy"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ArchivePolicyResponse{
+		DataType:         policy.DataType,
+		RetentionDays:    policy.RetentionDays,
+		ArchiveAfterDays: policy.ArchiveAfterDays,
+		Active:           policy.Active,
+	})
+}
+
+// AdminRunArchive godoc
+// @Summary Run log archival (Admin)
+// @Description Moves aged rows into archive tables and exports and purges expired months now. Active policies also run once a day on their own.
+// @Tags admin/archive
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Only run for this data type"
+// @Success 200 {array} archive.RunResult
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/archive/run [post]
+func (h *ArchiveHandler) AdminRunArchive(c *gin.Context) {
+	if dataType := c.Query("type"); dataType != "" {
+		result, err := h.archiveService.RunTarget(dataType, time.Now())
+		if err != nil {
+			if err == archive.ErrUnknownDataType {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: "Unknown data type"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, []archive.RunResult{*result})
+		return
+	}
+
+	results, err := h.archiveService.Run(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// AdminListArchives godoc
+// @Summary List archive exports (Admin)
+// @Description Returns the compressed exports written before purging log rows
+// @Tags admin/archive
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Filter by data type"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/archive/exports [get]
+func (h *ArchiveHandler) AdminListArchives(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	archives, total, err := h.archiveService.ListArchives(c.Query("type"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch archive exports"})
+		return
+	}
+
+	response := make([]ArchiveExportResponse, 0, len(archives))
+	for _, a := range archives {
+		response = append(response, ArchiveExportResponse{
+			ID:          a.ID,
+			DataType:    a.DataType,
+			SourceTable: a.SourceTable,
+			PeriodStart: a.PeriodStart.Format(time.RFC3339),
+			PeriodEnd:   a.PeriodEnd.Format(time.RFC3339),
+			RowCount:    a.RowCount,
+			FilePath:    a.FilePath,
+			FileSize:    a.FileSize,
+			Checksum:    a.Checksum,
+			CreatedAt:   a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// Request/Response types
+
+type ArchivePolicyResponse struct {
+	DataType         string `json:"data_type"`
+	RetentionDays    int    `json:"retention_days"`
+	ArchiveAfterDays int    `json:"archive_after_days"`
+	Active           bool   `json:"active"`
+	LastRunAt        string `json:"last_run_at,omitempty"`
+}
+
+type UpdateArchivePolicyRequest struct {
+	RetentionDays    int  `json:"retention_days"`
+	ArchiveAfterDays int  `json:"archive_after_days"`
+	Active           bool `json:"active"`
+}
+
+type ArchiveExportResponse struct {
+	ID          uint64 `json:"id"`
+	DataType    string `json:"data_type"`
+	SourceTable string `json:"source_table"`
+	PeriodStart string `json:"period_start"`
+	PeriodEnd   string `json:"period_end"`
+	RowCount    int64  `json:"row_count"`
+	FilePath    string `json:"file_path"`
+	FileSize    int64  `json:"file_size"`
+	Checksum    string `json:"checksum"`
+	CreatedAt   string `json:"created_at"`
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/assist"
+)
+
+// AssistHandler serves AI drafted replies and summaries to admins
+type AssistHandler struct {
+	assistService *assist.Service
+}
+
+// NewAssistHandler creates a new assist handler
+func NewAssistHandler(assistService *assist.Service) *AssistHandler {
+	return &AssistHandler{assistService: assistService}
+}
+
+// AdminGetSettings godoc
+// @Summary Admin: Get AI assist settings
+// @Description Returns whether AI assist is configured and whether the current admin turned it on
+// @Tags admin/assist
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AssistSettingsResponse
+// @Router /api/v1/admin/assist/settings [get]
+func (h *AssistHandler) AdminGetSettings(c *gin.Context) {
+	enabled, err := h.assistService.IsEnabled(GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch assist settings"})
+		return
+	}
+	c.JSON(http.StatusOK, AssistSettingsResponse{
+		Available: h.assistService.Available(),
+		Enabled:   enabled,
+		Logging:   h.assistService.Logging(),
+	})
+}
+
+// AdminUpdateSettings godoc
+// @Summary Admin: Update AI assist settings
+// @Description Turns AI assist on or off for the current admin
+// @Tags admin/assist
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateAssistSettingsRequest true "Settings"
+// @Success 200 {object} AssistSettingsResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/assist/settings [put]
+func (h *AssistHandler) AdminUpdateSettings(c *gin.Context) {
+	var req UpdateAssistSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.assistService.SetEnabled(GetCurrentUserID(c), req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update assist settings"})
+		return
+	}
+	c.JSON(http.StatusOK, AssistSettingsResponse{
+		Available: h.assistService.Available(),
+		Enabled:   req.Enabled,
+		Logging:   h.assistService.Logging(),
+	})
+}
+
+// AdminDraftTicketReply godoc
+// @Summary Admin: Draft ticket reply
+// @Description Drafts a reply to a ticket from its latest messages. The draft is only returned; post it as a reply after reviewing it.
+// @Tags admin/assist
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Ticket ID"
+// @Param request body DraftTicketReplyRequest false "What the reply should say"
+// @Success 200 {object} AssistDraftResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/tickets/{id}/draft-reply [post]
+func (h *AssistHandler) AdminDraftTicketReply(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	var req DraftTicketReplyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	draft, err := h.assistService.DraftTicketReply(c.Request.Context(), GetCurrentUser(c), ticketID, req.Instructions)
+	if err != nil {
+		writeAssistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, AssistDraftResponse{Draft: draft.Content, Model: draft.Model})
+}
+
+// AdminSummarizeArticle godoc
+// @Summary Admin: Summarize article
+// @Description Drafts a short summary of a knowledge base article, e.g. for its excerpt. The article is not changed.
+// @Tags admin/assist
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Article ID"
+// @Success 200 {object} AssistDraftResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/kb/articles/{id}/summary [post]
+func (h *AssistHandler) AdminSummarizeArticle(c *gin.Context) {
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid article ID"})
+		return
+	}
+
+	draft, err := h.assistService.SummarizeArticle(c.Request.Context(), GetCurrentUser(c), articleID)
+	if err != nil {
+		writeAssistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, AssistDraftResponse{Draft: draft.Content, Model: draft.Model})
+}
+
+// AdminListLogs godoc
+// @Summary Admin: List AI assist requests
+// @Description Returns the logged AI assist requests, newest first. Prompts and responses are included only with full logging.
+// @Tags admin/assist
+// @Produce json
+// @Security BearerAuth
+// @Param admin_id query int false "Admin ID"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/assist/logs [get]
+func (h *AssistHandler) AdminListLogs(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	var adminID *uint64
+	if value := c.Query("admin_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid admin ID"})
+			return
+		}
+		adminID = &id
+	}
+
+	logs, total, err := h.assistService.ListLogs(adminID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch assist logs"})
+		return
+	}
+
+	response := make([]AssistLogResponse, 0, len(logs))
+	for i := range logs {
+		response = append(response, toAssistLogResponse(&logs[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func writeAssistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, assist.ErrNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, assist.ErrDisabled):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, assist.ErrTicketNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ticket not found"})
+	case errors.Is(err, assist.ErrArticleNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Article not found"})
+	case errors.Is(err, assist.ErrProviderFailed):
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate draft"})
+	}
+}
+
+func toAssistLogResponse(l *domain.AssistLog) AssistLogResponse {
+	return AssistLogResponse{
+		ID:               l.ID,
+		AdminID:          l.AdminID,
+		Kind:             l.Kind,
+		SubjectID:        l.SubjectID,
+		Provider:         l.Provider,
+		Model:            l.Model,
+		Prompt:           l.Prompt,
+		Response:         l.Response,
+		PromptTokens:     l.PromptTokens,
+		CompletionTokens: l.CompletionTokens,
+		DurationMS:       l.DurationMS,
+		Error:            l.Error,
+		CreatedAt:        l.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// Request/Response types
+
+type AssistSettingsResponse struct {
+	Available bool   `json:"available"` // A provider is configured
+	Enabled   bool   `json:"enabled"`   // The current admin turned AI assist on
+	Logging   string `json:"logging"`   // none, metadata or full
+}
+
+type UpdateAssistSettingsRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type DraftTicketReplyRequest struct {
+	Instructions string `json:"instructions"` // What the reply should say, e.g. "the refund was approved"
+}
+
+type AssistDraftResponse struct {
+	Draft string `json:"draft"`
+	Model string `json:"model"`
+}
+
+type AssistLogResponse struct {
+	ID               uint64 `json:"id"`
+	AdminID          uint64 `json:"admin_id"`
+	Kind             string `json:"kind"`
+	SubjectID        uint64 `json:"subject_id"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model,omitempty"`
+	Prompt           string `json:"prompt,omitempty"`
+	Response         string `json:"response,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	DurationMS       int64  `json:"duration_ms"`
+	Error            string `json:"error,omitempty"`
+	CreatedAt        string `json:"created_at"`
+}
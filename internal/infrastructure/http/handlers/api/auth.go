@@ -4,21 +4,32 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/affiliate"
 	"github.com/openhost/openhost/internal/core/service/auth"
 )
 
 // AuthHandler handles authentication API endpoints
 type AuthHandler struct {
-	authService *auth.Service
+	authService      *auth.Service
+	accountService   *account.Service
+	affiliateService *affiliate.Service
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService *auth.Service) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *auth.Service, accountService *account.Service) *AuthHandler {
+	return &AuthHandler{authService: authService, accountService: accountService}
+}
+
+// SetAffiliateService credits signups to the affiliate whose link the
+// customer came through
+func (h *AuthHandler) SetAffiliateService(affiliateService *affiliate.Service) {
+	h.affiliateService = affiliateService
 }
 
 // RegisterRequest represents a registration request
@@ -27,11 +38,17 @@ type RegisterRequest struct {
 	Password  string `json:"password" binding:"required,min=8"`
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
+	// Currency the customer sees prices and is billed in, see GET
+	// /currencies; the default currency when empty. It is locked once the
+	// customer is invoiced.
+	Currency string `json:"currency" binding:"omitempty,len=3"`
+	// IDs of the legal documents the user accepted, see GET /legal
+	AcceptedDocuments []uint64 `json:"accepted_documents"`
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Creates a new user account
+// @Description Creates a new user account. Every current legal document that requires consent must be accepted.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -47,7 +64,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Register(req.Email, req.Password, req.FirstName, req.LastName)
+	accepted, err := h.accountService.CheckAcceptance(req.AcceptedDocuments)
+	if err != nil {
+		writeAcceptanceError(c, err)
+		return
+	}
+
+	user, err := h.authService.Register(req.Email, req.Password, req.FirstName, req.LastName, req.Currency,
+		accepted, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if err == auth.ErrEmailExists {
 			c.JSON(http.StatusConflict, ErrorResponse{Error: "Email already registered"})
@@ -57,9 +81,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Password must be at least 8 characters"})
 			return
 		}
+		if err == account.ErrCurrencyUnavailable {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Registration failed"})
 		return
 	}
+	attributeSignup(c, h.affiliateService, user.ID)
 
 	c.JSON(http.StatusCreated, UserResponse{
 		ID:        user.ID,
@@ -115,6 +144,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Account is suspended"})
 		case auth.ErrTooManyLoginAttempts:
 			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many login attempts"})
+		case auth.ErrUserBanned:
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Sign in is temporarily blocked for this account"})
 		default:
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Login failed"})
 		}
@@ -189,6 +220,7 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 		Status:        string(user.Status),
 		Language:      user.Language,
 		Currency:      user.Currency,
+		Timezone:      user.Timezone,
 		EmailVerified: user.EmailVerified,
 		Credit:        user.Credit.String(),
 		CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05Z"),
@@ -207,6 +239,7 @@ type UpdateProfileRequest struct {
 	State      string `json:"state"`
 	PostalCode string `json:"postal_code"`
 	Country    string `json:"country"`
+	Timezone   string `json:"timezone"` // IANA time zone, e.g. "Europe/Berlin"
 }
 
 // UpdateProfile godoc
@@ -237,8 +270,12 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	err := h.authService.UpdateProfile(
 		user.ID,
 		req.FirstName, req.LastName, req.Company, req.Phone,
-		req.Address1, req.Address2, req.City, req.State, req.PostalCode, req.Country,
+		req.Address1, req.Address2, req.City, req.State, req.PostalCode, req.Country, req.Timezone,
 	)
+	if err == auth.ErrInvalidTimezone {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
 		return
@@ -253,15 +290,22 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password" binding:"required,min=8"`
 }
 
+// ChangePasswordResponse carries the new token of the session, whose ID
+// changes with the password. The other sessions of the user end.
+type ChangePasswordResponse struct {
+	Message string `json:"message"`
+	Token   string `json:"token,omitempty"`
+}
+
 // ChangePassword godoc
 // @Summary Change password
-// @Description Changes the current user's password
+// @Description Changes the current user's password. The session gets a new token, returned and set as the session cookie when signed in with one; the previous token stops working.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body ChangePasswordRequest true "Password data"
-// @Success 200 {object} MessageResponse
+// @Success 200 {object} ChangePasswordResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/auth/password [put]
@@ -278,7 +322,8 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.ChangePassword(user.ID, req.CurrentPassword, req.NewPassword)
+	token := extractToken(c)
+	session, err := h.authService.ChangePassword(user.ID, token, req.CurrentPassword, req.NewPassword, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if err == auth.ErrInvalidCredentials {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Current password is incorrect"})
@@ -287,8 +332,16 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
 		return
 	}
+	if session == nil {
+		c.JSON(http.StatusOK, ChangePasswordResponse{Message: "Password changed successfully"})
+		return
+	}
+	if cookie, err := c.Cookie("session"); err == nil && cookie == token {
+		maxAge := int(time.Until(h.authService.SessionExpiry(session)).Seconds())
+		c.SetCookie("session", session.ID, maxAge, "/", "", c.Request.TLS != nil, true)
+	}
 
-	c.JSON(http.StatusOK, MessageResponse{Message: "Password changed successfully"})
+	c.JSON(http.StatusOK, ChangePasswordResponse{Message: "Password changed successfully", Token: session.ID})
 }
 
 // ForgotPasswordRequest represents a forgot password request
@@ -315,7 +368,7 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 
 	// Create token (don't reveal if user exists for security)
 	// Log the attempt internally for monitoring purposes
-	_, err := h.authService.CreatePasswordResetToken(req.Email)
+	_, err := h.authService.CreatePasswordResetToken(req.Email, c.ClientIP())
 	if err != nil {
 		// Log failed attempt for monitoring (user not found, etc.)
 		// but don't reveal this to the client
@@ -350,7 +403,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.ResetPassword(req.Token, req.NewPassword)
+	err := h.authService.ResetPassword(req.Token, req.NewPassword, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		if err == auth.ErrInvalidToken {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired reset token"})
@@ -385,6 +438,22 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware sets the current user of public routes that
+// show more to logged in users. Requests without a valid session go on
+// anonymously.
+func (h *AuthHandler) OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := extractToken(c); token != "" {
+			if user, err := h.authService.ValidateSession(token); err == nil {
+				SetCurrentUser(c, user)
+				c.Set("customer_id", user.ID)
+				c.Set("user_id", user.ID)
+			}
+		}
+		c.Next()
+	}
+}
+
 // AdminMiddleware restricts access to admin users
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -498,6 +567,7 @@ type UserDetailResponse struct {
 	Status        string `json:"status"`
 	Language      string `json:"language"`
 	Currency      string `json:"currency"`
+	Timezone      string `json:"timezone,omitempty"`
 	EmailVerified bool   `json:"email_verified"`
 	Credit        string `json:"credit"`
 	CreatedAt     string `json:"created_at"`
@@ -0,0 +1,529 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/automation"
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+// AutomationHandler serves the automation API used by no-code platforms
+// such as Zapier and n8n, and the admin endpoints managing its API keys
+type AutomationHandler struct {
+	automationService *automation.Service
+}
+
+// NewAutomationHandler creates a new automation handler
+func NewAutomationHandler(automationService *automation.Service) *AutomationHandler {
+	return &AutomationHandler{automationService: automationService}
+}
+
+// KeyMiddleware authenticates automation API requests with the X-API-Key
+// header. Requests act as the staff user the key was issued to.
+func (h *AutomationHandler) KeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := h.automationService.Authenticate(c.GetHeader("X-API-Key"))
+		if err != nil {
+			if err == automation.ErrInvalidKey {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid API key"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to authenticate"})
+			return
+		}
+
+		SetCurrentUser(c, &key.User)
+		setRequestAPIKey(c, key)
+		c.Next()
+	}
+}
+
+// Schema godoc
+// @Summary Automation API schema
+// @Description Describes the authentication, actions and triggers of the automation API so Zapier, n8n and similar platforms can build integrations from it
+// @Tags automation
+// @Produce json
+// @Success 200 {object} AutomationSchema
+// @Router /api/v1/automation/schema [get]
+func (h *AutomationHandler) Schema(c *gin.Context) {
+	c.JSON(http.StatusOK, automationSchema)
+}
+
+// Me godoc
+// @Summary Test automation API key
+// @Description Returns the API key and the user it acts as. Automation platforms call it to test a connection.
+// @Tags automation
+// @Produce json
+// @Security APIKeyAuth
+// @Success 200 {object} AutomationKeyResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/automation/me [get]
+func (h *AutomationHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, toAutomationKeyResponse(currentAutomationKey(c)))
+}
+
+// CreateCustomer godoc
+// @Summary Create customer action
+// @Tags automation
+// @Accept json
+// @Produce json
+// @Security APIKeyAuth
+// @Param request body AutomationCustomerRequest true "Customer"
+// @Success 201 {object} notification.CustomerEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/automation/actions/create-customer [post]
+func (h *AutomationHandler) CreateCustomer(c *gin.Context) {
+	var req AutomationCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := h.automationService.CreateCustomer(automation.CustomerInput{
+		Email:      req.Email,
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		Password:   req.Password,
+		Company:    req.Company,
+		Phone:      req.Phone,
+		Address1:   req.Address1,
+		Address2:   req.Address2,
+		City:       req.City,
+		State:      req.State,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+	})
+	if err != nil {
+		switch err {
+		case automation.ErrInvalidCustomer, auth.ErrPasswordTooShort:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case auth.ErrEmailExists:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "A customer with this email already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create customer"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, notification.NewCustomerEvent(user))
+}
+
+// CreateTicket godoc
+// @Summary Create ticket action
+// @Description Opens a ticket for a customer given by ID or email. An email without an account opens a guest ticket.
+// @Tags automation
+// @Accept json
+// @Produce json
+// @Security APIKeyAuth
+// @Param request body AutomationTicketRequest true "Ticket"
+// @Success 201 {object} notification.TicketEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/automation/actions/create-ticket [post]
+func (h *AutomationHandler) CreateTicket(c *gin.Context) {
+	var req AutomationTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ticket, err := h.automationService.CreateTicket(automation.TicketInput{
+		CustomerID: req.CustomerID,
+		Email:      req.Email,
+		Subject:    req.Subject,
+		Message:    req.Message,
+		Priority:   req.Priority,
+	})
+	if err != nil {
+		writeAutomationError(c, err, "Failed to create ticket")
+		return
+	}
+
+	c.JSON(http.StatusCreated, notification.NewTicketEvent(ticket))
+}
+
+// AddCredit godoc
+// @Summary Add credit action
+// @Tags automation
+// @Accept json
+// @Produce json
+// @Security APIKeyAuth
+// @Param request body AutomationCreditRequest true "Credit"
+// @Success 201 {object} notification.CreditEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/automation/actions/add-credit [post]
+func (h *AutomationHandler) AddCredit(c *gin.Context) {
+	var req AutomationCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid amount"})
+		return
+	}
+
+	adjustment, err := h.automationService.AddCredit(GetCurrentUserID(c), automation.CreditInput{
+		CustomerID: req.CustomerID,
+		Amount:     amount,
+		Currency:   req.Currency,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		writeAutomationError(c, err, "Failed to add credit")
+		return
+	}
+
+	c.JSON(http.StatusCreated, notification.NewCreditEvent(adjustment))
+}
+
+// CreateInvoice godoc
+// @Summary Create invoice action
+// @Description Creates an unpaid invoice. It is due in 7 days unless due_date (YYYY-MM-DD) is given.
+// @Tags automation
+// @Accept json
+// @Produce json
+// @Security APIKeyAuth
+// @Param request body AutomationInvoiceRequest true "Invoice"
+// @Success 201 {object} notification.InvoiceEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/automation/actions/create-invoice [post]
+func (h *AutomationHandler) CreateInvoice(c *gin.Context) {
+	var req AutomationInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	input := automation.InvoiceInput{
+		CustomerID: req.CustomerID,
+		Currency:   req.Currency,
+		Items:      make([]automation.InvoiceItemInput, 0, len(req.Items)),
+	}
+	if req.DueDate != "" {
+		dueDate, err := time.Parse("2006-01-02", req.DueDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid due date, expected YYYY-MM-DD"})
+			return
+		}
+		input.DueDate = dueDate
+	}
+	for _, item := range req.Items {
+		amount, err := decimal.NewFromString(item.Amount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid item amount"})
+			return
+		}
+		quantity := decimal.NewFromInt(1)
+		if item.Quantity != "" {
+			if quantity, err = decimal.NewFromString(item.Quantity); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid item quantity"})
+				return
+			}
+		}
+		input.Items = append(input.Items, automation.InvoiceItemInput{
+			Description: item.Description,
+			Amount:      amount,
+			Quantity:    quantity,
+			Taxable:     item.Taxable,
+		})
+	}
+
+	inv, err := h.automationService.CreateInvoice(input)
+	if err != nil {
+		writeAutomationError(c, err, "Failed to create invoice")
+		return
+	}
+
+	c.JSON(http.StatusCreated, notification.NewInvoiceEvent(inv))
+}
+
+// RecentEvents godoc
+// @Summary Poll trigger
+// @Description Returns the latest payloads of a trigger event, newest first. Platforms without REST hooks poll it; others use it for sample data.
+// @Tags automation
+// @Produce json
+// @Security APIKeyAuth
+// @Param event path string true "Trigger event, e.g. customer.created"
+// @Param limit query int false "Number of events (max 100)"
+// @Success 200 {array} object
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/automation/triggers/{event} [get]
+func (h *AutomationHandler) RecentEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if limit <= 0 || limit > 100 {
+		limit = 25
+	}
+
+	events, err := h.automationService.RecentEvents(c.Param("event"), limit)
+	if err != nil {
+		writeAutomationError(c, err, "Failed to fetch events")
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// Subscribe godoc
+// @Summary Subscribe to trigger
+// @Description Registers a REST hook delivering a trigger event to target_url. Payloads are signed like other webhooks with the returned secret.
+// @Tags automation
+// @Accept json
+// @Produce json
+// @Security APIKeyAuth
+// @Param request body AutomationSubscribeRequest true "Subscription"
+// @Success 201 {object} AutomationHookResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/automation/hooks [post]
+func (h *AutomationHandler) Subscribe(c *gin.Context) {
+	var req AutomationSubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	webhook, err := h.automationService.Subscribe(currentAutomationKey(c), req.Event, req.TargetURL)
+	if err != nil {
+		if err == automation.ErrUnknownEvent || err == automation.ErrInvalidHookURL {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to subscribe"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, AutomationHookResponse{
+		ID:        webhook.ID,
+		Event:     req.Event,
+		TargetURL: webhook.URL,
+		Secret:    webhook.Secret,
+		CreatedAt: webhook.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// Unsubscribe godoc
+// @Summary Unsubscribe from trigger
+// @Tags automation
+// @Produce json
+// @Security APIKeyAuth
+// @Param id path int true "Subscription ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/automation/hooks/{id} [delete]
+func (h *AutomationHandler) Unsubscribe(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	if err := h.automationService.Unsubscribe(currentAutomationKey(c).ID, id); err != nil {
+		writeAutomationError(c, err, "Failed to unsubscribe")
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Subscription removed"})
+}
+
+// AdminListKeys godoc
+// @Summary List automation API keys (Admin)
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} AutomationKeyResponse
+// @Router /api/v1/admin/automation-keys [get]
+func (h *AutomationHandler) AdminListKeys(c *gin.Context) {
+	keys, err := h.automationService.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch API keys"})
+		return
+	}
+
+	response := make([]AutomationKeyResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, toAutomationKeyResponse(&keys[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateKey godoc
+// @Summary Create automation API key (Admin)
+// @Description Issues an automation API key acting as the current admin. The key is only returned once.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAutomationKeyRequest false "API key"
+// @Success 201 {object} AutomationKeyResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/admin/automation-keys [post]
+func (h *AutomationHandler) AdminCreateKey(c *gin.Context) {
+	var req CreateAutomationKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	key, err := h.automationService.CreateKey(GetCurrentUserID(c), req.Name)
+	if err != nil {
+		if err == automation.ErrNotStaff {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	resp := toAutomationKeyResponse(&key.APIKey)
+	resp.Key = key.Secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// AdminRevokeKey godoc
+// @Summary Revoke automation API key (Admin)
+// @Description Deactivates the key and the trigger subscriptions made with it
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/automation-keys/{id} [delete]
+func (h *AutomationHandler) AdminRevokeKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	if err := h.automationService.RevokeKey(id); err != nil {
+		if err == automation.ErrKeyNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "API key revoked"})
+}
+
+func currentAutomationKey(c *gin.Context) *domain.APIKey {
+	return requestAPIKey(c)
+}
+
+func writeAutomationError(c *gin.Context, err error, message string) {
+	switch err {
+	case automation.ErrInvalidTicket, automation.ErrInvalidAmount, automation.ErrInvalidInvoice:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case automation.ErrCustomerMissing, automation.ErrUnknownEvent, automation.ErrHookNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
+
+func toAutomationKeyResponse(key *domain.APIKey) AutomationKeyResponse {
+	resp := AutomationKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		UserID:    key.UserID,
+		UserEmail: key.User.Email,
+		Active:    key.Active,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	resp.Prefix, _ = key.Permissions["prefix"].(string)
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type CreateAutomationKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type AutomationKeyResponse struct {
+	ID         uint64 `json:"id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`
+	Key        string `json:"key,omitempty"`
+	UserID     uint64 `json:"user_id"`
+	UserEmail  string `json:"user_email,omitempty"`
+	Active     bool   `json:"active"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type AutomationCustomerRequest struct {
+	Email      string `json:"email" binding:"required"`
+	FirstName  string `json:"first_name" binding:"required"`
+	LastName   string `json:"last_name" binding:"required"`
+	Password   string `json:"password"`
+	Company    string `json:"company"`
+	Phone      string `json:"phone"`
+	Address1   string `json:"address1"`
+	Address2   string `json:"address2"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+type AutomationTicketRequest struct {
+	CustomerID uint64 `json:"customer_id"`
+	Email      string `json:"email"`
+	Subject    string `json:"subject" binding:"required"`
+	Message    string `json:"message" binding:"required"`
+	Priority   string `json:"priority"`
+}
+
+type AutomationCreditRequest struct {
+	CustomerID uint64 `json:"customer_id" binding:"required"`
+	Amount     string `json:"amount" binding:"required"`
+	Currency   string `json:"currency"`
+	Reason     string `json:"reason"`
+}
+
+type AutomationInvoiceRequest struct {
+	CustomerID uint64                         `json:"customer_id" binding:"required"`
+	Currency   string                         `json:"currency"`
+	DueDate    string                         `json:"due_date"`
+	Items      []AutomationInvoiceItemRequest `json:"items" binding:"required"`
+}
+
+type AutomationInvoiceItemRequest struct {
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Quantity    string `json:"quantity"`
+	Taxable     bool   `json:"taxable"`
+}
+
+type AutomationSubscribeRequest struct {
+	Event     string `json:"event" binding:"required"`
+	TargetURL string `json:"target_url" binding:"required"`
+}
+
+type AutomationHookResponse struct {
+	ID        uint64 `json:"id"`
+	Event     string `json:"event"`
+	TargetURL string `json:"target_url"`
+	Secret    string `json:"secret"`
+	CreatedAt string `json:"created_at"`
+}
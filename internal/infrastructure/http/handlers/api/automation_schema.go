@@ -0,0 +1,214 @@
+package api
+
+import (
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+// automationSchema is the published description of the automation API.
+// Paths are relative to /api/v1/automation. Keep it in sync with the
+// actions and triggers of the automation service.
+var automationSchema = AutomationSchema{
+	Version: "1",
+	Auth: AutomationSchemaAuth{
+		Type:   "api_key",
+		Header: "X-API-Key",
+		Test:   "/me",
+	},
+	Actions: []AutomationSchemaAction{
+		{
+			Key:         "create_customer",
+			Label:       "Create Customer",
+			Description: "Creates a customer account",
+			Method:      "POST",
+			Path:        "/actions/create-customer",
+			Fields: []AutomationSchemaField{
+				{Key: "email", Label: "Email", Type: "string", Required: true},
+				{Key: "first_name", Label: "First Name", Type: "string", Required: true},
+				{Key: "last_name", Label: "Last Name", Type: "string", Required: true},
+				{Key: "password", Label: "Password", Type: "string", HelpText: "A random password is set when empty"},
+				{Key: "company", Label: "Company", Type: "string"},
+				{Key: "phone", Label: "Phone", Type: "string"},
+				{Key: "address1", Label: "Address", Type: "string"},
+				{Key: "address2", Label: "Address Line 2", Type: "string"},
+				{Key: "city", Label: "City", Type: "string"},
+				{Key: "state", Label: "State", Type: "string"},
+				{Key: "postal_code", Label: "Postal Code", Type: "string"},
+				{Key: "country", Label: "Country", Type: "string", HelpText: "Two letter country code"},
+			},
+			Sample: sampleCustomerEvent,
+		},
+		{
+			Key:         "create_ticket",
+			Label:       "Create Ticket",
+			Description: "Opens a support ticket for a customer or a guest email",
+			Method:      "POST",
+			Path:        "/actions/create-ticket",
+			Fields: []AutomationSchemaField{
+				{Key: "customer_id", Label: "Customer ID", Type: "integer", HelpText: "Either a customer ID or an email is required"},
+				{Key: "email", Label: "Email", Type: "string"},
+				{Key: "subject", Label: "Subject", Type: "string", Required: true},
+				{Key: "message", Label: "Message", Type: "text", Required: true},
+				{Key: "priority", Label: "Priority", Type: "string", Choices: []string{"low", "normal", "high"}},
+			},
+			Sample: sampleTicketEvent,
+		},
+		{
+			Key:         "add_credit",
+			Label:       "Add Credit",
+			Description: "Adds credit to a customer account",
+			Method:      "POST",
+			Path:        "/actions/add-credit",
+			Fields: []AutomationSchemaField{
+				{Key: "customer_id", Label: "Customer ID", Type: "integer", Required: true},
+				{Key: "amount", Label: "Amount", Type: "decimal", Required: true},
+				{Key: "currency", Label: "Currency", Type: "string", HelpText: "Defaults to the customer currency"},
+				{Key: "reason", Label: "Reason", Type: "string"},
+			},
+			Sample: sampleCreditEvent,
+		},
+		{
+			Key:         "create_invoice",
+			Label:       "Create Invoice",
+			Description: "Creates an unpaid invoice for a customer",
+			Method:      "POST",
+			Path:        "/actions/create-invoice",
+			Fields: []AutomationSchemaField{
+				{Key: "customer_id", Label: "Customer ID", Type: "integer", Required: true},
+				{Key: "currency", Label: "Currency", Type: "string", HelpText: "Defaults to the customer currency"},
+				{Key: "due_date", Label: "Due Date", Type: "date", HelpText: "YYYY-MM-DD, defaults to 7 days from now"},
+				{Key: "items", Label: "Items", Type: "list", Required: true, Children: []AutomationSchemaField{
+					{Key: "description", Label: "Description", Type: "string", Required: true},
+					{Key: "amount", Label: "Unit Price", Type: "decimal", Required: true},
+					{Key: "quantity", Label: "Quantity", Type: "decimal", HelpText: "Defaults to 1"},
+					{Key: "taxable", Label: "Taxable", Type: "boolean"},
+				}},
+			},
+			Sample: sampleInvoiceEvent,
+		},
+	},
+	Triggers: []AutomationSchemaTrigger{
+		{
+			Key:         notification.EventCustomerCreated,
+			Label:       "New Customer",
+			Description: "Triggers when a customer account is created",
+			Sample:      sampleCustomerEvent,
+		},
+		{
+			Key:         notification.EventTicketCreated,
+			Label:       "New Ticket",
+			Description: "Triggers when a support ticket is opened",
+			Sample:      sampleTicketEvent,
+		},
+		{
+			Key:         notification.EventCreditAdded,
+			Label:       "Credit Added",
+			Description: "Triggers when credit is added to a customer account",
+			Sample:      sampleCreditEvent,
+		},
+		{
+			Key:         notification.EventInvoiceCreated,
+			Label:       "New Invoice",
+			Description: "Triggers when an invoice is created",
+			Sample:      sampleInvoiceEvent,
+		},
+	},
+	Hooks: AutomationSchemaHooks{
+		Subscribe:   "POST /hooks",
+		Unsubscribe: "DELETE /hooks/{id}",
+		Poll:        "GET /triggers/{event}",
+		Signature:   "X-OpenHost-Signature",
+	},
+}
+
+var (
+	sampleCustomerEvent = notification.CustomerEvent{
+		ID:        1,
+		Email:     "jane@example.com",
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Company:   "Example Ltd",
+		Phone:     "+1 555 0100",
+		Country:   "US",
+		Currency:  "USD",
+		CreatedAt: "2024-01-01T12:00:00Z",
+	}
+	sampleTicketEvent = notification.TicketEvent{
+		ID:         1,
+		CustomerID: &sampleCustomerEvent.ID,
+		Email:      "jane@example.com",
+		Subject:    "Website is down",
+		Message:    "My website has been unreachable since this morning.",
+		Status:     "open",
+		Priority:   "normal",
+		Source:     "web",
+		CreatedAt:  "2024-01-01T12:00:00Z",
+	}
+	sampleCreditEvent = notification.CreditEvent{
+		ID:         1,
+		CustomerID: 1,
+		Amount:     "10.00",
+		Currency:   "USD",
+		Reason:     "Goodwill credit",
+		Balance:    "10.00",
+		CreatedAt:  "2024-01-01T12:00:00Z",
+	}
+	sampleInvoiceEvent = notification.InvoiceEvent{
+		ID:            1,
+		CustomerID:    1,
+		InvoiceNumber: "INV-2024-12345",
+		Status:        "unpaid",
+		Currency:      "USD",
+		Total:         "19.99",
+		Balance:       "19.99",
+		DueDate:       "2024-01-08T00:00:00Z",
+		CreatedAt:     "2024-01-01T12:00:00Z",
+	}
+)
+
+type AutomationSchema struct {
+	Version  string                    `json:"version"`
+	Auth     AutomationSchemaAuth      `json:"auth"`
+	Actions  []AutomationSchemaAction  `json:"actions"`
+	Triggers []AutomationSchemaTrigger `json:"triggers"`
+	Hooks    AutomationSchemaHooks     `json:"hooks"`
+}
+
+type AutomationSchemaAuth struct {
+	Type   string `json:"type"`
+	Header string `json:"header"`
+	Test   string `json:"test"`
+}
+
+type AutomationSchemaAction struct {
+	Key         string                  `json:"key"`
+	Label       string                  `json:"label"`
+	Description string                  `json:"description"`
+	Method      string                  `json:"method"`
+	Path        string                  `json:"path"`
+	Fields      []AutomationSchemaField `json:"fields"`
+	Sample      interface{}             `json:"sample"`
+}
+
+type AutomationSchemaField struct {
+	Key      string                  `json:"key"`
+	Label    string                  `json:"label"`
+	Type     string                  `json:"type"`
+	Required bool                    `json:"required"`
+	HelpText string                  `json:"help_text,omitempty"`
+	Choices  []string                `json:"choices,omitempty"`
+	Children []AutomationSchemaField `json:"children,omitempty"`
+}
+
+type AutomationSchemaTrigger struct {
+	Key         string      `json:"key"`
+	Label       string      `json:"label"`
+	Description string      `json:"description"`
+	Sample      interface{} `json:"sample"`
+}
+
+type AutomationSchemaHooks struct {
+	Subscribe   string `json:"subscribe"`
+	Unsubscribe string `json:"unsubscribe"`
+	Poll        string `json:"poll"`
+	Signature   string `json:"signature"`
+}
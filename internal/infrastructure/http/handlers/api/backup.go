@@ -0,0 +1,308 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/backup"
+	"github.com/openhost/openhost/internal/infrastructure/storage"
+)
+
+// redactedSecret replaces secrets of backup destinations in responses.
+// Sending it back in an update keeps the stored secret.
+const redactedSecret = "[redacted]"
+
+// BackupHandler handles backup API endpoints
+type BackupHandler struct {
+	backupService *backup.Service
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(backupService *backup.Service) *BackupHandler {
+	return &BackupHandler{backupService: backupService}
+}
+
+// AdminListConfigs godoc
+// @Summary List backup configurations (Admin)
+// @Description Returns the backup configurations with the outcome of their last run
+// @Tags admin/backup
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} BackupConfigResponse
+// @Router /api/v1/admin/backups/configs [get]
+func (h *BackupHandler) AdminListConfigs(c *gin.Context) {
+	configs, err := h.backupService.ListConfigs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch backup configurations"})
+		return
+	}
+
+	response := make([]BackupConfigResponse, 0, len(configs))
+	for i := range configs {
+		response = append(response, toBackupConfigResponse(&configs[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateConfig godoc
+// @Summary Create backup configuration (Admin)
+// @Description Creates a backup of the database, the attachment files or both to local disk or S3, optionally on a cron schedule
+// @Tags admin/backup
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BackupConfigRequest true "Backup configuration"
+// @Success 201 {object} BackupConfigResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/backups/configs [post]
+func (h *BackupHandler) AdminCreateConfig(c *gin.Context) {
+	var req BackupConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	config := &domain.BackupConfig{Active: true}
+	req.apply(config)
+	if err := h.backupService.SaveConfig(config); err != nil {
+		h.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toBackupConfigResponse(config))
+}
+
+// AdminUpdateConfig godoc
+// @Summary Update backup configuration (Admin)
+// @Description Replaces a backup configuration. A secret_key of "[redacted]" keeps the stored key.
+// @Tags admin/backup
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Backup configuration ID"
+// @Param request body BackupConfigRequest true "Backup configuration"
+// @Success 200 {object} BackupConfigResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/backups/configs/{id} [put]
+func (h *BackupHandler) AdminUpdateConfig(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid backup configuration ID"})
+		return
+	}
+	var req BackupConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	config, err := h.backupService.GetConfig(id)
+	if err != nil {
+		h.configError(c, err)
+		return
+	}
+	previous := config.Config
+	req.apply(config)
+	if secret, _ := config.Config["secret_key"].(string); secret == redactedSecret {
+		config.Config["secret_key"] = previous["secret_key"]
+	}
+	if err := h.backupService.SaveConfig(config); err != nil {
+		h.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toBackupConfigResponse(config))
+}
+
+// AdminDeleteConfig godoc
+// @Summary Delete backup configuration (Admin)
+// @Description Deletes a backup configuration and its run history. Backup files are kept.
+// @Tags admin/backup
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Backup configuration ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/backups/configs/{id} [delete]
+func (h *BackupHandler) AdminDeleteConfig(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid backup configuration ID"})
+		return
+	}
+	if err := h.backupService.DeleteConfig(id); err != nil {
+		h.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Backup configuration deleted"})
+}
+
+// AdminRunBackup godoc
+// @Summary Run backup (Admin)
+// @Description Starts a backup in the background. Its outcome appears in the configuration and the restore points.
+// @Tags admin/backup
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Backup configuration ID"
+// @Success 202 {object} BackupResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/backups/configs/{id}/run [post]
+func (h *BackupHandler) AdminRunBackup(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid backup configuration ID"})
+		return
+	}
+
+	entry, err := h.backupService.Start(id)
+	if err != nil {
+		h.configError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, toBackupResponse(entry))
+}
+
+// AdminListRestorePoints godoc
+// @Summary List restore points (Admin)
+// @Description Returns the successful backups, newest first. Restore one with "server restore -id <id>" while the server is stopped.
+// @Tags admin/backup
+// @Produce json
+// @Security BearerAuth
+// @Param config_id query int false "Filter by backup configuration"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/backups [get]
+func (h *BackupHandler) AdminListRestorePoints(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	configID, _ := strconv.ParseUint(c.Query("config_id"), 10, 64)
+
+	points, total, err := h.backupService.ListRestorePoints(configID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch restore points"})
+		return
+	}
+
+	response := make([]BackupResponse, 0, len(points))
+	for i := range points {
+		response = append(response, toBackupResponse(&points[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func (h *BackupHandler) configError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, backup.ErrConfigNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Backup configuration not found"})
+	case errors.Is(err, backup.ErrBackupRunning):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, backup.ErrInvalidType), errors.Is(err, backup.ErrUnsupportedDestination),
+		errors.Is(err, backup.ErrInvalidSchedule), errors.Is(err, storage.ErrInvalidS3Config),
+		errors.Is(err, backup.ErrEncryptionKeyRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save backup configuration"})
+	}
+}
+
+func toBackupConfigResponse(config *domain.BackupConfig) BackupConfigResponse {
+	settings := make(map[string]interface{}, len(config.Config))
+	for key, value := range config.Config {
+		settings[key] = value
+	}
+	if secret, _ := settings["secret_key"].(string); secret != "" {
+		settings["secret_key"] = redactedSecret
+	}
+
+	response := BackupConfigResponse{
+		ID:          config.ID,
+		Name:        config.Name,
+		Type:        config.Type,
+		Destination: config.Destination,
+		Config:      settings,
+		Schedule:    config.Schedule,
+		Retention:   config.Retention,
+		Active:      config.Active,
+		LastStatus:  config.LastStatus,
+		LastError:   config.LastError,
+	}
+	if config.LastRun != nil {
+		response.LastRun = config.LastRun.Format(time.RFC3339)
+	}
+	return response
+}
+
+func toBackupResponse(entry *domain.BackupLog) BackupResponse {
+	response := BackupResponse{
+		ID:        entry.ID,
+		ConfigID:  entry.BackupConfigID,
+		Config:    entry.BackupConfig.Name,
+		Status:    entry.Status,
+		StartedAt: entry.StartedAt.Format(time.RFC3339),
+		FileSize:  entry.FileSize,
+		FilePath:  entry.FilePath,
+		Error:     entry.ErrorMsg,
+	}
+	if entry.CompletedAt != nil {
+		response.CompletedAt = entry.CompletedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// Request/Response types
+
+type BackupConfigRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Type        string                 `json:"type" binding:"required"` // database, files or full
+	Destination string                 `json:"destination"`             // local or s3
+	Config      map[string]interface{} `json:"config"`                  // directory; bucket, region, endpoint, access_key, secret_key, prefix, path_style
+	Schedule    string                 `json:"schedule"`                // Cron expression, empty to only run manually
+	Retention   int                    `json:"retention"`               // Days
+	Active      *bool                  `json:"active"`
+}
+
+func (r *BackupConfigRequest) apply(config *domain.BackupConfig) {
+	config.Name = r.Name
+	config.Type = r.Type
+	config.Destination = r.Destination
+	config.Config = domain.JSONMap(r.Config)
+	if config.Config == nil {
+		config.Config = domain.JSONMap{}
+	}
+	config.Schedule = r.Schedule
+	config.Retention = r.Retention
+	if r.Active != nil {
+		config.Active = *r.Active
+	}
+}
+
+type BackupConfigResponse struct {
+	ID          uint64                 `json:"id"`
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Destination string                 `json:"destination"`
+	Config      map[string]interface{} `json:"config"`
+	Schedule    string                 `json:"schedule"`
+	Retention   int                    `json:"retention"`
+	Active      bool                   `json:"active"`
+	LastRun     string                 `json:"last_run,omitempty"`
+	LastStatus  string                 `json:"last_status,omitempty"`
+	LastError   string                 `json:"last_error,omitempty"`
+}
+
+type BackupResponse struct {
+	ID          uint64 `json:"id"`
+	ConfigID    uint64 `json:"config_id"`
+	Config      string `json:"config,omitempty"`
+	Status      string `json:"status"`
+	StartedAt   string `json:"started_at"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	FileSize    int64  `json:"file_size"`
+	FilePath    string `json:"file_path,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
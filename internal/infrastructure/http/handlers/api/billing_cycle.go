@@ -0,0 +1,222 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/order"
+)
+
+// QuoteBillingCycleChange godoc
+// @Summary Quote billing cycle change
+// @Description Prices switching a service to another billing cycle. The unused part of the current period is credited against a full period of the new cycle.
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param billing_cycle query string true "New billing cycle"
+// @Success 200 {object} CycleQuoteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/billing-cycle/quote [get]
+func (h *OrderHandler) QuoteBillingCycleChange(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+	billingCycle := c.Query("billing_cycle")
+	if billingCycle == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "billing_cycle is required"})
+		return
+	}
+
+	quote, err := h.orderService.QuoteCycleChange(userID, serviceID, billingCycle)
+	if err != nil {
+		writeCycleChangeError(c, err, "Failed to quote billing cycle change")
+		return
+	}
+
+	c.JSON(http.StatusOK, CycleQuoteResponse{
+		BillingCycle:  quote.BillingCycle,
+		NewAmount:     quote.NewAmount.String(),
+		Credit:        quote.Credit.String(),
+		Charge:        quote.Charge.String(),
+		AmountDue:     quote.AmountDue.String(),
+		AccountCredit: quote.AccountCredit.String(),
+		NextDueDate:   quote.NextDueDate.Format("2006-01-02"),
+	})
+}
+
+// ChangeBillingCycle godoc
+// @Summary Change billing cycle
+// @Description Switches a service to another billing cycle. The prorated difference is invoiced and the new cycle, amount and due date apply once it is paid.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param request body ChangeBillingCycleRequest true "Billing cycle"
+// @Success 201 {object} CycleChangeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/billing-cycle [post]
+func (h *OrderHandler) ChangeBillingCycle(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req ChangeBillingCycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	change, err := h.orderService.ChangeBillingCycle(userID, serviceID, req.BillingCycle)
+	if err != nil {
+		writeCycleChangeError(c, err, "Failed to change billing cycle")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCycleChangeResponse(change))
+}
+
+// GetBillingCycleChange godoc
+// @Summary Get billing cycle change
+// @Description Returns the latest billing cycle change of a service
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} CycleChangeResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/billing-cycle [get]
+func (h *OrderHandler) GetBillingCycleChange(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	change, err := h.orderService.GetCycleChange(userID, serviceID)
+	if err != nil {
+		writeCycleChangeError(c, err, "Failed to fetch billing cycle change")
+		return
+	}
+
+	c.JSON(http.StatusOK, toCycleChangeResponse(change))
+}
+
+// CancelBillingCycleChange godoc
+// @Summary Cancel billing cycle change
+// @Description Withdraws a pending billing cycle change and cancels its unpaid invoice
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/billing-cycle [delete]
+func (h *OrderHandler) CancelBillingCycleChange(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	if err := h.orderService.CancelCycleChange(userID, serviceID); err != nil {
+		writeCycleChangeError(c, err, "Failed to cancel billing cycle change")
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Billing cycle change cancelled"})
+}
+
+func writeCycleChangeError(c *gin.Context, err error, failure string) {
+	switch err {
+	case order.ErrServiceNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+	case order.ErrCycleChangeNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No billing cycle change found"})
+	case order.ErrInvalidBillingCycle, order.ErrSameBillingCycle, order.ErrServiceNotActive, order.ErrServiceOverdue:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case order.ErrCycleChangePending, order.ErrServiceCancelling:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+	}
+}
+
+func toCycleChangeResponse(change *domain.CycleChange) CycleChangeResponse {
+	resp := CycleChangeResponse{
+		ID:            change.ID,
+		ServiceID:     change.ServiceID,
+		Status:        string(change.Status),
+		FromCycle:     change.FromCycle,
+		ToCycle:       change.ToCycle,
+		NewAmount:     change.NewAmount.String(),
+		Credit:        change.Credit.String(),
+		Charge:        change.Charge.String(),
+		AmountDue:     change.AmountDue.String(),
+		AccountCredit: change.AccountCredit.String(),
+		NextDueDate:   change.NewNextDueDate.Format("2006-01-02"),
+		InvoiceID:     change.InvoiceID,
+		CreatedAt:     change.CreatedAt.Format(time.RFC3339),
+	}
+	if change.Invoice != nil {
+		resp.InvoiceNumber = change.Invoice.InvoiceNumber
+		resp.InvoiceTotal = change.Invoice.Total.String()
+	}
+	if change.CompletedAt != nil {
+		resp.CompletedAt = change.CompletedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type ChangeBillingCycleRequest struct {
+	BillingCycle string `json:"billing_cycle" binding:"required"`
+}
+
+type CycleQuoteResponse struct {
+	BillingCycle  string `json:"billing_cycle"`
+	NewAmount     string `json:"new_amount"`
+	Credit        string `json:"credit"`
+	Charge        string `json:"charge"`
+	AmountDue     string `json:"amount_due"`
+	AccountCredit string `json:"account_credit"`
+	NextDueDate   string `json:"next_due_date"`
+}
+
+type CycleChangeResponse struct {
+	ID            uint64  `json:"id"`
+	ServiceID     uint64  `json:"service_id"`
+	Status        string  `json:"status"`
+	FromCycle     string  `json:"from_cycle"`
+	ToCycle       string  `json:"to_cycle"`
+	NewAmount     string  `json:"new_amount"`
+	Credit        string  `json:"credit"`
+	Charge        string  `json:"charge"`
+	AmountDue     string  `json:"amount_due"`
+	AccountCredit string  `json:"account_credit"`
+	NextDueDate   string  `json:"next_due_date"`
+	InvoiceID     *uint64 `json:"invoice_id,omitempty"`
+	InvoiceNumber string  `json:"invoice_number,omitempty"`
+	InvoiceTotal  string  `json:"invoice_total,omitempty"`
+	CompletedAt   string  `json:"completed_at,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
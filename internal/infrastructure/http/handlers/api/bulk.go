@@ -0,0 +1,282 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/approval"
+	"github.com/openhost/openhost/internal/core/service/bulk"
+)
+
+// BulkHandler handles bulk admin operation endpoints
+type BulkHandler struct {
+	bulkService *bulk.Service
+	approvals   *approval.Service
+}
+
+// NewBulkHandler creates a new bulk handler
+func NewBulkHandler(bulkService *bulk.Service) *BulkHandler {
+	return &BulkHandler{bulkService: bulkService}
+}
+
+// SetApprovalService holds bulk terminations for a second admin when the
+// two-person rule covers them. The services matched when asking are the
+// ones terminated, and the job is recorded as queued by the admin who asked.
+func (h *BulkHandler) SetApprovalService(approvals *approval.Service) {
+	h.approvals = approvals
+	approvals.Register(approval.ActionBulkTerminate, func(request *domain.ApprovalRequest) (string, error) {
+		var req bulk.Request
+		if err := approval.DecodeParams(request, &req); err != nil {
+			return "", err
+		}
+		staffID := request.RequestedByID
+		req.StaffID = &staffID
+		job, err := h.bulkService.Submit(req)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Bulk job #%d queued", job.ID), nil
+	})
+}
+
+// AdminSubmitBulk godoc
+// @Summary Submit bulk operation (Admin)
+// @Description Queues an operation over a filtered set of services, customers or product prices. Supported operations: suspend_services, unsuspend_services, terminate_services, add_credit, adjust_pricing. When the two-person rule covers bulk terminations, terminate_services answers with an approval request instead and the matched services are terminated once a second admin approves.
+// @Tags admin/bulk
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BulkOperationRequest true "Bulk operation"
+// @Success 202 {object} BulkJobResponse
+// @Success 202 {object} ApprovalPendingResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/bulk [post]
+func (h *BulkHandler) AdminSubmitBulk(c *gin.Context) {
+	var req BulkOperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bulkReq := bulk.Request{
+		Operation: req.Operation,
+		Services: bulk.ServiceFilter{
+			ServiceIDs:  req.ServiceIDs,
+			ProductIDs:  req.ProductIDs,
+			CustomerIDs: req.ServiceCustomerIDs,
+			ServerID:    req.ServerID,
+			Status:      req.Status,
+		},
+		CustomerIDs: req.CustomerIDs,
+		Pricing: bulk.PricingFilter{
+			ProductIDs:     req.ProductIDs,
+			ProductGroupID: req.ProductGroupID,
+			Currency:       req.Currency,
+			Cycles:         req.Cycles,
+		},
+		Currency: req.Currency,
+		Reason:   req.Reason,
+	}
+
+	if req.Amount != "" {
+		amount, err := decimal.NewFromString(req.Amount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid amount"})
+			return
+		}
+		bulkReq.Amount = amount
+	}
+	if req.Percent != "" {
+		percent, err := decimal.NewFromString(req.Percent)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid percent"})
+			return
+		}
+		bulkReq.Percent = percent
+	}
+
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint64); ok {
+			bulkReq.StaffID = &id
+		}
+	}
+
+	if req.Operation == bulk.OpTerminateServices && h.approvals != nil && h.approvals.Required(approval.ActionBulkTerminate) {
+		h.holdTermination(c, bulkReq)
+		return
+	}
+
+	job, err := h.bulkService.Submit(bulkReq)
+	if err != nil {
+		h.writeSubmitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toBulkJobResponse(job))
+}
+
+// holdTermination asks a second admin to approve terminating the services
+// the request matches now
+func (h *BulkHandler) holdTermination(c *gin.Context, bulkReq bulk.Request) {
+	targets, err := h.bulkService.Targets(bulkReq)
+	if err != nil {
+		h.writeSubmitError(c, err)
+		return
+	}
+	held := bulk.Request{
+		Operation: bulk.OpTerminateServices,
+		Services:  bulk.ServiceFilter{ServiceIDs: targets},
+		Reason:    bulkReq.Reason,
+	}
+	summary := fmt.Sprintf("Terminate %d services", len(targets))
+	if len(targets) == 1 {
+		summary = fmt.Sprintf("Terminate service #%d", targets[0])
+	}
+	holdForApproval(c, h.approvals, approval.ActionBulkTerminate, held, summary)
+}
+
+func (h *BulkHandler) writeSubmitError(c *gin.Context, err error) {
+	switch err {
+	case bulk.ErrNoTargets:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case bulk.ErrUnknownOperation, bulk.ErrEmptyFilter, bulk.ErrInvalidAmount, bulk.ErrInvalidPercent:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to queue bulk operation"})
+	}
+}
+
+// AdminGetBulkJob godoc
+// @Summary Get bulk operation status (Admin)
+// @Description Returns the status and progress of a bulk operation
+// @Tags admin/bulk
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Job ID"
+// @Success 200 {object} BulkJobResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/bulk/{id} [get]
+func (h *BulkHandler) AdminGetBulkJob(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid job ID"})
+		return
+	}
+
+	job, err := h.bulkService.GetJob(jobID)
+	if err != nil {
+		if err == bulk.ErrJobNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Bulk job not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch bulk job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toBulkJobResponse(job))
+}
+
+// AdminListBulkJobs godoc
+// @Summary List bulk operations (Admin)
+// @Description Returns bulk operations, newest first
+// @Tags admin/bulk
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/bulk [get]
+func (h *BulkHandler) AdminListBulkJobs(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	jobs, total, err := h.bulkService.ListJobs(c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch bulk jobs"})
+		return
+	}
+
+	response := make([]BulkJobResponse, 0, len(jobs))
+	for i := range jobs {
+		response = append(response, toBulkJobResponse(&jobs[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func toBulkJobResponse(task *domain.SystemTask) BulkJobResponse {
+	resp := BulkJobResponse{
+		ID:        task.ID,
+		Status:    task.Status,
+		Error:     task.Error,
+		CreatedAt: task.CreatedAt.Format(time.RFC3339),
+	}
+	if op, ok := task.Data["operation"].(string); ok {
+		resp.Operation = op
+	}
+	resp.Total = jsonInt(task.Result["total"])
+	resp.Processed = jsonInt(task.Result["processed"])
+	resp.Succeeded = jsonInt(task.Result["succeeded"])
+	resp.Failed = jsonInt(task.Result["failed"])
+	if errs, ok := task.Result["errors"].([]interface{}); ok {
+		resp.Errors = errs
+	}
+	if resp.Total > 0 {
+		resp.Percent = resp.Processed * 100 / resp.Total
+	}
+	if task.StartedAt != nil {
+		resp.StartedAt = task.StartedAt.Format(time.RFC3339)
+	}
+	if task.CompletedAt != nil {
+		resp.CompletedAt = task.CompletedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func jsonInt(v interface{}) int {
+	if f, ok := v.(float64); ok {
+		return int(f)
+	}
+	return 0
+}
+
+// Request/Response types
+
+type BulkOperationRequest struct {
+	Operation          string   `json:"operation" binding:"required"`
+	ServiceIDs         []uint64 `json:"service_ids"`
+	ProductIDs         []uint64 `json:"product_ids"`
+	ServiceCustomerIDs []uint64 `json:"service_customer_ids"`
+	ServerID           *uint64  `json:"server_id"`
+	Status             string   `json:"status"`
+	CustomerIDs        []uint64 `json:"customer_ids"`
+	ProductGroupID     uint64   `json:"product_group_id"`
+	Cycles             []string `json:"cycles"`
+	Amount             string   `json:"amount"`
+	Currency           string   `json:"currency"`
+	Percent            string   `json:"percent"`
+	Reason             string   `json:"reason"`
+}
+
+type BulkJobResponse struct {
+	ID          uint64        `json:"id"`
+	Operation   string        `json:"operation"`
+	Status      string        `json:"status"`
+	Total       int           `json:"total"`
+	Processed   int           `json:"processed"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Percent     int           `json:"percent"`
+	Errors      []interface{} `json:"errors,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   string        `json:"created_at"`
+	StartedAt   string        `json:"started_at,omitempty"`
+	CompletedAt string        `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/product"
+)
+
+// BundleHandler handles product bundle endpoints
+type BundleHandler struct {
+	productService *product.Service
+}
+
+// NewBundleHandler creates a new bundle handler
+func NewBundleHandler(productService *product.Service) *BundleHandler {
+	return &BundleHandler{productService: productService}
+}
+
+// ListBundles godoc
+// @Summary List bundles
+// @Description Returns active bundles with their price and savings for a billing cycle. Optional products are not included in the price.
+// @Tags bundles
+// @Produce json
+// @Param billing_cycle query string false "Billing cycle" default(monthly)
+// @Param currency query string false "Currency" default(USD)
+// @Success 200 {array} BundleResponse
+// @Router /api/v1/bundles [get]
+func (h *BundleHandler) ListBundles(c *gin.Context) {
+	billingCycle := c.DefaultQuery("billing_cycle", "monthly")
+	currency := c.DefaultQuery("currency", "USD")
+
+	bundles, err := h.productService.ListBundles(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch bundles"})
+		return
+	}
+
+	response := make([]BundleResponse, 0, len(bundles))
+	for i := range bundles {
+		quote, err := h.productService.QuoteBundle(bundles[i].ID, billingCycle, currency, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to price bundles"})
+			return
+		}
+		response = append(response, toBundleResponse(&bundles[i], quote))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetBundle godoc
+// @Summary Get bundle
+// @Description Returns a bundle priced for a billing cycle with the chosen optional products
+// @Tags bundles
+// @Produce json
+// @Param id path int true "Bundle ID"
+// @Param billing_cycle query string false "Billing cycle" default(monthly)
+// @Param currency query string false "Currency" default(USD)
+// @Param optional query string false "Comma separated IDs of optional products to include"
+// @Success 200 {object} BundleResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/bundles/{id} [get]
+func (h *BundleHandler) GetBundle(c *gin.Context) {
+	bundleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid bundle ID"})
+		return
+	}
+
+	var optional []uint64
+	for _, raw := range strings.Split(c.Query("optional"), ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64); err == nil {
+			optional = append(optional, id)
+		}
+	}
+
+	bundle, err := h.productService.GetBundle(bundleID)
+	if err != nil || !bundle.Active {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Bundle not found"})
+		return
+	}
+
+	quote, err := h.productService.QuoteBundle(bundleID, c.DefaultQuery("billing_cycle", "monthly"), c.DefaultQuery("currency", "USD"), optional)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to price bundle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toBundleResponse(bundle, quote))
+}
+
+// AdminListBundles godoc
+// @Summary List bundles (Admin)
+// @Description Returns every bundle including inactive ones
+// @Tags admin/bundles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} BundleResponse
+// @Router /api/v1/admin/bundles [get]
+func (h *BundleHandler) AdminListBundles(c *gin.Context) {
+	bundles, err := h.productService.ListBundles(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch bundles"})
+		return
+	}
+
+	response := make([]BundleResponse, 0, len(bundles))
+	for i := range bundles {
+		response = append(response, toBundleResponse(&bundles[i], nil))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateBundle godoc
+// @Summary Create bundle (Admin)
+// @Description Creates a bundle of products. Bundles with a price for a billing cycle are sold at that price, otherwise each product gets its discount percentage.
+// @Tags admin/bundles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BundleRequest true "Bundle"
+// @Success 201 {object} BundleResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/bundles [post]
+func (h *BundleHandler) AdminCreateBundle(c *gin.Context) {
+	var req BundleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bundle, err := req.toDomain()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bundle, err = h.productService.CreateBundle(bundle)
+	if err != nil {
+		h.bundleError(c, err, "Failed to create bundle")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toBundleResponse(bundle, nil))
+}
+
+// AdminUpdateBundle godoc
+// @Summary Update bundle (Admin)
+// @Description Replaces the details and products of a bundle
+// @Tags admin/bundles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Bundle ID"
+// @Param request body BundleRequest true "Bundle"
+// @Success 200 {object} BundleResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/bundles/{id} [put]
+func (h *BundleHandler) AdminUpdateBundle(c *gin.Context) {
+	bundleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid bundle ID"})
+		return
+	}
+
+	var req BundleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bundle, err := req.toDomain()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bundle, err = h.productService.UpdateBundle(bundleID, bundle)
+	if err != nil {
+		h.bundleError(c, err, "Failed to update bundle")
+		return
+	}
+
+	c.JSON(http.StatusOK, toBundleResponse(bundle, nil))
+}
+
+// AdminDeleteBundle godoc
+// @Summary Delete bundle (Admin)
+// @Tags admin/bundles
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Bundle ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/bundles/{id} [delete]
+func (h *BundleHandler) AdminDeleteBundle(c *gin.Context) {
+	bundleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid bundle ID"})
+		return
+	}
+
+	if err := h.productService.DeleteBundle(bundleID); err != nil {
+		h.bundleError(c, err, "Failed to delete bundle")
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Bundle deleted"})
+}
+
+func (h *BundleHandler) bundleError(c *gin.Context, err error, message string) {
+	switch err {
+	case product.ErrBundleNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Bundle not found"})
+	case product.ErrProductNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+	case product.ErrInvalidBundle:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
+
+func (r BundleRequest) toDomain() (*domain.ProductBundle, error) {
+	bundle := &domain.ProductBundle{
+		Name:           r.Name,
+		Description:    r.Description,
+		AllowCustomize: r.AllowCustomize,
+		ShowSavings:    true,
+		Active:         true,
+		SortOrder:      r.SortOrder,
+	}
+	if r.ShowSavings != nil {
+		bundle.ShowSavings = *r.ShowSavings
+	}
+	if r.Active != nil {
+		bundle.Active = *r.Active
+	}
+
+	prices := []struct {
+		field string
+		raw   string
+		dest  *decimal.Decimal
+	}{
+		{"setup_fee", r.SetupFee, &bundle.SetupFee},
+		{"monthly", r.Monthly, &bundle.Monthly},
+		{"quarterly", r.Quarterly, &bundle.Quarterly},
+		{"semi_annually", r.SemiAnnually, &bundle.SemiAnnually},
+		{"annually", r.Annually, &bundle.Annually},
+		{"biennially", r.Biennially, &bundle.Biennially},
+		{"triennially", r.Triennially, &bundle.Triennially},
+	}
+	for _, price := range prices {
+		if price.raw == "" {
+			continue
+		}
+		value, err := decimal.NewFromString(price.raw)
+		if err != nil || value.IsNegative() {
+			return nil, fmt.Errorf("Invalid %s", price.field)
+		}
+		*price.dest = value
+	}
+
+	for _, item := range r.Items {
+		discount := decimal.Zero
+		if item.Discount != "" {
+			value, err := decimal.NewFromString(item.Discount)
+			if err != nil || value.IsNegative() || value.GreaterThan(decimal.NewFromInt(100)) {
+				return nil, fmt.Errorf("Invalid discount for product %d", item.ProductID)
+			}
+			discount = value
+		}
+		bundle.Items = append(bundle.Items, domain.ProductBundleItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Optional:  item.Optional,
+			Discount:  discount,
+			SortOrder: item.SortOrder,
+		})
+	}
+	return bundle, nil
+}
+
+func toBundleResponse(bundle *domain.ProductBundle, quote *product.BundleQuote) BundleResponse {
+	resp := BundleResponse{
+		ID:             bundle.ID,
+		Name:           bundle.Name,
+		Description:    bundle.Description,
+		SetupFee:       bundle.SetupFee.String(),
+		Monthly:        bundle.Monthly.String(),
+		Quarterly:      bundle.Quarterly.String(),
+		SemiAnnually:   bundle.SemiAnnually.String(),
+		Annually:       bundle.Annually.String(),
+		Biennially:     bundle.Biennially.String(),
+		Triennially:    bundle.Triennially.String(),
+		AllowCustomize: bundle.AllowCustomize,
+		ShowSavings:    bundle.ShowSavings,
+		Active:         bundle.Active,
+		Items:          make([]BundleItemResponse, 0, len(bundle.Items)),
+	}
+	for _, item := range bundle.Items {
+		resp.Items = append(resp.Items, BundleItemResponse{
+			ProductID:   item.ProductID,
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+			Optional:    item.Optional,
+			Discount:    item.Discount.String(),
+		})
+	}
+
+	if quote != nil {
+		resp.BillingCycle = quote.BillingCycle
+		resp.Currency = quote.Currency
+		resp.Price = quote.Price.String()
+		resp.ListPrice = quote.ListPrice.String()
+		if bundle.ShowSavings {
+			resp.Savings = quote.Savings.String()
+		}
+		prices := make(map[uint64]product.BundleQuoteItem, len(quote.Items))
+		for _, item := range quote.Items {
+			prices[item.ProductID] = item
+		}
+		for i := range resp.Items {
+			if price, ok := prices[resp.Items[i].ProductID]; ok {
+				resp.Items[i].SetupFee = price.SetupFee.String()
+				resp.Items[i].RecurringFee = price.RecurringFee.String()
+			}
+		}
+	}
+	return resp
+}
+
+// Request/Response types
+
+type BundleRequest struct {
+	Name           string              `json:"name" binding:"required"`
+	Description    string              `json:"description"`
+	SetupFee       string              `json:"setup_fee"`
+	Monthly        string              `json:"monthly"`
+	Quarterly      string              `json:"quarterly"`
+	SemiAnnually   string              `json:"semi_annually"`
+	Annually       string              `json:"annually"`
+	Biennially     string              `json:"biennially"`
+	Triennially    string              `json:"triennially"`
+	AllowCustomize bool                `json:"allow_customize"`
+	ShowSavings    *bool               `json:"show_savings"`
+	Active         *bool               `json:"active"`
+	SortOrder      int                 `json:"sort_order"`
+	Items          []BundleItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type BundleItemRequest struct {
+	ProductID uint64 `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity"`
+	Optional  bool   `json:"optional"`
+	Discount  string `json:"discount"` // Percentage
+	SortOrder int    `json:"sort_order"`
+}
+
+type BundleResponse struct {
+	ID             uint64               `json:"id"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	SetupFee       string               `json:"setup_fee"`
+	Monthly        string               `json:"monthly"`
+	Quarterly      string               `json:"quarterly"`
+	SemiAnnually   string               `json:"semi_annually"`
+	Annually       string               `json:"annually"`
+	Biennially     string               `json:"biennially"`
+	Triennially    string               `json:"triennially"`
+	AllowCustomize bool                 `json:"allow_customize"`
+	ShowSavings    bool                 `json:"show_savings"`
+	Active         bool                 `json:"active"`
+	BillingCycle   string               `json:"billing_cycle,omitempty"`
+	Currency       string               `json:"currency,omitempty"`
+	Price          string               `json:"price,omitempty"`
+	ListPrice      string               `json:"list_price,omitempty"`
+	Savings        string               `json:"savings,omitempty"`
+	Items          []BundleItemResponse `json:"items"`
+}
+
+type BundleItemResponse struct {
+	ProductID    uint64 `json:"product_id"`
+	ProductName  string `json:"product_name"`
+	Quantity     int    `json:"quantity"`
+	Optional     bool   `json:"optional"`
+	Discount     string `json:"discount"`
+	SetupFee     string `json:"setup_fee,omitempty"`
+	RecurringFee string `json:"recurring_fee,omitempty"`
+}
@@ -0,0 +1,535 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/cancellation"
+)
+
+// CancellationHandler handles service cancellation endpoints
+type CancellationHandler struct {
+	cancellationService *cancellation.Service
+}
+
+// NewCancellationHandler creates a new cancellation handler
+func NewCancellationHandler(cancellationService *cancellation.Service) *CancellationHandler {
+	return &CancellationHandler{cancellationService: cancellationService}
+}
+
+// GetRetentionOffers godoc
+// @Summary Get retention offers
+// @Description Returns the discounts offered instead of cancelling a service. Shown before the cancellation is confirmed.
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} RetentionOfferResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/cancellation/offers [get]
+func (h *CancellationHandler) GetRetentionOffers(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	offers, err := h.cancellationService.AvailableOffers(userID, serviceID)
+	if err != nil {
+		if err == cancellation.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch offers"})
+		return
+	}
+
+	response := make([]RetentionOfferResponse, 0, len(offers))
+	for i := range offers {
+		response = append(response, toRetentionOfferResponse(&offers[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AcceptRetentionOffer godoc
+// @Summary Accept retention offer
+// @Description Keeps a service with the discount of a retention offer applied to its renewals. A pending cancellation request is closed.
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param offer_id path int true "Retention offer ID"
+// @Success 200 {object} CancellationRequestResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/cancellation/offers/{offer_id}/accept [post]
+func (h *CancellationHandler) AcceptRetentionOffer(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+	offerID, err := strconv.ParseUint(c.Param("offer_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid offer ID"})
+		return
+	}
+
+	request, err := h.cancellationService.AcceptOffer(userID, serviceID, offerID)
+	if err != nil {
+		switch err {
+		case cancellation.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case cancellation.ErrOfferNotAvailable:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to accept offer"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toCancellationRequestResponse(request))
+}
+
+// RequestCancellation godoc
+// @Summary Request cancellation
+// @Description Asks for a service to be cancelled immediately or at the end of its billing cycle. The request awaits admin approval.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param request body CancellationRequestRequest true "Cancellation"
+// @Success 201 {object} CancellationRequestResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/cancellation [post]
+func (h *CancellationHandler) RequestCancellation(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req CancellationRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	request, err := h.cancellationService.RequestCancellation(userID, serviceID, domain.CancellationType(req.Type), req.Reason)
+	if err != nil {
+		switch err {
+		case cancellation.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case cancellation.ErrInvalidType, cancellation.ErrServiceNotActive:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case cancellation.ErrRequestExists:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request cancellation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCancellationRequestResponse(request))
+}
+
+// GetCancellation godoc
+// @Summary Get cancellation
+// @Description Returns the latest cancellation request of a service
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} CancellationRequestResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/cancellation [get]
+func (h *CancellationHandler) GetCancellation(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	request, err := h.cancellationService.GetServiceRequest(userID, serviceID)
+	if err != nil {
+		switch err {
+		case cancellation.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case cancellation.ErrRequestNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "No cancellation requested"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cancellation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toCancellationRequestResponse(request))
+}
+
+// WithdrawCancellation godoc
+// @Summary Withdraw cancellation
+// @Description Withdraws a pending or scheduled cancellation before the service is terminated
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/cancellation/withdraw [post]
+func (h *CancellationHandler) WithdrawCancellation(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	if err := h.cancellationService.WithdrawRequest(userID, serviceID); err != nil {
+		switch err {
+		case cancellation.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case cancellation.ErrRequestNotOpen:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to withdraw cancellation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Cancellation withdrawn"})
+}
+
+// AdminListCancellations godoc
+// @Summary List cancellation requests (Admin)
+// @Description Returns cancellation requests oldest first. Filter by status=pending for the approval queue.
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (pending, approved, rejected, withdrawn, retained, completed)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/cancellations [get]
+func (h *CancellationHandler) AdminListCancellations(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	requests, total, err := h.cancellationService.ListRequests(domain.CancellationStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cancellations"})
+		return
+	}
+
+	response := make([]CancellationRequestResponse, 0, len(requests))
+	for i := range requests {
+		response = append(response, toCancellationRequestResponse(&requests[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminApproveCancellation godoc
+// @Summary Approve cancellation (Admin)
+// @Description Approves a pending cancellation. Immediate cancellations terminate the service now, end of cycle ones on its next due date; renewal invoices after that date are cancelled.
+// @Tags admin/services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Cancellation request ID"
+// @Param request body ReviewCancellationRequest false "Notes"
+// @Success 200 {object} CancellationRequestResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/cancellations/{id}/approve [post]
+func (h *CancellationHandler) AdminApproveCancellation(c *gin.Context) {
+	h.review(c, h.cancellationService.ApproveRequest, "Failed to approve cancellation")
+}
+
+// AdminRejectCancellation godoc
+// @Summary Reject cancellation (Admin)
+// @Tags admin/services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Cancellation request ID"
+// @Param request body ReviewCancellationRequest false "Notes"
+// @Success 200 {object} CancellationRequestResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/cancellations/{id}/reject [post]
+func (h *CancellationHandler) AdminRejectCancellation(c *gin.Context) {
+	h.review(c, h.cancellationService.RejectRequest, "Failed to reject cancellation")
+}
+
+func (h *CancellationHandler) review(c *gin.Context, review func(id, adminID uint64, notes string) (*domain.CancellationRequest, error), failure string) {
+	adminID := GetCurrentUserID(c)
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request ID"})
+		return
+	}
+
+	var req ReviewCancellationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	request, err := review(requestID, adminID, req.Notes)
+	if err != nil {
+		switch err {
+		case cancellation.ErrRequestNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Cancellation request not found"})
+		case cancellation.ErrRequestNotPending:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toCancellationRequestResponse(request))
+}
+
+// AdminListRetentionOffers godoc
+// @Summary List retention offers (Admin)
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} RetentionOfferResponse
+// @Router /api/v1/admin/retention-offers [get]
+func (h *CancellationHandler) AdminListRetentionOffers(c *gin.Context) {
+	offers, err := h.cancellationService.ListOffers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch offers"})
+		return
+	}
+
+	response := make([]RetentionOfferResponse, 0, len(offers))
+	for i := range offers {
+		response = append(response, toRetentionOfferResponse(&offers[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateRetentionOffer godoc
+// @Summary Create retention offer (Admin)
+// @Description Creates a discount offered before a cancellation is confirmed. The coupon applies to the renewals of services that accept it, for its billing cycles.
+// @Tags admin/services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RetentionOfferRequest true "Offer"
+// @Success 201 {object} RetentionOfferResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/retention-offers [post]
+func (h *CancellationHandler) AdminCreateRetentionOffer(c *gin.Context) {
+	var req RetentionOfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	offer, err := h.cancellationService.CreateOffer(req.toDomain())
+	if err != nil {
+		if err == cancellation.ErrCouponNotFound {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create offer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toRetentionOfferResponse(offer))
+}
+
+// AdminUpdateRetentionOffer godoc
+// @Summary Update retention offer (Admin)
+// @Tags admin/services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Retention offer ID"
+// @Param request body RetentionOfferRequest true "Offer"
+// @Success 200 {object} RetentionOfferResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/retention-offers/{id} [put]
+func (h *CancellationHandler) AdminUpdateRetentionOffer(c *gin.Context) {
+	offerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid offer ID"})
+		return
+	}
+
+	var req RetentionOfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	offer, err := h.cancellationService.UpdateOffer(offerID, req.toDomain())
+	if err != nil {
+		switch err {
+		case cancellation.ErrOfferNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Offer not found"})
+		case cancellation.ErrCouponNotFound:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update offer"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toRetentionOfferResponse(offer))
+}
+
+// AdminDeleteRetentionOffer godoc
+// @Summary Delete retention offer (Admin)
+// @Description Deletes a retention offer. Offers that were accepted are deactivated instead so their discounts keep applying.
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Retention offer ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/retention-offers/{id} [delete]
+func (h *CancellationHandler) AdminDeleteRetentionOffer(c *gin.Context) {
+	offerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid offer ID"})
+		return
+	}
+
+	if err := h.cancellationService.DeleteOffer(offerID); err != nil {
+		if err == cancellation.ErrOfferNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Offer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Offer deleted"})
+}
+
+func toRetentionOfferResponse(offer *domain.RetentionOffer) RetentionOfferResponse {
+	return RetentionOfferResponse{
+		ID:            offer.ID,
+		Name:          offer.Name,
+		Description:   offer.Description,
+		ProductID:     offer.ProductID,
+		CouponID:      offer.CouponID,
+		CouponCode:    offer.Coupon.Code,
+		DiscountType:  string(offer.Coupon.Type),
+		Discount:      offer.Coupon.Amount.String(),
+		BillingCycles: offer.Coupon.BillingCycles,
+		Active:        offer.Active,
+		SortOrder:     offer.SortOrder,
+	}
+}
+
+func toCancellationRequestResponse(r *domain.CancellationRequest) CancellationRequestResponse {
+	resp := CancellationRequestResponse{
+		ID:               r.ID,
+		ServiceID:        r.ServiceID,
+		CustomerID:       r.CustomerID,
+		ProductName:      r.Service.Product.Name,
+		Type:             string(r.Type),
+		Reason:           r.Reason,
+		Status:           string(r.Status),
+		RetentionOfferID: r.RetentionOfferID,
+		AdminNotes:       r.AdminNotes,
+		CreatedAt:        r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.Customer.ID != 0 {
+		resp.CustomerEmail = r.Customer.Email
+	}
+	if r.ScheduledFor != nil {
+		resp.ScheduledFor = r.ScheduledFor.Format(time.RFC3339)
+	}
+	if r.CompletedAt != nil {
+		resp.CompletedAt = r.CompletedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func (r *RetentionOfferRequest) toDomain() *domain.RetentionOffer {
+	offer := &domain.RetentionOffer{
+		Name:        r.Name,
+		Description: r.Description,
+		ProductID:   r.ProductID,
+		CouponID:    r.CouponID,
+		SortOrder:   r.SortOrder,
+		Active:      true,
+	}
+	if r.Active != nil {
+		offer.Active = *r.Active
+	}
+	return offer
+}
+
+// Request/Response types
+
+type CancellationRequestRequest struct {
+	Type   string `json:"type" binding:"required,oneof=immediate end_of_cycle"`
+	Reason string `json:"reason"`
+}
+
+type ReviewCancellationRequest struct {
+	Notes string `json:"notes"`
+}
+
+type RetentionOfferRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	ProductID   *uint64 `json:"product_id"`
+	CouponID    uint64  `json:"coupon_id" binding:"required"`
+	SortOrder   int     `json:"sort_order"`
+	Active      *bool   `json:"active"`
+}
+
+type RetentionOfferResponse struct {
+	ID            uint64  `json:"id"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	ProductID     *uint64 `json:"product_id,omitempty"`
+	CouponID      uint64  `json:"coupon_id"`
+	CouponCode    string  `json:"coupon_code"`
+	DiscountType  string  `json:"discount_type"`
+	Discount      string  `json:"discount"`
+	BillingCycles int     `json:"billing_cycles"`
+	Active        bool    `json:"active"`
+	SortOrder     int     `json:"sort_order"`
+}
+
+type CancellationRequestResponse struct {
+	ID               uint64  `json:"id"`
+	ServiceID        uint64  `json:"service_id"`
+	CustomerID       uint64  `json:"customer_id"`
+	CustomerEmail    string  `json:"customer_email,omitempty"`
+	ProductName      string  `json:"product_name,omitempty"`
+	Type             string  `json:"type"`
+	Reason           string  `json:"reason"`
+	Status           string  `json:"status"`
+	RetentionOfferID *uint64 `json:"retention_offer_id,omitempty"`
+	ScheduledFor     string  `json:"scheduled_for,omitempty"`
+	AdminNotes       string  `json:"admin_notes,omitempty"`
+	CompletedAt      string  `json:"completed_at,omitempty"`
+	CreatedAt        string  `json:"created_at"`
+}
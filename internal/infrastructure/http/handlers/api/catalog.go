@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/product"
+)
+
+const maxCatalogImportSize = 10 << 20
+
+// AdminExportCatalog godoc
+// @Summary Export product catalog (Admin)
+// @Description Downloads groups, products, pricing, config options and addons as JSON or CSV. The CSV format only contains groups, products, pricing and assignments.
+// @Tags admin/products
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} product.Catalog
+// @Router /api/v1/admin/catalog/export [get]
+func (h *ProductHandler) AdminExportCatalog(c *gin.Context) {
+	catalog, err := h.productService.ExportCatalog()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export catalog"})
+		return
+	}
+
+	name := "catalog-" + time.Now().Format("20060102-150405")
+	if catalogFormat(c) == "csv" {
+		var buf bytes.Buffer
+		if err := product.WriteCatalogCSV(&buf, catalog); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export catalog"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+	c.IndentedJSON(http.StatusOK, catalog)
+}
+
+// AdminPreviewCatalogImport godoc
+// @Summary Preview catalog import (Admin)
+// @Description Validates an exported catalog and lists the records an import would create or update
+// @Tags admin/products
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param format query string false "json (default) or csv"
+// @Param file formData file false "Catalog file"
+// @Success 200 {object} product.ImportPlan
+// @Failure 400 {object} CatalogValidationResponse
+// @Router /api/v1/admin/catalog/import/preview [post]
+func (h *ProductHandler) AdminPreviewCatalogImport(c *gin.Context) {
+	catalog, ok := readCatalog(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.productService.PreviewImport(catalog)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// AdminImportCatalog godoc
+// @Summary Import catalog (Admin)
+// @Description Validates an exported catalog and upserts it. Records are matched by slug or name and records missing from the file are kept.
+// @Tags admin/products
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param format query string false "json (default) or csv"
+// @Param file formData file false "Catalog file"
+// @Success 200 {object} product.ImportPlan
+// @Failure 400 {object} CatalogValidationResponse
+// @Router /api/v1/admin/catalog/import [post]
+func (h *ProductHandler) AdminImportCatalog(c *gin.Context) {
+	catalog, ok := readCatalog(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.productService.ImportCatalog(catalog)
+	if err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// catalogFormat returns "csv" or "json" from the format query parameter,
+// falling back to the request content type
+func catalogFormat(c *gin.Context) string {
+	switch strings.ToLower(c.Query("format")) {
+	case "csv":
+		return "csv"
+	case "json":
+		return "json"
+	}
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+// readCatalog decodes a catalog from a multipart "file" field or the raw
+// request body. It writes the error response itself.
+func readCatalog(c *gin.Context) (*product.Catalog, bool) {
+	format := catalogFormat(c)
+
+	var body io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogImportSize)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing catalog file"})
+			return nil, false
+		}
+		if header.Size > maxCatalogImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Catalog file is too large"})
+			return nil, false
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read catalog file"})
+			return nil, false
+		}
+		defer file.Close()
+		body = file
+		if c.Query("format") == "" && strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+			format = "csv"
+		}
+	}
+
+	if format == "csv" {
+		catalog, err := product.ReadCatalogCSV(body)
+		if err != nil {
+			respondCatalogError(c, err)
+			return nil, false
+		}
+		return catalog, true
+	}
+
+	var catalog product.Catalog
+	if err := json.NewDecoder(body).Decode(&catalog); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid catalog JSON: " + err.Error()})
+		return nil, false
+	}
+	return &catalog, true
+}
+
+func respondCatalogError(c *gin.Context, err error) {
+	var validationErr *product.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, CatalogValidationResponse{
+			Error:    "Catalog validation failed",
+			Problems: validationErr.Problems,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to import catalog: " + err.Error()})
+}
+
+// Request/Response types
+
+type CatalogValidationResponse struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems"`
+}
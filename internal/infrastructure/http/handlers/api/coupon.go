@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/coupon"
+)
+
+// CouponHandler handles coupon batch endpoints
+type CouponHandler struct {
+	couponService *coupon.Service
+}
+
+// NewCouponHandler creates a new coupon handler
+func NewCouponHandler(couponService *coupon.Service) *CouponHandler {
+	return &CouponHandler{couponService: couponService}
+}
+
+// AdminGenerateBatch godoc
+// @Summary Generate coupon batch (Admin)
+// @Description Generates unique single-use coupon codes from a pattern, in which every X is replaced with a random letter or digit. The codes share the discount and rules of the batch.
+// @Tags admin/coupons
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body GenerateCouponBatchRequest true "Batch"
+// @Success 201 {object} CouponBatchResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/coupons/batches [post]
+func (h *CouponHandler) AdminGenerateBatch(c *gin.Context) {
+	var req GenerateCouponBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	input := coupon.BatchInput{
+		Name:           req.Name,
+		Pattern:        req.Pattern,
+		Quantity:       req.Quantity,
+		Description:    req.Description,
+		Type:           domain.CouponType(req.Type),
+		Currency:       req.Currency,
+		BillingCycles:  req.BillingCycles,
+		AppliesToNew:   true,
+		AppliesToRenew: req.AppliesToRenew,
+		ProductIDs:     req.ProductIDs,
+	}
+	if req.AppliesToNew != nil {
+		input.AppliesToNew = *req.AppliesToNew
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid amount"})
+		return
+	}
+	input.Amount = amount
+	if req.MinOrderAmount != "" {
+		minOrderAmount, err := decimal.NewFromString(req.MinOrderAmount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid min_order_amount"})
+			return
+		}
+		input.MinOrderAmount = minOrderAmount
+	}
+	if input.StartsAt, err = parseOptionalTime(req.StartsAt); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "starts_at must be an RFC 3339 timestamp"})
+		return
+	}
+	if input.ExpiresAt, err = parseOptionalTime(req.ExpiresAt); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expires_at must be an RFC 3339 timestamp"})
+		return
+	}
+
+	var createdBy *uint64
+	if adminID := c.GetUint64("admin_id"); adminID != 0 {
+		createdBy = &adminID
+	}
+
+	batch, err := h.couponService.GenerateBatch(input, createdBy)
+	if err != nil {
+		writeCouponError(c, err, "Failed to generate coupon batch")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCouponBatchResponse(batch, 0))
+}
+
+// AdminListBatches godoc
+// @Summary List coupon batches (Admin)
+// @Description Returns the coupon batches with how many of their codes were redeemed, newest first
+// @Tags admin/coupons
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string][]CouponBatchResponse
+// @Router /api/v1/admin/coupons/batches [get]
+func (h *CouponHandler) AdminListBatches(c *gin.Context) {
+	batches, err := h.couponService.ListBatches()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch coupon batches"})
+		return
+	}
+	redeemed, err := h.couponService.Redeemed()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch coupon batches"})
+		return
+	}
+
+	response := make([]CouponBatchResponse, 0, len(batches))
+	for i := range batches {
+		response = append(response, toCouponBatchResponse(&batches[i], redeemed[batches[i].ID]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batches": response})
+}
+
+// AdminGetBatch godoc
+// @Summary Get coupon batch report (Admin)
+// @Description Returns a coupon batch with every redemption of its codes: the customer, the order and when
+// @Tags admin/coupons
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Success 200 {object} CouponBatchReportResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/coupons/batches/{id} [get]
+func (h *CouponHandler) AdminGetBatch(c *gin.Context) {
+	batchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid batch ID"})
+		return
+	}
+
+	report, err := h.couponService.Report(batchID)
+	if err != nil {
+		writeCouponError(c, err, "Failed to fetch coupon batch")
+		return
+	}
+
+	response := CouponBatchReportResponse{
+		CouponBatchResponse: toCouponBatchResponse(&report.Batch, report.Redeemed),
+		RedemptionRate:      report.RedemptionRate(),
+		Redemptions:         make([]CouponRedemptionResponse, 0, len(report.Redemptions)),
+	}
+	for _, redeemed := range report.Redemptions {
+		redemption := CouponRedemptionResponse{CouponID: redeemed.ID, Code: redeemed.Code}
+		if redeemed.RedeemedBy != nil {
+			redemption.CustomerID = *redeemed.RedeemedBy
+		}
+		if redeemed.RedeemedOrderID != nil {
+			redemption.OrderID = *redeemed.RedeemedOrderID
+		}
+		if redeemed.RedeemedAt != nil {
+			redemption.RedeemedAt = redeemed.RedeemedAt.Format(time.RFC3339)
+		}
+		response.Redemptions = append(response.Redemptions, redemption)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminExportBatchCodes godoc
+// @Summary Export coupon batch codes (Admin)
+// @Description Downloads the codes of a coupon batch as CSV, with who redeemed each code with which order and when
+// @Tags admin/coupons
+// @Produce text/csv
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/coupons/batches/{id}/codes [get]
+func (h *CouponHandler) AdminExportBatchCodes(c *gin.Context) {
+	batchID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid batch ID"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.couponService.WriteCodesCSV(&buf, batchID); err != nil {
+		writeCouponError(c, err, "Failed to export coupon codes")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("coupon-batch-%d.csv", batchID)))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+func writeCouponError(c *gin.Context, err error, fallback string) {
+	switch err {
+	case coupon.ErrBatchNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Coupon batch not found"})
+	case coupon.ErrNameRequired, coupon.ErrInvalidQuantity, coupon.ErrInvalidPattern,
+		coupon.ErrInvalidType, coupon.ErrInvalidAmount:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fallback})
+	}
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func toCouponBatchResponse(b *domain.CouponBatch, redeemed int64) CouponBatchResponse {
+	return CouponBatchResponse{
+		ID:        b.ID,
+		Name:      b.Name,
+		Pattern:   b.Pattern,
+		Quantity:  b.Quantity,
+		Redeemed:  redeemed,
+		CreatedAt: b.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// Request/Response types
+
+type GenerateCouponBatchRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Pattern        string   `json:"pattern" binding:"required"` // Every X is replaced, such as BF25-XXXXXX
+	Quantity       int      `json:"quantity" binding:"required"`
+	Description    string   `json:"description"`
+	Type           string   `json:"type" binding:"required"`
+	Amount         string   `json:"amount" binding:"required"`
+	Currency       string   `json:"currency"`
+	BillingCycles  int      `json:"billing_cycles"`
+	MinOrderAmount string   `json:"min_order_amount"`
+	AppliesToNew   *bool    `json:"applies_to_new"` // Defaults to true
+	AppliesToRenew bool     `json:"applies_to_renew"`
+	ProductIDs     []uint64 `json:"product_ids"`
+	StartsAt       string   `json:"starts_at"`
+	ExpiresAt      string   `json:"expires_at"`
+}
+
+type CouponBatchResponse struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Pattern   string `json:"pattern"`
+	Quantity  int    `json:"quantity"`
+	Redeemed  int64  `json:"redeemed"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CouponBatchReportResponse struct {
+	CouponBatchResponse
+	RedemptionRate float64                    `json:"redemption_rate"`
+	Redemptions    []CouponRedemptionResponse `json:"redemptions"`
+}
+
+type CouponRedemptionResponse struct {
+	CouponID   uint64 `json:"coupon_id"`
+	Code       string `json:"code"`
+	CustomerID uint64 `json:"customer_id"`
+	OrderID    uint64 `json:"order_id"`
+	RedeemedAt string `json:"redeemed_at"`
+}
@@ -0,0 +1,500 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customergroup"
+)
+
+// CustomerGroupHandler handles customer groups, their members and the
+// product prices they get
+type CustomerGroupHandler struct {
+	groupService *customergroup.Service
+}
+
+// NewCustomerGroupHandler creates a new customer group handler
+func NewCustomerGroupHandler(groupService *customergroup.Service) *CustomerGroupHandler {
+	return &CustomerGroupHandler{groupService: groupService}
+}
+
+// AdminListGroups godoc
+// @Summary List customer groups (Admin)
+// @Description Returns the customer groups in sort order with their member counts
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string][]CustomerGroupResponse
+// @Router /api/v1/admin/customer-groups [get]
+func (h *CustomerGroupHandler) AdminListGroups(c *gin.Context) {
+	groups, members, err := h.groupService.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch customer groups"})
+		return
+	}
+
+	response := make([]CustomerGroupResponse, 0, len(groups))
+	for i := range groups {
+		response = append(response, toCustomerGroupResponse(&groups[i], members[groups[i].ID]))
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": response})
+}
+
+// AdminCreateGroup godoc
+// @Summary Create customer group (Admin)
+// @Description Creates a customer group. Members get the payment terms of the first group by sort order that sets them and are tax exempt when any of their groups is.
+// @Tags admin/customer-groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CustomerGroupRequest true "Customer group"
+// @Success 201 {object} CustomerGroupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups [post]
+func (h *CustomerGroupHandler) AdminCreateGroup(c *gin.Context) {
+	var req CustomerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	group, err := h.groupService.CreateGroup(req.toInput())
+	if err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCustomerGroupResponse(group, 0))
+}
+
+// AdminUpdateGroup godoc
+// @Summary Update customer group (Admin)
+// @Description Replaces the fields of a customer group
+// @Tags admin/customer-groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Param request body CustomerGroupRequest true "Customer group"
+// @Success 200 {object} CustomerGroupResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id} [put]
+func (h *CustomerGroupHandler) AdminUpdateGroup(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	var req CustomerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	group, err := h.groupService.UpdateGroup(groupID, req.toInput())
+	if err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCustomerGroupResponse(group, 0))
+}
+
+// AdminDeleteGroup godoc
+// @Summary Delete customer group (Admin)
+// @Description Deletes a customer group with its memberships and prices
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id} [delete]
+func (h *CustomerGroupHandler) AdminDeleteGroup(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	if err := h.groupService.DeleteGroup(groupID); err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Customer group deleted"})
+}
+
+// AdminListMembers godoc
+// @Summary List customer group members (Admin)
+// @Description Returns the customers of a group
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Success 200 {object} map[string][]CustomerGroupMemberResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/members [get]
+func (h *CustomerGroupHandler) AdminListMembers(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	customers, err := h.groupService.ListMembers(groupID)
+	if err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	response := make([]CustomerGroupMemberResponse, 0, len(customers))
+	for _, customer := range customers {
+		response = append(response, CustomerGroupMemberResponse{
+			ID:        customer.ID,
+			Email:     customer.Email,
+			FirstName: customer.FirstName,
+			LastName:  customer.LastName,
+			Company:   customer.Company,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"members": response})
+}
+
+// AdminAddMember godoc
+// @Summary Add customer group member (Admin)
+// @Description Adds a customer to a group. Adding a member twice does nothing.
+// @Tags admin/customer-groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Param request body CustomerGroupMemberRequest true "Customer"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/members [post]
+func (h *CustomerGroupHandler) AdminAddMember(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	var req CustomerGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.groupService.AddMember(groupID, req.CustomerID); err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Customer added to group"})
+}
+
+// AdminRemoveMember godoc
+// @Summary Remove customer group member (Admin)
+// @Description Removes a customer from a group
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Param customer_id path int true "Customer ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/members/{customer_id} [delete]
+func (h *CustomerGroupHandler) AdminRemoveMember(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+	customerID, err := strconv.ParseUint(c.Param("customer_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	if err := h.groupService.RemoveMember(groupID, customerID); err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Customer removed from group"})
+}
+
+// AdminListPrices godoc
+// @Summary List customer group prices (Admin)
+// @Description Returns the product prices of a group. Prices of -1 keep the product price.
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Success 200 {object} map[string][]CustomerGroupPriceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/prices [get]
+func (h *CustomerGroupHandler) AdminListPrices(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	prices, err := h.groupService.ListPrices(groupID)
+	if err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	response := make([]CustomerGroupPriceResponse, 0, len(prices))
+	for i := range prices {
+		response = append(response, toCustomerGroupPriceResponse(&prices[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"prices": response})
+}
+
+// AdminSetPrice godoc
+// @Summary Set customer group price (Admin)
+// @Description Sets the price of a product in a currency for the members of a group, replacing the one set before. Prices left out or set to -1 keep the product price; the others replace it in carts and price quotes. A group with prices for a restricted product can see and order it.
+// @Tags admin/customer-groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Param request body CustomerGroupPriceRequest true "Group price"
+// @Success 200 {object} CustomerGroupPriceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/prices [put]
+func (h *CustomerGroupHandler) AdminSetPrice(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+
+	var req CustomerGroupPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	price, err := req.toPrice(groupID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	saved, err := h.groupService.SetPrice(*price)
+	if err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toCustomerGroupPriceResponse(saved))
+}
+
+// AdminDeletePrice godoc
+// @Summary Delete customer group price (Admin)
+// @Description Removes the price of a product in a currency from a group
+// @Tags admin/customer-groups
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Group ID"
+// @Param product_id path int true "Product ID"
+// @Param currency query string true "Currency code"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customer-groups/{id}/prices/{product_id} [delete]
+func (h *CustomerGroupHandler) AdminDeletePrice(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid group ID"})
+		return
+	}
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+	currency := c.Query("currency")
+	if currency == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "currency is required"})
+		return
+	}
+
+	if err := h.groupService.DeletePrice(groupID, productID, currency); err != nil {
+		writeCustomerGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Group price deleted"})
+}
+
+func writeCustomerGroupError(c *gin.Context, err error) {
+	switch err {
+	case customergroup.ErrGroupNotFound, customergroup.ErrCustomerNotFound, customergroup.ErrProductNotFound,
+		customergroup.ErrPriceNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case customergroup.ErrNameExists:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case customergroup.ErrNameRequired, customergroup.ErrInvalidTerms, customergroup.ErrInvalidCurrency,
+		customergroup.ErrInvalidGroupPrice:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update customer group"})
+	}
+}
+
+func toCustomerGroupResponse(group *domain.CustomerGroup, members int64) CustomerGroupResponse {
+	return CustomerGroupResponse{
+		ID:               group.ID,
+		Name:             group.Name,
+		Description:      group.Description,
+		Color:            group.Color,
+		SortOrder:        group.SortOrder,
+		Active:           group.Active,
+		PaymentTermsDays: group.PaymentTermsDays,
+		TaxExempt:        group.TaxExempt,
+		Members:          members,
+		CreatedAt:        group.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toCustomerGroupPriceResponse(p *domain.CustomerGroupPrice) CustomerGroupPriceResponse {
+	return CustomerGroupPriceResponse{
+		ProductID:    p.ProductID,
+		ProductName:  p.Product.Name,
+		Currency:     p.Currency,
+		SetupFee:     p.SetupFee.String(),
+		Monthly:      p.Monthly.String(),
+		Quarterly:    p.Quarterly.String(),
+		SemiAnnually: p.SemiAnnually.String(),
+		Annually:     p.Annually.String(),
+		Biennially:   p.Biennially.String(),
+		Triennially:  p.Triennially.String(),
+	}
+}
+
+// Request/Response types
+
+type CustomerGroupRequest struct {
+	Name             string `json:"name" binding:"required,max=100"`
+	Description      string `json:"description"`
+	Color            string `json:"color" binding:"max=7"`
+	SortOrder        int    `json:"sort_order"`
+	Active           *bool  `json:"active"`             // Defaults to true
+	PaymentTermsDays *int   `json:"payment_terms_days"` // null for the default terms
+	TaxExempt        bool   `json:"tax_exempt"`
+}
+
+func (r CustomerGroupRequest) toInput() customergroup.Input {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return customergroup.Input{
+		Name:             r.Name,
+		Description:      r.Description,
+		Color:            r.Color,
+		SortOrder:        r.SortOrder,
+		Active:           active,
+		PaymentTermsDays: r.PaymentTermsDays,
+		TaxExempt:        r.TaxExempt,
+	}
+}
+
+type CustomerGroupMemberRequest struct {
+	CustomerID uint64 `json:"customer_id" binding:"required"`
+}
+
+type CustomerGroupPriceRequest struct {
+	ProductID    uint64 `json:"product_id" binding:"required"`
+	Currency     string `json:"currency" binding:"required,len=3"`
+	SetupFee     string `json:"setup_fee"` // Empty or -1 keeps the product price
+	Monthly      string `json:"monthly"`
+	Quarterly    string `json:"quarterly"`
+	SemiAnnually string `json:"semi_annually"`
+	Annually     string `json:"annually"`
+	Biennially   string `json:"biennially"`
+	Triennially  string `json:"triennially"`
+}
+
+func (r CustomerGroupPriceRequest) toPrice(groupID uint64) (*domain.CustomerGroupPrice, error) {
+	price := &domain.CustomerGroupPrice{CustomerGroupID: groupID, ProductID: r.ProductID, Currency: r.Currency}
+	prices := []struct {
+		field string
+		raw   string
+		dest  *decimal.Decimal
+	}{
+		{"setup_fee", r.SetupFee, &price.SetupFee},
+		{"monthly", r.Monthly, &price.Monthly},
+		{"quarterly", r.Quarterly, &price.Quarterly},
+		{"semi_annually", r.SemiAnnually, &price.SemiAnnually},
+		{"annually", r.Annually, &price.Annually},
+		{"biennially", r.Biennially, &price.Biennially},
+		{"triennially", r.Triennially, &price.Triennially},
+	}
+	for _, p := range prices {
+		if p.raw == "" {
+			*p.dest = decimal.NewFromInt(-1)
+			continue
+		}
+		value, err := decimal.NewFromString(p.raw)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s", p.field)
+		}
+		*p.dest = value
+	}
+	return price, nil
+}
+
+type CustomerGroupResponse struct {
+	ID               uint64 `json:"id"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Color            string `json:"color"`
+	SortOrder        int    `json:"sort_order"`
+	Active           bool   `json:"active"`
+	PaymentTermsDays *int   `json:"payment_terms_days"`
+	TaxExempt        bool   `json:"tax_exempt"`
+	Members          int64  `json:"members"`
+	CreatedAt        string `json:"created_at"`
+}
+
+type CustomerGroupMemberResponse struct {
+	ID        uint64 `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Company   string `json:"company"`
+}
+
+type CustomerGroupPriceResponse struct {
+	ProductID    uint64 `json:"product_id"`
+	ProductName  string `json:"product_name,omitempty"`
+	Currency     string `json:"currency"`
+	SetupFee     string `json:"setup_fee"`
+	Monthly      string `json:"monthly"`
+	Quarterly    string `json:"quarterly"`
+	SemiAnnually string `json:"semi_annually"`
+	Annually     string `json:"annually"`
+	Biennially   string `json:"biennially"`
+	Triennially  string `json:"triennially"`
+}
@@ -0,0 +1,748 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+)
+
+// CustomFieldHandler handles the custom field endpoints of products,
+// orders and invoices
+type CustomFieldHandler struct {
+	customFieldService *customfield.Service
+}
+
+// NewCustomFieldHandler creates a new custom field handler
+func NewCustomFieldHandler(customFieldService *customfield.Service) *CustomFieldHandler {
+	return &CustomFieldHandler{customFieldService: customFieldService}
+}
+
+// GetOrderFields godoc
+// @Summary Get order fields
+// @Description Returns the custom fields of a product to fill in when adding it to the cart
+// @Tags cart
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Success 200 {array} CustomFieldResponse
+// @Router /api/v1/order-fields/{product_id} [get]
+func (h *CustomFieldHandler) GetOrderFields(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	fields, err := h.customFieldService.ListProductFields(productID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	response := make([]CustomFieldResponse, 0, len(fields))
+	for i := range fields {
+		if fields[i].ShowOnOrder {
+			response = append(response, toCustomFieldResponse(&fields[i]))
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetServiceFields godoc
+// @Summary Get service fields
+// @Description Returns the custom field values of a service that are visible to the customer
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/custom-fields [get]
+func (h *CustomFieldHandler) GetServiceFields(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	values, err := h.customFieldService.GetCustomerServiceValues(userID, serviceID)
+	if err != nil {
+		if err == customfield.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminListProductFields godoc
+// @Summary List product custom fields (Admin)
+// @Description Returns every custom field of a product, including inactive and admin-only ones
+// @Tags admin/products
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Success 200 {array} CustomFieldResponse
+// @Router /api/v1/admin/products/{id}/custom-fields [get]
+func (h *CustomFieldHandler) AdminListProductFields(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	fields, err := h.customFieldService.ListAllProductFields(productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	response := make([]CustomFieldResponse, 0, len(fields))
+	for i := range fields {
+		response = append(response, toCustomFieldResponse(&fields[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateProductField godoc
+// @Summary Create product custom field (Admin)
+// @Description Adds a custom field to a product. Fields shown on the order are collected when the product is added to the cart, stored on the service and passed to the provisioning module.
+// @Tags admin/products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param request body CustomFieldRequest true "Field"
+// @Success 201 {object} CustomFieldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/custom-fields [post]
+func (h *CustomFieldHandler) AdminCreateProductField(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	var req CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	field, err := h.customFieldService.CreateField(productID, req.toDomain())
+	if err != nil {
+		h.fieldError(c, err, "Failed to create field")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCustomFieldResponse(field))
+}
+
+// AdminUpdateProductField godoc
+// @Summary Update custom field (Admin)
+// @Tags admin/products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Field ID"
+// @Param request body CustomFieldRequest true "Field"
+// @Success 200 {object} CustomFieldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/custom-fields/{id} [put]
+func (h *CustomFieldHandler) AdminUpdateProductField(c *gin.Context) {
+	fieldID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid field ID"})
+		return
+	}
+
+	var req CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	field, err := h.customFieldService.UpdateField(fieldID, req.toDomain())
+	if err != nil {
+		h.fieldError(c, err, "Failed to update field")
+		return
+	}
+
+	c.JSON(http.StatusOK, toCustomFieldResponse(field))
+}
+
+// AdminDeleteProductField godoc
+// @Summary Delete custom field (Admin)
+// @Description Deletes a custom field of a product, orders or invoices with its values
+// @Tags admin/products
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Field ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/custom-fields/{id} [delete]
+func (h *CustomFieldHandler) AdminDeleteProductField(c *gin.Context) {
+	fieldID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid field ID"})
+		return
+	}
+
+	if err := h.customFieldService.DeleteField(fieldID); err != nil {
+		if err == customfield.ErrFieldNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Field not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete field"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Field deleted"})
+}
+
+// AdminGetServiceFields godoc
+// @Summary Get service custom fields (Admin)
+// @Description Returns every custom field value of a service, including admin-only fields
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/custom-fields [get]
+func (h *CustomFieldHandler) AdminGetServiceFields(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	values, err := h.customFieldService.GetServiceValues(serviceID)
+	if err != nil {
+		if err == customfield.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminUpdateServiceFields godoc
+// @Summary Update service custom fields (Admin)
+// @Description Changes custom field values of a service by field name. Every change is recorded in the field history; an empty value clears the field.
+// @Tags admin/services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param request body UpdateServiceFieldsRequest true "Values"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/custom-fields [put]
+func (h *CustomFieldHandler) AdminUpdateServiceFields(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req UpdateServiceFieldsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	values, err := h.customFieldService.UpdateServiceValues(serviceID, req.Values, userID)
+	if err != nil {
+		switch {
+		case err == customfield.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+		case errors.Is(err, customfield.ErrUnknownField), errors.Is(err, customfield.ErrFieldRequired), errors.Is(err, customfield.ErrInvalidValue):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update fields"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminListServiceFieldHistory godoc
+// @Summary List service custom field history (Admin)
+// @Description Returns the changes made to the custom field values of a service, newest first. Password values are masked.
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/services/{id}/custom-fields/history [get]
+func (h *CustomFieldHandler) AdminListServiceFieldHistory(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+	limit, offset := PaginationParams(c)
+
+	changes, total, err := h.customFieldService.ListServiceChanges(serviceID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch history"})
+		return
+	}
+
+	response := make([]CustomFieldChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		resp := CustomFieldChangeResponse{
+			ID:        change.ID,
+			FieldID:   change.CustomFieldID,
+			FieldName: change.CustomField.FieldName,
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+			ChangedBy: change.ChangedBy,
+			CreatedAt: change.CreatedAt.Format(time.RFC3339),
+		}
+		if change.User != nil {
+			resp.ChangedByName = change.User.FirstName + " " + change.User.LastName
+		}
+		response = append(response, resp)
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// GetCheckoutFields godoc
+// @Summary Get checkout fields
+// @Description Returns the order fields to fill in at checkout, such as a purchase order number
+// @Tags orders
+// @Produce json
+// @Success 200 {array} CustomFieldResponse
+// @Router /api/v1/checkout-fields [get]
+func (h *CustomFieldHandler) GetCheckoutFields(c *gin.Context) {
+	fields, err := h.customFieldService.ListBillingFields(domain.CustomFieldEntityOrder, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	response := make([]CustomFieldResponse, 0, len(fields))
+	for i := range fields {
+		if fields[i].ShowOnOrder {
+			response = append(response, toCustomFieldResponse(&fields[i]))
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetInvoiceFields godoc
+// @Summary Get invoice fields
+// @Description Returns the filled in custom fields printed on an invoice of the current user, such as the purchase order number
+// @Tags invoices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/invoices/{id}/custom-fields [get]
+func (h *CustomFieldHandler) GetInvoiceFields(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	values, err := h.customFieldService.PrintedInvoiceValues(userID, invoiceID)
+	if err != nil {
+		h.valueError(c, err, "Failed to fetch fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminListOrderFields godoc
+// @Summary List order custom fields (Admin)
+// @Description Returns every order field, including inactive and admin-only ones
+// @Tags admin/orders
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} CustomFieldResponse
+// @Router /api/v1/admin/order-fields [get]
+func (h *CustomFieldHandler) AdminListOrderFields(c *gin.Context) {
+	h.listBillingFields(c, domain.CustomFieldEntityOrder)
+}
+
+// AdminCreateOrderField godoc
+// @Summary Create order custom field (Admin)
+// @Description Adds a field to orders. Fields shown on the order are filled in at checkout and required ones must be; values are carried onto the invoice of the order and printed on it when show_on_invoice is set.
+// @Tags admin/orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CustomFieldRequest true "Field"
+// @Success 201 {object} CustomFieldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/order-fields [post]
+func (h *CustomFieldHandler) AdminCreateOrderField(c *gin.Context) {
+	h.createBillingField(c, domain.CustomFieldEntityOrder)
+}
+
+// AdminListInvoiceFields godoc
+// @Summary List invoice custom fields (Admin)
+// @Description Returns every invoice field, including inactive and admin-only ones
+// @Tags admin/invoices
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} CustomFieldResponse
+// @Router /api/v1/admin/invoice-fields [get]
+func (h *CustomFieldHandler) AdminListInvoiceFields(c *gin.Context) {
+	h.listBillingFields(c, domain.CustomFieldEntityInvoice)
+}
+
+// AdminCreateInvoiceField godoc
+// @Summary Create invoice custom field (Admin)
+// @Description Adds a field staff fill in on invoices, printed on them when show_on_invoice is set
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CustomFieldRequest true "Field"
+// @Success 201 {object} CustomFieldResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/invoice-fields [post]
+func (h *CustomFieldHandler) AdminCreateInvoiceField(c *gin.Context) {
+	h.createBillingField(c, domain.CustomFieldEntityInvoice)
+}
+
+// AdminGetOrderFieldValues godoc
+// @Summary Get order custom field values (Admin)
+// @Description Returns the order fields with their values on an order
+// @Tags admin/orders
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/orders/{id}/custom-fields [get]
+func (h *CustomFieldHandler) AdminGetOrderFieldValues(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid order ID"})
+		return
+	}
+
+	values, err := h.customFieldService.GetOrderValues(orderID)
+	if err != nil {
+		h.valueError(c, err, "Failed to fetch fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminUpdateOrderFieldValues godoc
+// @Summary Update order custom field values (Admin)
+// @Description Changes order field values of an order by field name. Every change is recorded in the field history; an empty value clears the field. The invoice of the order keeps its own values.
+// @Tags admin/orders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Order ID"
+// @Param request body UpdateServiceFieldsRequest true "Values"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/orders/{id}/custom-fields [put]
+func (h *CustomFieldHandler) AdminUpdateOrderFieldValues(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid order ID"})
+		return
+	}
+
+	var req UpdateServiceFieldsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	values, err := h.customFieldService.UpdateOrderValues(orderID, req.Values, GetCurrentUserID(c))
+	if err != nil {
+		h.valueError(c, err, "Failed to update fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminGetInvoiceFieldValues godoc
+// @Summary Get invoice custom field values (Admin)
+// @Description Returns the order and invoice fields with their values on an invoice
+// @Tags admin/invoices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/custom-fields [get]
+func (h *CustomFieldHandler) AdminGetInvoiceFieldValues(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	values, err := h.customFieldService.GetInvoiceValues(invoiceID)
+	if err != nil {
+		h.valueError(c, err, "Failed to fetch fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+// AdminUpdateInvoiceFieldValues godoc
+// @Summary Update invoice custom field values (Admin)
+// @Description Changes order and invoice field values of an invoice by field name. Every change is recorded in the field history; an empty value clears the field.
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Param request body UpdateServiceFieldsRequest true "Values"
+// @Success 200 {array} ServiceFieldValueResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/custom-fields [put]
+func (h *CustomFieldHandler) AdminUpdateInvoiceFieldValues(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	var req UpdateServiceFieldsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	values, err := h.customFieldService.UpdateInvoiceValues(invoiceID, req.Values, GetCurrentUserID(c))
+	if err != nil {
+		h.valueError(c, err, "Failed to update fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceFieldValueResponses(values))
+}
+
+func (h *CustomFieldHandler) listBillingFields(c *gin.Context, entityType string) {
+	fields, err := h.customFieldService.ListAllBillingFields(entityType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch fields"})
+		return
+	}
+
+	response := make([]CustomFieldResponse, 0, len(fields))
+	for i := range fields {
+		response = append(response, toCustomFieldResponse(&fields[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *CustomFieldHandler) createBillingField(c *gin.Context, entityType string) {
+	var req CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	field, err := h.customFieldService.CreateBillingField(entityType, req.toDomain())
+	if err != nil {
+		h.fieldError(c, err, "Failed to create field")
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCustomFieldResponse(field))
+}
+
+func (h *CustomFieldHandler) valueError(c *gin.Context, err error, message string) {
+	switch {
+	case err == customfield.ErrOrderNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+	case err == customfield.ErrInvoiceNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invoice not found"})
+	case errors.Is(err, customfield.ErrUnknownField), errors.Is(err, customfield.ErrFieldRequired), errors.Is(err, customfield.ErrInvalidValue):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
+
+func (h *CustomFieldHandler) fieldError(c *gin.Context, err error, message string) {
+	switch {
+	case err == customfield.ErrProductNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+	case err == customfield.ErrFieldNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Field not found"})
+	case err == customfield.ErrDuplicateField:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, customfield.ErrInvalidFieldType):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: message})
+	}
+}
+
+func toCustomFieldResponse(field *domain.CustomField) CustomFieldResponse {
+	resp := CustomFieldResponse{
+		ID:            field.ID,
+		ProductID:     field.ProductID,
+		Name:          field.Name,
+		FieldName:     field.FieldName,
+		FieldType:     field.FieldType,
+		Description:   field.Description,
+		Options:       map[string]string{},
+		Required:      field.Required,
+		ShowOnOrder:   field.ShowOnOrder,
+		ShowOnInvoice: field.ShowOnInvoice,
+		AdminOnly:     field.AdminOnly,
+		Validation:    field.Validation,
+		DefaultValue:  field.DefaultValue,
+		SortOrder:     field.SortOrder,
+		Active:        field.Active,
+	}
+	for value, label := range field.Options {
+		if text, ok := label.(string); ok {
+			resp.Options[value] = text
+		}
+	}
+	return resp
+}
+
+func toServiceFieldValueResponses(values []customfield.ServiceValue) []ServiceFieldValueResponse {
+	response := make([]ServiceFieldValueResponse, 0, len(values))
+	for _, value := range values {
+		response = append(response, ServiceFieldValueResponse{
+			FieldID:   value.Field.ID,
+			Name:      value.Field.Name,
+			FieldName: value.Field.FieldName,
+			FieldType: value.Field.FieldType,
+			AdminOnly: value.Field.AdminOnly,
+			Value:     value.Value,
+		})
+	}
+	return response
+}
+
+func (r *CustomFieldRequest) toDomain() *domain.CustomField {
+	field := &domain.CustomField{
+		Name:          r.Name,
+		FieldName:     r.FieldName,
+		FieldType:     r.FieldType,
+		Description:   r.Description,
+		Options:       domain.JSONMap{},
+		Required:      r.Required,
+		ShowOnOrder:   r.ShowOnOrder,
+		ShowOnInvoice: r.ShowOnInvoice,
+		AdminOnly:     r.AdminOnly,
+		Validation:    r.Validation,
+		DefaultValue:  r.DefaultValue,
+		SortOrder:     r.SortOrder,
+		Active:        true,
+	}
+	for value, label := range r.Options {
+		field.Options[value] = label
+	}
+	if r.Active != nil {
+		field.Active = *r.Active
+	}
+	return field
+}
+
+// Request/Response types
+
+type CustomFieldRequest struct {
+	Name          string            `json:"name" binding:"required"`
+	FieldName     string            `json:"field_name" binding:"required"`
+	FieldType     string            `json:"field_type" binding:"required"`
+	Description   string            `json:"description"`
+	Options       map[string]string `json:"options"`
+	Required      bool              `json:"required"`
+	ShowOnOrder   bool              `json:"show_on_order"`
+	ShowOnInvoice bool              `json:"show_on_invoice"` // Order and invoice fields only
+	AdminOnly     bool              `json:"admin_only"`
+	Validation    string            `json:"validation"`
+	DefaultValue  string            `json:"default_value"`
+	SortOrder     int               `json:"sort_order"`
+	Active        *bool             `json:"active"`
+}
+
+type UpdateServiceFieldsRequest struct {
+	Values map[string]string `json:"values" binding:"required"`
+}
+
+type CustomFieldResponse struct {
+	ID            uint64            `json:"id"`
+	ProductID     *uint64           `json:"product_id"`
+	Name          string            `json:"name"`
+	FieldName     string            `json:"field_name"`
+	FieldType     string            `json:"field_type"`
+	Description   string            `json:"description"`
+	Options       map[string]string `json:"options"`
+	Required      bool              `json:"required"`
+	ShowOnOrder   bool              `json:"show_on_order"`
+	ShowOnInvoice bool              `json:"show_on_invoice"`
+	AdminOnly     bool              `json:"admin_only"`
+	Validation    string            `json:"validation,omitempty"`
+	DefaultValue  string            `json:"default_value,omitempty"`
+	SortOrder     int               `json:"sort_order"`
+	Active        bool              `json:"active"`
+}
+
+type ServiceFieldValueResponse struct {
+	FieldID   uint64 `json:"field_id"`
+	Name      string `json:"name"`
+	FieldName string `json:"field_name"`
+	FieldType string `json:"field_type"`
+	AdminOnly bool   `json:"admin_only"`
+	Value     string `json:"value"`
+}
+
+type CustomFieldChangeResponse struct {
+	ID            uint64  `json:"id"`
+	FieldID       uint64  `json:"field_id"`
+	FieldName     string  `json:"field_name"`
+	OldValue      string  `json:"old_value"`
+	NewValue      string  `json:"new_value"`
+	ChangedBy     *uint64 `json:"changed_by,omitempty"`
+	ChangedByName string  `json:"changed_by_name,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
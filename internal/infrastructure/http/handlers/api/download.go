@@ -0,0 +1,652 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/download"
+)
+
+// DownloadHandler handles the downloads area endpoints
+type DownloadHandler struct {
+	downloadService *download.Service
+}
+
+// NewDownloadHandler creates a new download handler
+func NewDownloadHandler(downloadService *download.Service) *DownloadHandler {
+	return &DownloadHandler{downloadService: downloadService}
+}
+
+// ListCategories godoc
+// @Summary List download categories
+// @Description Returns the active download categories with their subcategories
+// @Tags downloads
+// @Produce json
+// @Success 200 {array} DownloadCategoryResponse
+// @Router /api/v1/downloads/categories [get]
+func (h *DownloadHandler) ListCategories(c *gin.Context) {
+	categories, err := h.downloadService.ListCategories(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch download categories"})
+		return
+	}
+	c.JSON(http.StatusOK, toDownloadCategoryResponses(categories))
+}
+
+// ListDownloads godoc
+// @Summary List downloads
+// @Description Returns the downloads available to the caller. Anonymous callers see public downloads; logged in clients also see client-only downloads and those of products they have an active service of.
+// @Tags downloads
+// @Produce json
+// @Param category_id query int false "Category ID"
+// @Success 200 {array} DownloadResponse
+// @Router /api/v1/downloads [get]
+func (h *DownloadHandler) ListDownloads(c *gin.Context) {
+	var categoryID *uint64
+	if value := c.Query("category_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid category ID"})
+			return
+		}
+		categoryID = &id
+	}
+
+	downloads, err := h.downloadService.ListDownloads(GetCurrentUser(c), categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch downloads"})
+		return
+	}
+
+	response := make([]DownloadResponse, 0, len(downloads))
+	for i := range downloads {
+		response = append(response, toDownloadResponse(&downloads[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDownload godoc
+// @Summary Get download
+// @Description Returns a download the caller may access
+// @Tags downloads
+// @Produce json
+// @Param id path int true "Download ID"
+// @Success 200 {object} DownloadResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/downloads/{id} [get]
+func (h *DownloadHandler) GetDownload(c *gin.Context) {
+	d, ok := h.accessibleDownload(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toDownloadResponse(d))
+}
+
+// DownloadFile godoc
+// @Summary Download file
+// @Description Counts the download and redirects to a short-lived signed URL of the file. Range requests are supported to resume downloads; only requests from the first byte are counted.
+// @Tags downloads
+// @Produce octet-stream
+// @Param id path int true "Download ID"
+// @Success 302
+// @Success 206
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/downloads/{id}/file [get]
+func (h *DownloadHandler) DownloadFile(c *gin.Context) {
+	d, ok := h.accessibleDownload(c)
+	if !ok {
+		return
+	}
+
+	url, err := h.downloadService.DownloadURL(d, fileURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to sign download URL"})
+		return
+	}
+
+	// Resumed downloads ask for a later range and are counted once
+	if rangeHeader := c.GetHeader("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+		var customerID *uint64
+		if user := GetCurrentUser(c); user != nil {
+			customerID = &user.ID
+		}
+		if err := h.downloadService.RecordDownload(d.ID, customerID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to record download"})
+			return
+		}
+	}
+
+	if url != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	// Files added by local path before the file store
+	f, err := h.downloadService.OpenFile(d)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+	if d.ContentType != "" {
+		c.Header("Content-Type", d.ContentType)
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.FileName}))
+	http.ServeContent(c.Writer, c.Request, "", fi.ModTime(), f)
+}
+
+// accessibleDownload loads the download of the request and writes the
+// error response when the caller may not access it
+func (h *DownloadHandler) accessibleDownload(c *gin.Context) (*domain.Download, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid download ID"})
+		return nil, false
+	}
+
+	d, err := h.downloadService.GetDownload(id)
+	if err == nil {
+		err = h.downloadService.CheckAccess(d, GetCurrentUser(c))
+	}
+	switch {
+	case err == nil:
+		return d, true
+	case errors.Is(err, download.ErrDownloadNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Download not found"})
+	case errors.Is(err, download.ErrLoginRequired):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Log in to access this download"})
+	case errors.Is(err, download.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "This download is available to customers of other products"})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch download"})
+	}
+	return nil, false
+}
+
+// AdminListCategories godoc
+// @Summary List download categories (Admin)
+// @Description Returns all download categories, including inactive ones
+// @Tags admin/downloads
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} DownloadCategoryResponse
+// @Router /api/v1/admin/downloads/categories [get]
+func (h *DownloadHandler) AdminListCategories(c *gin.Context) {
+	categories, err := h.downloadService.ListCategories(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch download categories"})
+		return
+	}
+	c.JSON(http.StatusOK, toDownloadCategoryResponses(categories))
+}
+
+// AdminCreateCategory godoc
+// @Summary Create download category (Admin)
+// @Description Creates an active download category, optionally below another one
+// @Tags admin/downloads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DownloadCategoryRequest true "Category"
+// @Success 201 {object} DownloadCategoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/categories [post]
+func (h *DownloadHandler) AdminCreateCategory(c *gin.Context) {
+	var req DownloadCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	category, err := h.downloadService.CreateCategory(req.Name, req.Description, req.ParentID, req.SortOrder)
+	if err != nil {
+		h.categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toDownloadCategoryResponse(category))
+}
+
+// AdminUpdateCategory godoc
+// @Summary Update download category (Admin)
+// @Tags admin/downloads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Param request body DownloadCategoryRequest true "Category"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/categories/{id} [put]
+func (h *DownloadHandler) AdminUpdateCategory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid category ID"})
+		return
+	}
+	var req DownloadCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	if err := h.downloadService.UpdateCategory(id, req.Name, req.Description, req.SortOrder, active); err != nil {
+		h.categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Download category updated"})
+}
+
+// AdminDeleteCategory godoc
+// @Summary Delete download category (Admin)
+// @Description Deletes a category without downloads or subcategories
+// @Tags admin/downloads
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Success 200 {object} MessageResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/categories/{id} [delete]
+func (h *DownloadHandler) AdminDeleteCategory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid category ID"})
+		return
+	}
+
+	if err := h.downloadService.DeleteCategory(id); err != nil {
+		h.categoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Download category deleted"})
+}
+
+func (h *DownloadHandler) categoryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, download.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Download category not found"})
+	case errors.Is(err, download.ErrCategoryNotEmpty):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save download category"})
+	}
+}
+
+// AdminListDownloads godoc
+// @Summary List downloads (Admin)
+// @Description Returns all downloads, including inactive ones
+// @Tags admin/downloads
+// @Produce json
+// @Security BearerAuth
+// @Param category_id query int false "Category ID"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/downloads [get]
+func (h *DownloadHandler) AdminListDownloads(c *gin.Context) {
+	var categoryID *uint64
+	if value := c.Query("category_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid category ID"})
+			return
+		}
+		categoryID = &id
+	}
+	limit, offset := PaginationParams(c)
+
+	downloads, total, err := h.downloadService.AdminListDownloads(categoryID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch downloads"})
+		return
+	}
+
+	response := make([]DownloadResponse, 0, len(downloads))
+	for i := range downloads {
+		response = append(response, toDownloadResponse(&downloads[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminCreateDownload godoc
+// @Summary Upload download (Admin)
+// @Description Uploads a file of up to 2 GB as a new download
+// @Tags admin/downloads
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param category_id formData int true "Category ID"
+// @Param name formData string true "Name"
+// @Param description formData string false "Description"
+// @Param version formData string false "Version"
+// @Param changelog formData string false "Changelog"
+// @Param clients_only formData bool false "Require login"
+// @Param product_ids formData []int false "Limit to customers with an active service of these products"
+// @Param sort_order formData int false "Sort order"
+// @Param active formData bool false "Active, default true"
+// @Param file formData file true "File"
+// @Success 201 {object} DownloadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/downloads [post]
+func (h *DownloadHandler) AdminCreateDownload(c *gin.Context) {
+	var req DownloadRequest
+	file, ok := bindUpload(c, maxDownloadSize, &req)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	d, err := h.downloadService.CreateDownload(c.Request.Context(), req.input(), download.FileInput{
+		FileName:    file.header.Filename,
+		ContentType: file.header.Header.Get("Content-Type"),
+		Reader:      file,
+		Size:        file.header.Size,
+	}, GetCurrentUserID(c))
+	if err != nil {
+		h.downloadError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toDownloadResponse(d))
+}
+
+// AdminUpdateDownload godoc
+// @Summary Update download (Admin)
+// @Description Updates the details of a download; the file is replaced by uploading a new version
+// @Tags admin/downloads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Download ID"
+// @Param request body DownloadRequest true "Download"
+// @Success 200 {object} DownloadResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/{id} [put]
+func (h *DownloadHandler) AdminUpdateDownload(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid download ID"})
+		return
+	}
+	var req DownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	d, err := h.downloadService.UpdateDownload(id, req.input())
+	if err != nil {
+		h.downloadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDownloadResponse(d))
+}
+
+// AdminAddVersion godoc
+// @Summary Upload new version (Admin)
+// @Description Replaces the file of a download with a new version. The changelog is added on top of the existing one and download counts are kept.
+// @Tags admin/downloads
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Download ID"
+// @Param version formData string true "Version"
+// @Param changelog formData string false "Changes in this version"
+// @Param file formData file true "File"
+// @Success 200 {object} DownloadResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/{id}/versions [post]
+func (h *DownloadHandler) AdminAddVersion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid download ID"})
+		return
+	}
+	var req DownloadVersionRequest
+	file, ok := bindUpload(c, maxDownloadSize, &req)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	d, err := h.downloadService.AddVersion(c.Request.Context(), id, req.Version, req.Changelog, download.FileInput{
+		FileName:    file.header.Filename,
+		ContentType: file.header.Header.Get("Content-Type"),
+		Reader:      file,
+		Size:        file.header.Size,
+	}, GetCurrentUserID(c))
+	if err != nil {
+		h.downloadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDownloadResponse(d))
+}
+
+// AdminDeleteDownload godoc
+// @Summary Delete download (Admin)
+// @Description Deletes a download with its file and download log
+// @Tags admin/downloads
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Download ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/downloads/{id} [delete]
+func (h *DownloadHandler) AdminDeleteDownload(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid download ID"})
+		return
+	}
+
+	if err := h.downloadService.DeleteDownload(id); err != nil {
+		h.downloadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Download deleted"})
+}
+
+// AdminListLogs godoc
+// @Summary List download log (Admin)
+// @Description Returns who downloaded a file and when, newest first
+// @Tags admin/downloads
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Download ID"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/downloads/{id}/logs [get]
+func (h *DownloadHandler) AdminListLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid download ID"})
+		return
+	}
+	limit, offset := PaginationParams(c)
+
+	logs, total, err := h.downloadService.ListLogs(id, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch download log"})
+		return
+	}
+
+	response := make([]DownloadLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		item := DownloadLogResponse{
+			ID:         entry.ID,
+			CustomerID: entry.CustomerID,
+			IPAddress:  entry.IPAddress,
+			UserAgent:  entry.UserAgent,
+			CreatedAt:  entry.CreatedAt.Format(time.RFC3339),
+		}
+		if entry.Customer != nil {
+			item.CustomerEmail = entry.Customer.Email
+		}
+		response = append(response, item)
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func (h *DownloadHandler) downloadError(c *gin.Context, err error) {
+	if scanError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, download.ErrDownloadNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Download not found"})
+	case errors.Is(err, download.ErrCategoryNotFound), errors.Is(err, download.ErrNameRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, download.ErrNoFileStore):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save download"})
+	}
+}
+
+// Request/Response types
+
+type DownloadCategoryRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	ParentID    *uint64 `json:"parent_id"` // Only used when creating
+	SortOrder   int     `json:"sort_order"`
+	Active      *bool   `json:"active"` // Only used when updating
+}
+
+type DownloadRequest struct {
+	CategoryID  uint64   `json:"category_id" form:"category_id" binding:"required"`
+	Name        string   `json:"name" form:"name" binding:"required"`
+	Description string   `json:"description" form:"description"`
+	Version     *string  `json:"version" form:"version"`     // Omit to keep the current version
+	Changelog   *string  `json:"changelog" form:"changelog"` // Omit to keep the current changelog
+	ClientsOnly bool     `json:"clients_only" form:"clients_only"`
+	ProductIDs  []uint64 `json:"product_ids" form:"product_ids"` // Empty for no product restriction
+	SortOrder   int      `json:"sort_order" form:"sort_order"`
+	Active      *bool    `json:"active" form:"active"`
+}
+
+func (r *DownloadRequest) input() download.DownloadInput {
+	return download.DownloadInput{
+		CategoryID:  r.CategoryID,
+		Name:        r.Name,
+		Description: r.Description,
+		Version:     r.Version,
+		Changelog:   r.Changelog,
+		ClientsOnly: r.ClientsOnly,
+		ProductIDs:  r.ProductIDs,
+		SortOrder:   r.SortOrder,
+		Active:      r.Active == nil || *r.Active,
+	}
+}
+
+type DownloadVersionRequest struct {
+	Version   string `form:"version" binding:"required"`
+	Changelog string `form:"changelog"`
+}
+
+type DownloadCategoryResponse struct {
+	ID          uint64                     `json:"id"`
+	ParentID    *uint64                    `json:"parent_id,omitempty"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	SortOrder   int                        `json:"sort_order"`
+	Active      bool                       `json:"active"`
+	Children    []DownloadCategoryResponse `json:"children,omitempty"`
+}
+
+type DownloadResponse struct {
+	ID           uint64   `json:"id"`
+	CategoryID   uint64   `json:"category_id"`
+	CategoryName string   `json:"category_name,omitempty"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Version      string   `json:"version"`
+	Changelog    string   `json:"changelog"`
+	FileName     string   `json:"file_name"`
+	FileSize     int64    `json:"file_size"`
+	ContentType  string   `json:"content_type"`
+	Downloads    int64    `json:"downloads"`
+	ClientsOnly  bool     `json:"clients_only"`
+	ProductIDs   []uint64 `json:"product_ids"`
+	SortOrder    int      `json:"sort_order"`
+	Active       bool     `json:"active"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+type DownloadLogResponse struct {
+	ID            uint64  `json:"id"`
+	CustomerID    *uint64 `json:"customer_id,omitempty"`
+	CustomerEmail string  `json:"customer_email,omitempty"`
+	IPAddress     string  `json:"ip_address"`
+	UserAgent     string  `json:"user_agent"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+func toDownloadCategoryResponse(category *domain.DownloadCategory) DownloadCategoryResponse {
+	response := DownloadCategoryResponse{
+		ID:          category.ID,
+		ParentID:    category.ParentID,
+		Name:        category.Name,
+		Description: category.Description,
+		SortOrder:   category.SortOrder,
+		Active:      category.Active,
+	}
+	if len(category.Children) > 0 {
+		response.Children = toDownloadCategoryResponses(category.Children)
+	}
+	return response
+}
+
+func toDownloadCategoryResponses(categories []domain.DownloadCategory) []DownloadCategoryResponse {
+	response := make([]DownloadCategoryResponse, 0, len(categories))
+	for i := range categories {
+		response = append(response, toDownloadCategoryResponse(&categories[i]))
+	}
+	return response
+}
+
+func toDownloadResponse(d *domain.Download) DownloadResponse {
+	return DownloadResponse{
+		ID:           d.ID,
+		CategoryID:   d.CategoryID,
+		CategoryName: d.Category.Name,
+		Name:         d.Name,
+		Description:  d.Description,
+		Version:      d.Version,
+		Changelog:    d.Changelog,
+		FileName:     d.FileName,
+		FileSize:     d.FileSize,
+		ContentType:  d.ContentType,
+		Downloads:    d.Downloads,
+		ClientsOnly:  d.ClientsOnly,
+		ProductIDs:   download.ProductIDs(d),
+		SortOrder:    d.SortOrder,
+		Active:       d.Active,
+		CreatedAt:    d.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    d.UpdatedAt.Format(time.RFC3339),
+	}
+}
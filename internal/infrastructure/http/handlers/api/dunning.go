@@ -0,0 +1,229 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/dunning"
+)
+
+// DunningHandler handles the dunning steps of overdue invoices and the
+// promises to pay that pause them
+type DunningHandler struct {
+	dunningService *dunning.Service
+}
+
+// NewDunningHandler creates a new dunning handler
+func NewDunningHandler(dunningService *dunning.Service) *DunningHandler {
+	return &DunningHandler{dunningService: dunningService}
+}
+
+// AdminGetDunningSettings godoc
+// @Summary Get dunning settings (Admin)
+// @Description Returns the days overdue customers are reminded of an unpaid invoice on and the days overdue after which the services billed on it are suspended
+// @Tags admin/dunning
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} DunningSettingsRequest
+// @Router /api/v1/admin/dunning [get]
+func (h *DunningHandler) AdminGetDunningSettings(c *gin.Context) {
+	settings, err := h.dunningService.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch dunning settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toDunningSettings(settings))
+}
+
+// AdminUpdateDunningSettings godoc
+// @Summary Update dunning settings (Admin)
+// @Description Sets the days overdue reminders are sent on, up to 10, and the days overdue after which services are suspended, 0 to never suspend them
+// @Tags admin/dunning
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DunningSettingsRequest true "Dunning settings"
+// @Success 200 {object} DunningSettingsRequest
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/dunning [put]
+func (h *DunningHandler) AdminUpdateDunningSettings(c *gin.Context) {
+	var req DunningSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	settings, err := h.dunningService.UpdateSettings(dunning.Settings{
+		ReminderDays: req.ReminderDays,
+		SuspendDays:  *req.SuspendDays,
+	})
+	if err != nil {
+		writeDunningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toDunningSettings(settings))
+}
+
+// AdminListPromises godoc
+// @Summary List promises to pay (Admin)
+// @Description Returns the promises to pay an invoice recorded, the latest first
+// @Tags admin/dunning
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {object} map[string][]PaymentPromiseResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/promises [get]
+func (h *DunningHandler) AdminListPromises(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	promises, err := h.dunningService.ListPromises(invoiceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch promises to pay"})
+		return
+	}
+
+	response := make([]PaymentPromiseResponse, 0, len(promises))
+	for i := range promises {
+		response = append(response, toPaymentPromiseResponse(&promises[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"promises": response})
+}
+
+// AdminRecordPromise godoc
+// @Summary Record promise to pay (Admin)
+// @Description Records a customer's promise to pay an unpaid or overdue invoice by a date up to 90 days ahead. Reminders and suspension are paused until the end of that day; if the invoice is still unpaid then, the promise is broken, the customer and the staff member are told and dunning resumes. A promise already active is replaced.
+// @Tags admin/dunning
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Param request body RecordPromiseRequest true "Promise"
+// @Success 201 {object} PaymentPromiseResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/promise [post]
+func (h *DunningHandler) AdminRecordPromise(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	var req RecordPromiseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	promisedDate, err := time.ParseInLocation("2006-01-02", req.PromisedDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "promised_date must be a date like 2024-01-31"})
+		return
+	}
+
+	promise, err := h.dunningService.RecordPromise(invoiceID, promisedDate, req.Note, c.GetUint64("admin_id"), time.Now())
+	if err != nil {
+		writeDunningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toPaymentPromiseResponse(promise))
+}
+
+// AdminCancelPromise godoc
+// @Summary Cancel promise to pay (Admin)
+// @Description Withdraws the active promise to pay an invoice, resuming dunning
+// @Tags admin/dunning
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/promise [delete]
+func (h *DunningHandler) AdminCancelPromise(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	if err := h.dunningService.CancelPromise(invoiceID, time.Now()); err != nil {
+		writeDunningError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Promise to pay cancelled"})
+}
+
+func writeDunningError(c *gin.Context, err error) {
+	switch err {
+	case dunning.ErrInvoiceNotFound, dunning.ErrNoActivePromise:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case dunning.ErrInvoiceNotDue:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case dunning.ErrInvalidPromiseDate, dunning.ErrInvalidReminderDays, dunning.ErrInvalidSuspendDays:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update dunning"})
+	}
+}
+
+func toDunningSettings(settings dunning.Settings) DunningSettingsRequest {
+	days := settings.ReminderDays
+	if days == nil {
+		days = []int{}
+	}
+	return DunningSettingsRequest{ReminderDays: days, SuspendDays: &settings.SuspendDays}
+}
+
+func toPaymentPromiseResponse(p *domain.PaymentPromise) PaymentPromiseResponse {
+	resp := PaymentPromiseResponse{
+		ID:           p.ID,
+		InvoiceID:    p.InvoiceID,
+		PromisedDate: p.PromisedDate.Format("2006-01-02"),
+		Note:         p.Note,
+		Status:       string(p.Status),
+		RecordedBy:   p.RecordedBy,
+		CreatedAt:    p.CreatedAt.Format(time.RFC3339),
+	}
+	if p.ResolvedAt != nil {
+		resolved := p.ResolvedAt.Format(time.RFC3339)
+		resp.ResolvedAt = &resolved
+	}
+	return resp
+}
+
+// Request/Response types
+
+type DunningSettingsRequest struct {
+	ReminderDays []int `json:"reminder_days"`                   // Days overdue, empty for no reminders
+	SuspendDays  *int  `json:"suspend_days" binding:"required"` // 0 never suspends
+}
+
+type RecordPromiseRequest struct {
+	PromisedDate string `json:"promised_date" binding:"required"` // YYYY-MM-DD
+	Note         string `json:"note" binding:"max=500"`
+}
+
+type PaymentPromiseResponse struct {
+	ID           uint64  `json:"id"`
+	InvoiceID    uint64  `json:"invoice_id"`
+	PromisedDate string  `json:"promised_date"`
+	Note         string  `json:"note"`
+	Status       string  `json:"status"` // active, kept, broken or cancelled
+	RecordedBy   uint64  `json:"recorded_by"`
+	ResolvedAt   *string `json:"resolved_at"`
+	CreatedAt    string  `json:"created_at"`
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/export"
+)
+
+// ExportHandler streams large exports of invoices, transactions and
+// customers
+type ExportHandler struct {
+	exportService *export.Service
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(exportService *export.Service) *ExportHandler {
+	return &ExportHandler{exportService: exportService}
+}
+
+// exportFunc is one of the export service's streams
+type exportFunc func(ctx context.Context, w io.Writer, format export.Format, filter export.Filter) (int64, error)
+
+// AdminExportInvoices godoc
+// @Summary Export invoices (Admin)
+// @Description Streams every invoice matching the filters in ID order as NDJSON or CSV. Rows are written as they are read, so the export can be of any size; pass the last ID received as after_id to resume.
+// @Tags admin/exports
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "ndjson (default) or csv"
+// @Param status query string false "Invoice status"
+// @Param customer_id query int false "Customer ID"
+// @Param from query string false "Created on or after, YYYY-MM-DD"
+// @Param to query string false "Created on or before, YYYY-MM-DD"
+// @Param after_id query int false "Only rows after this ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/exports/invoices [get]
+func (h *ExportHandler) AdminExportInvoices(c *gin.Context) {
+	h.stream(c, "invoices", h.exportService.Invoices)
+}
+
+// AdminExportTransactions godoc
+// @Summary Export transactions (Admin)
+// @Description Streams every transaction matching the filters in ID order as NDJSON or CSV. Rows are written as they are read, so the export can be of any size; pass the last ID received as after_id to resume.
+// @Tags admin/exports
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "ndjson (default) or csv"
+// @Param status query string false "Transaction status"
+// @Param customer_id query int false "Customer ID"
+// @Param from query string false "Created on or after, YYYY-MM-DD"
+// @Param to query string false "Created on or before, YYYY-MM-DD"
+// @Param after_id query int false "Only rows after this ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/exports/transactions [get]
+func (h *ExportHandler) AdminExportTransactions(c *gin.Context) {
+	h.stream(c, "transactions", h.exportService.Transactions)
+}
+
+// AdminExportCustomers godoc
+// @Summary Export customers (Admin)
+// @Description Streams every customer matching the filters in ID order as NDJSON or CSV. Rows are written as they are read, so the export can be of any size; pass the last ID received as after_id to resume.
+// @Tags admin/exports
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "ndjson (default) or csv"
+// @Param status query string false "Account status"
+// @Param from query string false "Registered on or after, YYYY-MM-DD"
+// @Param to query string false "Registered on or before, YYYY-MM-DD"
+// @Param after_id query int false "Only rows after this ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/exports/customers [get]
+func (h *ExportHandler) AdminExportCustomers(c *gin.Context) {
+	h.stream(c, "customers", h.exportService.Customers)
+}
+
+// stream checks the query, then writes the export straight to the
+// response. Once the first row is out the status can no longer change, so
+// a failure midway is logged and the response cut short.
+func (h *ExportHandler) stream(c *gin.Context, name string, run exportFunc) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var filter export.Filter
+	filter.Status = c.Query("status")
+	if value := c.Query("customer_id"); value != "" {
+		if filter.CustomerID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+			return
+		}
+	}
+	if value := c.Query("after_id"); value != "" {
+		if filter.AfterID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid after_id"})
+			return
+		}
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date"})
+			return
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date"})
+			return
+		}
+		to := day.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	filename := name + "-" + time.Now().Format("20060102-150405") + "." + string(format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// Keep reverse proxies from buffering the whole export
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	rows, err := run(c.Request.Context(), c.Writer, format, filter)
+	if err != nil {
+		log.Printf("Export of %s stopped after %d rows: %v", name, rows, err)
+	}
+}
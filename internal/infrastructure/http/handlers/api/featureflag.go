@@ -0,0 +1,210 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/featureflag"
+)
+
+// FeatureFlagHandler tells clients which gradually rolled out subsystems
+// they get and lets admins change the rollout
+type FeatureFlagHandler struct {
+	featureFlagService *featureflag.Service
+}
+
+// NewFeatureFlagHandler creates a new feature flag handler
+func NewFeatureFlagHandler(featureFlagService *featureflag.Service) *FeatureFlagHandler {
+	return &FeatureFlagHandler{featureFlagService: featureFlagService}
+}
+
+// RequireFeature answers 404 to requests of users a flag is off for, so
+// routes of a subsystem being rolled out look absent to everyone else.
+// It runs after the authentication middleware of the route.
+func (h *FeatureFlagHandler) RequireFeature(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.featureFlagService.Enabled(key, GetCurrentUser(c)) {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "Not found"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetFeatures godoc
+// @Summary Get enabled features
+// @Description Returns the feature flags that are on for the signed in user, or for guests
+// @Tags features
+// @Produce json
+// @Success 200 {object} FeaturesResponse
+// @Router /api/v1/features [get]
+func (h *FeatureFlagHandler) GetFeatures(c *gin.Context) {
+	c.JSON(http.StatusOK, FeaturesResponse{Features: h.featureFlagService.EnabledFor(GetCurrentUser(c))})
+}
+
+// AdminListFlags godoc
+// @Summary Admin: List feature flags
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} FeatureFlagResponse
+// @Router /api/v1/admin/feature-flags [get]
+func (h *FeatureFlagHandler) AdminListFlags(c *gin.Context) {
+	flags, err := h.featureFlagService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch feature flags"})
+		return
+	}
+
+	response := make([]FeatureFlagResponse, 0, len(flags))
+	for i := range flags {
+		response = append(response, toFeatureFlagResponse(&flags[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminGetFlag godoc
+// @Summary Admin: Get feature flag
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param key path string true "Flag key"
+// @Success 200 {object} FeatureFlagResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/feature-flags/{key} [get]
+func (h *FeatureFlagHandler) AdminGetFlag(c *gin.Context) {
+	flag, err := h.featureFlagService.Get(c.Param("key"))
+	if err != nil {
+		if err == featureflag.ErrFlagNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Feature flag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch feature flag"})
+		return
+	}
+	c.JSON(http.StatusOK, toFeatureFlagResponse(flag))
+}
+
+// AdminUpdateFlag godoc
+// @Summary Admin: Create or update feature flag
+// @Description Sets who a flag is on for. It applies at once on the instance serving the request and within 30 seconds on the others.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key path string true "Flag key"
+// @Param request body UpdateFeatureFlagRequest true "Rollout"
+// @Success 200 {object} FeatureFlagResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/feature-flags/{key} [put]
+func (h *FeatureFlagHandler) AdminUpdateFlag(c *gin.Context) {
+	var req UpdateFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	roles := make([]domain.UserRole, 0, len(req.Roles))
+	for _, role := range req.Roles {
+		roles = append(roles, domain.UserRole(role))
+	}
+	flag, err := h.featureFlagService.Save(c.Param("key"), featureflag.Input{
+		Description: req.Description,
+		Enabled:     req.Enabled,
+		Percentage:  req.Percentage,
+		Targets: domain.FeatureFlagTargets{
+			Roles:            roles,
+			CustomerGroupIDs: req.CustomerGroupIDs,
+			UserIDs:          req.UserIDs,
+		},
+	}, c.GetUint64("admin_id"))
+	if err != nil {
+		switch err {
+		case featureflag.ErrInvalidKey, featureflag.ErrInvalidPercentage, featureflag.ErrInvalidRole:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update feature flag"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, toFeatureFlagResponse(flag))
+}
+
+// AdminDeleteFlag godoc
+// @Summary Admin: Delete feature flag
+// @Description Turns the flag off for everyone. Known flags stay listed, off.
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param key path string true "Flag key"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/feature-flags/{key} [delete]
+func (h *FeatureFlagHandler) AdminDeleteFlag(c *gin.Context) {
+	if err := h.featureFlagService.Delete(c.Param("key")); err != nil {
+		if err == featureflag.ErrFlagNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Feature flag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete feature flag"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Feature flag deleted"})
+}
+
+func toFeatureFlagResponse(f *domain.FeatureFlag) FeatureFlagResponse {
+	roles := make([]string, 0, len(f.Targets.Roles))
+	for _, role := range f.Targets.Roles {
+		roles = append(roles, string(role))
+	}
+	resp := FeatureFlagResponse{
+		Key:              f.Key,
+		Description:      f.Description,
+		Enabled:          f.Enabled,
+		Percentage:       f.Percentage,
+		Roles:            roles,
+		CustomerGroupIDs: f.Targets.CustomerGroupIDs,
+		UserIDs:          f.Targets.UserIDs,
+		UpdatedBy:        f.UpdatedBy,
+	}
+	if resp.CustomerGroupIDs == nil {
+		resp.CustomerGroupIDs = []uint64{}
+	}
+	if resp.UserIDs == nil {
+		resp.UserIDs = []uint64{}
+	}
+	if !f.UpdatedAt.IsZero() {
+		resp.UpdatedAt = f.UpdatedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type UpdateFeatureFlagRequest struct {
+	Description      string   `json:"description" binding:"max=255"`
+	Enabled          bool     `json:"enabled"`
+	Percentage       int      `json:"percentage"`         // Share of signed in users it is rolled out to, 0 to 100
+	Roles            []string `json:"roles"`              // customer, staff or admin
+	CustomerGroupIDs []uint64 `json:"customer_group_ids"` // Customer groups it is on for
+	UserIDs          []uint64 `json:"user_ids"`           // Users it is on for
+}
+
+type FeatureFlagResponse struct {
+	Key              string   `json:"key"`
+	Description      string   `json:"description"`
+	Enabled          bool     `json:"enabled"`
+	Percentage       int      `json:"percentage"`
+	Roles            []string `json:"roles"`
+	CustomerGroupIDs []uint64 `json:"customer_group_ids"`
+	UserIDs          []uint64 `json:"user_ids"`
+	UpdatedBy        *uint64  `json:"updated_by,omitempty"`
+	UpdatedAt        string   `json:"updated_at,omitempty"` // Empty for known flags never saved
+}
+
+type FeaturesResponse struct {
+	Features []string `json:"features"`
+}
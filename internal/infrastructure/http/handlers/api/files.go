@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+)
+
+const (
+	// fileURLExpiry is the lifetime of signed download URLs handed out by
+	// redirects; clients follow them right away
+	fileURLExpiry = 5 * time.Minute
+
+	maxTicketAttachmentSize = 10 << 20
+	maxKBAttachmentSize     = 100 << 20
+	maxDownloadSize         = 2 << 30
+)
+
+// sendFile redirects to the signed URL of a stored file, or streams the
+// file when it has no URL, e.g. attachments kept in the database
+func sendFile(c *gin.Context, url string, open func() (io.ReadCloser, error), fileName, contentType string, size int64) {
+	if url != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	r, err := open()
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+		return
+	}
+	defer r.Close()
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	length := int64(-1)
+	if size > 0 {
+		length = size
+	}
+	c.DataFromReader(http.StatusOK, length, contentType, r, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+	})
+}
+
+// scanError responds to an upload the malware scanner rejected or could
+// not check, and reports whether err was such an error
+func scanError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, quarantine.ErrInfected):
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, quarantine.ErrScanFailed):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// uploadedFile is the file part of an upload form
+type uploadedFile struct {
+	multipart.File
+	header *multipart.FileHeader
+	form   *multipart.Form
+}
+
+func (f *uploadedFile) Close() error {
+	f.File.Close()
+	return f.form.RemoveAll()
+}
+
+// bindUpload binds the fields of an upload form of up to maxSize bytes to
+// req and opens its "file" part. Large files are spooled to disk while the
+// form is parsed, so the file can be read more than once.
+func bindUpload(c *gin.Context, maxSize int64, req interface{}) (*uploadedFile, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "File is too large"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid form data"})
+		return nil, false
+	}
+	if err := c.ShouldBind(req); err != nil {
+		form.RemoveAll()
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid form data"})
+		return nil, false
+	}
+	if len(form.File["file"]) == 0 {
+		form.RemoveAll()
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "File is required"})
+		return nil, false
+	}
+
+	header := form.File["file"][0]
+	file, err := header.Open()
+	if err != nil {
+		form.RemoveAll()
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file"})
+		return nil, false
+	}
+	return &uploadedFile{File: file, header: header, form: form}, true
+}
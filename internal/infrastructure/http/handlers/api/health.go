@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/customerhealth"
+)
+
+// HealthHandler serves customer health scores to admins
+type HealthHandler struct {
+	healthService *customerhealth.Service
+}
+
+// NewHealthHandler creates a new customer health handler
+func NewHealthHandler(healthService *customerhealth.Service) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// AdminListHealth godoc
+// @Summary Admin: List customer health scores
+// @Description Returns the customer health scores, lowest first
+// @Tags admin/customers
+// @Produce json
+// @Security BearerAuth
+// @Param risk query string false "healthy, at_risk or high_risk"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/customers/health [get]
+func (h *HealthHandler) AdminListHealth(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	healths, total, err := h.healthService.List(domain.HealthRisk(c.Query("risk")), limit, offset)
+	if err != nil {
+		if errors.Is(err, customerhealth.ErrInvalidRisk) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch customer health"})
+		return
+	}
+
+	response := make([]CustomerHealthResponse, 0, len(healths))
+	for i := range healths {
+		response = append(response, toCustomerHealthResponse(&healths[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetHealth godoc
+// @Summary Admin: Get customer health
+// @Description Returns the health score of a customer with its part scores and churn-risk flags
+// @Tags admin/customers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer ID"
+// @Success 200 {object} CustomerHealthResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/health [get]
+func (h *HealthHandler) AdminGetHealth(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	result, err := h.healthService.Get(customerID)
+	if err != nil {
+		writeHealthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toCustomerHealthResponse(result))
+}
+
+// AdminRecomputeHealth godoc
+// @Summary Admin: Recompute customer health
+// @Description Scores a customer now instead of waiting for the next periodic run
+// @Tags admin/customers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer ID"
+// @Success 200 {object} CustomerHealthResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/health/recompute [post]
+func (h *HealthHandler) AdminRecomputeHealth(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	result, err := h.healthService.Compute(customerID, time.Now())
+	if err != nil {
+		writeHealthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toCustomerHealthResponse(result))
+}
+
+// AdminSetAccountManager godoc
+// @Summary Admin: Set account manager
+// @Description Assigns the staff member alerted when the health of a customer drops. Without one, all admins are alerted.
+// @Tags admin/customers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer ID"
+// @Param request body SetAccountManagerRequest true "Account manager"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/account-manager [put]
+func (h *HealthHandler) AdminSetAccountManager(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	var req SetAccountManagerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.healthService.SetAccountManager(customerID, req.AccountManagerID); err != nil {
+		writeHealthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Account manager updated"})
+}
+
+func writeHealthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, customerhealth.ErrCustomerNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Customer not found"})
+	case errors.Is(err, customerhealth.ErrManagerNotFound):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute customer health"})
+	}
+}
+
+func toCustomerHealthResponse(h *domain.CustomerHealth) CustomerHealthResponse {
+	flags := []string(h.Flags)
+	if flags == nil {
+		flags = []string{}
+	}
+	resp := CustomerHealthResponse{
+		CustomerID:      h.CustomerID,
+		Score:           h.Score,
+		Risk:            string(h.Risk),
+		PaymentScore:    h.PaymentScore,
+		SupportScore:    h.SupportScore,
+		UsageScore:      h.UsageScore,
+		EngagementScore: h.EngagementScore,
+		Flags:           flags,
+		PreviousScore:   h.PreviousScore,
+		ComputedAt:      h.ComputedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if h.AlertedAt != nil {
+		resp.AlertedAt = h.AlertedAt.Format("2006-01-02T15:04:05Z")
+	}
+	return resp
+}
+
+// Request/Response types
+
+type CustomerHealthResponse struct {
+	CustomerID      uint64   `json:"customer_id"`
+	Score           int      `json:"score"` // 0 to 100
+	Risk            string   `json:"risk"`  // healthy, at_risk or high_risk
+	PaymentScore    int      `json:"payment_score"`
+	SupportScore    int      `json:"support_score"`
+	UsageScore      int      `json:"usage_score"`
+	EngagementScore int      `json:"engagement_score"`
+	Flags           []string `json:"flags"`
+	PreviousScore   *int     `json:"previous_score"`
+	ComputedAt      string   `json:"computed_at"`
+	AlertedAt       string   `json:"alerted_at,omitempty"`
+}
+
+type SetAccountManagerRequest struct {
+	AccountManagerID *uint64 `json:"account_manager_id"` // null alerts all admins
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -37,7 +38,7 @@ func (h *InvoiceHandler) ListInvoices(c *gin.Context) {
 	limit, offset := PaginationParams(c)
 	status := domain.InvoiceStatus(c.Query("status"))
 
-	invoices, total, err := h.invoiceService.ListInvoices(userID, status, limit, offset)
+	invoices, total, err := h.invoiceService.WithContext(c.Request.Context()).ListInvoices(userID, status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch invoices"})
 		return
@@ -79,9 +80,9 @@ func (h *InvoiceHandler) GetInvoice(c *gin.Context) {
 		return
 	}
 
-	// Verify ownership (unless admin)
+	// Verify ownership (unless admin); drafts are not shown to customers
 	user := GetCurrentUser(c)
-	if inv.CustomerID != user.ID && !user.IsAdmin() {
+	if (inv.CustomerID != user.ID || inv.IsDraft()) && !user.IsAdmin() {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invoice not found"})
 		return
 	}
@@ -136,7 +137,7 @@ func (h *InvoiceHandler) AdminListInvoices(c *gin.Context) {
 	status := domain.InvoiceStatus(c.Query("status"))
 
 	// For admin, list all invoices
-	invoices, total, err := h.invoiceService.ListInvoices(0, status, limit, offset)
+	invoices, total, err := h.invoiceService.WithContext(c.Request.Context()).ListAllInvoices(status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch invoices"})
 		return
@@ -180,6 +181,270 @@ func (h *InvoiceHandler) AdminCancelInvoice(c *gin.Context) {
 	c.JSON(http.StatusOK, MessageResponse{Message: "Invoice cancelled"})
 }
 
+// AdminListDrafts godoc
+// @Summary List draft invoices (Admin)
+// @Description Returns the invoices held as drafts for review, the first to be published first
+// @Tags admin/invoices
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string][]DraftInvoiceResponse
+// @Router /api/v1/admin/invoices/drafts [get]
+func (h *InvoiceHandler) AdminListDrafts(c *gin.Context) {
+	invoices, err := h.invoiceService.ListDrafts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch draft invoices"})
+		return
+	}
+
+	response := make([]DraftInvoiceResponse, 0, len(invoices))
+	for i := range invoices {
+		response = append(response, DraftInvoiceResponse{
+			InvoiceResponse: toInvoiceResponse(&invoices[i]),
+			CustomerID:      invoices[i].CustomerID,
+			CustomerEmail:   invoices[i].Customer.Email,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoices": response})
+}
+
+// AdminPublishInvoice godoc
+// @Summary Publish draft invoice (Admin)
+// @Description Makes a draft invoice payable and emails it to the customer
+// @Tags admin/invoices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Success 200 {object} InvoiceResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/publish [post]
+func (h *InvoiceHandler) AdminPublishInvoice(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	inv, err := h.invoiceService.Publish(invoiceID, time.Now())
+	if err != nil {
+		writeDraftError(c, err, "Failed to publish invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, toInvoiceResponse(inv))
+}
+
+// AdminPublishInvoices godoc
+// @Summary Publish draft invoices (Admin)
+// @Description Publishes several draft invoices at once, skipping those that are no longer drafts
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body PublishInvoicesRequest true "Invoices"
+// @Success 200 {object} PublishInvoicesResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/publish [post]
+func (h *InvoiceHandler) AdminPublishInvoices(c *gin.Context) {
+	var req PublishInvoicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	published, err := h.invoiceService.PublishMany(req.InvoiceIDs, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to publish invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PublishInvoicesResponse{Published: published})
+}
+
+// AdminScheduleInvoice godoc
+// @Summary Schedule draft invoice (Admin)
+// @Description Sets when a draft invoice is published. Without publish_at the draft is held until published by hand.
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Invoice ID"
+// @Param request body ScheduleInvoiceRequest true "Publish time"
+// @Success 200 {object} InvoiceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/{id}/publish-at [put]
+func (h *InvoiceHandler) AdminScheduleInvoice(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invoice ID"})
+		return
+	}
+
+	var req ScheduleInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var publishAt *time.Time
+	if req.PublishAt != "" {
+		t, err := time.Parse(time.RFC3339, req.PublishAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "publish_at must be an RFC 3339 timestamp"})
+			return
+		}
+		publishAt = &t
+	}
+
+	inv, err := h.invoiceService.SchedulePublish(invoiceID, publishAt)
+	if err != nil {
+		writeDraftError(c, err, "Failed to schedule invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, toInvoiceResponse(inv))
+}
+
+// AdminGetReviewWindow godoc
+// @Summary Get invoice review window (Admin)
+// @Description Returns how many hours generated renewal invoices are held as drafts for review, 0 when they are published right away
+// @Tags admin/invoices
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ReviewWindowRequest
+// @Router /api/v1/admin/invoices/review-window [get]
+func (h *InvoiceHandler) AdminGetReviewWindow(c *gin.Context) {
+	hours, err := h.invoiceService.ReviewHours()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch review window"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReviewWindowRequest{Hours: &hours})
+}
+
+// AdminSetReviewWindow godoc
+// @Summary Set invoice review window (Admin)
+// @Description Sets how many hours generated renewal invoices are held as drafts for review, 0 to publish them right away
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ReviewWindowRequest true "Review window"
+// @Success 200 {object} ReviewWindowRequest
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/review-window [put]
+func (h *InvoiceHandler) AdminSetReviewWindow(c *gin.Context) {
+	var req ReviewWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.invoiceService.SetReviewHours(*req.Hours); err != nil {
+		if err == invoiceSvc.ErrInvalidReviewHours {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set review window"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// AdminMergeInvoices godoc
+// @Summary Merge invoices (Admin)
+// @Description Merges unpaid or draft invoices of one customer into a new invoice due on the earliest due date. The lines are copied, the tax is recalculated and the merged invoices are cancelled.
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MergeInvoicesRequest true "Invoices"
+// @Success 201 {object} InvoiceDetailResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/invoices/merge [post]
+func (h *InvoiceHandler) AdminMergeInvoices(c *gin.Context) {
+	var req MergeInvoicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	inv, err := h.invoiceService.MergeInvoices(req.InvoiceIDs, c.GetUint64("admin_id"), time.Now())
+	if err != nil {
+		switch err {
+		case invoiceSvc.ErrInvoiceNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invoice not found"})
+		case invoiceSvc.ErrMergeTooFew, invoiceSvc.ErrMergeMixed:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case invoiceSvc.ErrMergeNotOpen:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge invoices"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toInvoiceDetailResponse(inv))
+}
+
+// AdminSetConsolidation godoc
+// @Summary Set invoice consolidation (Admin)
+// @Description Sets the window in days within which the renewals of a customer are billed on one invoice, 0 for one invoice per service
+// @Tags admin/invoices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer ID"
+// @Param request body ConsolidationRequest true "Window"
+// @Success 200 {object} ConsolidationRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/invoice-consolidation [put]
+func (h *InvoiceHandler) AdminSetConsolidation(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	var req ConsolidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.invoiceService.SetConsolidateDays(customerID, *req.Days); err != nil {
+		switch err {
+		case invoiceSvc.ErrInvalidConsolidation:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case invoiceSvc.ErrCustomerNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Customer not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set invoice consolidation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+func writeDraftError(c *gin.Context, err error, fallback string) {
+	switch err {
+	case invoiceSvc.ErrInvoiceNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invoice not found"})
+	case invoiceSvc.ErrInvoiceNotDraft:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fallback})
+	}
+}
+
 // Helper functions
 
 func toInvoiceResponse(inv *domain.Invoice) InvoiceResponse {
@@ -188,9 +453,10 @@ func toInvoiceResponse(inv *domain.Invoice) InvoiceResponse {
 		InvoiceNumber: inv.InvoiceNumber,
 		Status:        string(inv.Status),
 		Currency:      inv.Currency,
-		Total:         inv.Total.String(),
-		Balance:       inv.Balance.String(),
+		Total:         formatAmount(inv.Total, inv.Currency),
+		Balance:       formatAmount(inv.Balance, inv.Currency),
 		DueDate:       inv.DueDate.Format("2006-01-02"),
+		PublishAt:     formatPublishAt(inv),
 		CreatedAt:     inv.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
@@ -203,9 +469,9 @@ func toInvoiceDetailResponse(inv *domain.Invoice) InvoiceDetailResponse {
 			Type:        item.Type,
 			Description: item.Description,
 			Quantity:    item.Quantity.String(),
-			UnitPrice:   item.UnitPrice.String(),
-			Discount:    item.Discount.String(),
-			Total:       item.Total.String(),
+			UnitPrice:   formatAmount(item.UnitPrice, inv.Currency),
+			Discount:    formatAmount(item.Discount, inv.Currency),
+			Total:       formatAmount(item.Total, inv.Currency),
 		})
 	}
 
@@ -214,15 +480,16 @@ func toInvoiceDetailResponse(inv *domain.Invoice) InvoiceDetailResponse {
 		InvoiceNumber: inv.InvoiceNumber,
 		Status:        string(inv.Status),
 		Currency:      inv.Currency,
-		Subtotal:      inv.Subtotal.String(),
-		Discount:      inv.Discount.String(),
-		TaxAmount:     inv.TaxAmount.String(),
-		Total:         inv.Total.String(),
-		AmountPaid:    inv.AmountPaid.String(),
-		Balance:       inv.Balance.String(),
+		Subtotal:      formatAmount(inv.Subtotal, inv.Currency),
+		Discount:      formatAmount(inv.Discount, inv.Currency),
+		TaxAmount:     formatAmount(inv.TaxAmount, inv.Currency),
+		Total:         formatAmount(inv.Total, inv.Currency),
+		AmountPaid:    formatAmount(inv.AmountPaid, inv.Currency),
+		Balance:       formatAmount(inv.Balance, inv.Currency),
 		DueDate:       inv.DueDate.Format("2006-01-02"),
 		Items:         items,
 		Notes:         inv.Notes,
+		PublishAt:     formatPublishAt(inv),
 		CreatedAt:     inv.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 
@@ -230,21 +497,70 @@ func toInvoiceDetailResponse(inv *domain.Invoice) InvoiceDetailResponse {
 		paidAt := inv.PaidAt.Format("2006-01-02T15:04:05Z")
 		resp.PaidAt = &paidAt
 	}
+	if inv.ReverseCharge {
+		resp.ReverseCharge = true
+		resp.VATNumber = inv.VATNumber
+		resp.VATConsultation = inv.VATConsultation
+		if inv.VATCheckedAt != nil {
+			checkedAt := inv.VATCheckedAt.Format(time.RFC3339)
+			resp.VATCheckedAt = &checkedAt
+		}
+	}
 
 	return resp
 }
 
-// Response types
+// formatPublishAt returns when a draft invoice is published, if scheduled
+func formatPublishAt(inv *domain.Invoice) *string {
+	if inv.PublishAt == nil {
+		return nil
+	}
+	publishAt := inv.PublishAt.Format(time.RFC3339)
+	return &publishAt
+}
+
+// Request/Response types
+
+type MergeInvoicesRequest struct {
+	InvoiceIDs []uint64 `json:"invoice_ids" binding:"required"`
+}
+
+type ConsolidationRequest struct {
+	Days *int `json:"days" binding:"required"` // 0 for one invoice per service
+}
+
+type PublishInvoicesRequest struct {
+	InvoiceIDs []uint64 `json:"invoice_ids" binding:"required"`
+}
+
+type PublishInvoicesResponse struct {
+	Published []uint64 `json:"published"`
+}
+
+type ScheduleInvoiceRequest struct {
+	PublishAt string `json:"publish_at"` // Empty to hold the draft until published by hand
+}
+
+type ReviewWindowRequest struct {
+	Hours *int `json:"hours" binding:"required"`
+}
+
+type DraftInvoiceResponse struct {
+	InvoiceResponse
+	CustomerID    uint64 `json:"customer_id"`
+	CustomerEmail string `json:"customer_email"`
+}
 
 type InvoiceResponse struct {
-	ID            uint64 `json:"id"`
-	InvoiceNumber string `json:"invoice_number"`
-	Status        string `json:"status"`
-	Currency      string `json:"currency"`
-	Total         string `json:"total"`
-	Balance       string `json:"balance"`
-	DueDate       string `json:"due_date"`
-	CreatedAt     string `json:"created_at"`
+	ID            uint64  `json:"id"`
+	InvoiceNumber string  `json:"invoice_number"`
+	Status        string  `json:"status"`
+	Currency      string  `json:"currency"`
+	Total         string  `json:"total"`
+	Balance       string  `json:"balance"`
+	DueDate       string  `json:"due_date"`
+	PublishAt     *string `json:"publish_at,omitempty"` // Drafts only
+	CreatedAt     string  `json:"created_at"`
 }
 
 type InvoiceDetailResponse struct {
@@ -262,7 +578,14 @@ type InvoiceDetailResponse struct {
 	PaidAt        *string               `json:"paid_at,omitempty"`
 	Items         []InvoiceItemResponse `json:"items"`
 	Notes         string                `json:"notes,omitempty"`
+	PublishAt     *string               `json:"publish_at,omitempty"` // Drafts only
 	CreatedAt     string                `json:"created_at"`
+
+	// Reverse charged invoices only
+	ReverseCharge   bool    `json:"reverse_charge"`
+	VATNumber       string  `json:"vat_number,omitempty"`
+	VATCheckedAt    *string `json:"vat_checked_at,omitempty"`
+	VATConsultation string  `json:"vat_consultation,omitempty"`
 }
 
 type InvoiceItemResponse struct {
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -84,9 +87,6 @@ func (h *KnowledgeBaseHandler) GetArticle(c *gin.Context) {
 		return
 	}
 
-	// Increment view count
-	h.service.IncrementViewCount(article.ID)
-
 	// Get related articles
 	related, err := h.service.GetRelatedArticles(article.ID, 5)
 	if err != nil {
@@ -99,6 +99,13 @@ func (h *KnowledgeBaseHandler) GetArticle(c *gin.Context) {
 	})
 }
 
+// CountView counts a view of the article a request reads. It goes ahead of
+// the response cache, which may answer without GetArticle.
+func (h *KnowledgeBaseHandler) CountView(c *gin.Context) {
+	h.service.IncrementViewCount(c.Param("slug"))
+	c.Next()
+}
+
 // SearchArticles searches knowledge base articles
 // @Summary Search articles
 // @Description Search knowledge base articles
@@ -180,6 +187,87 @@ func (h *KnowledgeBaseHandler) GetPopularArticles(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"articles": articles})
 }
 
+// SuggestArticles suggests articles for a ticket being written
+// @Summary Suggest articles for a ticket
+// @Description Returns the published articles that best match the subject and body of a draft ticket. Report what the customer did with them to /api/v1/kb/suggest/{id}/outcome.
+// @Tags Knowledge Base
+// @Accept json
+// @Produce json
+// @Param request body SuggestArticlesRequest true "Draft ticket"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/kb/suggest [post]
+func (h *KnowledgeBaseHandler) SuggestArticles(c *gin.Context) {
+	var req SuggestArticlesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Subject == "" && req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subject or body required"})
+		return
+	}
+
+	suggestion, err := h.service.SuggestArticles(req.Subject, req.Body, currentCustomerID(c), c.ClientIP(), req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestion_id": suggestion.ID,
+		"articles":      suggestion.Articles,
+	})
+}
+
+// RecordSuggestionOutcome records what a customer did with suggestions
+// @Summary Record suggestion outcome
+// @Description Records the suggested article the customer opened and whether it resolved their problem, so they sent no ticket
+// @Tags Knowledge Base
+// @Accept json
+// @Produce json
+// @Param id path int true "Suggestion ID"
+// @Param request body SuggestionOutcomeRequest true "Outcome"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/kb/suggest/{id}/outcome [post]
+func (h *KnowledgeBaseHandler) RecordSuggestionOutcome(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid suggestion ID"})
+		return
+	}
+
+	var req SuggestionOutcomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.RecordSuggestionOutcome(id, currentCustomerID(c), req.ArticleID, req.Resolved); err != nil {
+		switch {
+		case errors.Is(err, knowledgebase.ErrSuggestionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "suggestion not found"})
+		case errors.Is(err, knowledgebase.ErrArticleNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "article was not suggested"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Outcome recorded"})
+}
+
+// currentCustomerID returns the ID of the logged in user of a route with
+// optional authentication
+func currentCustomerID(c *gin.Context) *uint64 {
+	if user := GetCurrentUser(c); user != nil {
+		return &user.ID
+	}
+	return nil
+}
+
 // Admin handlers
 
 // AdminListCategories lists all categories including hidden
@@ -462,6 +550,130 @@ func (h *KnowledgeBaseHandler) AdminDeleteArticle(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Article deleted"})
 }
 
+// DownloadAttachment downloads an article attachment
+// @Summary Download attachment
+// @Description Redirects to a short-lived signed URL of an attachment of a published article
+// @Tags Knowledge Base
+// @Produce octet-stream
+// @Param id path int true "Attachment ID"
+// @Success 302
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/kb/attachments/{id} [get]
+func (h *KnowledgeBaseHandler) DownloadAttachment(c *gin.Context) {
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment ID"})
+		return
+	}
+
+	attachment, err := h.service.GetAttachment(attachmentID)
+	if err != nil || !attachment.Article.IsPublished() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+		return
+	}
+
+	url, err := h.service.AttachmentURL(attachment, fileURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.service.IncrementAttachmentDownload(attachment.ID)
+	sendFile(c, url, func() (io.ReadCloser, error) {
+		return h.service.OpenAttachment(c.Request.Context(), attachment)
+	}, attachment.FileName, attachment.ContentType, attachment.FileSize)
+}
+
+// AdminUploadAttachment uploads an article attachment
+// @Summary Admin: Upload attachment
+// @Description Upload a file of up to 100 MB in the "file" field of a multipart form. The file is streamed to the file store.
+// @Tags Admin Knowledge Base
+// @Accept mpfd
+// @Produce json
+// @Param id path int true "Article ID"
+// @Param file formData file true "Attachment"
+// @Success 201 {object} map[string]interface{}
+// @Failure 422 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/kb/articles/{id}/attachments [post]
+func (h *KnowledgeBaseHandler) AdminUploadAttachment(c *gin.Context) {
+	articleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid article ID"})
+		return
+	}
+
+	// Read the parts as they arrive instead of buffering the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxKBAttachmentSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart form expected"})
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing file"})
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		contentType := part.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		attachment, err := h.service.AddAttachment(c.Request.Context(), articleID, part.FileName(), contentType, part, -1)
+		part.Close()
+		if err != nil {
+			if scanError(c, err) {
+				return
+			}
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, knowledgebase.ErrArticleNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "article not found"})
+			case errors.As(err, &maxBytesErr):
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, attachment)
+		return
+	}
+}
+
+// AdminDeleteAttachment deletes an article attachment
+// @Summary Admin: Delete attachment
+// @Description Delete an article attachment and its file (admin only)
+// @Tags Admin Knowledge Base
+// @Produce json
+// @Param id path int true "Attachment ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/kb/attachments/{id} [delete]
+func (h *KnowledgeBaseHandler) AdminDeleteAttachment(c *gin.Context) {
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment ID"})
+		return
+	}
+
+	if err := h.service.DeleteAttachment(attachmentID); err != nil {
+		if errors.Is(err, knowledgebase.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
 // AdminGetSearchStats gets search statistics
 // @Summary Admin: Get search statistics
 // @Description Get popular search queries (admin only)
@@ -482,6 +694,31 @@ func (h *KnowledgeBaseHandler) AdminGetSearchStats(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"stats": stats})
 }
 
+// AdminGetDeflectionStats returns ticket deflection metrics
+// @Summary Admin: Get ticket deflection stats
+// @Description Returns how often articles suggested while writing a ticket were opened and resolved the problem
+// @Tags Admin Knowledge Base
+// @Produce json
+// @Param days query int false "Days to report" default(30)
+// @Param limit query int false "Number of top articles" default(10)
+// @Success 200 {object} knowledgebase.DeflectionStats
+// @Router /api/v1/admin/kb/deflection-stats [get]
+func (h *KnowledgeBaseHandler) AdminGetDeflectionStats(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days <= 0 {
+		days = 30
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	stats, err := h.service.GetDeflectionStats(time.Now().AddDate(0, 0, -days), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 // Request/Response types
 type RateArticleRequest struct {
 	Helpful bool `json:"helpful"`
@@ -517,3 +754,14 @@ type UpdateArticleRequest struct {
 	Excerpt string   `json:"excerpt"`
 	Tags    []string `json:"tags"`
 }
+
+type SuggestArticlesRequest struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Limit   int    `json:"limit"` // Up to 10, default 5
+}
+
+type SuggestionOutcomeRequest struct {
+	ArticleID *uint64 `json:"article_id"` // Suggested article the customer opened
+	Resolved  bool    `json:"resolved"`   // The article answered the question; no ticket was sent
+}
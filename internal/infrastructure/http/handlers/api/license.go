@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/license"
+)
+
+// LicenseHandler shows the license and the available updates to admins
+// and keeps enterprise modules from other editions
+type LicenseHandler struct {
+	licenseService *license.Service
+}
+
+// NewLicenseHandler creates a new license handler
+func NewLicenseHandler(licenseService *license.Service) *LicenseHandler {
+	return &LicenseHandler{licenseService: licenseService}
+}
+
+// RequireEdition answers 403 to requests to a module the edition in
+// effect is not served, such as the reseller module or SSO
+func (h *LicenseHandler) RequireEdition(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.licenseService.Allows(feature) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Error: "This module requires the " + license.RequiredEdition(feature) + " edition",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminGetLicense godoc
+// @Summary Admin: Get license and updates
+// @Description Returns the edition in effect, the last answer of the update server and the releases newer than the running version with their changelogs
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LicenseResponse
+// @Router /api/v1/admin/license [get]
+func (h *LicenseHandler) AdminGetLicense(c *gin.Context) {
+	c.JSON(http.StatusOK, toLicenseResponse(h.licenseService.Status(time.Now())))
+}
+
+// AdminUpdateLicense godoc
+// @Summary Admin: Set license key
+// @Description Stores the license key and validates it with the update server. The key is kept when the server cannot be reached.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateLicenseRequest true "License key"
+// @Success 200 {object} LicenseResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 502 {object} LicenseResponse
+// @Router /api/v1/admin/license [put]
+func (h *LicenseHandler) AdminUpdateLicense(c *gin.Context) {
+	var req UpdateLicenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status, err := h.licenseService.SetKey(c.Request.Context(), req.Key)
+	h.respond(c, status, err)
+}
+
+// AdminCheckLicense godoc
+// @Summary Admin: Check license and updates now
+// @Description Validates the license key and reads the releases from the update server instead of waiting for the daily check
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LicenseResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 502 {object} LicenseResponse
+// @Router /api/v1/admin/license/check [post]
+func (h *LicenseHandler) AdminCheckLicense(c *gin.Context) {
+	status, err := h.licenseService.Check(c.Request.Context(), time.Now())
+	h.respond(c, status, err)
+}
+
+// respond answers with the status after a check. An unreachable update
+// server is a 502 that still carries the status, as the last answer is
+// kept.
+func (h *LicenseHandler) respond(c *gin.Context, status *license.Status, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, toLicenseResponse(status))
+	case license.ErrServerUnavailable:
+		c.JSON(http.StatusBadGateway, toLicenseResponse(status))
+	case license.ErrNoServer, license.ErrKeyRequired:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check license"})
+	}
+}
+
+func toLicenseResponse(s *license.Status) LicenseResponse {
+	resp := LicenseResponse{
+		Edition:         s.Edition,
+		LicensedEdition: s.LicensedEdition,
+		Features:        s.Features,
+		Key:             s.Key,
+		Valid:           s.Valid,
+		Licensee:        s.Licensee,
+		ExpiresAt:       s.ExpiresAt,
+		Message:         s.Message,
+		CheckedAt:       s.CheckedAt,
+		AttemptedAt:     s.AttemptedAt,
+		LastError:       s.LastError,
+		Offline:         s.Offline,
+		GraceEndsAt:     s.GraceEndsAt,
+		Version:         s.Version,
+		LatestVersion:   s.LatestVersion,
+		UpdateAvailable: s.UpdateAvailable,
+		Releases:        make([]ReleaseResponse, 0, len(s.Releases)),
+	}
+	for _, r := range s.Releases {
+		resp.Releases = append(resp.Releases, ReleaseResponse{
+			Version:    r.Version,
+			ReleasedAt: r.ReleasedAt.Format(time.RFC3339),
+			Changelog:  r.Changelog,
+			URL:        r.URL,
+			Security:   r.Security,
+		})
+	}
+	return resp
+}
+
+// Request/Response types
+
+type UpdateLicenseRequest struct {
+	Key string `json:"key" binding:"required,max=512"`
+}
+
+type LicenseResponse struct {
+	Edition         string            `json:"edition"`                    // Edition in effect
+	LicensedEdition string            `json:"licensed_edition,omitempty"` // Edition of the key at the last check
+	Features        []string          `json:"features"`                   // Enterprise modules served
+	Key             string            `json:"key,omitempty"`              // Masked
+	Valid           bool              `json:"valid"`
+	Licensee        string            `json:"licensee,omitempty"`
+	ExpiresAt       *time.Time        `json:"expires_at,omitempty"`
+	Message         string            `json:"message,omitempty"`
+	CheckedAt       *time.Time        `json:"checked_at,omitempty"`
+	AttemptedAt     *time.Time        `json:"attempted_at,omitempty"`
+	LastError       string            `json:"last_error,omitempty"`
+	Offline         bool              `json:"offline"`
+	GraceEndsAt     *time.Time        `json:"grace_ends_at,omitempty"` // When the edition lapses unless the server is reached
+	Version         string            `json:"version"`
+	LatestVersion   string            `json:"latest_version,omitempty"`
+	UpdateAvailable bool              `json:"update_available"`
+	Releases        []ReleaseResponse `json:"releases"`
+}
+
+type ReleaseResponse struct {
+	Version    string `json:"version"`
+	ReleasedAt string `json:"released_at"`
+	Changelog  string `json:"changelog"`
+	URL        string `json:"url,omitempty"`
+	Security   bool   `json:"security,omitempty"`
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/markup"
+)
+
+// highlightCSSCacheAge is how long browsers may cache the stylesheet of
+// highlighted code, which only changes with a new release
+const highlightCSSCacheAge = 24 * time.Hour
+
+// MarkupHandler renders Markdown previews
+type MarkupHandler struct{}
+
+// NewMarkupHandler creates a new markup handler
+func NewMarkupHandler() *MarkupHandler {
+	return &MarkupHandler{}
+}
+
+// Preview godoc
+// @Summary Preview Markdown
+// @Description Renders Markdown as it will be shown once saved. Raw HTML is kept only for admins; everyone else gets strictly sanitized HTML.
+// @Tags markup
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MarkupPreviewRequest true "Content to render"
+// @Success 200 {object} MarkupPreviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/markup/preview [post]
+func (h *MarkupHandler) Preview(c *gin.Context) {
+	var req MarkupPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	opts := markup.Options{Trusted: GetCurrentUser(c).IsAdmin()}
+	switch req.Context {
+	case "kb":
+		opts.Highlight = true
+	case "", "ticket":
+		opts.HardWraps = true
+	}
+
+	html, err := markup.Render(req.Content, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to render content"})
+		return
+	}
+	c.JSON(http.StatusOK, MarkupPreviewResponse{HTML: html})
+}
+
+// HighlightCSS godoc
+// @Summary Get code highlighting stylesheet
+// @Description Returns the CSS for the highlighted code blocks of knowledge base articles
+// @Tags markup
+// @Produce text/css
+// @Success 200 {string} string
+// @Router /api/v1/markup/highlight.css [get]
+func (h *MarkupHandler) HighlightCSS(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := markup.HighlightCSS(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build stylesheet"})
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(highlightCSSCacheAge.Seconds())))
+	c.Data(http.StatusOK, "text/css; charset=utf-8", buf.Bytes())
+}
+
+// Request/Response types
+
+type MarkupPreviewRequest struct {
+	Content string `json:"content" binding:"max=200000"`
+	Context string `json:"context" binding:"omitempty,oneof=kb ticket"` // kb highlights code; ticket keeps line breaks
+}
+
+type MarkupPreviewResponse struct {
+	HTML string `json:"html"`
+}
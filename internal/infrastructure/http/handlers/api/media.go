@@ -0,0 +1,328 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/media"
+)
+
+// mediaCacheAge is how long browsers and proxies may cache hosted images.
+// Images never change under their ID; replacing one means a new upload.
+const mediaCacheAge = 7 * 24 * time.Hour
+
+// MediaHandler handles the media library and serves its images
+type MediaHandler struct {
+	mediaService *media.Service
+}
+
+// NewMediaHandler creates a new media handler
+func NewMediaHandler(mediaService *media.Service) *MediaHandler {
+	return &MediaHandler{mediaService: mediaService}
+}
+
+// ServeMedia godoc
+// @Summary Get image
+// @Description Serves an image of the media library for use in articles and product descriptions, as WebP when the browser accepts it
+// @Tags media
+// @Produce image/jpeg,image/png,image/gif,image/webp
+// @Param id path int true "Media ID"
+// @Param size query string false "thumbnail for the thumbnail"
+// @Success 200
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/media/{id} [get]
+func (h *MediaHandler) ServeMedia(c *gin.Context) {
+	file, ok := h.media(c)
+	if !ok {
+		return
+	}
+
+	acceptWebP := strings.Contains(c.GetHeader("Accept"), "image/webp")
+	r, contentType, err := h.mediaService.Open(c.Request.Context(), file, c.Query("size") == "thumbnail", acceptWebP)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Image not found"})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(mediaCacheAge.Seconds())))
+	c.Header("Vary", "Accept")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, r, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("inline", map[string]string{"filename": file.FileName}),
+	})
+}
+
+// AdminListMedia godoc
+// @Summary Admin: List media
+// @Description Returns the images of the media library, newest first
+// @Tags admin/media
+// @Produce json
+// @Security BearerAuth
+// @Param folder query string false "Folder; empty for the root folder"
+// @Param search query string false "Search file names and alt texts"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/media [get]
+func (h *MediaHandler) AdminListMedia(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	var folder *string
+	if value, ok := c.GetQuery("folder"); ok {
+		folder = &value
+	}
+
+	files, total, err := h.mediaService.ListMedia(folder, c.Query("search"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch media"})
+		return
+	}
+	response := make([]MediaResponse, 0, len(files))
+	for i := range files {
+		response = append(response, toMediaResponse(&files[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminListFolders godoc
+// @Summary Admin: List media folders
+// @Tags admin/media
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} media.Folder
+// @Router /api/v1/admin/media/folders [get]
+func (h *MediaHandler) AdminListFolders(c *gin.Context) {
+	folders, err := h.mediaService.ListFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch folders"})
+		return
+	}
+	c.JSON(http.StatusOK, folders)
+}
+
+// AdminUploadMedia godoc
+// @Summary Admin: Upload image
+// @Description Uploads a JPEG, PNG or GIF image. Large images are scaled down and a thumbnail and WebP variants are made.
+// @Tags admin/media
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Image"
+// @Param folder formData string false "Folder"
+// @Param alt_text formData string false "Alternative text"
+// @Success 201 {object} MediaResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/media [post]
+func (h *MediaHandler) AdminUploadMedia(c *gin.Context) {
+	var req MediaRequest
+	file, ok := bindUpload(c, h.mediaService.MaxFileSize()+uploadFormOverhead, &req)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	m, err := h.mediaService.Upload(c.Request.Context(), media.UploadInput{
+		FileName: file.header.Filename,
+		Folder:   req.Folder,
+		AltText:  req.AltText,
+		Reader:   file,
+		Size:     file.header.Size,
+	}, GetCurrentUserID(c))
+	if err != nil {
+		if scanError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, media.ErrFileTooLarge), errors.Is(err, media.ErrImageTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, media.ErrUnsupportedImage):
+			c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, media.ErrNoFileStore):
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload image"})
+		}
+		return
+	}
+	m.Uploader = *GetCurrentUser(c)
+	c.JSON(http.StatusCreated, toMediaResponse(m))
+}
+
+// AdminGetMedia godoc
+// @Summary Admin: Get image
+// @Description Returns an image with the articles and products that show it
+// @Tags admin/media
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Media ID"
+// @Success 200 {object} MediaDetailResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/media/{id} [get]
+func (h *MediaHandler) AdminGetMedia(c *gin.Context) {
+	file, ok := h.media(c)
+	if !ok {
+		return
+	}
+	refs, err := h.mediaService.FindReferences(file.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch image usage"})
+		return
+	}
+	c.JSON(http.StatusOK, MediaDetailResponse{
+		MediaResponse: toMediaResponse(file),
+		ArticleIDs:    refs.ArticleIDs,
+		ProductIDs:    refs.ProductIDs,
+	})
+}
+
+// AdminUpdateMedia godoc
+// @Summary Admin: Update image
+// @Description Renames an image, moves it to another folder or changes its alt text
+// @Tags admin/media
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Media ID"
+// @Param request body MediaRequest true "Image details"
+// @Success 200 {object} MediaResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/media/{id} [put]
+func (h *MediaHandler) AdminUpdateMedia(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid media ID"})
+		return
+	}
+	var req MediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	file, err := h.mediaService.UpdateMedia(id, media.MediaUpdate{
+		FileName: req.FileName,
+		Folder:   req.Folder,
+		AltText:  req.AltText,
+	})
+	if err != nil {
+		if errors.Is(err, media.ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update image"})
+		return
+	}
+	c.JSON(http.StatusOK, toMediaResponse(file))
+}
+
+// AdminDeleteMedia godoc
+// @Summary Admin: Delete image
+// @Description Deletes an image. Images still shown by articles or products are only deleted with force.
+// @Tags admin/media
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Media ID"
+// @Param force query bool false "Delete even when in use"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/media/{id} [delete]
+func (h *MediaHandler) AdminDeleteMedia(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid media ID"})
+		return
+	}
+
+	if err := h.mediaService.DeleteMedia(id, c.Query("force") == "true"); err != nil {
+		switch {
+		case errors.Is(err, media.ErrMediaNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Image not found"})
+		case errors.Is(err, media.ErrInUse):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete image"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Image deleted"})
+}
+
+func (h *MediaHandler) media(c *gin.Context) (*domain.MediaFile, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid media ID"})
+		return nil, false
+	}
+	file, err := h.mediaService.GetMedia(id)
+	if err != nil {
+		if errors.Is(err, media.ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Image not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch image"})
+		return nil, false
+	}
+	return file, true
+}
+
+// Request/Response types
+
+type MediaRequest struct {
+	FileName string `json:"file_name" form:"file_name" binding:"max=255"`
+	Folder   string `json:"folder" form:"folder" binding:"max=255"`
+	AltText  string `json:"alt_text" form:"alt_text" binding:"max=500"`
+}
+
+type MediaResponse struct {
+	ID           uint64 `json:"id"`
+	FileName     string `json:"file_name"`
+	Folder       string `json:"folder"`
+	AltText      string `json:"alt_text"`
+	ContentType  string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FileSize     int64  `json:"file_size"`
+	WebP         bool   `json:"webp"`
+	URL          string `json:"url"`           // Path to embed in articles and descriptions
+	ThumbnailURL string `json:"thumbnail_url"` // Path of the thumbnail
+	UploadedBy   string `json:"uploaded_by"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type MediaDetailResponse struct {
+	MediaResponse
+	ArticleIDs []uint64 `json:"article_ids"` // Knowledge base articles showing the image
+	ProductIDs []uint64 `json:"product_ids"` // Products showing the image
+}
+
+func toMediaResponse(file *domain.MediaFile) MediaResponse {
+	url := fmt.Sprintf("/api/v1/media/%d", file.ID)
+	return MediaResponse{
+		ID:           file.ID,
+		FileName:     file.FileName,
+		Folder:       file.Folder,
+		AltText:      file.AltText,
+		ContentType:  file.ContentType,
+		Width:        file.Width,
+		Height:       file.Height,
+		FileSize:     file.FileSize,
+		WebP:         file.WebPKey != "",
+		URL:          url,
+		ThumbnailURL: url + "?size=thumbnail",
+		UploadedBy:   file.Uploader.Email,
+		CreatedAt:    file.CreatedAt.Format(time.RFC3339),
+	}
+}
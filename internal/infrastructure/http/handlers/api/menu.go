@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// MenuHandler serves the navigation menus registered by the core modules
+// and addons, so SPA frontends render the same menus as the templates
+type MenuHandler struct {
+	registry *web.MenuRegistry
+}
+
+// NewMenuHandler creates a new menu handler
+func NewMenuHandler(registry *web.MenuRegistry) *MenuHandler {
+	return &MenuHandler{registry: registry}
+}
+
+// GetMenu returns a menu for the current user
+// @Summary Get menu
+// @Description Get the client or admin menu items the current user may see, with translated labels. The section or path marks the active items and the breadcrumbs.
+// @Tags Menus
+// @Produce json
+// @Security BearerAuth
+// @Param menu path string true "Menu (client or admin)"
+// @Param section query string false "Page section"
+// @Param path query string false "Page path"
+// @Success 200 {object} MenuResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/menus/{menu} [get]
+func (h *MenuHandler) GetMenu(c *gin.Context) {
+	user := GetCurrentUser(c)
+	menu := c.Param("menu")
+
+	if !h.registry.Has(menu) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "menu not found"})
+		return
+	}
+	if menu == web.MenuAdmin && (user == nil || !user.IsStaff()) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "staff access required"})
+		return
+	}
+
+	section, path := c.Query("section"), c.Query("path")
+	items := h.registry.Resolve(menu, user, section, path, web.RequestTranslator(c))
+
+	c.JSON(http.StatusOK, MenuResponse{Menu: menu, Items: items, Breadcrumbs: web.MenuTrail(items)})
+}
+
+// Request/Response types
+
+// MenuResponse is a menu resolved for the current user
+type MenuResponse struct {
+	Menu        string           `json:"menu"`
+	Items       []web.MenuEntry  `json:"items"`
+	Breadcrumbs []web.Breadcrumb `json:"breadcrumbs"`
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/service/money"
+)
+
+// moneyService writes the amounts of API responses. It knows the ISO 4217
+// currencies until SetMoneyService provides the configured ones.
+var moneyService = money.NewService(nil)
+
+// SetMoneyService sets the service writing the amounts of API responses
+func SetMoneyService(service *money.Service) {
+	moneyService = service
+}
+
+// formatAmount returns an amount with the decimals of its currency
+func formatAmount(amount decimal.Decimal, currency string) string {
+	return moneyService.Amount(amount, currency)
+}
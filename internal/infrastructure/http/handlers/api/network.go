@@ -0,0 +1,423 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/network"
+)
+
+// maxCalendarDays bounds the period of the maintenance calendar
+const maxCalendarDays = 366
+
+// NetworkHandler serves the network status page and its maintenance
+// calendar
+type NetworkHandler struct {
+	networkService *network.Service
+}
+
+// NewNetworkHandler creates a new network status handler
+func NewNetworkHandler(networkService *network.Service) *NetworkHandler {
+	return &NetworkHandler{networkService: networkService}
+}
+
+// ListComponents godoc
+// @Summary List status components
+// @Description Returns the components of the network status page and their status
+// @Tags network
+// @Produce json
+// @Success 200 {array} NetworkComponentResponse
+// @Router /api/v1/network/components [get]
+func (h *NetworkHandler) ListComponents(c *gin.Context) {
+	components, err := h.networkService.ListComponents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list components"})
+		return
+	}
+
+	response := make([]NetworkComponentResponse, 0, len(components))
+	for i := range components {
+		response = append(response, toNetworkComponentResponse(&components[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMaintenanceCalendar godoc
+// @Summary Maintenance calendar
+// @Description Returns the scheduled maintenance overlapping a period, by default the next 30 days
+// @Tags network
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} MaintenanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/network/maintenance [get]
+func (h *NetworkHandler) GetMaintenanceCalendar(c *gin.Context) {
+	from, to, ok := calendarPeriod(c)
+	if !ok {
+		return
+	}
+
+	maintenance, err := h.networkService.Calendar(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list maintenance"})
+		return
+	}
+
+	response := make([]MaintenanceResponse, 0, len(maintenance))
+	for i := range maintenance {
+		response = append(response, toMaintenanceResponse(&maintenance[i], false))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMyMaintenance godoc
+// @Summary My maintenance
+// @Description Returns the maintenance not over yet that affects services of the current user, with the affected services
+// @Tags network
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} MaintenanceResponse
+// @Router /api/v1/maintenance [get]
+func (h *NetworkHandler) GetMyMaintenance(c *gin.Context) {
+	affected, err := h.networkService.ForCustomer(GetCurrentUserID(c), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list maintenance"})
+		return
+	}
+	c.JSON(http.StatusOK, toAffectedResponse(affected))
+}
+
+// GetServiceMaintenance godoc
+// @Summary Service maintenance
+// @Description Returns the maintenance not over yet that affects a service. Maintenance with active set is under way.
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {array} MaintenanceResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/maintenance [get]
+func (h *NetworkHandler) GetServiceMaintenance(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	affected, err := h.networkService.ForService(serviceID, GetCurrentUserID(c), time.Now())
+	if err != nil {
+		writeNetworkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toAffectedResponse(affected))
+}
+
+// AdminCreateComponent godoc
+// @Summary Admin: Create status component
+// @Tags admin/network
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body NetworkComponentRequest true "Component"
+// @Success 201 {object} NetworkComponentResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/network/components [post]
+func (h *NetworkHandler) AdminCreateComponent(c *gin.Context) {
+	var req NetworkComponentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	component, err := h.networkService.CreateComponent(req.Name, req.Description, req.SortOrder)
+	if err != nil {
+		writeNetworkError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toNetworkComponentResponse(component))
+}
+
+// AdminListMaintenance godoc
+// @Summary Admin: List maintenance
+// @Description Returns the scheduled maintenance overlapping a period with its targets, by default the next 30 days
+// @Tags admin/network
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} MaintenanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/network/maintenance [get]
+func (h *NetworkHandler) AdminListMaintenance(c *gin.Context) {
+	from, to, ok := calendarPeriod(c)
+	if !ok {
+		return
+	}
+
+	maintenance, err := h.networkService.Calendar(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list maintenance"})
+		return
+	}
+
+	response := make([]MaintenanceResponse, 0, len(maintenance))
+	for i := range maintenance {
+		response = append(response, toMaintenanceResponse(&maintenance[i], true))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminScheduleMaintenance godoc
+// @Summary Admin: Schedule maintenance
+// @Description Schedules maintenance of a component. Customers of the targeted services, and of the services on the targeted servers, are emailed notice_hours before it starts.
+// @Tags admin/network
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MaintenanceRequest true "Maintenance"
+// @Success 201 {object} MaintenanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/network/maintenance [post]
+func (h *NetworkHandler) AdminScheduleMaintenance(c *gin.Context) {
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	maintenance, err := h.networkService.ScheduleMaintenance(c.GetUint64("admin_id"), req.input())
+	if err != nil {
+		writeNetworkError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toMaintenanceResponse(maintenance, true))
+}
+
+// AdminUpdateMaintenance godoc
+// @Summary Admin: Update maintenance
+// @Description Replaces the fields and targets of maintenance. Moving its window announces it again.
+// @Tags admin/network
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Maintenance ID"
+// @Param request body MaintenanceRequest true "Maintenance"
+// @Success 200 {object} MaintenanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/network/maintenance/{id} [put]
+func (h *NetworkHandler) AdminUpdateMaintenance(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid maintenance ID"})
+		return
+	}
+
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	maintenance, err := h.networkService.UpdateMaintenance(id, req.input())
+	if err != nil {
+		writeNetworkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toMaintenanceResponse(maintenance, true))
+}
+
+// AdminDeleteMaintenance godoc
+// @Summary Admin: Cancel maintenance
+// @Tags admin/network
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Maintenance ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/network/maintenance/{id} [delete]
+func (h *NetworkHandler) AdminDeleteMaintenance(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid maintenance ID"})
+		return
+	}
+
+	if err := h.networkService.DeleteMaintenance(id); err != nil {
+		writeNetworkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Maintenance cancelled"})
+}
+
+// calendarPeriod reads the from and to dates of a calendar request. The
+// period runs from the start of from to the end of to.
+func calendarPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 30)
+
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !to.After(from) || to.Sub(from) > maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Period must be at most a year, ending after it starts"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func writeNetworkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, network.ErrMaintenanceNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Maintenance not found"})
+	case errors.Is(err, network.ErrServiceNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+	case errors.Is(err, network.ErrComponentNotFound), errors.Is(err, network.ErrNameRequired),
+		errors.Is(err, network.ErrTitleRequired), errors.Is(err, network.ErrInvalidWindow),
+		errors.Is(err, network.ErrInvalidImpact), errors.Is(err, network.ErrTargetNotFound):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save maintenance"})
+	}
+}
+
+func toNetworkComponentResponse(component *domain.NetworkStatusPage) NetworkComponentResponse {
+	return NetworkComponentResponse{
+		ID:          component.ID,
+		Name:        component.Name,
+		Description: component.Description,
+		Status:      component.Status,
+	}
+}
+
+// toMaintenanceResponse converts maintenance. Targets are shown to staff
+// only.
+func toMaintenanceResponse(m *domain.NetworkIncident, withTargets bool) MaintenanceResponse {
+	now := time.Now()
+	resp := MaintenanceResponse{
+		ID:          m.ID,
+		ComponentID: m.ComponentID,
+		Component:   m.Component.Name,
+		Title:       m.Title,
+		Message:     m.Message,
+		Impact:      m.Impact,
+		Status:      m.Status,
+		StartsAt:    m.ScheduledAt.UTC().Format("2006-01-02T15:04:05Z"),
+		EndsAt:      m.ScheduledEnd.UTC().Format("2006-01-02T15:04:05Z"),
+		Active:      !m.ScheduledAt.After(now) && m.ScheduledEnd.After(now),
+	}
+	if withTargets {
+		resp.NoticeHours = &m.NoticeHours
+		resp.ServerIDs = []uint64{}
+		resp.TargetServiceIDs = []uint64{}
+		for _, t := range m.Targets {
+			if t.ServerID != nil {
+				resp.ServerIDs = append(resp.ServerIDs, *t.ServerID)
+			}
+			if t.ServiceID != nil {
+				resp.TargetServiceIDs = append(resp.TargetServiceIDs, *t.ServiceID)
+			}
+		}
+		if m.NoticeSentAt != nil {
+			resp.NoticeSentAt = m.NoticeSentAt.UTC().Format("2006-01-02T15:04:05Z")
+		}
+	}
+	return resp
+}
+
+func toAffectedResponse(affected []network.Affected) []MaintenanceResponse {
+	response := make([]MaintenanceResponse, 0, len(affected))
+	for i := range affected {
+		resp := toMaintenanceResponse(&affected[i].Maintenance, false)
+		resp.AffectedServiceIDs = affected[i].ServiceIDs
+		response = append(response, resp)
+	}
+	return response
+}
+
+// Request/Response types
+
+type NetworkComponentRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	SortOrder   int    `json:"sort_order"`
+}
+
+type MaintenanceRequest struct {
+	ComponentID uint64    `json:"component_id" binding:"required"`
+	Title       string    `json:"title" binding:"required"`
+	Message     string    `json:"message"`
+	Impact      string    `json:"impact"` // none, minor, major or critical
+	StartsAt    time.Time `json:"starts_at" binding:"required"`
+	EndsAt      time.Time `json:"ends_at" binding:"required"`
+	NoticeHours *int      `json:"notice_hours"` // Defaults to 48
+	ServerIDs   []uint64  `json:"server_ids"`
+	ServiceIDs  []uint64  `json:"service_ids"`
+}
+
+func (r MaintenanceRequest) input() network.MaintenanceInput {
+	noticeHours := 48
+	if r.NoticeHours != nil {
+		noticeHours = *r.NoticeHours
+	}
+	return network.MaintenanceInput{
+		ComponentID: r.ComponentID,
+		Title:       r.Title,
+		Message:     r.Message,
+		Impact:      r.Impact,
+		StartsAt:    r.StartsAt,
+		EndsAt:      r.EndsAt,
+		NoticeHours: noticeHours,
+		ServerIDs:   r.ServerIDs,
+		ServiceIDs:  r.ServiceIDs,
+	}
+}
+
+type NetworkComponentResponse struct {
+	ID          uint64 `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+}
+
+type MaintenanceResponse struct {
+	ID          uint64 `json:"id"`
+	ComponentID uint64 `json:"component_id"`
+	Component   string `json:"component"`
+	Title       string `json:"title"`
+	Message     string `json:"message"`
+	Impact      string `json:"impact"`
+	Status      string `json:"status"` // scheduled, in_progress or completed
+	StartsAt    string `json:"starts_at"`
+	EndsAt      string `json:"ends_at"`
+	Active      bool   `json:"active"` // Under way now
+
+	// Services of the current user it affects
+	AffectedServiceIDs []uint64 `json:"affected_service_ids,omitempty"`
+
+	// Staff only
+	NoticeHours      *int     `json:"notice_hours,omitempty"`
+	NoticeSentAt     string   `json:"notice_sent_at,omitempty"`
+	ServerIDs        []uint64 `json:"server_ids,omitempty"`
+	TargetServiceIDs []uint64 `json:"service_ids,omitempty"`
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/note"
+)
+
+// NoteHandler serves the internal staff notes on customers and orders
+type NoteHandler struct {
+	noteService *note.Service
+	authService *auth.Service
+}
+
+// NewNoteHandler creates a new note handler
+func NewNoteHandler(noteService *note.Service, authService *auth.Service) *NoteHandler {
+	return &NoteHandler{noteService: noteService, authService: authService}
+}
+
+// AdminGetCustomer godoc
+// @Summary Admin: Get customer
+// @Description Returns a customer with the pinned staff notes on top
+// @Tags admin/customers
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer ID"
+// @Success 200 {object} AdminCustomerResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id} [get]
+func (h *NoteHandler) AdminGetCustomer(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID"})
+		return
+	}
+
+	user, err := h.authService.GetUserByID(customerID)
+	if err != nil || user.Role != domain.UserRoleCustomer {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Customer not found"})
+		return
+	}
+	pinned, err := h.noteService.Pinned(domain.NoteSubjectCustomer, customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch notes"})
+		return
+	}
+
+	resp := AdminCustomerResponse{
+		PinnedNotes: toNoteResponses(pinned),
+		Customer: UserDetailResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			Company:       user.Company,
+			Phone:         user.Phone,
+			Address1:      user.Address1,
+			Address2:      user.Address2,
+			City:          user.City,
+			State:         user.State,
+			PostalCode:    user.PostalCode,
+			Country:       user.Country,
+			Role:          string(user.Role),
+			Status:        string(user.Status),
+			Language:      user.Language,
+			Currency:      user.Currency,
+			Timezone:      user.Timezone,
+			EmailVerified: user.EmailVerified,
+			Credit:        user.Credit.String(),
+			CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		},
+		AccountManagerID: user.AccountManagerID,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AdminListNotes godoc
+// @Summary Admin: List notes
+// @Description Returns the staff notes of a customer or order, pinned notes first and then the newest first
+// @Tags admin/notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer or order ID"
+// @Success 200 {array} NoteResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/notes [get]
+// @Router /api/v1/admin/orders/{id}/notes [get]
+func (h *NoteHandler) AdminListNotes(subject domain.NoteSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjectID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+			return
+		}
+
+		notes, err := h.noteService.List(subject, subjectID)
+		if err != nil {
+			writeNoteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, toNoteResponses(notes))
+	}
+}
+
+// AdminAddNote godoc
+// @Summary Admin: Add note
+// @Description Writes a staff note on a customer or order. Staff mentioned with @ followed by their email, or the part of it before the @, are notified.
+// @Tags admin/notes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer or order ID"
+// @Param request body AddNoteRequest true "Note"
+// @Success 201 {object} NoteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/notes [post]
+// @Router /api/v1/admin/orders/{id}/notes [post]
+func (h *NoteHandler) AdminAddNote(subject domain.NoteSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjectID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+			return
+		}
+
+		var req AddNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		result, err := h.noteService.Add(subject, subjectID, c.GetUint64("admin_id"), req.Note, req.Pinned)
+		if err != nil {
+			writeNoteError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, toNoteResponse(result))
+	}
+}
+
+// AdminUpdateNote godoc
+// @Summary Admin: Update note
+// @Description Replaces the text of a note, keeping the previous text in its history, and pins or unpins it. Staff mentioned for the first time are notified.
+// @Tags admin/notes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer or order ID"
+// @Param note_id path int true "Note ID"
+// @Param request body UpdateNoteRequest true "Note"
+// @Success 200 {object} NoteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/notes/{note_id} [put]
+// @Router /api/v1/admin/orders/{id}/notes/{note_id} [put]
+func (h *NoteHandler) AdminUpdateNote(subject domain.NoteSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjectID, noteID, ok := noteParams(c)
+		if !ok {
+			return
+		}
+
+		var req UpdateNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		result, err := h.noteService.Get(subject, subjectID, noteID)
+		if err == nil && strings.TrimSpace(req.Note) != "" {
+			result, err = h.noteService.Edit(subject, subjectID, noteID, c.GetUint64("admin_id"), req.Note)
+		}
+		if err == nil && req.Pinned != nil {
+			result, err = h.noteService.SetPinned(subject, subjectID, noteID, *req.Pinned)
+		}
+		if err != nil {
+			writeNoteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, toNoteResponse(result))
+	}
+}
+
+// AdminDeleteNote godoc
+// @Summary Admin: Delete note
+// @Tags admin/notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer or order ID"
+// @Param note_id path int true "Note ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/notes/{note_id} [delete]
+// @Router /api/v1/admin/orders/{id}/notes/{note_id} [delete]
+func (h *NoteHandler) AdminDeleteNote(subject domain.NoteSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjectID, noteID, ok := noteParams(c)
+		if !ok {
+			return
+		}
+
+		if err := h.noteService.Delete(subject, subjectID, noteID); err != nil {
+			writeNoteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, MessageResponse{Message: "Note deleted"})
+	}
+}
+
+// AdminNoteHistory godoc
+// @Summary Admin: Note history
+// @Description Returns the earlier versions of a note, newest first
+// @Tags admin/notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Customer or order ID"
+// @Param note_id path int true "Note ID"
+// @Success 200 {array} NoteRevisionResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/customers/{id}/notes/{note_id}/history [get]
+// @Router /api/v1/admin/orders/{id}/notes/{note_id}/history [get]
+func (h *NoteHandler) AdminNoteHistory(subject domain.NoteSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subjectID, noteID, ok := noteParams(c)
+		if !ok {
+			return
+		}
+
+		revisions, err := h.noteService.History(subject, subjectID, noteID)
+		if err != nil {
+			writeNoteError(c, err)
+			return
+		}
+		resp := make([]NoteRevisionResponse, 0, len(revisions))
+		for _, r := range revisions {
+			item := NoteRevisionResponse{
+				Note:     r.Note,
+				EditedBy: r.EditedBy,
+				EditedAt: r.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			}
+			if r.Editor != nil {
+				item.Editor = r.Editor.FullName()
+			}
+			resp = append(resp, item)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// noteParams reads the record and note IDs of a note request
+func noteParams(c *gin.Context) (uint64, uint64, bool) {
+	subjectID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+		return 0, 0, false
+	}
+	noteID, err := strconv.ParseUint(c.Param("note_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid note ID"})
+		return 0, 0, false
+	}
+	return subjectID, noteID, true
+}
+
+func writeNoteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, note.ErrNoteNotFound), errors.Is(err, note.ErrSubjectNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, note.ErrNoteRequired), errors.Is(err, note.ErrInvalidSubject):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save note"})
+	}
+}
+
+func toNoteResponses(notes []note.Note) []NoteResponse {
+	resp := make([]NoteResponse, 0, len(notes))
+	for i := range notes {
+		resp = append(resp, toNoteResponse(&notes[i]))
+	}
+	return resp
+}
+
+func toNoteResponse(n *note.Note) NoteResponse {
+	resp := NoteResponse{
+		ID:        n.ID,
+		StaffID:   n.StaffID,
+		Note:      n.Text,
+		Pinned:    n.Pinned,
+		Edited:    n.Edits > 0,
+		CreatedAt: n.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt: n.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if n.Staff != nil {
+		resp.Staff = n.Staff.FullName()
+	}
+	return resp
+}
+
+// Request/Response types
+
+type AddNoteRequest struct {
+	Note   string `json:"note" binding:"required"`
+	Pinned bool   `json:"pinned"`
+}
+
+type UpdateNoteRequest struct {
+	Note   string `json:"note"`   // New text, empty keeps the text
+	Pinned *bool  `json:"pinned"` // Omitted keeps the pin
+}
+
+type NoteResponse struct {
+	ID        uint64 `json:"id"`
+	StaffID   uint64 `json:"staff_id"`
+	Staff     string `json:"staff"`
+	Note      string `json:"note"`
+	Pinned    bool   `json:"pinned"`
+	Edited    bool   `json:"edited"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type NoteRevisionResponse struct {
+	Note     string `json:"note"` // Text before the edit
+	EditedBy uint64 `json:"edited_by"`
+	Editor   string `json:"editor"`
+	EditedAt string `json:"edited_at"`
+}
+
+type AdminCustomerResponse struct {
+	PinnedNotes      []NoteResponse     `json:"pinned_notes"`
+	Customer         UserDetailResponse `json:"customer"`
+	AccountManagerID *uint64            `json:"account_manager_id"`
+}
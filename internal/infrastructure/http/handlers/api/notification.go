@@ -1,11 +1,14 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/openhost/openhost/internal/core/domain"
 	"github.com/openhost/openhost/internal/core/service/notification"
 )
 
@@ -99,6 +102,69 @@ func (h *NotificationHandler) MarkAllAsRead(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read"})
 }
 
+// GetEmailPreferences gets how often the current user gets non-critical emails
+// @Summary Get email preferences
+// @Description Get how often the current user gets the emails of each category: immediate, daily or weekly
+// @Tags Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/account/email-preferences [get]
+func (h *NotificationHandler) GetEmailPreferences(c *gin.Context) {
+	frequencies, err := h.service.EmailFrequencies(GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"frequencies": frequencies})
+}
+
+// UpdateEmailPreferences changes how often the current user gets non-critical emails
+// @Summary Update email preferences
+// @Description Set the frequency of email categories. Emails of daily and weekly categories are held for a digest; never unsubscribes from a category other than billing.
+// @Tags Notifications
+// @Accept json
+// @Produce json
+// @Param request body UpdateEmailPreferencesRequest true "Frequencies by category"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/account/email-preferences [put]
+func (h *NotificationHandler) UpdateEmailPreferences(c *gin.Context) {
+	var req UpdateEmailPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for category, frequency := range req.Frequencies {
+		if !category.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": notification.ErrInvalidCategory.Error()})
+			return
+		}
+		if !frequency.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": notification.ErrInvalidFrequency.Error()})
+			return
+		}
+		if frequency == domain.EmailFrequencyNever && !category.CanOptOut() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": notification.ErrCannotOptOut.Error()})
+			return
+		}
+	}
+
+	userID := GetCurrentUserID(c)
+	for category, frequency := range req.Frequencies {
+		if err := h.service.SetEmailFrequency(userID, category, frequency); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	frequencies, err := h.service.EmailFrequencies(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"frequencies": frequencies})
+}
+
 // Admin handlers
 
 // AdminSendNotification sends a notification to a user
@@ -148,7 +214,20 @@ func (h *NotificationHandler) AdminListEmailTemplates(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"templates": templates})
+	stats, err := h.service.TemplateStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	templateStats := make(map[uint64]TemplateStatsResponse, len(templates))
+	for _, template := range templates {
+		templateStats[template.ID] = toTemplateStatsResponse(stats[template.ID])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"stats":     templateStats,
+	})
 }
 
 // AdminCreateEmailTemplate creates an email template
@@ -241,6 +320,103 @@ func (h *NotificationHandler) AdminTestEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Test email sent"})
 }
 
+// AdminGetWelcomeEmail gets the welcome email of a product
+// @Summary Admin: Get product welcome email
+// @Description Get the welcome email sent when a service of the product is activated (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/products/{id}/welcome-email [get]
+func (h *NotificationHandler) AdminGetWelcomeEmail(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	email, err := h.service.GetWelcomeEmail(productID)
+	if err != nil {
+		if err == notification.ErrWelcomeEmailNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"welcome_email": email})
+}
+
+// AdminSetWelcomeEmail sets the welcome email of a product
+// @Summary Admin: Set product welcome email
+// @Description Create or replace the welcome email of a product (admin only). Subject and body are templates with the service details, credentials, .Options and custom .Fields.
+// @Tags Admin Notifications
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param request body SetWelcomeEmailRequest true "Welcome email request"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/products/{id}/welcome-email [put]
+func (h *NotificationHandler) AdminSetWelcomeEmail(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	var req SetWelcomeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, err := h.service.SetWelcomeEmail(productID, req.Subject, req.Body, req.Active)
+	if err != nil {
+		if err == notification.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Welcome email saved",
+		"welcome_email": email,
+	})
+}
+
+// AdminResendWelcomeEmail queues the welcome email of a service again
+// @Summary Admin: Resend welcome email
+// @Description Render the product welcome email for a service and queue it again (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param id path int true "Service ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/services/{id}/welcome-email [post]
+func (h *NotificationHandler) AdminResendWelcomeEmail(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service ID"})
+		return
+	}
+
+	if err := h.service.SendWelcomeEmail(serviceID); err != nil {
+		switch err {
+		case notification.ErrServiceNotFound, notification.ErrWelcomeEmailNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case notification.ErrSMTPNotConfigured:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Welcome email queued"})
+}
+
 // AdminCreateWebhook creates a webhook
 // @Summary Admin: Create webhook
 // @Description Create a webhook configuration (admin only)
@@ -275,6 +451,450 @@ func (h *NotificationHandler) AdminCreateWebhook(c *gin.Context) {
 	})
 }
 
+// AdminListSuppressions lists the suppression list
+// @Summary Admin: List suppressed addresses
+// @Description List the addresses the email queue never sends to, with the reason (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/suppressions [get]
+func (h *NotificationHandler) AdminListSuppressions(c *gin.Context) {
+	suppressions, err := h.service.ListSuppressions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suppressions": suppressions})
+}
+
+// AdminAddSuppression puts an address on the suppression list
+// @Summary Admin: Suppress address
+// @Description Stop sending email to an address, for a bounce, a complaint or by hand (admin only)
+// @Tags Admin Notifications
+// @Accept json
+// @Produce json
+// @Param request body AddSuppressionRequest true "Suppression request"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/suppressions [post]
+func (h *NotificationHandler) AdminAddSuppression(c *gin.Context) {
+	var req AddSuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetUint64("admin_id")
+	suppression, err := h.service.AddSuppression(req.Email, domain.SuppressionReason(req.Reason), req.Note, &adminID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Address suppressed",
+		"suppression": suppression,
+	})
+}
+
+// AdminRemoveSuppression takes an address off the suppression list
+// @Summary Admin: Remove suppressed address
+// @Description Send email to a suppressed address again (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param id path int true "Suppression ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/suppressions/{id} [delete]
+func (h *NotificationHandler) AdminRemoveSuppression(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid suppression ID"})
+		return
+	}
+
+	if err := h.service.RemoveSuppression(id); err != nil {
+		if errors.Is(err, notification.ErrSuppressionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address removed from the suppression list"})
+}
+
+// AdminListSkippedEmails lists the emails the queue skipped
+// @Summary Admin: List skipped emails
+// @Description List the queued emails that were not sent and why: a suppressed address or an unsubscribed category (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param email query string false "Recipient address"
+// @Param limit query int false "Limit results"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/skipped [get]
+func (h *NotificationHandler) AdminListSkippedEmails(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	emails, err := h.service.ListSkipped(c.Query("email"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	skipped := make([]SkippedEmailResponse, 0, len(emails))
+	for _, email := range emails {
+		skipped = append(skipped, SkippedEmailResponse{
+			ID:         email.ID,
+			ToEmail:    email.ToEmail,
+			Subject:    email.Subject,
+			Category:   email.Category,
+			SkipReason: email.SkipReason,
+			CustomerID: email.CustomerID,
+			CreatedAt:  email.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"emails": skipped})
+}
+
+// AdminListDKIMKeys lists the DKIM keys of the sending domains
+// @Summary Admin: List DKIM keys
+// @Description List the DKIM keys of the sending domains with the DNS record publishing each (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/dkim [get]
+func (h *NotificationHandler) AdminListDKIMKeys(c *gin.Context) {
+	keys, err := h.service.ListDKIMKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]DKIMKeyResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, toDKIMKeyResponse(&keys[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": response})
+}
+
+// AdminGenerateDKIMKey generates the DKIM key of a sending domain
+// @Summary Admin: Generate DKIM key
+// @Description Generate the DKIM key email from a domain is signed with. A domain that has a key gets a new one. (admin only)
+// @Tags Admin Notifications
+// @Accept json
+// @Produce json
+// @Param request body GenerateDKIMKeyRequest true "DKIM key request"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/dkim [post]
+func (h *NotificationHandler) AdminGenerateDKIMKey(c *gin.Context) {
+	var req GenerateDKIMKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Selector == "" {
+		req.Selector = "openhost"
+	}
+
+	key, err := h.service.GenerateDKIMKey(req.Domain, req.Selector)
+	if err != nil {
+		if errors.Is(err, notification.ErrInvalidDomain) || errors.Is(err, notification.ErrInvalidSelector) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "DKIM key generated, publish its DNS record",
+		"key":     toDKIMKeyResponse(key),
+	})
+}
+
+// AdminDeleteDKIMKey deletes the DKIM key of a sending domain
+// @Summary Admin: Delete DKIM key
+// @Description Stop signing the email of a domain (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param id path int true "DKIM key ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/dkim/{id} [delete]
+func (h *NotificationHandler) AdminDeleteDKIMKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid DKIM key ID"})
+		return
+	}
+
+	if err := h.service.DeleteDKIMKey(id); err != nil {
+		if errors.Is(err, notification.ErrDKIMKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "DKIM key deleted"})
+}
+
+// AdminSetReturnPath sets the return path of an SMTP configuration
+// @Summary Admin: Set return path
+// @Description Set the envelope sender bounces of an SMTP configuration go to; empty sends them to its from address (admin only)
+// @Tags Admin Notifications
+// @Accept json
+// @Produce json
+// @Param id path int true "SMTP configuration ID"
+// @Param request body SetReturnPathRequest true "Return path request"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/smtp/{id}/return-path [put]
+func (h *NotificationHandler) AdminSetReturnPath(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SMTP configuration ID"})
+		return
+	}
+
+	var req SetReturnPathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetReturnPath(id, req.ReturnPath); err != nil {
+		switch {
+		case errors.Is(err, notification.ErrSMTPConfigNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, notification.ErrInvalidReturnPath):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Return path updated"})
+}
+
+// AdminCheckDNS checks the email DNS records of a domain
+// @Summary Admin: Check email DNS
+// @Description Verify the SPF, DKIM and DMARC records of a sending domain. Each record is ok, missing, invalid, mismatch or error. (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param domain query string true "Sending domain"
+// @Success 200 {object} DNSCheckResponse
+// @Router /api/v1/admin/email/dns-check [get]
+func (h *NotificationHandler) AdminCheckDNS(c *gin.Context) {
+	check, err := h.service.CheckDNS(c.Request.Context(), c.Query("domain"))
+	if err != nil {
+		if errors.Is(err, notification.ErrInvalidDomain) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, DNSCheckResponse{
+		Domain: check.Domain,
+		SPF:    toDNSRecordResponse(check.SPF),
+		DKIM:   toDNSRecordResponse(check.DKIM),
+		DMARC:  toDNSRecordResponse(check.DMARC),
+	})
+}
+
+// AdminGetTracking tells whether email tracking is on
+// @Summary Admin: Get email tracking
+// @Description Tell whether emails are sent with an open pixel and wrapped links (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/tracking [get]
+func (h *NotificationHandler) AdminGetTracking(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.service.TrackingEnabled()})
+}
+
+// AdminSetTracking turns email tracking on or off
+// @Summary Admin: Set email tracking
+// @Description Turn the open and click tracking of emails on or off for every email (admin only)
+// @Tags Admin Notifications
+// @Accept json
+// @Produce json
+// @Param request body SetTrackingRequest true "Tracking request"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/email/tracking [put]
+func (h *NotificationHandler) AdminSetTracking(c *gin.Context) {
+	var req SetTrackingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetTracking(*req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
+
+// AdminGetEmailLog gets a sent email with its opens and clicks
+// @Summary Admin: Get email log
+// @Description Get a logged email with its opens, clicks and the clicks of each of its links (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param id path int true "Email log ID"
+// @Success 200 {object} EmailLogResponse
+// @Router /api/v1/admin/email/logs/{id} [get]
+func (h *NotificationHandler) AdminGetEmailLog(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email log ID"})
+		return
+	}
+
+	emailLog, err := h.service.GetEmailLog(id)
+	if err != nil {
+		if errors.Is(err, notification.ErrTrackingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "email log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := EmailLogResponse{
+		ID:             emailLog.ID,
+		TemplateID:     emailLog.TemplateID,
+		CustomerID:     emailLog.CustomerID,
+		ToEmail:        emailLog.ToEmail,
+		Subject:        emailLog.Subject,
+		Status:         emailLog.Status,
+		SentAt:         emailLog.SentAt,
+		Tracked:        emailLog.TrackingToken != "",
+		Opens:          emailLog.Opens,
+		Clicks:         emailLog.Clicks,
+		FirstOpenedAt:  emailLog.FirstOpenedAt,
+		LastOpenedAt:   emailLog.LastOpenedAt,
+		FirstClickedAt: emailLog.FirstClickedAt,
+		Links:          make([]EmailLinkResponse, 0, len(emailLog.Links)),
+	}
+	for _, link := range emailLog.Links {
+		response.Links = append(response.Links, EmailLinkResponse{
+			URL:           link.URL,
+			Clicks:        link.Clicks,
+			LastClickedAt: link.LastClickedAt,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminGetPostmaster reports on email delivery
+// @Summary Admin: Postmaster dashboard
+// @Description Report the email queue, the sends and failures of each SMTP config, recent hard bounces, recipient domains failing often and how much of each daily limit is used (admin only)
+// @Tags Admin Notifications
+// @Produce json
+// @Param hours query int false "Hours to report on (default 24)"
+// @Success 200 {object} PostmasterResponse
+// @Router /api/v1/admin/email/postmaster [get]
+func (h *NotificationHandler) AdminGetPostmaster(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if hours <= 0 || hours > 24*30 {
+		hours = 24
+	}
+
+	now := time.Now()
+	report, err := h.service.PostmasterReport(now.Add(-time.Duration(hours) * time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := PostmasterResponse{
+		Since: report.Since,
+		Queue: QueueStatsResponse{
+			Pending:       report.Queue.Pending,
+			Sending:       report.Queue.Sending,
+			Failed:        report.Queue.Failed,
+			Skipped:       report.Queue.Skipped,
+			OldestPending: report.Queue.OldestPending,
+		},
+		SMTPConfigs:    make([]SMTPStatsResponse, 0, len(report.SMTPConfigs)),
+		RecentBounces:  make([]BounceResponse, 0, len(report.RecentBounces)),
+		FailingDomains: make([]DomainStatsResponse, 0, len(report.FailingDomains)),
+	}
+	for _, stats := range report.SMTPConfigs {
+		response.SMTPConfigs = append(response.SMTPConfigs, SMTPStatsResponse{
+			ID:          stats.Config.ID,
+			Name:        stats.Config.Name,
+			Active:      stats.Config.Active,
+			Sent:        stats.Sent,
+			Failed:      stats.Failed,
+			Bounced:     stats.Bounced,
+			FailureRate: stats.FailureRate(),
+			DailyLimit:  stats.Config.DailyLimit,
+			SentToday:   stats.Config.SentOn(now),
+			LimitUsage:  stats.Config.LimitUsage(now),
+		})
+	}
+	for _, bounce := range report.RecentBounces {
+		response.RecentBounces = append(response.RecentBounces, BounceResponse{
+			ID:           bounce.ID,
+			ToEmail:      bounce.ToEmail,
+			Subject:      bounce.Subject,
+			Error:        bounce.ErrorMsg,
+			SMTPConfigID: bounce.SMTPConfigID,
+			CreatedAt:    bounce.CreatedAt,
+		})
+	}
+	for _, stats := range report.FailingDomains {
+		response.FailingDomains = append(response.FailingDomains, DomainStatsResponse{
+			Domain:      stats.Domain,
+			Sent:        stats.Sent,
+			Failed:      stats.Failed,
+			FailureRate: stats.FailureRate(),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func toTemplateStatsResponse(stats notification.TemplateStats) TemplateStatsResponse {
+	return TemplateStatsResponse{
+		Sent:      stats.Sent,
+		Opened:    stats.Opened,
+		Clicked:   stats.Clicked,
+		OpenRate:  stats.OpenRate(),
+		ClickRate: stats.ClickRate(),
+	}
+}
+
+func toDKIMKeyResponse(key *domain.DKIMKey) DKIMKeyResponse {
+	return DKIMKeyResponse{
+		ID:        key.ID,
+		Domain:    key.Domain,
+		Selector:  key.Selector,
+		DNSName:   key.DNSName(),
+		DNSRecord: key.DNSRecord(),
+		Active:    key.Active,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+func toDNSRecordResponse(check notification.DNSRecordCheck) DNSRecordResponse {
+	return DNSRecordResponse{
+		Name:     check.Name,
+		Status:   check.Status,
+		Record:   check.Record,
+		Expected: check.Expected,
+		Message:  check.Message,
+	}
+}
+
 // Request/Response types
 type AdminSendNotificationRequest struct {
 	UserID  uint64 `json:"user_id" binding:"required"`
@@ -284,6 +904,140 @@ type AdminSendNotificationRequest struct {
 	Link    string `json:"link"`
 }
 
+type UpdateEmailPreferencesRequest struct {
+	Frequencies map[domain.EmailCategory]domain.EmailFrequency `json:"frequencies" binding:"required"`
+}
+
+type AddSuppressionRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Reason string `json:"reason" binding:"required"`
+	Note   string `json:"note"`
+}
+
+type SkippedEmailResponse struct {
+	ID         uint64    `json:"id"`
+	ToEmail    string    `json:"to_email"`
+	Subject    string    `json:"subject"`
+	Category   string    `json:"category,omitempty"`
+	SkipReason string    `json:"skip_reason"`
+	CustomerID *uint64   `json:"customer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type GenerateDKIMKeyRequest struct {
+	Domain   string `json:"domain" binding:"required"`
+	Selector string `json:"selector"`
+}
+
+type DKIMKeyResponse struct {
+	ID        uint64    `json:"id"`
+	Domain    string    `json:"domain"`
+	Selector  string    `json:"selector"`
+	DNSName   string    `json:"dns_name"`
+	DNSRecord string    `json:"dns_record"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SetReturnPathRequest struct {
+	ReturnPath string `json:"return_path"`
+}
+
+type DNSRecordResponse struct {
+	Name     string `json:"name,omitempty"`
+	Status   string `json:"status"`
+	Record   string `json:"record,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type DNSCheckResponse struct {
+	Domain string            `json:"domain"`
+	SPF    DNSRecordResponse `json:"spf"`
+	DKIM   DNSRecordResponse `json:"dkim"`
+	DMARC  DNSRecordResponse `json:"dmarc"`
+}
+
+type SetTrackingRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+type TemplateStatsResponse struct {
+	Sent      int64   `json:"sent"`
+	Opened    int64   `json:"opened"`
+	Clicked   int64   `json:"clicked"`
+	OpenRate  float64 `json:"open_rate"`
+	ClickRate float64 `json:"click_rate"`
+}
+
+type EmailLinkResponse struct {
+	URL           string     `json:"url"`
+	Clicks        int        `json:"clicks"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+}
+
+type EmailLogResponse struct {
+	ID             uint64              `json:"id"`
+	TemplateID     *uint64             `json:"template_id,omitempty"`
+	CustomerID     *uint64             `json:"customer_id,omitempty"`
+	ToEmail        string              `json:"to_email"`
+	Subject        string              `json:"subject"`
+	Status         string              `json:"status"`
+	SentAt         *time.Time          `json:"sent_at,omitempty"`
+	Tracked        bool                `json:"tracked"`
+	Opens          int                 `json:"opens"`
+	Clicks         int                 `json:"clicks"`
+	FirstOpenedAt  *time.Time          `json:"first_opened_at,omitempty"`
+	LastOpenedAt   *time.Time          `json:"last_opened_at,omitempty"`
+	FirstClickedAt *time.Time          `json:"first_clicked_at,omitempty"`
+	Links          []EmailLinkResponse `json:"links"`
+}
+
+type PostmasterResponse struct {
+	Since          time.Time             `json:"since"`
+	Queue          QueueStatsResponse    `json:"queue"`
+	SMTPConfigs    []SMTPStatsResponse   `json:"smtp_configs"`
+	RecentBounces  []BounceResponse      `json:"recent_bounces"`
+	FailingDomains []DomainStatsResponse `json:"failing_domains"`
+}
+
+type QueueStatsResponse struct {
+	Pending       int64      `json:"pending"`
+	Sending       int64      `json:"sending"`
+	Failed        int64      `json:"failed"`
+	Skipped       int64      `json:"skipped"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+}
+
+type SMTPStatsResponse struct {
+	ID          uint64  `json:"id"`
+	Name        string  `json:"name"`
+	Active      bool    `json:"active"`
+	Sent        int64   `json:"sent"`
+	Failed      int64   `json:"failed"`
+	Bounced     int64   `json:"bounced"`
+	FailureRate float64 `json:"failure_rate"`
+	DailyLimit  int     `json:"daily_limit"`
+	SentToday   int     `json:"sent_today"`
+	LimitUsage  float64 `json:"limit_usage"`
+}
+
+type BounceResponse struct {
+	ID           uint64    `json:"id"`
+	ToEmail      string    `json:"to_email"`
+	Subject      string    `json:"subject"`
+	Error        string    `json:"error"`
+	SMTPConfigID *uint64   `json:"smtp_config_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type DomainStatsResponse struct {
+	Domain      string  `json:"domain"`
+	Sent        int64   `json:"sent"`
+	Failed      int64   `json:"failed"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
 type CreateEmailTemplateRequest struct {
 	Name      string `json:"name" binding:"required"`
 	Type      string `json:"type" binding:"required"`
@@ -300,6 +1054,12 @@ type UpdateEmailTemplateRequest struct {
 	Active    bool   `json:"active"`
 }
 
+type SetWelcomeEmailRequest struct {
+	Subject string `json:"subject" binding:"required"`
+	Body    string `json:"body" binding:"required"`
+	Active  bool   `json:"active"`
+}
+
 type TestEmailRequest struct {
 	To        string `json:"to" binding:"required,email"`
 	Subject   string `json:"subject" binding:"required"`
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/numbering"
+)
+
+// NumberingHandler handles the numbering schemes of invoices and orders
+type NumberingHandler struct {
+	numberingService *numbering.Service
+}
+
+// NewNumberingHandler creates a new numbering handler
+func NewNumberingHandler(numberingService *numbering.Service) *NumberingHandler {
+	return &NumberingHandler{numberingService: numberingService}
+}
+
+// AdminListSequences godoc
+// @Summary List number sequences (Admin)
+// @Description Returns the numbering scheme of invoices and orders with the last number given out in the current period and the next one
+// @Tags admin/numbering
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string][]NumberSequenceResponse
+// @Router /api/v1/admin/numbering [get]
+func (h *NumberingHandler) AdminListSequences(c *gin.Context) {
+	now := time.Now()
+	response := make([]NumberSequenceResponse, 0, len(numbering.Kinds))
+	for _, kind := range numbering.Kinds {
+		sequence, err := h.sequenceResponse(kind, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch number sequences"})
+			return
+		}
+		response = append(response, sequence)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sequences": response})
+}
+
+// AdminUpdateSequence godoc
+// @Summary Update number sequence (Admin)
+// @Description Sets the format and reset of a number sequence: {SEQ} or {SEQ:n} padded to n digits, with {YEAR}, {YY}, {MONTH} and {DAY}. next_number raises the number the next document gets in the current period. A format that would give out numbers already issued is refused unless next_number is past them.
+// @Tags admin/numbering
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param kind path string true "invoice or order"
+// @Param request body UpdateNumberSequenceRequest true "Sequence"
+// @Success 200 {object} NumberSequenceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/numbering/{kind} [put]
+func (h *NumberingHandler) AdminUpdateSequence(c *gin.Context) {
+	kind := domain.NumberKind(c.Param("kind"))
+
+	var req UpdateNumberSequenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Reset == "" {
+		req.Reset = string(domain.NumberResetNever)
+	}
+
+	now := time.Now()
+	if _, err := h.numberingService.UpdateSequence(kind, req.Format, domain.NumberReset(req.Reset), req.NextNumber, now); err != nil {
+		writeNumberingError(c, err)
+		return
+	}
+
+	response, err := h.sequenceResponse(kind, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch number sequence"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *NumberingHandler) sequenceResponse(kind domain.NumberKind, now time.Time) (NumberSequenceResponse, error) {
+	sequence, err := h.numberingService.Sequence(kind)
+	if err != nil {
+		return NumberSequenceResponse{}, err
+	}
+	last, err := h.numberingService.Last(kind, now)
+	if err != nil {
+		return NumberSequenceResponse{}, err
+	}
+	return NumberSequenceResponse{
+		Kind:       string(kind),
+		Format:     sequence.Format,
+		Reset:      string(sequence.Reset),
+		LastNumber: last,
+		Next:       numbering.Format(sequence.Format, now, last+1),
+	}, nil
+}
+
+func writeNumberingError(c *gin.Context, err error) {
+	switch err {
+	case numbering.ErrUnknownKind:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Unknown number sequence"})
+	case numbering.ErrInvalidFormat, numbering.ErrInvalidReset, numbering.ErrResetNeedsDate:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case numbering.ErrNextTooLow, numbering.ErrNumbersIssued:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update number sequence"})
+	}
+}
+
+// Request/Response types
+
+type UpdateNumberSequenceRequest struct {
+	Format     string `json:"format" binding:"required"`
+	Reset      string `json:"reset"`       // never (default), yearly or monthly
+	NextNumber uint64 `json:"next_number"` // Optional, only raises the sequence
+}
+
+type NumberSequenceResponse struct {
+	Kind       string `json:"kind"`
+	Format     string `json:"format"`
+	Reset      string `json:"reset"`
+	LastNumber uint64 `json:"last_number"` // In the current period
+	Next       string `json:"next"`
+}
@@ -1,29 +1,68 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/address"
+	"github.com/openhost/openhost/internal/core/service/approval"
+	"github.com/openhost/openhost/internal/core/service/customfield"
 	"github.com/openhost/openhost/internal/core/service/order"
+	"github.com/openhost/openhost/internal/core/service/vat"
+	"github.com/openhost/openhost/internal/infrastructure/web"
 )
 
 // OrderHandler handles order API endpoints
 type OrderHandler struct {
-	orderService *order.Service
-	cartService  *order.CartService
+	orderService   *order.Service
+	cartService    *order.CartService
+	accountService *account.Service
+	vatService     *vat.Service
+	approvals      *approval.Service
 }
 
 // NewOrderHandler creates a new order handler
-func NewOrderHandler(orderService *order.Service, cartService *order.CartService) *OrderHandler {
+func NewOrderHandler(orderService *order.Service, cartService *order.CartService, accountService *account.Service) *OrderHandler {
 	return &OrderHandler{
-		orderService: orderService,
-		cartService:  cartService,
+		orderService:   orderService,
+		cartService:    cartService,
+		accountService: accountService,
 	}
 }
 
+// SetVATService checks the VAT numbers customers give at checkout, so EU
+// businesses are reverse charged
+func (h *OrderHandler) SetVATService(vatService *vat.Service) {
+	h.vatService = vatService
+}
+
+// SetApprovalService holds service terminations for a second admin when
+// the two-person rule covers them
+func (h *OrderHandler) SetApprovalService(approvals *approval.Service) {
+	h.approvals = approvals
+	approvals.Register(approval.ActionTerminateService, func(request *domain.ApprovalRequest) (string, error) {
+		var params terminateServiceParams
+		if err := approval.DecodeParams(request, &params); err != nil {
+			return "", err
+		}
+		if err := h.orderService.TerminateService(params.ServiceID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Service #%d terminated", params.ServiceID), nil
+	})
+}
+
+type terminateServiceParams struct {
+	ServiceID uint64 `json:"service_id"`
+}
+
 // ListOrders godoc
 // @Summary List orders
 // @Description Returns the current user's orders
@@ -39,7 +78,7 @@ func (h *OrderHandler) ListOrders(c *gin.Context) {
 	userID := GetCurrentUserID(c)
 	limit, offset := PaginationParams(c)
 
-	orders, total, err := h.orderService.ListOrders(userID, limit, offset)
+	orders, total, err := h.orderService.WithContext(c.Request.Context()).ListOrders(userID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
 		return
@@ -93,18 +132,45 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 // CreateOrder godoc
 // @Summary Create order from cart
-// @Description Creates a new order from the user's shopping cart
+// @Description Creates a new order from the user's shopping cart. Every current legal document that requires consent must be accepted, and required order fields such as a purchase order number filled in. The customer's billing address must be complete and valid for their country, and the country must not be restricted or embargoed. A vat_number is checked with VIES first; EU businesses with a valid number in another member state than the seller are reverse charged.
 // @Tags orders
+// @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Param request body CreateOrderRequest false "Accepted legal documents and order fields"
 // @Success 201 {object} OrderResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /api/v1/orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	userID := GetCurrentUserID(c)
 	ipAddress := c.ClientIP()
 
+	var req CreateOrderRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	accepted, err := h.accountService.CheckAcceptance(req.AcceptedDocuments)
+	if err != nil {
+		writeAcceptanceError(c, err)
+		return
+	}
+
+	// A VAT number given at checkout is checked before the tax is worked
+	// out; if VIES is down the order goes ahead with VAT charged
+	if req.VATNumber != nil && h.vatService != nil {
+		if _, err := h.vatService.SetCustomerVATNumber(c.Request.Context(), userID, *req.VATNumber, time.Now()); err != nil && err != vat.ErrVIESUnavailable {
+			writeVATError(c, err)
+			return
+		}
+	}
+
 	// Get user's cart
 	cart, err := h.cartService.GetOrCreateCart(&userID, "")
 	if err != nil {
@@ -112,12 +178,28 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	o, err := h.orderService.CreateOrder(userID, cart.ID, ipAddress)
+	o, err := h.orderService.CreateOrder(userID, cart.ID, accepted, req.CustomFields, ipAddress, c.GetHeader("User-Agent"))
 	if err != nil {
 		if err == order.ErrCartEmpty {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Cart is empty"})
 			return
 		}
+		if errors.Is(err, customfield.ErrFieldRequired) || errors.Is(err, customfield.ErrInvalidValue) || errors.Is(err, customfield.ErrUnknownField) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, address.ErrInvalidAddress) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err == address.ErrCountryNotSold || err == address.ErrCountryEmbargoed {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, order.ErrOutOfStock) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create order"})
 		return
 	}
@@ -142,7 +224,7 @@ func (h *OrderHandler) ListServices(c *gin.Context) {
 	limit, offset := PaginationParams(c)
 	status := domain.ServiceStatus(c.Query("status"))
 
-	services, total, err := h.orderService.ListServices(userID, status, limit, offset)
+	services, total, err := h.orderService.WithContext(c.Request.Context()).ListServices(userID, status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch services"})
 		return
@@ -225,6 +307,58 @@ func (h *OrderHandler) GetCart(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cart"})
 		return
 	}
+	// Guest carts follow the currency and country the visitor picked or
+	// was located in
+	if err := h.cartService.Locate(cart, cartLocation(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cart"})
+		return
+	}
+
+	summary, err := h.cartService.GetCartSummary(cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cart summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCartSummaryResponse(summary))
+}
+
+// SetCartCountry godoc
+// @Summary Set guest cart country
+// @Description Sets the country a guest cart's tax is estimated for. It wins over the country of the visitor's IP address. Customers pay the tax of their billing address.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param X-Session-ID header string true "Guest cart session"
+// @Param request body CartCountryRequest true "Country"
+// @Success 200 {object} CartSummaryResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/cart/country [put]
+func (h *OrderHandler) SetCartCountry(c *gin.Context) {
+	var req CartCountryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if GetCurrentUser(c) != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Customers pay the tax of their billing address"})
+		return
+	}
+	sessionID := c.GetHeader("X-Session-ID")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Session ID required for guest cart"})
+		return
+	}
+
+	cart, err := h.cartService.GetOrCreateCart(nil, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cart"})
+		return
+	}
+	if err := h.cartService.Locate(cart, order.CartLocation{Country: req.Country, CountrySource: order.SourceUser}); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set country"})
+		return
+	}
 
 	summary, err := h.cartService.GetCartSummary(cart.ID)
 	if err != nil {
@@ -235,6 +369,17 @@ func (h *OrderHandler) GetCart(c *gin.Context) {
 	c.JSON(http.StatusOK, toCartSummaryResponse(summary))
 }
 
+// cartLocation returns the currency and country detected for a visitor
+func cartLocation(c *gin.Context) order.CartLocation {
+	detected := web.Detect(c)
+	return order.CartLocation{
+		Currency:       detected.Currency,
+		CurrencySource: detected.CurrencySource,
+		Country:        detected.Country,
+		CountrySource:  detected.CountrySource,
+	}
+}
+
 // AddToCart godoc
 // @Summary Add item to cart
 // @Description Adds a product to the shopping cart
@@ -245,6 +390,7 @@ func (h *OrderHandler) GetCart(c *gin.Context) {
 // @Param request body AddToCartRequest true "Cart item data"
 // @Success 201 {object} CartItemResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /api/v1/cart/items [post]
 func (h *OrderHandler) AddToCart(c *gin.Context) {
 	var customerID *uint64
@@ -273,7 +419,7 @@ func (h *OrderHandler) AddToCart(c *gin.Context) {
 		return
 	}
 
-	item, err := h.cartService.AddItem(cart.ID, req.ProductID, req.Quantity, req.BillingCycle, req.Domain, req.Hostname, req.ConfigOptions)
+	item, err := h.cartService.AddItem(cart.ID, req.ProductID, req.Quantity, req.BillingCycle, req.Domain, req.Hostname, req.ConfigOptions, req.CustomFields)
 	if err != nil {
 		switch err {
 		case order.ErrPricingNotFound:
@@ -283,6 +429,10 @@ func (h *OrderHandler) AddToCart(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Billing cycle not available"})
 			return
 		}
+		if errors.Is(err, order.ErrOutOfStock) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -299,6 +449,84 @@ func (h *OrderHandler) AddToCart(c *gin.Context) {
 	})
 }
 
+// AddBundleToCart godoc
+// @Summary Add bundle to cart
+// @Description Adds the products of a bundle to the shopping cart at their bundle prices. The items are removed together.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AddBundleToCartRequest true "Bundle data"
+// @Success 201 {array} CartItemResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/cart/bundles [post]
+func (h *OrderHandler) AddBundleToCart(c *gin.Context) {
+	var customerID *uint64
+	sessionID := ""
+
+	user := GetCurrentUser(c)
+	if user != nil {
+		customerID = &user.ID
+	} else {
+		sessionID = c.GetHeader("X-Session-ID")
+		if sessionID == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Session ID required for guest cart"})
+			return
+		}
+	}
+
+	var req AddBundleToCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.GetOrCreateCart(customerID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cart"})
+		return
+	}
+
+	items, err := h.cartService.AddBundle(cart.ID, req.BundleID, req.BillingCycle, req.OptionalProductIDs)
+	if err != nil {
+		switch err {
+		case order.ErrBundleNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Bundle not found"})
+			return
+		case order.ErrPricingNotFound:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Pricing not configured for a product in this bundle"})
+			return
+		case order.ErrInvalidBillingCycle:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Billing cycle not available"})
+			return
+		}
+		if errors.Is(err, order.ErrOutOfStock) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := make([]CartItemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, CartItemResponse{
+			ID:           item.ID,
+			ProductID:    item.ProductID,
+			Quantity:     item.Quantity,
+			BillingCycle: item.BillingCycle,
+			SetupFee:     item.SetupFee.String(),
+			RecurringFee: item.RecurringFee.String(),
+			Discount:     item.Discount.String(),
+			Total:        item.Total.String(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
 // UpdateCartItem godoc
 // @Summary Update cart item
 // @Description Updates the quantity of a cart item
@@ -311,6 +539,7 @@ func (h *OrderHandler) AddToCart(c *gin.Context) {
 // @Success 200 {object} CartItemResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /api/v1/cart/items/{id} [put]
 func (h *OrderHandler) UpdateCartItem(c *gin.Context) {
 	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -331,6 +560,14 @@ func (h *OrderHandler) UpdateCartItem(c *gin.Context) {
 			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Cart item not found"})
 			return
 		}
+		if err == order.ErrBundleItem {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if errors.Is(err, order.ErrOutOfStock) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update cart item"})
 		return
 	}
@@ -497,7 +734,7 @@ func (h *OrderHandler) AdminListOrders(c *gin.Context) {
 	limit, offset := PaginationParams(c)
 	status := domain.OrderStatus(c.Query("status"))
 
-	orders, total, err := h.orderService.ListAllOrders(status, limit, offset)
+	orders, total, err := h.orderService.WithContext(c.Request.Context()).ListAllOrders(status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
 		return
@@ -538,6 +775,10 @@ func (h *OrderHandler) AdminUpdateOrderStatus(c *gin.Context) {
 	}
 
 	if err := h.orderService.UpdateOrderStatus(orderID, domain.OrderStatus(req.Status)); err != nil {
+		if err == order.ErrOrderNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update order status"})
 		return
 	}
@@ -607,12 +848,13 @@ func (h *OrderHandler) AdminUnsuspendService(c *gin.Context) {
 
 // AdminTerminateService godoc
 // @Summary Terminate service (Admin)
-// @Description Terminates a customer's service
+// @Description Terminates a customer's service. When the two-person rule covers terminations, answers 202 with an approval request instead and the service is terminated once a second admin approves.
 // @Tags admin/services
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Service ID"
 // @Success 200 {object} MessageResponse
+// @Success 202 {object} ApprovalPendingResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/v1/admin/services/{id}/terminate [post]
@@ -623,6 +865,20 @@ func (h *OrderHandler) AdminTerminateService(c *gin.Context) {
 		return
 	}
 
+	if h.approvals != nil && h.approvals.Required(approval.ActionTerminateService) {
+		service, err := h.orderService.GetService(serviceID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		summary := fmt.Sprintf("Terminate service #%d", service.ID)
+		if service.Domain != "" {
+			summary += " (" + service.Domain + ")"
+		}
+		holdForApproval(c, h.approvals, approval.ActionTerminateService, terminateServiceParams{ServiceID: service.ID}, summary)
+		return
+	}
+
 	if err := h.orderService.TerminateService(serviceID); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to terminate service"})
 		return
@@ -631,6 +887,122 @@ func (h *OrderHandler) AdminTerminateService(c *gin.Context) {
 	c.JSON(http.StatusOK, MessageResponse{Message: "Service terminated"})
 }
 
+// RevealServiceCredentials godoc
+// @Summary Reveal service password
+// @Description Returns the username and password of a service in plain text. Service details only show the password masked; every reveal is recorded in the audit log.
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} ServiceCredentialsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/credentials/reveal [post]
+func (h *OrderHandler) RevealServiceCredentials(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	s, err := h.orderService.GetService(serviceID)
+	user := GetCurrentUser(c)
+	if err == nil && s.CustomerID != user.ID && !user.IsAdmin() {
+		err = order.ErrServiceNotFound
+	}
+	if err != nil {
+		if errors.Is(err, order.ErrServiceNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch service"})
+		return
+	}
+
+	h.revealCredentials(c, serviceID, user.ID)
+}
+
+// AdminRevealServiceCredentials godoc
+// @Summary Reveal service password (Admin)
+// @Description Returns the username and password of a customer's service in plain text and records the reveal in the audit log
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} ServiceCredentialsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/credentials/reveal [post]
+func (h *OrderHandler) AdminRevealServiceCredentials(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	h.revealCredentials(c, serviceID, GetCurrentUserID(c))
+}
+
+func (h *OrderHandler) revealCredentials(c *gin.Context, serviceID, viewerID uint64) {
+	credentials, err := h.orderService.RevealCredentials(serviceID, viewerID, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		if errors.Is(err, order.ErrServiceNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reveal credentials"})
+		return
+	}
+
+	// Revealed credentials must not be kept by browsers or proxies
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, ServiceCredentialsResponse{Username: credentials.Username, Password: credentials.Password})
+}
+
+// AdminListCredentialReveals godoc
+// @Summary List service password reveals (Admin)
+// @Description Returns the audit log of who revealed the password of a service and from where, newest first
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param limit query int false "Items per page" default(20)
+// @Param page query int false "Page number" default(1)
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/credentials/reveals [get]
+func (h *OrderHandler) AdminListCredentialReveals(c *gin.Context) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+	limit, offset := PaginationParams(c)
+
+	entries, total, err := h.orderService.ListCredentialReveals(serviceID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch credential reveals"})
+		return
+	}
+
+	response := make([]CredentialRevealResponse, 0, len(entries))
+	for _, entry := range entries {
+		item := CredentialRevealResponse{
+			ID:        entry.ID,
+			UserID:    entry.UserID,
+			IPAddress: entry.IPAddress,
+			UserAgent: entry.UserAgent,
+			CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+		}
+		if entry.User != nil {
+			item.UserEmail = entry.User.Email
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
 // Helper functions
 
 func toOrderResponse(o *domain.Order) OrderResponse {
@@ -639,7 +1011,7 @@ func toOrderResponse(o *domain.Order) OrderResponse {
 		OrderNumber: o.OrderNumber,
 		Status:      string(o.Status),
 		Currency:    o.Currency,
-		Total:       o.Total.String(),
+		Total:       formatAmount(o.Total, o.Currency),
 		CreatedAt:   o.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
@@ -653,10 +1025,10 @@ func toOrderDetailResponse(o *domain.Order) OrderDetailResponse {
 			Description:  item.Description,
 			Quantity:     item.Quantity,
 			BillingCycle: item.BillingCycle,
-			SetupFee:     item.SetupFee.String(),
-			RecurringFee: item.RecurringFee.String(),
-			Discount:     item.Discount.String(),
-			Total:        item.Total.String(),
+			SetupFee:     formatAmount(item.SetupFee, o.Currency),
+			RecurringFee: formatAmount(item.RecurringFee, o.Currency),
+			Discount:     formatAmount(item.Discount, o.Currency),
+			Total:        formatAmount(item.Total, o.Currency),
 		})
 	}
 
@@ -665,17 +1037,17 @@ func toOrderDetailResponse(o *domain.Order) OrderDetailResponse {
 		OrderNumber: o.OrderNumber,
 		Status:      string(o.Status),
 		Currency:    o.Currency,
-		Subtotal:    o.Subtotal.String(),
-		Discount:    o.Discount.String(),
-		TaxAmount:   o.TaxAmount.String(),
-		Total:       o.Total.String(),
+		Subtotal:    formatAmount(o.Subtotal, o.Currency),
+		Discount:    formatAmount(o.Discount, o.Currency),
+		TaxAmount:   formatAmount(o.TaxAmount, o.Currency),
+		Total:       formatAmount(o.Total, o.Currency),
 		Items:       items,
 		CreatedAt:   o.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
 
 func toServiceResponse(s *domain.Service) ServiceResponse {
-	return ServiceResponse{
+	resp := ServiceResponse{
 		ID:              s.ID,
 		ProductID:       s.ProductID,
 		ProductName:     s.Product.Name,
@@ -684,9 +1056,14 @@ func toServiceResponse(s *domain.Service) ServiceResponse {
 		Hostname:        s.Hostname,
 		BillingCycle:    s.BillingCycle,
 		NextDueDate:     s.NextDueDate.Format("2006-01-02"),
-		RecurringAmount: s.RecurringAmount.String(),
+		RecurringAmount: formatAmount(s.RecurringAmount, s.Currency),
 		Currency:        s.Currency,
+		Test:            s.Test,
 	}
+	if s.IPAddress != nil {
+		resp.IPAddress = s.IPAddress.IP
+	}
+	return resp
 }
 
 func toServiceDetailResponse(s *domain.Service) ServiceDetailResponse {
@@ -698,12 +1075,14 @@ func toServiceDetailResponse(s *domain.Service) ServiceDetailResponse {
 		Domain:           s.Domain,
 		Hostname:         s.Hostname,
 		Username:         s.Username,
+		Password:         s.Password.Masked(),
 		BillingCycle:     s.BillingCycle,
 		Currency:         s.Currency,
-		RecurringAmount:  s.RecurringAmount.String(),
+		RecurringAmount:  formatAmount(s.RecurringAmount, s.Currency),
 		NextDueDate:      s.NextDueDate.Format("2006-01-02"),
 		RegistrationDate: s.RegistrationDate.Format("2006-01-02"),
 		Notes:            s.Notes,
+		Test:             s.Test,
 	}
 
 	if s.IPAddress != nil {
@@ -720,28 +1099,42 @@ func toServiceDetailResponse(s *domain.Service) ServiceDetailResponse {
 func toCartSummaryResponse(summary *order.CartSummary) CartSummaryResponse {
 	var items []CartItemSummaryResponse
 	for _, item := range summary.Items {
+		var savings []PriceSavingResponse
+		for _, saving := range item.Savings {
+			savings = append(savings, PriceSavingResponse{Label: saving.Label, Amount: formatAmount(saving.Amount, summary.Currency)})
+		}
 		items = append(items, CartItemSummaryResponse{
-			ID:           item.ID,
-			ProductID:    item.ProductID,
-			ProductName:  item.ProductName,
-			Quantity:     item.Quantity,
-			BillingCycle: item.BillingCycle,
-			SetupFee:     item.SetupFee.String(),
-			RecurringFee: item.RecurringFee.String(),
-			Discount:     item.Discount.String(),
-			Total:        item.Total.String(),
+			ID:            item.ID,
+			ProductID:     item.ProductID,
+			ProductName:   item.ProductName,
+			Quantity:      item.Quantity,
+			BillingCycle:  item.BillingCycle,
+			SetupFee:      formatAmount(item.SetupFee, summary.Currency),
+			RecurringFee:  formatAmount(item.RecurringFee, summary.Currency),
+			Discount:      formatAmount(item.Discount, summary.Currency),
+			PromoDiscount: formatAmount(item.PromoDiscount, summary.Currency),
+			Savings:       savings,
+			Total:         formatAmount(item.Total, summary.Currency),
+			BundleID:      item.BundleID,
+			BundleName:    item.BundleName,
+			BundleKey:     item.BundleKey,
 		})
 	}
 
 	return CartSummaryResponse{
-		CartID:        summary.CartID,
-		Currency:      summary.Currency,
-		Items:         items,
-		Subtotal:      summary.Subtotal.String(),
-		TotalDiscount: summary.TotalDiscount.String(),
-		Tax:           summary.Tax.String(),
-		Total:         summary.Total.String(),
-		CouponCode:    summary.CouponCode,
+		CartID:           summary.CartID,
+		Currency:         summary.Currency,
+		CurrencySource:   summary.CurrencySource,
+		TaxCountry:       summary.TaxCountry,
+		TaxCountrySource: summary.TaxCountrySource,
+		Items:            items,
+		Subtotal:         formatAmount(summary.Subtotal, summary.Currency),
+		TotalDiscount:    formatAmount(summary.TotalDiscount, summary.Currency),
+		TotalSavings:     formatAmount(summary.TotalSavings, summary.Currency),
+		Tax:              formatAmount(summary.Tax, summary.Currency),
+		TaxEstimated:     summary.TaxEstimated,
+		Total:            formatAmount(summary.Total, summary.Currency),
+		CouponCode:       summary.CouponCode,
 	}
 }
 
@@ -788,10 +1181,12 @@ type ServiceResponse struct {
 	Status          string `json:"status"`
 	Domain          string `json:"domain,omitempty"`
 	Hostname        string `json:"hostname,omitempty"`
+	IPAddress       string `json:"ip_address,omitempty"`
 	BillingCycle    string `json:"billing_cycle"`
 	NextDueDate     string `json:"next_due_date"`
 	RecurringAmount string `json:"recurring_amount"`
 	Currency        string `json:"currency"`
+	Test            bool   `json:"test,omitempty"` // Provisioned in test mode
 }
 
 type ServiceDetailResponse struct {
@@ -802,6 +1197,7 @@ type ServiceDetailResponse struct {
 	Domain           string `json:"domain,omitempty"`
 	Hostname         string `json:"hostname,omitempty"`
 	Username         string `json:"username,omitempty"`
+	Password         string `json:"password,omitempty"` // Masked, revealed through credentials/reveal
 	IPAddress        string `json:"ip_address,omitempty"`
 	BillingCycle     string `json:"billing_cycle"`
 	Currency         string `json:"currency"`
@@ -810,29 +1206,60 @@ type ServiceDetailResponse struct {
 	RegistrationDate string `json:"registration_date"`
 	SuspensionReason string `json:"suspension_reason,omitempty"`
 	Notes            string `json:"notes,omitempty"`
+	Test             bool   `json:"test,omitempty"` // Provisioned in test mode
+}
+
+type ServiceCredentialsResponse struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type CredentialRevealResponse struct {
+	ID        uint64  `json:"id"`
+	UserID    *uint64 `json:"user_id"`
+	UserEmail string  `json:"user_email,omitempty"`
+	IPAddress string  `json:"ip_address,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	CreatedAt string  `json:"created_at"`
 }
 
 type CartSummaryResponse struct {
-	CartID        uint64                    `json:"cart_id"`
-	Currency      string                    `json:"currency"`
-	Items         []CartItemSummaryResponse `json:"items"`
-	Subtotal      string                    `json:"subtotal"`
-	TotalDiscount string                    `json:"total_discount"`
-	Tax           string                    `json:"tax"`
-	Total         string                    `json:"total"`
-	CouponCode    string                    `json:"coupon_code,omitempty"`
+	CartID   uint64 `json:"cart_id"`
+	Currency string `json:"currency"`
+	// Where the currency and the country guests' tax is estimated for came
+	// from: user, profile, geoip or default
+	CurrencySource   string                    `json:"currency_source"`
+	TaxCountry       string                    `json:"tax_country,omitempty"`
+	TaxCountrySource string                    `json:"tax_country_source,omitempty"`
+	Items            []CartItemSummaryResponse `json:"items"`
+	Subtotal         string                    `json:"subtotal"`
+	TotalDiscount    string                    `json:"total_discount"`
+	TotalSavings     string                    `json:"total_savings"`
+	Tax              string                    `json:"tax"`
+	TaxEstimated     bool                      `json:"tax_estimated"`
+	Total            string                    `json:"total"`
+	CouponCode       string                    `json:"coupon_code,omitempty"`
+}
+
+type CartCountryRequest struct {
+	Country string `json:"country" binding:"required,len=2,alpha"` // ISO 3166-1 alpha-2
 }
 
 type CartItemSummaryResponse struct {
-	ID           uint64 `json:"id"`
-	ProductID    uint64 `json:"product_id"`
-	ProductName  string `json:"product_name"`
-	Quantity     int    `json:"quantity"`
-	BillingCycle string `json:"billing_cycle"`
-	SetupFee     string `json:"setup_fee"`
-	RecurringFee string `json:"recurring_fee"`
-	Discount     string `json:"discount"`
-	Total        string `json:"total"`
+	ID            uint64                `json:"id"`
+	ProductID     uint64                `json:"product_id"`
+	ProductName   string                `json:"product_name"`
+	Quantity      int                   `json:"quantity"`
+	BillingCycle  string                `json:"billing_cycle"`
+	SetupFee      string                `json:"setup_fee"`
+	RecurringFee  string                `json:"recurring_fee"`
+	Discount      string                `json:"discount"`
+	PromoDiscount string                `json:"promo_discount"`
+	Savings       []PriceSavingResponse `json:"savings,omitempty"`
+	Total         string                `json:"total"`
+	BundleID      *uint64               `json:"bundle_id,omitempty"`
+	BundleName    string                `json:"bundle_name,omitempty"`
+	BundleKey     string                `json:"bundle_key,omitempty"`
 }
 
 type CartItemResponse struct {
@@ -853,6 +1280,13 @@ type AddToCartRequest struct {
 	Domain        string         `json:"domain"`
 	Hostname      string         `json:"hostname"`
 	ConfigOptions domain.JSONMap `json:"config_options"`
+	CustomFields  map[string]string `json:"custom_fields"`
+}
+
+type AddBundleToCartRequest struct {
+	BundleID           uint64   `json:"bundle_id" binding:"required"`
+	BillingCycle       string   `json:"billing_cycle" binding:"required"`
+	OptionalProductIDs []uint64 `json:"optional_product_ids"`
 }
 
 type UpdateCartItemRequest struct {
@@ -863,6 +1297,12 @@ type ApplyCouponRequest struct {
 	Code string `json:"code" binding:"required"`
 }
 
+type CreateOrderRequest struct {
+	AcceptedDocuments []uint64          `json:"accepted_documents"`
+	CustomFields      map[string]string `json:"custom_fields"` // Order field values by field name
+	VATNumber         *string           `json:"vat_number"`    // Replaces the customer's VAT number, empty removes it
+}
+
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status" binding:"required"`
 }
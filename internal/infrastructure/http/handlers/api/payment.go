@@ -1,19 +1,23 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/approval"
 	"github.com/openhost/openhost/internal/core/service/payment"
 )
 
 // PaymentHandler handles payment API endpoints
 type PaymentHandler struct {
-	service *payment.Service
+	service   *payment.Service
+	approvals *approval.Service
 }
 
 // NewPaymentHandler creates a new payment handler
@@ -21,15 +25,43 @@ func NewPaymentHandler(service *payment.Service) *PaymentHandler {
 	return &PaymentHandler{service: service}
 }
 
+// SetApprovalService holds refunds for a second admin when the two-person
+// rule covers them. The refund is recorded as made by the admin who asked.
+func (h *PaymentHandler) SetApprovalService(approvals *approval.Service) {
+	h.approvals = approvals
+	approvals.Register(approval.ActionRefundPayment, func(request *domain.ApprovalRequest) (string, error) {
+		var params refundParams
+		if err := approval.DecodeParams(request, &params); err != nil {
+			return "", err
+		}
+		amount, err := decimal.NewFromString(params.Amount)
+		if err != nil {
+			return "", err
+		}
+		refund, err := h.service.ProcessRefund(params.TransactionID, amount, params.Reason, request.RequestedByID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Refund #%d of %s processed", refund.ID, amount.StringFixed(2)), nil
+	})
+}
+
+type refundParams struct {
+	TransactionID uint64 `json:"transaction_id"`
+	Amount        string `json:"amount"`
+	Reason        string `json:"reason"`
+}
+
 // ListGateways lists available payment gateways
 // @Summary List payment gateways
-// @Description Get a list of available payment gateways for the customer
+// @Description Get a list of available payment gateways for the customer. With a currency only the gateways taking payments in it are listed, such as those for the currency of the invoice being paid.
 // @Tags Payments
 // @Produce json
+// @Param currency query string false "Currency code"
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/payments/gateways [get]
 func (h *PaymentHandler) ListGateways(c *gin.Context) {
-	gateways, err := h.service.ListActiveGateways()
+	gateways, err := h.service.ListActiveGateways(strings.ToUpper(c.Query("currency")))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -71,6 +103,14 @@ func (h *PaymentHandler) CreatePaymentRequest(c *gin.Context) {
 		c.ClientIP(),
 	)
 	if err != nil {
+		if err == payment.ErrCurrencyNotSupported {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err == payment.ErrCustomerBanned {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -375,13 +415,14 @@ func (h *PaymentHandler) AdminAddCredit(c *gin.Context) {
 
 // AdminRefundPayment refunds a payment
 // @Summary Admin: Refund payment
-// @Description Refund a payment (admin only)
+// @Description Refund a payment (admin only). When the two-person rule covers refunds, answers 202 with an approval request instead and the refund is made once a second admin approves.
 // @Tags Admin Payments
 // @Accept json
 // @Produce json
 // @Param id path int true "Transaction ID"
 // @Param request body RefundRequest true "Refund request"
 // @Success 200 {object} map[string]interface{}
+// @Success 202 {object} ApprovalPendingResponse
 // @Router /api/v1/admin/payments/{id}/refund [post]
 func (h *PaymentHandler) AdminRefundPayment(c *gin.Context) {
 	adminID, _ := c.Get("admin_id")
@@ -399,6 +440,12 @@ func (h *PaymentHandler) AdminRefundPayment(c *gin.Context) {
 
 	amount := decimal.NewFromFloat(req.Amount)
 
+	params := refundParams{TransactionID: transactionID, Amount: amount.String(), Reason: req.Reason}
+	summary := fmt.Sprintf("Refund %s of transaction #%d", amount.StringFixed(2), transactionID)
+	if holdForApproval(c, h.approvals, approval.ActionRefundPayment, params, summary) {
+		return
+	}
+
 	refund, err := h.service.ProcessRefund(transactionID, amount, req.Reason, adminID.(uint64))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -411,6 +458,136 @@ func (h *PaymentHandler) AdminRefundPayment(c *gin.Context) {
 	})
 }
 
+// AdminSetGatewayFees sets the fees a gateway charges
+// @Summary Admin: Set gateway fees
+// @Description Set the percent and fixed fee charged by a gateway on each payment. They are recorded on payments whose processor reports no fee.
+// @Tags Admin Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Gateway ID"
+// @Param request body SetGatewayFeesRequest true "Gateway fees"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/payments/gateways/{id}/fees [put]
+func (h *PaymentHandler) AdminSetGatewayFees(c *gin.Context) {
+	gatewayID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gateway ID"})
+		return
+	}
+
+	var req SetGatewayFeesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gateway, err := h.service.SetGatewayFees(gatewayID, decimal.NewFromFloat(req.FeePercent), decimal.NewFromFloat(req.FeeFixed))
+	if err != nil {
+		switch err {
+		case payment.ErrGatewayNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case payment.ErrInvalidFee:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Gateway fees updated",
+		"gateway_id":  gateway.ID,
+		"fee_percent": gateway.FeePercent.String(),
+		"fee_fixed":   gateway.FeeFixed.String(),
+	})
+}
+
+// AdminSetGatewayCurrencies restricts the currencies a gateway takes
+// @Summary Admin: Set gateway currencies
+// @Description Set the currencies a gateway takes payments in, such as only CNY for Alipay. The gateway is not listed or usable for invoices in other currencies. An empty list lets it take any currency.
+// @Tags Admin Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Gateway ID"
+// @Param request body SetGatewayCurrenciesRequest true "Gateway currencies"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/payments/gateways/{id}/currencies [put]
+func (h *PaymentHandler) AdminSetGatewayCurrencies(c *gin.Context) {
+	gatewayID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gateway ID"})
+		return
+	}
+
+	var req SetGatewayCurrenciesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gateway, err := h.service.SetGatewayCurrencies(gatewayID, req.Currencies)
+	if err != nil {
+		switch err {
+		case payment.ErrGatewayNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case payment.ErrInvalidCurrency:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Gateway currencies updated",
+		"gateway_id": gateway.ID,
+		"currencies": gateway.Config.SupportedCurrencies,
+	})
+}
+
+// AdminSetGatewayTestMode turns test mode of a gateway on or off
+// @Summary Admin: Set gateway test mode
+// @Description Turn test mode of a gateway on or off. In test mode charges go to the sandbox with the sandbox credentials, never the live ones, and the payments, transactions and subscriptions made are flagged as tests and left out of reports. Sandbox credentials replace those stored when given. The test_mode setting of the configuration puts every gateway in test mode.
+// @Tags Admin Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Gateway ID"
+// @Param request body SetGatewayTestModeRequest true "Gateway test mode"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/payments/gateways/{id}/test-mode [put]
+func (h *PaymentHandler) AdminSetGatewayTestMode(c *gin.Context) {
+	gatewayID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gateway ID"})
+		return
+	}
+
+	var req SetGatewayTestModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gateway, err := h.service.SetGatewayTestMode(gatewayID, req.TestMode, req.Sandbox)
+	if err != nil {
+		switch err {
+		case payment.ErrGatewayNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Gateway test mode updated",
+		"gateway_id":   gateway.ID,
+		"test_mode":    gateway.TestMode,
+		"in_test_mode": h.service.TestMode(gateway),
+		"has_sandbox":  gateway.Config.Sandbox != nil,
+	})
+}
+
 // Request/Response types
 type CreatePaymentRequestBody struct {
 	InvoiceID uint64  `json:"invoice_id" binding:"required"`
@@ -452,3 +629,17 @@ type RefundRequest struct {
 	Amount float64 `json:"amount" binding:"required,gt=0"`
 	Reason string  `json:"reason"`
 }
+
+type SetGatewayFeesRequest struct {
+	FeePercent float64 `json:"fee_percent"`
+	FeeFixed   float64 `json:"fee_fixed"`
+}
+
+type SetGatewayCurrenciesRequest struct {
+	Currencies []string `json:"currencies"` // Empty takes any currency
+}
+
+type SetGatewayTestModeRequest struct {
+	TestMode bool                         `json:"test_mode"`
+	Sandbox  *domain.PaymentGatewayConfig `json:"sandbox"` // Sandbox credentials, kept when omitted
+}
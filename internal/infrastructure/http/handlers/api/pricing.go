@@ -0,0 +1,566 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/pricing"
+)
+
+// PricingHandler handles price revision and pricing tier endpoints
+type PricingHandler struct {
+	pricingService *pricing.Service
+}
+
+// NewPricingHandler creates a new pricing handler
+func NewPricingHandler(pricingService *pricing.Service) *PricingHandler {
+	return &PricingHandler{pricingService: pricingService}
+}
+
+// AdminStageRevision godoc
+// @Summary Stage price revision (Admin)
+// @Description Stages a percentage or fixed price change for the matching products with an effective date. Existing services are grandfathered or migrated at their next renewal.
+// @Tags admin/pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body StageRevisionRequest true "Price change"
+// @Success 201 {object} PriceRevisionDetailResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/revisions [post]
+func (h *PricingHandler) AdminStageRevision(c *gin.Context) {
+	var req StageRevisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	revisionReq := pricing.RevisionRequest{
+		Name:           req.Name,
+		Description:    req.Description,
+		ProductIDs:     req.ProductIDs,
+		ProductGroupID: req.ProductGroupID,
+		Currencies:     req.Currencies,
+		Cycles:         req.Cycles,
+		ServicePolicy:  req.ServicePolicy,
+	}
+	if req.Percent != "" {
+		percent, err := decimal.NewFromString(req.Percent)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid percent"})
+			return
+		}
+		revisionReq.Percent = percent
+	}
+	if req.Amount != "" {
+		amount, err := decimal.NewFromString(req.Amount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid amount"})
+			return
+		}
+		revisionReq.Amount = amount
+	}
+	if req.EffectiveAt != "" {
+		effectiveAt, err := time.Parse(time.RFC3339, req.EffectiveAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "effective_at must be an RFC 3339 timestamp"})
+			return
+		}
+		revisionReq.EffectiveAt = effectiveAt
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint64); ok {
+			revisionReq.CreatedBy = &id
+		}
+	}
+
+	revision, err := h.pricingService.StageRevision(revisionReq)
+	if err != nil {
+		switch err {
+		case pricing.ErrInvalidAdjustment, pricing.ErrInvalidPolicy, pricing.ErrInvalidCycle, pricing.ErrNoPrices:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to stage price revision"})
+		}
+		return
+	}
+
+	revision, err = h.pricingService.GetRevision(revision.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch price revision"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toPriceRevisionDetailResponse(revision))
+}
+
+// AdminListRevisions godoc
+// @Summary List price revisions (Admin)
+// @Description Returns price revisions, latest effective date first
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/pricing/revisions [get]
+func (h *PricingHandler) AdminListRevisions(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	status := domain.PriceRevisionStatus(c.Query("status"))
+
+	revisions, total, err := h.pricingService.ListRevisions(status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch price revisions"})
+		return
+	}
+
+	response := make([]PriceRevisionResponse, 0, len(revisions))
+	for i := range revisions {
+		response = append(response, toPriceRevisionResponse(&revisions[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetRevision godoc
+// @Summary Get price revision (Admin)
+// @Description Returns a price revision with the old and new price of every item
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Revision ID"
+// @Success 200 {object} PriceRevisionDetailResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/revisions/{id} [get]
+func (h *PricingHandler) AdminGetRevision(c *gin.Context) {
+	revisionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision ID"})
+		return
+	}
+
+	revision, err := h.pricingService.GetRevision(revisionID)
+	if err != nil {
+		if err == pricing.ErrRevisionNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Price revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch price revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toPriceRevisionDetailResponse(revision))
+}
+
+// AdminUpdateRevisionItem godoc
+// @Summary Override revision item price (Admin)
+// @Description Sets the new price of one item of a scheduled revision
+// @Tags admin/pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Revision ID"
+// @Param itemId path int true "Item ID"
+// @Param request body UpdateRevisionItemRequest true "New price"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/revisions/{id}/items/{itemId} [put]
+func (h *PricingHandler) AdminUpdateRevisionItem(c *gin.Context) {
+	revisionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision ID"})
+		return
+	}
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid item ID"})
+		return
+	}
+
+	var req UpdateRevisionItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	price, err := decimal.NewFromString(req.NewPrice)
+	if err != nil || price.IsNegative() {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid price"})
+		return
+	}
+
+	if err := h.pricingService.UpdateItemPrice(revisionID, itemID, price); err != nil {
+		switch err {
+		case pricing.ErrRevisionNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Price revision item not found"})
+		case pricing.ErrRevisionNotPending:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update price"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Price updated"})
+}
+
+// AdminCancelRevision godoc
+// @Summary Cancel price revision (Admin)
+// @Description Cancels a scheduled price revision
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Revision ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/revisions/{id}/cancel [post]
+func (h *PricingHandler) AdminCancelRevision(c *gin.Context) {
+	revisionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision ID"})
+		return
+	}
+
+	if err := h.pricingService.CancelRevision(revisionID); err != nil {
+		switch err {
+		case pricing.ErrRevisionNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Price revision not found"})
+		case pricing.ErrRevisionNotPending:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to cancel price revision"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Price revision cancelled"})
+}
+
+// AdminApplyDueRevisions godoc
+// @Summary Apply due price revisions (Admin)
+// @Description Applies every scheduled revision whose effective date has passed without waiting for the scheduler
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ApplyRevisionsResponse
+// @Router /api/v1/admin/pricing/revisions/apply [post]
+func (h *PricingHandler) AdminApplyDueRevisions(c *gin.Context) {
+	applied, err := h.pricingService.ApplyDueRevisions(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply price revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApplyRevisionsResponse{Applied: applied})
+}
+
+// AdminListTiers godoc
+// @Summary List pricing tiers (Admin)
+// @Description Returns the quantity breaks and term promotions of a product
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Param product_id query int true "Product ID"
+// @Success 200 {array} PricingTierResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/tiers [get]
+func (h *PricingHandler) AdminListTiers(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Query("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	tiers, err := h.pricingService.ListTiers(productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch pricing tiers"})
+		return
+	}
+
+	response := make([]PricingTierResponse, 0, len(tiers))
+	for i := range tiers {
+		response = append(response, toPricingTierResponse(&tiers[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateTier godoc
+// @Summary Create pricing tier (Admin)
+// @Description Adds a quantity break (type quantity) or a term length promotion (type term) to a product price. Term promotions with first_term_only only discount the first invoice.
+// @Tags admin/pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreatePricingTierRequest true "Pricing tier"
+// @Success 201 {object} PricingTierResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/tiers [post]
+func (h *PricingHandler) AdminCreateTier(c *gin.Context) {
+	var req CreatePricingTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	value, err := decimal.NewFromString(req.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid value"})
+		return
+	}
+	tier := &domain.PricingTier{
+		Type:          req.Type,
+		BillingCycle:  req.BillingCycle,
+		MinQuantity:   req.MinQuantity,
+		DiscountType:  req.DiscountType,
+		Value:         value,
+		FirstTermOnly: req.FirstTermOnly,
+		Label:         req.Label,
+	}
+	for field, raw := range map[string]string{"starts_at": req.StartsAt, "ends_at": req.EndsAt} {
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: field + " must be an RFC 3339 timestamp"})
+			return
+		}
+		if field == "starts_at" {
+			tier.StartsAt = &at
+		} else {
+			tier.EndsAt = &at
+		}
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	if err := h.pricingService.CreateTier(req.ProductID, currency, tier); err != nil {
+		switch err {
+		case pricing.ErrPricingNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case pricing.ErrInvalidTier, pricing.ErrInvalidCycle:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create pricing tier"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toPricingTierResponse(tier))
+}
+
+// AdminUpdateTier godoc
+// @Summary Enable or disable pricing tier (Admin)
+// @Tags admin/pricing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tier ID"
+// @Param request body UpdatePricingTierRequest true "Tier state"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/tiers/{id} [put]
+func (h *PricingHandler) AdminUpdateTier(c *gin.Context) {
+	tierID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid tier ID"})
+		return
+	}
+
+	var req UpdatePricingTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.pricingService.SetTierActive(tierID, req.Active); err != nil {
+		if err == pricing.ErrTierNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Pricing tier not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update pricing tier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Pricing tier updated"})
+}
+
+// AdminDeleteTier godoc
+// @Summary Delete pricing tier (Admin)
+// @Tags admin/pricing
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tier ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/pricing/tiers/{id} [delete]
+func (h *PricingHandler) AdminDeleteTier(c *gin.Context) {
+	tierID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid tier ID"})
+		return
+	}
+
+	if err := h.pricingService.DeleteTier(tierID); err != nil {
+		if err == pricing.ErrTierNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Pricing tier not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete pricing tier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Pricing tier deleted"})
+}
+
+func toPricingTierResponse(t *domain.PricingTier) PricingTierResponse {
+	resp := PricingTierResponse{
+		ID:               t.ID,
+		ProductPricingID: t.ProductPricingID,
+		Type:             t.Type,
+		BillingCycle:     t.BillingCycle,
+		MinQuantity:      t.MinQuantity,
+		DiscountType:     t.DiscountType,
+		Value:            t.Value.String(),
+		FirstTermOnly:    t.FirstTermOnly,
+		Label:            t.DisplayLabel(),
+		Active:           t.Active,
+	}
+	if t.StartsAt != nil {
+		resp.StartsAt = t.StartsAt.Format(time.RFC3339)
+	}
+	if t.EndsAt != nil {
+		resp.EndsAt = t.EndsAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func toPriceRevisionResponse(r *domain.PriceRevision) PriceRevisionResponse {
+	resp := PriceRevisionResponse{
+		ID:            r.ID,
+		Name:          r.Name,
+		Description:   r.Description,
+		Status:        string(r.Status),
+		ServicePolicy: r.ServicePolicy,
+		Percent:       r.Percent.String(),
+		Amount:        r.Amount.String(),
+		EffectiveAt:   r.EffectiveAt.Format(time.RFC3339),
+		CreatedAt:     r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.AppliedAt != nil {
+		resp.AppliedAt = r.AppliedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func toPriceRevisionDetailResponse(r *domain.PriceRevision) PriceRevisionDetailResponse {
+	resp := PriceRevisionDetailResponse{PriceRevisionResponse: toPriceRevisionResponse(r)}
+	for _, item := range r.Items {
+		resp.Items = append(resp.Items, PriceRevisionItemResponse{
+			ID:          item.ID,
+			ProductID:   item.ProductID,
+			ProductName: item.Product.Name,
+			Currency:    item.Currency,
+			Cycle:       item.Cycle,
+			OldPrice:    formatAmount(item.OldPrice, item.Currency),
+			NewPrice:    formatAmount(item.NewPrice, item.Currency),
+		})
+	}
+	return resp
+}
+
+// Request/Response types
+
+type StageRevisionRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Description    string   `json:"description"`
+	ProductIDs     []uint64 `json:"product_ids"`
+	ProductGroupID uint64   `json:"product_group_id"`
+	Currencies     []string `json:"currencies"`
+	Cycles         []string `json:"cycles"`
+	Percent        string   `json:"percent"`
+	Amount         string   `json:"amount"`
+	EffectiveAt    string   `json:"effective_at"`
+	ServicePolicy  string   `json:"service_policy"`
+}
+
+type UpdateRevisionItemRequest struct {
+	NewPrice string `json:"new_price" binding:"required"`
+}
+
+type PriceRevisionResponse struct {
+	ID            uint64 `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Status        string `json:"status"`
+	ServicePolicy string `json:"service_policy"`
+	Percent       string `json:"percent"`
+	Amount        string `json:"amount"`
+	EffectiveAt   string `json:"effective_at"`
+	AppliedAt     string `json:"applied_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type PriceRevisionDetailResponse struct {
+	PriceRevisionResponse
+	Items []PriceRevisionItemResponse `json:"items"`
+}
+
+type PriceRevisionItemResponse struct {
+	ID          uint64 `json:"id"`
+	ProductID   uint64 `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Currency    string `json:"currency"`
+	Cycle       string `json:"cycle"`
+	OldPrice    string `json:"old_price"`
+	NewPrice    string `json:"new_price"`
+}
+
+type ApplyRevisionsResponse struct {
+	Applied int `json:"applied"`
+}
+
+type CreatePricingTierRequest struct {
+	ProductID     uint64 `json:"product_id" binding:"required"`
+	Currency      string `json:"currency"`
+	Type          string `json:"type" binding:"required"`
+	BillingCycle  string `json:"billing_cycle"`
+	MinQuantity   int    `json:"min_quantity"`
+	DiscountType  string `json:"discount_type"`
+	Value         string `json:"value" binding:"required"`
+	FirstTermOnly bool   `json:"first_term_only"`
+	Label         string `json:"label"`
+	StartsAt      string `json:"starts_at"`
+	EndsAt        string `json:"ends_at"`
+}
+
+type UpdatePricingTierRequest struct {
+	Active bool `json:"active"`
+}
+
+type PricingTierResponse struct {
+	ID               uint64 `json:"id"`
+	ProductPricingID uint64 `json:"product_pricing_id"`
+	Type             string `json:"type"`
+	BillingCycle     string `json:"billing_cycle,omitempty"`
+	MinQuantity      int    `json:"min_quantity"`
+	DiscountType     string `json:"discount_type"`
+	Value            string `json:"value"`
+	FirstTermOnly    bool   `json:"first_term_only"`
+	Label            string `json:"label"`
+	StartsAt         string `json:"starts_at,omitempty"`
+	EndsAt           string `json:"ends_at,omitempty"`
+	Active           bool   `json:"active"`
+}
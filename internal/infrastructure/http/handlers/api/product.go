@@ -72,11 +72,20 @@ func (h *ProductHandler) GetProductGroup(c *gin.Context) {
 		return
 	}
 
+	customerID := GetCurrentUserID(c)
 	var products []ProductResponse
 	for _, p := range group.Products {
 		if !p.Active {
 			continue
 		}
+		visible, err := h.productService.IsVisible(customerID, &p)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch product group"})
+			return
+		}
+		if !visible {
+			continue
+		}
 		products = append(products, ProductResponse{
 			ID:          p.ID,
 			Name:        p.Name,
@@ -97,7 +106,7 @@ func (h *ProductHandler) GetProductGroup(c *gin.Context) {
 
 // ListProducts godoc
 // @Summary List products
-// @Description Returns products with optional filtering
+// @Description Returns products with optional filtering. Restricted products are only listed to customers in groups with prices for them.
 // @Tags products
 // @Produce json
 // @Param group query int false "Filter by group ID"
@@ -117,7 +126,7 @@ func (h *ProductHandler) ListProducts(c *gin.Context) {
 		}
 	}
 
-	products, total, err := h.productService.ListProducts(groupID, activeOnly, limit, offset)
+	products, total, err := h.productService.ListCatalog(GetCurrentUserID(c), groupID, activeOnly, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch products"})
 		return
@@ -157,6 +166,15 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch product"})
 		return
 	}
+	visible, err := h.productService.IsVisible(GetCurrentUserID(c), p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch product"})
+		return
+	}
+	if !visible {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+		return
+	}
 
 	var configGroups []ConfigGroupResponse
 	for _, cg := range p.ConfigGroups {
@@ -164,9 +182,10 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		for _, opt := range cg.Options {
 			var subOptions []ConfigSubOptionResponse
 			for _, sub := range opt.SubOptions {
-				subOptions = append(subOptions, ConfigSubOptionResponse{
-					ID:   sub.ID,
-					Name: sub.Name,
+				resp := ConfigSubOptionResponse{
+					ID:        sub.ID,
+					Name:      sub.Name,
+					Available: !sub.SoldOut,
 					Pricing: PricingResponse{
 						SetupFee:    sub.Pricing.SetupFee.String(),
 						Monthly:     sub.Pricing.Monthly.String(),
@@ -174,7 +193,11 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 						Yearly:      sub.Pricing.Yearly.String(),
 						Triennially: sub.Pricing.Triennially.String(),
 					},
-				})
+				}
+				if sub.SoldOut {
+					resp.OutOfStockMessage = sub.OutOfStockMsg
+				}
+				subOptions = append(subOptions, resp)
 			}
 			options = append(options, ConfigOptionResponse{
 				ID:         opt.ID,
@@ -204,7 +227,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 
 // GetProductPricing godoc
 // @Summary Calculate product pricing
-// @Description Calculates pricing for a product with selected options
+// @Description Calculates pricing for a product with selected options. The prices of the signed-in customer's groups replace the product prices.
 // @Tags products
 // @Accept json
 // @Produce json
@@ -227,7 +250,7 @@ func (h *ProductHandler) GetProductPricing(c *gin.Context) {
 		return
 	}
 
-	result, err := h.productService.GetProductPricing(productID, req.BillingCycle, req.SelectedOptions)
+	result, err := h.productService.GetProductPricing(productID, req.BillingCycle, req.SelectedOptions, req.Quantity, req.Currency, GetCurrentUserID(c))
 	if err != nil {
 		if err == product.ErrProductNotFound {
 			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
@@ -237,13 +260,22 @@ func (h *ProductHandler) GetProductPricing(c *gin.Context) {
 		return
 	}
 
+	savings := make([]PriceSavingResponse, 0, len(result.Savings))
+	for _, saving := range result.Savings {
+		savings = append(savings, PriceSavingResponse{Label: saving.Label, Amount: formatAmount(saving.Amount, result.Currency)})
+	}
+
 	c.JSON(http.StatusOK, PricingCalculationResponse{
-		ProductID:    result.ProductID,
-		ProductName:  result.ProductName,
-		BillingCycle: result.BillingCycle,
-		SetupFee:     result.SetupFee.String(),
-		RecurringFee: result.RecurringFee.String(),
-		Total:        result.Total.String(),
+		ProductID:         result.ProductID,
+		ProductName:       result.ProductName,
+		BillingCycle:      result.BillingCycle,
+		Quantity:          result.Quantity,
+		Currency:          result.Currency,
+		SetupFee:          formatAmount(result.SetupFee, result.Currency),
+		RecurringFee:      formatAmount(result.RecurringFee, result.Currency),
+		FirstTermDiscount: formatAmount(result.FirstTermDiscount, result.Currency),
+		Total:             formatAmount(result.Total, result.Currency),
+		Savings:           savings,
 	})
 }
 
@@ -388,6 +420,89 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, MessageResponse{Message: "Product deleted successfully"})
 }
 
+// AdminSetSubOptionStock godoc
+// @Summary Set config sub-option stock (Admin)
+// @Description Enables or disables stock control of a config sub-option and sets the units in stock. Carts reserve stock until they expire and orders take it when completed.
+// @Tags admin/products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Sub-option ID"
+// @Param request body SubOptionStockRequest true "Stock settings"
+// @Success 200 {object} SubOptionStockResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/config-sub-options/{id}/stock [put]
+func (h *ProductHandler) AdminSetSubOptionStock(c *gin.Context) {
+	subOptionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid sub-option ID"})
+		return
+	}
+
+	var req SubOptionStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sub, err := h.productService.SetSubOptionStock(subOptionID, req.StockControl, req.StockQuantity, req.OutOfStockMsg)
+	if err != nil {
+		if err == product.ErrSubOptionNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Sub-option not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SubOptionStockResponse{
+		ID:            sub.ID,
+		Name:          sub.Name,
+		StockControl:  sub.StockControl,
+		StockQuantity: sub.StockQuantity,
+		OutOfStockMsg: sub.OutOfStockMsg,
+	})
+}
+
+// AdminSetProductRestricted godoc
+// @Summary Restrict product to customer groups (Admin)
+// @Description Sets whether a product is only listed to and orderable by customers in groups with prices for it
+// @Tags admin/products
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param request body ProductRestrictedRequest true "Restriction"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/restricted [put]
+func (h *ProductHandler) AdminSetProductRestricted(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	var req ProductRestrictedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.productService.SetRestricted(productID, req.Restricted); err != nil {
+		if err == product.ErrProductNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Product updated successfully"})
+}
+
 // Response types
 
 type ProductGroupResponse struct {
@@ -439,9 +554,29 @@ type ConfigOptionResponse struct {
 }
 
 type ConfigSubOptionResponse struct {
-	ID      uint64          `json:"id"`
-	Name    string          `json:"name"`
-	Pricing PricingResponse `json:"pricing"`
+	ID                uint64          `json:"id"`
+	Name              string          `json:"name"`
+	Pricing           PricingResponse `json:"pricing"`
+	Available         bool            `json:"available"`
+	OutOfStockMessage string          `json:"out_of_stock_message,omitempty"`
+}
+
+type SubOptionStockRequest struct {
+	StockControl  bool   `json:"stock_control"`
+	StockQuantity int    `json:"stock_quantity" binding:"min=0"`
+	OutOfStockMsg string `json:"out_of_stock_message"`
+}
+
+type ProductRestrictedRequest struct {
+	Restricted bool `json:"restricted"`
+}
+
+type SubOptionStockResponse struct {
+	ID            uint64 `json:"id"`
+	Name          string `json:"name"`
+	StockControl  bool   `json:"stock_control"`
+	StockQuantity int    `json:"stock_quantity"`
+	OutOfStockMsg string `json:"out_of_stock_message,omitempty"`
 }
 
 type PricingResponse struct {
@@ -455,15 +590,26 @@ type PricingResponse struct {
 type PricingCalculationRequest struct {
 	BillingCycle    string            `json:"billing_cycle" binding:"required"`
 	SelectedOptions map[uint64]uint64 `json:"selected_options"`
+	Quantity        int               `json:"quantity"`
+	Currency        string            `json:"currency"` // The currency the customer is billed in when empty
 }
 
 type PricingCalculationResponse struct {
-	ProductID    uint64 `json:"product_id"`
-	ProductName  string `json:"product_name"`
-	BillingCycle string `json:"billing_cycle"`
-	SetupFee     string `json:"setup_fee"`
-	RecurringFee string `json:"recurring_fee"`
-	Total        string `json:"total"`
+	ProductID         uint64                `json:"product_id"`
+	ProductName       string                `json:"product_name"`
+	BillingCycle      string                `json:"billing_cycle"`
+	Quantity          int                   `json:"quantity"`
+	Currency          string                `json:"currency"`
+	SetupFee          string                `json:"setup_fee"`
+	RecurringFee      string                `json:"recurring_fee"`
+	FirstTermDiscount string                `json:"first_term_discount"`
+	Total             string                `json:"total"`
+	Savings           []PriceSavingResponse `json:"savings"`
+}
+
+type PriceSavingResponse struct {
+	Label  string `json:"label"`
+	Amount string `json:"amount"`
 }
 
 type CreateProductGroupRequest struct {
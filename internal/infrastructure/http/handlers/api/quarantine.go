@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/quarantine"
+)
+
+// QuarantineHandler handles the uploads the malware scanner rejected
+type QuarantineHandler struct {
+	quarantineService *quarantine.Service
+}
+
+// NewQuarantineHandler creates a new quarantine handler
+func NewQuarantineHandler(quarantineService *quarantine.Service) *QuarantineHandler {
+	return &QuarantineHandler{quarantineService: quarantineService}
+}
+
+// AdminListFiles godoc
+// @Summary Admin: List quarantined files
+// @Description Returns the uploads rejected by the malware scanner, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param source query string false "Upload source" Enums(ticket, kb, download, service)
+// @Param page query int false "Page number"
+// @Param limit query int false "Limit"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/quarantine [get]
+func (h *QuarantineHandler) AdminListFiles(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	files, total, err := h.quarantineService.ListFiles(c.Query("source"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch quarantined files"})
+		return
+	}
+
+	response := make([]QuarantinedFileResponse, 0, len(files))
+	for i := range files {
+		response = append(response, toQuarantinedFileResponse(&files[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetFile godoc
+// @Summary Admin: Get quarantined file
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Quarantined file ID"
+// @Success 200 {object} QuarantinedFileResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/quarantine/{id} [get]
+func (h *QuarantineHandler) AdminGetFile(c *gin.Context) {
+	file, ok := h.file(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toQuarantinedFileResponse(file))
+}
+
+// AdminDownloadFile godoc
+// @Summary Admin: Download quarantined file
+// @Description Redirects to a short-lived signed URL of the infected file, for analysis. Handle with care.
+// @Tags admin
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Quarantined file ID"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/quarantine/{id}/download [get]
+func (h *QuarantineHandler) AdminDownloadFile(c *gin.Context) {
+	file, ok := h.file(c)
+	if !ok {
+		return
+	}
+	url, err := h.quarantineService.FileURL(file, fileURLExpiry)
+	if err != nil {
+		if errors.Is(err, quarantine.ErrNoFileStore) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "The file was not kept"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to sign file URL"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+// AdminDeleteFile godoc
+// @Summary Admin: Delete quarantined file
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Quarantined file ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/quarantine/{id} [delete]
+func (h *QuarantineHandler) AdminDeleteFile(c *gin.Context) {
+	file, ok := h.file(c)
+	if !ok {
+		return
+	}
+	if err := h.quarantineService.DeleteFile(file); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete file"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "File deleted"})
+}
+
+func (h *QuarantineHandler) file(c *gin.Context) (*domain.QuarantinedFile, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid file ID"})
+		return nil, false
+	}
+	file, err := h.quarantineService.GetFile(id)
+	if err != nil {
+		if errors.Is(err, quarantine.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch file"})
+		return nil, false
+	}
+	return file, true
+}
+
+// Request/Response types
+
+type QuarantinedFileResponse struct {
+	ID          uint64 `json:"id"`
+	Source      string `json:"source"`
+	SourceID    uint64 `json:"source_id,omitempty"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	ContentType string `json:"content_type"`
+	Threat      string `json:"threat"`
+	UploadedBy  string `json:"uploaded_by,omitempty"`
+	Stored      bool   `json:"stored"` // Whether the file can be downloaded for analysis
+	CreatedAt   string `json:"created_at"`
+}
+
+func toQuarantinedFileResponse(file *domain.QuarantinedFile) QuarantinedFileResponse {
+	response := QuarantinedFileResponse{
+		ID:          file.ID,
+		Source:      file.Source,
+		SourceID:    file.SourceID,
+		FileName:    file.FileName,
+		FileSize:    file.FileSize,
+		ContentType: file.ContentType,
+		Threat:      file.Threat,
+		Stored:      file.StorageKey != "",
+		CreatedAt:   file.CreatedAt.Format(time.RFC3339),
+	}
+	if file.Uploader != nil {
+		response.UploadedBy = file.Uploader.Email
+	}
+	return response
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/recognition"
+)
+
+// RecognitionHandler serves the revenue recognition report to admins
+type RecognitionHandler struct {
+	recognitionService *recognition.Service
+}
+
+// NewRecognitionHandler creates a new revenue recognition handler
+func NewRecognitionHandler(recognitionService *recognition.Service) *RecognitionHandler {
+	return &RecognitionHandler{recognitionService: recognitionService}
+}
+
+// AdminRevenueReport godoc
+// @Summary Admin: Revenue recognition report
+// @Description Returns per month and currency the revenue billed, the revenue recognized as the service was provided, and the deferred revenue still to be recognized at the end of the month. The last 12 months by default.
+// @Tags admin/reports
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First month, YYYY-MM"
+// @Param to query string false "Last month, YYYY-MM"
+// @Param currency query string false "Currency code"
+// @Success 200 {array} RevenueMonthResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/reports/revenue [get]
+func (h *RecognitionHandler) AdminRevenueReport(c *gin.Context) {
+	now := time.Now().UTC()
+	to := now
+	from := now.AddDate(0, -11, 0)
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse("2006-01", value); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must be a month like 2024-01"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse("2006-01", value); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "to must be a month like 2024-12"})
+			return
+		}
+	}
+
+	months, err := h.recognitionService.Report(from, to, strings.ToUpper(c.Query("currency")))
+	if err != nil {
+		if errors.Is(err, recognition.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build revenue report"})
+		return
+	}
+
+	response := make([]RevenueMonthResponse, 0, len(months))
+	for _, month := range months {
+		response = append(response, RevenueMonthResponse{
+			Month:      month.Month.Format("2006-01"),
+			Currency:   month.Currency,
+			Billed:     month.Billed.StringFixed(2),
+			Recognized: month.Recognized.StringFixed(2),
+			Deferred:   month.Deferred.StringFixed(2),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Request/Response types
+
+type RevenueMonthResponse struct {
+	Month      string `json:"month"`
+	Currency   string `json:"currency"`
+	Billed     string `json:"billed"`     // Paid in the month
+	Recognized string `json:"recognized"` // Earned in the month
+	Deferred   string `json:"deferred"`   // Paid and not yet earned at the end of the month
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/service/report"
+)
+
+// ReportHandler serves the finance reports to admins
+type ReportHandler struct {
+	reportService *report.Service
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler(reportService *report.Service) *ReportHandler {
+	return &ReportHandler{reportService: reportService}
+}
+
+// AdminTaxReport godoc
+// @Summary Admin: Sales tax report
+// @Description Totals the tax charged per jurisdiction, rate and currency for a period. The period is a quarter, such as 2024-Q3, or from and to dates; the current quarter by default. format=csv downloads the rows, format=oss downloads the EU One-Stop Shop return for a business in home_country.
+// @Tags admin/reports
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param quarter query string false "Quarter, e.g. 2024-Q3"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param basis query string false "paid (default) or invoiced"
+// @Param format query string false "json (default), csv or oss"
+// @Param home_country query string false "EU member state of the business, for format=oss"
+// @Success 200 {object} TaxReportResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/reports/tax [get]
+func (h *ReportHandler) AdminTaxReport(c *gin.Context) {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.reportService.Tax(report.TaxQuery{From: from, To: to, Basis: c.Query("basis")})
+	if err != nil {
+		if errors.Is(err, report.ErrInvalidBasis) || errors.Is(err, report.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build tax report"})
+		return
+	}
+
+	name := fmt.Sprintf("tax-%s-%s", from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+	var buf bytes.Buffer
+	switch c.Query("format") {
+	case "csv":
+		if err := report.WriteTaxReportCSV(&buf, result); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export tax report"})
+			return
+		}
+	case "oss":
+		rows, err := report.OSSRows(result, c.Query("home_country"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err := report.WriteOSSCSV(&buf, rows, from, to); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export tax report"})
+			return
+		}
+		name = "oss-" + name
+	default:
+		c.JSON(http.StatusOK, toTaxReportResponse(result))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// AdminGatewayReport godoc
+// @Summary Admin: Gateway profitability report
+// @Description Compares payments, refunds, gateway fees and net revenue per gateway and per product for a period. The period is a quarter, such as 2024-Q3, or from and to dates; the current quarter by default. Payments are shared by the products of the invoice they paid in proportion to the item totals.
+// @Tags admin/reports
+// @Produce json
+// @Security BearerAuth
+// @Param quarter query string false "Quarter, e.g. 2024-Q3"
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Success 200 {object} ProfitabilityResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/reports/gateways [get]
+func (h *ReportHandler) AdminGatewayReport(c *gin.Context) {
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.reportService.Profitability(from, to)
+	if err != nil {
+		if errors.Is(err, report.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build gateway report"})
+		return
+	}
+
+	resp := ProfitabilityResponse{
+		From:     result.From.Format("2006-01-02"),
+		To:       result.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Gateways: make([]GatewayProfitResponse, 0, len(result.Gateways)),
+		Products: make([]ProductProfitResponse, 0, len(result.Products)),
+	}
+	for _, g := range result.Gateways {
+		feeRate := "0"
+		if g.Gross.IsPositive() {
+			feeRate = g.Fees.Div(g.Gross).Mul(decimal.NewFromInt(100)).StringFixed(2)
+		}
+		resp.Gateways = append(resp.Gateways, GatewayProfitResponse{
+			Gateway:        g.Gateway,
+			Currency:       g.Currency,
+			Payments:       g.Payments,
+			Gross:          g.Gross.StringFixed(2),
+			Refunds:        g.Refunds.StringFixed(2),
+			Fees:           g.Fees.StringFixed(2),
+			CalculatedFees: g.CalculatedFee.StringFixed(2),
+			FeeRate:        feeRate,
+			Net:            g.Net.StringFixed(2),
+		})
+	}
+	for _, p := range result.Products {
+		resp.Products = append(resp.Products, ProductProfitResponse{
+			ProductID: p.ProductID,
+			Product:   p.Product,
+			Currency:  p.Currency,
+			Gross:     p.Gross.StringFixed(2),
+			Refunds:   p.Refunds.StringFixed(2),
+			Fees:      p.Fees.StringFixed(2),
+			Net:       p.Net.StringFixed(2),
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AdminAgingReport godoc
+// @Summary Admin: Accounts receivable aging report
+// @Description Totals the balances of unpaid and overdue invoices per customer and currency by days past due: current, 1-30, 31-60, 61-90 and over 90. Each row shows the balance under an active promise to pay, the earliest promised day and how many promises the customer has broken. format=csv downloads the rows.
+// @Tags admin/reports
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} AgingReportResponse
+// @Router /api/v1/admin/reports/aging [get]
+func (h *ReportHandler) AdminAgingReport(c *gin.Context) {
+	result, err := h.reportService.Aging(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build aging report"})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		if err := report.WriteAgingCSV(&buf, result); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export aging report"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "aging-"+result.AsOf.Format("20060102")+".csv"))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+
+	resp := AgingReportResponse{
+		AsOf:   result.AsOf.Format(time.RFC3339),
+		Rows:   make([]AgingRowResponse, 0, len(result.Rows)),
+		Totals: make([]AgingRowResponse, 0, len(result.Totals)),
+	}
+	for _, row := range result.Rows {
+		resp.Rows = append(resp.Rows, toAgingRowResponse(row))
+	}
+	for _, total := range result.Totals {
+		resp.Totals = append(resp.Totals, toAgingRowResponse(total))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// reportPeriod reads the quarter or from and to dates of a report
+// request. The returned end is exclusive.
+func reportPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	if quarter := c.Query("quarter"); quarter != "" {
+		return report.QuarterPeriod(quarter)
+	}
+	if c.Query("from") == "" && c.Query("to") == "" {
+		now := time.Now().UTC()
+		return report.QuarterPeriod(fmt.Sprintf("%d-Q%d", now.Year(), (int(now.Month())-1)/3+1))
+	}
+
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be a date like 2024-01-31")
+	}
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be a date like 2024-01-31")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+func toTaxReportResponse(r *report.TaxReport) TaxReportResponse {
+	resp := TaxReportResponse{
+		From:       r.From.Format("2006-01-02"),
+		To:         r.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Basis:      r.Basis,
+		Rows:       make([]TaxReportRowResponse, 0, len(r.Rows)),
+		Totals:     make([]TaxTotalResponse, 0, len(r.Totals)),
+		Unrecorded: make([]TaxTotalResponse, 0, len(r.Unrecorded)),
+	}
+	for _, row := range r.Rows {
+		resp.Rows = append(resp.Rows, TaxReportRowResponse{
+			Country:       row.Country,
+			State:         row.State,
+			TaxType:       row.TaxType,
+			Rate:          row.Rate.String(),
+			Currency:      row.Currency,
+			Invoices:      row.Invoices,
+			TaxableAmount: row.TaxableAmount.StringFixed(2),
+			TaxAmount:     row.TaxAmount.StringFixed(2),
+		})
+	}
+	for _, total := range r.Totals {
+		resp.Totals = append(resp.Totals, toTaxTotalResponse(total))
+	}
+	for _, total := range r.Unrecorded {
+		resp.Unrecorded = append(resp.Unrecorded, toTaxTotalResponse(total))
+	}
+	return resp
+}
+
+func toTaxTotalResponse(t report.TaxTotal) TaxTotalResponse {
+	return TaxTotalResponse{
+		Currency:      t.Currency,
+		Invoices:      t.Invoices,
+		TaxableAmount: t.TaxableAmount.StringFixed(2),
+		TaxAmount:     t.TaxAmount.StringFixed(2),
+	}
+}
+
+func toAgingRowResponse(r report.AgingRow) AgingRowResponse {
+	resp := AgingRowResponse{
+		CustomerID:     r.CustomerID,
+		Customer:       r.Customer,
+		Currency:       r.Currency,
+		Current:        r.Current.StringFixed(2),
+		Days1To30:      r.Days1To30.StringFixed(2),
+		Days31To60:     r.Days31To60.StringFixed(2),
+		Days61To90:     r.Days61To90.StringFixed(2),
+		Over90:         r.Over90.StringFixed(2),
+		Total:          r.Total.StringFixed(2),
+		Promised:       r.Promised.StringFixed(2),
+		BrokenPromises: r.BrokenPromises,
+	}
+	if r.PromisedDate != nil {
+		date := r.PromisedDate.Format("2006-01-02")
+		resp.PromisedDate = &date
+	}
+	return resp
+}
+
+// Request/Response types
+
+type TaxReportResponse struct {
+	From       string                 `json:"from"`
+	To         string                 `json:"to"` // Last day of the period
+	Basis      string                 `json:"basis"`
+	Rows       []TaxReportRowResponse `json:"rows"`
+	Totals     []TaxTotalResponse     `json:"totals"`
+	Unrecorded []TaxTotalResponse     `json:"unrecorded"` // Taxed invoices from before tax lines were recorded
+}
+
+type TaxReportRowResponse struct {
+	Country       string `json:"country"`
+	State         string `json:"state"`
+	TaxType       string `json:"tax_type"`
+	Rate          string `json:"rate"`
+	Currency      string `json:"currency"`
+	Invoices      int64  `json:"invoices"`
+	TaxableAmount string `json:"taxable_amount"`
+	TaxAmount     string `json:"tax_amount"`
+}
+
+type TaxTotalResponse struct {
+	Currency      string `json:"currency"`
+	Invoices      int64  `json:"invoices"`
+	TaxableAmount string `json:"taxable_amount"`
+	TaxAmount     string `json:"tax_amount"`
+}
+
+type ProfitabilityResponse struct {
+	From     string                  `json:"from"`
+	To       string                  `json:"to"` // Last day of the period
+	Gateways []GatewayProfitResponse `json:"gateways"`
+	Products []ProductProfitResponse `json:"products"`
+}
+
+type GatewayProfitResponse struct {
+	Gateway        string `json:"gateway"`
+	Currency       string `json:"currency"`
+	Payments       int64  `json:"payments"`
+	Gross          string `json:"gross"`
+	Refunds        string `json:"refunds"`
+	Fees           string `json:"fees"`
+	CalculatedFees string `json:"calculated_fees"` // Fees from the gateway fee settings
+	FeeRate        string `json:"fee_rate"`        // Fees as a percent of gross
+	Net            string `json:"net"`
+}
+
+type ProductProfitResponse struct {
+	ProductID uint64 `json:"product_id"` // Zero for items of no product
+	Product   string `json:"product"`
+	Currency  string `json:"currency"`
+	Gross     string `json:"gross"`
+	Refunds   string `json:"refunds"`
+	Fees      string `json:"fees"`
+	Net       string `json:"net"`
+}
+
+type AgingReportResponse struct {
+	AsOf   string             `json:"as_of"`
+	Rows   []AgingRowResponse `json:"rows"`
+	Totals []AgingRowResponse `json:"totals"` // Per currency
+}
+
+type AgingRowResponse struct {
+	CustomerID     uint64  `json:"customer_id,omitempty"`
+	Customer       string  `json:"customer,omitempty"`
+	Currency       string  `json:"currency"`
+	Current        string  `json:"current"` // Not due yet
+	Days1To30      string  `json:"days_1_30"`
+	Days31To60     string  `json:"days_31_60"`
+	Days61To90     string  `json:"days_61_90"`
+	Over90         string  `json:"over_90"`
+	Total          string  `json:"total"`
+	Promised       string  `json:"promised"`      // Under an active promise to pay
+	PromisedDate   *string `json:"promised_date"` // Earliest promised day
+	BrokenPromises int64   `json:"broken_promises,omitempty"`
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/routing"
+)
+
+// RoutingHandler serves the working hours and staff of ticket departments,
+// the on-call rotation and ticket assignment
+type RoutingHandler struct {
+	routingService *routing.Service
+}
+
+// NewRoutingHandler creates a new routing handler
+func NewRoutingHandler(routingService *routing.Service) *RoutingHandler {
+	return &RoutingHandler{routingService: routingService}
+}
+
+// AdminGetDepartmentSchedule godoc
+// @Summary Admin: Get department schedule
+// @Description Returns the time zone, working hours, holidays, members and assignment mode of a ticket department
+// @Tags admin/tickets
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Department ID"
+// @Success 200 {object} DepartmentScheduleResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/departments/{id}/schedule [get]
+func (h *RoutingHandler) AdminGetDepartmentSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid department ID"})
+		return
+	}
+
+	schedule, err := h.routingService.GetSchedule(id)
+	if err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDepartmentScheduleResponse(schedule))
+}
+
+// AdminUpdateDepartmentSchedule godoc
+// @Summary Admin: Update department schedule
+// @Description Replaces the time zone, working hours, members and assignment mode of a ticket department. SLA deadlines of new tickets count only working hours; a department without hours works around the clock.
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Department ID"
+// @Param request body DepartmentScheduleRequest true "Schedule"
+// @Success 200 {object} DepartmentScheduleResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/departments/{id}/schedule [put]
+func (h *RoutingHandler) AdminUpdateDepartmentSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid department ID"})
+		return
+	}
+
+	var req DepartmentScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	input := routing.ScheduleInput{
+		Timezone:       req.Timezone,
+		AssignmentMode: domain.AssignmentMode(req.AssignmentMode),
+		MemberIDs:      req.MemberIDs,
+	}
+	for _, entry := range req.Hours {
+		input.Hours = append(input.Hours, domain.DepartmentHours{Weekday: entry.Weekday, Opens: entry.Opens, Closes: entry.Closes})
+	}
+
+	schedule, err := h.routingService.UpdateSchedule(id, input)
+	if err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toDepartmentScheduleResponse(schedule))
+}
+
+// AdminAddDepartmentHoliday godoc
+// @Summary Admin: Add department holiday
+// @Description Closes a ticket department for a day. Adding a day again renames it.
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Department ID"
+// @Param request body DepartmentHolidayRequest true "Holiday"
+// @Success 201 {object} DepartmentHolidayResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/departments/{id}/holidays [post]
+func (h *RoutingHandler) AdminAddDepartmentHoliday(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid department ID"})
+		return
+	}
+
+	var req DepartmentHolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	holiday, err := h.routingService.AddHoliday(id, req.Date, req.Name)
+	if err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, DepartmentHolidayResponse{ID: holiday.ID, Date: holiday.Date, Name: holiday.Name})
+}
+
+// AdminDeleteDepartmentHoliday godoc
+// @Summary Admin: Delete department holiday
+// @Tags admin/tickets
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Department ID"
+// @Param holiday_id path int true "Holiday ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/departments/{id}/holidays/{holiday_id} [delete]
+func (h *RoutingHandler) AdminDeleteDepartmentHoliday(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid department ID"})
+		return
+	}
+	holidayID, err := strconv.ParseUint(c.Param("holiday_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid holiday ID"})
+		return
+	}
+
+	if err := h.routingService.DeleteHoliday(id, holidayID); err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Holiday deleted"})
+}
+
+// AdminListOnCall godoc
+// @Summary Admin: List on-call shifts
+// @Description Returns the on-call shifts that have not ended, the first starting first
+// @Tags admin/tickets
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} OnCallShiftResponse
+// @Router /api/v1/admin/on-call [get]
+func (h *RoutingHandler) AdminListOnCall(c *gin.Context) {
+	shifts, err := h.routingService.ListShifts(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list on-call shifts"})
+		return
+	}
+
+	response := make([]OnCallShiftResponse, 0, len(shifts))
+	for i := range shifts {
+		response = append(response, toOnCallShiftResponse(&shifts[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminAddOnCall godoc
+// @Summary Admin: Add on-call shift
+// @Description Puts a staff member on call for a department, or for every department without department_id. High priority tickets arriving outside working hours are assigned to them.
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body OnCallShiftRequest true "Shift"
+// @Success 201 {object} OnCallShiftResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/on-call [post]
+func (h *RoutingHandler) AdminAddOnCall(c *gin.Context) {
+	var req OnCallShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	shift, err := h.routingService.AddShift(routing.ShiftInput{
+		DepartmentID: req.DepartmentID,
+		UserID:       req.UserID,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+	})
+	if err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toOnCallShiftResponse(shift))
+}
+
+// AdminDeleteOnCall godoc
+// @Summary Admin: Delete on-call shift
+// @Tags admin/tickets
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Shift ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/on-call/{id} [delete]
+func (h *RoutingHandler) AdminDeleteOnCall(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid shift ID"})
+		return
+	}
+
+	if err := h.routingService.DeleteShift(id); err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "On-call shift deleted"})
+}
+
+// AdminSetAvailability godoc
+// @Summary Admin: Set availability
+// @Description Marks the signed in staff member away, so new tickets are not assigned to them, or back
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AvailabilityRequest true "Availability"
+// @Success 200 {object} MessageResponse
+// @Router /api/v1/admin/staff/availability [put]
+func (h *RoutingHandler) AdminSetAvailability(c *gin.Context) {
+	var req AvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.routingService.SetAway(c.GetUint64("admin_id"), req.Away); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update availability"})
+		return
+	}
+	if req.Away {
+		c.JSON(http.StatusOK, MessageResponse{Message: "You are away"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "You are available"})
+}
+
+// AdminAssignTicket godoc
+// @Summary Admin: Assign ticket
+// @Description Gives a ticket to a staff member, who is notified. A null assignee_id unassigns it.
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Ticket ID"
+// @Param request body AssignTicketRequest true "Assignee"
+// @Success 200 {object} TicketResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tickets/{id}/assignee [put]
+func (h *RoutingHandler) AdminAssignTicket(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	var req AssignTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ticket, err := h.routingService.Assign(id, req.AssigneeID, c.GetUint64("admin_id"))
+	if err != nil {
+		writeRoutingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toTicketResponse(ticket))
+}
+
+func writeRoutingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, routing.ErrDepartmentNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Department not found"})
+	case errors.Is(err, routing.ErrTicketNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ticket not found"})
+	case errors.Is(err, routing.ErrShiftNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "On-call shift not found"})
+	case errors.Is(err, routing.ErrHolidayNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Holiday not found"})
+	case errors.Is(err, routing.ErrInvalidTimezone), errors.Is(err, routing.ErrInvalidHours),
+		errors.Is(err, routing.ErrInvalidMode), errors.Is(err, routing.ErrInvalidDate),
+		errors.Is(err, routing.ErrInvalidShift), errors.Is(err, routing.ErrNotStaff):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save routing"})
+	}
+}
+
+func toDepartmentScheduleResponse(s *routing.DepartmentSchedule) DepartmentScheduleResponse {
+	resp := DepartmentScheduleResponse{
+		DepartmentID:     s.Department.ID,
+		Timezone:         s.Department.Timezone,
+		AssignmentMode:   string(s.Department.AssignmentMode),
+		SLAResponseHours: s.Department.SLAResponseHours,
+		SLAResolveHours:  s.Department.SLAResolveHours,
+		Hours:            []DepartmentHoursEntry{},
+		Holidays:         []DepartmentHolidayResponse{},
+		Members:          []DepartmentMemberResponse{},
+	}
+	if resp.Timezone == "" {
+		resp.Timezone = "UTC"
+	}
+	for _, h := range s.Hours {
+		resp.Hours = append(resp.Hours, DepartmentHoursEntry{Weekday: h.Weekday, Opens: h.Opens, Closes: h.Closes})
+	}
+	for _, h := range s.Holidays {
+		resp.Holidays = append(resp.Holidays, DepartmentHolidayResponse{ID: h.ID, Date: h.Date, Name: h.Name})
+	}
+	for _, m := range s.Members {
+		resp.Members = append(resp.Members, DepartmentMemberResponse{UserID: m.UserID, Name: m.User.FullName(), Away: m.User.Away})
+	}
+	return resp
+}
+
+func toOnCallShiftResponse(s *domain.OnCallShift) OnCallShiftResponse {
+	return OnCallShiftResponse{
+		ID:           s.ID,
+		DepartmentID: s.DepartmentID,
+		UserID:       s.UserID,
+		Name:         s.User.FullName(),
+		StartsAt:     s.StartsAt.UTC().Format("2006-01-02T15:04:05Z"),
+		EndsAt:       s.EndsAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// Request/Response types
+
+type DepartmentHoursEntry struct {
+	Weekday int    `json:"weekday"` // 0 is Sunday
+	Opens   string `json:"opens"`   // HH:MM
+	Closes  string `json:"closes"`  // HH:MM, 24:00 for midnight
+}
+
+type DepartmentScheduleRequest struct {
+	Timezone       string                 `json:"timezone"`        // IANA name, empty for UTC
+	AssignmentMode string                 `json:"assignment_mode"` // none, round_robin or load_based
+	Hours          []DepartmentHoursEntry `json:"hours"`
+	MemberIDs      []uint64               `json:"member_ids"`
+}
+
+type DepartmentHolidayRequest struct {
+	Date string `json:"date" binding:"required"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+type OnCallShiftRequest struct {
+	DepartmentID *uint64   `json:"department_id"` // Null for every department
+	UserID       uint64    `json:"user_id" binding:"required"`
+	StartsAt     time.Time `json:"starts_at" binding:"required"`
+	EndsAt       time.Time `json:"ends_at" binding:"required"`
+}
+
+type AvailabilityRequest struct {
+	Away bool `json:"away"`
+}
+
+type AssignTicketRequest struct {
+	AssigneeID *uint64 `json:"assignee_id"`
+}
+
+type DepartmentScheduleResponse struct {
+	DepartmentID     uint64                      `json:"department_id"`
+	Timezone         string                      `json:"timezone"`
+	AssignmentMode   string                      `json:"assignment_mode"`
+	SLAResponseHours int                         `json:"sla_response_hours"`
+	SLAResolveHours  int                         `json:"sla_resolve_hours"`
+	Hours            []DepartmentHoursEntry      `json:"hours"`
+	Holidays         []DepartmentHolidayResponse `json:"holidays"`
+	Members          []DepartmentMemberResponse  `json:"members"`
+}
+
+type DepartmentHolidayResponse struct {
+	ID   uint64 `json:"id"`
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+type DepartmentMemberResponse struct {
+	UserID uint64 `json:"user_id"`
+	Name   string `json:"name"`
+	Away   bool   `json:"away"`
+}
+
+type OnCallShiftResponse struct {
+	ID           uint64  `json:"id"`
+	DepartmentID *uint64 `json:"department_id"`
+	UserID       uint64  `json:"user_id"`
+	Name         string  `json:"name"`
+	StartsAt     string  `json:"starts_at"`
+	EndsAt       string  `json:"ends_at"`
+}
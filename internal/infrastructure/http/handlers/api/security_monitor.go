@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/adminaccess"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/securitymonitor"
+)
+
+// SecurityMonitorHandler lets admins review the abuse the security monitor
+// counted and manage bans
+type SecurityMonitorHandler struct {
+	monitor     *securitymonitor.Service
+	authService *auth.Service
+}
+
+// NewSecurityMonitorHandler creates a new security monitor handler
+func NewSecurityMonitorHandler(monitor *securitymonitor.Service, authService *auth.Service) *SecurityMonitorHandler {
+	return &SecurityMonitorHandler{monitor: monitor, authService: authService}
+}
+
+// BanBypass reports whether a request from a banned address is let
+// through anyway: those of signed in staff, so an admin sharing an
+// address with an attacker can still lift the ban
+func (h *SecurityMonitorHandler) BanBypass(c *gin.Context) bool {
+	token := extractToken(c)
+	if token == "" {
+		return false
+	}
+	user, err := h.authService.ValidateSession(token)
+	return err == nil && user.IsStaff()
+}
+
+// AdminListBans godoc
+// @Summary Admin: List bans
+// @Description Returns the IP and user bans newest first, applied by the security monitor or by staff
+// @Tags admin/security
+// @Produce json
+// @Security BearerAuth
+// @Param active query bool false "Only bans in force"
+// @Param limit query int false "Items per page" default(20)
+// @Param page query int false "Page number" default(1)
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/security/bans [get]
+func (h *SecurityMonitorHandler) AdminListBans(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	bans, total, err := h.monitor.ListBans(c.Query("active") == "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch bans"})
+		return
+	}
+
+	response := make([]SecurityBanResponse, 0, len(bans))
+	for i := range bans {
+		response = append(response, toSecurityBanResponse(&bans[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminCreateBan godoc
+// @Summary Admin: Ban an address or user
+// @Description Bans an IP address or CIDR range from the site, or a user from signing in and paying, for a number of minutes or for good. Addresses in security_monitor.trusted_ips cannot be banned.
+// @Tags admin/security
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateBanRequest true "Ban"
+// @Success 201 {object} SecurityBanResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/admin/security/bans [post]
+func (h *SecurityMonitorHandler) AdminCreateBan(c *gin.Context) {
+	var req CreateBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	ban, err := h.monitor.Ban(req.IPAddress, req.UserID, req.Reason, duration, GetCurrentUserID(c), c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, securitymonitor.ErrBanTarget), errors.Is(err, adminaccess.ErrInvalidRange):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, securitymonitor.ErrBanTrusted):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, securitymonitor.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create ban"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, toSecurityBanResponse(ban))
+}
+
+// AdminLiftBan godoc
+// @Summary Admin: Lift a ban
+// @Description Ends a ban before it expires
+// @Tags admin/security
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Ban ID"
+// @Success 200 {object} SecurityBanResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/security/bans/{id} [delete]
+func (h *SecurityMonitorHandler) AdminLiftBan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ban ID"})
+		return
+	}
+
+	ban, err := h.monitor.Lift(id, GetCurrentUserID(c), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, securitymonitor.ErrBanNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ban not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to lift ban"})
+		return
+	}
+	c.JSON(http.StatusOK, toSecurityBanResponse(ban))
+}
+
+// AdminListAbuseEvents godoc
+// @Summary Admin: List abuse events
+// @Description Returns the failed sign ins, password reset requests and declined payments of the last day the security monitor counts toward bans, newest first
+// @Tags admin/security
+// @Produce json
+// @Security BearerAuth
+// @Param ip query string false "Only events from this address"
+// @Param limit query int false "Items per page" default(20)
+// @Param page query int false "Page number" default(1)
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/security/events [get]
+func (h *SecurityMonitorHandler) AdminListAbuseEvents(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	events, total, err := h.monitor.ListEvents(c.Query("ip"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch events"})
+		return
+	}
+
+	response := make([]AbuseEventResponse, 0, len(events))
+	for _, event := range events {
+		response = append(response, AbuseEventResponse{
+			ID:        event.ID,
+			Kind:      string(event.Kind),
+			IPAddress: event.IPAddress,
+			UserID:    event.UserID,
+			Email:     event.Email,
+			CreatedAt: event.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func toSecurityBanResponse(ban *domain.SecurityBan) SecurityBanResponse {
+	response := SecurityBanResponse{
+		ID:          ban.ID,
+		IPAddress:   ban.IPAddress,
+		UserID:      ban.UserID,
+		Reason:      ban.Reason,
+		Automatic:   ban.Automatic,
+		Active:      ban.Active(time.Now()),
+		CreatedByID: ban.CreatedByID,
+		LiftedByID:  ban.LiftedByID,
+		CreatedAt:   ban.CreatedAt.Format(time.RFC3339),
+	}
+	if ban.User != nil {
+		response.UserEmail = ban.User.Email
+	}
+	if ban.ExpiresAt != nil {
+		expires := ban.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &expires
+	}
+	if ban.LiftedAt != nil {
+		lifted := ban.LiftedAt.Format(time.RFC3339)
+		response.LiftedAt = &lifted
+	}
+	return response
+}
+
+// Request/Response types
+
+type CreateBanRequest struct {
+	IPAddress       string  `json:"ip_address" binding:"max=64"` // Address or CIDR range
+	UserID          *uint64 `json:"user_id"`
+	Reason          string  `json:"reason" binding:"max=255"`
+	DurationMinutes int     `json:"duration_minutes" binding:"min=0"` // 0 bans for good
+}
+
+type SecurityBanResponse struct {
+	ID          uint64  `json:"id"`
+	IPAddress   string  `json:"ip_address,omitempty"`
+	UserID      *uint64 `json:"user_id"`
+	UserEmail   string  `json:"user_email,omitempty"`
+	Reason      string  `json:"reason"`
+	Automatic   bool    `json:"automatic"`
+	Active      bool    `json:"active"`
+	ExpiresAt   *string `json:"expires_at"`
+	CreatedByID *uint64 `json:"created_by_id"`
+	LiftedAt    *string `json:"lifted_at"`
+	LiftedByID  *uint64 `json:"lifted_by_id"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+type AbuseEventResponse struct {
+	ID        uint64  `json:"id"`
+	Kind      string  `json:"kind"` // login_failed, password_reset or card_declined
+	IPAddress string  `json:"ip_address"`
+	UserID    *uint64 `json:"user_id"`
+	Email     string  `json:"email,omitempty"`
+	CreatedAt string  `json:"created_at"`
+}
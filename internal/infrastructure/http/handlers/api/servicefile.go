@@ -0,0 +1,361 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/servicefile"
+)
+
+// uploadFormOverhead allows for the fields and boundaries of upload forms
+// on top of the file size limit
+const uploadFormOverhead = 1 << 20
+
+// ServiceFileHandler handles the files exchanged for services
+type ServiceFileHandler struct {
+	serviceFileService *servicefile.Service
+}
+
+// NewServiceFileHandler creates a new service file handler
+func NewServiceFileHandler(serviceFileService *servicefile.Service) *ServiceFileHandler {
+	return &ServiceFileHandler{serviceFileService: serviceFileService}
+}
+
+// ListFiles godoc
+// @Summary List service files
+// @Description Returns the files of a service with the storage used by customer uploads
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} ServiceFilesResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/files [get]
+func (h *ServiceFileHandler) ListFiles(c *gin.Context) {
+	service, ok := h.service(c, false)
+	if !ok {
+		return
+	}
+	h.listFiles(c, service)
+}
+
+// UploadFile godoc
+// @Summary Upload service file
+// @Description Uploads a file requested by staff. Files count against the upload size and storage quota of the service and are scanned for malware when a scanner is configured.
+// @Tags services
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file formData file true "File"
+// @Param note formData string false "Note for staff"
+// @Success 201 {object} ServiceFileResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Router /api/v1/services/{id}/files [post]
+func (h *ServiceFileHandler) UploadFile(c *gin.Context) {
+	service, ok := h.service(c, false)
+	if !ok {
+		return
+	}
+	maxFileSize, _ := h.serviceFileService.Limits()
+	h.upload(c, service, false, maxFileSize+uploadFormOverhead)
+}
+
+// DownloadFile godoc
+// @Summary Download service file
+// @Description Redirects to a short-lived signed URL of a file of the service
+// @Tags services
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file_id path int true "File ID"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/files/{file_id}/download [get]
+func (h *ServiceFileHandler) DownloadFile(c *gin.Context) {
+	service, ok := h.service(c, false)
+	if !ok {
+		return
+	}
+	h.download(c, service)
+}
+
+// DeleteFile godoc
+// @Summary Delete service file
+// @Description Deletes a file the customer uploaded; files from staff cannot be deleted by customers
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file_id path int true "File ID"
+// @Success 200 {object} MessageResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/services/{id}/files/{file_id} [delete]
+func (h *ServiceFileHandler) DeleteFile(c *gin.Context) {
+	service, ok := h.service(c, false)
+	if !ok {
+		return
+	}
+	file, ok := h.file(c, service)
+	if !ok {
+		return
+	}
+	if file.FromStaff {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Files from staff cannot be deleted"})
+		return
+	}
+	h.deleteFile(c, file)
+}
+
+// AdminListFiles godoc
+// @Summary List service files (Admin)
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Success 200 {object} ServiceFilesResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/files [get]
+func (h *ServiceFileHandler) AdminListFiles(c *gin.Context) {
+	service, ok := h.service(c, true)
+	if !ok {
+		return
+	}
+	h.listFiles(c, service)
+}
+
+// AdminUploadFile godoc
+// @Summary Upload service file (Admin)
+// @Description Attaches a deliverable such as a configuration file or report to a service and notifies the customer. Staff uploads do not count against the quota.
+// @Tags admin/services
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file formData file true "File"
+// @Param note formData string false "Note for the customer"
+// @Success 201 {object} ServiceFileResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/files [post]
+func (h *ServiceFileHandler) AdminUploadFile(c *gin.Context) {
+	service, ok := h.service(c, true)
+	if !ok {
+		return
+	}
+	h.upload(c, service, true, maxDownloadSize)
+}
+
+// AdminDownloadFile godoc
+// @Summary Download service file (Admin)
+// @Tags admin/services
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file_id path int true "File ID"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/files/{file_id}/download [get]
+func (h *ServiceFileHandler) AdminDownloadFile(c *gin.Context) {
+	service, ok := h.service(c, true)
+	if !ok {
+		return
+	}
+	h.download(c, service)
+}
+
+// AdminDeleteFile godoc
+// @Summary Delete service file (Admin)
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param file_id path int true "File ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/services/{id}/files/{file_id} [delete]
+func (h *ServiceFileHandler) AdminDeleteFile(c *gin.Context) {
+	service, ok := h.service(c, true)
+	if !ok {
+		return
+	}
+	file, ok := h.file(c, service)
+	if !ok {
+		return
+	}
+	h.deleteFile(c, file)
+}
+
+// service loads the service of the request; customers only see their own
+func (h *ServiceFileHandler) service(c *gin.Context, admin bool) (*domain.Service, bool) {
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return nil, false
+	}
+
+	var customerID *uint64
+	if !admin {
+		userID := GetCurrentUserID(c)
+		customerID = &userID
+	}
+	service, err := h.serviceFileService.GetService(serviceID, customerID)
+	if err != nil {
+		if errors.Is(err, servicefile.ErrServiceNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch service"})
+		return nil, false
+	}
+	return service, true
+}
+
+func (h *ServiceFileHandler) file(c *gin.Context, service *domain.Service) (*domain.ServiceFile, bool) {
+	fileID, err := strconv.ParseUint(c.Param("file_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid file ID"})
+		return nil, false
+	}
+
+	file, err := h.serviceFileService.GetFile(service.ID, fileID)
+	if err != nil {
+		if errors.Is(err, servicefile.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "File not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch file"})
+		return nil, false
+	}
+	return file, true
+}
+
+func (h *ServiceFileHandler) listFiles(c *gin.Context, service *domain.Service) {
+	files, err := h.serviceFileService.ListFiles(service.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch files"})
+		return
+	}
+	used, err := h.serviceFileService.Usage(service.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch files"})
+		return
+	}
+
+	maxFileSize, quota := h.serviceFileService.Limits()
+	response := ServiceFilesResponse{
+		Files:       make([]ServiceFileResponse, 0, len(files)),
+		Used:        used,
+		Quota:       quota,
+		MaxFileSize: maxFileSize,
+	}
+	for i := range files {
+		response.Files = append(response.Files, toServiceFileResponse(&files[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *ServiceFileHandler) upload(c *gin.Context, service *domain.Service, fromStaff bool, maxSize int64) {
+	var req ServiceFileUploadRequest
+	file, ok := bindUpload(c, maxSize, &req)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	record, err := h.serviceFileService.Upload(c.Request.Context(), service, GetCurrentUser(c), fromStaff, servicefile.FileInput{
+		FileName:    file.header.Filename,
+		ContentType: file.header.Header.Get("Content-Type"),
+		Reader:      file,
+		Size:        file.header.Size,
+		Note:        req.Note,
+	})
+	if err != nil {
+		if scanError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, servicefile.ErrFileTooLarge), errors.Is(err, servicefile.ErrQuotaExceeded):
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, servicefile.ErrNoFileStore):
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload file"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, toServiceFileResponse(record))
+}
+
+func (h *ServiceFileHandler) download(c *gin.Context, service *domain.Service) {
+	file, ok := h.file(c, service)
+	if !ok {
+		return
+	}
+	url, err := h.serviceFileService.FileURL(file, fileURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to sign file URL"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+func (h *ServiceFileHandler) deleteFile(c *gin.Context, file *domain.ServiceFile) {
+	if err := h.serviceFileService.DeleteFile(file); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete file"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "File deleted"})
+}
+
+// Request/Response types
+
+type ServiceFileUploadRequest struct {
+	Note string `form:"note" binding:"max=1000"`
+}
+
+type ServiceFileResponse struct {
+	ID          uint64 `json:"id"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	ContentType string `json:"content_type"`
+	Note        string `json:"note,omitempty"`
+	FromStaff   bool   `json:"from_staff"`
+	UploadedBy  string `json:"uploaded_by"`
+	ScanStatus  string `json:"scan_status"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type ServiceFilesResponse struct {
+	Files       []ServiceFileResponse `json:"files"`
+	Used        int64                 `json:"used"`  // Bytes of customer uploads
+	Quota       int64                 `json:"quota"` // Bytes available to customer uploads
+	MaxFileSize int64                 `json:"max_file_size"`
+}
+
+func toServiceFileResponse(file *domain.ServiceFile) ServiceFileResponse {
+	uploadedBy := "Staff"
+	if !file.FromStaff {
+		uploadedBy = file.Uploader.FirstName + " " + file.Uploader.LastName
+	}
+	return ServiceFileResponse{
+		ID:          file.ID,
+		FileName:    file.FileName,
+		FileSize:    file.FileSize,
+		ContentType: file.ContentType,
+		Note:        file.Note,
+		FromStaff:   file.FromStaff,
+		UploadedBy:  uploadedBy,
+		ScanStatus:  file.ScanStatus,
+		CreatedAt:   file.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/spam"
+)
+
+// SpamHandler handles the spam queue and the sender lists of the email
+// pipe
+type SpamHandler struct {
+	spamService *spam.Service
+}
+
+// NewSpamHandler creates a new spam handler
+func NewSpamHandler(spamService *spam.Service) *SpamHandler {
+	return &SpamHandler{spamService: spamService}
+}
+
+// AdminListMessages godoc
+// @Summary Admin: List spam messages
+// @Description Returns the emails the spam filter held back, newest first
+// @Tags admin/spam
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Status" Enums(pending, released)
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/spam [get]
+func (h *SpamHandler) AdminListMessages(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	messages, total, err := h.spamService.ListMessages(domain.SpamMessageStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch spam messages"})
+		return
+	}
+
+	response := make([]SpamMessageResponse, 0, len(messages))
+	for i := range messages {
+		response = append(response, toSpamMessageResponse(&messages[i]))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetMessage godoc
+// @Summary Admin: Get spam message
+// @Description Returns a held back email with its raw content
+// @Tags admin/spam
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Spam message ID"
+// @Success 200 {object} SpamMessageDetailResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/spam/{id} [get]
+func (h *SpamHandler) AdminGetMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return
+	}
+	message, err := h.spamService.GetMessage(id)
+	if err != nil {
+		if errors.Is(err, spam.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Message not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch spam message"})
+		return
+	}
+	c.JSON(http.StatusOK, SpamMessageDetailResponse{
+		SpamMessageResponse: toSpamMessageResponse(message),
+		Raw:                 string(message.Raw),
+	})
+}
+
+// AdminReleaseMessage godoc
+// @Summary Admin: Release spam message
+// @Description Turns a held back email into a ticket message as if it had just arrived, optionally allowing its sender from now on
+// @Tags admin/spam
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Spam message ID"
+// @Param request body ReleaseSpamRequest false "Release options"
+// @Success 200 {object} SpamMessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Router /api/v1/admin/spam/{id}/release [post]
+func (h *SpamHandler) AdminReleaseMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return
+	}
+	var req ReleaseSpamRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	message, err := h.spamService.ReleaseMessage(id, GetCurrentUserID(c), req.AllowSender)
+	if err != nil {
+		switch {
+		case errors.Is(err, spam.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Message not found"})
+		case errors.Is(err, spam.ErrAlreadyReleased):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		case errors.Is(err, domain.ErrSenderRejected):
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to release message"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, toSpamMessageResponse(message))
+}
+
+// AdminDeleteMessage godoc
+// @Summary Admin: Delete spam message
+// @Tags admin/spam
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Spam message ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/spam/{id} [delete]
+func (h *SpamHandler) AdminDeleteMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid message ID"})
+		return
+	}
+	if err := h.spamService.DeleteMessage(id); err != nil {
+		if errors.Is(err, spam.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Message not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete message"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Message deleted"})
+}
+
+// AdminListEntries godoc
+// @Summary Admin: List spam list entries
+// @Description Returns the senders on the allow and block lists of the email pipe
+// @Tags admin/spam
+// @Produce json
+// @Security BearerAuth
+// @Param list query string false "List" Enums(allow, block)
+// @Success 200 {array} SpamListEntryResponse
+// @Router /api/v1/admin/spam/lists [get]
+func (h *SpamHandler) AdminListEntries(c *gin.Context) {
+	entries, err := h.spamService.ListEntries(c.Query("list"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch spam lists"})
+		return
+	}
+	response := make([]SpamListEntryResponse, 0, len(entries))
+	for i := range entries {
+		response = append(response, toSpamListEntryResponse(&entries[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminAddEntry godoc
+// @Summary Admin: Add spam list entry
+// @Description Allows or blocks an email address or a domain with its subdomains
+// @Tags admin/spam
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SpamListEntryRequest true "Entry"
+// @Success 201 {object} SpamListEntryResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/spam/lists [post]
+func (h *SpamHandler) AdminAddEntry(c *gin.Context) {
+	var req SpamListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	adminID := GetCurrentUserID(c)
+	entry, err := h.spamService.AddEntry(req.List, req.Pattern, req.Note, &adminID)
+	if err != nil {
+		if errors.Is(err, spam.ErrInvalidList) || errors.Is(err, spam.ErrInvalidPattern) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to add spam list entry"})
+		return
+	}
+	c.JSON(http.StatusCreated, toSpamListEntryResponse(entry))
+}
+
+// AdminDeleteEntry godoc
+// @Summary Admin: Delete spam list entry
+// @Tags admin/spam
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Entry ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/spam/lists/{id} [delete]
+func (h *SpamHandler) AdminDeleteEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid entry ID"})
+		return
+	}
+	if err := h.spamService.DeleteEntry(id); err != nil {
+		if errors.Is(err, spam.ErrEntryNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Entry not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete spam list entry"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Entry deleted"})
+}
+
+// Request/Response types
+
+type ReleaseSpamRequest struct {
+	AllowSender bool `json:"allow_sender"` // Add the sender to the allow list
+}
+
+type SpamListEntryRequest struct {
+	List    string `json:"list" binding:"required,oneof=allow block"`
+	Pattern string `json:"pattern" binding:"required,max=255"` // Email address or domain
+	Note    string `json:"note" binding:"max=255"`
+}
+
+type SpamMessageResponse struct {
+	ID         uint64   `json:"id"`
+	Sender     string   `json:"sender"`
+	Subject    string   `json:"subject"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+	Status     string   `json:"status"`
+	TicketID   *uint64  `json:"ticket_id,omitempty"`
+	ReleasedAt string   `json:"released_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type SpamMessageDetailResponse struct {
+	SpamMessageResponse
+	Raw string `json:"raw"` // Message as received, with all headers
+}
+
+type SpamListEntryResponse struct {
+	ID        uint64 `json:"id"`
+	List      string `json:"list"`
+	Pattern   string `json:"pattern"`
+	Note      string `json:"note"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toSpamMessageResponse(m *domain.SpamMessage) SpamMessageResponse {
+	resp := SpamMessageResponse{
+		ID:        m.ID,
+		Sender:    m.Sender,
+		Subject:   m.Subject,
+		Score:     m.Score,
+		Reasons:   m.Reasons,
+		Status:    string(m.Status),
+		TicketID:  m.TicketID,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	}
+	if resp.Reasons == nil {
+		resp.Reasons = []string{}
+	}
+	if m.ReleasedAt != nil {
+		resp.ReleasedAt = m.ReleasedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func toSpamListEntryResponse(e *domain.SpamListEntry) SpamListEntryResponse {
+	return SpamListEntryResponse{
+		ID:        e.ID,
+		List:      e.ListType,
+		Pattern:   e.Pattern,
+		Note:      e.Note,
+		CreatedAt: e.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/stock"
+)
+
+// StockHandler handles product stock endpoints
+type StockHandler struct {
+	stockService *stock.Service
+}
+
+// NewStockHandler creates a new stock handler
+func NewStockHandler(stockService *stock.Service) *StockHandler {
+	return &StockHandler{stockService: stockService}
+}
+
+// AdminListStock godoc
+// @Summary List product stock (Admin)
+// @Description Returns stock tracked products, lowest available quantity first
+// @Tags admin/stock
+// @Produce json
+// @Security BearerAuth
+// @Param low query bool false "Only products at or below their low stock alert"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/stock [get]
+func (h *StockHandler) AdminListStock(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+	lowOnly := c.Query("low") == "true"
+
+	stocks, total, err := h.stockService.ListStock(lowOnly, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch stock"})
+		return
+	}
+
+	response := make([]ProductStockResponse, 0, len(stocks))
+	for i := range stocks {
+		response = append(response, toProductStockResponse(&stocks[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminGetStock godoc
+// @Summary Get product stock (Admin)
+// @Tags admin/stock
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Success 200 {object} ProductStockResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/stock [get]
+func (h *StockHandler) AdminGetStock(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	s, err := h.stockService.GetStock(productID)
+	if err != nil {
+		if err == stock.ErrNotTracked {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toProductStockResponse(s))
+}
+
+// AdminSetStock godoc
+// @Summary Set product stock (Admin)
+// @Description Starts or updates stock tracking for a product. Tracked products can only be ordered while units are available unless backorders are allowed.
+// @Tags admin/stock
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param request body SetStockRequest true "Stock settings"
+// @Success 200 {object} ProductStockResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/stock [put]
+func (h *StockHandler) AdminSetStock(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	var req SetStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	lowStockAlert := 5
+	if req.LowStockAlert != nil {
+		lowStockAlert = *req.LowStockAlert
+	}
+	s, err := h.stockService.SetStock(productID, stock.Settings{
+		Quantity:       req.Quantity,
+		LowStockAlert:  lowStockAlert,
+		OutOfStockMsg:  req.OutOfStockMsg,
+		AllowBackorder: req.AllowBackorder,
+	})
+	if err != nil {
+		switch err {
+		case stock.ErrProductNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+		case stock.ErrInvalidQuantity:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update stock"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toProductStockResponse(s))
+}
+
+// AdminRestock godoc
+// @Summary Restock product (Admin)
+// @Description Adds units to the stock of a product and re-arms its low stock alert
+// @Tags admin/stock
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param request body RestockRequest true "Units received"
+// @Success 200 {object} ProductStockResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/restock [post]
+func (h *StockHandler) AdminRestock(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	var req RestockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	s, err := h.stockService.Restock(productID, req.Quantity)
+	if err != nil {
+		switch err {
+		case stock.ErrNotTracked:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case stock.ErrInvalidQuantity:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to restock product"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toProductStockResponse(s))
+}
+
+// AdminStopTracking godoc
+// @Summary Stop tracking product stock (Admin)
+// @Tags admin/stock
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/stock [delete]
+func (h *StockHandler) AdminStopTracking(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	if err := h.stockService.StopTracking(productID); err != nil {
+		if err == stock.ErrNotTracked {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to stop stock tracking"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Stock tracking disabled"})
+}
+
+func toProductStockResponse(s *domain.ProductStock) ProductStockResponse {
+	resp := ProductStockResponse{
+		ProductID:      s.ProductID,
+		ProductName:    s.Product.Name,
+		Quantity:       s.Quantity,
+		Reserved:       s.ReservedQty,
+		Available:      s.AvailableQuantity(),
+		LowStockAlert:  s.LowStockAlert,
+		LowStock:       s.IsLowStock(),
+		OutOfStockMsg:  s.OutOfStockMsg,
+		AllowBackorder: s.AllowBackorder,
+	}
+	if s.LastRestocked != nil {
+		resp.LastRestocked = s.LastRestocked.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type SetStockRequest struct {
+	Quantity       int    `json:"quantity" binding:"min=0"`
+	LowStockAlert  *int   `json:"low_stock_alert"`
+	OutOfStockMsg  string `json:"out_of_stock_message"`
+	AllowBackorder bool   `json:"allow_backorder"`
+}
+
+type RestockRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+type ProductStockResponse struct {
+	ProductID      uint64 `json:"product_id"`
+	ProductName    string `json:"product_name,omitempty"`
+	Quantity       int    `json:"quantity"`
+	Reserved       int    `json:"reserved"`
+	Available      int    `json:"available"`
+	LowStockAlert  int    `json:"low_stock_alert"`
+	LowStock       bool   `json:"low_stock"`
+	OutOfStockMsg  string `json:"out_of_stock_message,omitempty"`
+	AllowBackorder bool   `json:"allow_backorder"`
+	LastRestocked  string `json:"last_restocked,omitempty"`
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/sysinfo"
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// SystemHandler handles system maintenance API endpoints
+type SystemHandler struct {
+	renderer  *web.Renderer
+	collector *sysinfo.Collector
+}
+
+// NewSystemHandler creates a new system handler
+func NewSystemHandler(renderer *web.Renderer, collector *sysinfo.Collector) *SystemHandler {
+	return &SystemHandler{renderer: renderer, collector: collector}
+}
+
+// ClearTemplateCache drops all cached templates
+// @Summary Clear template cache
+// @Description Drop all cached templates, so theme changes deployed without a restart take effect
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MessageResponse
+// @Router /api/v1/admin/system/clear-template-cache [post]
+func (h *SystemHandler) ClearTemplateCache(c *gin.Context) {
+	h.renderer.ClearTemplateCache()
+	c.JSON(http.StatusOK, MessageResponse{Message: "Template cache cleared"})
+}
+
+// GetInfo returns the system information
+// @Summary Get system information
+// @Description Get the version and commit, Go runtime statistics, database size and migration status, queue depths, last cron runs, attachment storage usage and license
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} sysinfo.Info
+// @Router /api/v1/admin/system/info [get]
+func (h *SystemHandler) GetInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, h.collector.Collect(c.Request.Context()))
+}
+
+// DownloadDiagnostics returns a diagnostics bundle for support
+// @Summary Download diagnostics bundle
+// @Description Download a zip archive with the system information, the configuration without secrets, recent cron failures and a goroutine dump, to attach to support requests
+// @Tags Admin
+// @Produce application/zip
+// @Security BearerAuth
+// @Success 200 {file} file
+// @Router /api/v1/admin/system/diagnostics [get]
+func (h *SystemHandler) DownloadDiagnostics(c *gin.Context) {
+	filename := fmt.Sprintf("openhost-diagnostics-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	if err := h.collector.WriteBundle(c.Request.Context(), c.Writer); err != nil {
+		// Headers are already sent; the truncated archive fails to open
+		_ = c.Error(err)
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/task"
+)
+
+// TaskHandler serves the to-do list of the staff
+type TaskHandler struct {
+	taskService *task.Service
+}
+
+// NewTaskHandler creates a new task handler
+func NewTaskHandler(taskService *task.Service) *TaskHandler {
+	return &TaskHandler{taskService: taskService}
+}
+
+// AdminListTasks godoc
+// @Summary Admin: List tasks
+// @Description Returns the tasks, the ones due first first. assignee=me lists the tasks of the signed in staff member.
+// @Tags admin/tasks
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "open or done"
+// @Param assignee query string false "Staff ID or me"
+// @Param entity_type query string false "customer, order, invoice, service or ticket"
+// @Param entity_id query int false "ID of the linked record, with entity_type"
+// @Param overdue query bool false "Only open tasks past their due date"
+// @Param limit query int false "Limit"
+// @Param offset query int false "Offset"
+// @Success 200 {object} PaginatedResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/tasks [get]
+func (h *TaskHandler) AdminListTasks(c *gin.Context) {
+	filter := task.Filter{
+		Status:     domain.AdminTaskStatus(c.Query("status")),
+		EntityType: domain.TaskEntity(c.Query("entity_type")),
+		Overdue:    c.Query("overdue") == "true",
+	}
+	switch assignee := c.Query("assignee"); assignee {
+	case "":
+	case "me":
+		adminID := c.GetUint64("admin_id")
+		filter.AssigneeID = &adminID
+	default:
+		id, err := strconv.ParseUint(assignee, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid assignee"})
+			return
+		}
+		filter.AssigneeID = &id
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		id, err := strconv.ParseUint(entityID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid entity ID"})
+			return
+		}
+		filter.EntityID = &id
+	}
+
+	limit, offset := PaginationParams(c)
+	tasks, total, err := h.taskService.List(filter, limit, offset)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+
+	now := time.Now()
+	response := make([]TaskResponse, 0, len(tasks))
+	for i := range tasks {
+		response = append(response, toTaskResponse(&tasks[i], now))
+	}
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminCreateTask godoc
+// @Summary Admin: Create task
+// @Description Adds a task, optionally about a customer, order, invoice, service or ticket. The assignee is notified.
+// @Tags admin/tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TaskRequest true "Task"
+// @Success 201 {object} TaskResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/tasks [post]
+func (h *TaskHandler) AdminCreateTask(c *gin.Context) {
+	var req TaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.taskService.Create(c.GetUint64("admin_id"), req.input())
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toTaskResponse(result, time.Now()))
+}
+
+// AdminGetTask godoc
+// @Summary Admin: Get task
+// @Tags admin/tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} TaskResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tasks/{id} [get]
+func (h *TaskHandler) AdminGetTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid task ID"})
+		return
+	}
+
+	result, err := h.taskService.Get(id)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toTaskResponse(result, time.Now()))
+}
+
+// AdminUpdateTask godoc
+// @Summary Admin: Update task
+// @Description Replaces the title, description, linked record, assignee and due date of a task. A new assignee is notified.
+// @Tags admin/tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body TaskRequest true "Task"
+// @Success 200 {object} TaskResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tasks/{id} [put]
+func (h *TaskHandler) AdminUpdateTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid task ID"})
+		return
+	}
+
+	var req TaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.taskService.Update(id, c.GetUint64("admin_id"), req.input())
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toTaskResponse(result, time.Now()))
+}
+
+// AdminSetTaskStatus godoc
+// @Summary Admin: Complete or reopen task
+// @Tags admin/tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body SetTaskStatusRequest true "Status"
+// @Success 200 {object} TaskResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tasks/{id}/status [put]
+func (h *TaskHandler) AdminSetTaskStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid task ID"})
+		return
+	}
+
+	var req SetTaskStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.taskService.SetStatus(id, c.GetUint64("admin_id"), domain.AdminTaskStatus(req.Status))
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toTaskResponse(result, time.Now()))
+}
+
+// AdminDeleteTask godoc
+// @Summary Admin: Delete task
+// @Tags admin/tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tasks/{id} [delete]
+func (h *TaskHandler) AdminDeleteTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid task ID"})
+		return
+	}
+
+	if err := h.taskService.Delete(id); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Task deleted"})
+}
+
+func writeTaskError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, task.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Task not found"})
+	case errors.Is(err, task.ErrTitleRequired), errors.Is(err, task.ErrInvalidEntity),
+		errors.Is(err, task.ErrEntityNotFound), errors.Is(err, task.ErrAssigneeNotStaff),
+		errors.Is(err, task.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save task"})
+	}
+}
+
+func toTaskResponse(t *domain.AdminTask, now time.Time) TaskResponse {
+	resp := TaskResponse{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      string(t.Status),
+		EntityType:  string(t.EntityType),
+		EntityID:    t.EntityID,
+		Link:        task.EntityLink(t),
+		AssigneeID:  t.AssigneeID,
+		CreatedBy:   t.CreatedBy,
+		Overdue:     t.IsOverdue(now),
+		CreatedAt:   t.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if t.Assignee != nil {
+		resp.Assignee = t.Assignee.FullName()
+	}
+	if t.DueAt != nil {
+		resp.DueAt = t.DueAt.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	if t.CompletedAt != nil {
+		resp.CompletedAt = t.CompletedAt.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return resp
+}
+
+// Request/Response types
+
+type TaskRequest struct {
+	Title       string     `json:"title" binding:"required"`
+	Description string     `json:"description"`
+	EntityType  string     `json:"entity_type"` // customer, order, invoice, service or ticket
+	EntityID    *uint64    `json:"entity_id"`
+	AssigneeID  *uint64    `json:"assignee_id"`
+	DueAt       *time.Time `json:"due_at"`
+}
+
+func (r TaskRequest) input() task.Input {
+	return task.Input{
+		Title:       r.Title,
+		Description: r.Description,
+		EntityType:  domain.TaskEntity(r.EntityType),
+		EntityID:    r.EntityID,
+		AssigneeID:  r.AssigneeID,
+		DueAt:       r.DueAt,
+	}
+}
+
+type SetTaskStatusRequest struct {
+	Status string `json:"status" binding:"required"` // open or done
+}
+
+type TaskResponse struct {
+	ID          uint64  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	EntityType  string  `json:"entity_type,omitempty"`
+	EntityID    *uint64 `json:"entity_id,omitempty"`
+	Link        string  `json:"link"` // Admin page of the linked record
+	AssigneeID  *uint64 `json:"assignee_id"`
+	Assignee    string  `json:"assignee,omitempty"`
+	CreatedBy   uint64  `json:"created_by"`
+	Overdue     bool    `json:"overdue"`
+	DueAt       string  `json:"due_at,omitempty"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -37,7 +39,7 @@ func (h *TicketHandler) ListTickets(c *gin.Context) {
 	limit, offset := PaginationParams(c)
 	status := domain.TicketStatus(c.Query("status"))
 
-	tickets, total, err := h.ticketService.ListTickets(&userID, status, limit, offset)
+	tickets, total, err := h.ticketService.WithContext(c.Request.Context()).ListTickets(&userID, status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch tickets"})
 		return
@@ -127,9 +129,9 @@ func (h *TicketHandler) CreateTicket(c *gin.Context) {
 
 // ReplyToTicket godoc
 // @Summary Reply to ticket
-// @Description Adds a reply to an existing ticket
+// @Description Adds a reply to an existing ticket. Send multipart/form-data with a "body" field and "attachments" files to attach files of up to 10 MB each.
 // @Tags tickets
-// @Accept json
+// @Accept json,mpfd
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Ticket ID"
@@ -138,6 +140,8 @@ func (h *TicketHandler) CreateTicket(c *gin.Context) {
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/tickets/{id}/reply [post]
 func (h *TicketHandler) ReplyToTicket(c *gin.Context) {
 	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -158,13 +162,46 @@ func (h *TicketHandler) ReplyToTicket(c *gin.Context) {
 	}
 
 	var req ReplyTicketRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var attachments []ticketSvc.AttachmentData
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid form data"})
+			return
+		}
+		defer form.RemoveAll()
+		if req.Body = strings.TrimSpace(c.PostForm("body")); req.Body == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Body is required"})
+			return
+		}
+		for _, header := range form.File["attachments"] {
+			if header.Size > maxTicketAttachmentSize {
+				c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Attachment is too large"})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read attachment"})
+				return
+			}
+			defer file.Close()
+			attachments = append(attachments, ticketSvc.AttachmentData{
+				FileName:    header.Filename,
+				ContentType: header.Header.Get("Content-Type"),
+				Reader:      file,
+				Size:        header.Size,
+			})
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	message, err := h.ticketService.AddReply(ticketID, user.Email, req.Body, user.IsStaff(), nil)
+	message, err := h.ticketService.AddReply(ticketID, user.Email, req.Body, user.IsStaff(), user.IsAdmin(), attachments)
 	if err != nil {
+		if scanError(c, err) {
+			return
+		}
 		if err == ticketSvc.ErrTicketNotFound {
 			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ticket not found"})
 			return
@@ -180,6 +217,58 @@ func (h *TicketHandler) ReplyToTicket(c *gin.Context) {
 	c.JSON(http.StatusCreated, toTicketMessageResponse(message))
 }
 
+// DownloadAttachment godoc
+// @Summary Download ticket attachment
+// @Description Redirects to a short-lived signed URL of an attachment, or returns the file for attachments kept in the database
+// @Tags tickets
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Ticket ID"
+// @Param attachmentId path int true "Attachment ID"
+// @Success 200 {file} file
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/tickets/{id}/attachments/{attachmentId} [get]
+func (h *TicketHandler) DownloadAttachment(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachmentId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid attachment ID"})
+		return
+	}
+
+	user := GetCurrentUser(c)
+	if !user.IsStaff() {
+		if _, err := h.ticketService.GetTicketForCustomer(ticketID, user.ID); err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ticket not found"})
+			return
+		}
+	}
+
+	attachment, err := h.ticketService.GetTicketAttachment(ticketID, attachmentID)
+	if err != nil {
+		if err == ticketSvc.ErrAttachmentNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch attachment"})
+		return
+	}
+
+	url, err := h.ticketService.AttachmentURL(attachment, fileURLExpiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to sign attachment URL"})
+		return
+	}
+	sendFile(c, url, func() (io.ReadCloser, error) {
+		return h.ticketService.OpenAttachment(c.Request.Context(), attachment)
+	}, attachment.FileName, attachment.ContentType, attachment.SizeBytes)
+}
+
 // CloseTicket godoc
 // @Summary Close ticket
 // @Description Closes a support ticket
@@ -260,7 +349,7 @@ func (h *TicketHandler) AdminListTickets(c *gin.Context) {
 	limit, offset := PaginationParams(c)
 	status := domain.TicketStatus(c.Query("status"))
 
-	tickets, total, err := h.ticketService.ListTickets(nil, status, limit, offset)
+	tickets, total, err := h.ticketService.WithContext(c.Request.Context()).ListTickets(nil, status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch tickets"})
 		return
@@ -368,6 +457,47 @@ func (h *TicketHandler) AdminUpdateTicketPriority(c *gin.Context) {
 	c.JSON(http.StatusOK, MessageResponse{Message: "Ticket priority updated"})
 }
 
+// AdminAssignCustomer godoc
+// @Summary Assign ticket customer (Admin)
+// @Description Attaches a ticket to a customer, e.g. one opened by email from an unknown address
+// @Tags admin/tickets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Ticket ID"
+// @Param request body AssignTicketCustomerRequest true "Customer"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/tickets/{id}/customer [put]
+func (h *TicketHandler) AdminAssignCustomer(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ticket ID"})
+		return
+	}
+
+	var req AssignTicketCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.ticketService.AssignCustomer(ticketID, req.CustomerID); err != nil {
+		switch err {
+		case ticketSvc.ErrTicketNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Ticket not found"})
+		case ticketSvc.ErrCustomerNotFound:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Customer not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to assign customer"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Ticket customer assigned"})
+}
+
 // AdminDeleteTicket godoc
 // @Summary Delete ticket (Admin)
 // @Description Deletes a ticket and all its messages
@@ -398,12 +528,18 @@ func (h *TicketHandler) AdminDeleteTicket(c *gin.Context) {
 
 func toTicketResponse(t *domain.Ticket) TicketResponse {
 	return TicketResponse{
-		ID:        t.ID,
-		Subject:   t.Subject,
-		Status:    string(t.Status),
-		Priority:  string(t.Priority),
-		CreatedAt: t.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:            t.ID,
+		Subject:       t.Subject,
+		Status:        string(t.Status),
+		Priority:      string(t.Priority),
+		CustomerID:    t.CustomerID,
+		DepartmentID:  t.DepartmentID,
+		AssigneeID:    t.AssigneeID,
+		UnknownSender: t.UnknownSender,
+		Messages:      t.MessageCount,
+		Answered:      t.LastReplyStaff,
+		CreatedAt:     t.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:     t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
 
@@ -414,14 +550,18 @@ func toTicketDetailResponse(t *domain.Ticket) TicketDetailResponse {
 	}
 
 	return TicketDetailResponse{
-		ID:        t.ID,
-		Subject:   t.Subject,
-		Status:    string(t.Status),
-		Priority:  string(t.Priority),
-		Source:    t.Source,
-		Messages:  messages,
-		CreatedAt: t.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:            t.ID,
+		Subject:       t.Subject,
+		Status:        string(t.Status),
+		Priority:      string(t.Priority),
+		Source:        t.Source,
+		CustomerID:    t.CustomerID,
+		DepartmentID:  t.DepartmentID,
+		AssigneeID:    t.AssigneeID,
+		UnknownSender: t.UnknownSender,
+		Messages:      messages,
+		CreatedAt:     t.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:     t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
 
@@ -437,44 +577,61 @@ func toTicketMessageResponse(m *domain.TicketMessage) TicketMessageResponse {
 	}
 
 	return TicketMessageResponse{
-		ID:          m.ID,
-		SenderEmail: m.SenderEmail,
-		Body:        m.Body,
-		IsStaff:     m.IsStaff,
-		Attachments: attachments,
-		CreatedAt:   m.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:           m.ID,
+		SenderEmail:  m.SenderEmail,
+		Body:         m.Body,
+		BodyHTML:     m.BodyHTML,
+		IsStaff:      m.IsStaff,
+		Attachments:  attachments,
+		CreatedAt:    m.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		OriginalBody: m.OriginalBody,
 	}
 }
 
 // Request/Response types
 
 type TicketResponse struct {
-	ID        uint64 `json:"id"`
-	Subject   string `json:"subject"`
-	Status    string `json:"status"`
-	Priority  string `json:"priority"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID            uint64  `json:"id"`
+	Subject       string  `json:"subject"`
+	Status        string  `json:"status"`
+	Priority      string  `json:"priority"`
+	CustomerID    *uint64 `json:"customer_id,omitempty"`
+	DepartmentID  *uint64 `json:"department_id,omitempty"`
+	AssigneeID    *uint64 `json:"assignee_id,omitempty"` // Staff member handling the ticket
+	UnknownSender bool    `json:"unknown_sender"`        // Opened by email from an address of no customer
+	Messages      int64   `json:"messages"`
+	Answered      bool    `json:"answered"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
 }
 
 type TicketDetailResponse struct {
-	ID        uint64                  `json:"id"`
-	Subject   string                  `json:"subject"`
-	Status    string                  `json:"status"`
-	Priority  string                  `json:"priority"`
-	Source    string                  `json:"source"`
-	Messages  []TicketMessageResponse `json:"messages"`
-	CreatedAt string                  `json:"created_at"`
-	UpdatedAt string                  `json:"updated_at"`
+	ID            uint64                  `json:"id"`
+	Subject       string                  `json:"subject"`
+	Status        string                  `json:"status"`
+	Priority      string                  `json:"priority"`
+	Source        string                  `json:"source"`
+	CustomerID    *uint64                 `json:"customer_id,omitempty"`
+	DepartmentID  *uint64                 `json:"department_id,omitempty"`
+	AssigneeID    *uint64                 `json:"assignee_id,omitempty"`
+	UnknownSender bool                    `json:"unknown_sender"`
+	Messages      []TicketMessageResponse `json:"messages"`
+	CreatedAt     string                  `json:"created_at"`
+	UpdatedAt     string                  `json:"updated_at"`
 }
 
 type TicketMessageResponse struct {
 	ID          uint64                     `json:"id"`
 	SenderEmail string                     `json:"sender_email"`
 	Body        string                     `json:"body"`
+	BodyHTML    string                     `json:"body_html"` // Body rendered from Markdown and sanitized
 	IsStaff     bool                       `json:"is_staff"`
 	Attachments []TicketAttachmentResponse `json:"attachments,omitempty"`
 	CreatedAt   string                     `json:"created_at"`
+
+	// Full text of an emailed message before quoted history and the
+	// signature were removed
+	OriginalBody string `json:"original_body,omitempty"`
 }
 
 type TicketAttachmentResponse struct {
@@ -514,3 +671,7 @@ type UpdateTicketStatusRequest struct {
 type UpdateTicketPriorityRequest struct {
 	Priority string `json:"priority" binding:"required"`
 }
+
+type AssignTicketCustomerRequest struct {
+	CustomerID uint64 `json:"customer_id" binding:"required"`
+}
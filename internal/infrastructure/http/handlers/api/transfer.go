@@ -0,0 +1,272 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/transfer"
+)
+
+// TransferHandler handles service transfer endpoints
+type TransferHandler struct {
+	transferService *transfer.Service
+}
+
+// NewTransferHandler creates a new transfer handler
+func NewTransferHandler(transferService *transfer.Service) *TransferHandler {
+	return &TransferHandler{transferService: transferService}
+}
+
+// InitiateTransfer godoc
+// @Summary Transfer service
+// @Description Starts moving a service to another customer account. The returned code is shared with the recipient, who accepts it within 7 days.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Service ID"
+// @Param request body InitiateTransferRequest false "Recipient"
+// @Success 201 {object} ServiceTransferResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/services/{id}/transfer [post]
+func (h *TransferHandler) InitiateTransfer(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	serviceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req InitiateTransferRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	t, err := h.transferService.InitiateTransfer(userID, serviceID, req.RecipientEmail)
+	if err != nil {
+		writeTransferError(c, err, "Failed to start transfer")
+		return
+	}
+
+	resp := toServiceTransferResponse(t)
+	resp.Code = t.Code
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListOutgoingTransfers godoc
+// @Summary List outgoing transfers
+// @Description Returns the service transfers started by the current user
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ServiceTransferResponse
+// @Router /api/v1/service-transfers [get]
+func (h *TransferHandler) ListOutgoingTransfers(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	transfers, err := h.transferService.ListOutgoing(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch transfers"})
+		return
+	}
+
+	response := make([]ServiceTransferResponse, 0, len(transfers))
+	for i := range transfers {
+		resp := toServiceTransferResponse(&transfers[i])
+		if transfers[i].IsValid() {
+			resp.Code = transfers[i].Code
+		}
+		response = append(response, resp)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelTransfer godoc
+// @Summary Cancel transfer
+// @Description Withdraws a pending transfer started by the current user
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/service-transfers/{id}/cancel [post]
+func (h *TransferHandler) CancelTransfer(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	transferID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid transfer ID"})
+		return
+	}
+
+	if err := h.transferService.CancelTransfer(userID, transferID); err != nil {
+		writeTransferError(c, err, "Failed to cancel transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Transfer cancelled"})
+}
+
+// LookupTransfer godoc
+// @Summary Look up transfer
+// @Description Returns the service offered by a transfer code so it can be reviewed before accepting
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "Transfer code"
+// @Success 200 {object} ServiceTransferResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/service-transfers/code/{code} [get]
+func (h *TransferHandler) LookupTransfer(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	t, err := h.transferService.GetTransferByCode(userID, c.Param("code"))
+	if err != nil {
+		writeTransferError(c, err, "Failed to fetch transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceTransferResponse(t))
+}
+
+// AcceptTransfer godoc
+// @Summary Accept transfer
+// @Description Moves a service to the current user's account. Invoices issued before the transfer stay with the sender, except unpaid ones for periods that have not started.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AcceptTransferRequest true "Transfer code"
+// @Success 200 {object} ServiceTransferResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/service-transfers/accept [post]
+func (h *TransferHandler) AcceptTransfer(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	var req AcceptTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	t, err := h.transferService.AcceptTransfer(userID, req.Code)
+	if err != nil {
+		writeTransferError(c, err, "Failed to accept transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, toServiceTransferResponse(t))
+}
+
+// AdminListTransfers godoc
+// @Summary List service transfers (Admin)
+// @Tags admin/services
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (pending, accepted, cancelled)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/service-transfers [get]
+func (h *TransferHandler) AdminListTransfers(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	transfers, total, err := h.transferService.ListTransfers(domain.ServiceTransferStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch transfers"})
+		return
+	}
+
+	response := make([]ServiceTransferResponse, 0, len(transfers))
+	for i := range transfers {
+		resp := toServiceTransferResponse(&transfers[i])
+		resp.FromEmail = transfers[i].FromCustomer.Email
+		if transfers[i].ToCustomer != nil {
+			resp.ToEmail = transfers[i].ToCustomer.Email
+		}
+		response = append(response, resp)
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+func writeTransferError(c *gin.Context, err error, failure string) {
+	switch err {
+	case transfer.ErrServiceNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Service not found"})
+	case transfer.ErrTransferNotFound, transfer.ErrTransferInvalid:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case transfer.ErrRecipientMismatch:
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case transfer.ErrServiceNotActive, transfer.ErrSelfTransfer, transfer.ErrInvalidRecipient:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case transfer.ErrTransferPending, transfer.ErrTransferNotPending, transfer.ErrOwnerChanged,
+		transfer.ErrServiceCancelling, transfer.ErrCycleChangePending:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: failure})
+	}
+}
+
+func toServiceTransferResponse(t *domain.ServiceTransfer) ServiceTransferResponse {
+	status := string(t.Status)
+	if t.Status == domain.ServiceTransferStatusPending && !t.IsValid() {
+		status = "expired"
+	}
+
+	resp := ServiceTransferResponse{
+		ID:             t.ID,
+		ServiceID:      t.ServiceID,
+		ProductName:    t.Service.Product.Name,
+		Domain:         t.Service.Domain,
+		Status:         status,
+		RecipientEmail: t.RecipientEmail,
+		MovedInvoices:  t.MovedInvoices,
+		ExpiresAt:      t.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:      t.CreatedAt.Format(time.RFC3339),
+	}
+	if t.AcceptedAt != nil {
+		resp.AcceptedAt = t.AcceptedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type InitiateTransferRequest struct {
+	RecipientEmail string `json:"recipient_email"`
+}
+
+type AcceptTransferRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ServiceTransferResponse struct {
+	ID             uint64 `json:"id"`
+	ServiceID      uint64 `json:"service_id"`
+	ProductName    string `json:"product_name"`
+	Domain         string `json:"domain,omitempty"`
+	Status         string `json:"status"`
+	Code           string `json:"code,omitempty"`
+	RecipientEmail string `json:"recipient_email,omitempty"`
+	FromEmail      string `json:"from_email,omitempty"`
+	ToEmail        string `json:"to_email,omitempty"`
+	MovedInvoices  int    `json:"moved_invoices"`
+	ExpiresAt      string `json:"expires_at"`
+	AcceptedAt     string `json:"accepted_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
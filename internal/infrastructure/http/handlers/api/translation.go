@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// TranslationHandler handles the translation endpoints used by translators
+// to find missing keys and to load translation packs at runtime
+type TranslationHandler struct {
+	renderer *web.Renderer
+}
+
+// NewTranslationHandler creates a new translation handler
+func NewTranslationHandler(renderer *web.Renderer) *TranslationHandler {
+	return &TranslationHandler{renderer: renderer}
+}
+
+// GetMissingKeys returns the translation report of the loaded languages
+// @Summary Get missing translation keys
+// @Description Get, per language, the keys looked up at runtime without a translation and the keys of the fallback language the language does not translate
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param lang query string false "Language code"
+// @Success 200 {object} TranslationReportResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/translations/missing [get]
+func (h *TranslationHandler) GetMissingKeys(c *gin.Context) {
+	manager := h.renderer.I18nManager()
+
+	var languages []*i18n.Language
+	if code := c.Query("lang"); code != "" {
+		language := manager.GetLanguage(code)
+		if language == nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "language not found"})
+			return
+		}
+		languages = append(languages, language)
+	} else {
+		languages = manager.GetLanguages()
+		sort.Slice(languages, func(i, j int) bool {
+			return languages[i].Code < languages[j].Code
+		})
+	}
+
+	response := TranslationReportResponse{Languages: make([]LanguageReportResponse, 0, len(languages))}
+	for _, language := range languages {
+		response.Languages = append(response.Languages, LanguageReportResponse{
+			Code:         language.Code,
+			Name:         language.Name,
+			Direction:    language.Dir(),
+			Missing:      manager.MissingKeys(language.Code),
+			Untranslated: manager.UntranslatedKeys(language.Code),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetMissingKeys forgets the recorded missing keys
+// @Summary Reset missing translation keys
+// @Description Forget the keys recorded as missing for a language, or for all languages
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param lang query string false "Language code"
+// @Success 200 {object} MessageResponse
+// @Router /api/v1/admin/translations/missing [delete]
+func (h *TranslationHandler) ResetMissingKeys(c *gin.Context) {
+	h.renderer.I18nManager().ResetMissingKeys(c.Query("lang"))
+	c.JSON(http.StatusOK, MessageResponse{Message: "Missing keys reset"})
+}
+
+// ReloadTranslations loads the translations again
+// @Summary Reload translations
+// @Description Load the built-in translations and the translation packs in the locales directory again, so added or changed packs take effect without a restart
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MessageResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/admin/translations/reload [post]
+func (h *TranslationHandler) ReloadTranslations(c *gin.Context) {
+	if err := h.renderer.ReloadTranslations(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Translations reloaded"})
+}
+
+// Request/Response types
+
+// TranslationReportResponse lists the translation gaps of the languages
+type TranslationReportResponse struct {
+	Languages []LanguageReportResponse `json:"languages"`
+}
+
+// LanguageReportResponse lists the translation gaps of a language
+type LanguageReportResponse struct {
+	Code         string            `json:"code"`
+	Name         string            `json:"name"`
+	Direction    string            `json:"direction"`
+	Missing      []i18n.MissingKey `json:"missing"`
+	Untranslated []string          `json:"untranslated"`
+}
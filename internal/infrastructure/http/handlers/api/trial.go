@@ -0,0 +1,325 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/stock"
+	"github.com/openhost/openhost/internal/core/service/trial"
+)
+
+// TrialHandler handles free trial endpoints
+type TrialHandler struct {
+	trialService *trial.Service
+}
+
+// NewTrialHandler creates a new trial handler
+func NewTrialHandler(trialService *trial.Service) *TrialHandler {
+	return &TrialHandler{trialService: trialService}
+}
+
+// GetProductTrial godoc
+// @Summary Get product trial offer
+// @Description Returns whether a product can be tried for free and on which terms
+// @Tags trials
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Success 200 {object} TrialConfigResponse
+// @Router /api/v1/trial-offers/{product_id} [get]
+func (h *TrialHandler) GetProductTrial(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	config, err := h.trialService.GetConfig(productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch trial"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toTrialConfigResponse(config))
+}
+
+// StartTrial godoc
+// @Summary Start free trial
+// @Description Signs the current user up for a free trial of a product. A zero-amount order is placed and the service is billed when the trial ends.
+// @Tags trials
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body StartTrialRequest true "Trial signup"
+// @Success 201 {object} TrialResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/trials [post]
+func (h *TrialHandler) StartTrial(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+
+	var req StartTrialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	t, err := h.trialService.StartTrial(userID, req.ProductID, trial.StartRequest{
+		BillingCycle:    req.BillingCycle,
+		Currency:        req.Currency,
+		PaymentMethodID: req.PaymentMethodID,
+		Domain:          req.Domain,
+		Hostname:        req.Hostname,
+		IPAddress:       c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case err == trial.ErrProductNotFound, err == trial.ErrPaymentMethodNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		case err == trial.ErrTrialNotAvailable:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		case err == trial.ErrPaymentMethodRequired:
+			c.JSON(http.StatusPaymentRequired, ErrorResponse{Error: err.Error()})
+		case err == trial.ErrTrialLimitReached, errors.Is(err, stock.ErrOutOfStock):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start trial"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, toTrialResponse(t))
+}
+
+// ListTrials godoc
+// @Summary List trials
+// @Description Returns the current user's free trials
+// @Tags trials
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (active, converted, expired, cancelled)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/trials [get]
+func (h *TrialHandler) ListTrials(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	limit, offset := PaginationParams(c)
+
+	trials, total, err := h.trialService.ListTrials(userID, domain.TrialStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch trials"})
+		return
+	}
+
+	response := make([]TrialResponse, 0, len(trials))
+	for i := range trials {
+		response = append(response, toTrialResponse(&trials[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// CancelTrial godoc
+// @Summary Cancel trial
+// @Description Ends an active trial without converting it. The trial service is cancelled and no invoice is issued.
+// @Tags trials
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Trial ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/trials/{id}/cancel [post]
+func (h *TrialHandler) CancelTrial(c *gin.Context) {
+	userID := GetCurrentUserID(c)
+	trialID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trial ID"})
+		return
+	}
+
+	if err := h.trialService.CancelTrial(userID, trialID); err != nil {
+		switch err {
+		case trial.ErrTrialNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trial not found"})
+		case trial.ErrTrialNotActive:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to cancel trial"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Trial cancelled"})
+}
+
+// AdminListTrials godoc
+// @Summary List trials (Admin)
+// @Tags admin/trials
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (active, converted, expired, cancelled)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} PaginatedResponse
+// @Router /api/v1/admin/trials [get]
+func (h *TrialHandler) AdminListTrials(c *gin.Context) {
+	limit, offset := PaginationParams(c)
+
+	trials, total, err := h.trialService.ListTrials(0, domain.TrialStatus(c.Query("status")), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch trials"})
+		return
+	}
+
+	response := make([]TrialResponse, 0, len(trials))
+	for i := range trials {
+		response = append(response, toTrialResponse(&trials[i]))
+	}
+
+	c.JSON(http.StatusOK, NewPaginatedResponse(response, total, limit, offset))
+}
+
+// AdminSetProductTrial godoc
+// @Summary Set product trial (Admin)
+// @Description Configures the free trial of a product
+// @Tags admin/trials
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Product ID"
+// @Param request body SetTrialConfigRequest true "Trial settings"
+// @Success 200 {object} TrialConfigResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/products/{id}/trial [put]
+func (h *TrialHandler) AdminSetProductTrial(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product ID"})
+		return
+	}
+
+	var req SetTrialConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	settings := trial.Settings{
+		Enabled:          req.Enabled,
+		Days:             req.Days,
+		RequirePayment:   req.RequirePayment,
+		LimitPerCustomer: 1,
+		AutoActivate:     true,
+		ConvertToService: true,
+	}
+	if req.LimitPerCustomer != nil {
+		settings.LimitPerCustomer = *req.LimitPerCustomer
+	}
+	if req.AutoActivate != nil {
+		settings.AutoActivate = *req.AutoActivate
+	}
+	if req.ConvertToService != nil {
+		settings.ConvertToService = *req.ConvertToService
+	}
+
+	config, err := h.trialService.SetConfig(productID, settings)
+	if err != nil {
+		switch err {
+		case trial.ErrProductNotFound:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found"})
+		case trial.ErrInvalidDays:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update trial"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toTrialConfigResponse(config))
+}
+
+func toTrialConfigResponse(config *domain.FreeTrialConfig) TrialConfigResponse {
+	return TrialConfigResponse{
+		ProductID:        config.ProductID,
+		Enabled:          config.Enabled,
+		Days:             config.Days,
+		RequirePayment:   config.RequirePayment,
+		LimitPerCustomer: config.LimitPerCustomer,
+		AutoActivate:     config.AutoActivate,
+		ConvertToService: config.ConvertToService,
+	}
+}
+
+func toTrialResponse(t *domain.ProductTrial) TrialResponse {
+	resp := TrialResponse{
+		ID:              t.ID,
+		CustomerID:      t.CustomerID,
+		ProductID:       t.ProductID,
+		ProductName:     t.Product.Name,
+		OrderID:         t.OrderID,
+		ServiceID:       t.ServiceID,
+		PaymentMethodID: t.PaymentMethodID,
+		InvoiceID:       t.InvoiceID,
+		Status:          string(t.Status),
+		EndsAt:          t.EndsAt.Format(time.RFC3339),
+		CreatedAt:       t.CreatedAt.Format(time.RFC3339),
+	}
+	if t.ConvertedAt != nil {
+		resp.ConvertedAt = t.ConvertedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type StartTrialRequest struct {
+	ProductID       uint64  `json:"product_id" binding:"required"`
+	BillingCycle    string  `json:"billing_cycle"`
+	Currency        string  `json:"currency"`
+	PaymentMethodID *uint64 `json:"payment_method_id"`
+	Domain          string  `json:"domain"`
+	Hostname        string  `json:"hostname"`
+}
+
+type SetTrialConfigRequest struct {
+	Enabled          bool  `json:"enabled"`
+	Days             int   `json:"days" binding:"required,min=1"`
+	RequirePayment   bool  `json:"require_payment"`
+	LimitPerCustomer *int  `json:"limit_per_customer"`
+	AutoActivate     *bool `json:"auto_activate"`
+	ConvertToService *bool `json:"convert_to_service"`
+}
+
+type TrialConfigResponse struct {
+	ProductID        uint64 `json:"product_id"`
+	Enabled          bool   `json:"enabled"`
+	Days             int    `json:"days"`
+	RequirePayment   bool   `json:"require_payment"`
+	LimitPerCustomer int    `json:"limit_per_customer"`
+	AutoActivate     bool   `json:"auto_activate"`
+	ConvertToService bool   `json:"convert_to_service"`
+}
+
+type TrialResponse struct {
+	ID              uint64  `json:"id"`
+	CustomerID      uint64  `json:"customer_id"`
+	ProductID       uint64  `json:"product_id"`
+	ProductName     string  `json:"product_name,omitempty"`
+	OrderID         uint64  `json:"order_id"`
+	ServiceID       uint64  `json:"service_id"`
+	PaymentMethodID *uint64 `json:"payment_method_id,omitempty"`
+	InvoiceID       *uint64 `json:"invoice_id,omitempty"`
+	Status          string  `json:"status"`
+	EndsAt          string  `json:"ends_at"`
+	ConvertedAt     string  `json:"converted_at,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/vat"
+)
+
+// VATHandler handles VAT numbers, their VIES checks and the seller's VAT
+// settings
+type VATHandler struct {
+	vatService *vat.Service
+}
+
+// NewVATHandler creates a new VAT handler
+func NewVATHandler(vatService *vat.Service) *VATHandler {
+	return &VATHandler{vatService: vatService}
+}
+
+// UpdateVATNumber godoc
+// @Summary Set VAT number
+// @Description Checks the customer's VAT number with VIES and stores it. Numbers of EU customers must be issued by the country of their billing address and valid; with a valid number in another member state than the seller the customer is reverse charged. When VIES is unavailable the number is stored unchecked and VAT is charged. An empty number removes it.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VATNumberRequest true "VAT number"
+// @Success 200 {object} VATNumberResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/account/vat-number [put]
+func (h *VATHandler) UpdateVATNumber(c *gin.Context) {
+	var req VATNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID := GetCurrentUserID(c)
+	if _, err := h.vatService.SetCustomerVATNumber(c.Request.Context(), userID, req.VATNumber, time.Now()); err != nil && err != vat.ErrVIESUnavailable {
+		writeVATError(c, err)
+		return
+	}
+
+	h.GetVATNumber(c)
+}
+
+// GetVATNumber godoc
+// @Summary Get VAT number
+// @Description Returns the customer's VAT number, its last VIES check and whether they are reverse charged
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} VATNumberResponse
+// @Router /api/v1/account/vat-number [get]
+func (h *VATHandler) GetVATNumber(c *gin.Context) {
+	customer, err := h.vatService.Customer(GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch VAT number"})
+		return
+	}
+
+	resp := VATNumberResponse{VATNumber: customer.VATNumber, ReverseCharge: customer.ReverseCharge}
+	if customer.Check != nil {
+		check := toVATValidationResponse(customer.Check)
+		resp.Check = &check
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AdminGetVATSettings godoc
+// @Summary Get VAT settings (Admin)
+// @Description Returns the seller's country and VAT number. Customers in other EU member states with a valid VAT number are reverse charged.
+// @Tags admin/tax
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} VATSettingsRequest
+// @Router /api/v1/admin/tax/vat [get]
+func (h *VATHandler) AdminGetVATSettings(c *gin.Context) {
+	settings, err := h.vatService.Settings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch VAT settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, VATSettingsRequest{SellerCountry: settings.SellerCountry, SellerVATNumber: settings.SellerVATNumber})
+}
+
+// AdminUpdateVATSettings godoc
+// @Summary Update VAT settings (Admin)
+// @Description Sets the seller's EU country and VAT number. The VAT number is sent along with VIES checks so they get a consultation number. An empty country turns reverse charging off.
+// @Tags admin/tax
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VATSettingsRequest true "VAT settings"
+// @Success 200 {object} VATSettingsRequest
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/admin/tax/vat [put]
+func (h *VATHandler) AdminUpdateVATSettings(c *gin.Context) {
+	var req VATSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	settings, err := h.vatService.UpdateSettings(vat.Settings{SellerCountry: req.SellerCountry, SellerVATNumber: req.SellerVATNumber})
+	if err != nil {
+		writeVATError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, VATSettingsRequest{SellerCountry: settings.SellerCountry, SellerVATNumber: settings.SellerVATNumber})
+}
+
+// AdminCheckVATNumber godoc
+// @Summary Check VAT number (Admin)
+// @Description Checks a VAT number with its country prefix with VIES now, bypassing the cache, and stores the result
+// @Tags admin/tax
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VATNumberRequest true "VAT number"
+// @Success 200 {object} VATValidationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/v1/admin/tax/vat/check [post]
+func (h *VATHandler) AdminCheckVATNumber(c *gin.Context) {
+	var req VATNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	validation, err := h.vatService.Check(c.Request.Context(), req.VATNumber, true, time.Now())
+	if err != nil {
+		writeVATError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toVATValidationResponse(validation))
+}
+
+func writeVATError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, vat.ErrInvalidVATNumber), err == vat.ErrVATFormat, err == vat.ErrCountryMismatch,
+		err == vat.ErrInvalidSeller, err == vat.ErrSellerVATMismatch:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err == vat.ErrCustomerNotFound:
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case err == vat.ErrVIESUnavailable:
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check VAT number"})
+	}
+}
+
+func toVATValidationResponse(v *domain.VATValidation) VATValidationResponse {
+	return VATValidationResponse{
+		VATNumber:          v.VATNumber,
+		Valid:              v.Valid,
+		Name:               v.Name,
+		Address:            v.Address,
+		ConsultationNumber: v.ConsultationNumber,
+		CheckedAt:          v.CheckedAt.Format(time.RFC3339),
+	}
+}
+
+// Request/Response types
+
+type VATNumberRequest struct {
+	VATNumber string `json:"vat_number" binding:"max=50"`
+}
+
+type VATNumberResponse struct {
+	VATNumber     string                 `json:"vat_number"`
+	ReverseCharge bool                   `json:"reverse_charge"`
+	Check         *VATValidationResponse `json:"check"` // Last VIES check, none when never checked
+}
+
+type VATValidationResponse struct {
+	VATNumber          string `json:"vat_number"`
+	Valid              bool   `json:"valid"`
+	Name               string `json:"name"`
+	Address            string `json:"address"`
+	ConsultationNumber string `json:"consultation_number"`
+	CheckedAt          string `json:"checked_at"`
+}
+
+type VATSettingsRequest struct {
+	SellerCountry   string `json:"seller_country" binding:"max=2"` // ISO 3166-1 alpha-2, empty turns reverse charging off
+	SellerVATNumber string `json:"seller_vat_number" binding:"max=20"`
+}
@@ -0,0 +1,560 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/invoice"
+	"github.com/openhost/openhost/internal/core/service/whmcs"
+)
+
+// WHMCSHandler serves the WHMCS compatible /includes/api.php endpoint and
+// the admin endpoints managing its credentials
+type WHMCSHandler struct {
+	whmcsService *whmcs.Service
+	allowedIPs   []string
+	accessKey    string
+}
+
+// NewWHMCSHandler creates a new WHMCS compatibility handler. Requests from
+// addresses outside allowedIPs must pass accessKey; an empty allowedIPs
+// accepts any address.
+func NewWHMCSHandler(whmcsService *whmcs.Service, allowedIPs []string, accessKey string) *WHMCSHandler {
+	return &WHMCSHandler{whmcsService: whmcsService, allowedIPs: allowedIPs, accessKey: accessKey}
+}
+
+// KeyMiddleware authenticates WHMCS API requests by their address or
+// access key and their credential, whose staff member becomes the current
+// user
+func (h *WHMCSHandler) KeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.allowed(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, WHMCSResult{Result: "error", Message: "Invalid IP " + c.ClientIP()})
+			return
+		}
+		key, err := h.whmcsService.Authenticate(whmcsParam(c, "identifier"), whmcsParam(c, "secret"))
+		if err != nil {
+			if err == whmcs.ErrAuthenticationFailed {
+				c.AbortWithStatusJSON(http.StatusForbidden, WHMCSResult{Result: "error", Message: "Authentication Failed"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, WHMCSResult{Result: "error", Message: "An internal error occurred"})
+			return
+		}
+		SetCurrentUser(c, &key.User)
+		setRequestAPIKey(c, key)
+		c.Set(apiActionContextKey, whmcsParam(c, "action"))
+		c.Next()
+	}
+}
+
+// API godoc
+// @Summary WHMCS compatible API
+// @Description Implements the AddClient, GetClientsProducts, AddInvoicePayment and OpenTicket actions of the WHMCS API. Parameters are form encoded as in WHMCS; authenticate with identifier and secret. Only JSON responses are supported.
+// @Tags whmcs
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param action formData string true "API action"
+// @Param identifier formData string true "API identifier"
+// @Param secret formData string true "API secret"
+// @Param accesskey formData string false "Access key for addresses outside the allowed IPs"
+// @Param responsetype formData string false "Response type (json)"
+// @Success 200 {object} WHMCSResult
+// @Failure 403 {object} WHMCSResult
+// @Router /includes/api.php [post]
+func (h *WHMCSHandler) API(c *gin.Context) {
+	if responseType := whmcsParam(c, "responsetype"); responseType != "" && !strings.EqualFold(responseType, "json") {
+		c.JSON(http.StatusOK, WHMCSResult{Result: "error", Message: "Only the json response type is supported"})
+		return
+	}
+
+	switch strings.ToLower(whmcsParam(c, "action")) {
+	case "addclient":
+		h.addClient(c)
+	case "getclientsproducts":
+		h.getClientsProducts(c)
+	case "addinvoicepayment":
+		h.addInvoicePayment(c)
+	case "openticket":
+		h.openTicket(c)
+	default:
+		c.JSON(http.StatusOK, WHMCSResult{Result: "error", Message: "Command Not Found"})
+	}
+}
+
+func (h *WHMCSHandler) addClient(c *gin.Context) {
+	user, err := h.whmcsService.AddClient(whmcs.ClientDetails{
+		FirstName:  whmcsParam(c, "firstname"),
+		LastName:   whmcsParam(c, "lastname"),
+		Email:      whmcsParam(c, "email"),
+		Password:   whmcsParam(c, "password2"),
+		Company:    whmcsParam(c, "companyname"),
+		Address1:   whmcsParam(c, "address1"),
+		Address2:   whmcsParam(c, "address2"),
+		City:       whmcsParam(c, "city"),
+		State:      whmcsParam(c, "state"),
+		PostalCode: whmcsParam(c, "postcode"),
+		Country:    whmcsParam(c, "country"),
+		Phone:      whmcsParam(c, "phonenumber"),
+		Language:   whmcsParam(c, "language"),
+	})
+	if err != nil {
+		switch err {
+		case whmcs.ErrInvalidClient:
+			writeWHMCSError(c, "You did not enter the first name, last name and email address")
+		case auth.ErrEmailExists:
+			writeWHMCSError(c, "A user already exists with that email address")
+		case auth.ErrPasswordTooShort:
+			writeWHMCSError(c, "Password must be at least 8 characters")
+		default:
+			writeWHMCSError(c, "Failed to create client")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, WHMCSAddClientResponse{Result: "success", ClientID: user.ID})
+}
+
+func (h *WHMCSHandler) getClientsProducts(c *gin.Context) {
+	filter := whmcs.ServiceFilter{
+		ClientID:  whmcsID(c, "clientid"),
+		ServiceID: whmcsID(c, "serviceid"),
+		ProductID: whmcsID(c, "pid"),
+		Domain:    whmcsParam(c, "domain"),
+		Username:  whmcsParam(c, "username2"),
+	}
+	offset, _ := strconv.Atoi(whmcsParam(c, "limitstart"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(whmcsParam(c, "limitnum"))
+	if limit <= 0 {
+		limit = 25
+	}
+
+	services, total, err := h.whmcsService.ListClientServices(filter, limit, offset)
+	if err != nil {
+		if err == whmcs.ErrClientNotFound {
+			writeWHMCSError(c, "Client ID Not Found")
+			return
+		}
+		writeWHMCSError(c, "Failed to fetch products")
+		return
+	}
+
+	response := WHMCSProductsResponse{
+		Result:       "success",
+		ClientID:     filter.ClientID,
+		ServiceID:    filter.ServiceID,
+		PID:          filter.ProductID,
+		Domain:       filter.Domain,
+		TotalResults: total,
+		StartNumber:  offset,
+		NumReturned:  len(services),
+	}
+	response.Products.Product = make([]WHMCSProduct, 0, len(services))
+	for i := range services {
+		response.Products.Product = append(response.Products.Product, toWHMCSProduct(&services[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *WHMCSHandler) addInvoicePayment(c *gin.Context) {
+	invoiceID := whmcsID(c, "invoiceid")
+	if invoiceID == 0 {
+		writeWHMCSError(c, "Invoice ID Not Found")
+		return
+	}
+	amount := decimal.Zero
+	if value := whmcsParam(c, "amount"); value != "" {
+		parsed, err := decimal.NewFromString(value)
+		if err != nil {
+			writeWHMCSError(c, "Invalid amount")
+			return
+		}
+		amount = parsed
+	}
+
+	_, err := h.whmcsService.AddInvoicePayment(invoiceID, amount, whmcsParam(c, "gateway"), whmcsParam(c, "transid"))
+	if err != nil {
+		switch err {
+		case whmcs.ErrInvoiceNotFound, invoice.ErrInvoiceNotFound:
+			writeWHMCSError(c, "Invoice ID Not Found")
+		case invoice.ErrInvoiceAlreadyPaid:
+			writeWHMCSError(c, "Invoice is already paid")
+		case invoice.ErrInvoiceCancelled:
+			writeWHMCSError(c, "Invoice is cancelled")
+		case invoice.ErrInvalidAmount:
+			writeWHMCSError(c, "Invalid amount")
+		default:
+			writeWHMCSError(c, "Failed to add payment")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, WHMCSResult{Result: "success"})
+}
+
+func (h *WHMCSHandler) openTicket(c *gin.Context) {
+	t, err := h.whmcsService.OpenTicket(whmcs.TicketDetails{
+		ClientID: whmcsID(c, "clientid"),
+		Name:     whmcsParam(c, "name"),
+		Email:    whmcsParam(c, "email"),
+		Subject:  whmcsParam(c, "subject"),
+		Message:  whmcsParam(c, "message"),
+		Priority: whmcsPriority(whmcsParam(c, "priority")),
+	})
+	if err != nil {
+		switch err {
+		case whmcs.ErrInvalidTicket:
+			writeWHMCSError(c, "Subject and Message are required")
+		case whmcs.ErrTicketSender:
+			writeWHMCSError(c, "Name and email address are required if not a client")
+		case whmcs.ErrClientNotFound:
+			writeWHMCSError(c, "Client ID Not Found")
+		default:
+			writeWHMCSError(c, "Failed to open ticket")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, WHMCSOpenTicketResponse{
+		Result: "success",
+		ID:     t.ID,
+		TID:    strconv.FormatUint(t.ID, 10),
+	})
+}
+
+// allowed checks the client address against the allowed IPs, falling back
+// to the access key
+func (h *WHMCSHandler) allowed(c *gin.Context) bool {
+	if len(h.allowedIPs) == 0 {
+		return true
+	}
+	ip := c.ClientIP()
+	for _, allowed := range h.allowedIPs {
+		if allowed == ip {
+			return true
+		}
+	}
+	key := whmcsParam(c, "accesskey")
+	return h.accessKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(h.accessKey)) == 1
+}
+
+// AdminListCredentials godoc
+// @Summary List WHMCS API credentials (Admin)
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} WHMCSCredentialResponse
+// @Router /api/v1/admin/whmcs-credentials [get]
+func (h *WHMCSHandler) AdminListCredentials(c *gin.Context) {
+	keys, err := h.whmcsService.ListCredentials()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch credentials"})
+		return
+	}
+
+	response := make([]WHMCSCredentialResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, toWHMCSCredentialResponse(&keys[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateCredential godoc
+// @Summary Create WHMCS API credential (Admin)
+// @Description Issues an API identifier and secret for the WHMCS compatible API acting as the current admin. The secret is only returned once.
+// @Tags admin/settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateWHMCSCredentialRequest false "Credential"
+// @Success 201 {object} WHMCSCredentialResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/admin/whmcs-credentials [post]
+func (h *WHMCSHandler) AdminCreateCredential(c *gin.Context) {
+	var req CreateWHMCSCredentialRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	credential, err := h.whmcsService.CreateCredential(GetCurrentUserID(c), req.Name)
+	if err != nil {
+		if err == whmcs.ErrNotStaff {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create credential"})
+		return
+	}
+
+	resp := toWHMCSCredentialResponse(&credential.Key)
+	resp.Identifier = credential.Identifier
+	resp.Secret = credential.Secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// AdminRevokeCredential godoc
+// @Summary Revoke WHMCS API credential (Admin)
+// @Tags admin/settings
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Credential ID"
+// @Success 200 {object} MessageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/admin/whmcs-credentials/{id} [delete]
+func (h *WHMCSHandler) AdminRevokeCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid credential ID"})
+		return
+	}
+
+	if err := h.whmcsService.RevokeCredential(id); err != nil {
+		if err == whmcs.ErrCredentialNotFound {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Credential not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke credential"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Credential revoked"})
+}
+
+func writeWHMCSError(c *gin.Context, message string) {
+	c.JSON(http.StatusOK, WHMCSResult{Result: "error", Message: message})
+}
+
+// whmcsParam reads a WHMCS API parameter from the form body or the query
+func whmcsParam(c *gin.Context, key string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(c.Query(key))
+}
+
+func whmcsID(c *gin.Context, key string) uint64 {
+	id, _ := strconv.ParseUint(whmcsParam(c, key), 10, 64)
+	return id
+}
+
+func whmcsPriority(priority string) domain.TicketPriority {
+	switch strings.ToLower(priority) {
+	case "low":
+		return domain.TicketPriorityLow
+	case "high":
+		return domain.TicketPriorityHigh
+	default:
+		return domain.TicketPriorityNormal
+	}
+}
+
+// whmcsBillingCycles maps OpenHost billing cycles to their WHMCS names
+var whmcsBillingCycles = map[string]string{
+	"monthly":       "Monthly",
+	"quarterly":     "Quarterly",
+	"semi-annually": "Semi-Annually",
+	"semiannually":  "Semi-Annually",
+	"annually":      "Annually",
+	"yearly":        "Annually",
+	"biennially":    "Biennially",
+	"triennially":   "Triennially",
+	"onetime":       "One Time",
+	"free":          "Free Account",
+}
+
+func toWHMCSProduct(cs *whmcs.ClientService) WHMCSProduct {
+	s := &cs.Service
+	product := WHMCSProduct{
+		ID:               s.ID,
+		ClientID:         s.CustomerID,
+		PID:              s.ProductID,
+		RegDate:          s.RegistrationDate.Format("2006-01-02"),
+		Name:             s.Product.Name,
+		TranslatedName:   s.Product.Name,
+		GroupName:        cs.GroupName,
+		Domain:           s.Domain,
+		SuspensionReason: s.SuspensionReason,
+		RecurringAmount:  formatAmount(s.RecurringAmount, s.Currency),
+		BillingCycle:     whmcsBillingCycles[s.BillingCycle],
+		NextDueDate:      s.NextDueDate.Format("2006-01-02"),
+		Status:           whmcsStatus(string(s.Status)),
+		Username:         s.Username,
+		Notes:            s.Notes,
+	}
+	if product.BillingCycle == "" {
+		product.BillingCycle = s.BillingCycle
+	}
+	if s.OrderID != nil {
+		product.OrderID = *s.OrderID
+	}
+	if s.Order != nil {
+		product.OrderNumber = s.Order.OrderNumber
+	}
+	if s.ServerID != nil {
+		product.ServerID = *s.ServerID
+	}
+	if s.Server != nil {
+		product.ServerName = s.Server.Name
+		product.ServerIP = s.Server.IPAddress
+		product.ServerHostname = s.Server.Hostname
+	}
+	if s.IPAddress != nil {
+		product.DedicatedIP = s.IPAddress.IP
+	}
+
+	product.CustomFields.CustomField = make([]WHMCSCustomField, 0, len(cs.CustomFields))
+	for _, value := range cs.CustomFields {
+		product.CustomFields.CustomField = append(product.CustomFields.CustomField, WHMCSCustomField{
+			ID:             value.Field.ID,
+			Name:           value.Field.Name,
+			TranslatedName: value.Field.Name,
+			Value:          value.Value,
+		})
+	}
+
+	options := make([]string, 0, len(s.ConfigSelection))
+	for option := range s.ConfigSelection {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	product.ConfigOptions.ConfigOption = make([]WHMCSConfigOption, 0, len(options))
+	for _, option := range options {
+		product.ConfigOptions.ConfigOption = append(product.ConfigOptions.ConfigOption, WHMCSConfigOption{
+			Option: option,
+			Value:  fmt.Sprint(s.ConfigSelection[option]),
+		})
+	}
+	return product
+}
+
+func whmcsStatus(status string) string {
+	if status == "" {
+		return status
+	}
+	return strings.ToUpper(status[:1]) + status[1:]
+}
+
+func toWHMCSCredentialResponse(key *domain.APIKey) WHMCSCredentialResponse {
+	resp := WHMCSCredentialResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		UserID:    key.UserID,
+		UserEmail: key.User.Email,
+		Active:    key.Active,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	resp.Identifier, _ = key.Permissions["identifier"].(string)
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Request/Response types
+
+type CreateWHMCSCredentialRequest struct {
+	Name string `json:"name"`
+}
+
+type WHMCSCredentialResponse struct {
+	ID         uint64 `json:"id"`
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+	Secret     string `json:"secret,omitempty"`
+	UserID     uint64 `json:"user_id"`
+	UserEmail  string `json:"user_email,omitempty"`
+	Active     bool   `json:"active"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type WHMCSResult struct {
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+type WHMCSAddClientResponse struct {
+	Result   string `json:"result"`
+	ClientID uint64 `json:"clientid"`
+}
+
+type WHMCSOpenTicketResponse struct {
+	Result string `json:"result"`
+	ID     uint64 `json:"id"`
+	TID    string `json:"tid"`
+}
+
+type WHMCSProductsResponse struct {
+	Result       string `json:"result"`
+	ClientID     uint64 `json:"clientid,omitempty"`
+	ServiceID    uint64 `json:"serviceid,omitempty"`
+	PID          uint64 `json:"pid,omitempty"`
+	Domain       string `json:"domain,omitempty"`
+	TotalResults int64  `json:"totalresults"`
+	StartNumber  int    `json:"startnumber"`
+	NumReturned  int    `json:"numreturned"`
+	Products     struct {
+		Product []WHMCSProduct `json:"product"`
+	} `json:"products"`
+}
+
+type WHMCSProduct struct {
+	ID               uint64 `json:"id"`
+	ClientID         uint64 `json:"clientid"`
+	OrderID          uint64 `json:"orderid"`
+	OrderNumber      string `json:"ordernumber"`
+	PID              uint64 `json:"pid"`
+	RegDate          string `json:"regdate"`
+	Name             string `json:"name"`
+	TranslatedName   string `json:"translated_name"`
+	GroupName        string `json:"groupname"`
+	Domain           string `json:"domain"`
+	DedicatedIP      string `json:"dedicatedip"`
+	ServerID         uint64 `json:"serverid"`
+	ServerName       string `json:"servername"`
+	ServerIP         string `json:"serverip"`
+	ServerHostname   string `json:"serverhostname"`
+	SuspensionReason string `json:"suspensionreason"`
+	RecurringAmount  string `json:"recurringamount"`
+	BillingCycle     string `json:"billingcycle"`
+	NextDueDate      string `json:"nextduedate"`
+	Status           string `json:"status"`
+	Username         string `json:"username"`
+	Notes            string `json:"notes"`
+	CustomFields     struct {
+		CustomField []WHMCSCustomField `json:"customfield"`
+	} `json:"customfields"`
+	ConfigOptions struct {
+		ConfigOption []WHMCSConfigOption `json:"configoption"`
+	} `json:"configoptions"`
+}
+
+type WHMCSCustomField struct {
+	ID             uint64 `json:"id"`
+	Name           string `json:"name"`
+	TranslatedName string `json:"translated_name"`
+	Value          string `json:"value"`
+}
+
+type WHMCSConfigOption struct {
+	Option string `json:"option"`
+	Value  string `json:"value"`
+}
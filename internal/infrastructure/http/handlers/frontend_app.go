@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,10 +14,15 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/account"
+	"github.com/openhost/openhost/internal/core/service/address"
+	"github.com/openhost/openhost/internal/core/service/affiliate"
 	"github.com/openhost/openhost/internal/core/service/auth"
+	"github.com/openhost/openhost/internal/core/service/customfield"
 	"github.com/openhost/openhost/internal/core/service/invoice"
 	"github.com/openhost/openhost/internal/core/service/order"
 	"github.com/openhost/openhost/internal/core/service/product"
+	"github.com/openhost/openhost/internal/core/service/vat"
 	"github.com/openhost/openhost/internal/infrastructure/web"
 )
 
@@ -31,6 +37,10 @@ type FrontendHandler struct {
 	cartService    *order.CartService
 	orderService   *order.Service
 	invoiceService *invoice.Service
+	accountService *account.Service
+
+	affiliateService *affiliate.Service
+	vatService       *vat.Service
 }
 
 func NewFrontendHandler(
@@ -39,6 +49,7 @@ func NewFrontendHandler(
 	cartService *order.CartService,
 	orderService *order.Service,
 	invoiceService *invoice.Service,
+	accountService *account.Service,
 ) *FrontendHandler {
 	return &FrontendHandler{
 		authService:    authService,
@@ -46,9 +57,22 @@ func NewFrontendHandler(
 		cartService:    cartService,
 		orderService:   orderService,
 		invoiceService: invoiceService,
+		accountService: accountService,
 	}
 }
 
+// SetAffiliateService credits signups to the affiliate whose link the
+// customer came through
+func (h *FrontendHandler) SetAffiliateService(affiliateService *affiliate.Service) {
+	h.affiliateService = affiliateService
+}
+
+// SetVATService checks the VAT numbers customers give at checkout, so EU
+// businesses are reverse charged
+func (h *FrontendHandler) SetVATService(vatService *vat.Service) {
+	h.vatService = vatService
+}
+
 func (h *FrontendHandler) SessionMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token, err := c.Cookie(frontendSessionCookie)
@@ -56,6 +80,7 @@ func (h *FrontendHandler) SessionMiddleware() gin.HandlerFunc {
 			user, err := h.authService.ValidateSession(token)
 			if err == nil {
 				c.Set(web.ContextUserKey, user)
+				web.ApplyUserPreferences(c, user)
 			}
 		}
 		c.Next()
@@ -86,7 +111,7 @@ func (h *FrontendHandler) LoginSubmit(c *gin.Context) {
 }
 
 func (h *FrontendHandler) RegisterForm(c *gin.Context) {
-	renderAuthPage(c, "register.html", "")
+	h.renderRegister(c, "")
 }
 
 func (h *FrontendHandler) RegisterSubmit(c *gin.Context) {
@@ -96,32 +121,43 @@ func (h *FrontendHandler) RegisterSubmit(c *gin.Context) {
 	password := c.PostForm("password")
 	confirm := c.PostForm("confirm_password")
 	acceptTerms := c.PostForm("accept_terms")
+	currency := c.PostForm("currency")
 
 	if firstName == "" || lastName == "" || email == "" || password == "" {
-		renderAuthPage(c, "register.html", "请完整填写注册信息。")
+		h.renderRegister(c, "请完整填写注册信息。")
 		return
 	}
 	if password != confirm {
-		renderAuthPage(c, "register.html", "两次输入的密码不一致。")
+		h.renderRegister(c, "两次输入的密码不一致。")
 		return
 	}
 	if acceptTerms == "" {
-		renderAuthPage(c, "register.html", "请先同意服务条款。")
+		h.renderRegister(c, "请先同意服务条款。")
 		return
 	}
 
-	_, err := h.authService.Register(email, password, firstName, lastName)
+	// The terms checkbox accepts every legal document that requires consent
+	accepted, err := h.accountService.RequiredDocuments()
+	if err != nil {
+		h.renderRegister(c, "注册失败，请稍后再试。")
+		return
+	}
+
+	user, err := h.authService.Register(email, password, firstName, lastName, currency, accepted, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err != nil {
 		switch err {
 		case auth.ErrEmailExists:
-			renderAuthPage(c, "register.html", "该邮箱已注册。")
+			h.renderRegister(c, "该邮箱已注册。")
 		case auth.ErrPasswordTooShort:
-			renderAuthPage(c, "register.html", "密码长度至少 8 位。")
+			h.renderRegister(c, "密码长度至少 8 位。")
+		case account.ErrCurrencyUnavailable:
+			h.renderRegister(c, "所选币种暂不可用，请重新选择。")
 		default:
-			renderAuthPage(c, "register.html", "注册失败，请稍后再试。")
+			h.renderRegister(c, "注册失败，请稍后再试。")
 		}
 		return
 	}
+	attributeReferral(c, h.affiliateService, user.ID)
 
 	session, err := h.authService.Login(email, password, c.ClientIP(), c.GetHeader("User-Agent"))
 	if err == nil {
@@ -137,27 +173,23 @@ func (h *FrontendHandler) Logout(c *gin.Context) {
 }
 
 func (h *FrontendHandler) Products(c *gin.Context) {
-	products, _, err := h.productService.ListProducts(nil, true, 100, 0)
+	customerID := currentCustomerID(c)
+	products, _, err := h.productService.ListCatalog(customerID, nil, true, 100, 0)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	currencyCode := "USD"
-	if value, ok := c.Get(web.ContextCurrencyKey); ok {
-		if code, ok := value.(string); ok && code != "" {
-			currencyCode = code
-		}
-	}
+	currencyCode := visitorCurrency(c)
 
 	cards := make([]productCard, 0, len(products))
 	for _, item := range products {
 		priceLabel := ""
 		billingCycle := ""
-		if pricing, err := h.productService.GetPricing(item.ID, currencyCode); err == nil {
+		if pricing, err := h.productService.GetCustomerPricing(item.ID, currencyCode, customerID); err == nil {
 			cycle, amount := pickPreferredCycle(pricing)
 			billingCycle = cycle
-			priceLabel = amount.StringFixed(2)
+			priceLabel = web.FormatMoney(c, amount, currencyCode)
 		}
 		cards = append(cards, productCard{
 			ID:           int(item.ID),
@@ -185,19 +217,19 @@ func (h *FrontendHandler) ConfigureProduct(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-
-	currencyCode := "USD"
-	if value, ok := c.Get(web.ContextCurrencyKey); ok {
-		if code, ok := value.(string); ok && code != "" {
-			currencyCode = code
-		}
+	customerID := currentCustomerID(c)
+	if visible, err := h.productService.IsVisible(customerID, productItem); err != nil || !visible {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
 	}
-	pricing, _ := h.productService.GetPricing(productItem.ID, currencyCode)
+
+	currencyCode := visitorCurrency(c)
+	pricing, _ := h.productService.GetCustomerPricing(productItem.ID, currencyCode, customerID)
 	billingCycles := availableCycles(pricing)
-	configGroups := buildConfigGroups(productItem.ConfigGroups)
+	configGroups := buildConfigGroups(c, productItem.ConfigGroups, currencyCode)
 	cycle, amount := pickPreferredCycle(pricing)
 
-	h.renderConfigure(c, productItem, billingCycles, configGroups, cycle, amount.StringFixed(2), currencyCode, "")
+	h.renderConfigure(c, productItem, billingCycles, configGroups, cycle, web.FormatMoney(c, amount, currencyCode), currencyCode, "")
 }
 
 func (h *FrontendHandler) AddToCartFromProduct(c *gin.Context) {
@@ -207,6 +239,10 @@ func (h *FrontendHandler) AddToCartFromProduct(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
+	if visible, err := h.productService.IsVisible(currentCustomerID(c), productItem); err != nil || !visible {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 
 	quantity, _ := strconv.Atoi(c.PostForm("quantity"))
 	billingCycle := c.PostForm("billing_cycle")
@@ -218,7 +254,7 @@ func (h *FrontendHandler) AddToCartFromProduct(c *gin.Context) {
 		return
 	}
 
-	_, err = h.cartService.AddItem(cart.ID, productItem.ID, quantity, billingCycle, "", "", configOptions)
+	_, err = h.cartService.AddItem(cart.ID, productItem.ID, quantity, billingCycle, "", "", configOptions, c.PostFormMap("custom_fields"))
 	if err != nil {
 		h.renderConfigureFromProduct(c, productItem, err.Error())
 		return
@@ -252,6 +288,23 @@ func (h *FrontendHandler) ApplyCoupon(c *gin.Context) {
 	c.Redirect(http.StatusSeeOther, "/cart")
 }
 
+// SetCartCountry sets the country a guest's tax is estimated for, which
+// wins over the country of their IP address
+func (h *FrontendHandler) SetCartCountry(c *gin.Context) {
+	country := strings.ToUpper(strings.TrimSpace(c.PostForm("country")))
+	if len(country) != 2 {
+		h.renderCart(c, "请输入两位国家代码。")
+		return
+	}
+	web.SetCountry(c, country)
+
+	if _, err := h.getOrCreateCart(c); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/cart")
+}
+
 func (h *FrontendHandler) Checkout(c *gin.Context) {
 	user := currentUser(c)
 	if user == nil {
@@ -271,7 +324,7 @@ func (h *FrontendHandler) Checkout(c *gin.Context) {
 		return
 	}
 
-	view := cartSummaryViewFrom(summary)
+	view := cartSummaryViewFrom(c, summary)
 
 	web.Render(c, "checkout.html", gin.H{
 		"Title":       "结账",
@@ -295,11 +348,44 @@ func (h *FrontendHandler) PlaceOrder(c *gin.Context) {
 		return
 	}
 
-	orderRecord, err := h.orderService.CreateOrder(user.ID, cart.ID, c.ClientIP())
+	accepted, err := h.accountService.RequiredDocuments()
 	if err != nil {
 		h.renderCart(c, "订单创建失败，请稍后再试。")
 		return
 	}
+	if len(accepted) > 0 && c.PostForm("agree_terms") == "" {
+		h.renderCart(c, "请先同意服务条款。")
+		return
+	}
+
+	if number, ok := c.GetPostForm("vat_number"); ok && h.vatService != nil {
+		if _, err := h.vatService.SetCustomerVATNumber(c.Request.Context(), user.ID, number, time.Now()); err != nil && err != vat.ErrVIESUnavailable {
+			if errors.Is(err, vat.ErrInvalidVATNumber) || err == vat.ErrVATFormat || err == vat.ErrCountryMismatch {
+				h.renderCart(c, "增值税号无效："+err.Error())
+				return
+			}
+			h.renderCart(c, "订单创建失败，请稍后再试。")
+			return
+		}
+	}
+
+	orderRecord, err := h.orderService.CreateOrder(user.ID, cart.ID, accepted, c.PostFormMap("order_fields"), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		if errors.Is(err, customfield.ErrFieldRequired) || errors.Is(err, customfield.ErrInvalidValue) || errors.Is(err, customfield.ErrUnknownField) {
+			h.renderCart(c, err.Error())
+			return
+		}
+		if errors.Is(err, address.ErrInvalidAddress) {
+			h.renderCart(c, "账单地址不完整或无效，请先更新您的账户资料："+err.Error())
+			return
+		}
+		if err == address.ErrCountryNotSold || err == address.ErrCountryEmbargoed {
+			h.renderCart(c, "很抱歉，我们暂不向您所在的国家或地区提供服务。")
+			return
+		}
+		h.renderCart(c, "订单创建失败，请稍后再试。")
+		return
+	}
 
 	invoiceRecord, err := h.invoiceService.CreateInvoiceFromOrder(orderRecord, time.Now().Add(7*24*time.Hour))
 	if err != nil {
@@ -323,7 +409,8 @@ func (h *FrontendHandler) renderCart(c *gin.Context, errorMessage string) {
 		return
 	}
 
-	view := cartSummaryViewFrom(summary)
+	view := cartSummaryViewFrom(c, summary)
+	view.Guest = currentUser(c) == nil
 
 	data := gin.H{
 		"Title":       "购物车",
@@ -339,17 +426,12 @@ func (h *FrontendHandler) renderCart(c *gin.Context, errorMessage string) {
 }
 
 func (h *FrontendHandler) renderConfigureFromProduct(c *gin.Context, productItem *domain.Product, message string) {
-	currencyCode := "USD"
-	if value, ok := c.Get(web.ContextCurrencyKey); ok {
-		if code, ok := value.(string); ok && code != "" {
-			currencyCode = code
-		}
-	}
-	pricing, _ := h.productService.GetPricing(productItem.ID, currencyCode)
+	currencyCode := visitorCurrency(c)
+	pricing, _ := h.productService.GetCustomerPricing(productItem.ID, currencyCode, currentCustomerID(c))
 	billingCycles := availableCycles(pricing)
-	configGroups := buildConfigGroups(productItem.ConfigGroups)
+	configGroups := buildConfigGroups(c, productItem.ConfigGroups, currencyCode)
 	cycle, amount := pickPreferredCycle(pricing)
-	h.renderConfigure(c, productItem, billingCycles, configGroups, cycle, amount.StringFixed(2), currencyCode, message)
+	h.renderConfigure(c, productItem, billingCycles, configGroups, cycle, web.FormatMoney(c, amount, currencyCode), currencyCode, message)
 }
 
 func (h *FrontendHandler) renderConfigure(
@@ -394,7 +476,43 @@ func (h *FrontendHandler) getOrCreateCart(c *gin.Context) (*domain.Cart, error)
 		sessionID = newSession
 		c.SetCookie(cartSessionCookie, sessionID, int((30 * 24 * time.Hour).Seconds()), "/", "", c.Request.TLS != nil, true)
 	}
-	return h.cartService.GetOrCreateCart(nil, sessionID)
+	cart, err := h.cartService.GetOrCreateCart(nil, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Visitors shop in the currency they picked or were located in, when
+	// it is offered
+	currency := cart.Currency
+	if err := h.cartService.Locate(cart, cartLocation(c)); err != nil {
+		return nil, err
+	}
+	if cart.Currency != currency {
+		return h.cartService.GetOrCreateCart(nil, sessionID)
+	}
+	return cart, nil
+}
+
+// cartLocation returns the currency and country detected for a visitor
+func cartLocation(c *gin.Context) order.CartLocation {
+	detected := web.Detect(c)
+	return order.CartLocation{
+		Currency:       detected.Currency,
+		CurrencySource: detected.CurrencySource,
+		Country:        detected.Country,
+		CountrySource:  detected.CountrySource,
+	}
+}
+
+// visitorCurrency returns the currency prices are shown in: the one a
+// customer is billed in, or the one a visitor picked
+func visitorCurrency(c *gin.Context) string {
+	if value, ok := c.Get(web.ContextCurrencyKey); ok {
+		if code, ok := value.(string); ok && code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+	return "USD"
 }
 
 func currentUser(c *gin.Context) *domain.User {
@@ -409,6 +527,14 @@ func currentUser(c *gin.Context) *domain.User {
 	return user
 }
 
+// currentCustomerID returns the ID of the signed-in customer, 0 for guests
+func currentCustomerID(c *gin.Context) uint64 {
+	if user := currentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
 func setSessionCookie(c *gin.Context, token string) {
 	maxAge := int(auth.SessionDuration.Seconds())
 	c.SetCookie(frontendSessionCookie, token, maxAge, "/", "", c.Request.TLS != nil, true)
@@ -454,12 +580,14 @@ type configOptionView struct {
 }
 
 type configSubOptionView struct {
-	ID    uint64
-	Name  string
-	Price string
+	ID       uint64
+	Name     string
+	Price    string
+	Disabled bool
+	Note     string
 }
 
-func buildConfigGroups(groups []domain.ConfigGroup) []configGroupView {
+func buildConfigGroups(c *gin.Context, groups []domain.ConfigGroup, currency string) []configGroupView {
 	views := make([]configGroupView, 0, len(groups))
 	for _, group := range groups {
 		view := configGroupView{Name: group.Name}
@@ -470,11 +598,16 @@ func buildConfigGroups(groups []domain.ConfigGroup) []configGroupView {
 				Required: option.Required,
 			}
 			for _, subOption := range option.SubOptions {
-				optView.SubOptions = append(optView.SubOptions, configSubOptionView{
-					ID:    subOption.ID,
-					Name:  subOption.Name,
-					Price: subOption.Pricing.Monthly.StringFixed(2),
-				})
+				subView := configSubOptionView{
+					ID:       subOption.ID,
+					Name:     subOption.Name,
+					Disabled: subOption.SoldOut,
+					Note:     subOption.OutOfStockMsg,
+				}
+				if !subOption.Pricing.Monthly.IsZero() {
+					subView.Price = web.FormatMoney(c, subOption.Pricing.Monthly, currency)
+				}
+				optView.SubOptions = append(optView.SubOptions, subView)
 			}
 			view.Options = append(view.Options, optView)
 		}
@@ -537,41 +670,80 @@ type cartItemView struct {
 	BillingCycle string
 	Quantity     int
 	Total        string
+	Savings      []cartSavingView
+}
+
+type cartSavingView struct {
+	Label  string
+	Amount string
 }
 
 type cartSummaryView struct {
 	Items      []cartItemView
 	Subtotal   string
 	Discount   string
+	Savings    string
 	Tax        string
 	Total      string
 	Currency   string
 	HasItems   bool
 	CouponCode string
+
+	// Guests pick the country their tax is estimated for
+	Guest        bool
+	TaxCountry   string
+	TaxEstimated bool
 }
 
-func cartSummaryViewFrom(summary *order.CartSummary) cartSummaryView {
+func cartSummaryViewFrom(c *gin.Context, summary *order.CartSummary) cartSummaryView {
 	view := cartSummaryView{
-		Currency:   summary.Currency,
-		CouponCode: summary.CouponCode,
+		Currency:     summary.Currency,
+		CouponCode:   summary.CouponCode,
+		TaxCountry:   summary.TaxCountry,
+		TaxEstimated: summary.TaxEstimated,
 	}
 	for _, item := range summary.Items {
-		view.Items = append(view.Items, cartItemView{
+		itemView := cartItemView{
 			ID:           item.ID,
 			ProductName:  item.ProductName,
 			BillingCycle: item.BillingCycle,
 			Quantity:     item.Quantity,
-			Total:        item.Total.StringFixed(2),
-		})
+			Total:        web.FormatMoney(c, item.Total, summary.Currency),
+		}
+		for _, saving := range item.Savings {
+			itemView.Savings = append(itemView.Savings, cartSavingView{Label: saving.Label, Amount: web.FormatMoney(c, saving.Amount, summary.Currency)})
+		}
+		view.Items = append(view.Items, itemView)
+	}
+	view.Subtotal = web.FormatMoney(c, summary.Subtotal, summary.Currency)
+	view.Discount = web.FormatMoney(c, summary.TotalDiscount, summary.Currency)
+	if summary.TotalSavings.IsPositive() {
+		view.Savings = web.FormatMoney(c, summary.TotalSavings, summary.Currency)
 	}
-	view.Subtotal = summary.Subtotal.StringFixed(2)
-	view.Discount = summary.TotalDiscount.StringFixed(2)
-	view.Tax = summary.Tax.StringFixed(2)
-	view.Total = summary.Total.StringFixed(2)
+	view.Tax = web.FormatMoney(c, summary.Tax, summary.Currency)
+	view.Total = web.FormatMoney(c, summary.Total, summary.Currency)
 	view.HasItems = len(view.Items) > 0
 	return view
 }
 
+// renderRegister renders the registration form with the currencies a
+// customer can pick, the one the visitor browsed in selected
+func (h *FrontendHandler) renderRegister(c *gin.Context, message string) {
+	// Without the list the default currency is used
+	currencies, _ := h.accountService.Currencies()
+	data := gin.H{
+		"Title":            "认证",
+		"Description":      "登录或注册 OpenHost",
+		"Year":             time.Now().Year(),
+		"Currencies":       currencies,
+		"SelectedCurrency": visitorCurrency(c),
+	}
+	if message != "" {
+		data["Flash"] = &web.Flash{Type: "error", Message: message}
+	}
+	web.Render(c, "register.html", data)
+}
+
 func renderAuthPage(c *gin.Context, templateName string, message string) {
 	data := gin.H{
 		"Title":       "认证",
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/health"
 )
 
 type HealthResponse struct {
@@ -20,3 +22,47 @@ type HealthResponse struct {
 func Health(c *gin.Context) {
 	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
 }
+
+// HealthHandler serves the Kubernetes liveness and readiness probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new health handler. A nil checker reports
+// the service as not ready, as before installation.
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Returns ok while the process serves requests. Dependencies are not checked, so an outage of the database does not restart the service.
+// @Tags system
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: health.StatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Checks the database, pending migrations, the job queue and the SMTP server. Returns 503 while a critical check fails; failing non-critical checks report the status degraded.
+// @Tags system
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.checker == nil {
+		c.JSON(http.StatusServiceUnavailable, health.Report{Status: health.StatusFail, Checks: []health.Result{}})
+		return
+	}
+
+	report := h.checker.Run(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
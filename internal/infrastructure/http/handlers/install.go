@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -194,6 +196,11 @@ func buildConfig(form installForm) (config.Config, error) {
 	if err != nil {
 		return config.Config{}, err
 	}
+	// New installations encrypt service credentials from the start
+	secretsKey := make([]byte, 32)
+	if _, err := rand.Read(secretsKey); err != nil {
+		return config.Config{}, err
+	}
 	cfg := config.Config{
 		App: config.AppConfig{
 			Name:    form.AppName,
@@ -206,6 +213,7 @@ func buildConfig(form installForm) (config.Config, error) {
 			Email:        form.AdminEmail,
 			PasswordHash: string(passwordHash),
 		},
+		Secrets: config.SecretsConfig{Key: hex.EncodeToString(secretsKey)},
 	}
 	if cfg.Database.Type == "sqlite" {
 		cfg.Database.SQLite = config.SQLiteConfig{Path: form.SQLitePath}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+var startedAt = time.Now()
+
+type MetricsResponse struct {
+	UptimeSeconds int64                `json:"uptime_seconds"`
+	Goroutines    int                  `json:"goroutines"`
+	Database      []database.PoolStats `json:"database"`
+}
+
+// Metrics godoc
+// @Summary Runtime metrics
+// @Description Returns process and database connection pool statistics
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MetricsResponse
+// @Router /admin/metrics [get]
+func Metrics(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pools, err := database.Stats(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read pool stats"})
+			return
+		}
+
+		c.JSON(http.StatusOK, MetricsResponse{
+			UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+			Goroutines:    runtime.NumGoroutine(),
+			Database:      pools,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/affiliate"
+)
+
+// ReferralHandler serves the links affiliates share
+type ReferralHandler struct {
+	affiliateService *affiliate.Service
+}
+
+func NewReferralHandler(affiliateService *affiliate.Service) *ReferralHandler {
+	return &ReferralHandler{affiliateService: affiliateService}
+}
+
+// Visit records a click on an affiliate link, sets the attribution cookie
+// and redirects to the page the link points to with "to". Banner links
+// name their banner with "banner". Visitors always land on the page, even
+// when the code is unknown.
+func (h *ReferralHandler) Visit(c *gin.Context) {
+	landingPage := c.Query("to")
+	if !strings.HasPrefix(landingPage, "/") || strings.HasPrefix(landingPage, "//") || strings.HasPrefix(landingPage, "/\\") {
+		landingPage = "/"
+	}
+	var bannerID *uint64
+	if id, err := strconv.ParseUint(c.Query("banner"), 10, 64); err == nil {
+		bannerID = &id
+	}
+
+	referral, err := h.affiliateService.TrackVisit(c.Param("code"), affiliate.Visit{
+		BannerID:    bannerID,
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.GetHeader("User-Agent"),
+		ReferrerURL: c.GetHeader("Referer"),
+		LandingPage: landingPage,
+		UTM: affiliate.UTM{
+			Source:   c.Query("utm_source"),
+			Medium:   c.Query("utm_medium"),
+			Campaign: c.Query("utm_campaign"),
+			Term:     c.Query("utm_term"),
+			Content:  c.Query("utm_content"),
+		},
+	})
+	switch {
+	case err == nil:
+		maxAge := h.affiliateService.CookieDays() * 24 * 60 * 60
+		c.SetCookie(affiliate.ReferralCookie, referral.Token, maxAge, "/", "", c.Request.TLS != nil, true)
+	case !errors.Is(err, affiliate.ErrAffiliateNotFound):
+		log.Printf("failed to track affiliate visit: %v", err)
+	}
+	c.Redirect(http.StatusFound, landingPage)
+}
+
+// Banner serves a banner for an affiliate as a page to embed in an iframe
+// and counts an impression. Links open in the page embedding it.
+func (h *ReferralHandler) Banner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	banner, err := h.affiliateService.ServeBanner(id, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, affiliate.ErrBannerNotFound) || errors.Is(err, affiliate.ErrAffiliateNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to serve affiliate banner %d: %v", id, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store, max-age=0")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(
+		`<!DOCTYPE html><html><head><meta charset="utf-8"><base target="_top"></head>`+
+			`<body style="margin:0">`+banner+`</body></html>`))
+}
+
+// attributeReferral credits a new customer to the affiliate in the referral
+// cookie of the request, if any
+func attributeReferral(c *gin.Context, affiliateService *affiliate.Service, customerID uint64) {
+	token, err := c.Cookie(affiliate.ReferralCookie)
+	if err != nil || token == "" || affiliateService == nil {
+		return
+	}
+	err = affiliateService.AttributeSignup(token, customerID, time.Now())
+	if err != nil && !errors.Is(err, affiliate.ErrReferralNotFound) && !errors.Is(err, affiliate.ErrReferralExpired) {
+		log.Printf("failed to credit signup of customer %d to affiliate: %v", customerID, err)
+	}
+}
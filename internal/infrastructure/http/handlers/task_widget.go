@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
+)
+
+// myTasksWidget lists the open tasks of the signed in staff member. The
+// rows come from the task list data endpoint, which checks the session.
+var myTasksWidget = template.Must(template.New("my_tasks").Parse(`<section class="section">
+    <div class="card">
+        <div class="section-header">
+            <h2 class="section-title">{{ call .T "admin.tasks.mine" }}</h2>
+        </div>
+        <input type="hidden" name="assignee" value="me" data-table-filter="/admin/tasks/data">
+        <input type="hidden" name="status" value="open" data-table-filter="/admin/tasks/data">
+        <table class="table" data-admin-table="/admin/tasks/data">
+            <thead>
+                <tr>
+                    <th data-column="title" data-sortable>{{ call .T "admin.tasks.title" }}</th>
+                    <th data-column="entity">{{ call .T "admin.tasks.entity" }}</th>
+                    <th data-column="due_at" data-format="date" data-sortable>{{ call .T "admin.tasks.due" }}</th>
+                </tr>
+            </thead>
+            <tbody>
+            </tbody>
+        </table>
+        <div class="table-pager" data-table-pager="/admin/tasks/data" data-previous-label="{{ call .T "common.previous" }}" data-next-label="{{ call .T "common.next" }}"></div>
+    </div>
+</section>
+`))
+
+// MyTasksWidget renders the open tasks widget of the admin dashboard. It
+// is registered for the admin dashboard hook and gets the page data.
+func MyTasksWidget(data any) (string, error) {
+	page, _ := data.(gin.H)
+	translate, ok := page["T"].(i18n.TranslatorFunc)
+	if !ok {
+		translate = func(key string, args ...any) string { return key }
+	}
+
+	var buf bytes.Buffer
+	if err := myTasksWidget.Execute(&buf, struct{ T i18n.TranslatorFunc }{translate}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/notification"
+)
+
+// transparentGIF is the 1x1 image of the open pixel
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// TrackingHandler records the opens and clicks of tracked emails
+type TrackingHandler struct {
+	notificationService *notification.Service
+}
+
+func NewTrackingHandler(notificationService *notification.Service) *TrackingHandler {
+	return &TrackingHandler{notificationService: notificationService}
+}
+
+// Open serves the open pixel. The image is served whatever happens, so a
+// broken image never shows in the email.
+func (h *TrackingHandler) Open(c *gin.Context) {
+	_ = h.notificationService.RecordOpen(c.Param("token"), time.Now())
+	c.Header("Cache-Control", "no-store, max-age=0")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
+
+// Click counts a click on a wrapped link and redirects to the link. Only
+// links an email was sent with are redirected to.
+func (h *TrackingHandler) Click(c *gin.Context) {
+	position, err := strconv.Atoi(c.Param("position"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Link not found")
+		return
+	}
+
+	// A click that fails to be counted still redirects
+	url, _ := h.notificationService.RecordClick(c.Param("token"), position, time.Now())
+	if url == "" {
+		c.String(http.StatusNotFound, "Link not found")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/infrastructure/web"
+)
+
+// UnsubscribeHandler serves the unsubscribe links of marketing-class
+// emails
+type UnsubscribeHandler struct {
+	notificationService *notification.Service
+}
+
+func NewUnsubscribeHandler(notificationService *notification.Service) *UnsubscribeHandler {
+	return &UnsubscribeHandler{notificationService: notificationService}
+}
+
+// Confirm shows what a link unsubscribes from. Opening the link does not
+// unsubscribe, so link scanners cannot do it by accident.
+func (h *UnsubscribeHandler) Confirm(c *gin.Context) {
+	token := c.Param("token")
+	unsubscription, err := h.notificationService.LookupUnsubscribe(token)
+	if err != nil {
+		h.render(c, http.StatusNotFound, gin.H{"NotFound": true})
+		return
+	}
+
+	h.render(c, http.StatusOK, gin.H{
+		"Token":      token,
+		"Email":      unsubscription.Email,
+		"Categories": unsubscription.Categories,
+	})
+}
+
+// Unsubscribe unsubscribes. Mail clients post here when the recipient
+// uses their one-click unsubscribe button (RFC 8058), as does the
+// confirmation page.
+func (h *UnsubscribeHandler) Unsubscribe(c *gin.Context) {
+	if _, err := h.notificationService.Unsubscribe(c.Param("token")); err != nil {
+		if errors.Is(err, notification.ErrUnsubscribeNotFound) {
+			h.render(c, http.StatusNotFound, gin.H{"NotFound": true})
+			return
+		}
+		c.String(http.StatusInternalServerError, "Failed to unsubscribe")
+		return
+	}
+	h.render(c, http.StatusOK, gin.H{"Done": true})
+}
+
+func (h *UnsubscribeHandler) render(c *gin.Context, status int, data gin.H) {
+	web.RenderWithOptions(c, "unsubscribe.html", data, web.RenderOptions{Title: "退订", StatusCode: status})
+}
@@ -0,0 +1,364 @@
+// Package httpcache caches public API responses that rarely change, such
+// as the product catalog and the knowledge base.
+//
+// Responses are kept per scope, the routes reading one set of tables, and
+// stay valid while the version of the scope is unchanged: the row count
+// and latest update of each of its tables. Admin writes to a scope drop
+// its responses at once; changes made elsewhere, such as stock reserved by
+// carts, are noticed when the version is next read. Responses carry an
+// ETag and Cache-Control, and a matching If-None-Match is answered with
+// 304 Not Modified.
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultMaxAge = time.Minute     // How long clients may reuse a response
+	DefaultTTL    = 5 * time.Minute // How long the server keeps a response
+
+	// recheckInterval is how long a version is trusted before it is read
+	// again
+	recheckInterval = 15 * time.Second
+
+	// maxEntries bounds the responses kept per scope, which differ by
+	// query string
+	maxEntries = 1000
+)
+
+// VersionFunc returns the current version of a scope's data
+type VersionFunc func(ctx context.Context) (string, error)
+
+// Scope is a group of cached routes
+type Scope struct {
+	Name    string
+	Version VersionFunc
+
+	// Writes are the route prefixes, such as /api/v1/admin/kb, of the
+	// admin writes changing the scope
+	Writes []string
+
+	// Personal reports a request answered for the signed-in user, which is
+	// not cached. Scopes with it vary by Authorization and Cookie.
+	Personal func(c *gin.Context) bool
+}
+
+// Cache keeps the responses of its scopes
+type Cache struct {
+	mu       sync.Mutex
+	scopes   map[string]*scope
+	maxAge   time.Duration
+	ttl      time.Duration
+	disabled bool
+}
+
+type scope struct {
+	Scope
+	version   string
+	checkedAt time.Time
+	// generation counts invalidations, so responses rendered before one
+	// are not stored after it
+	generation uint64
+	entries    map[string]*entry
+}
+
+type entry struct {
+	version     string
+	storedAt    time.Time
+	contentType string
+	body        []byte
+	etag        string
+}
+
+// New creates an empty cache
+func New() *Cache {
+	return &Cache{scopes: make(map[string]*scope), maxAge: DefaultMaxAge, ttl: DefaultTTL}
+}
+
+// SetMaxAge sets how long clients and proxies may reuse a response
+func (c *Cache) SetMaxAge(maxAge time.Duration) {
+	if maxAge > 0 {
+		c.maxAge = maxAge
+	}
+}
+
+// SetTTL sets how long a response is kept however its scope changes
+func (c *Cache) SetTTL(ttl time.Duration) {
+	if ttl > 0 {
+		c.ttl = ttl
+	}
+}
+
+// Disable turns the cache off: middleware made afterwards passes every
+// request through
+func (c *Cache) Disable() {
+	c.disabled = true
+}
+
+// Register adds a scope
+func (c *Cache) Register(s Scope) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scopes[s.Name] = &scope{Scope: s, entries: make(map[string]*entry)}
+}
+
+// Invalidate drops the responses of the named scopes
+func (c *Cache) Invalidate(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		if s, ok := c.scopes[name]; ok {
+			s.invalidate()
+		}
+	}
+}
+
+func (s *scope) invalidate() {
+	s.version = ""
+	s.generation++
+	clear(s.entries)
+}
+
+// Middleware caches the GET responses of a route in the named scope,
+// which must be registered
+func (c *Cache) Middleware(name string) gin.HandlerFunc {
+	c.mu.Lock()
+	s, ok := c.scopes[name]
+	c.mu.Unlock()
+	if !ok {
+		panic("httpcache: unknown scope " + name)
+	}
+	if c.disabled {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			return
+		}
+		if s.Personal != nil {
+			ctx.Header("Vary", "Authorization, Cookie")
+			if s.Personal(ctx) {
+				ctx.Next()
+				return
+			}
+		}
+
+		version, generation, err := c.version(ctx.Request.Context(), s)
+		if err != nil {
+			log.Printf("Failed to read the %s cache version: %v", s.Name, err)
+			ctx.Next()
+			return
+		}
+		key := ctx.Request.URL.RequestURI()
+		if e := c.lookup(s, key, version); e != nil {
+			c.serve(ctx, e)
+			ctx.Abort()
+			return
+		}
+
+		w := &bufferWriter{ResponseWriter: ctx.Writer, status: http.StatusOK}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+		if w.status != http.StatusOK {
+			w.ResponseWriter.WriteHeader(w.status)
+			w.ResponseWriter.Write(w.buf.Bytes())
+			return
+		}
+
+		e := &entry{
+			version:     version,
+			storedAt:    time.Now(),
+			contentType: w.Header().Get("Content-Type"),
+			body:        w.buf.Bytes(),
+		}
+		sum := sha256.Sum256(append([]byte(version+"\x00"), e.body...))
+		e.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		c.store(s, key, generation, e)
+		c.serve(ctx, e)
+	}
+}
+
+// InvalidateMiddleware drops the responses of the scopes a successful
+// write changes. It goes on the admin routes.
+func (c *Cache) InvalidateMiddleware() gin.HandlerFunc {
+	if c.disabled {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+	return func(ctx *gin.Context) {
+		ctx.Next()
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		if ctx.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		path := ctx.FullPath()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, s := range c.scopes {
+			for _, prefix := range s.Writes {
+				if path == prefix || strings.HasPrefix(path, prefix+"/") {
+					s.invalidate()
+					break
+				}
+			}
+		}
+	}
+}
+
+// version returns the version of a scope, reading it again when it is
+// no longer trusted
+func (c *Cache) version(ctx context.Context, s *scope) (string, uint64, error) {
+	c.mu.Lock()
+	version, checkedAt, generation := s.version, s.checkedAt, s.generation
+	c.mu.Unlock()
+	if version != "" && time.Since(checkedAt) < recheckInterval {
+		return version, generation, nil
+	}
+
+	version, err := s.Version(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.generation == generation {
+		if s.version != version {
+			clear(s.entries)
+		}
+		s.version = version
+		s.checkedAt = time.Now()
+	}
+	return version, generation, nil
+}
+
+func (c *Cache) lookup(s *scope, key, version string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.version != version || time.Since(e.storedAt) >= c.ttl {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (c *Cache) store(s *scope, key string, generation uint64, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.generation != generation {
+		return
+	}
+	if len(s.entries) >= maxEntries {
+		for k := range s.entries {
+			delete(s.entries, k)
+			break
+		}
+	}
+	s.entries[key] = e
+}
+
+func (c *Cache) serve(ctx *gin.Context, e *entry) {
+	ctx.Header("ETag", e.etag)
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(c.maxAge.Seconds())))
+	if etagMatch(ctx.GetHeader("If-None-Match"), e.etag) {
+		ctx.Status(http.StatusNotModified)
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+	ctx.Data(http.StatusOK, e.contentType, e.body)
+}
+
+// etagMatch reports whether an If-None-Match header lists etag, weakly
+// compared as RFC 9110 asks
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferWriter holds back a response until the cache has seen it
+type bufferWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	return w.buf.Len()
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.buf.Len() > 0
+}
+
+// TableVersion returns a version made of the row count and latest update
+// of each table. Tables without updated_at use created_at, so only rows
+// added or removed change them.
+func TableVersion(db *gorm.DB, tables ...string) VersionFunc {
+	columns := make([]string, len(tables))
+	for i, table := range tables {
+		columns[i] = "created_at"
+		if db.Migrator().HasColumn(table, "updated_at") {
+			columns[i] = "updated_at"
+		}
+	}
+
+	return func(ctx context.Context) (string, error) {
+		var version strings.Builder
+		for i, table := range tables {
+			var count int64
+			var latest sql.NullString
+			err := db.WithContext(ctx).Table(table).Select("COUNT(*), MAX("+columns[i]+")").
+				Row().Scan(&count, &latest)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", table, err)
+			}
+			fmt.Fprintf(&version, "%s:%d:%s;", table, count, latest.String)
+		}
+		return version.String(), nil
+	}
+}
@@ -1,6 +1,7 @@
 // Package i18n provides internationalization support for OpenHost.
 // It supports multiple languages with JSON-based translation files and
-// provides a clean API for use in templates and handlers.
+// provides a clean API for use in templates and handlers, with plural
+// forms, locale formats for dates and numbers, and right-to-left scripts.
 package i18n
 
 import (
@@ -19,13 +20,22 @@ type Language struct {
 	NativeName string `json:"native_name"` // Native name (e.g., "English", "中文")
 	Direction  string `json:"direction"`   // Text direction ("ltr" or "rtl")
 	Flag       string `json:"flag"`        // Flag emoji
+
+	DateFormat       string `json:"date_format"`       // Go layout of dates (e.g., "02.01.2006")
+	TimeFormat       string `json:"time_format"`       // Go layout of times (e.g., "15:04")
+	DateTimeFormat   string `json:"datetime_format"`   // Go layout of dates with times
+	DecimalSeparator string `json:"decimal_separator"` // Decimal separator (e.g., ",")
+	GroupSeparator   string `json:"group_separator"`   // Thousands separator (e.g., ".")
+	CurrencyFormat   string `json:"currency_format"`   // Symbol "¤" around number "#" (e.g., "# ¤")
 }
 
 // Translator handles translations for a specific language
 type Translator struct {
 	lang         string
+	language     *Language
 	translations map[string]string
 	fallback     *Translator
+	missing      *missingKeys
 }
 
 // Manager manages all translations and languages
@@ -36,6 +46,7 @@ type Manager struct {
 	defaultLang  string
 	fallbackLang string
 	basePath     string
+	missing      *missingKeys
 }
 
 var (
@@ -64,6 +75,7 @@ func NewManager(basePath string) *Manager {
 		defaultLang:  "en",
 		fallbackLang: "en",
 		basePath:     basePath,
+		missing:      newMissingKeys(),
 	}
 	return m
 }
@@ -84,33 +96,70 @@ func (m *Manager) SetFallbackLanguage(lang string) {
 
 // LoadLanguage loads a language from a JSON file
 func (m *Manager) LoadLanguage(lang string) error {
+	meta, translations, err := m.readLanguageDir(lang)
+	if err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Load language metadata
-	metaPath := filepath.Join(m.basePath, lang, "meta.json")
-	metaData, err := os.ReadFile(metaPath)
-	if err != nil {
+	if meta == nil {
 		// Create default metadata if not found
-		m.languages[lang] = &Language{
+		meta = &Language{
 			Code:       lang,
 			Name:       lang,
 			NativeName: lang,
-			Direction:  "ltr",
 		}
-	} else {
+	}
+	applyLanguageDefaults(meta, lang)
+	m.languages[lang] = meta
+
+	translator := &Translator{
+		lang:         lang,
+		language:     meta,
+		translations: translations,
+		missing:      m.missing,
+	}
+
+	// Set fallback if available
+	if lang != m.fallbackLang {
+		if fb, ok := m.translators[m.fallbackLang]; ok {
+			translator.fallback = fb
+		}
+	}
+
+	m.translators[lang] = translator
+
+	// Update fallback references for other translators
+	if lang == m.fallbackLang {
+		for code, t := range m.translators {
+			if code != lang {
+				t.fallback = translator
+			}
+		}
+	}
+
+	return nil
+}
+
+// readLanguageDir reads the metadata and translations of a language from
+// its directory. The metadata is nil when the directory has no meta.json.
+func (m *Manager) readLanguageDir(lang string) (*Language, map[string]string, error) {
+	var meta *Language
+	metaPath := filepath.Join(m.basePath, lang, "meta.json")
+	if metaData, err := os.ReadFile(metaPath); err == nil {
 		var langMeta Language
 		if err := json.Unmarshal(metaData, &langMeta); err != nil {
-			return fmt.Errorf("parse language meta %s: %w", lang, err)
+			return nil, nil, fmt.Errorf("parse language meta %s: %w", lang, err)
 		}
-		m.languages[lang] = &langMeta
+		meta = &langMeta
 	}
 
-	// Load translations
 	translations := make(map[string]string)
 	langDir := filepath.Join(m.basePath, lang)
 
-	err = filepath.Walk(langDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(langDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -134,34 +183,57 @@ func (m *Manager) LoadLanguage(lang string) error {
 
 		return nil
 	})
-
 	if err != nil {
-		return fmt.Errorf("load translations for %s: %w", lang, err)
+		return nil, nil, fmt.Errorf("load translations for %s: %w", lang, err)
 	}
 
-	translator := &Translator{
-		lang:         lang,
-		translations: translations,
-	}
+	return meta, translations, nil
+}
 
-	// Set fallback if available
-	if lang != m.fallbackLang {
-		if fb, ok := m.translators[m.fallbackLang]; ok {
-			translator.fallback = fb
+// LoadOverrides loads the languages in the locales directory. Translations
+// of a language that is already loaded replace its keys one by one, other
+// languages are loaded in full. A missing locales directory is not an
+// error.
+func (m *Manager) LoadOverrides() error {
+	entries, err := os.ReadDir(m.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
 		}
+		return fmt.Errorf("read locales directory: %w", err)
 	}
 
-	m.translators[lang] = translator
-
-	// Update fallback references for other translators
-	if lang == m.fallbackLang {
-		for code, t := range m.translators {
-			if code != lang {
-				t.fallback = translator
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		lang := entry.Name()
+
+		m.mu.RLock()
+		translator, loaded := m.translators[lang]
+		m.mu.RUnlock()
+		if !loaded {
+			if err := m.LoadLanguage(lang); err != nil {
+				return err
 			}
+			continue
 		}
-	}
 
+		meta, translations, err := m.readLanguageDir(lang)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		if meta != nil {
+			applyLanguageDefaults(meta, lang)
+			m.languages[lang] = meta
+			translator.language = meta
+		}
+		for key, value := range translations {
+			translator.translations[key] = value
+		}
+		m.mu.Unlock()
+	}
 	return nil
 }
 
@@ -212,9 +284,39 @@ func (m *Manager) GetTranslator(lang string) *Translator {
 	return &Translator{
 		lang:         lang,
 		translations: make(map[string]string),
+		missing:      m.missing,
 	}
 }
 
+// GetLanguage returns a loaded language, or nil if it is not loaded
+func (m *Manager) GetLanguage(lang string) *Language {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.languages[lang]
+}
+
+// Reload loads the built-in languages and the locales directory again, so
+// translation packs added or changed at runtime take effect. Translators
+// obtained before keep the translations they had.
+func (m *Manager) Reload() error {
+	fresh := NewManager(m.basePath)
+	m.mu.RLock()
+	fresh.defaultLang = m.defaultLang
+	fresh.fallbackLang = m.fallbackLang
+	m.mu.RUnlock()
+	fresh.missing = m.missing
+
+	if err := fresh.LoadBuiltinLanguages(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.languages = fresh.languages
+	m.translators = fresh.translators
+	m.mu.Unlock()
+	return nil
+}
+
 // T is a shortcut for translating a key using the default manager
 func T(lang, key string, args ...any) string {
 	return Default().GetTranslator(lang).T(key, args...)
@@ -227,6 +329,9 @@ func (t *Translator) T(key string, args ...any) string {
 	}
 
 	value, ok := t.translations[key]
+	if !ok {
+		t.missing.report(t.lang, key)
+	}
 	if !ok && t.fallback != nil {
 		return t.fallback.T(key, args...)
 	}
@@ -273,13 +378,10 @@ func (t *Translator) Func() TranslatorFunc {
 	return t.T
 }
 
-// LoadBuiltinLanguages loads the built-in English and Chinese translations
+// LoadBuiltinLanguages loads the built-in English and Chinese translations,
+// compiled into the binary, followed by the overrides in the locales
+// directory when it exists
 func (m *Manager) LoadBuiltinLanguages() error {
-	// Ensure the base path exists
-	if err := os.MkdirAll(m.basePath, 0755); err != nil {
-		return fmt.Errorf("create locales directory: %w", err)
-	}
-
 	// Load embedded translations
 	if err := m.loadEmbeddedLanguage("en", englishTranslations()); err != nil {
 		return err
@@ -288,7 +390,7 @@ func (m *Manager) LoadBuiltinLanguages() error {
 		return err
 	}
 
-	return nil
+	return m.LoadOverrides()
 }
 
 func (m *Manager) loadEmbeddedLanguage(lang string, translations map[string]any) error {
@@ -296,22 +398,24 @@ func (m *Manager) loadEmbeddedLanguage(lang string, translations map[string]any)
 	defer m.mu.Unlock()
 
 	// Extract metadata
+	language := &Language{Code: lang, Name: lang, NativeName: lang}
 	if meta, ok := translations["meta"].(map[string]any); ok {
-		m.languages[lang] = &Language{
-			Code:       getString(meta, "code", lang),
-			Name:       getString(meta, "name", lang),
-			NativeName: getString(meta, "native_name", lang),
-			Direction:  getString(meta, "direction", "ltr"),
-			Flag:       getString(meta, "flag", ""),
-		}
-	} else {
-		m.languages[lang] = &Language{
-			Code:       lang,
-			Name:       lang,
-			NativeName: lang,
-			Direction:  "ltr",
+		language = &Language{
+			Code:             getString(meta, "code", lang),
+			Name:             getString(meta, "name", lang),
+			NativeName:       getString(meta, "native_name", lang),
+			Direction:        getString(meta, "direction", ""),
+			Flag:             getString(meta, "flag", ""),
+			DateFormat:       getString(meta, "date_format", ""),
+			TimeFormat:       getString(meta, "time_format", ""),
+			DateTimeFormat:   getString(meta, "datetime_format", ""),
+			DecimalSeparator: getString(meta, "decimal_separator", ""),
+			GroupSeparator:   getString(meta, "group_separator", ""),
+			CurrencyFormat:   getString(meta, "currency_format", ""),
 		}
 	}
+	applyLanguageDefaults(language, lang)
+	m.languages[lang] = language
 
 	// Flatten translations
 	flatTranslations := make(map[string]string)
@@ -328,7 +432,9 @@ func (m *Manager) loadEmbeddedLanguage(lang string, translations map[string]any)
 
 	translator := &Translator{
 		lang:         lang,
+		language:     language,
 		translations: flatTranslations,
+		missing:      m.missing,
 	}
 
 	// Set fallback
@@ -0,0 +1,130 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Text directions
+const (
+	DirectionLTR = "ltr"
+	DirectionRTL = "rtl"
+)
+
+// Default locale formats, used by languages that do not set their own
+const (
+	DefaultDateFormat       = "2006-01-02"
+	DefaultTimeFormat       = "15:04"
+	DefaultDateTimeFormat   = "2006-01-02 15:04:05"
+	DefaultDecimalSeparator = "."
+	DefaultGroupSeparator   = ","
+)
+
+// rtlLanguages are the languages written right to left, used for the
+// direction of languages that do not set it
+var rtlLanguages = map[string]bool{
+	"ar": true, "he": true, "fa": true, "ur": true, "ps": true,
+	"yi": true, "dv": true, "ckb": true, "sd": true, "ug": true,
+}
+
+// IsRTL reports whether the language is written right to left
+func (l *Language) IsRTL() bool {
+	return l != nil && l.Direction == DirectionRTL
+}
+
+// Dir returns the text direction of the language, for the dir attribute
+func (l *Language) Dir() string {
+	if l.IsRTL() {
+		return DirectionRTL
+	}
+	return DirectionLTR
+}
+
+// applyLanguageDefaults fills in the fields a language leaves empty
+func applyLanguageDefaults(l *Language, code string) {
+	if l.Code == "" {
+		l.Code = code
+	}
+	if l.Name == "" {
+		l.Name = code
+	}
+	if l.NativeName == "" {
+		l.NativeName = l.Name
+	}
+	if l.Direction == "" {
+		l.Direction = DirectionLTR
+		if rtlLanguages[baseLanguage(strings.ToLower(code))] {
+			l.Direction = DirectionRTL
+		}
+	}
+	if l.DateFormat == "" {
+		l.DateFormat = DefaultDateFormat
+	}
+	if l.TimeFormat == "" {
+		l.TimeFormat = DefaultTimeFormat
+	}
+	if l.DateTimeFormat == "" {
+		l.DateTimeFormat = DefaultDateTimeFormat
+	}
+	if l.DecimalSeparator == "" {
+		l.DecimalSeparator = DefaultDecimalSeparator
+	}
+	if l.GroupSeparator == "" {
+		l.GroupSeparator = DefaultGroupSeparator
+	}
+}
+
+// Language returns the language of this translator. Translators of
+// languages that are not loaded get the default formats.
+func (t *Translator) Language() *Language {
+	if t == nil || t.language == nil {
+		l := &Language{}
+		applyLanguageDefaults(l, t.Lang())
+		return l
+	}
+	return t.language
+}
+
+// FormatDate formats a date in the format of the language
+func (t *Translator) FormatDate(tm time.Time) string {
+	return tm.Format(t.Language().DateFormat)
+}
+
+// FormatTime formats a time of day in the format of the language
+func (t *Translator) FormatTime(tm time.Time) string {
+	return tm.Format(t.Language().TimeFormat)
+}
+
+// FormatDateTime formats a date and time in the format of the language
+func (t *Translator) FormatDateTime(tm time.Time) string {
+	return tm.Format(t.Language().DateTimeFormat)
+}
+
+// FormatNumber formats a number with the given decimals and the decimal
+// and thousands separators of the language
+func (t *Translator) FormatNumber(n float64, decimals int) string {
+	language := t.Language()
+
+	formatted := strconv.FormatFloat(n, 'f', decimals, 64)
+	negative := strings.HasPrefix(formatted, "-")
+	formatted = strings.TrimPrefix(formatted, "-")
+
+	intPart, fracPart, hasFrac := strings.Cut(formatted, ".")
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(language.GroupSeparator)
+		}
+		b.WriteRune(c)
+	}
+	if hasFrac {
+		b.WriteString(language.DecimalSeparator)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package i18n
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMissingKeys limits the missing keys recorded per language, so keys
+// built from user input cannot grow the report without bound
+const maxMissingKeys = 1000
+
+// MissingKey is a translation key that was looked up in a language without
+// a translation
+type MissingKey struct {
+	Key       string    `json:"key"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// missingKeys records the missing keys of all languages of a manager
+type missingKeys struct {
+	mu   sync.Mutex
+	keys map[string]map[string]*MissingKey
+}
+
+func newMissingKeys() *missingKeys {
+	return &missingKeys{keys: make(map[string]map[string]*MissingKey)}
+}
+
+// report records a lookup of a key a language has no translation for
+func (r *missingKeys) report(lang, key string) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, ok := r.keys[lang]
+	if !ok {
+		keys = make(map[string]*MissingKey)
+		r.keys[lang] = keys
+	}
+	if entry, ok := keys[key]; ok {
+		entry.Count++
+		entry.LastSeen = now
+		return
+	}
+	if len(keys) >= maxMissingKeys {
+		return
+	}
+	keys[key] = &MissingKey{Key: key, Count: 1, FirstSeen: now, LastSeen: now}
+}
+
+// MissingKeys returns the keys looked up in a language without a
+// translation since the start or the last reset, sorted by key
+func (m *Manager) MissingKeys(lang string) []MissingKey {
+	m.missing.mu.Lock()
+	defer m.missing.mu.Unlock()
+
+	keys := make([]MissingKey, 0, len(m.missing.keys[lang]))
+	for _, entry := range m.missing.keys[lang] {
+		keys = append(keys, *entry)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// ResetMissingKeys forgets the missing keys of a language, or of all
+// languages when lang is empty
+func (m *Manager) ResetMissingKeys(lang string) {
+	m.missing.mu.Lock()
+	defer m.missing.mu.Unlock()
+
+	if lang == "" {
+		m.missing.keys = make(map[string]map[string]*MissingKey)
+		return
+	}
+	delete(m.missing.keys, lang)
+}
+
+// UntranslatedKeys returns the keys of the fallback language a language
+// has no translation for, sorted
+func (m *Manager) UntranslatedKeys(lang string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []string{}
+	translator, ok := m.translators[lang]
+	fallback, hasFallback := m.translators[m.fallbackLang]
+	if !ok || !hasFallback || lang == m.fallbackLang {
+		return keys
+	}
+	for key := range fallback.translations {
+		if _, ok := translator.translations[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
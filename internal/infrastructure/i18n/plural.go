@@ -0,0 +1,250 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Plural categories, as defined by the Unicode CLDR plural rules
+const (
+	PluralZero  = "zero"
+	PluralOne   = "one"
+	PluralTwo   = "two"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// PluralRule returns the plural category of a count
+type PluralRule func(n int) string
+
+var (
+	pluralMu sync.RWMutex
+
+	// pluralRules are the CLDR cardinal rules of integer counts, by
+	// language code. Languages not listed use pluralOneOther.
+	pluralRules = map[string]PluralRule{
+		"zh": pluralNone, "ja": pluralNone, "ko": pluralNone, "vi": pluralNone,
+		"th": pluralNone, "id": pluralNone, "ms": pluralNone,
+		"fr": pluralZeroOne, "pt": pluralZeroOne, "hi": pluralZeroOne,
+		"bn": pluralZeroOne, "fa": pluralZeroOne, "hy": pluralZeroOne,
+		"ru": pluralEastSlavic, "uk": pluralEastSlavic, "be": pluralEastSlavic,
+		"hr": pluralSouthSlavic, "sr": pluralSouthSlavic, "bs": pluralSouthSlavic,
+		"pl": pluralPolish,
+		"cs": pluralCzech, "sk": pluralCzech,
+		"sl": pluralSlovenian,
+		"lt": pluralLithuanian,
+		"lv": pluralLatvian,
+		"ro": pluralRomanian,
+		"ar": pluralArabic,
+		"he": pluralHebrew,
+	}
+)
+
+// RegisterPluralRule sets the plural rule of a language, replacing the
+// built-in one
+func RegisterPluralRule(lang string, rule PluralRule) {
+	pluralMu.Lock()
+	defer pluralMu.Unlock()
+	pluralRules[strings.ToLower(lang)] = rule
+}
+
+// PluralCategory returns the plural category of a count in a language.
+// Regional codes like "pt-BR" use the rule of their base language unless
+// they have one of their own.
+func PluralCategory(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	lang = strings.ToLower(lang)
+
+	pluralMu.RLock()
+	rule, ok := pluralRules[lang]
+	if !ok {
+		rule, ok = pluralRules[baseLanguage(lang)]
+	}
+	pluralMu.RUnlock()
+
+	if !ok {
+		rule = pluralOneOther
+	}
+	return rule(n)
+}
+
+// Plural translates the plural form of a key for a count. The forms are
+// sub-keys named after the plural categories of the language (e.g.
+// "items.one" and "items.other"), with "other" used for categories that
+// have no form. Without arguments the count is formatted into the form.
+func (t *Translator) Plural(key string, count int, args ...any) string {
+	if t == nil {
+		return key
+	}
+
+	category := PluralCategory(t.lang, count)
+	value, ok := t.translations[key+"."+category]
+	if !ok {
+		value, ok = t.translations[key+"."+PluralOther]
+	}
+	if !ok {
+		t.missing.report(t.lang, key+"."+category)
+		if t.fallback != nil {
+			return t.fallback.Plural(key, count, args...)
+		}
+		return key
+	}
+
+	if len(args) == 0 && strings.Contains(value, "%") {
+		args = []any{count}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(value, args...)
+	}
+	return value
+}
+
+// baseLanguage returns the language of a regional code like "pt-br"
+func baseLanguage(lang string) string {
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		return lang[:i]
+	}
+	return lang
+}
+
+func pluralNone(n int) string {
+	return PluralOther
+}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralZeroOne(n int) string {
+	if n == 0 || n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralEastSlavic(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 1 && mod100 != 11:
+		return PluralOne
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+func pluralSouthSlavic(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 1 && mod100 != 11:
+		return PluralOne
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralPolish(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case n == 1:
+		return PluralOne
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+func pluralCzech(n int) string {
+	switch {
+	case n == 1:
+		return PluralOne
+	case n >= 2 && n <= 4:
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralSlovenian(n int) string {
+	switch n % 100 {
+	case 1:
+		return PluralOne
+	case 2:
+		return PluralTwo
+	case 3, 4:
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralLithuanian(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod100 >= 11 && mod100 <= 19:
+		return PluralOther
+	case mod10 == 1:
+		return PluralOne
+	case mod10 >= 2:
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralLatvian(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 0 || (mod100 >= 11 && mod100 <= 19):
+		return PluralZero
+	case mod10 == 1:
+		return PluralOne
+	default:
+		return PluralOther
+	}
+}
+
+func pluralRomanian(n int) string {
+	switch mod100 := n % 100; {
+	case n == 1:
+		return PluralOne
+	case n == 0 || (mod100 >= 1 && mod100 <= 19):
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralArabic(n int) string {
+	switch mod100 := n % 100; {
+	case n == 0:
+		return PluralZero
+	case n == 1:
+		return PluralOne
+	case n == 2:
+		return PluralTwo
+	case mod100 >= 3 && mod100 <= 10:
+		return PluralFew
+	case mod100 >= 11:
+		return PluralMany
+	default:
+		return PluralOther
+	}
+}
+
+func pluralHebrew(n int) string {
+	switch n {
+	case 1:
+		return PluralOne
+	case 2:
+		return PluralTwo
+	default:
+		return PluralOther
+	}
+}
@@ -112,6 +112,8 @@ func englishTranslations() map[string]any {
 				"password_placeholder":         "Create a strong password",
 				"confirm_password":             "Confirm Password",
 				"confirm_password_placeholder": "Confirm your password",
+				"currency":                     "Currency",
+				"currency_hint":                "Prices are shown and invoices issued in this currency. It cannot be changed after your first invoice.",
 				"agree_terms":                  "I agree to the",
 				"terms":                        "Terms of Service",
 				"and":                          "and",
@@ -206,6 +208,7 @@ func englishTranslations() map[string]any {
 			"configure":    "Configure",
 			"compare":      "Compare Plans",
 			"all_products": "All Products",
+			"out_of_stock": "Out of stock",
 			"categories": map[string]any{
 				"all":       "All",
 				"vps":       "VPS",
@@ -231,28 +234,34 @@ func englishTranslations() map[string]any {
 			"faq_title":     "Frequently Asked Questions",
 		},
 		"cart": map[string]any{
-			"title":         "Shopping Cart",
-			"empty":         "Your cart is empty",
-			"continue":      "Continue Shopping",
-			"checkout":      "Proceed to Checkout",
-			"remove":        "Remove",
-			"update":        "Update",
-			"item":          "Item",
-			"items":         "Items",
-			"billing_cycle": "Billing Cycle",
-			"setup_fee":     "Setup Fee",
-			"recurring":     "Recurring",
-			"promo_code":    "Promo Code",
-			"apply":         "Apply",
-			"summary":       "Order Summary",
+			"title":          "Shopping Cart",
+			"empty":          "Your cart is empty",
+			"continue":       "Continue Shopping",
+			"checkout":       "Proceed to Checkout",
+			"remove":         "Remove",
+			"update":         "Update",
+			"item":           "Item",
+			"items":          "Items",
+			"billing_cycle":  "Billing Cycle",
+			"setup_fee":      "Setup Fee",
+			"recurring":      "Recurring",
+			"promo_code":     "Promo Code",
+			"savings":        "You Save",
+			"tax_estimated":  "estimated for %s",
+			"tax_country":    "Country for tax",
+			"update_country": "Update",
+			"apply":          "Apply",
+			"summary":        "Order Summary",
 		},
 		"checkout": map[string]any{
-			"title":          "Checkout",
-			"billing_info":   "Billing Information",
-			"payment_method": "Payment Method",
-			"review_order":   "Review Order",
-			"place_order":    "Place Order",
-			"agree_terms":    "I agree to the Terms of Service",
+			"title":           "Checkout",
+			"billing_info":    "Billing Information",
+			"payment_method":  "Payment Method",
+			"review_order":    "Review Order",
+			"place_order":     "Place Order",
+			"agree_terms":     "I agree to the Terms of Service",
+			"vat_number":      "VAT Number",
+			"vat_number_hint": "EU businesses, e.g. DE123456789",
 			"success": map[string]any{
 				"title":        "Order Confirmed!",
 				"message":      "Thank you for your order. You will receive a confirmation email shortly.",
@@ -293,16 +302,17 @@ func englishTranslations() map[string]any {
 					"view":    "View Details",
 				},
 				"details": map[string]any{
-					"title":      "Service Details",
-					"product":    "Product",
-					"domain":     "Domain",
-					"server":     "Server",
-					"username":   "Username",
-					"password":   "Password",
-					"next_due":   "Next Due Date",
-					"billing":    "Billing Cycle",
-					"amount":     "Recurring Amount",
-					"registered": "Registration Date",
+					"title":       "Service Details",
+					"product":     "Product",
+					"domain":      "Domain",
+					"server":      "Server",
+					"username":    "Username",
+					"password":    "Password",
+					"next_due":    "Next Due Date",
+					"billing":     "Billing Cycle",
+					"amount":      "Recurring Amount",
+					"registered":  "Registration Date",
+					"maintenance": "Maintenance in progress",
 				},
 			},
 			"invoices": map[string]any{
@@ -444,6 +454,20 @@ func englishTranslations() map[string]any {
 				"title":  "Customers",
 				"add":    "Add Customer",
 				"search": "Search customers...",
+				"health": "Health",
+				"risk": map[string]any{
+					"title":     "Risk",
+					"all":       "All customers",
+					"healthy":   "Healthy",
+					"at_risk":   "At risk",
+					"high_risk": "High risk",
+				},
+			},
+			"tasks": map[string]any{
+				"mine":   "My Open Tasks",
+				"title":  "Task",
+				"entity": "Related To",
+				"due":    "Due",
 			},
 			"orders": map[string]any{
 				"title": "Orders",
@@ -497,6 +521,19 @@ func englishTranslations() map[string]any {
 				"terms":   "Terms",
 			},
 		},
+		"unsubscribe": map[string]any{
+			"title":      "Unsubscribe",
+			"subtitle":   "Stop getting these emails at %s.",
+			"categories": "You will no longer get:",
+			"confirm":    "Unsubscribe",
+			"done":       "You have been unsubscribed. You can change this at any time in your account.",
+			"not_found":  "This unsubscribe link is not valid.",
+			"category": map[string]any{
+				"announcement":   "Announcements",
+				"knowledge_base": "Knowledge base articles",
+				"marketing":      "Offers and news",
+			},
+		},
 		"errors": map[string]any{
 			"404": map[string]any{
 				"title":   "Page Not Found",
@@ -509,9 +546,20 @@ func englishTranslations() map[string]any {
 				"back":    "Go Back Home",
 			},
 			"403": map[string]any{
-				"title":   "Access Denied",
-				"message": "You don't have permission to access this page.",
-				"back":    "Go Back Home",
+				"title":    "Access Denied",
+				"message":  "You don't have permission to access this page.",
+				"back":     "Go Back Home",
+				"admin_ip": "The admin area cannot be reached from your address, %s.",
+			},
+			"429": map[string]any{
+				"title":   "Too Many Requests",
+				"message": "Too many attempts were made from your address, %s. Please try again later.",
+				"until":   "You can try again after %s",
+			},
+			"503": map[string]any{
+				"title":   "Under Maintenance",
+				"message": "We're making improvements and will be back shortly. Thank you for your patience.",
+				"until":   "Expected back by %s",
 			},
 		},
 		"validation": map[string]any{
@@ -524,5 +572,39 @@ func englishTranslations() map[string]any {
 			"numeric":        "Must be a number",
 			"url":            "Please enter a valid URL",
 		},
+		"pdf": map[string]any{
+			"invoice": map[string]any{
+				"title":          "Invoice",
+				"number":         "Invoice number",
+				"date":           "Invoice date",
+				"due_date":       "Due date",
+				"paid_date":      "Paid on",
+				"status_label":   "Status",
+				"bill_to":        "Bill to",
+				"vat_number":     "VAT number: %s",
+				"tax_id":         "Tax ID: %s",
+				"description":    "Description",
+				"quantity":       "Qty",
+				"unit_price":     "Unit price",
+				"amount":         "Amount",
+				"subtotal":       "Subtotal",
+				"discount":       "Discount",
+				"tax":            "Tax",
+				"total":          "Total",
+				"amount_paid":    "Amount paid",
+				"balance":        "Balance due",
+				"reverse_charge": "Reverse charge: VAT to be accounted for by the recipient",
+				"notes":          "Notes",
+				"page":           "Page %d of %d",
+				"status": map[string]any{
+					"draft":     "Draft",
+					"unpaid":    "Unpaid",
+					"paid":      "Paid",
+					"overdue":   "Overdue",
+					"cancelled": "Cancelled",
+					"refunded":  "Refunded",
+				},
+			},
+		},
 	}
 }
@@ -112,6 +112,8 @@ func chineseTranslations() map[string]any {
 				"password_placeholder":         "创建一个强密码",
 				"confirm_password":             "确认密码",
 				"confirm_password_placeholder": "再次输入密码",
+				"currency":                     "币种",
+				"currency_hint":                "价格与账单均以该币种显示和开具，首张账单生成后不可更改。",
 				"agree_terms":                  "我同意",
 				"terms":                        "服务条款",
 				"and":                          "和",
@@ -206,6 +208,7 @@ func chineseTranslations() map[string]any {
 			"configure":    "配置",
 			"compare":      "对比方案",
 			"all_products": "全部产品",
+			"out_of_stock": "已售罄",
 			"categories": map[string]any{
 				"all":       "全部",
 				"vps":       "VPS 云服务器",
@@ -231,28 +234,34 @@ func chineseTranslations() map[string]any {
 			"faq_title":     "常见问题",
 		},
 		"cart": map[string]any{
-			"title":         "购物车",
-			"empty":         "您的购物车是空的",
-			"continue":      "继续购物",
-			"checkout":      "去结算",
-			"remove":        "移除",
-			"update":        "更新",
-			"item":          "商品",
-			"items":         "商品",
-			"billing_cycle": "计费周期",
-			"setup_fee":     "初装费",
-			"recurring":     "续费金额",
-			"promo_code":    "优惠码",
-			"apply":         "应用",
-			"summary":       "订单摘要",
+			"title":          "购物车",
+			"empty":          "您的购物车是空的",
+			"continue":       "继续购物",
+			"checkout":       "去结算",
+			"remove":         "移除",
+			"update":         "更新",
+			"item":           "商品",
+			"items":          "商品",
+			"billing_cycle":  "计费周期",
+			"setup_fee":      "初装费",
+			"recurring":      "续费金额",
+			"promo_code":     "优惠码",
+			"savings":        "已节省",
+			"tax_estimated":  "按 %s 估算",
+			"tax_country":    "计税国家",
+			"update_country": "更新",
+			"apply":          "应用",
+			"summary":        "订单摘要",
 		},
 		"checkout": map[string]any{
-			"title":          "结算",
-			"billing_info":   "账单信息",
-			"payment_method": "支付方式",
-			"review_order":   "确认订单",
-			"place_order":    "提交订单",
-			"agree_terms":    "我同意服务条款",
+			"title":           "结算",
+			"billing_info":    "账单信息",
+			"payment_method":  "支付方式",
+			"review_order":    "确认订单",
+			"place_order":     "提交订单",
+			"agree_terms":     "我同意服务条款",
+			"vat_number":      "增值税号",
+			"vat_number_hint": "欧盟企业填写，例如 DE123456789",
 			"success": map[string]any{
 				"title":        "订单已确认！",
 				"message":      "感谢您的订购。您将很快收到确认邮件。",
@@ -293,16 +302,17 @@ func chineseTranslations() map[string]any {
 					"view":    "查看详情",
 				},
 				"details": map[string]any{
-					"title":      "服务详情",
-					"product":    "产品",
-					"domain":     "域名",
-					"server":     "服务器",
-					"username":   "用户名",
-					"password":   "密码",
-					"next_due":   "下次到期日",
-					"billing":    "计费周期",
-					"amount":     "续费金额",
-					"registered": "注册日期",
+					"title":       "服务详情",
+					"product":     "产品",
+					"domain":      "域名",
+					"server":      "服务器",
+					"username":    "用户名",
+					"password":    "密码",
+					"next_due":    "下次到期日",
+					"billing":     "计费周期",
+					"amount":      "续费金额",
+					"registered":  "注册日期",
+					"maintenance": "正在维护",
 				},
 			},
 			"invoices": map[string]any{
@@ -444,6 +454,20 @@ func chineseTranslations() map[string]any {
 				"title":  "客户管理",
 				"add":    "添加客户",
 				"search": "搜索客户...",
+				"health": "健康度",
+				"risk": map[string]any{
+					"title":     "风险",
+					"all":       "全部客户",
+					"healthy":   "健康",
+					"at_risk":   "有风险",
+					"high_risk": "高风险",
+				},
+			},
+			"tasks": map[string]any{
+				"mine":   "我的待办任务",
+				"title":  "任务",
+				"entity": "关联对象",
+				"due":    "截止时间",
 			},
 			"orders": map[string]any{
 				"title": "订单管理",
@@ -497,6 +521,19 @@ func chineseTranslations() map[string]any {
 				"terms":   "服务条款",
 			},
 		},
+		"unsubscribe": map[string]any{
+			"title":      "退订",
+			"subtitle":   "%s 将不再收到这些邮件。",
+			"categories": "你将不再收到:",
+			"confirm":    "退订",
+			"done":       "你已成功退订，可随时在账户中更改此设置。",
+			"not_found":  "此退订链接无效。",
+			"category": map[string]any{
+				"announcement":   "公告",
+				"knowledge_base": "知识库文章",
+				"marketing":      "优惠与新闻",
+			},
+		},
 		"errors": map[string]any{
 			"404": map[string]any{
 				"title":   "页面未找到",
@@ -509,9 +546,20 @@ func chineseTranslations() map[string]any {
 				"back":    "返回首页",
 			},
 			"403": map[string]any{
-				"title":   "访问被拒绝",
-				"message": "您没有权限访问此页面。",
-				"back":    "返回首页",
+				"title":    "访问被拒绝",
+				"message":  "您没有权限访问此页面。",
+				"back":     "返回首页",
+				"admin_ip": "您的地址 %s 无法访问管理后台。",
+			},
+			"429": map[string]any{
+				"title":   "请求过于频繁",
+				"message": "您的地址 %s 尝试次数过多，请稍后再试。",
+				"until":   "您可以在 %s 之后重试",
+			},
+			"503": map[string]any{
+				"title":   "系统维护中",
+				"message": "我们正在进行系统升级，很快就会恢复，感谢您的耐心等待。",
+				"until":   "预计于 %s 恢复",
 			},
 		},
 		"validation": map[string]any{
@@ -524,5 +572,39 @@ func chineseTranslations() map[string]any {
 			"numeric":        "必须是数字",
 			"url":            "请输入有效的 URL",
 		},
+		"pdf": map[string]any{
+			"invoice": map[string]any{
+				"title":          "账单",
+				"number":         "账单编号",
+				"date":           "开具日期",
+				"due_date":       "到期日",
+				"paid_date":      "支付日期",
+				"status_label":   "状态",
+				"bill_to":        "付款方",
+				"vat_number":     "增值税号: %s",
+				"tax_id":         "税号: %s",
+				"description":    "描述",
+				"quantity":       "数量",
+				"unit_price":     "单价",
+				"amount":         "金额",
+				"subtotal":       "小计",
+				"discount":       "折扣",
+				"tax":            "税费",
+				"total":          "总计",
+				"amount_paid":    "已付金额",
+				"balance":        "应付余额",
+				"reverse_charge": "反向征收: 增值税由购买方申报缴纳",
+				"notes":          "备注",
+				"page":           "第 %d 页，共 %d 页",
+				"status": map[string]any{
+					"draft":     "草稿",
+					"unpaid":    "未支付",
+					"paid":      "已支付",
+					"overdue":   "已逾期",
+					"cancelled": "已取消",
+					"refunded":  "已退款",
+				},
+			},
+		},
 	}
 }
@@ -0,0 +1,272 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/money"
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
+)
+
+// Seller is the business issuing invoices, as printed on them
+type Seller struct {
+	Name      string
+	Country   string
+	VATNumber string
+}
+
+// Layout of invoice pages, in points
+const (
+	margin       = 50.0
+	footerHeight = 60.0
+	rowHeight    = 18.0
+	columnQty    = 340.0 // Right edges of the numeric columns
+	columnPrice  = 440.0
+	columnAmount = PageWidth - margin
+)
+
+// InvoiceRenderer renders invoices with the labels, dates and amounts of
+// the language of the reader
+type InvoiceRenderer struct {
+	i18n   *i18n.Manager
+	money  *money.Service
+	seller func() Seller
+}
+
+// NewInvoiceRenderer creates a renderer printing the seller returned by
+// seller, which is called for each invoice so changes to it show at once
+func NewInvoiceRenderer(i18nManager *i18n.Manager, moneyService *money.Service, seller func() Seller) *InvoiceRenderer {
+	return &InvoiceRenderer{i18n: i18nManager, money: moneyService, seller: seller}
+}
+
+// RenderInvoice renders an invoice loaded with its line items, taxes and
+// customer as a PDF
+func (r *InvoiceRenderer) RenderInvoice(invoice *domain.Invoice, language string) ([]byte, error) {
+	t := r.i18n.GetTranslator(language)
+	w := &invoiceWriter{
+		doc:     New(t.T("pdf.invoice.title") + " " + invoice.InvoiceNumber),
+		t:       t,
+		money:   r.money,
+		locale:  moneyLocale(t.Language()),
+		invoice: invoice,
+	}
+	w.doc.AddPage()
+	w.header(r.seller())
+	w.lineItems()
+	w.totals()
+	w.notes()
+	w.pageNumbers()
+	return w.doc.Bytes(), nil
+}
+
+// invoiceWriter lays an invoice out, adding pages as the line items need
+type invoiceWriter struct {
+	doc     *Document
+	t       *i18n.Translator
+	money   *money.Service
+	locale  money.Locale
+	invoice *domain.Invoice
+	y       float64
+}
+
+func (w *invoiceWriter) header(seller Seller) {
+	inv := w.invoice
+	top := PageHeight - margin
+
+	// Seller on the left, title on the right
+	w.doc.Text(margin, top-16, 16, true, 0, seller.Name)
+	y := top - 32
+	if seller.Country != "" {
+		w.doc.Text(margin, y, 9, false, 0.3, seller.Country)
+		y -= 12
+	}
+	if seller.VATNumber != "" {
+		w.doc.Text(margin, y, 9, false, 0.3, w.t.T("pdf.invoice.vat_number", seller.VATNumber))
+	}
+	w.doc.TextRight(columnAmount, top-18, 22, true, 0, strings.ToUpper(w.t.T("pdf.invoice.title")))
+
+	// Invoice details under the title
+	details := [][2]string{
+		{w.t.T("pdf.invoice.number"), inv.InvoiceNumber},
+		{w.t.T("pdf.invoice.date"), w.t.FormatDate(inv.CreatedAt)},
+		{w.t.T("pdf.invoice.due_date"), w.t.FormatDate(inv.DueDate)},
+	}
+	if inv.PaidAt != nil {
+		details = append(details, [2]string{w.t.T("pdf.invoice.paid_date"), w.t.FormatDate(*inv.PaidAt)})
+	}
+	details = append(details, [2]string{w.t.T("pdf.invoice.status_label"), w.t.T("pdf.invoice.status." + string(inv.Status))})
+	y = top - 44
+	for _, detail := range details {
+		w.doc.TextRight(columnPrice, y, 9, false, 0.4, detail[0])
+		w.doc.TextRight(columnAmount, y, 9, true, 0, detail[1])
+		y -= 13
+	}
+
+	// Customer
+	c := inv.Customer
+	billTo := top - 120
+	w.doc.Text(margin, billTo, 9, true, 0.4, strings.ToUpper(w.t.T("pdf.invoice.bill_to")))
+	lines := []string{
+		strings.TrimSpace(c.FirstName + " " + c.LastName),
+		c.Company,
+		c.Address1,
+		c.Address2,
+		strings.TrimSpace(strings.Join(nonEmpty(c.City, c.State, c.PostalCode), ", ")),
+		c.Country,
+		c.Email,
+	}
+	if inv.VATNumber != "" {
+		lines = append(lines, w.t.T("pdf.invoice.vat_number", inv.VATNumber))
+	} else if c.TaxID != "" {
+		lines = append(lines, w.t.T("pdf.invoice.tax_id", c.TaxID))
+	}
+	y = billTo - 15
+	for _, line := range nonEmpty(lines...) {
+		w.doc.Text(margin, y, 10, false, 0, Fit(line, 10, 280))
+		y -= 13
+	}
+
+	w.y = y - 20
+	w.tableHeader()
+}
+
+func (w *invoiceWriter) tableHeader() {
+	w.doc.Rect(margin, w.y-6, columnAmount-margin, rowHeight, 0.93)
+	w.doc.Text(margin+6, w.y, 9, true, 0, w.t.T("pdf.invoice.description"))
+	w.doc.TextRight(columnQty, w.y, 9, true, 0, w.t.T("pdf.invoice.quantity"))
+	w.doc.TextRight(columnPrice, w.y, 9, true, 0, w.t.T("pdf.invoice.unit_price"))
+	w.doc.TextRight(columnAmount-6, w.y, 9, true, 0, w.t.T("pdf.invoice.amount"))
+	w.y -= rowHeight + 4
+}
+
+// space moves to a new page, under a new table header when the table goes
+// on, when fewer than height points are left
+func (w *invoiceWriter) space(height float64, table bool) {
+	if w.y-height >= margin+footerHeight {
+		return
+	}
+	w.doc.AddPage()
+	w.y = PageHeight - margin - 10
+	if table {
+		w.tableHeader()
+	}
+}
+
+func (w *invoiceWriter) lineItems() {
+	for _, item := range w.invoice.LineItems {
+		period := ""
+		if item.PeriodStart != nil && item.PeriodEnd != nil {
+			period = w.t.FormatDate(*item.PeriodStart) + " - " + w.t.FormatDate(*item.PeriodEnd)
+		}
+		height := rowHeight
+		if period != "" {
+			height += 11
+		}
+		w.space(height, true)
+
+		w.doc.Text(margin+6, w.y, 10, false, 0, Fit(item.Description, 10, columnQty-margin-50))
+		w.doc.TextRight(columnQty, w.y, 10, false, 0, item.Quantity.String())
+		w.doc.TextRight(columnPrice, w.y, 10, false, 0, w.format(item.UnitPrice))
+		w.doc.TextRight(columnAmount-6, w.y, 10, false, 0, w.format(item.Total))
+		if period != "" {
+			w.doc.Text(margin+6, w.y-11, 8, false, 0.45, period)
+		}
+		w.doc.Line(margin, w.y-height+12, columnAmount, w.y-height+12, 0.5, 0.85)
+		w.y -= height
+	}
+	w.y -= 6
+}
+
+func (w *invoiceWriter) totals() {
+	inv := w.invoice
+	rows := [][2]string{{w.t.T("pdf.invoice.subtotal"), w.format(inv.Subtotal)}}
+	if !inv.Discount.IsZero() {
+		rows = append(rows, [2]string{w.t.T("pdf.invoice.discount"), w.format(inv.Discount.Neg())})
+	}
+	if len(inv.Taxes) > 0 {
+		for _, tax := range inv.Taxes {
+			label := fmt.Sprintf("%s (%s%%)", tax.Name, tax.Rate.String())
+			rows = append(rows, [2]string{label, w.format(tax.Amount)})
+		}
+	} else if !inv.TaxAmount.IsZero() {
+		label := fmt.Sprintf("%s (%s%%)", w.t.T("pdf.invoice.tax"), inv.TaxRate.String())
+		rows = append(rows, [2]string{label, w.format(inv.TaxAmount)})
+	}
+
+	w.space(float64(len(rows)+4)*15, false)
+	for _, row := range rows {
+		w.doc.TextRight(columnPrice, w.y, 10, false, 0.3, row[0])
+		w.doc.TextRight(columnAmount-6, w.y, 10, false, 0, row[1])
+		w.y -= 15
+	}
+	w.doc.Line(columnPrice-120, w.y+10, columnAmount, w.y+10, 0.8, 0)
+	w.y -= 4
+	w.doc.TextRight(columnPrice, w.y, 12, true, 0, w.t.T("pdf.invoice.total"))
+	w.doc.TextRight(columnAmount-6, w.y, 12, true, 0, w.format(inv.Total))
+	w.y -= 18
+	if !inv.AmountPaid.IsZero() {
+		w.doc.TextRight(columnPrice, w.y, 10, false, 0.3, w.t.T("pdf.invoice.amount_paid"))
+		w.doc.TextRight(columnAmount-6, w.y, 10, false, 0, w.format(inv.AmountPaid.Neg()))
+		w.y -= 15
+	}
+	w.doc.TextRight(columnPrice, w.y, 10, true, 0, w.t.T("pdf.invoice.balance"))
+	w.doc.TextRight(columnAmount-6, w.y, 10, true, 0, w.format(inv.Balance))
+	w.y -= 24
+
+	if inv.ReverseCharge {
+		w.space(15, false)
+		w.doc.Text(margin, w.y, 9, false, 0.3, w.t.T("pdf.invoice.reverse_charge"))
+		w.y -= 15
+	}
+}
+
+func (w *invoiceWriter) notes() {
+	notes := strings.TrimSpace(w.invoice.Notes)
+	if notes == "" {
+		return
+	}
+	w.space(30, false)
+	w.doc.Text(margin, w.y, 9, true, 0.4, strings.ToUpper(w.t.T("pdf.invoice.notes")))
+	w.y -= 13
+	for _, line := range strings.Split(notes, "\n") {
+		w.space(12, false)
+		w.doc.Text(margin, w.y, 9, false, 0, Fit(strings.TrimSpace(line), 9, columnAmount-margin))
+		w.y -= 12
+	}
+}
+
+// pageNumbers numbers the pages at their foot, once they are all added
+func (w *invoiceWriter) pageNumbers() {
+	count := w.doc.PageCount()
+	for n := 1; n <= count; n++ {
+		w.doc.SetPage(n)
+		w.doc.Line(margin, margin+20, columnAmount, margin+20, 0.5, 0.85)
+		w.doc.Text(margin, margin+6, 8, false, 0.45, w.invoice.InvoiceNumber)
+		w.doc.TextRight(columnAmount, margin+6, 8, false, 0.45, w.t.T("pdf.invoice.page", n, count))
+	}
+}
+
+func (w *invoiceWriter) format(amount decimal.Decimal) string {
+	return w.money.Format(amount, w.invoice.Currency, w.locale)
+}
+
+func moneyLocale(language *i18n.Language) money.Locale {
+	return money.Locale{
+		DecimalSeparator: language.DecimalSeparator,
+		GroupSeparator:   language.GroupSeparator,
+		Pattern:          language.CurrencyFormat,
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,250 @@
+// Package pdf writes simple PDF documents, such as invoices, without
+// embedding fonts. Latin text uses the standard Helvetica fonts and other
+// scripts, Chinese first, the STSong-Light font PDF readers provide.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Page size of A4 in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Fonts of every document, as named in the page resources
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontCJK     = "F3"
+)
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size. Helvetica-Bold is close
+// enough for aligning text, and its digits are the same width.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// winAnsiSpecials are the characters of WinAnsiEncoding outside Latin-1
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// Document is a PDF document being written, page by page. Coordinates
+// are in points from the bottom left corner of the page.
+type Document struct {
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+// New creates a document with the given title and no pages
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage starts a new page, which the following calls draw on
+func (d *Document) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// PageCount returns the number of pages added so far
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// SetPage makes the following calls draw on a page added before,
+// numbered from 1, such as to number the pages once they are all added
+func (d *Document) SetPage(n int) {
+	d.page = d.pages[n-1]
+}
+
+// Text draws text with its baseline starting at x, y. Gray is the shade
+// of the text, from 0 for black to 1 for white.
+func (d *Document) Text(x, y, size float64, bold bool, gray float64, text string) {
+	if text == "" {
+		return
+	}
+	font, encoded := encode(text, bold)
+	fmt.Fprintf(d.page, "BT %.2f g /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", gray, font, size, x, y, encoded)
+}
+
+// TextRight draws text ending at x
+func (d *Document) TextRight(x, y, size float64, bold bool, gray float64, text string) {
+	d.Text(x-TextWidth(text, size), y, size, bold, gray, text)
+}
+
+// Line draws a line of the given width and shade
+func (d *Document) Line(x1, y1, x2, y2, width, gray float64) {
+	fmt.Fprintf(d.page, "%.2f G %.2f w %.2f %.2f m %.2f %.2f l S\n", gray, width, x1, y1, x2, y2)
+}
+
+// Rect fills a rectangle whose bottom left corner is at x, y
+func (d *Document) Rect(x, y, width, height, gray float64) {
+	fmt.Fprintf(d.page, "%.2f g %.2f %.2f %.2f %.2f re f\n", gray, x, y, width, height)
+}
+
+// TextWidth returns the width of text in points, as drawn by Text
+func TextWidth(text string, size float64) float64 {
+	units := 0
+	cjk := needsCJK(text)
+	for _, r := range text {
+		switch {
+		case cjk && r < 0x80:
+			units += 500
+		case cjk:
+			units += 1000
+		case r >= ' ' && r <= '~':
+			units += helveticaWidths[r-' ']
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// Fit shortens text with an ellipsis so it is at most width points wide
+func Fit(text string, size, width float64) string {
+	if TextWidth(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		shortened := strings.TrimRight(string(runes), " ") + "..."
+		if TextWidth(shortened, size) <= width {
+			return shortened
+		}
+	}
+	return ""
+}
+
+// Bytes returns the document as a PDF file
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	// Objects 1 to 7 come first so pages can refer to them; pages take
+	// two objects each from 8 on
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 8+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [6 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 7 0 R /DW 1000 /W [1 95 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+
+	resources := fmt.Sprintf("<< /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >>", fontRegular, fontBold, fontCJK)
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			PageWidth, PageHeight, resources, 9+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+	object(fmt.Sprintf("<< /Title %s /Producer (OpenHost) >>", utf16Text(d.title)))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, len(offsets), xref)
+	return out.Bytes()
+}
+
+// needsCJK reports whether text has characters Helvetica cannot draw
+func needsCJK(text string) bool {
+	for _, r := range text {
+		if _, ok := winAnsi(r); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// winAnsi returns the WinAnsiEncoding byte of a character
+func winAnsi(r rune) (byte, bool) {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return byte(r), true
+	}
+	b, ok := winAnsiSpecials[r]
+	return b, ok
+}
+
+// encode returns the font drawing text and the text as a PDF string in
+// the encoding of that font
+func encode(text string, bold bool) (string, string) {
+	if needsCJK(text) {
+		// UCS-2 has no characters outside the Basic Multilingual Plane
+		var hex strings.Builder
+		hex.WriteByte('<')
+		for _, r := range text {
+			if r > 0xFFFF {
+				r = '?'
+			}
+			fmt.Fprintf(&hex, "%04X", r)
+		}
+		hex.WriteByte('>')
+		return fontCJK, hex.String()
+	}
+
+	var literal strings.Builder
+	literal.WriteByte('(')
+	for _, r := range text {
+		b, _ := winAnsi(r)
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			literal.WriteByte('\\')
+			literal.WriteByte(b)
+		case b < ' ' || b >= 0x7F:
+			fmt.Fprintf(&literal, "\\%03o", b)
+		default:
+			literal.WriteByte(b)
+		}
+	}
+	literal.WriteByte(')')
+	font := fontRegular
+	if bold {
+		font = fontBold
+	}
+	return font, literal.String()
+}
+
+// utf16Text returns text as a PDF text string, which readers show in any
+// script
+func utf16Text(text string) string {
+	var hex strings.Builder
+	hex.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&hex, "%04X", unit)
+	}
+	hex.WriteByte('>')
+	return hex.String()
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	provisionerv1 "github.com/openhost/openhost/pkg/proto/provisioner/v1"
+)
+
+// MockProvisioner is the provisioning driver of test mode. It answers
+// every call with success without reaching a server, so orders can be
+// placed on staging against production-like data.
+type MockProvisioner struct{}
+
+// NewMockProvisioner creates the test mode provisioning driver
+func NewMockProvisioner() *MockProvisioner {
+	return &MockProvisioner{}
+}
+
+var _ provisionerv1.ProvisionerServiceClient = (*MockProvisioner)(nil)
+
+// CreateService returns an external ID derived from the service ID
+func (m *MockProvisioner) CreateService(_ context.Context, in *provisionerv1.CreateServiceRequest, _ ...grpc.CallOption) (*provisionerv1.CreateServiceResponse, error) {
+	return &provisionerv1.CreateServiceResponse{
+		ExternalId: "test-" + in.ServiceId,
+		Message:    "Created in test mode",
+	}, nil
+}
+
+func (m *MockProvisioner) Suspend(_ context.Context, _ *provisionerv1.SuspendRequest, _ ...grpc.CallOption) (*provisionerv1.SuspendResponse, error) {
+	return &provisionerv1.SuspendResponse{Message: "Suspended in test mode"}, nil
+}
+
+func (m *MockProvisioner) Terminate(_ context.Context, _ *provisionerv1.TerminateRequest, _ ...grpc.CallOption) (*provisionerv1.TerminateResponse, error) {
+	return &provisionerv1.TerminateResponse{Message: "Terminated in test mode"}, nil
+}
+
+func (m *MockProvisioner) ChangePackage(_ context.Context, _ *provisionerv1.ChangePackageRequest, _ ...grpc.CallOption) (*provisionerv1.ChangePackageResponse, error) {
+	return &provisionerv1.ChangePackageResponse{Message: "Package changed in test mode"}, nil
+}
+
+func (m *MockProvisioner) PowerControl(_ context.Context, _ *provisionerv1.PowerControlRequest, _ ...grpc.CallOption) (*provisionerv1.PowerControlResponse, error) {
+	return &provisionerv1.PowerControlResponse{Message: "Power action ignored in test mode"}, nil
+}
+
+// GetUsage reports no usage
+func (m *MockProvisioner) GetUsage(_ context.Context, _ *provisionerv1.GetUsageRequest, _ ...grpc.CallOption) (*provisionerv1.GetUsageResponse, error) {
+	return &provisionerv1.GetUsageResponse{Message: "No usage in test mode"}, nil
+}
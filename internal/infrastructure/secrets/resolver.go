@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// Prefixes of credentials referring to secrets kept outside the database:
+// "env:NAME" and "vault:path#field", such as
+// "vault:secret/data/openhost#smtp_password" for a KV version 2 engine
+const (
+	RefEnv   = "env:"
+	RefVault = "vault:"
+)
+
+const (
+	vaultTimeout      = 10 * time.Second
+	defaultVaultCache = 5 * time.Minute
+)
+
+var (
+	ErrEnvNotSet          = errors.New("environment variable of the secret is not set")
+	ErrVaultNotConfigured = errors.New("secret refers to Vault but no Vault address and token are configured")
+	ErrVaultReference     = errors.New("vault secret references must be vault:path#field")
+	ErrVaultField         = errors.New("vault secret has no such field")
+)
+
+// Resolver resolves references to secrets in environment variables and
+// HashiCorp Vault. It implements domain.SecretResolver.
+type Resolver struct {
+	address   string
+	token     string
+	namespace string
+	ttl       time.Duration
+	client    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]vaultSecret
+}
+
+// vaultSecret holds the fields of a Vault secret until it expires
+type vaultSecret struct {
+	fields  map[string]any
+	expires time.Time
+}
+
+// NewResolver creates a resolver reading Vault secrets from the configured
+// server, else the one of the VAULT_ADDR and VAULT_TOKEN environment
+// variables
+func NewResolver(cfg config.VaultConfig) *Resolver {
+	r := &Resolver{
+		address:   strings.TrimRight(cfg.Address, "/"),
+		token:     cfg.Token,
+		namespace: cfg.Namespace,
+		ttl:       time.Duration(cfg.CacheSeconds) * time.Second,
+		client:    &http.Client{Timeout: vaultTimeout},
+		cache:     make(map[string]vaultSecret),
+	}
+	if r.address == "" {
+		r.address = strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	}
+	if r.token == "" {
+		r.token = os.Getenv("VAULT_TOKEN")
+	}
+	if r.namespace == "" {
+		r.namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if r.ttl <= 0 {
+		r.ttl = defaultVaultCache
+	}
+	return r
+}
+
+// Resolve returns the secret a value refers to, or the value itself when
+// it is not a reference
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, RefEnv):
+		name := strings.TrimPrefix(value, RefEnv)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrEnvNotSet, name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, RefVault):
+		path, field, ok := strings.Cut(strings.TrimPrefix(value, RefVault), "#")
+		path = strings.Trim(path, "/")
+		if !ok || path == "" || field == "" {
+			return "", ErrVaultReference
+		}
+		fields, err := r.vaultFields(path)
+		if err != nil {
+			return "", err
+		}
+		secret, ok := fields[field]
+		if !ok {
+			return "", fmt.Errorf("%w: %s#%s", ErrVaultField, path, field)
+		}
+		if text, ok := secret.(string); ok {
+			return text, nil
+		}
+		return fmt.Sprint(secret), nil
+	default:
+		return value, nil
+	}
+}
+
+// vaultFields returns the fields of a Vault secret, read again once the
+// cached copy expires
+func (r *Resolver) vaultFields(path string) (map[string]any, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[path]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.fields, nil
+	}
+
+	if r.address == "" || r.token == "" {
+		return nil, ErrVaultNotConfigured
+	}
+	req, err := http.NewRequest(http.MethodGet, r.address+"/v1/"+(&url.URL{Path: path}).EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", r.token)
+	if r.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.namespace)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("read vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("read vault secret %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("read vault secret %s: %w", path, err)
+	}
+	// KV version 2 engines nest the fields under data next to metadata
+	fields := body.Data
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, versioned := fields["metadata"]; versioned {
+			fields = nested
+		}
+	}
+
+	r.mu.Lock()
+	r.cache[path] = vaultSecret{fields: fields, expires: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return fields, nil
+}
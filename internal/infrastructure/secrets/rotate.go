@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// rotateBatchSize is how many values are read at a time
+const rotateBatchSize = 500
+
+// ColumnResult counts the values of a Secret column by what rotating them
+// did
+type ColumnResult struct {
+	Table   string
+	Column  string
+	Rotated int // Encrypted with the current key, or would be in a dry run
+	Current int // Already encrypted with the current key
+}
+
+// Columns returns the Secret columns of models
+func Columns(db *gorm.DB, models []any) ([]ColumnResult, error) {
+	secretType := reflect.TypeOf(domain.Secret(""))
+	var columns []ColumnResult
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.FieldType == secretType && field.DBName != "" {
+				columns = append(columns, ColumnResult{Table: stmt.Schema.Table, Column: field.DBName})
+			}
+		}
+	}
+	return columns, nil
+}
+
+// Rotate encrypts every value of the Secret columns of models that is not
+// encrypted with the current key, such as values stored before encryption
+// was configured or encrypted with a previous key. A dry run only counts
+// them. Values changed while rotating are left for the next run.
+func Rotate(ctx context.Context, db *gorm.DB, keyring *Keyring, models []any, dryRun bool) ([]ColumnResult, error) {
+	columns, err := Columns(db, models)
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		if err := rotateColumn(ctx, db, keyring, &columns[i], dryRun); err != nil {
+			return columns, fmt.Errorf("%s.%s: %w", columns[i].Table, columns[i].Column, err)
+		}
+	}
+	return columns, nil
+}
+
+func rotateColumn(ctx context.Context, db *gorm.DB, keyring *Keyring, column *ColumnResult, dryRun bool) error {
+	type row struct {
+		ID    uint64
+		Value string
+	}
+	// Values are read and written as plain strings, bypassing Secret
+	table := db.WithContext(ctx).Table(column.Table)
+	var lastID uint64
+	for {
+		var rows []row
+		if err := table.Session(&gorm.Session{}).
+			Select("id", column.Column+" AS value").
+			Where("id > ? AND "+column.Column+" <> ''", lastID).
+			Order("id").Limit(rotateBatchSize).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			lastID = r.ID
+			if keyring.Current(r.Value) {
+				column.Current++
+				continue
+			}
+			if dryRun {
+				column.Rotated++
+				continue
+			}
+			// Values stored unencrypted are returned as they are
+			plaintext, err := keyring.Decrypt(r.Value)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", r.ID, err)
+			}
+			encrypted, err := keyring.Encrypt(plaintext)
+			if err != nil {
+				return err
+			}
+			result := table.Session(&gorm.Session{}).
+				Where("id = ? AND "+column.Column+" = ?", r.ID, r.Value).
+				UpdateColumn(column.Column, encrypted)
+			if result.Error != nil {
+				return result.Error
+			}
+			column.Rotated += int(result.RowsAffected)
+		}
+		if len(rows) < rotateBatchSize {
+			return nil
+		}
+	}
+}
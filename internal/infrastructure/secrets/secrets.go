@@ -0,0 +1,207 @@
+// Package secrets encrypts credentials stored in the database, such as
+// service passwords and server API tokens, with AES-256-GCM under a key
+// derived from the configured one with HKDF-SHA256. Each value records the
+// key it was encrypted with, so keys can be rotated while values encrypted
+// with the previous ones are still read.
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// KeyEnv overrides the configured key
+const KeyEnv = "OPENHOST_SECRETS_KEY"
+
+// Encrypted values are stored as "enc:v2:<key ID>:<sealed>", the sealed
+// part being the base64 of the nonce followed by the ciphertext. Values of
+// format v1 were encrypted with the SHA-256 of the key; they are still
+// read, and rotate-secrets encrypts them again.
+const (
+	formatVersion = "v2"
+	legacyVersion = "v1"
+)
+
+// hkdfInfo binds the derived cipher key to its use
+const hkdfInfo = "openhost secret encryption key"
+
+// keyCommandTimeout bounds running the key command at startup
+const keyCommandTimeout = 30 * time.Second
+
+var (
+	ErrUnknownKey       = errors.New("secret was encrypted with a key that is not configured, add it to secrets.previous_keys")
+	ErrCorrupted        = errors.New("secret is corrupted or the encryption key is wrong")
+	ErrPreviousKeysOnly = errors.New("secrets.previous_keys are set without a current key")
+)
+
+// Keyring encrypts with the current key and decrypts with any configured
+// key. It implements domain.SecretCipher.
+type Keyring struct {
+	current *key
+	keys    map[string]*key
+}
+
+type key struct {
+	id     string
+	aead   cipher.AEAD
+	legacy cipher.AEAD // Of format v1 values
+}
+
+// New loads the configured keys. It returns nil without an error when no
+// key is configured.
+func New(cfg config.SecretsConfig) (*Keyring, error) {
+	secret := os.Getenv(KeyEnv)
+	if secret == "" {
+		secret = cfg.Key
+	}
+	if secret == "" && cfg.KeyCommand != "" {
+		output, err := runKeyCommand(cfg.KeyCommand)
+		if err != nil {
+			return nil, err
+		}
+		secret = output
+	}
+	if secret == "" {
+		if len(cfg.PreviousKeys) > 0 {
+			return nil, ErrPreviousKeysOnly
+		}
+		return nil, nil
+	}
+
+	current, err := newKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{current: current, keys: map[string]*key{current.id: current}}
+	for _, previous := range cfg.PreviousKeys {
+		if previous == "" {
+			continue
+		}
+		pk, err := newKey(previous)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[pk.id]; !ok {
+			k.keys[pk.id] = pk
+		}
+	}
+	return k, nil
+}
+
+// runKeyCommand returns what the key command prints, such as a key
+// decrypted by a KMS
+func runKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run secrets key command: %w", err)
+	}
+	secret := strings.TrimSpace(string(output))
+	if secret == "" {
+		return "", errors.New("secrets key command printed no key")
+	}
+	return secret, nil
+}
+
+// newKey derives the ciphers of a key and the ID values encrypted with it
+// are marked with. The ID does not reveal the key.
+func newKey(secret string) (*key, error) {
+	derived := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(hkdfInfo)), derived); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(derived)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(secret))
+	legacy, err := newAEAD(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("openhost secret key id"))
+	return &key{id: hex.EncodeToString(mac.Sum(nil)[:4]), aead: aead, legacy: legacy}, nil
+}
+
+func newAEAD(cipherKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyID returns the ID of the current key
+func (k *Keyring) KeyID() string {
+	return k.current.id
+}
+
+// Encrypt encrypts a value with the current key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, k.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return domain.SecretPrefix + formatVersion + ":" + k.current.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted with any configured key. Values that
+// are not encrypted are returned as they are.
+func (k *Keyring) Decrypt(stored string) (string, error) {
+	version, id, sealed, ok := domain.ParseSecret(stored)
+	if !ok {
+		return stored, nil
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w (key %s)", ErrUnknownKey, id)
+	}
+	var aead cipher.AEAD
+	switch version {
+	case formatVersion:
+		aead = key.aead
+	case legacyVersion:
+		aead = key.legacy
+	default:
+		return "", fmt.Errorf("%w (format %s)", ErrCorrupted, version)
+	}
+	size := aead.NonceSize()
+	if len(sealed) < size {
+		return "", ErrCorrupted
+	}
+	plaintext, err := aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", ErrCorrupted
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether a stored value is encrypted with the current key
+// in the current format
+func (k *Keyring) Current(stored string) bool {
+	version, id, _, ok := domain.ParseSecret(stored)
+	return ok && version == formatVersion && id == k.current.id
+}
@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// TestDecrypt checks that values are read back with the key and format
+// they were encrypted with, and that values without a valid header are
+// plain text stored before encryption was configured
+func TestDecrypt(t *testing.T) {
+	keyring, err := New(config.SecretsConfig{Key: "current key", PreviousKeys: []string{"previous key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := keyring.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "enc:v2:"+keyring.KeyID()+":") || !keyring.Current(encrypted) {
+		t.Errorf("encrypted value %q is not current", encrypted)
+	}
+
+	// Format v1 keyed the cipher with the SHA-256 of the key
+	sum := sha256.Sum256([]byte("previous key"))
+	aead, err := newAEAD(sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := newKey("previous key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := "enc:v1:" + previous.id + ":" + base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte("old s3cret"), nil))
+	if keyring.Current(legacy) {
+		t.Errorf("format v1 value %q is current", legacy)
+	}
+
+	unknown, err := New(config.SecretsConfig{Key: "unknown key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := unknown.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stored string
+		want   string
+		err    error
+	}{
+		{stored: encrypted, want: "s3cret"},
+		{stored: legacy, want: "old s3cret"},
+		{stored: "plain password", want: "plain password"},
+		{stored: "enc:password", want: "enc:password"},
+		{stored: "enc:v2:" + keyring.KeyID() + ":not base64!", want: "enc:v2:" + keyring.KeyID() + ":not base64!"},
+		{stored: "enc:v2:NOTHEX00:" + strings.SplitN(encrypted, ":", 4)[3], want: "enc:v2:NOTHEX00:" + strings.SplitN(encrypted, ":", 4)[3]},
+		{stored: foreign, err: ErrUnknownKey},
+		{stored: encrypted[:len(encrypted)-4] + "AAAA", err: ErrCorrupted},
+	}
+	domain.SetSecretCipher(keyring)
+	t.Cleanup(func() { domain.SetSecretCipher(nil) })
+	for _, tt := range tests {
+		got, err := keyring.Decrypt(tt.stored)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Decrypt(%q) = %q, %v, want %q, %v", tt.stored, got, err, tt.want, tt.err)
+		}
+		var secret domain.Secret
+		err = secret.Scan(tt.stored)
+		if !errors.Is(err, tt.err) || string(secret) != tt.want {
+			t.Errorf("Scan(%q) = %q, %v, want %q, %v", tt.stored, secret, err, tt.want, tt.err)
+		}
+	}
+}
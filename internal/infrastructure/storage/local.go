@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// LocalURLPrefix is the path signed URLs of local files are served under
+const LocalURLPrefix = "/files/"
+
+// Local keeps files in a directory. Its signed URLs point to Handler.
+type Local struct {
+	dir    string
+	secret []byte
+}
+
+// NewLocal creates a store writing below dir. URLs are signed with
+// secret, or a random key when it is empty.
+func NewLocal(dir string, secret []byte) *Local {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+	return &Local{dir: dir, secret: secret}
+}
+
+func (s *Local) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return err
+	}
+
+	// Readers never see a partly written file
+	tmp := path + ".partial"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, domain.ErrFileNotFound
+	}
+	return f, err
+}
+
+func (s *Local) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL returns a path below LocalURLPrefix carrying the file name,
+// expiry and an HMAC of both and the key
+func (s *Local) SignedURL(key, fileName string, expires time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("name", fileName)
+	query.Set("expires", expiresAt)
+	query.Set("signature", s.sign(key, fileName, expiresAt))
+	return LocalURLPrefix + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Handler serves files for signed URLs. It is registered at
+// LocalURLPrefix + "*key".
+func (s *Local) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		fileName := c.Query("name")
+		expiresAt := c.Query("expires")
+
+		expires, err := strconv.ParseInt(expiresAt, 10, 64)
+		if err != nil || time.Now().Unix() > expires ||
+			!hmac.Equal([]byte(c.Query("signature")), []byte(s.sign(key, fileName, expiresAt))) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		filePath, err := s.path(key)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(fileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", contentDisposition(fileName))
+		c.Header("Cache-Control", "private, max-age=300")
+		http.ServeContent(c.Writer, c.Request, "", fi.ModTime(), f)
+	}
+}
+
+func (s *Local) sign(key, fileName, expiresAt string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + fileName + "\n" + expiresAt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
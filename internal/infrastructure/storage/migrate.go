@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// migrateBatch is the number of rows loaded at a time. Ticket attachments
+// carry their content, so batches stay small.
+const migrateBatch = 50
+
+// MigrateOptions controls a migration into the file store
+type MigrateOptions struct {
+	// From is the store files were kept in before, e.g. the local store
+	// when switching to S3. Files it holds are copied to the new store.
+	From domain.FileStore
+	// Keep leaves ticket attachment content in the database and local
+	// files on disk after they were copied
+	Keep bool
+}
+
+// MigrateResult counts the files moved by a migration
+type MigrateResult struct {
+	TicketAttachments int
+	KBAttachments     int
+	Downloads         int
+	Copied            int
+}
+
+// Migrate moves ticket attachments stored in the database and knowledge
+// base attachments and downloads stored as local paths into store. With
+// opts.From set it also copies files already keyed in the old store.
+// Migrating twice is harmless; rows that were moved are skipped.
+func Migrate(ctx context.Context, db *gorm.DB, store domain.FileStore, opts MigrateOptions) (*MigrateResult, error) {
+	result := &MigrateResult{}
+	if opts.From != nil {
+		copied, err := copyKeyed(ctx, db, opts.From, store)
+		result.Copied = copied
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var err error
+	if result.TicketAttachments, err = migrateTicketAttachments(ctx, db, store, opts.Keep); err != nil {
+		return result, err
+	}
+	if result.KBAttachments, err = migrateLocalFiles(ctx, db, store, &domain.KBArticleAttachment{}, "kb", "article_id", opts.Keep); err != nil {
+		return result, err
+	}
+	if result.Downloads, err = migrateLocalFiles(ctx, db, store, &domain.Download{}, "downloads", "category_id", opts.Keep); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func migrateTicketAttachments(ctx context.Context, db *gorm.DB, store domain.FileStore, keep bool) (int, error) {
+	type row struct {
+		domain.TicketAttachment
+		TicketID uint64
+	}
+
+	moved := 0
+	var lastID uint64
+	for {
+		var rows []row
+		if err := db.WithContext(ctx).Table("ticket_attachments").
+			Select("ticket_attachments.*, ticket_messages.ticket_id").
+			Joins("JOIN ticket_messages ON ticket_messages.id = ticket_attachments.ticket_message_id").
+			Where("ticket_attachments.id > ? AND (ticket_attachments.storage_key = '' OR ticket_attachments.storage_key IS NULL)", lastID).
+			Order("ticket_attachments.id").Limit(migrateBatch).
+			Find(&rows).Error; err != nil {
+			return moved, err
+		}
+		if len(rows) == 0 {
+			return moved, nil
+		}
+
+		for _, r := range rows {
+			lastID = r.ID
+			key, err := domain.NewFileKey("tickets", r.TicketID, r.TicketMessageID)
+			if err != nil {
+				return moved, err
+			}
+			if err := store.Put(ctx, key, bytes.NewReader(r.Data), int64(len(r.Data)), r.ContentType); err != nil {
+				return moved, fmt.Errorf("ticket attachment %d: %w", r.ID, err)
+			}
+
+			updates := map[string]interface{}{"storage_key": key}
+			if !keep {
+				updates["data"] = []byte{}
+			}
+			if err := db.WithContext(ctx).Model(&domain.TicketAttachment{}).Where("id = ?", r.ID).Updates(updates).Error; err != nil {
+				store.Delete(ctx, key)
+				return moved, err
+			}
+			moved++
+		}
+	}
+}
+
+// migrateLocalFiles moves the files of knowledge base attachments or
+// downloads, both of which keep a local FilePath, into the store. Keys
+// are made of prefix and the ID in the parent column.
+func migrateLocalFiles(ctx context.Context, db *gorm.DB, store domain.FileStore, model interface{}, prefix, parent string, keep bool) (int, error) {
+	type row struct {
+		ID          uint64
+		ParentID    uint64
+		FilePath    string
+		ContentType string
+	}
+
+	// Downloads are not created by every installation
+	if !db.Migrator().HasTable(model) {
+		return 0, nil
+	}
+
+	moved := 0
+	var lastID uint64
+	for {
+		var rows []row
+		if err := db.WithContext(ctx).Model(model).
+			Select("id, "+parent+" AS parent_id, file_path, content_type").
+			Where("id > ? AND file_path <> '' AND (storage_key = '' OR storage_key IS NULL)", lastID).
+			Order("id").Limit(migrateBatch).
+			Scan(&rows).Error; err != nil {
+			return moved, err
+		}
+		if len(rows) == 0 {
+			return moved, nil
+		}
+
+		for _, r := range rows {
+			lastID = r.ID
+			key, err := domain.NewFileKey(prefix, r.ParentID)
+			if err != nil {
+				return moved, err
+			}
+			if err := putLocalFile(ctx, store, key, r.FilePath, r.ContentType); err != nil {
+				return moved, fmt.Errorf("%s %d: %w", prefix, r.ID, err)
+			}
+
+			updates := map[string]interface{}{"storage_key": key}
+			if !keep {
+				updates["file_path"] = ""
+			}
+			if err := db.WithContext(ctx).Model(model).Where("id = ?", r.ID).Updates(updates).Error; err != nil {
+				store.Delete(ctx, key)
+				return moved, err
+			}
+			if !keep {
+				os.Remove(r.FilePath)
+			}
+			moved++
+		}
+	}
+}
+
+func putLocalFile(ctx context.Context, store domain.FileStore, key, path, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, f, fi.Size(), contentType)
+}
+
+// copyKeyed copies every file referenced by a storage key from one store
+// to another, keeping the keys
+func copyKeyed(ctx context.Context, db *gorm.DB, from, to domain.FileStore) (int, error) {
+	copied := 0
+	for _, model := range []interface{}{&domain.TicketAttachment{}, &domain.KBArticleAttachment{}, &domain.Download{}, &domain.ServiceFile{}, &domain.QuarantinedFile{}} {
+		type row struct {
+			ID          uint64
+			StorageKey  string
+			ContentType string
+		}
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+
+		var lastID uint64
+		for {
+			var rows []row
+			if err := db.WithContext(ctx).Model(model).
+				Select("id, storage_key, content_type").
+				Where("id > ? AND storage_key <> ''", lastID).
+				Order("id").Limit(migrateBatch).
+				Scan(&rows).Error; err != nil {
+				return copied, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, r := range rows {
+				lastID = r.ID
+				if err := copyFile(ctx, from, to, r.StorageKey, r.ContentType); err != nil {
+					return copied, fmt.Errorf("copy %s: %w", r.StorageKey, err)
+				}
+				copied++
+			}
+		}
+	}
+
+	n, err := copyMedia(ctx, db, from, to)
+	return copied + n, err
+}
+
+// copyMedia copies the images of the media library with their thumbnails
+// and WebP variants
+func copyMedia(ctx context.Context, db *gorm.DB, from, to domain.FileStore) (int, error) {
+	if !db.Migrator().HasTable(&domain.MediaFile{}) {
+		return 0, nil
+	}
+
+	copied := 0
+	var lastID uint64
+	for {
+		var files []domain.MediaFile
+		if err := db.WithContext(ctx).Where("id > ?", lastID).
+			Order("id").Limit(migrateBatch).Find(&files).Error; err != nil {
+			return copied, err
+		}
+		if len(files) == 0 {
+			return copied, nil
+		}
+
+		for _, f := range files {
+			lastID = f.ID
+			contentTypes := map[string]string{
+				f.StorageKey:       f.ContentType,
+				f.ThumbnailKey:     f.ThumbnailType,
+				f.WebPKey:          "image/webp",
+				f.ThumbnailWebPKey: "image/webp",
+			}
+			for _, key := range f.StorageKeys() {
+				if err := copyFile(ctx, from, to, key, contentTypes[key]); err != nil {
+					return copied, fmt.Errorf("copy %s: %w", key, err)
+				}
+				copied++
+			}
+		}
+	}
+}
+
+func copyFile(ctx context.Context, from, to domain.FileStore, key, contentType string) error {
+	r, err := from.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Local files know their size, which spares S3 uploads a spool file
+	size := int64(-1)
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+	}
+	return to.Put(ctx, key, r, size, contentType)
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+const (
+	// clamChunk is the size of INSTREAM chunks sent to clamd
+	clamChunk = 64 << 10
+	// scanTimeout bounds a scan when the context has no deadline
+	scanTimeout = 5 * time.Minute
+)
+
+// NewScanner creates the malware scanner of the configuration, or returns
+// nil when scanning is not configured
+func NewScanner(cfg config.ScannerConfig) domain.FileScanner {
+	switch {
+	case cfg.ClamAV != "":
+		return NewClamAV(cfg.ClamAV)
+	case cfg.Command != "":
+		return &CommandScanner{args: strings.Fields(cfg.Command)}
+	default:
+		return nil
+	}
+}
+
+// ClamAV scans files with a clamd daemon using its INSTREAM command
+type ClamAV struct {
+	network string
+	address string
+}
+
+// NewClamAV creates a scanner for the clamd at address, either
+// "tcp://host:port" or the path of its unix socket
+func NewClamAV(address string) *ClamAV {
+	if hostPort, ok := strings.CutPrefix(address, "tcp://"); ok {
+		return &ClamAV{network: "tcp", address: hostPort}
+	}
+	return &ClamAV{network: "unix", address: strings.TrimPrefix(address, "unix://")}
+}
+
+func (s *ClamAV) Scan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(scanTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	buf := make([]byte, 4+clamChunk)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the connection when the stream exceeds its
+				// size limit; its reply says so
+				break
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+	conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	return parseClamReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamReply reads replies such as "stream: OK" and
+// "stream: Win.Test.EICAR_HDB-1 FOUND"
+func parseClamReply(reply string) (string, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", reply)
+	}
+}
+
+// CommandScanner scans files with a command such as
+// "clamdscan --no-summary -". The file is written to its stdin; exit
+// status 1 reports a threat, named by the last line of its output.
+type CommandScanner struct {
+	args []string
+}
+
+func (s *CommandScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scanTimeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if threat := strings.TrimSpace(lines[len(lines)-1]); threat != "" {
+			return threat, nil
+		}
+		return "malware", nil
+	default:
+		return "", fmt.Errorf("scanner %s: %w: %s", s.args[0], err, strings.TrimSpace(output.String()))
+	}
+}
@@ -0,0 +1,71 @@
+// Package storage keeps uploaded files on local disk or in an S3
+// compatible bucket behind the domain.FileStore interface.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// Storage drivers
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// DefaultDirectory keeps local files when no directory is configured
+const DefaultDirectory = "./data/files"
+
+const (
+	dirPerm  = 0o750
+	filePerm = 0o600
+)
+
+var (
+	ErrUnknownDriver   = errors.New("storage driver must be local or s3")
+	ErrInvalidKey      = errors.New("invalid storage key")
+	ErrInvalidS3Config = errors.New("s3 storage needs bucket, region, access_key and secret_key")
+)
+
+// New creates the file store of the configuration
+func New(cfg config.StorageConfig) (domain.FileStore, error) {
+	switch cfg.Driver {
+	case DriverLocal, "":
+		dir := cfg.Directory
+		if dir == "" {
+			dir = DefaultDirectory
+		}
+		return NewLocal(dir, []byte(cfg.SigningKey)), nil
+	case DriverS3:
+		return NewS3(cfg.S3)
+	default:
+		return nil, ErrUnknownDriver
+	}
+}
+
+// cleanKey rejects keys that are empty, absolute or leave the store
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return key, nil
+}
+
+// contentDisposition makes the browser download a file as fileName
+func contentDisposition(fileName string) string {
+	if fileName == "" {
+		return "attachment"
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": fileName})
+}
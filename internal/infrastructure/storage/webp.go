@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// webpTimeout bounds a conversion when the context has no deadline
+const webpTimeout = time.Minute
+
+// NewWebPEncoder creates an encoder running command, or returns nil when
+// command is empty
+func NewWebPEncoder(command string) domain.WebPEncoder {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil
+	}
+	return &CommandWebP{args: args}
+}
+
+// CommandWebP converts images to WebP with a command such as
+// "cwebp -quiet -q 80 {input} -o {output}". The image is written as a
+// PNG to {input} and the WebP read back from {output}.
+type CommandWebP struct {
+	args []string
+}
+
+func (e *CommandWebP) EncodeWebP(ctx context.Context, img image.Image, w io.Writer) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, webpTimeout)
+		defer cancel()
+	}
+
+	dir, err := os.MkdirTemp("", "openhost-webp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "input.png"), filepath.Join(dir, "output.webp")
+
+	f, err := os.Create(input)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = strings.NewReplacer("{input}", input, "{output}", output).Replace(arg)
+	}
+	var messages bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &messages
+	cmd.Stderr = &messages
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(messages.String()))
+	}
+
+	result, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	_, err = io.Copy(w, result)
+	return err
+}
@@ -0,0 +1,109 @@
+package sysinfo
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"runtime/pprof"
+	"time"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+)
+
+// bundleLogLimit is the number of recent cron failures in a bundle
+const bundleLogLimit = 100
+
+// WriteBundle writes a zip archive for support requests: the system
+// information, the configuration without secrets, recent cron failures
+// and a goroutine dump
+func (c *Collector) WriteBundle(ctx context.Context, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	if err := writeJSON(archive, "info.json", c.Collect(ctx)); err != nil {
+		return err
+	}
+	if err := writeJSON(archive, "config.json", redactConfig(c.cfg)); err != nil {
+		return err
+	}
+
+	failures := []domain.CronJobLog{}
+	if err := c.db.WithContext(ctx).
+		Where("status IN ?", []string{"failed", "timeout"}).
+		Order("created_at DESC").
+		Limit(bundleLogLimit).
+		Find(&failures).Error; err != nil {
+		return err
+	}
+	if err := writeJSON(archive, "cron_failures.json", failures); err != nil {
+		return err
+	}
+
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: "goroutines.txt", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(f, 1); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, v any) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// redactConfig removes passwords and keys from a configuration
+func redactConfig(cfg config.Config) config.Config {
+	const redacted = "[redacted]"
+
+	if cfg.Database.Postgres.Password != "" {
+		cfg.Database.Postgres.Password = redacted
+	}
+	replicas := make([]config.PostgresConfig, len(cfg.Database.Replicas))
+	for i, replica := range cfg.Database.Replicas {
+		if replica.Password != "" {
+			replica.Password = redacted
+		}
+		replicas[i] = replica
+	}
+	cfg.Database.Replicas = replicas
+	if cfg.Admin.PasswordHash != "" {
+		cfg.Admin.PasswordHash = redacted
+	}
+	if cfg.Queue.RedisPassword != "" {
+		cfg.Queue.RedisPassword = redacted
+	}
+	if cfg.WHMCS.AccessKey != "" {
+		cfg.WHMCS.AccessKey = redacted
+	}
+	if cfg.Backup.EncryptionKey != "" {
+		cfg.Backup.EncryptionKey = redacted
+	}
+	if cfg.Storage.SigningKey != "" {
+		cfg.Storage.SigningKey = redacted
+	}
+	if cfg.Storage.S3.SecretKey != "" {
+		cfg.Storage.S3.SecretKey = redacted
+	}
+	if cfg.Secrets.Key != "" {
+		cfg.Secrets.Key = redacted
+	}
+	previousKeys := make([]string, len(cfg.Secrets.PreviousKeys))
+	for i := range previousKeys {
+		previousKeys[i] = redacted
+	}
+	cfg.Secrets.PreviousKeys = previousKeys
+	if cfg.Secrets.Vault.Token != "" {
+		cfg.Secrets.Vault.Token = redacted
+	}
+	return cfg
+}
@@ -0,0 +1,358 @@
+// Package sysinfo collects the system information administrators and
+// support need to diagnose an installation: build, runtime, database,
+// queues, cron and storage.
+package sysinfo
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/config"
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// Build information, set at build time with
+//
+//	-ldflags "-X github.com/openhost/openhost/internal/infrastructure/sysinfo.Version=1.2.0"
+//
+// Commit and BuildTime default to the VCS information Go embeds.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// License is the license OpenHost is distributed under
+const (
+	License    = "MIT"
+	LicenseURL = "https://opensource.org/licenses/MIT"
+)
+
+var startedAt = time.Now()
+
+// Info is a snapshot of the system
+type Info struct {
+	Build       BuildInfo     `json:"build"`
+	Runtime     RuntimeInfo   `json:"runtime"`
+	Database    DatabaseInfo  `json:"database"`
+	Queues      []QueueInfo   `json:"queues"`
+	Cron        []CronInfo    `json:"cron"`
+	Storage     []StorageInfo `json:"storage"`
+	License     LicenseInfo   `json:"license"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with changes
+	GoVersion string `json:"go_version"`
+}
+
+// RuntimeInfo describes the Go runtime of the process
+type RuntimeInfo struct {
+	OS            string    `json:"os"`
+	Arch          string    `json:"arch"`
+	CPUs          int       `json:"cpus"`
+	Goroutines    int       `json:"goroutines"`
+	HeapAlloc     uint64    `json:"heap_alloc_bytes"`
+	HeapSys       uint64    `json:"heap_sys_bytes"`
+	Sys           uint64    `json:"sys_bytes"`
+	NumGC         uint32    `json:"num_gc"`
+	LastGC        time.Time `json:"last_gc"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// DatabaseInfo describes the database and its schema
+type DatabaseInfo struct {
+	Type              string               `json:"type"`
+	SizeBytes         int64                `json:"size_bytes"`
+	PendingMigrations []string             `json:"pending_migrations"`
+	Pools             []database.PoolStats `json:"pools"`
+	Error             string               `json:"error,omitempty"`
+}
+
+// QueueInfo describes the depth of a queue
+type QueueInfo struct {
+	Name      string `json:"name"`
+	Backend   string `json:"backend"` // redis or database
+	Pending   int    `json:"pending"`
+	Active    int    `json:"active"`
+	Scheduled int    `json:"scheduled"`
+	Retry     int    `json:"retry"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CronInfo describes the last and next run of a scheduled task
+type CronInfo struct {
+	Name       string     `json:"name"`
+	Schedule   string     `json:"schedule"`
+	Active     bool       `json:"active"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// StorageInfo describes the space used by stored files
+type StorageInfo struct {
+	Name     string `json:"name"`
+	Location string `json:"location"` // "database" or a directory
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	Error    string `json:"error,omitempty"`
+}
+
+// LicenseInfo describes the license of the installation
+type LicenseInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Collector collects system information. Failures of one section are
+// reported in that section instead of failing the whole snapshot.
+type Collector struct {
+	db        *gorm.DB
+	cfg       config.Config
+	inspector *asynq.Inspector
+}
+
+// NewCollector creates a collector for the given installation. A nil
+// inspector leaves out the Redis queues.
+func NewCollector(db *gorm.DB, cfg config.Config, inspector *asynq.Inspector) *Collector {
+	return &Collector{db: db, cfg: cfg, inspector: inspector}
+}
+
+// Collect takes a snapshot of the system
+func (c *Collector) Collect(ctx context.Context) *Info {
+	db := c.db.WithContext(ctx)
+	return &Info{
+		Build:       buildInfo(),
+		Runtime:     runtimeInfo(),
+		Database:    c.databaseInfo(db),
+		Queues:      c.queueInfo(db),
+		Cron:        c.cronInfo(db),
+		Storage:     c.storageInfo(db),
+		License:     LicenseInfo{Name: License, URL: LicenseURL},
+		GeneratedAt: time.Now(),
+	}
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+func runtimeInfo() RuntimeInfo {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	info := RuntimeInfo{
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		CPUs:          runtime.NumCPU(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapSys:       mem.HeapSys,
+		Sys:           mem.Sys,
+		NumGC:         mem.NumGC,
+		StartedAt:     startedAt,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+	}
+	if mem.LastGC > 0 {
+		info.LastGC = time.Unix(0, int64(mem.LastGC))
+	}
+	return info
+}
+
+func (c *Collector) databaseInfo(db *gorm.DB) DatabaseInfo {
+	info := DatabaseInfo{Type: db.Dialector.Name(), PendingMigrations: []string{}}
+
+	var err error
+	switch info.Type {
+	case "postgres":
+		err = db.Raw("SELECT pg_database_size(current_database())").Scan(&info.SizeBytes).Error
+	case "sqlite":
+		var pageCount, pageSize int64
+		if err = db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err == nil {
+			err = db.Raw("PRAGMA page_size").Scan(&pageSize).Error
+		}
+		info.SizeBytes = pageCount * pageSize
+	}
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if pending != nil {
+		info.PendingMigrations = pending
+	}
+
+	if info.Pools, err = database.Stats(db); err != nil {
+		info.Error = err.Error()
+	}
+	return info
+}
+
+func (c *Collector) queueInfo(db *gorm.DB) []QueueInfo {
+	var queues []QueueInfo
+
+	if c.inspector != nil {
+		names, err := c.inspector.Queues()
+		if err != nil {
+			queues = append(queues, QueueInfo{Name: "redis", Backend: "redis", Error: err.Error()})
+		}
+		for _, name := range names {
+			queue := QueueInfo{Name: name, Backend: "redis"}
+			if stats, err := c.inspector.GetQueueInfo(name); err != nil {
+				queue.Error = err.Error()
+			} else {
+				queue.Pending = stats.Pending
+				queue.Active = stats.Active
+				queue.Scheduled = stats.Scheduled
+				queue.Retry = stats.Retry
+				queue.Failed = stats.Archived
+			}
+			queues = append(queues, queue)
+		}
+	}
+
+	email := QueueInfo{Name: "email", Backend: "database"}
+	var counts []struct {
+		Status string
+		Count  int
+	}
+	if err := db.Model(&domain.EmailQueue{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		email.Error = err.Error()
+	}
+	for _, count := range counts {
+		switch count.Status {
+		case "pending":
+			email.Pending = count.Count
+		case "sending":
+			email.Active = count.Count
+		case "failed":
+			email.Failed = count.Count
+		}
+	}
+	return append(queues, email)
+}
+
+func (c *Collector) cronInfo(db *gorm.DB) []CronInfo {
+	cron := []CronInfo{}
+
+	var jobs []domain.CronJob
+	if err := db.Order("name").Find(&jobs).Error; err == nil {
+		for _, job := range jobs {
+			cron = append(cron, CronInfo{
+				Name:       job.Name,
+				Schedule:   job.Schedule,
+				Active:     job.Active,
+				LastRunAt:  job.LastRunAt,
+				NextRunAt:  job.NextRunAt,
+				LastStatus: job.LastStatus,
+			})
+		}
+	}
+
+	var tasks []domain.CronTask
+	if err := db.Order("name").Find(&tasks).Error; err == nil {
+		for _, task := range tasks {
+			cron = append(cron, CronInfo{
+				Name:       task.Name,
+				Schedule:   task.Schedule,
+				Active:     task.Active,
+				LastRunAt:  task.LastRun,
+				NextRunAt:  task.NextRun,
+				LastStatus: task.LastStatus,
+				LastError:  task.LastError,
+			})
+		}
+	}
+	return cron
+}
+
+func (c *Collector) storageInfo(db *gorm.DB) []StorageInfo {
+	tickets := StorageInfo{Name: "ticket_attachments", Location: "database"}
+	if err := db.Model(&domain.TicketAttachment{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(size_bytes), 0) AS bytes").
+		Scan(&tickets).Error; err != nil {
+		tickets.Error = err.Error()
+	}
+
+	articles := StorageInfo{Name: "kb_attachments", Location: "database"}
+	if err := db.Model(&domain.KBArticleAttachment{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Scan(&articles).Error; err != nil {
+		articles.Error = err.Error()
+	}
+
+	storage := []StorageInfo{tickets, articles}
+	if dir := c.cfg.Archive.Directory; dir != "" {
+		storage = append(storage, directoryUsage("archives", dir))
+	}
+	return storage
+}
+
+// directoryUsage adds up the files below a directory
+func directoryUsage(name, dir string) StorageInfo {
+	info := StorageInfo{Name: name, Location: dir}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		info.Files++
+		info.Bytes += fi.Size()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		info.Error = err.Error()
+	}
+	return info
+}
@@ -10,6 +10,7 @@ const (
 	TypeProvision = "openhost:provision"
 	TypeSuspend   = "openhost:suspend"
 	TypeTerminate = "openhost:terminate"
+	TypeBulk      = "openhost:bulk"
 )
 
 type TaskPayload struct {
@@ -28,6 +29,18 @@ func NewTerminateTask(serviceID uint64) (*asynq.Task, error) {
 	return newTask(TypeTerminate, TaskPayload{ServiceID: serviceID})
 }
 
+type BulkPayload struct {
+	JobID uint64 `json:"job_id"`
+}
+
+func NewBulkTask(jobID uint64) (*asynq.Task, error) {
+	data, err := json.Marshal(BulkPayload{JobID: jobID})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeBulk, data), nil
+}
+
 func newTask(taskType string, payload TaskPayload) (*asynq.Task, error) {
 	data, err := json.Marshal(payload)
 	if err != nil {
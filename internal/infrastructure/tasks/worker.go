@@ -14,6 +14,11 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/core/service/agent"
+	"github.com/openhost/openhost/internal/core/service/bulk"
+	"github.com/openhost/openhost/internal/core/service/customfield"
+	"github.com/openhost/openhost/internal/core/service/notification"
+	"github.com/openhost/openhost/internal/infrastructure/agentrpc"
 	infraPlugin "github.com/openhost/openhost/internal/infrastructure/plugin"
 	provisionerv1 "github.com/openhost/openhost/pkg/proto/provisioner/v1"
 )
@@ -23,9 +28,10 @@ const (
 )
 
 type Worker struct {
-	db      *gorm.DB
-	plugins *infraPlugin.PluginManager
-	logger  hclog.Logger
+	db       *gorm.DB
+	plugins  *infraPlugin.PluginManager
+	logger   hclog.Logger
+	testMode bool
 }
 
 func NewWorker(db *gorm.DB, plugins *infraPlugin.PluginManager, logger hclog.Logger) *Worker {
@@ -42,6 +48,12 @@ func NewWorker(db *gorm.DB, plugins *infraPlugin.PluginManager, logger hclog.Log
 	}
 }
 
+// SetTestMode provisions every service with the mock driver instead of its
+// module. Services of modules in test mode always are.
+func (w *Worker) SetTestMode(enabled bool) {
+	w.testMode = enabled
+}
+
 func DefaultRetryDelay(retryCount int, _ error, _ *asynq.Task) time.Duration {
 	if retryCount <= 0 {
 		return 0
@@ -62,6 +74,8 @@ func (w *Worker) ProcessTask(ctx context.Context, task *asynq.Task) error {
 		return asynq.SkipRetry
 	case TypeTerminate:
 		return asynq.SkipRetry
+	case TypeBulk:
+		return w.handleBulk(ctx, task)
 	default:
 		return asynq.SkipRetry
 	}
@@ -71,9 +85,6 @@ func (w *Worker) handleProvision(ctx context.Context, task *asynq.Task) error {
 	if w.db == nil {
 		return errors.New("db is required")
 	}
-	if w.plugins == nil {
-		return errors.New("plugin manager is required")
-	}
 
 	var payload TaskPayload
 	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
@@ -85,47 +96,152 @@ func (w *Worker) handleProvision(ctx context.Context, task *asynq.Task) error {
 		return err
 	}
 
-	moduleName := service.Product.ModuleName
-	if moduleName == "" {
-		return errors.New("service product module name is required")
-	}
-
-	conn, err := w.plugins.GetClient(moduleName)
+	test, err := w.provisionsInTestMode(ctx, service)
 	if err != nil {
 		return err
 	}
 
-	client := provisionerv1.NewProvisionerServiceClient(conn)
-	request := buildProvisionRequest(service)
-	if _, err := client.CreateService(ctx, request); err != nil {
+	var client provisionerv1.ProvisionerServiceClient
+	var request *provisionerv1.CreateServiceRequest
+	viaAgent := service.Product.ModuleName == agentrpc.ModuleName
+	if test {
+		// The server credentials of production data may not resolve here,
+		// and the mock driver has no use for them
+		client = infraPlugin.NewMockProvisioner()
+		request = &provisionerv1.CreateServiceRequest{
+			ServiceId:  strconv.FormatUint(service.ID, 10),
+			CustomerId: strconv.FormatUint(service.CustomerID, 10),
+			PackageId:  strconv.FormatUint(service.ProductID, 10),
+		}
+	} else {
+		if viaAgent {
+			if client, err = w.agentProvisioner(service); err != nil {
+				return err
+			}
+		} else {
+			if w.plugins == nil {
+				return errors.New("plugin manager is required")
+			}
+			conn, err := w.plugins.GetClient(service.Product.ModuleName)
+			if err != nil {
+				return err
+			}
+			client = provisionerv1.NewProvisionerServiceClient(conn)
+		}
+
+		fields, err := customfield.NewService(w.db).ProvisioningValues(service.ID)
+		if err != nil {
+			return fmt.Errorf("load custom fields: %w", err)
+		}
+		if request, err = buildProvisionRequest(service, fields); err != nil {
+			return err
+		}
+	}
+	response, err := client.CreateService(ctx, request)
+	if err != nil {
 		if statusErr := status.Convert(err); statusErr != nil {
 			w.logger.Error("provisioner request failed", "service_id", service.ID, "error", statusErr.Message())
 		}
 		return err
 	}
 
+	updates := map[string]interface{}{"status": ServiceStatusActive}
+	if test {
+		updates["test"] = true
+		updates["external_id"] = response.ExternalId
+	} else if viaAgent && response.ExternalId != "" {
+		updates["external_id"] = response.ExternalId
+	}
 	if err := w.db.Model(&domain.Service{}).
 		Where("id = ?", service.ID).
-		Update("status", ServiceStatusActive).Error; err != nil {
+		Updates(updates).Error; err != nil {
 		return fmt.Errorf("update service status: %w", err)
 	}
 
+	// The welcome email is best effort; a failure must not retry provisioning
+	if err := notification.NewService(w.db).SendWelcomeEmail(service.ID); err != nil &&
+		!errors.Is(err, notification.ErrWelcomeEmailNotFound) {
+		w.logger.Warn("failed to queue welcome email", "service_id", service.ID, "error", err)
+	}
+
 	return nil
 }
 
+func (w *Worker) handleBulk(_ context.Context, task *asynq.Task) error {
+	if w.db == nil {
+		return errors.New("db is required")
+	}
+
+	var payload BulkPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	if err := bulk.NewService(w.db, nil).Execute(payload.JobID); err != nil {
+		if errors.Is(err, bulk.ErrJobNotFound) || errors.Is(err, bulk.ErrUnknownOperation) {
+			return asynq.SkipRetry
+		}
+		w.logger.Error("bulk job failed", "job_id", payload.JobID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// provisionsInTestMode reports whether a service is provisioned by the
+// mock driver: in test mode, or when the module of its product is
+func (w *Worker) provisionsInTestMode(ctx context.Context, service domain.Service) (bool, error) {
+	if w.testMode {
+		return true, nil
+	}
+	moduleName := service.Product.ModuleName
+	if moduleName == "" {
+		return false, errors.New("service product module name is required")
+	}
+	var count int64
+	if err := w.db.WithContext(ctx).Model(&domain.ProvisioningServerModule{}).
+		Where("slug = ? AND test_mode = ?", moduleName, true).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("load module: %w", err)
+	}
+	return count > 0, nil
+}
+
+// agentProvisioner provisions a service through the agent of the node
+// linked to its server
+func (w *Worker) agentProvisioner(service domain.Service) (provisionerv1.ProvisionerServiceClient, error) {
+	if service.ServerID == nil {
+		return nil, fmt.Errorf("service %d has no server for the agent to provision it on", service.ID)
+	}
+	agents := agent.NewService(w.db)
+	node, err := agents.NodeForServer(*service.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("server %d: %w", *service.ServerID, err)
+	}
+	return agentrpc.NewProvisioner(agents, node.ID, &service.ID), nil
+}
+
 func (w *Worker) loadService(ctx context.Context, serviceID uint64) (domain.Service, error) {
 	var service domain.Service
 	if err := w.db.WithContext(ctx).
 		Preload("Product").
 		Preload("IPAddress").
+		Preload("Server").
 		First(&service, serviceID).Error; err != nil {
 		return domain.Service{}, fmt.Errorf("load service: %w", err)
 	}
 	return service, nil
 }
 
-func buildProvisionRequest(service domain.Service) *provisionerv1.CreateServiceRequest {
+// buildProvisionRequest passes the module the options of a service and
+// the server it is placed on. Credentials set by staff, those of the
+// server and the plugin values, may refer to secrets kept outside the
+// database; custom field and configurable option values never do, as
+// customers enter them.
+func buildProvisionRequest(service domain.Service, fields map[string]string) (*provisionerv1.CreateServiceRequest, error) {
 	options := map[string]string{}
+	for key, value := range fields {
+		options[key] = value
+	}
 	for key, value := range service.ConfigSelection {
 		options[key] = stringifyOptionValue(value)
 	}
@@ -141,7 +257,29 @@ func buildProvisionRequest(service domain.Service) *provisionerv1.CreateServiceR
 		options["node_id"] = service.PluginConfig.NodeID
 	}
 	for key, value := range service.PluginConfig.Values {
-		options[key] = value
+		resolved, err := domain.ResolveSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("plugin value %s: %w", key, err)
+		}
+		options[key] = resolved
+	}
+	if server := service.Server; server != nil {
+		options["server_hostname"] = server.Hostname
+		options["server_ip"] = server.IPAddress
+		options["server_port"] = strconv.Itoa(server.Port)
+		options["server_secure"] = strconv.FormatBool(server.Secure)
+		credentials := map[string]string{
+			"server_username":    server.Username,
+			"server_password":    string(server.Password),
+			"server_access_hash": string(server.AccessHash),
+		}
+		for key, value := range credentials {
+			resolved, err := domain.ResolveSecret(value)
+			if err != nil {
+				return nil, fmt.Errorf("server %d %s: %w", server.ID, key, err)
+			}
+			options[key] = resolved
+		}
 	}
 
 	return &provisionerv1.CreateServiceRequest{
@@ -149,7 +287,7 @@ func buildProvisionRequest(service domain.Service) *provisionerv1.CreateServiceR
 		CustomerId: strconv.FormatUint(service.CustomerID, 10),
 		PackageId:  strconv.FormatUint(service.ProductID, 10),
 		Options:    options,
-	}
+	}, nil
 }
 
 func stringifyOptionValue(value any) string {
@@ -0,0 +1,135 @@
+package tickets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// DefaultMaxAttachmentSize limits emailed attachments when the policy
+// sets no size, matching attachments uploaded on the site
+const DefaultMaxAttachmentSize = 10 << 20
+
+// AttachmentPolicy decides which attachments of piped email are kept.
+// AllowedTypes lists MIME types such as "application/pdf" or "image/*";
+// an empty list allows every type.
+type AttachmentPolicy struct {
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+// Check returns why an attachment is not allowed, or "" when it is
+func (p AttachmentPolicy) Check(contentType string, size int64) string {
+	maxSize := p.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAttachmentSize
+	}
+	if size > maxSize {
+		return fmt.Sprintf("larger than %.1f MB", float64(maxSize)/(1<<20))
+	}
+	if len(p.AllowedTypes) == 0 {
+		return ""
+	}
+	kind := mediaType(contentType)
+	for _, allowed := range p.AllowedTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == kind {
+			return ""
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(kind, prefix+"/") {
+			return ""
+		}
+	}
+	return fmt.Sprintf("type %s is not allowed", kind)
+}
+
+// mediaType returns the lower cased type of a Content-Type value without
+// its parameters
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	kind, _, _ := strings.Cut(contentType, ";")
+	if kind = strings.ToLower(strings.TrimSpace(kind)); kind == "" {
+		return "application/octet-stream"
+	}
+	return kind
+}
+
+// emailAttachment is an attachment of an email accepted by the policy
+type emailAttachment struct {
+	fileName    string
+	contentType string
+	data        []byte
+}
+
+// removedNotice returns the text appended to a message whose attachments
+// were removed, one line per attachment
+func removedNotice(removed []string) string {
+	if len(removed) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n---\nAttachments removed by the attachment policy:\n")
+	for _, line := range removed {
+		b.WriteString("- ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// saveMessage creates a message and its attachments. Attachment content
+// goes into the file store, or into the attachment rows when there is
+// none; stored files are removed again if the message cannot be saved.
+func (r *Repository) saveMessage(message *domain.TicketMessage, attachments []emailAttachment) error {
+	var stored []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("create message: %w", err)
+		}
+		for _, att := range attachments {
+			attachment := domain.TicketAttachment{
+				TicketMessageID: message.ID,
+				FileName:        att.fileName,
+				ContentType:     att.contentType,
+				SizeBytes:       int64(len(att.data)),
+				Data:            []byte{},
+			}
+			if r.files == nil {
+				attachment.Data = att.data
+			} else {
+				key, err := domain.NewFileKey("tickets", message.TicketID, message.ID)
+				if err != nil {
+					return err
+				}
+				if err := r.files.Put(context.Background(), key, bytes.NewReader(att.data), attachment.SizeBytes, att.contentType); err != nil {
+					return fmt.Errorf("store attachment: %w", err)
+				}
+				stored = append(stored, key)
+				attachment.StorageKey = key
+			}
+			if err := tx.Create(&attachment).Error; err != nil {
+				return fmt.Errorf("create attachment: %w", err)
+			}
+			message.Attachments = append(message.Attachments, attachment)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, key := range stored {
+			if err := r.files.Delete(context.Background(), key); err != nil {
+				log.Printf("tickets: failed to delete attachment %s: %v", key, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package tickets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"gorm.io/gorm"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var ticketIDRegex = regexp.MustCompile(`\[Ticket #(\d+)\]`)
+
+// recipientHeaders are searched in order for the department address an
+// email was sent to
+var recipientHeaders = []string{"Delivered-To", "X-Original-To", "To", "Cc"}
+
+// ImportEmail adds an email to the ticket its subject refers to, or opens
+// a new ticket for it. The ticket belongs to the customer the sender
+// resolves to. Only that customer may answer it by email; mail from
+// anyone else opens a new ticket. Departments that accept clients only
+// reject unknown senders with domain.ErrSenderRejected, the others open a
+// ticket flagged UnknownSender. Attachments outside the attachment policy
+// are left out with a notice appended to the message. Quoted history and
+// signatures are stripped from the body, which is kept in full as the
+// message's OriginalBody.
+func (r *Repository) ImportEmail(raw []byte) (*domain.TicketMessage, error) {
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse email: %w", err)
+	}
+
+	subject := strings.TrimSpace(envelope.GetHeader("Subject"))
+	if subject == "" {
+		subject = "(no subject)"
+	}
+
+	ticketID, err := extractTicketID(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	body := strings.TrimSpace(envelope.Text)
+	if body == "" {
+		body = strings.TrimSpace(envelope.HTML)
+	}
+	if body == "" {
+		body = "(no content)"
+	}
+	original := body
+	body = ParseReply(body)
+	if body == original {
+		original = ""
+	}
+
+	sender := strings.TrimSpace(envelope.GetHeader("From"))
+	if sender == "" {
+		sender = "unknown"
+	}
+
+	from, err := r.ResolveSender(sender)
+	if err != nil {
+		return nil, fmt.Errorf("resolve sender: %w", err)
+	}
+
+	var ticket domain.Ticket
+	if ticketID != nil {
+		ticket, err = r.FindTicketByID(*ticketID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("load ticket: %w", err)
+		}
+		if err == nil {
+			allowed, err := r.mayAnswer(ticket, from)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				ticket = domain.Ticket{}
+			}
+		}
+	}
+	if ticket.ID == 0 {
+		ticket, err = r.createEmailTicket(subject, recipients(envelope), from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Attachments the policy rejects are dropped with a notice in the
+	// message, so staff know the customer sent them
+	var attachments []emailAttachment
+	var removed []string
+	for _, attachment := range envelope.Attachments {
+		data := attachment.Content
+		if reason := r.policy.Check(attachment.ContentType, int64(len(data))); reason != "" {
+			removed = append(removed, fmt.Sprintf("%s (%s)", attachment.FileName, reason))
+			continue
+		}
+		attachments = append(attachments, emailAttachment{
+			fileName:    attachment.FileName,
+			contentType: attachment.ContentType,
+			data:        data,
+		})
+	}
+
+	message := domain.TicketMessage{
+		TicketID:     ticket.ID,
+		SenderEmail:  sender,
+		Body:         body + removedNotice(removed),
+		OriginalBody: original,
+		IsStaff:      false,
+	}
+	if err := r.saveMessage(&message, attachments); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+func extractTicketID(subject string) (*uint64, error) {
+	matches := ticketIDRegex.FindStringSubmatch(subject)
+	if len(matches) < 2 {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse ticket id: %w", err)
+	}
+	return &id, nil
+}
+
+func (r *Repository) createEmailTicket(subject string, recipients []string, from *Sender) (domain.Ticket, error) {
+	ticket := domain.Ticket{
+		Subject:  subject,
+		Status:   domain.TicketStatusOpen,
+		Priority: domain.TicketPriorityNormal,
+		Source:   "email",
+	}
+
+	department, err := r.findDepartment(recipients)
+	if err != nil {
+		return domain.Ticket{}, fmt.Errorf("find department: %w", err)
+	}
+	if department != nil {
+		if !department.PipesEnabled {
+			return domain.Ticket{}, fmt.Errorf("%w: %s does not accept email", domain.ErrSenderRejected, department.Name)
+		}
+		ticket.DepartmentID = &department.ID
+		if department.DefaultPriority != "" {
+			ticket.Priority = domain.TicketPriority(department.DefaultPriority)
+		}
+	}
+
+	if from.CanOpen() {
+		ticket.CustomerID = from.CustomerID
+	} else {
+		if department != nil && department.ClientsOnly {
+			return domain.Ticket{}, fmt.Errorf("%w: %s is not a client of %s", domain.ErrSenderRejected, from.Address, department.Name)
+		}
+		ticket.UnknownSender = true
+	}
+
+	if err := r.CreateTicket(&ticket); err != nil {
+		return domain.Ticket{}, err
+	}
+	return ticket, nil
+}
+
+// mayAnswer reports whether a sender may add to a ticket by email. Tickets
+// of unknown senders are answered from the address that opened them.
+func (r *Repository) mayAnswer(ticket domain.Ticket, from *Sender) (bool, error) {
+	if ticket.CustomerID != nil {
+		return from.CanReply() && *from.CustomerID == *ticket.CustomerID, nil
+	}
+	var first domain.TicketMessage
+	if err := r.db.Where("ticket_id = ? AND is_staff = ?", ticket.ID, false).
+		Order("id").Limit(1).Find(&first).Error; err != nil {
+		return false, err
+	}
+	return first.ID != 0 && normalizeAddress(first.SenderEmail, true) == normalizeAddress(from.Address, true), nil
+}
+
+// recipients returns the addresses an email was delivered to
+func recipients(envelope *enmime.Envelope) []string {
+	var addresses []string
+	for _, header := range recipientHeaders {
+		for _, value := range envelope.GetHeaderValues(header) {
+			list, err := mail.ParseAddressList(value)
+			if err != nil {
+				addresses = append(addresses, value)
+				continue
+			}
+			for _, address := range list {
+				addresses = append(addresses, address.Address)
+			}
+		}
+	}
+	return addresses
+}
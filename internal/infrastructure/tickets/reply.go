@@ -0,0 +1,118 @@
+package tickets
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Lines that start the quoted history of a reply; everything from them on
+// is dropped
+var quoteHeaderPatterns = []*regexp.Regexp{
+	// "On Mon, 1 Jan 2024 at 10:00, Support <support@example.com> wrote:"
+	regexp.MustCompile(`(?i)^\s*on\b.{0,300}\bwrote:\s*$`),
+	// "Am 01.01.2024 um 10:00 schrieb Support:", "Le ... a écrit :"
+	regexp.MustCompile(`(?i)^\s*(am|le|el|il|op)\b.{0,300}\b(schrieb|a écrit|escribió|ha scritto|schreef)\s*:\s*$`),
+	// "在 2024年1月1日 10:00，Support <support@example.com> 写道："
+	regexp.MustCompile(`^\s*在.{0,300}写道[:：]\s*$`),
+	regexp.MustCompile(`(?i)^\s*-{2,}\s*(original message|forwarded message|reply above this line)\s*-{2,}\s*$`),
+	regexp.MustCompile(`(?i)^\s*-{2,}\s*原始邮件\s*-{2,}\s*$`),
+	// Outlook separates the quoted message with a line of underscores
+	regexp.MustCompile(`^\s*_{20,}\s*$`),
+}
+
+// outlookHeaderPattern matches the "From:" line Outlook puts above the
+// quoted message; it starts the history when "Sent:" or "Date:" follows
+var outlookHeaderPattern = regexp.MustCompile(`(?i)^\s*\*?(from|von|de|发件人)\s*\*?\s*[:：]`)
+
+var outlookDatePattern = regexp.MustCompile(`(?i)^\s*\*?(sent|date|gesendet|envoyé|发送时间)\s*\*?\s*[:：]`)
+
+// signatureMaxLines is how far above the end of a reply a signature may
+// start
+const signatureMaxLines = 12
+
+// signaturePatterns match the first line of a signature; it is dropped
+// with everything below it
+var signaturePatterns = []*regexp.Regexp{
+	// The standard "-- " delimiter, often stripped to "--"
+	regexp.MustCompile(`^--\s*$`),
+	regexp.MustCompile(`(?i)^\s*sent from my \w+`),
+	regexp.MustCompile(`(?i)^\s*(get|sent from) outlook for \w+`),
+	regexp.MustCompile(`^\s*发自我的`),
+}
+
+// ParseReply returns the text a customer wrote in an email, without the
+// quoted earlier messages and the signature. It returns the text unchanged
+// when nothing would be left, e.g. for an email that only forwards
+// another.
+func ParseReply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	end := len(lines)
+	for i := range lines {
+		if isQuoteHeader(lines, i) {
+			end = i
+			break
+		}
+	}
+	lines = lines[:end]
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Signatures are searched near the bottom only, so a "--" in the
+	// middle of a long message keeps the text below it
+	cut := len(lines)
+	for i := max(0, len(lines)-signatureMaxLines); i < len(lines); i++ {
+		if isSignature(lines[i]) {
+			cut = i
+			break
+		}
+	}
+	lines = lines[:cut]
+
+	// Quoted lines left between the paragraphs of an inline reply are
+	// dropped, keeping the answers
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			kept = append(kept, line)
+		}
+	}
+
+	reply := strings.TrimSpace(strings.Join(kept, "\n"))
+	if reply == "" {
+		return strings.TrimSpace(text)
+	}
+	return reply
+}
+
+// isQuoteHeader reports whether line i starts the quoted history
+func isQuoteHeader(lines []string, i int) bool {
+	line := lines[i]
+	for _, pattern := range quoteHeaderPatterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	// Mail clients wrap long "On ... wrote:" lines
+	if i+1 < len(lines) && quoteHeaderPatterns[0].MatchString(line+" "+strings.TrimSpace(lines[i+1])) {
+		return true
+	}
+	if outlookHeaderPattern.MatchString(line) {
+		for _, next := range lines[i+1 : min(i+4, len(lines))] {
+			if outlookDatePattern.MatchString(next) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSignature(line string) bool {
+	for _, pattern := range signaturePatterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -10,18 +10,31 @@ import (
 )
 
 type Repository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	files  domain.FileStore
+	policy AttachmentPolicy
 }
 
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// SetFileStore keeps attachment content in the file store instead of the
+// database
+func (r *Repository) SetFileStore(files domain.FileStore) {
+	r.files = files
+}
+
+// SetAttachmentPolicy sets which attachments of piped email are kept
+func (r *Repository) SetAttachmentPolicy(policy AttachmentPolicy) {
+	r.policy = policy
+}
+
 func (r *Repository) AutoMigrate() error {
 	if r.db == nil {
 		return errors.New("db is required")
 	}
-	return r.db.AutoMigrate(&domain.Ticket{}, &domain.TicketMessage{}, &domain.TicketAttachment{})
+	return r.db.AutoMigrate(&domain.TicketDepartment{}, &domain.Ticket{}, &domain.TicketMessage{}, &domain.TicketAttachment{})
 }
 
 func (r *Repository) FindTicketByID(id uint64) (domain.Ticket, error) {
@@ -0,0 +1,103 @@
+package tickets
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Sender is the customer an email address belongs to, either as the
+// account holder or as one of their sub-users
+type Sender struct {
+	Address    string
+	CustomerID *uint64
+	SubUser    *domain.SubUser
+}
+
+// CanOpen reports whether the sender may open tickets for the customer
+func (s *Sender) CanOpen() bool {
+	return s.CustomerID != nil && (s.SubUser == nil || s.SubUser.Permissions.CreateTickets)
+}
+
+// CanReply reports whether the sender may answer tickets of the customer
+func (s *Sender) CanReply() bool {
+	return s.CustomerID != nil && (s.SubUser == nil || s.SubUser.Permissions.ReplyTickets)
+}
+
+// ResolveSender looks up the customer of an email address. Addresses
+// with a "+tag" also match the address without it, so
+// "jane+hosting@example.com" is Jane's. Customers are matched before
+// sub-users; inactive sub-users match no one.
+func (r *Repository) ResolveSender(address string) (*Sender, error) {
+	sender := &Sender{Address: normalizeAddress(address, false)}
+	if sender.Address == "" {
+		return sender, nil
+	}
+	candidates := []string{sender.Address}
+	if stripped := normalizeAddress(address, true); stripped != sender.Address {
+		candidates = append(candidates, stripped)
+	}
+
+	for _, candidate := range candidates {
+		var user domain.User
+		err := r.db.Where("LOWER(email) = ? AND role = ?", candidate, domain.UserRoleCustomer).
+			Limit(1).Find(&user).Error
+		if err != nil {
+			return nil, err
+		}
+		if user.ID != 0 {
+			sender.CustomerID = &user.ID
+			return sender, nil
+		}
+
+		var subUser domain.SubUser
+		if err := r.db.Where("LOWER(email) = ? AND active = ?", candidate, true).
+			Limit(1).Find(&subUser).Error; err != nil {
+			return nil, err
+		}
+		if subUser.ID != 0 {
+			sender.CustomerID = &subUser.CustomerID
+			sender.SubUser = &subUser
+			return sender, nil
+		}
+	}
+	return sender, nil
+}
+
+// findDepartment returns the active department whose pipe address
+// received the email, trying the recipients in order
+func (r *Repository) findDepartment(recipients []string) (*domain.TicketDepartment, error) {
+	var departments []domain.TicketDepartment
+	if err := r.db.Where("active = ? AND email <> ''", true).
+		Order("sort_order, id").Find(&departments).Error; err != nil {
+		return nil, err
+	}
+	for _, recipient := range recipients {
+		recipient = normalizeAddress(recipient, true)
+		for i := range departments {
+			if normalizeAddress(departments[i].Email, true) == recipient {
+				return &departments[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// normalizeAddress lower cases the address of a header value such as
+// "Jane <Jane@Example.com>", optionally dropping the "+tag" of its local
+// part
+func normalizeAddress(value string, stripTag bool) string {
+	address := strings.TrimSpace(value)
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		address = parsed.Address
+	}
+	address = strings.ToLower(address)
+	if stripTag {
+		local, domainName, ok := strings.Cut(address, "@")
+		if base, _, tagged := strings.Cut(local, "+"); ok && tagged && base != "" {
+			address = base + "@" + domainName
+		}
+	}
+	return address
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var adminAccess struct {
+	mu      sync.RWMutex
+	allowed func(c *gin.Context) bool
+}
+
+// SetAdminAccess sets how AdminAccessMiddleware decides whether a request
+// may reach the admin panel, such as by checking the client address
+// against the allow-list
+func SetAdminAccess(allowed func(c *gin.Context) bool) {
+	adminAccess.mu.Lock()
+	defer adminAccess.mu.Unlock()
+	adminAccess.allowed = allowed
+}
+
+// AdminAccessMiddleware answers requests for admin panel pages from
+// addresses that are not allowed with the forbidden page of the theme.
+// The admin API checks the allow-list itself.
+func AdminAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if path != "/admin" && !strings.HasPrefix(path, "/admin/") {
+			c.Next()
+			return
+		}
+		adminAccess.mu.RLock()
+		allowed := adminAccess.allowed
+		adminAccess.mu.RUnlock()
+		if allowed == nil || allowed(c) {
+			c.Next()
+			return
+		}
+
+		RenderWithOptions(c, "forbidden.html", gin.H{
+			"IP": c.ClientIP(),
+		}, RenderOptions{StatusCode: http.StatusForbidden})
+		c.Abort()
+	}
+}
@@ -0,0 +1,315 @@
+// Package web provides the asset pipeline for OpenHost themes.
+// Asset URLs carry a hash of the file content, so browsers cache them for
+// a year and pick up changes as soon as a file is modified. Pre-compressed
+// .br and .gz copies are served to clients that accept them.
+package web
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cache-Control values of served assets
+const (
+	CacheImmutable   = "public, max-age=31536000, immutable"
+	CacheRevalidate  = "public, no-cache"
+	fingerprintBytes = 5
+)
+
+// fingerprintPattern matches file names like main.3f2a9b1c04.css
+var fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{10})(\.[^./]+)$`)
+
+// precompressedEncodings are tried in order of preference
+var precompressedEncodings = []struct {
+	name string
+	ext  string
+}{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+// compressibleExts are the asset types worth pre-compressing
+var compressibleExts = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".json": true, ".map": true,
+	".svg": true, ".txt": true, ".xml": true,
+}
+
+// AssetServer serves theme assets under a URL prefix and builds their
+// fingerprinted URLs
+type AssetServer struct {
+	root   string
+	fsys   fs.FS
+	prefix string
+
+	mu     sync.RWMutex
+	hashes map[string]assetHash
+}
+
+type assetHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// DefaultAssetServer serves the themes directory under /static
+var DefaultAssetServer = NewAssetServer("./themes", "/static")
+
+// NewAssetServer creates an asset server for the themes in root, served
+// under prefix. Files missing from root are served from the embedded
+// default theme.
+func NewAssetServer(root, prefix string) *AssetServer {
+	return &AssetServer{
+		root:   root,
+		fsys:   NewThemeFS(root),
+		prefix: "/" + strings.Trim(prefix, "/"),
+		hashes: make(map[string]assetHash),
+	}
+}
+
+// AssetURL returns the fingerprinted URL of an asset of the default server
+func AssetURL(name string) string {
+	return DefaultAssetServer.URL(name)
+}
+
+// URL returns the URL of an asset, relative to the root, with the hash of
+// its content in the file name. Missing files get a plain URL.
+func (s *AssetServer) URL(name string) string {
+	rel := cleanAssetPath(name)
+	hash, err := s.hash(rel)
+	if err != nil {
+		return s.prefix + rel
+	}
+	ext := path.Ext(rel)
+	return s.prefix + strings.TrimSuffix(rel, ext) + "." + hash + ext
+}
+
+// Handler serves the assets under the route parameter "filepath".
+// Fingerprinted URLs are cached for a year, plain ones are revalidated
+// on every use.
+func (s *AssetServer) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rel := cleanAssetPath(c.Param("filepath"))
+		cacheControl := CacheRevalidate
+
+		info, err := s.stat(rel)
+		if err != nil {
+			if m := fingerprintPattern.FindStringSubmatch(rel); m != nil {
+				original := m[1] + m[3]
+				if hash, err := s.hash(original); err == nil {
+					rel = original
+					info, _ = s.stat(rel)
+					// An outdated hash gets the current file, which must
+					// not be cached under the old URL
+					if hash == m[2] {
+						cacheControl = CacheImmutable
+					}
+				}
+			}
+		}
+		if info == nil || info.IsDir() {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		hash, err := s.hash(rel)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Cache-Control", cacheControl)
+		name, encoding := s.precompressed(rel, info, c.GetHeader("Accept-Encoding"))
+		ctype := mime.TypeByExtension(path.Ext(rel))
+		if ctype == "" && encoding != "" {
+			// Sniffing would see the compressed bytes
+			ctype = "application/octet-stream"
+		}
+		if ctype != "" {
+			c.Header("Content-Type", ctype)
+		}
+		if compressibleExts[path.Ext(rel)] {
+			c.Header("Vary", "Accept-Encoding")
+		}
+		if encoding != "" {
+			c.Header("Content-Encoding", encoding)
+			c.Header("ETag", `"`+hash+"-"+encoding+`"`)
+		} else {
+			c.Header("ETag", `"`+hash+`"`)
+		}
+
+		f, err := s.fsys.Open(s.file(name))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(c.Writer, c.Request, "", info.ModTime(), content)
+	}
+}
+
+// Precompress writes gzip copies of the compressible assets in root next
+// to them, skipping copies that are up to date. Brotli copies are produced
+// by external tools and served the same way when present.
+func (s *AssetServer) Precompress() (int, error) {
+	written := 0
+	err := filepath.WalkDir(s.root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !compressibleExts[filepath.Ext(name)] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if gz, err := os.Stat(name + ".gz"); err == nil && !gz.ModTime().Before(info.ModTime()) {
+			return nil
+		}
+		if err := gzipFile(name); err != nil {
+			return fmt.Errorf("compress %s: %w", name, err)
+		}
+		written++
+		return nil
+	})
+	return written, err
+}
+
+// precompressed returns the file to serve for an asset and its content
+// encoding, preferring an up to date compressed copy the client accepts
+func (s *AssetServer) precompressed(rel string, info os.FileInfo, acceptEncoding string) (string, string) {
+	if !compressibleExts[path.Ext(rel)] {
+		return rel, ""
+	}
+	for _, enc := range precompressedEncodings {
+		if !acceptsEncoding(acceptEncoding, enc.name) {
+			continue
+		}
+		compressed, err := s.stat(rel + enc.ext)
+		if err == nil && !compressed.IsDir() && !compressed.ModTime().Before(info.ModTime()) {
+			return rel + enc.ext, enc.name
+		}
+	}
+	return rel, ""
+}
+
+// hash returns the content hash of an asset, computed again only when the
+// file changed
+func (s *AssetServer) hash(rel string) (string, error) {
+	info, err := s.stat(rel)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fs.ErrNotExist
+	}
+
+	s.mu.RLock()
+	cached, ok := s.hashes[rel]
+	s.mu.RUnlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+
+	f, err := s.fsys.Open(s.file(rel))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil)[:fingerprintBytes])
+
+	s.mu.Lock()
+	s.hashes[rel] = assetHash{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	s.mu.Unlock()
+	return hash, nil
+}
+
+func (s *AssetServer) stat(rel string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, s.file(rel))
+}
+
+// file returns the file system name of a cleaned asset path
+func (s *AssetServer) file(rel string) string {
+	return strings.TrimPrefix(rel, "/")
+}
+
+// cleanAssetPath turns a request path into a slash separated path that
+// cannot leave the root
+func cleanAssetPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != encoding {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".precompress-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw, err := gzip.NewWriterLevel(tmp, gzip.BestCompression)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name+".gz")
+}
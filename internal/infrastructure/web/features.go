@@ -0,0 +1,35 @@
+package web
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+var features struct {
+	mu      sync.RWMutex
+	enabled func(key string, user *domain.User) bool
+}
+
+// SetFeatures sets how feature flags are checked for the signed in user,
+// nil to turn every flag off
+func SetFeatures(enabled func(key string, user *domain.User) bool) {
+	features.mu.Lock()
+	defer features.mu.Unlock()
+	features.enabled = enabled
+}
+
+// FeatureEnabled reports whether a feature flag is on for the user of a
+// request. Templates check it with {{if call .Feature "live_chat"}}.
+func FeatureEnabled(c *gin.Context, key string) bool {
+	features.mu.RLock()
+	enabled := features.enabled
+	features.mu.RUnlock()
+	if enabled == nil {
+		return false
+	}
+	user, _ := contextValue(c, ContextUserKey).(*domain.User)
+	return enabled(key, user)
+}
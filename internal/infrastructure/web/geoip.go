@@ -0,0 +1,158 @@
+package web
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/geoip"
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
+)
+
+// Sources of the country, currency and language of a request. They are
+// recorded so it can be told later why a visitor got them.
+const (
+	SourceUser    = "user"    // Picked by the visitor
+	SourceProfile = "profile" // Preferences of the signed in user
+	SourceBrowser = "browser" // Accept-Language header
+	SourceGeoIP   = "geoip"   // Country of the visitor's IP address
+	SourceDefault = "default"
+)
+
+// Context keys of the detected country and of the sources of the detected
+// values
+const (
+	ContextCountryKey        = "country"
+	ContextCountrySourceKey  = "country_source"
+	ContextCurrencySourceKey = "currency_source"
+	ContextLangSourceKey     = "lang_source"
+)
+
+// countryCookie keeps the country a visitor picked for their cart's tax
+const countryCookie = "country"
+
+var geo struct {
+	mu      sync.RWMutex
+	locator geoip.Locator
+	offered func(currency string) bool
+}
+
+// SetGeoIP sets the locator finding the country of visitors, nil to stop
+// locating them. Offered reports whether customers can be billed in a
+// currency, so visitors are only preselected currencies on sale.
+func SetGeoIP(locator geoip.Locator, offered func(currency string) bool) {
+	geo.mu.Lock()
+	defer geo.mu.Unlock()
+	geo.locator = locator
+	geo.offered = offered
+}
+
+// GeoIPMiddleware sets the country of a visitor: the one they picked, or
+// the one of their IP address when a locator is set. It runs before
+// LanguageMiddleware and CurrencyMiddleware, which fall back to the
+// language and currency of the country.
+func GeoIPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if country, err := c.Cookie(countryCookie); err == nil && validCountry(country) {
+			c.Set(ContextCountryKey, strings.ToUpper(country))
+			c.Set(ContextCountrySourceKey, SourceUser)
+			c.Next()
+			return
+		}
+
+		geo.mu.RLock()
+		locator := geo.locator
+		geo.mu.RUnlock()
+		if locator != nil {
+			if country, err := locator.Country(net.ParseIP(c.ClientIP())); err == nil {
+				c.Set(ContextCountryKey, country)
+				c.Set(ContextCountrySourceKey, SourceGeoIP)
+			}
+		}
+		c.Next()
+	}
+}
+
+// SetCountry keeps the country a visitor picked, which wins over the one
+// of their IP address
+func SetCountry(c *gin.Context, country string) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	c.SetCookie(countryCookie, country, 86400*365, "/", "", false, false)
+	c.Set(ContextCountryKey, country)
+	c.Set(ContextCountrySourceKey, SourceUser)
+}
+
+// Detection is the country, currency and language of a request with where
+// each came from
+type Detection struct {
+	Country        string
+	CountrySource  string
+	Currency       string
+	CurrencySource string
+	Language       string
+	LanguageSource string
+}
+
+// Detect returns the country, currency and language of a request
+func Detect(c *gin.Context) Detection {
+	value := func(key string) string {
+		s, _ := contextValue(c, key).(string)
+		return s
+	}
+	return Detection{
+		Country:        value(ContextCountryKey),
+		CountrySource:  value(ContextCountrySourceKey),
+		Currency:       value(ContextCurrencyKey),
+		CurrencySource: value(ContextCurrencySourceKey),
+		Language:       value(ContextLangKey),
+		LanguageSource: value(ContextLangSourceKey),
+	}
+}
+
+// geoCurrency returns the currency of a located visitor's country when it
+// is on sale
+func geoCurrency(c *gin.Context) string {
+	if source, _ := contextValue(c, ContextCountrySourceKey).(string); source != SourceGeoIP {
+		return ""
+	}
+	country, _ := contextValue(c, ContextCountryKey).(string)
+	currency := geoip.Currency(country)
+	if currency == "" {
+		return ""
+	}
+	geo.mu.RLock()
+	offered := geo.offered
+	geo.mu.RUnlock()
+	if offered != nil && !offered(currency) {
+		return ""
+	}
+	return currency
+}
+
+// geoLanguage returns the language of a located visitor's country when it
+// is translated
+func geoLanguage(c *gin.Context) string {
+	if source, _ := contextValue(c, ContextCountrySourceKey).(string); source != SourceGeoIP {
+		return ""
+	}
+	country, _ := contextValue(c, ContextCountryKey).(string)
+	lang := geoip.Language(country)
+	if lang == "" || i18n.Default().GetLanguage(lang) == nil {
+		return ""
+	}
+	return lang
+}
+
+func validCountry(country string) bool {
+	if len(country) != 2 {
+		return false
+	}
+	for _, r := range strings.ToUpper(country) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+// Package web provides HTMX support for OpenHost templates.
+// Requests made by HTMX get the page block without the layout, together
+// with out-of-band swaps for the parts of the layout that changed.
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
+)
+
+// HTMX request headers
+const (
+	HeaderHXRequest = "HX-Request"
+	HeaderHXBoosted = "HX-Boosted"
+	HeaderHXTarget  = "HX-Target"
+)
+
+// Context and template names used by fragment rendering
+const (
+	ContextOOBKey = "htmx_oob"
+
+	// DefaultBlock is the page block rendered for HTMX requests
+	DefaultBlock = "content"
+
+	// FlashBlock is the partial rendering flash messages, FlashTarget the
+	// element of the layout it is rendered into
+	FlashBlock  = "flash"
+	FlashTarget = "flash"
+)
+
+// OOBSwap is a template block sent along with a fragment, replacing the
+// content of the element with the target ID
+type OOBSwap struct {
+	TargetID string
+	Block    string
+}
+
+// IsHTMXRequest reports whether a request was made by HTMX and expects a
+// fragment. Boosted links and forms swap the whole body, so they get the
+// full page.
+func IsHTMXRequest(c *gin.Context) bool {
+	return c.GetHeader(HeaderHXRequest) == "true" && c.GetHeader(HeaderHXBoosted) != "true"
+}
+
+// AddOOB queues a template block to be swapped into the element with the
+// target ID when the page is rendered as a fragment. Full page renders
+// ignore it, the layout already contains the block.
+func AddOOB(c *gin.Context, targetID, block string) {
+	existing, _ := c.Get(ContextOOBKey)
+	swaps, _ := existing.([]OOBSwap)
+	swaps = append(swaps, OOBSwap{TargetID: targetID, Block: block})
+	c.Set(ContextOOBKey, swaps)
+}
+
+// RenderFlash responds to an HTMX request with only a flash message,
+// swapped into the flash element of the layout
+func RenderFlash(c *gin.Context, flashType, message string) {
+	defaultRenderer.RenderFlash(c, flashType, message)
+}
+
+// RenderFlash responds to an HTMX request with only a flash message,
+// swapped into the flash element of the layout
+func (r *Renderer) RenderFlash(c *gin.Context, flashType, message string) {
+	flash := &Flash{Type: flashType, Message: message}
+	SetFlash(c, flashType, message)
+
+	lang := r.getLanguage(c)
+	translator := r.i18nManager.GetTranslator(lang)
+	data := gin.H{"Flash": flash, "Lang": lang, "Dir": translator.Language().Dir(), "Theme": r.getActiveTheme(c), "HTMX": true}
+
+	var buf bytes.Buffer
+	tmpl, err := r.loadPartials(r.getActiveTheme(c), translator)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := writeFlash(&buf, tmpl, data, flash); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// renderFragment renders a page block without its layout, followed by the
+// queued out-of-band swaps and the flash message
+func (r *Renderer) renderFragment(c *gin.Context, tmpl *template.Template, statusCode int, block string, data gin.H) {
+	if block == "" {
+		block = DefaultBlock
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	existing, _ := c.Get(ContextOOBKey)
+	swaps, _ := existing.([]OOBSwap)
+	for _, swap := range swaps {
+		fmt.Fprintf(&buf, `<div id="%s" hx-swap-oob="innerHTML">`, template.HTMLEscapeString(swap.TargetID))
+		if err := tmpl.ExecuteTemplate(&buf, swap.Block, data); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		buf.WriteString("</div>")
+	}
+
+	// The layout is not rendered again, so the flash message is swapped in
+	if flash, ok := data["Flash"].(*Flash); ok && flash != nil {
+		if err := writeFlash(&buf, tmpl, data, flash); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	c.Data(statusCode, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// loadPartials parses the partials of a theme
+func (r *Renderer) loadPartials(theme string, translator *i18n.Translator) (*template.Template, error) {
+	funcMap := make(template.FuncMap)
+	r.mu.RLock()
+	for k, v := range r.funcMap {
+		funcMap[k] = v
+	}
+	r.mu.RUnlock()
+	for k, v := range translatorFuncs(translator, r.money) {
+		funcMap[k] = v
+	}
+
+	tmpl := template.New("partials").Funcs(funcMap)
+	files := r.themePartials(r.themeManager.ThemeChain(theme))
+	if len(files) == 0 {
+		return tmpl, nil
+	}
+	return tmpl.ParseFS(r.fsys, files...)
+}
+
+// writeFlash writes a flash message as an out-of-band swap of the flash
+// element. Themes without a flash partial get a plain alert.
+func writeFlash(buf *bytes.Buffer, tmpl *template.Template, data gin.H, flash *Flash) error {
+	fmt.Fprintf(buf, `<div id="%s" hx-swap-oob="innerHTML">`, FlashTarget)
+	if tmpl.Lookup(FlashBlock) != nil {
+		if err := tmpl.ExecuteTemplate(buf, FlashBlock, data); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(buf, `<div class="alert alert-%s">%s</div>`,
+			template.HTMLEscapeString(flash.Type), template.HTMLEscapeString(flash.Message))
+	}
+	buf.WriteString("</div>")
+	return nil
+}
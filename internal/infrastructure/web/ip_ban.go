@@ -0,0 +1,66 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ipBans struct {
+	mu     sync.RWMutex
+	banned func(ip string) (bool, *time.Time)
+	bypass func(c *gin.Context) bool
+}
+
+// SetIPBans sets how IPBanMiddleware checks whether the client address is
+// banned and until when, nil for good. Bypass reports whether a request is
+// let through anyway, such as one of signed in staff.
+func SetIPBans(banned func(ip string) (bool, *time.Time), bypass func(c *gin.Context) bool) {
+	ipBans.mu.Lock()
+	defer ipBans.mu.Unlock()
+	ipBans.banned = banned
+	ipBans.bypass = bypass
+}
+
+// IPBanMiddleware answers requests from banned addresses with a 429: a
+// JSON error under /api/ and the blocked page of the theme otherwise.
+// Static files and health checks are always served.
+func IPBanMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ipBans.mu.RLock()
+		banned, bypass := ipBans.banned, ipBans.bypass
+		ipBans.mu.RUnlock()
+		if banned == nil || maintenanceExempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		ip := c.ClientIP()
+		isBanned, until := banned(ip)
+		if !isBanned || (bypass != nil && bypass(c)) {
+			c.Next()
+			return
+		}
+
+		if until != nil {
+			if wait := time.Until(*until); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+		}
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			TooManyRequests(c, "Too many requests from your address, try again later")
+			c.Abort()
+			return
+		}
+
+		RenderWithOptions(c, "blocked.html", gin.H{
+			"IP":    ip,
+			"Until": until,
+		}, RenderOptions{StatusCode: http.StatusTooManyRequests})
+		c.Abort()
+	}
+}
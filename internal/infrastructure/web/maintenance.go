@@ -0,0 +1,83 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceState is the maintenance mode shown to visitors
+type MaintenanceState struct {
+	Enabled bool
+	Message string     // Replaces the default text of the page
+	EndsAt  *time.Time // Expected end, sent as Retry-After
+}
+
+var maintenance struct {
+	mu     sync.RWMutex
+	state  func() MaintenanceState
+	bypass func(c *gin.Context) bool
+}
+
+// SetMaintenance sets where MaintenanceModeMiddleware reads the maintenance
+// mode from. Bypass reports whether a request is let through anyway, such
+// as one of a signed in admin.
+func SetMaintenance(state func() MaintenanceState, bypass func(c *gin.Context) bool) {
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+	maintenance.state = state
+	maintenance.bypass = bypass
+}
+
+// MaintenanceModeMiddleware answers requests with a 503 while the
+// maintenance mode is on: a JSON error under /api/ and the maintenance
+// page of the theme otherwise. Static files and health checks are always
+// served.
+func MaintenanceModeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maintenance.mu.RLock()
+		stateFunc, bypass := maintenance.state, maintenance.bypass
+		maintenance.mu.RUnlock()
+		if stateFunc == nil {
+			c.Next()
+			return
+		}
+		state := stateFunc()
+		if !state.Enabled || maintenanceExempt(c.Request.URL.Path) || (bypass != nil && bypass(c)) {
+			c.Next()
+			return
+		}
+
+		if state.EndsAt != nil {
+			if wait := time.Until(*state.EndsAt); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+		}
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			message := state.Message
+			if message == "" {
+				message = "Service under maintenance"
+			}
+			ServiceUnavailable(c, message)
+			c.Abort()
+			return
+		}
+
+		RenderWithOptions(c, "maintenance.html", gin.H{
+			"Message": state.Message,
+			"EndsAt":  state.EndsAt,
+		}, RenderOptions{StatusCode: http.StatusServiceUnavailable})
+		c.Abort()
+	}
+}
+
+// maintenanceExempt reports whether a path is served during maintenance
+func maintenanceExempt(path string) bool {
+	return strings.HasPrefix(path, "/static/") || path == "/healthz" || path == "/readyz" ||
+		path == "/api/v1/health"
+}
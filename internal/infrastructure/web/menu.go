@@ -0,0 +1,339 @@
+// Package web provides the menu registry for OpenHost navigation.
+// Core modules and addons register client and admin menu items, which
+// templates render with the menus and breadcrumbs functions and SPA
+// frontends load through the API.
+package web
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+)
+
+// Menus
+const (
+	MenuClient = "client"
+	MenuAdmin  = "admin"
+)
+
+// MenuItem is a navigation link registered by a module
+type MenuItem struct {
+	ID      string // Unique within the menu, replaces an item with the same ID
+	Parent  string // ID of the parent item, nests the item and its breadcrumbs
+	Title   string // Translation key of the label
+	URL     string
+	Icon    string
+	Order   int    // Lower comes first
+	Section string // Page section the item is active on, matched against .Section
+	Module  string // Registering module, used to unregister all its items
+
+	// Roles allowed to see the item; empty allows anyone who sees the menu
+	Roles []domain.UserRole
+	// Visible is an optional check for finer permissions
+	Visible func(user *domain.User) bool
+}
+
+// MenuEntry is a menu item resolved for a user
+type MenuEntry struct {
+	ID       string      `json:"id"`
+	Title    string      `json:"title"`
+	Label    string      `json:"label"`
+	URL      string      `json:"url"`
+	Icon     string      `json:"icon,omitempty"`
+	Active   bool        `json:"active"`
+	Children []MenuEntry `json:"children,omitempty"`
+}
+
+// MenuRegistry manages the items of the navigation menus
+type MenuRegistry struct {
+	mu    sync.RWMutex
+	menus map[string][]MenuItem
+}
+
+// DefaultMenuRegistry is the global menu registry
+var DefaultMenuRegistry = NewMenuRegistry()
+
+func init() {
+	registerCoreMenus(DefaultMenuRegistry)
+}
+
+// NewMenuRegistry creates a new, empty menu registry
+func NewMenuRegistry() *MenuRegistry {
+	return &MenuRegistry{menus: make(map[string][]MenuItem)}
+}
+
+// Register adds an item to a menu, replacing an item with the same ID
+func (r *MenuRegistry) Register(menu string, item MenuItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := r.menus[menu]
+	for i, existing := range items {
+		if existing.ID == item.ID {
+			items[i] = item
+			return
+		}
+	}
+	r.menus[menu] = append(items, item)
+}
+
+// Unregister removes an item from a menu
+func (r *MenuRegistry) Unregister(menu, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := r.menus[menu]
+	for i, item := range items {
+		if item.ID == id {
+			r.menus[menu] = append(items[:i], items[i+1:]...)
+			return
+		}
+	}
+}
+
+// UnregisterModule removes the items a module registered in all menus
+func (r *MenuRegistry) UnregisterModule(module string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for menu, items := range r.menus {
+		kept := items[:0]
+		for _, item := range items {
+			if item.Module != module {
+				kept = append(kept, item)
+			}
+		}
+		r.menus[menu] = kept
+	}
+}
+
+// Has reports whether a menu has any registered items
+func (r *MenuRegistry) Has(menu string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.menus[menu]) > 0
+}
+
+// Items returns the items of a menu in display order
+func (r *MenuRegistry) Items(menu string) []MenuItem {
+	r.mu.RLock()
+	items := make([]MenuItem, len(r.menus[menu]))
+	copy(items, r.menus[menu])
+	r.mu.RUnlock()
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Order < items[j].Order
+	})
+	return items
+}
+
+// Resolve returns the items of a menu a user may see as a tree. Items are
+// active when they match the page section, or else when theirs is the
+// longest URL the page path starts with. Parents of active items are
+// active too.
+func (r *MenuRegistry) Resolve(menu string, user *domain.User, section, path string, translate func(string, ...any) string) []MenuEntry {
+	items := r.Items(menu)
+
+	visible := make(map[string]bool, len(items))
+	pathMatch := ""
+	for _, item := range items {
+		visible[item.ID] = canSeeMenuItem(item, user)
+		if visible[item.ID] && matchesMenuPath(item.URL, path) && len(item.URL) > len(pathMatch) {
+			pathMatch = item.URL
+		}
+	}
+
+	var build func(parent string) []MenuEntry
+	build = func(parent string) []MenuEntry {
+		entries := []MenuEntry{}
+		for _, item := range items {
+			if item.Parent != parent || !visible[item.ID] {
+				continue
+			}
+			entry := MenuEntry{
+				ID:     item.ID,
+				Title:  item.Title,
+				Label:  item.Title,
+				URL:    item.URL,
+				Icon:   item.Icon,
+				Active: menuItemActive(item, section, pathMatch),
+			}
+			if translate != nil {
+				entry.Label = translate(item.Title)
+			}
+			entry.Children = build(item.ID)
+			for _, child := range entry.Children {
+				if child.Active {
+					entry.Active = true
+				}
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+	return build("")
+}
+
+// Breadcrumbs returns the trail of items from the top of a menu to the
+// item matching the page section or path
+func (r *MenuRegistry) Breadcrumbs(menu string, user *domain.User, section, path string, translate func(string, ...any) string) []Breadcrumb {
+	return MenuTrail(r.Resolve(menu, user, section, path, translate))
+}
+
+// MenuTrail returns the breadcrumbs of the active entries of a resolved menu
+func MenuTrail(entries []MenuEntry) []Breadcrumb {
+	trail := []Breadcrumb{}
+	for len(entries) > 0 {
+		var active *MenuEntry
+		for i := range entries {
+			if entries[i].Active {
+				active = &entries[i]
+				break
+			}
+		}
+		if active == nil {
+			break
+		}
+		trail = append(trail, Breadcrumb{Title: active.Label, URL: active.URL, Icon: active.Icon})
+		entries = active.Children
+	}
+	return trail
+}
+
+// Global convenience functions
+
+// RegisterMenuItem adds an item to a menu of the default registry
+func RegisterMenuItem(menu string, item MenuItem) {
+	DefaultMenuRegistry.Register(menu, item)
+}
+
+// UnregisterMenuModule removes the items of a module from the default
+// registry
+func UnregisterMenuModule(module string) {
+	DefaultMenuRegistry.UnregisterModule(module)
+}
+
+// RequestTranslator returns the translation function for the language of
+// a request, for labels resolved outside of templates
+func RequestTranslator(c *gin.Context) func(string, ...any) string {
+	return defaultRenderer.RequestTranslator(c)
+}
+
+// RequestTranslator returns the translation function for the language of
+// a request, for labels resolved outside of templates
+func (r *Renderer) RequestTranslator(c *gin.Context) func(string, ...any) string {
+	return r.i18nManager.GetTranslator(r.getLanguage(c)).T
+}
+
+// menus is the template function rendering a menu for the current page
+func (r *Renderer) menus(menu string, data any) []MenuEntry {
+	user, section, path, lang := menuContext(data)
+	translate := r.i18nManager.GetTranslator(lang).T
+	return DefaultMenuRegistry.Resolve(menu, user, section, path, translate)
+}
+
+// breadcrumbs is the template function returning the breadcrumbs of the
+// current page. Breadcrumbs set by the handler take precedence over the
+// ones derived from the menu.
+func (r *Renderer) breadcrumbs(menu string, data any) []Breadcrumb {
+	if values, ok := data.(gin.H); ok {
+		if set, ok := values["Breadcrumbs"].([]Breadcrumb); ok && len(set) > 0 {
+			return set
+		}
+	}
+	user, section, path, lang := menuContext(data)
+	translate := r.i18nManager.GetTranslator(lang).T
+	return DefaultMenuRegistry.Breadcrumbs(menu, user, section, path, translate)
+}
+
+// menuContext reads the user, section, path and language of the page
+// from template data
+func menuContext(data any) (*domain.User, string, string, string) {
+	values, ok := data.(gin.H)
+	if !ok {
+		return nil, "", "", ""
+	}
+	user, _ := values["User"].(*domain.User)
+	section, _ := values["Section"].(string)
+	lang, _ := values["Lang"].(string)
+	var path string
+	if request, ok := values["Request"].(gin.H); ok {
+		path, _ = request["Path"].(string)
+	}
+	return user, section, path, lang
+}
+
+func canSeeMenuItem(item MenuItem, user *domain.User) bool {
+	if len(item.Roles) > 0 {
+		if user == nil {
+			return false
+		}
+		allowed := false
+		for _, role := range item.Roles {
+			if user.Role == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return item.Visible == nil || item.Visible(user)
+}
+
+func menuItemActive(item MenuItem, section, pathMatch string) bool {
+	if section != "" && item.Section != "" {
+		return item.Section == section
+	}
+	return pathMatch != "" && item.URL == pathMatch
+}
+
+func matchesMenuPath(url, path string) bool {
+	if path == "" || url == "" {
+		return false
+	}
+	return path == url || strings.HasPrefix(path, strings.TrimSuffix(url, "/")+"/")
+}
+
+// registerCoreMenus registers the menu items of the core modules. The
+// pages check access themselves, so core items have no role requirement.
+func registerCoreMenus(r *MenuRegistry) {
+	client := []MenuItem{
+		{ID: "dashboard", Title: "client.dashboard.title", URL: "/client", Section: "dashboard"},
+		{ID: "services", Title: "client.services.title", URL: "/client/services", Section: "services"},
+		{ID: "invoices", Title: "client.invoices.title", URL: "/client/invoices", Section: "invoices"},
+		{ID: "tickets", Title: "client.tickets.title", URL: "/client/tickets", Section: "tickets"},
+		{ID: "profile", Title: "client.profile.title", URL: "/client/profile", Section: "profile"},
+		{ID: "affiliates", Title: "client.affiliates.title", URL: "/client/affiliates", Section: "affiliates"},
+		{ID: "domains", Title: "client.domains.title", URL: "/client/domains", Section: "domains"},
+		{ID: "subusers", Title: "client.subusers.title", URL: "/client/subusers", Section: "subusers"},
+		{ID: "security", Title: "client.security.title", URL: "/client/security", Section: "security"},
+	}
+	for i, item := range client {
+		item.Order = (i + 1) * 10
+		item.Module = "core"
+		r.Register(MenuClient, item)
+	}
+
+	admin := []MenuItem{
+		{ID: "dashboard", Title: "admin.dashboard.title", URL: "/admin", Section: "dashboard"},
+		{ID: "customers", Title: "admin.customers.title", URL: "/admin/customers", Section: "customers"},
+		{ID: "orders", Title: "admin.orders.title", URL: "/admin/orders", Section: "orders"},
+		{ID: "services", Title: "admin.services.title", URL: "/admin/services", Section: "services"},
+		{ID: "invoices", Title: "admin.invoices.title", URL: "/admin/invoices", Section: "invoices"},
+		{ID: "tickets", Title: "admin.tickets.title", URL: "/admin/tickets", Section: "tickets"},
+		{ID: "products", Title: "admin.products.title", URL: "/admin/products", Section: "products"},
+		{ID: "servers", Title: "admin.servers.title", URL: "/admin/servers", Section: "servers"},
+		{ID: "settings", Title: "admin.settings.title", URL: "/admin/settings", Section: "settings"},
+	}
+	for i, item := range admin {
+		item.Order = (i + 1) * 10
+		item.Module = "core"
+		r.Register(MenuAdmin, item)
+	}
+}
@@ -9,14 +9,20 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/openhost/openhost/internal/core/domain"
+	"github.com/openhost/openhost/internal/infrastructure/database"
 )
 
-// LanguageMiddleware detects and sets the user's preferred language
+// LanguageMiddleware detects and sets the user's preferred language: the
+// one they picked, the one of their browser, or the one of the country
+// GeoIPMiddleware located them in
 func LanguageMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check query parameter first (allows switching)
 		if lang := c.Query("lang"); lang != "" {
 			c.Set(ContextLangKey, lang)
+			c.Set(ContextLangSourceKey, SourceUser)
 			// Set cookie for persistence
 			c.SetCookie("lang", lang, 86400*365, "/", "", false, false)
 			c.Next()
@@ -26,6 +32,7 @@ func LanguageMiddleware() gin.HandlerFunc {
 		// Check cookie
 		if lang, err := c.Cookie("lang"); err == nil && lang != "" {
 			c.Set(ContextLangKey, lang)
+			c.Set(ContextLangSourceKey, SourceUser)
 			c.Next()
 			return
 		}
@@ -36,18 +43,29 @@ func LanguageMiddleware() gin.HandlerFunc {
 			if len(acceptLang) >= 2 {
 				lang := strings.ToLower(acceptLang[:2])
 				c.Set(ContextLangKey, lang)
+				c.Set(ContextLangSourceKey, SourceBrowser)
 				c.Next()
 				return
 			}
 		}
 
+		if lang := geoLanguage(c); lang != "" {
+			c.Set(ContextLangKey, lang)
+			c.Set(ContextLangSourceKey, SourceGeoIP)
+			c.Next()
+			return
+		}
+
 		// Default to English
 		c.Set(ContextLangKey, "en")
+		c.Set(ContextLangSourceKey, SourceDefault)
 		c.Next()
 	}
 }
 
-// ThemeMiddleware sets the active theme based on query parameter or config
+// ThemeMiddleware sets the active theme based on query parameter or config,
+// and the preferences of the user when one is already signed in. Session
+// middleware running later applies them with ApplyUserPreferences.
 func ThemeMiddleware(defaultTheme string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		theme := defaultTheme
@@ -60,33 +78,91 @@ func ThemeMiddleware(defaultTheme string) gin.HandlerFunc {
 		}
 
 		c.Set(ContextThemeKey, theme)
+		if user, ok := c.Get(ContextUserKey); ok {
+			if u, ok := user.(*domain.User); ok {
+				ApplyUserPreferences(c, u)
+			}
+		}
 		c.Next()
 	}
 }
 
-// CurrencyMiddleware sets the user's currency preference
+// ApplyUserPreferences sets the appearance, theme, time zone and currency a
+// signed in user chose, once the middleware loading the user found them.
+// Customers always see the currency they are billed in. A theme preview
+// through the query string still wins, and themes users may no longer
+// choose are ignored.
+func ApplyUserPreferences(c *gin.Context, user *domain.User) {
+	if user == nil {
+		return
+	}
+	appearance := user.Appearance
+	if !appearance.Valid() {
+		appearance = domain.AppearanceAuto
+	}
+	c.Set(ContextAppearanceKey, string(appearance))
+	c.Set(ContextTimezoneKey, user.Location())
+	if user.Currency != "" {
+		c.Set(ContextCurrencyKey, strings.ToUpper(user.Currency))
+		c.Set(ContextCurrencySourceKey, SourceProfile)
+	}
+
+	if user.Theme != "" && c.Query("theme") == "" && DefaultThemeManager.IsUserSelectable(user.Theme) {
+		c.Set(ContextThemeKey, user.Theme)
+	}
+}
+
+// UserLocation returns the time zone of the signed in user, or the server
+// time zone for visitors
+func UserLocation(c *gin.Context) *time.Location {
+	if loc, ok := contextValue(c, ContextTimezoneKey).(*time.Location); ok && loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+// CurrencyMiddleware sets the user's currency preference: the one they
+// picked, or the one of the country GeoIPMiddleware located them in when
+// it is on sale
 func CurrencyMiddleware(defaultCurrency string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		currency := defaultCurrency
+		source := SourceDefault
 
 		// Check query parameter
 		if curr := c.Query("currency"); curr != "" {
 			currency = strings.ToUpper(curr)
+			source = SourceUser
 			c.SetCookie("currency", currency, 86400*365, "/", "", false, false)
 		} else if curr, err := c.Cookie("currency"); err == nil && curr != "" {
 			currency = curr
+			source = SourceUser
+		} else if curr := geoCurrency(c); curr != "" {
+			currency = curr
+			source = SourceGeoIP
 		}
 
 		c.Set(ContextCurrencyKey, currency)
+		c.Set(ContextCurrencySourceKey, source)
 		c.Next()
 	}
 }
 
-// SecurityHeaders adds common security headers to responses
+// SecurityHeaders adds common security headers to responses. The
+// Content-Security-Policy, HSTS and frame options are set with
+// SetSecurityHeaders; pages add those of their theme when rendered.
 func SecurityHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Prevent clickjacking
-		c.Header("X-Frame-Options", "SAMEORIGIN")
+		// Inline scripts of the page run with the nonce of the request
+		if nonce := newCSPNonce(); nonce != "" {
+			c.Set(ContextCSPNonceKey, nonce)
+		}
+		// Prevent clickjacking and restrict what pages load
+		applySecurityHeaders(c, nil)
+
+		if hsts := hstsHeader(); hsts != "" && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			c.Header("Strict-Transport-Security", hsts)
+		}
 
 		// Prevent MIME type sniffing
 		c.Header("X-Content-Type-Options", "nosniff")
@@ -166,7 +242,9 @@ func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 	}
 }
 
-// RequestIDMiddleware adds a unique request ID to each request
+// RequestIDMiddleware adds a unique request ID to each request. It is
+// also set on the request context, so queries run with it are logged
+// with the ID.
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if request ID already exists (e.g., from load balancer)
@@ -176,6 +254,7 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		}
 
 		c.Set("RequestID", requestID)
+		c.Request = c.Request.WithContext(database.WithRequestID(c.Request.Context(), requestID))
 		c.Header("X-Request-ID", requestID)
 		c.Next()
 	}
@@ -234,37 +313,6 @@ func MethodNotAllowedHandler(c *gin.Context) {
 	})
 }
 
-// MaintenanceModeMiddleware shows maintenance page when enabled
-func MaintenanceModeMiddleware(enabled bool, allowedIPs []string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if !enabled {
-			c.Next()
-			return
-		}
-
-		// Check if IP is allowed
-		clientIP := c.ClientIP()
-		for _, ip := range allowedIPs {
-			if ip == clientIP {
-				c.Next()
-				return
-			}
-		}
-
-		// Check if this is an API request
-		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-			ServiceUnavailable(c, "Service under maintenance")
-			return
-		}
-
-		// Render maintenance page
-		c.HTML(http.StatusServiceUnavailable, "maintenance.html", gin.H{
-			"Title": "Under Maintenance",
-		})
-		c.Abort()
-	}
-}
-
 // Helper function to generate request ID
 func generateRequestID() string {
 	// Simple implementation - in production, use UUID
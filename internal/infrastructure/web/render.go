@@ -6,16 +6,18 @@ package web
 import (
 	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/render"
+	"github.com/shopspring/decimal"
 
+	"github.com/openhost/openhost/internal/core/service/money"
 	"github.com/openhost/openhost/internal/infrastructure/i18n"
 )
 
@@ -28,6 +30,8 @@ const (
 	ContextLangKey       = "lang"
 	ContextFlashKey      = "flash"
 	ContextBreadcrumbKey = "breadcrumbs"
+	ContextAppearanceKey = "appearance"
+	ContextTimezoneKey   = "timezone"
 	ContextSiteConfigKey = "site_config"
 )
 
@@ -47,9 +51,9 @@ type Flash struct {
 
 // Breadcrumb represents a navigation breadcrumb
 type Breadcrumb struct {
-	Title string
-	URL   string
-	Icon  string
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Icon  string `json:"icon,omitempty"`
 }
 
 // SiteConfig contains site-wide configuration passed to templates
@@ -75,6 +79,8 @@ type RenderOptions struct {
 	StatusCode  int         // HTTP status code (default 200)
 	ContentType string      // Response content type
 	Headers     http.Header // Additional headers
+	Fragment    bool        // Render only Block, without the layout (implied for HTMX requests)
+	Block       string      // Block rendered as a fragment (default "content")
 }
 
 // Renderer handles template rendering with theme and i18n support
@@ -82,11 +88,14 @@ type Renderer struct {
 	mu            sync.RWMutex
 	theme         string
 	basePath      string
+	fsys          fs.FS
 	providers     []HookProvider
 	i18nManager   *i18n.Manager
 	themeManager  *ThemeManager
 	siteConfig    *SiteConfig
+	money         *money.Service
 	templateCache map[string]*template.Template
+	templateFiles map[string][]string // Files each cached template was parsed from
 	cacheEnabled  bool
 	funcMap       template.FuncMap
 }
@@ -107,11 +116,14 @@ func NewRenderer(theme string, providers ...HookProvider) *Renderer {
 	r := &Renderer{
 		theme:         theme,
 		basePath:      "./themes",
+		fsys:          NewThemeFS("./themes"),
 		providers:     providers,
 		i18nManager:   i18nMgr,
 		themeManager:  DefaultThemeManager,
 		siteConfig:    &SiteConfig{Name: "OpenHost", Tagline: "Modern Hosting Platform"},
+		money:         money.NewService(nil),
 		templateCache: make(map[string]*template.Template),
+		templateFiles: make(map[string][]string),
 		cacheEnabled:  false, // Disable cache by default for development
 	}
 
@@ -125,8 +137,9 @@ func NewRenderer(theme string, providers ...HookProvider) *Renderer {
 func (r *Renderer) initFuncMap() {
 	r.funcMap = template.FuncMap{
 		// Internationalization
-		"t": func(key string, args ...any) string { return key },
-		"T": func(key string, args ...any) string { return key },
+		"t":  func(key string, args ...any) string { return key },
+		"T":  func(key string, args ...any) string { return key },
+		"tn": func(key string, count int, args ...any) string { return key },
 
 		// Template helpers
 		"dict":       templateDict,
@@ -174,10 +187,11 @@ func (r *Renderer) initFuncMap() {
 		"formatTime":     templateFormatTime,
 		"timeAgo":        templateTimeAgo,
 		"now":            time.Now,
+		"inZone":         templateInZone,
 
 		// Number formatting
 		"formatNumber":   templateFormatNumber,
-		"formatCurrency": templateFormatCurrency,
+		"formatCurrency": r.formatCurrency,
 		"formatPercent":  templateFormatPercent,
 		"formatBytes":    templateFormatBytes,
 
@@ -214,6 +228,10 @@ func (r *Renderer) initFuncMap() {
 		// Hook system
 		"hook": r.hook,
 
+		// Navigation
+		"menus":       r.menus,
+		"breadcrumbs": r.breadcrumbs,
+
 		// Debug (only in development)
 		"dump":  templateDump,
 		"debug": templateDebug,
@@ -227,6 +245,54 @@ func (r *Renderer) SetI18nManager(mgr *i18n.Manager) {
 	r.i18nManager = mgr
 }
 
+// I18nManager returns the i18n manager of this renderer
+func (r *Renderer) I18nManager() *i18n.Manager {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.i18nManager
+}
+
+// ReloadTranslations loads the translations again, picking up translation
+// packs changed in the locales directory, and drops the cached templates
+// bound to the old ones
+func (r *Renderer) ReloadTranslations() error {
+	if err := r.I18nManager().Reload(); err != nil {
+		return err
+	}
+	r.ClearTemplateCache()
+	return nil
+}
+
+// SetMoneyService sets the service formatting monetary amounts, so
+// templates use the currencies configured in the database
+func (r *Renderer) SetMoneyService(service *money.Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.money = service
+}
+
+// formatCurrency is the template function formatting an amount of a
+// currency, the default one when none is given, before the language of a
+// page is known
+func (r *Renderer) formatCurrency(n any, currency ...any) string {
+	formatter := r.Money()
+	return formatter.Format(toDecimal(n), currencyCode(formatter, currency), money.DefaultLocale)
+}
+
+// Money returns the service formatting monetary amounts
+func (r *Renderer) Money() *money.Service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.money
+}
+
+// FormatMoney formats an amount of a currency in the language of a
+// request
+func (r *Renderer) FormatMoney(c *gin.Context, amount decimal.Decimal, currency string) string {
+	language := r.i18nManager.GetTranslator(r.getLanguage(c)).Language()
+	return r.Money().Format(amount, currency, moneyLocale(language))
+}
+
 // SetThemeManager sets the theme manager for this renderer
 func (r *Renderer) SetThemeManager(tm *ThemeManager) {
 	r.mu.Lock()
@@ -248,6 +314,7 @@ func (r *Renderer) SetCacheEnabled(enabled bool) {
 	r.cacheEnabled = enabled
 	if !enabled {
 		r.templateCache = make(map[string]*template.Template)
+		r.templateFiles = make(map[string][]string)
 	}
 }
 
@@ -311,6 +378,11 @@ func (r *Renderer) RenderWithOptions(c *gin.Context, templateName string, data g
 	// Inject context values
 	r.injectContextData(c, data)
 
+	// HTMX requests already show the layout and only swap the page block
+	fragment := opts.Fragment || IsHTMXRequest(c)
+	data["HTMX"] = fragment
+	c.Header("Vary", HeaderHXRequest)
+
 	// Get language and translator
 	lang := r.getLanguage(c)
 	data["Lang"] = lang
@@ -318,6 +390,8 @@ func (r *Renderer) RenderWithOptions(c *gin.Context, templateName string, data g
 
 	translator := r.i18nManager.GetTranslator(lang)
 	data["T"] = translator.Func()
+	data["Dir"] = translator.Language().Dir()
+	data["RTL"] = translator.Language().IsRTL()
 
 	// Get active theme
 	activeTheme := r.getActiveTheme(c)
@@ -329,6 +403,7 @@ func (r *Renderer) RenderWithOptions(c *gin.Context, templateName string, data g
 		themeConfig, _ = r.themeManager.GetTheme(r.themeManager.GetFallbackTheme())
 	}
 	data["ThemeConfig"] = themeConfig
+	applySecurityHeaders(c, themeConfig)
 
 	// Set site configuration
 	data["Site"] = r.siteConfig
@@ -349,9 +424,6 @@ func (r *Renderer) RenderWithOptions(c *gin.Context, templateName string, data g
 		return
 	}
 
-	// Determine which template to execute
-	execName := r.determineExecName(activeTheme, templateName, opts.Layout)
-
 	// Set custom headers
 	for key, values := range opts.Headers {
 		for _, value := range values {
@@ -359,6 +431,14 @@ func (r *Renderer) RenderWithOptions(c *gin.Context, templateName string, data g
 		}
 	}
 
+	if fragment {
+		r.renderFragment(c, tmpl, statusCode, opts.Block, data)
+		return
+	}
+
+	// Determine which template to execute
+	execName := r.determineExecName(activeTheme, templateName, opts.Layout)
+
 	// Render the template
 	c.Render(statusCode, render.HTML{
 		Template: tmpl,
@@ -384,7 +464,11 @@ func (r *Renderer) inferLayout(templateName string) string {
 func (r *Renderer) injectContextData(c *gin.Context, data gin.H) {
 	data["User"] = contextValue(c, ContextUserKey)
 	data["CSRFToken"] = contextValue(c, ContextCSRFKey)
+	data["CSPNonce"] = CSPNonce(c)
 	data["Currency"] = contextValue(c, ContextCurrencyKey)
+	data["Appearance"] = contextValue(c, ContextAppearanceKey)
+	data["Location"] = UserLocation(c)
+	data["Feature"] = func(key string) bool { return FeatureEnabled(c, key) }
 
 	// Flash messages
 	if flash := contextValue(c, ContextFlashKey); flash != nil {
@@ -474,8 +558,7 @@ func (r *Renderer) loadTemplates(theme, templateName string, translator *i18n.Tr
 		r.mu.RUnlock()
 	}
 
-	themeDir := filepath.Join(r.basePath, theme)
-	files, err := r.resolveTemplateFiles(themeDir, templateName, layout)
+	files, err := r.resolveTemplateFiles(theme, templateName, layout)
 	if err != nil {
 		return nil, err
 	}
@@ -485,10 +568,11 @@ func (r *Renderer) loadTemplates(theme, templateName string, translator *i18n.Tr
 	for k, v := range r.funcMap {
 		funcMap[k] = v
 	}
-	funcMap["t"] = translator.T
-	funcMap["T"] = translator.T
+	for k, v := range translatorFuncs(translator, r.money) {
+		funcMap[k] = v
+	}
 
-	tmpl, err := template.New("templates").Funcs(funcMap).ParseFiles(files...)
+	tmpl, err := template.New("templates").Funcs(funcMap).ParseFS(r.fsys, files...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse templates: %w", err)
 	}
@@ -497,51 +581,35 @@ func (r *Renderer) loadTemplates(theme, templateName string, translator *i18n.Tr
 	if r.cacheEnabled {
 		r.mu.Lock()
 		r.templateCache[cacheKey] = tmpl
+		r.templateFiles[cacheKey] = files
 		r.mu.Unlock()
 	}
 
 	return tmpl, nil
 }
 
-// resolveTemplateFiles determines which template files to load
-func (r *Renderer) resolveTemplateFiles(themeDir, templateName, layout string) ([]string, error) {
+// resolveTemplateFiles determines which template files to load. Files the
+// theme does not have are taken from its parent themes.
+func (r *Renderer) resolveTemplateFiles(theme, templateName, layout string) ([]string, error) {
 	var files []string
+	chain := r.themeManager.ThemeChain(theme)
 
-	// Add layout file based on type
-	layoutFile := "base.html"
-	if layout != "" {
-		layoutFile = layout + ".html"
-	}
-
-	// Check for layout in layouts directory
-	layoutPath := filepath.Join(themeDir, "layouts", layoutFile)
-	if fileExists(layoutPath) {
+	// Add layout file based on type, falling back to base.html
+	if layoutPath, ok := r.findLayout(chain, layout); ok {
 		files = append(files, layoutPath)
-	} else {
-		// Fallback to base.html
-		basePath := filepath.Join(themeDir, "layouts", "base.html")
-		if fileExists(basePath) {
-			files = append(files, basePath)
-		}
 	}
 
-	// Add partials directory if it exists
-	partialsDir := filepath.Join(themeDir, "partials")
-	if dirExists(partialsDir) {
-		partialFiles, _ := filepath.Glob(filepath.Join(partialsDir, "*.html"))
-		files = append(files, partialFiles...)
-	}
+	// Add partials, a child theme's partial replacing the parent's one
+	files = append(files, r.themePartials(chain)...)
 
 	// Add the page template
-	pagePath := filepath.Join(themeDir, "pages", templateName)
-	if fileExists(pagePath) {
+	if pagePath, ok := r.findThemeFile(chain, path.Join("pages", templateName)); ok {
 		files = append(files, pagePath)
 		return files, nil
 	}
 
 	// Try without pages prefix
-	altPath := filepath.Join(themeDir, templateName)
-	if fileExists(altPath) {
+	if altPath, ok := r.findThemeFile(chain, templateName); ok {
 		files = append(files, altPath)
 		return files, nil
 	}
@@ -556,30 +624,70 @@ func (r *Renderer) resolveTemplateFiles(themeDir, templateName, layout string) (
 
 // determineExecName determines which template name to execute
 func (r *Renderer) determineExecName(theme, templateName, layout string) string {
-	themeDir := filepath.Join(r.basePath, theme)
+	if layoutPath, ok := r.findLayout(r.themeManager.ThemeChain(theme), layout); ok {
+		return path.Base(layoutPath)
+	}
+	return templateName
+}
 
-	// Check for layout file
+// findLayout returns the layout file of the nearest theme in the chain,
+// or its base.html when no theme has the layout
+func (r *Renderer) findLayout(chain []string, layout string) (string, bool) {
 	layoutFile := "base.html"
 	if layout != "" {
 		layoutFile = layout + ".html"
 	}
-
-	layoutPath := filepath.Join(themeDir, "layouts", layoutFile)
-	if fileExists(layoutPath) {
-		return layoutFile
+	if layoutPath, ok := r.findThemeFile(chain, path.Join("layouts", layoutFile)); ok {
+		return layoutPath, true
 	}
+	return r.findThemeFile(chain, path.Join("layouts", "base.html"))
+}
 
-	basePath := filepath.Join(themeDir, "layouts", "base.html")
-	if fileExists(basePath) {
-		return "base.html"
+// findThemeFile returns a file of the nearest theme in the chain that has it
+func (r *Renderer) findThemeFile(chain []string, name string) (string, bool) {
+	for _, theme := range chain {
+		file := path.Join(theme, name)
+		if r.fileExists(file) {
+			return file, true
+		}
 	}
+	return "", false
+}
 
-	return templateName
+// themePartials returns the partials of a theme chain, parents first so
+// that a child's definitions are parsed last and win
+func (r *Renderer) themePartials(chain []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, theme := range chain {
+		partialsDir := path.Join(theme, "partials")
+		if !r.dirExists(partialsDir) {
+			continue
+		}
+		partialFiles, _ := fs.Glob(r.fsys, path.Join(partialsDir, "*.html"))
+		for i := len(partialFiles) - 1; i >= 0; i-- {
+			if name := path.Base(partialFiles[i]); !seen[name] {
+				seen[name] = true
+				files = append(files, partialFiles[i])
+			}
+		}
+	}
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+	return files
 }
 
-// assetURL returns the full URL for a theme asset
-func (r *Renderer) assetURL(path string) string {
-	return fmt.Sprintf("/static/%s", strings.TrimPrefix(path, "/"))
+// assetURL returns the fingerprinted URL for a theme asset. Assets a
+// child theme does not have are taken from its parent themes.
+func (r *Renderer) assetURL(name string) string {
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)
+	if len(parts) == 2 && r.themeManager.ThemeExists(parts[0]) {
+		if file, ok := r.themeManager.ResolveThemeFile(parts[0], parts[1]); ok {
+			name = file
+		}
+	}
+	return AssetURL(name)
 }
 
 // hook executes registered hook providers and returns combined HTML
@@ -592,7 +700,12 @@ func (r *Renderer) hook(name string, data any) template.HTML {
 		}
 		output.WriteString(html)
 	}
-	return template.HTML(output.String())
+	// Inline scripts of hooks run with the nonce of the page
+	var nonce string
+	if page, ok := data.(gin.H); ok {
+		nonce, _ = page["CSPNonce"].(string)
+	}
+	return template.HTML(addScriptNonce(output.String(), nonce))
 }
 
 // ClearTemplateCache clears the template cache
@@ -600,6 +713,7 @@ func (r *Renderer) ClearTemplateCache() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.templateCache = make(map[string]*template.Template)
+	r.templateFiles = make(map[string][]string)
 }
 
 // Helper functions
@@ -611,16 +725,27 @@ func contextValue(c *gin.Context, key string) any {
 	return nil
 }
 
-func fileExists(path string) bool {
-	info, err := os.Stat(path)
+func (r *Renderer) fileExists(name string) bool {
+	info, err := fs.Stat(r.fsys, name)
 	return err == nil && !info.IsDir()
 }
 
-func dirExists(path string) bool {
-	info, err := os.Stat(path)
+func (r *Renderer) dirExists(name string) bool {
+	info, err := fs.Stat(r.fsys, name)
 	return err == nil && info.IsDir()
 }
 
+// Money returns the money service of the default renderer
+func Money() *money.Service {
+	return defaultRenderer.Money()
+}
+
+// FormatMoney formats an amount of a currency in the language of a
+// request, using the default renderer
+func FormatMoney(c *gin.Context, amount decimal.Decimal, currency string) string {
+	return defaultRenderer.FormatMoney(c, amount, currency)
+}
+
 // SetFlash sets a flash message in the context
 func SetFlash(c *gin.Context, flashType, message string) {
 	c.Set(ContextFlashKey, &Flash{Type: flashType, Message: message})
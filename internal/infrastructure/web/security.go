@@ -0,0 +1,232 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextCSPNonceKey holds the nonce inline scripts of a page run with
+const ContextCSPNonceKey = "csp_nonce"
+
+// SecurityOptions configures the security headers SecurityHeaders sends
+type SecurityOptions struct {
+	CSP                   map[string][]string // Directives replacing the built-in ones, an empty list removing one
+	CSPDisabled           bool
+	CSPReportOnly         bool // Report violations without blocking
+	HSTSMaxAge            int  // Seconds, 0 for no Strict-Transport-Security
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	FrameOptions          string // DENY, SAMEORIGIN or "off"; themes may set it when empty
+}
+
+// cspDirective is a Content-Security-Policy directive and its sources
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// defaultCSP is the built-in policy. It allows the Google Fonts the
+// default theme uses and images and embedded videos over HTTPS; inline
+// scripts need the nonce of the page.
+var defaultCSP = []cspDirective{
+	{"default-src", []string{"'self'"}},
+	{"script-src", []string{"'self'"}},
+	{"style-src", []string{"'self'", "'unsafe-inline'", "https://fonts.googleapis.com"}},
+	{"img-src", []string{"'self'", "data:", "https:"}},
+	{"font-src", []string{"'self'", "https://fonts.gstatic.com"}},
+	{"connect-src", []string{"'self'"}},
+	{"frame-src", []string{"'self'", "https:"}},
+	{"object-src", []string{"'none'"}},
+	{"base-uri", []string{"'self'"}},
+}
+
+var security struct {
+	mu      sync.RWMutex
+	options SecurityOptions
+	policy  []cspDirective // defaultCSP with the configured directives
+}
+
+func init() {
+	SetSecurityHeaders(SecurityOptions{})
+}
+
+// SetSecurityHeaders sets the security headers SecurityHeaders sends
+func SetSecurityHeaders(options SecurityOptions) {
+	policy := make([]cspDirective, 0, len(defaultCSP)+len(options.CSP))
+	for _, directive := range defaultCSP {
+		if sources, ok := options.CSP[directive.name]; ok {
+			directive.sources = sources
+		}
+		if len(directive.sources) > 0 {
+			policy = append(policy, directive)
+		}
+	}
+	var added []string
+	for name, sources := range options.CSP {
+		if len(sources) > 0 && !hasDirective(defaultCSP, name) {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		policy = append(policy, cspDirective{name: name, sources: options.CSP[name]})
+	}
+
+	security.mu.Lock()
+	defer security.mu.Unlock()
+	security.options = options
+	security.policy = policy
+}
+
+// CSPNonce returns the nonce inline scripts of the page need, as in
+// <script nonce="{{ .CSPNonce }}">, or "" without a policy
+func CSPNonce(c *gin.Context) string {
+	nonce, _ := contextValue(c, ContextCSPNonceKey).(string)
+	return nonce
+}
+
+// applySecurityHeaders sets the Content-Security-Policy and
+// X-Frame-Options of a response, adding the sources and frame options of
+// the theme of a page
+func applySecurityHeaders(c *gin.Context, theme *ThemeConfig) {
+	security.mu.RLock()
+	options, policy := security.options, security.policy
+	security.mu.RUnlock()
+
+	frameOptions := options.FrameOptions
+	if frameOptions == "" && theme != nil {
+		frameOptions = theme.Security.FrameOptions
+	}
+	switch strings.ToUpper(frameOptions) {
+	case "":
+		c.Header("X-Frame-Options", "SAMEORIGIN")
+	case "OFF":
+		c.Writer.Header().Del("X-Frame-Options")
+	default:
+		c.Header("X-Frame-Options", strings.ToUpper(frameOptions))
+	}
+
+	if options.CSPDisabled {
+		return
+	}
+	var themeCSP map[string][]string
+	if theme != nil {
+		themeCSP = theme.Security.CSP
+	}
+	header := "Content-Security-Policy"
+	if options.CSPReportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+	c.Header(header, buildCSP(policy, themeCSP, CSPNonce(c)))
+}
+
+// buildCSP formats a policy with the sources a theme adds and the nonce
+// of the page
+func buildCSP(policy []cspDirective, themeCSP map[string][]string, nonce string) string {
+	directives := make([]cspDirective, len(policy))
+	copy(directives, policy)
+	var added []string
+	for name := range themeCSP {
+		if !hasDirective(directives, name) {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		directives = append(directives, cspDirective{name: name})
+	}
+
+	parts := make([]string, 0, len(directives))
+	for _, directive := range directives {
+		sources := append([]string{}, directive.sources...)
+		for _, source := range themeCSP[directive.name] {
+			if !containsString(sources, source) {
+				sources = append(sources, source)
+			}
+		}
+		if directive.name == "script-src" && nonce != "" {
+			sources = append(sources, "'nonce-"+nonce+"'")
+		}
+		if len(sources) == 0 {
+			parts = append(parts, directive.name)
+			continue
+		}
+		parts = append(parts, directive.name+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// newCSPNonce returns a random nonce, or "" when the policy is off
+func newCSPNonce() string {
+	security.mu.RLock()
+	disabled := security.options.CSPDisabled
+	security.mu.RUnlock()
+	if disabled {
+		return ""
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// hstsHeader returns the Strict-Transport-Security value, or "" when off
+func hstsHeader() string {
+	security.mu.RLock()
+	options := security.options
+	security.mu.RUnlock()
+	if options.HSTSMaxAge <= 0 {
+		return ""
+	}
+	value := "max-age=" + strconv.Itoa(options.HSTSMaxAge)
+	if options.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if options.HSTSPreload {
+		value += "; preload"
+	}
+	return value
+}
+
+// scriptTag matches opening script tags
+var scriptTag = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+
+// addScriptNonce adds the nonce to the script tags of HTML that have none,
+// such as the inline scripts plugin hooks inject
+func addScriptNonce(html, nonce string) string {
+	if nonce == "" {
+		return html
+	}
+	return scriptTag.ReplaceAllStringFunc(html, func(tag string) string {
+		if strings.Contains(strings.ToLower(tag), "nonce=") {
+			return tag
+		}
+		return tag[:len("<script")] + ` nonce="` + nonce + `"` + tag[len("<script"):]
+	})
+}
+
+func hasDirective(directives []cspDirective, name string) bool {
+	for _, directive := range directives {
+		if directive.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
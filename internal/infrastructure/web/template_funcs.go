@@ -14,6 +14,11 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/openhost/openhost/internal/core/service/money"
+	"github.com/openhost/openhost/internal/infrastructure/i18n"
 )
 
 // templateDict creates a map from alternating key-value pairs
@@ -196,6 +201,23 @@ func templateFormatTime(t time.Time, format ...string) string {
 	return t.Format(f)
 }
 
+// templateInZone converts a time to a time zone, given as a location like
+// the .Location of a page or as an IANA name. Unknown zones leave the time
+// unchanged.
+func templateInZone(t time.Time, zone any) time.Time {
+	switch z := zone.(type) {
+	case *time.Location:
+		if z != nil {
+			return t.In(z)
+		}
+	case string:
+		if loc, err := time.LoadLocation(z); err == nil && z != "" {
+			return t.In(loc)
+		}
+	}
+	return t
+}
+
 // templateTimeAgo returns a human-readable time difference
 func templateTimeAgo(t time.Time) string {
 	diff := time.Since(t)
@@ -273,13 +295,70 @@ func templateFormatNumber(n any, decimals ...int) string {
 	return result.String()
 }
 
-// templateFormatCurrency formats a number as currency
-func templateFormatCurrency(n any, symbol ...string) string {
-	sym := "¥"
-	if len(symbol) > 0 {
-		sym = symbol[0]
+// translatorFuncs returns the template functions bound to the language of
+// a page: translation, plural forms, and date, number and money formatting
+// in the formats of the language. Explicit date layouts take precedence.
+func translatorFuncs(translator *i18n.Translator, formatter *money.Service) template.FuncMap {
+	formatNumber := func(n any, decimals ...int) string {
+		dec := 0
+		if len(decimals) > 0 {
+			dec = decimals[0]
+		}
+		return translator.FormatNumber(toFloat64(n), dec)
+	}
+
+	return template.FuncMap{
+		"t":  translator.T,
+		"T":  translator.T,
+		"tn": translator.Plural,
+
+		"formatDate": func(t time.Time, format ...string) string {
+			if len(format) > 0 {
+				return t.Format(format[0])
+			}
+			return translator.FormatDate(t)
+		},
+		"formatDateTime": func(t time.Time, format ...string) string {
+			if len(format) > 0 {
+				return t.Format(format[0])
+			}
+			return translator.FormatDateTime(t)
+		},
+		"formatTime": func(t time.Time, format ...string) string {
+			if len(format) > 0 {
+				return t.Format(format[0])
+			}
+			return translator.FormatTime(t)
+		},
+
+		"formatNumber": formatNumber,
+		"formatCurrency": func(n any, currency ...any) string {
+			return formatter.Format(toDecimal(n), currencyCode(formatter, currency), moneyLocale(translator.Language()))
+		},
+		"formatPercent": func(n any, decimals ...int) string {
+			return formatNumber(toFloat64(n)*100, decimals...) + "%"
+		},
+	}
+}
+
+// currencyCode returns the currency passed to a template function, or the
+// default currency when none or an empty one is passed
+func currencyCode(formatter *money.Service, currency []any) string {
+	if len(currency) > 0 {
+		if code, ok := currency[0].(string); ok && code != "" {
+			return code
+		}
+	}
+	return formatter.DefaultCurrency()
+}
+
+// moneyLocale returns the money format of a language
+func moneyLocale(language *i18n.Language) money.Locale {
+	return money.Locale{
+		DecimalSeparator: language.DecimalSeparator,
+		GroupSeparator:   language.GroupSeparator,
+		Pattern:          language.CurrencyFormat,
 	}
-	return sym + templateFormatNumber(n, 2)
 }
 
 // templateFormatPercent formats a number as a percentage
@@ -611,6 +690,9 @@ func toFloat64(v any) float64 {
 		return float64(n)
 	case float64:
 		return n
+	case decimal.Decimal:
+		f, _ := n.Float64()
+		return f
 	case string:
 		var f float64
 		fmt.Sscanf(n, "%f", &f)
@@ -620,6 +702,26 @@ func toFloat64(v any) float64 {
 	}
 }
 
+// toDecimal converts a value to an exact decimal
+func toDecimal(v any) decimal.Decimal {
+	switch val := v.(type) {
+	case decimal.Decimal:
+		return val
+	case *decimal.Decimal:
+		if val != nil {
+			return *val
+		}
+		return decimal.Zero
+	case string:
+		if d, err := decimal.NewFromString(val); err == nil {
+			return d
+		}
+		return decimal.Zero
+	default:
+		return decimal.NewFromFloat(toFloat64(v))
+	}
+}
+
 func toInt(v any) int {
 	return int(math.Round(toFloat64(v)))
 }
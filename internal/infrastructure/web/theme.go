@@ -5,8 +5,10 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
 	"sync"
 )
@@ -22,6 +24,8 @@ type ThemeConfig struct {
 	License            string            `json:"license"`
 	Screenshot         string            `json:"screenshot"`
 	Type               string            `json:"type"` // "public", "admin", "both"
+	Parent             string            `json:"parent,omitempty"` // Theme to inherit missing files from
+	UserSelectable     bool              `json:"user_selectable"`  // Users may choose it as their theme
 	MinOpenHostVersion string            `json:"min_openhost_version"`
 	Supports           ThemeSupports     `json:"supports"`
 	Settings           ThemeSettings     `json:"settings"`
@@ -29,6 +33,7 @@ type ThemeConfig struct {
 	Pages              map[string]string `json:"pages"`
 	Assets             ThemeAssets       `json:"assets"`
 	Hooks              []string          `json:"hooks"`
+	Security           ThemeSecurity     `json:"security"`
 }
 
 // ThemeSupports defines what features the theme supports
@@ -42,6 +47,14 @@ type ThemeSupports struct {
 	ColorSchemes bool `json:"color_schemes"`
 }
 
+// ThemeSecurity loosens the security headers for the pages of the theme,
+// such as to load fonts or scripts from a CDN. CSP sources are added to
+// the directives of the site policy.
+type ThemeSecurity struct {
+	CSP          map[string][]string `json:"csp"`
+	FrameOptions string              `json:"frame_options"` // Used unless the site sets one
+}
+
 // ThemeSettings contains configurable theme settings
 type ThemeSettings struct {
 	PrimaryColor   string       `json:"primary_color"`
@@ -79,6 +92,7 @@ type ThemeAssets struct {
 type ThemeManager struct {
 	mu         sync.RWMutex
 	basePath   string
+	fsys       fs.FS
 	themes     map[string]*ThemeConfig
 	active     string
 	fallback   string
@@ -91,6 +105,7 @@ var DefaultThemeManager = NewThemeManager("./themes")
 func NewThemeManager(basePath string) *ThemeManager {
 	return &ThemeManager{
 		basePath: basePath,
+		fsys:     NewThemeFS(basePath),
 		themes:   make(map[string]*ThemeConfig),
 		active:   "default",
 		fallback: "default",
@@ -108,11 +123,11 @@ func (tm *ThemeManager) LoadTheme(name string) (*ThemeConfig, error) {
 	}
 
 	// Load theme.json
-	configPath := filepath.Join(tm.basePath, name, "theme.json")
-	data, err := os.ReadFile(configPath)
+	configPath := path.Join(name, "theme.json")
+	data, err := fs.ReadFile(tm.fsys, configPath)
 	if err != nil {
 		// If theme.json doesn't exist, create default config
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			config := tm.createDefaultConfig(name)
 			tm.themes[name] = config
 			return config, nil
@@ -186,11 +201,66 @@ func (tm *ThemeManager) GetTheme(name string) (*ThemeConfig, error) {
 	return tm.LoadTheme(name)
 }
 
+// ThemeChain returns a theme followed by its parent themes, nearest first.
+// A missing parent or a cycle ends the chain.
+func (tm *ThemeManager) ThemeChain(name string) []string {
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+	for {
+		config, err := tm.GetTheme(name)
+		if err != nil || config.Parent == "" || seen[config.Parent] || !tm.ThemeExists(config.Parent) {
+			return chain
+		}
+		name = config.Parent
+		seen[name] = true
+		chain = append(chain, name)
+	}
+}
+
+// ResolveThemeFile returns the path of a theme file, relative to the
+// themes directory, from the nearest theme in the chain that has it
+func (tm *ThemeManager) ResolveThemeFile(theme, name string) (string, bool) {
+	for _, t := range tm.ThemeChain(theme) {
+		file := path.Join(t, name)
+		if info, err := fs.Stat(tm.fsys, file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// IsUserSelectable reports whether users may choose a theme as their own:
+// the active theme and themes marked user_selectable
+func (tm *ThemeManager) IsUserSelectable(name string) bool {
+	if !tm.ThemeExists(name) {
+		return false
+	}
+	if name == tm.GetActiveTheme() {
+		return true
+	}
+	config, err := tm.GetTheme(name)
+	return err == nil && config.UserSelectable
+}
+
+// UserSelectableThemes returns the themes users may choose
+func (tm *ThemeManager) UserSelectableThemes() []string {
+	names, err := tm.ListThemes()
+	if err != nil {
+		return nil
+	}
+	var themes []string
+	for _, name := range names {
+		if tm.IsUserSelectable(name) {
+			themes = append(themes, name)
+		}
+	}
+	return themes
+}
+
 // SetActiveTheme sets the currently active theme
 func (tm *ThemeManager) SetActiveTheme(name string) error {
 	// Verify theme exists
-	themePath := filepath.Join(tm.basePath, name)
-	if _, err := os.Stat(themePath); os.IsNotExist(err) {
+	if !tm.ThemeExists(name) {
 		return fmt.Errorf("theme '%s' does not exist", name)
 	}
 
@@ -226,7 +296,7 @@ func (tm *ThemeManager) GetFallbackTheme() string {
 
 // ListThemes returns all available themes
 func (tm *ThemeManager) ListThemes() ([]string, error) {
-	entries, err := os.ReadDir(tm.basePath)
+	entries, err := fs.ReadDir(tm.fsys, ".")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read themes directory: %w", err)
 	}
@@ -247,8 +317,7 @@ func (tm *ThemeManager) GetThemeAssetPath(themeName, assetPath string) string {
 
 // ThemeExists checks if a theme exists
 func (tm *ThemeManager) ThemeExists(name string) bool {
-	themePath := filepath.Join(tm.basePath, name)
-	info, err := os.Stat(themePath)
+	info, err := fs.Stat(tm.fsys, name)
 	return err == nil && info.IsDir()
 }
 
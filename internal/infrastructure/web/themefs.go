@@ -0,0 +1,72 @@
+// Package web provides the theme file system for OpenHost.
+// Theme files are read from the themes directory when present and from
+// the theme embedded in the binary otherwise.
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/openhost/openhost/themes"
+)
+
+// NewThemeFS returns the themes in dir, falling back to the embedded
+// default theme for files dir does not have
+func NewThemeFS(dir string) fs.FS {
+	return NewOverlayFS(os.DirFS(dir), themes.FS)
+}
+
+// OverlayFS reads each file from the first layer that has it. Directory
+// listings merge the entries of all layers.
+type OverlayFS struct {
+	layers []fs.FS
+}
+
+// NewOverlayFS creates an overlay of layers, the first taking precedence
+func NewOverlayFS(layers ...fs.FS) *OverlayFS {
+	return &OverlayFS{layers: layers}
+}
+
+// Open opens a file from the first layer that has it
+func (o *OverlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o.layers {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir lists a directory of all layers, sorted by name
+func (o *OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	found := false
+	for _, layer := range o.layers {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
@@ -0,0 +1,159 @@
+// Package web provides template cache invalidation for OpenHost themes.
+// A file system watcher drops the cached templates a changed theme file
+// was parsed into, so caching can stay on while themes are edited.
+package web
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchTemplates watches the themes directory of the default renderer
+func WatchTemplates(ctx context.Context) error {
+	return defaultRenderer.WatchTemplates(ctx)
+}
+
+// WatchTemplates watches the themes directory and invalidates the cached
+// templates affected by each change until the context is done. Edits drop
+// the templates parsed from the file; added, removed or renamed files drop
+// every template of the theme, since they change which files are parsed.
+func (r *Renderer) WatchTemplates(ctx context.Context) error {
+	// Without a themes directory only the embedded theme is used, which
+	// never changes
+	if _, err := os.Stat(r.basePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create template watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watchDirs(watcher, r.basePath); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			r.handleTemplateEvent(watcher, event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("template watcher: %v", err)
+		}
+	}
+}
+
+// InvalidateTemplateFile drops the cached templates parsed from a theme
+// file, named relative to the themes directory (e.g.
+// "default/partials/flash.html"), and returns how many were dropped
+func (r *Renderer) InvalidateTemplateFile(name string) int {
+	name = filepath.ToSlash(name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dropped := 0
+	for key, files := range r.templateFiles {
+		for _, file := range files {
+			if file == name {
+				delete(r.templateCache, key)
+				delete(r.templateFiles, key)
+				dropped++
+				break
+			}
+		}
+	}
+	return dropped
+}
+
+// InvalidateTheme drops the cached templates of a theme, and those of its
+// child themes that use its files, and returns how many were dropped
+func (r *Renderer) InvalidateTheme(theme string) int {
+	prefix := theme + ":"
+	dir := theme + "/"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dropped := 0
+	for key, files := range r.templateFiles {
+		drop := strings.HasPrefix(key, prefix)
+		for _, file := range files {
+			if drop || strings.HasPrefix(file, dir) {
+				drop = true
+				break
+			}
+		}
+		if drop {
+			delete(r.templateCache, key)
+			delete(r.templateFiles, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+func (r *Renderer) handleTemplateEvent(watcher *fsnotify.Watcher, event fsnotify.Event) {
+	rel, err := filepath.Rel(r.basePath, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	theme := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+
+	// A changed theme.json may name another parent theme
+	if filepath.Base(rel) == "theme.json" {
+		if _, err := r.themeManager.ReloadTheme(theme); err != nil {
+			log.Printf("template watcher: reload theme %s: %v", theme, err)
+		}
+		// Its child themes change with it
+		r.ClearTemplateCache()
+		return
+	}
+
+	switch {
+	case event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0:
+		// New directories need a watch of their own
+		if event.Op&fsnotify.Create != 0 {
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if err := watchDirs(watcher, event.Name); err != nil {
+					log.Printf("template watcher: %v", err)
+				}
+			}
+		}
+		r.InvalidateTheme(theme)
+	case event.Op&fsnotify.Write != 0:
+		r.InvalidateTemplateFile(rel)
+	}
+}
+
+// watchDirs adds a watch for a directory and all directories below it
+func watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(name); err != nil {
+			return fmt.Errorf("watch %s: %w", name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+// Package testutil provides the database setup shared by the service
+// tests.
+package testutil
+
+import (
+	"fmt"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/openhost/openhost/internal/infrastructure/database"
+)
+
+// OpenDB returns a migrated in-memory SQLite database private to the test.
+// It has a single connection, so transactions see each other's writes as
+// on the primary database.
+func OpenDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", tb.Name())),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	tb.Cleanup(func() { sqlDB.Close() })
+	if err := database.AutoMigrate(db); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// CountQueries counts the queries run on db until the test ends
+func CountQueries(tb testing.TB, db *gorm.DB) *int {
+	tb.Helper()
+	queries := new(int)
+	name := "testutil:count_queries"
+	if err := db.Callback().Query().Before("gorm:query").Register(name, func(*gorm.DB) { *queries++ }); err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register(name, func(*gorm.DB) { *queries++ }); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		db.Callback().Query().Remove(name)
+		db.Callback().Row().Remove(name)
+	})
+	return queries
+}
@@ -0,0 +1,306 @@
+package agentv1
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+type Capacity struct {
+	CpuCores    int32 `json:"cpu_cores,omitempty"`
+	MemoryBytes int64 `json:"memory_bytes,omitempty"`
+	DiskBytes   int64 `json:"disk_bytes,omitempty"`
+}
+
+type Health struct {
+	Load1           float64 `json:"load1,omitempty"`
+	MemoryUsedBytes int64   `json:"memory_used_bytes,omitempty"`
+	DiskUsedBytes   int64   `json:"disk_used_bytes,omitempty"`
+	UptimeSeconds   int64   `json:"uptime_seconds,omitempty"`
+}
+
+type RegisterRequest struct {
+	EnrollmentToken string    `json:"enrollment_token,omitempty"`
+	Hostname        string    `json:"hostname,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	Os              string    `json:"os,omitempty"`
+	Arch            string    `json:"arch,omitempty"`
+	Capacity        *Capacity `json:"capacity,omitempty"`
+}
+
+type RegisterResponse struct {
+	NodeId           uint64 `json:"node_id,omitempty"`
+	NodeToken        string `json:"node_token,omitempty"`
+	SigningKey       string `json:"signing_key,omitempty"`
+	HeartbeatSeconds int32  `json:"heartbeat_seconds,omitempty"`
+}
+
+type HeartbeatRequest struct {
+	Version  string    `json:"version,omitempty"`
+	Capacity *Capacity `json:"capacity,omitempty"`
+	Health   *Health   `json:"health,omitempty"`
+}
+
+type HeartbeatResponse struct {
+	HeartbeatSeconds int32 `json:"heartbeat_seconds,omitempty"`
+}
+
+type TasksRequest struct{}
+
+type Task struct {
+	Id             uint64 `json:"id,omitempty"`
+	NodeId         uint64 `json:"node_id,omitempty"`
+	Action         string `json:"action,omitempty"`
+	Args           []byte `json:"args,omitempty"`
+	IssuedAt       int64  `json:"issued_at,omitempty"`
+	ExpiresAt      int64  `json:"expires_at,omitempty"`
+	TimeoutSeconds int32  `json:"timeout_seconds,omitempty"`
+	Signature      []byte `json:"signature,omitempty"`
+}
+
+// SigningPayload returns the bytes of a task its signature covers: every
+// field but the signature, in a fixed order
+func (t *Task) SigningPayload() []byte {
+	payload, _ := json.Marshal([]interface{}{
+		"openhost-agent-task-v1", t.Id, t.NodeId, t.Action, t.Args, t.IssuedAt, t.ExpiresAt, t.TimeoutSeconds,
+	})
+	return payload
+}
+
+type LogLine struct {
+	Stream string `json:"stream,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Time   int64  `json:"time,omitempty"`
+}
+
+type TaskReport struct {
+	TaskId  uint64     `json:"task_id,omitempty"`
+	Lines   []*LogLine `json:"lines,omitempty"`
+	Done    bool       `json:"done,omitempty"`
+	Success bool       `json:"success,omitempty"`
+	Output  string     `json:"output,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type ReportResponse struct{}
+
+type AgentServiceClient interface {
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	Tasks(ctx context.Context, in *TasksRequest, opts ...grpc.CallOption) (AgentService_TasksClient, error)
+	Report(ctx context.Context, opts ...grpc.CallOption) (AgentService_ReportClient, error)
+}
+
+type agentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentServiceClient(cc grpc.ClientConnInterface) AgentServiceClient {
+	return &agentServiceClient{cc}
+}
+
+func (c *agentServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, "/openhost.agent.v1.AgentService/Register", in, out, withCodec(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, "/openhost.agent.v1.AgentService/Heartbeat", in, out, withCodec(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Tasks(ctx context.Context, in *TasksRequest, opts ...grpc.CallOption) (AgentService_TasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[0], "/openhost.agent.v1.AgentService/Tasks", withCodec(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceTasksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AgentService_TasksClient interface {
+	Recv() (*Task, error)
+	grpc.ClientStream
+}
+
+type agentServiceTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceTasksClient) Recv() (*Task, error) {
+	m := new(Task)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) Report(ctx context.Context, opts ...grpc.CallOption) (AgentService_ReportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[1], "/openhost.agent.v1.AgentService/Report", withCodec(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	return &agentServiceReportClient{stream}, nil
+}
+
+type AgentService_ReportClient interface {
+	Send(*TaskReport) error
+	CloseAndRecv() (*ReportResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceReportClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceReportClient) Send(m *TaskReport) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceReportClient) CloseAndRecv() (*ReportResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ReportResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type AgentServiceServer interface {
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	Tasks(*TasksRequest, AgentService_TasksServer) error
+	Report(AgentService_ReportServer) error
+}
+
+func RegisterAgentServiceServer(s grpc.ServiceRegistrar, srv AgentServiceServer) {
+	s.RegisterService(&AgentService_ServiceDesc, srv)
+}
+
+func _AgentService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/openhost.agent.v1.AgentService/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/openhost.agent.v1.AgentService/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Tasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TasksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServiceServer).Tasks(m, &agentServiceTasksServer{stream})
+}
+
+type AgentService_TasksServer interface {
+	Send(*Task) error
+	grpc.ServerStream
+}
+
+type agentServiceTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceTasksServer) Send(m *Task) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AgentService_Report_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).Report(&agentServiceReportServer{stream})
+}
+
+type AgentService_ReportServer interface {
+	SendAndClose(*ReportResponse) error
+	Recv() (*TaskReport, error)
+	grpc.ServerStream
+}
+
+type agentServiceReportServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceReportServer) SendAndClose(m *ReportResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceReportServer) Recv() (*TaskReport, error) {
+	m := new(TaskReport)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var AgentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "openhost.agent.v1.AgentService",
+	HandlerType: (*AgentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _AgentService_Register_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _AgentService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Tasks",
+			Handler:       _AgentService_Tasks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Report",
+			Handler:       _AgentService_Report_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pkg/proto/agent.proto",
+}
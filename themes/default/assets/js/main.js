@@ -32,17 +32,201 @@
         document.documentElement.setAttribute('data-theme', theme);
     };
 
-    const storedTheme = localStorage.getItem('openhost-theme');
+    // Signed in users get the appearance stored on their account, which
+    // the toggle updates; visitors keep theirs in local storage
+    const accountAppearance = document.documentElement.dataset.appearance;
+    const storedTheme = accountAppearance || localStorage.getItem('openhost-theme');
     if (storedTheme) {
         applyTheme(storedTheme);
     }
 
     if (themeToggle) {
         themeToggle.addEventListener('click', () => {
-            const current = document.documentElement.getAttribute('data-theme') || 'light';
+            const systemTheme = window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light';
+            const current = document.documentElement.getAttribute('data-theme') || systemTheme;
             const next = current === 'light' ? 'dark' : 'light';
             applyTheme(next);
             localStorage.setItem('openhost-theme', next);
+            if (accountAppearance) {
+                fetch('/api/v1/account/appearance', {
+                    method: 'PUT',
+                    credentials: 'same-origin',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ appearance: next })
+                }).catch(() => {});
+            }
         });
     }
+
+    // Admin lists load their rows page by page from a data endpoint using
+    // the DataTables server-side parameters
+    const initAdminTable = (table) => {
+        if (table.dataset.tableReady) {
+            return;
+        }
+        table.dataset.tableReady = 'true';
+
+        const source = table.dataset.adminTable;
+        const tbody = table.querySelector('tbody');
+        const headers = Array.from(table.querySelectorAll('th[data-column]'));
+        const search = document.querySelector(`[data-table-search="${source}"]`);
+        const filters = Array.from(document.querySelectorAll(`[data-table-filter="${source}"]`));
+        const pager = document.querySelector(`[data-table-pager="${source}"]`);
+        const state = { draw: 0, start: 0, length: 25, sort: -1, dir: 'asc', search: '' };
+
+        const formatCell = (row, header) => {
+            const value = row[header.dataset.column];
+            if (value === null || value === undefined) {
+                return '';
+            }
+            switch (header.dataset.format) {
+            case 'date':
+                return String(value).slice(0, 10);
+            case 'money':
+                // Labels are formatted for the language of the page
+                if (row[`${header.dataset.column}_label`]) {
+                    return row[`${header.dataset.column}_label`];
+                }
+                return row.currency ? `${value} ${row.currency}` : value;
+            default:
+                return value;
+            }
+        };
+
+        const renderPager = (filtered) => {
+            if (!pager) {
+                return;
+            }
+            pager.replaceChildren();
+            const from = filtered === 0 ? 0 : state.start + 1;
+            const to = Math.min(state.start + state.length, filtered);
+            const summary = document.createElement('span');
+            summary.textContent = `${from}-${to} / ${filtered}`;
+
+            const button = (label, disabled, start) => {
+                const el = document.createElement('button');
+                el.type = 'button';
+                el.className = 'button button-ghost';
+                el.textContent = label;
+                el.disabled = disabled;
+                el.addEventListener('click', () => {
+                    state.start = start;
+                    load();
+                });
+                return el;
+            };
+            pager.append(
+                summary,
+                button(pager.dataset.previousLabel || 'Previous', state.start === 0, Math.max(state.start - state.length, 0)),
+                button(pager.dataset.nextLabel || 'Next', to >= filtered, state.start + state.length),
+            );
+        };
+
+        const load = () => {
+            state.draw += 1;
+            const params = new URLSearchParams({
+                draw: state.draw,
+                start: state.start,
+                length: state.length,
+                'search[value]': state.search,
+            });
+            headers.forEach((header, index) => params.append(`columns[${index}][data]`, header.dataset.column));
+            filters.forEach((filter) => {
+                if (filter.value) {
+                    params.append(filter.name, filter.value);
+                }
+            });
+            if (state.sort >= 0) {
+                params.append('order[0][column]', state.sort);
+                params.append('order[0][dir]', state.dir);
+            }
+
+            fetch(`${source}?${params}`, { credentials: 'same-origin', headers: { Accept: 'application/json' } })
+                .then((response) => response.json())
+                .then((result) => {
+                    // Ignore responses of requests made before the latest one
+                    if (result.draw !== state.draw || !Array.isArray(result.data)) {
+                        return;
+                    }
+                    tbody.replaceChildren(...result.data.map((row) => {
+                        const tr = document.createElement('tr');
+                        headers.forEach((header) => {
+                            const td = document.createElement('td');
+                            td.textContent = formatCell(row, header);
+                            tr.append(td);
+                        });
+                        return tr;
+                    }));
+                    renderPager(result.recordsFiltered);
+                });
+        };
+
+        headers.forEach((header, index) => {
+            if (!header.hasAttribute('data-sortable')) {
+                return;
+            }
+            header.addEventListener('click', () => {
+                state.dir = state.sort === index && state.dir === 'asc' ? 'desc' : 'asc';
+                state.sort = index;
+                state.start = 0;
+                headers.forEach((h) => h.removeAttribute('data-sort'));
+                header.dataset.sort = state.dir;
+                load();
+            });
+        });
+
+        if (search) {
+            let timer;
+            search.addEventListener('input', () => {
+                clearTimeout(timer);
+                timer = setTimeout(() => {
+                    state.search = search.value.trim();
+                    state.start = 0;
+                    load();
+                }, 300);
+            });
+        }
+
+        filters.forEach((filter) => {
+            filter.addEventListener('change', () => {
+                state.start = 0;
+                load();
+            });
+        });
+
+        load();
+    };
+
+    // Service pages show a banner while maintenance affecting the service
+    // is under way
+    document.querySelectorAll('[data-maintenance-banner]').forEach((banner) => {
+        fetch(banner.dataset.maintenanceBanner, { credentials: 'same-origin', headers: { Accept: 'application/json' } })
+            .then((response) => (response.ok ? response.json() : []))
+            .then((windows) => {
+                const current = windows.find((entry) => entry.active);
+                if (!current) {
+                    return;
+                }
+                const title = document.createElement('strong');
+                title.textContent = `${banner.dataset.label}: ${current.title}`;
+                const period = document.createElement('div');
+                period.textContent = `${new Date(current.starts_at).toLocaleString()} - ${new Date(current.ends_at).toLocaleString()}`;
+                banner.replaceChildren(title, period);
+                if (current.message) {
+                    const message = document.createElement('div');
+                    message.textContent = current.message;
+                    banner.append(message);
+                }
+                banner.hidden = false;
+            })
+            .catch(() => {});
+    });
+
+    const initAdminTables = (root) => {
+        root.querySelectorAll('[data-admin-table]').forEach(initAdminTable);
+    };
+
+    initAdminTables(document);
+    // Pages swapped in by HTMX bring their own tables
+    document.addEventListener('htmx:load', (event) => initAdminTables(event.target));
 })();
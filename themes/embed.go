@@ -0,0 +1,11 @@
+// Package themes embeds the default theme into the binary, so OpenHost
+// renders pages even when the themes directory is missing. Files in the
+// themes directory take precedence over the embedded copies.
+package themes
+
+import "embed"
+
+// FS holds the default theme, rooted at the themes directory
+//
+//go:embed default
+var FS embed.FS